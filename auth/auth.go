@@ -0,0 +1,145 @@
+// Package auth signs and verifies access tokens. Tokens are HS256 JWTs
+// naming their signing key in the kid header, so the key can be rotated
+// without logging every player out. The middlewares, the socket server and
+// token issuance all go through here, as does hashing OTP codes for storage.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"fiberapp/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrNotConfigured = errors.New("auth: no signing key configured")
+	ErrUnknownKey    = errors.New("token signed with an unknown key")
+)
+
+// Keyset is the current signing key and the previous keys still accepted
+type Keyset struct {
+	currentID string
+	keys      map[string][]byte
+	// order is the current key then the previous ones, tried in turn for
+	// tokens issued before they carried a kid
+	order []string
+}
+
+// NewKeyset builds the keyset of cfg; config.Validate has checked the keys
+func NewKeyset(cfg config.AuthConfig) (*Keyset, error) {
+	if cfg.JWTKeyID == "" || cfg.JWTSecret == "" {
+		return nil, ErrNotConfigured
+	}
+	k := &Keyset{
+		currentID: cfg.JWTKeyID,
+		keys:      map[string][]byte{cfg.JWTKeyID: []byte(cfg.JWTSecret)},
+		order:     []string{cfg.JWTKeyID},
+	}
+	previous := make([]string, 0, len(cfg.JWTPreviousKeys))
+	for kid := range cfg.JWTPreviousKeys {
+		if kid == cfg.JWTKeyID {
+			return nil, fmt.Errorf("auth: previous key %q reuses the current kid", kid)
+		}
+		previous = append(previous, kid)
+	}
+	sort.Strings(previous)
+	for _, kid := range previous {
+		k.keys[kid] = []byte(cfg.JWTPreviousKeys[kid])
+		k.order = append(k.order, kid)
+	}
+	return k, nil
+}
+
+// Sign returns claims as a token signed with the current key
+func (k *Keyset) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = k.currentID
+	return token.SignedString(k.keys[k.currentID])
+}
+
+// Verify checks the signature and expiry of tokenString and returns its
+// claims. A token is checked against the key its kid names; one without a
+// kid against every key, current first.
+func (k *Keyset) Verify(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, k.keyFunc, jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid or expired token")
+	}
+	return claims, nil
+}
+
+func (k *Keyset) keyFunc(token *jwt.Token) (interface{}, error) {
+	raw, named := token.Header["kid"]
+	if !named {
+		set := jwt.VerificationKeySet{}
+		for _, kid := range k.order {
+			set.Keys = append(set.Keys, k.keys[kid])
+		}
+		return set, nil
+	}
+	kid, _ := raw.(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+var current struct {
+	mu     sync.RWMutex
+	keyset *Keyset
+	otpKey []byte
+}
+
+// Configure installs the keyset of cfg for Sign and Verify and its OTP key
+// for HashOTP. Both binaries call it at startup; until then every token is
+// rejected.
+func Configure(cfg config.AuthConfig) error {
+	k, err := NewKeyset(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.OTPKey == "" {
+		return ErrNotConfigured
+	}
+	current.mu.Lock()
+	defer current.mu.Unlock()
+	current.keyset = k
+	current.otpKey = []byte(cfg.OTPKey)
+	return nil
+}
+
+func keyset() (*Keyset, error) {
+	current.mu.RLock()
+	defer current.mu.RUnlock()
+	if current.keyset == nil {
+		return nil, ErrNotConfigured
+	}
+	return current.keyset, nil
+}
+
+// Sign signs claims with the configured current key
+func Sign(claims jwt.MapClaims) (string, error) {
+	k, err := keyset()
+	if err != nil {
+		return "", err
+	}
+	return k.Sign(claims)
+}
+
+// Verify verifies tokenString against the configured keyset
+func Verify(tokenString string) (jwt.MapClaims, error) {
+	k, err := keyset()
+	if err != nil {
+		return nil, err
+	}
+	return k.Verify(tokenString)
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"fiberapp/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	oldSecret = "old-secret-old-secret-old-secret-0"
+	newSecret = "new-secret-new-secret-new-secret-1"
+)
+
+func keysetOf(t *testing.T, cfg config.AuthConfig) *Keyset {
+	t.Helper()
+	k, err := NewKeyset(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func claimsFor(msisdn string, ttl time.Duration) jwt.MapClaims {
+	return jwt.MapClaims{"msisdn": msisdn, "exp": time.Now().Add(ttl).Unix()}
+}
+
+func TestSignSetsKid(t *testing.T) {
+	k := keysetOf(t, config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret})
+	signed, err := k.Sign(claimsFor("254712345678", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != "k1" || token.Method.Alg() != "HS256" {
+		t.Errorf("header = %v, want kid k1 and HS256", token.Header)
+	}
+}
+
+func TestVerifyAcrossRotation(t *testing.T) {
+	before := keysetOf(t, config.AuthConfig{JWTKeyID: "k0", JWTSecret: oldSecret})
+	old, err := before.Sign(claimsFor("254712345678", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := before.Sign(claimsFor("254712345678", -time.Minute))
+
+	after := keysetOf(t, config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, JWTPreviousKeys: map[string]string{"k0": oldSecret}})
+	claims, err := after.Verify(old)
+	if err != nil || claims["msisdn"] != "254712345678" {
+		t.Fatalf("old-key token after rotation = %v, %v; want accepted", claims, err)
+	}
+	if _, err := after.Verify(expired); err == nil {
+		t.Error("expired old-key token accepted")
+	}
+	fresh, _ := after.Sign(claimsFor("254712345678", time.Hour))
+	if _, err := after.Verify(fresh); err != nil {
+		t.Errorf("new-key token = %v", err)
+	}
+	if _, err := before.Verify(fresh); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("new-key token on the old keyset = %v, want ErrUnknownKey", err)
+	}
+
+	dropped := keysetOf(t, config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret})
+	if _, err := dropped.Verify(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("old-key token once k0 is dropped = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestVerifyRejectsForgedKid(t *testing.T) {
+	k := keysetOf(t, config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, JWTPreviousKeys: map[string]string{"k0": oldSecret}})
+
+	// A token naming k1 but signed with k0 fails the signature
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("254712345678", time.Hour))
+	token.Header["kid"] = "k1"
+	forged, _ := token.SignedString([]byte(oldSecret))
+	if _, err := k.Verify(forged); err == nil {
+		t.Error("token signed with k0 but naming k1 accepted")
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("254712345678", time.Hour))
+	token.Header["kid"] = "k9"
+	unknown, _ := token.SignedString([]byte(newSecret))
+	if _, err := k.Verify(unknown); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown kid = %v, want ErrUnknownKey", err)
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, claimsFor("254712345678", time.Hour))
+	token.Header["kid"] = "k1"
+	none, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := k.Verify(none); err == nil {
+		t.Error("unsigned token accepted")
+	}
+}
+
+func TestVerifyTokenWithoutKid(t *testing.T) {
+	k := keysetOf(t, config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, JWTPreviousKeys: map[string]string{"k0": oldSecret}})
+	for _, secret := range []string{newSecret, oldSecret} {
+		legacy, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("254712345678", time.Hour)).SignedString([]byte(secret))
+		if _, err := k.Verify(legacy); err != nil {
+			t.Errorf("kid-less token under a known key = %v", err)
+		}
+	}
+	stranger, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claimsFor("254712345678", time.Hour)).SignedString([]byte("someone-elses-secret-someone-else"))
+	if _, err := k.Verify(stranger); err == nil {
+		t.Error("kid-less token under an unknown key accepted")
+	}
+}
+
+func TestNewKeysetRejects(t *testing.T) {
+	if _, err := NewKeyset(config.AuthConfig{JWTKeyID: "k1"}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("no secret = %v, want ErrNotConfigured", err)
+	}
+	_, err := NewKeyset(config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, JWTPreviousKeys: map[string]string{"k1": oldSecret}})
+	if err == nil || !strings.Contains(err.Error(), "k1") {
+		t.Errorf("previous key reusing the current kid = %v, want rejected", err)
+	}
+}
+
+func TestConfigureWithoutSecret(t *testing.T) {
+	defer func(k *Keyset, otp []byte) { current.keyset, current.otpKey = k, otp }(current.keyset, current.otpKey)
+	current.keyset, current.otpKey = nil, nil
+
+	if err := Configure(config.AuthConfig{JWTKeyID: "k1", OTPKey: "otp"}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Configure without a secret = %v, want ErrNotConfigured", err)
+	}
+	if err := Configure(config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret}); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Configure without an otp key = %v, want ErrNotConfigured", err)
+	}
+	if _, err := Sign(claimsFor("254712345678", time.Hour)); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Sign before Configure = %v, want ErrNotConfigured", err)
+	}
+	if _, err := Verify("x.y.z"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Verify before Configure = %v, want ErrNotConfigured", err)
+	}
+
+	if err := Configure(config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, OTPKey: "otp"}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := Sign(claimsFor("254712345678", time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(signed); err != nil {
+		t.Errorf("Verify after Configure = %v", err)
+	}
+}
+
+func TestHashOTP(t *testing.T) {
+	defer func(k *Keyset, otp []byte) { current.keyset, current.otpKey = k, otp }(current.keyset, current.otpKey)
+	current.otpKey = nil
+	if _, err := HashOTP("254712345678", "login", "1234"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("HashOTP before Configure = %v, want ErrNotConfigured", err)
+	}
+
+	if err := Configure(config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, OTPKey: "otp-key-one"}); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(msisdn, purpose, code string) string {
+		h, err := HashOTP(msisdn, purpose, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	base := hash("254712345678", "login", "1234")
+	if len(base) != 64 || strings.Contains(base, "1234") {
+		t.Errorf("hash = %q, want 64 hex characters", base)
+	}
+	if hash("254712345678", "login", "1234") != base {
+		t.Error("the same code hashed twice differs")
+	}
+	for name, other := range map[string]string{
+		"another code":    hash("254712345678", "login", "1235"),
+		"another purpose": hash("254712345678", "withdraw", "1234"),
+		"another msisdn":  hash("254712345679", "login", "1234"),
+		"shifted fields":  hash("254712345678", "login1", "234"),
+	} {
+		if other == base {
+			t.Errorf("%s hashes alike", name)
+		}
+	}
+
+	if err := Configure(config.AuthConfig{JWTKeyID: "k1", JWTSecret: newSecret, OTPKey: "otp-key-two"}); err != nil {
+		t.Fatal(err)
+	}
+	if hash("254712345678", "login", "1234") == base {
+		t.Error("another key hashes alike")
+	}
+}
@@ -0,0 +1,112 @@
+// Package bootstrap is the startup the API and the socket server share:
+// config, logging, auth, the database pool and the services. Each is built
+// once per process, so a socket server embedded in the API uses the same
+// pool and services as the HTTP handlers.
+package bootstrap
+
+import (
+	"fiberapp/clock"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/controllers"
+	"fiberapp/database"
+	"fiberapp/flags"
+	"fiberapp/money"
+	"fiberapp/services"
+	"fiberapp/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// App is what a binary gets from New
+type App struct {
+	Config *config.Config
+	DB     *database.Database
+	Lucky  *services.LuckyNumberService
+}
+
+// LoadConfig parses the -config and -print-config flags and loads the
+// config. With -print-config it prints the effective config (secrets
+// redacted) and exits.
+func LoadConfig() (*config.Config, error) {
+	configPath := flag.String("config", config.DefaultPath, "path to config.yml")
+	printConfig := flag.Bool("print-config", false, "print the effective config (secrets redacted) and exit")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		return nil, err
+	}
+	if *printConfig {
+		if err := cfg.Print(); err != nil {
+			return nil, fmt.Errorf("failed to print config: %w", err)
+		}
+		os.Exit(0)
+	}
+	return cfg, nil
+}
+
+// New sets up logging and auth, connects the database and builds the
+// services from cfg. Close releases what it opened.
+func New(cfg *config.Config) (*App, error) {
+	// Use all available CPUs
+	runtime.GOMAXPROCS(runtime.NumCPU())
+
+	// JSON, no caller; smaller timestamp format keeps messages compact
+	logrus.SetLevel(cfg.LogLevel())
+	logrus.SetReportCaller(false)
+	logrus.SetFormatter(&logrus.JSONFormatter{TimestampFormat: time.RFC3339})
+	// OTP codes in flight never reach the log
+	logrus.AddHook(utils.SecretRedactionHook{})
+
+	if err := auth.Configure(cfg.Auth); err != nil {
+		return nil, err
+	}
+
+	if err := clock.Configure(cfg.Server.Timezone); err != nil {
+		return nil, err
+	}
+
+	logrus.Info("📦 Initializing database connection...")
+	if err := database.ConnectPostgres(cfg.Database); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	logrus.Info("✅ Database connected successfully")
+
+	db := database.NewDatabase(logrus.WithField("component", "database"))
+	// The lucky service only sees the PawaBox tables; aviator methods stay behind database.AviatorRepo
+	var luckyRepo database.LuckyRepo = db
+
+	logrus.Info("📦 Initializing services...")
+	services.Configure(cfg.Limits)
+	money.Configure(cfg.Limits)
+	services.ConfigureSettlementLag(cfg.SettlementLag)
+	services.ConfigureWebhooks(cfg.Webhooks)
+	services.ConfigureInboundCallbacks(cfg.Callbacks)
+	services.ConfigureSMS(cfg.SMS)
+	services.ConfigureSocketPush(cfg.Server.SocketPushURL)
+	services.ConfigureBetTiming(cfg.Logging.SlowBet)
+	lucky := services.NewLuckyNumberService(luckyRepo)
+	flags.Configure(lucky.FeatureFlag)
+	utils.ConfigureTokenRevocation(db.AccessTokenRevoked, cfg.Limits.RevocationCacheTTL)
+	utils.ConfigureSessionTouch(db.TouchSession, cfg.Limits.SessionTouchInterval)
+	utils.ConfigureAdmission(db.PoolUsage, cfg.Limits.AdmissionMaxInFlight, cfg.Limits.AdmissionPoolSaturation)
+	controllers.InitLuckyNumberService(lucky, luckyRepo)
+	controllers.ConfigureCallbacks(cfg.Callbacks)
+	controllers.ConfigureCompat(cfg.Compat)
+	logrus.Info("✅ Services initialized successfully")
+
+	return &App{Config: cfg, DB: db, Lucky: lucky}, nil
+}
+
+// Close releases the database pool. Call it once the servers have stopped
+// and background work has finished.
+func (a *App) Close() {
+	database.Close()
+}
@@ -0,0 +1,169 @@
+package bootstrap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/dbtest"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	testSecret = "bootstrap-test-signing-key-0123456789"
+	testOTPKey = "bootstrap-test-otp-key-0123456789"
+)
+
+func TestNewRefusesMissingSecret(t *testing.T) {
+	cfg := config.Default()
+	if _, err := New(&cfg); !errors.Is(err, auth.ErrNotConfigured) {
+		t.Fatalf("New without a secret = %v, want auth.ErrNotConfigured", err)
+	}
+}
+
+func TestNewRefusesBadTimezone(t *testing.T) {
+	cfg := config.Default()
+	cfg.Auth.JWTSecret, cfg.Auth.OTPKey = testSecret, testOTPKey
+	cfg.Server.Timezone = "Africa/Atlantis"
+	_, err := New(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "Africa/Atlantis") {
+		t.Fatalf("New with an unknown timezone = %v, want it named", err)
+	}
+}
+
+// databaseEnv is the DB_* environment naming TEST_DATABASE_URL
+func databaseEnv(t *testing.T) []string {
+	t.Helper()
+	dbtest.Open(t)
+	conn, err := pgx.ParseConfig(os.Getenv("TEST_DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []string{
+		"DB_HOST=" + conn.Host,
+		"DB_PORT=" + strconv.Itoa(int(conn.Port)),
+		"DB_USER=" + conn.User,
+		"DB_PASSWORD=" + conn.Password,
+		"DB_NAME=" + conn.Database,
+	}
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestNewIntegration(t *testing.T) {
+	for _, kv := range databaseEnv(t) {
+		name, value, _ := strings.Cut(kv, "=")
+		t.Setenv(name, value)
+	}
+	t.Setenv("JWT_SECRET", testSecret)
+	t.Setenv("OTP_KEY", testOTPKey)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte("production: {}\n"), 0o600)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer app.Close()
+	if app.DB == nil || app.Lucky == nil || app.Config != cfg {
+		t.Fatalf("app = %+v, want the database, the service and cfg", app)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := app.Lucky.GetMaintenance(ctx); err != nil {
+		t.Errorf("service cannot reach the database: %v", err)
+	}
+	if err := database.WarmPool(ctx, cfg.Database); err != nil {
+		t.Errorf("pool warmup = %v", err)
+	}
+}
+
+func TestBinariesStartAndStopIntegration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stops the binaries with SIGINT")
+	}
+	env := databaseEnv(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(path, []byte("production: {}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pkg := range []string{"cmd", "cmdsocket"} {
+		t.Run(pkg, func(t *testing.T) {
+			bin := filepath.Join(dir, pkg)
+			build := exec.Command("go", "build", "-o", bin, "fiberapp/"+pkg)
+			if out, err := build.CombinedOutput(); err != nil {
+				t.Fatalf("build: %v\n%s", err, out)
+			}
+
+			port, socketPort := freePort(t), freePort(t)
+			health := fmt.Sprintf("http://127.0.0.1:%d/health", port)
+			if pkg == "cmdsocket" {
+				health = fmt.Sprintf("http://127.0.0.1:%d/health", socketPort)
+			}
+			var log strings.Builder
+			cmd := exec.Command(bin, "-config", path)
+			cmd.Env = append(os.Environ(), env...)
+			cmd.Env = append(cmd.Env, "JWT_SECRET="+testSecret, "OTP_KEY="+testOTPKey,
+				"PORT="+strconv.Itoa(port), "SOCKET_PORT="+strconv.Itoa(socketPort), "SHUTDOWN_TIMEOUT=5s")
+			cmd.Stdout, cmd.Stderr = &log, &log
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			exited := make(chan error, 1)
+			go func() { exited <- cmd.Wait() }()
+
+			up := false
+			for deadline := time.Now().Add(20 * time.Second); !up && time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+				if resp, err := http.Get(health); err == nil {
+					resp.Body.Close()
+					up = resp.StatusCode == http.StatusOK
+				}
+			}
+			if !up {
+				cmd.Process.Kill()
+				<-exited
+				t.Fatalf("%s never became healthy:\n%s", pkg, log.String())
+			}
+
+			cmd.Process.Signal(syscall.SIGINT)
+			select {
+			case err := <-exited:
+				if err != nil {
+					t.Errorf("%s exited with %v:\n%s", pkg, err, log.String())
+				}
+			case <-time.After(15 * time.Second):
+				cmd.Process.Kill()
+				t.Fatalf("%s still running 15s after SIGINT:\n%s", pkg, log.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Package clock is where the app reads the time and decides what day it
+// is. The business day runs in one zone, Africa/Nairobi unless configured
+// otherwise, whatever zone the server or the database session is in: KPI
+// rows, daily caps and reports roll over at midnight there.
+package clock
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // the runtime image has no zoneinfo
+)
+
+// DefaultZone is the business zone when none is configured
+const DefaultZone = "Africa/Nairobi"
+
+var (
+	loc    = mustLoad(DefaultZone)
+	source = time.Now
+)
+
+func mustLoad(zone string) *time.Location {
+	l, err := time.LoadLocation(zone)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Configure sets the business zone by its IANA name. Call it at startup,
+// before anything reads the time.
+func Configure(zone string) error {
+	l, err := time.LoadLocation(zone)
+	if err != nil {
+		return fmt.Errorf("unknown time zone %q: %w", zone, err)
+	}
+	loc = l
+	return nil
+}
+
+// ConfigureSource makes Now read the time from now, time.Now when nil.
+// Tests pin the clock with it.
+func ConfigureSource(now func() time.Time) {
+	if now == nil {
+		now = time.Now
+	}
+	source = now
+}
+
+// Location returns the business zone
+func Location() *time.Location {
+	return loc
+}
+
+// Zone returns the IANA name of the business zone, as Postgres takes it
+func Zone() string {
+	return loc.String()
+}
+
+// Now returns the current time in the business zone
+func Now() time.Time {
+	return source().In(loc)
+}
+
+// Today returns the start of the current business day
+func Today() time.Time {
+	return StartOfDay(Now())
+}
+
+// StartOfDay returns midnight, in the business zone, of the business day t
+// falls on
+func StartOfDay(t time.Time) time.Time {
+	y, m, d := t.In(loc).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,69 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// pin fixes Now at t for the test
+func pin(t *testing.T, at time.Time) {
+	t.Helper()
+	ConfigureSource(func() time.Time { return at })
+	t.Cleanup(func() { ConfigureSource(nil) })
+}
+
+func TestDayBoundaryIsNairobiMidnight(t *testing.T) {
+	nbo := Location()
+	if Zone() != DefaultZone {
+		t.Fatalf("zone = %s, want %s", Zone(), DefaultZone)
+	}
+
+	// 23:59 in Nairobi is 20:59 UTC, the same calendar day in both
+	pin(t, time.Date(2026, 3, 31, 20, 59, 0, 0, time.UTC))
+	if got := Today(); !got.Equal(time.Date(2026, 3, 31, 0, 0, 0, 0, nbo)) {
+		t.Errorf("today at 23:59 = %v, want 31 March", got)
+	}
+	if got := Now().Format("2006-01-02 15:04"); got != "2026-03-31 23:59" {
+		t.Errorf("now = %s, want Nairobi wall time", got)
+	}
+
+	// 00:01 in Nairobi is still 21:01 on the previous day in UTC
+	pin(t, time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC))
+	if got := Today(); !got.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, nbo)) {
+		t.Errorf("today at 00:01 = %v, want 1 April", got)
+	}
+	if got := Today().UTC(); !got.Equal(time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC)) {
+		t.Errorf("the business day started at %v UTC, want 21:00 the day before", got)
+	}
+}
+
+func TestStartOfDay(t *testing.T) {
+	nbo := Location()
+	for _, tc := range []struct {
+		at   time.Time
+		want time.Time
+	}{
+		{time.Date(2026, 3, 31, 20, 59, 59, 0, time.UTC), time.Date(2026, 3, 31, 0, 0, 0, 0, nbo)},
+		{time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, nbo)},
+		{time.Date(2026, 4, 1, 0, 1, 0, 0, nbo), time.Date(2026, 4, 1, 0, 0, 0, 0, nbo)},
+		{time.Date(2026, 4, 1, 2, 0, 0, 0, time.FixedZone("WAT", 3600)), time.Date(2026, 4, 1, 0, 0, 0, 0, nbo)},
+	} {
+		if got := StartOfDay(tc.at); !got.Equal(tc.want) || got.Location() != nbo {
+			t.Errorf("StartOfDay(%v) = %v, want %v", tc.at, got, tc.want)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	t.Cleanup(func() { Configure(DefaultZone) })
+	if err := Configure("Mars/Olympus"); err == nil || Zone() != DefaultZone {
+		t.Errorf("unknown zone = %v, zone %s, want an error and the zone kept", err, Zone())
+	}
+	if err := Configure("UTC"); err != nil {
+		t.Fatal(err)
+	}
+	pin(t, time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC))
+	if got := Today(); !got.Equal(time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("today in UTC = %v, want 31 March", got)
+	}
+}
@@ -2,22 +2,23 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
-	"math/rand"
 	"os"
 	"os/signal"
 	"path"
 	"path/filepath"
-	"runtime"
 	"strconv"
-	"sync/atomic"
 	"time"
 
-	"fiberapp/config"
+	"fiberapp/bootstrap"
 	"fiberapp/controllers"
 	"fiberapp/database"
+	"fiberapp/middleware"
 	"fiberapp/routes"
 	"fiberapp/services"
+	"fiberapp/socket"
+	"fiberapp/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
@@ -26,54 +27,23 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var (
-	requestCount uint64
-)
-
 func main() {
-	// Use all available CPUs
-	runtime.GOMAXPROCS(runtime.NumCPU())
-
-	// ---------- Logger (JSON, no caller) ----------
-	logger := config.NewLogger()
-	logrus.SetLevel(logrus.InfoLevel)
-	logrus.SetReportCaller(false)
-	logrus.SetFormatter(&logrus.JSONFormatter{
-		// smaller timestamp format; keep messages compact
-		TimestampFormat: time.RFC3339,
-	})
-	_ = logger // keep existing usage if needed elsewhere
-
-	// ---------- Database ----------
-	logrus.Info("📦 Initializing database connection...")
-	// Let database.ConnectPostgres manage pooling config using config.yml.
-	if err := database.ConnectPostgres("config.yml"); err != nil {
-		logrus.Fatalf("❌ Failed to connect to database: %v", err)
+	// ---------- Config, logger, database and services ----------
+	cfg, err := bootstrap.LoadConfig()
+	if err != nil {
+		logrus.Fatalf("❌ %v", err)
 	}
-	defer database.Close()
-	logrus.Info("✅ Database connected successfully")
-
-	db := database.NewDatabase()
-
-	// ---------- Services ----------
-	logrus.Info("📦 Initializing services...")
-	luckyService := services.NewLuckyNumberService(db)
-	controllers.InitLuckyNumberService(db)
-	logrus.Info("✅ Services initialized successfully")
-
-	// ---------- Fiber config (tunable via env) ----------
-	// PREFORK env var enables preforking (good for CPU-bound loads / multiple forks).
-	prefork := os.Getenv("PREFORK") == "true"
-
-	// Concurrency: keep it reasonable so the runtime and kernel don't get overwhelmed.
-	// Tune via env var if needed.
-	defaultConcurrency := runtime.NumCPU() * 1024
-	if v := os.Getenv("FIBER_CONC"); v != "" {
-		// ignore parse error, keep default if invalid
-		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
-			defaultConcurrency = parsed
-		}
+	shared, err := bootstrap.New(cfg)
+	if err != nil {
+		logrus.Fatalf("❌ %v", err)
 	}
+	luckyService, db := shared.Lucky, shared.DB
+
+	// ---------- Fiber config ----------
+	// Prefork is good for CPU-bound loads / multiple forks. Concurrency should
+	// stay reasonable so the runtime and kernel don't get overwhelmed.
+	prefork := cfg.Server.Prefork
+	defaultConcurrency := cfg.Server.Concurrency
 
 	app := fiber.New(fiber.Config{
 		IdleTimeout:           60 * time.Second,
@@ -87,13 +57,21 @@ func main() {
 		EnablePrintRoutes:     false,
 		DisableStartupMessage: true,
 		Prefork:               prefork,
+
+		// c.IP() reads the proxy header only from trusted proxies; the
+		// callback allowlist relies on it
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxies,
+		EnableIPValidation:      true,
 	})
 
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowMethods: "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Access-Token",
-		MaxAge:       600,
+		AllowOrigins:  "*",
+		AllowMethods:  "GET,POST,PUT,DELETE,OPTIONS",
+		AllowHeaders:  "Origin, Content-Type, Accept, Accept-Language, Authorization, Idempotency-Key, X-Access-Token, X-Request-ID",
+		ExposeHeaders: utils.RequestIDHeader + ", Idempotent-Replayed",
+		MaxAge:        600,
 	}))
 
 	app.Options("/*", func(c *fiber.Ctx) error {
@@ -101,46 +79,25 @@ func main() {
 	})
 
 	// ---------- Middlewares ----------
+	// Request ID first so every later log line (and DB trace) can carry it
+	app.Use(utils.RequestIDMiddleware())
+
 	// Recover without stack trace in production
 	app.Use(recover.New(recover.Config{
 		EnableStackTrace: false,
 	}))
 
+	// 503 until the pool is warm; the probes stay reachable
+	app.Use(utils.ReadyMiddleware("/health", "/ready"))
+
 	// Compression to reduce bandwidth and latency (CPU < network cost typically)
 	app.Use(compress.New(compress.Config{
 		Level: compress.LevelDefault,
 	}))
 
-	// Light-weight request sampling logger - sampleRateEnv or default 100 (1%)
-	sampleRate := 100 // sample 1 in 100
-	if s := os.Getenv("LOG_SAMPLE_RATE"); s != "" {
-		if parsed, err := strconv.Atoi(s); err == nil && parsed > 0 {
-			sampleRate = parsed
-		}
-	}
-	// Seeded rand for sampling; atomic ensures safe concurrent access on counter
-	rand.Seed(time.Now().UnixNano())
-	app.Use(func(c *fiber.Ctx) error {
-		start := time.Now()
-		atomic.AddUint64(&requestCount, 1)
-
-		err := c.Next()
-
-		duration := time.Since(start)
-		current := atomic.LoadUint64(&requestCount)
-		// log either slow requests or probabilistically sample
-		if duration > 500*time.Millisecond || (int(current)%sampleRate == 0) {
-			// keep log fields minimal to reduce allocation
-			logrus.WithFields(logrus.Fields{
-				"m":  c.Method(),
-				"p":  c.Path(),
-				"d":  duration.Milliseconds(),
-				"s":  c.Response().StatusCode(),
-				"ip": c.IP(),
-			}).Info("request")
-		}
-		return err
-	})
+	// Request logger: samples 1 in logging.sample_rate, always logs 5xx and
+	// requests slower than logging.slow_request
+	app.Use(middleware.RequestLog(cfg.Logging.SampleRate, cfg.Logging.SlowRequest))
 
 	// inject shared services into context
 	app.Use(func(c *fiber.Ctx) error {
@@ -150,26 +107,31 @@ func main() {
 	})
 
 	// ---------- Routes ----------
+	routes.ConfigureDocs(cfg.Server.Docs)
 	routes.RegisterRoutes(app)
+	for _, problem := range routes.CheckOpenAPI(app) {
+		logrus.Warnf("openapi: %v", problem)
+	}
 
 	// simple health check
-	app.Get("/health", func(c *fiber.Ctx) error {
-		// small, fast payload
-		return c.Status(fiber.StatusOK).JSON(fiber.Map{
-			"status":    "healthy",
-			"service":   "Lucky Number Game API",
-			"timestamp": time.Now().Unix(),
-		})
+	app.Get("/health", controllers.HealthHandler("Lucky Number Game API", nil))
+
+	// readiness probe: 503 while the pool warms up and once shutdown begins
+	app.Get("/ready", func(c *fiber.Ctx) error {
+		if !utils.IsReady() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "not ready"})
+		}
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"status": "ready"})
 	})
 
 	// Resolve absolute path to uploads folder
 	// cwd, _ := os.Getwd()
-	uploadDir := "./profile_uploads"
+	uploadDir := services.ProfileUploadDir
 	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
 		_ = os.Mkdir(uploadDir, 0755)
 	}
 	log.Println("Serving images from:", uploadDir)
-	
+
 	app.Get("/image/:name", func(c *fiber.Ctx) error {
 		filename := path.Base(c.Params("name")) // prevent ../../ attacks
 		fullPath := filepath.Join(uploadDir, filename)
@@ -185,10 +147,7 @@ func main() {
 	})
 
 	// ---------- Start server ----------
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3007"
-	}
+	port := strconv.Itoa(cfg.Server.Port)
 
 	logrus.Infof("🚀 Starting server on port %s (prefork=%v, concurrency=%d)...", port, prefork, defaultConcurrency)
 
@@ -196,13 +155,81 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
+	listenErr := make(chan error, 3)
+
+	// Socket server in this process for single-process deployments. Like the
+	// internal API only the prefork parent runs it, and it must be up before
+	// the reveal dispatcher emits through it.
+	var sockets *socket.Server
+	if cfg.Server.SocketEmbedded && !fiber.IsChild() {
+		sockets = socket.New(cfg, luckyService)
+		services.ConfigureSocketEmitter(sockets.Emit)
+		logrus.Infof("🔌 Starting socket server on :%d...", cfg.Server.SocketPort)
+		go func() {
+			if err := sockets.ListenAndServe(); err != nil {
+				listenErr <- fmt.Errorf("socket server: %w", err)
+			}
+		}()
+	}
+
+	// Stuck-money monitor, OTP purge, account deletion, free bet expiry, webhook dispatcher, callback retries, balance snapshots and bet reveals; with prefork only the parent runs them so work is not repeated per child.
+	// The parent also checks the jackpot games against their kitties once, warning on mismatches.
+	if !fiber.IsChild() {
+		go controllers.WarnJackpotInconsistencies(ctx)
+		go controllers.RunSettlementLagMonitor(ctx)
+		go controllers.RunVerificationPurge(ctx)
+		go controllers.RunAccountDeletion(ctx)
+		go controllers.RunFreeBetExpiry(ctx)
+		go controllers.RunWebhookDispatcher(ctx)
+		go controllers.RunInboundCallbackDispatcher(ctx)
+		go controllers.RunBalanceSnapshots(ctx)
+		go controllers.RunRevealDispatcher(ctx)
+	}
+
 	// Run Listen in goroutine so we can respond to shutdown signals
-	listenErr := make(chan error, 1)
 	go func() {
-		if err := app.Listen(":" + port); err != nil {
-			listenErr <- err
+		listenErr <- app.Listen(":" + port)
+	}()
+
+	// Internal API for the USSD gateway, on its own listener. With prefork
+	// only the parent serves it, since children cannot share the address.
+	var internal *fiber.App
+	if cfg.Server.InternalAddr != "" && !fiber.IsChild() {
+		internal = fiber.New(fiber.Config{
+			IdleTimeout:           60 * time.Second,
+			ReadTimeout:           8 * time.Second,
+			WriteTimeout:          8 * time.Second,
+			AppName:               "Lucky Number Internal API",
+			DisableStartupMessage: true,
+		})
+		internal.Use(utils.RequestIDMiddleware())
+		internal.Use(recover.New(recover.Config{EnableStackTrace: false}))
+		internal.Use(utils.ReadyMiddleware())
+		internal.Use(middleware.RequestLog(cfg.Logging.SampleRate, cfg.Logging.SlowRequest))
+		internal.Use(func(c *fiber.Ctx) error {
+			c.Locals("luckyService", luckyService)
+			c.Locals("db", db)
+			return c.Next()
+		})
+		routes.RegisterInternalRoutes(internal, cfg.Server.InternalToken)
+
+		logrus.Infof("🔒 Starting internal API on %s...", cfg.Server.InternalAddr)
+		go func() {
+			if err := internal.Listen(cfg.Server.InternalAddr); err != nil {
+				listenErr <- fmt.Errorf("internal api: %w", err)
+			}
+		}()
+	}
+
+	// Warm the pool while the listeners answer 503, then go ready. A failed
+	// warmup is not fatal: the pool is connected and the first requests just
+	// pay for their own dials.
+	go func() {
+		if err := database.WarmPool(ctx, cfg.Database); err != nil {
+			logrus.Warnf("⚠️ Pool warmup incomplete: %v", err)
 		}
-		close(listenErr)
+		utils.MarkReady()
+		logrus.Info("✅ Ready to serve")
 	}()
 
 	// Wait for signal or server error
@@ -216,22 +243,38 @@ func main() {
 		}
 	}
 
-	// Graceful shutdown with timeout (tunable via env)
-	shutdownTimeout := 5 * time.Second
-	if st := os.Getenv("SHUTDOWN_TIMEOUT"); st != "" {
-		if parsed, err := strconv.Atoi(st); err == nil && parsed > 0 {
-			shutdownTimeout = time.Duration(parsed) * time.Second
-		}
-	}
-	_, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	// Graceful shutdown with timeout (server.shutdown_timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
-	if err := app.Shutdown(); err != nil {
+	// 1. stop taking new bets/deposits (503) while open connections finish
+	utils.BeginDrain()
+
+	// 2. stop the listeners and wait for in-flight handlers
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
 		logrus.Errorf("❌ Error during shutdown: %v", err)
-	} else {
-		// Wait for any remaining things for a short interval before exiting
-		<-time.After(100 * time.Millisecond)
 	}
+	if internal != nil {
+		if err := internal.ShutdownWithContext(shutdownCtx); err != nil {
+			logrus.Errorf("❌ Error during internal API shutdown: %v", err)
+		}
+	}
+	if sockets != nil {
+		if err := sockets.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("❌ Error during socket server shutdown: %v", err)
+		}
+	}
+
+	// 3. wait for background settlement goroutines that are still moving money
+	if n := utils.BackgroundInFlight(); n > 0 {
+		logrus.Infof("⏳ Waiting for %d background task(s) to finish", n)
+	}
+	if err := utils.WaitBackground(shutdownCtx); err != nil {
+		logrus.Errorf("❌ Shutdown timeout with %d background task(s) still running", utils.BackgroundInFlight())
+	}
+
+	// 4. only now release the pool
+	shared.Close()
 
 	logrus.Info("✅ Server gracefully stopped")
 }
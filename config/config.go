@@ -0,0 +1,1088 @@
+package config
+
+import (
+	"errors"
+	"fiberapp/clock"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the config file read when --config is not given
+const DefaultPath = "config.yml"
+
+// Config is every runtime setting for both binaries. It is built once by
+// Load from defaults, then config.yml, then environment variables.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Logging   LoggingConfig   `yaml:"logging"`
+	Limits    LimitsConfig    `yaml:"limits"`
+	SMS       SMSConfig       `yaml:"sms"`
+	Callbacks CallbacksConfig `yaml:"callbacks"`
+	Compat    CompatConfig    `yaml:"compat"`
+
+	SettlementLag SettlementLagConfig `yaml:"settlement_lag"`
+	Webhooks      WebhooksConfig      `yaml:"webhooks"`
+}
+
+type ServerConfig struct {
+	Port            int           `yaml:"port"`             // PORT
+	SocketPort      int           `yaml:"socket_port"`      // SOCKET_PORT
+	Prefork         bool          `yaml:"prefork"`          // PREFORK
+	Concurrency     int           `yaml:"concurrency"`      // FIBER_CONC
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // SHUTDOWN_TIMEOUT
+	SocketGuests    bool          `yaml:"socket_guests"`    // SOCKET_GUESTS, allow unauthenticated winners-feed sockets
+	SocketPushURL   string        `yaml:"socket_push_url"`  // SOCKET_PUSH_URL, the socket server's /push, e.g. http://127.0.0.1:3009/push; empty sends no bet_result events
+	SocketEmbedded  bool          `yaml:"socket_embedded"`  // SOCKET_EMBEDDED, run the socket server inside the API process on socket_port; bet_result events then skip socket_push_url
+	Docs            bool          `yaml:"docs"`             // DOCS_ENABLED, serve the Swagger UI at /api/v1/docs; keep off in production
+	Timezone        string        `yaml:"timezone"`         // APP_TIMEZONE, IANA zone of the business day: KPI rows, daily caps, reports and expiries roll over at its midnight
+
+	// Internal API for the USSD gateway; bind it to a private interface
+	InternalAddr  string `yaml:"internal_addr"`  // INTERNAL_ADDR, host:port; empty disables it
+	InternalToken string `yaml:"internal_token"` // INTERNAL_TOKEN, bearer token every internal call must send
+
+	// The client address behind a reverse proxy. ProxyHeader is read only
+	// on connections from TrustedProxies; from anyone else, and when it is
+	// empty, the address is the connection's. Name a header the proxy
+	// overwrites, e.g. X-Real-IP: the first X-Forwarded-For entry is the
+	// one a client sent.
+	ProxyHeader    string   `yaml:"proxy_header"`    // PROXY_HEADER
+	TrustedProxies []string `yaml:"trusted_proxies"` // TRUSTED_PROXIES, comma separated IPs or CIDRs
+}
+
+// AuthConfig holds the keys access tokens are signed with. A token names
+// its key in the kid header. To rotate, move the current key into
+// jwt_previous_keys, set a new jwt_key_id and jwt_secret, and drop the old
+// key once the tokens it signed have expired.
+type AuthConfig struct {
+	JWTKeyID        string            `yaml:"jwt_key_id"`        // JWT_KEY_ID, kid of the signing key
+	JWTSecret       string            `yaml:"jwt_secret"`        // JWT_SECRET, required, the signing key
+	JWTPreviousKeys map[string]string `yaml:"jwt_previous_keys"` // JWT_PREVIOUS_KEYS, comma separated kid:secret pairs still accepted but no longer signed with
+	OTPKey          string            `yaml:"otp_key"`           // OTP_KEY, required, the HMAC key OTP codes are stored under; changing it voids the codes in flight
+}
+
+type DatabaseConfig struct {
+	Host     string `yaml:"host"`     // DB_HOST
+	Port     int    `yaml:"port"`     // DB_PORT
+	User     string `yaml:"username"` // DB_USER
+	Password string `yaml:"password"` // DB_PASSWORD
+	Name     string `yaml:"database"` // DB_NAME
+	MaxConns int32  `yaml:"max_conns"`
+	MinConns int32  `yaml:"min_conns"`
+
+	// Optional read replica for history and report queries
+	ReplicaEnabled    bool          `yaml:"replica_enabled"`    // DB_REPLICA_ENABLED
+	ReplicaDSN        string        `yaml:"replica_dsn"`        // DB_REPLICA_DSN, postgres:// URL
+	ReplicaStickiness time.Duration `yaml:"replica_stickiness"` // DB_REPLICA_STICKINESS, keep a player on the primary this long after a write
+
+	// Startup warmup; /ready answers 503 until it is done
+	WarmConns   int32         `yaml:"warm_conns"`   // DB_WARM_CONNS, connections opened before ready, 0 = min_conns
+	WarmTimeout time.Duration `yaml:"warm_timeout"` // DB_WARM_TIMEOUT, give up warming after this and go ready anyway
+	WarmQueries []string      `yaml:"warm_queries"` // DB_WARM_QUERIES, comma separated, see WarmQueryNames
+}
+
+// WarmQueryNames are the hot queries database.WarmPool can prepare on each
+// warmed connection
+var WarmQueryNames = []string{"check_user", "check_setting", "get_game", "check_setting_kpi"}
+
+type LoggingConfig struct {
+	Level       string        `yaml:"level"`        // LOG_LEVEL
+	SampleRate  int           `yaml:"sample_rate"`  // LOG_SAMPLE_RATE, log each request with probability 1/N
+	SlowRequest time.Duration `yaml:"slow_request"` // LOG_SLOW_REQUEST, always log requests slower than this; 0 disables
+	SlowBet     time.Duration `yaml:"slow_bet"`     // LOG_SLOW_BET, log the stage timings of bets and deposits slower than this; 0 disables
+}
+
+type LimitsConfig struct {
+	PlayerCacheSize  int           `yaml:"player_cache_size"`  // PLAYER_CACHE_SIZE
+	PlayerCacheTTL   time.Duration `yaml:"player_cache_ttl"`   // PLAYER_CACHE_TTL
+	WinnersMinAmount float64       `yaml:"winners_min_amount"` // WINNERS_MIN_AMOUNT
+	LookupCacheTTL   time.Duration `yaml:"lookup_cache_ttl"`   // LOOKUP_CACHE_TTL, games and settings
+	LookupMissTTL    time.Duration `yaml:"lookup_miss_ttl"`    // LOOKUP_MISS_TTL, unknown game ids
+
+	TransferMinAmount    float64 `yaml:"transfer_min_amount"`    // TRANSFER_MIN_AMOUNT
+	TransferOTPThreshold float64 `yaml:"transfer_otp_threshold"` // TRANSFER_OTP_THRESHOLD, larger transfers need an OTP
+
+	DepositMin    float64 `yaml:"deposit_min"`    // DEPOSIT_MIN, floor under the settings' min_deposit; gateway deposits outside the bounds are flagged for review
+	DepositMax    float64 `yaml:"deposit_max"`    // DEPOSIT_MAX, ceiling over the settings' max_deposit
+	AdjustmentMax float64 `yaml:"adjustment_max"` // ADJUSTMENT_MAX, largest admin bonus grant or basket top-up; 0 is no limit
+
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"` // REFRESH_TOKEN_TTL
+	LoginMinLatency time.Duration `yaml:"login_min_latency"` // LOGIN_MIN_LATENCY, pads /login so new and existing numbers answer alike
+
+	RevocationCacheTTL time.Duration `yaml:"revocation_cache_ttl"` // REVOCATION_CACHE_TTL, how long a revoked access token may keep working in another process
+
+	MaxSessions          int           `yaml:"max_sessions"`           // MAX_SESSIONS, live sessions a player may hold at once; 0 is no limit
+	SessionLimitPolicy   string        `yaml:"session_limit_policy"`   // SESSION_LIMIT_POLICY, what a login past max_sessions does, see SessionLimitPolicies
+	SessionTouchInterval time.Duration `yaml:"session_touch_interval"` // SESSION_TOUCH_INTERVAL, how often a session in use has its last_seen written
+
+	IdempotencyTTL     time.Duration `yaml:"idempotency_ttl"`      // IDEMPOTENCY_TTL, replay answers to an Idempotency-Key this long
+	DuplicateBetWindow time.Duration `yaml:"duplicate_bet_window"` // DUPLICATE_BET_WINDOW, reject identical keyless bets and deposits this close together; 0 disables
+	BetThrottleStore   string        `yaml:"bet_throttle_store"`   // BET_THROTTLE_STORE, where players' bet cooldowns and per-minute caps are counted, see BetThrottleStores
+
+	AdmissionMaxInFlight    int           `yaml:"admission_max_in_flight"`   // ADMISSION_MAX_IN_FLIGHT, money requests a process runs at once before answering 503; 0 disables
+	AdmissionPoolSaturation float64       `yaml:"admission_pool_saturation"` // ADMISSION_POOL_SATURATION, answer money requests 503 once this share of the DB pool is acquired; 0 disables
+	MaxConcurrentPlays      int           `yaml:"max_concurrent_plays"`      // MAX_CONCURRENT_PLAYS, games a process plays at once
+	PlayQueueTimeout        time.Duration `yaml:"play_queue_timeout"`        // PLAY_QUEUE_TIMEOUT, how long a bet waits for a free play slot before 503
+	AccountingWorkers       int           `yaml:"accounting_workers"`        // ACCOUNTING_WORKERS, statements of bets' accounting a process runs at once, at most database.max_conns; keep it below so other queries find a connection
+
+	OTPResendMax      int           `yaml:"otp_resend_max"`      // OTP_RESEND_MAX, resends allowed per OTP
+	OTPResendCooldown time.Duration `yaml:"otp_resend_cooldown"` // OTP_RESEND_COOLDOWN, wait between sends of the same OTP
+	MsisdnChangeTTL   time.Duration `yaml:"msisdn_change_ttl"`   // MSISDN_CHANGE_TTL, how long a requested phone number change holds the new number
+	OTPPlaintextGrace time.Duration `yaml:"otp_plaintext_grace"` // OTP_PLAINTEXT_GRACE, how long a code stored in plaintext before hashing still verifies, and an OTP SMS keeps its text in dbQueue, before the purge job clears them
+
+	VerificationPurgeInterval time.Duration `yaml:"verification_purge_interval"` // VERIFICATION_PURGE_INTERVAL, 0 disables the purge job
+	VerificationRetention     time.Duration `yaml:"verification_retention"`      // VERIFICATION_RETENTION, keep used/expired OTPs this long
+	DecisionRetention         time.Duration `yaml:"decision_retention"`          // DECISION_RETENTION, keep outcome decisions this long, purged with the OTPs; 0 keeps them
+
+	DeletionInterval  time.Duration `yaml:"deletion_interval"`  // DELETION_INTERVAL, 0 disables the account deletion job
+	DeletionRetention time.Duration `yaml:"deletion_retention"` // DELETION_RETENTION, wait this long after a deletion request before anonymizing
+
+	FreeBetExpiryInterval time.Duration `yaml:"freebet_expiry_interval"` // FREEBET_EXPIRY_INTERVAL, 0 disables the free bet expiry job
+	FreeBetExpiryBatch    int           `yaml:"freebet_expiry_batch"`    // FREEBET_EXPIRY_BATCH, players expired per transaction
+	FreeBetExpiryMax      int           `yaml:"freebet_expiry_max"`      // FREEBET_EXPIRY_MAX, players expired per run; the rest wait for the next
+	FreeBetExpirySMS      bool          `yaml:"freebet_expiry_sms"`      // FREEBET_EXPIRY_SMS, tell players their free bets expired unless they opted out of SMS
+
+	DefaultShortcode string `yaml:"default_shortcode"` // DEFAULT_SHORTCODE, STK push shortcode when no active row in "shortcodes" matches
+
+	STKRetryMax     int           `yaml:"stk_retry_max"`     // STK_RETRY_MAX, re-pushes allowed per deposit request; 0 disables /retry_stk
+	STKRetrySpacing time.Duration `yaml:"stk_retry_spacing"` // STK_RETRY_SPACING, wait after a push before it can be sent again
+	STKRetryMaxAge  time.Duration `yaml:"stk_retry_max_age"` // STK_RETRY_MAX_AGE, deposit requests older than this are not re-pushed
+
+	OpenRoundMaxAge time.Duration `yaml:"open_round_max_age"` // OPEN_ROUND_MAX_AGE, /open_rounds leaves out deposits and bets older than this; reconciliation owns those
+
+	WithdrawalRetryMax int           `yaml:"withdrawal_retry_max"` // WITHDRAWAL_RETRY_MAX, admin re-drives per withdrawal before it is flagged for manual resolution
+	WithdrawalStuckAge time.Duration `yaml:"withdrawal_stuck_age"` // WITHDRAWAL_STUCK_AGE, an unanswered disbursement older than this is stuck and may be re-driven
+
+	BonusWagering float64 `yaml:"bonus_wagering"` // BONUS_WAGERING, stake required per shilling of bonus before it converts to cash
+	BonusFirst    bool    `yaml:"bonus_first"`    // BONUS_FIRST, take stakes from the bonus wallet before cash
+
+	ReversalAllowNegative bool `yaml:"reversal_allow_negative"` // REVERSAL_ALLOW_NEGATIVE, else clamp at 0 and record a debt
+
+	DemoBalance    float64       `yaml:"demo_balance"`     // DEMO_BALANCE, fake balance a demo session starts with
+	DemoSessionTTL time.Duration `yaml:"demo_session_ttl"` // DEMO_SESSION_TTL, idle demo wallets are dropped after this
+
+	RevealInterval time.Duration `yaml:"reveal_interval"` // REVEAL_INTERVAL, how often delayed bet outcomes are pushed and their SMS sent; 0 disables the reveal job
+
+	ReportTolerance float64 `yaml:"report_tolerance"` // REPORT_TOLERANCE, Ksh a kpi counter may differ from the finance report's recomputed sum before it is listed as a discrepancy
+	SnapshotTime    string  `yaml:"snapshot_time"`    // SNAPSHOT_TIME, HH:MM in the business zone when the day's basket and house income snapshots are taken; "" disables the snapshot job
+
+	ExposureCapStrict bool `yaml:"exposure_cap_strict"` // EXPOSURE_CAP_STRICT, pause a game that reaches its daily_exposure_cap instead of only capping its wins
+}
+
+// Session limit policies: what a login does when the player already holds
+// limits.max_sessions live sessions
+const (
+	SessionRevokeOldest = "revoke_oldest" // log the oldest session out
+	SessionReject       = "reject"        // refuse the login
+)
+
+var SessionLimitPolicies = []string{SessionRevokeOldest, SessionReject}
+
+// Bet throttle stores: where limits.bet_throttle_store counts the settings'
+// bet_cooldown_ms and max_bets_per_minute
+const (
+	BetThrottleMemory   = "memory"   // per process; with prefork or several instances each counts apart
+	BetThrottleDatabase = "database" // the bet_throttle table, shared by every process
+)
+
+var BetThrottleStores = []string{BetThrottleMemory, BetThrottleDatabase}
+
+type SMSConfig struct {
+	URL      string `yaml:"url"`       // SMS_URL
+	SenderID string `yaml:"sender_id"` // SMS_SENDER_ID
+
+	ResultsOptOut bool `yaml:"results_opt_out"` // SMS_RESULTS_OPT_OUT, win/loss SMS honour the player's sms_notifications setting
+
+	// Call to action in bet and deposit SMS, by the channel the player used.
+	// Web and app fall back to the USSD code when empty.
+	CTAUSSD string `yaml:"cta_ussd"` // SMS_CTA_USSD
+	CTAWeb  string `yaml:"cta_web"`  // SMS_CTA_WEB, the web app URL
+	CTAApp  string `yaml:"cta_app"`  // SMS_CTA_APP, the app deep link
+}
+
+type CallbacksConfig struct {
+	Strict     bool     `yaml:"strict"`      // CALLBACK_STRICT
+	AllowedIPs []string `yaml:"allowed_ips"` // CALLBACK_ALLOWED_IPS, comma separated
+
+	// Stored callbacks (settle_bt) whose processing failed are retried after
+	// BackoffBase, doubling up to BackoffMax, until MaxAttempts
+	RetryInterval time.Duration `yaml:"retry_interval"` // CALLBACK_RETRY_INTERVAL, how often the dispatcher looks for due callbacks
+	Lease         time.Duration `yaml:"lease"`          // CALLBACK_LEASE, how long a claimed callback is left to its worker before another may take it
+	MaxAttempts   int           `yaml:"max_attempts"`   // CALLBACK_MAX_ATTEMPTS
+	BackoffBase   time.Duration `yaml:"backoff_base"`   // CALLBACK_BACKOFF_BASE
+	BackoffMax    time.Duration `yaml:"backoff_max"`    // CALLBACK_BACKOFF_MAX
+}
+
+// SettlementLagConfig controls the stuck-money monitor. A bucket alerts when
+// its stuck rows exceed MaxCount or their total exceeds MaxAmount.
+type SettlementLagConfig struct {
+	Interval      time.Duration   `yaml:"interval"`       // LAG_INTERVAL
+	AlertInterval time.Duration   `yaml:"alert_interval"` // LAG_ALERT_INTERVAL, quiet period between repeat alerts per bucket
+	WebhookURL    string          `yaml:"webhook_url"`    // LAG_WEBHOOK_URL, Slack incoming webhook for lag and basket-short alerts; empty logs only
+	Deposits      LagBucketConfig `yaml:"deposits"`       // LAG_DEPOSITS_AGE, LAG_DEPOSITS_MAX_COUNT, LAG_DEPOSITS_MAX_AMOUNT
+	Withdrawals   LagBucketConfig `yaml:"withdrawals"`    // LAG_WITHDRAWALS_*
+	Bets          LagBucketConfig `yaml:"bets"`           // LAG_BETS_*
+	Callbacks     LagBucketConfig `yaml:"callbacks"`      // LAG_CALLBACKS_*, inbound callbacks still pending after age; failed ones count at once
+}
+
+type LagBucketConfig struct {
+	Age       time.Duration `yaml:"age"` // rows older than this count as stuck
+	MaxCount  int           `yaml:"max_count"`
+	MaxAmount float64       `yaml:"max_amount"`
+}
+
+// WebhooksConfig controls delivery of partner webhooks. A failed delivery is
+// retried after BackoffBase, doubling up to BackoffMax, until MaxAttempts.
+type WebhooksConfig struct {
+	Interval    time.Duration `yaml:"interval"`     // WEBHOOK_INTERVAL, how often the dispatcher looks for due events
+	Timeout     time.Duration `yaml:"timeout"`      // WEBHOOK_TIMEOUT, per delivery attempt
+	MaxAttempts int           `yaml:"max_attempts"` // WEBHOOK_MAX_ATTEMPTS
+	BackoffBase time.Duration `yaml:"backoff_base"` // WEBHOOK_BACKOFF_BASE
+	BackoffMax  time.Duration `yaml:"backoff_max"`  // WEBHOOK_BACKOFF_MAX
+}
+
+// CompatConfig keeps legacy client-facing behavior during client migrations
+type CompatConfig struct {
+	LegacyOTPStatus bool `yaml:"legacy_otp_status"` // LEGACY_OTP_STATUS, answer failed OTP checks with 201
+}
+
+// fileConfig is the layout of config.yml. The postgres block predates the
+// other sections and keeps its original shape. Each field points into the
+// Config being loaded, so keys missing from the file keep their defaults.
+type fileConfig struct {
+	Production struct {
+		Postgres struct {
+			Connection *DatabaseConfig `yaml:"connection"`
+		} `yaml:"postgres"`
+		Server    *ServerConfig    `yaml:"server"`
+		Auth      *AuthConfig      `yaml:"auth"`
+		Logging   *LoggingConfig   `yaml:"logging"`
+		Limits    *LimitsConfig    `yaml:"limits"`
+		SMS       *SMSConfig       `yaml:"sms"`
+		Callbacks *CallbacksConfig `yaml:"callbacks"`
+		Compat    *CompatConfig    `yaml:"compat"`
+
+		SettlementLag *SettlementLagConfig `yaml:"settlement_lag"`
+		Webhooks      *WebhooksConfig      `yaml:"webhooks"`
+	} `yaml:"production"`
+}
+
+// Default returns the values used when neither the file nor env sets a field
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            3007,
+			SocketPort:      3006,
+			Concurrency:     runtime.NumCPU() * 1024,
+			ShutdownTimeout: 5 * time.Second,
+			SocketGuests:    true,
+			Timezone:        clock.DefaultZone,
+		},
+		Auth: AuthConfig{
+			JWTKeyID: "1",
+		},
+		Database: DatabaseConfig{
+			Port:     5432,
+			MaxConns: 100,
+			MinConns: 5,
+
+			ReplicaStickiness: 10 * time.Second,
+
+			WarmTimeout: 10 * time.Second,
+			WarmQueries: append([]string(nil), WarmQueryNames...),
+		},
+		Logging: LoggingConfig{
+			Level:       "info",
+			SampleRate:  100,
+			SlowRequest: 500 * time.Millisecond,
+			SlowBet:     time.Second,
+		},
+		Limits: LimitsConfig{
+			PlayerCacheSize:  10000,
+			PlayerCacheTTL:   30 * time.Minute,
+			WinnersMinAmount: 100,
+			LookupCacheTTL:   5 * time.Second,
+			LookupMissTTL:    time.Second,
+
+			TransferMinAmount:    10,
+			TransferOTPThreshold: 1000,
+
+			DepositMin:    1,
+			DepositMax:    150000,
+			AdjustmentMax: 1000000,
+
+			RefreshTokenTTL: 7 * 24 * time.Hour,
+			LoginMinLatency: 750 * time.Millisecond,
+
+			RevocationCacheTTL: 30 * time.Second,
+
+			SessionLimitPolicy:   SessionRevokeOldest,
+			SessionTouchInterval: time.Minute,
+
+			IdempotencyTTL:     10 * time.Minute,
+			DuplicateBetWindow: 2 * time.Second,
+			BetThrottleStore:   BetThrottleMemory,
+
+			AdmissionMaxInFlight:    200,
+			AdmissionPoolSaturation: 0.9,
+			MaxConcurrentPlays:      16,
+			AccountingWorkers:       50,
+			PlayQueueTimeout:        2 * time.Second,
+
+			OTPResendMax:      3,
+			OTPResendCooldown: 30 * time.Second,
+			MsisdnChangeTTL:   10 * time.Minute,
+			OTPPlaintextGrace: time.Hour,
+
+			VerificationPurgeInterval: time.Hour,
+			VerificationRetention:     24 * time.Hour,
+
+			DeletionInterval:  time.Hour,
+			DeletionRetention: 14 * 24 * time.Hour,
+
+			FreeBetExpiryInterval: 15 * time.Minute,
+			FreeBetExpiryBatch:    500,
+			FreeBetExpiryMax:      5000,
+			FreeBetExpirySMS:      true,
+
+			DefaultShortcode: "00000",
+
+			STKRetryMax:     2,
+			STKRetrySpacing: 30 * time.Second,
+			STKRetryMaxAge:  10 * time.Minute,
+
+			OpenRoundMaxAge: 30 * time.Minute,
+
+			WithdrawalRetryMax: 3,
+			WithdrawalStuckAge: 30 * time.Minute,
+
+			BonusWagering: 5,
+			BonusFirst:    true,
+
+			DemoBalance:    1000,
+			DemoSessionTTL: time.Hour,
+
+			RevealInterval: 500 * time.Millisecond,
+
+			ReportTolerance: 1,
+			SnapshotTime:    "23:55",
+		},
+		SMS: SMSConfig{
+			URL:      "http://172.16.0.184:8008/api/v1/insert_sms",
+			SenderID: "LuckyNumber",
+
+			ResultsOptOut: true,
+
+			CTAUSSD: "*463#",
+		},
+		Callbacks: CallbacksConfig{
+			AllowedIPs: []string{"172.16.0.131", "172.16.0.104", "172.16.0.184", "127.0.0.1", "172.16.0.108"},
+
+			RetryInterval: 10 * time.Second,
+			Lease:         2 * time.Minute,
+			MaxAttempts:   6,
+			BackoffBase:   30 * time.Second,
+			BackoffMax:    30 * time.Minute,
+		},
+		SettlementLag: SettlementLagConfig{
+			Interval:      time.Minute,
+			AlertInterval: 30 * time.Minute,
+			Deposits:      LagBucketConfig{Age: 5 * time.Minute, MaxCount: 20, MaxAmount: 10000},
+			Withdrawals:   LagBucketConfig{Age: 15 * time.Minute, MaxCount: 10, MaxAmount: 50000},
+			Bets:          LagBucketConfig{Age: 2 * time.Minute, MaxCount: 50, MaxAmount: 5000},
+			Callbacks:     LagBucketConfig{Age: 10 * time.Minute, MaxCount: 0, MaxAmount: 0},
+		},
+		Webhooks: WebhooksConfig{
+			Interval:    5 * time.Second,
+			Timeout:     10 * time.Second,
+			MaxAttempts: 8,
+			BackoffBase: 30 * time.Second,
+			BackoffMax:  time.Hour,
+		},
+	}
+}
+
+// Load builds the effective config: defaults, then the YAML file at path,
+// then environment variables. Any unparseable or invalid value is an error
+// naming the field, so a typo fails startup instead of being ignored.
+func Load(path string) (*Config, error) {
+	cfg := Default()
+
+	if err := cfg.mergeFile(path); err != nil {
+		return nil, err
+	}
+	if err := cfg.mergeEnv(os.Getenv); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (c *Config) mergeFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: reading %s: %w", path, err)
+	}
+
+	var fc fileConfig
+	fc.Production.Postgres.Connection = &c.Database
+	fc.Production.Server = &c.Server
+	fc.Production.Auth = &c.Auth
+	fc.Production.Logging = &c.Logging
+	fc.Production.Limits = &c.Limits
+	fc.Production.SMS = &c.SMS
+	fc.Production.Callbacks = &c.Callbacks
+	fc.Production.Compat = &c.Compat
+	fc.Production.SettlementLag = &c.SettlementLag
+	fc.Production.Webhooks = &c.Webhooks
+
+	if err := yaml.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("config: parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// mergeEnv applies environment overrides; getenv is os.Getenv outside tests
+func (c *Config) mergeEnv(getenv func(string) string) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			*dst = v
+		}
+	}
+	integer := func(name string, dst *int) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: not an integer", name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	int32v := func(name string, dst *int32) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			n, err := strconv.ParseInt(v, 10, 32)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: not an integer", name, v))
+				return
+			}
+			*dst = int32(n)
+		}
+	}
+	float := func(name string, dst *float64) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: not a number", name, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: not a boolean", name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	// duration accepts Go durations ("30s") or, for backwards compatibility
+	// with SHUTDOWN_TIMEOUT, a bare number of seconds
+	duration := func(name string, dst *time.Duration) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			if secs, err := strconv.Atoi(v); err == nil {
+				*dst = time.Duration(secs) * time.Second
+				return
+			}
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s=%q: not a duration", name, v))
+				return
+			}
+			*dst = d
+		}
+	}
+	list := func(name string, dst *[]string) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			var out []string
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					out = append(out, item)
+				}
+			}
+			*dst = out
+		}
+	}
+	// keys parses "kid:secret,kid:secret"; a secret may contain ':' but not ','
+	keys := func(name string, dst *map[string]string) {
+		if v := strings.TrimSpace(getenv(name)); v != "" {
+			out := make(map[string]string)
+			for i, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				kid, secret, ok := strings.Cut(item, ":")
+				if !ok {
+					// the entry may be a bare secret, so it is not echoed
+					errs = append(errs, fmt.Errorf("%s: entry %d is not kid:secret", name, i+1))
+					continue
+				}
+				out[strings.TrimSpace(kid)] = secret
+			}
+			*dst = out
+		}
+	}
+
+	integer("PORT", &c.Server.Port)
+	integer("SOCKET_PORT", &c.Server.SocketPort)
+	boolean("PREFORK", &c.Server.Prefork)
+	integer("FIBER_CONC", &c.Server.Concurrency)
+	duration("SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout)
+	boolean("SOCKET_GUESTS", &c.Server.SocketGuests)
+	str("SOCKET_PUSH_URL", &c.Server.SocketPushURL)
+	boolean("SOCKET_EMBEDDED", &c.Server.SocketEmbedded)
+	boolean("DOCS_ENABLED", &c.Server.Docs)
+	str("APP_TIMEZONE", &c.Server.Timezone)
+	str("INTERNAL_ADDR", &c.Server.InternalAddr)
+	str("INTERNAL_TOKEN", &c.Server.InternalToken)
+	str("PROXY_HEADER", &c.Server.ProxyHeader)
+	list("TRUSTED_PROXIES", &c.Server.TrustedProxies)
+
+	str("JWT_KEY_ID", &c.Auth.JWTKeyID)
+	str("JWT_SECRET", &c.Auth.JWTSecret)
+	keys("JWT_PREVIOUS_KEYS", &c.Auth.JWTPreviousKeys)
+	str("OTP_KEY", &c.Auth.OTPKey)
+
+	str("DB_HOST", &c.Database.Host)
+	integer("DB_PORT", &c.Database.Port)
+	str("DB_USER", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	int32v("DB_MAX_CONNS", &c.Database.MaxConns)
+	int32v("DB_MIN_CONNS", &c.Database.MinConns)
+	boolean("DB_REPLICA_ENABLED", &c.Database.ReplicaEnabled)
+	str("DB_REPLICA_DSN", &c.Database.ReplicaDSN)
+	duration("DB_REPLICA_STICKINESS", &c.Database.ReplicaStickiness)
+	int32v("DB_WARM_CONNS", &c.Database.WarmConns)
+	duration("DB_WARM_TIMEOUT", &c.Database.WarmTimeout)
+	list("DB_WARM_QUERIES", &c.Database.WarmQueries)
+
+	str("LOG_LEVEL", &c.Logging.Level)
+	integer("LOG_SAMPLE_RATE", &c.Logging.SampleRate)
+	duration("LOG_SLOW_REQUEST", &c.Logging.SlowRequest)
+	duration("LOG_SLOW_BET", &c.Logging.SlowBet)
+
+	integer("PLAYER_CACHE_SIZE", &c.Limits.PlayerCacheSize)
+	duration("PLAYER_CACHE_TTL", &c.Limits.PlayerCacheTTL)
+	float("WINNERS_MIN_AMOUNT", &c.Limits.WinnersMinAmount)
+	duration("LOOKUP_CACHE_TTL", &c.Limits.LookupCacheTTL)
+	duration("LOOKUP_MISS_TTL", &c.Limits.LookupMissTTL)
+	float("TRANSFER_MIN_AMOUNT", &c.Limits.TransferMinAmount)
+	float("TRANSFER_OTP_THRESHOLD", &c.Limits.TransferOTPThreshold)
+	float("DEPOSIT_MIN", &c.Limits.DepositMin)
+	float("DEPOSIT_MAX", &c.Limits.DepositMax)
+	float("ADJUSTMENT_MAX", &c.Limits.AdjustmentMax)
+	duration("REFRESH_TOKEN_TTL", &c.Limits.RefreshTokenTTL)
+	duration("LOGIN_MIN_LATENCY", &c.Limits.LoginMinLatency)
+	duration("REVOCATION_CACHE_TTL", &c.Limits.RevocationCacheTTL)
+	integer("MAX_SESSIONS", &c.Limits.MaxSessions)
+	str("SESSION_LIMIT_POLICY", &c.Limits.SessionLimitPolicy)
+	duration("SESSION_TOUCH_INTERVAL", &c.Limits.SessionTouchInterval)
+	duration("IDEMPOTENCY_TTL", &c.Limits.IdempotencyTTL)
+	duration("DUPLICATE_BET_WINDOW", &c.Limits.DuplicateBetWindow)
+	str("BET_THROTTLE_STORE", &c.Limits.BetThrottleStore)
+	integer("ADMISSION_MAX_IN_FLIGHT", &c.Limits.AdmissionMaxInFlight)
+	float("ADMISSION_POOL_SATURATION", &c.Limits.AdmissionPoolSaturation)
+	integer("MAX_CONCURRENT_PLAYS", &c.Limits.MaxConcurrentPlays)
+	integer("ACCOUNTING_WORKERS", &c.Limits.AccountingWorkers)
+	duration("PLAY_QUEUE_TIMEOUT", &c.Limits.PlayQueueTimeout)
+	integer("OTP_RESEND_MAX", &c.Limits.OTPResendMax)
+	duration("OTP_RESEND_COOLDOWN", &c.Limits.OTPResendCooldown)
+	duration("MSISDN_CHANGE_TTL", &c.Limits.MsisdnChangeTTL)
+	duration("OTP_PLAINTEXT_GRACE", &c.Limits.OTPPlaintextGrace)
+	duration("VERIFICATION_PURGE_INTERVAL", &c.Limits.VerificationPurgeInterval)
+	duration("VERIFICATION_RETENTION", &c.Limits.VerificationRetention)
+	duration("DECISION_RETENTION", &c.Limits.DecisionRetention)
+	duration("DELETION_INTERVAL", &c.Limits.DeletionInterval)
+	duration("DELETION_RETENTION", &c.Limits.DeletionRetention)
+	duration("FREEBET_EXPIRY_INTERVAL", &c.Limits.FreeBetExpiryInterval)
+	integer("FREEBET_EXPIRY_BATCH", &c.Limits.FreeBetExpiryBatch)
+	integer("FREEBET_EXPIRY_MAX", &c.Limits.FreeBetExpiryMax)
+	boolean("FREEBET_EXPIRY_SMS", &c.Limits.FreeBetExpirySMS)
+	str("DEFAULT_SHORTCODE", &c.Limits.DefaultShortcode)
+	integer("STK_RETRY_MAX", &c.Limits.STKRetryMax)
+	duration("STK_RETRY_SPACING", &c.Limits.STKRetrySpacing)
+	duration("STK_RETRY_MAX_AGE", &c.Limits.STKRetryMaxAge)
+	duration("OPEN_ROUND_MAX_AGE", &c.Limits.OpenRoundMaxAge)
+	integer("WITHDRAWAL_RETRY_MAX", &c.Limits.WithdrawalRetryMax)
+	duration("WITHDRAWAL_STUCK_AGE", &c.Limits.WithdrawalStuckAge)
+	float("BONUS_WAGERING", &c.Limits.BonusWagering)
+	boolean("BONUS_FIRST", &c.Limits.BonusFirst)
+	boolean("REVERSAL_ALLOW_NEGATIVE", &c.Limits.ReversalAllowNegative)
+	float("DEMO_BALANCE", &c.Limits.DemoBalance)
+	duration("DEMO_SESSION_TTL", &c.Limits.DemoSessionTTL)
+	duration("REVEAL_INTERVAL", &c.Limits.RevealInterval)
+	float("REPORT_TOLERANCE", &c.Limits.ReportTolerance)
+	str("SNAPSHOT_TIME", &c.Limits.SnapshotTime)
+	boolean("EXPOSURE_CAP_STRICT", &c.Limits.ExposureCapStrict)
+
+	str("SMS_URL", &c.SMS.URL)
+	str("SMS_SENDER_ID", &c.SMS.SenderID)
+	boolean("SMS_RESULTS_OPT_OUT", &c.SMS.ResultsOptOut)
+	str("SMS_CTA_USSD", &c.SMS.CTAUSSD)
+	str("SMS_CTA_WEB", &c.SMS.CTAWeb)
+	str("SMS_CTA_APP", &c.SMS.CTAApp)
+
+	boolean("CALLBACK_STRICT", &c.Callbacks.Strict)
+	list("CALLBACK_ALLOWED_IPS", &c.Callbacks.AllowedIPs)
+	duration("CALLBACK_RETRY_INTERVAL", &c.Callbacks.RetryInterval)
+	duration("CALLBACK_LEASE", &c.Callbacks.Lease)
+	integer("CALLBACK_MAX_ATTEMPTS", &c.Callbacks.MaxAttempts)
+	duration("CALLBACK_BACKOFF_BASE", &c.Callbacks.BackoffBase)
+	duration("CALLBACK_BACKOFF_MAX", &c.Callbacks.BackoffMax)
+
+	boolean("LEGACY_OTP_STATUS", &c.Compat.LegacyOTPStatus)
+
+	duration("LAG_INTERVAL", &c.SettlementLag.Interval)
+	duration("LAG_ALERT_INTERVAL", &c.SettlementLag.AlertInterval)
+	str("LAG_WEBHOOK_URL", &c.SettlementLag.WebhookURL)
+	lagBucket := func(prefix string, b *LagBucketConfig) {
+		duration(prefix+"_AGE", &b.Age)
+		integer(prefix+"_MAX_COUNT", &b.MaxCount)
+		float(prefix+"_MAX_AMOUNT", &b.MaxAmount)
+	}
+	lagBucket("LAG_DEPOSITS", &c.SettlementLag.Deposits)
+	lagBucket("LAG_WITHDRAWALS", &c.SettlementLag.Withdrawals)
+	lagBucket("LAG_BETS", &c.SettlementLag.Bets)
+	lagBucket("LAG_CALLBACKS", &c.SettlementLag.Callbacks)
+
+	duration("WEBHOOK_INTERVAL", &c.Webhooks.Interval)
+	duration("WEBHOOK_TIMEOUT", &c.Webhooks.Timeout)
+	integer("WEBHOOK_MAX_ATTEMPTS", &c.Webhooks.MaxAttempts)
+	duration("WEBHOOK_BACKOFF_BASE", &c.Webhooks.BackoffBase)
+	duration("WEBHOOK_BACKOFF_MAX", &c.Webhooks.BackoffMax)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate checks ranges and required fields, naming every bad field
+func (c Config) Validate() error {
+	var errs []error
+	bad := func(field, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if _, err := time.LoadLocation(c.Server.Timezone); err != nil || c.Server.Timezone == "" {
+		bad("server.timezone", "%q is not an IANA time zone", c.Server.Timezone)
+	}
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		bad("server.port", "%d is not a valid port", c.Server.Port)
+	}
+	if c.Server.SocketPort < 1 || c.Server.SocketPort > 65535 {
+		bad("server.socket_port", "%d is not a valid port", c.Server.SocketPort)
+	}
+	if c.Server.SocketEmbedded && c.Server.SocketPort == c.Server.Port {
+		bad("server.socket_port", "must differ from server.port when socket_embedded is set")
+	}
+	if c.Server.Concurrency <= 0 {
+		bad("server.concurrency", "must be positive, got %d", c.Server.Concurrency)
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		bad("server.shutdown_timeout", "must be positive, got %s", c.Server.ShutdownTimeout)
+	}
+	if c.Server.SocketPushURL != "" {
+		if u, err := url.Parse(c.Server.SocketPushURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad("server.socket_push_url", "%q is not an http(s) URL", c.Server.SocketPushURL)
+		}
+	}
+	if c.Server.InternalAddr != "" {
+		if _, port, err := net.SplitHostPort(c.Server.InternalAddr); err != nil || port == "" {
+			bad("server.internal_addr", "%q is not a host:port", c.Server.InternalAddr)
+		}
+		if len(c.Server.InternalToken) < 32 {
+			bad("server.internal_token", "must be at least 32 characters when internal_addr is set")
+		}
+	}
+	if c.Server.ProxyHeader != "" && len(c.Server.TrustedProxies) == 0 {
+		bad("server.trusted_proxies", "is required when proxy_header is set")
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			bad("server.trusted_proxies", "%q is not an IP address or CIDR", proxy)
+		}
+	}
+
+	if c.Auth.JWTSecret == "" {
+		bad("auth.jwt_secret", "is required, set it in config.yml or JWT_SECRET")
+	} else if len(c.Auth.JWTSecret) < 32 {
+		bad("auth.jwt_secret", "must be at least 32 characters")
+	}
+	if c.Auth.OTPKey == "" {
+		bad("auth.otp_key", "is required, set it in config.yml or OTP_KEY")
+	} else if len(c.Auth.OTPKey) < 32 {
+		bad("auth.otp_key", "must be at least 32 characters")
+	} else if c.Auth.OTPKey == c.Auth.JWTSecret {
+		bad("auth.otp_key", "must differ from auth.jwt_secret")
+	}
+	if c.Auth.JWTKeyID == "" || strings.ContainsAny(c.Auth.JWTKeyID, ":,") {
+		bad("auth.jwt_key_id", "%q must be non-empty without ':' or ','", c.Auth.JWTKeyID)
+	}
+	for kid, secret := range c.Auth.JWTPreviousKeys {
+		switch {
+		case kid == "" || strings.ContainsAny(kid, ":,"):
+			bad("auth.jwt_previous_keys", "kid %q must be non-empty without ':' or ','", kid)
+		case kid == c.Auth.JWTKeyID:
+			bad("auth.jwt_previous_keys", "kid %q is also jwt_key_id", kid)
+		case len(secret) < 32:
+			bad("auth.jwt_previous_keys", "secret of kid %q must be at least 32 characters", kid)
+		}
+	}
+
+	if c.Database.Host == "" {
+		bad("database.host", "is required")
+	}
+	if c.Database.User == "" {
+		bad("database.username", "is required")
+	}
+	if c.Database.Name == "" {
+		bad("database.database", "is required")
+	}
+	if c.Database.Port < 1 || c.Database.Port > 65535 {
+		bad("database.port", "%d is not a valid port", c.Database.Port)
+	}
+	if c.Database.MaxConns <= 0 {
+		bad("database.max_conns", "must be positive, got %d", c.Database.MaxConns)
+	}
+	if c.Database.MinConns < 0 || c.Database.MinConns > c.Database.MaxConns {
+		bad("database.min_conns", "must be between 0 and max_conns (%d), got %d", c.Database.MaxConns, c.Database.MinConns)
+	}
+	if c.Database.ReplicaEnabled {
+		if u, err := url.Parse(c.Database.ReplicaDSN); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") || u.Host == "" {
+			bad("database.replica_dsn", "must be a postgres:// URL when replica_enabled is set")
+		}
+	}
+	if c.Database.ReplicaStickiness < 0 {
+		bad("database.replica_stickiness", "must not be negative, got %s", c.Database.ReplicaStickiness)
+	}
+	if c.Database.WarmConns < 0 || c.Database.WarmConns > c.Database.MaxConns {
+		bad("database.warm_conns", "must be between 0 and max_conns (%d), got %d", c.Database.MaxConns, c.Database.WarmConns)
+	}
+	if c.Database.WarmTimeout <= 0 {
+		bad("database.warm_timeout", "must be positive, got %s", c.Database.WarmTimeout)
+	}
+	for _, name := range c.Database.WarmQueries {
+		if !slices.Contains(WarmQueryNames, name) {
+			bad("database.warm_queries", "%q is not one of %s", name, strings.Join(WarmQueryNames, ", "))
+		}
+	}
+
+	if _, err := logrus.ParseLevel(c.Logging.Level); err != nil {
+		bad("logging.level", "%q is not a log level", c.Logging.Level)
+	}
+	if c.Logging.SampleRate <= 0 {
+		bad("logging.sample_rate", "must be positive, got %d", c.Logging.SampleRate)
+	}
+	if c.Logging.SlowRequest < 0 {
+		bad("logging.slow_request", "must not be negative, got %s", c.Logging.SlowRequest)
+	}
+	if c.Logging.SlowBet < 0 {
+		bad("logging.slow_bet", "must not be negative, got %s", c.Logging.SlowBet)
+	}
+
+	if c.Limits.PlayerCacheSize <= 0 {
+		bad("limits.player_cache_size", "must be positive, got %d", c.Limits.PlayerCacheSize)
+	}
+	if c.Limits.PlayerCacheTTL <= 0 {
+		bad("limits.player_cache_ttl", "must be positive, got %s", c.Limits.PlayerCacheTTL)
+	}
+	if c.Limits.WinnersMinAmount < 0 {
+		bad("limits.winners_min_amount", "must not be negative, got %v", c.Limits.WinnersMinAmount)
+	}
+	if c.Limits.LookupCacheTTL <= 0 {
+		bad("limits.lookup_cache_ttl", "must be positive, got %s", c.Limits.LookupCacheTTL)
+	}
+	if c.Limits.LookupMissTTL <= 0 || c.Limits.LookupMissTTL > c.Limits.LookupCacheTTL {
+		bad("limits.lookup_miss_ttl", "must be positive and at most lookup_cache_ttl, got %s", c.Limits.LookupMissTTL)
+	}
+	if c.Limits.TransferMinAmount <= 0 {
+		bad("limits.transfer_min_amount", "must be positive, got %v", c.Limits.TransferMinAmount)
+	}
+	if c.Limits.TransferOTPThreshold < 0 {
+		bad("limits.transfer_otp_threshold", "must not be negative, got %v", c.Limits.TransferOTPThreshold)
+	}
+	if c.Limits.DepositMin <= 0 {
+		bad("limits.deposit_min", "must be positive, got %v", c.Limits.DepositMin)
+	}
+	if c.Limits.DepositMax < c.Limits.DepositMin {
+		bad("limits.deposit_max", "must be at least deposit_min, got %v", c.Limits.DepositMax)
+	}
+	if c.Limits.AdjustmentMax < 0 {
+		bad("limits.adjustment_max", "must not be negative, got %v", c.Limits.AdjustmentMax)
+	}
+	if c.Limits.RefreshTokenTTL <= 0 {
+		bad("limits.refresh_token_ttl", "must be positive, got %s", c.Limits.RefreshTokenTTL)
+	}
+	if c.Limits.LoginMinLatency < 0 {
+		bad("limits.login_min_latency", "must not be negative, got %s", c.Limits.LoginMinLatency)
+	}
+	if c.Limits.RevocationCacheTTL <= 0 || c.Limits.RevocationCacheTTL > 5*time.Minute {
+		bad("limits.revocation_cache_ttl", "must be positive and at most 5m, got %s", c.Limits.RevocationCacheTTL)
+	}
+	if c.Limits.MaxSessions < 0 {
+		bad("limits.max_sessions", "must not be negative, got %d", c.Limits.MaxSessions)
+	}
+	if !slices.Contains(SessionLimitPolicies, c.Limits.SessionLimitPolicy) {
+		bad("limits.session_limit_policy", "%q is not one of %s", c.Limits.SessionLimitPolicy, strings.Join(SessionLimitPolicies, ", "))
+	}
+	if c.Limits.SessionTouchInterval <= 0 {
+		bad("limits.session_touch_interval", "must be positive, got %s", c.Limits.SessionTouchInterval)
+	}
+	if c.Limits.IdempotencyTTL <= 0 {
+		bad("limits.idempotency_ttl", "must be positive, got %s", c.Limits.IdempotencyTTL)
+	}
+	if c.Limits.DuplicateBetWindow < 0 || c.Limits.DuplicateBetWindow > time.Minute {
+		bad("limits.duplicate_bet_window", "must be between 0 and 1m, got %s", c.Limits.DuplicateBetWindow)
+	}
+	if !slices.Contains(BetThrottleStores, c.Limits.BetThrottleStore) {
+		bad("limits.bet_throttle_store", "%q is not one of %s", c.Limits.BetThrottleStore, strings.Join(BetThrottleStores, ", "))
+	}
+	if c.Limits.AdmissionMaxInFlight < 0 {
+		bad("limits.admission_max_in_flight", "must not be negative, got %d", c.Limits.AdmissionMaxInFlight)
+	}
+	if c.Limits.AdmissionPoolSaturation < 0 || c.Limits.AdmissionPoolSaturation > 1 {
+		bad("limits.admission_pool_saturation", "must be between 0 and 1, got %v", c.Limits.AdmissionPoolSaturation)
+	}
+	if c.Limits.MaxConcurrentPlays <= 0 {
+		bad("limits.max_concurrent_plays", "must be positive, got %d", c.Limits.MaxConcurrentPlays)
+	}
+	if c.Limits.AccountingWorkers <= 0 || c.Limits.AccountingWorkers > int(c.Database.MaxConns) {
+		bad("limits.accounting_workers", "must be between 1 and database.max_conns (%d), got %d", c.Database.MaxConns, c.Limits.AccountingWorkers)
+	}
+	if c.Limits.PlayQueueTimeout <= 0 {
+		bad("limits.play_queue_timeout", "must be positive, got %s", c.Limits.PlayQueueTimeout)
+	}
+	if c.Limits.OTPResendMax < 0 {
+		bad("limits.otp_resend_max", "must not be negative, got %d", c.Limits.OTPResendMax)
+	}
+	if c.Limits.OTPResendCooldown < 0 {
+		bad("limits.otp_resend_cooldown", "must not be negative, got %s", c.Limits.OTPResendCooldown)
+	}
+	if c.Limits.MsisdnChangeTTL <= 0 {
+		bad("limits.msisdn_change_ttl", "must be positive, got %s", c.Limits.MsisdnChangeTTL)
+	}
+	if c.Limits.OTPPlaintextGrace <= 0 {
+		bad("limits.otp_plaintext_grace", "must be positive, got %s", c.Limits.OTPPlaintextGrace)
+	}
+	if c.Limits.VerificationPurgeInterval < 0 {
+		bad("limits.verification_purge_interval", "must not be negative, got %s", c.Limits.VerificationPurgeInterval)
+	}
+	if c.Limits.VerificationRetention < 0 {
+		bad("limits.verification_retention", "must not be negative, got %s", c.Limits.VerificationRetention)
+	}
+	if c.Limits.DecisionRetention < 0 {
+		bad("limits.decision_retention", "must not be negative, got %s", c.Limits.DecisionRetention)
+	}
+	if c.Limits.DeletionInterval < 0 {
+		bad("limits.deletion_interval", "must not be negative, got %s", c.Limits.DeletionInterval)
+	}
+	if c.Limits.DeletionRetention < 0 || c.Limits.DeletionRetention > 30*24*time.Hour {
+		bad("limits.deletion_retention", "must be between 0 and 30 days, got %s", c.Limits.DeletionRetention)
+	}
+	if c.Limits.FreeBetExpiryInterval < 0 {
+		bad("limits.freebet_expiry_interval", "must not be negative, got %s", c.Limits.FreeBetExpiryInterval)
+	}
+	if c.Limits.FreeBetExpiryBatch <= 0 {
+		bad("limits.freebet_expiry_batch", "must be positive, got %d", c.Limits.FreeBetExpiryBatch)
+	}
+	if c.Limits.FreeBetExpiryMax < c.Limits.FreeBetExpiryBatch {
+		bad("limits.freebet_expiry_max", "must be at least freebet_expiry_batch (%d), got %d", c.Limits.FreeBetExpiryBatch, c.Limits.FreeBetExpiryMax)
+	}
+	if strings.TrimSpace(c.Limits.DefaultShortcode) == "" {
+		bad("limits.default_shortcode", "must not be empty")
+	}
+	if c.Limits.STKRetryMax < 0 {
+		bad("limits.stk_retry_max", "must not be negative, got %d", c.Limits.STKRetryMax)
+	}
+	if c.Limits.STKRetrySpacing < 0 {
+		bad("limits.stk_retry_spacing", "must not be negative, got %s", c.Limits.STKRetrySpacing)
+	}
+	if c.Limits.STKRetryMaxAge <= 0 {
+		bad("limits.stk_retry_max_age", "must be positive, got %s", c.Limits.STKRetryMaxAge)
+	}
+	if c.Limits.OpenRoundMaxAge <= 0 {
+		bad("limits.open_round_max_age", "must be positive, got %s", c.Limits.OpenRoundMaxAge)
+	}
+	if c.Limits.WithdrawalRetryMax < 0 {
+		bad("limits.withdrawal_retry_max", "must not be negative, got %d", c.Limits.WithdrawalRetryMax)
+	}
+	if c.Limits.WithdrawalStuckAge <= 0 {
+		bad("limits.withdrawal_stuck_age", "must be positive, got %s", c.Limits.WithdrawalStuckAge)
+	}
+	if c.Limits.BonusWagering < 0 {
+		bad("limits.bonus_wagering", "must not be negative, got %v", c.Limits.BonusWagering)
+	}
+	if c.Limits.DemoBalance < 0 {
+		bad("limits.demo_balance", "must not be negative, got %v", c.Limits.DemoBalance)
+	}
+	if c.Limits.DemoSessionTTL <= 0 {
+		bad("limits.demo_session_ttl", "must be positive, got %s", c.Limits.DemoSessionTTL)
+	}
+	if c.Limits.RevealInterval < 0 {
+		bad("limits.reveal_interval", "must not be negative, got %s", c.Limits.RevealInterval)
+	}
+	if c.Limits.ReportTolerance < 0 {
+		bad("limits.report_tolerance", "must not be negative, got %v", c.Limits.ReportTolerance)
+	}
+	if c.Limits.SnapshotTime != "" {
+		if _, err := time.Parse("15:04", c.Limits.SnapshotTime); err != nil {
+			bad("limits.snapshot_time", "must be HH:MM, got %q", c.Limits.SnapshotTime)
+		}
+	}
+
+	if strings.TrimSpace(c.SMS.CTAUSSD) == "" {
+		bad("sms.cta_ussd", "is required")
+	}
+
+	for _, ip := range c.Callbacks.AllowedIPs {
+		if net.ParseIP(ip) == nil {
+			bad("callbacks.allowed_ips", "%q is not an IP address", ip)
+		}
+	}
+	cbs := c.Callbacks
+	if cbs.RetryInterval <= 0 {
+		bad("callbacks.retry_interval", "must be positive, got %s", cbs.RetryInterval)
+	}
+	if cbs.Lease <= 0 {
+		bad("callbacks.lease", "must be positive, got %s", cbs.Lease)
+	}
+	if cbs.MaxAttempts < 1 {
+		bad("callbacks.max_attempts", "must be at least 1, got %d", cbs.MaxAttempts)
+	}
+	if cbs.BackoffBase <= 0 {
+		bad("callbacks.backoff_base", "must be positive, got %s", cbs.BackoffBase)
+	}
+	if cbs.BackoffMax < cbs.BackoffBase {
+		bad("callbacks.backoff_max", "must be at least backoff_base, got %s", cbs.BackoffMax)
+	}
+
+	lag := c.SettlementLag
+	if lag.Interval <= 0 {
+		bad("settlement_lag.interval", "must be positive, got %s", lag.Interval)
+	}
+	if lag.AlertInterval < 0 {
+		bad("settlement_lag.alert_interval", "must not be negative, got %s", lag.AlertInterval)
+	}
+	if lag.WebhookURL != "" {
+		if u, err := url.Parse(lag.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			bad("settlement_lag.webhook_url", "%q is not an http(s) URL", lag.WebhookURL)
+		}
+	}
+	lagBucket := func(name string, b LagBucketConfig) {
+		if b.Age <= 0 {
+			bad("settlement_lag."+name+".age", "must be positive, got %s", b.Age)
+		}
+		if b.MaxCount < 0 {
+			bad("settlement_lag."+name+".max_count", "must not be negative, got %d", b.MaxCount)
+		}
+		if b.MaxAmount < 0 {
+			bad("settlement_lag."+name+".max_amount", "must not be negative, got %v", b.MaxAmount)
+		}
+	}
+	lagBucket("deposits", lag.Deposits)
+	lagBucket("withdrawals", lag.Withdrawals)
+	lagBucket("bets", lag.Bets)
+	lagBucket("callbacks", lag.Callbacks)
+
+	hooks := c.Webhooks
+	if hooks.Interval <= 0 {
+		bad("webhooks.interval", "must be positive, got %s", hooks.Interval)
+	}
+	if hooks.Timeout <= 0 {
+		bad("webhooks.timeout", "must be positive, got %s", hooks.Timeout)
+	}
+	if hooks.MaxAttempts < 1 {
+		bad("webhooks.max_attempts", "must be at least 1, got %d", hooks.MaxAttempts)
+	}
+	if hooks.BackoffBase <= 0 {
+		bad("webhooks.backoff_base", "must be positive, got %s", hooks.BackoffBase)
+	}
+	if hooks.BackoffMax < hooks.BackoffBase {
+		bad("webhooks.backoff_max", "must be at least backoff_base, got %s", hooks.BackoffMax)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("config: invalid values: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// LogLevel returns the parsed logging level; Validate has already checked it
+func (c Config) LogLevel() logrus.Level {
+	level, err := logrus.ParseLevel(c.Logging.Level)
+	if err != nil {
+		return logrus.InfoLevel
+	}
+	return level
+}
+
+// Redacted returns a copy safe to print, with secrets masked
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = "[redacted]"
+	}
+	if c.Server.InternalToken != "" {
+		c.Server.InternalToken = "[redacted]"
+	}
+	if c.Auth.JWTSecret != "" {
+		c.Auth.JWTSecret = "[redacted]"
+	}
+	if c.Auth.OTPKey != "" {
+		c.Auth.OTPKey = "[redacted]"
+	}
+	if len(c.Auth.JWTPreviousKeys) > 0 {
+		// the map is shared with the original, so build a new one
+		keys := make(map[string]string, len(c.Auth.JWTPreviousKeys))
+		for kid := range c.Auth.JWTPreviousKeys {
+			keys[kid] = "[redacted]"
+		}
+		c.Auth.JWTPreviousKeys = keys
+	}
+	if c.Database.ReplicaDSN != "" {
+		c.Database.ReplicaDSN = "[redacted]"
+	}
+	if c.SettlementLag.WebhookURL != "" {
+		c.SettlementLag.WebhookURL = "[redacted]"
+	}
+	return c
+}
+
+// Print writes the redacted effective config as YAML, durations included
+// in their "30s" form
+func (c Config) Print() error {
+	out, err := yaml.Marshal(c.Redacted())
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSecret = "test-signing-key-0123456789abcdef"
+	testOTPKey = "test-otp-key-0123456789abcdef0123"
+)
+
+func writeConfig(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMergesFileThenEnv(t *testing.T) {
+	path := writeConfig(t, `
+production:
+  postgres:
+    connection:
+      host: db.internal
+      port: 5433
+      username: app
+      password: file-password
+      database: pawabox
+  server:
+    port: 8081
+    shutdown_timeout: 45s
+  auth:
+    jwt_key_id: k1
+    jwt_secret: `+testSecret+`
+    otp_key: `+testOTPKey+`
+`)
+	t.Setenv("DB_HOST", "127.0.0.1")
+	t.Setenv("SHUTDOWN_TIMEOUT", "20")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.Host != "127.0.0.1" || cfg.Database.Port != 5433 || cfg.Database.Name != "pawabox" {
+		t.Errorf("database %s:%d/%s, want the file values with DB_HOST from env", cfg.Database.Host, cfg.Database.Port, cfg.Database.Name)
+	}
+	if cfg.Server.Port != 8081 || cfg.Server.ShutdownTimeout != 20*time.Second {
+		t.Errorf("server port %d, shutdown %s; want 8081 and 20s", cfg.Server.Port, cfg.Server.ShutdownTimeout)
+	}
+	if cfg.Limits != Default().Limits {
+		t.Error("limits missing from the file should keep their defaults")
+	}
+}
+
+func TestLoadRejectsBadValuesByName(t *testing.T) {
+	path := writeConfig(t, "production:\n  auth:\n    jwt_secret: "+testSecret+"\n    otp_key: "+testOTPKey+"\n")
+	t.Setenv("PORT", "eighty")
+	t.Setenv("LOG_SLOW_BET", "soon")
+
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("bad env values accepted")
+	}
+	for _, name := range []string{"PORT", "LOG_SLOW_BET"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name %s", err, name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+func TestValidateSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Host, cfg.Database.User, cfg.Database.Name = "127.0.0.1", "app", "pawabox"
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "auth.jwt_secret") {
+		t.Fatalf("default config without a secret = %v, want auth.jwt_secret required", err)
+	}
+
+	cfg.Auth.JWTSecret = "short-secret"
+	cfg.Auth.OTPKey = testOTPKey
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "at least 32") {
+		t.Fatalf("short secret = %v, want rejected", err)
+	}
+	if strings.Contains(err.Error(), "short-secret") {
+		t.Error("validation error echoes the secret")
+	}
+
+	cfg.Auth.JWTSecret = testSecret
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("defaults with secrets = %v, want valid", err)
+	}
+
+	for key, want := range map[string]string{
+		"":              "auth.otp_key: is required",
+		"short-otp-key": "auth.otp_key: must be at least 32",
+		testSecret:      "auth.otp_key: must differ from auth.jwt_secret",
+	} {
+		cfg.Auth.OTPKey = key
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("otp key %q = %v, want %q", key, err, want)
+		}
+	}
+	cfg.Auth.OTPKey = testOTPKey
+	cfg.Limits.OTPPlaintextGrace = 0
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "limits.otp_plaintext_grace") {
+		t.Errorf("no plaintext grace = %v, want rejected", err)
+	}
+}
+
+func TestRedactedMasksSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "db-password"
+	cfg.Auth.JWTSecret = testSecret
+	cfg.Auth.OTPKey = testOTPKey
+	cfg.Auth.JWTPreviousKeys = map[string]string{"k0": "old-secret"}
+	cfg.Server.InternalToken = "internal-token"
+
+	red := cfg.Redacted()
+	for _, v := range []string{red.Database.Password, red.Auth.JWTSecret, red.Auth.OTPKey, red.Auth.JWTPreviousKeys["k0"], red.Server.InternalToken} {
+		if v != "[redacted]" {
+			t.Errorf("secret left in redacted config: %q", v)
+		}
+	}
+	if cfg.Auth.JWTPreviousKeys["k0"] != "old-secret" {
+		t.Error("Redacted changed the original previous keys")
+	}
+}
+
+func TestLoadWarmSettings(t *testing.T) {
+	path := writeConfig(t, `
+production:
+  postgres:
+    connection:
+      host: db.internal
+      username: app
+      database: pawabox
+  auth:
+    jwt_secret: `+testSecret+`
+    otp_key: `+testOTPKey+`
+`)
+	t.Setenv("DB_WARM_CONNS", "4")
+	t.Setenv("DB_WARM_TIMEOUT", "3s")
+	t.Setenv("DB_WARM_QUERIES", "check_user,get_game")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.WarmConns != 4 || cfg.Database.WarmTimeout != 3*time.Second ||
+		strings.Join(cfg.Database.WarmQueries, ",") != "check_user,get_game" {
+		t.Errorf("warm %d conns in %s running %v, want 4 in 3s running check_user and get_game",
+			cfg.Database.WarmConns, cfg.Database.WarmTimeout, cfg.Database.WarmQueries)
+	}
+
+	t.Setenv("DB_WARM_CONNS", "100000")
+	t.Setenv("DB_WARM_QUERIES", "check_user,check_users")
+	_, err = Load(path)
+	if err == nil {
+		t.Fatal("bad warm settings accepted")
+	}
+	for _, name := range []string{"database.warm_conns", "database.warm_queries", `"check_users"`} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not name %s", err, name)
+		}
+	}
+}
+
+func TestValidateTrustedProxies(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Host, cfg.Database.User, cfg.Database.Name = "127.0.0.1", "app", "pawabox"
+	cfg.Auth.JWTSecret, cfg.Auth.OTPKey = testSecret, testOTPKey
+
+	cfg.Server.ProxyHeader = "X-Real-IP"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "server.trusted_proxies: is required") {
+		t.Errorf("proxy header without proxies = %v, want trusted_proxies required", err)
+	}
+	cfg.Server.TrustedProxies = []string{"10.0.0.1", "172.16.0.0/16", "proxy.internal"}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `"proxy.internal"`) {
+		t.Errorf("hostname proxy = %v, want rejected", err)
+	}
+	cfg.Server.TrustedProxies = cfg.Server.TrustedProxies[:2]
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("IP and CIDR proxies = %v, want valid", err)
+	}
+}
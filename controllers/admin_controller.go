@@ -0,0 +1,1592 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/services"
+	"fiberapp/utils"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultDailyStatsDays is the window returned when no range is supplied
+const defaultDailyStatsDays = 30
+
+// GetPlayerStatsHandler - GET /api/v1/admin/players/:msisdn/stats
+func GetPlayerStatsHandler(c *fiber.Ctx) error {
+	stats, err := lucky.GetPlayerStats(c.Params("msisdn"))
+	if errors.Is(err, services.ErrPlayerNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "player not found"))
+	}
+	if err != nil {
+		logrus.Errorf("GetPlayerStats error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch player stats"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          stats,
+	})
+}
+
+// FindDuplicatePlayersHandler - GET /api/v1/admin/players/duplicates
+func FindDuplicatePlayersHandler(c *fiber.Ctx) error {
+	groups, err := lucky.FindDuplicatePlayers()
+	if err != nil {
+		logrus.Errorf("FindDuplicatePlayers error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to find duplicate players"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          groups,
+	})
+}
+
+// ListPlayerStatsHandler - GET /api/v1/admin/players?sort=rtp_desc&min_bets=100&page=1&page_size=20
+func ListPlayerStatsHandler(c *fiber.Ctx) error {
+	page, err := utils.ParsePage(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+
+	result, err := lucky.ListPlayerStats(c.Query("sort"), int64(c.QueryInt("min_bets", 0)), page)
+	if errors.Is(err, database.ErrInvalidSort) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("ListPlayerStats error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch players"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// playerExportTimeout bounds one /admin/players/export stream
+const playerExportTimeout = 10 * time.Minute
+
+// playerExportFlushRows is how many CSV rows are buffered between flushes
+const playerExportFlushRows = 500
+
+var playerExportHeader = []string{
+	"msisdn", "rtp", "bet_count", "total_bets", "payout", "total_losses",
+	"average_stake", "last_stake", "largest_win", "loss_streak",
+	"last_transaction_time", "date_created",
+}
+
+// ExportPlayerStatsHandler - GET /api/v1/admin/players/export?sort=rtp_desc&min_bets=100
+// Streams every matching player as CSV. Rows go to the client as they are
+// read, so the export never holds the whole player base in memory. A client
+// that disconnects stops the query.
+func ExportPlayerStatsHandler(c *fiber.Ctx) error {
+	sort, err := services.NormalizePlayerSort(c.Query("sort"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	minBets := int64(c.QueryInt("min_bets", 0))
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="players.csv"`)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), playerExportTimeout)
+		defer cancel()
+
+		out := csv.NewWriter(w)
+		_ = out.Write(playerExportHeader)
+		n := 0
+		err := lucky.ExportPlayerStats(ctx, sort, minBets, func(p services.PlayerStats) error {
+			if err := out.Write(playerExportRecord(p)); err != nil {
+				return err
+			}
+			if n++; n%playerExportFlushRows == 0 {
+				out.Flush()
+				if err := out.Error(); err != nil {
+					return err
+				}
+				return w.Flush()
+			}
+			return nil
+		})
+		out.Flush()
+		if err != nil {
+			logrus.Errorf("ExportPlayerStats stopped after %d rows: %v", n, err)
+		}
+	})
+	return nil
+}
+
+func playerExportRecord(p services.PlayerStats) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	return []string{
+		p.Msisdn, f(p.RTP), strconv.FormatInt(p.BetCount, 10), f(p.TotalBets), f(p.Payout), f(p.TotalLosses),
+		f(p.AverageStake), f(p.LastStake), f(p.LargestWin), strconv.FormatInt(p.LossStreak, 10),
+		p.LastTransactionTime, p.DateCreated,
+	}
+}
+
+// GetDailyStatsHandler - GET /api/v1/admin/stats/daily?start_date=2024-01-01&end_date=2024-01-31
+func GetDailyStatsHandler(c *fiber.Ctx) error {
+	dateRange, err := utils.ParseDateRange(c.Query("start_date"), c.Query("end_date"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if dateRange.IsZero() {
+		now := clock.Now()
+		dateRange = utils.DateRange{Start: now.AddDate(0, 0, -(defaultDailyStatsDays - 1)), End: now}
+	}
+
+	days, err := lucky.GetDailyStats(dateRange)
+	if err != nil {
+		logrus.Errorf("GetDailyStats error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch daily stats"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          days,
+	})
+}
+
+// GetChannelStatsHandler - GET /api/v1/admin/stats/channels?from=&to=
+func GetChannelStatsHandler(c *fiber.Ctx) error {
+	dateRange, err := utils.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if dateRange.IsZero() {
+		now := clock.Now()
+		dateRange = utils.DateRange{Start: now.AddDate(0, 0, -(defaultDailyStatsDays - 1)), End: now}
+	}
+
+	stats, err := lucky.GetChannelStats(dateRange)
+	if err != nil {
+		logrus.Errorf("GetChannelStats error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch channel stats"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          stats,
+	})
+}
+
+// GetExposureStatsHandler - GET /api/v1/admin/stats/exposure
+// What each game has paid out in wins today against its daily exposure cap
+func GetExposureStatsHandler(c *fiber.Ctx) error {
+	games, err := lucky.GetGameExposure()
+	if err != nil {
+		logrus.Errorf("GetGameExposure error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch game exposure"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          games,
+	})
+}
+
+// GetDepositsByShortcodeHandler - GET /api/v1/admin/stats/deposits_by_shortcode?from=&to=
+// Deposits per paybill shortcode; shortcodes missing from the shortcode
+// table are listed with known false
+func GetDepositsByShortcodeHandler(c *fiber.Ctx) error {
+	dateRange, err := utils.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if dateRange.IsZero() {
+		now := clock.Now()
+		dateRange = utils.DateRange{Start: now.AddDate(0, 0, -(defaultDailyStatsDays - 1)), End: now}
+	}
+
+	stats, err := lucky.DepositsByShortcode(dateRange)
+	if err != nil {
+		logrus.Errorf("DepositsByShortcode error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch deposit stats"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          stats,
+	})
+}
+
+// reportTimeout bounds the queries behind one finance report
+const reportTimeout = time.Minute
+
+// GetDailyReportHandler - GET /api/v1/admin/reports/daily?date=2024-01-31&format=csv
+// Finance report of one day, yesterday by default
+func GetDailyReportHandler(c *fiber.Ctx) error {
+	date := c.Query("date")
+	if date == "" {
+		date = clock.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "date must be YYYY-MM-DD"))
+	}
+	dateRange, err := utils.ParseDateRange(date, date)
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	return financeReport(c, dateRange, "report-"+date+".csv")
+}
+
+// GetMonthlyReportHandler - GET /api/v1/admin/reports/monthly?month=2024-01&format=csv
+// Finance report of every day of a month, the current one by default
+func GetMonthlyReportHandler(c *fiber.Ctx) error {
+	month := clock.Now()
+	if q := c.Query("month"); q != "" {
+		var err error
+		if month, err = time.ParseInLocation("2006-01", q, clock.Location()); err != nil {
+			return c.Status(400).JSON(models.NewErrorResponse(400, 1, "month must be YYYY-MM"))
+		}
+	}
+	return financeReport(c, utils.MonthRange(month), "report-"+month.Format("2006-01")+".csv")
+}
+
+// GetBasketHistoryHandler - GET /api/v1/admin/reports/basket_history?from=2024-01-01&to=2024-01-31
+// The daily basket and house income snapshots, the last 30 days by default
+func GetBasketHistoryHandler(c *fiber.Ctx) error {
+	dateRange, err := utils.ParseDateRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if dateRange.IsZero() {
+		today := clock.Today()
+		dateRange = utils.DateRange{Start: today.AddDate(0, 0, -29), End: today.AddDate(0, 0, 1).Add(-time.Nanosecond)}
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), reportTimeout)
+	defer cancel()
+	history, err := lucky.GetBalanceHistory(ctx, dateRange)
+	if err != nil {
+		logrus.Errorf("GetBalanceHistory error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch basket history"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          history,
+	})
+}
+
+// SnapshotBalancesHandler - POST /api/v1/admin/reports/basket_history/snapshot
+// Takes today's snapshot now, replacing one taken earlier today
+func SnapshotBalancesHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), reportTimeout)
+	defer cancel()
+	snapshot, err := lucky.SnapshotBalances(ctx)
+	if err != nil {
+		logrus.Errorf("SnapshotBalances error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to take snapshot"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	logrus.Infof("balance snapshots: %s took %s on demand", admin, snapshot.Date)
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          snapshot,
+	})
+}
+
+// financeReport answers with the report as JSON, or as CSV for format=csv:
+// one row per day, a total row, then the discrepancies
+func financeReport(c *fiber.Ctx, dateRange utils.DateRange, filename string) error {
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "format must be json or csv"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), reportTimeout)
+	defer cancel()
+	report, err := lucky.GetFinanceReport(ctx, dateRange)
+	if err != nil {
+		logrus.Errorf("GetFinanceReport error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to build finance report"))
+	}
+
+	if format == "json" {
+		return c.JSON(fiber.Map{
+			"Status":        200,
+			"StatusCode":    0,
+			"StatusMessage": "Success",
+			"Data":          report,
+		})
+	}
+
+	var buf bytes.Buffer
+	out := csv.NewWriter(&buf)
+	_ = out.Write(reportExportHeader)
+	for _, day := range report.Days {
+		_ = out.Write(reportExportRecord(day.Date, day.ReportFigures))
+	}
+	_ = out.Write(reportExportRecord("total", report.Totals))
+	_ = out.Write(nil)
+	_ = out.Write([]string{"date", "counter", "kpi", "recomputed", "difference"})
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	for _, d := range report.Discrepancies {
+		_ = out.Write([]string{d.Date, d.Counter, f(d.KPI), f(d.Recomputed), f(d.Difference)})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		logrus.Errorf("finance report csv: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to build finance report"))
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Send(buf.Bytes())
+}
+
+var reportExportHeader = []string{
+	"date", "handle", "bet_count", "payout", "ggr", "excise_collected", "withholding_collected",
+	"deposits", "deposit_reversals", "deposits_total", "withdrawals_disbursed", "pending_payouts",
+	"free_bet_count", "free_bet_stake", "free_bet_cost",
+}
+
+func reportExportRecord(date string, r services.ReportFigures) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	return []string{
+		date, f(r.Handle), strconv.FormatInt(r.BetCount, 10), f(r.Payout), f(r.GGR), f(r.ExciseCollected), f(r.WithholdingCollected),
+		f(r.Deposits), f(r.DepositReversals), f(r.DepositsTotal), f(r.WithdrawalsDisbursed), f(r.PendingPayouts),
+		strconv.FormatInt(r.FreeBetCount, 10), f(r.FreeBetStake), f(r.FreeBetCost),
+	}
+}
+
+// GetCacheStatsHandler - GET /api/v1/admin/stats/cache
+func GetCacheStatsHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data": fiber.Map{
+			"players": lucky.PlayerCacheStats(),
+			"lookups": lucky.LookupCacheStats(),
+		},
+	})
+}
+
+// LoadStats is this process's admission, play slot and accounting worker
+// counters. With prefork every worker keeps its own.
+type LoadStats struct {
+	Requests   utils.AdmissionStats         `json:"requests"`
+	Plays      services.PlaySlotStats       `json:"plays"`
+	Accounting services.AccountingPoolStats `json:"accounting"`
+}
+
+// CurrentLoad returns this process's LoadStats, for /health
+func CurrentLoad() LoadStats {
+	return LoadStats{Requests: utils.Admission(), Plays: lucky.PlaySlotStats(), Accounting: lucky.AccountingPoolStats()}
+}
+
+// HealthHandler is the /health of the API and the socket server: a small,
+// fast payload with the cached maintenance state and this process's load.
+// extra, when set, adds the server's own fields.
+func HealthHandler(service string, extra func() fiber.Map) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		health := fiber.Map{
+			"status":    "healthy",
+			"service":   service,
+			"timestamp": time.Now().Unix(),
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), time.Second)
+		defer cancel()
+		if maintenance, err := MaintenanceState(ctx); err != nil {
+			health["maintenance"] = "unknown"
+		} else {
+			health["maintenance"] = maintenance
+		}
+		health["load"] = CurrentLoad()
+		if extra != nil {
+			for k, v := range extra() {
+				health[k] = v
+			}
+		}
+		return c.Status(fiber.StatusOK).JSON(health)
+	}
+}
+
+// GetLoadStatsHandler - GET /api/v1/admin/stats/load
+func GetLoadStatsHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          CurrentLoad(),
+	})
+}
+
+// GetSettlementLagHandler - GET /api/v1/admin/settlement_lag
+func GetSettlementLagHandler(c *fiber.Ctx) error {
+	lag, err := lucky.SettlementLag(c.UserContext())
+	if err != nil {
+		logrus.Errorf("SettlementLag error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to measure settlement lag"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          lag,
+	})
+}
+
+// ListStuckWithdrawalsHandler - GET /api/v1/admin/withdrawals/stuck?older_than=1h&page=1&page_size=20
+// Processed withdrawals the disbursement partner has not paid, oldest first.
+func ListStuckWithdrawalsHandler(c *fiber.Ctx) error {
+	page, err := utils.ParsePage(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	var olderThan time.Duration
+	if v := c.Query("older_than"); v != "" {
+		if olderThan, err = time.ParseDuration(v); err != nil || olderThan <= 0 {
+			return c.Status(400).JSON(models.NewErrorResponse(400, 1, "older_than must be a positive duration such as 30m or 2h"))
+		}
+	}
+
+	result, err := lucky.StuckWithdrawals(olderThan, page)
+	if err != nil {
+		logrus.Errorf("StuckWithdrawals error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch stuck withdrawals"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// RetryWithdrawalHandler - POST /api/v1/admin/withdrawals/:reference/retry
+// Puts a stuck withdrawal back on the disbursement queue. Past the retry
+// limit it is flagged for manual resolution instead: 409 with the retry in
+// Data.
+func RetryWithdrawalHandler(c *fiber.Ctx) error {
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	retry, err := lucky.RetryWithdrawal(admin, c.Params("reference"))
+	switch {
+	case errors.Is(err, database.ErrWithdrawalNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case errors.Is(err, database.ErrWithdrawalDisbursed),
+		errors.Is(err, database.ErrWithdrawalManual),
+		errors.Is(err, database.ErrWithdrawalAwaitingCallback):
+		return c.Status(409).JSON(models.NewErrorResponse(409, 1, err.Error()))
+	case errors.Is(err, services.ErrWithdrawalRetryLimit):
+		return c.Status(409).JSON(fiber.Map{
+			"Status":        409,
+			"StatusCode":    1,
+			"StatusMessage": err.Error(),
+			"Data":          retry,
+		})
+	case err != nil:
+		logrus.Errorf("RetryWithdrawal error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to retry withdrawal"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          retry,
+	})
+}
+
+// ListCallbacksHandler - GET /api/v1/admin/callbacks?status=&page=&page_size=
+// Stored gateway callbacks, newest first; status is pending, processed or
+// failed, all when empty.
+func ListCallbacksHandler(c *fiber.Ctx) error {
+	page, err := utils.ParsePage(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+
+	result, err := lucky.ListInboundCallbacks(c.Query("status"), page)
+	if errors.Is(err, services.ErrCallbackStatus) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("ListInboundCallbacks error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch callbacks"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// ListDepositReviewsHandler - GET /api/v1/admin/deposit_reviews?page=&page_size=
+// Deposit callbacks flagged for review instead of credited, newest first.
+func ListDepositReviewsHandler(c *fiber.Ctx) error {
+	page, err := utils.ParsePage(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+
+	result, err := lucky.ListDepositReviews(page)
+	if err != nil {
+		logrus.Errorf("ListDepositReviews error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch deposit reviews"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// RetryCallbackHandler - POST /api/v1/admin/callbacks/:id/retry
+// Queues a failed callback for processing again with fresh attempts.
+func RetryCallbackHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid callback id"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	err = lucky.RetryInboundCallback(admin, int64(id))
+	switch {
+	case errors.Is(err, services.ErrCallbackNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case errors.Is(err, services.ErrCallbackNotFailed):
+		return c.Status(409).JSON(models.NewErrorResponse(409, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("RetryInboundCallback error for %d: %v", id, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to retry callback"))
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// SettlementLagMetricsHandler - GET /api/v1/admin/settlement_lag/metrics (Prometheus text format)
+func SettlementLagMetricsHandler(c *fiber.Ctx) error {
+	lag, err := lucky.SettlementLag(c.UserContext())
+	if err != nil {
+		logrus.Errorf("SettlementLag error: %v", err)
+		return c.Status(500).SendString("failed to measure settlement lag\n")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	lag.WritePrometheus(c)
+	return nil
+}
+
+// BetTimingMetricsHandler - GET /api/v1/admin/bet_timing/metrics (Prometheus text format)
+func BetTimingMetricsHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	services.WriteBetTimingMetrics(c)
+	return nil
+}
+
+// RunSettlementLagMonitor runs the stuck-money monitor on the controllers'
+// service instance, so GET /admin/settlement_lag serves its snapshots
+func RunSettlementLagMonitor(ctx context.Context) {
+	lucky.RunSettlementLagMonitor(ctx)
+}
+
+// RunVerificationPurge runs the OTP purge job on the controllers' service
+// instance, so GET /admin/stats/verification_purge reports its counters
+func RunVerificationPurge(ctx context.Context) {
+	lucky.RunVerificationPurge(ctx)
+}
+
+// MaintenanceState reports whether betting and deposits are paused, for
+// /health
+func MaintenanceState(ctx context.Context) (services.MaintenanceState, error) {
+	return lucky.GetMaintenance(ctx)
+}
+
+// GetVerificationPurgeStatsHandler - GET /api/v1/admin/stats/verification_purge
+// Counters are kept by the process running the job; with prefork that is the
+// parent, and the children serving this route report zeros.
+func GetVerificationPurgeStatsHandler(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          lucky.VerificationPurgeStats(),
+	})
+}
+
+// RunAccountDeletion runs the account deletion job on the controllers'
+// service instance, so GET /admin/deletions reports its counters
+func RunAccountDeletion(ctx context.Context) {
+	lucky.RunAccountDeletion(ctx)
+}
+
+// ListDeletionRequestsHandler - GET /api/v1/admin/deletions
+// Accounts pending deletion, when each is due and why any are blocked. The
+// job counters come from the process running it, as for the OTP purge.
+func ListDeletionRequestsHandler(c *fiber.Ctx) error {
+	requests, err := lucky.DeletionRequests()
+	if err != nil {
+		logrus.Errorf("DeletionRequests error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch deletion requests"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data": fiber.Map{
+			"requests": requests,
+			"job":      lucky.AccountDeletionStats(),
+		},
+	})
+}
+
+// RunFreeBetExpiry runs the free bet expiry job on the controllers' service
+// instance, so GET /admin/freebets/liability reports its counters
+func RunFreeBetExpiry(ctx context.Context) {
+	lucky.RunFreeBetExpiry(ctx)
+}
+
+// FreeBetLiabilityHandler - GET /api/v1/admin/freebets/liability
+// Unexpired free bets by the day they expire. The job counters come from
+// the process running it, as for the OTP purge.
+func FreeBetLiabilityHandler(c *fiber.Ctx) error {
+	liability, err := lucky.FreeBetLiability()
+	if err != nil {
+		logrus.Errorf("FreeBetLiability error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch free bet liability"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data": fiber.Map{
+			"liability": liability,
+			"job":       lucky.FreeBetExpiryStats(),
+		},
+	})
+}
+
+// GetBasketHandler - GET /api/v1/admin/basket
+func GetBasketHandler(c *fiber.Ctx) error {
+	basket, err := lucky.GetBasket()
+	if err != nil {
+		logrus.Errorf("GetBasket error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch basket"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          basket,
+	})
+}
+
+// GetJackpotReconciliationHandler - GET /api/v1/admin/jackpots/reconcile
+// Each jackpot kitty against its opening balance + contributions - payouts
+func GetJackpotReconciliationHandler(c *fiber.Ctx) error {
+	kitties, err := lucky.ReconcileJackpots()
+	if err != nil {
+		logrus.Errorf("ReconcileJackpots error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to reconcile jackpots"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          kitties,
+	})
+}
+
+// GetJackpotConsistencyHandler - GET /api/v1/admin/jackpots/consistency
+// Games flagged is_jackpot against the jackpot kitties they should feed
+func GetJackpotConsistencyHandler(c *fiber.Ctx) error {
+	report, err := lucky.CheckJackpotConsistency(c.Context())
+	if err != nil {
+		logrus.Errorf("CheckJackpotConsistency error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to check jackpot consistency"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          report,
+	})
+}
+
+// WarnJackpotInconsistencies logs, once at startup, every jackpot game
+// without a kitty and every kitty no game feeds
+func WarnJackpotInconsistencies(ctx context.Context) {
+	lucky.WarnJackpotInconsistencies(ctx)
+}
+
+// AuditStatusesHandler - GET /api/v1/admin/audit/statuses
+// Stored statuses outside the vocabulary of package status
+func AuditStatusesHandler(c *fiber.Ctx) error {
+	rows, err := lucky.AuditStatuses()
+	if err != nil {
+		logrus.Errorf("AuditStatuses error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to audit statuses"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          rows,
+	})
+}
+
+// SimulateRTPHandler - POST /api/v1/admin/simulate_rtp
+// Plays simulated bets with candidate settings through the real box
+// generator and reports the RTP they would pay. Nothing is written.
+func SimulateRTPHandler(c *fiber.Ctx) error {
+	var sim services.RTPSimulation
+	if err := c.BodyParser(&sim); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	result, err := lucky.SimulateRTP(sim)
+	switch {
+	case errors.Is(err, services.ErrInvalidSimulation):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrUnknownGame):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "game not found"))
+	case err != nil:
+		logrus.Errorf("SimulateRTP error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to simulate RTP"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// GetSettingsHandler - GET /api/v1/admin/settings
+// The stored settings row, whether or not it validates.
+func GetSettingsHandler(c *fiber.Ctx) error {
+	settings, err := lucky.Settings(c.UserContext())
+	if errors.Is(err, services.ErrSettingsNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("Settings error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch settings"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          settings,
+	})
+}
+
+// UpdateSettingsHandler - PUT /api/v1/admin/settings {default_rtp, ...}
+// Sets the fields given and keeps the rest. The resulting row must
+// validate; the calling admin and each change are audited.
+func UpdateSettingsHandler(c *fiber.Ctx) error {
+	var change services.SettingsChange
+	if err := c.BodyParser(&change); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	settings, err := lucky.UpdateSettings(admin, change)
+	switch {
+	case errors.Is(err, services.ErrInvalidSettings):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrSettingsNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("UpdateSettings error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to update settings"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          settings,
+	})
+}
+
+// TopUpBasketHandler - POST /api/v1/admin/basket/topup {amount, note}
+// The calling admin is recorded with the top-up.
+func TopUpBasketHandler(c *fiber.Ctx) error {
+	var req TopUpBasketRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	topUp, err := lucky.TopUpBasket(admin, req.Amount, req.Note)
+	if errors.Is(err, services.ErrInvalidAmount) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("TopUpBasket error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to top up basket"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          topUp,
+	})
+}
+
+// GetRoundHandler - GET /api/v1/admin/rounds/:reference
+// The round of a bet or deposit reference with its full timeline.
+func GetRoundHandler(c *fiber.Ctx) error {
+	round, err := lucky.GetRound(c.Params("reference"))
+	if errors.Is(err, services.ErrRoundNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "round not found"))
+	}
+	if err != nil {
+		logrus.Errorf("GetRound error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch round"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          round,
+	})
+}
+
+// SearchHandler - GET /api/v1/admin/search?q=
+// Looks up a player by msisdn, or a bet, deposit or withdrawal chain by
+// reference or M-Pesa transaction id, for support. Each search is audited.
+func SearchHandler(c *fiber.Ctx) error {
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	result, err := lucky.Search(c.UserContext(), admin, c.Query("q"))
+	if errors.Is(err, services.ErrInvalidSearch) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("Search error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to search"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
+}
+
+// GetOutcomeDecisionHandler - GET /api/v1/admin/outcome_decisions/:reference
+// What a settled bet's outcome was decided from, for regulator queries.
+func GetOutcomeDecisionHandler(c *fiber.Ctx) error {
+	decision, err := lucky.GetOutcomeDecision(c.Params("reference"))
+	if errors.Is(err, services.ErrDecisionNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "outcome decision not found"))
+	}
+	if err != nil {
+		logrus.Errorf("GetOutcomeDecision error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch outcome decision"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          decision,
+	})
+}
+
+// GetMaintenanceHandler - GET /api/v1/admin/maintenance
+func GetMaintenanceHandler(c *fiber.Ctx) error {
+	state, err := lucky.GetMaintenance(c.UserContext())
+	if err != nil {
+		logrus.Errorf("GetMaintenance error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch maintenance state"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          state,
+	})
+}
+
+// SetMaintenanceHandler - PUT /api/v1/admin/maintenance
+// {scope, game_cat_id, betting_enabled, deposits_enabled, message}
+// Pauses or resumes betting, globally or on one game, and deposits. The
+// calling admin is recorded with the switch.
+func SetMaintenanceHandler(c *fiber.Ctx) error {
+	var req MaintenanceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	state, err := lucky.SetMaintenance(admin, req.Scope, string(req.GameCatID), req.BettingEnabled, req.DepositsEnabled, req.Message)
+	if errors.Is(err, services.ErrInvalidMaintenance) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("SetMaintenance error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to set maintenance switch"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          state,
+	})
+}
+
+// ListFeatureFlagsHandler - GET /api/v1/admin/flags
+func ListFeatureFlagsHandler(c *fiber.Ctx) error {
+	all, err := lucky.FeatureFlags(c.UserContext())
+	if err != nil {
+		logrus.Errorf("FeatureFlags error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch feature flags"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          all,
+	})
+}
+
+// SetFeatureFlagHandler - PUT /api/v1/admin/flags/:name
+// {enabled, percentage, allowlist}
+// Rolls a feature out to a share of players, or to everyone or no one. The
+// calling admin is recorded with the flag.
+func SetFeatureFlagHandler(c *fiber.Ctx) error {
+	var req FeatureFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	flag, err := lucky.SetFeatureFlag(admin, c.Params("name"), req.Enabled, req.Percentage, req.Allowlist)
+	if errors.Is(err, services.ErrInvalidFeatureFlag) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("SetFeatureFlag error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to set feature flag"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          flag,
+	})
+}
+
+// ListTaxRatesHandler - GET /api/v1/admin/tax_rates
+func ListTaxRatesHandler(c *fiber.Ctx) error {
+	rates, err := lucky.TaxRates(c.UserContext())
+	if err != nil {
+		logrus.Errorf("TaxRates error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch tax rates"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          rates,
+	})
+}
+
+// CreateTaxRateHandler - POST /api/v1/admin/tax_rates
+// {tax_type, rate, effective_from}
+// Schedules an excise or withholding rate. The calling admin is recorded
+// with it.
+func CreateTaxRateHandler(c *fiber.Ctx) error {
+	rate, ok, err := parseTaxRate(c)
+	if !ok {
+		return err
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	created, err := lucky.CreateTaxRate(admin, rate)
+	return taxRateResponse(c, 201, created, err)
+}
+
+// UpdateTaxRateHandler - PUT /api/v1/admin/tax_rates/:id
+// {rate, effective_from}
+// Moves or changes a rate not yet in effect
+func UpdateTaxRateHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid tax rate id"))
+	}
+	rate, ok, err := parseTaxRate(c)
+	if !ok {
+		return err
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	updated, err := lucky.UpdateTaxRate(admin, int64(id), rate)
+	return taxRateResponse(c, 200, updated, err)
+}
+
+// DeleteTaxRateHandler - DELETE /api/v1/admin/tax_rates/:id
+// Withdraws a rate not yet in effect
+func DeleteTaxRateHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid tax rate id"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	err = lucky.DeleteTaxRate(admin, int64(id))
+	if err != nil {
+		return taxRateResponse(c, 200, services.TaxRate{}, err)
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// parseTaxRate reads a TaxRateRequest. ok is false once the error response
+// has been written.
+func parseTaxRate(c *fiber.Ctx) (services.TaxRate, bool, error) {
+	var req TaxRateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return services.TaxRate{}, false, c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+	if req.Rate == nil || req.EffectiveFrom == nil {
+		return services.TaxRate{}, false, c.Status(400).JSON(models.NewErrorResponse(400, 1, "rate and effective_from are required"))
+	}
+	return services.TaxRate{TaxType: req.TaxType, Rate: *req.Rate, EffectiveFrom: *req.EffectiveFrom}, true, nil
+}
+
+func taxRateResponse(c *fiber.Ctx, status int, rate services.TaxRate, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidTaxRate):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrTaxRateNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case errors.Is(err, services.ErrTaxRateInEffect):
+		return c.Status(409).JSON(models.NewErrorResponse(409, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("tax rate save error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save tax rate"))
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"Status":        status,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          rate,
+	})
+}
+
+// GetWelcomeGrantHandler - GET /api/v1/admin/welcome_grant
+func GetWelcomeGrantHandler(c *fiber.Ctx) error {
+	grant, err := lucky.GetWelcomeGrant(c.UserContext())
+	if err != nil {
+		logrus.Errorf("GetWelcomeGrant error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch welcome grant"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          grant,
+	})
+}
+
+// SetWelcomeGrantHandler - PUT /api/v1/admin/welcome_grant
+// {enabled, free_bets, valid_hours}
+// Turns the welcome free bets of brand-new players on or off and sets how
+// many they get and for how long. The calling admin is recorded.
+func SetWelcomeGrantHandler(c *fiber.Ctx) error {
+	var req WelcomeGrantRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	grant, err := lucky.SetWelcomeGrant(admin, req.Enabled, req.FreeBets, req.ValidHours)
+	if errors.Is(err, services.ErrInvalidWelcomeGrant) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("SetWelcomeGrant error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to set welcome grant"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          grant,
+	})
+}
+
+// ListCampaignsHandler - GET /api/v1/admin/campaigns
+func ListCampaignsHandler(c *fiber.Ctx) error {
+	campaigns, err := lucky.ListCampaigns()
+	if err != nil {
+		logrus.Errorf("ListCampaigns error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch campaigns"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          campaigns,
+	})
+}
+
+// CreateCampaignHandler - POST /api/v1/admin/campaigns
+func CreateCampaignHandler(c *fiber.Ctx) error {
+	var campaign services.Campaign
+	if err := c.BodyParser(&campaign); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	created, err := lucky.CreateCampaign(campaign)
+	return campaignResponse(c, 201, created, err)
+}
+
+// UpdateCampaignHandler - PUT /api/v1/admin/campaigns/:id
+func UpdateCampaignHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid campaign id"))
+	}
+
+	var campaign services.Campaign
+	if err := c.BodyParser(&campaign); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+	campaign.ID = int64(id)
+
+	updated, err := lucky.UpdateCampaign(campaign)
+	return campaignResponse(c, 200, updated, err)
+}
+
+// DeleteCampaignHandler - DELETE /api/v1/admin/campaigns/:id
+func DeleteCampaignHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid campaign id"))
+	}
+
+	if err := lucky.DeleteCampaign(int64(id)); err != nil {
+		if errors.Is(err, services.ErrCampaignNotFound) {
+			return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+		}
+		logrus.Errorf("DeleteCampaign error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to delete campaign"))
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+func campaignResponse(c *fiber.Ctx, status int, campaign services.Campaign, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidCampaign):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrCampaignNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("campaign save error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save campaign"))
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"Status":        status,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          campaign,
+	})
+}
+
+// ListMessageTemplatesHandler - GET /api/v1/admin/templates
+func ListMessageTemplatesHandler(c *fiber.Ctx) error {
+	templates, err := lucky.ListMessageTemplates()
+	if err != nil {
+		logrus.Errorf("ListMessageTemplates error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch templates"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          templates,
+	})
+}
+
+// SaveMessageTemplateHandler - PUT /api/v1/admin/templates/:key/:language {body, active}
+func SaveMessageTemplateHandler(c *fiber.Ctx) error {
+	var req SaveTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	template := services.MessageTemplate{
+		Key:      c.Params("key"),
+		Language: c.Params("language"),
+		Body:     req.Body,
+		Active:   req.Active == nil || *req.Active,
+	}
+	saved, err := lucky.SaveMessageTemplate(template)
+	if errors.Is(err, services.ErrInvalidTemplate) {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("SaveMessageTemplate error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save template"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          saved,
+	})
+}
+
+// DeleteMessageTemplateHandler - DELETE /api/v1/admin/templates/:key/:language
+func DeleteMessageTemplateHandler(c *fiber.Ctx) error {
+	err := lucky.DeleteMessageTemplate(c.Params("key"), c.Params("language"))
+	if errors.Is(err, services.ErrTemplateNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("DeleteMessageTemplate error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to delete template"))
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// ListShortcodesHandler - GET /api/v1/admin/shortcodes
+func ListShortcodesHandler(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	shortcodes, err := lucky.Shortcodes(ctx)
+	if err != nil {
+		logrus.Errorf("Shortcodes error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch shortcodes"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          shortcodes,
+	})
+}
+
+// SaveShortcodeHandler - PUT /api/v1/admin/shortcodes/:shortcode {label, campaign, channel, default, active}
+func SaveShortcodeHandler(c *fiber.Ctx) error {
+	var req SaveShortcodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	saved, err := lucky.SaveShortcode(services.Shortcode{
+		Shortcode: c.Params("shortcode"),
+		Label:     req.Label,
+		Campaign:  req.Campaign,
+		Channel:   req.Channel,
+		Default:   req.Default,
+		Active:    req.Active == nil || *req.Active,
+	})
+	switch {
+	case errors.Is(err, services.ErrInvalidShortcode):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, database.ErrShortcodeConflict):
+		return c.Status(409).JSON(models.NewErrorResponse(409, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("SaveShortcode error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save shortcode"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          saved,
+	})
+}
+
+// DeleteShortcodeHandler - DELETE /api/v1/admin/shortcodes/:shortcode
+func DeleteShortcodeHandler(c *fiber.Ctx) error {
+	err := lucky.DeleteShortcode(c.Params("shortcode"))
+	if errors.Is(err, services.ErrShortcodeNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("DeleteShortcode error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to delete shortcode"))
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// GrantBonusHandler - POST /api/v1/admin/players/:msisdn/bonus {amount, validity_hours, reference}
+func GrantBonusHandler(c *fiber.Ctx) error {
+	var req GrantBonusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+	if req.ValidityHours <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "validity_hours must be positive"))
+	}
+
+	expiresAt := time.Now().Add(time.Duration(req.ValidityHours) * time.Hour)
+	id, err := lucky.GrantBonus(c.Params("msisdn"), req.Amount, expiresAt, "admin", req.Reference)
+	switch {
+	case errors.Is(err, services.ErrBonusAmount):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrPlayerNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "player not found"))
+	case err != nil:
+		logrus.Errorf("GrantBonus error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to grant bonus"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          fiber.Map{"id": id, "expires_at": expiresAt},
+	})
+}
+
+// RevokeSessionsHandler - POST /api/v1/admin/players/:msisdn/revoke_sessions
+// Logs the player out everywhere, e.g. after a stolen phone is reported.
+func RevokeSessionsHandler(c *fiber.Ctx) error {
+	msisdn := c.Params("msisdn")
+	revoked, err := lucky.RevokeSessions(msisdn)
+	if err != nil {
+		logrus.Errorf("RevokeSessions error for %s: %v", msisdn, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to revoke sessions"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	logrus.Warnf("sessions: %s revoked every session of %s", admin, msisdn)
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          revoked,
+	})
+}
+
+// ListPlayerSessionsHandler - GET /api/v1/admin/players/:msisdn/sessions
+func ListPlayerSessionsHandler(c *fiber.Ctx) error {
+	msisdn := c.Params("msisdn")
+	sessions, err := lucky.ListSessions(msisdn, "")
+	if err != nil {
+		logrus.Errorf("ListSessions error for %s: %v", msisdn, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to list sessions"))
+	}
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          sessions,
+	})
+}
+
+// EndPlayerSessionHandler - DELETE /api/v1/admin/sessions/:id
+// Logs one session of any player out during an investigation
+func EndPlayerSessionHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid session id"))
+	}
+
+	if err := lucky.EndSession("", int64(id)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+		}
+		logrus.Errorf("EndSession error for session %d: %v", id, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to end session"))
+	}
+
+	admin, _ := c.Locals("user").(jwt.MapClaims)["sub"].(string)
+	logrus.Warnf("sessions: %s ended session %d", admin, id)
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// RunWebhookDispatcher delivers partner webhooks from the controllers'
+// service instance
+func RunWebhookDispatcher(ctx context.Context) {
+	lucky.RunWebhookDispatcher(ctx)
+}
+
+// RunRevealDispatcher reveals delayed bets from the controllers' service
+// instance
+func RunRevealDispatcher(ctx context.Context) {
+	lucky.RunRevealDispatcher(ctx)
+}
+
+// RunBalanceSnapshots takes the daily basket and house income snapshots
+// from the controllers' service instance
+func RunBalanceSnapshots(ctx context.Context) {
+	lucky.RunBalanceSnapshots(ctx)
+}
+
+// RunInboundCallbackDispatcher retries stored gateway callbacks from the
+// controllers' service instance
+func RunInboundCallbackDispatcher(ctx context.Context) {
+	lucky.RunInboundCallbackDispatcher(ctx)
+}
+
+// ListWebhooksHandler - GET /api/v1/admin/webhooks
+func ListWebhooksHandler(c *fiber.Ctx) error {
+	subs, err := lucky.ListWebhookSubscriptions()
+	if err != nil {
+		logrus.Errorf("ListWebhookSubscriptions error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch webhooks"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          subs,
+	})
+}
+
+// CreateWebhookHandler - POST /api/v1/admin/webhooks
+// {partner_id, target_url, event_types, active?, secret?}; active defaults
+// to true, and the secret is generated when omitted and only returned here
+func CreateWebhookHandler(c *fiber.Ctx) error {
+	sub := services.WebhookSubscription{Active: true}
+	if err := c.BodyParser(&sub); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	created, err := lucky.CreateWebhookSubscription(sub)
+	return webhookResponse(c, 201, created, err)
+}
+
+// UpdateWebhookHandler - PUT /api/v1/admin/webhooks/:id
+func UpdateWebhookHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid webhook id"))
+	}
+
+	var sub services.WebhookSubscription
+	if err := c.BodyParser(&sub); err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	}
+
+	updated, err := lucky.UpdateWebhookSubscription(int64(id), sub)
+	return webhookResponse(c, 200, updated, err)
+}
+
+// DeleteWebhookHandler - DELETE /api/v1/admin/webhooks/:id
+func DeleteWebhookHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid webhook id"))
+	}
+
+	if err := lucky.DeleteWebhookSubscription(int64(id)); err != nil {
+		if errors.Is(err, services.ErrWebhookNotFound) {
+			return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+		}
+		logrus.Errorf("DeleteWebhookSubscription error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to delete webhook"))
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// ListWebhookDeliveriesHandler - GET /api/v1/admin/webhooks/:id/deliveries?page=1&page_size=20
+func ListWebhookDeliveriesHandler(c *fiber.Ctx) error {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid webhook id"))
+	}
+	page, err := utils.ParsePage(c.Query("page"), c.Query("page_size"))
+	if err != nil {
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	}
+
+	deliveries, err := lucky.ListWebhookDeliveries(int64(id), page)
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("ListWebhookDeliveries error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to fetch webhook deliveries"))
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          deliveries,
+	})
+}
+
+func webhookResponse(c *fiber.Ctx, status int, sub services.WebhookSubscription, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidWebhook):
+		return c.Status(400).JSON(models.NewErrorResponse(400, 1, err.Error()))
+	case errors.Is(err, services.ErrWebhookNotFound):
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	case err != nil:
+		logrus.Errorf("webhook save error: %v", err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save webhook"))
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"Status":        status,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          sub,
+	})
+}
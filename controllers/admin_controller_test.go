@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/services"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportRepo streams rows players as StreamPlayerStats does and records
+// where the callback stopped it
+type exportRepo struct {
+	*loginRepo
+	rows    int
+	handed  int
+	stopErr error
+}
+
+func (r *exportRepo) StreamPlayerStats(ctx context.Context, sort string, minBets int64, fn func(row map[string]interface{}) error) error {
+	row := map[string]interface{}{}
+	for i := 0; i < r.rows; i++ {
+		row["msisdn"] = fmt.Sprintf("2547%08d", i)
+		row["frequency"] = int64(4)
+		row["total_bets"] = 200.0
+		row["date_created"] = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+		r.handed++
+		if err := fn(row); err != nil {
+			r.stopErr = err
+			return err
+		}
+	}
+	return nil
+}
+
+func exportApp(t *testing.T, repo *exportRepo) *fiber.App {
+	t.Helper()
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/export", ExportPlayerStatsHandler)
+	return app
+}
+
+func TestExportPlayerStatsStreamsCSV(t *testing.T) {
+	repo := &exportRepo{loginRepo: newLoginRepo(), rows: 3*playerExportFlushRows + 7}
+	app := exportApp(t, repo)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/export?sort=rtp_desc", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("export = %d %s, want 200 text/csv", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != repo.rows+1 {
+		t.Fatalf("%d CSV records, want the header and %d rows", len(records), repo.rows)
+	}
+	if records[1][0] != "254700000000" || records[1][6] != "50.00" || records[1][11] != "2026-03-01T00:00:00Z" {
+		t.Errorf("first row = %v, want msisdn, an average stake of 50.00 and the creation date", records[1])
+	}
+	if repo.stopErr != nil {
+		t.Errorf("a full export stopped with %v", repo.stopErr)
+	}
+}
+
+func TestExportPlayerStatsRejectsSort(t *testing.T) {
+	repo := &exportRepo{loginRepo: newLoginRepo(), rows: 10}
+	app := exportApp(t, repo)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/export?sort=msisdn;drop", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 || repo.handed != 0 {
+		t.Errorf("bad sort = %d after %d rows, want 400 before any query", resp.StatusCode, repo.handed)
+	}
+}
+
+func TestExportPlayerStatsStopsOnCallbackError(t *testing.T) {
+	repo := &exportRepo{loginRepo: newLoginRepo(), rows: 1000}
+	s := services.NewLuckyNumberService(repo)
+	stop := errors.New("client gone")
+
+	n := 0
+	err := s.ExportPlayerStats(context.Background(), "", 0, func(p services.PlayerStats) error {
+		if n++; n == 10 {
+			return stop
+		}
+		return nil
+	})
+	if !errors.Is(err, stop) || repo.handed != 10 {
+		t.Errorf("export = %v after %d rows, want the callback's error after 10", err, repo.handed)
+	}
+}
+
+// shortcodeStatsRepo answers GetDepositsByShortcode and records the range
+type shortcodeStatsRepo struct {
+	*loginRepo
+	start, end time.Time
+}
+
+func (r *shortcodeStatsRepo) GetDepositsByShortcode(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	r.start, r.end = start, end
+	return []map[string]interface{}{
+		{"shortcode": "4093451", "label": "Radio Jambo", "campaign": "jambo", "known": true, "deposits": int64(3), "players": int64(2), "amount": 150.0},
+		{"shortcode": "999999", "label": "", "campaign": "", "known": false, "deposits": int64(1), "players": int64(1), "amount": 20.0},
+	}, nil
+}
+
+func TestDepositsByShortcodeHandler(t *testing.T) {
+	repo := &shortcodeStatsRepo{loginRepo: newLoginRepo()}
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/stats", GetDepositsByShortcodeHandler)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/stats?from=2026-03-01&to=2026-03-31", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Data []services.ShortcodeDeposits
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || len(body.Data) != 2 {
+		t.Fatalf("stats = %d %+v, want both shortcodes", resp.StatusCode, body.Data)
+	}
+	want := services.ShortcodeDeposits{Shortcode: "4093451", Label: "Radio Jambo", Campaign: "jambo", Known: true, Deposits: 3, Players: 2, Amount: 150}
+	if body.Data[0] != want || body.Data[1].Known || body.Data[1].Shortcode != "999999" {
+		t.Errorf("stats = %+v, want the campaign's and an unknown shortcode", body.Data)
+	}
+	if repo.start.Format("2006-01-02") != "2026-03-01" || repo.end.Format("2006-01-02") != "2026-03-31" {
+		t.Errorf("queried %v to %v, want March 2026", repo.start, repo.end)
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/stats?from=yesterday", nil))
+	if resp.StatusCode != 400 {
+		t.Errorf("bad from = %d, want 400", resp.StatusCode)
+	}
+}
+
+// financeRepo answers the finance report with one day of stakes whose kpi
+// row counts 50 too much
+type financeRepo struct {
+	*loginRepo
+}
+
+func (r *financeRepo) GetReportFigures(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{
+		{"day": "2026-03-02", "figure": "stakes", "amount": 300.0, "count": int64(3)},
+		{"day": "2026-03-02", "figure": "wins", "amount": 120.0, "count": int64(2)},
+		{"day": "2026-03-02", "figure": "deposits", "amount": 1000.0, "count": int64(4)},
+	}, nil
+}
+
+func (r *financeRepo) GetDailyKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{
+		{"date": "2026-03-02", "bet": 350.0, "bet_count": int64(3), "payout": 120.0, "handle": 1000.0},
+	}, nil
+}
+
+func TestDailyReportHandler(t *testing.T) {
+	repo := &financeRepo{loginRepo: newLoginRepo()}
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/daily", GetDailyReportHandler)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/daily?date=2026-03-02", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body struct {
+		Data services.FinanceReport
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || body.Data.Totals.Handle != 300 || body.Data.Totals.GGR != 180 || body.Data.Totals.DepositsTotal != 1000 {
+		t.Errorf("report = %d %+v, want 300 handle, 180 GGR and 1000 deposits", resp.StatusCode, body.Data.Totals)
+	}
+	if len(body.Data.Discrepancies) != 1 || body.Data.Discrepancies[0].Counter != "bet" {
+		t.Errorf("discrepancies = %+v, want the drifted bet counter", body.Data.Discrepancies)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/daily?date=2026-03-02&format=csv", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" ||
+		resp.Header.Get("Content-Disposition") != `attachment; filename="report-2026-03-02.csv"` {
+		t.Errorf("headers = %v, want a CSV attachment", resp.Header)
+	}
+	r := csv.NewReader(resp.Body)
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		reportExportHeader,
+		{"2026-03-02", "300.00", "3", "120.00", "180.00", "0.00", "0.00", "1000.00", "0.00", "1000.00", "0.00", "0.00", "0", "0.00", "0.00"},
+		{"total", "300.00", "3", "120.00", "180.00", "0.00", "0.00", "1000.00", "0.00", "1000.00", "0.00", "0.00", "0", "0.00", "0.00"},
+		{"date", "counter", "kpi", "recomputed", "difference"},
+		{"2026-03-02", "bet", "350.00", "300.00", "50.00"},
+	}
+	if fmt.Sprint(records) != fmt.Sprint(want) {
+		t.Errorf("csv = %q\nwant %q", records, want)
+	}
+
+	for _, query := range []string{"?date=02-03-2026", "?date=2026-03-02&format=xlsx"} {
+		resp, _ = app.Test(httptest.NewRequest("GET", "/daily"+query, nil))
+		if resp.StatusCode != 400 {
+			t.Errorf("%s = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
+
+// historyRepo serves a week of snapshots, 2026-03-01 through 2026-03-07,
+// by business day as GetBalanceSnapshots does
+type historyRepo struct {
+	*loginRepo
+	snapshots []map[string]interface{}
+}
+
+func newHistoryRepo() *historyRepo {
+	repo := &historyRepo{loginRepo: newLoginRepo()}
+	for day := 1; day <= 7; day++ {
+		repo.snapshots = append(repo.snapshots, map[string]interface{}{
+			"day": fmt.Sprintf("2026-03-%02d", day), "basket": 1000.0 + float64(day)*100,
+			"basket_credit": 50.0, "basket_debit": 150.0, "house_income": float64(day) * 40,
+			"day_house_income": 40.0, "taken_at": time.Date(2026, 3, day, 20, 55, 0, 0, time.UTC)})
+	}
+	return repo
+}
+
+func (r *historyRepo) GetBalanceSnapshots(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	from, to := start.In(clock.Location()).Format("2006-01-02"), end.In(clock.Location()).Format("2006-01-02")
+	var rows []map[string]interface{}
+	for _, row := range r.snapshots {
+		if day := row["day"].(string); day >= from && day <= to {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func TestBasketHistoryHandler(t *testing.T) {
+	repo := newHistoryRepo()
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/history", GetBasketHistoryHandler)
+
+	history := func(query string) services.BalanceHistory {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/history"+query, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Data services.BalanceHistory
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("%s = %d, %v", query, resp.StatusCode, err)
+		}
+		return body.Data
+	}
+
+	got := history("?from=2026-03-02&to=2026-03-05")
+	if got.From != "2026-03-02" || got.To != "2026-03-05" || len(got.Snapshots) != 4 {
+		t.Fatalf("history = %+v, want 4 days", got)
+	}
+	for i, snapshot := range got.Snapshots {
+		day := i + 2
+		if snapshot.Date != fmt.Sprintf("2026-03-%02d", day) || snapshot.Basket != 1000+float64(day)*100 ||
+			snapshot.BasketDebit != 150 || snapshot.HouseIncome != float64(day)*40 || snapshot.TakenAt.IsZero() {
+			t.Errorf("snapshot %d = %+v", i, snapshot)
+		}
+	}
+
+	// The last 30 days by default, today included
+	defer clock.ConfigureSource(nil)
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 7, 21, 30, 0, 0, time.UTC) }) // 00:30 on the 8th in Nairobi
+	if got := history(""); got.From != "2026-02-07" || got.To != "2026-03-08" || len(got.Snapshots) != 7 {
+		t.Errorf("default history = %s to %s, %d snapshots, want the week within the last 30 days", got.From, got.To, len(got.Snapshots))
+	}
+	if got := history("?from=2026-04-01&to=2026-04-30"); got.Snapshots == nil || len(got.Snapshots) != 0 {
+		t.Errorf("empty month = %+v, want an empty series", got.Snapshots)
+	}
+
+	for _, query := range []string{"?from=2026-03-05&to=2026-03-02", "?from=2026-03-02", "?from=yesterday&to=2026-03-05"} {
+		resp, _ := app.Test(httptest.NewRequest("GET", "/history"+query, nil))
+		if resp.StatusCode != 400 {
+			t.Errorf("%s = %d, want 400", query, resp.StatusCode)
+		}
+	}
+}
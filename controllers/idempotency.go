@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fiberapp/services"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// maxIdempotencyKeyLen bounds client supplied keys
+const maxIdempotencyKeyLen = 128
+
+// Idempotent answers a repeated request to route from the caller with the
+// response to the first one. Clients name a request with the Idempotency-Key
+// header or a client_request_id body field; a replay is marked with the
+// Idempotent-Replayed header. A keyless request identical to one made
+// within limits.duplicate_bet_window gets StatusCode 4, which the app can
+// ignore. Register it after JWTMiddleware.
+func Idempotent(route string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(jwt.MapClaims)
+		if !ok {
+			return c.Next()
+		}
+		msisdn, _ := claims["sub"].(string)
+
+		var body map[string]interface{}
+		if msisdn == "" || json.Unmarshal(c.Body(), &body) != nil {
+			// The handler rejects what it cannot parse
+			return c.Next()
+		}
+
+		key := c.Get("Idempotency-Key")
+		if id, ok := body["client_request_id"]; ok {
+			if key == "" && id != nil {
+				key = fmt.Sprint(id)
+			}
+			delete(body, "client_request_id")
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			return fail(c, 400, 1, "idempotency_key_invalid", maxIdempotencyKeyLen)
+		}
+
+		// Keys come out sorted, so the hash does not depend on field order
+		canonical, err := json.Marshal(body)
+		if err != nil {
+			return c.Next()
+		}
+		sum := sha256.Sum256(canonical)
+		hash := hex.EncodeToString(sum[:])
+
+		claim, replay, err := lucky.BeginIdempotent(msisdn, route, key, hash)
+		switch {
+		case errors.Is(err, services.ErrDuplicateRequest):
+			return fail(c, 202, 4, "duplicate_request")
+		case errors.Is(err, services.ErrRequestInProgress):
+			return fail(c, 202, 4, "request_in_progress")
+		case errors.Is(err, services.ErrIdempotencyMismatch):
+			return fail(c, 422, 1, "idempotency_key_mismatch")
+		case err != nil && key != "":
+			logrus.Errorf("idempotency %s: %v", route, err)
+			return fail(c, 503, 1, "internal_error")
+		case err != nil:
+			// Without a key the guard is best effort
+			logrus.Warnf("idempotency %s: %v", route, err)
+			return c.Next()
+		case replay != nil:
+			c.Set("Idempotent-Replayed", "true")
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.Status(replay.Status).Send(replay.Body)
+		}
+
+		if err := c.Next(); err != nil {
+			lucky.FinishIdempotent(claim, fiber.StatusInternalServerError, nil)
+			return err
+		}
+		resp := c.Response()
+		lucky.FinishIdempotent(claim, resp.StatusCode(), append([]byte(nil), resp.Body()...))
+		return nil
+	}
+}
@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"context"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/services"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type memIdempotencyKey struct {
+	database.IdempotentRequest
+	expiresAt time.Time
+}
+
+// idempotencyRepo keeps idempotency_keys in memory
+type idempotencyRepo struct {
+	*loginRepo
+	keys map[string]*memIdempotencyKey
+}
+
+func newIdempotencyRepo() *idempotencyRepo {
+	return &idempotencyRepo{loginRepo: newLoginRepo(), keys: map[string]*memIdempotencyKey{}}
+}
+
+func (r *idempotencyRepo) ClaimIdempotencyKey(ctx context.Context, msisdn, route, key, requestHash string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := msisdn + "|" + route + "|" + key
+	if k, ok := r.keys[id]; ok && time.Now().Before(k.expiresAt) {
+		return false, nil
+	}
+	r.keys[id] = &memIdempotencyKey{IdempotentRequest: database.IdempotentRequest{RequestHash: requestHash}, expiresAt: expiresAt}
+	return true, nil
+}
+
+func (r *idempotencyRepo) GetIdempotencyKey(ctx context.Context, msisdn, route, key string) (*database.IdempotentRequest, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[msisdn+"|"+route+"|"+key]
+	if !ok || !time.Now().Before(k.expiresAt) {
+		return nil, nil
+	}
+	stored := k.IdempotentRequest
+	return &stored, nil
+}
+
+func (r *idempotencyRepo) SaveIdempotentResponse(ctx context.Context, msisdn, route, key string, statusCode int, response []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if k, ok := r.keys[msisdn+"|"+route+"|"+key]; ok {
+		k.StatusCode, k.Response = statusCode, response
+	}
+	return nil
+}
+
+func (r *idempotencyRepo) ReleaseIdempotencyKey(ctx context.Context, msisdn, route, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.keys, msisdn+"|"+route+"|"+key)
+	return nil
+}
+
+// idempotentApp serves POST /bet behind Idempotent with window as the
+// duplicate bet window. The handler takes a moment, so concurrent requests
+// overlap, and counts how often it runs.
+func idempotentApp(t *testing.T, window time.Duration) (*fiber.App, *int32) {
+	t.Helper()
+	limits := config.Default().Limits
+	limits.DuplicateBetWindow = window
+	services.Configure(limits)
+	t.Cleanup(func() { services.Configure(config.Default().Limits) })
+
+	repo := newIdempotencyRepo()
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+
+	var runs int32
+	app := fiber.New()
+	app.Post("/bet", func(c *fiber.Ctx) error {
+		c.Locals("user", jwt.MapClaims{"sub": "254700000001"})
+		return c.Next()
+	}, Idempotent("bet"), func(c *fiber.Ctx) error {
+		n := atomic.AddInt32(&runs, 1)
+		time.Sleep(20 * time.Millisecond)
+		return c.JSON(fiber.Map{"Status": 201, "StatusCode": 0, "StatusMessage": fmt.Sprintf("bet %d", n)})
+	})
+	return app, &runs
+}
+
+type idempotentAnswer struct {
+	status   int
+	body     string
+	replayed bool
+}
+
+func postBet(t *testing.T, app *fiber.App, key, body string) idempotentAnswer {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/bet", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Error(err)
+		return idempotentAnswer{}
+	}
+	out, _ := io.ReadAll(resp.Body)
+	return idempotentAnswer{resp.StatusCode, string(out), resp.Header.Get("Idempotent-Replayed") == "true"}
+}
+
+// concurrently sends n copies of body at once
+func concurrently(t *testing.T, app *fiber.App, n int, key func(i int) string, body func(i int) string) []idempotentAnswer {
+	t.Helper()
+	answers := make([]idempotentAnswer, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			answers[i] = postBet(t, app, key(i), body(i))
+		}(i)
+	}
+	wg.Wait()
+	return answers
+}
+
+const betBody = `{"choice":"3","amount":20,"game_cat_id":"1","channel":"web"}`
+
+func TestIdempotencyKeyConcurrentDuplicates(t *testing.T) {
+	app, runs := idempotentApp(t, 2*time.Second)
+	answers := concurrently(t, app, 8, func(int) string { return "tap-1" }, func(int) string { return betBody })
+	if *runs != 1 {
+		t.Fatalf("bet processed %d times for one key, want once", *runs)
+	}
+	for _, a := range answers {
+		inProgress := a.status == 202 && strings.Contains(a.body, "request_in_progress")
+		if !inProgress && (a.status != 200 || !strings.Contains(a.body, "bet 1")) {
+			t.Errorf("duplicate answered %d %s, want the first response or request_in_progress", a.status, a.body)
+		}
+	}
+
+	// Once answered, the key replays the stored response
+	replay := postBet(t, app, "tap-1", betBody)
+	if !replay.replayed || replay.status != 200 || !strings.Contains(replay.body, "bet 1") {
+		t.Errorf("replay = %+v, want the stored bet 1 marked replayed", replay)
+	}
+	if *runs != 1 {
+		t.Errorf("replay processed the bet again")
+	}
+	// Reordered fields are the same request
+	if a := postBet(t, app, "tap-1", `{"channel":"web","game_cat_id":"1","amount":20,"choice":"3"}`); !a.replayed {
+		t.Errorf("reordered body = %+v, want a replay", a)
+	}
+	if a := postBet(t, app, "tap-1", `{"choice":"4","amount":20,"game_cat_id":"1","channel":"web"}`); a.status != 422 {
+		t.Errorf("key reused for another bet = %d %s, want 422", a.status, a.body)
+	}
+}
+
+func TestKeylessConcurrentDuplicates(t *testing.T) {
+	app, runs := idempotentApp(t, 2*time.Second)
+	answers := concurrently(t, app, 8, func(int) string { return "" }, func(int) string { return betBody })
+	if *runs != 1 {
+		t.Fatalf("identical keyless bet processed %d times, want once", *runs)
+	}
+	duplicates := 0
+	for _, a := range answers {
+		if a.status == 202 && strings.Contains(a.body, `"StatusCode":4`) && strings.Contains(a.body, "duplicate_request") {
+			duplicates++
+		}
+	}
+	if duplicates != len(answers)-1 {
+		t.Errorf("%d duplicates answered StatusCode 4, want %d", duplicates, len(answers)-1)
+	}
+	// client_request_id names the request like the header
+	if a := postBet(t, app, "", `{"client_request_id":"tap-2",`+betBody[1:]); a.status != 200 {
+		t.Errorf("keyed bet after a keyless one = %d %s, want 200", a.status, a.body)
+	}
+}
+
+func TestDistinctBetsWithinWindow(t *testing.T) {
+	app, runs := idempotentApp(t, 2*time.Second)
+	answers := concurrently(t, app, 5, func(int) string { return "" }, func(i int) string {
+		return fmt.Sprintf(`{"choice":"%d","amount":20,"game_cat_id":"1","channel":"web"}`, i+1)
+	})
+	if *runs != 5 {
+		t.Errorf("%d of 5 distinct bets processed, want all", *runs)
+	}
+	for _, a := range answers {
+		if a.status != 200 {
+			t.Errorf("distinct bet = %d %s, want 200", a.status, a.body)
+		}
+	}
+}
+
+func TestKeylessWindowDisabledAndExpired(t *testing.T) {
+	app, runs := idempotentApp(t, 0)
+	postBet(t, app, "", betBody)
+	postBet(t, app, "", betBody)
+	if *runs != 2 {
+		t.Errorf("window 0 processed %d of 2 bets, want both", *runs)
+	}
+
+	app, runs = idempotentApp(t, 50*time.Millisecond)
+	postBet(t, app, "", betBody)
+	time.Sleep(100 * time.Millisecond)
+	if a := postBet(t, app, "", betBody); a.status != 200 || *runs != 2 {
+		t.Errorf("same bet after the window = %d %s, want processed", a.status, a.body)
+	}
+}
@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/internalapi"
+	"fiberapp/money"
+	"fiberapp/services"
+	"fiberapp/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// Handlers of the internal API the USSD gateway calls. They answer with the
+// internalapi types instead of the public envelope; bets go through the
+// same checks and service calls as /place_bet_pawabox.
+
+// InternalAuth rejects calls that do not send token as a bearer token
+func InternalAuth(token string) fiber.Handler {
+	want := []byte("Bearer " + token)
+	return func(c *fiber.Ctx) error {
+		if subtle.ConstantTimeCompare([]byte(c.Get(fiber.HeaderAuthorization)), want) != 1 {
+			return c.Status(fiber.StatusUnauthorized).JSON(internalapi.Error{
+				Status:  fiber.StatusUnauthorized,
+				Code:    "unauthorized",
+				Message: "missing or wrong internal token",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// internalFail answers with the internalapi.Error for err. Codes and
+// messages are the ones the public API would send.
+func internalFail(c *fiber.Ctx, status int, err error) error {
+	code, detail := errorCode(err)
+	var args []interface{}
+	var text string
+
+	var paused *services.MaintenanceError
+	var throttled *services.BetThrottleError
+	var stake *services.StakeError
+	var amount *money.Error
+	switch {
+	case errors.As(err, &throttled):
+		status, code, detail = fiber.StatusTooManyRequests, throttled.Code(), ""
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(throttled.RetrySeconds(), 10))
+	case errors.As(err, &paused):
+		status, code, detail = fiber.StatusServiceUnavailable, "betting_paused", ""
+		if paused.Deposits {
+			code = "deposits_paused"
+		}
+		text = paused.Message
+	case errors.As(err, &stake):
+		code, detail = stake.Code, ""
+		if stake.Limit != nil {
+			args = append(args, stake.Limit)
+		}
+	case errors.As(err, &amount):
+		code, detail = amount.Code, ""
+		if amount.Limit != nil {
+			args = append(args, amount.Limit)
+		}
+	case errors.Is(err, services.ErrServerBusy):
+		status = fiber.StatusServiceUnavailable
+	}
+
+	if code == "" {
+		if status < 500 {
+			code, text = "error", err.Error()
+		} else {
+			logrus.Errorf("%s %s: %v", c.Method(), c.Path(), err)
+			code = "internal_error"
+		}
+	}
+	if text == "" {
+		text = message(c, code, args...)
+	}
+	if detail != "" {
+		text += ": " + detail
+	}
+	return c.Status(status).JSON(internalapi.Error{Status: status, Code: code, Message: text})
+}
+
+// internalRefuse answers with the catalogued message code
+func internalRefuse(c *fiber.Ctx, status int, code string) error {
+	return c.Status(status).JSON(internalapi.Error{Status: status, Code: code, Message: message(c, code)})
+}
+
+// InternalPlayerSummary - GET /internal/v1/players/:msisdn
+func InternalPlayerSummary(c *fiber.Ctx) error {
+	msisdn, err := utils.NormalizeMsisdn(c.Params("msisdn"))
+	if err != nil {
+		return internalFail(c, fiber.StatusBadRequest, err)
+	}
+	user, err := lucky.CheckUserNoCreating(msisdn)
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+	if user == nil {
+		return internalFail(c, fiber.StatusNotFound, services.ErrProfileNotFound)
+	}
+
+	summary := internalapi.PlayerSummary{
+		Msisdn:  msisdn,
+		Name:    utils.ToString(user["name"]),
+		Balance: utils.NumericFloat(user["balance"]),
+		Bonus:   utils.NumericFloat(user["bonus"]),
+	}
+	if freeBet := services.FreeBetOf(user); freeBet.Active(clock.Now()) {
+		summary.FreeBet = freeBet.Amount
+	}
+	return c.JSON(summary)
+}
+
+// InternalActiveGames - GET /internal/v1/games
+func InternalActiveGames(c *fiber.Ctx) error {
+	stored, err := lucky.CheckGame("all")
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+	rows, _ := stored.([]map[string]interface{})
+
+	games := make([]internalapi.Game, 0, len(rows))
+	for _, row := range rows {
+		id := utils.ToString(row["id"])
+		stakes, err := lucky.StakeRules(id)
+		if errors.Is(err, services.ErrUnknownGame) {
+			continue // deactivated since the list was read
+		}
+		if err != nil {
+			return internalFail(c, fiber.StatusInternalServerError, err)
+		}
+		games = append(games, internalapi.Game{
+			ID:           id,
+			Name:         utils.ToString(row["name"]),
+			Category:     utils.ToString(row["category"]),
+			Boxes:        utils.ToInt(row["boxes"]),
+			StakeMode:    stakes.Mode,
+			DefaultStake: stakes.DefaultStake,
+			Stakes:       stakes.Options(),
+		})
+	}
+	return c.JSON(games)
+}
+
+// InternalPlaceBet - POST /internal/v1/bets
+// Places and settles a single-box bet for the player, creating the player
+// on a first bet like /place_bet_pawabox does.
+func InternalPlaceBet(c *fiber.Ctx) error {
+	var req internalapi.PlaceBetRequest
+	if err := c.BodyParser(&req); err != nil {
+		return internalRefuse(c, fiber.StatusBadRequest, "invalid_json")
+	}
+	msisdn, err := utils.NormalizeMsisdn(req.Msisdn)
+	if err != nil {
+		return internalFail(c, fiber.StatusBadRequest, err)
+	}
+	if req.Channel == "" {
+		req.Channel = internalapi.ChannelUSSD
+	}
+	var ok bool
+	if req.Channel, ok = parseChannel(req.Channel); !ok {
+		return internalRefuse(c, fiber.StatusBadRequest, "invalid_channel")
+	}
+
+	game, err := lucky.GetPlayableGame(c.Context(), req.GameCatID)
+	if errors.Is(err, services.ErrUnknownGame) {
+		return internalFail(c, fiber.StatusNotFound, err)
+	}
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+	stakes, err := lucky.StakeRules(game.ID)
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+	user, err := lucky.CheckUser(msisdn, "", "")
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+
+	result, err := placeLuckyBet(c.UserContext(), user, game, stakes, msisdn, req.USSD, req.Stake, req.Box, req.Channel)
+	var stake *services.StakeError
+	switch {
+	case errors.Is(err, errInvalidLuckyNumber), errors.As(err, &stake), errors.Is(err, money.ErrInvalidAmount):
+		return internalFail(c, fiber.StatusUnprocessableEntity, err)
+	case errors.Is(err, database.ErrInsufficientBalance):
+		return internalFail(c, fiber.StatusPaymentRequired, err)
+	case err != nil:
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+
+	if result.Reveal != nil {
+		return c.JSON(internalapi.Bet{
+			Reference: result.Reveal.Reference,
+			Result:    result.Reveal.Status,
+			Box:       req.Box,
+			FreeBet:   utils.ToBool(result.FreeBet),
+			Message:   result.Message,
+			RevealAt:  &result.Reveal.RevealAt,
+		})
+	}
+
+	display := result.GameResult
+	return c.JSON(internalapi.Bet{
+		Reference:     display.GameID,
+		Result:        display.ResultStatus.String(),
+		Box:           display.SelectedBox,
+		Jackpot:       utils.ToBool(display.JackPot),
+		GrossAmount:   display.GrossAmount,
+		TaxAmount:     display.TaxAmount,
+		NetAmount:     display.NetAmount,
+		PayoutDelayed: display.PayoutDelayed,
+		FreeBet:       utils.ToBool(result.FreeBet),
+		Message:       result.Message,
+	})
+}
+
+// InternalBetResult - GET /internal/v1/bets/:reference
+func InternalBetResult(c *fiber.Ctx) error {
+	round, err := lucky.GetRound(c.Params("reference"))
+	if errors.Is(err, services.ErrRoundNotFound) {
+		return internalFail(c, fiber.StatusNotFound, err)
+	}
+	if err != nil {
+		return internalFail(c, fiber.StatusInternalServerError, err)
+	}
+	return c.JSON(internalapi.BetStatus{
+		Reference:   round.Reference,
+		Msisdn:      round.Msisdn,
+		GameCatID:   round.GameCatID,
+		Stake:       round.Amount,
+		State:       round.State,
+		DateCreated: round.DateCreated,
+		DateUpdated: round.DateUpdated,
+	})
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/services"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginRepo holds the players and verification codes /login touches
+type loginRepo struct {
+	database.LuckyRepo
+
+	mu      sync.Mutex
+	players map[string]map[string]interface{}
+	promos  map[string]bool
+	codes   map[string]int    // msisdn -> codes issued
+	hashes  map[string]string // msisdn -> latest code hash
+	sms     int
+	smsDown bool // dbQueue inserts fail
+}
+
+func newLoginRepo() *loginRepo {
+	return &loginRepo{players: map[string]map[string]interface{}{}, promos: map[string]bool{}, codes: map[string]int{}, hashes: map[string]string{}}
+}
+
+func (r *loginRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p, ok := r.players[msisdn]; ok {
+		return p, nil
+	}
+	return nil, nil
+}
+
+func (r *loginRepo) CreateUser(ctx context.Context, carrier, msisdn, name, myPromocode, promocode string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.players[msisdn] = map[string]interface{}{"msisdn": msisdn, "active_status": "active", "self_exclusion": "NO"}
+	return int64(len(r.players)), nil
+}
+
+func (r *loginRepo) CreatePromo(ctx context.Context, msisdn, promocode string) (int64, error) {
+	return 1, nil
+}
+
+func (r *loginRepo) CheckPromoCode(ctx context.Context, promo string) (map[string]interface{}, error) {
+	if r.promos[promo] {
+		return map[string]interface{}{"promocode": promo}, nil
+	}
+	return nil, nil
+}
+
+func (r *loginRepo) InsertVerification(ctx context.Context, msisdn, purpose, codeHash string, expired, created int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codes[msisdn]++
+	r.hashes[msisdn] = codeHash
+	return r.codes[msisdn] - 1, nil // each code still valid: every later login resends it
+}
+
+func (r *loginRepo) GetOTPChecked(ctx context.Context, msisdn, purpose string, guess database.OTPGuess) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.hashes[msisdn] == "" || r.hashes[msisdn] != guess.Hash {
+		return nil, nil
+	}
+	return map[string]interface{}{"id": int32(1), "msisdn": msisdn, "expired": time.Now().Unix() + 60, "status": int32(0)}, nil
+}
+
+func (r *loginRepo) GetOTPVerified(ctx context.Context, msisdn, purpose string, guess database.OTPGuess, now int64) (map[string]interface{}, error) {
+	return r.GetOTPChecked(ctx, msisdn, purpose, guess)
+}
+
+func (r *loginRepo) UpdateIntoVerification(ctx context.Context, id int32) (int64, error) {
+	return 1, nil
+}
+
+func (r *loginRepo) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.smsDown {
+		return 0, errors.New("dbQueue: connection reset")
+	}
+	r.sms++
+	return int64(r.sms), nil
+}
+
+func (r *loginRepo) GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *loginRepo) ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+// loginApp serves /login over repo with latency as the minimum response time
+func loginApp(t *testing.T, repo *loginRepo, latency time.Duration) *fiber.App {
+	t.Helper()
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+	limits := config.Default().Limits
+	limits.LoginMinLatency = latency
+	services.Configure(limits)
+	t.Cleanup(func() { services.Configure(config.Default().Limits) })
+
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+
+	app := fiber.New()
+	app.Post("/login", Login)
+	return app
+}
+
+func postLogin(t *testing.T, app *fiber.App, body string) (int, string, time.Duration) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	start := time.Now()
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elapsed := time.Since(start)
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(out), elapsed
+}
+
+func TestLoginDoesNotRevealAccountState(t *testing.T) {
+	repo := newLoginRepo()
+	repo.players["254711000001"] = map[string]interface{}{"active_status": "active", "self_exclusion": "NO"}
+	repo.players["254711000002"] = map[string]interface{}{"active_status": "inactive", "self_exclusion": "NO"}
+	repo.players["254711000003"] = map[string]interface{}{"active_status": "active", "self_exclusion": "YES"}
+	app := loginApp(t, repo, 0)
+
+	cases := map[string]string{
+		"registered":    `{"msisdn":"254711000001"}`,
+		"inactive":      `{"msisdn":"254711000002"}`,
+		"self-excluded": `{"msisdn":"254711000003"}`,
+		"unknown":       `{"msisdn":"254711000004"}`,
+		"bad promocode": `{"msisdn":"254711000005","promocode":"NOPE"}`,
+	}
+	var first string
+	for name, body := range cases {
+		status, resp, _ := postLogin(t, app, body)
+		if status != 200 {
+			t.Errorf("%s: status %d, want 200", name, status)
+		}
+		if first == "" {
+			first = resp
+		} else if resp != first {
+			t.Errorf("%s: body %s differs from %s", name, resp, first)
+		}
+	}
+	for _, msisdn := range []string{"254711000001", "254711000002", "254711000003", "254711000004", "254711000005"} {
+		if repo.codes[msisdn] != 1 {
+			t.Errorf("%s got %d codes, want one whatever its state", msisdn, repo.codes[msisdn])
+		}
+	}
+}
+
+func TestVerifyOTPRevealsAccountState(t *testing.T) {
+	// 254717029580 is a fixed test account whose login code is always 1111
+	repo := newLoginRepo()
+	repo.players["254717029580"] = map[string]interface{}{"active_status": "inactive", "self_exclusion": "NO"}
+	app := loginApp(t, repo, 0)
+	app.Post("/verify_otp", VerifyOTP)
+
+	if status, _, _ := postLogin(t, app, `{"msisdn":"254717029580"}`); status != 200 {
+		t.Fatalf("login status %d, want 200", status)
+	}
+	req := httptest.NewRequest("POST", "/verify_otp", strings.NewReader(`{"msisdn":"254717029580","otp":"1111"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 202 || !strings.Contains(string(body), "account_inactive") {
+		t.Errorf("verify = %d %s, want 202 account_inactive once the OTP checks out", resp.StatusCode, body)
+	}
+}
+
+func TestLoginFixedCodeResendsLeft(t *testing.T) {
+	// 254717629732 always gets 2222; asking again counts as a resend of it
+	repo := newLoginRepo()
+	app := loginApp(t, repo, 0)
+	want, err := auth.HashOTP("254717629732", services.OTPLogin, "2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, left := range []string{"3", "2", "1"} {
+		status, body, _ := postLogin(t, app, `{"msisdn":"254717629732"}`)
+		if status != 200 || !strings.Contains(body, `"ResendsLeft":`+left) {
+			t.Errorf("login = %d %s, want %s resends left", status, body, left)
+		}
+	}
+	if repo.hashes["254717629732"] != want {
+		t.Error("a test account's login code is not its fixed code")
+	}
+}
+
+func TestLoginRejectsMalformedMsisdn(t *testing.T) {
+	app := loginApp(t, newLoginRepo(), 0)
+	if status, _, _ := postLogin(t, app, `{"msisdn":"12ab"}`); status != 400 {
+		t.Errorf("malformed msisdn status %d, want 400", status)
+	}
+}
+
+func TestLoginMinimumLatency(t *testing.T) {
+	const latency = 80 * time.Millisecond
+	repo := newLoginRepo()
+	repo.players["254711000001"] = map[string]interface{}{"active_status": "active", "self_exclusion": "NO"}
+	app := loginApp(t, repo, latency)
+
+	// Registering a new number does more work than signing in a known one;
+	// both answer no sooner than the floor
+	for _, msisdn := range []string{"254711000001", "254711000009"} {
+		if _, _, elapsed := postLogin(t, app, `{"msisdn":"`+msisdn+`"}`); elapsed < latency {
+			t.Errorf("%s answered in %s, want at least %s", msisdn, elapsed, latency)
+		}
+	}
+}
+
+func TestAccountState(t *testing.T) {
+	cases := []struct {
+		active, excluded string
+		want             error
+	}{
+		{"active", "NO", nil},
+		{"inactive", "NO", services.ErrAccountInactive},
+		{"pending_deletion", "NO", services.ErrAccountInactive},
+		{"deleted", "YES", services.ErrAccountInactive},
+		{"active", "YES", services.ErrAccountSelfExcluded},
+	}
+	for _, tc := range cases {
+		user := map[string]interface{}{"active_status": tc.active, "self_exclusion": tc.excluded}
+		if got := services.AccountState(user); got != tc.want {
+			t.Errorf("AccountState(%s, %s) = %v, want %v", tc.active, tc.excluded, got, tc.want)
+		}
+	}
+}
+
+func TestLoginSMSQueueDown(t *testing.T) {
+	repo := newLoginRepo()
+	repo.smsDown = true
+	app := loginApp(t, repo, 0)
+
+	status, body, _ := postLogin(t, app, `{"msisdn":"254711000001"}`)
+	if status != 202 || !strings.Contains(body, `"MessageCode":"otp_delivery_delayed"`) || !strings.Contains(body, `"ResendAllowedAfter"`) {
+		t.Errorf("login with dbQueue down = %d %s, want 202 otp_delivery_delayed with the resend timing", status, body)
+	}
+	if repo.codes["254711000001"] != 1 || repo.sms != 0 {
+		t.Errorf("%d codes stored and %d sms queued, want the code stored and nothing queued", repo.codes["254711000001"], repo.sms)
+	}
+}
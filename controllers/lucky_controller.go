@@ -3,14 +3,17 @@ package controllers
 import (
 	"context"
 	"errors"
+	"fiberapp/clock"
+	"fiberapp/config"
 	"fiberapp/database"
+	"fiberapp/flags"
 	"fiberapp/models"
+	"fiberapp/money"
 	"fiberapp/services"
 	"fiberapp/utils"
 	"fmt"
 	"log"
 	"math/rand"
-	"net"
 	"os"
 	"path"
 	"strconv"
@@ -20,7 +23,6 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 )
@@ -29,21 +31,64 @@ import (
 
 var lucky *services.LuckyNumberService
 
-// Initialize function to set up the service with database dependency
-func InitLuckyNumberService(db *database.Database) {
-	lucky = services.NewLuckyNumberService(db)
+// demo plays bets flagged as demo; it can only read the database
+var demo *services.DemoGameEngine
+
+// InitLuckyNumberService installs the shared lucky number service and
+// builds the demo engine on db
+func InitLuckyNumberService(s *services.LuckyNumberService, db database.LuckyRepo) {
+	lucky = s
+	demo = services.NewDemoGameEngine(db)
+}
+
+// callbackAllowedIPs are the gateway hosts allowed to post the payment
+// callbacks: settlements, reversals, withdrawals and SMS delivery reports
+var callbackAllowedIPs = map[string]bool{}
+
+// ConfigureCallbacks applies the callbacks section of the config
+func ConfigureCallbacks(cfg config.CallbacksConfig) {
+	allowed := make(map[string]bool, len(cfg.AllowedIPs))
+	for _, ip := range cfg.AllowedIPs {
+		allowed[ip] = true
+	}
+	callbackAllowedIPs = allowed
+	models.StrictCallbackDecoding = cfg.Strict
+}
+
+// legacyOTPStatus answers failed OTP checks with 201 for clients that have
+// not yet moved to the 4xx codes
+var legacyOTPStatus bool
+
+// ConfigureCompat applies the compat section of the config
+func ConfigureCompat(cfg config.CompatConfig) {
+	legacyOTPStatus = cfg.LegacyOTPStatus
+}
+
+// otpFailureStatus maps a VerifyOTP error to its HTTP status: 401 for a
+// wrong code, 410 for an expired one, 500 for anything else
+func otpFailureStatus(err error) int {
+	switch {
+	case legacyOTPStatus:
+		return 201
+	case errors.Is(err, services.ErrOTPInvalid):
+		return 401
+	case errors.Is(err, services.ErrOTPExpired):
+		return 410
+	default:
+		return 500
+	}
 }
 
 // Hello - GET /api/v1/
 func Hello(c *fiber.Ctx) error {
 	if err := lucky.Start(); err != nil {
-		return c.Status(500).JSON(models.NewErrorResponse(500, 2, err.Error()))
+		return failErr(c, 500, 2, err)
 	}
 	setting, err := lucky.CheckSetting()
 	if err != nil {
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+		return failErr(c, 500, 1, err)
 	}
-	return c.Status(200).JSON(models.NewSuccessWithData(200, 0, setting))
+	return c.Status(200).JSON(models.NewSuccessWithData(200, 0, utils.NormalizeRow(setting)))
 }
 
 // Test - GET /test (simulate delay)
@@ -54,12 +99,22 @@ func Test(c *fiber.Ctx) error {
 
 // request bodies
 type PlaceBetRequest struct {
-	Amount    float64     `json:"amount"`
-	Choice    interface{} `json:"choice"`
-	GameCatID interface{} `json:"game_cat_id"`
-	Msisdn    interface{} `json:"msisdn"`
-	Channel   string      `json:"channel"`
-	Ussd      string      `json:"ussd"`
+	Amount     float64        `json:"amount"`
+	Choice     interface{}    `json:"choice"`
+	Selections []BetSelection `json:"selections"` // several boxes in one bet, instead of choice and amount
+	GameCatID  interface{}    `json:"game_cat_id"`
+	Msisdn     interface{}    `json:"msisdn"`
+	Channel    string         `json:"channel"`
+	Ussd       string         `json:"ussd"`
+	Mode       string         `json:"mode"` // "demo" plays against a fake balance
+
+	ClientRequestID string `json:"client_request_id"` // same as the Idempotency-Key header
+}
+
+// BetSelection is one box of a multi-box bet
+type BetSelection struct {
+	Box    models.FlexString `json:"box" example:"5"`
+	Amount float64           `json:"amount" example:"20"`
 }
 
 // request bodies
@@ -71,9 +126,11 @@ type PlaceSpinRequest struct {
 	Mode      string      `json:"mode"`
 }
 type IniatateDepositRequest struct {
-	Amount  float64     `json:"amount"`
-	Msisdn  interface{} `json:"msisdn"`
-	Channel string      `json:"channel"`
+	Amount          float64     `json:"amount"`
+	Msisdn          interface{} `json:"msisdn"`
+	Channel         string      `json:"channel"`
+	Campaign        string      `json:"campaign,omitempty"` // pushes on this campaign's shortcode instead of the channel's
+	ClientRequestID string      `json:"client_request_id"`  // same as the Idempotency-Key header
 }
 
 func parseFloatInterface(v interface{}) (float64, error) {
@@ -90,6 +147,21 @@ func parseFloatInterface(v interface{}) (float64, error) {
 		return 0, errors.New("invalid number")
 	}
 }
+
+// channels are the channel values a bet or deposit may carry; each is a
+// dimension of kpi_by_channel
+var channels = map[string]bool{"web": true, "ussd": true, "app": true}
+
+// parseChannel normalizes a request's channel and reports whether it is
+// allowed. An empty channel is taken as "web".
+func parseChannel(channel string) (string, bool) {
+	channel = strings.ToLower(strings.TrimSpace(channel))
+	if channel == "" {
+		channel = "web"
+	}
+	return channel, channels[channel]
+}
+
 func PlaceBetLuckyNumber(c *fiber.Ctx) error {
 	var req PlaceBetRequest
 
@@ -98,21 +170,39 @@ func PlaceBetLuckyNumber(c *fiber.Ctx) error {
 
 	if err := c.BodyParser(&req); err != nil {
 		log.Printf("invalid json: %v", err)
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
+	}
+	if _, ok := apiVersion(c); !ok {
+		return fail(c, 400, 1, "unsupported_api_version")
+	}
+	var ok bool
+	if req.Channel, ok = parseChannel(req.Channel); !ok {
+		return fail(c, 400, 1, "invalid_channel")
+	}
+
+	if len(req.Selections) > 0 && (req.Choice != nil || req.Amount != 0) {
+		return fail(c, 202, 1, "bet_payload_conflict")
+	}
+
+	if role, _ := userClaims["role"].(string); req.Mode == "demo" || role == "demo" {
+		if len(req.Selections) > 0 {
+			return fail(c, 202, 1, "demo_single_choice")
+		}
+		return placeDemoBet(c, msisdn, req)
 	}
 
 	var startErr, checkErr, userErr error
-	var setting map[string]interface{}
+	var game database.Game
 	var user map[string]interface{}
 
-	// Run start and checkGameONE concurrently
+	// Run start and the game lookup concurrently
 	g := new(errgroup.Group)
 	g.Go(func() error {
 		startErr = lucky.Start()
 		return startErr
 	})
 	g.Go(func() error {
-		setting, checkErr = lucky.CheckGameONE(utils.ToString(req.GameCatID))
+		game, checkErr = lucky.GetPlayableGame(c.Context(), utils.ToString(req.GameCatID))
 		return checkErr
 	})
 	g.Go(func() error {
@@ -121,72 +211,218 @@ func PlaceBetLuckyNumber(c *fiber.Ctx) error {
 	})
 
 	if err := g.Wait(); err != nil {
+		if errors.Is(err, services.ErrUnknownGame) {
+			return fail(c, 202, 1, "game_not_found")
+		}
 		log.Printf("error initializing or checking game: %v", err)
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+		return failErr(c, 500, 1, err)
+	}
+
+	stakes, err := lucky.StakeRules(utils.ToString(req.GameCatID))
+	if err != nil {
+		return failErr(c, 500, 1, err)
 	}
 
-	if setting == nil {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Game not found"))
+	if len(req.Selections) > 0 {
+		return placeParcel(c, msisdn, req, game, stakes, user)
 	}
 
-	// validate amount
-	expectedF, _ := parseFloatInterface(setting["bet_amount"])
-	if req.Amount != expectedF {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, fmt.Sprintf("Invalid Bet Amount. Expected %v.", setting["bet_amount"])))
+	result, err := placeLuckyBet(c.UserContext(), user, game, stakes, msisdn, req.Ussd, req.Amount, utils.ToString(req.Choice), req.Channel)
+	var stake *services.StakeError
+	var throttled *services.BetThrottleError
+	switch {
+	case errors.Is(err, database.ErrInsufficientBalance):
+		return fail(c, 202, 3, "insufficient_balance")
+	case errors.As(err, &throttled):
+		return betThrottled(c, throttled)
+	case errors.Is(err, errInvalidLuckyNumber), errors.As(err, &stake), errors.Is(err, money.ErrInvalidAmount):
+		return failErr(c, 202, 1, err)
+	case err != nil:
+		log.Printf("Error placing bet: %v", err)
+		return failErr(c, 500, 1, err)
 	}
 
-	// validate choice
-	choiceF, err := parseFloatInterface(req.Choice)
+	if result.Reveal != nil {
+		return c.Status(200).JSON(PlaceBetPendingResponse{
+			Status:        200,
+			StatusCode:    0,
+			FreeBet:       result.FreeBet,
+			StatusMessage: result.Message,
+			Pending:       *result.Reveal,
+			Timing:        debugTiming(c, result.Timing),
+		})
+	}
+
+	// success
+	return sendBetResult(c, PlaceBetResponse{
+		Status:        200,
+		StatusCode:    0,
+		FreeBet:       result.FreeBet,
+		StatusMessage: result.Message,
+		GameResults:   result.GameResult,
+		Timing:        debugTiming(c, result.Timing),
+	})
+}
+
+// apiVersion returns the result shape the caller asked for with
+// X-API-Version: 1 has boxes of Value and Item; 2 has services.ResultBox.
+// Without the header players get 1, or 2 while flags.ResponseV2 is on for
+// them. ok is false for any other version.
+func apiVersion(c *fiber.Ctx) (version int, ok bool) {
+	switch c.Get("X-API-Version") {
+	case "":
+		claims, _ := c.Locals("user").(jwt.MapClaims)
+		msisdn, _ := claims["sub"].(string)
+		if msisdn != "" && flags.IsEnabled(c.UserContext(), flags.ResponseV2, msisdn) {
+			return 2, true
+		}
+		return 1, true
+	case "1":
+		return 1, true
+	case "2":
+		return 2, true
+	}
+	return 0, false
+}
+
+// sendBetResult answers a settled bet in the caller's API version
+func sendBetResult(c *fiber.Ctx, resp PlaceBetResponse) error {
+	if version, _ := apiVersion(c); version == 2 {
+		return c.Status(200).JSON(PlaceBetResponseV2{PlaceBetResponse: resp, GameResults: resp.GameResults.V2()})
+	}
+	resp.GameResults = resp.GameResults.Legacy()
+	return c.Status(200).JSON(resp)
+}
+
+// debugTiming returns a bet's stage timings when the caller is an admin
+// that sent X-Debug-Timing, and nil otherwise
+func debugTiming(c *fiber.Ctx, timing *services.TimingBreakdown) *services.TimingBreakdown {
+	if c.Get("X-Debug-Timing") == "" {
+		return nil
+	}
+	claims, _ := c.Locals("user").(jwt.MapClaims)
+	if role, _ := claims["role"].(string); role != utils.RoleAdmin {
+		return nil
+	}
+	return timing
+}
+
+// errInvalidLuckyNumber is a single-box bet on a box other than 1 to 7
+var errInvalidLuckyNumber = errors.New("invalid lucky number")
+
+// placeLuckyBet checks a single-box bet against the game's stake rules and
+// the player's balance, then places it. The public and internal APIs both
+// place bets through it. A refused bet is a *services.StakeError,
+// errInvalidLuckyNumber or database.ErrInsufficientBalance.
+func placeLuckyBet(ctx context.Context, user map[string]interface{}, game database.Game, stakes services.StakeRules, msisdn, ussd string, amount float64, choice, channel string) (services.PlaceBetResult, error) {
+	if err := stakes.Check(amount); err != nil {
+		return services.PlaceBetResult{}, err
+	}
+	choiceF, err := parseFloatInterface(choice)
 	if err != nil || choiceF < 1 || choiceF > 7 {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid lucky number. Please select a number between 1 and 7."))
+		return services.PlaceBetResult{}, errInvalidLuckyNumber
+	}
+	if utils.NumericFloat(user["balance"])+utils.NumericFloat(user["bonus"]) < amount {
+		return services.PlaceBetResult{}, database.ErrInsufficientBalance
 	}
+	return lucky.PlaceBet(ctx, user, ussd, game.Name, game.ID, msisdn, amount, choice, channel)
+}
 
-	num := user["balance"].(pgtype.Numeric)
+// placeParcel plays every box in req.Selections as one bet. Each box's
+// stake must pass the game's stake rules.
+func placeParcel(c *fiber.Ctx, msisdn string, req PlaceBetRequest, game database.Game, stakes services.StakeRules, user map[string]interface{}) error {
+	selections := make([]services.Selection, len(req.Selections))
+	for i, sel := range req.Selections {
+		selections[i] = services.Selection{Box: string(sel.Box), Amount: sel.Amount}
+	}
+	selections, err := services.ValidateSelections(selections, stakes)
+	if err != nil {
+		return failErr(c, 202, 1, err)
+	}
 
-	f, _ := num.Float64Value()
-	balance := f.Float64
-	amount := utils.ToFloat64(req.Amount)
+	var total float64
+	for _, sel := range selections {
+		total += sel.Amount
+	}
+	if utils.NumericFloat(user["balance"])+utils.NumericFloat(user["bonus"]) < total {
+		return fail(c, 202, 3, "insufficient_balance")
+	}
 
-	if balance >= amount {
+	result, err := lucky.PlaceParcel(user, req.Ussd, game.Name, utils.ToString(req.GameCatID), msisdn, req.Channel, selections)
+	if errors.Is(err, database.ErrInsufficientBalance) {
+		return fail(c, 202, 3, "insufficient_balance")
+	}
+	if err != nil {
+		log.Printf("Error placing parcel: %v", err)
+		return failErr(c, 500, 1, err)
+	}
 
-		// place bet
-		result, err := lucky.PlaceBet(
-			user,
-			req.Ussd,
-			utils.ToString(setting["name"]),
-			utils.ToString(req.GameCatID),
-			utils.ToString(msisdn),
-			req.Amount,
-			utils.ToString(req.Choice),
-			req.Channel,
-		)
-		if err != nil {
-			log.Printf("Error placing bet: %v", err)
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+	resp := PlaceParcelResponse{
+		Status:        200,
+		StatusCode:    0,
+		FreeBet:       "false",
+		StatusMessage: message(c, "parcel_placed"),
+		ParcelResults: result.Legacy(),
+	}
+	if version, _ := apiVersion(c); version == 2 {
+		return c.Status(200).JSON(PlaceParcelResponseV2{PlaceParcelResponse: resp, ParcelResults: result.V2()})
+	}
+	return c.Status(200).JSON(resp)
+}
+
+// placeDemoBet settles a bet against the caller's demo wallet. Nothing is
+// written to the money tables and no SMS is sent.
+func placeDemoBet(c *fiber.Ctx, msisdn string, req PlaceBetRequest) error {
+	if _, err := lucky.GetPlayableGame(c.Context(), utils.ToString(req.GameCatID)); err != nil {
+		if errors.Is(err, services.ErrUnknownGame) {
+			return fail(c, 202, 1, "game_not_found")
 		}
+		return failErr(c, 500, 1, err)
+	}
 
-		// success
-		return c.Status(200).JSON(models.H{
-			"Status":        200,
-			"StatusCode":    0,
-			"FreeBet":       result.FreeBet,
-			"StatusMessage": result.Message,
-			"GameResults":   result.GameResult,
-		})
-	} else {
-		return c.Status(202).JSON(models.H{
-			"Status":        202,
-			"StatusCode":    3,
-			"StatusMessage": "insufficient balance",
-		})
+	stakes, err := lucky.StakeRules(utils.ToString(req.GameCatID))
+	if err != nil {
+		return failErr(c, 500, 1, err)
 	}
+	if err := stakes.Check(req.Amount); err != nil {
+		return failErr(c, 202, 1, err)
+	}
+	choiceF, err := parseFloatInterface(req.Choice)
+	if err != nil || choiceF < 1 || choiceF > 7 {
+		return fail(c, 202, 1, "invalid_lucky_number")
+	}
+
+	result, err := demo.Play(c.Context(), msisdn, utils.ToString(req.GameCatID), req.Amount, utils.ToString(req.Choice))
+	if errors.Is(err, services.ErrDemoInsufficientBalance) {
+		resp := models.NewErrorResponseCode(messageLanguage(c), 202, 3, "insufficient_balance")
+		resp["Demo"] = true
+		resp["DemoBalance"] = demo.Balance(msisdn)
+		return c.Status(202).JSON(resp)
+	}
+	if err != nil {
+		log.Printf("Error placing demo bet: %v", err)
+		return failErr(c, 500, 1, err)
+	}
+
+	return sendBetResult(c, PlaceBetResponse{
+		Status:        200,
+		StatusCode:    0,
+		StatusMessage: result.GameResult.ResultMessage,
+		GameResults:   result.GameResult,
+		Demo:          true,
+		DemoBalance:   &result.Balance,
+	})
 }
 
 func IniatateDepositLuckyNumber(c *fiber.Ctx) error {
 	var req IniatateDepositRequest
 	if err := c.BodyParser(&req); err != nil {
 		log.Printf("invalid json: %v", err)
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
+	}
+	var ok bool
+	if req.Channel, ok = parseChannel(req.Channel); !ok {
+		return fail(c, 400, 1, "invalid_channel")
 	}
 
 	userClaims := c.Locals("user").(jwt.MapClaims)
@@ -196,10 +432,18 @@ func IniatateDepositLuckyNumber(c *fiber.Ctx) error {
 	result, err := lucky.IniatatDeposit(
 		utils.ToString(msisdn),
 		req.Amount,
-		req.Channel)
+		req.Channel,
+		strings.ToLower(strings.TrimSpace(req.Campaign)))
+	var deposit *services.DepositError
+	if errors.As(err, &deposit) {
+		return failErr(c, 202, 1, err)
+	}
+	if errors.Is(err, services.ErrUnknownCampaign) {
+		return failErr(c, 400, 1, err)
+	}
 	if err != nil {
 		log.Printf("Error placing bet: %v", err)
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+		return failErr(c, 500, 1, err)
 	}
 
 	// success
@@ -207,84 +451,345 @@ func IniatateDepositLuckyNumber(c *fiber.Ctx) error {
 		"Status":        200,
 		"StatusCode":    0,
 		"FreeBet":       result.FreeBet,
-		"StatusMessage": result.Message,
+		"Reference":     result.Reference,
+		"MessageCode":   "deposit_pin_prompt",
+		"StatusMessage": message(c, "deposit_pin_prompt"),
 	})
 }
 
-// SettleBTLuckyNumber - create background task and return immediately
-func SettleBTLuckyNumber(c *fiber.Ctx) error {
-	var data map[string]interface{}
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+// GetWalletHandler - GET /api/v1/wallet
+// Returns cash and bonus balances and the wagering progress of each bonus.
+func GetWalletHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	wallet, err := lucky.WalletSummary(msisdn)
+	if err != nil {
+		logrus.Errorf("WalletSummary error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          wallet,
+	})
+}
+
+// GetTaxPreviewHandler - GET /api/v1/tax_preview?amount=1000&stake=50
+// Shows the withholding tax and net payout for a win of amount, and the
+// excise duty on stake when given, exactly as settlement would apply them.
+func GetTaxPreviewHandler(c *fiber.Ctx) error {
+	amount, err := strconv.ParseFloat(c.Query("amount"), 64)
+	if err != nil {
+		return fail(c, 400, 1, "amount_not_number")
 	}
-	// launch in background
-	go func(d map[string]interface{}) {
-		if err := lucky.HandleDepositAndGame(d); err != nil {
-			logrus.Errorf("handle_deposit_and_game error: %v", err)
+	stake := 0.0
+	if v := c.Query("stake"); v != "" {
+		if stake, err = strconv.ParseFloat(v, 64); err != nil || stake < 0 {
+			return fail(c, 400, 1, "stake_negative")
 		}
-	}(data)
+	}
 
-	return c.Status(200).JSON(models.NewSuccess(200, 0, "Success"))
+	preview, err := lucky.PreviewTax(amount, stake)
+	if errors.Is(err, services.ErrInvalidAmount) {
+		return failErr(c, 400, 1, err)
+	}
+	if err != nil {
+		logrus.Errorf("PreviewTax error: %v", err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          preview,
+	})
 }
 
-// SettleBetLuckyNumber - validates IPs then processes
-func SettleBetLuckyNumber(c *fiber.Ctx) error {
-	allowed := map[string]bool{"172.16.0.131": true, "172.16.0.104": true, "172.16.0.184": true, "127.0.0.1": true, "172.16.0.108": true}
+// GetDepositStatusHandler - GET /api/v1/deposit_status/:reference?wait=20s
+// Reports pending / success / fail for the caller's own deposit. With wait
+// the request is held until the deposit settles or wait elapses.
+func GetDepositStatusHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	var wait time.Duration
+	if w := c.Query("wait"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil {
+			// bare numbers are seconds
+			secs, convErr := strconv.Atoi(w)
+			if convErr != nil {
+				return fail(c, 400, 1, "invalid_wait")
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		if d < 0 {
+			return fail(c, 400, 1, "invalid_wait")
+		}
+		wait = d
+	}
+
+	status, err := lucky.GetDepositStatus(c.UserContext(), msisdn, c.Params("reference"), wait)
+	if errors.Is(err, services.ErrDepositNotFound) {
+		return failErr(c, 404, 1, err)
+	}
+	if err != nil {
+		logrus.Errorf("GetDepositStatus error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          status,
+	})
+}
+
+// RetrySTKHandler - POST /api/v1/retry_stk {reference}
+// Sends the STK of the caller's pending deposit again under the same
+// reference and reports how many retries are left.
+func RetrySTKHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	var data RetrySTKRequest
+	if err := c.BodyParser(&data); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+	reference := strings.TrimSpace(string(data.Reference))
+	if reference == "" {
+		return fail(c, 400, 1, "reference_required")
+	}
+
+	retry, err := lucky.RetrySTK(msisdn, reference)
+	switch {
+	case errors.Is(err, services.ErrDepositNotFound):
+		return failErr(c, 404, 1, err)
+	case errors.Is(err, services.ErrDepositNotPending), errors.Is(err, services.ErrSTKRetryExpired):
+		return failErr(c, 409, 1, err)
+	case errors.Is(err, services.ErrSTKRetryLimit):
+		return failErr(c, 429, 1, err)
+	case errors.Is(err, services.ErrSTKRetryTooSoon):
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(retry.RetryAllowedAfter, 10))
+		return failErr(c, 429, 1, err)
+	case err != nil:
+		return failErr(c, 400, 1, err)
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"MessageCode":   "deposit_pin_prompt",
+		"StatusMessage": message(c, "deposit_pin_prompt"),
+		"Data":          retry,
+	})
+}
+
+// GetBetHandler - GET /api/v1/bet/:reference
+// A bet: pending until it settles or, on a game with a reveal delay, until
+// its RevealAt, then with the outcome
+func GetBetHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
 
-	clientIP := c.Get("X-Forwarded-For", c.IP())
-	if strings.Contains(clientIP, ",") {
-		clientIP = strings.TrimSpace(strings.Split(clientIP, ",")[0])
+	version, ok := apiVersion(c)
+	if !ok {
+		return fail(c, 400, 1, "unsupported_api_version")
+	}
+	reveal, err := lucky.GetBetReveal(c.UserContext(), msisdn, c.Params("reference"))
+	if errors.Is(err, services.ErrBetNotFound) {
+		return failErr(c, 404, 1, err)
 	}
-	// strip port if present
-	if host, _, err := net.SplitHostPort(clientIP); err == nil {
-		clientIP = host
+	if err != nil {
+		logrus.Errorf("GetBetReveal error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
 	}
 
-	if !allowed[clientIP] {
+	var data interface{} = reveal.Legacy()
+	if version == 2 {
+		data = reveal.V2()
+	}
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          data,
+	})
+}
+
+// OpenRoundsHandler - GET /api/v1/open_rounds
+// The player's deposits and bets that have not resolved, newest first, so
+// the app can resume them after a restart
+func OpenRoundsHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	rounds, err := lucky.OpenRounds(c.UserContext(), msisdn)
+	if err != nil {
+		logrus.Errorf("OpenRounds error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          rounds,
+	})
+}
+
+// SettleBTLuckyNumber - stores the callback, processes it in the background
+// and returns at once. A callback that could not be stored gets 500 so the
+// gateway sends it again.
+func SettleBTLuckyNumber(c *fiber.Ctx) error {
+	if !callbackIPAllowed(c) {
 		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
 	}
 
-	var data map[string]interface{}
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	var cb models.SettlementCallback
+	if resp := decodeCallback(c, &cb); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := cb.ValidateBT(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
+	}
+	if err := lucky.AcceptSettleBT(c.UserContext(), cb, c.Body()); err != nil {
+		logrus.Errorf("AcceptSettleBT error for %s: %v", cb.Reference, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to store callback"))
 	}
 
-	status := utils.ToString(data["status"])
-	if status == "0" || strings.EqualFold(status, "success") {
-		go func(d map[string]interface{}) {
-			if _, err := lucky.ProcessBetAndPlayGame(d); err != nil {
+	return c.Status(200).JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// callbackIPAllowed reports whether the request comes from an allowed gateway
+// host. c.IP() takes server.proxy_header into account only on connections
+// from server.trusted_proxies, so a client cannot name its own address.
+func callbackIPAllowed(c *fiber.Ctx) bool {
+	return callbackAllowedIPs[c.IP()]
+}
+
+// SettleBetLuckyNumber - validates IPs then processes
+func SettleBetLuckyNumber(c *fiber.Ctx) error {
+	if !callbackIPAllowed(c) {
+		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
+	}
+
+	var cb models.SettlementCallback
+	if resp := decodeCallback(c, &cb); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := cb.Validate(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
+	}
+	if fields := cb.NormalizeMsisdn(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
+	}
+
+	if cb.Succeeded() {
+		utils.GoBackground("process_bet_and_play_game", func() {
+			if _, err := lucky.ProcessBetAndPlayGame(cb); err != nil {
 				logrus.Errorf("process_bet_and_play_game error: %v", err)
 			}
-		}(data)
+		})
 		return c.Status(200).JSON(models.NewSuccess(200, 0, "Success"))
 	}
 
-	desc := utils.ToString(data["description"])
+	desc := cb.Description
 	if desc == "CUSTOMER_CANCELED_PIN" || desc == "CUSTOMER_CONF_FAILED" {
-		_ = lucky.InsertFailedSMS(utils.ToString(data["reference"]))
+		_ = lucky.InsertFailedSMS(cb.Reference)
 	}
 
-	go func() {
-		_ = lucky.UpdateAviatorDepositFailRequestLucky(utils.ToString(data["reference"]), desc)
-	}()
+	utils.GoBackground("deposit_failed", func() {
+		_ = lucky.UpdateAviatorDepositFailRequestLucky(cb.Reference, desc)
+	})
 
 	return c.Status(400).JSON(models.NewErrorResponse(400, 2, desc))
 }
 
+// SettleReversalLuckyNumber - POST /api/v1/settle_reversal {transaction_id, reversal_reference}
+// Claws back a deposit M-Pesa has reversed. Duplicate notifications succeed
+// without reversing twice.
+func SettleReversalLuckyNumber(c *fiber.Ctx) error {
+	if !callbackIPAllowed(c) {
+		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
+	}
+
+	var cb models.ReversalCallback
+	if resp := decodeCallback(c, &cb); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := cb.Validate(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
+	}
+
+	reversal, err := lucky.ReverseDeposit(cb)
+	if errors.Is(err, database.ErrReversalNotFound) {
+		return c.Status(404).JSON(models.NewErrorResponse(404, 1, err.Error()))
+	}
+	if err != nil {
+		logrus.Errorf("ReverseDeposit error for %s: %v", cb.TransactionID, err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          reversal,
+	})
+}
+
+// SMSDeliveryReportHandler - POST /api/v1/sms_dlr {record_id, status, description}
+// Records the SMS gateway's delivery status for a dbQueue row. Reports for
+// unknown rows or rows already final are acknowledged and ignored.
+func SMSDeliveryReportHandler(c *fiber.Ctx) error {
+	if !callbackIPAllowed(c) {
+		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
+	}
+
+	var report models.SMSDeliveryReport
+	if resp := decodeCallback(c, &report); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := report.Validate(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
+	}
+
+	ok, err := lucky.RecordSMSDelivery(report.ID(), report.NormalizedStatus(), report.Description)
+	if err != nil {
+		logrus.Errorf("RecordSMSDelivery error for %d: %v", report.ID(), err)
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+	}
+	if ok {
+		return c.Status(200).JSON(models.NewSuccess(200, 0, "Success"))
+	}
+	return c.Status(200).JSON(models.NewSuccess(200, 0, "Not Found/Status already final"))
+}
+
 // SettleWithdrawalLuckyNumber
 func SettleWithdrawalLuckyNumber(c *fiber.Ctx) error {
-	var data map[string]interface{}
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	if !callbackIPAllowed(c) {
+		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
+	}
+
+	var cb models.WithdrawalCallback
+	if resp := decodeCallback(c, &cb); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := cb.Validate(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
 	}
 
-	ref := utils.ToString(data["reference"])
 	var ok bool
 	var err error
-	if strings.HasPrefix(ref, "AV_") {
-		ok, err = lucky.UpdateLuckyNumberWithdrawalDisburseMotto(utils.ToString(data["transaction_id"]), utils.ToString(data["status"]), utils.ToString(data["description"]), ref)
+	if strings.HasPrefix(cb.Reference, "AV_") {
+		ok, err = lucky.UpdateLuckyNumberWithdrawalDisburseMotto(cb)
 	} else {
-		ok, err = lucky.UpdateLuckyNumberWithdrawalDisburse(utils.ToString(data["transaction_id"]), utils.ToString(data["status"]), utils.ToString(data["description"]), ref)
+		ok, err = lucky.UpdateLuckyNumberWithdrawalDisburse(cb)
 	}
 	if err != nil {
 		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
@@ -297,11 +802,18 @@ func SettleWithdrawalLuckyNumber(c *fiber.Ctx) error {
 
 // SettleWithdrawalB2B
 func SettleWithdrawalB2BLuckyNumber(c *fiber.Ctx) error {
-	var data map[string]interface{}
-	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	if !callbackIPAllowed(c) {
+		return c.Status(403).JSON(models.NewErrorResponse(403, 1, "forbidden"))
+	}
+
+	var cb models.WithdrawalCallback
+	if resp := decodeCallback(c, &cb); resp != nil {
+		return c.Status(400).JSON(resp)
+	}
+	if fields := cb.Validate(); len(fields) > 0 {
+		return c.Status(400).JSON(models.NewCallbackFieldsError(fields))
 	}
-	ok, err := lucky.UpdatePawaBox_KeWithdrawalb2bDisburse(utils.ToString(data["transaction_id"]), utils.ToString(data["status"]), utils.ToString(data["description"]), utils.ToString(data["reference"]))
+	ok, err := lucky.UpdatePawaBox_KeWithdrawalb2bDisburse(cb)
 	if err != nil {
 		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
 	}
@@ -311,354 +823,270 @@ func SettleWithdrawalB2BLuckyNumber(c *fiber.Ctx) error {
 	return c.Status(200).JSON(models.NewSuccess(200, 0, "Not Found/Transaction already processed"))
 }
 
-// GetGames - POST /lucky_games
-func GetGames(c *fiber.Ctx) error {
-	// logrus.Infof("GetGames request: %+v", data)
-
-	categories := []string{"all", "Money Prize", "Car Prize", "Bike Prize", "JackPot"}
-
-	category := c.Query("category", "all") // default = "all"
-
-	userVal := c.Locals("user")
-
-	msisdn := c.Query("msisdn", "") // default = "all"
-	if msisdn != "" && len(msisdn) > 0 {
-
-		// Ensure user exists
-		user, err := lucky.CheckUser(msisdn, "", "")
-		if err != nil {
-			logrus.Errorf("CheckUser error: %v", err)
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
-		}
-		if user == nil {
-			// You returned an error in your example — replicate that behavior
-			logrus.Warnf("user not found for msisdn=%s", msisdn)
-			return c.Status(404).JSON(models.NewErrorResponse(404, 1, "user not found"))
-		}
-
-		if utils.ToString(user["active_status"]) == "inactive" {
-			return c.Status(202).JSON(models.NewErrorResponse(202, 1, "user account is inactive"))
-
-		}
-		// --- JWT generation ---
-		secret := utils.JWT_SECRET
-		if secret == "" {
-			// fail safe: log and return 500
-			logrus.Error("JWT_SECRET not set in environment")
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
-		}
-
-		num := user["balance"].(pgtype.Numeric)
-
-		f, _ := num.Float64Value()
-		balance := f.Float64
-
-		// token expiry duration — adjust as needed
-		expireDuration := 48 * time.Hour
-		now := time.Now()
-		claims := jwt.MapClaims{
-			"sub":  msisdn,
-			"iat":  now.Unix(),
-			"exp":  now.Add(expireDuration).Unix(),
-			"role": "user", // optional; change or remove as needed
-		}
-
-		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-		tokenString, err := token.SignedString([]byte(secret))
-		if err != nil {
-			logrus.Errorf("failed to sign JWT: %v", err)
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
-		}
+// decodeCallback decodes a gateway callback body and returns the 400 body to
+// send when it is malformed, or nil on success
+func decodeCallback(c *fiber.Ctx, v interface{}) models.H {
+	err := models.DecodeCallback(c.Body(), v)
+	if err == nil {
+		return nil
+	}
+	logrus.Warnf("rejected callback on %s: %v", c.Path(), err)
+	var decodeErr *models.CallbackDecodeError
+	if errors.As(err, &decodeErr) && len(decodeErr.Fields) > 0 {
+		return models.NewCallbackFieldsError(decodeErr.Fields)
+	}
+	return models.NewErrorResponse(400, 1, "invalid JSON")
+}
 
-		if userVal == nil {
+// GetGames - GET /api/v1/lucky_games?category=
+// Lists the games of a category, each with its presentation config. With a
+// token the response adds the caller's balance and free bet; without one
+// it carries neither.
+func GetGames(c *fiber.Ctx) error {
+	category, err := lucky.ResolveCategory(c.Query("category", "all"))
+	if errors.Is(err, services.ErrUnknownCategory) {
+		return failErr(c, 400, 1, err)
+	}
+	if err != nil {
+		logrus.Errorf("GameCategories error: %v", err)
+		return fail(c, 500, 1, "games_unavailable")
+	}
+	gameCategories, err := lucky.GameCategories()
+	if err != nil {
+		logrus.Errorf("GameCategories error: %v", err)
+		return fail(c, 500, 1, "games_unavailable")
+	}
 
-			game, err := lucky.CheckGame(category)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"Status":  false,
-					"Message": "failed to fetch history",
-				})
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-			// Ensure history is never nil
-			if game == nil {
-				game = []map[string]interface{}{}
-			}
-			title := "SHINDA HADI KES 3M CASH PAPO HAPO!"
-
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Title":         title,
-				"Data":          game,
-				"FreeBet":       false,
-				"token":         tokenString,
-				"Balance":       balance,
-				"Categories":    categories,
-				"StatusMessage": "success",
-			})
-		} else {
-			// guest user
-			userClaims := userVal.(jwt.MapClaims)
-
-			msisdn := userClaims["sub"].(string) // get MSISDN
-
-			// Create context with timeout for all operations
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			// Execute concurrent queries
-			gameResult, userResult, err := executeConcurrentQueries(ctx, category, msisdn)
-			if err != nil {
-				return handleQueryError(err)
-			}
+	resp, err := buildGameList(ctx, category, resolveIdentity(c))
+	if err != nil {
+		logrus.Errorf("GetGames error for category %s: %v", category, err)
+		return fail(c, 500, 1, "games_unavailable")
+	}
+	resp.Categories = append([]string{"all"}, gameCategories...)
+	return c.Status(200).JSON(resp)
+}
 
-			// Process user data for freebet logic
-			freebet, addTitle := processFreebetLogic(userResult)
-
-			// Insert logs asynchronously (fire and forget)
-			title := "SHINDA HADI KES 3M CASH PAPO HAPO!" + addTitle
-
-			logrus.Infof("Game data: %+v", gameResult)
-			logrus.Infof("User data: %+v", userResult)
-
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Title":         title,
-				"Data":          gameResult,
-				"FreeBet":       freebet,
-				"token":         tokenString,
-				"Categories":    categories,
-				"Balance":       balance,
-				"StatusMessage": "success",
-			})
-		}
-	} else {
-		if userVal == nil {
-
-			game, err := lucky.CheckGame(category)
-			if err != nil {
-				return c.Status(500).JSON(fiber.Map{
-					"Status":  false,
-					"Message": "failed to fetch history",
-				})
-			}
+// resolveIdentity returns the msisdn of the JWT OptionalJWTMiddleware
+// accepted, or "" for a guest. Only the token identifies the player; a
+// ?msisdn= parameter is ignored so the game list can never be used to
+// obtain a token or another player's balance.
+func resolveIdentity(c *fiber.Ctx) string {
+	claims, ok := c.Locals("user").(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	msisdn, _ := claims["sub"].(string)
+	return msisdn
+}
 
-			// Ensure history is never nil
-			if game == nil {
-				game = []map[string]interface{}{}
-			}
-			title := "SHINDA HADI KES 3M CASH PAPO HAPO!"
-
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Title":         title,
-				"Data":          game,
-				"FreeBet":       false,
-				"token":         "",
-				"Categories":    categories,
-				"StatusMessage": "success",
-			})
-		} else {
-			// guest user
-			userClaims := userVal.(jwt.MapClaims)
-
-			msisdn := userClaims["sub"].(string) // get MSISDN
-
-			// Create context with timeout for all operations
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-
-			// Execute concurrent queries
-			gameResult, userResult, err := executeConcurrentQueries(ctx, category, msisdn)
-			if err != nil {
-				return handleQueryError(err)
-			}
+// buildGameList fetches the games of category and, when msisdn is set, the
+// player alongside them. A failed player lookup still lists the games.
+func buildGameList(ctx context.Context, category, msisdn string) (GamesResponse, error) {
+	games, user, err := executeConcurrentQueries(ctx, category, msisdn)
+	if err != nil {
+		return GamesResponse{}, err
+	}
 
-			// Process user data for freebet logic
-			freebet, addTitle := processFreebetLogic(userResult)
-
-			// Insert logs asynchronously (fire and forget)
-			title := "SHINDA HADI KES 3M CASH PAPO HAPO!" + addTitle
-
-			logrus.Infof("Game data: %+v", gameResult)
-			logrus.Infof("User data: %+v", userResult)
-
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Title":         title,
-				"Data":          gameResult,
-				"FreeBet":       freebet,
-				"Categories":    categories,
-				"token":         "",
-				"StatusMessage": "success",
-			})
-		}
+	resp := GamesResponse{
+		Status:        200,
+		StatusCode:    0,
+		StatusMessage: "success",
+		Title:         services.DefaultGamesTitle, // a player holding a free bet sees it added
+		Data:          games,
 	}
+	if msisdn != "" {
+		enrichWithUser(&resp, user)
+	}
+	return resp, nil
+}
 
+// enrichWithUser adds the player's balance and free bet to resp. An empty
+// user, a lookup that failed, leaves resp as a guest would see it.
+func enrichWithUser(resp *GamesResponse, user map[string]interface{}) {
+	if len(user) == 0 {
+		return
+	}
+	var addTitle string
+	resp.FreeBet, addTitle = processFreebetLogic(user)
+	resp.Title += addTitle
+	balance := utils.NumericFloat(user["balance"])
+	resp.Balance = &balance
+	resp.Token = new(string)
 }
 
-// GetGames - POST /lucky_games
+// GetBetAmount - GET /api/v1/bet_amounts?game_cat_id=
+// Lists the stakes the game accepts. BetAmount holds the options a client
+// can offer; Data the full rules.
 func GetBetAmount(c *fiber.Ctx) error {
-	// logrus.Infof("GetGames request: %+v", data)
-	// guest user
+	gameCatID := c.Query("game_cat_id")
+	if gameCatID == "" {
+		return fail(c, 400, 1, "game_cat_id_required")
+	}
 
-	bets := []string{"20", "30", "40", "50", "100"}
+	stakes, err := lucky.StakeRules(gameCatID)
+	if errors.Is(err, services.ErrUnknownGame) {
+		return fail(c, 202, 1, "game_not_found")
+	}
+	if err != nil {
+		return failErr(c, 500, 1, err)
+	}
 
 	return c.Status(200).JSON(models.H{
 		"Status":        200,
 		"StatusCode":    0,
-		"BetAmount":     bets,
+		"BetAmount":     stakes.Options(),
 		"BetType":       "JackPot",
 		"StatusMessage": "success",
+		"Data":          stakes,
 	})
-
 }
 
 // GetGames - POST /lucky_games
 func Login(c *fiber.Ctx) error {
-	var data map[string]interface{}
+	var data LoginRequest
 
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
-	msisdn := utils.ToString(data["msisdn"])
-
-	if msisdn != "" && len(msisdn) > 0 {
-
-		name := utils.ToString(data["name"])
-		promocode := utils.ToString(data["promocode"])
-		val := rand.Intn(9000) + 1000
-
-		created := time.Now().Unix()
-		expired := created + 2*60 // expire after 2 minutes
-
-		code := strconv.Itoa(val)
-
-		if msisdn == "254717629732" {
-			code = "2222"
-		}
-
-		if msisdn == "254717029580" {
-			code = "1111"
-		}
-
-		if msisdn == "254718468634" {
-			code = "1111"
-		}
-
-		if msisdn == "254785128132" {
-			code = "1111"
-		}
-
-		if msisdn == "254720841355" {
-			code = "1111"
-		}
-
-		if msisdn == "254714383269" {
-			code = "1111"
-		}
-		if msisdn == "254703639349" {
-			code = "1111"
-		}
-
-		if msisdn == "254718400000" {
-			code = "1111"
-		}
-
-		if msisdn == "254785100000" {
-			code = "1111"
-		}
-
-		if msisdn == "254720820000" {
-			code = "1111"
-		}
-
-		if msisdn == "254714388880" {
-			code = "1111"
-		}
-		if msisdn == "254703630000" {
-			code = "1111"
-		}
-
-		if promocode != "" && len(promocode) > 0 {
-
-			promo, err := lucky.CheckPromoCode(promocode)
-
-			logrus.Info(promo)
-
-			if err != nil {
-				return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
-			}
-			if promo == nil {
-				return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
-			}
-
-			user, err := lucky.CheckUser(msisdn, name, promocode)
-			if err != nil {
-				return err
-			}
-			if user == nil {
-				return err
-			}
-			err = lucky.InsertVerification(msisdn, code, expired, created)
-			if err != nil {
-				return err
-			}
-
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Units":         "Minutes",
-				"ExpireIn":      2,
-				"StatusMessage": "Otp Verification has been sent!",
-			})
-
-		} else {
-			user, err := lucky.CheckUser(msisdn, name, "")
-			if err != nil {
-				return err
-			}
-			if user == nil {
-				return err
-			}
-			if utils.ToString(user["active_status"]) == "inactive" {
-				return c.Status(202).JSON(models.NewErrorResponse(202, 1, "user account not found"))
-			}
+	// Only the number's format is checked here; account state is revealed
+	// by VerifyOTP so /login cannot be used to enumerate players
+	msisdn, err := utils.NormalizeMsisdn(string(data.Msisdn))
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	name := string(data.Name)
+	promocode := string(data.Promocode)
+
+	created := clock.Now().Unix()
+	expired := created + int64(loginOTPTTL/time.Second)
+	code := loginOTPCode(msisdn)
+
+	resendsLeft, err := lucky.RequestLoginOTP(msisdn, name, promocode, code, expired, created)
+	if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+		// The code is stored; /resend_otp sends a new one
+		return c.Status(202).JSON(LoginResponse{
+			Status:             202,
+			StatusCode:         1,
+			Units:              "Minutes",
+			ExpireIn:           int(loginOTPTTL / time.Minute),
+			ResendAllowedAfter: services.ResendAllowedAfter(),
+			ResendsLeft:        resendsLeft,
+			MessageCode:        "otp_delivery_delayed",
+			StatusMessage:      message(c, "otp_delivery_delayed"),
+		})
+	}
+	if err != nil {
+		logrus.Errorf("RequestLoginOTP error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(LoginResponse{
+		Status:             200,
+		StatusCode:         0,
+		Units:              "Minutes",
+		ExpireIn:           int(loginOTPTTL / time.Minute),
+		ResendAllowedAfter: services.ResendAllowedAfter(),
+		ResendsLeft:        resendsLeft,
+		MessageCode:        "otp_sent_if_eligible",
+		StatusMessage:      message(c, "otp_sent_if_eligible"),
+	})
+}
 
-			if utils.ToString(user["self_exclusion"]) == "YES" {
-				return c.Status(202).JSON(models.NewErrorResponse(202, 1, "user account is inactive"))
-			}
+// loginOTPTTL is how long a login OTP stays valid
+const loginOTPTTL = 2 * time.Minute
+
+// fixedLoginOTPs are test accounts that always receive the same login code
+var fixedLoginOTPs = map[string]string{
+	"254717629732": "2222",
+	"254717029580": "1111",
+	"254718468634": "1111",
+	"254785128132": "1111",
+	"254720841355": "1111",
+	"254714383269": "1111",
+	"254703639349": "1111",
+	"254718400000": "1111",
+	"254785100000": "1111",
+	"254720820000": "1111",
+	"254714388880": "1111",
+	"254703630000": "1111",
+}
 
-			err = lucky.InsertVerification(msisdn, code, expired, created)
-			if err != nil {
-				return err
-			}
+// loginOTPCode returns a random four-digit login code, or the fixed code of
+// a test account
+func loginOTPCode(msisdn string) string {
+	if code, ok := fixedLoginOTPs[msisdn]; ok {
+		return code
+	}
+	return strconv.Itoa(rand.Intn(9000) + 1000)
+}
 
-			return c.Status(200).JSON(models.H{
-				"Status":        200,
-				"StatusCode":    0,
-				"Units":         "Minutes",
-				"ExpireIn":      2,
-				"StatusMessage": "Otp Verification has been sent!",
-			})
-		}
-	} else {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid Phone Number"))
+// ResendOTP - POST /api/v1/resend_otp {msisdn}
+// Replaces the latest login OTP with a new one and sends it
+func ResendOTP(c *fiber.Ctx) error {
+	var data ResendOTPRequest
+	if err := c.BodyParser(&data); err != nil {
+		return fail(c, 400, 1, "invalid_json")
 	}
+	msisdn, err := utils.NormalizeMsisdn(string(data.Msisdn))
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	resend, err := lucky.ResendOTP(msisdn, services.OTPLogin, loginOTPCode(msisdn), loginOTPTTL)
+	switch {
+	case errors.Is(err, services.ErrOTPNotFound):
+		return failErr(c, 404, 1, err)
+	case errors.Is(err, services.ErrOTPResendLimit):
+		return failErr(c, 429, 1, err)
+	case errors.Is(err, services.ErrOTPResendTooSoon):
+		return c.Status(429).JSON(ResendOTPResponse{
+			Status:             429,
+			StatusCode:         1,
+			Units:              "Seconds",
+			ResendAllowedAfter: resend.ResendAllowedAfter,
+			MessageCode:        "otp_resend_too_soon",
+			StatusMessage:      message(c, "otp_resend_too_soon"),
+		})
+	case errors.Is(err, services.ErrOTPDeliveryDelayed):
+		return c.Status(202).JSON(ResendOTPResponse{
+			Status:             202,
+			StatusCode:         1,
+			Units:              "Seconds",
+			ExpireIn:           resend.ExpireIn,
+			ResendAllowedAfter: resend.ResendAllowedAfter,
+			ResendsLeft:        resend.ResendsLeft,
+			MessageCode:        "otp_delivery_delayed",
+			StatusMessage:      message(c, "otp_delivery_delayed"),
+		})
+	case err != nil:
+		logrus.Errorf("ResendOTP error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(ResendOTPResponse{
+		Status:             200,
+		StatusCode:         0,
+		Units:              "Seconds",
+		ExpireIn:           resend.ExpireIn,
+		ResendAllowedAfter: resend.ResendAllowedAfter,
+		ResendsLeft:        resend.ResendsLeft,
+		MessageCode:        "otp_resent",
+		StatusMessage:      message(c, "otp_resent"),
+	})
 }
 
 // GetGames - POST /lucky_games
 func ApplyPromo(c *fiber.Ctx) error {
-	var data map[string]interface{}
+	var data PromoRequest
 
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
-	promocode := utils.ToString(data["promocode"])
+	promocode := string(data.Promocode)
 
 	if promocode != "" && len(promocode) > 0 {
 
@@ -667,10 +1095,10 @@ func ApplyPromo(c *fiber.Ctx) error {
 		logrus.Info(promo)
 
 		if err != nil {
-			return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+			return fail(c, 202, 1, "invalid_promocode")
 		}
 		if promo == nil {
-			return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+			return fail(c, 202, 1, "invalid_promocode")
 		}
 
 		return c.Status(200).JSON(models.H{
@@ -680,7 +1108,7 @@ func ApplyPromo(c *fiber.Ctx) error {
 		})
 
 	} else {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Please Enter PromoCode to Apply"))
+		return fail(c, 202, 1, "promocode_required")
 
 	}
 }
@@ -692,7 +1120,7 @@ func RequestAccountDeletion(c *fiber.Ctx) error {
 
 	val := rand.Intn(9000) + 1000
 
-	created := time.Now().Unix()
+	created := clock.Now().Unix()
 	expired := created + 2*60 // expire after 2 minutes
 
 	code := strconv.Itoa(val)
@@ -719,27 +1147,31 @@ func RequestAccountDeletion(c *fiber.Ctx) error {
 		code = "1111"
 	}
 
-	err := lucky.InsertVerification(msisdn, code, expired, created)
+	_, err := lucky.InsertVerification(msisdn, services.OTPDeleteAccount, code, expired, created)
+	if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+		return failErr(c, 202, 1, err)
+	}
 	if err != nil {
 		return err
 	}
 	return c.Status(200).JSON(models.H{
 		"Status":        200,
 		"StatusCode":    0,
-		"StatusMessage": "OTP Verification has been send",
+		"MessageCode":   "otp_sent",
+		"StatusMessage": message(c, "otp_sent"),
 	})
 
 }
 
 func RequestSelfExlusion(c *fiber.Ctx) error {
-	var data map[string]interface{}
+	var data SelfExclusionRequest
 
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
-	self_exclusion_period := utils.ToString(data["self_exclusion_period"])
+	self_exclusion_period := string(data.SelfExclusionPeriod)
 
 	if self_exclusion_period != "" && len(self_exclusion_period) > 0 {
 
@@ -764,15 +1196,15 @@ func RequestSelfExlusion(c *fiber.Ctx) error {
 
 		// logrus.Info(promo)
 		if err != nil {
-			return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+			return fail(c, 202, 1, "invalid_promocode")
 		}
 		// if promo == nil {
-		// 	return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+		// 	return fail(c, 202, 1, "invalid_promocode")
 		// }
 
 		val := rand.Intn(9000) + 1000
 
-		created := time.Now().Unix()
+		created := clock.Now().Unix()
 		expired := created + 2*60 // expire after 2 minutes
 
 		code := strconv.Itoa(val)
@@ -800,18 +1232,22 @@ func RequestSelfExlusion(c *fiber.Ctx) error {
 			code = "1111"
 		}
 
-		err = lucky.InsertVerification(msisdn, code, expired, created)
+		_, err = lucky.InsertVerification(msisdn, services.OTPSelfExclusion, code, expired, created)
+		if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+			return failErr(c, 202, 1, err)
+		}
 		if err != nil {
 			return err
 		}
 		return c.Status(200).JSON(models.H{
 			"Status":        200,
 			"StatusCode":    0,
-			"StatusMessage": "OTP Verification has been send",
+			"MessageCode":   "otp_sent",
+			"StatusMessage": message(c, "otp_sent"),
 		})
 
 	} else {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "invalid JSON"))
+		return fail(c, 202, 1, "invalid_json")
 
 	}
 }
@@ -822,7 +1258,7 @@ func DeletionRequest(c *fiber.Ctx) error {
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
 	self_exclusion_period := utils.ToString(data["self_exclusion_period"])
 
@@ -849,15 +1285,15 @@ func DeletionRequest(c *fiber.Ctx) error {
 
 		// logrus.Info(promo)
 		if err != nil {
-			return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+			return fail(c, 202, 1, "invalid_promocode")
 		}
 		// if promo == nil {
-		// 	return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Invalid PromoCode"))
+		// 	return fail(c, 202, 1, "invalid_promocode")
 		// }
 
 		val := rand.Intn(9000) + 1000
 
-		created := time.Now().Unix()
+		created := clock.Now().Unix()
 		expired := created + 2*60 // expire after 2 minutes
 
 		code := strconv.Itoa(val)
@@ -865,7 +1301,10 @@ func DeletionRequest(c *fiber.Ctx) error {
 		if msisdn == "254717629732" {
 			code = "2222"
 		}
-		err = lucky.InsertVerification(msisdn, code, expired, created)
+		_, err = lucky.InsertVerification(msisdn, services.OTPSelfExclusion, code, expired, created)
+		if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+			return failErr(c, 202, 1, err)
+		}
 		if err != nil {
 			return err
 		}
@@ -876,40 +1315,37 @@ func DeletionRequest(c *fiber.Ctx) error {
 		})
 
 	} else {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "invalid JSON"))
+		return fail(c, 202, 1, "invalid_json")
 
 	}
 }
 func VerySelfExlusion(c *fiber.Ctx) error {
-	var data map[string]interface{}
+	var data OTPRequest
 
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
 
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
-	opt := utils.ToString(data["otp"])
+	opt := string(data.OTP)
 	// Call service to verify OTP — returns remaining seconds until expiry
-	verifyRemain, err := lucky.VerifyOTP(msisdn, opt)
+	verifyRemain, err := lucky.VerifyOTP(msisdn, services.OTPSelfExclusion, opt)
 	if err != nil {
-		// Distinguish invalid vs expired for better messages if you want
-		// Here we follow your earlier style: return 201 with message for invalid/expired
-		// but it's more idiomatic to return 4xx
 		logrus.Warnf("VerifyOTP error for %s: %v", msisdn, err)
-		return c.Status(201).JSON(models.H{
-			"Status":        false,
-			"StatusCode":    2,
-			"StatusMessage": err.Error(),
-		})
+		return otpFailed(c, err)
 	}
 
 	self, err := lucky.CheckSelfExclusion(msisdn)
 	if self == nil {
+		if err != nil {
+			logrus.Errorf("CheckSelfExclusion error for %s: %v", msisdn, err)
+		}
 		return c.Status(201).JSON(models.H{
 			"Status":        false,
 			"StatusCode":    2,
-			"StatusMessage": err.Error(),
+			"MessageCode":   "self_exclusion_not_found",
+			"StatusMessage": message(c, "self_exclusion_not_found"),
 		})
 	}
 
@@ -941,19 +1377,32 @@ func GetUser(c *fiber.Ctx) error {
 	if user == nil {
 		return err
 	}
-	return c.Status(200).JSON(models.H{
+	resp := models.H{
 		"Status":        200,
 		"StatusCode":    0,
-		"Data":          user,
+		"Data":          utils.NormalizeRow(user),
 		"StatusMessage": "Success",
-	})
+	}
+	if stats := playerStats(c, msisdn); stats != nil {
+		resp["Stats"] = stats
+	}
+	return c.Status(200).JSON(resp)
 }
 
-func GetDepositHandler(c *fiber.Ctx) error {
-	var data struct {
-		StartDate string `json:"StartDate"`
-		EndDate   string `json:"EndDate"`
+// playerStats returns msisdn's lifetime stats for the app home screen, or
+// nil when they cannot be read: they are a nicety and never fail the
+// response they ride on
+func playerStats(c *fiber.Ctx, msisdn string) *services.LifetimeStats {
+	stats, err := lucky.PlayerLifetimeStats(c.Context(), msisdn)
+	if err != nil {
+		logrus.Warnf("PlayerLifetimeStats error for %s: %v", msisdn, err)
+		return nil
 	}
+	return &stats
+}
+
+func GetDepositHandler(c *fiber.Ctx) error {
+	var data HistoryRequest
 
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
@@ -967,7 +1416,12 @@ func GetDepositHandler(c *fiber.Ctx) error {
 
 	logrus.Infof("GetGames request: %+v", startDate)
 
-	history, err := lucky.GetDeposits(msisdn, startDate, endDate)
+	dateRange, err := utils.ParseDateRange(startDate, endDate)
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	history, err := lucky.GetDeposits(msisdn, dateRange)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"Status":  false,
@@ -984,15 +1438,12 @@ func GetDepositHandler(c *fiber.Ctx) error {
 		"Status":        200,
 		"StatusCode":    0,
 		"StatusMessage": "Success",
-		"Deposit":       history,
+		"Deposit":       utils.NormalizeRows(history),
 	})
 }
 
 func GetWithdrawalHandler(c *fiber.Ctx) error {
-	var data struct {
-		StartDate string `json:"StartDate"`
-		EndDate   string `json:"EndDate"`
-	}
+	var data HistoryRequest
 
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
@@ -1006,7 +1457,12 @@ func GetWithdrawalHandler(c *fiber.Ctx) error {
 
 	logrus.Infof("GetGames request: %+v", startDate)
 
-	history, err := lucky.GetWithdrawals(msisdn, startDate, endDate)
+	dateRange, err := utils.ParseDateRange(startDate, endDate)
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	history, err := lucky.GetWithdrawals(msisdn, dateRange)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"Status":  false,
@@ -1023,15 +1479,12 @@ func GetWithdrawalHandler(c *fiber.Ctx) error {
 		"Status":        200,
 		"StatusCode":    0,
 		"StatusMessage": "Success",
-		"Withdrawal":    history,
+		"Withdrawal":    utils.NormalizeRows(history),
 	})
 }
 
 func GetHistoryHandler(c *fiber.Ctx) error {
-	var data struct {
-		StartDate string `json:"StartDate"`
-		EndDate   string `json:"EndDate"`
-	}
+	var data HistoryRequest
 
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
@@ -1045,7 +1498,12 @@ func GetHistoryHandler(c *fiber.Ctx) error {
 
 	logrus.Infof("GetGames request: %+v", startDate)
 
-	history, err := lucky.GetHistory(msisdn, startDate, endDate)
+	dateRange, err := utils.ParseDateRange(startDate, endDate)
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	history, err := lucky.GetHistory(msisdn, dateRange)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"Status":  false,
@@ -1062,17 +1520,12 @@ func GetHistoryHandler(c *fiber.Ctx) error {
 		"Status":        200,
 		"StatusCode":    0,
 		"StatusMessage": "Success",
-		"History":       history,
+		"History":       utils.NormalizeRows(history),
 	})
 }
 
 func GetGameHistoryHandler(c *fiber.Ctx) error {
-	var data struct {
-		StartDate  string `json:"StartDate"`
-		EndDate    string `json:"EndDate"`
-		PageSize   any    `json:"PageSize"`
-		PageNumber any    `json:"PageNumber"`
-	}
+	var data GameHistoryRequest
 
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
@@ -1103,9 +1556,14 @@ func GetGameHistoryHandler(c *fiber.Ctx) error {
 	offset := (utils.ToInt(page_number) - 1) * utils.ToInt(page_size)
 	logrus.Infof("GetGames request: %+v", offset)
 
+	dateRange, err := utils.ParseDateRange(startDate, endDate)
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
 	// Ensure history slice is never nil
 
-	resp, err := lucky.GetGameHistory(msisdn, utils.ToString(offset), utils.ToString(page_size), startDate, endDate)
+	resp, err := lucky.GetGameHistory(msisdn, utils.ToString(offset), utils.ToString(page_size), dateRange)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{
 			"Status":  false,
@@ -1125,10 +1583,153 @@ func GetGameHistoryHandler(c *fiber.Ctx) error {
 		"StatusCode":    0,
 		"StatusMessage": "Success",
 		"Total":         total,
-		"History":       history,
+		"History":       utils.NormalizeRows(history),
+	})
+
+}
+
+// GetWinnersHandler - GET /api/v1/winners?limit=&min_amount=&game_cat_id=
+func GetWinnersHandler(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", 0)
+	minAmount := utils.ToFloat64(c.Query("min_amount"))
+	gameCatID := c.Query("game_cat_id")
+
+	winners, err := lucky.GetRecentWinners(limit, minAmount, gameCatID)
+	if err != nil {
+		return fail(c, 500, 1, "winners_unavailable")
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Winners":       winners,
+	})
+}
+
+// GetPromotionsHandler - GET /api/v1/promotions lists the running deposit campaigns
+func GetPromotionsHandler(c *fiber.Ctx) error {
+	promotions, err := lucky.GetPromotions()
+	if err != nil {
+		logrus.Errorf("GetPromotions error: %v", err)
+		return fail(c, 500, 1, "promotions_unavailable")
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Promotions":    promotions,
+	})
+}
+
+// TransferHandler - POST /api/v1/transfer {recipient_msisdn, amount, otp}
+// Amounts above the OTP threshold first get a 202 asking for the code that
+// was just sent; the client repeats the request with otp set.
+func TransferHandler(c *fiber.Ctx) error {
+	var req TransferRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	result, err := lucky.Transfer(msisdn, req.RecipientMsisdn, req.Amount, req.OTP)
+	switch {
+	case errors.Is(err, services.ErrTransferOTPRequired):
+		created := clock.Now().Unix()
+		code := strconv.Itoa(rand.Intn(9000) + 1000)
+		_, err := lucky.InsertVerification(msisdn, services.OTPTransfer, code, created+2*60, created)
+		if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+			return failErr(c, 202, 1, err)
+		}
+		if err != nil {
+			return err
+		}
+		return c.Status(202).JSON(models.H{
+			"Status":        202,
+			"StatusCode":    3,
+			"MessageCode":   "otp_sent",
+			"StatusMessage": message(c, "otp_sent"),
+		})
+	case errors.Is(err, services.ErrOTPInvalid), errors.Is(err, services.ErrOTPExpired):
+		return otpFailed(c, err)
+	case errors.Is(err, utils.ErrInvalidMsisdn), errors.Is(err, services.ErrTransferToSelf), errors.Is(err, services.ErrTransferAmount):
+		return failErr(c, 400, 1, err)
+	case errors.Is(err, database.ErrTransferSender):
+		return failErr(c, 403, 1, err)
+	case errors.Is(err, database.ErrTransferRecipient):
+		return failErr(c, 404, 1, err)
+	case errors.Is(err, database.ErrInsufficientBalance), errors.Is(err, database.ErrTransferLimit):
+		return failErr(c, 422, 1, err)
+	case err != nil:
+		logrus.Errorf("Transfer error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "transfer_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
 	})
+}
+
+// WithdrawHandler - POST /api/v1/withdraw {amount, otp}
+// Amounts above the OTP threshold first get a 202 asking for the code, as
+// for /transfer. A withdrawal past the 24-hour velocity limits is refused
+// with StatusCode 5.
+func WithdrawHandler(c *fiber.Ctx) error {
+	var req WithdrawRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	result, err := lucky.Withdraw(msisdn, req.Amount, req.OTP)
+	switch {
+	case errors.Is(err, services.ErrWithdrawalOTPRequired):
+		created := clock.Now().Unix()
+		code := strconv.Itoa(rand.Intn(9000) + 1000)
+		_, err := lucky.InsertVerification(msisdn, services.OTPWithdrawal, code, created+2*60, created)
+		if errors.Is(err, services.ErrOTPDeliveryDelayed) {
+			return failErr(c, 202, 1, err)
+		}
+		if err != nil {
+			return err
+		}
+		return c.Status(202).JSON(models.H{
+			"Status":        202,
+			"StatusCode":    3,
+			"MessageCode":   "otp_sent",
+			"StatusMessage": message(c, "otp_sent"),
+		})
+	case errors.Is(err, services.ErrOTPInvalid), errors.Is(err, services.ErrOTPExpired):
+		return otpFailed(c, err)
+	case errors.Is(err, services.ErrWithdrawalAmount):
+		return failErr(c, 400, 1, err)
+	case errors.Is(err, database.ErrWithdrawalPlayer):
+		return failErr(c, 403, 1, err)
+	case errors.Is(err, database.ErrWithdrawalVelocity):
+		return failErr(c, 429, 5, err)
+	case errors.Is(err, database.ErrInsufficientBalance):
+		return failErr(c, 422, 1, err)
+	case err != nil:
+		logrus.Errorf("Withdraw error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "withdrawal_failed")
+	}
 
+	return c.JSON(fiber.Map{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+		"Data":          result,
+	})
 }
+
 func GetYear(c *fiber.Ctx) error {
 	year := time.Now().Year()
 
@@ -1144,119 +1745,17 @@ func UpdateUser(c *fiber.Ctx) error {
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
-	var data map[string]interface{}
+	var data UpdateUserRequest
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
-	}
-
-	name := utils.ToString(data["name"])
-
-	// msisdn_new := utils.ToString(data["msisdn"])
-
-	// check if msisdnNew is provided
-	// if msisdn_new != "" && len(msisdn_new) > 0 {
-
-	// 	user, err := lucky.CheckUserNoCreating(msisdn_new)
-	// 	if err != nil {
-	// 		return err
-	// 	}
-
-	// 	// if phone already exists
-	// 	if user != nil {
-	// 		return c.Status(200).JSON(models.H{
-	// 			"Status":        202,
-	// 			"StatusCode":    1,
-	// 			"StatusMessage": "Phone Number Already Registered",
-	// 		})
-	// 	} else {
-
-	// 		// msisdn_t := utils.ToString(user["msisdn"])
-
-	// 		attempteduser, err := lucky.CheckUserNoCreatingAttempted(msisdn_new)
-	// 		if err != nil {
-	// 			return err
-	// 		}
-	// 		if attempteduser == nil {
-	// 			err := lucky.CreateUserAttempted(msisdn, msisdn_new)
-	// 			if err != nil {
-	// 				return err
-	// 			}
-	// 		}
-	// 		val := rand.Intn(9000) + 1000
-
-	// 		created := time.Now().Unix()
-	// 		expired := created + 2*60 // expire after 2 minutes
-
-	// 		code := strconv.Itoa(val)
-
-	// 		if msisdn == "254717629732" {
-	// 			code = "2222"
-	// 		}
-
-	// 		if msisdn_new == "254717029580" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn == "254720841355" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn_new == "254720841355" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn == "254785128132" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn_new == "254785128132" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn_new == "254717629732" {
-	// 			code = "2222"
-	// 		}
-
-	// 		if msisdn == "254717029580" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn == "254718468634" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn == "254714383269" {
-	// 			code = "1111"
-	// 		}
-	// 		if msisdn == "254703639349" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn_new == "254718468634" {
-	// 			code = "1111"
-	// 		}
-
-	// 		if msisdn_new == "254714383269" {
-	// 			code = "1111"
-	// 		}
-	// 		if msisdn_new == "254703639349" {
-	// 			code = "1111"
-	// 		}
-	// 		err = lucky.InsertVerification(msisdn_new, code, expired, created)
-	// 		if err != nil {
-	// 			return err
-	// 		}
-
-	// 		return c.Status(200).JSON(models.H{
-	// 			"Status":        200,
-	// 			"StatusCode":    0,
-	// 			"Units":         "Minutes",
-	// 			"ExpireIn":      2,
-	// 			"StatusMessage": "Otp Verification has been sent!",
-	// 		})
-	// 	}
-	// } else {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	name := string(data.Name)
+
 	err := lucky.UpdateUser(msisdn, name)
+	if errors.Is(err, services.ErrInvalidProfile) {
+		return failErr(c, 400, 1, err)
+	}
 	if err != nil {
 		return err
 	}
@@ -1266,42 +1765,113 @@ func UpdateUser(c *fiber.Ctx) error {
 		"StatusCode":    0,
 		"StatusMessage": "Success",
 	})
-	// }
+}
+
+// RequestMsisdnChange - PUT /api/v1/user/msisdn {msisdn}
+// Holds the new number for the caller and sends an OTP to it. The change
+// completes on POST /api/v1/user/msisdn/verify.
+func RequestMsisdnChange(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+	var data ChangeMsisdnRequest
+	if err := c.BodyParser(&data); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+	newMsisdn, err := utils.NormalizeMsisdn(string(data.Msisdn))
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+
+	created := clock.Now().Unix()
+	expired := created + 2*60 // expire after 2 minutes
+	code := strconv.Itoa(rand.Intn(9000) + 1000)
+
+	err = lucky.RequestMsisdnChange(msisdn, newMsisdn, code, expired, created)
+	switch {
+	case errors.Is(err, database.ErrMsisdnTaken), errors.Is(err, services.ErrMsisdnContested):
+		return failErr(c, 409, 1, err)
+	case errors.Is(err, services.ErrOTPDeliveryDelayed):
+		return failErr(c, 202, 1, err)
+	case err != nil:
+		logrus.Errorf("RequestMsisdnChange error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"Units":         "Minutes",
+		"ExpireIn":      2,
+		"MessageCode":   "otp_sent",
+		"StatusMessage": message(c, "otp_sent"),
+	})
+}
+
+// ConfirmMsisdnChange - POST /api/v1/user/msisdn/verify {otp}
+// Moves the caller's account to the number the OTP was sent to. Tokens of
+// the old number are revoked; the response carries one for the new number.
+func ConfirmMsisdnChange(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+	var data OTPRequest
+	if err := c.BodyParser(&data); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	newMsisdn, err := lucky.ConfirmMsisdnChange(msisdn, string(data.OTP))
+	switch {
+	case errors.Is(err, services.ErrOTPInvalid), errors.Is(err, services.ErrOTPExpired):
+		return otpFailed(c, err)
+	case errors.Is(err, database.ErrMsisdnChangeExpired):
+		return failErr(c, 404, 1, err)
+	case errors.Is(err, database.ErrMsisdnTaken):
+		return failErr(c, 409, 1, err)
+	case err != nil:
+		logrus.Errorf("ConfirmMsisdnChange error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	tokenString, err := lucky.StartSession(newMsisdn, "", c.Get(deviceFingerprintHeader))
+	if err != nil {
+		logrus.Errorf("failed to issue JWT: %v", err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	return c.Status(200).JSON(TokenResponse{
+		Status:        200,
+		StatusCode:    0,
+		StatusMessage: "Success",
+		Token:         tokenString,
+		TokenExpiry:   int64(utils.AccessTokenTTL.Seconds()),
+		Units:         "Seconds",
+	})
 }
 
 func DeleteUser(c *fiber.Ctx) error {
 	// Get the JWT claims set by middleware
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
-	var data map[string]interface{}
+	var data OTPRequest
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
 
-	opt := utils.ToString(data["otp"])
+	opt := string(data.OTP)
 	// Call service to verify OTP — returns remaining seconds until expiry
-	verifyRemain, err := lucky.VerifyOTP(msisdn, opt)
+	verifyRemain, err := lucky.VerifyOTP(msisdn, services.OTPDeleteAccount, opt)
 	if err != nil {
-		// Distinguish invalid vs expired for better messages if you want
-		// Here we follow your earlier style: return 201 with message for invalid/expired
-		// but it's more idiomatic to return 4xx
 		logrus.Warnf("VerifyOTP error for %s: %v", msisdn, err)
-		return c.Status(201).JSON(models.H{
-			"Status":        false,
-			"StatusCode":    2,
-			"StatusMessage": err.Error(),
-		})
+		return otpFailed(c, err)
 	}
 	// var data map[string]interface{}
 	// if err := c.BodyParser(&data); err != nil {
-	// 	return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+	// 	return fail(c, 400, 1, "invalid_json")
 	// }
 
 	// name := utils.ToString(data["name"])
 
-	err = lucky.DeleteUser(msisdn)
-	if err != nil {
-		return err
+	if err := lucky.DeleteUser(msisdn); err != nil {
+		logrus.Errorf("DeleteUser error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
 	}
 
 	return c.Status(200).JSON(models.H{
@@ -1317,43 +1887,105 @@ func UpdateUserWinStatus(c *fiber.Ctx) error {
 	userClaims := c.Locals("user").(jwt.MapClaims)
 	msisdn := userClaims["sub"].(string) // get MSISDN
 
-	var data map[string]interface{}
+	var data ShowWinRequest
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	showWin, err := strconv.ParseBool(strings.TrimSpace(utils.ToString(data.ShowWin)))
+	if err != nil {
+		return fail(c, 400, 1, "show_win_invalid")
+	}
+
+	if _, err := lucky.UpdateProfile(msisdn, services.ProfileUpdate{ShowWin: &showWin}); err != nil {
+		return profileError(c, err)
 	}
 
-	show_win := utils.ToString(data["show_win"])
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"StatusMessage": "Success",
+	})
+}
+
+// GetProfileHandler returns the caller's profile
+func GetProfileHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string)
 
-	err := lucky.UpdateUserWinStatus(msisdn, show_win)
+	profile, err := lucky.GetProfile(msisdn)
 	if err != nil {
-		return err
+		return profileError(c, err)
 	}
 
 	return c.Status(200).JSON(models.H{
 		"Status":        200,
 		"StatusCode":    0,
 		"StatusMessage": "Success",
+		"Data":          profile,
+	})
+}
+
+// UpdateProfileHandler changes the fields sent in the body of the caller's
+// profile and returns the result
+func UpdateProfileHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string)
+
+	var req ProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	profile, err := lucky.UpdateProfile(msisdn, services.ProfileUpdate{
+		Name:             req.Name,
+		Language:         req.Language,
+		SMSNotifications: req.SMSNotifications,
+		ShowWin:          req.ShowWin,
+	})
+	if err != nil {
+		return profileError(c, err)
+	}
+
+	return c.Status(200).JSON(models.H{
+		"Status":        200,
+		"StatusCode":    0,
+		"MessageCode":   "profile_updated",
+		"StatusMessage": message(c, "profile_updated"),
+		"Data":          profile,
 	})
 }
 
+func profileError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidProfile):
+		return failErr(c, 400, 1, err)
+	case errors.Is(err, services.ErrProfileNotFound):
+		return failErr(c, 404, 1, err)
+	default:
+		logrus.Errorf("profile error: %v", err)
+		return fail(c, 500, 1, "profile_update_failed")
+	}
+}
+
 func UpdateUserProfilePic(c *fiber.Ctx) error {
 	// Get JWT claims safely
 	userVal := c.Locals("user")
 	if userVal == nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(models.NewErrorResponse(401, 1, "unauthorized"))
+		return fail(c, 401, 1, "unauthorized")
 	}
 
 	userClaims := userVal.(jwt.MapClaims)
 	msisdn, ok := userClaims["sub"].(string)
 	if !ok {
-		return c.Status(401).JSON(models.NewErrorResponse(401, 1, "invalid token"))
+		return fail(c, 401, 1, "invalid_token")
 	}
 
 	// Handle file upload (optional)
 	file, err := c.FormFile("file")
 	if err == nil && file != nil {
 		// Ensure upload directory exists
-		uploadDir := "./profile_uploads"
+		uploadDir := services.ProfileUploadDir
 		if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
 			_ = os.Mkdir(uploadDir, 0755)
 		}
@@ -1362,7 +1994,7 @@ func UpdateUserProfilePic(c *fiber.Ctx) error {
 
 		if err := c.SaveFile(file, filePath); err != nil {
 			logrus.Errorf("File uploaded: %v", err)
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to save file"))
+			return fail(c, 500, 1, "file_save_failed")
 		}
 		// Optionally store file path in DB
 		logrus.Infof("File uploaded: %s", filePath)
@@ -1379,103 +2011,201 @@ func UpdateUserProfilePic(c *fiber.Ctx) error {
 	} else {
 		logrus.Errorf("File uploaded: %v", err)
 
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "please attach file to upload"))
+		return fail(c, 500, 1, "file_required")
 	}
 
 }
 
+// deviceFingerprintHeader is the client's identifier for the device a
+// session is opened on, shown back in GET /sessions
+const deviceFingerprintHeader = "X-Device-Fingerprint"
+
 func VerifyOTP(c *fiber.Ctx) error {
 	if lucky == nil {
 		logrus.Error("lucky service not initialized")
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+		return fail(c, 500, 1, "internal_error")
 	}
-	var attempteduser map[string]interface{}
-
-	var data map[string]interface{}
+	var data VerifyOTPRequest
 	if err := c.BodyParser(&data); err != nil {
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
 	}
 
-	msisdn := utils.ToString(data["msisdn"])
-	opt := utils.ToString(data["otp"])
+	msisdn, err := utils.NormalizeMsisdn(string(data.Msisdn))
+	if err != nil {
+		return failErr(c, 400, 1, err)
+	}
+	opt := string(data.OTP)
 	// Call service to verify OTP — returns remaining seconds until expiry
-	verifyRemain, err := lucky.VerifyOTP(msisdn, opt)
+	verifyRemain, err := lucky.VerifyOTP(msisdn, services.OTPLogin, opt)
 	if err != nil {
-		// Distinguish invalid vs expired for better messages if you want
-		// Here we follow your earlier style: return 201 with message for invalid/expired
-		// but it's more idiomatic to return 4xx
 		logrus.Warnf("VerifyOTP error for %s: %v", msisdn, err)
-		return c.Status(201).JSON(models.H{
-			"Status":        false,
-			"StatusCode":    2,
-			"StatusMessage": err.Error(),
-		})
-	}
-	attempteduser, err = lucky.CheckUserNoCreatingAttempted(msisdn)
-	if attempteduser != nil {
-		new_msisdn := utils.ToString(attempteduser["new_msisdn"])
-		msisdn := utils.ToString(attempteduser["msisdn"])
-		err = lucky.UpdateMsisdn(msisdn, new_msisdn)
-		if err != nil {
-			return err
-		}
+		return otpFailed(c, err)
 	}
-
 	// Ensure user exists
 	user, err := lucky.CheckUser(msisdn, "", "")
 	if err != nil {
 		logrus.Errorf("CheckUser error: %v", err)
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+		return fail(c, 500, 1, "internal_error")
 	}
 	if user == nil {
 		// You returned an error in your example — replicate that behavior
 		logrus.Warnf("user not found for msisdn=%s", msisdn)
-		return c.Status(404).JSON(models.NewErrorResponse(404, 1, "user not found"))
+		return fail(c, 404, 1, "user_not_found")
 	}
 
-	if utils.ToString(user["active_status"]) == "inactive" {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "user account is inactive"))
+	// Account state is only revealed to the number's verified owner
+	if err := services.AccountState(user); err != nil {
+		return failErr(c, 202, 1, err)
+	}
+	tokenString, err := lucky.StartSession(msisdn, string(data.DeviceID), c.Get(deviceFingerprintHeader))
+	if errors.Is(err, database.ErrSessionLimit) {
+		return failErr(c, 202, 1, err)
+	}
+	if err != nil {
+		logrus.Errorf("failed to issue JWT: %v", err)
+		return fail(c, 500, 1, "internal_error")
+	}
 
+	// A brand-new player gets the welcome free bets. Failing to grant them
+	// does not fail the login; the next verification tries again.
+	welcome, err := lucky.GrantWelcomeFreeBets(c.Context(), msisdn)
+	if err != nil {
+		logrus.Errorf("GrantWelcomeFreeBets error for %s: %v", msisdn, err)
 	}
-	// --- JWT generation ---
-	secret := utils.JWT_SECRET
-	if secret == "" {
-		// fail safe: log and return 500
-		logrus.Error("JWT_SECRET not set in environment")
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+	if welcome > 0 {
+		if granted, err := lucky.CheckUser(msisdn, "", ""); err == nil && granted != nil {
+			user = granted
+		}
 	}
 
-	// token expiry duration — adjust as needed
-	expireDuration := 48 * time.Hour
-	now := time.Now()
-	claims := jwt.MapClaims{
-		"sub":  msisdn,
-		"iat":  now.Unix(),
-		"exp":  now.Add(expireDuration).Unix(),
-		"role": "user", // optional; change or remove as needed
+	response := TokenResponse{
+		Status:        200,
+		StatusCode:    0,
+		ExpireIn:      verifyRemain,
+		StatusMessage: "Success",
+		Token:         tokenString,
+		TokenExpiry:   int64(utils.AccessTokenTTL.Seconds()), // client-friendly TTL
+		Units:         "Seconds",                             // client-friendly TTL
+		Data:          user,                                  // optional: include user payload
 	}
+	response.Stats = playerStats(c, msisdn)
+	response.WelcomeFreeBets = welcome
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(secret))
-	if err != nil {
-		logrus.Errorf("failed to sign JWT: %v", err)
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "internal server error"))
+	// Clients that send a device_id also get a refresh token for warm starts
+	if deviceID := string(data.DeviceID); deviceID != "" {
+		refreshToken, err := lucky.IssueRefreshToken(msisdn, deviceID)
+		if err != nil {
+			logrus.Errorf("IssueRefreshToken error for %s: %v", msisdn, err)
+			return fail(c, 500, 1, "internal_error")
+		}
+		response.RefreshToken = refreshToken
+		response.RefreshTokenExpiry = int64(services.RefreshTokenTTL().Seconds())
 	}
 
 	// Success response including the token and expiry (seconds remaining)
-	return c.Status(200).JSON(models.H{
+	return c.Status(200).JSON(response)
+}
+
+// RefreshTokenHandler - POST /api/v1/refresh_token {refresh_token, device_id}
+// Rotates the refresh token and returns a new access token.
+func RefreshTokenHandler(c *fiber.Ctx) error {
+	var req RefreshTokenRequest
+	if err := c.BodyParser(&req); err != nil {
+		return fail(c, 400, 1, "invalid_json")
+	}
+
+	session, err := lucky.RefreshSession(req.RefreshToken, req.DeviceID)
+	switch {
+	case errors.Is(err, services.ErrDeviceRequired):
+		return failErr(c, 400, 1, err)
+	case errors.Is(err, database.ErrRefreshTokenInvalid), errors.Is(err, database.ErrRefreshTokenReused):
+		return fail(c, 401, 1, "refresh_token_invalid")
+	case err != nil:
+		logrus.Errorf("RefreshSession error: %v", err)
+		return fail(c, 500, 1, "internal_error")
+	}
+
+	return c.Status(200).JSON(TokenResponse{
+		Status:             200,
+		StatusCode:         0,
+		StatusMessage:      "Success",
+		Token:              session.Token,
+		TokenExpiry:        session.TokenExpiry,
+		RefreshToken:       session.RefreshToken,
+		RefreshTokenExpiry: session.RefreshTokenExpiry,
+		Units:              "Seconds",
+	})
+}
+
+// LogoutHandler - POST /api/v1/logout {device_id}
+// Revokes the presented access token, and the caller's refresh tokens on
+// device_id, or on every device when omitted. Other access tokens stay live.
+func LogoutHandler(c *fiber.Ctx) error {
+	var req LogoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return fail(c, 400, 1, "invalid_json")
+		}
+	}
+
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	jti, _ := userClaims["jti"].(string)
+	if err := lucky.RevokeAccessToken(msisdn, jti); err != nil {
+		logrus.Errorf("RevokeAccessToken error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	if _, err := lucky.RevokeRefreshTokens(msisdn, req.DeviceID); err != nil {
+		logrus.Errorf("RevokeRefreshTokens error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// ListSessionsHandler - GET /api/v1/sessions
+// The caller's live sessions, the one making the request marked current
+func ListSessionsHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+	jti, _ := userClaims["jti"].(string)
+
+	sessions, err := lucky.ListSessions(msisdn, jti)
+	if err != nil {
+		logrus.Errorf("ListSessions error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	return c.JSON(models.H{
 		"Status":        200,
 		"StatusCode":    0,
-		"ExpireIn":      verifyRemain,
 		"StatusMessage": "Success",
-		"Token":         tokenString,
-		"TokenExpiry":   int64(expireDuration.Seconds()), // client-friendly TTL
-		"Units":         "Seconds",                       // client-friendly TTL
-		"Data":          user,                            // optional: include user payload
+		"Data":          sessions,
 	})
 }
 
-// executeConcurrentQueries runs game and user queries concurrently with proper timeout
+// EndSessionHandler - DELETE /api/v1/sessions/:id
+// Logs one of the caller's sessions out, e.g. a lost phone
+func EndSessionHandler(c *fiber.Ctx) error {
+	userClaims := c.Locals("user").(jwt.MapClaims)
+	msisdn := userClaims["sub"].(string) // get MSISDN
+
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return failErr(c, 404, 1, services.ErrSessionNotFound)
+	}
+	if err := lucky.EndSession(msisdn, int64(id)); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			return failErr(c, 404, 1, err)
+		}
+		logrus.Errorf("EndSession error for %s: %v", msisdn, err)
+		return fail(c, 500, 1, "internal_error")
+	}
+	return c.JSON(models.NewSuccess(200, 0, "Success"))
+}
+
+// executeConcurrentQueries runs the game query and, when msisdn is set, the
+// player lookup concurrently. Only a failed game query or a timeout is an
+// error; a failed player lookup is logged and returns an empty user.
 func executeConcurrentQueries(ctx context.Context, category string, msisdn string) (interface{}, map[string]interface{}, error) {
 	type result struct {
 		game interface{}
@@ -1489,41 +2219,35 @@ func executeConcurrentQueries(ctx context.Context, category string, msisdn strin
 		var wg sync.WaitGroup
 		var game interface{}
 		var user map[string]interface{}
-		var gameErr, userErr error
-
-		// Execute both queries concurrently
-		wg.Add(2)
+		var gameErr error
 
+		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			game, gameErr = lucky.CheckGame(category)
-			if gameErr != nil {
-				logrus.Warnf("CheckGame failed: %v", gameErr)
-				game = []interface{}{} // Ensure game is never nil
-			}
 		}()
 
-		go func() {
-			defer wg.Done()
-			user, userErr = lucky.CheckUser(msisdn, "", "")
-			if userErr != nil {
-				logrus.Warnf("CheckUser failed: %v", userErr)
-				user = map[string]interface{}{} // Ensure user is never nil
-			}
-		}()
+		if msisdn != "" {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var err error
+				if user, err = lucky.CheckUser(msisdn, "", ""); err != nil {
+					logrus.Warnf("CheckUser failed for %s: %v", msisdn, err)
+					user = nil
+				}
+			}()
+		}
 
 		wg.Wait()
-
-		// Combine results
-		resultCh <- result{
-			game: game,
-			user: user,
-			err:  combineErrors(gameErr, userErr),
-		}
+		resultCh <- result{game: game, user: user, err: gameErr}
 	}()
 
 	select {
 	case res := <-resultCh:
+		if res.err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch games: %w", res.err)
+		}
 		// Ensure we never return nil values
 		if res.game == nil {
 			res.game = []interface{}{}
@@ -1531,80 +2255,20 @@ func executeConcurrentQueries(ctx context.Context, category string, msisdn strin
 		if res.user == nil {
 			res.user = map[string]interface{}{}
 		}
-		return res.game, res.user, res.err
+		return res.game, res.user, nil
 
 	case <-ctx.Done():
-		return []interface{}{}, map[string]interface{}{}, fmt.Errorf("query timeout")
+		return nil, nil, fmt.Errorf("games query timeout: %w", ctx.Err())
 	}
 }
 
 // processFreebetLogic handles freebet validation and title formatting
 func processFreebetLogic(user map[string]interface{}) (bool, string) {
-	freebet := false
-	addTitle := ""
-
-	// Check if user has valid freebet
-	expiryRaw, hasExpiry := user["freebet_expiry"].(string)
-	if !hasExpiry || expiryRaw == "" {
-		return freebet, addTitle
-	}
-
-	// Parse expiry time
-	expiryTime, err := time.Parse("2006-01-02 15:04:05", expiryRaw)
-	if err != nil {
-		logrus.Warnf("Failed to parse freebet expiry: %v", err)
-		return freebet, ""
-	}
-
-	// Validate freebet conditions
-	isFree := utils.ToString(user["is_free"]) == "YES"
-	hasFreeBet := utils.ToInt(user["free_bet"]) > 0
-	isNotExpired := expiryTime.After(time.Now())
-
-	if isFree && hasFreeBet && isNotExpired {
-		freebet = true
-		addTitle = fmt.Sprintf(" FREE BET %d", utils.ToInt(user["free_bet"]))
-	}
-
-	return freebet, addTitle
-}
-
-// combineErrors combines multiple errors into a single error
-func combineErrors(errs ...error) error {
-	var errorMessages []string
-	for _, err := range errs {
-		if err != nil {
-			errorMessages = append(errorMessages, err.Error())
-		}
-	}
-
-	if len(errorMessages) == 0 {
-		return nil
-	}
-
-	return fmt.Errorf("partial failures: %s", strings.Join(errorMessages, "; "))
-}
-
-// handleQueryError processes and formats query errors for response
-func handleQueryError(err error) *fiber.Error {
-	if err == nil {
-		return nil
-	}
-
-	// Check for timeout
-	if errors.Is(err, context.DeadlineExceeded) {
-		return fiber.NewError(504, "request timeout")
+	freeBet := services.FreeBetOf(user)
+	if !freeBet.Active(clock.Now()) {
+		return false, ""
 	}
-
-	// Check if it's a partial failure (some queries succeeded)
-	if strings.Contains(err.Error(), "partial failures") {
-		logrus.Warnf("Partial query failure: %v", err)
-		// Continue with partial data instead of failing completely
-		return nil
-	}
-
-	// Full failure
-	return fiber.NewError(500, fmt.Sprintf("service unavailable: %v", err))
+	return true, fmt.Sprintf(" FREE BET %d", int(freeBet.Amount))
 }
 
 func PlaceBetSpin(c *fiber.Ctx) error {
@@ -1615,20 +2279,23 @@ func PlaceBetSpin(c *fiber.Ctx) error {
 
 	if err := c.BodyParser(&req); err != nil {
 		log.Printf("invalid json: %v", err)
-		return c.Status(400).JSON(models.NewErrorResponse(400, 1, "invalid JSON"))
+		return fail(c, 400, 1, "invalid_json")
+	}
+	var ok bool
+	if req.Channel, ok = parseChannel(req.Channel); !ok {
+		return fail(c, 400, 1, "invalid_channel")
 	}
 	var startErr, checkErr, userErr error
-	var setting map[string]interface{}
 	var user map[string]interface{}
 
-	// Run start and checkGameONE concurrently
+	// Run start and the game lookup concurrently
 	g := new(errgroup.Group)
 	g.Go(func() error {
 		startErr = lucky.Start()
 		return startErr
 	})
 	g.Go(func() error {
-		setting, checkErr = lucky.CheckGameONE(utils.ToString(req.GameCatID))
+		_, checkErr = lucky.GetPlayableGame(c.Context(), utils.ToString(req.GameCatID))
 		return checkErr
 	})
 	g.Go(func() error {
@@ -1637,23 +2304,31 @@ func PlaceBetSpin(c *fiber.Ctx) error {
 	})
 
 	if err := g.Wait(); err != nil {
+		if errors.Is(err, services.ErrUnknownGame) {
+			return fail(c, 202, 1, "game_not_found")
+		}
 		log.Printf("error initializing or checking game: %v", err)
-		return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+		return failErr(c, 500, 1, err)
 	}
 
-	if setting == nil {
-		return c.Status(202).JSON(models.NewErrorResponse(202, 1, "Game not found"))
+	// Spin games took any stake before stake rules; one without rules still
+	// does, as long as it is positive
+	stakes, err := lucky.StakeRules(utils.ToString(req.GameCatID))
+	if err != nil {
+		return failErr(c, 500, 1, err)
+	}
+	if stakes.Mode != services.StakeFixed || req.Amount <= 0 {
+		if err := stakes.Check(req.Amount); err != nil {
+			return failErr(c, 202, 1, err)
+		}
 	}
 
-	num := user["balance"].(pgtype.Numeric)
-
-	f, _ := num.Float64Value()
-	balance := f.Float64
+	balance := utils.NumericFloat(user["balance"]) + utils.NumericFloat(user["bonus"])
 	amount := utils.ToFloat64(req.Amount)
 
 	if balance >= amount {
 
-		logrus.Infof("rtpLimit : %s", amount)
+		logrus.Infof("rtpLimit : %.2f", amount)
 
 		logrus.Infof("rtpLimit : %s", user)
 
@@ -1669,7 +2344,7 @@ func PlaceBetSpin(c *fiber.Ctx) error {
 
 		if err != nil {
 			log.Printf("Error placing bet: %v", err)
-			return c.Status(500).JSON(models.NewErrorResponse(500, 1, err.Error()))
+			return failErr(c, 500, 1, err)
 		}
 
 		// success
@@ -1679,10 +2354,6 @@ func PlaceBetSpin(c *fiber.Ctx) error {
 			"StatusMessage": result,
 		})
 	} else {
-		return c.Status(202).JSON(models.H{
-			"Status":        202,
-			"StatusCode":    3,
-			"StatusMessage": "insufficient balance",
-		})
+		return fail(c, 202, 3, "insufficient_balance")
 	}
 }
@@ -0,0 +1,511 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/flags"
+	"fiberapp/services"
+	"fiberapp/utils"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestOTPFailureStatus(t *testing.T) {
+	cases := map[error]int{
+		services.ErrOTPInvalid:                           401,
+		services.ErrOTPExpired:                           410,
+		fmt.Errorf("verify: %w", services.ErrOTPExpired): 410,
+		errors.New("connection refused"):                 500,
+	}
+	for err, want := range cases {
+		if got := otpFailureStatus(err); got != want {
+			t.Errorf("otpFailureStatus(%v) = %d, want %d", err, got, want)
+		}
+	}
+
+	ConfigureCompat(config.CompatConfig{LegacyOTPStatus: true})
+	defer ConfigureCompat(config.CompatConfig{})
+	if got := otpFailureStatus(services.ErrOTPExpired); got != 201 {
+		t.Errorf("legacy status = %d, want 201", got)
+	}
+}
+
+func TestResolveIdentityIgnoresQueryMsisdn(t *testing.T) {
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+	app := fiber.New()
+	app.Get("/games", utils.OptionalJWTMiddleware(), func(c *fiber.Ctx) error {
+		return c.SendString(resolveIdentity(c))
+	})
+	identity := func(target, token string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		if token != "" {
+			req.Header.Set("x-access-token", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	if got := identity("/games?msisdn=254712345678", ""); got != "" {
+		t.Errorf("guest with ?msisdn= resolved as %q, want a guest", got)
+	}
+	token, err := utils.SignAccessToken("254700000001", utils.RoleUser, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := identity("/games?msisdn=254712345678", token); got != "254700000001" {
+		t.Errorf("token holder resolved as %q, want the token's subject", got)
+	}
+}
+
+func TestParseChannel(t *testing.T) {
+	cases := map[string]struct {
+		want string
+		ok   bool
+	}{
+		"web":     {"web", true},
+		"ussd":    {"ussd", true},
+		"app":     {"app", true},
+		" USSD ":  {"ussd", true},
+		"":        {"web", true},
+		"sms":     {"sms", false},
+		"web; --": {"web; --", false},
+	}
+	for in, tc := range cases {
+		if got, ok := parseChannel(in); got != tc.want || ok != tc.ok {
+			t.Errorf("parseChannel(%q) = %q, %t; want %q, %t", in, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+// categoryRepo knows the categories of the active games and nothing else
+type categoryRepo struct {
+	*loginRepo
+}
+
+func (r categoryRepo) GetGameCategories(ctx context.Context) ([]string, error) {
+	return []string{"Money Prize", "Car Prize"}, nil
+}
+
+func (r categoryRepo) CheckGames(ctx context.Context, category string, previewAwards int) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{{
+		"id": "1", "name": "PawaBox", "category": "Money Prize", "bet_amount": 20.0, "boxes": "7",
+		"max_win": 3000000.0, "prize_preview": []interface{}{"KES 3M", "KES 1M"},
+	}}, nil
+}
+
+// getGames requests the game list as msisdn, or as a guest when msisdn is ""
+func getGames(t *testing.T, repo categoryRepo, msisdn string) (int, string) {
+	t.Helper()
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/lucky_games", func(c *fiber.Ctx) error {
+		if msisdn != "" {
+			c.Locals("user", jwt.MapClaims{"sub": msisdn})
+		}
+		return c.Next()
+	}, GetGames)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/lucky_games?msisdn=254700000002", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+const gamesGolden = `"Categories":["all","Money Prize","Car Prize"],"Data":[{"bet_amount":20,"boxes":"7","category":"Money Prize","config":` +
+	`{"boxes":7,"stake_mode":"fixed","default_stake":20,"min_stake":20,"max_stake":20,"max_win":3000000,` +
+	`"prize_preview":["KES 3M","KES 1M"],"title":"SHINDA HADI KES 3M CASH PAPO HAPO!"},` +
+	`"id":"1","max_win":3000000,"name":"PawaBox"}]`
+
+func TestGetGamesAuthenticatedGolden(t *testing.T) {
+	repo := categoryRepo{newLoginRepo()}
+	repo.players["254700000001"] = map[string]interface{}{
+		"msisdn": "254700000001", "balance": 150.0, "free_bet": 2.0, "is_free": "YES",
+		"freebet_expiry": time.Now().Add(time.Hour),
+	}
+	status, body := getGames(t, repo, "254700000001")
+	want := `{"Balance":150,` + gamesGolden + `,"FreeBet":true,"Status":200,"StatusCode":0,"StatusMessage":"success",` +
+		`"Title":"SHINDA HADI KES 3M CASH PAPO HAPO! FREE BET 2","token":""}`
+	if status != 200 || body != want {
+		t.Errorf("authenticated games = %d\n%s\nwant\n%s", status, body, want)
+	}
+}
+
+func TestGetGamesAnonymous(t *testing.T) {
+	repo := categoryRepo{newLoginRepo()}
+	repo.players["254700000002"] = map[string]interface{}{"msisdn": "254700000002", "balance": 999.0}
+	// ?msisdn= names no one; a guest gets the games without balance or token
+	status, body := getGames(t, repo, "")
+	want := `{` + gamesGolden + `,"FreeBet":false,"Status":200,"StatusCode":0,"StatusMessage":"success",` +
+		`"Title":"SHINDA HADI KES 3M CASH PAPO HAPO!"}`
+	if status != 200 || body != want {
+		t.Errorf("guest games = %d\n%s\nwant\n%s", status, body, want)
+	}
+	if len(repo.players) != 1 {
+		t.Error("listing the games as a guest created a player")
+	}
+}
+
+func TestGetGamesRejectsUnknownCategory(t *testing.T) {
+	repo := categoryRepo{newLoginRepo()}
+	saved := lucky
+	InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	t.Cleanup(func() { lucky = saved })
+	app := fiber.New()
+	app.Get("/lucky_games", GetGames)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/lucky_games?category=Boat%20Prize", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 400 || !strings.Contains(string(body), "unknown game category") {
+		t.Errorf("unknown category = %d %s, want 400 unknown game category", resp.StatusCode, body)
+	}
+}
+
+func TestPlaceBetPayloads(t *testing.T) {
+	app := fiber.New()
+	app.Post("/bet", func(c *fiber.Ctx) error {
+		c.Locals("user", jwt.MapClaims{"sub": "254700000001", "role": c.Get("X-Role")})
+		return PlaceBetLuckyNumber(c)
+	})
+	post := func(body, role string) (int, string) {
+		req := httptest.NewRequest("POST", "/bet", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Version", "1")
+		req.Header.Set("X-Role", role)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(out)
+	}
+
+	selections := `"selections":[{"box":2,"amount":20},{"box":"5","amount":20}]`
+	cases := []struct {
+		name, body, role, code string
+	}{
+		{"choice with selections", `{"choice":"3",` + selections + `,"channel":"web"}`, "", "bet_payload_conflict"},
+		{"amount with selections", `{"amount":20,` + selections + `,"channel":"web"}`, "", "bet_payload_conflict"},
+		{"demo selections", `{"mode":"demo",` + selections + `,"channel":"web"}`, "", "demo_single_choice"},
+		{"demo role selections", `{` + selections + `,"channel":"web"}`, "demo", "demo_single_choice"},
+	}
+	for _, tc := range cases {
+		status, body := post(tc.body, tc.role)
+		if status != 202 || !strings.Contains(body, tc.code) {
+			t.Errorf("%s = %d %s, want 202 %s", tc.name, status, body, tc.code)
+		}
+	}
+
+	// The single-choice payload decodes as before, with no selections
+	var req PlaceBetRequest
+	if err := json.Unmarshal([]byte(`{"amount":20,"choice":"3","game_cat_id":"1","channel":"web"}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Amount != 20 || req.Choice != "3" || req.Selections != nil {
+		t.Errorf("single choice decoded as %+v", req)
+	}
+	if err := json.Unmarshal([]byte(`{`+selections+`}`), &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Selections) != 2 || req.Selections[0].Box != "2" || req.Selections[1].Box != "5" {
+		t.Errorf("selections decoded as %+v, want boxes 2 and 5 from a number and a string", req.Selections)
+	}
+}
+
+func TestFailLocalizesMessage(t *testing.T) {
+	app := fiber.New()
+	app.Get("/fail", func(c *fiber.Ctx) error { return fail(c, 202, 3, "insufficient_balance") })
+	get := func(acceptLanguage string) map[string]interface{} {
+		req := httptest.NewRequest("GET", "/fail", nil)
+		req.Header.Set("Accept-Language", acceptLanguage)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+
+	cases := map[string]string{
+		"sw-KE,en;q=0.5": "Salio halitoshi",
+		"en":             "insufficient balance",
+		"fr":             "insufficient balance",
+		"":               "insufficient balance",
+	}
+	for header, want := range cases {
+		body := get(header)
+		if body["MessageCode"] != "insufficient_balance" || body["StatusMessage"] != want {
+			t.Errorf("Accept-Language %q = %v, want insufficient_balance %q", header, body, want)
+		}
+	}
+}
+
+func TestDepositRefusalMessage(t *testing.T) {
+	cases := []struct {
+		err  *services.DepositError
+		want string
+	}{
+		{&services.DepositError{Code: "deposit_below_min", Limit: 10.0}, "Minimum deposit is KES 10."},
+		{&services.DepositError{Code: "deposit_above_max", Limit: 150000.0}, "Maximum deposit is KES 150000."},
+		{&services.DepositError{Code: "deposit_not_whole"}, "Deposit must be a whole number of shillings."},
+	}
+	for _, tc := range cases {
+		app := fiber.New()
+		app.Get("/deposit", func(c *fiber.Ctx) error { return failErr(c, 202, 1, fmt.Errorf("deposit: %w", tc.err)) })
+		resp, err := app.Test(httptest.NewRequest("GET", "/deposit", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 202 || body["MessageCode"] != tc.err.Code || body["StatusMessage"] != tc.want {
+			t.Errorf("%s = %d %v, want 202 %q", tc.err.Code, resp.StatusCode, body, tc.want)
+		}
+	}
+}
+
+func TestBetThrottledAnswer(t *testing.T) {
+	app := fiber.New()
+	app.Get("/bet", func(c *fiber.Ctx) error {
+		return betThrottled(c, &services.BetThrottleError{Reason: services.ThrottleRate, Wait: 1500 * time.Millisecond})
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/bet", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 429 || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("answer = %d, Retry-After %q, want 429 and 2s", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if body["StatusCode"] != 6.0 || body["MessageCode"] != "bet_rate_limit" || body["RetryAfterMs"] != 1500.0 || body["StatusMessage"] == "" {
+		t.Errorf("body = %v, want bet_rate_limit with the wait", body)
+	}
+}
+
+func TestDebugTimingAdminsOnly(t *testing.T) {
+	timing := &services.TimingBreakdown{SettingsFetchMs: 1.5, TotalMs: 4}
+	app := fiber.New()
+	app.Get("/bet", func(c *fiber.Ctx) error {
+		if role := c.Query("role"); role != "" {
+			c.Locals("user", jwt.MapClaims{"msisdn": "254712345678", "role": role})
+		}
+		return c.JSON(PlaceBetResponse{Status: 200, Timing: debugTiming(c, timing)})
+	})
+	body := func(role string, header bool) string {
+		req := httptest.NewRequest("GET", "/bet?role="+role, nil)
+		if header {
+			req.Header.Set("X-Debug-Timing", "1")
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(resp.Body)
+		return string(raw)
+	}
+
+	if got := body(utils.RoleAdmin, true); !strings.Contains(got, `"Timing":{`) || !strings.Contains(got, `"settings_fetch_ms":1.5`) {
+		t.Errorf("admin with X-Debug-Timing = %s, want the timing block", got)
+	}
+	for _, tc := range []struct {
+		role   string
+		header bool
+	}{{utils.RoleAdmin, false}, {utils.RoleUser, true}, {"", true}} {
+		if got := body(tc.role, tc.header); strings.Contains(got, "Timing") {
+			t.Errorf("role %q, header %v = %s, want no timing block", tc.role, tc.header, got)
+		}
+	}
+}
+
+func TestBetResultAPIVersions(t *testing.T) {
+	app := fiber.New()
+	app.Get("/bet", func(c *fiber.Ctx) error {
+		if _, ok := apiVersion(c); !ok {
+			return fail(c, 400, 1, "unsupported_api_version")
+		}
+		return sendBetResult(c, PlaceBetResponse{Status: 200, GameResults: services.PlaceBetResultDisplay{
+			Boxes: map[string]services.WinAmount{
+				"1": {Value: 1234.5, Item: "1,234.50"},
+				"2": {Value: 25000, Item: "Smart TV", Kind: services.BoxAward},
+			},
+		}})
+	})
+	get := func(version string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("GET", "/bet", nil)
+		if version != "" {
+			req.Header.Set("X-API-Version", version)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	boxes := func(body map[string]interface{}) string {
+		raw, _ := json.Marshal(body["GameResults"].(map[string]interface{})["Boxes"])
+		return string(raw)
+	}
+
+	for _, version := range []string{"", "1"} {
+		code, body := get(version)
+		if want := `{"1":{"Item":"1,234.50","Value":1234.5},"2":{"Item":"Smart TV","Value":25000}}`; code != 200 || boxes(body) != want {
+			t.Errorf("version %q = %d %s, want 200 %s", version, code, boxes(body), want)
+		}
+	}
+	code, body := get("2")
+	if want := `{"1":{"display":"1,234.50","kind":"cash","value":1234.5},"2":{"award_name":"Smart TV","display":"25,000.00","kind":"award","value":25000}}`; code != 200 || boxes(body) != want {
+		t.Errorf("version 2 = %d %s, want 200 %s", code, boxes(body), want)
+	}
+	if body["Status"] != 200.0 {
+		t.Errorf("version 2 = %v, want the version 1 fields alongside", body)
+	}
+	if code, body := get("3"); code != 400 || !strings.Contains(fmt.Sprint(body), "unsupported_api_version") {
+		t.Errorf("version 3 = %d %v, want 400 unsupported_api_version", code, body)
+	}
+}
+
+func TestResponseV2Flag(t *testing.T) {
+	flags.Configure(func(ctx context.Context, name string) (flags.Flag, error) {
+		return flags.Flag{Name: name, Enabled: name == flags.ResponseV2, Allowlist: []string{"254700000001"}}, nil
+	})
+	t.Cleanup(func() { flags.Configure(nil) })
+	app := fiber.New()
+	app.Get("/version", func(c *fiber.Ctx) error {
+		if msisdn := c.Query("msisdn"); msisdn != "" {
+			c.Locals("user", jwt.MapClaims{"sub": msisdn})
+		}
+		c.SetUserContext(flags.WithDecisions(c.UserContext()))
+		version, _ := apiVersion(c)
+		return c.SendString(fmt.Sprintf("%d %s", version, flags.Decisions(c.UserContext())))
+	})
+
+	for _, tc := range []struct{ msisdn, header, want string }{
+		{"254700000001", "", "2 response_v2=on"},
+		{"254700000001", "1", "1 "},
+		{"254700000002", "", "1 response_v2=off"},
+		{"", "", "1 "},
+	} {
+		req := httptest.NewRequest("GET", "/version?msisdn="+tc.msisdn, nil)
+		if tc.header != "" {
+			req.Header.Set("X-API-Version", tc.header)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != tc.want {
+			t.Errorf("%q with X-API-Version %q = %q, want %q", tc.msisdn, tc.header, body, tc.want)
+		}
+	}
+}
+
+func TestPlaceBetRefusesUnknownAPIVersion(t *testing.T) {
+	app := fiber.New()
+	app.Post("/bet", func(c *fiber.Ctx) error {
+		c.Locals("user", jwt.MapClaims{"sub": "254700000001"})
+		return PlaceBetLuckyNumber(c)
+	})
+	req := httptest.NewRequest("POST", "/bet", strings.NewReader(`{"amount":20,"choice":"3","channel":"web"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Version", "3")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 400 || !strings.Contains(string(body), "unsupported_api_version") {
+		t.Errorf("X-API-Version 3 = %d %s, want 400 unsupported_api_version", resp.StatusCode, body)
+	}
+}
+
+func TestCallbackIPAllowlist(t *testing.T) {
+	ConfigureCallbacks(config.CallbacksConfig{AllowedIPs: []string{"172.16.0.131"}})
+	defer ConfigureCallbacks(config.CallbacksConfig{})
+
+	// app.Test connections come from 0.0.0.0
+	check := func(cfg fiber.Config, header, value string) bool {
+		t.Helper()
+		app := fiber.New(cfg)
+		app.Post("/check", func(c *fiber.Ctx) error {
+			return c.SendString(fmt.Sprint(callbackIPAllowed(c)))
+		})
+		req := httptest.NewRequest("POST", "/check", nil)
+		req.Header.Set(header, value)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body) == "true"
+	}
+	proxied := func(trusted string) fiber.Config {
+		return fiber.Config{ProxyHeader: "X-Real-IP", EnableTrustedProxyCheck: true,
+			TrustedProxies: []string{trusted}, EnableIPValidation: true}
+	}
+
+	if check(fiber.Config{}, "X-Forwarded-For", "172.16.0.131") {
+		t.Error("a client-sent X-Forwarded-For was trusted without a proxy")
+	}
+	if check(proxied("10.0.0.1"), "X-Real-IP", "172.16.0.131") {
+		t.Error("the proxy header was trusted from a host that is not a trusted proxy")
+	}
+	if !check(proxied("0.0.0.0"), "X-Real-IP", "172.16.0.131") {
+		t.Error("an allowed gateway behind a trusted proxy was refused")
+	}
+	if check(proxied("0.0.0.0"), "X-Real-IP", "10.9.9.9") {
+		t.Error("a host outside the allowlist behind a trusted proxy was accepted")
+	}
+	if check(proxied("0.0.0.0"), "X-Forwarded-For", "172.16.0.131") {
+		t.Error("a header other than proxy_header was trusted")
+	}
+
+	app := fiber.New()
+	app.Post("/settle_bt", SettleBTLuckyNumber)
+	app.Post("/settle_withdrawal", SettleWithdrawalLuckyNumber)
+	app.Post("/settle_withdrawal_b2b", SettleWithdrawalB2BLuckyNumber)
+	for _, path := range []string{"/settle_bt", "/settle_withdrawal", "/settle_withdrawal_b2b"} {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "172.16.0.131")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 403 {
+			t.Errorf("%s from an unlisted host = %d, want 403", path, resp.StatusCode)
+		}
+	}
+}
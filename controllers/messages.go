@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"errors"
+	"fiberapp/database"
+	"fiberapp/i18n"
+	"fiberapp/models"
+	"fiberapp/money"
+	"fiberapp/services"
+	"fiberapp/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+// errorCodes maps the errors handlers pass to failErr to their message
+// codes in the i18n catalog
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{services.ErrOTPInvalid, "otp_invalid"},
+	{services.ErrOTPExpired, "otp_expired"},
+	{services.ErrOTPNotFound, "otp_not_found"},
+	{services.ErrOTPResendLimit, "otp_resend_limit"},
+	{services.ErrOTPResendTooSoon, "otp_resend_too_soon"},
+	{services.ErrOTPDeliveryDelayed, "otp_delivery_delayed"},
+	{services.ErrAccountInactive, "account_inactive"},
+	{services.ErrAccountSelfExcluded, "account_self_excluded"},
+	{services.ErrDeviceRequired, "device_required"},
+	{services.ErrInvalidAmount, "invalid_amount"},
+	{services.ErrDepositNotFound, "deposit_not_found"},
+	{services.ErrDepositNotPending, "deposit_not_pending"},
+	{services.ErrSTKRetryExpired, "stk_retry_expired"},
+	{services.ErrSTKRetryLimit, "stk_retry_limit"},
+	{services.ErrSTKRetryTooSoon, "stk_retry_too_soon"},
+	{services.ErrBetNotFound, "bet_not_found"},
+	{services.ErrUnknownCategory, "unknown_category"},
+	{services.ErrInvalidSelection, "invalid_selection"},
+	{services.ErrInvalidProfile, "invalid_profile"},
+	{services.ErrProfileNotFound, "player_not_found"},
+	{services.ErrTransferToSelf, "transfer_to_self"},
+	{services.ErrTransferAmount, "transfer_amount"},
+	{services.ErrWithdrawalAmount, "withdrawal_amount"},
+	{services.ErrServerBusy, "server_busy"},
+	{services.ErrUnknownGame, "game_not_found"},
+	{services.ErrMsisdnContested, "msisdn_contested"},
+	{services.ErrUnknownCampaign, "unknown_campaign"},
+	{services.ErrSessionNotFound, "session_not_found"},
+	{errInvalidLuckyNumber, "invalid_lucky_number"},
+	{database.ErrTransferSender, "transfer_sender"},
+	{database.ErrTransferRecipient, "transfer_recipient"},
+	{database.ErrTransferLimit, "transfer_limit"},
+	{database.ErrWithdrawalPlayer, "withdrawal_player"},
+	{database.ErrWithdrawalVelocity, "withdrawal_limit"},
+	{database.ErrInsufficientBalance, "insufficient_balance"},
+	{database.ErrRefreshTokenInvalid, "refresh_token_invalid"},
+	{database.ErrMsisdnTaken, "msisdn_taken"},
+	{database.ErrMsisdnChangeExpired, "msisdn_change_expired"},
+	{database.ErrSessionLimit, "session_limit"},
+	{utils.ErrInvalidMsisdn, "invalid_msisdn"},
+	{utils.ErrInvalidDate, "invalid_date"},
+	{utils.ErrIncompleteRange, "incomplete_date_range"},
+	{utils.ErrReversedDateRange, "reversed_date_range"},
+	{utils.ErrDateRangeTooLong, "date_range_too_long"},
+}
+
+// messageLanguage returns the language for c's StatusMessage: the first
+// supported Accept-Language, else the caller's stored language, else
+// i18n.DefaultLanguage
+func messageLanguage(c *fiber.Ctx) string {
+	if lang, ok := c.Locals("lang").(string); ok {
+		return lang
+	}
+	lang := i18n.Negotiate(c.Get(fiber.HeaderAcceptLanguage))
+	if lang == "" {
+		if claims, ok := c.Locals("user").(jwt.MapClaims); ok {
+			if msisdn, _ := claims["sub"].(string); msisdn != "" {
+				if stored := lucky.PlayerLanguage(msisdn); i18n.Supported(stored) {
+					lang = stored
+				}
+			}
+		}
+	}
+	if lang == "" {
+		lang = i18n.DefaultLanguage
+	}
+	c.Locals("lang", lang)
+	return lang
+}
+
+// message returns the text of code in c's language
+func message(c *fiber.Ctx, code string, args ...interface{}) string {
+	return i18n.T(messageLanguage(c), code, args...)
+}
+
+// fail answers with the catalogued message code
+func fail(c *fiber.Ctx, status, statusCode int, code string, args ...interface{}) error {
+	return c.Status(status).JSON(models.NewErrorResponseCode(messageLanguage(c), status, statusCode, code, args...))
+}
+
+// failErr answers with the message code of err. Details a service added
+// after the error's own text stay in English. An unknown error is sent as
+// is, or as internal_error and logged when status is 5xx. A paused bet or
+// deposit, or one refused a play slot, always gets 503. A refused stake or
+// amount names the limit it crossed. A bet placed too fast gets 429.
+func failErr(c *fiber.Ctx, status, statusCode int, err error) error {
+	var paused *services.MaintenanceError
+	if errors.As(err, &paused) {
+		return pausedForMaintenance(c, paused)
+	}
+	var throttled *services.BetThrottleError
+	if errors.As(err, &throttled) {
+		return betThrottled(c, throttled)
+	}
+	var stake *services.StakeError
+	if errors.As(err, &stake) {
+		if stake.Limit == nil {
+			return fail(c, status, statusCode, stake.Code)
+		}
+		return fail(c, status, statusCode, stake.Code, stake.Limit)
+	}
+	var deposit *services.DepositError
+	if errors.As(err, &deposit) {
+		if deposit.Limit == nil {
+			return fail(c, status, statusCode, deposit.Code)
+		}
+		return fail(c, status, statusCode, deposit.Code, deposit.Limit)
+	}
+	var amount *money.Error
+	if errors.As(err, &amount) {
+		if amount.Limit == nil {
+			return fail(c, status, statusCode, amount.Code)
+		}
+		return fail(c, status, statusCode, amount.Code, amount.Limit)
+	}
+	if errors.Is(err, services.ErrServerBusy) {
+		c.Set(fiber.HeaderRetryAfter, "5")
+		status = fiber.StatusServiceUnavailable
+	}
+	code, detail := errorCode(err)
+	if code == "" {
+		if status < 500 {
+			return c.Status(status).JSON(models.H{
+				"Status":        status,
+				"StatusCode":    statusCode,
+				"MessageCode":   "error",
+				"StatusMessage": err.Error(),
+			})
+		}
+		logrus.Errorf("%s %s: %v", c.Method(), c.Path(), err)
+		code = "internal_error"
+	}
+	resp := models.NewErrorResponseCode(messageLanguage(c), status, statusCode, code)
+	if detail != "" {
+		resp["StatusMessage"] = resp["StatusMessage"].(string) + ": " + detail
+	}
+	return c.Status(status).JSON(resp)
+}
+
+// pausedForMaintenance answers a bet or deposit an admin has paused with
+// StatusCode 5 and the admin's message, or the catalogued one when none
+// was set
+func pausedForMaintenance(c *fiber.Ctx, paused *services.MaintenanceError) error {
+	code := "betting_paused"
+	if paused.Deposits {
+		code = "deposits_paused"
+	}
+	resp := models.NewErrorResponseCode(messageLanguage(c), fiber.StatusServiceUnavailable, 5, code)
+	if paused.Message != "" {
+		resp["StatusMessage"] = paused.Message
+	}
+	c.Set(fiber.HeaderRetryAfter, "60")
+	return c.Status(fiber.StatusServiceUnavailable).JSON(resp)
+}
+
+// betThrottled answers a bet placed faster than the settings allow with 429,
+// StatusCode 6 and the wait: Retry-After in whole seconds and RetryAfterMs
+func betThrottled(c *fiber.Ctx, throttled *services.BetThrottleError) error {
+	resp := models.NewErrorResponseCode(messageLanguage(c), fiber.StatusTooManyRequests, 6, throttled.Code())
+	resp["RetryAfterMs"] = throttled.Wait.Milliseconds()
+	c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(throttled.RetrySeconds(), 10))
+	return c.Status(fiber.StatusTooManyRequests).JSON(resp)
+}
+
+// otpFailed answers a failed OTP check with the status otpFailureStatus
+// picks
+func otpFailed(c *fiber.Ctx, err error) error {
+	code, _ := errorCode(err)
+	if code == "" {
+		code = "internal_error"
+	}
+	return c.Status(otpFailureStatus(err)).JSON(models.H{
+		"Status":        false,
+		"StatusCode":    2,
+		"MessageCode":   code,
+		"StatusMessage": message(c, code),
+	})
+}
+
+// errorCode returns the message code of err and whatever err says beyond
+// the matched error's own text, or "" when err is not catalogued
+func errorCode(err error) (string, string) {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			detail, _ := strings.CutPrefix(err.Error(), e.err.Error()+": ")
+			if detail == err.Error() {
+				detail = ""
+			}
+			return e.code, detail
+		}
+	}
+	return "", ""
+}
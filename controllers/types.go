@@ -0,0 +1,272 @@
+package controllers
+
+import (
+	"fiberapp/models"
+	"fiberapp/services"
+	"time"
+)
+
+// Request bodies. Fields a client may send as a string or a number use
+// models.FlexString. routes/openapi.go documents the API from these types,
+// so a field added here shows up in /api/v1/openapi.json.
+
+// LoginRequest is the body of /login and /register
+type LoginRequest struct {
+	Msisdn    models.FlexString `json:"msisdn" example:"254712345678"`
+	Name      models.FlexString `json:"name" example:"Jane"`
+	Promocode models.FlexString `json:"promocode"`
+}
+
+// VerifyOTPRequest is the body of /verify_otp. A device_id also returns a
+// refresh token.
+type VerifyOTPRequest struct {
+	Msisdn   models.FlexString `json:"msisdn" example:"254712345678"`
+	OTP      models.FlexString `json:"otp" example:"1234"`
+	DeviceID models.FlexString `json:"device_id"`
+}
+
+// ResendOTPRequest is the body of /resend_otp
+type ResendOTPRequest struct {
+	Msisdn models.FlexString `json:"msisdn" example:"254712345678"`
+}
+
+// RetrySTKRequest is the body of /retry_stk
+type RetrySTKRequest struct {
+	Reference models.FlexString `json:"reference"`
+}
+
+// OTPRequest confirms an action on the caller's account with an OTP
+type OTPRequest struct {
+	OTP models.FlexString `json:"otp" example:"1234"`
+}
+
+type PromoRequest struct {
+	Promocode models.FlexString `json:"promocode"`
+}
+
+type SelfExclusionRequest struct {
+	SelfExclusionPeriod models.FlexString `json:"self_exclusion_period" example:"24 Hours"`
+}
+
+type UpdateUserRequest struct {
+	Name models.FlexString `json:"name"`
+}
+
+// ChangeMsisdnRequest is the body of PUT /user/msisdn
+type ChangeMsisdnRequest struct {
+	Msisdn models.FlexString `json:"msisdn" example:"254712345678"`
+}
+
+// ProfileRequest is the body of PUT /profile. Fields left out keep their
+// current value.
+type ProfileRequest struct {
+	Name             *string `json:"name" example:"Jane Wanjiru"`
+	Language         *string `json:"language" example:"sw"`
+	SMSNotifications *bool   `json:"sms_notifications"`
+	ShowWin          *bool   `json:"show_win"`
+}
+
+// ShowWinRequest toggles whether the caller's wins appear in the winners feed
+type ShowWinRequest struct {
+	ShowWin interface{} `json:"show_win"` // string or boolean
+}
+
+// HistoryRequest filters the history and wallet listings. Both dates or
+// neither must be sent.
+type HistoryRequest struct {
+	StartDate string `json:"StartDate" example:"2025-01-01"`
+	EndDate   string `json:"EndDate" example:"2025-01-31"`
+}
+
+type GameHistoryRequest struct {
+	StartDate  string `json:"StartDate" example:"2025-01-01"`
+	EndDate    string `json:"EndDate" example:"2025-01-31"`
+	PageSize   any    `json:"PageSize"`
+	PageNumber any    `json:"PageNumber"`
+}
+
+type TransferRequest struct {
+	RecipientMsisdn string  `json:"recipient_msisdn" example:"254712345678"`
+	Amount          float64 `json:"amount" example:"100"`
+	OTP             string  `json:"otp"`
+}
+
+type WithdrawRequest struct {
+	Amount float64 `json:"amount" example:"500"`
+	OTP    string  `json:"otp"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+	DeviceID     string `json:"device_id"`
+}
+
+// LogoutRequest revokes refresh tokens on one device, or on all when empty
+type LogoutRequest struct {
+	DeviceID string `json:"device_id"`
+}
+
+type SaveTemplateRequest struct {
+	Body   string `json:"body"`
+	Active *bool  `json:"active"`
+}
+
+type SaveShortcodeRequest struct {
+	Label    string `json:"label" example:"Radio Jambo"`
+	Campaign string `json:"campaign" example:"jambo"`
+	Channel  string `json:"channel" example:"ussd"`
+	Default  bool   `json:"default"`
+	Active   *bool  `json:"active"`
+}
+
+type GrantBonusRequest struct {
+	Amount        float64 `json:"amount" example:"50"`
+	ValidityHours int     `json:"validity_hours" example:"72"`
+	Reference     string  `json:"reference"`
+}
+
+// TopUpBasketRequest is the body of POST /admin/basket/topup
+type TopUpBasketRequest struct {
+	Amount float64 `json:"amount" example:"50000"`
+	Note   string  `json:"note" example:"weekly float"`
+}
+
+// MaintenanceRequest is the body of PUT /admin/maintenance. Switches left
+// out keep their current value; message replaces the stored one.
+type MaintenanceRequest struct {
+	Scope           string            `json:"scope" example:"game"`
+	GameCatID       models.FlexString `json:"game_cat_id" example:"1"`
+	BettingEnabled  *bool             `json:"betting_enabled"`
+	DepositsEnabled *bool             `json:"deposits_enabled"`
+	Message         string            `json:"message" example:"Lucky Box is paused for a few minutes"`
+}
+
+// FeatureFlagRequest is the body of PUT /admin/flags/:name. Fields left
+// out keep their current value; an allowlist replaces the stored one.
+type FeatureFlagRequest struct {
+	Enabled    *bool    `json:"enabled"`
+	Percentage *int     `json:"percentage" example:"5"`
+	Allowlist  []string `json:"allowlist" example:"254700000000"`
+}
+
+// TaxRateRequest is the body of POST /admin/tax_rates and PUT
+// /admin/tax_rates/:id, which keeps the stored tax_type. rate is a
+// percentage; effective_from is RFC 3339 and must be in the future.
+type TaxRateRequest struct {
+	TaxType       string     `json:"tax_type" example:"excise"`
+	Rate          *float64   `json:"rate" example:"12.5"`
+	EffectiveFrom *time.Time `json:"effective_from" example:"2027-07-01T00:00:00+03:00"`
+}
+
+// WelcomeGrantRequest is the body of PUT /admin/welcome_grant. Fields left
+// out keep their current value.
+type WelcomeGrantRequest struct {
+	Enabled    *bool `json:"enabled"`
+	FreeBets   *int  `json:"free_bets" example:"3"`
+	ValidHours *int  `json:"valid_hours" example:"72"`
+}
+
+// Responses. Every response carries the Status/StatusCode/StatusMessage
+// envelope; errors carry only that (models.BaseResponse). Catalogued
+// messages also carry their i18n code as MessageCode, with StatusMessage
+// in the caller's language.
+
+type PlaceBetResponse struct {
+	Status        int                            `json:"Status" example:"200"`
+	StatusCode    int                            `json:"StatusCode" example:"0"`
+	StatusMessage string                         `json:"StatusMessage"`
+	FreeBet       string                         `json:"FreeBet"`
+	GameResults   services.PlaceBetResultDisplay `json:"GameResults"`
+	Demo          bool                           `json:"Demo,omitempty"`
+	DemoBalance   *float64                       `json:"DemoBalance,omitempty"`
+	Timing        *services.TimingBreakdown      `json:"Timing,omitempty"` // admins sending X-Debug-Timing only
+}
+
+// PlaceBetResponseV2 is PlaceBetResponse for X-API-Version 2: each box is
+// {value, display, kind, award_name}
+type PlaceBetResponseV2 struct {
+	PlaceBetResponse
+	GameResults services.GameResultV2 `json:"GameResults"`
+}
+
+// PlaceBetPendingResponse answers a bet on a game with a reveal delay. The
+// outcome is at GET /bet/:reference, and comes as the socket bet_result
+// event, from Pending.RevealAt.
+type PlaceBetPendingResponse struct {
+	Status        int                       `json:"Status" example:"200"`
+	StatusCode    int                       `json:"StatusCode" example:"0"`
+	StatusMessage string                    `json:"StatusMessage"`
+	FreeBet       string                    `json:"FreeBet"`
+	Pending       services.BetReveal        `json:"Pending"`
+	Timing        *services.TimingBreakdown `json:"Timing,omitempty"` // admins sending X-Debug-Timing only
+}
+
+// PlaceParcelResponse answers a bet placed with selections
+type PlaceParcelResponse struct {
+	Status        int                   `json:"Status" example:"200"`
+	StatusCode    int                   `json:"StatusCode" example:"0"`
+	StatusMessage string                `json:"StatusMessage"`
+	FreeBet       string                `json:"FreeBet"`
+	ParcelResults services.ParcelResult `json:"ParcelResults"`
+}
+
+// PlaceParcelResponseV2 is PlaceParcelResponse for X-API-Version 2
+type PlaceParcelResponseV2 struct {
+	PlaceParcelResponse
+	ParcelResults services.ParcelResultV2 `json:"ParcelResults"`
+}
+
+// GamesResponse lists the games of a category. Balance and token are only
+// set for an authenticated caller; token is always empty and kept for
+// clients that read it. Fields are in the key order the response had as a
+// map.
+type GamesResponse struct {
+	Balance       *float64    `json:"Balance,omitempty" example:"150"`
+	Categories    []string    `json:"Categories"`
+	Data          interface{} `json:"Data"`
+	FreeBet       bool        `json:"FreeBet"`
+	Status        int         `json:"Status" example:"200"`
+	StatusCode    int         `json:"StatusCode" example:"0"`
+	StatusMessage string      `json:"StatusMessage" example:"success"`
+	Title         string      `json:"Title" example:"SHINDA HADI KES 3M CASH PAPO HAPO!"`
+	Token         *string     `json:"token,omitempty"`
+}
+
+// LoginResponse gives ExpireIn in Units; ResendAllowedAfter is always in
+// seconds
+type LoginResponse struct {
+	Status             int    `json:"Status" example:"200"`
+	StatusCode         int    `json:"StatusCode" example:"0"`
+	Units              string `json:"Units" example:"Minutes"`
+	ExpireIn           int    `json:"ExpireIn" example:"2"`
+	ResendAllowedAfter int64  `json:"ResendAllowedAfter" example:"30"`
+	ResendsLeft        int    `json:"ResendsLeft" example:"3"` // asking again while the code is valid resends it
+	MessageCode        string `json:"MessageCode" example:"otp_sent_if_eligible"`
+	StatusMessage      string `json:"StatusMessage" example:"OTP sent if the account is eligible"`
+}
+
+type ResendOTPResponse struct {
+	Status             int    `json:"Status" example:"200"`
+	StatusCode         int    `json:"StatusCode" example:"0"`
+	Units              string `json:"Units" example:"Seconds"`
+	ExpireIn           int64  `json:"ExpireIn,omitempty" example:"120"`
+	ResendAllowedAfter int64  `json:"ResendAllowedAfter" example:"30"`
+	ResendsLeft        int    `json:"ResendsLeft" example:"2"`
+	MessageCode        string `json:"MessageCode" example:"otp_resent"`
+	StatusMessage      string `json:"StatusMessage" example:"OTP resent"`
+}
+
+type TokenResponse struct {
+	Status             int                     `json:"Status" example:"200"`
+	StatusCode         int                     `json:"StatusCode" example:"0"`
+	StatusMessage      string                  `json:"StatusMessage" example:"Success"`
+	ExpireIn           int64                   `json:"ExpireIn,omitempty"`
+	Token              string                  `json:"Token"`
+	TokenExpiry        int64                   `json:"TokenExpiry"`
+	Units              string                  `json:"Units" example:"Seconds"`
+	RefreshToken       string                  `json:"RefreshToken,omitempty"`
+	RefreshTokenExpiry int64                   `json:"RefreshTokenExpiry,omitempty"`
+	Data               map[string]interface{}  `json:"Data,omitempty"`
+	Stats              *services.LifetimeStats `json:"Stats,omitempty"`                       // left out when they could not be read
+	WelcomeFreeBets    int                     `json:"WelcomeFreeBets,omitempty" example:"3"` // free bets granted to a brand-new player by this login
+}
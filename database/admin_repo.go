@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// AdminRepo holds the read-only reporting queries behind the admin dashboard
+type AdminRepo interface {
+	GetPlayerStats(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	ListPlayerStats(ctx context.Context, sort string, minBets int64, limit, offset int) ([]map[string]interface{}, int64, error)
+	StreamPlayerStats(ctx context.Context, sort string, minBets int64, fn func(row map[string]interface{}) error) error
+	GetDailyKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error)
+	GetChannelKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error)
+	ListGameDailyExposure(ctx context.Context) ([]map[string]interface{}, error)
+	FindDuplicatePlayers(ctx context.Context) ([]map[string]interface{}, error)
+	GetSettlementLag(ctx context.Context, depositAge, withdrawalAge, betAge, callbackAge time.Duration) ([]map[string]interface{}, error)
+}
+
+var _ AdminRepo = (*Database)(nil)
@@ -0,0 +1,11 @@
+package database
+
+import "context"
+
+// AuditRepo finds stored values that fall outside a vocabulary of package
+// status, so historical data can be fixed
+type AuditRepo interface {
+	AuditStatuses(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+var _ AuditRepo = (*Database)(nil)
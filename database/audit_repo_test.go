@@ -0,0 +1,65 @@
+package database
+
+import (
+	"fiberapp/status"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// sqlLiteral is a single-quoted SQL string inside a Go string
+var sqlLiteral = regexp.MustCompile(`'([^'\n]*)'`)
+
+// TestNoStatusLiteralsInSQL keeps status values out of the SQL text: a
+// query compares against a constant of package status bound as a
+// parameter, so a renamed status cannot leave a query behind
+func TestNoStatusLiteralsInSQL(t *testing.T) {
+	vocabulary := map[string]bool{}
+	for _, vs := range [][]string{
+		status.Strings(status.ResultStatuses), {"Lose"},
+		status.Strings(status.BetStatuses),
+		status.Strings(status.B2BStatuses),
+		status.Strings(append(status.DepositStatuses, status.DepositPending)),
+		status.Strings(status.WithdrawalStatuses),
+		status.Strings(status.GatewaySucceeded),
+		status.Strings(status.CallbackStatuses),
+		status.Strings(status.WebhookStatuses),
+		status.Strings(status.SMSStatuses),
+		status.Strings(status.ExclusionStatuses),
+	} {
+		for _, v := range vs {
+			vocabulary[v] = true
+		}
+	}
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			lit, ok := n.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			for _, m := range sqlLiteral.FindAllStringSubmatch(lit.Value, -1) {
+				if vocabulary[m[1]] {
+					t.Errorf("%s: status '%s' in SQL; bind the status constant as a parameter", fset.Position(lit.Pos()), m[1])
+				}
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package database
+
+import "context"
+
+// AviatorRepo covers the "Aviator" schema and aviator withdrawal queue.
+//
+// None of these methods are called by cmd/main.go or cmdsocket; they are kept
+// behind this interface so the lucky service no longer sees them and can be
+// removed once no other deployment depends on them.
+type AviatorRepo interface {
+	UpdateHouseAviatorHouse(ctx context.Context, mvalue float64) (int64, error)
+	UpdateCustomerAviator(ctx context.Context, fieldName string, mvalue interface{}, id int64) (int64, error)
+	UpdateCustomerAviatorBets(ctx context.Context, mvalue float64, id int64) (int64, error)
+	UpdateCustomerAviatorWins(ctx context.Context, mvalue float64, id int64) (int64, error)
+	UpdateCustomerAviatorLosses(ctx context.Context, mvalue float64, id int64) (int64, error)
+	UpdateCustomerWallet(ctx context.Context, id int64, mvalue float64) (int64, error)
+	UpdateCustomerWallet2(ctx context.Context, msisdn string, mvalue float64) (int64, error)
+	InsertCustomerLogsAviator(ctx context.Context, amount float64, logType string, customerID int64, narrative string) (int64, error)
+	InsertCustomerLogsAviatorGame(ctx context.Context, gameID int64, amount float64, logType string, customerID int64, narrative string) (int64, error)
+	InsertUSSDSession(ctx context.Context, data map[string]string) (int64, error)
+	DisburseWithdrawalAviator(ctx context.Context, amount float64, msisdn, reference string) (int64, error)
+	InsertIntoWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error)
+	InsertIntoDepositRequest(ctx context.Context, amount float64, msisdn, reference string) (int64, error)
+	CheckUSSDSession(ctx context.Context, sessionID string) (map[string]interface{}, error)
+	InsertHouseLogsAviator(ctx context.Context, fieldName, msisdn string, mvalue float64) (int64, error)
+	InsertHouseLogsAviatorGameID(ctx context.Context, gameID int64, fieldName, msisdn string, mvalue float64) (int64, error)
+	CheckUSSDSessionLogs(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	CheckDepositRequests(ctx context.Context, reference string) (map[string]interface{}, error)
+	CheckWithdrawalRequests(ctx context.Context, reference string) (map[string]interface{}, error)
+	InsertAviatorUssdLogs(ctx context.Context, gameID int64, sessionID, msisdn, payload string) (int64, error)
+	InsertAviatorUssdInputLogs(ctx context.Context, sessionCode, sessionID, msisdn, ussdMenu string) (int64, error)
+	UpdateAviatorUssdLogs(ctx context.Context, sessionID, msisdn string, gameID int64, payload string) (int64, error)
+	UpdateAviatorUssdLogsStatus(ctx context.Context, gameID int64, msisdn string) (int64, error)
+}
+
+var _ AviatorRepo = (*Database)(nil)
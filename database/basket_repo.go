@@ -0,0 +1,23 @@
+package database
+
+import "context"
+
+// BasketRelease is a held win paid out after a top-up: Amount left the
+// basket and Payout, the net amount, was queued for disbursement
+type BasketRelease struct {
+	Reference string
+	Msisdn    string
+	Amount    float64
+	Payout    float64
+}
+
+// BasketRepo holds the audited admin changes to the prize basket and the
+// wins reserved against it
+type BasketRepo interface {
+	TopUpBasket(ctx context.Context, amount float64, admin, note string) (int64, float64, error)
+	ListBasketTopUps(ctx context.Context, limit int) ([]map[string]interface{}, error)
+	HoldBasketPayout(ctx context.Context, reference, msisdn string, amount float64) (bool, error)
+	ReleaseBasketHolds(ctx context.Context) ([]BasketRelease, error)
+}
+
+var _ BasketRepo = (*Database)(nil)
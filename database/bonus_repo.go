@@ -0,0 +1,24 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Stake is one bet's share of a debit
+type Stake struct {
+	Reference string
+	Amount    float64
+}
+
+// BonusRepo holds the bonus wallet: grants, stake funding and conversion
+type BonusRepo interface {
+	GrantBonus(ctx context.Context, msisdn string, amount, wageringRequired float64, expiresAt time.Time, source, reference string) (int64, error)
+	DebitStake(ctx context.Context, msisdn, reference string, amount float64, bonusFirst bool) (float64, float64, error)
+	DebitStakes(ctx context.Context, msisdn string, stakes []Stake, bonusFirst bool) (float64, float64, error)
+	CreditBonusWin(ctx context.Context, reference string, amount float64) (float64, error)
+	ExpireBonusGrants(ctx context.Context, msisdn string) (int64, error)
+	ListBonusGrants(ctx context.Context, msisdn string, activeOnly bool) ([]map[string]interface{}, error)
+}
+
+var _ BonusRepo = (*Database)(nil)
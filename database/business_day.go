@@ -0,0 +1,32 @@
+package database
+
+import (
+	"fiberapp/clock"
+	"strings"
+)
+
+// Date-bucketed queries name the business zone (clock.Zone) explicitly, so
+// the day they bucket by is the same whatever timezone the server or the
+// session runs in. NOW() is absolute, so an age check such as
+// NOW() - make_interval(...) needs none of this.
+
+// zoneLiteral is clock.Zone as an SQL string literal
+func zoneLiteral() string {
+	return "'" + strings.ReplaceAll(clock.Zone(), "'", "''") + "'"
+}
+
+// today is the SQL for the current business day, a date
+func today() string {
+	return "(NOW() AT TIME ZONE " + zoneLiteral() + ")::date"
+}
+
+// startOfToday is the SQL for the timestamptz the current business day
+// started at
+func startOfToday() string {
+	return "(date_trunc('day', NOW() AT TIME ZONE " + zoneLiteral() + ") AT TIME ZONE " + zoneLiteral() + ")"
+}
+
+// dayOf is the SQL for the business day of timestamptz expression col
+func dayOf(col string) string {
+	return "(" + col + " AT TIME ZONE " + zoneLiteral() + ")::date"
+}
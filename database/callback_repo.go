@@ -0,0 +1,20 @@
+package database
+
+import (
+	"context"
+	"fiberapp/status"
+	"time"
+)
+
+// InboundCallbackRepo holds the gateway callbacks stored before they are
+// processed, and their processing queue
+type InboundCallbackRepo interface {
+	InsertInboundCallback(ctx context.Context, source, reference, transactionID string, payload []byte) (int64, bool, error)
+	ClaimInboundCallback(ctx context.Context, id int64, lease time.Duration) (map[string]interface{}, error)
+	ClaimDueInboundCallbacks(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error)
+	RecordInboundCallback(ctx context.Context, id int64, state status.CallbackStatus, nextAttemptAt time.Time, lastError string) error
+	ListInboundCallbacks(ctx context.Context, filter string, limit, offset int) ([]map[string]interface{}, int64, error)
+	RequeueInboundCallback(ctx context.Context, id int64) (status.CallbackStatus, error)
+}
+
+var _ InboundCallbackRepo = (*Database)(nil)
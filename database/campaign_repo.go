@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// CampaignRepo holds the deposit campaigns and their redemptions
+type CampaignRepo interface {
+	ListCampaigns(ctx context.Context, activeOnly bool) ([]map[string]interface{}, error)
+	GetCampaign(ctx context.Context, id int64) (map[string]interface{}, error)
+	CreateCampaign(ctx context.Context, name, rewardType string, minDeposit, rewardAmount float64, rewardHours, maxPerUser int, startDate, endDate time.Time) (int64, error)
+	UpdateCampaign(ctx context.Context, id int64, name, rewardType string, minDeposit, rewardAmount float64, rewardHours, maxPerUser int, startDate, endDate time.Time, status string) (int64, error)
+	DeleteCampaign(ctx context.Context, id int64) (int64, error)
+	RedeemCampaign(ctx context.Context, campaignID int64, msisdn, transactionID, rewardType string, rewardAmount float64, rewardExpiry time.Time, maxPerUser int, bonusWagering float64) (bool, error)
+}
+
+var _ CampaignRepo = (*Database)(nil)
@@ -3,42 +3,53 @@ package database
 import (
 	"context"
 	"errors"
+	"fiberapp/clock"
+	"fiberapp/config"
+	"fiberapp/money"
+	"fiberapp/status"
 	"fiberapp/utils"
 	"fmt"
-	"log"
-	"os"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
+	"golang.org/x/sync/errgroup"
 )
 
 // VerificationCode represents one row from verification
 type VerificationCode struct {
-	ID      int64
-	Msisdn  string
-	Code    string
-	Expired int64 // unix seconds
-	Created int64 // unix seconds
-	Status  int
-}
-
-type Config struct {
-	Production struct {
-		Postgres struct {
-			Connection struct {
-				Host     string `yaml:"host"`
-				User     string `yaml:"username"`
-				Password string `yaml:"password"`
-				DBName   string `yaml:"database"`
-				Port     int    `yaml:"port"`
-			} `yaml:"connection"`
-		} `yaml:"postgres"`
-	} `yaml:"production"`
-}
+	ID          int64
+	Msisdn      string
+	Purpose     string
+	CodeHash    string // auth.HashOTP of the code; empty for a code stored in plaintext
+	Expired     int64  // unix seconds
+	Created     int64  // unix seconds
+	Status      int
+	ResendCount int
+	LastSent    int64 // unix seconds, created until the first resend
+}
+
+// OTPGuess is a code typed for verification, in the forms rows are matched
+// by: its auth.HashOTP hash, and the code itself for rows stored in
+// plaintext before codes were hashed, while they were created at or after
+// PlaintextSince (unix seconds)
+type OTPGuess struct {
+	Hash           string
+	Code           string
+	PlaintextSince int64
+}
+
+// otpGuessMatches matches a verification row against an OTPGuess passed as
+// $3 (hash), $4 (code) and $5 (plaintext since)
+const otpGuessMatches = `(code_hash = $3 OR (code_hash IS NULL AND code = $4 AND created >= $5))`
 
 var (
 	// Global pool instance - renamed from DB to avoid conflict
@@ -50,61 +61,49 @@ var (
 
 // Database struct to hold the connection pool
 type Database struct {
-	pool *pgxpool.Pool
+	pool    *pgxpool.Pool
+	replica *pgxpool.Pool // optional, see ReadDB
+	log     logrus.FieldLogger
 }
 
-// NewDatabase creates a new Database instance using the global pool
-func NewDatabase() *Database {
+// NewDatabase creates a new Database instance using the global pool that
+// logs to log, or the standard logger when nil
+func NewDatabase(log logrus.FieldLogger) *Database {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
 	if globalPool == nil {
 		log.Fatal("Database not initialized. Call ConnectPostgres first.")
 	}
-	return &Database{pool: globalPool}
+	return &Database{pool: globalPool, replica: replicaPool, log: log}
 }
 
 // NewDatabaseWithPool creates a new Database instance with a custom pool
-func NewDatabaseWithPool(pool *pgxpool.Pool) *Database {
-	return &Database{pool: pool}
-}
-
-// Load YAML config
-func loadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		log.Printf(":%s", err)
-		return nil, err
-	}
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		log.Printf("Unmarshal error: %v", err)
-		return nil, err
+func NewDatabaseWithPool(pool *pgxpool.Pool, log logrus.FieldLogger) *Database {
+	if log == nil {
+		log = logrus.StandardLogger()
 	}
-
-	// Log the parsed config to verify
-	// configJSON, _ := json.MarshalIndent(cfg, "", "  ")
-	// log.Printf("Parsed config: %s", string(configJSON))
-
-	return &cfg, nil
+	return &Database{pool: pool, log: log}
 }
 
-// Build DSN
-func dsnFromConfig(cfg *Config) string {
-
-	// log.Println("Raw YAML content:\n%s", cfg)
-	conn := cfg.Production.Postgres.Connection
+// logFor returns the database logger tagged with the request ID from ctx.
+// Phone numbers go through utils.RedactMsisdn; codes, OTPs and row
+// contents are never logged.
+func (db *Database) logFor(ctx context.Context) logrus.FieldLogger {
+	return withRequestID(ctx, db.log)
+}
 
-	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable&pool_max_conns=50&pool_min_conns=5",
-		conn.User, conn.Password, conn.Host, conn.Port, conn.DBName)
+// dsnFromConfig builds the connection string; pool sizing is set on the
+// parsed pgxpool.Config instead of the DSN
+func dsnFromConfig(cfg config.DatabaseConfig) string {
+	return fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		url.QueryEscape(cfg.User), url.QueryEscape(cfg.Password), cfg.Host, cfg.Port, cfg.Name)
 }
 
 // ConnectPostgres initializes the global pool once
-func ConnectPostgres(configPath string) error {
+func ConnectPostgres(cfg config.DatabaseConfig) error {
 	var connErr error
 	dbOnce.Do(func() {
-		cfg, err := loadConfig(configPath)
-		if err != nil {
-			connErr = err
-			return
-		}
 		dsn := dsnFromConfig(cfg)
 
 		ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
@@ -118,8 +117,8 @@ func ConnectPostgres(configPath string) error {
 		}
 
 		// OPTIMIZE CONNECTION POOL SETTINGS
-		poolConfig.MaxConns = 100                  // Default is 4 - too low for web apps!
-		poolConfig.MinConns = 5                    // Keep some connections ready
+		poolConfig.MaxConns = cfg.MaxConns         // Default is 4 - too low for web apps!
+		poolConfig.MinConns = cfg.MinConns         // Keep some connections ready
 		poolConfig.MaxConnLifetime = 1 * time.Hour // Recycle connections periodically
 		poolConfig.MaxConnIdleTime = 30 * time.Minute
 		poolConfig.HealthCheckPeriod = 1 * time.Minute
@@ -127,8 +126,12 @@ func ConnectPostgres(configPath string) error {
 		// Configure connection timeouts
 		poolConfig.ConnConfig.ConnectTimeout = 10 * time.Second
 		poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = "10000" // 10 seconds
+		poolConfig.ConnConfig.RuntimeParams["timezone"] = clock.Zone()     // CURRENT_DATE and ::date in the business zone
+
+		// Log query name, duration and request ID (debug level) for every statement
+		poolConfig.ConnConfig.Tracer = queryTracer{}
 
-		log.Printf("🔄 Initializing database pool with %d max connections", poolConfig.MaxConns)
+		logrus.Infof("🔄 Initializing database pool with %d max connections", poolConfig.MaxConns)
 
 		pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
 		if err != nil {
@@ -147,12 +150,116 @@ func ConnectPostgres(configPath string) error {
 
 		// Log initial pool stats
 		stats := pool.Stat()
-		log.Printf("📊 Initial Pool Stats - Max: %d, Total: %d, Idle: %d",
+		logrus.Infof("📊 Initial Pool Stats - Max: %d, Total: %d, Idle: %d",
 			poolConfig.MaxConns, stats.TotalConns(), stats.IdleConns())
+
+		if cfg.ReplicaEnabled {
+			if err := connectReplica(cfg); err != nil {
+				logrus.Errorf("Read replica disabled: %v", err)
+			}
+		}
 	})
 	return connErr
 }
 
+// The queries every bet runs. They are constants so WarmPool can prepare
+// the exact statements pgx caches for them.
+const (
+	checkUserQuery    = `SELECT * FROM "Player" WHERE msisdn = $1 `
+	checkSettingQuery = `SELECT * FROM "PawaBox_KeSettings" `
+	getGameQuery      = `SELECT id::text, COALESCE(name, ''), COALESCE(name_init, ''), COALESCE(category, ''),
+			COALESCE(status, ''), COALESCE(trim(boxes::text), ''), COALESCE(max_exposure::float8, 0),
+			COALESCE(bet_amount::float8, 0), min_stake::float8, max_stake::float8,
+			COALESCE(allowed_stakes::float8[], '{}'), COALESCE(reveal_delay, 0),
+			COALESCE(daily_exposure_cap::float8, 0), is_jackpot
+		FROM "Games" WHERE id = $1`
+)
+
+// checkSettingKPIQuery reads today's kpi row. It names the business zone,
+// so it is built at run time, the same way each time.
+func checkSettingKPIQuery() string {
+	return `SELECT rtp, payout, bet FROM "kpi" WHERE date = ` + today()
+}
+
+// warmQueries maps config.WarmQueryNames to a statement and arguments that
+// match no row
+func warmQueries() map[string]struct {
+	sql  string
+	args []interface{}
+} {
+	return map[string]struct {
+		sql  string
+		args []interface{}
+	}{
+		"check_user":        {checkUserQuery, []interface{}{""}},
+		"check_setting":     {checkSettingQuery, nil},
+		"get_game":          {getGameQuery, []interface{}{"0"}},
+		"check_setting_kpi": {checkSettingKPIQuery(), nil},
+	}
+}
+
+// WarmPool opens cfg.WarmConns connections (min_conns when 0) at once and
+// runs cfg.WarmQueries on each, so the first requests after a start neither
+// dial nor prepare. The connections are held until all are open, otherwise
+// the pool would hand the same one out again.
+func WarmPool(ctx context.Context, cfg config.DatabaseConfig) error {
+	if globalPool == nil {
+		return errors.New("database not initialized")
+	}
+	n := cfg.WarmConns
+	if n == 0 {
+		n = cfg.MinConns
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.WarmTimeout)
+	defer cancel()
+	start := time.Now()
+
+	conns := make([]*pgxpool.Conn, n)
+	defer func() {
+		for _, conn := range conns {
+			if conn != nil {
+				conn.Release()
+			}
+		}
+	}()
+
+	g, gctx := errgroup.WithContext(ctx)
+	for i := range conns {
+		i := i
+		g.Go(func() error {
+			conn, err := globalPool.Acquire(gctx)
+			if err != nil {
+				return fmt.Errorf("failed to acquire connection: %w", err)
+			}
+			conns[i] = conn
+			for _, name := range cfg.WarmQueries {
+				q, ok := warmQueries()[name]
+				if !ok {
+					return fmt.Errorf("unknown warm query %q", name)
+				}
+				// Query, not Exec: Exec without arguments skips the statement cache
+				rows, err := conn.Query(gctx, q.sql, q.args...)
+				if err != nil {
+					return fmt.Errorf("failed to warm %s: %w", name, err)
+				}
+				rows.Close()
+				if err := rows.Err(); err != nil {
+					return fmt.Errorf("failed to warm %s: %w", name, err)
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	stats := globalPool.Stat()
+	logrus.Infof("🔥 Pool warmed in %s - %d connections, %d queries each, Total: %d",
+		time.Since(start).Round(time.Millisecond), n, len(cfg.WarmQueries), stats.TotalConns())
+	return nil
+}
+
 // GetPool returns the global connection pool
 func GetPool() *pgxpool.Pool {
 	return globalPool
@@ -183,9 +290,10 @@ func Close() {
 	defer dbMux.Unlock()
 
 	if !isClosed && globalPool != nil {
+		closeReplica()
 		globalPool.Close()
 		isClosed = true
-		log.Println("✅ PostgreSQL pool closed")
+		logrus.Info("✅ PostgreSQL pool closed")
 	}
 }
 
@@ -209,8 +317,6 @@ func (db *Database) scanRowsToSingleMap(rows pgx.Rows) (map[string]interface{},
 		result[string(fd.Name)] = values[i]
 	}
 
-	log.Printf("Acquiring connection for : %v", result)
-
 	return result, nil
 }
 
@@ -243,9 +349,10 @@ func (db *Database) scanRowsToMap(rows pgx.Rows) ([]map[string]interface{}, erro
 
 // Database methods implementation...
 
-// CheckUserAttempted checks if user exists in Attempted_Players table
+// CheckUserAttempted returns the pending change to the number msisdn, or
+// nil when no player is changing to it
 func (db *Database) CheckUserAttempted(ctx context.Context, msisdn string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Attempted_Players" WHERE new_msisdn = $1 `
+	query := `SELECT * FROM "Attempted_Players" WHERE new_msisdn = $1 AND expires_at > NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -263,7 +370,7 @@ func (db *Database) CheckUserAttempted(ctx context.Context, msisdn string) (map[
 }
 
 func (db *Database) CheckSelfExclusion(ctx context.Context, msisdn string) (map[string]interface{}, error) {
-	query := `SELECT * FROM self_exlusion_request WHERE msisdn = $1  AND status = 'pending' order by id DESC LIMIT 1`
+	query := `SELECT * FROM self_exlusion_request WHERE msisdn = $1  AND status = $2 order by id DESC LIMIT 1`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -271,7 +378,7 @@ func (db *Database) CheckSelfExclusion(ctx context.Context, msisdn string) (map[
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn)
+	rows, err := conn.Query(ctx, query, msisdn, status.ExclusionPending)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -283,8 +390,6 @@ func (db *Database) CheckPromoCode(ctx context.Context, promo string) (map[strin
 
 	query := `SELECT * FROM "promocode" WHERE promocode = $1 AND expire = 'NO'`
 
-	logrus.Infof("promo already : %s", promo)
-
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
@@ -320,6 +425,9 @@ func (db *Database) CheckTransaction(ctx context.Context, transactionID string)
 }
 
 func (db *Database) UpdateUserAviatorBalInfoLucky(ctx context.Context, amount float64, msisdn, name string) (int64, error) {
+	if err := money.CheckDelta(money.Deposit, amount); err != nil {
+		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
+	}
 	query := `UPDATE "Player" 
               SET name = $1,
 				  monetary = monetary + $2,
@@ -337,44 +445,63 @@ func (db *Database) UpdateUserAviatorBalInfoLucky(ctx context.Context, amount fl
 		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
 	}
 
+	noteWrite(msisdn)
 	return result.RowsAffected(), nil
 }
 
-func (db *Database) UpdateUserInfo(ctx context.Context, msisdn, name string) (int64, error) {
-	query := `UPDATE "Player" 
-              SET name = $1
-              WHERE msisdn = $2`
+// Phone number change errors
+var (
+	ErrMsisdnChangeExpired = errors.New("no pending phone number change")
+	ErrMsisdnTaken         = errors.New("phone number already registered")
+)
 
+// UpdateUserMsisdn moves the player msisdn to newmsisdn and consumes the
+// pending change that claimed it. It returns ErrMsisdnChangeExpired when
+// that change is gone or expired, and ErrMsisdnTaken when a player has
+// registered newmsisdn since the change was requested.
+func (db *Database) UpdateUserMsisdn(ctx context.Context, msisdn, newmsisdn string) (int64, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, name, msisdn)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-func (db *Database) UpdateUserMsisdn(ctx context.Context, msisdn, newmsisdn string) (int64, error) {
-	query := `UPDATE "Player" 
-              SET msisdn = $1
-              WHERE msisdn = $2`
-
-	conn, err := db.pool.Acquire(ctx)
+	claimed, err := tx.Exec(ctx, `DELETE FROM "Attempted_Players"
+		WHERE msisdn = $1 AND new_msisdn = $2 AND expires_at > NOW()`, msisdn, newmsisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to consume phone number change: %w", err)
+	}
+	if claimed.RowsAffected() == 0 {
+		return 0, ErrMsisdnChangeExpired
+	}
+
+	var taken bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM "Player" WHERE msisdn = $1)`, newmsisdn).Scan(&taken); err != nil {
+		return 0, fmt.Errorf("failed to check user %s: %w", newmsisdn, err)
+	}
+	if taken {
+		return 0, ErrMsisdnTaken
 	}
-	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, newmsisdn, msisdn)
+	result, err := tx.Exec(ctx, `UPDATE "Player" SET msisdn = $1 WHERE msisdn = $2`, newmsisdn, msisdn)
+	if isUniqueViolation(err) {
+		return 0, ErrMsisdnTaken
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
 	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit phone number change: %w", err)
+	}
 
+	noteWrite(msisdn)
+	noteWrite(newmsisdn)
 	return result.RowsAffected(), nil
 }
 
@@ -401,8 +528,8 @@ func (db *Database) UpdatePlayerSelf(ctx context.Context, msisdn string, hrs str
 
 func (db *Database) UpdateSelfExclusion(ctx context.Context, msisdn string) error {
 	query := `UPDATE self_exlusion_request 
-              SET status = 'processed'
-              WHERE msisdn = $1 AND status = 'pending'`
+              SET status = $2
+              WHERE msisdn = $1 AND status = $3`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -410,7 +537,7 @@ func (db *Database) UpdateSelfExclusion(ctx context.Context, msisdn string) erro
 	}
 	defer conn.Release()
 
-	_, err = conn.Exec(ctx, query, msisdn)
+	_, err = conn.Exec(ctx, query, msisdn, status.ExclusionProcessed, status.ExclusionPending)
 	if err != nil {
 		return fmt.Errorf("failed to update user %s: %w", msisdn, err)
 	}
@@ -418,19 +545,98 @@ func (db *Database) UpdateSelfExclusion(ctx context.Context, msisdn string) erro
 	return nil
 }
 
-func (db *Database) UpdateUserWinStatus(ctx context.Context, msisdn, show_win string) (int64, error) {
-	query := `UPDATE "Player" 
-              SET show_win = $1
-              WHERE msisdn = $2`
+// showsWins is true for a "Player" p whose show_win reads as true the way
+// GetPlayerProfile reads it. NULL, which GET /profile reports as false,
+// keeps the player out of public feeds too.
+const showsWins = `lower(COALESCE(p.show_win::text, '')) IN ('true', 't', '1', 'yes', 'on')`
+
+// GetPlayerProfile returns msisdn's profile, or nil when there is no such
+// player
+func (db *Database) GetPlayerProfile(ctx context.Context, msisdn string) (*PlayerProfile, error) {
+	query := `SELECT msisdn, COALESCE(name, ''), COALESCE(language, ''),
+			sms_notifications, COALESCE(show_win::text, '')
+		FROM "Player" WHERE msisdn = $1`
+
+	conn, err := db.readConn(ctx, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var p PlayerProfile
+	var showWin string
+	err = conn.QueryRow(ctx, query, msisdn).Scan(&p.Msisdn, &p.Name, &p.Language, &p.SMSNotifications, &showWin)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile %s: %w", msisdn, err)
+	}
+	p.ShowWin = utils.ToBool(showWin)
+	return &p, nil
+}
+
+// GetPlayerLifetimeStats totals msisdn's settled bets in one statement.
+// The streak is the bets after the newest one whose outcome differs from
+// the newest bet's. Both bets are read from the top of
+// bets_msisdn_date_created, so counting the streak needs no sort of the
+// player's history.
+func (db *Database) GetPlayerLifetimeStats(ctx context.Context, msisdn string) (PlayerLifetimeStats, error) {
+	query := `WITH latest AS (
+			SELECT result_status FROM "Bets"
+			WHERE msisdn = $1 AND result_status IN ($2, $3)
+			ORDER BY date_created DESC, id DESC LIMIT 1
+		), last_break AS (
+			SELECT date_created, id FROM "Bets"
+			WHERE msisdn = $1 AND result_status IN ($2, $3)
+				AND result_status <> (SELECT result_status FROM latest)
+			ORDER BY date_created DESC, id DESC LIMIT 1
+		)
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE b.result_status = $2),
+			COUNT(*) FILTER (WHERE b.result_status = $3),
+			COALESCE(SUM(b.amount) FILTER (WHERE b.bet_type IS DISTINCT FROM 'free_bet'), 0)::float8,
+			COALESCE(SUM(b.win_amount), 0)::float8,
+			COALESCE(MAX(b.win_amount), 0)::float8,
+			COALESCE((SELECT result_status = $2 FROM latest), false),
+			COUNT(*) FILTER (WHERE NOT EXISTS (SELECT 1 FROM last_break)
+				OR (b.date_created, b.id) > (SELECT date_created, id FROM last_break))
+		FROM "Bets" b
+		WHERE b.msisdn = $1 AND b.result_status IN ($2, $3)`
+
+	conn, err := db.readConn(ctx, msisdn)
+	if err != nil {
+		return PlayerLifetimeStats{}, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var st PlayerLifetimeStats
+	err = conn.QueryRow(ctx, query, msisdn, status.ResultWin, status.ResultLoss).Scan(&st.GamesPlayed, &st.Wins, &st.Losses,
+		&st.TotalWagered, &st.TotalWon, &st.BiggestWin, &st.StreakWon, &st.Streak)
+	if err != nil {
+		return PlayerLifetimeStats{}, fmt.Errorf("failed to load stats of %s: %w", msisdn, err)
+	}
+	return st, nil
+}
+
+// UpdatePlayerProfile writes every field of p to the player's row
+func (db *Database) UpdatePlayerProfile(ctx context.Context, p PlayerProfile) (int64, error) {
+	query := `UPDATE "Player"
+		SET name = $1, language = NULLIF($2, ''), sms_notifications = $3, show_win = $4
+		WHERE msisdn = $5`
+
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
-	result, err := conn.Exec(ctx, query, show_win, msisdn)
+
+	result, err := conn.Exec(ctx, query, p.Name, p.Language, p.SMSNotifications, strconv.FormatBool(p.ShowWin), p.Msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
+		return 0, fmt.Errorf("failed to update profile %s: %w", p.Msisdn, err)
 	}
+
+	noteWrite(p.Msisdn)
 	return result.RowsAffected(), nil
 }
 
@@ -450,10 +656,15 @@ func (db *Database) UpdateUserProfilePic(ctx context.Context, msisdn, filename s
 	return result.RowsAffected(), nil
 }
 
-func (db *Database) DeleteUserInfo(ctx context.Context, msisdn string) (int64, error) {
-	query := `UPDATE "Player" 
-              SET active_status = 'inactive'
-              WHERE msisdn = $1`
+// RequestPlayerDeletion marks msisdn pending_deletion. A repeated request
+// keeps the original date so it cannot push the deletion back, and clears
+// any earlier block so the job checks the account again.
+func (db *Database) RequestPlayerDeletion(ctx context.Context, msisdn string) (int64, error) {
+	query := `UPDATE "Player"
+              SET active_status = 'pending_deletion',
+                  deletion_requested_at = COALESCE(deletion_requested_at, NOW()),
+                  deletion_blocked = NULL
+              WHERE msisdn = $1 AND anonymized_at IS NULL`
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
@@ -463,8 +674,190 @@ func (db *Database) DeleteUserInfo(ctx context.Context, msisdn string) (int64, e
 	if err != nil {
 		return 0, fmt.Errorf("failed to update user %s: %w", msisdn, err)
 	}
+	noteWrite(msisdn)
 	return result.RowsAffected(), nil
 }
+
+// ListDueDeletions returns up to limit players pending deletion since before
+// requestedBefore, oldest first with blocked ones last so they cannot hold
+// up the rest
+func (db *Database) ListDueDeletions(ctx context.Context, requestedBefore time.Time, limit int) ([]DeletionCandidate, error) {
+	query := `SELECT msisdn, COALESCE(profile_url, ''), deletion_requested_at
+		FROM "Player"
+		WHERE active_status = 'pending_deletion' AND deletion_requested_at <= $1
+		ORDER BY deletion_blocked IS NOT NULL, deletion_requested_at
+		LIMIT $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, requestedBefore, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (DeletionCandidate, error) {
+		var c DeletionCandidate
+		err := row.Scan(&c.Msisdn, &c.ProfileURL, &c.RequestedAt)
+		return c, err
+	})
+}
+
+// GetDeletionBlocker returns why msisdn cannot be anonymized yet: a pending
+// withdrawal or an unsettled debt from a reversed deposit. Returns "" when
+// nothing holds it back.
+func (db *Database) GetDeletionBlocker(ctx context.Context, msisdn string) (string, error) {
+	query := `SELECT CASE
+			WHEN EXISTS (SELECT 1 FROM "withdrawals" WHERE msisdn = $1 AND status = $2) THEN 'pending_withdrawal'
+			WHEN EXISTS (SELECT 1 FROM "player_debts" WHERE msisdn = $1 AND settled_at IS NULL) THEN 'open_debt'
+			ELSE ''
+		END`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var reason string
+	if err := conn.QueryRow(ctx, query, msisdn, status.WithdrawalPending).Scan(&reason); err != nil {
+		return "", fmt.Errorf("failed to check deletion blockers: %w", err)
+	}
+	return reason, nil
+}
+
+// MarkDeletionBlocked records why a pending deletion was skipped
+func (db *Database) MarkDeletionBlocked(ctx context.Context, msisdn, reason string) error {
+	query := `UPDATE "Player" SET deletion_blocked = $2
+		WHERE msisdn = $1 AND active_status = 'pending_deletion'`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, query, msisdn, reason); err != nil {
+		return fmt.Errorf("failed to mark deletion blocked: %w", err)
+	}
+	return nil
+}
+
+// anonymizeRekey lists the money tables whose msisdn column is replaced by
+// the anonymous token, so the records stay together for audit
+var anonymizeRekey = []struct{ table, column string }{
+	{`"Bets"`, "msisdn"},
+	{`"deposit_requests"`, "msisdn"},
+	{`"withdrawals"`, "msisdn"},
+	{`"pending_withdrawals"`, "msisdn"},
+	{`"withdrawal_queue_ke"`, "msisdn"},
+	{`"mpesa_disburse"`, "msisdn"},
+	{`"stk_queue_ke"`, "msisdn"},
+	{`"tax_record"`, "msisdn"},
+	{`"jackpot_winners"`, "msisdn"},
+	{`"transfers"`, "sender"},
+	{`"transfers"`, "recipient"},
+	{`"bonus_grants"`, "msisdn"},
+	{`"bet_funding"`, "msisdn"},
+	{`"deposit_reversals"`, "msisdn"},
+	{`"player_debts"`, "msisdn"},
+	{`"campaign_redemptions"`, "msisdn"},
+	{`"game_rounds"`, "msisdn"},
+	{`"promocode"`, "msisdn"},
+	{`"balance_withdrawals"`, "msisdn"},
+}
+
+// anonymizeDelete lists the tables whose rows for msisdn carry no money and
+// are deleted outright
+var anonymizeDelete = []struct{ table, column string }{
+	{"verification", "msisdn"},
+	{`"refresh_tokens"`, "msisdn"},
+	{`"Attempted_Players"`, "msisdn"},
+	{`"Attempted_Players"`, "new_msisdn"},
+	{`"Aviator"."ussd_session"`, "msisdn"},
+	{`"Aviator"."ussd_logs"`, "msisdn"},
+	{`"Aviator"."ussd_log_inputs"`, "msisdn"},
+	{"self_exlusion_request", "msisdn"},
+	{`"bet_reveals"`, "msisdn"},
+}
+
+// AnonymizePlayer replaces msisdn with token in one transaction: the
+// Player row loses its name and picture and becomes 'deleted', money tables
+// are re-keyed to token, queued SMS lose their text and OTPs, sessions and
+// logs are deleted. Returns false when the player is no longer pending
+// deletion.
+func (db *Database) AnonymizePlayer(ctx context.Context, msisdn, token string) (bool, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `UPDATE "Player"
+		SET msisdn = $2, name = '', profile_url = NULL,
+		    active_status = 'deleted', deletion_blocked = NULL, anonymized_at = NOW()
+		WHERE msisdn = $1 AND active_status = 'pending_deletion'`, msisdn, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to anonymize player: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	for _, t := range anonymizeRekey {
+		query := `UPDATE ` + t.table + ` SET ` + t.column + ` = $2 WHERE ` + t.column + ` = $1`
+		if _, err := tx.Exec(ctx, query, msisdn, token); err != nil {
+			return false, fmt.Errorf("failed to re-key %s.%s: %w", t.table, t.column, err)
+		}
+	}
+	for _, t := range anonymizeDelete {
+		query := `DELETE FROM ` + t.table + ` WHERE ` + t.column + ` = $1`
+		if _, err := tx.Exec(ctx, query, msisdn); err != nil {
+			return false, fmt.Errorf("failed to delete from %s: %w", t.table, err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `UPDATE "dbQueue" SET "Destination" = $2, "Message" = '' WHERE "Destination" = $1`, msisdn, token); err != nil {
+		return false, fmt.Errorf("failed to scrub SMS queue: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	noteWrite(msisdn)
+	return true, nil
+}
+
+// ListDeletionRequests returns every player pending deletion, oldest request
+// first, with the reason it is blocked if any
+func (db *Database) ListDeletionRequests(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT msisdn, deletion_requested_at, COALESCE(deletion_blocked, '') AS deletion_blocked
+		FROM "Player"
+		WHERE active_status = 'pending_deletion'
+		ORDER BY deletion_requested_at`
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
 func (db *Database) CheckDepositRequestLucky(ctx context.Context, reference string) (map[string]interface{}, error) {
 	query := `SELECT * FROM "deposit_requests" 
               WHERE reference = $1 
@@ -487,10 +880,38 @@ func (db *Database) CheckDepositRequestLucky(ctx context.Context, reference stri
 	return db.scanRowsToSingleMap(rows)
 }
 
+// GetDepositStatus returns a deposit request by reference together with its
+// STK result, or nil when the reference is unknown. Once the STK was
+// retried the result of the first push no longer applies and is left out.
+func (db *Database) GetDepositStatus(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT d.reference, d.msisdn, d.amount::float8 AS amount, d.status, d.description,
+			d.transaction_id, d.date_created,
+			s.status AS stk_status, s.description AS stk_description
+		FROM "deposit_requests" d
+		LEFT JOIN "stk_results" s ON s.reference = d.reference AND d.stk_retried_at IS NULL
+		WHERE d.reference = $1
+		ORDER BY d.date_created DESC
+		LIMIT 1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToSingleMap(rows)
+}
+
 // CheckUser checks if user exists in Player table
 func (db *Database) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
 
-	query := `SELECT * FROM "Player" WHERE msisdn = $1 `
+	query := checkUserQuery
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -510,23 +931,20 @@ func (db *Database) CheckUser(ctx context.Context, msisdn string) (map[string]in
 }
 
 // bet History
-func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate, endDate *string) ([]map[string]interface{}, error) {
+func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error) {
 	var query string
 	var args []interface{}
 
 	args = append(args, msisdn) // $1 for msisdn
 
-	// Log for debugging
-
-	if startDate != nil && endDate != nil {
-		logrus.Infof("GetGames request: %+v", startDate)
+	if !startDate.IsZero() && !endDate.IsZero() {
 		// Filter by date range
 		query = `SELECT * 
 		         FROM "Bets" 
 		         WHERE msisdn = $1 
 		           AND date_created BETWEEN $2 AND $3
 		         ORDER BY id DESC LIMIT 100`
-		args = append(args, *startDate, *endDate) // $2, $3
+		args = append(args, startDate, endDate) // $2, $3
 	} else {
 		// No date filter
 		query = `SELECT * 
@@ -535,7 +953,7 @@ func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate,
 		         ORDER BY id DESC LIMIT 10`
 	}
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, msisdn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
@@ -551,14 +969,14 @@ func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate,
 }
 
 // bet History
-// func (db *Database) CheckGameHistory(ctx context.Context, msisdn string, startDate, endDate *string, offset string, page_size string) ([]map[string]interface{}, error) {
+// func (db *Database) CheckGameHistory(ctx context.Context, msisdn string, startDate, endDate time.Time, offset string, page_size string) ([]map[string]interface{}, error) {
 // 	var query string
 // 	var args []interface{}
 
 // 	args = append(args, msisdn) // $1 for msisdn
 
 // 	// Log for debugging
-// 	if startDate != nil && endDate != nil {
+// 	if !startDate.IsZero() && !endDate.IsZero() {
 // 		logrus.Infof("GetGames request: %+v", startDate)
 // 		// Filter by date range
 // 		query = `SELECT c.*, p.msisdn
@@ -571,7 +989,7 @@ func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate,
 // 		logrus.Infof("GetGames request: %+v", offset)
 // 		logrus.Infof("GetGames request: %+v", page_size)
 
-// 		args = append(args, *startDate, *endDate, offset, page_size) // $2, $3
+// 		args = append(args, startDate, endDate, offset, page_size) // $2, $3
 // 	} else {
 // 		// No date filter
 // 		query = `SELECT
@@ -608,7 +1026,7 @@ func (db *Database) CheckHistory(ctx context.Context, msisdn string, startDate,
 func (db *Database) CheckGameHistory(
 	ctx context.Context,
 	msisdn string,
-	startDate, endDate *string,
+	startDate, endDate time.Time,
 	offset, pageSize string,
 ) ([]map[string]interface{}, float64, error) {
 
@@ -622,7 +1040,7 @@ func (db *Database) CheckGameHistory(
 	// -------------------------------
 	// BET HISTORY QUERY
 	// -------------------------------
-	if startDate != nil && endDate != nil {
+	if !startDate.IsZero() && !endDate.IsZero() {
 		historyQuery = `
 			SELECT 
 				c.*,
@@ -643,7 +1061,7 @@ func (db *Database) CheckGameHistory(
 			  AND c.date_created BETWEEN $2 AND $3;
 		`
 
-		args = []interface{}{msisdn, *startDate, *endDate, offset, pageSize}
+		args = []interface{}{msisdn, startDate, endDate, offset, pageSize}
 	} else {
 		historyQuery = `
 			SELECT 
@@ -669,7 +1087,7 @@ func (db *Database) CheckGameHistory(
 	// -------------------------------
 	// DB CONNECTION
 	// -------------------------------
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, msisdn)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -693,7 +1111,7 @@ func (db *Database) CheckGameHistory(
 	// FETCH TOTAL BET AMOUNT
 	// -------------------------------
 	totalArgs := args[:1]
-	if startDate != nil && endDate != nil {
+	if !startDate.IsZero() && !endDate.IsZero() {
 		totalArgs = args[:3]
 	}
 
@@ -705,23 +1123,20 @@ func (db *Database) CheckGameHistory(
 	return history, totalAmount, nil
 }
 
-func (db *Database) CheckWithdrawal(ctx context.Context, msisdn string, startDate, endDate *string) ([]map[string]interface{}, error) {
+func (db *Database) CheckWithdrawal(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error) {
 	var query string
 	var args []interface{}
 
 	args = append(args, msisdn) // $1 for msisdn
 
-	// Log for debugging
-
-	if startDate != nil && endDate != nil {
-		logrus.Infof("GetGames request: %+v", startDate)
+	if !startDate.IsZero() && !endDate.IsZero() {
 		// Filter by date range
 		query = `SELECT * 
 		         FROM "withdrawals" 
 		         WHERE msisdn = $1 
 		           AND date_created BETWEEN $2 AND $3
 		         ORDER BY id DESC LIMIT 100`
-		args = append(args, *startDate, *endDate) // $2, $3
+		args = append(args, startDate, endDate) // $2, $3
 	} else {
 		// No date filter
 		query = `SELECT * 
@@ -730,7 +1145,7 @@ func (db *Database) CheckWithdrawal(ctx context.Context, msisdn string, startDat
 		         ORDER BY id DESC LIMIT 10`
 	}
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, msisdn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
@@ -745,23 +1160,30 @@ func (db *Database) CheckWithdrawal(ctx context.Context, msisdn string, startDat
 	return db.scanRowsToMap(rows)
 }
 
-func (db *Database) GetWinners(ctx context.Context) ([]map[string]interface{}, error) {
-	var query string
-	var args []interface{}
-
-	// No date filter
-	query = `SELECT DISTINCT ON (msisdn) *
-		FROM withdrawals 
-		ORDER BY msisdn, id DESC 
-		LIMIT 10;`
-
-	conn, err := db.pool.Acquire(ctx)
+// GetRecentWinners returns the latest wins at or above minAmount, optionally
+// filtered by game category. Only the columns needed by the public feed are selected.
+// The msisdn of a player who has not opted in to show_win comes back empty,
+// so it never leaves the database. Balance withdrawals are cash-outs, not
+// wins, and are left out.
+func (db *Database) GetRecentWinners(ctx context.Context, limit int, minAmount float64, gameCatID string) ([]map[string]interface{}, error) {
+	query := `SELECT CASE WHEN ` + showsWins + ` THEN w.msisdn ELSE '' END AS msisdn,
+			w.items, w.amount::float8 AS amount, COALESCE(b.game_name, '') AS game_name, w.date_created
+		FROM "withdrawals" w
+		LEFT JOIN "Bets" b ON b.reference = w.reference
+		LEFT JOIN "Player" p ON p.msisdn = w.msisdn
+		WHERE w.amount >= $1
+		  AND ($2 = '' OR b.game_cat_id::text = $2)
+		  AND w.items IS DISTINCT FROM $4
+		ORDER BY w.id DESC
+		LIMIT $3`
+
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, args...)
+	rows, err := conn.Query(ctx, query, minAmount, gameCatID, limit, WithdrawalItemsBalance)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -770,66 +1192,143 @@ func (db *Database) GetWinners(ctx context.Context) ([]map[string]interface{}, e
 	return db.scanRowsToMap(rows)
 }
 
-func (db *Database) GetOnlineUsers(ctx context.Context) ([]map[string]interface{}, error) {
-	var query string
-	var args []interface{}
-
-	// No date filter
-	query = `SELECT 
-				COUNT(DISTINCT c.customer_id) AS online_users
-			FROM "CustomerLogs" c
-			INNER JOIN "Player" p 
-				ON c.customer_id = p.id::text
-			WHERE  
-				c.date_created >= NOW() - INTERVAL '1 hour';`
-
-	conn, err := db.pool.Acquire(ctx)
+// playerStatsColumns is the projection shared by the admin player queries.
+// Numeric columns are cast so they scan as float64/int64, not pgtype.Numeric.
+const playerStatsColumns = `p.msisdn,
+		COALESCE(p.rtp_player, 0)::float8 AS rtp_player,
+		COALESCE(p.frequency, 0)::bigint AS frequency,
+		COALESCE(p.total_bets, 0)::float8 AS total_bets,
+		COALESCE(p.payout, 0)::float8 AS payout,
+		COALESCE(p.total_losses, 0)::float8 AS total_losses,
+		COALESCE(p.lost_count, 0)::bigint AS lost_count,
+		COALESCE(p.last_stake_amount, 0)::float8 AS last_stake_amount,
+		p.last_transaction_time,
+		p.date_created,
+		COALESCE((SELECT MAX(b.win_amount) FROM "Bets" b WHERE b.msisdn = p.msisdn), 0)::float8 AS largest_win`
+
+// playerSortOrders whitelists the ORDER BY clauses ListPlayerStats accepts;
+// the sort key is never interpolated into SQL directly
+var playerSortOrders = map[string]string{
+	"rtp_desc":         "p.rtp_player DESC NULLS LAST",
+	"rtp_asc":          "p.rtp_player ASC NULLS LAST",
+	"bets_desc":        "p.total_bets DESC NULLS LAST",
+	"frequency_desc":   "p.frequency DESC NULLS LAST",
+	"payout_desc":      "p.payout DESC NULLS LAST",
+	"losses_desc":      "p.total_losses DESC NULLS LAST",
+	"loss_streak_desc": "p.lost_count DESC NULLS LAST",
+	"recent":           "p.last_transaction_time DESC NULLS LAST",
+}
+
+// ErrInvalidSort is returned when a sort key is not in the whitelist
+var ErrInvalidSort = errors.New("invalid sort")
+
+// IsValidPlayerSort reports whether sort is an accepted ListPlayerStats key
+func IsValidPlayerSort(sort string) bool {
+	_, ok := playerSortOrders[sort]
+	return ok
+}
+
+// GetPlayerStats returns the lifetime gameplay figures for one player
+func (db *Database) GetPlayerStats(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	query := `SELECT ` + playerStatsColumns + `
+		FROM "Player" p
+		WHERE p.msisdn = $1`
+
+	conn, err := db.readConn(ctx, msisdn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, args...)
+	rows, err := conn.Query(ctx, query, msisdn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	return db.scanRowsToMap(rows)
+	return db.scanRowsToSingleMap(rows)
 }
 
-func (db *Database) CheckDeposits(ctx context.Context, msisdn string, startDate, endDate *string) ([]map[string]interface{}, error) {
-	var query string
-	var args []interface{}
+// ListPlayerStats pages through players with at least minBets bets, ordered
+// by a whitelisted sort key. It also returns the total matching rows.
+func (db *Database) ListPlayerStats(ctx context.Context, sort string, minBets int64, limit, offset int) ([]map[string]interface{}, int64, error) {
+	orderBy, ok := playerSortOrders[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidSort, sort)
+	}
 
-	args = append(args, msisdn) // $1 for msisdn
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
 
-	// Log for debugging
+	var total int64
+	err = conn.QueryRow(ctx, `SELECT COUNT(*) FROM "Player" p WHERE COALESCE(p.frequency, 0) >= $1`, minBets).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count players: %w", err)
+	}
 
-	if startDate != nil && endDate != nil {
-		logrus.Infof("GetGames request: %+v", startDate)
-		// Filter by date range
-		query = `SELECT * 
-		         FROM "deposit" 
-		         WHERE msisdn = $1 
-		           AND date_created BETWEEN $2 AND $3
-		         ORDER BY id DESC LIMIT 100`
-		args = append(args, *startDate, *endDate) // $2, $3
-	} else {
-		// No date filter
-		query = `SELECT * 
-		         FROM "deposit" 
-		         WHERE msisdn = $1 
-		         ORDER BY id DESC LIMIT 10`
+	query := `SELECT ` + playerStatsColumns + `
+		FROM "Player" p
+		WHERE COALESCE(p.frequency, 0) >= $1
+		ORDER BY ` + orderBy + `, p.id
+		LIMIT $2 OFFSET $3`
+
+	rows, err := conn.Query(ctx, query, minBets, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	conn, err := db.pool.Acquire(ctx)
+	players, err := db.scanRowsToMap(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return players, total, nil
+}
+
+// StreamPlayerStats hands every player with at least minBets bets to fn in
+// sort order, without loading them all; see ForEachRow
+func (db *Database) StreamPlayerStats(ctx context.Context, sort string, minBets int64, fn func(row map[string]interface{}) error) error {
+	orderBy, ok := playerSortOrders[sort]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidSort, sort)
+	}
+
+	query := `SELECT ` + playerStatsColumns + `
+		FROM "Player" p
+		WHERE COALESCE(p.frequency, 0) >= $1
+		ORDER BY ` + orderBy + `, p.id`
+
+	return db.ForEachRow(ctx, query, []interface{}{minBets}, fn)
+}
+
+// GetDailyKPI returns the kpi rows between two YYYY-MM-DD dates inclusive
+func (db *Database) GetDailyKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+	query := `SELECT date::text AS date,
+			COALESCE(handle, 0)::float8 AS handle,
+			COALESCE(bet, 0)::float8 AS bet,
+			COALESCE(bet_count, 0)::bigint AS bet_count,
+			COALESCE(payout, 0)::float8 AS payout,
+			COALESCE(ggr, 0)::float8 AS ggr,
+			COALESCE(rtp, 0)::float8 AS rtp,
+			COALESCE(vig, 0)::float8 AS vig,
+			COALESCE(withholding_tax_amount, 0)::float8 AS withholding_tax_amount,
+			COALESCE(excise_duty_tax_amount, 0)::float8 AS excise_duty_tax_amount,
+			COALESCE(free_bet_count, 0)::bigint AS free_bet_count,
+			COALESCE(free_bet_stake, 0)::float8 AS free_bet_stake
+		FROM "kpi"
+		WHERE date BETWEEN $1::date AND $2::date
+		ORDER BY date`
+
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, args...)
+	rows, err := conn.Query(ctx, query, startDate, endDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -838,17 +1337,25 @@ func (db *Database) CheckDeposits(ctx context.Context, msisdn string, startDate,
 	return db.scanRowsToMap(rows)
 }
 
-// CheckBets gets user's bets
-func (db *Database) CheckBets(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
-	query := `SELECT * FROM "Bets" WHERE msisdn = $1 ORDER BY id DESC `
+// GetChannelKPI totals kpi_by_channel per channel between two YYYY-MM-DD
+// dates inclusive
+func (db *Database) GetChannelKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+	query := `SELECT channel,
+			COALESCE(SUM(handle), 0)::float8 AS handle,
+			COALESCE(SUM(payout), 0)::float8 AS payout,
+			COALESCE(SUM(bet_count), 0)::bigint AS bet_count
+		FROM "kpi_by_channel"
+		WHERE date BETWEEN $1::date AND $2::date
+		GROUP BY channel
+		ORDER BY channel`
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn)
+	rows, err := conn.Query(ctx, query, startDate, endDate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -857,17 +1364,25 @@ func (db *Database) CheckBets(ctx context.Context, msisdn string) ([]map[string]
 	return db.scanRowsToMap(rows)
 }
 
-// CheckBettoBet checks recent bets within 1 minute
-func (db *Database) CheckBettoBet(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
-	query := `SELECT * FROM "Bets" WHERE msisdn = $1 AND date_created >= NOW() - INTERVAL '1 minute' ORDER BY id DESC `
+// ListGameDailyExposure returns every game with its daily_exposure_cap
+// and what it has paid out in wins today: game_cat_id, name, status,
+// daily_exposure_cap (0 is no cap), exposure and win_count
+func (db *Database) ListGameDailyExposure(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT g.id::text AS game_cat_id, COALESCE(g.name, '') AS name, COALESCE(g.status, '') AS status,
+			COALESCE(g.daily_exposure_cap, 0)::float8 AS daily_exposure_cap,
+			COALESCE(e.exposure, 0)::float8 AS exposure,
+			COALESCE(e.win_count, 0)::bigint AS win_count
+		FROM "Games" g
+		LEFT JOIN "game_daily_exposure" e ON e.game_cat_id = g.id::text AND e.date = ` + today() + `
+		ORDER BY g.id`
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -876,17 +1391,86 @@ func (db *Database) CheckBettoBet(ctx context.Context, msisdn string) ([]map[str
 	return db.scanRowsToMap(rows)
 }
 
-// CheckJackpotWinnerKitty gets recent jackpot winners
-func (db *Database) CheckJackpotWinnerKitty(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
-	query := `SELECT msisdn FROM "jackpot_winners" ORDER BY id DESC LIMIT 3`
-
-	conn, err := db.pool.Acquire(ctx)
+// GetReportFigures sums each report figure per day from its source table,
+// for rows created in [start, end]. A row has day, figure, amount and
+// count; days without activity for a figure have no row. Days are the
+// business day of date_created, the same day a kpi row is booked to.
+//
+//	stakes             "Bets" not staked from a free bet
+//	wins               "Bets" win_amount, free bets included
+//	free_bet_stakes    "Bets" staked from a free bet
+//	free_bet_wins      "Bets" win_amount of free bets
+//	excise             "tax_record" tax_amount, tax_type excise
+//	withholding        "tax_record" tax_amount, tax_type withholding
+//	deposits           "deposit"
+//	deposit_reversals  "deposit_reversals"
+//	withdrawals_paid   "withdrawals" processed
+//	withdrawals_queued "withdrawals" still pending
+//	payouts_held       "pending_withdrawals", wins waiting on the basket
+func (db *Database) GetReportFigures(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	query := `SELECT ` + dayOf("date_created") + `::text AS day, 'stakes' AS figure,
+			COALESCE(SUM(amount), 0)::float8 AS amount, COUNT(*)::bigint AS count
+		FROM "Bets"
+		WHERE date_created BETWEEN $1 AND $2 AND bet_type IS DISTINCT FROM 'free_bet'
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'wins',
+			COALESCE(SUM(win_amount), 0)::float8, COUNT(*)::bigint
+		FROM "Bets"
+		WHERE date_created BETWEEN $1 AND $2 AND win_amount > 0
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'free_bet_stakes',
+			COALESCE(SUM(amount), 0)::float8, COUNT(*)::bigint
+		FROM "Bets"
+		WHERE date_created BETWEEN $1 AND $2 AND bet_type = 'free_bet'
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'free_bet_wins',
+			COALESCE(SUM(win_amount), 0)::float8, COUNT(*)::bigint
+		FROM "Bets"
+		WHERE date_created BETWEEN $1 AND $2 AND bet_type = 'free_bet' AND win_amount > 0
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, tax_type,
+			COALESCE(SUM(tax_amount), 0)::float8, COUNT(*)::bigint
+		FROM "tax_record"
+		WHERE date_created BETWEEN $1 AND $2 AND tax_type IN ('excise', 'withholding')
+		GROUP BY 1, 2
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'deposits',
+			COALESCE(SUM(amount), 0)::float8, COUNT(*)::bigint
+		FROM "deposit"
+		WHERE date_created BETWEEN $1 AND $2
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'deposit_reversals',
+			COALESCE(SUM(amount), 0)::float8, COUNT(*)::bigint
+		FROM "deposit_reversals"
+		WHERE date_created BETWEEN $1 AND $2
+		GROUP BY 1
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text,
+			CASE WHEN status = $3 THEN 'withdrawals_paid' ELSE 'withdrawals_queued' END,
+			COALESCE(SUM(amount), 0)::float8, COUNT(*)::bigint
+		FROM "withdrawals"
+		WHERE date_created BETWEEN $1 AND $2 AND status IN ($3, $4)
+		GROUP BY 1, 2
+		UNION ALL
+		SELECT ` + dayOf("date_created") + `::text, 'payouts_held',
+			COALESCE(SUM(amount), 0)::float8, COUNT(*)::bigint
+		FROM "pending_withdrawals"
+		WHERE date_created BETWEEN $1 AND $2
+		GROUP BY 1
+		ORDER BY 1, 2`
+
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
 		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query)
+	rows, err := conn.Query(ctx, query, start, end, status.WithdrawalProcessed, status.WithdrawalPending)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -895,91 +1479,146 @@ func (db *Database) CheckJackpotWinnerKitty(ctx context.Context, msisdn string)
 	return db.scanRowsToMap(rows)
 }
 
-// UpdateKPI updates or inserts KPI record
-func (db *Database) UpdateKPI(ctx context.Context) (int64, error) {
-	checkQuery := `SELECT id FROM "kpi" WHERE DATE(created_on) = CURRENT_DATE`
+// balanceSnapshots selects the basket and house snapshots side by side, one
+// row per day either was taken
+const balanceSnapshots = `SELECT day::text AS day,
+			b.amount::float8 AS basket, b.credit::float8 AS basket_credit, b.debit::float8 AS basket_debit,
+			h.house_income::float8 AS house_income, h.total_bets::float8 AS total_bets,
+			h.total_wins::float8 AS total_wins, h.total_losses::float8 AS total_losses,
+			h.day_house_income::float8 AS day_house_income, h.day_bets::float8 AS day_bets,
+			h.day_wins::float8 AS day_wins, h.day_losses::float8 AS day_losses,
+			GREATEST(b.taken_at, h.taken_at) AS taken_at
+		FROM "basket_snapshots" b
+		FULL JOIN "house_snapshots" h USING (day)`
+
+// UpsertBalanceSnapshots snapshots "Basket" and "HouseIncome" for the current
+// business day, with the day's sums from their logs so far, and returns the
+// snapshot. Taking it again the same day overwrites it. The balances are read
+// without locking them, so bets are not held up.
+func (db *Database) UpsertBalanceSnapshots(ctx context.Context) (map[string]interface{}, error) {
+	basket := `INSERT INTO "basket_snapshots" (day, amount, credit, debit, taken_at)
+		SELECT ` + today() + `,
+			(SELECT COALESCE(SUM(amount), 0) FROM "Basket"),
+			COALESCE(SUM(credit), 0), COALESCE(SUM(debit), 0), NOW()
+		FROM "BasketLogs"
+		WHERE date_created >= ` + startOfToday() + `
+		ON CONFLICT (day) DO UPDATE SET amount = EXCLUDED.amount, credit = EXCLUDED.credit,
+			debit = EXCLUDED.debit, taken_at = EXCLUDED.taken_at`
+
+	house := `INSERT INTO "house_snapshots" (day, house_income, total_bets, total_wins, total_losses,
+			day_house_income, day_bets, day_wins, day_losses, taken_at)
+		SELECT ` + today() + `, h.house_income, h.total_bets, h.total_wins, h.total_losses,
+			l.house_income, l.total_bets, l.total_wins, l.total_losses, NOW()
+		FROM (SELECT COALESCE(SUM(house_income), 0) AS house_income, COALESCE(SUM(total_bets), 0) AS total_bets,
+				COALESCE(SUM(total_wins), 0) AS total_wins, COALESCE(SUM(total_losses), 0) AS total_losses
+			FROM "HouseIncome") h,
+			(SELECT COALESCE(SUM(house_income), 0) AS house_income, COALESCE(SUM(total_bets), 0) AS total_bets,
+				COALESCE(SUM(total_wins), 0) AS total_wins, COALESCE(SUM(total_losses), 0) AS total_losses
+			FROM "HouseIncomeLogs"
+			WHERE date_created >= ` + startOfToday() + `) l
+		ON CONFLICT (day) DO UPDATE SET house_income = EXCLUDED.house_income, total_bets = EXCLUDED.total_bets,
+			total_wins = EXCLUDED.total_wins, total_losses = EXCLUDED.total_losses,
+			day_house_income = EXCLUDED.day_house_income, day_bets = EXCLUDED.day_bets,
+			day_wins = EXCLUDED.day_wins, day_losses = EXCLUDED.day_losses, taken_at = EXCLUDED.taken_at`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
 	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var existingID int64
-	err = tx.QueryRow(ctx, checkQuery).Scan(&existingID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		insertQuery := `INSERT INTO "kpi" (date, handle, payout, ggr) 
-					   SELECT CURRENT_DATE, 0, 0, 0 FROM "HouseIncome"`
-		result, err := tx.Exec(ctx, insertQuery)
-		if err != nil {
-			return 0, fmt.Errorf("failed to insert kpi: %w", err)
-		}
-
-		if err := tx.Commit(ctx); err != nil {
-			return 0, fmt.Errorf("failed to commit transaction: %w", err)
-		}
-
-		return result.RowsAffected(), nil
-	} else if err != nil {
-		return 0, fmt.Errorf("failed to check existing kpi: %w", err)
+	if _, err := tx.Exec(ctx, basket); err != nil {
+		return nil, fmt.Errorf("failed to snapshot basket: %w", err)
+	}
+	if _, err := tx.Exec(ctx, house); err != nil {
+		return nil, fmt.Errorf("failed to snapshot house income: %w", err)
+	}
+	rows, err := tx.Query(ctx, balanceSnapshots+` WHERE day = `+today())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read balance snapshot: %w", err)
+	}
+	snapshot, err := db.scanRowsToSingleMap(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
 	}
 
-	return 0, nil
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit balance snapshots: %w", err)
+	}
+	return snapshot, nil
 }
 
-// UpdateJackpotKit updates jackpot kitty
-func (db *Database) UpdateJackpotKit(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "jackpot_kitty"
-			 SET kitty = kitty + ($1 * (pct_slice / 100)),
-				 pct_to_target = ((kitty + ($1 * (pct_slice / 100))) / cost) * 100 
-			 WHERE LENGTH(name_init) = 0`
+// GetBalanceSnapshots returns the balance snapshots of the business days
+// from start through end, oldest first
+func (db *Database) GetBalanceSnapshots(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	query := balanceSnapshots + `
+		WHERE day BETWEEN ` + dayOf("$1::timestamptz") + ` AND ` + dayOf("$2::timestamptz") + `
+		ORDER BY day`
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	rows, err := conn.Query(ctx, query, start, end)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update jackpot kitty: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateJackpotKitNameInit updates jackpot kitty with name_init
-func (db *Database) UpdateJackpotKitNameInit(ctx context.Context, mvalue float64, nameInit string) (int64, error) {
-	query := `UPDATE "jackpot_kitty"
-			 SET kitty = kitty + ($1 * (pct_slice / 100)),
-				 pct_to_target = ((kitty + ($1 * (pct_slice / 100))) / cost) * 100 
-			 WHERE LENGTH(name_init) > 0 AND name_init = $2`
+// AdmitBet counts a bet of msisdn's when it keeps cooldown after the last
+// one and perMinute bets in the current minute window; 0 disables either.
+// A refused bet is not counted: the stored row is returned with the
+// database's now, so the caller can tell how long to wait.
+func (db *Database) AdmitBet(ctx context.Context, msisdn string, cooldown time.Duration, perMinute int) (bool, map[string]interface{}, error) {
+	query := `INSERT INTO "bet_throttle" AS t (msisdn, last_bet_at, window_start, window_count)
+		VALUES ($1, NOW(), NOW(), 1)
+		ON CONFLICT (msisdn) DO UPDATE SET
+			last_bet_at  = NOW(),
+			window_start = CASE WHEN t.window_start <= NOW() - interval '1 minute' THEN NOW() ELSE t.window_start END,
+			window_count = CASE WHEN t.window_start <= NOW() - interval '1 minute' THEN 1 ELSE t.window_count + 1 END
+		WHERE t.last_bet_at <= NOW() - make_interval(secs => $2::float8 / 1000)
+			AND ($3::int <= 0 OR t.window_start <= NOW() - interval '1 minute' OR t.window_count < $3::int)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, nameInit)
+	result, err := conn.Exec(ctx, query, msisdn, cooldown.Milliseconds(), perMinute)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+		return false, nil, fmt.Errorf("failed to admit bet: %w", err)
+	}
+	if result.RowsAffected() > 0 {
+		return true, nil, nil
 	}
 
-	return result.RowsAffected(), nil
+	rows, err := conn.Query(ctx, `SELECT last_bet_at, window_start, window_count, NOW() AS now
+		FROM "bet_throttle" WHERE msisdn = $1`, msisdn)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to read bet throttle: %w", err)
+	}
+	defer rows.Close()
+
+	row, err := db.scanRowsToSingleMap(rows)
+	return false, row, err
 }
 
-func (db *Database) UpdateJackpotKity(ctx context.Context, id int) (int64, error) {
-	query := `UPDATE "jackpot_kitty"
-			 SET is_locked = 0 ,kitty = kitty-cost, win_count = win_count+ 1
-			 WHERE id = $1`
+// CountDepositsSince counts msisdn's deposits made at or after since
+func (db *Database) CountDepositsSince(ctx context.Context, msisdn string, since time.Time) (int64, error) {
+	query := `SELECT COUNT(*) FROM "deposit" WHERE msisdn = $1 AND date_created >= $2`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -987,78 +1626,290 @@ func (db *Database) UpdateJackpotKity(ctx context.Context, id int) (int64, error
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, id)
-	if err != nil {
-		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
-	}
+	var count int64
+	if err := conn.QueryRow(ctx, query, msisdn, since).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count deposits: %w", err)
+	}
+	return count, nil
+}
+
+// searchBetColumns, searchDepositColumns and searchWithdrawalColumns are
+// selected in the order scanSearchBet, scanSearchDeposit and
+// scanSearchWithdrawal read them
+const (
+	searchBetColumns = `COALESCE(reference, ''), COALESCE(parcel_reference, ''), msisdn,
+			COALESCE(game_cat_id::text, ''), COALESCE(game_name, ''), COALESCE(channel, ''),
+			COALESCE(bet_type, ''), COALESCE(amount, 0)::float8, COALESCE(selected_number::text, ''),
+			COALESCE(result_status::text, ''), COALESCE(win_amount, 0)::float8, date_created`
+	searchDepositColumns = `COALESCE(reference, ''), COALESCE(transaction_id, ''), msisdn,
+			COALESCE(amount, 0)::float8, COALESCE(status, ''), COALESCE(deposit_type, ''),
+			COALESCE(channel, ''), COALESCE(game_cat_id::text, ''), COALESCE(description, ''), date_created`
+	searchWithdrawalColumns = `COALESCE(reference, ''), COALESCE(transaction_id, ''), msisdn,
+			COALESCE(amount, 0)::float8, COALESCE(tax_amount, 0)::float8, COALESCE(status, ''),
+			COALESCE(disburse, ''), COALESCE(description, ''), date_created`
+)
 
-	return result.RowsAffected(), nil
+func scanSearchBet(row pgx.CollectableRow) (SearchBet, error) {
+	var b SearchBet
+	err := row.Scan(&b.Reference, &b.ParcelReference, &b.Msisdn, &b.GameCatID, &b.GameName, &b.Channel,
+		&b.BetType, &b.Amount, &b.SelectedNumber, &b.ResultStatus, &b.WinAmount, &b.DateCreated)
+	return b, err
 }
 
-func (db *Database) UpdatePlayerRestLossJackpot(ctx context.Context, cost float64, id int) (int64, error) {
-	query := `UPDATE "Player"
-			 SET jackpot_amount = jackpot_amount + $1, lost_count = 0
-			 WHERE id = $2`
+func scanSearchDeposit(row pgx.CollectableRow) (SearchDeposit, error) {
+	var d SearchDeposit
+	err := row.Scan(&d.Reference, &d.TransactionID, &d.Msisdn, &d.Amount, &d.Status, &d.DepositType,
+		&d.Channel, &d.GameCatID, &d.Description, &d.DateCreated)
+	return d, err
+}
 
-	conn, err := db.pool.Acquire(ctx)
+func scanSearchWithdrawal(row pgx.CollectableRow) (SearchWithdrawal, error) {
+	var w SearchWithdrawal
+	err := row.Scan(&w.Reference, &w.TransactionID, &w.Msisdn, &w.Amount, &w.TaxAmount, &w.Status,
+		&w.Disburse, &w.Description, &w.DateCreated)
+	return w, err
+}
+
+// searchRows runs a support search or open rounds query on the read pool
+// and collects its rows with scan. what names the rows in errors.
+func searchRows[T any](ctx context.Context, db *Database, msisdn, what, query string, scan pgx.RowToFunc[T], args ...interface{}) ([]T, error) {
+	conn, err := db.readConn(ctx, msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, cost, id)
+	rows, err := conn.Query(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+		return nil, fmt.Errorf("failed to search %s: %w", what, err)
 	}
-
-	return result.RowsAffected(), nil
+	found, err := pgx.CollectRows(rows, scan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", what, err)
+	}
+	return found, nil
 }
 
-func (db *Database) UpdateJackpotKitUpdate(ctx context.Context, id int) (int64, error) {
-	query := `UPDATE "jackpot_kitty"
-			 SET is_locked = 1 
-			 WHERE id = $1`
+// SearchPlayer returns the summary of player msisdn, or nil when there is
+// no such player
+func (db *Database) SearchPlayer(ctx context.Context, msisdn string) (*SearchPlayer, error) {
+	query := `SELECT msisdn, COALESCE(name, ''), COALESCE(balance, 0)::float8, COALESCE(free_bet, 0)::float8,
+			COALESCE(frequency, 0)::bigint, COALESCE(lost_count, 0)::bigint, last_transaction_time, date_created
+		FROM "Player" WHERE msisdn = $1`
+
+	conn, err := db.readConn(ctx, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
 
+	var p SearchPlayer
+	err = conn.QueryRow(ctx, query, msisdn).Scan(&p.Msisdn, &p.Name, &p.Balance, &p.FreeBets,
+		&p.BetCount, &p.LostCount, &p.LastTransaction, &p.DateCreated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search player: %w", err)
+	}
+	return &p, nil
+}
+
+// SearchPlayerBets returns msisdn's latest limit bets
+func (db *Database) SearchPlayerBets(ctx context.Context, msisdn string, limit int) ([]SearchBet, error) {
+	query := `SELECT ` + searchBetColumns + `
+		FROM "Bets" WHERE msisdn = $1
+		ORDER BY date_created DESC, id DESC
+		LIMIT $2`
+	return searchRows(ctx, db, msisdn, "bets", query, scanSearchBet, msisdn, limit)
+}
+
+// SearchPlayerDeposits returns msisdn's latest limit deposit requests
+func (db *Database) SearchPlayerDeposits(ctx context.Context, msisdn string, limit int) ([]SearchDeposit, error) {
+	query := `SELECT ` + searchDepositColumns + `
+		FROM "deposit_requests" WHERE msisdn = $1
+		ORDER BY date_created DESC
+		LIMIT $2`
+	return searchRows(ctx, db, msisdn, "deposits", query, scanSearchDeposit, msisdn, limit)
+}
+
+// SearchPlayerWithdrawals returns msisdn's latest limit withdrawals
+func (db *Database) SearchPlayerWithdrawals(ctx context.Context, msisdn string, limit int) ([]SearchWithdrawal, error) {
+	query := `SELECT ` + searchWithdrawalColumns + `
+		FROM "withdrawals" WHERE msisdn = $1
+		ORDER BY date_created DESC, id DESC
+		LIMIT $2`
+	return searchRows(ctx, db, msisdn, "withdrawals", query, scanSearchWithdrawal, msisdn, limit)
+}
+
+// SearchBetsByKey returns up to limit bets whose reference or parcel
+// reference is one of keys. Excluding empty references matches the partial
+// bets_reference_unique index.
+func (db *Database) SearchBetsByKey(ctx context.Context, keys []string, limit int) ([]SearchBet, error) {
+	query := `SELECT ` + searchBetColumns + `
+		FROM "Bets"
+		WHERE (reference = ANY($1) AND reference <> '') OR parcel_reference = ANY($1)
+		ORDER BY date_created DESC, id DESC
+		LIMIT $2`
+	return searchRows(ctx, db, "", "bets", query, scanSearchBet, keys, limit)
+}
+
+// SearchDepositsByKey returns up to limit deposit requests whose reference
+// or transaction id is one of keys
+func (db *Database) SearchDepositsByKey(ctx context.Context, keys []string, limit int) ([]SearchDeposit, error) {
+	query := `SELECT ` + searchDepositColumns + `
+		FROM "deposit_requests"
+		WHERE (reference = ANY($1) AND reference <> '') OR transaction_id = ANY($1)
+		ORDER BY date_created DESC
+		LIMIT $2`
+	return searchRows(ctx, db, "", "deposits", query, scanSearchDeposit, keys, limit)
+}
+
+// SearchWithdrawalsByKey returns up to limit withdrawals whose reference
+// or transaction id is one of keys
+func (db *Database) SearchWithdrawalsByKey(ctx context.Context, keys []string, limit int) ([]SearchWithdrawal, error) {
+	query := `SELECT ` + searchWithdrawalColumns + `
+		FROM "withdrawals"
+		WHERE reference = ANY($1) OR transaction_id = ANY($1)
+		ORDER BY date_created DESC, id DESC
+		LIMIT $2`
+	return searchRows(ctx, db, "", "withdrawals", query, scanSearchWithdrawal, keys, limit)
+}
+
+// LogAdminAccess records in admin_audit_log that admin ran action with
+// query and was shown the players msisdns
+func (db *Database) LogAdminAccess(ctx context.Context, admin, action, query string, msisdns []string) error {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, id)
+	if msisdns == nil {
+		msisdns = []string{}
+	}
+	_, err = conn.Exec(ctx, `INSERT INTO "admin_audit_log" (admin, action, query, msisdns) VALUES ($1, $2, $3, $4)`,
+		admin, action, query, msisdns)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+		return fmt.Errorf("failed to log admin access: %w", err)
 	}
+	return nil
+}
 
-	return result.RowsAffected(), nil
+const playerBetColumns = `COALESCE(b.reference, ''), COALESCE(b.game_cat_id::text, ''), COALESCE(b.game_name, ''),
+			COALESCE(b.channel, ''), COALESCE(b.amount, 0)::float8, COALESCE(b.selected_number::text, ''),
+			COALESCE(b.result_status::text, ''), COALESCE(b.win_amount, 0)::float8, b.date_created, r.reveal_at`
+
+func scanPlayerBet(row pgx.CollectableRow) (PlayerBet, error) {
+	var b PlayerBet
+	err := row.Scan(&b.Reference, &b.GameCatID, &b.GameName, &b.Channel, &b.Amount, &b.SelectedBox,
+		&b.ResultStatus, &b.WinAmount, &b.DateCreated, &b.RevealAt)
+	return b, err
+}
+
+// ListOpenDeposits returns msisdn's deposit requests for a game since
+// since that no bet holds the reference of: unanswered, unless the STK
+// push already failed, or succeeded and not yet played
+func (db *Database) ListOpenDeposits(ctx context.Context, msisdn string, since time.Time, limit int) ([]OpenDeposit, error) {
+	query := `SELECT d.reference, COALESCE(d.game_cat_id::text, ''), COALESCE(d.game, ''), COALESCE(d.channel, ''),
+			COALESCE(d.amount, 0)::float8, COALESCE(d.selected_box::text, ''), COALESCE(d.status, ''), d.date_created
+		FROM "deposit_requests" d
+		LEFT JOIN "stk_results" s ON s.reference = d.reference AND d.stk_retried_at IS NULL
+		WHERE d.msisdn = $1 AND d.date_created >= $2
+		  AND d.reference <> '' AND COALESCE(d.selected_box::text, '') <> ''
+		  AND ((d.status IS NULL AND s.status IS DISTINCT FROM $4) OR d.status = $5)
+		  AND NOT EXISTS (SELECT 1 FROM "Bets" b WHERE b.reference = d.reference)
+		ORDER BY d.date_created DESC
+		LIMIT $3`
+	return searchRows(ctx, db, msisdn, "open deposits", query, func(row pgx.CollectableRow) (OpenDeposit, error) {
+		var d OpenDeposit
+		err := row.Scan(&d.Reference, &d.GameCatID, &d.GameName, &d.Channel, &d.Amount, &d.SelectedBox, &d.Status, &d.DateCreated)
+		return d, err
+	}, msisdn, since, limit, string(status.DepositFail), string(status.DepositSuccess))
+}
+
+// ListOpenBets returns msisdn's bets since since that are still Pending or
+// whose delayed outcome is still held back
+func (db *Database) ListOpenBets(ctx context.Context, msisdn string, since time.Time, limit int) ([]PlayerBet, error) {
+	query := `SELECT ` + playerBetColumns + `
+		FROM "Bets" b
+		LEFT JOIN "bet_reveals" r ON r.reference = b.reference AND r.reveal_at > NOW()
+		WHERE b.msisdn = $1 AND b.date_created >= $2
+		  AND (b.result_status = $3 OR r.reference IS NOT NULL)
+		ORDER BY b.date_created DESC, b.id DESC
+		LIMIT $4`
+	return searchRows(ctx, db, msisdn, "open bets", query, scanPlayerBet, msisdn, since, string(status.ResultPending), limit)
+}
+
+// GetPlayerBet returns msisdn's bet reference, or nil when msisdn has no
+// such bet
+func (db *Database) GetPlayerBet(ctx context.Context, reference, msisdn string) (*PlayerBet, error) {
+	query := `SELECT ` + playerBetColumns + `
+		FROM "Bets" b
+		LEFT JOIN "bet_reveals" r ON r.reference = b.reference AND r.reveal_at > NOW()
+		WHERE b.reference = $1 AND b.msisdn = $2 AND b.reference <> ''
+		LIMIT 1`
+	bets, err := searchRows(ctx, db, msisdn, "bet", query, scanPlayerBet, reference, msisdn)
+	if err != nil || len(bets) == 0 {
+		return nil, err
+	}
+	return &bets[0], nil
 }
 
-// UpdateKPIHandle updates KPI handle
-func (db *Database) UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "kpi"
-             SET bet_count = bet_count + 1,
-                 bet = bet + $1,
-                 rtp = ((payout / CASE WHEN bet + $1 = 0 THEN 1 ELSE bet + $1 END) * 100)
-             WHERE DATE(created_on) = CURRENT_DATE`
+// FindDuplicatePlayers groups Player rows whose msisdns share the same last
+// nine digits, i.e. the same number stored as 07.., 2547.. or +2547..
+func (db *Database) FindDuplicatePlayers(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT '254' || RIGHT(regexp_replace(msisdn, '[^0-9]', '', 'g'), 9) AS canonical,
+			COUNT(*) AS players,
+			string_agg(msisdn, ',' ORDER BY id) AS msisdns,
+			string_agg(id::text, ',' ORDER BY id) AS player_ids
+		FROM "Player"
+		WHERE length(regexp_replace(msisdn, '[^0-9]', '', 'g')) >= 9
+		GROUP BY 1
+		HAVING COUNT(*) > 1
+		ORDER BY 2 DESC, 1`
 
-	conn, err := db.pool.Acquire(ctx)
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	// Only pass mvalue once since all placeholders are $1
-	result, err := conn.Exec(ctx, query, mvalue)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi handle: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// CheckSettingKPI gets KPI settings
-func (db *Database) CheckSettingKPI(ctx context.Context) (map[string]interface{}, error) {
-	query := `SELECT rtp, payout, bet FROM "kpi" WHERE DATE(created_on) = CURRENT_DATE `
+// GetSettlementLag returns one row per bucket (deposits, withdrawals, bets,
+// callbacks) with the count, total amount and oldest date_created of rows
+// still unsettled after the bucket's age. A failed inbound callback counts
+// whatever its age; its amount is its deposit request's.
+func (db *Database) GetSettlementLag(ctx context.Context, depositAge, withdrawalAge, betAge, callbackAge time.Duration) ([]map[string]interface{}, error) {
+	query := `SELECT 'deposits' AS bucket, COUNT(*)::bigint AS count,
+			COALESCE(SUM(amount), 0)::float8 AS amount, MIN(date_created) AS oldest
+		FROM "deposit_requests"
+		WHERE status IS NULL AND date_created < NOW() - make_interval(secs => $1)
+		UNION ALL
+		SELECT 'withdrawals', COUNT(*)::bigint,
+			COALESCE(SUM(amount), 0)::float8, MIN(date_created)
+		FROM "withdrawals"
+		WHERE status = $4 AND date_created < NOW() - make_interval(secs => $2)
+		UNION ALL
+		SELECT 'bets', COUNT(*)::bigint,
+			COALESCE(SUM(amount), 0)::float8, MIN(date_created)
+		FROM "Bets"
+		WHERE result_status = $5 AND date_created < NOW() - make_interval(secs => $3)
+		UNION ALL
+		SELECT 'callbacks', COUNT(*)::bigint,
+			COALESCE(SUM(d.amount), 0)::float8, MIN(c.received_at)
+		FROM "inbound_callbacks" c
+		LEFT JOIN "deposit_requests" d ON d.reference = c.reference
+		WHERE c.status = $7
+		   OR (c.status = $8 AND c.received_at < NOW() - make_interval(secs => $6))`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1066,69 +1917,74 @@ func (db *Database) CheckSettingKPI(ctx context.Context) (map[string]interface{}
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query)
+	rows, err := conn.Query(ctx, query, depositAge.Seconds(), withdrawalAge.Seconds(), betAge.Seconds(),
+		status.WithdrawalPending, status.ResultPending, callbackAge.Seconds(),
+		status.CallbackFailed, status.CallbackPending)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
-
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateKPIPayouts updates KPI payouts
-func (db *Database) UpdateKPIPayouts(ctx context.Context, mvalue, withTaxAmount, exciseTaxAmount float64) (int64, error) {
-	query := `UPDATE "kpi"  
-			 SET withholding_tax_amount = withholding_tax_amount + $1, 
-				 excise_duty_tax_amount = excise_duty_tax_amount + $2, 
-				 rtp = (((payout + $3) / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100), 
-				 ggr = handle - (payout + $4), 
-				 payout = payout + $5 
-			 WHERE DATE(created_on) = CURRENT_DATE`
+const campaignColumns = `id, name,
+		min_deposit::float8 AS min_deposit,
+		reward_type,
+		reward_amount::float8 AS reward_amount,
+		reward_validity_hours,
+		start_date, end_date,
+		max_redemptions_per_user,
+		status, date_created`
+
+// ListCampaigns returns all non-deleted campaigns, or only those running now
+func (db *Database) ListCampaigns(ctx context.Context, activeOnly bool) ([]map[string]interface{}, error) {
+	query := `SELECT ` + campaignColumns + `
+		FROM "campaigns"
+		WHERE status <> 'deleted'
+		  AND (NOT $1 OR (status = 'active' AND NOW() BETWEEN start_date AND end_date))
+		ORDER BY id DESC`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, withTaxAmount, exciseTaxAmount, mvalue, mvalue, mvalue)
+	rows, err := conn.Query(ctx, query, activeOnly)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateKPIPayouts updates KPI payouts
-func (db *Database) UpdateKPIPayoutSPIN(ctx context.Context, exciseTaxAmount float64) (int64, error) {
-	query := `UPDATE "kpi"  
-			 SET 
-				 excise_duty_tax_amount = excise_duty_tax_amount + $1, 
-				 rtp = (((payout) / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100), 
-				 ggr = handle - (payout)
-			 WHERE DATE(created_on) = CURRENT_DATE`
+// GetCampaign returns one non-deleted campaign
+func (db *Database) GetCampaign(ctx context.Context, id int64) (map[string]interface{}, error) {
+	query := `SELECT ` + campaignColumns + ` FROM "campaigns" WHERE id = $1 AND status <> 'deleted'`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, exciseTaxAmount)
+	rows, err := conn.Query(ctx, query, id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToSingleMap(rows)
 }
 
-// UpdateKPIRTP updates KPI RTP
-func (db *Database) UpdateKPIRTP(ctx context.Context) (int64, error) {
-	query := `UPDATE "kpi" 
-			 SET rtp = ((payout / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100) 
-			 WHERE DATE(created_on) = CURRENT_DATE`
+// CreateCampaign inserts an active campaign and returns its id
+func (db *Database) CreateCampaign(ctx context.Context, name, rewardType string, minDeposit, rewardAmount float64, rewardHours, maxPerUser int, startDate, endDate time.Time) (int64, error) {
+	query := `INSERT INTO "campaigns"
+			 (name, reward_type, min_deposit, reward_amount, reward_validity_hours, max_redemptions_per_user, start_date, end_date)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			 RETURNING id`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1136,17 +1992,21 @@ func (db *Database) UpdateKPIRTP(ctx context.Context) (int64, error) {
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query)
+	var id int64
+	err = conn.QueryRow(ctx, query, name, rewardType, minDeposit, rewardAmount, rewardHours, maxPerUser, startDate, endDate).Scan(&id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi rtp: %w", err)
+		return 0, fmt.Errorf("failed to create campaign: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return id, nil
 }
 
-// UpdateKPIVIG updates KPI VIG
-func (db *Database) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "kpi" SET vig = vig + $1 WHERE DATE(created_on) = CURRENT_DATE`
+// UpdateCampaign replaces a campaign's settings
+func (db *Database) UpdateCampaign(ctx context.Context, id int64, name, rewardType string, minDeposit, rewardAmount float64, rewardHours, maxPerUser int, startDate, endDate time.Time, status string) (int64, error) {
+	query := `UPDATE "campaigns"
+			 SET name = $1, reward_type = $2, min_deposit = $3, reward_amount = $4,
+				 reward_validity_hours = $5, max_redemptions_per_user = $6,
+				 start_date = $7, end_date = $8, status = $9
+			 WHERE id = $10 AND status <> 'deleted'`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1154,20 +2014,16 @@ func (db *Database) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, er
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	result, err := conn.Exec(ctx, query, name, rewardType, minDeposit, rewardAmount, rewardHours, maxPerUser, startDate, endDate, status, id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi vig: %w", err)
+		return 0, fmt.Errorf("failed to update campaign: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// UpdateKPIDeposit updates KPI deposit
-func (db *Database) UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "kpi" 
-			 SET handle = handle + $1, 
-				 ggr = handle - payout 
-			 WHERE DATE(created_on) = CURRENT_DATE`
+// DeleteCampaign soft-deletes a campaign so its redemptions keep their reference
+func (db *Database) DeleteCampaign(ctx context.Context, id int64) (int64, error) {
+	query := `UPDATE "campaigns" SET status = 'deleted' WHERE id = $1 AND status <> 'deleted'`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1175,79 +2031,96 @@ func (db *Database) UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	result, err := conn.Exec(ctx, query, id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update kpi deposit: %w", err)
+		return 0, fmt.Errorf("failed to delete campaign: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// CheckGames gets active USSD games
-func (db *Database) CheckGames(ctx context.Context, category string) ([]map[string]interface{}, error) {
-	baseQuery := `SELECT id, name, title, category, name_init, description, bet_amount, boxes, max_win
-                  FROM "Games"
-                  WHERE status = 'active'`
-
-	var args []interface{}
-	if category != "" && category != "all" {
-		baseQuery += " AND category = $1"
-		args = append(args, category)
+// RedeemCampaign records a redemption and credits the reward to the player in
+// one transaction. Bonus rewards become a bonus grant that must be wagered
+// bonusWagering times before it converts to cash. It returns false without granting anything when this
+// transaction was already redeemed (a retried callback) or the player has
+// reached maxPerUser redemptions.
+func (db *Database) RedeemCampaign(ctx context.Context, campaignID int64, msisdn, transactionID, rewardType string, rewardAmount float64, rewardExpiry time.Time, maxPerUser int, bonusWagering float64) (bool, error) {
+	var grantQuery string
+	switch rewardType {
+	case "free_bet":
+		grantQuery = `UPDATE "Player"
+			 SET free_bet = COALESCE(free_bet, 0) + $1,
+				 is_free = 'YES',
+				 freebet_expiry = GREATEST(COALESCE(freebet_expiry, NOW()), $2)
+			 WHERE msisdn = $3`
+	case "bonus":
+		// granted through the bonus ledger below
+	default:
+		return false, fmt.Errorf("unknown reward type %q", rewardType)
 	}
 
-	baseQuery += ` ORDER BY CASE id 
-                 WHEN 10 THEN 1
-                 WHEN 17 THEN 2
-                 WHEN 16 THEN 3 
-                 WHEN 8 THEN 4
-                 WHEN 9 THEN 5
-                 WHEN 12 THEN 6
-                 WHEN 13 THEN 7
-                 WHEN 11 THEN 8
-                 WHEN 14 THEN 9
-                 WHEN 15 THEN 10
-                 ELSE 11
-             END`
-
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, baseQuery, args...)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
-
-	return db.scanRowsToMap(rows)
-}
+	defer tx.Rollback(ctx)
 
-// CheckGameONE gets a specific game by ID
-func (db *Database) CheckGameONE(ctx context.Context, catID string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Games" WHERE id = $1 AND status = 'active' `
+	// Serialise redemptions per campaign and player so two deposits settling
+	// at once cannot both pass the per-user cap
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, int32(campaignID), msisdn); err != nil {
+		return false, fmt.Errorf("failed to lock redemption: %w", err)
+	}
 
-	conn, err := db.pool.Acquire(ctx)
+	var redeemed int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM "campaign_redemptions" WHERE campaign_id = $1 AND msisdn = $2`, campaignID, msisdn).Scan(&redeemed)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, fmt.Errorf("failed to count redemptions: %w", err)
+	}
+	if redeemed >= maxPerUser {
+		return false, nil
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, catID)
+	result, err := tx.Exec(ctx, `INSERT INTO "campaign_redemptions" (campaign_id, msisdn, transaction_id, reward_type, reward_amount)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (campaign_id, transaction_id) DO NOTHING`,
+		campaignID, msisdn, transactionID, rewardType, rewardAmount)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return false, fmt.Errorf("failed to record redemption: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
 	}
-	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+	if rewardType == "bonus" {
+		if _, err := grantBonusTx(ctx, tx, msisdn, rewardAmount, rewardAmount*bonusWagering, rewardExpiry, "campaign", transactionID); err != nil {
+			return false, err
+		}
+	} else {
+		result, err = tx.Exec(ctx, grantQuery, rewardAmount, rewardExpiry, msisdn)
+		if err != nil {
+			return false, fmt.Errorf("failed to grant campaign reward: %w", err)
+		}
+		if result.RowsAffected() == 0 {
+			return false, fmt.Errorf("player %s not found", msisdn)
+		}
+	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit redemption: %w", err)
+	}
+	return true, nil
 }
 
-// CheckGamePlay gets a game by ID
-func (db *Database) CheckGamePlay(ctx context.Context, catID string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Games" WHERE id = $1 `
+// ListMessageTemplates returns every stored template, active or not
+func (db *Database) ListMessageTemplates(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT id, key, language, body, active, date_updated
+		FROM "message_templates"
+		ORDER BY key, language`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1255,20 +2128,18 @@ func (db *Database) CheckGamePlay(ctx context.Context, catID string) (map[string
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, catID)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
-
+	return db.scanRowsToMap(rows)
 }
 
-// CheckSetting gets settings
-func (db *Database) CheckSetting(ctx context.Context) (map[string]interface{}, error) {
-	query := `SELECT * FROM "PawaBox_KeSettings" `
+// GetMessageTemplate returns the active template for key and language
+func (db *Database) GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error) {
+	query := `SELECT key, language, body FROM "message_templates" WHERE key = $1 AND language = $2 AND active`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1276,23 +2147,22 @@ func (db *Database) CheckSetting(ctx context.Context) (map[string]interface{}, e
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query)
+	rows, err := conn.Query(ctx, query, key, language)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
 	return db.scanRowsToSingleMap(rows)
 }
 
-// UpdateUserLucky updates user lucky count
-func (db *Database) UpdateUserLucky(ctx context.Context, msisdn string) (int64, error) {
-	query := `UPDATE "Player" 
-			 SET free_bet_count = free_bet_count + 1,  
-				 freebet_count = freebet_count + 1, 
-				 free_bet = free_bet - 1 
-			 WHERE msisdn = $1 `
+// UpsertMessageTemplate creates or replaces the template for key and language
+func (db *Database) UpsertMessageTemplate(ctx context.Context, key, language, body string, active bool) (int64, error) {
+	query := `INSERT INTO "message_templates" (key, language, body, active)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key, language)
+		DO UPDATE SET body = EXCLUDED.body, active = EXCLUDED.active, date_updated = NOW()
+		RETURNING id`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1300,17 +2170,16 @@ func (db *Database) UpdateUserLucky(ctx context.Context, msisdn string) (int64,
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn)
-	if err != nil {
-		return 0, fmt.Errorf("failed to update user lucky: %w", err)
+	var id int64
+	if err := conn.QueryRow(ctx, query, key, language, body, active).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to save message template: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return id, nil
 }
 
-// UpdateUserLuckyFree updates user free status
-func (db *Database) UpdateUserLuckyFree(ctx context.Context, msisdn string) (int64, error) {
-	query := `UPDATE "Player" SET is_free = 'NO' WHERE msisdn = $1 RETURNING id`
+// DeleteMessageTemplate removes a template so the compiled-in default applies
+func (db *Database) DeleteMessageTemplate(ctx context.Context, key, language string) (int64, error) {
+	query := `DELETE FROM "message_templates" WHERE key = $1 AND language = $2`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1318,61 +2187,64 @@ func (db *Database) UpdateUserLuckyFree(ctx context.Context, msisdn string) (int
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn)
+	result, err := conn.Exec(ctx, query, key, language)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user free status: %w", err)
+		return 0, fmt.Errorf("failed to delete message template: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// UpdateUser updates user field
-func (db *Database) UpdateUser(ctx context.Context, name string, mvalue interface{}, id int64) (int64, error) {
-	// Use parameterized query to prevent SQL injection
-	query := fmt.Sprintf(`UPDATE "Player" SET %s = $1 WHERE id = $2 `, name)
+// ListShortcodes returns every paybill shortcode, active or not
+func (db *Database) ListShortcodes(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT shortcode, label, COALESCE(campaign, '') AS campaign, COALESCE(channel, '') AS channel,
+			is_default, active, date_updated
+		FROM "shortcodes"
+		ORDER BY shortcode`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateUserRTP updates user RTP
-func (db *Database) UpdateUserRTP(ctx context.Context, amount float64, id int64) (int64, error) {
-	query := `UPDATE "Player" 
-			 SET is_free = 'NO', balance = balance - $1, rtp_player = (payout / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100 
-			 WHERE id = $2`
+// UpsertShortcode creates or replaces a shortcode. An empty campaign or
+// channel is stored as NULL. It returns ErrShortcodeConflict when another
+// active shortcode holds the same channel, default or campaign.
+func (db *Database) UpsertShortcode(ctx context.Context, shortcode, label, campaign, channel string, isDefault, active bool) error {
+	query := `INSERT INTO "shortcodes" (shortcode, label, campaign, channel, is_default, active)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		ON CONFLICT (shortcode)
+		DO UPDATE SET label = EXCLUDED.label, campaign = EXCLUDED.campaign, channel = EXCLUDED.channel,
+			is_default = EXCLUDED.is_default, active = EXCLUDED.active, date_updated = NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, amount, id)
+	_, err = conn.Exec(ctx, query, shortcode, label, campaign, channel, isDefault, active)
+	if isUniqueViolation(err) {
+		return ErrShortcodeConflict
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user rtp: %w", err)
+		return fmt.Errorf("failed to save shortcode: %w", err)
 	}
+	return nil
+}
 
-	return result.RowsAffected(), nil
-}
-
-// UpdateUserLossCount updates user loss count
-func (db *Database) UpdateUserLossCount(ctx context.Context, mvalue float64, id int64) (int64, error) {
-	query := `UPDATE "Player" 
-			 SET lost_count = lost_count + 1,
-				 total_loss_count = total_loss_count + 1, 
-				 rtp_player = (payout / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100,
-				 total_losses = total_losses + $1 
-			 WHERE id = $2 `
+// DeleteShortcode removes a shortcode; its past deposits report as unknown
+func (db *Database) DeleteShortcode(ctx context.Context, shortcode string) (int64, error) {
+	query := `DELETE FROM "shortcodes" WHERE shortcode = $1`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1380,111 +2252,135 @@ func (db *Database) UpdateUserLossCount(ctx context.Context, mvalue float64, id
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	result, err := conn.Exec(ctx, query, shortcode)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user loss count: %w", err)
+		return 0, fmt.Errorf("failed to delete shortcode: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// UpdateUserBet updates user bet information
-func (db *Database) UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error) {
-	query := `UPDATE "Player" 
-			 SET monetary = monetary + $1, 
-				 frequency = frequency + 1, 
-				 last_transaction_time = NOW(),
-				 total_bets = total_bets + $2,
-				 recency = EXTRACT(DAY FROM (NOW() - last_transaction_time)),
-				 last_stake_amount = $3 
-			 WHERE id = $4`
-
-	conn, err := db.pool.Acquire(ctx)
+// GetDepositsByShortcode totals the deposits made between start and end per
+// shortcode. known is false for a shortcode missing from "shortcodes".
+func (db *Database) GetDepositsByShortcode(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	query := `SELECT COALESCE(d.shortcode, '') AS shortcode,
+			COALESCE(s.label, '') AS label,
+			COALESCE(s.campaign, '') AS campaign,
+			s.shortcode IS NOT NULL AS known,
+			COUNT(*) AS deposits,
+			COUNT(DISTINCT d.msisdn) AS players,
+			COALESCE(SUM(d.amount), 0)::float8 AS amount
+		FROM "deposit" d
+		LEFT JOIN "shortcodes" s ON s.shortcode = d.shortcode
+		WHERE d.date_created BETWEEN $1 AND $2
+		GROUP BY 1, 2, 3, 4
+		ORDER BY amount DESC, shortcode`
+
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, mvalue, mvalue, id)
+	rows, err := conn.Query(ctx, query, start, end)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update user bet: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// CreateBet creates a new bet
-func (db *Database) CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference, betStatus, betType, gameCatID, gameName, channel string) (int64, error) {
-	query := `INSERT INTO "Bets" 
-			 (game_cat_id, game_name,channel, bet_type, result_status, results, reference, amount, msisdn, selected_number) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,$10)`
+// Refresh token failures
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+)
+
+// InsertRefreshToken stores the hash of a newly issued refresh token
+func (db *Database) InsertRefreshToken(ctx context.Context, msisdn, deviceID, tokenHash string, expiresAt time.Time) error {
+	query := `INSERT INTO "refresh_tokens" (token_hash, msisdn, device_id, expires_at) VALUES ($1, $2, $3, $4)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	resultExec, err := conn.Exec(ctx, query, gameCatID, gameName, channel, betType, betStatus, result, reference, amount, msisdn, selectedChoice)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create bet: %w", err)
+	if _, err := conn.Exec(ctx, query, tokenHash, msisdn, deviceID, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert refresh token: %w", err)
 	}
-
-	return resultExec.RowsAffected(), nil
+	return nil
 }
 
-// InsertVerification inserts a new verification code
-func (db *Database) InsertVerification(ctx context.Context, msisdn, code string, expired int64, created int64) (int64, error) {
-	query := `
-		INSERT INTO verification 
-		(msisdn, code, expired, created)
-		VALUES ($1, $2, $3, $4)
-	`
-
+// RotateRefreshToken swaps a live refresh token for a new one on the same
+// device and returns its msisdn. Presenting an already rotated or revoked
+// token is treated as theft: every live token of that player is revoked and
+// ErrRefreshTokenReused returned.
+func (db *Database) RotateRefreshToken(ctx context.Context, oldHash, deviceID, newHash string, expiresAt time.Time) (string, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return "", fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	resultExec, err := conn.Exec(ctx, query, msisdn, code, expired, created)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert verification code: %w", err)
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return resultExec.RowsAffected(), nil
-}
-
-// RequestSelfExlusion inserts a new verification code
-func (db *Database) RequestSelfExlusion(ctx context.Context, msisdn string, hrs int) (int64, error) {
-	query := `
-		INSERT INTO self_exlusion_request 
-		(msisdn, value_hrs)
-		VALUES ($1, $2)
-	`
-
-	conn, err := db.pool.Acquire(ctx)
+	var (
+		id        int64
+		msisdn    string
+		device    string
+		expired   bool
+		revokedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `SELECT id, msisdn, device_id, expires_at <= NOW(), revoked_at
+		FROM "refresh_tokens"
+		WHERE token_hash = $1
+		FOR UPDATE`, oldHash).Scan(&id, &msisdn, &device, &expired, &revokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrRefreshTokenInvalid
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return "", fmt.Errorf("failed to load refresh token: %w", err)
 	}
-	defer conn.Release()
 
-	resultExec, err := conn.Exec(ctx, query, msisdn, hrs)
+	if revokedAt != nil {
+		if _, err := tx.Exec(ctx, `UPDATE "refresh_tokens" SET revoked_at = NOW() WHERE msisdn = $1 AND revoked_at IS NULL`, msisdn); err != nil {
+			return "", fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("failed to commit revocation: %w", err)
+		}
+		return "", ErrRefreshTokenReused
+	}
+	if expired || device != deviceID {
+		return "", ErrRefreshTokenInvalid
+	}
+
+	var newID int64
+	err = tx.QueryRow(ctx, `INSERT INTO "refresh_tokens" (token_hash, msisdn, device_id, expires_at)
+		VALUES ($1, $2, $3, $4) RETURNING id`, newHash, msisdn, device, expiresAt).Scan(&newID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert self_exlusion_request code: %w", err)
+		return "", fmt.Errorf("failed to insert refresh token: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE "refresh_tokens" SET revoked_at = NOW(), replaced_by = $1 WHERE id = $2`, newID, id); err != nil {
+		return "", fmt.Errorf("failed to rotate refresh token: %w", err)
 	}
 
-	return resultExec.RowsAffected(), nil
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit rotation: %w", err)
+	}
+	return msisdn, nil
 }
 
-// UpdateLuckyBet updates bet result
-func (db *Database) UpdateLuckyBet(ctx context.Context, result, game, reference, betStatus string) (int64, error) {
-	query := `UPDATE "Bets" 
-			 SET result_status = $1, 
-				 status = 'processed', 
-				 results = $2 ,
-				 game = $3
-			 WHERE reference = $4 `
+// RevokeRefreshTokens revokes the player's live refresh tokens on deviceID,
+// or on every device when deviceID is empty
+func (db *Database) RevokeRefreshTokens(ctx context.Context, msisdn, deviceID string) (int64, error) {
+	query := `UPDATE "refresh_tokens" SET revoked_at = NOW()
+		WHERE msisdn = $1 AND revoked_at IS NULL AND ($2 = '' OR device_id = $2)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -1492,575 +2388,896 @@ func (db *Database) UpdateLuckyBet(ctx context.Context, result, game, reference,
 	}
 	defer conn.Release()
 
-	resultExec, err := conn.Exec(ctx, query, betStatus, result, game, reference)
+	result, err := conn.Exec(ctx, query, msisdn, deviceID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update lucky bet: %w", err)
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
 	}
-
-	return resultExec.RowsAffected(), nil
+	return result.RowsAffected(), nil
 }
 
-// UpdateLuckyBetWin updates bet with win amount
-func (db *Database) UpdateLuckyBetWin(ctx context.Context, result, game, reference string, winAmount float64, betStatus string) (int64, error) {
-	query := `UPDATE "Bets" 
-			 SET result_status = $1, 
-				 status = 'processed', 
-				 win_amount = $2, 
-				 results = $3,
-				 game=$4
-			 WHERE reference = $5 `
+// InsertAccessToken records a newly issued access token by its jti
+func (db *Database) InsertAccessToken(ctx context.Context, jti, msisdn string, expiresAt time.Time) error {
+	query := `INSERT INTO "access_tokens" (jti, msisdn, expires_at) VALUES ($1, $2, $3)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	resultExec, err := conn.Exec(ctx, query, betStatus, winAmount, result, game, reference)
-	if err != nil {
-		return 0, fmt.Errorf("failed to update lucky bet win: %w", err)
+	if _, err := conn.Exec(ctx, query, jti, msisdn, expiresAt); err != nil {
+		return fmt.Errorf("failed to insert access token: %w", err)
 	}
-
-	return resultExec.RowsAffected(), nil
+	return nil
 }
 
-// CreateUser creates a new user
-func (db *Database) CreateUser(ctx context.Context, carrier, msisdn string, name string, my_promocode string, promocode string) (int64, error) {
-	query := `INSERT INTO "Player" (carrier, msisdn, name, promocode, my_promocode) VALUES ($1, $2, $3, $4, $5)`
+// AccessTokenRevoked reports whether the access token jti may no longer be
+// used. A jti that was never recorded counts as revoked. It reads the
+// primary so a token is usable as soon as it is issued.
+func (db *Database) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	query := `SELECT revoked_at IS NOT NULL FROM "access_tokens" WHERE jti = $1`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, carrier, msisdn, name, promocode, my_promocode)
+	var revoked bool
+	err = conn.QueryRow(ctx, query, jti).Scan(&revoked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return true, nil
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to create user: %w", err)
+		return false, fmt.Errorf("failed to check access token: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return revoked, nil
 }
 
-func (db *Database) CreatePromo(ctx context.Context, msisdn string, promocode string) (int64, error) {
-	query := `INSERT INTO "promocode" (promocode, msisdn) VALUES ($1, $2)`
+// RevokeAccessToken revokes one access token of msisdn and ends its
+// session. It reports false when the token was unknown or already revoked.
+func (db *Database) RevokeAccessToken(ctx context.Context, msisdn, jti string) (bool, error) {
+	query := `WITH revoked AS (
+			UPDATE "access_tokens" SET revoked_at = NOW()
+			WHERE jti = $1 AND msisdn = $2 AND revoked_at IS NULL
+			RETURNING jti
+		), ended AS (
+			UPDATE "player_sessions" SET revoked_at = NOW()
+			WHERE jti IN (SELECT jti FROM revoked) AND revoked_at IS NULL
+		)
+		SELECT COUNT(*) FROM revoked`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, promocode, msisdn)
-	if err != nil {
-		return 0, fmt.Errorf("failed to promocode user: %w", err)
+	var revoked int64
+	if err := conn.QueryRow(ctx, query, jti, msisdn).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to revoke access token: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return revoked > 0, nil
 }
 
-// CreateUserAttempted creates a new attempted user
-func (db *Database) CreateUserAttempted(ctx context.Context, msisdn string, new_msisdn string) (int64, error) {
-	query := `INSERT INTO "Attempted_Players" ( msisdn, new_msisdn) VALUES ($1,$2) 
-	ON CONFLICT DO NOTHING`
+// RevokeAccessTokens revokes every unexpired access token of msisdn, ends
+// every session and returns the tokens' jtis
+func (db *Database) RevokeAccessTokens(ctx context.Context, msisdn string) ([]string, error) {
+	query := `WITH ended AS (
+			UPDATE "player_sessions" SET revoked_at = NOW()
+			WHERE msisdn = $1 AND revoked_at IS NULL
+		)
+		UPDATE "access_tokens" SET revoked_at = NOW()
+		WHERE msisdn = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING jti`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn, new_msisdn)
+	rows, err := conn.Query(ctx, query, msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create attempted user: %w", err)
+		return nil, fmt.Errorf("failed to revoke access tokens: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	jtis, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+	return jtis, nil
 }
 
-// DeleteUserAttempted deletes attempted user
-func (db *Database) DeleteUserAttempted(ctx context.Context, msisdn string) (int64, error) {
-	query := `DELETE FROM "Attempted_Players" WHERE msisdn = $1`
+// ErrSessionLimit is returned by OpenSession when the player already holds
+// the most live sessions allowed
+var ErrSessionLimit = errors.New("too many active sessions")
 
+// OpenSession records a login of msisdn on the access token jti, and the
+// token itself. The player's live sessions on the same device, by deviceID
+// or else fingerprint, are replaced. When maxSessions is set and the player
+// still holds that many, the oldest are revoked along with their refresh
+// tokens if evictOldest, and ErrSessionLimit is returned otherwise. Returns
+// the jtis of the access tokens revoked.
+func (db *Database) OpenSession(ctx context.Context, msisdn, jti, deviceID, fingerprint string, accessExpiry, expiresAt time.Time, maxSessions int, evictOldest bool) ([]string, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to delete attempted user: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-// CheckJackpotWinner checks for available jackpot winners
-func (db *Database) CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error) {
-	query := `SELECT * FROM "jackpot_kitty" 
-			 WHERE is_locked = 0 AND kitty > 0 AND kitty >= cost AND release_jackpot = 'yes' 
-			 ORDER BY RANDOM() `
+	// Serialise logins per player so two at once cannot both pass maxSessions
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('player_sessions:' || $1))`, msisdn); err != nil {
+		return nil, fmt.Errorf("failed to lock sessions: %w", err)
+	}
 
-	conn, err := db.pool.Acquire(ctx)
+	type liveSession struct {
+		id                  int64
+		jti, device, finger string
+	}
+	rows, err := tx.Query(ctx, `SELECT id, jti, device_id, device_fingerprint FROM "player_sessions"
+		WHERE msisdn = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at`, msisdn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
 	}
-	defer conn.Release()
-	rows, err := conn.Query(ctx, query)
+	live, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (liveSession, error) {
+		var l liveSession
+		err := row.Scan(&l.id, &l.jti, &l.device, &l.finger)
+		return l, err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return nil, fmt.Errorf("failed to load sessions: %w", err)
 	}
-	defer rows.Close()
-
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
-
-}
 
-// GetOTPVerified returns a single verification row that hasn't expired (expired > now)
-func (db *Database) GetOTPVerified(ctx context.Context, msisdn, code string, now int64) (map[string]interface{}, error) {
-	query := `
-		SELECT *
-		FROM verification
-		WHERE msisdn = $1 AND code = $2 AND expired > $3
-		LIMIT 1
-	`
+	var ids []int64
+	var jtis, devices []string
+	others := make([]liveSession, 0, len(live))
+	for _, l := range live {
+		if (deviceID != "" && l.device == deviceID) || (fingerprint != "" && l.finger == fingerprint) {
+			ids, jtis = append(ids, l.id), append(jtis, l.jti)
+			continue
+		}
+		others = append(others, l)
+	}
+	if maxSessions > 0 && len(others) >= maxSessions {
+		if !evictOldest {
+			return nil, ErrSessionLimit
+		}
+		for _, l := range others[:len(others)-maxSessions+1] {
+			ids, jtis = append(ids, l.id), append(jtis, l.jti)
+			if l.device != "" {
+				devices = append(devices, l.device)
+			}
+		}
+	}
 
-	conn, err := db.pool.Acquire(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	if len(ids) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE "player_sessions" SET revoked_at = NOW() WHERE id = ANY($1)`, ids); err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE "access_tokens" SET revoked_at = NOW() WHERE jti = ANY($1) AND revoked_at IS NULL`, jtis); err != nil {
+			return nil, fmt.Errorf("failed to revoke access tokens: %w", err)
+		}
+	}
+	if len(devices) > 0 {
+		if _, err := tx.Exec(ctx, `UPDATE "refresh_tokens" SET revoked_at = NOW()
+			WHERE msisdn = $1 AND device_id = ANY($2) AND revoked_at IS NULL`, msisdn, devices); err != nil {
+			return nil, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn, code, now)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute GetOTPVerified query: %w", err)
+	if _, err := tx.Exec(ctx, `INSERT INTO "access_tokens" (jti, msisdn, expires_at) VALUES ($1, $2, $3)`, jti, msisdn, accessExpiry); err != nil {
+		return nil, fmt.Errorf("failed to insert access token: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "player_sessions" (msisdn, jti, device_id, device_fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, msisdn, jti, deviceID, fingerprint, expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to insert session: %w", err)
 	}
-	defer rows.Close()
 
-	return db.scanRowsToSingleMap(rows)
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit session: %w", err)
+	}
+	return jtis, nil
 }
 
-// GetOTPChecked returns a single verification row with status = 0 (unused)
-func (db *Database) GetOTPChecked(ctx context.Context, msisdn, code string) (map[string]interface{}, error) {
-	query := `
-		SELECT *
-		FROM verification
-		WHERE status = 0 AND msisdn = $1 AND code = $2
-		LIMIT 1
-	`
+// RenewSession moves the live session of msisdn on deviceID to the access
+// token jti issued by a refresh, and extends it to expiresAt. Logins from
+// before sessions were recorded have no row and are left alone.
+func (db *Database) RenewSession(ctx context.Context, msisdn, deviceID, jti string, expiresAt time.Time) error {
+	query := `UPDATE "player_sessions" SET jti = $3, expires_at = $4, last_seen = NOW()
+		WHERE id = (
+			SELECT id FROM "player_sessions"
+			WHERE msisdn = $1 AND device_id = $2 AND device_id <> '' AND revoked_at IS NULL
+			ORDER BY created_at DESC
+			LIMIT 1
+		)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn, code)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute GetOTPChecked query: %w", err)
+	if _, err := conn.Exec(ctx, query, msisdn, deviceID, jti, expiresAt); err != nil {
+		return fmt.Errorf("failed to renew session: %w", err)
 	}
-	defer rows.Close()
-
-	return db.scanRowsToSingleMap(rows)
+	return nil
 }
 
-// UpdateIntoVerification marks the verification as used (status = 1) and returns affected rows
-func (db *Database) UpdateIntoVerification(ctx context.Context, id int32) (int64, error) {
-	query := `UPDATE verification SET status = 1 WHERE id = $1`
+// TouchSession sets last_seen of the live session on access token jti
+func (db *Database) TouchSession(ctx context.Context, jti string) error {
+	query := `UPDATE "player_sessions" SET last_seen = NOW() WHERE jti = $1 AND revoked_at IS NULL`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	res, err := conn.Exec(ctx, query, id)
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute UpdateIntoVerification: %w", err)
+	if _, err := conn.Exec(ctx, query, jti); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
 	}
-
-	return res.RowsAffected(), nil
+	return nil
 }
 
-func (db *Database) UpdateIntoVerificationOld(ctx context.Context, msisdn string) (int64, error) {
-	query := `UPDATE verification SET status = 1 WHERE status = 0 and msisdn = $1`
+// ListSessions returns the live sessions of msisdn, newest first. It reads
+// the primary so a session ended a moment ago is not listed.
+func (db *Database) ListSessions(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	query := `SELECT id, msisdn, jti, device_fingerprint, device_id <> '' AS refreshable,
+			created_at, last_seen, expires_at
+		FROM "player_sessions"
+		WHERE msisdn = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY created_at DESC`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	res, err := conn.Exec(ctx, query, msisdn)
+	rows, err := conn.Query(ctx, query, msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to execute UpdateIntoVerification: %w", err)
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
 	}
-
-	return res.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// CheckBasketLucky checks basket
-func (db *Database) CheckBasketLucky(ctx context.Context) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Basket" `
-
+// RevokeSession ends session id of msisdn, or of any player when msisdn is
+// empty, with its access token and the refresh tokens of its device.
+// Returns the access token's jti, or "" when there is no such live session.
+func (db *Database) RevokeSession(ctx context.Context, msisdn string, id int64) (string, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return "", fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
+	defer tx.Rollback(ctx)
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+	var owner, jti, deviceID string
+	err = tx.QueryRow(ctx, `UPDATE "player_sessions" SET revoked_at = NOW()
+		WHERE id = $1 AND ($2 = '' OR msisdn = $2) AND revoked_at IS NULL
+		RETURNING msisdn, jti, device_id`, id, msisdn).Scan(&owner, &jti, &deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE "access_tokens" SET revoked_at = NOW() WHERE jti = $1 AND revoked_at IS NULL`, jti); err != nil {
+		return "", fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	if deviceID != "" {
+		if _, err := tx.Exec(ctx, `UPDATE "refresh_tokens" SET revoked_at = NOW()
+			WHERE msisdn = $1 AND device_id = $2 AND revoked_at IS NULL`, owner, deviceID); err != nil {
+			return "", fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit session revocation: %w", err)
+	}
+	return jti, nil
 }
 
-// CheckAwardsLuckyRandom gets a random active award by name_init
-func (db *Database) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "awards" WHERE name_init = $1 AND status = 'active' ORDER BY RANDOM() `
+// Bonus grant states
+const (
+	BonusActive    = "active"
+	BonusConverted = "converted"
+	BonusExpired   = "expired"
+)
 
+// bonusCents rounds a wallet amount to cents so split stakes never leave
+// fractions behind
+func bonusCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// GrantBonus adds a bonus grant that converts to cash once wageringRequired
+// has been staked, and returns its id
+func (db *Database) GrantBonus(ctx context.Context, msisdn string, amount, wageringRequired float64, expiresAt time.Time, source, reference string) (int64, error) {
+	if err := money.CheckDelta(money.Adjustment, amount, wageringRequired); err != nil {
+		return 0, fmt.Errorf("failed to grant bonus to %s: %w", msisdn, err)
+	}
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, nameInit)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+	defer tx.Rollback(ctx)
 
+	id, err := grantBonusTx(ctx, tx, msisdn, amount, wageringRequired, expiresAt, source, reference)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit bonus grant: %w", err)
+	}
+	return id, nil
 }
 
-// CheckAwardsLucky gets awards by name_init with value less than win amount
-func (db *Database) CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "awards" WHERE name_init = $1 AND value < $2 AND status = 'active' `
-
-	conn, err := db.pool.Acquire(ctx)
+func grantBonusTx(ctx context.Context, tx pgx.Tx, msisdn string, amount, wageringRequired float64, expiresAt time.Time, source, reference string) (int64, error) {
+	var id int64
+	err := tx.QueryRow(ctx, `INSERT INTO "bonus_grants" (msisdn, amount, balance, wagering_required, source, reference, expires_at)
+		VALUES ($1, $2, $2, $3, $4, NULLIF($5, ''), $6)
+		RETURNING id`,
+		msisdn, bonusCents(amount), bonusCents(wageringRequired), source, reference, expiresAt).Scan(&id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to insert bonus grant: %w", err)
 	}
-	defer conn.Release()
+	if err := syncPlayerBonusTx(ctx, tx, msisdn); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
 
-	rows, err := conn.Query(ctx, query, nameInit, winAmount)
+// syncPlayerBonusTx sets "Player".bonus to the sum of active grant balances
+// and bonus_expiry to the earliest active expiry
+func syncPlayerBonusTx(ctx context.Context, tx pgx.Tx, msisdn string) error {
+	result, err := tx.Exec(ctx, `UPDATE "Player" SET
+			bonus = COALESCE((SELECT SUM(balance) FROM "bonus_grants" WHERE msisdn = $1 AND status = 'active'), 0),
+			bonus_expiry = (SELECT MIN(expires_at) FROM "bonus_grants" WHERE msisdn = $1 AND status = 'active')
+		WHERE msisdn = $1`, msisdn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return fmt.Errorf("failed to sync player bonus: %w", err)
 	}
-	defer rows.Close()
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("player %s not found", msisdn)
+	}
+	return nil
 }
 
-// InsertHouseBasketLogs inserts basket logs
-func (db *Database) InsertHouseBasketLogs(ctx context.Context, credit, debit, mvalue float64, narrative string) (int64, error) {
-	query := `INSERT INTO "BasketLogs" (credit, debit, amount, narrative) VALUES ($1, $2, $3, $4)`
+// expireBonusGrantsTx closes msisdn's active grants past their expiry. The
+// remaining balance is forfeited even when the requirement was partly met.
+func expireBonusGrantsTx(ctx context.Context, tx pgx.Tx, msisdn string) (int64, error) {
+	result, err := tx.Exec(ctx, `UPDATE "bonus_grants"
+		SET status = 'expired', date_closed = NOW()
+		WHERE msisdn = $1 AND status = 'active' AND expires_at <= NOW()`, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire bonus grants: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
 
+// ExpireBonusGrants forfeits msisdn's expired grants and resyncs the player's bonus
+func (db *Database) ExpireBonusGrants(ctx context.Context, msisdn string) (int64, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, credit, debit, mvalue, narrative)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert basket logs: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-// UpdateHouseAviatorHouse updates aviator house income
-func (db *Database) UpdateHouseAviatorHouse(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "Aviator"."HouseIncome" SET house_income = house_income + $1`
+	n, err := expireBonusGrantsTx(ctx, tx, msisdn)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	if err := syncPlayerBonusTx(ctx, tx, msisdn); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit bonus expiry: %w", err)
+	}
+	return n, nil
+}
+
+// DebitStake takes a stake from the player's wallets and returns the cash
+// and bonus parts. With bonusFirst the bonus wallet pays first and cash
+// covers the rest; otherwise the other way round, so a single stake can be
+// split across both. Bonus is taken from the earliest-expiring grants, and
+// the whole stake, cash and bonus alike, counts towards wagering: it fills
+// the earliest-expiring grant's requirement first and the excess carries to
+// the next. Grants whose requirement is met convert their balance to cash
+// in the same transaction. Returns ErrInsufficientBalance when cash and
+// bonus together cannot cover amount.
+func (db *Database) DebitStake(ctx context.Context, msisdn, reference string, amount float64, bonusFirst bool) (float64, float64, error) {
+	return db.DebitStakes(ctx, msisdn, []Stake{{Reference: reference, Amount: amount}}, bonusFirst)
+}
+
+// DebitStakes takes several stakes from the player's wallets in one
+// transaction, as DebitStake does for one: either all are debited or none
+// is. The cash and bonus parts are split across the stakes in proportion to
+// their amounts so each reference's win is credited like a single bet.
+// Returns the total cash and bonus parts.
+func (db *Database) DebitStakes(ctx context.Context, msisdn string, stakes []Stake, bonusFirst bool) (float64, float64, error) {
+	var amount float64
+	for _, st := range stakes {
+		if err := money.CheckDelta(money.Stake, st.Amount); err != nil {
+			return 0, 0, fmt.Errorf("failed to debit stake %s: %w", st.Reference, err)
+		}
+		amount += st.Amount
+	}
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator house income: %w", err)
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-// CheckHousePawaBoxKe gets house income data
-func (db *Database) CheckHousePawaBoxKe(ctx context.Context) (map[string]interface{}, error) {
-	query := `SELECT * FROM "HouseIncome" `
+	var cash float64
+	err = tx.QueryRow(ctx, `SELECT balance::float8 FROM "Player" WHERE msisdn = $1 FOR UPDATE`, msisdn).Scan(&cash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, fmt.Errorf("player %s not found", msisdn)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to lock player: %w", err)
+	}
 
-	log.Printf("Fetching house income data")
+	if _, err := expireBonusGrantsTx(ctx, tx, msisdn); err != nil {
+		return 0, 0, err
+	}
 
-	conn, err := db.pool.Acquire(ctx)
+	rows, err := tx.Query(ctx, `SELECT id, balance::float8 AS balance,
+			wagering_required::float8 AS wagering_required, wagered::float8 AS wagered
+		FROM "bonus_grants"
+		WHERE msisdn = $1 AND status = 'active'
+		ORDER BY expires_at, id
+		FOR UPDATE`, msisdn)
 	if err != nil {
-		log.Printf("Error acquiring connection for house income: %v", err)
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, 0, fmt.Errorf("failed to lock bonus grants: %w", err)
 	}
-	defer conn.Release()
-
-	rows, err := conn.Query(ctx, query)
+	grants, err := db.scanRowsToMap(rows)
 	if err != nil {
-		log.Printf("Error querying house income: %v", err)
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, 0, err
 	}
-	defer rows.Close()
 
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return nil, fmt.Errorf("error reading rows: %w", err)
+	var bonus float64
+	for _, g := range grants {
+		bonus += utils.ToFloat64(g["balance"])
+	}
+	amount = bonusCents(amount)
+	if bonusCents(cash+bonus) < amount {
+		return 0, 0, ErrInsufficientBalance
+	}
+
+	var bonusPart float64
+	if bonusFirst {
+		bonusPart = math.Min(amount, bonus)
+	} else {
+		bonusPart = math.Max(0, amount-math.Max(cash, 0))
+	}
+	bonusPart = bonusCents(bonusPart)
+	cashPart := bonusCents(amount - bonusPart)
+
+	var fundingGrant interface{}
+	toDebit := bonusPart
+	toWager := amount
+	var converted float64
+	for _, g := range grants {
+		id := utils.ToInt64(g["id"])
+		balance := utils.ToFloat64(g["balance"])
+
+		debit := bonusCents(math.Min(toDebit, balance))
+		if debit > 0 && fundingGrant == nil {
+			fundingGrant = id
+		}
+		toDebit = bonusCents(toDebit - debit)
+		balance = bonusCents(balance - debit)
+
+		need := math.Max(0, utils.ToFloat64(g["wagering_required"])-utils.ToFloat64(g["wagered"]))
+		wager := bonusCents(math.Min(toWager, need))
+		toWager = bonusCents(toWager - wager)
+
+		if wager >= bonusCents(need) {
+			// Requirement met: the remaining balance becomes cash
+			converted += balance
+			_, err = tx.Exec(ctx, `UPDATE "bonus_grants"
+				SET balance = 0, wagered = wagered + $1, status = 'converted',
+					converted_amount = $2, date_closed = NOW()
+				WHERE id = $3`, wager, balance, id)
+		} else {
+			_, err = tx.Exec(ctx, `UPDATE "bonus_grants"
+				SET balance = $1, wagered = wagered + $2
+				WHERE id = $3`, balance, wager, id)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to update bonus grant: %w", err)
 		}
-		return nil, nil // No rows found
 	}
+	converted = bonusCents(converted)
 
-	values, err := rows.Values()
+	_, err = tx.Exec(ctx, `UPDATE "Player"
+		SET balance = balance - $1 + $2,
+			bonus_turn_into_real_money = COALESCE(bonus_turn_into_real_money, 0) + $2
+		WHERE msisdn = $3`, cashPart, converted, msisdn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get row values: %w", err)
+		return 0, 0, fmt.Errorf("failed to debit stake: %w", err)
 	}
-
-	fieldDescriptions := rows.FieldDescriptions()
-	result := make(map[string]interface{})
-	for i, fd := range fieldDescriptions {
-		result[string(fd.Name)] = values[i]
+	if err := syncPlayerBonusTx(ctx, tx, msisdn); err != nil {
+		return 0, 0, err
 	}
 
-	log.Printf("House income data fetched successfully")
-	return result, nil
-}
+	// The last stake takes what rounding leaves so the parts add up
+	bonusLeft := bonusPart
+	for i, st := range stakes {
+		stakeBonus := bonusLeft
+		if i < len(stakes)-1 && amount > 0 {
+			stakeBonus = bonusCents(math.Min(bonusLeft, st.Amount*bonusPart/amount))
+		}
+		bonusLeft = bonusCents(bonusLeft - stakeBonus)
 
-// UpdateAviatorDepositRequestLucky updates deposit request to success status
-func (db *Database) UpdateAviatorDepositRequestLucky(ctx context.Context, transactionID, reference, description string) (int64, error) {
-	query := `UPDATE "deposit_requests" 
-	SET status = 'success', transaction_id = $1, description = $2 
-	WHERE reference = $3`
+		_, err = tx.Exec(ctx, `INSERT INTO "bet_funding" (reference, msisdn, cash_amount, bonus_amount, grant_id)
+			VALUES ($1, $2, $3, $4, $5)`, st.Reference, msisdn, bonusCents(st.Amount-stakeBonus), stakeBonus, fundingGrant)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to record bet funding: %w", err)
+		}
+	}
 
-	log.Printf("Updating deposit request to success: ref=%s, transaction_id=%s", reference, transactionID)
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit stake: %w", err)
+	}
+	noteWrite(msisdn)
+	return cashPart, bonusPart, nil
+}
 
+// CreditBonusWin splits a win on reference by how its stake was funded and
+// returns the bonus share, which the caller must not pay out as cash. The
+// share goes back to the funding grant while it is active. If the grant has
+// since converted the share is 0 and the whole win is cash; if it has
+// expired the share is forfeited. A repeated call returns the recorded share.
+func (db *Database) CreditBonusWin(ctx context.Context, reference string, amount float64) (float64, error) {
+	if err := money.CheckDelta(money.Payout, amount); err != nil {
+		return 0, fmt.Errorf("failed to credit win %s: %w", reference, err)
+	}
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for deposit update: %v", err)
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, transactionID, description, reference)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		log.Printf("Error updating deposit request: %v", err)
-		return 0, fmt.Errorf("failed to update deposit request: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Deposit request updated to success: ref=%s, rows_affected=%d", reference, rowsAffected)
+	var (
+		msisdn              string
+		cashPart, bonusPart float64
+		grantID             *int64
+		recorded            *float64
+	)
+	err = tx.QueryRow(ctx, `SELECT msisdn, cash_amount::float8, bonus_amount::float8, grant_id, bonus_win::float8
+		FROM "bet_funding" WHERE reference = $1 FOR UPDATE`, reference).
+		Scan(&msisdn, &cashPart, &bonusPart, &grantID, &recorded)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read bet funding: %w", err)
+	}
+	if recorded != nil {
+		return *recorded, nil
+	}
+	if bonusPart <= 0 || grantID == nil {
+		return 0, nil
+	}
 
-	return rowsAffected, nil
-}
+	share := bonusCents(amount * bonusPart / (cashPart + bonusPart))
 
-// InsertIntoDepositLuckyRequestBonus inserts bonus deposit request
-func (db *Database) InsertIntoDepositLuckyRequestBonus(ctx context.Context, depositType, ussd, game, carrier string, gameCatID string, amount float64, msisdn, selectedBox, reference, channel string) (int64, error) {
-	query := `INSERT INTO "deposit_requests" 
-	(deposit_type, status, transaction_id, description, ussd, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference) 
-	VALUES ($1, 'success', $2, 'Free bets', $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	if _, err := expireBonusGrantsTx(ctx, tx, msisdn); err != nil {
+		return 0, err
+	}
+	var status string
+	err = tx.QueryRow(ctx, `SELECT status FROM "bonus_grants" WHERE id = $1 FOR UPDATE`, *grantID).Scan(&status)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock bonus grant: %w", err)
+	}
 
-	log.Printf("Inserting bonus deposit request: ref=%s, msisdn=%s, amount=%.2f, type=%s",
-		reference, msisdn, amount, depositType)
+	switch status {
+	case BonusActive:
+		if _, err := tx.Exec(ctx, `UPDATE "bonus_grants" SET balance = balance + $1 WHERE id = $2`, share, *grantID); err != nil {
+			return 0, fmt.Errorf("failed to credit bonus grant: %w", err)
+		}
+	case BonusConverted:
+		share = 0
+	}
+	if err := syncPlayerBonusTx(ctx, tx, msisdn); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE "bet_funding" SET bonus_win = $1 WHERE reference = $2`, share, reference); err != nil {
+		return 0, fmt.Errorf("failed to record bonus win: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit bonus win: %w", err)
+	}
+	return share, nil
+}
+
+// ListBonusGrants returns msisdn's grants, newest first
+func (db *Database) ListBonusGrants(ctx context.Context, msisdn string, activeOnly bool) ([]map[string]interface{}, error) {
+	query := `SELECT id, amount::float8 AS amount, balance::float8 AS balance,
+			wagering_required::float8 AS wagering_required, wagered::float8 AS wagered,
+			status, source, converted_amount::float8 AS converted_amount,
+			expires_at, date_created, date_closed
+		FROM "bonus_grants"
+		WHERE msisdn = $1 AND (NOT $2 OR status = 'active')
+		ORDER BY id DESC
+		LIMIT 50`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for bonus deposit: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	params := []interface{}{depositType, reference, ussd, game, carrier, channel, gameCatID, amount, msisdn, selectedBox, reference}
-	result, err := conn.Exec(ctx, query, params...)
+	rows, err := conn.Query(ctx, query, msisdn, activeOnly)
 	if err != nil {
-		log.Printf("Error inserting bonus deposit request: %v", err)
-		return 0, fmt.Errorf("failed to insert bonus deposit request: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Bonus deposit request inserted: ref=%s, rows_affected=%d", reference, rowsAffected)
-
-	return rowsAffected, nil
+	return db.scanRowsToMap(rows)
 }
 
-// InsertIntoDepositLuckyRequestComplete inserts a deposit request similar to the Python async version
-func (db *Database) InsertIntoDepositLuckyRequestComplete(
-	ctx context.Context,
-	transactionID, description, game, carrier, channel, gameCatID string,
-	amount float64,
-	msisdn, selectedBox, reference string,
-) (int64, error) {
+// ErrReversalNotFound is returned when no settled deposit has the reversed transaction id
+var ErrReversalNotFound = errors.New("no settled deposit for reversed transaction")
 
-	query := `INSERT INTO deposit_requests
-        (gateway, status, transaction_id, description, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference)
-        VALUES ('direct deposit', 'success', $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)` // equivalent to MySQL INSERT IGNORE
+const reversalColumns = `id, reversal_reference, transaction_id, msisdn, amount::float8 AS amount,
+	clawed_back::float8 AS clawed_back, debt::float8 AS debt, bet_reference, bet_result,
+	bet_win_amount::float8 AS bet_win_amount, description, date_created`
 
+// ReverseDeposit claws a reversed M-Pesa deposit back from the player in one
+// transaction and returns the deposit_reversals row plus the new "balance".
+// Without allowNegative the claw-back stops at a zero balance and the rest is
+// recorded in "player_debts". The deposit is marked reversed and so is the
+// bet it paid for, whatever its result; a won bet's payout has already gone
+// out, so it is only recorded on the reversal for review. The second return
+// is false when the transaction was already reversed, in which case the
+// earlier reversal is returned unchanged.
+func (db *Database) ReverseDeposit(ctx context.Context, transactionID, reversalReference, description string, allowNegative bool) (map[string]interface{}, bool, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	params := []interface{}{transactionID, description, game, carrier, channel, gameCatID, amount, msisdn, selectedBox, reference}
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
 
-	result, err := conn.Exec(ctx, query, params...)
+	// Locking the deposit first serialises duplicate notifications
+	rows, err := tx.Query(ctx, `SELECT reference, msisdn, amount::float8 AS amount, status
+		FROM "deposit_requests"
+		WHERE transaction_id = $1 AND status IN ($2, $3)
+		LIMIT 1
+		FOR UPDATE`, transactionID, status.DepositSuccess, status.DepositReversed)
 	if err != nil {
-		log.Printf("Error inserting deposit request: %v", err)
-		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
+		return nil, false, fmt.Errorf("failed to lock deposit: %w", err)
+	}
+	deposit, err := db.scanRowsToSingleMap(rows)
+	rows.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	if deposit == nil {
+		return nil, false, ErrReversalNotFound
 	}
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Deposit request inserted: ref=%s, rows_affected=%d", reference, rowsAffected)
+	rows, err = tx.Query(ctx, `SELECT `+reversalColumns+` FROM "deposit_reversals"
+		WHERE transaction_id = $1 OR reversal_reference = $2
+		LIMIT 1`, transactionID, reversalReference)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to check reversals: %w", err)
+	}
+	existing, err := db.scanRowsToSingleMap(rows)
+	rows.Close()
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		return existing, false, nil
+	}
 
-	return rowsAffected, nil
-}
+	msisdn := utils.ToString(deposit["msisdn"])
+	amount := utils.ToFloat64(deposit["amount"])
+	betReference := utils.ToString(deposit["reference"])
 
-// CreateDepositRecordLucky creates a deposit record
-func (db *Database) CreateDepositRecordLucky(ctx context.Context, msisdn string, amount float64, transactionID, shortcode, name, reference, depositType string) (int64, error) {
-	query := `INSERT INTO "deposit" 
-	(deposit_type, msisdn, amount, transaction_id, shortcode, name, mreference) 
-	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	var playerID int64
+	var balance float64
+	err = tx.QueryRow(ctx, `SELECT id, balance::float8 FROM "Player" WHERE msisdn = $1 FOR UPDATE`, msisdn).Scan(&playerID, &balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("player %s not found", msisdn)
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock player: %w", err)
+	}
 
-	log.Printf("Creating deposit record: ref=%s, msisdn=%s, amount=%.2f, type=%s",
-		reference, msisdn, amount, depositType)
+	clawback := amount
+	if !allowNegative {
+		clawback = math.Min(amount, math.Max(balance, 0))
+	}
+	debt := bonusCents(amount - clawback)
 
-	conn, err := db.pool.Acquire(ctx)
+	err = tx.QueryRow(ctx, `UPDATE "Player" SET balance = balance - $1 WHERE id = $2 RETURNING balance::float8`,
+		clawback, playerID).Scan(&balance)
 	if err != nil {
-		log.Printf("Error acquiring connection for deposit record: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, false, fmt.Errorf("failed to claw back deposit: %w", err)
+	}
+	if debt > 0 {
+		if _, err := tx.Exec(ctx, `INSERT INTO "player_debts" (msisdn, amount, reason, reference) VALUES ($1, $2, 'reversal', $3)`,
+			msisdn, debt, reversalReference); err != nil {
+			return nil, false, fmt.Errorf("failed to record debt: %w", err)
+		}
 	}
-	defer conn.Release()
 
-	params := []interface{}{depositType, msisdn, amount, transactionID, shortcode, name, reference}
-	result, err := conn.Exec(ctx, query, params...)
-	if err != nil {
-		log.Printf("Error creating deposit record: %v", err)
-		return 0, fmt.Errorf("failed to create deposit record: %w", err)
+	if _, err := tx.Exec(ctx, `UPDATE "deposit_requests" SET status = $3, description = $2 WHERE transaction_id = $1`,
+		transactionID, "reversed: "+description, status.DepositReversed); err != nil {
+		return nil, false, fmt.Errorf("failed to mark deposit reversed: %w", err)
 	}
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Deposit record created: ref=%s, rows_affected=%d", reference, rowsAffected)
+	var betResult *string
+	var betWin *float64
+	err = tx.QueryRow(ctx, `UPDATE "Bets" SET status = $2 WHERE reference = $1
+		RETURNING result_status, win_amount::float8`, betReference, status.BetReversed).Scan(&betResult, &betWin)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, fmt.Errorf("failed to mark bet reversed: %w", err)
+	}
 
-	return rowsAffected, nil
+	if _, err := tx.Exec(ctx, `INSERT INTO "CustomerLogs" (customer_id, type, narrative, amount, game_id) VALUES ($1, $2, $3, $4, $5)`,
+		utils.ToString(playerID), "reversal", "deposit "+transactionID+" reversed", clawback, reversalReference); err != nil {
+		return nil, false, fmt.Errorf("failed to insert customer logs: %w", err)
+	}
+
+	rows, err = tx.Query(ctx, `INSERT INTO "deposit_reversals"
+			(reversal_reference, transaction_id, msisdn, amount, clawed_back, debt, bet_reference, bet_result, bet_win_amount, description)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, $9, $10)
+		RETURNING `+reversalColumns,
+		reversalReference, transactionID, msisdn, amount, clawback, debt, betReference, betResult, betWin, description)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to record reversal: %w", err)
+	}
+	reversal, err := db.scanRowsToSingleMap(rows)
+	rows.Close()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, false, fmt.Errorf("failed to commit reversal: %w", err)
+	}
+	reversal["balance"] = balance
+	noteWrite(msisdn)
+	return reversal, true, nil
 }
 
-// UpdateHousePawaBoxKeBasket updates basket amount
-func (db *Database) UpdateHousePawaBoxKeBasket(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "Basket" SET amount = amount + $1`
+const webhookSubscriptionColumns = `id, partner_id, target_url, event_types, active, date_created, date_updated`
 
-	log.Printf("Updating basket amount: +%.2f", mvalue)
+// ListWebhookSubscriptions returns every non-deleted subscription without secrets
+func (db *Database) ListWebhookSubscriptions(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + `
+		FROM "webhook_subscriptions"
+		WHERE deleted_at IS NULL
+		ORDER BY id DESC`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for basket update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		log.Printf("Error updating basket: %v", err)
-		return 0, fmt.Errorf("failed to update basket: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Basket updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
-
-	return rowsAffected, nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateHousePawaBoxKeHouse updates house income
-func (db *Database) UpdateHousePawaBoxKeHouse(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "HouseIncome" SET house_income = house_income + $1`
-
-	log.Printf("Updating house income: +%.2f", mvalue)
+// GetWebhookSubscription returns one non-deleted subscription without its secret
+func (db *Database) GetWebhookSubscription(ctx context.Context, id int64) (map[string]interface{}, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM "webhook_subscriptions" WHERE id = $1 AND deleted_at IS NULL`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for house income update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	rows, err := conn.Query(ctx, query, id)
 	if err != nil {
-		log.Printf("Error updating house income: %v", err)
-		return 0, fmt.Errorf("failed to update house income: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("House income updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
-
-	return rowsAffected, nil
+	return db.scanRowsToSingleMap(rows)
 }
 
-// UpdateHouseLucyNumberHouseCurrentRTP updates house current RTP
-func (db *Database) UpdateHouseLucyNumberHouseCurrentRTP(ctx context.Context) (int64, error) {
-	query := `UPDATE "HouseIncome" 
-	SET current_rtp = (total_wins / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100`
-
-	log.Printf("Updating house current RTP")
+// CreateWebhookSubscription adds a partner subscription
+func (db *Database) CreateWebhookSubscription(ctx context.Context, partnerID, targetURL, secret string, eventTypes []string, active bool) (int64, error) {
+	query := `INSERT INTO "webhook_subscriptions" (partner_id, target_url, secret, event_types, active)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for RTP update: %v", err)
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query)
-	if err != nil {
-		log.Printf("Error updating house RTP: %v", err)
-		return 0, fmt.Errorf("failed to update house RTP: %w", err)
+	var id int64
+	if err := conn.QueryRow(ctx, query, partnerID, targetURL, secret, eventTypes, active).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create webhook subscription: %w", err)
 	}
-
-	rowsAffected := result.RowsAffected()
-	log.Printf("House RTP updated, rows_affected=%d", rowsAffected)
-
-	return rowsAffected, nil
+	return id, nil
 }
 
-// UpdateHousePawaBoxKeBets updates house total bets
-func (db *Database) UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "HouseIncome" SET total_bets = total_bets + $1`
-
-	log.Printf("Updating house total bets: +%.2f", mvalue)
+// UpdateWebhookSubscription replaces a subscription's settings. An empty
+// secret keeps the current one.
+func (db *Database) UpdateWebhookSubscription(ctx context.Context, id int64, partnerID, targetURL, secret string, eventTypes []string, active bool) (int64, error) {
+	query := `UPDATE "webhook_subscriptions"
+			 SET partner_id = $1, target_url = $2, secret = COALESCE(NULLIF($3, ''), secret),
+				 event_types = $4, active = $5, date_updated = NOW()
+			 WHERE id = $6 AND deleted_at IS NULL`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for house bets update: %v", err)
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	result, err := conn.Exec(ctx, query, partnerID, targetURL, secret, eventTypes, active, id)
 	if err != nil {
-		log.Printf("Error updating house bets: %v", err)
-		return 0, fmt.Errorf("failed to update house bets: %w", err)
+		return 0, fmt.Errorf("failed to update webhook subscription: %w", err)
 	}
-
-	rowsAffected := result.RowsAffected()
-	log.Printf("House bets updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
-
-	return rowsAffected, nil
+	return result.RowsAffected(), nil
 }
 
-// UpdateCustomerAviator updates aviator customer field
-func (db *Database) UpdateCustomerAviator(ctx context.Context, fieldName string, mvalue interface{}, id int64) (int64, error) {
-	query := fmt.Sprintf(`UPDATE "Aviator"."Customer" SET %s = $1 WHERE id = $2`, fieldName)
+// DeleteWebhookSubscription soft-deletes a subscription so its delivery log
+// stays readable. Its pending events are never claimed again.
+func (db *Database) DeleteWebhookSubscription(ctx context.Context, id int64) (int64, error) {
+	query := `UPDATE "webhook_subscriptions" SET deleted_at = NOW(), active = FALSE WHERE id = $1 AND deleted_at IS NULL`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -2068,21 +3285,24 @@ func (db *Database) UpdateCustomerAviator(ctx context.Context, fieldName string,
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	result, err := conn.Exec(ctx, query, id)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator customer: %w", err)
+		return 0, fmt.Errorf("failed to delete webhook subscription: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// UpdateCustomerAviatorBets updates aviator customer bets
-func (db *Database) UpdateCustomerAviatorBets(ctx context.Context, mvalue float64, id int64) (int64, error) {
-	query := `UPDATE "Aviator"."Customer" 
-			 SET last_stake_time = NOW(), 
-				 bets = bets + 1, 
-				 total_bets = total_bets + $1 
-			 WHERE id = $2`
+// EnqueueWebhookEvent queues payload for every active subscription of the
+// partner msisdn signed up with that listens to eventType. It returns the
+// number of events queued, which is 0 for players without a partner.
+func (db *Database) EnqueueWebhookEvent(ctx context.Context, eventType, msisdn string, payload []byte) (int64, error) {
+	query := `INSERT INTO "webhook_events" (subscription_id, event_type, payload, msisdn)
+		SELECT s.id, $1, $3::jsonb, $2
+		FROM "webhook_subscriptions" s
+		JOIN "Player" p ON p.promocode = s.partner_id
+		WHERE p.msisdn = $2
+		  AND s.active AND s.deleted_at IS NULL
+		  AND $1 = ANY (s.event_types)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -2090,365 +3310,3410 @@ func (db *Database) UpdateCustomerAviatorBets(ctx context.Context, mvalue float6
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	result, err := conn.Exec(ctx, query, eventType, msisdn, string(payload))
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator customer bets: %w", err)
+		return 0, fmt.Errorf("failed to enqueue webhook event: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// UpdateCustomerAviatorWins updates aviator customer wins
-func (db *Database) UpdateCustomerAviatorWins(ctx context.Context, mvalue float64, id int64) (int64, error) {
-	query := `UPDATE "Aviator"."Customer" 
-			 SET win_count = win_count + 1, 
-				 loss_count = 0, 
-				 wins = wins + 1, 
-				 total_wins = total_wins + $1 
-			 WHERE id = $2`
+// ClaimWebhookEvents takes up to limit due events of active subscriptions,
+// counts the attempt and pushes next_attempt_at out by lease so no other
+// dispatcher claims them meanwhile. An event whose delivery is never
+// recorded (the process died) becomes due again when the lease runs out.
+// A player's events reach a subscription in the order they were queued:
+// one waits, due or not, while an earlier one of the same player is still
+// pending, retries included. Events queued before 048 carry no msisdn and
+// are not ordered.
+func (db *Database) ClaimWebhookEvents(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error) {
+	query := `UPDATE "webhook_events" e
+		SET attempts = e.attempts + 1,
+			next_attempt_at = NOW() + make_interval(secs => $2)
+		FROM "webhook_subscriptions" s
+		WHERE s.id = e.subscription_id
+		  AND e.id IN (
+			SELECT id FROM "webhook_events" w
+			WHERE status = $3 AND next_attempt_at <= NOW()
+			  AND subscription_id IN (SELECT id FROM "webhook_subscriptions" WHERE active AND deleted_at IS NULL)
+			  AND NOT EXISTS (
+				SELECT 1 FROM "webhook_events" p
+				WHERE p.subscription_id = w.subscription_id AND p.msisdn = w.msisdn
+				  AND p.status = $3 AND p.id < w.id
+			  )
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		  )
+		RETURNING e.id, e.subscription_id, e.event_type, e.payload::text AS payload,
+			e.attempts, e.date_created, s.target_url, s.secret`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	rows, err := conn.Query(ctx, query, limit, lease.Seconds(), status.WebhookPending)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator customer wins: %w", err)
+		return nil, fmt.Errorf("failed to claim webhook events: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdateCustomerAviatorLosses updates aviator customer losses
-func (db *Database) UpdateCustomerAviatorLosses(ctx context.Context, mvalue float64, id int64) (int64, error) {
-	query := `UPDATE "Aviator"."Customer" 
-			 SET loss_count = loss_count + 1, 
-				 win_count = 0, 
-				 losses = losses + 1, 
-				 total_losses = total_losses + $1 
-			 WHERE id = $2`
-
+// RecordWebhookDelivery logs one delivery attempt and moves the event to
+// state: delivered, failed, or pending again at nextAttemptAt
+func (db *Database) RecordWebhookDelivery(ctx context.Context, eventID int64, attempt, statusCode int, deliveryErr string, elapsed time.Duration, state status.WebhookStatus, nextAttemptAt time.Time) error {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator customer losses: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-// UpdateCustomerWallet updates customer wallet balance
-func (db *Database) UpdateCustomerWallet(ctx context.Context, id int64, mvalue float64) (int64, error) {
-	query := `UPDATE "Aviator"."Customer" SET balance = $1 WHERE id = $2`
-
-	conn, err := db.pool.Acquire(ctx)
+	_, err = tx.Exec(ctx, `INSERT INTO "webhook_deliveries" (event_id, attempt, status_code, error, duration_ms)
+		VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, ''), $5)`,
+		eventID, attempt, statusCode, deliveryErr, elapsed.Milliseconds())
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to record webhook delivery: %w", err)
 	}
-	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, id)
+	_, err = tx.Exec(ctx, `UPDATE "webhook_events"
+		SET status = $1,
+			next_attempt_at = $2,
+			last_error = NULLIF($3, ''),
+			date_delivered = CASE WHEN $1 = $5 THEN NOW() END
+		WHERE id = $4`, state, nextAttemptAt, deliveryErr, eventID, status.WebhookDelivered)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update customer wallet: %w", err)
+		return fmt.Errorf("failed to update webhook event: %w", err)
 	}
 
-	return result.RowsAffected(), nil
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit webhook delivery: %w", err)
+	}
+	return nil
 }
 
-// UpdateCustomerWallet2 updates customer total withdrawal
-func (db *Database) UpdateCustomerWallet2(ctx context.Context, msisdn string, mvalue float64) (int64, error) {
-	query := `UPDATE "Aviator"."Customer" SET total_withdrawal = total_withdrawal + $1 WHERE msisdn = $2`
-
+// ListWebhookDeliveries returns a subscription's delivery attempts, newest
+// first, with the event each belongs to, and the total number of attempts
+func (db *Database) ListWebhookDeliveries(ctx context.Context, subscriptionID int64, limit, offset int) ([]map[string]interface{}, int64, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue, msisdn)
+	var total int64
+	err = conn.QueryRow(ctx, `SELECT COUNT(*)
+		FROM "webhook_deliveries" d
+		JOIN "webhook_events" e ON e.id = d.event_id
+		WHERE e.subscription_id = $1`, subscriptionID).Scan(&total)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update customer wallet2: %w", err)
+		return nil, 0, fmt.Errorf("failed to count webhook deliveries: %w", err)
 	}
 
-	return result.RowsAffected(), nil
-}
-
-// InsertCustomerLogsAviator inserts aviator customer logs
-func (db *Database) InsertCustomerLogsAviator(ctx context.Context, amount float64, logType string, customerID int64, narrative string) (int64, error) {
-	query := `INSERT INTO "Aviator"."CustomerLogs" (customer_id, type, narrative, amount) VALUES ($1, $2, $3, $4)`
-
-	conn, err := db.pool.Acquire(ctx)
+	rows, err := conn.Query(ctx, `SELECT d.id, d.event_id, e.event_type, e.status AS event_status,
+			d.attempt, d.status_code, d.error, d.duration_ms, d.date_created
+		FROM "webhook_deliveries" d
+		JOIN "webhook_events" e ON e.id = d.event_id
+		WHERE e.subscription_id = $1
+		ORDER BY d.id DESC
+		LIMIT $2 OFFSET $3`, subscriptionID, limit, offset)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
 	}
-	defer conn.Release()
+	defer rows.Close()
 
-	result, err := conn.Exec(ctx, query, customerID, logType, narrative, amount)
+	deliveries, err := db.scanRowsToMap(rows)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator customer logs: %w", err)
+		return nil, 0, err
 	}
-
-	return result.RowsAffected(), nil
+	return deliveries, total, nil
 }
 
-// InsertCustomerLogsAviatorGame inserts aviator customer logs with game ID
-func (db *Database) InsertCustomerLogsAviatorGame(ctx context.Context, gameID int64, amount float64, logType string, customerID int64, narrative string) (int64, error) {
-	query := `INSERT INTO "Aviator"."CustomerLogs" (game_id, customer_id, type, narrative, amount) VALUES ($1, $2, $3, $4, $5)`
+// InsertInboundCallback stores a callback from source before it is
+// processed, due at once. A re-delivery of transactionID from the same
+// source stores nothing and reports false with the stored row's id.
+func (db *Database) InsertInboundCallback(ctx context.Context, source, reference, transactionID string, payload []byte) (int64, bool, error) {
+	query := `WITH inserted AS (
+			INSERT INTO "inbound_callbacks" (source, reference, transaction_id, payload)
+			VALUES ($1, $2, $3, $4::jsonb)
+			ON CONFLICT (source, transaction_id) DO NOTHING
+			RETURNING id
+		)
+		SELECT id, TRUE FROM inserted
+		UNION ALL
+		SELECT id, FALSE FROM "inbound_callbacks"
+		WHERE source = $1 AND transaction_id = $3 AND NOT EXISTS (SELECT 1 FROM inserted)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, gameID, customerID, logType, narrative, amount)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator customer logs with game: %w", err)
-	}
-
-	return result.RowsAffected(), nil
-}
-
-// InsertUSSDSession inserts USSD session
-func (db *Database) InsertUSSDSession(ctx context.Context, data map[string]string) (int64, error) {
-	query := `INSERT INTO "Aviator"."ussd_session" (sessionId, serviceCode, msisdn, ussdString) VALUES ($1, $2, $3, $4)`
+	var id int64
+	var inserted bool
+	if err := conn.QueryRow(ctx, query, source, reference, transactionID, string(payload)).Scan(&id, &inserted); err != nil {
+		return 0, false, fmt.Errorf("failed to store inbound callback: %w", err)
+	}
+	return id, inserted, nil
+}
+
+// inboundCallbackClaim counts an attempt on the pending, due callbacks
+// picked by the subquery ($1) and pushes next_attempt_at out by the lease
+// ($2) so no other worker claims them meanwhile. A callback whose outcome
+// is never recorded (the process died) becomes due again when the lease
+// runs out.
+const inboundCallbackClaim = `UPDATE "inbound_callbacks"
+		SET attempts = attempts + 1,
+			next_attempt_at = NOW() + make_interval(secs => $2)
+		WHERE id IN (%s)
+		RETURNING id, source, reference, transaction_id, payload::text AS payload, attempts, received_at`
+
+// ClaimInboundCallback claims callback id for processing, or returns nil
+// when it is not pending and due: processed, failed, or claimed by another
+// worker whose lease has not run out
+func (db *Database) ClaimInboundCallback(ctx context.Context, id int64, lease time.Duration) (map[string]interface{}, error) {
+	query := fmt.Sprintf(inboundCallbackClaim, `SELECT id FROM "inbound_callbacks"
+			WHERE id = $1 AND status = $3 AND next_attempt_at <= NOW()
+			FOR UPDATE SKIP LOCKED`)
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, data["sessionId"], data["serviceCode"], data["msisdn"], data["ussdString"])
+	rows, err := conn.Query(ctx, query, id, lease.Seconds(), status.CallbackPending)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert USSD session: %w", err)
+		return nil, fmt.Errorf("failed to claim inbound callback: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToSingleMap(rows)
 }
 
-// DisburseWithdrawalAviator inserts into withdrawal queue for aviator
-func (db *Database) DisburseWithdrawalAviator(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "luckynumber"."withdrawal_queue_ke" 
-			 (msisdn, amount, client, callback, reference) 
-			 VALUES ($1, $2, 'aviator', 'https://gameapi.strikebet.co.ke/', $3)`
+// ClaimDueInboundCallbacks claims up to limit pending, due callbacks,
+// oldest due first
+func (db *Database) ClaimDueInboundCallbacks(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error) {
+	query := fmt.Sprintf(inboundCallbackClaim, `SELECT id FROM "inbound_callbacks"
+			WHERE status = $3 AND next_attempt_at <= NOW()
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED`)
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn, amount, reference)
+	rows, err := conn.Query(ctx, query, limit, lease.Seconds(), status.CallbackPending)
 	if err != nil {
-		return 0, fmt.Errorf("failed to disburse aviator withdrawal: %w", err)
+		return nil, fmt.Errorf("failed to claim inbound callbacks: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// DisburseWithdrawals inserts into mpesa disburse
-func (db *Database) DisburseWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "mpesa_disburse" 
-			 (transaction_id, reference, amount, msisdn) 
-			 VALUES (uuid(), $1, $2, $3)`
+// RecordInboundCallback moves callback id to state: processed, failed, or
+// pending again at nextAttemptAt
+func (db *Database) RecordInboundCallback(ctx context.Context, id int64, state status.CallbackStatus, nextAttemptAt time.Time, lastError string) error {
+	query := `UPDATE "inbound_callbacks"
+		SET status = $1,
+			next_attempt_at = $2,
+			last_error = NULLIF($3, ''),
+			processed_at = CASE WHEN $1 = $5 THEN NOW() END
+		WHERE id = $4`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, reference, amount, msisdn)
-	if err != nil {
-		return 0, fmt.Errorf("failed to disburse withdrawals: %w", err)
+	if _, err := conn.Exec(ctx, query, state, nextAttemptAt, lastError, id, status.CallbackProcessed); err != nil {
+		return fmt.Errorf("failed to record inbound callback: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return nil
 }
 
-// InsertIntoWithdrawals inserts into aviator withdrawals
-func (db *Database) InsertIntoWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "Aviator"."withdrawals" (reference, amount, msisdn) VALUES ($1, $2, $3)`
-
-	conn, err := db.pool.Acquire(ctx)
+// ListInboundCallbacks returns a page of stored callbacks in status filter, or
+// of every status when it is "", newest first, and how many there are
+func (db *Database) ListInboundCallbacks(ctx context.Context, filter string, limit, offset int) ([]map[string]interface{}, int64, error) {
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, reference, amount, msisdn)
+	var total int64
+	err = conn.QueryRow(ctx, `SELECT COUNT(*) FROM "inbound_callbacks"
+		WHERE $1 = '' OR status = $1`, filter).Scan(&total)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert into withdrawals: %w", err)
+		return nil, 0, fmt.Errorf("failed to count inbound callbacks: %w", err)
 	}
 
-	return result.RowsAffected(), nil
-}
-
-// InsertIntoWithdrawalsLucky inserts into pawa box withdrawals
-func (db *Database) InsertIntoWithdrawalsLucky(ctx context.Context, nonAmount, amount, withholdTax float64, items string, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "withdrawals" 
-			 (non_roundoff_amount, tax_amount, items, game_id, reference, amount, msisdn) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7)`
-
-	conn, err := db.pool.Acquire(ctx)
+	rows, err := conn.Query(ctx, `SELECT id, source, reference, transaction_id, payload::text AS payload,
+			status, attempts, next_attempt_at, last_error, received_at, processed_at
+		FROM "inbound_callbacks"
+		WHERE $1 = '' OR status = $1
+		ORDER BY received_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, filter, limit, offset)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
 	}
-	defer conn.Release()
+	defer rows.Close()
 
-	result, err := conn.Exec(ctx, query, nonAmount, withholdTax, items, reference, reference, amount, msisdn)
+	callbacks, err := db.scanRowsToMap(rows)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert into lucky withdrawals: %w", err)
+		return nil, 0, err
 	}
-
-	return result.RowsAffected(), nil
+	return callbacks, total, nil
 }
 
-// InsertIntoJackPotWinners inserts jackpot winners
-func (db *Database) InsertIntoJackPotWinners(ctx context.Context, taxAmount float64, items string, gameID string, gameName, jackpotCategory string, kittyID string, amount float64, msisdn string) (int64, error) {
-	query := `INSERT INTO "jackpot_winners" 
-			 (tax_amount, items, game_id, game_name, jackpot_category, kitty_id, amount, msisdn, awarded) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'yes')`
+// RequeueInboundCallback puts failed callback id back on the queue, due at
+// once with its attempts reset. It returns the status id had, requeued only
+// when that is failed, or "" when there is no such callback.
+func (db *Database) RequeueInboundCallback(ctx context.Context, id int64) (status.CallbackStatus, error) {
+	query := `WITH prev AS (
+			SELECT id, status FROM "inbound_callbacks" WHERE id = $1 FOR UPDATE
+		), requeued AS (
+			UPDATE "inbound_callbacks" c
+			SET status = $2, attempts = 0, next_attempt_at = NOW()
+			FROM prev
+			WHERE c.id = prev.id AND prev.status = $3
+		)
+		SELECT status FROM prev`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return "", fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, taxAmount, items, gameID, gameName, jackpotCategory, kittyID, amount, msisdn)
+	var prev string
+	err = conn.QueryRow(ctx, query, id, status.CallbackPending, status.CallbackFailed).Scan(&prev)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert jackpot winners: %w", err)
+		return "", fmt.Errorf("failed to requeue inbound callback: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return status.CallbackStatus(prev), nil
 }
 
-// InsertIntoPendingWithdrawalsLucky inserts into pending withdrawals
-func (db *Database) InsertIntoPendingWithdrawalsLucky(ctx context.Context, amount, taxAmount float64, items, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "pending_withdrawals" 
-			 (tax_amount, items, reference, amount, msisdn) 
-			 VALUES ($1, $2, $3, $4, $5)`
+// Transfer failures the service maps to player-facing messages
+var (
+	ErrTransferSender      = errors.New("sender not found or inactive")
+	ErrTransferRecipient   = errors.New("recipient not found or unavailable")
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrTransferLimit       = errors.New("daily transfer limit reached")
+)
 
+// TransferBalance moves amount from one player's balance to another's in a
+// single transaction and returns both new balances. Both Player rows are
+// locked in id order, so concurrent transfers between the same players can
+// neither deadlock nor overdraw; any failure rolls the debit back. Daily
+// caps come from "PawaBox_KeSettings" and are checked under the same lock.
+func (db *Database) TransferBalance(ctx context.Context, from, to string, amount float64, reference string) (float64, float64, error) {
+	if err := money.CheckDelta(money.Transfer, amount); err != nil {
+		return 0, 0, fmt.Errorf("failed to transfer %s: %w", reference, err)
+	}
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, taxAmount, items, reference, amount, msisdn)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert pending withdrawals: %w", err)
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	return result.RowsAffected(), nil
-}
-
-// InsertIntoDepositRequest inserts into deposit requests
-func (db *Database) InsertIntoDepositRequest(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
-	query := `INSERT INTO "Aviator"."deposit_requests" (amount, msisdn, reference) VALUES ($1, $2, $3)`
-
-	conn, err := db.pool.Acquire(ctx)
+	rows, err := tx.Query(ctx, `SELECT id::text AS id, msisdn,
+			COALESCE(active_status, 'active') <> 'inactive'
+				AND NOT (COALESCE(self_exclusion, 'NO') = 'YES' AND COALESCE(self_exclusion_expiry, NOW()) > NOW()) AS available
+		FROM "Player"
+		WHERE msisdn IN ($1, $2)
+		ORDER BY id
+		FOR UPDATE`, from, to)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, 0, fmt.Errorf("failed to lock players: %w", err)
 	}
-	defer conn.Release()
-
-	result, err := conn.Exec(ctx, query, amount, msisdn, reference)
+	players, err := db.scanRowsToMap(rows)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
+		return 0, 0, err
 	}
 
-	return result.RowsAffected(), nil
-}
+	var sender, recipient map[string]interface{}
+	for _, p := range players {
+		switch p["msisdn"] {
+		case from:
+			sender = p
+		case to:
+			recipient = p
+		}
+	}
+	if sender == nil || sender["available"] != true {
+		return 0, 0, ErrTransferSender
+	}
+	if recipient == nil || recipient["available"] != true {
+		return 0, 0, ErrTransferRecipient
+	}
 
-// CheckWithdrawalsPawaBoxKe checks pending withdrawals
-func (db *Database) CheckWithdrawalsPawaBoxKe(ctx context.Context, reference string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "withdrawals" WHERE status = 'pending' AND reference = $1 `
+	var sentCount int64
+	var sentAmount, dailyLimit float64
+	var dailyCount int64
+	err = tx.QueryRow(ctx, `SELECT
+			(SELECT COUNT(*) FROM "transfers" WHERE sender = $1 AND date_created >= `+startOfToday()+`)::bigint,
+			(SELECT COALESCE(SUM(amount), 0) FROM "transfers" WHERE sender = $1 AND date_created >= `+startOfToday()+`)::float8,
+			COALESCE((SELECT transfer_daily_limit FROM "PawaBox_KeSettings" LIMIT 1), 0)::float8,
+			COALESCE((SELECT transfer_daily_count FROM "PawaBox_KeSettings" LIMIT 1), 0)::bigint`,
+		from).Scan(&sentCount, &sentAmount, &dailyLimit, &dailyCount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check transfer limits: %w", err)
+	}
+	if (dailyCount > 0 && sentCount+1 > dailyCount) || (dailyLimit > 0 && sentAmount+amount > dailyLimit) {
+		return 0, 0, ErrTransferLimit
+	}
 
-	conn, err := db.pool.Acquire(ctx)
+	var fromBalance, toBalance float64
+	err = tx.QueryRow(ctx, `UPDATE "Player" SET balance = balance - $1
+		WHERE msisdn = $2 AND balance >= $1
+		RETURNING balance::float8`, amount, from).Scan(&fromBalance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, ErrInsufficientBalance
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, 0, fmt.Errorf("failed to debit sender: %w", err)
 	}
-	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, reference)
+	err = tx.QueryRow(ctx, `UPDATE "Player" SET balance = balance + $1
+		WHERE msisdn = $2
+		RETURNING balance::float8`, amount, to).Scan(&toBalance)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, 0, fmt.Errorf("failed to credit recipient: %w", err)
 	}
-	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+	if _, err := tx.Exec(ctx, `INSERT INTO "transfers" (reference, sender, recipient, amount) VALUES ($1, $2, $3, $4)`,
+		reference, from, to, amount); err != nil {
+		return 0, 0, fmt.Errorf("failed to record transfer: %w", err)
+	}
 
-}
+	logQuery := `INSERT INTO "CustomerLogs" (customer_id, type, narrative, amount, game_id) VALUES ($1, $2, $3, $4, $5)`
+	if _, err := tx.Exec(ctx, logQuery, sender["id"], "transfer_out", "transfer to "+to, amount, reference); err != nil {
+		return 0, 0, fmt.Errorf("failed to insert customer logs: %w", err)
+	}
+	if _, err := tx.Exec(ctx, logQuery, recipient["id"], "transfer_in", "transfer from "+from, amount, reference); err != nil {
+		return 0, 0, fmt.Errorf("failed to insert customer logs: %w", err)
+	}
 
-// CheckUSSDSession checks USSD session
-func (db *Database) CheckUSSDSession(ctx context.Context, sessionID string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Aviator"."ussd_session" WHERE sessionId = $1 `
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit transfer: %w", err)
+	}
+	noteWrite(from)
+	noteWrite(to)
+	return fromBalance, toBalance, nil
+}
 
+// WithdrawBalance takes amount from msisdn's balance and queues it for
+// disbursement under reference, returning the new balance. The Player row
+// is locked first, so the withdrawals counted against limits cannot change
+// before the debit; a *WithdrawalVelocityError refuses one that would pass
+// them.
+func (db *Database) WithdrawBalance(ctx context.Context, msisdn string, amount float64, reference string, limits WithdrawalLimits) (float64, error) {
+	if err := money.CheckDelta(money.Payout, amount); err != nil {
+		return 0, fmt.Errorf("failed to withdraw %s: %w", reference, err)
+	}
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, sessionID)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
 	}
-	defer rows.Close()
-
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
-
-}
-
-// InsertHouseLogsAviator inserts aviator house logs
-func (db *Database) InsertHouseLogsAviator(ctx context.Context, fieldName, msisdn string, mvalue float64) (int64, error) {
-	query := fmt.Sprintf(`INSERT INTO "Aviator"."HouseIncomeLogs" (msisdn, %s) VALUES ($1, $2)`, fieldName)
+	defer tx.Rollback(ctx)
 
-	conn, err := db.pool.Acquire(ctx)
+	playerID, err := checkWithdrawal(ctx, tx, msisdn, amount, limits, "FOR UPDATE")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, err
 	}
-	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, msisdn, mvalue)
+	var balance float64
+	err = tx.QueryRow(ctx, `UPDATE "Player" SET balance = balance - $1
+		WHERE msisdn = $2 AND balance >= $1
+		RETURNING balance::float8`, amount, msisdn).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrInsufficientBalance
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator house logs: %w", err)
+		return 0, fmt.Errorf("failed to debit player: %w", err)
 	}
 
-	return result.RowsAffected(), nil
-}
+	if _, err := tx.Exec(ctx, `INSERT INTO "balance_withdrawals" (reference, msisdn, amount) VALUES ($1, $2, $3)`,
+		reference, msisdn, amount); err != nil {
+		return 0, fmt.Errorf("failed to record withdrawal: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "withdrawals" (non_roundoff_amount, tax_amount, items, game_id, reference, amount, msisdn)
+		VALUES ($1, 0, $4, $2, $2, $1, $3)`, amount, reference, msisdn, WithdrawalItemsBalance); err != nil {
+		return 0, fmt.Errorf("failed to insert withdrawal: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "withdrawal_queue_ke" (reference, msisdn, amount, callback) VALUES ($1, $2, $3, 'http?')`,
+		reference, msisdn, amount); err != nil {
+		return 0, fmt.Errorf("failed to insert withdrawal queue: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "CustomerLogs" (customer_id, type, narrative, amount, game_id) VALUES ($1, $2, $3, $4, $5)`,
+		playerID, "withdrawal", "balance withdrawal", amount, reference); err != nil {
+		return 0, fmt.Errorf("failed to insert customer logs: %w", err)
+	}
 
-// InsertHouseLogsAviatorGameID inserts aviator house logs with game ID
-func (db *Database) InsertHouseLogsAviatorGameID(ctx context.Context, gameID int64, fieldName, msisdn string, mvalue float64) (int64, error) {
-	query := fmt.Sprintf(`INSERT INTO "Aviator"."HouseIncomeLogs" (game_id, msisdn, %s) VALUES ($1, $2, $3)`, fieldName)
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit withdrawal: %w", err)
+	}
+	noteWrite(msisdn)
+	return balance, nil
+}
 
+// CheckBalanceWithdrawal returns the error WithdrawBalance would refuse msisdn's
+// withdrawal of amount with now, or nil. Nothing is locked, so
+// WithdrawBalance checks again; this lets a caller refuse a withdrawal
+// before spending anything on it, such as the player's OTP.
+func (db *Database) CheckBalanceWithdrawal(ctx context.Context, msisdn string, amount float64, limits WithdrawalLimits) error {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, gameID, msisdn, mvalue)
-	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator house logs with game: %w", err)
-	}
+	_, err = checkWithdrawal(ctx, conn, msisdn, amount, limits, "")
+	return err
+}
 
-	return result.RowsAffected(), nil
+// rowQuerier is a pool connection or a transaction
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
 }
 
-// CheckUSSDSessionLogs checks USSD session logs
+// checkWithdrawal reads msisdn's Player row, with lock appended to the
+// SELECT, and refuses amount when the player is unavailable, the velocity
+// limits would be passed or the balance is short. It returns the player id.
+func checkWithdrawal(ctx context.Context, q rowQuerier, msisdn string, amount float64, limits WithdrawalLimits, lock string) (string, error) {
+	var playerID string
+	var available bool
+	var balance float64
+	err := q.QueryRow(ctx, `SELECT id::text,
+			COALESCE(active_status, 'active') <> 'inactive'
+				AND NOT (COALESCE(self_exclusion, 'NO') = 'YES' AND COALESCE(self_exclusion_expiry, NOW()) > NOW()),
+			COALESCE(balance, 0)::float8
+		FROM "Player"
+		WHERE msisdn = $1
+		`+lock, msisdn).Scan(&playerID, &available, &balance)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !available) {
+		return "", ErrWithdrawalPlayer
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read player: %w", err)
+	}
+
+	var count int64
+	var total float64
+	err = q.QueryRow(ctx, `SELECT COUNT(*)::bigint, COALESCE(SUM(amount), 0)::float8
+		FROM "balance_withdrawals"
+		WHERE msisdn = $1 AND date_created >= $2`, msisdn, limits.Since).Scan(&count, &total)
+	if err != nil {
+		return "", fmt.Errorf("failed to check withdrawal limits: %w", err)
+	}
+	if err := limits.Check(count, total, amount); err != nil {
+		return "", err
+	}
+	if balance < amount {
+		return "", ErrInsufficientBalance
+	}
+	return playerID, nil
+}
+
+func (db *Database) GetOnlineUsers(ctx context.Context) ([]map[string]interface{}, error) {
+	var query string
+	var args []interface{}
+
+	// No date filter
+	query = `SELECT 
+				COUNT(DISTINCT c.customer_id) AS online_users
+			FROM "CustomerLogs" c
+			INNER JOIN "Player" p 
+				ON c.customer_id = p.id::text
+			WHERE  
+				c.date_created >= NOW() - INTERVAL '1 hour';`
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+func (db *Database) CheckDeposits(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error) {
+	var query string
+	var args []interface{}
+
+	args = append(args, msisdn) // $1 for msisdn
+
+	if !startDate.IsZero() && !endDate.IsZero() {
+		// Filter by date range
+		query = `SELECT * 
+		         FROM "deposit" 
+		         WHERE msisdn = $1 
+		           AND date_created BETWEEN $2 AND $3
+		         ORDER BY id DESC LIMIT 100`
+		args = append(args, startDate, endDate) // $2, $3
+	} else {
+		// No date filter
+		query = `SELECT * 
+		         FROM "deposit" 
+		         WHERE msisdn = $1 
+		         ORDER BY id DESC LIMIT 10`
+	}
+
+	conn, err := db.readConn(ctx, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// CheckBets gets user's bets
+func (db *Database) CheckBets(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	query := `SELECT * FROM "Bets" WHERE msisdn = $1 ORDER BY id DESC `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// CheckBettoBet checks recent bets within 1 minute
+func (db *Database) CheckBettoBet(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	query := `SELECT * FROM "Bets" WHERE msisdn = $1 AND date_created >= NOW() - INTERVAL '1 minute' ORDER BY id DESC `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// CheckJackpotWinnerKitty gets recent jackpot winners
+func (db *Database) CheckJackpotWinnerKitty(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	query := `SELECT msisdn FROM "jackpot_winners" ORDER BY id DESC LIMIT 3`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// ErrKPIRowMissing is returned when today's kpi row could not be created or updated
+var ErrKPIRowMissing = errors.New("kpi row for today is missing")
+
+// kpiDay remembers the day this process last ensured a kpi row exists, so the
+// upsert costs one extra query per day rather than one per bet
+var kpiDay struct {
+	mu   sync.Mutex
+	date string
+}
+
+// UpdateKPI makes sure today's kpi row exists
+func (db *Database) UpdateKPI(ctx context.Context) (int64, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	return upsertTodayKPI(ctx, conn)
+}
+
+// execer is the part of a pooled connection the kpi upsert needs
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// upsertTodayKPI inserts today's kpi row; concurrent creators are absorbed by
+// the unique index on kpi.date (database/migrations/001_kpi_date_unique.sql)
+func upsertTodayKPI(ctx context.Context, conn execer) (int64, error) {
+	query := `INSERT INTO "kpi" (date, handle, payout, ggr)
+			 VALUES (` + today() + `, 0, 0, 0)
+			 ON CONFLICT (date) DO NOTHING`
+
+	result, err := conn.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert kpi: %w", err)
+	}
+
+	kpiDay.mu.Lock()
+	kpiDay.date = clock.Now().Format("2006-01-02")
+	kpiDay.mu.Unlock()
+
+	return result.RowsAffected(), nil
+}
+
+// execKPI runs an UPDATE against today's kpi row, creating the row first when
+// this process hasn't seen today yet. If nothing was updated (e.g. the
+// process and database disagree on the date around midnight) the row is
+// upserted and the update retried once before giving up with ErrKPIRowMissing.
+func execKPI(ctx context.Context, conn execer, query string, args ...interface{}) (int64, error) {
+	kpiDay.mu.Lock()
+	seen := kpiDay.date == clock.Now().Format("2006-01-02")
+	kpiDay.mu.Unlock()
+
+	if !seen {
+		if _, err := upsertTodayKPI(ctx, conn); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err := conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if result.RowsAffected() > 0 {
+		return result.RowsAffected(), nil
+	}
+
+	if _, err := upsertTodayKPI(ctx, conn); err != nil {
+		return 0, err
+	}
+	result, err = conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	if result.RowsAffected() == 0 {
+		return 0, ErrKPIRowMissing
+	}
+	return result.RowsAffected(), nil
+}
+
+// UpdateJackpotKit pays the jackpot slice of bet reference into the
+// generic kitties (empty name_init)
+func (db *Database) UpdateJackpotKit(ctx context.Context, reference string, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kit: %w", err)
+	}
+	n, err := db.contributeJackpot(ctx, reference, mvalue, "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kitty: %w", err)
+	}
+	return n, nil
+}
+
+// UpdateJackpotKitNameInit pays the jackpot slice of bet reference into the
+// kitties of game nameInit
+func (db *Database) UpdateJackpotKitNameInit(ctx context.Context, reference string, mvalue float64, nameInit string) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kit %s: %w", nameInit, err)
+	}
+	if nameInit == "" {
+		return 0, nil
+	}
+	n, err := db.contributeJackpot(ctx, reference, mvalue, nameInit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+	}
+	return n, nil
+}
+
+// contributeJackpot resolves the kitties with name_init, locks them by id in
+// id order, adds each one's pct_slice of mvalue and books it in
+// jackpot_contributions, all in one statement. A kitty locked for a payout
+// (is_locked = 1), or that becomes locked while this waits for its row, is
+// skipped. Returns the number of kitties paid into.
+func (db *Database) contributeJackpot(ctx context.Context, reference string, mvalue float64, nameInit string) (int64, error) {
+	query := `WITH kitties AS (
+			SELECT id, $2 * (pct_slice / 100) AS amount
+			FROM "jackpot_kitty"
+			WHERE name_init = $3 AND is_locked = 0
+			ORDER BY id
+			FOR UPDATE
+		), paid AS (
+			UPDATE "jackpot_kitty" k
+			SET kitty = k.kitty + c.amount,
+				pct_to_target = ((k.kitty + c.amount) / k.cost) * 100
+			FROM kitties c
+			WHERE k.id = c.id
+			RETURNING k.id, c.amount
+		)
+		INSERT INTO "jackpot_contributions" (reference, kitty_id, amount, kind)
+		SELECT $1, id, amount, 'contribution' FROM paid`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, reference, mvalue, nameInit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+// UpdateJackpotKity takes kitty id's cost out for the jackpot win of bet
+// reference, unlocks it and books the payout in jackpot_contributions
+func (db *Database) UpdateJackpotKity(ctx context.Context, id int, reference string) (int64, error) {
+	query := `WITH paid AS (
+			UPDATE "jackpot_kitty"
+			SET is_locked = 0 ,kitty = kitty-cost, win_count = win_count+ 1
+			WHERE id = $1
+			RETURNING id, cost
+		)
+		INSERT INTO "jackpot_contributions" (reference, kitty_id, amount, kind)
+		SELECT $2, id, cost, 'payout' FROM paid`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, id, reference)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (db *Database) UpdatePlayerRestLossJackpot(ctx context.Context, cost float64, id int) (int64, error) {
+	query := `UPDATE "Player"
+			 SET jackpot_amount = jackpot_amount + $1, lost_count = 0, lost_since = NULL
+			 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, cost, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (db *Database) UpdateJackpotKitUpdate(ctx context.Context, id int) (int64, error) {
+	query := `UPDATE "jackpot_kitty"
+			 SET is_locked = 1 
+			 WHERE id = $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update jackpot kitty with name_init: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateKPIHandle updates KPI handle
+func (db *Database) UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update kpi handle: %w", err)
+	}
+	query := `UPDATE "kpi"
+             SET bet_count = bet_count + 1,
+                 bet = bet + $1,
+                 rtp = ((payout / CASE WHEN bet + $1 = 0 THEN 1 ELSE bet + $1 END) * 100)
+             WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Only pass mvalue once since all placeholders are $1
+	rowsAffected, err := execKPI(ctx, conn, query, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi handle: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// CheckSettingKPI gets KPI settings
+func (db *Database) CheckSettingKPI(ctx context.Context) (map[string]interface{}, error) {
+	query := checkSettingKPIQuery()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// UpdateKPIPayouts updates KPI payouts
+func (db *Database) UpdateKPIPayouts(ctx context.Context, mvalue, withTaxAmount, exciseTaxAmount float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue, withTaxAmount, exciseTaxAmount); err != nil {
+		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+	}
+	query := `UPDATE "kpi"  
+			 SET withholding_tax_amount = withholding_tax_amount + $1, 
+				 excise_duty_tax_amount = excise_duty_tax_amount + $2, 
+				 rtp = (((payout + $3) / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100), 
+				 ggr = handle - (payout + $4), 
+				 payout = payout + $5 
+			 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, withTaxAmount, exciseTaxAmount, mvalue, mvalue, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateKPIPayouts updates KPI payouts
+func (db *Database) UpdateKPIPayoutSPIN(ctx context.Context, exciseTaxAmount float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, exciseTaxAmount); err != nil {
+		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+	}
+	query := `UPDATE "kpi"  
+			 SET 
+				 excise_duty_tax_amount = excise_duty_tax_amount + $1, 
+				 rtp = (((payout) / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100), 
+				 ggr = handle - (payout)
+			 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, exciseTaxAmount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi payouts: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateKPIRTP updates KPI RTP
+func (db *Database) UpdateKPIRTP(ctx context.Context) (int64, error) {
+	query := `UPDATE "kpi" 
+			 SET rtp = ((payout / CASE WHEN bet = 0 THEN 1 ELSE bet END) * 100) 
+			 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi rtp: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateKPIVIG updates KPI VIG
+func (db *Database) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update kpi vig: %w", err)
+	}
+	query := `UPDATE "kpi" SET vig = vig + $1 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi vig: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateKPIFreeBetStake books a free bet's stake as free-bet cost. Free
+// bets bring in no cash, so they stay out of bet/handle and excise.
+func (db *Database) UpdateKPIFreeBetStake(ctx context.Context, stake float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, stake); err != nil {
+		return 0, fmt.Errorf("failed to update kpi free bet stake: %w", err)
+	}
+	query := `UPDATE "kpi"
+			 SET free_bet_count = free_bet_count + 1,
+				 free_bet_stake = free_bet_stake + $1
+			 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, stake)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi free bet stake: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// UpdateKPIChannelHandle adds one bet's stake to today's kpi_by_channel row
+// for channel. The upsert creates the row, so it needs no execKPI retry.
+func (db *Database) UpdateKPIChannelHandle(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update kpi handle for %s: %w", channel, err)
+	}
+	query := `INSERT INTO "kpi_by_channel" (date, channel, handle, bet_count)
+			 VALUES (` + today() + `, $1, $2, 1)
+			 ON CONFLICT (date, channel) DO UPDATE
+			 SET handle = "kpi_by_channel".handle + EXCLUDED.handle,
+				 bet_count = "kpi_by_channel".bet_count + 1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, channel, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi by channel handle: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateKPIChannelPayout adds a win to today's kpi_by_channel row for channel
+func (db *Database) UpdateKPIChannelPayout(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update kpi payout for %s: %w", channel, err)
+	}
+	query := `INSERT INTO "kpi_by_channel" (date, channel, payout)
+			 VALUES (` + today() + `, $1, $2)
+			 ON CONFLICT (date, channel) DO UPDATE
+			 SET payout = "kpi_by_channel".payout + EXCLUDED.payout`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, channel, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi by channel payout: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// AddGameDailyExposure adds a win to today's game_daily_exposure row for
+// gameCatID and returns the game's exposure for the day including it. The
+// upsert makes concurrent wins add up; a new day starts a new row.
+func (db *Database) AddGameDailyExposure(ctx context.Context, gameCatID string, mvalue float64) (float64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to add daily exposure for game %s: %w", gameCatID, err)
+	}
+	query := `INSERT INTO "game_daily_exposure" (date, game_cat_id, exposure, win_count)
+			 VALUES (` + today() + `, $1, $2, 1)
+			 ON CONFLICT (date, game_cat_id) DO UPDATE
+			 SET exposure = "game_daily_exposure".exposure + EXCLUDED.exposure,
+				 win_count = "game_daily_exposure".win_count + 1
+			 RETURNING exposure::float8`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var exposure float64
+	if err := conn.QueryRow(ctx, query, gameCatID, mvalue).Scan(&exposure); err != nil {
+		return 0, fmt.Errorf("failed to add daily exposure for game %s: %w", gameCatID, err)
+	}
+	return exposure, nil
+}
+
+// GetGameDailyExposure returns what gameCatID has paid out in wins today.
+// It reads the primary, as the cap check must see the latest wins.
+func (db *Database) GetGameDailyExposure(ctx context.Context, gameCatID string) (float64, error) {
+	query := `SELECT COALESCE((SELECT exposure FROM "game_daily_exposure"
+			 WHERE date = ` + today() + ` AND game_cat_id = $1), 0)::float8`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var exposure float64
+	if err := conn.QueryRow(ctx, query, gameCatID).Scan(&exposure); err != nil {
+		return 0, fmt.Errorf("failed to get daily exposure for game %s: %w", gameCatID, err)
+	}
+	return exposure, nil
+}
+
+// UpdateKPIDeposit updates KPI deposit
+func (db *Database) UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update kpi deposit: %w", err)
+	}
+	query := `UPDATE "kpi" 
+			 SET handle = handle + $1, 
+				 ggr = handle - payout 
+			 WHERE date = ` + today()
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update kpi deposit: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// ReverseKPIDeposit takes reversed deposit transactionID of mvalue back off
+// the KPI handle of the day the deposit was booked, today's if its "deposit"
+// row is gone. It is the only deposit debit; UpdateKPIDeposit refuses
+// negative amounts.
+func (db *Database) ReverseKPIDeposit(ctx context.Context, transactionID string, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to reverse kpi deposit: %w", err)
+	}
+	query := `UPDATE "kpi" 
+			 SET handle = handle - $1, 
+				 ggr = (handle - $1) - payout 
+			 WHERE date = COALESCE(
+				 (SELECT ` + dayOf("date_created") + ` FROM "deposit" WHERE transaction_id = $2 ORDER BY id LIMIT 1),
+				 ` + today() + `)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rowsAffected, err := execKPI(ctx, conn, query, mvalue, transactionID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reverse kpi deposit: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// CheckGames gets active games with what the games list shows of them:
+// their stake columns, marketing_copy, the names of their previewAwards
+// most valuable active awards (prize_preview) and, for jackpot games, the
+// total of their kitties (jackpot_kitty)
+func (db *Database) CheckGames(ctx context.Context, category string, previewAwards int) ([]map[string]interface{}, error) {
+	baseQuery := `SELECT id, name, title, category, name_init, description, bet_amount, boxes, max_win,
+                         min_stake::float8 AS min_stake, max_stake::float8 AS max_stake,
+                         COALESCE(allowed_stakes::float8[], '{}') AS allowed_stakes,
+                         COALESCE(marketing_copy, '') AS marketing_copy, is_jackpot,
+                         ARRAY(SELECT a.name FROM "awards" a
+                               WHERE a.name_init = g.name_init AND a.status = 'active'
+                               ORDER BY a.value DESC, a.name
+                               LIMIT $1) AS prize_preview,
+                         CASE WHEN is_jackpot THEN (SELECT SUM(k.kitty)::float8 FROM "jackpot_kitty" k
+                                                    WHERE k.name_init = g.name_init) END AS jackpot_kitty
+                  FROM "Games" g
+                  WHERE status = 'active'`
+
+	args := []interface{}{previewAwards}
+	if category != "" && category != "all" {
+		baseQuery += " AND category = $2"
+		args = append(args, category)
+	}
+
+	baseQuery += ` ORDER BY CASE id 
+                 WHEN 10 THEN 1
+                 WHEN 17 THEN 2
+                 WHEN 16 THEN 3 
+                 WHEN 8 THEN 4
+                 WHEN 9 THEN 5
+                 WHEN 12 THEN 6
+                 WHEN 13 THEN 7
+                 WHEN 11 THEN 8
+                 WHEN 14 THEN 9
+                 WHEN 15 THEN 10
+                 ELSE 11
+             END`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, baseQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// GetGameCategories returns the categories of active games in
+// category_order order, unlisted ones last by name
+func (db *Database) GetGameCategories(ctx context.Context) ([]string, error) {
+	query := `SELECT g.category
+		FROM (SELECT DISTINCT category FROM "Games"
+			WHERE status = 'active' AND COALESCE(category, '') <> '') g
+		LEFT JOIN "category_order" o ON o.category = g.category
+		ORDER BY o.position NULLS LAST, g.category`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load game categories: %w", err)
+	}
+	categories, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to load game categories: %w", err)
+	}
+	return categories, nil
+}
+
+// GameStakeRules are the stake columns of a "Games" row. A nil limit or
+// an empty AllowedStakes is not configured.
+type GameStakeRules struct {
+	BetAmount     float64
+	MinStake      *float64
+	MaxStake      *float64
+	AllowedStakes []float64
+}
+
+// Game is a "Games" row as bets read it. Null columns read as their zero
+// value.
+type Game struct {
+	ID          string
+	Name        string
+	NameInit    string
+	Category    string
+	Status      string
+	Boxes       int
+	MaxExposure float64
+	RevealDelay time.Duration // how long bets wait before their outcome is shown; 0 shows it at once
+
+	DailyExposureCap float64 // most the game pays out in wins per day; 0 is no cap
+	IsJackpot        bool    // stakes feed the jackpot_kitty of the same name_init
+	GameStakeRules
+}
+
+// Active reports whether the game takes new bets
+func (g *Game) Active() bool {
+	return g.Status == "active"
+}
+
+// GetGame returns the game catID whatever its status, or nil when there is
+// no such game
+func (db *Database) GetGame(ctx context.Context, catID string) (*Game, error) {
+	query := getGameQuery
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var game Game
+	var boxes string
+	var revealDelay int32
+	err = conn.QueryRow(ctx, query, catID).Scan(&game.ID, &game.Name, &game.NameInit, &game.Category,
+		&game.Status, &boxes, &game.MaxExposure,
+		&game.BetAmount, &game.MinStake, &game.MaxStake, &game.AllowedStakes, &revealDelay,
+		&game.DailyExposureCap, &game.IsJackpot)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get game %s: %w", catID, err)
+	}
+	game.Boxes, _ = strconv.Atoi(boxes)
+	game.RevealDelay = time.Duration(revealDelay) * time.Second
+	return &game, nil
+}
+
+// CheckSetting gets settings
+func (db *Database) CheckSetting(ctx context.Context) (map[string]interface{}, error) {
+	query := checkSettingQuery
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+}
+
+// UpdateUserLucky updates user lucky count
+func (db *Database) UpdateUserLucky(ctx context.Context, msisdn string) (int64, error) {
+	query := `UPDATE "Player" 
+			 SET free_bet_count = free_bet_count + 1,  
+				 freebet_count = freebet_count + 1, 
+				 free_bet = GREATEST(free_bet - 1, 0)
+			 WHERE msisdn = $1 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user lucky: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ExpireFreeBets takes back the free bets of up to batchSize players whose
+// freebet_expiry has passed: free_bet goes to 0, is_free to 'NO' and a
+// freebet_expired CustomerLogs row records how many were lost. Players
+// another transaction holds are left for the next batch.
+func (db *Database) ExpireFreeBets(ctx context.Context, batchSize int) ([]ExpiredFreeBet, error) {
+	query := `WITH due AS (
+			SELECT id, free_bet FROM "Player"
+			WHERE free_bet > 0 AND freebet_expiry < NOW()
+			ORDER BY freebet_expiry
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		), expired AS (
+			UPDATE "Player" p SET free_bet = 0, is_free = 'NO'
+			FROM due WHERE p.id = due.id
+			RETURNING p.id, p.msisdn, due.free_bet::float8 AS free_bets, COALESCE(p.sms_notifications, TRUE) AS sms_notifications
+		), logged AS (
+			INSERT INTO "CustomerLogs" (customer_id, type, narrative, amount, game_id)
+			SELECT id::text, 'freebet_expired', 'free bets expired', free_bets, '' FROM expired
+		)
+		SELECT id, msisdn, free_bets, sms_notifications FROM expired`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire free bets: %w", err)
+	}
+	defer rows.Close()
+
+	var expired []ExpiredFreeBet
+	for rows.Next() {
+		var e ExpiredFreeBet
+		if err := rows.Scan(&e.PlayerID, &e.Msisdn, &e.FreeBets, &e.SMSNotifications); err != nil {
+			return nil, fmt.Errorf("failed to scan expired free bet: %w", err)
+		}
+		expired = append(expired, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to expire free bets: %w", err)
+	}
+	for _, e := range expired {
+		noteWrite(e.Msisdn)
+	}
+	return expired, nil
+}
+
+// GetWelcomeGrantSettings returns the welcome grant settings, or nil when
+// none are stored. It reads the primary so a change takes effect without
+// waiting for a replica.
+func (db *Database) GetWelcomeGrantSettings(ctx context.Context) (*WelcomeGrantSettings, error) {
+	query := `SELECT enabled, free_bets, valid_hours, updated_by, date_updated
+		FROM "welcome_grant_settings"`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var w WelcomeGrantSettings
+	var freeBets, validHours int32
+	err = conn.QueryRow(ctx, query).Scan(&w.Enabled, &freeBets, &validHours, &w.UpdatedBy, &w.DateUpdated)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load welcome grant settings: %w", err)
+	}
+	w.FreeBets, w.ValidHours = int(freeBets), int(validHours)
+	return &w, nil
+}
+
+// SetWelcomeGrantSettings stores the welcome grant settings on behalf of admin
+func (db *Database) SetWelcomeGrantSettings(ctx context.Context, enabled bool, freeBets, validHours int, admin string) error {
+	query := `INSERT INTO "welcome_grant_settings" (id, enabled, free_bets, valid_hours, updated_by)
+		VALUES (TRUE, $1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE
+			SET enabled = EXCLUDED.enabled,
+			    free_bets = EXCLUDED.free_bets,
+			    valid_hours = EXCLUDED.valid_hours,
+			    updated_by = EXCLUDED.updated_by,
+			    date_updated = NOW()`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, query, enabled, freeBets, validHours, admin); err != nil {
+		return fmt.Errorf("failed to set welcome grant settings: %w", err)
+	}
+	return nil
+}
+
+// GrantWelcomeFreeBets gives msisdn freeBets free bets expiring no earlier
+// than expiry, and logs them as a welcome_grant CustomerLogs row, unless
+// the player's welcome grant was already decided or they have placed a
+// bet. The check and the grant are one UPDATE, so of two concurrent calls
+// only the first grants: the second waits on the row lock and then finds
+// welcome_grant_at set. Returns whether this call granted.
+func (db *Database) GrantWelcomeFreeBets(ctx context.Context, msisdn string, freeBets int, expiry time.Time) (bool, error) {
+	query := `WITH granted AS (
+			UPDATE "Player" p
+			SET free_bet = COALESCE(p.free_bet, 0) + $2,
+				is_free = 'YES',
+				freebet_expiry = GREATEST(COALESCE(p.freebet_expiry, NOW()), $3),
+				welcome_grant_at = NOW(),
+				welcome_free_bets = $2
+			WHERE p.msisdn = $1 AND p.welcome_grant_at IS NULL
+				AND NOT EXISTS (SELECT 1 FROM "Bets" b WHERE b.msisdn = p.msisdn)
+			RETURNING p.id
+		), logged AS (
+			INSERT INTO "CustomerLogs" (customer_id, type, narrative, amount, game_id)
+			SELECT id::text, 'welcome_grant', 'welcome free bets', $2, '' FROM granted
+		)
+		SELECT COUNT(*) FROM granted`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var granted int64
+	if err := conn.QueryRow(ctx, query, msisdn, freeBets, expiry).Scan(&granted); err != nil {
+		return false, fmt.Errorf("failed to grant welcome free bets: %w", err)
+	}
+	if granted > 0 {
+		noteWrite(msisdn)
+	}
+	return granted > 0, nil
+}
+
+// GetFreeBetLiability returns the unexpired free bets by expiry day: day,
+// players and free_bets
+func (db *Database) GetFreeBetLiability(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT to_char(freebet_expiry, 'YYYY-MM-DD') AS day,
+			COUNT(*) AS players, SUM(free_bet)::float8 AS free_bets
+		FROM "Player"
+		WHERE free_bet > 0 AND freebet_expiry >= NOW()
+		GROUP BY 1 ORDER BY 1`
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get free bet liability: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// UpdateUserLuckyFree updates user free status
+func (db *Database) UpdateUserLuckyFree(ctx context.Context, msisdn string) (int64, error) {
+	query := `UPDATE "Player" SET is_free = 'NO' WHERE msisdn = $1 RETURNING id`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user free status: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateUser updates user field
+func (db *Database) UpdateUser(ctx context.Context, name string, mvalue interface{}, id int64) (int64, error) {
+	// Use parameterized query to prevent SQL injection
+	query := fmt.Sprintf(`UPDATE "Player" SET %s = $1 WHERE id = $2 `, name)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateUserRTP updates user RTP
+func (db *Database) UpdateUserRTP(ctx context.Context, amount float64, id int64) (int64, error) {
+	query := `UPDATE "Player" 
+			 SET is_free = 'NO', balance = balance - $1, rtp_player = (payout / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100 
+			 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, amount, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user rtp: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateUserLossCount updates user loss count
+func (db *Database) UpdateUserLossCount(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	query := `UPDATE "Player" 
+			 SET lost_count = lost_count + 1,
+				 lost_since = CASE WHEN lost_count = 0 OR lost_since IS NULL THEN NOW() ELSE lost_since END,
+				 total_loss_count = total_loss_count + 1, 
+				 rtp_player = (payout / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100,
+				 total_losses = total_losses + $1 
+			 WHERE id = $2 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user loss count: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateUserBet updates user bet information
+func (db *Database) UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	query := `UPDATE "Player" 
+			 SET monetary = monetary + $1, 
+				 frequency = frequency + 1, 
+				 last_transaction_time = NOW(),
+				 total_bets = total_bets + $2,
+				 recency = EXTRACT(DAY FROM (NOW() - last_transaction_time)),
+				 last_stake_amount = $3 
+			 WHERE id = $4`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, mvalue, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update user bet: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// ErrDuplicateReference means a bet or deposit request already holds the
+// reference. Callers draw a new one and insert again.
+var ErrDuplicateReference = errors.New("reference already in use")
+
+// isUniqueViolation reports whether err is a postgres unique_violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// CreateBet creates a new bet. It reports false, writing nothing, when a
+// bet already holds the reference: the round was played by whoever created
+// that one. The conflict is arbitrated by bets_reference_unique (012).
+func (db *Database) CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference string, betStatus status.ResultStatus, betType, gameCatID, gameName, channel string) (bool, error) {
+	query := `INSERT INTO "Bets" 
+			 (game_cat_id, game_name,channel, bet_type, result_status, results, reference, amount, msisdn, selected_number) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,$10)
+			 ON CONFLICT (reference) WHERE reference <> '' DO NOTHING`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	resultExec, err := conn.Exec(ctx, query, gameCatID, gameName, channel, betType, betStatus, result, reference, amount, msisdn, selectedChoice)
+	if err != nil {
+		return false, fmt.Errorf("failed to create bet: %w", err)
+	}
+	if resultExec.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	noteWrite(msisdn)
+	return true, nil
+}
+
+// BetExists reports whether a bet holds reference. It reads the primary:
+// it guards against playing a round another process has just played.
+func (db *Database) BetExists(ctx context.Context, reference string) (bool, error) {
+	query := `SELECT EXISTS (SELECT 1 FROM "Bets" WHERE reference = $1)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, query, reference).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check bet %s: %w", reference, err)
+	}
+	return exists, nil
+}
+
+// CreateParcelBets creates the pending bets of a parcel in one transaction.
+// Returns ErrDuplicateReference when any reference is taken.
+func (db *Database) CreateParcelBets(ctx context.Context, msisdn, parcel string, bets []ParcelBet, betType, gameCatID, gameName, channel string) error {
+	query := `INSERT INTO "Bets"
+			 (game_cat_id, game_name, channel, bet_type, result_status, results, reference, amount, msisdn, selected_number, parcel_reference)
+			 VALUES ($1, $2, $3, $4, $10, '', $5, $6, $7, $8, $9)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, b := range bets {
+		_, err := tx.Exec(ctx, query, gameCatID, gameName, channel, betType, b.Reference, b.Amount, msisdn, b.Box, parcel, status.ResultPending)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("failed to create bet %s: %w", b.Reference, ErrDuplicateReference)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create bet: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit parcel bets: %w", err)
+	}
+	noteWrite(msisdn)
+	return nil
+}
+
+// InsertVerification issues the code hashed to codeHash for purpose as
+// msisdn's only usable one and returns how many times it counts as resent.
+// Every other unused code for the purpose is retired (status = 2). When
+// msisdn re-requests while its code is still valid the request counts as a
+// resend, carried over from that code; re-issuing the same code, as the
+// fixed codes of test accounts are, refreshes that code's row rather than
+// adding another.
+func (db *Database) InsertVerification(ctx context.Context, msisdn, purpose, codeHash string, expired int64, created int64) (int, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serializes requests for the same msisdn and purpose, which may have no
+	// row to lock yet
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('verification:' || $1 || ':' || $2))`, msisdn, purpose); err != nil {
+		return 0, fmt.Errorf("failed to lock verification codes: %w", err)
+	}
+
+	var latestID, latestExpired int64
+	var latestHash string
+	var resends int
+	err = tx.QueryRow(ctx, `
+		SELECT id, COALESCE(code_hash, ''), expired, resend_count
+		FROM verification
+		WHERE msisdn = $1 AND purpose = $2 AND status = 0
+		ORDER BY id DESC
+		LIMIT 1`, msisdn, purpose).Scan(&latestID, &latestHash, &latestExpired, &resends)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		resends = 0
+	case err != nil:
+		return 0, fmt.Errorf("failed to get latest verification: %w", err)
+	case latestExpired > created:
+		resends++
+	default:
+		resends = 0
+	}
+
+	// Re-issuing the latest code keeps its row; ids start at 1, so 0 keeps none
+	var keep int64
+	if latestHash == codeHash {
+		keep = latestID
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE verification SET status = 2
+		WHERE msisdn = $1 AND purpose = $2 AND status = 0 AND id <> $3`, msisdn, purpose, keep); err != nil {
+		return 0, fmt.Errorf("failed to retire verification codes: %w", err)
+	}
+
+	if keep != 0 {
+		_, err = tx.Exec(ctx, `
+			UPDATE verification SET expired = $2, created = $3, last_sent = $3, resend_count = $4
+			WHERE id = $1`, latestID, expired, created, resends)
+	} else {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO verification (msisdn, purpose, code_hash, expired, created, resend_count, last_sent)
+			VALUES ($1, $2, $3, $4, $5, $6, $5)`, msisdn, purpose, codeHash, expired, created, resends)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert verification code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return resends, nil
+}
+
+// RequestSelfExlusion inserts a new verification code
+func (db *Database) RequestSelfExlusion(ctx context.Context, msisdn string, hrs int) (int64, error) {
+	query := `
+		INSERT INTO self_exlusion_request 
+		(msisdn, value_hrs)
+		VALUES ($1, $2)
+	`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	resultExec, err := conn.Exec(ctx, query, msisdn, hrs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert self_exlusion_request code: %w", err)
+	}
+
+	return resultExec.RowsAffected(), nil
+}
+
+// UpdateLuckyBet updates bet result
+func (db *Database) UpdateLuckyBet(ctx context.Context, result, game, reference string, betStatus status.ResultStatus) (int64, error) {
+	query := `UPDATE "Bets" 
+			 SET result_status = $1, 
+				 status = $5, 
+				 results = $2 ,
+				 game = $3
+			 WHERE reference = $4 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	resultExec, err := conn.Exec(ctx, query, betStatus, result, game, reference, status.BetProcessed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update lucky bet: %w", err)
+	}
+
+	return resultExec.RowsAffected(), nil
+}
+
+// UpdateLuckyBetWin updates bet with win amount
+func (db *Database) UpdateLuckyBetWin(ctx context.Context, result, game, reference string, winAmount float64, betStatus status.ResultStatus) (int64, error) {
+	query := `UPDATE "Bets" 
+			 SET result_status = $1, 
+				 status = $6, 
+				 win_amount = $2, 
+				 results = $3,
+				 game=$4
+			 WHERE reference = $5 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	resultExec, err := conn.Exec(ctx, query, betStatus, winAmount, result, game, reference, status.BetProcessed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update lucky bet win: %w", err)
+	}
+
+	return resultExec.RowsAffected(), nil
+}
+
+// CreateUser creates a new user. The wallet and RTP columns start at 0
+// rather than NULL; migration 027 makes that the default too.
+func (db *Database) CreateUser(ctx context.Context, carrier, msisdn string, name string, my_promocode string, promocode string) (int64, error) {
+	query := `INSERT INTO "Player" (carrier, msisdn, name, promocode, my_promocode,
+			balance, bonus, free_bet, total_bets, payout, total_losses, lost_count)
+		VALUES ($1, $2, $3, $4, $5, 0, 0, 0, 0, 0, 0, 0)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, carrier, msisdn, name, promocode, my_promocode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+func (db *Database) CreatePromo(ctx context.Context, msisdn string, promocode string) (int64, error) {
+	query := `INSERT INTO "promocode" (promocode, msisdn) VALUES ($1, $2)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, promocode, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to promocode user: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// CreateUserAttempted records that msisdn is changing to new_msisdn until
+// expiresAt, replacing the player's earlier pending change and dropping
+// expired ones. It affects no row when another player's unexpired change
+// already claims new_msisdn.
+func (db *Database) CreateUserAttempted(ctx context.Context, msisdn string, new_msisdn string, expiresAt time.Time) (int64, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM "Attempted_Players" WHERE msisdn = $1 OR expires_at <= NOW()`, msisdn); err != nil {
+		return 0, fmt.Errorf("failed to clear attempted user: %w", err)
+	}
+	result, err := tx.Exec(ctx, `INSERT INTO "Attempted_Players" (msisdn, new_msisdn, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, msisdn, new_msisdn, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create attempted user: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit attempted user: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetUserAttempted returns msisdn's unexpired pending phone number change,
+// or nil when there is none
+func (db *Database) GetUserAttempted(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, `SELECT * FROM "Attempted_Players" WHERE msisdn = $1 AND expires_at > NOW()`, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToSingleMap(rows)
+}
+
+// DeleteUserAttempted deletes attempted user
+func (db *Database) DeleteUserAttempted(ctx context.Context, msisdn string) (int64, error) {
+	query := `DELETE FROM "Attempted_Players" WHERE msisdn = $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete attempted user: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetJackpotReconciliation returns each kitty's current value next to its
+// ledger sums. It reads the primary: the kitty and its ledger rows are
+// written together, and a lagging replica would show a difference that
+// isn't there.
+func (db *Database) GetJackpotReconciliation(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT k.id, COALESCE(k.name_init, '') AS name_init, COALESCE(k.item_name, '') AS item_name,
+			k.is_locked, COALESCE(k.kitty, 0)::float8 AS kitty,
+			COALESCE(SUM(c.amount) FILTER (WHERE c.kind = 'opening'), 0)::float8 AS opening,
+			COALESCE(SUM(c.amount) FILTER (WHERE c.kind = 'contribution'), 0)::float8 AS contributions,
+			COUNT(c.id) FILTER (WHERE c.kind = 'contribution') AS contribution_count,
+			COALESCE(SUM(c.amount) FILTER (WHERE c.kind = 'payout'), 0)::float8 AS payouts,
+			COUNT(c.id) FILTER (WHERE c.kind = 'payout') AS payout_count
+		FROM "jackpot_kitty" k
+		LEFT JOIN "jackpot_contributions" c ON c.kitty_id = k.id
+		GROUP BY k.id
+		ORDER BY k.id`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reconcile jackpot kitties: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// ListJackpotGames returns every game that is flagged is_jackpot or shares
+// a name_init with a jackpot kitty, whatever its status
+func (db *Database) ListJackpotGames(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT g.id::text AS id, COALESCE(g.name, '') AS name, COALESCE(g.name_init, '') AS name_init,
+			COALESCE(g.status, '') AS status, g.is_jackpot
+		FROM "Games" g
+		WHERE g.is_jackpot OR EXISTS (SELECT 1 FROM "jackpot_kitty" k WHERE k.name_init = g.name_init)
+		ORDER BY g.id`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jackpot games: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// ListJackpotKitties returns every jackpot kitty with the name_init it is
+// matched on
+func (db *Database) ListJackpotKitties(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT id, COALESCE(name_init, '') AS name_init, COALESCE(item_name, '') AS item_name
+		FROM "jackpot_kitty"
+		ORDER BY id`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jackpot kitties: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// statusColumns are the columns AuditStatuses checks, each with the
+// vocabulary it may hold. stk_results is left out: the gateway writes its
+// own statuses there.
+var statusColumns = []struct {
+	table, column string
+	allowed       []string
+}{
+	{`"Bets"`, "result_status", status.Strings(status.ResultStatuses)},
+	{`"Bets"`, "status", status.Strings(status.BetStatuses)},
+	{`"deposit_requests"`, "status", status.Strings(status.DepositStatuses)},
+	{`"withdrawals"`, "status", status.Strings(status.WithdrawalStatuses)},
+	{`"withdrawal_b2b_to_process"`, "bet_status", status.Strings(status.B2BStatuses)},
+	{`"deposit_reversals"`, "bet_result", status.Strings(status.ResultStatuses)},
+}
+
+// AuditStatuses returns one row per out-of-vocabulary value of each status
+// column with how many rows hold it. NULL is not reported: the columns use
+// it for "not yet". It scans whole tables, so it reads the replica.
+func (db *Database) AuditStatuses(ctx context.Context) ([]map[string]interface{}, error) {
+	parts := make([]string, len(statusColumns))
+	args := make([]interface{}, len(statusColumns))
+	for i, c := range statusColumns {
+		parts[i] = fmt.Sprintf(`SELECT '%s' AS table_name, '%s' AS column_name, %s::text AS value, COUNT(*)::bigint AS count
+		FROM %s
+		WHERE %s IS NOT NULL AND %s::text <> ALL($%d)
+		GROUP BY %s`, strings.Trim(c.table, `"`), c.column, c.column, c.table, c.column, c.column, i+1, c.column)
+		args[i] = c.allowed
+	}
+	query := strings.Join(parts, "\n\t\tUNION ALL\n\t\t") + "\n\t\tORDER BY table_name, column_name, count DESC"
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to audit statuses: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// CheckJackpotWinner checks for available jackpot winners
+func (db *Database) CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error) {
+	query := `SELECT * FROM "jackpot_kitty" 
+			 WHERE is_locked = 0 AND kitty > 0 AND kitty >= cost AND release_jackpot = 'yes' 
+			 ORDER BY RANDOM() `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// GetOTPVerified returns msisdn's latest unused code for purpose when it
+// matches guess and hasn't expired (expired > now)
+func (db *Database) GetOTPVerified(ctx context.Context, msisdn, purpose string, guess OTPGuess, now int64) (map[string]interface{}, error) {
+	query := `
+		SELECT id, msisdn, purpose, expired, created, status
+		FROM verification
+		WHERE id = (
+			SELECT id FROM verification
+			WHERE msisdn = $1 AND purpose = $2 AND status = 0
+			ORDER BY id DESC
+			LIMIT 1
+		) AND ` + otpGuessMatches + ` AND expired > $6
+	`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, msisdn, purpose, guess.Hash, guess.Code, guess.PlaintextSince, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GetOTPVerified query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToSingleMap(rows)
+}
+
+// GetOTPChecked returns msisdn's latest unused (status = 0) code for
+// purpose when it matches guess. Codes it replaced never match.
+func (db *Database) GetOTPChecked(ctx context.Context, msisdn, purpose string, guess OTPGuess) (map[string]interface{}, error) {
+	query := `
+		SELECT id, msisdn, purpose, expired, created, status
+		FROM verification
+		WHERE id = (
+			SELECT id FROM verification
+			WHERE msisdn = $1 AND purpose = $2 AND status = 0
+			ORDER BY id DESC
+			LIMIT 1
+		) AND ` + otpGuessMatches + `
+	`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, msisdn, purpose, guess.Hash, guess.Code, guess.PlaintextSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GetOTPChecked query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToSingleMap(rows)
+}
+
+// UpdateIntoVerification marks the verification as used (status = 1) and returns affected rows
+func (db *Database) UpdateIntoVerification(ctx context.Context, id int32) (int64, error) {
+	query := `UPDATE verification SET status = 1 WHERE id = $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	res, err := conn.Exec(ctx, query, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to execute UpdateIntoVerification: %w", err)
+	}
+
+	return res.RowsAffected(), nil
+}
+
+// GetLatestVerification returns msisdn's newest unused code for purpose, or
+// nil when there is none
+func (db *Database) GetLatestVerification(ctx context.Context, msisdn, purpose string) (*VerificationCode, error) {
+	query := `
+		SELECT id, msisdn, purpose, COALESCE(code_hash, ''), expired, created, status, resend_count, GREATEST(created, last_sent)
+		FROM verification
+		WHERE msisdn = $1 AND purpose = $2 AND status = 0
+		ORDER BY id DESC
+		LIMIT 1
+	`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var v VerificationCode
+	err = conn.QueryRow(ctx, query, msisdn, purpose).Scan(&v.ID, &v.Msisdn, &v.Purpose, &v.CodeHash, &v.Expired, &v.Created, &v.Status, &v.ResendCount, &v.LastSent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest verification: %w", err)
+	}
+	return &v, nil
+}
+
+// ReissueVerification replaces the unused code id with the one hashed to
+// codeHash, for the same msisdn and purpose. The old code is retired
+// (status = 2) so it can no longer be verified, and the new row carries the
+// resend count on. Returns false when the old code was used or replaced
+// meanwhile, or has already been resent maxResends times.
+func (db *Database) ReissueVerification(ctx context.Context, id int64, codeHash string, expired, created int64, maxResends int) (bool, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var msisdn, purpose string
+	var resends int
+	err = tx.QueryRow(ctx, `
+		UPDATE verification SET status = 2
+		WHERE id = $1 AND status = 0 AND resend_count < $2
+		RETURNING msisdn, purpose, resend_count`, id, maxResends).Scan(&msisdn, &purpose, &resends)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to retire verification code: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO verification (msisdn, purpose, code_hash, expired, created, resend_count, last_sent)
+		VALUES ($1, $2, $3, $4, $5, $6, $5)`, msisdn, purpose, codeHash, expired, created, resends+1)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert verification code: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// verificationPurgeBatch bounds each purge DELETE so it never holds row locks
+// on verification for long while logins are inserting codes
+const verificationPurgeBatch = 5000
+
+// PurgeExpiredVerifications deletes codes that expired, or were used, more
+// than olderThan ago, in batches of verificationPurgeBatch. Unused codes that
+// have not expired are never touched. Returns the number of rows deleted.
+func (db *Database) PurgeExpiredVerifications(ctx context.Context, olderThan time.Duration) (int64, error) {
+	return purgeVerificationBatches(ctx, db.pool, time.Now().Add(-olderThan).Unix())
+}
+
+// purgeVerificationBatches deletes rows past cutoff one batch per statement
+// until a batch comes back short
+func purgeVerificationBatches(ctx context.Context, conn execer, cutoff int64) (int64, error) {
+	query := `
+		DELETE FROM verification
+		WHERE id IN (
+			SELECT id FROM verification
+			WHERE expired < $1 OR (status = 1 AND created < $1)
+			LIMIT $2
+		)
+	`
+	var total int64
+	for {
+		res, err := conn.Exec(ctx, query, cutoff, verificationPurgeBatch)
+		if err != nil {
+			return total, fmt.Errorf("failed to purge verification codes: %w", err)
+		}
+
+		total += res.RowsAffected()
+		if res.RowsAffected() < verificationPurgeBatch {
+			return total, nil
+		}
+	}
+}
+
+// PurgeOTPPlaintext clears, in batches of verificationPurgeBatch, the
+// plaintext codes of verification rows created before before and the text
+// of OTP messages queued in dbQueue before it. Returns the number of rows
+// cleared.
+func (db *Database) PurgeOTPPlaintext(ctx context.Context, before time.Time) (int64, error) {
+	queries := []struct {
+		query string
+		arg   interface{}
+	}{
+		{`UPDATE verification SET code = NULL
+			WHERE id IN (
+				SELECT id FROM verification
+				WHERE code IS NOT NULL AND created < $1
+				LIMIT $2
+			)`, before.Unix()},
+		{`UPDATE "dbQueue" SET "Message" = ''
+			WHERE "RecordID" IN (
+				SELECT "RecordID" FROM "dbQueue"
+				WHERE command = 'otp' AND "Message" <> '' AND "MessageTimeStamp" < $1
+				LIMIT $2
+			)`, before},
+	}
+
+	var total int64
+	for _, q := range queries {
+		for {
+			conn, err := db.pool.Acquire(ctx)
+			if err != nil {
+				return total, fmt.Errorf("failed to acquire connection: %w", err)
+			}
+			res, err := conn.Exec(ctx, q.query, q.arg, verificationPurgeBatch)
+			conn.Release()
+			if err != nil {
+				return total, fmt.Errorf("failed to purge OTP plaintext: %w", err)
+			}
+
+			total += res.RowsAffected()
+			if res.RowsAffected() < verificationPurgeBatch {
+				break
+			}
+		}
+	}
+	return total, nil
+}
+
+// ClaimIdempotencyKey claims key for msisdn on route until expiresAt. It
+// reports false when a live claim already holds the key; an expired claim
+// is taken over.
+func (db *Database) ClaimIdempotencyKey(ctx context.Context, msisdn, route, key, requestHash string, expiresAt time.Time) (bool, error) {
+	query := `INSERT INTO "idempotency_keys" (msisdn, route, key, request_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (msisdn, route, key) DO UPDATE
+			SET request_hash = EXCLUDED.request_hash,
+			    status_code = NULL,
+			    response = NULL,
+			    expires_at = EXCLUDED.expires_at,
+			    date_created = NOW()
+			WHERE "idempotency_keys".expires_at <= NOW()
+		RETURNING true`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var claimed bool
+	err = conn.QueryRow(ctx, query, msisdn, route, key, requestHash, expiresAt).Scan(&claimed)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	return claimed, nil
+}
+
+// GetIdempotencyKey returns the live claim on key, or nil when there is none
+func (db *Database) GetIdempotencyKey(ctx context.Context, msisdn, route, key string) (*IdempotentRequest, error) {
+	query := `SELECT request_hash, COALESCE(status_code, 0), response
+		FROM "idempotency_keys"
+		WHERE msisdn = $1 AND route = $2 AND key = $3 AND expires_at > NOW()`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var r IdempotentRequest
+	err = conn.QueryRow(ctx, query, msisdn, route, key).Scan(&r.RequestHash, &r.StatusCode, &r.Response)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	return &r, nil
+}
+
+// SaveIdempotentResponse stores the response replays of key get
+func (db *Database) SaveIdempotentResponse(ctx context.Context, msisdn, route, key string, statusCode int, response []byte) error {
+	query := `UPDATE "idempotency_keys" SET status_code = $4, response = $5
+		WHERE msisdn = $1 AND route = $2 AND key = $3`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, query, msisdn, route, key, statusCode, response); err != nil {
+		return fmt.Errorf("failed to save idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey drops the claim on key so the request can be retried
+func (db *Database) ReleaseIdempotencyKey(ctx context.Context, msisdn, route, key string) error {
+	query := `DELETE FROM "idempotency_keys" WHERE msisdn = $1 AND route = $2 AND key = $3`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, query, msisdn, route, key); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys deletes expired claims and returns how many
+func (db *Database) PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	query := `DELETE FROM "idempotency_keys" WHERE expires_at <= NOW()`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// CheckBasketLucky returns the basket. amount is what is available, net of
+// the wins reserved against it.
+func (db *Database) CheckBasketLucky(ctx context.Context) (map[string]interface{}, error) {
+	query := `SELECT id, amount - reserved AS amount, reserved FROM "Basket" `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// CheckAwardsLuckyRandom gets a random active award by name_init
+func (db *Database) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "awards" WHERE name_init = $1 AND status = 'active' ORDER BY RANDOM() `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, nameInit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// CheckAwardsLucky gets awards by name_init with value less than win amount
+func (db *Database) CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "awards" WHERE name_init = $1 AND value < $2 AND status = 'active' `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, nameInit, winAmount)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+}
+
+// InsertHouseBasketLogs inserts basket logs
+func (db *Database) InsertHouseBasketLogs(ctx context.Context, credit, debit, mvalue float64, narrative string) (int64, error) {
+	query := `INSERT INTO "BasketLogs" (credit, debit, amount, narrative) VALUES ($1, $2, $3, $4)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, credit, debit, mvalue, narrative)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert basket logs: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateHouseAviatorHouse updates aviator house income
+func (db *Database) UpdateHouseAviatorHouse(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update house income: %w", err)
+	}
+	query := `UPDATE "Aviator"."HouseIncome" SET house_income = house_income + $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update aviator house income: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// CheckHousePawaBoxKe gets house income data
+func (db *Database) CheckHousePawaBoxKe(ctx context.Context) (map[string]interface{}, error) {
+	query := `SELECT * FROM "HouseIncome" `
+
+	db.logFor(ctx).Debugf("Fetching house income data")
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for house income: %v", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error querying house income: %v", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading rows: %w", err)
+		}
+		return nil, nil // No rows found
+	}
+
+	values, err := rows.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row values: %w", err)
+	}
+
+	fieldDescriptions := rows.FieldDescriptions()
+	result := make(map[string]interface{})
+	for i, fd := range fieldDescriptions {
+		result[string(fd.Name)] = values[i]
+	}
+
+	db.logFor(ctx).Debugf("House income data fetched successfully")
+	return result, nil
+}
+
+// UpdateAviatorDepositRequestLucky updates deposit request to success status
+func (db *Database) UpdateAviatorDepositRequestLucky(ctx context.Context, transactionID, reference, description string) (int64, error) {
+	query := `UPDATE "deposit_requests" 
+	SET status = $4, transaction_id = $1, description = $2 
+	WHERE reference = $3`
+
+	db.logFor(ctx).Debugf("Updating deposit request to success: ref=%s, transaction_id=%s", reference, transactionID)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for deposit update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, transactionID, description, reference, status.DepositSuccess)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating deposit request: %v", err)
+		return 0, fmt.Errorf("failed to update deposit request: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Deposit request updated to success: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// InsertIntoDepositLuckyRequestBonus inserts bonus deposit request
+func (db *Database) InsertIntoDepositLuckyRequestBonus(ctx context.Context, depositType, ussd, game, carrier string, gameCatID string, amount float64, msisdn, selectedBox, reference, channel string) (int64, error) {
+	query := `INSERT INTO "deposit_requests" 
+	(deposit_type, status, transaction_id, description, ussd, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference) 
+	VALUES ($1, $12, $2, 'Free bets', $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	db.logFor(ctx).Debugf("Inserting bonus deposit request: ref=%s, msisdn=%s, amount=%.2f, type=%s",
+		reference, utils.RedactMsisdn(msisdn), amount, depositType)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for bonus deposit: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	params := []interface{}{depositType, reference, ussd, game, carrier, channel, gameCatID, amount, msisdn, selectedBox, reference, status.DepositSuccess}
+	result, err := conn.Exec(ctx, query, params...)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error inserting bonus deposit request: %v", err)
+		return 0, fmt.Errorf("failed to insert bonus deposit request: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Bonus deposit request inserted: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// InsertIntoDepositLuckyRequestComplete inserts a deposit request similar to the Python async version
+func (db *Database) InsertIntoDepositLuckyRequestComplete(
+	ctx context.Context,
+	transactionID, description, game, carrier, channel, gameCatID string,
+	amount float64,
+	msisdn, selectedBox, reference string,
+) (int64, error) {
+
+	query := `INSERT INTO deposit_requests
+        (gateway, status, transaction_id, description, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference)
+        VALUES ('direct deposit', $11, $1, $2, $3, $4, $5, $6, $7, $8, $9, $10)` // equivalent to MySQL INSERT IGNORE
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for deposit request: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	params := []interface{}{transactionID, description, game, carrier, channel, gameCatID, amount, msisdn, selectedBox, reference, status.DepositSuccess}
+
+	result, err := conn.Exec(ctx, query, params...)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error inserting deposit request: %v", err)
+		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Deposit request inserted: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	noteWrite(msisdn)
+	return rowsAffected, nil
+}
+
+// CreateDepositRecordLucky creates a deposit record
+func (db *Database) CreateDepositRecordLucky(ctx context.Context, msisdn string, amount float64, transactionID, shortcode, name, reference, depositType string) (int64, error) {
+	query := `INSERT INTO "deposit" 
+	(deposit_type, msisdn, amount, transaction_id, shortcode, name, mreference) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	db.logFor(ctx).Debugf("Creating deposit record: ref=%s, msisdn=%s, amount=%.2f, type=%s",
+		reference, utils.RedactMsisdn(msisdn), amount, depositType)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for deposit record: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	params := []interface{}{depositType, msisdn, amount, transactionID, shortcode, name, reference}
+	result, err := conn.Exec(ctx, query, params...)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error creating deposit record: %v", err)
+		return 0, fmt.Errorf("failed to create deposit record: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Deposit record created: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	noteWrite(msisdn)
+	return rowsAffected, nil
+}
+
+// UpdateHousePawaBoxKeBasket updates basket amount
+func (db *Database) UpdateHousePawaBoxKeBasket(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update basket: %w", err)
+	}
+	query := `UPDATE "Basket" SET amount = amount + $1`
+
+	db.logFor(ctx).Debugf("Updating basket amount: +%.2f", mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for basket update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating basket: %v", err)
+		return 0, fmt.Errorf("failed to update basket: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Basket updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// TopUpBasket adds amount to the basket and records the top-up in
+// basket_topups and BasketLogs in one transaction. Returns the audit row id
+// and the basket balance after the top-up.
+func (db *Database) TopUpBasket(ctx context.Context, amount float64, admin, note string) (int64, float64, error) {
+	if err := money.CheckDelta(money.Adjustment, amount); err != nil {
+		return 0, 0, fmt.Errorf("failed to top up basket: %w", err)
+	}
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var balance float64
+	err = tx.QueryRow(ctx, `UPDATE "Basket" SET amount = amount + $1 RETURNING amount::float8`, amount).Scan(&balance)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, 0, fmt.Errorf("no basket record to top up")
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to top up basket: %w", err)
+	}
+
+	var id int64
+	err = tx.QueryRow(ctx, `INSERT INTO "basket_topups" (amount, balance_after, admin, note)
+		VALUES ($1, $2, $3, $4) RETURNING id`, amount, balance, admin, note).Scan(&id)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to record basket top-up: %w", err)
+	}
+
+	narrative := fmt.Sprintf("%.2f added to the basket:- top-up #%d by %s", amount, id, admin)
+	if _, err := tx.Exec(ctx, `INSERT INTO "BasketLogs" (credit, debit, amount, narrative) VALUES ($1, $2, $3, $4)`,
+		0, amount, amount, narrative); err != nil {
+		return 0, 0, fmt.Errorf("failed to insert basket logs: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, 0, fmt.Errorf("failed to commit basket top-up: %w", err)
+	}
+	return id, balance, nil
+}
+
+// HoldBasketPayout reserves the gross amount of a win the basket could not
+// cover, so later wins cannot take it first. Reports false when reference
+// is already held.
+func (db *Database) HoldBasketPayout(ctx context.Context, reference, msisdn string, amount float64) (bool, error) {
+	if err := money.CheckDelta(money.Counter, amount); err != nil {
+		return false, fmt.Errorf("failed to hold basket payout: %w", err)
+	}
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	result, err := tx.Exec(ctx, `INSERT INTO "basket_holds" (reference, msisdn, amount) VALUES ($1, $2, $3)
+		ON CONFLICT (reference) DO NOTHING`, reference, msisdn, amount)
+	if err != nil {
+		return false, fmt.Errorf("failed to insert basket hold: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(ctx, `UPDATE "Basket" SET reserved = reserved + $1`, amount); err != nil {
+		return false, fmt.Errorf("failed to reserve basket: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit basket hold: %w", err)
+	}
+	return true, nil
+}
+
+// ReleaseBasketHolds pays out held wins, oldest first, while the basket
+// covers them. Each release takes its amount from the basket and the
+// reservation, and moves the net payout from pending_withdrawals to
+// withdrawal_queue_ke, in one transaction. The first hold the basket cannot
+// cover stops the run, so a smaller, newer win never jumps the queue.
+func (db *Database) ReleaseBasketHolds(ctx context.Context) ([]BasketRelease, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var basket float64
+	err = tx.QueryRow(ctx, `SELECT amount::float8 FROM "Basket" FOR UPDATE`).Scan(&basket)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock basket: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `SELECT reference, msisdn, amount::float8 FROM "basket_holds"
+		WHERE released_at IS NULL ORDER BY id FOR UPDATE`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list basket holds: %w", err)
+	}
+	holds, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (BasketRelease, error) {
+		var r BasketRelease
+		err := row.Scan(&r.Reference, &r.Msisdn, &r.Amount)
+		return r, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan basket holds: %w", err)
+	}
+
+	var released []BasketRelease
+	for _, h := range holds {
+		if basket < h.Amount {
+			break
+		}
+		basket -= h.Amount
+		if _, err := tx.Exec(ctx, `UPDATE "Basket" SET amount = amount - $1, reserved = reserved - $1`, h.Amount); err != nil {
+			return nil, fmt.Errorf("failed to release basket hold %s: %w", h.Reference, err)
+		}
+		if _, err := tx.Exec(ctx, `UPDATE "basket_holds" SET released_at = NOW() WHERE reference = $1`, h.Reference); err != nil {
+			return nil, fmt.Errorf("failed to release basket hold %s: %w", h.Reference, err)
+		}
+		narrative := fmt.Sprintf("%.2f deducted from the basket:- held game id %s", h.Amount, h.Reference)
+		if _, err := tx.Exec(ctx, `INSERT INTO "BasketLogs" (credit, debit, amount, narrative) VALUES ($1, $2, $3, $4)`,
+			h.Amount, 0, -h.Amount, narrative); err != nil {
+			return nil, fmt.Errorf("failed to insert basket logs: %w", err)
+		}
+
+		// A win kept wholly in the bonus wallet has no payout to move
+		err := tx.QueryRow(ctx, `DELETE FROM "pending_withdrawals" WHERE reference = $1 RETURNING amount::float8`, h.Reference).Scan(&h.Payout)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("failed to take pending withdrawal %s: %w", h.Reference, err)
+		}
+		if h.Payout > 0 {
+			if _, err := tx.Exec(ctx, `INSERT INTO "withdrawal_queue_ke" (reference, msisdn, amount, callback) VALUES ($1, $2, $3, $4)`,
+				h.Reference, h.Msisdn, h.Payout, "http?"); err != nil {
+				return nil, fmt.Errorf("failed to queue held payout %s: %w", h.Reference, err)
+			}
+		}
+		released = append(released, h)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit basket releases: %w", err)
+	}
+	return released, nil
+}
+
+// ListBasketTopUps returns the latest limit basket top-ups, newest first
+func (db *Database) ListBasketTopUps(ctx context.Context, limit int) ([]map[string]interface{}, error) {
+	query := `SELECT id, amount::float8 AS amount, balance_after::float8 AS balance_after, admin, note, date_created
+		FROM "basket_topups"
+		ORDER BY id DESC
+		LIMIT $1`
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToMap(rows)
+}
+
+// UpdateHousePawaBoxKeHouse updates house income
+func (db *Database) UpdateHousePawaBoxKeHouse(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update house income: %w", err)
+	}
+	query := `UPDATE "HouseIncome" SET house_income = house_income + $1`
+
+	db.logFor(ctx).Debugf("Updating house income: +%.2f", mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for house income update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating house income: %v", err)
+		return 0, fmt.Errorf("failed to update house income: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("House income updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateHouseLucyNumberHouseCurrentRTP updates house current RTP
+func (db *Database) UpdateHouseLucyNumberHouseCurrentRTP(ctx context.Context) (int64, error) {
+	query := `UPDATE "HouseIncome" 
+	SET current_rtp = (total_wins / CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END) * 100`
+
+	db.logFor(ctx).Debugf("Updating house current RTP")
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for RTP update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating house RTP: %v", err)
+		return 0, fmt.Errorf("failed to update house RTP: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("House RTP updated, rows_affected=%d", rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateHousePawaBoxKeBets updates house total bets
+func (db *Database) UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update house total bets: %w", err)
+	}
+	query := `UPDATE "HouseIncome" SET total_bets = total_bets + $1`
+
+	db.logFor(ctx).Debugf("Updating house total bets: +%.2f", mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for house bets update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating house bets: %v", err)
+		return 0, fmt.Errorf("failed to update house bets: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("House bets updated: +%.2f, rows_affected=%d", mvalue, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateCustomerAviator updates aviator customer field
+func (db *Database) UpdateCustomerAviator(ctx context.Context, fieldName string, mvalue interface{}, id int64) (int64, error) {
+	query := fmt.Sprintf(`UPDATE "Aviator"."Customer" SET %s = $1 WHERE id = $2`, fieldName)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update aviator customer: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateCustomerAviatorBets updates aviator customer bets
+func (db *Database) UpdateCustomerAviatorBets(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	query := `UPDATE "Aviator"."Customer" 
+			 SET last_stake_time = NOW(), 
+				 bets = bets + 1, 
+				 total_bets = total_bets + $1 
+			 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update aviator customer bets: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateCustomerAviatorWins updates aviator customer wins
+func (db *Database) UpdateCustomerAviatorWins(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	query := `UPDATE "Aviator"."Customer" 
+			 SET win_count = win_count + 1, 
+				 loss_count = 0, 
+				 wins = wins + 1, 
+				 total_wins = total_wins + $1 
+			 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update aviator customer wins: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateCustomerAviatorLosses updates aviator customer losses
+func (db *Database) UpdateCustomerAviatorLosses(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	query := `UPDATE "Aviator"."Customer" 
+			 SET loss_count = loss_count + 1, 
+				 win_count = 0, 
+				 losses = losses + 1, 
+				 total_losses = total_losses + $1 
+			 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update aviator customer losses: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateCustomerWallet updates customer wallet balance
+func (db *Database) UpdateCustomerWallet(ctx context.Context, id int64, mvalue float64) (int64, error) {
+	query := `UPDATE "Aviator"."Customer" SET balance = $1 WHERE id = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update customer wallet: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdateCustomerWallet2 updates customer total withdrawal
+func (db *Database) UpdateCustomerWallet2(ctx context.Context, msisdn string, mvalue float64) (int64, error) {
+	query := `UPDATE "Aviator"."Customer" SET total_withdrawal = total_withdrawal + $1 WHERE msisdn = $2`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update customer wallet2: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertCustomerLogsAviator inserts aviator customer logs
+func (db *Database) InsertCustomerLogsAviator(ctx context.Context, amount float64, logType string, customerID int64, narrative string) (int64, error) {
+	query := `INSERT INTO "Aviator"."CustomerLogs" (customer_id, type, narrative, amount) VALUES ($1, $2, $3, $4)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, customerID, logType, narrative, amount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert aviator customer logs: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertCustomerLogsAviatorGame inserts aviator customer logs with game ID
+func (db *Database) InsertCustomerLogsAviatorGame(ctx context.Context, gameID int64, amount float64, logType string, customerID int64, narrative string) (int64, error) {
+	query := `INSERT INTO "Aviator"."CustomerLogs" (game_id, customer_id, type, narrative, amount) VALUES ($1, $2, $3, $4, $5)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, gameID, customerID, logType, narrative, amount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert aviator customer logs with game: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertUSSDSession inserts USSD session
+func (db *Database) InsertUSSDSession(ctx context.Context, data map[string]string) (int64, error) {
+	query := `INSERT INTO "Aviator"."ussd_session" (sessionId, serviceCode, msisdn, ussdString) VALUES ($1, $2, $3, $4)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, data["sessionId"], data["serviceCode"], data["msisdn"], data["ussdString"])
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert USSD session: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// DisburseWithdrawalAviator inserts into withdrawal queue for aviator
+func (db *Database) DisburseWithdrawalAviator(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
+	query := `INSERT INTO "luckynumber"."withdrawal_queue_ke" 
+			 (msisdn, amount, client, callback, reference) 
+			 VALUES ($1, $2, 'aviator', 'https://gameapi.strikebet.co.ke/', $3)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, msisdn, amount, reference)
+	if err != nil {
+		return 0, fmt.Errorf("failed to disburse aviator withdrawal: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// DisburseWithdrawals inserts into mpesa disburse
+func (db *Database) DisburseWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
+	query := `INSERT INTO "mpesa_disburse" 
+			 (transaction_id, reference, amount, msisdn) 
+			 VALUES (uuid(), $1, $2, $3)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, reference, amount, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to disburse withdrawals: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertIntoWithdrawals inserts into aviator withdrawals
+func (db *Database) InsertIntoWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
+	query := `INSERT INTO "Aviator"."withdrawals" (reference, amount, msisdn) VALUES ($1, $2, $3)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, reference, amount, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into withdrawals: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertIntoWithdrawalsLucky inserts into pawa box withdrawals
+func (db *Database) InsertIntoWithdrawalsLucky(ctx context.Context, nonAmount, amount, withholdTax float64, items string, msisdn, reference string) (int64, error) {
+	if err := money.CheckDelta(money.Payout, nonAmount, amount, withholdTax); err != nil {
+		return 0, fmt.Errorf("failed to insert withdrawal %s: %w", reference, err)
+	}
+	query := `INSERT INTO "withdrawals" 
+			 (non_roundoff_amount, tax_amount, items, game_id, reference, amount, msisdn) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, nonAmount, withholdTax, items, reference, reference, amount, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into lucky withdrawals: %w", err)
+	}
+
+	noteWrite(msisdn)
+	return result.RowsAffected(), nil
+}
+
+// InsertIntoJackPotWinners inserts jackpot winners
+func (db *Database) InsertIntoJackPotWinners(ctx context.Context, taxAmount float64, items string, gameID string, gameName, jackpotCategory string, kittyID string, amount float64, msisdn string) (int64, error) {
+	query := `INSERT INTO "jackpot_winners" 
+			 (tax_amount, items, game_id, game_name, jackpot_category, kitty_id, amount, msisdn, awarded) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'yes')`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, taxAmount, items, gameID, gameName, jackpotCategory, kittyID, amount, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert jackpot winners: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertIntoPendingWithdrawalsLucky inserts into pending withdrawals
+func (db *Database) InsertIntoPendingWithdrawalsLucky(ctx context.Context, amount, taxAmount float64, items, msisdn, reference string) (int64, error) {
+	query := `INSERT INTO "pending_withdrawals" 
+			 (tax_amount, items, reference, amount, msisdn) 
+			 VALUES ($1, $2, $3, $4, $5)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, taxAmount, items, reference, amount, msisdn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert pending withdrawals: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertIntoDepositRequest inserts into deposit requests
+func (db *Database) InsertIntoDepositRequest(ctx context.Context, amount float64, msisdn, reference string) (int64, error) {
+	query := `INSERT INTO "Aviator"."deposit_requests" (amount, msisdn, reference) VALUES ($1, $2, $3)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, amount, msisdn, reference)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// CheckWithdrawalsPawaBoxKe checks pending withdrawals
+func (db *Database) CheckWithdrawalsPawaBoxKe(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "withdrawals" WHERE status = $2 AND reference = $1 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference, status.WithdrawalPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// CheckUSSDSession checks USSD session
+func (db *Database) CheckUSSDSession(ctx context.Context, sessionID string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "Aviator"."ussd_session" WHERE sessionId = $1 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// InsertHouseLogsAviator inserts aviator house logs
+func (db *Database) InsertHouseLogsAviator(ctx context.Context, fieldName, msisdn string, mvalue float64) (int64, error) {
+	query := fmt.Sprintf(`INSERT INTO "Aviator"."HouseIncomeLogs" (msisdn, %s) VALUES ($1, $2)`, fieldName)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, msisdn, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert aviator house logs: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// InsertHouseLogsAviatorGameID inserts aviator house logs with game ID
+func (db *Database) InsertHouseLogsAviatorGameID(ctx context.Context, gameID int64, fieldName, msisdn string, mvalue float64) (int64, error) {
+	query := fmt.Sprintf(`INSERT INTO "Aviator"."HouseIncomeLogs" (game_id, msisdn, %s) VALUES ($1, $2, $3)`, fieldName)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, gameID, msisdn, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert aviator house logs with game: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// CheckUSSDSessionLogs checks USSD session logs
 func (db *Database) CheckUSSDSessionLogs(ctx context.Context, msisdn string) (map[string]interface{}, error) {
 	query := `SELECT payload, msisdn FROM "Aviator"."ussd_logs" 
 			 WHERE msisdn = $1 
@@ -2462,143 +6727,952 @@ func (db *Database) CheckUSSDSessionLogs(ctx context.Context, msisdn string) (ma
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, msisdn)
+	rows, err := conn.Query(ctx, query, msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// CheckDepositRequestLuckyFailed checks if a deposit request exists by reference
+func (db *Database) CheckDepositRequestLuckyFailed(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "deposit_requests" WHERE reference = $1 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("error reading rows: %w", err)
+		}
+		return nil, nil // No rows found
+	}
+
+	values, err := rows.Values()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get row values: %w", err)
+	}
+
+	fieldDescriptions := rows.FieldDescriptions()
+	result := make(map[string]interface{})
+	for i, fd := range fieldDescriptions {
+		result[string(fd.Name)] = values[i]
+	}
+
+	return result, nil
+}
+
+// CheckDepositRequests checks deposit requests
+func (db *Database) CheckDepositRequests(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "Aviator"."deposit_requests" WHERE reference = $1 AND status = $2 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference, status.DepositPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// CheckWithdrawalRequests checks withdrawal requests
+func (db *Database) CheckWithdrawalRequests(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT * FROM "Aviator"."withdrawals" WHERE reference = $1 AND status = $2 `
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference, status.WithdrawalPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	// Now use scanRowsToSingleMap which works with pgx.Rows
+	return db.scanRowsToSingleMap(rows)
+
+}
+
+// InsertIntoDepositLuckyRequest records an STK deposit request. Returns
+// ErrDuplicateReference when the reference is taken.
+func (db *Database) InsertIntoDepositLuckyRequest(
+	ctx context.Context,
+	ussd, game, carrier string,
+	gameCatID string,
+	amount float64,
+	msisdn, selectedBox, reference, channel string,
+) (int64, error) {
+
+	query := `INSERT INTO "deposit_requests" 
+          (ussd, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference) 
+          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	// Acquire connection from pool
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release() // Automatically release connection when function exits
+
+	// Execute the query
+	_, err = conn.Exec(
+		ctx,
+		query,
+		ussd, game, carrier, channel, gameCatID, amount, utils.ToString(msisdn), utils.ToInt(selectedBox), reference,
+	)
+	if isUniqueViolation(err) {
+		return 0, fmt.Errorf("failed to insert deposit request %s: %w", reference, ErrDuplicateReference)
+	}
+	if err != nil {
+		db.logFor(ctx).Errorf("Failed to insert deposit request: %v", err)
+		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
+	}
+
+	// If you need the last inserted ID instead of rows affected:
+	// Note: This depends on your database driver. For PostgreSQL with pgx:
+	var lastInsertID int64
+	err = conn.QueryRow(ctx, "SELECT LASTVAL()").Scan(&lastInsertID)
+	if err != nil {
+		db.logFor(ctx).Errorf("Failed to get last insert ID: %v", err)
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	db.logFor(ctx).Debugf("Inserted deposit request with ID: %d", lastInsertID)
+	return lastInsertID, nil
+}
+
+// InsertSTK inserts into STK queue
+func (db *Database) InsertSTK(ctx context.Context, game, carrier, reference, msisdn string, amount float64, shortcode string) (int64, error) {
+	query := `INSERT INTO "stk_queue_ke" 
+			 (game, carrier, reference, msisdn, amount, account, shortcode) 
+			 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, game, carrier, reference, msisdn, amount, reference, shortcode)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert STK: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// GetSTKRetry returns what a re-push of deposit request reference needs:
+// its owner, status, age and retry counters, and the shortcode of its
+// first push. Nil when there is no such request. It reads the primary, as
+// the claim that follows does.
+func (db *Database) GetSTKRetry(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT d.msisdn, d.status, d.carrier, d.amount::float8 AS amount, d.date_created,
+			d.stk_retries, COALESCE(d.stk_retried_at, d.date_created) AS last_push,
+			(SELECT q.shortcode FROM "stk_queue_ke" q WHERE q.reference = d.reference LIMIT 1) AS shortcode
+		FROM "deposit_requests" d
+		WHERE d.reference = $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	return db.scanRowsToSingleMap(rows)
+}
+
+// ClaimSTKRetry counts a re-push of deposit request reference that had
+// retries re-pushes when it was read. Returns false when it settled, was
+// re-pushed by a concurrent request, has maxRetries re-pushes already or
+// was last pushed less than spacing ago.
+func (db *Database) ClaimSTKRetry(ctx context.Context, reference string, retries, maxRetries int, spacing time.Duration) (bool, error) {
+	query := `UPDATE "deposit_requests"
+		SET stk_retries = stk_retries + 1, stk_retried_at = NOW()
+		WHERE reference = $1 AND stk_retries = $2 AND stk_retries < $3
+			AND (status IS NULL OR status = $5)
+			AND COALESCE(stk_retried_at, date_created) <= NOW() - make_interval(secs => $4)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	res, err := conn.Exec(ctx, query, reference, retries, maxRetries, spacing.Seconds(), status.DepositPending)
+	if err != nil {
+		return false, fmt.Errorf("failed to count STK retry: %w", err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// InsertWithdrawalQueue inserts into withdrawal queue
+func (db *Database) InsertWithdrawalQueue(ctx context.Context, reference, msisdn string, amount float64, callback string) (int64, error) {
+	query := `INSERT INTO "withdrawal_queue_ke" 
+			 (reference, msisdn, amount, callback) 
+			 VALUES ($1, $2, $3, $4)`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, reference, msisdn, amount, callback)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert withdrawal queue: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// undisbursedWithdrawal matches a "withdrawals" row with no successful
+// disbursement callback, the opposite of WithdrawalCallback.Succeeded. arg
+// is the placeholder bound to status.Strings(status.GatewaySucceeded). The
+// withdrawals_undisbursed index of migration 039 spells out the same
+// predicate.
+func undisbursedWithdrawal(arg string) string {
+	return `(disburse IS NULL OR lower(disburse) <> ALL(` + arg + `::text[]))`
+}
+
+// Re-drive refusals of RetryWithdrawal
+var (
+	ErrWithdrawalNotFound         = errors.New("withdrawal not found or not processed")
+	ErrWithdrawalDisbursed        = errors.New("withdrawal already disbursed")
+	ErrWithdrawalManual           = errors.New("withdrawal is flagged for manual resolution")
+	ErrWithdrawalAwaitingCallback = errors.New("withdrawal is still awaiting its disbursement callback")
+)
+
+// FindUndisbursedWithdrawals returns a page of processed withdrawals older
+// than olderThan that no successful disbursement callback has matched,
+// oldest first, and how many there are in all. Rows flagged for manual
+// resolution are included.
+func (db *Database) FindUndisbursedWithdrawals(ctx context.Context, olderThan time.Duration, limit, offset int) ([]map[string]interface{}, int64, error) {
+	where := `WHERE status = $1 AND ` + undisbursedWithdrawal("$3") + `
+			AND date_created < NOW() - make_interval(secs => $2)`
+
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var total int64
+	err = conn.QueryRow(ctx, `SELECT COUNT(*) FROM "withdrawals" `+where,
+		status.WithdrawalProcessed, olderThan.Seconds(), status.Strings(status.GatewaySucceeded)).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count undisbursed withdrawals: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT reference, msisdn, amount::float8 AS amount,
+			disburse, description, transaction_id, disburse_retries, disburse_retried_at,
+			manual_resolution, date_created
+		FROM "withdrawals" `+where+`
+		ORDER BY date_created
+		LIMIT $4 OFFSET $5`, status.WithdrawalProcessed, olderThan.Seconds(), status.Strings(status.GatewaySucceeded), limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	withdrawals, err := db.scanRowsToMap(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return withdrawals, total, nil
+}
+
+// RetryWithdrawal re-drives processed withdrawal reference on behalf of
+// admin: it clears its disbursement status, counts the retry and puts it
+// back on withdrawal_queue_ke. One that has maxRetries re-drives already is
+// flagged manual_resolution instead and not requeued. Either way the
+// re-drive is recorded in withdrawal_retries.
+//
+// The row is locked for the duration, so a disbursement callback either
+// lands first and is seen here, or waits and lands on the requeued row.
+// A withdrawal already disbursed returns ErrWithdrawalDisbursed, and one
+// sent less than awaitCallback ago that has not been answered yet
+// ErrWithdrawalAwaitingCallback.
+func (db *Database) RetryWithdrawal(ctx context.Context, reference, admin string, maxRetries int, awaitCallback time.Duration) (*WithdrawalRetry, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		w                 = WithdrawalRetry{Reference: reference}
+		disburse          *string
+		retries           int
+		manual, disbursed bool
+		awaiting          bool
+	)
+	err = tx.QueryRow(ctx, `SELECT msisdn, amount::float8, disburse, disburse_retries, manual_resolution,
+			NOT `+undisbursedWithdrawal("$4")+`,
+			disburse IS NULL AND COALESCE(disburse_retried_at, date_created) > NOW() - make_interval(secs => $3)
+		FROM "withdrawals"
+		WHERE reference = $1 AND status = $2
+		ORDER BY date_created DESC
+		LIMIT 1
+		FOR UPDATE`, reference, status.WithdrawalProcessed, awaitCallback.Seconds(), status.Strings(status.GatewaySucceeded)).
+		Scan(&w.Msisdn, &w.Amount, &disburse, &retries, &manual, &disbursed, &awaiting)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWithdrawalNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load withdrawal %s: %w", reference, err)
+	}
+	switch {
+	case disbursed:
+		return nil, ErrWithdrawalDisbursed
+	case manual:
+		return nil, ErrWithdrawalManual
+	case awaiting:
+		return nil, ErrWithdrawalAwaitingCallback
+	}
+
+	w.Attempt = retries + 1
+	w.Outcome = WithdrawalRequeued
+	if retries >= maxRetries {
+		w.Outcome = WithdrawalManual
+		if _, err := tx.Exec(ctx, `UPDATE "withdrawals" SET manual_resolution = TRUE
+			WHERE reference = $1 AND status = $2`, reference, status.WithdrawalProcessed); err != nil {
+			return nil, fmt.Errorf("failed to flag withdrawal %s: %w", reference, err)
+		}
+	} else {
+		if _, err := tx.Exec(ctx, `UPDATE "withdrawals"
+			SET disburse = NULL, disburse_retries = disburse_retries + 1, disburse_retried_at = NOW()
+			WHERE reference = $1 AND status = $2`, reference, status.WithdrawalProcessed); err != nil {
+			return nil, fmt.Errorf("failed to count withdrawal retry %s: %w", reference, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO "withdrawal_queue_ke" (reference, msisdn, amount, callback)
+			VALUES ($1, $2, $3, $4)`, reference, w.Msisdn, w.Amount, "http?"); err != nil {
+			return nil, fmt.Errorf("failed to insert withdrawal queue: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO "withdrawal_retries" (reference, attempt, outcome, previous_disburse, admin)
+		VALUES ($1, $2, $3, $4, $5)`, reference, w.Attempt, w.Outcome, disburse, admin); err != nil {
+		return nil, fmt.Errorf("failed to record withdrawal retry: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit withdrawal retry: %w", err)
+	}
+	noteWrite(w.Msisdn)
+	return &w, nil
+}
+
+// UpdateSMSDeliveryStatus records a gateway delivery report against the
+// dbQueue row. A row that already holds a final status keeps it, so a late
+// SENT cannot undo DELIVERED. The gateway has sent an OTP message by the
+// time it reports on it, so its text, the code, is cleared. Returns false
+// when the row is missing or final.
+func (db *Database) UpdateSMSDeliveryStatus(ctx context.Context, recordID int64, delivery, description string) (bool, error) {
+	query := `
+		UPDATE "dbQueue"
+		SET delivery_status = $2, delivery_description = $3, delivery_updated_at = NOW(),
+			"Message" = CASE WHEN command = 'otp' THEN '' ELSE "Message" END
+		WHERE "RecordID" = $1
+		  AND (delivery_status IS NULL OR delivery_status <> ALL($4::text[]))
+	`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	res, err := conn.Exec(ctx, query, recordID, delivery, description, status.Strings(status.SMSFinal))
+	if err != nil {
+		return false, fmt.Errorf("failed to update SMS delivery status: %w", err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// InsertCustomerLogsPawaBoxKeWithID inserts customer logs and returns the ID
+func (db *Database) InsertCustomerLogsPawaBoxKeWithID(ctx context.Context, amount float64, logType string, customerID int64, narrative, reference string) (int64, error) {
+	query := `INSERT INTO "CustomerLogs" 
+	(customer_id, type, narrative, amount, game_id) 
+	VALUES ($1, $2, $3, $4, $5) 
+	RETURNING id`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var insertedID int64
+	err = conn.QueryRow(ctx, query, customerID, logType, narrative, amount, reference).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert customer logs: %w", err)
+	}
+
+	return insertedID, nil
+}
+
+// UpdateHouseLuckyWins updates house total wins
+func (db *Database) UpdateHouseLuckyWins(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update house wins: %w", err)
+	}
+	query := `UPDATE "HouseIncome" 
+	SET total_wins = total_wins + $1`
+
+	db.logFor(ctx).Debugf("Updating house wins: +%.2f", mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for house wins update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating house wins: %v", err)
+		return 0, fmt.Errorf("failed to update house wins: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("House wins updated successfully: +%.2f, rows_affected=%d", mvalue, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateHouseLuckyBasketWins deducts amount from basket for wins
+func (db *Database) UpdateHouseLuckyBasketWins(ctx context.Context, mvalue float64) (bool, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return false, fmt.Errorf("failed to deduct basket wins: %w", err)
+	}
+	query := `UPDATE "Basket" 
+	SET amount = amount - $1 
+	WHERE amount - reserved >= $1` // Ensure we don't go negative or into held wins
+
+	db.logFor(ctx).Debugf("Deducting from basket for wins: -%.2f", mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for basket update: %v", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating basket: %v", err)
+		return false, fmt.Errorf("failed to update basket: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	success := rowsAffected > 0
+
+	if success {
+		db.logFor(ctx).Debugf("Basket updated successfully: -%.2f, rows_affected=%d", mvalue, rowsAffected)
+	} else {
+		db.logFor(ctx).Warnf("No basket record updated (insufficient funds or no record): amount=%.2f", mvalue)
+	}
+
+	return success, nil
+}
+
+// UpdateRESTLossUser updates player payout and resets loss count
+func (db *Database) UpdateRESTLossUser(ctx context.Context, payout float64, id int64) (int64, error) {
+	query := `UPDATE "Player" 
+	SET payout = payout + $1, lost_count = 0, lost_since = NULL
+	WHERE id = $2`
+
+	db.logFor(ctx).Debugf("Updating player loss reset: id=%d, payout=+%.2f", id, payout)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for player update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, payout, id)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating player loss reset: %v", err)
+		return 0, fmt.Errorf("failed to update player: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Player loss reset updated: id=%d, rows_affected=%d", id, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// InsertTaxQueueWithID inserts tax record, with the rate it was deducted
+// at, and returns the ID
+func (db *Database) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error) {
+	query := `INSERT INTO "tax_record" 
+	(game_id, amount, tax_amount, after_tax, tax_type, msisdn, rate) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7) 
+	ON CONFLICT DO NOTHING
+	RETURNING id`
+
+	db.logFor(ctx).Debugf("Inserting tax record: game_id=%s, amount=%.2f, tax=%.2f, rate=%.2f, type=%s, msisdn=%s",
+		gameID, amount, taxAmount, rate, taxType, utils.RedactMsisdn(msisdn))
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for tax record: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var insertedID int64
+	err = conn.QueryRow(ctx, query, gameID, amount, taxAmount, taxDeductedAmount, taxType, msisdn, rate).Scan(&insertedID)
+	if err != nil {
+		// Check if it's a no-rows error (conflict)
+		if err == pgx.ErrNoRows {
+			db.logFor(ctx).Debugf("Tax record already exists or conflict occurred")
+			return 0, nil
+		}
+		db.logFor(ctx).Errorf("Error inserting tax record: %v", err)
+		return 0, fmt.Errorf("failed to insert tax record: %w", err)
+	}
+
+	db.logFor(ctx).Debugf("Tax record inserted successfully, ID: %d", insertedID)
+	return insertedID, nil
+}
+
+// UpdatePawaBoxKeWithdrawalRequest updates withdrawal request status to processed
+func (db *Database) UpdatePawaBoxKeWithdrawalRequest(ctx context.Context, reference string) (int64, error) {
+	query := `UPDATE "withdrawals" 
+	SET status = $2 
+	WHERE reference = $1`
+
+	db.logFor(ctx).Debugf("Updating withdrawal request status to processed: ref=%s", reference)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for withdrawal update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, reference, status.WithdrawalProcessed)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating withdrawal request: %v", err)
+		return 0, fmt.Errorf("failed to update withdrawal request: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Withdrawal request updated to processed: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateHouseLuckyHouseLosses updates house losses
+func (db *Database) UpdateHouseLuckyHouseLosses(ctx context.Context, mvalue float64) (int64, error) {
+	if err := money.CheckDelta(money.Counter, mvalue); err != nil {
+		return 0, fmt.Errorf("failed to update house losses: %w", err)
+	}
+	query := `UPDATE "HouseIncome" 
+	SET total_losses = total_losses + $1`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, mvalue)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update house losses: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
+// UpdatePawaBoxKeWithdrawalB2BDisburse updates B2B withdrawal disbursement status
+func (db *Database) UpdatePawaBoxKeWithdrawalB2BDisburse(ctx context.Context, transactionID, disburse, description, reference string) (bool, error) {
+	query := `UPDATE "withdrawalsb2b" 
+	SET transaction_id = $1, disburse = $2, description = $3 
+	WHERE status = $5 AND reference = $4`
+
+	db.logFor(ctx).Debugf("Updating B2B withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
+		reference, transactionID, disburse)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for B2B withdrawal update: %v", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, transactionID, disburse, description, reference, status.WithdrawalProcessed)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating B2B withdrawal disburse: %v", err)
+		return false, fmt.Errorf("failed to update B2B withdrawal disburse: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	success := rowsAffected > 0
+
+	if success {
+		db.logFor(ctx).Debugf("B2B withdrawal disburse updated successfully: ref=%s, rows_affected=%d", reference, rowsAffected)
+	} else {
+		db.logFor(ctx).Warnf("No B2B withdrawal found to update: ref=%s", reference)
+	}
+
+	return success, nil
+}
+
+// UpdatePawaBoxKeWithdrawalDisburseMotto updates LudoMotto withdrawal disbursement status
+func (db *Database) UpdatePawaBoxKeWithdrawalDisburseMotto(ctx context.Context, transactionID, disburse, description, reference string) (bool, error) {
+	query := `UPDATE "LudoMotto_Ke"."withdrawals" 
+	SET transaction_id = $1, disburse = $2, description = $3 
+	WHERE status = $5 AND reference = $4`
+
+	db.logFor(ctx).Debugf("Updating LudoMotto withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
+		reference, transactionID, disburse)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for LudoMotto withdrawal update: %v", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, transactionID, disburse, description, reference, status.WithdrawalProcessed)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating LudoMotto withdrawal disburse: %v", err)
+		return false, fmt.Errorf("failed to update LudoMotto withdrawal disburse: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	success := rowsAffected > 0
+
+	if success {
+		db.logFor(ctx).Debugf("LudoMotto withdrawal disburse updated successfully: ref=%s, rows_affected=%d", reference, rowsAffected)
+	} else {
+		db.logFor(ctx).Warnf("No LudoMotto withdrawal found to update: ref=%s", reference)
+	}
+
+	return success, nil
+}
+
+// UpdatePawaBoxKeWithdrawalDisburse records the disbursement status of a
+// processed withdrawal and returns it, nil when none matches reference
+func (db *Database) UpdatePawaBoxKeWithdrawalDisburse(ctx context.Context, transactionID, disburse, description, reference string) (*DisbursedWithdrawal, error) {
+	query := `UPDATE "withdrawals" 
+	SET transaction_id = $1, disburse = $2, description = $3 
+	WHERE status = $5 AND reference = $4
+	RETURNING msisdn, amount::float8, reference`
+
+	db.logFor(ctx).Debugf("Updating withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
+		reference, transactionID, disburse)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for withdrawal update: %v", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var w DisbursedWithdrawal
+	err = conn.QueryRow(ctx, query, transactionID, disburse, description, reference, status.WithdrawalProcessed).
+		Scan(&w.Msisdn, &w.Amount, &w.Reference)
+	if errors.Is(err, pgx.ErrNoRows) {
+		db.logFor(ctx).Warnf("No withdrawal found to update: ref=%s", reference)
+		return nil, nil
+	}
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating withdrawal disburse: %v", err)
+		return nil, fmt.Errorf("failed to update withdrawal disburse: %w", err)
+	}
+
+	db.logFor(ctx).Debugf("Withdrawal disburse updated successfully: ref=%s", reference)
+	return &w, nil
+}
+
+// UpdateAviatorDepositFailRequestLucky updates deposit request to failed status
+func (db *Database) UpdateAviatorDepositFailRequestLucky(ctx context.Context, reference, description string) (int64, error) {
+	query := `UPDATE "deposit_requests" 
+	SET status = $3, description = $1 
+	WHERE reference = $2`
+
+	db.logFor(ctx).Debugf("Updating deposit request to failed: ref=%s, description=%s", reference, description)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for deposit fail update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, description, reference, status.DepositFail)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating deposit request to failed: %v", err)
+		return 0, fmt.Errorf("failed to update deposit request: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("Deposit request updated to failed: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// UpdateAviatorDepositFailRequestLuckySTK updates STK results to failed status
+func (db *Database) UpdateAviatorDepositFailRequestLuckySTK(ctx context.Context, reference, description string) (int64, error) {
+	query := `UPDATE "stk_results" 
+	SET status = $3, description = $1 
+	WHERE reference = $2`
+
+	db.logFor(ctx).Debugf("Updating STK result to failed: ref=%s, description=%s", reference, description)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for STK fail update: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	result, err := conn.Exec(ctx, query, description, reference, status.DepositFail)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error updating STK result to failed: %v", err)
+		return 0, fmt.Errorf("failed to update STK result: %w", err)
+	}
+
+	rowsAffected := result.RowsAffected()
+	db.logFor(ctx).Debugf("STK result updated to failed: ref=%s, rows_affected=%d", reference, rowsAffected)
+
+	return rowsAffected, nil
+}
+
+// InsertIntoSMSQueue inserts a message into the SMS queue and returns the
+// ID. sequence orders it among msisdn's messages for the drainer (048).
+func (db *Database) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	query := `INSERT INTO "dbQueue" ("Originator", "Destination", "Message",  "MessageDirection","MessageTimeStamp", "SMSCID", "command", "Sequence")
+VALUES ($1, $2, $3, $4, NOW(), $5, $6, $7) 
+    RETURNING "RecordID"`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var insertedID int64
+	params := []interface{}{"LuckyNumber", msisdn, message, "OUT", smscID, response, sequence}
+	err = conn.QueryRow(ctx, query, params...).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into SMS queue: %w", err)
+	}
+
+	db.logFor(ctx).Debugf("SMS queued with ID %d for %s", insertedID, utils.RedactMsisdn(msisdn))
+	return insertedID, nil
+}
+
+// InsertCustomerLogsPawaBoxKeWithID inserts customer logs and returns the ID
+func (db *Database) InsertCustomerLogsPawaBoxKe(ctx context.Context, amount float64, logType string, customerID string, narrative, reference string) (int64, error) {
+	query := `INSERT INTO "CustomerLogs" 
+	(customer_id, type, narrative, amount, game_id) 
+	VALUES ($1, $2, $3, $4, $5) 
+	RETURNING id`
+
+	db.logFor(ctx).Debugf("Inserting customer log: customer_id=%s, type=%s, amount=%.2f", customerID, logType, amount)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for customer log: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var insertedID int64
+	err = conn.QueryRow(ctx, query, customerID, logType, narrative, amount, reference).Scan(&insertedID)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error inserting customer log: %v", err)
+		return 0, fmt.Errorf("failed to insert customer log: %w", err)
+	}
+
+	db.logFor(ctx).Debugf("Customer log inserted successfully, ID: %d", insertedID)
+	return insertedID, nil
+}
+
+// InsertHouseLogsPawaBoxKeGameIDWithID inserts house income logs and returns the ID
+func (db *Database) InsertHouseLogsPawaBoxKeGameID(ctx context.Context, gameID string, fieldName, msisdn string, mvalue float64) (int64, error) {
+	// Validate field name
+	validFields := map[string]bool{
+		"total_bets": true, "total_wins": true, "total_losses": true,
+		"house_income": true, "total_payout": true, "total_profit": true,
+		"amount": true, "credit": true, "debit": true,
+		"free_bet_stake": true,
+	}
+
+	if !validFields[fieldName] {
+		return 0, fmt.Errorf("invalid field name: %s", fieldName)
+	}
+
+	query := fmt.Sprintf(`INSERT INTO "HouseIncomeLogs" 
+	(game_id, msisdn, %s) 
+	VALUES ($1, $2, $3) 
+	RETURNING id`, fieldName)
+
+	db.logFor(ctx).Debugf("Inserting house income log: game_id=%s, msisdn=%s, %s=%.2f", gameID, utils.RedactMsisdn(msisdn), fieldName, mvalue)
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		db.logFor(ctx).Errorf("Error acquiring connection for house income log: %v", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var insertedID int64
+	err = conn.QueryRow(ctx, query, gameID, msisdn, mvalue).Scan(&insertedID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		db.logFor(ctx).Errorf("Error inserting house income log: %v", err)
+		return 0, fmt.Errorf("failed to insert house income log: %w", err)
 	}
-	defer rows.Close()
-
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
 
+	db.logFor(ctx).Debugf("House income log inserted successfully, ID: %d", insertedID)
+	return insertedID, nil
 }
 
-// CheckDepositRequestLuckyFailed checks if a deposit request exists by reference
-func (db *Database) CheckDepositRequestLuckyFailed(ctx context.Context, reference string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "deposit_requests" WHERE reference = $1 `
+// InsertB2BWithdrawalB2B inserts into B2B withdrawal processing
+func (db *Database) InsertB2BWithdrawalB2B(ctx context.Context, reference, msisdn string, amount float64, betStatus status.B2BStatus) (int64, error) {
+	query := `INSERT INTO "withdrawal_b2b_to_process" 
+			 (reference, msisdn, amount, bet_status) 
+			 VALUES ($1, $2, $3, $4)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, reference)
+	result, err := conn.Exec(ctx, query, reference, msisdn, amount, betStatus)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, fmt.Errorf("failed to insert B2B withdrawal: %w", err)
 	}
-	defer rows.Close()
 
-	if !rows.Next() {
-		if err := rows.Err(); err != nil {
-			return nil, fmt.Errorf("error reading rows: %w", err)
-		}
-		return nil, nil // No rows found
-	}
+	return result.RowsAffected(), nil
+}
 
-	values, err := rows.Values()
+// InsertSpinResult records one spin (table spin_results, see models.SpinResult) and returns its id
+func (db *Database) InsertSpinResult(ctx context.Context, playerID, spinID string, drums []byte, stake, winAmount, balance int64, isWin bool) (int64, error) {
+	query := `INSERT INTO "spin_results"
+			 (created_at, updated_at, player_id, spin_id, drums, win_amount, balance, stake, is_win, timestamp)
+			 VALUES (NOW(), NOW(), $1, $2, $3, $4, $5, $6, $7, NOW())
+			 RETURNING id`
+
+	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get row values: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	fieldDescriptions := rows.FieldDescriptions()
-	result := make(map[string]interface{})
-	for i, fd := range fieldDescriptions {
-		result[string(fd.Name)] = values[i]
+	var insertedID int64
+	err = conn.QueryRow(ctx, query, playerID, spinID, drums, winAmount, balance, stake, isWin).Scan(&insertedID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert spin result: %w", err)
 	}
 
-	return result, nil
+	return insertedID, nil
 }
 
-// CheckDepositRequests checks deposit requests
-func (db *Database) CheckDepositRequests(ctx context.Context, reference string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Aviator"."deposit_requests" WHERE reference = $1 AND status = 'pending' `
+// InsertSpinWinLine records a winning line of a spin (table win_lines, see models.WinLine)
+func (db *Database) InsertSpinWinLine(ctx context.Context, spinResultID int64, lineNumber int, symbol string, count int, payout int64, positions []byte) (int64, error) {
+	query := `INSERT INTO "win_lines"
+			 (created_at, updated_at, spin_result_id, line_number, symbol, count, payout, positions)
+			 VALUES (NOW(), NOW(), $1, $2, $3, $4, $5, $6)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, reference)
+	result, err := conn.Exec(ctx, query, spinResultID, lineNumber, symbol, count, payout, positions)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return 0, fmt.Errorf("failed to insert spin win line: %w", err)
 	}
-	defer rows.Close()
-
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
 
+	return result.RowsAffected(), nil
 }
 
-// CheckWithdrawalRequests checks withdrawal requests
-func (db *Database) CheckWithdrawalRequests(ctx context.Context, reference string) (map[string]interface{}, error) {
-	query := `SELECT * FROM "Aviator"."withdrawals" WHERE reference = $1 AND status = 'pending' `
+// InsertUSSDLogs inserts USSD session logs
+func (db *Database) InsertUSSDLogs(ctx context.Context, msisdn, sessionID, serviceCode, ussdString string) (int64, error) {
+	query := `INSERT INTO "ussd_session" 
+	(msisdn, sessionId, serviceCode, ussdString) 
+	VALUES ($1, $2, $3, $4) 
+	ON CONFLICT DO NOTHING` // PostgreSQL equivalent of INSERT IGNORE
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to acquire connection: %w", err)
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	rows, err := conn.Query(ctx, query, reference)
+	result, err := conn.Exec(ctx, query, msisdn, sessionID, serviceCode, ussdString)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
-	}
-	defer rows.Close()
 
-	// Now use scanRowsToSingleMap which works with pgx.Rows
-	return db.scanRowsToSingleMap(rows)
+		return 0, fmt.Errorf("failed to insert USSD logs: %w", err)
+	}
 
+	return result.RowsAffected(), nil
 }
 
-func (db *Database) InsertIntoDepositLuckyRequest(
-	ctx context.Context,
-	ussd, game, carrier string,
-	gameCatID string,
-	amount float64,
-	msisdn, selectedBox, reference, channel string,
-) (int64, error) {
+// InsertAviatorUssdLogs inserts aviator USSD logs
+func (db *Database) InsertAviatorUssdLogs(ctx context.Context, gameID int64, sessionID, msisdn, payload string) (int64, error) {
+	query := `INSERT INTO "Aviator"."ussd_logs" (game_id, sessionid, msisdn, payload) VALUES ($1, $2, $3, $4)`
 
-	query := `INSERT INTO "deposit_requests" 
-          (ussd, game, carrier, channel, game_cat_id, amount, msisdn, selected_box, reference) 
-          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
-	// Acquire connection from pool
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
-	defer conn.Release() // Automatically release connection when function exits
-
-	// Execute the query
-	_, err = conn.Exec(
-		ctx,
-		query,
-		ussd, game, carrier, channel, gameCatID, amount, utils.ToString(msisdn), utils.ToInt(selectedBox), reference,
-	)
-	if err != nil {
-		fmt.Errorf("Failed to insert deposit request: %v", err)
-		return 0, fmt.Errorf("failed to insert deposit request: %w", err)
-	}
+	defer conn.Release()
 
-	// If you need the last inserted ID instead of rows affected:
-	// Note: This depends on your database driver. For PostgreSQL with pgx:
-	var lastInsertID int64
-	err = conn.QueryRow(ctx, "SELECT LASTVAL()").Scan(&lastInsertID)
+	result, err := conn.Exec(ctx, query, gameID, sessionID, msisdn, payload)
 	if err != nil {
-		fmt.Errorf("Failed to get last insert ID: %v", err)
-		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+		return 0, fmt.Errorf("failed to insert aviator USSD logs: %w", err)
 	}
 
-	fmt.Printf("Successfully inserted deposit request with ID: %d", lastInsertID)
-	return lastInsertID, nil
+	return result.RowsAffected(), nil
 }
 
-// InsertSTK inserts into STK queue
-func (db *Database) InsertSTK(ctx context.Context, game, carrier, reference, msisdn string, amount float64, shortcode string) (int64, error) {
-	query := `INSERT INTO "stk_queue_ke" 
-			 (game, carrier, reference, msisdn, amount, account, shortcode) 
-			 VALUES ($1, $2, $3, $4, $5, $6, $7)`
+// InsertAviatorUssdInputLogs inserts aviator USSD input logs
+func (db *Database) InsertAviatorUssdInputLogs(ctx context.Context, sessionCode, sessionID, msisdn, ussdMenu string) (int64, error) {
+	query := `INSERT INTO "Aviator"."ussd_log_inputs" (ussd_code, sessionid, msisdn, ussd_menu) VALUES ($1, $2, $3, $4)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -2606,19 +7680,19 @@ func (db *Database) InsertSTK(ctx context.Context, game, carrier, reference, msi
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, game, carrier, reference, msisdn, amount, reference, shortcode)
+	result, err := conn.Exec(ctx, query, sessionCode, sessionID, msisdn, ussdMenu)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert STK: %w", err)
+		return 0, fmt.Errorf("failed to insert aviator USSD input logs: %w", err)
 	}
 
 	return result.RowsAffected(), nil
 }
 
-// InsertWithdrawalQueue inserts into withdrawal queue
-func (db *Database) InsertWithdrawalQueue(ctx context.Context, reference, msisdn string, amount float64, callback string) (int64, error) {
-	query := `INSERT INTO "withdrawal_queue_ke" 
-			 (reference, msisdn, amount, callback) 
-			 VALUES ($1, $2, $3, $4)`
+// UpdateAviatorUssdLogs updates aviator USSD logs
+func (db *Database) UpdateAviatorUssdLogs(ctx context.Context, sessionID, msisdn string, gameID int64, payload string) (int64, error) {
+	query := `UPDATE "Aviator"."ussd_logs" 
+			 SET sessionid = $1, payload = $2 
+			 WHERE game_id = $3 AND msisdn = $4`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -2626,20 +7700,17 @@ func (db *Database) InsertWithdrawalQueue(ctx context.Context, reference, msisdn
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, reference, msisdn, amount, callback)
+	result, err := conn.Exec(ctx, query, sessionID, payload, gameID, msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert withdrawal queue: %w", err)
+		return 0, fmt.Errorf("failed to update aviator USSD logs: %w", err)
 	}
 
 	return result.RowsAffected(), nil
 }
 
-// InsertCustomerLogsPawaBoxKeWithID inserts customer logs and returns the ID
-func (db *Database) InsertCustomerLogsPawaBoxKeWithID(ctx context.Context, amount float64, logType string, customerID int64, narrative, reference string) (int64, error) {
-	query := `INSERT INTO "CustomerLogs" 
-	(customer_id, type, narrative, amount, game_id) 
-	VALUES ($1, $2, $3, $4, $5) 
-	RETURNING id`
+// UpdateAviatorUssdLogsStatus updates aviator USSD logs status
+func (db *Database) UpdateAviatorUssdLogsStatus(ctx context.Context, gameID int64, msisdn string) (int64, error) {
+	query := `UPDATE "Aviator"."ussd_logs" SET status = 'closed' WHERE game_id = $1 AND msisdn = $2`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -2647,430 +7718,548 @@ func (db *Database) InsertCustomerLogsPawaBoxKeWithID(ctx context.Context, amoun
 	}
 	defer conn.Release()
 
-	var insertedID int64
-	err = conn.QueryRow(ctx, query, customerID, logType, narrative, amount, reference).Scan(&insertedID)
+	result, err := conn.Exec(ctx, query, gameID, msisdn)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert customer logs: %w", err)
+		return 0, fmt.Errorf("failed to update aviator USSD logs status: %w", err)
 	}
 
-	return insertedID, nil
+	return result.RowsAffected(), nil
 }
 
-// UpdateHouseLuckyWins updates house total wins
-func (db *Database) UpdateHouseLuckyWins(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "HouseIncome" 
-	SET total_wins = total_wins + $1`
+// Additional methods can be added following the same pattern...
+
+// Close closes the database connection pool
+// Round states. A round moves created -> funded -> played -> settled ->
+// paid, or to failed from any state before paid.
+const (
+	RoundCreated = "created"
+	RoundFunded  = "funded"
+	RoundPlayed  = "played"
+	RoundSettled = "settled"
+	RoundPaid    = "paid"
+	RoundFailed  = "failed"
+)
+
+// roundTransitions lists the states each round state may move to
+var roundTransitions = map[string][]string{
+	RoundCreated: {RoundFunded, RoundFailed},
+	RoundFunded:  {RoundPlayed, RoundFailed},
+	RoundPlayed:  {RoundSettled, RoundFailed},
+	RoundSettled: {RoundPaid, RoundFailed},
+}
 
-	log.Printf("Updating house wins: +%.2f", mvalue)
+var (
+	ErrRoundNotFound          = errors.New("round not found")
+	ErrRoundExists            = errors.New("round already exists")
+	ErrInvalidRoundTransition = errors.New("invalid round transition")
+)
+
+// RoundTransitionAllowed reports whether a round in state from may move to
+// state to
+func RoundTransitionAllowed(from, to string) bool {
+	return slices.Contains(roundTransitions[from], to)
+}
 
+// CreateRound opens the round of reference in state created, with the tax
+// rates in effect now. It returns ErrRoundExists when reference already has
+// one.
+func (db *Database) CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for house wins update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		log.Printf("Error updating house wins: %v", err)
-		return 0, fmt.Errorf("failed to update house wins: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("House wins updated successfully: +%.2f, rows_affected=%d", mvalue, rowsAffected)
+	tag, err := tx.Exec(ctx, `INSERT INTO "game_rounds" (reference, msisdn, game_cat_id, amount, state, excise_rate, withholding_rate)
+		VALUES ($1, $2, $3, $4, $5, `+taxRateNow(TaxExcise)+`, `+taxRateNow(TaxWithholding)+`)
+		ON CONFLICT (reference) DO NOTHING`, reference, msisdn, gameCatID, amount, RoundCreated)
+	if err != nil {
+		return fmt.Errorf("failed to create round: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w: %s", ErrRoundExists, reference)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "game_round_events" (reference, to_state, actor, detail)
+		VALUES ($1, $2, $3, $4)`, reference, RoundCreated, actor, detail); err != nil {
+		return fmt.Errorf("failed to record round event: %w", err)
+	}
 
-	return rowsAffected, nil
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit round: %w", err)
+	}
+	return nil
 }
 
-// UpdateHouseLuckyBasketWins deducts amount from basket for wins
-func (db *Database) UpdateHouseLuckyBasketWins(ctx context.Context, mvalue float64) (bool, error) {
-	query := `UPDATE "Basket" 
-	SET amount = amount - $1 
-	WHERE amount >= $1` // Ensure we don't go negative
-
-	log.Printf("Deducting from basket for wins: -%.2f", mvalue)
-
+// TransitionRound moves the round of reference to state to and records who
+// moved it. A move the state machine does not allow, such as settling a
+// round twice, returns ErrInvalidRoundTransition and changes nothing.
+func (db *Database) TransitionRound(ctx context.Context, reference, to, actor, detail string) error {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for basket update: %v", err)
-		return false, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	tx, err := conn.Begin(ctx)
 	if err != nil {
-		log.Printf("Error updating basket: %v", err)
-		return false, fmt.Errorf("failed to update basket: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	rowsAffected := result.RowsAffected()
-	success := rowsAffected > 0
+	var from string
+	err = tx.QueryRow(ctx, `SELECT state FROM "game_rounds" WHERE reference = $1 FOR UPDATE`, reference).Scan(&from)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %s", ErrRoundNotFound, reference)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load round: %w", err)
+	}
+	if !RoundTransitionAllowed(from, to) {
+		return fmt.Errorf("%w: %s is %s, cannot move to %s", ErrInvalidRoundTransition, reference, from, to)
+	}
 
-	if success {
-		log.Printf("Basket updated successfully: -%.2f, rows_affected=%d", mvalue, rowsAffected)
-	} else {
-		log.Printf("No basket record updated (insufficient funds or no record): amount=%.2f", mvalue)
+	if _, err := tx.Exec(ctx, `UPDATE "game_rounds" SET state = $2, date_updated = NOW() WHERE reference = $1`, reference, to); err != nil {
+		return fmt.Errorf("failed to update round: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO "game_round_events" (reference, from_state, to_state, actor, detail)
+		VALUES ($1, $2, $3, $4, $5)`, reference, from, to, actor, detail); err != nil {
+		return fmt.Errorf("failed to record round event: %w", err)
 	}
 
-	return success, nil
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit round transition: %w", err)
+	}
+	return nil
 }
 
-// UpdateRESTLossUser updates player payout and resets loss count
-func (db *Database) UpdateRESTLossUser(ctx context.Context, payout float64, id int64) (int64, error) {
-	query := `UPDATE "Player" 
-	SET payout = payout + $1, lost_count = 0 
-	WHERE id = $2`
-
-	log.Printf("Updating player loss reset: id=%d, payout=+%.2f", id, payout)
-
+// GetRound returns the round of reference and its events in order, or a
+// nil round when there is none
+func (db *Database) GetRound(ctx context.Context, reference string) (map[string]interface{}, []map[string]interface{}, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for player update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, payout, id)
+	rows, err := conn.Query(ctx, `SELECT reference, msisdn, game_cat_id, amount::float8 AS amount, state, date_created, date_updated
+		FROM "game_rounds" WHERE reference = $1`, reference)
 	if err != nil {
-		log.Printf("Error updating player loss reset: %v", err)
-		return 0, fmt.Errorf("failed to update player: %w", err)
+		return nil, nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	round, err := db.scanRowsToSingleMap(rows)
+	rows.Close()
+	if err != nil || round == nil {
+		return nil, nil, err
 	}
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Player loss reset updated: id=%d, rows_affected=%d", id, rowsAffected)
-
-	return rowsAffected, nil
+	rows, err = conn.Query(ctx, `SELECT from_state, to_state, actor, detail, date_created
+		FROM "game_round_events" WHERE reference = $1 ORDER BY id`, reference)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	events, err := db.scanRowsToMap(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return round, events, nil
 }
 
-// InsertTaxQueueWithID inserts tax record and returns the ID
-func (db *Database) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount float64, taxType, msisdn string) (int64, error) {
-	query := `INSERT INTO "tax_record" 
-	(game_id, amount, tax_amount, after_tax, tax_type, msisdn) 
-	VALUES ($1, $2, $3, $4, $5, $6) 
-	ON CONFLICT DO NOTHING
-	RETURNING id`
-
-	log.Printf("Inserting tax record: game_id=%d, amount=%.2f, tax=%.2f, type=%s, msisdn=%s",
-		gameID, amount, taxAmount, taxType, msisdn)
+// SetMaintenanceSwitch stores the betting and deposit switches for scope
+// and gameCatID, recording the admin who set them
+func (db *Database) SetMaintenanceSwitch(ctx context.Context, scope, gameCatID string, bettingEnabled, depositsEnabled bool, message, admin string) error {
+	query := `INSERT INTO "maintenance_switches" (scope, game_cat_id, betting_enabled, deposits_enabled, message, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (scope, game_cat_id) DO UPDATE
+			SET betting_enabled = EXCLUDED.betting_enabled,
+			    deposits_enabled = EXCLUDED.deposits_enabled,
+			    message = EXCLUDED.message,
+			    updated_by = EXCLUDED.updated_by,
+			    date_updated = NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for tax record: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	var insertedID int64
-	err = conn.QueryRow(ctx, query, gameID, amount, taxAmount, taxDeductedAmount, taxType, msisdn).Scan(&insertedID)
+	if _, err := conn.Exec(ctx, query, scope, gameCatID, bettingEnabled, depositsEnabled, message, admin); err != nil {
+		return fmt.Errorf("failed to set maintenance switch: %w", err)
+	}
+	return nil
+}
+
+// ListMaintenanceSwitches returns every stored switch. It reads the primary
+// so a switch takes effect without waiting for a replica.
+func (db *Database) ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT scope, game_cat_id, betting_enabled, deposits_enabled, message, updated_by, date_updated
+		FROM "maintenance_switches"
+		ORDER BY scope DESC, game_cat_id`
+
+	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		// Check if it's a no-rows error (conflict)
-		if err == pgx.ErrNoRows {
-			log.Printf("Tax record already exists or conflict occurred")
-			return 0, nil
-		}
-		log.Printf("Error inserting tax record: %v", err)
-		return 0, fmt.Errorf("failed to insert tax record: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	log.Printf("Tax record inserted successfully, ID: %d", insertedID)
-	return insertedID, nil
-}
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
 
-// UpdatePawaBoxKeWithdrawalRequest updates withdrawal request status to processed
-func (db *Database) UpdatePawaBoxKeWithdrawalRequest(ctx context.Context, reference string) (int64, error) {
-	query := `UPDATE "withdrawals" 
-	SET status = 'processed' 
-	WHERE reference = $1`
+	return db.scanRowsToMap(rows)
+}
 
-	log.Printf("Updating withdrawal request status to processed: ref=%s", reference)
+// SetFeatureFlag stores flag name, recording the admin who set it
+func (db *Database) SetFeatureFlag(ctx context.Context, name string, enabled bool, percentage int, allowlist []string, admin string) error {
+	query := `INSERT INTO "feature_flags" (name, enabled, percentage, allowlist, updated_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE
+			SET enabled = EXCLUDED.enabled,
+			    percentage = EXCLUDED.percentage,
+			    allowlist = EXCLUDED.allowlist,
+			    updated_by = EXCLUDED.updated_by,
+			    date_updated = NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for withdrawal update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, reference)
-	if err != nil {
-		log.Printf("Error updating withdrawal request: %v", err)
-		return 0, fmt.Errorf("failed to update withdrawal request: %w", err)
+	if _, err := conn.Exec(ctx, query, name, enabled, percentage, allowlist, admin); err != nil {
+		return fmt.Errorf("failed to set feature flag: %w", err)
 	}
-
-	rowsAffected := result.RowsAffected()
-	log.Printf("Withdrawal request updated to processed: ref=%s, rows_affected=%d", reference, rowsAffected)
-
-	return rowsAffected, nil
+	return nil
 }
 
-// UpdateHouseLuckyHouseLosses updates house losses
-func (db *Database) UpdateHouseLuckyHouseLosses(ctx context.Context, mvalue float64) (int64, error) {
-	query := `UPDATE "HouseIncome" 
-	SET total_losses = total_losses + $1`
+// ListFeatureFlags returns every stored flag. It reads the primary so a
+// flip takes effect without waiting for a replica.
+func (db *Database) ListFeatureFlags(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT name, enabled, percentage, allowlist, updated_by, date_updated
+		FROM "feature_flags"
+		ORDER BY name`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, mvalue)
+	rows, err := conn.Query(ctx, query)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update house losses: %w", err)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	return db.scanRowsToMap(rows)
 }
 
-// UpdatePawaBoxKeWithdrawalB2BDisburse updates B2B withdrawal disbursement status
-func (db *Database) UpdatePawaBoxKeWithdrawalB2BDisburse(ctx context.Context, transactionID, status, description, reference string) (bool, error) {
-	query := `UPDATE "withdrawalsb2b" 
-	SET transaction_id = $1, disburse = $2, description = $3 
-	WHERE status = 'processed' AND reference = $4`
-
-	log.Printf("Updating B2B withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
-		reference, transactionID, status)
+// CreateBetReveal stores the settled outcome of a delayed bet and the SMS
+// to send when it is revealed at revealAt
+func (db *Database) CreateBetReveal(ctx context.Context, reference, msisdn string, result []byte, sms []string, revealAt time.Time) error {
+	query := `INSERT INTO "bet_reveals" (reference, msisdn, result, sms, reveal_at)
+		VALUES ($1, $2, $3::jsonb, $4, $5)`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for B2B withdrawal update: %v", err)
-		return false, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, transactionID, status, description, reference)
-	if err != nil {
-		log.Printf("Error updating B2B withdrawal disburse: %v", err)
-		return false, fmt.Errorf("failed to update B2B withdrawal disburse: %w", err)
+	if sms == nil {
+		sms = []string{}
 	}
-
-	rowsAffected := result.RowsAffected()
-	success := rowsAffected > 0
-
-	if success {
-		log.Printf("B2B withdrawal disburse updated successfully: ref=%s, rows_affected=%d", reference, rowsAffected)
-	} else {
-		log.Printf("No B2B withdrawal found to update: ref=%s", reference)
+	if _, err := conn.Exec(ctx, query, reference, msisdn, string(result), sms, revealAt); err != nil {
+		return fmt.Errorf("failed to create bet reveal: %w", err)
 	}
-
-	return success, nil
+	return nil
 }
 
-// UpdatePawaBoxKeWithdrawalDisburseMotto updates LudoMotto withdrawal disbursement status
-func (db *Database) UpdatePawaBoxKeWithdrawalDisburseMotto(ctx context.Context, transactionID, status, description, reference string) (bool, error) {
-	query := `UPDATE "LudoMotto_Ke"."withdrawals" 
-	SET transaction_id = $1, disburse = $2, description = $3 
-	WHERE status = 'processed' AND reference = $4`
-
-	log.Printf("Updating LudoMotto withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
-		reference, transactionID, status)
+// GetBetReveal returns the delayed bet reference of msisdn, or nil when
+// there is none. It reads the primary: clients poll right after the bet.
+func (db *Database) GetBetReveal(ctx context.Context, reference, msisdn string) (map[string]interface{}, error) {
+	query := `SELECT reference, result::text AS result, reveal_at
+		FROM "bet_reveals"
+		WHERE reference = $1 AND msisdn = $2`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for LudoMotto withdrawal update: %v", err)
-		return false, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, transactionID, status, description, reference)
+	rows, err := conn.Query(ctx, query, reference, msisdn)
 	if err != nil {
-		log.Printf("Error updating LudoMotto withdrawal disburse: %v", err)
-		return false, fmt.Errorf("failed to update LudoMotto withdrawal disburse: %w", err)
-	}
-
-	rowsAffected := result.RowsAffected()
-	success := rowsAffected > 0
-
-	if success {
-		log.Printf("LudoMotto withdrawal disburse updated successfully: ref=%s, rows_affected=%d", reference, rowsAffected)
-	} else {
-		log.Printf("No LudoMotto withdrawal found to update: ref=%s", reference)
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return success, nil
+	return db.scanRowsToSingleMap(rows)
 }
 
-// UpdatePawaBoxKeWithdrawalDisburse updates regular withdrawal disbursement status
-func (db *Database) UpdatePawaBoxKeWithdrawalDisburse(ctx context.Context, transactionID, status, description, reference string) (bool, error) {
-	query := `UPDATE "withdrawals" 
-	SET transaction_id = $1, disburse = $2, description = $3 
-	WHERE status = 'processed' AND reference = $4`
-
-	log.Printf("Updating withdrawal disburse: ref=%s, transaction_id=%s, status=%s",
-		reference, transactionID, status)
+// ClaimDueReveals marks up to limit reveals whose time has come as revealed
+// and returns them. Concurrent claimers skip each other's rows, so each
+// reveal is handed out once.
+func (db *Database) ClaimDueReveals(ctx context.Context, limit int) ([]map[string]interface{}, error) {
+	query := `UPDATE "bet_reveals"
+		SET revealed_at = NOW()
+		WHERE reference IN (
+			SELECT reference FROM "bet_reveals"
+			WHERE revealed_at IS NULL AND reveal_at <= NOW()
+			ORDER BY reveal_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING reference, msisdn, result::text AS result, sms, reveal_at`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for withdrawal update: %v", err)
-		return false, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, transactionID, status, description, reference)
+	rows, err := conn.Query(ctx, query, limit)
 	if err != nil {
-		log.Printf("Error updating withdrawal disburse: %v", err)
-		return false, fmt.Errorf("failed to update withdrawal disburse: %w", err)
+		return nil, fmt.Errorf("failed to claim bet reveals: %w", err)
 	}
+	defer rows.Close()
 
-	rowsAffected := result.RowsAffected()
-	success := rowsAffected > 0
+	return db.scanRowsToMap(rows)
+}
 
-	if success {
-		log.Printf("Withdrawal disburse updated successfully: ref=%s, rows_affected=%d", reference, rowsAffected)
-	} else {
-		log.Printf("No withdrawal found to update: ref=%s", reference)
+// PurgeBetReveals deletes reveals sent before before
+func (db *Database) PurgeBetReveals(ctx context.Context, before time.Time) (int64, error) {
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	return success, nil
+	tag, err := conn.Exec(ctx, `DELETE FROM "bet_reveals" WHERE revealed_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge bet reveals: %w", err)
+	}
+	return tag.RowsAffected(), nil
 }
 
-// UpdateAviatorDepositFailRequestLucky updates deposit request to failed status
-func (db *Database) UpdateAviatorDepositFailRequestLucky(ctx context.Context, reference, description string) (int64, error) {
-	query := `UPDATE "deposit_requests" 
-	SET status = 'fail', description = $1 
-	WHERE reference = $2`
-
-	log.Printf("Updating deposit request to failed: ref=%s, description=%s", reference, description)
+// InsertOutcomeDecision records how the bet reference was decided.
+// decision is the JSON record; a reference already recorded keeps its
+// first row.
+func (db *Database) InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error {
+	query := `INSERT INTO "outcome_decisions" (reference, msisdn, game_cat_id, branch, result, amount, decision)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb)
+		ON CONFLICT (reference) DO NOTHING`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for deposit fail update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, description, reference)
+	if _, err := conn.Exec(ctx, query, reference, msisdn, gameCatID, branch, result, amount, string(decision)); err != nil {
+		return fmt.Errorf("failed to insert outcome decision %s: %w", reference, err)
+	}
+	return nil
+}
+
+// GetOutcomeDecision returns the decision row of reference, or nil when
+// there is none
+func (db *Database) GetOutcomeDecision(ctx context.Context, reference string) (map[string]interface{}, error) {
+	query := `SELECT reference, msisdn, game_cat_id, branch, result, amount::float8 AS amount,
+			decision::text AS decision, date_created
+		FROM "outcome_decisions"
+		WHERE reference = $1`
+
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		log.Printf("Error updating deposit request to failed: %v", err)
-		return 0, fmt.Errorf("failed to update deposit request: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("Deposit request updated to failed: ref=%s, rows_affected=%d", reference, rowsAffected)
+	rows, err := conn.Query(ctx, query, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
 
-	return rowsAffected, nil
+	return db.scanRowsToSingleMap(rows)
 }
 
-// UpdateAviatorDepositFailRequestLuckySTK updates STK results to failed status
-func (db *Database) UpdateAviatorDepositFailRequestLuckySTK(ctx context.Context, reference, description string) (int64, error) {
-	query := `UPDATE "stk_results" 
-	SET status = 'fail', description = $1 
-	WHERE reference = $2`
+// decisionPurgeBatch caps the outcome decisions deleted per statement
+const decisionPurgeBatch = 5000
 
-	log.Printf("Updating STK result to failed: ref=%s, description=%s", reference, description)
+// PurgeOutcomeDecisions deletes decisions recorded before before, in
+// batches, and returns how many were removed
+func (db *Database) PurgeOutcomeDecisions(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM "outcome_decisions"
+		WHERE reference IN (
+			SELECT reference FROM "outcome_decisions"
+			WHERE date_created < $1
+			LIMIT $2
+		)`
 
-	conn, err := db.pool.Acquire(ctx)
-	if err != nil {
-		log.Printf("Error acquiring connection for STK fail update: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+	var total int64
+	for {
+		conn, err := db.pool.Acquire(ctx)
+		if err != nil {
+			return total, fmt.Errorf("failed to acquire connection: %w", err)
+		}
+		res, err := conn.Exec(ctx, query, before, decisionPurgeBatch)
+		conn.Release()
+		if err != nil {
+			return total, fmt.Errorf("failed to purge outcome decisions: %w", err)
+		}
+
+		total += res.RowsAffected()
+		if res.RowsAffected() < decisionPurgeBatch {
+			return total, nil
+		}
 	}
-	defer conn.Release()
+}
 
-	result, err := conn.Exec(ctx, query, description, reference)
-	if err != nil {
-		log.Printf("Error updating STK result to failed: %v", err)
-		return 0, fmt.Errorf("failed to update STK result: %w", err)
+// PoolUsage returns how many connections of the primary pool are acquired
+// and the pool's maximum
+func (db *Database) PoolUsage() (acquired, max int32) {
+	if db.pool == nil {
+		return 0, 0
 	}
+	stat := db.pool.Stat()
+	return stat.AcquiredConns(), stat.MaxConns()
+}
 
-	rowsAffected := result.RowsAffected()
-	log.Printf("STK result updated to failed: ref=%s, rows_affected=%d", reference, rowsAffected)
+func (db *Database) Close() {
+	if db.pool != nil {
+		db.pool.Close()
+	}
+}
 
-	return rowsAffected, nil
+// taxRateNow is a subquery for the "tax_rates" rate of taxType in effect
+// now, NULL when none is
+func taxRateNow(taxType string) string {
+	return `(SELECT rate FROM "tax_rates" WHERE tax_type = '` + taxType + `' AND effective_from <= NOW()
+			ORDER BY effective_from DESC LIMIT 1)`
 }
 
-// InsertIntoSMSQueueWithID inserts a message into the SMS queue and returns the ID
-func (db *Database) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string) (int64, error) {
-	query := `INSERT INTO "dbQueue" ("Originator", "Destination", "Message",  "MessageDirection","MessageTimeStamp", "SMSCID", "command")
-VALUES ($1, $2, $3, $4, NOW(), $5, $6) 
-    RETURNING "RecordID"`
+// TaxRatesAt returns the "tax_rates" rate of each tax type in effect at at.
+// A tax type with no rate in effect is missing from the map.
+func (db *Database) TaxRatesAt(ctx context.Context, at time.Time) (map[string]float64, error) {
+	query := `SELECT DISTINCT ON (tax_type) tax_type, rate::float8
+		FROM "tax_rates"
+		WHERE effective_from <= $1
+		ORDER BY tax_type, effective_from DESC`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	var insertedID int64
-	params := []interface{}{"LuckyNumber", msisdn, message, "OUT", smscID, response}
-	err = conn.QueryRow(ctx, query, params...).Scan(&insertedID)
+	rows, err := conn.Query(ctx, query, at)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert into SMS queue: %w", err)
+		return nil, fmt.Errorf("failed to query tax rates: %w", err)
 	}
+	defer rows.Close()
 
-	logrus.Infof("✅ SMS queued successfully with ID: %d for %s", insertedID, msisdn)
-	return insertedID, nil
+	rates := make(map[string]float64)
+	for rows.Next() {
+		var taxType string
+		var rate float64
+		if err := rows.Scan(&taxType, &rate); err != nil {
+			return nil, fmt.Errorf("failed to scan tax rate: %w", err)
+		}
+		rates[taxType] = rate
+	}
+	return rates, rows.Err()
 }
 
-// InsertCustomerLogsPawaBoxKeWithID inserts customer logs and returns the ID
-func (db *Database) InsertCustomerLogsPawaBoxKe(ctx context.Context, amount float64, logType string, customerID string, narrative, reference string) (int64, error) {
-	query := `INSERT INTO "CustomerLogs" 
-	(customer_id, type, narrative, amount, game_id) 
-	VALUES ($1, $2, $3, $4, $5) 
-	RETURNING id`
-
-	log.Printf("Inserting customer log: customer_id=%d, type=%s, amount=%.2f", customerID, logType, amount)
+// RoundTaxRates returns the tax rates the round of reference was opened
+// with. A tax type with no rate in effect then, or a reference with no
+// round, is missing from the map.
+func (db *Database) RoundTaxRates(ctx context.Context, reference string) (map[string]float64, error) {
+	query := `SELECT excise_rate::float8, withholding_rate::float8 FROM "game_rounds" WHERE reference = $1`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for customer log: %v", err)
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	var insertedID int64
-	err = conn.QueryRow(ctx, query, customerID, logType, narrative, amount, reference).Scan(&insertedID)
-	if err != nil {
-		log.Printf("Error inserting customer log: %v", err)
-		return 0, fmt.Errorf("failed to insert customer log: %w", err)
+	var excise, withholding *float64
+	err = conn.QueryRow(ctx, query, reference).Scan(&excise, &withholding)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to read round tax rates: %w", err)
 	}
-
-	log.Printf("Customer log inserted successfully, ID: %d", insertedID)
-	return insertedID, nil
+	rates := make(map[string]float64)
+	if excise != nil {
+		rates[TaxExcise] = *excise
+	}
+	if withholding != nil {
+		rates[TaxWithholding] = *withholding
+	}
+	return rates, nil
 }
 
-// InsertHouseLogsPawaBoxKeGameIDWithID inserts house income logs and returns the ID
-func (db *Database) InsertHouseLogsPawaBoxKeGameID(ctx context.Context, gameID string, fieldName, msisdn string, mvalue float64) (int64, error) {
-	// Validate field name
-	validFields := map[string]bool{
-		"total_bets": true, "total_wins": true, "total_losses": true,
-		"house_income": true, "total_payout": true, "total_profit": true,
-		"amount": true, "credit": true, "debit": true,
+// ListTaxRates returns every tax rate, past and future, by tax type and
+// effective_from
+func (db *Database) ListTaxRates(ctx context.Context) ([]map[string]interface{}, error) {
+	query := `SELECT id, tax_type, rate::float8 AS rate, effective_from, updated_by, date_updated
+		FROM "tax_rates"
+		ORDER BY tax_type, effective_from`
+
+	conn, err := db.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
+	defer conn.Release()
 
-	if !validFields[fieldName] {
-		return 0, fmt.Errorf("invalid field name: %s", fieldName)
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	query := fmt.Sprintf(`INSERT INTO "HouseIncomeLogs" 
-	(game_id, msisdn, %s) 
-	VALUES ($1, $2, $3) 
-	RETURNING id`, fieldName)
+	return db.scanRowsToMap(rows)
+}
 
-	log.Printf("Inserting house income log: game_id=%d, msisdn=%s, %s=%.2f", gameID, msisdn, fieldName, mvalue)
+// InsertTaxRate adds a rate of taxType effective from effectiveFrom and
+// returns its id. It returns ErrTaxRateExists when taxType already has a
+// rate from that moment.
+func (db *Database) InsertTaxRate(ctx context.Context, taxType string, rate float64, effectiveFrom time.Time, admin string) (int64, error) {
+	query := `INSERT INTO "tax_rates" (tax_type, rate, effective_from, updated_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		log.Printf("Error acquiring connection for house income log: %v", err)
 		return 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	var insertedID int64
-	err = conn.QueryRow(ctx, query, gameID, msisdn, mvalue).Scan(&insertedID)
+	var id int64
+	err = conn.QueryRow(ctx, query, taxType, rate, effectiveFrom, admin).Scan(&id)
+	if isUniqueViolation(err) {
+		return 0, ErrTaxRateExists
+	}
 	if err != nil {
-		log.Printf("Error inserting house income log: %v", err)
-		return 0, fmt.Errorf("failed to insert house income log: %w", err)
+		return 0, fmt.Errorf("failed to insert tax rate: %w", err)
 	}
-
-	log.Printf("House income log inserted successfully, ID: %d", insertedID)
-	return insertedID, nil
+	return id, nil
 }
 
-// InsertB2BWithdrawalB2B inserts into B2B withdrawal processing
-func (db *Database) InsertB2BWithdrawalB2B(ctx context.Context, reference, msisdn string, amount float64, betStatus string) (int64, error) {
-	query := `INSERT INTO "withdrawal_b2b_to_process" 
-			 (reference, msisdn, amount, bet_status) 
-			 VALUES ($1, $2, $3, $4)`
+// UpdateTaxRate changes the rate and effective_from of tax rate id, as long
+// as it is not yet in effect. It returns the rows changed: none for a rate
+// missing or already in effect.
+func (db *Database) UpdateTaxRate(ctx context.Context, id int64, rate float64, effectiveFrom time.Time, admin string) (int64, error) {
+	query := `UPDATE "tax_rates"
+		SET rate = $2, effective_from = $3, updated_by = $4, date_updated = NOW()
+		WHERE id = $1 AND effective_from > NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -3078,20 +8267,20 @@ func (db *Database) InsertB2BWithdrawalB2B(ctx context.Context, reference, msisd
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, reference, msisdn, amount, betStatus)
+	result, err := conn.Exec(ctx, query, id, rate, effectiveFrom, admin)
+	if isUniqueViolation(err) {
+		return 0, ErrTaxRateExists
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert B2B withdrawal: %w", err)
+		return 0, fmt.Errorf("failed to update tax rate: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// InsertUSSDLogs inserts USSD session logs
-func (db *Database) InsertUSSDLogs(ctx context.Context, msisdn, sessionID, serviceCode, ussdString string) (int64, error) {
-	query := `INSERT INTO "ussd_session" 
-	(msisdn, sessionId, serviceCode, ussdString) 
-	VALUES ($1, $2, $3, $4) 
-	ON CONFLICT DO NOTHING` // PostgreSQL equivalent of INSERT IGNORE
+// DeleteTaxRate removes tax rate id, as long as it is not yet in effect.
+// It returns the rows removed.
+func (db *Database) DeleteTaxRate(ctx context.Context, id int64) (int64, error) {
+	query := `DELETE FROM "tax_rates" WHERE id = $1 AND effective_from > NOW()`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -3099,77 +8288,112 @@ func (db *Database) InsertUSSDLogs(ctx context.Context, msisdn, sessionID, servi
 	}
 	defer conn.Release()
 
-	println(msisdn)
-	// println(msisdn, sessionID, serviceCode, ussdString)
-	result, err := conn.Exec(ctx, query, msisdn, sessionID, serviceCode, ussdString)
+	result, err := conn.Exec(ctx, query, id)
 	if err != nil {
-
-		println(fmt.Errorf("failed to execute query: %w", err))
-		return 0, fmt.Errorf("failed to insert USSD logs: %w", err)
+		return 0, fmt.Errorf("failed to delete tax rate: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
 
-// InsertAviatorUssdLogs inserts aviator USSD logs
-func (db *Database) InsertAviatorUssdLogs(ctx context.Context, gameID int64, sessionID, msisdn, payload string) (int64, error) {
-	query := `INSERT INTO "Aviator"."ussd_logs" (game_id, sessionid, msisdn, payload) VALUES ($1, $2, $3, $4)`
+// InsertDepositReview records the deposit callback of transactionID for
+// review. It reports false when the transaction is already recorded.
+func (db *Database) InsertDepositReview(ctx context.Context, source, transactionID, reference, msisdn string, amount float64, reason string) (bool, error) {
+	query := `INSERT INTO "deposit_reviews" (source, transaction_id, reference, msisdn, amount, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (transaction_id) DO NOTHING`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return false, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, gameID, sessionID, msisdn, payload)
+	result, err := conn.Exec(ctx, query, source, transactionID, reference, msisdn, amount, reason)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator USSD logs: %w", err)
+		return false, fmt.Errorf("failed to insert deposit review: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return result.RowsAffected() > 0, nil
 }
 
-// InsertAviatorUssdInputLogs inserts aviator USSD input logs
-func (db *Database) InsertAviatorUssdInputLogs(ctx context.Context, sessionCode, sessionID, msisdn, ussdMenu string) (int64, error) {
-	query := `INSERT INTO "Aviator"."ussd_log_inputs" (ussd_code, sessionid, msisdn, ussd_menu) VALUES ($1, $2, $3, $4)`
-
-	conn, err := db.pool.Acquire(ctx)
+// ListDepositReviews returns a page of the deposits recorded for review,
+// newest first, and how many there are
+func (db *Database) ListDepositReviews(ctx context.Context, limit, offset int) ([]map[string]interface{}, int64, error) {
+	conn, err := db.readConn(ctx, "")
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, 0, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, sessionCode, sessionID, msisdn, ussdMenu)
+	var total int64
+	if err := conn.QueryRow(ctx, `SELECT COUNT(*) FROM "deposit_reviews"`).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count deposit reviews: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, `SELECT id, source, transaction_id, reference, msisdn,
+			amount::float8 AS amount, reason, date_created
+		FROM "deposit_reviews"
+		ORDER BY date_created DESC, id DESC
+		LIMIT $1 OFFSET $2`, limit, offset)
 	if err != nil {
-		return 0, fmt.Errorf("failed to insert aviator USSD input logs: %w", err)
+		return nil, 0, fmt.Errorf("failed to execute query: %w", err)
 	}
+	defer rows.Close()
 
-	return result.RowsAffected(), nil
+	reviews, err := db.scanRowsToMap(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return reviews, total, nil
 }
 
-// UpdateAviatorUssdLogs updates aviator USSD logs
-func (db *Database) UpdateAviatorUssdLogs(ctx context.Context, sessionID, msisdn string, gameID int64, payload string) (int64, error) {
-	query := `UPDATE "Aviator"."ussd_logs" 
-			 SET sessionid = $1, payload = $2 
-			 WHERE game_id = $3 AND msisdn = $4`
+// settingsColumns are the "PawaBox_KeSettings" columns of Settings, in its
+// field order
+const settingsColumns = `COALESCE(default_rtp, 0)::float8, COALESCE(adjustmentable_rtp, 0)::float8,
+		COALESCE(vig_percentage, 0)::float8, COALESCE(jackpot_percentage, 0)::float8,
+		COALESCE(rtp_overload, 0)::float8, COALESCE(min_win_multipier, 0)::float8,
+		COALESCE(max_win_multipier, 0)::float8, COALESCE(min_loss_count, 0)::int,
+		COALESCE(withholding, 0)::float8, COALESCE(excise_duty, 0)::float8,
+		bet_cooldown_ms::bigint, max_bets_per_minute::int,
+		forced_win_min_streak_secs::bigint, forced_win_min_deposits::bigint,
+		min_deposit::float8, max_deposit::float8, round_deposits,
+		withdrawal_otp_threshold::float8, withdrawal_max_count::int, withdrawal_max_amount::float8`
 
+// GetSettings returns the settings row, or nil when there is none
+func (db *Database) GetSettings(ctx context.Context) (*Settings, error) {
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to acquire connection: %w", err)
+		return nil, fmt.Errorf("failed to acquire connection: %w", err)
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, sessionID, payload, gameID, msisdn)
+	var s Settings
+	err = conn.QueryRow(ctx, `SELECT `+settingsColumns+` FROM "PawaBox_KeSettings" LIMIT 1`).Scan(
+		&s.DefaultRTP, &s.AdjustableRTP, &s.VigPercentage, &s.JackpotPercentage,
+		&s.RTPOverload, &s.MinWinMultiplier, &s.MaxWinMultiplier, &s.MinLossCount,
+		&s.Withholding, &s.ExciseDuty,
+		&s.BetCooldownMS, &s.MaxBetsPerMinute, &s.ForcedWinMinStreakSecs, &s.ForcedWinMinDeposits,
+		&s.MinDeposit, &s.MaxDeposit, &s.RoundDeposits,
+		&s.WithdrawalOTPThreshold, &s.WithdrawalMaxCount, &s.WithdrawalMaxAmount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator USSD logs: %w", err)
+		return nil, fmt.Errorf("failed to get settings: %w", err)
 	}
-
-	return result.RowsAffected(), nil
+	return &s, nil
 }
 
-// UpdateAviatorUssdLogsStatus updates aviator USSD logs status
-func (db *Database) UpdateAviatorUssdLogsStatus(ctx context.Context, gameID int64, msisdn string) (int64, error) {
-	query := `UPDATE "Aviator"."ussd_logs" SET status = 'closed' WHERE game_id = $1 AND msisdn = $2`
+// UpdateSettings writes every field of s to the settings row. It returns
+// the rows changed: none when there is no settings row.
+func (db *Database) UpdateSettings(ctx context.Context, s Settings) (int64, error) {
+	query := `UPDATE "PawaBox_KeSettings"
+		SET default_rtp = $1, adjustmentable_rtp = $2, vig_percentage = $3, jackpot_percentage = $4,
+			rtp_overload = $5, min_win_multipier = $6, max_win_multipier = $7, min_loss_count = $8,
+			withholding = $9, excise_duty = $10,
+			bet_cooldown_ms = $11, max_bets_per_minute = $12,
+			forced_win_min_streak_secs = $13, forced_win_min_deposits = $14,
+			min_deposit = $15, max_deposit = $16, round_deposits = $17,
+			withdrawal_otp_threshold = $18, withdrawal_max_count = $19, withdrawal_max_amount = $20`
 
 	conn, err := db.pool.Acquire(ctx)
 	if err != nil {
@@ -3177,19 +8401,15 @@ func (db *Database) UpdateAviatorUssdLogsStatus(ctx context.Context, gameID int6
 	}
 	defer conn.Release()
 
-	result, err := conn.Exec(ctx, query, gameID, msisdn)
+	result, err := conn.Exec(ctx, query,
+		s.DefaultRTP, s.AdjustableRTP, s.VigPercentage, s.JackpotPercentage,
+		s.RTPOverload, s.MinWinMultiplier, s.MaxWinMultiplier, s.MinLossCount,
+		s.Withholding, s.ExciseDuty,
+		s.BetCooldownMS, s.MaxBetsPerMinute, s.ForcedWinMinStreakSecs, s.ForcedWinMinDeposits,
+		s.MinDeposit, s.MaxDeposit, s.RoundDeposits,
+		s.WithdrawalOTPThreshold, s.WithdrawalMaxCount, s.WithdrawalMaxAmount)
 	if err != nil {
-		return 0, fmt.Errorf("failed to update aviator USSD logs status: %w", err)
+		return 0, fmt.Errorf("failed to update settings: %w", err)
 	}
-
 	return result.RowsAffected(), nil
 }
-
-// Additional methods can be added following the same pattern...
-
-// Close closes the database connection pool
-func (db *Database) Close() {
-	if db.pool != nil {
-		db.pool.Close()
-	}
-}
@@ -0,0 +1,16 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// DecisionRepo holds the append-only record of how each settled bet's
+// outcome was decided
+type DecisionRepo interface {
+	InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error
+	GetOutcomeDecision(ctx context.Context, reference string) (map[string]interface{}, error)
+	PurgeOutcomeDecisions(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ DecisionRepo = (*Database)(nil)
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// DeletionCandidate is a player whose deletion request has passed the
+// retention window
+type DeletionCandidate struct {
+	Msisdn      string
+	ProfileURL  string
+	RequestedAt time.Time
+}
+
+// DeletionRepo holds the account deletion lifecycle: the request, the
+// checks that hold it back and the anonymization itself
+type DeletionRepo interface {
+	RequestPlayerDeletion(ctx context.Context, msisdn string) (int64, error)
+	ListDueDeletions(ctx context.Context, requestedBefore time.Time, limit int) ([]DeletionCandidate, error)
+	GetDeletionBlocker(ctx context.Context, msisdn string) (string, error)
+	MarkDeletionBlocked(ctx context.Context, msisdn, reason string) error
+	AnonymizePlayer(ctx context.Context, msisdn, token string) (bool, error)
+	ListDeletionRequests(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+var _ DeletionRepo = (*Database)(nil)
@@ -0,0 +1,12 @@
+package database
+
+import "context"
+
+// DepositReviewRepo holds the deposit callbacks recorded for review instead
+// of credited
+type DepositReviewRepo interface {
+	InsertDepositReview(ctx context.Context, source, transactionID, reference, msisdn string, amount float64, reason string) (bool, error)
+	ListDepositReviews(ctx context.Context, limit, offset int) ([]map[string]interface{}, int64, error)
+}
+
+var _ DepositReviewRepo = (*Database)(nil)
@@ -0,0 +1,11 @@
+package database
+
+import "context"
+
+// FlagRepo holds the feature flags admins roll features out with
+type FlagRepo interface {
+	SetFeatureFlag(ctx context.Context, name string, enabled bool, percentage int, allowlist []string, admin string) error
+	ListFeatureFlags(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+var _ FlagRepo = (*Database)(nil)
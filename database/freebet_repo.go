@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// ExpiredFreeBet is a player whose free bets ExpireFreeBets took back
+type ExpiredFreeBet struct {
+	PlayerID         int64
+	Msisdn           string
+	FreeBets         float64 // how many expired
+	SMSNotifications bool
+}
+
+// WelcomeGrantSettings is the "welcome_grant_settings" row
+type WelcomeGrantSettings struct {
+	Enabled     bool
+	FreeBets    int
+	ValidHours  int
+	UpdatedBy   string
+	DateUpdated time.Time // zero when no row is stored
+}
+
+// FreeBetRepo holds the free bet expiry job, the liability report and the
+// welcome grant
+type FreeBetRepo interface {
+	ExpireFreeBets(ctx context.Context, batchSize int) ([]ExpiredFreeBet, error)
+	GetFreeBetLiability(ctx context.Context) ([]map[string]interface{}, error)
+	GetWelcomeGrantSettings(ctx context.Context) (*WelcomeGrantSettings, error)
+	SetWelcomeGrantSettings(ctx context.Context, enabled bool, freeBets, validHours int, admin string) error
+	GrantWelcomeFreeBets(ctx context.Context, msisdn string, freeBets int, expiry time.Time) (bool, error)
+}
+
+var _ FreeBetRepo = (*Database)(nil)
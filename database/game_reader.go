@@ -0,0 +1,17 @@
+package database
+
+import "context"
+
+// GameReader is the read-only slice of the database that box generation
+// needs. The demo engine is handed only this, so it cannot reach a method
+// that writes bets, wallets, KPI or house rows.
+type GameReader interface {
+	CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	GetSettings(ctx context.Context) (*Settings, error)
+	GetGame(ctx context.Context, catID string) (*Game, error)
+	CheckBasketLucky(ctx context.Context) (map[string]interface{}, error)
+	CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error)
+	CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error)
+}
+
+var _ GameReader = (*Database)(nil)
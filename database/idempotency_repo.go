@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotentRequest is a claimed idempotency key. StatusCode and Response
+// are empty while the first request is still being processed.
+type IdempotentRequest struct {
+	RequestHash string
+	StatusCode  int
+	Response    []byte
+}
+
+// IdempotencyRepo holds the keys that stop a bet or deposit from being
+// processed twice
+type IdempotencyRepo interface {
+	ClaimIdempotencyKey(ctx context.Context, msisdn, route, key, requestHash string, expiresAt time.Time) (bool, error)
+	GetIdempotencyKey(ctx context.Context, msisdn, route, key string) (*IdempotentRequest, error)
+	SaveIdempotentResponse(ctx context.Context, msisdn, route, key string, statusCode int, response []byte) error
+	ReleaseIdempotencyKey(ctx context.Context, msisdn, route, key string) error
+	PurgeExpiredIdempotencyKeys(ctx context.Context) (int64, error)
+}
+
+var _ IdempotencyRepo = (*Database)(nil)
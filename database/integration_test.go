@@ -0,0 +1,2225 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/config"
+	"fiberapp/dbtest"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// The tests in this file run their SQL against a real
+// Postgres at TEST_DATABASE_URL and skip without one, see package dbtest
+
+// openIntegration opens the test database with tables emptied
+func openIntegration(t testing.TB, tables ...string) (*Database, *pgxpool.Pool) {
+	pool := dbtest.Open(t)
+	dbtest.Reset(t, pool, tables...)
+	return NewDatabaseWithPool(pool, nil), pool
+}
+
+func TestBetWinIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "Games", "Bets")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 100)
+	dbtest.SeedGame(t, pool, 1, "PawaBox", "pw")
+
+	if created, err := db.CreateBet(ctx, "254700000001", "3", 20, "", "BET_1", status.ResultPending, "normal", "1", "PawaBox", "web"); err != nil || !created {
+		t.Fatalf("create = %t, %v", created, err)
+	}
+	n, err := db.UpdateLuckyBetWin(ctx, "3,5,1", "PawaBox", "BET_1", 60, status.ResultWin)
+	if err != nil || n != 1 {
+		t.Fatalf("update = %d, %v, want the bet updated", n, err)
+	}
+	var result, betStatus, results, game string
+	var win float64
+	if err := pool.QueryRow(ctx, `SELECT result_status, status, results, game, win_amount::float8 FROM "Bets" WHERE reference = 'BET_1'`).
+		Scan(&result, &betStatus, &results, &game, &win); err != nil {
+		t.Fatal(err)
+	}
+	if result != string(status.ResultWin) || betStatus != string(status.BetProcessed) || results != "3,5,1" || game != "PawaBox" || win != 60 {
+		t.Errorf("bet = %s, %s, %q, %s, %v; want a processed win of 60", result, betStatus, results, game, win)
+	}
+	if n, err := db.UpdateLuckyBetWin(ctx, "1", "PawaBox", "BET_NONE", 60, status.ResultWin); err != nil || n != 0 {
+		t.Errorf("unknown reference = %d, %v, want nothing updated", n, err)
+	}
+}
+
+func TestCheckHistoryIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Bets")
+	ctx := context.Background()
+	// 105 bets a minute apart, BET_0 the newest, and one of another player
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (reference, msisdn, amount, result_status, date_created)
+		SELECT 'BET_' || n, '254700000001', 20, 'Loss', NOW() - n * INTERVAL '1 minute' FROM generate_series(0, 104) n`)
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (reference, msisdn, amount, result_status) VALUES ('OTHER', '254700000002', 20, 'Win')`)
+
+	references := func(rows []map[string]interface{}) []string {
+		var refs []string
+		for _, row := range rows {
+			refs = append(refs, utils.ToString(row["reference"]))
+		}
+		return refs
+	}
+	rows, err := db.CheckHistory(ctx, "254700000001", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := references(rows); len(refs) != 10 || refs[0] != "BET_0" || refs[9] != "BET_9" {
+		t.Errorf("latest page = %v, want BET_0 to BET_9", refs)
+	}
+
+	now := time.Now()
+	rows, err = db.CheckHistory(ctx, "254700000001", now.Add(-29*time.Minute-30*time.Second), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := references(rows); len(refs) != 30 || refs[0] != "BET_0" || refs[29] != "BET_29" {
+		t.Errorf("last half hour = %d bets from %v, want BET_0 to BET_29", len(refs), refs)
+	}
+	rows, err = db.CheckHistory(ctx, "254700000001", now.Add(-24*time.Hour), now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := references(rows); len(refs) != 100 || refs[99] != "BET_99" || slices.Contains(refs, "OTHER") {
+		t.Errorf("a day = %d bets, want the newest 100 of the player's", len(refs))
+	}
+}
+
+func TestSettleDepositCreditIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "deposit", "deposit_requests", "kpi")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 100)
+	dbtest.SeedKPI(t, pool, clock.Now(), 1000, 400)
+
+	if row, err := db.CheckTransaction(ctx, "QK1"); err != nil || row != nil {
+		t.Fatalf("unseen transaction = %v, %v, want none", row, err)
+	}
+	if n, err := db.CreateDepositRecordLucky(ctx, "254700000001", 50, "QK1", "4043", "JANE", "BET_1", "normal"); err != nil || n != 1 {
+		t.Fatalf("deposit record = %d, %v", n, err)
+	}
+	if n, err := db.UpdateUserAviatorBalInfoLucky(ctx, 50, "254700000001", "JANE"); err != nil || n != 1 {
+		t.Fatalf("credit = %d, %v", n, err)
+	}
+	if _, err := db.UpdateKPIDeposit(ctx, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dbtest.PlayerBalance(t, pool, "254700000001"); got != 150 {
+		t.Errorf("balance = %v, want 150", got)
+	}
+	var name string
+	var monetary float64
+	if err := pool.QueryRow(ctx, `SELECT name, monetary::float8 FROM "Player" WHERE msisdn = '254700000001'`).Scan(&name, &monetary); err != nil {
+		t.Fatal(err)
+	}
+	if name != "JANE" || monetary != 50 {
+		t.Errorf("player = %s with monetary %v, want JANE with 50", name, monetary)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "deposit"
+		WHERE transaction_id = 'QK1' AND mreference = 'BET_1' AND amount = 50 AND shortcode = '4043' AND deposit_type = 'normal'`); n != 1 {
+		t.Errorf("%d deposit rows for QK1, want 1", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "kpi" WHERE handle = 1050`); n != 1 {
+		t.Error("today's handle should take the deposit")
+	}
+	if n, err := db.UpdateUserAviatorBalInfoLucky(ctx, 50, "254700000009", "NOBODY"); err != nil || n != 0 {
+		t.Errorf("credit of an unknown player = %d, %v, want nothing updated", n, err)
+	}
+}
+
+func TestTransferBalanceIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "transfers", "CustomerLogs", "PawaBox_KeSettings")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 500)
+	dbtest.SeedPlayer(t, pool, "254700000002", 10)
+	dbtest.Exec(t, pool, `INSERT INTO "PawaBox_KeSettings" (transfer_daily_limit, transfer_daily_count) VALUES (1000, 2)`)
+
+	from, to, err := db.TransferBalance(ctx, "254700000001", "254700000002", 200, "TRF_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 300 || to != 210 {
+		t.Errorf("balances = %v, %v, want 300, 210", from, to)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "CustomerLogs" WHERE game_id = 'TRF_1'`); n != 2 {
+		t.Errorf("%d CustomerLogs rows, want transfer_out and transfer_in", n)
+	}
+
+	if _, _, err := db.TransferBalance(ctx, "254700000001", "254700000002", 301, "TRF_2"); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("overdraw = %v, want ErrInsufficientBalance", err)
+	}
+	if dbtest.PlayerBalance(t, pool, "254700000001") != 300 || dbtest.PlayerBalance(t, pool, "254700000002") != 210 {
+		t.Error("a refused transfer must roll back")
+	}
+
+	if _, _, err := db.TransferBalance(ctx, "254700000001", "254700000002", 100, "TRF_3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := db.TransferBalance(ctx, "254700000001", "254700000002", 100, "TRF_4"); !errors.Is(err, ErrTransferLimit) {
+		t.Errorf("third transfer of the day = %v, want ErrTransferLimit", err)
+	}
+	if _, _, err := db.TransferBalance(ctx, "254700000001", "254700000009", 10, "TRF_5"); !errors.Is(err, ErrTransferRecipient) {
+		t.Errorf("unknown recipient = %v, want ErrTransferRecipient", err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "transfers"`); n != 2 {
+		t.Errorf("%d transfers recorded, want 2", n)
+	}
+}
+
+func TestReverseDepositIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "deposit_requests", "Bets", "CustomerLogs", "deposit_reversals", "player_debts")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 30)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (reference, msisdn, amount, status, transaction_id)
+		VALUES ('BET_1', '254700000001', 100, $1, 'MPESA1')`, status.DepositSuccess)
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (reference, msisdn, amount, result_status, status, win_amount)
+		VALUES ('BET_1', '254700000001', 100, $1, $2, 250)`, status.ResultWin, status.BetProcessed)
+
+	reversal, created, err := db.ReverseDeposit(ctx, "MPESA1", "REV_1", "customer dispute", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || reversal["clawed_back"] != 30.0 || reversal["debt"] != 70.0 || reversal["balance"] != 0.0 {
+		t.Errorf("reversal = %v, want 30 clawed back, 70 owed, balance 0", reversal)
+	}
+	if reversal["bet_result"] != status.ResultWin.String() || reversal["bet_win_amount"] != 250.0 {
+		t.Errorf("reversal = %v, want the won bet recorded for review", reversal)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "player_debts" WHERE msisdn = '254700000001' AND amount = 70`); n != 1 {
+		t.Errorf("%d player_debts rows, want one of 70", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Bets" WHERE reference = 'BET_1' AND status = $1`, status.BetReversed); n != 1 {
+		t.Error("the bet should be marked reversed")
+	}
+
+	again, created, err := db.ReverseDeposit(ctx, "MPESA1", "REV_2", "duplicate", false)
+	if err != nil || created || again["reversal_reference"] != "REV_1" {
+		t.Errorf("duplicate = %v, %v, %v, want the first reversal back", again, created, err)
+	}
+	if dbtest.PlayerBalance(t, pool, "254700000001") != 0 {
+		t.Error("a duplicate notification must not claw back twice")
+	}
+	if _, _, err := db.ReverseDeposit(ctx, "MPESA9", "REV_3", "", false); !errors.Is(err, ErrReversalNotFound) {
+		t.Errorf("unknown transaction = %v, want ErrReversalNotFound", err)
+	}
+}
+
+func TestReverseDepositAllowNegativeIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "deposit_requests", "Bets", "CustomerLogs", "deposit_reversals", "player_debts")
+	dbtest.SeedPlayer(t, pool, "254700000001", 30)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (reference, msisdn, amount, status, transaction_id)
+		VALUES ('BET_1', '254700000001', 100, $1, 'MPESA1')`, status.DepositSuccess)
+
+	reversal, _, err := db.ReverseDeposit(context.Background(), "MPESA1", "REV_1", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal["balance"] != -70.0 || reversal["debt"] != 0.0 {
+		t.Errorf("reversal = %v, want balance -70 and no debt", reversal)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "player_debts"`); n != 0 {
+		t.Errorf("%d player_debts rows, want none", n)
+	}
+}
+
+func TestReverseKPIDepositIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "deposit", "kpi")
+	ctx := context.Background()
+	yesterday := clock.Now().AddDate(0, 0, -1)
+	dbtest.SeedKPI(t, pool, yesterday, 1000, 400)
+	dbtest.SeedKPI(t, pool, clock.Now(), 500, 100)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit" (msisdn, amount, transaction_id, date_created)
+		VALUES ('254700000001', 100, 'MPESA1', $1)`, yesterday)
+
+	if _, err := db.ReverseKPIDeposit(ctx, "MPESA1", 100); err != nil {
+		t.Fatal(err)
+	}
+	kpi := func(day time.Time) (handle, ggr float64) {
+		t.Helper()
+		if err := pool.QueryRow(ctx, `SELECT handle::float8, ggr::float8 FROM "kpi" WHERE date = $1::date`,
+			day.In(clock.Location()).Format("2006-01-02")).Scan(&handle, &ggr); err != nil {
+			t.Fatal(err)
+		}
+		return handle, ggr
+	}
+	if handle, ggr := kpi(yesterday); handle != 900 || ggr != 500 {
+		t.Errorf("deposit day = handle %v, ggr %v, want 900 and 500", handle, ggr)
+	}
+	if handle, ggr := kpi(clock.Now()); handle != 500 || ggr != 400 {
+		t.Errorf("today = handle %v, ggr %v, want it untouched", handle, ggr)
+	}
+}
+
+func TestWithdrawBalanceIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "balance_withdrawals", "withdrawals", "withdrawal_queue_ke", "CustomerLogs")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 5000)
+	dbtest.Exec(t, pool, `INSERT INTO "balance_withdrawals" (reference, msisdn, amount, date_created)
+		VALUES ('WDR_OLD', '254700000001', 900, NOW() - INTERVAL '25 hours')`)
+	limits := WithdrawalLimits{MaxCount: 2, MaxAmount: 3000, Since: time.Now().Add(-24 * time.Hour)}
+
+	balance, err := db.WithdrawBalance(ctx, "254700000001", 1000, "WDR_1", limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 4000 {
+		t.Errorf("balance = %v, want 4000", balance)
+	}
+	for _, table := range []string{"withdrawals", "withdrawal_queue_ke"} {
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "`+table+`" WHERE reference = 'WDR_1'`); n != 1 {
+			t.Errorf("%d %s rows for the withdrawal, want 1", n, table)
+		}
+	}
+
+	_, err = db.WithdrawBalance(ctx, "254700000001", 2500, "WDR_2", limits)
+	var velocity *WithdrawalVelocityError
+	if !errors.As(err, &velocity) || velocity.Count != 1 || velocity.Total != 1000 {
+		t.Errorf("past the amount cap = %v, want a velocity refusal counting only the last 24 hours", err)
+	}
+	if _, err := db.WithdrawBalance(ctx, "254700000001", 2000, "WDR_3", limits); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.WithdrawBalance(ctx, "254700000001", 10, "WDR_4", limits); !errors.Is(err, ErrWithdrawalVelocity) {
+		t.Errorf("third withdrawal = %v, want a velocity refusal", err)
+	}
+	if _, err := db.WithdrawBalance(ctx, "254700000001", 5000, "WDR_5", WithdrawalLimits{}); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("overdraw = %v, want ErrInsufficientBalance", err)
+	}
+	if dbtest.PlayerBalance(t, pool, "254700000001") != 2000 {
+		t.Error("refused withdrawals must roll back")
+	}
+}
+
+func TestCheckBalanceWithdrawalIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "balance_withdrawals", "withdrawals", "withdrawal_queue_ke", "CustomerLogs")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 3000)
+	dbtest.Exec(t, pool, `INSERT INTO "balance_withdrawals" (reference, msisdn, amount) VALUES ('WDR_OLD', '254700000001', 4500)`)
+	limits := WithdrawalLimits{MaxAmount: 5000, Since: time.Now().Add(-24 * time.Hour)}
+
+	if err := db.CheckBalanceWithdrawal(ctx, "254700000001", 1000, limits); !errors.Is(err, ErrWithdrawalVelocity) {
+		t.Errorf("past the amount cap = %v, want a velocity refusal", err)
+	}
+	if err := db.CheckBalanceWithdrawal(ctx, "254700000001", 3001, WithdrawalLimits{}); !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("overdraw = %v, want ErrInsufficientBalance", err)
+	}
+	if err := db.CheckBalanceWithdrawal(ctx, "254700000009", 10, WithdrawalLimits{}); !errors.Is(err, ErrWithdrawalPlayer) {
+		t.Errorf("unknown player = %v, want ErrWithdrawalPlayer", err)
+	}
+	if err := db.CheckBalanceWithdrawal(ctx, "254700000001", 500, limits); err != nil {
+		t.Errorf("withdrawal within the limits = %v", err)
+	}
+	if dbtest.PlayerBalance(t, pool, "254700000001") != 3000 || dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawals"`) != 0 {
+		t.Error("a check must not move money")
+	}
+}
+
+func TestCashOutsNotInWinnersIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "balance_withdrawals", "withdrawals", "withdrawal_queue_ke", "CustomerLogs", "Bets")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 50000)
+	dbtest.Exec(t, pool, `UPDATE "Player" SET show_win = 'true'`)
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (reference, msisdn, amount, items) VALUES ('W1', '254700000001', 500, 'KES 500')`)
+
+	if _, err := db.WithdrawBalance(ctx, "254700000001", 20000, "WDR_1", WithdrawalLimits{}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.GetRecentWinners(ctx, 10, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["items"] != "KES 500" {
+		t.Errorf("feed = %v, want only the win, not the cash-out", rows)
+	}
+	if rows, _ := db.GetRecentWinners(ctx, 10, 1000, ""); len(rows) != 0 {
+		t.Errorf("feed over the floor = %v, want the cash-out left out", rows)
+	}
+}
+
+func TestInsertIntoSMSQueueIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "dbQueue")
+	ctx := context.Background()
+
+	id, err := db.InsertIntoSMSQueue(ctx, "254700000001", "You won KES 60", "LuckyNumber", "game_response", 7)
+	if err != nil || id <= 0 {
+		t.Fatalf("insert = %d, %v", id, err)
+	}
+	var originator, destination, message, direction, smscID, command string
+	var sequence int64
+	var stamped time.Time
+	var delivery *string
+	if err := pool.QueryRow(ctx, `SELECT "Originator", "Destination", "Message", "MessageDirection", "SMSCID",
+			command, "Sequence", "MessageTimeStamp", delivery_status
+		FROM "dbQueue" WHERE "RecordID" = $1`, id).
+		Scan(&originator, &destination, &message, &direction, &smscID, &command, &sequence, &stamped, &delivery); err != nil {
+		t.Fatal(err)
+	}
+	if originator != "LuckyNumber" || destination != "254700000001" || message != "You won KES 60" ||
+		direction != "OUT" || smscID != "LuckyNumber" || command != "game_response" || sequence != 7 {
+		t.Errorf("row = %s, %s, %q, %s, %s, %s, %d", originator, destination, message, direction, smscID, command, sequence)
+	}
+	if time.Since(stamped) > time.Minute {
+		t.Errorf("MessageTimeStamp = %v, want now", stamped)
+	}
+	// Unsent: the drainer picks it up and the gateway reports on it later
+	if delivery != nil {
+		t.Errorf("delivery_status = %q, want NULL until a report arrives", *delivery)
+	}
+
+	next, err := db.InsertIntoSMSQueue(ctx, "254700000001", "Deposit received", "LuckyNumber", "deposit", 8)
+	if err != nil || next <= id {
+		t.Errorf("second insert = %d, %v, want an id after %d", next, err, id)
+	}
+}
+
+func TestUpdateSMSDeliveryStatusIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "dbQueue")
+	ctx := context.Background()
+	var otp, result int64
+	if err := pool.QueryRow(ctx, `INSERT INTO "dbQueue" ("Destination", "Message", command) VALUES ('254700000001', 'Your code is 1234', 'otp') RETURNING "RecordID"`).Scan(&otp); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, `INSERT INTO "dbQueue" ("Destination", "Message", command) VALUES ('254700000001', 'You won', 'result') RETURNING "RecordID"`).Scan(&result); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		id     int64
+		status string
+		ok     bool
+	}{
+		{otp, "SENT", true},
+		{otp, "SENT", true},
+		{otp, "DELIVERED", true},
+		{otp, "SENT", false}, // a late SENT cannot undo DELIVERED
+		{otp, "FAILED", false},
+		{result, "FAILED", true},
+		{result, "DELIVERED", false},
+		{result + 100, "DELIVERED", false},
+	}
+	for i, step := range steps {
+		ok, err := db.UpdateSMSDeliveryStatus(ctx, step.id, step.status, "")
+		if err != nil || ok != step.ok {
+			t.Errorf("step %d: %s on %d = %v, %v, want %v", i, step.status, step.id, ok, err, step.ok)
+		}
+	}
+
+	var status, message string
+	pool.QueryRow(ctx, `SELECT delivery_status, "Message" FROM "dbQueue" WHERE "RecordID" = $1`, otp).Scan(&status, &message)
+	if status != "DELIVERED" || message != "" {
+		t.Errorf("OTP row = %q %q, want DELIVERED with its code cleared", status, message)
+	}
+	pool.QueryRow(ctx, `SELECT delivery_status, "Message" FROM "dbQueue" WHERE "RecordID" = $1`, result).Scan(&status, &message)
+	if status != "FAILED" || message != "You won" {
+		t.Errorf("result row = %q %q, want FAILED with its text kept", status, message)
+	}
+}
+
+func TestReissueVerificationIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "verification")
+	ctx := context.Background()
+	now := time.Now().Unix()
+	if _, err := db.InsertVerification(ctx, "254700000001", "login", "hash-1", now+300, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		v, err := db.GetLatestVerification(ctx, "254700000001", "login")
+		if err != nil || v == nil {
+			t.Fatalf("latest = %v, %v", v, err)
+		}
+		ok, err := db.ReissueVerification(ctx, v.ID, "hash-new", now+600, now+int64(i), 3)
+		if err != nil || !ok {
+			t.Fatalf("resend %d = %v, %v", i, ok, err)
+		}
+		old := v.ID
+		if v, _ = db.GetLatestVerification(ctx, "254700000001", "login"); v.ID == old || v.ResendCount != i || v.LastSent != now+int64(i) {
+			t.Errorf("after resend %d latest = %+v, want a new row counting %d", i, v, i)
+		}
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM verification WHERE id = $1 AND status = 2`, old); n != 1 {
+			t.Errorf("resend %d left the old code unretired", i)
+		}
+	}
+	v, _ := db.GetLatestVerification(ctx, "254700000001", "login")
+	if ok, err := db.ReissueVerification(ctx, v.ID, "hash-4", now+600, now, 3); err != nil || ok {
+		t.Errorf("fourth resend = %v, %v, want refused", ok, err)
+	}
+}
+
+func TestInsertVerificationSupersedesIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "verification")
+	ctx := context.Background()
+	now := time.Now().Unix()
+	const msisdn = "254700000001"
+	if _, err := db.InsertVerification(ctx, msisdn, "withdraw", "hash-w", now+300, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, hash := range []string{"hash-1", "hash-2", "hash-3"} {
+		resends, err := db.InsertVerification(ctx, msisdn, "login", hash, now+300, now+int64(i))
+		if err != nil || resends != i {
+			t.Fatalf("request %d = %d, %v, want %d resends", i+1, resends, err, i)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM verification WHERE purpose = 'login' AND status = 0`); n != 1 {
+		t.Errorf("%d usable login codes, want one", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM verification WHERE purpose = 'login' AND status = 2`); n != 2 {
+		t.Errorf("%d retired login codes, want two", n)
+	}
+	for _, old := range []string{"hash-1", "hash-2"} {
+		if row, err := db.GetOTPChecked(ctx, msisdn, "login", OTPGuess{Hash: old}); err != nil || row != nil {
+			t.Errorf("superseded %s = %v, %v, want no match", old, row, err)
+		}
+	}
+	if row, err := db.GetOTPChecked(ctx, msisdn, "login", OTPGuess{Hash: "hash-3"}); err != nil || row == nil {
+		t.Errorf("latest = %v, %v, want a match", row, err)
+	}
+	if row, err := db.GetOTPChecked(ctx, msisdn, "withdraw", OTPGuess{Hash: "hash-w"}); err != nil || row == nil {
+		t.Errorf("other purpose = %v, %v, want its code left usable", row, err)
+	}
+
+	// The same code again, as a test account's fixed code: the row is refreshed
+	const fixed = "254700000002"
+	for i := 0; i < 3; i++ {
+		if _, err := db.InsertVerification(ctx, fixed, "login", "hash-1111", now+300+int64(i), now+int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var rows, expired, resends int64
+	if err := pool.QueryRow(ctx, `SELECT COUNT(*), MAX(expired), MAX(resend_count) FROM verification WHERE msisdn = $1`, fixed).
+		Scan(&rows, &expired, &resends); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 || expired != now+302 || resends != 2 {
+		t.Errorf("fixed code rows = %d, expired %d, resends %d, want one row refreshed", rows, expired, resends)
+	}
+
+	// Past the last code's expiry the count starts over
+	if resends, err := db.InsertVerification(ctx, msisdn, "login", "hash-4", now+900, now+600); err != nil || resends != 0 {
+		t.Errorf("after expiry = %d, %v, want 0 resends", resends, err)
+	}
+}
+
+func TestAnonymizePlayerIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "Bets", "balance_withdrawals", "dbQueue", "verification",
+		`"Aviator"."ussd_session"`, `"Aviator"."ussd_logs"`, `"Aviator"."ussd_log_inputs"`)
+	ctx := context.Background()
+	const msisdn, other, token = "254700000001", "254700000002", "del0123456789"
+	dbtest.SeedPlayer(t, pool, msisdn, 100)
+	dbtest.SeedPlayer(t, pool, other, 100)
+	for _, m := range []string{msisdn, other} {
+		dbtest.Exec(t, pool, `INSERT INTO "Bets" (msisdn, amount) VALUES ($1, 20)`, m)
+		dbtest.Exec(t, pool, `INSERT INTO "balance_withdrawals" (reference, msisdn, amount) VALUES ($1, $2, 50)`, "ref-"+m, m)
+		dbtest.Exec(t, pool, `INSERT INTO "dbQueue" ("Destination", "Message") VALUES ($1, 'Your code is 123456')`, m)
+		dbtest.Exec(t, pool, `INSERT INTO verification (msisdn, expired, created) VALUES ($1, 0, 0)`, m)
+		dbtest.Exec(t, pool, `INSERT INTO "Aviator"."ussd_session" (sessionid, msisdn) VALUES ('s', $1)`, m)
+		dbtest.Exec(t, pool, `INSERT INTO "Aviator"."ussd_logs" (sessionid, msisdn) VALUES ('s', $1)`, m)
+		dbtest.Exec(t, pool, `INSERT INTO "Aviator"."ussd_log_inputs" (sessionid, msisdn) VALUES ('s', $1)`, m)
+	}
+
+	if ok, err := db.AnonymizePlayer(ctx, msisdn, token); err != nil || ok {
+		t.Fatalf("anonymize before the request = %v, %v, want refused", ok, err)
+	}
+	if _, err := db.RequestPlayerDeletion(ctx, msisdn); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.AnonymizePlayer(ctx, msisdn, token); err != nil || !ok {
+		t.Fatalf("AnonymizePlayer = %v, %v", ok, err)
+	}
+
+	for _, table := range []string{`"Bets"`, `"balance_withdrawals"`} {
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM `+table+` WHERE msisdn = $1`, token); n != 1 {
+			t.Errorf("%s has %d rows under the token, want the player's row re-keyed", table, n)
+		}
+	}
+	for _, table := range []string{"verification", `"Aviator"."ussd_session"`, `"Aviator"."ussd_logs"`, `"Aviator"."ussd_log_inputs"`} {
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM `+table+` WHERE msisdn IN ($1, $2)`, msisdn, token); n != 0 {
+			t.Errorf("%s kept %d rows for the deleted player", table, n)
+		}
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM `+table+` WHERE msisdn = $1`, other); n != 1 {
+			t.Errorf("%s lost the other player's row", table)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "dbQueue" WHERE "Destination" = $1 AND "Message" = ''`, token); n != 1 {
+		t.Error("the queued SMS should be re-keyed with its text removed")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE msisdn = $1 AND active_status = 'deleted' AND balance = 100`, token); n != 1 {
+		t.Error("the player row should be deleted under the token with its balance kept")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE msisdn = $1`, msisdn); n != 0 {
+		t.Error("no player row should be left under the msisdn")
+	}
+}
+
+func TestListDueDeletionsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "withdrawals", "player_debts")
+	ctx := context.Background()
+	retention := 14 * 24 * time.Hour
+	now := time.Now()
+	players := []struct {
+		msisdn    string
+		requested time.Duration
+		blocked   string
+	}{
+		{"254700000001", retention + time.Minute, "pending_withdrawal"},
+		{"254700000002", retention + time.Hour, ""},
+		{"254700000003", retention + time.Minute, ""},
+		{"254700000004", retention - time.Minute, ""},
+	}
+	for _, p := range players {
+		dbtest.SeedPlayer(t, pool, p.msisdn, 0)
+		dbtest.Exec(t, pool, `UPDATE "Player" SET active_status = 'pending_deletion', deletion_requested_at = $2,
+			deletion_blocked = NULLIF($3, '') WHERE msisdn = $1`, p.msisdn, now.Add(-p.requested), p.blocked)
+	}
+
+	due, err := db.ListDueDeletions(ctx, now.Add(-retention), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range due {
+		got = append(got, c.Msisdn)
+	}
+	want := []string{"254700000002", "254700000003", "254700000001"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("due = %v, want %v: oldest first, blocked last, none inside the window", got, want)
+	}
+
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (msisdn, amount, status) VALUES ('254700000001', 50, $1)`, status.WithdrawalPending)
+	dbtest.Exec(t, pool, `INSERT INTO "player_debts" (msisdn, amount, reason, reference) VALUES ('254700000002', 10, 'reversal', 'r1')`)
+	dbtest.Exec(t, pool, `INSERT INTO "player_debts" (msisdn, amount, reason, reference, settled_at) VALUES ('254700000003', 10, 'reversal', 'r2', NOW())`)
+	for msisdn, want := range map[string]string{"254700000001": "pending_withdrawal", "254700000002": "open_debt", "254700000003": ""} {
+		if reason, err := db.GetDeletionBlocker(ctx, msisdn); err != nil || reason != want {
+			t.Errorf("blocker for %s = %q, %v, want %q", msisdn, reason, err, want)
+		}
+	}
+}
+
+func TestBasketHoldsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Basket", "BasketLogs", "basket_holds", "basket_topups", "pending_withdrawals", "withdrawal_queue_ke")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Basket" (amount) VALUES (150)`)
+	for _, h := range []struct {
+		ref    string
+		amount float64
+	}{{"G1", 200}, {"G2", 120}} {
+		dbtest.Exec(t, pool, `INSERT INTO "pending_withdrawals" (reference, msisdn, amount, tax_amount) VALUES ($1, '254700000001', $2, 0)`, h.ref, h.amount*0.8)
+		if ok, err := db.HoldBasketPayout(ctx, h.ref, "254700000001", h.amount); err != nil || !ok {
+			t.Fatalf("hold %s = %v, %v", h.ref, ok, err)
+		}
+	}
+	if ok, err := db.HoldBasketPayout(ctx, "G1", "254700000001", 200); err != nil || ok {
+		t.Errorf("holding G1 twice = %v, %v, want refused", ok, err)
+	}
+
+	basket, err := db.CheckBasketLucky(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if available := utils.NumericFloat(basket["amount"]); available != -170 {
+		t.Errorf("available = %v, want 150 less the 320 reserved", available)
+	}
+	if covered, err := db.UpdateHouseLuckyBasketWins(ctx, 100); err != nil || covered {
+		t.Errorf("a win against reserved funds = %v, %v, want not covered", covered, err)
+	}
+
+	// 250 covers G1 only; G2 waits even though 50 is left
+	if _, _, err := db.TopUpBasket(ctx, 100, "admin", ""); err != nil {
+		t.Fatal(err)
+	}
+	released, err := db.ReleaseBasketHolds(ctx)
+	if err != nil || len(released) != 1 || released[0].Reference != "G1" || released[0].Payout != 160 {
+		t.Fatalf("released = %+v, %v, want G1 paying 160", released, err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawal_queue_ke" WHERE reference = 'G1' AND amount = 160`); n != 1 {
+		t.Error("G1's payout should be queued")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "pending_withdrawals"`); n != 1 {
+		t.Errorf("%d pending withdrawals, want only G2's", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Basket" WHERE amount = 50 AND reserved = 120`); n != 1 {
+		t.Error("the basket should be 50 with G2's 120 still reserved")
+	}
+	if released, _ := db.ReleaseBasketHolds(ctx); len(released) != 0 {
+		t.Errorf("released %+v without a top-up", released)
+	}
+}
+
+func TestDebitStakesIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "bonus_grants", "bet_funding", "Bets")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 50)
+	stakes := []Stake{{"B1", 20}, {"B2", 20}, {"B3", 20}}
+
+	if _, _, err := db.DebitStakes(ctx, "254700000001", stakes, false); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("three stakes on 50 = %v, want ErrInsufficientBalance", err)
+	}
+	if got := dbtest.PlayerBalance(t, pool, "254700000001"); got != 50 {
+		t.Errorf("balance = %v after a refused parcel, want 50", got)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "bet_funding"`); n != 0 {
+		t.Errorf("%d funding rows after a refused parcel", n)
+	}
+
+	cash, bonus, err := db.DebitStakes(ctx, "254700000001", stakes[:2], false)
+	if err != nil || cash != 40 || bonus != 0 {
+		t.Fatalf("two stakes = %v, %v, %v, want 40 cash", cash, bonus, err)
+	}
+	if got := dbtest.PlayerBalance(t, pool, "254700000001"); got != 10 {
+		t.Errorf("balance = %v, want 10", got)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "bet_funding" WHERE reference IN ('B1', 'B2')`); n != 2 {
+		t.Errorf("%d funding rows, want one per box", n)
+	}
+
+	bets := []ParcelBet{{Stake: stakes[0], Box: "2"}, {Stake: stakes[1], Box: "5"}}
+	if err := db.CreateParcelBets(ctx, "254700000001", "P1", bets, "normal", "1", "Test", "web"); err != nil {
+		t.Fatal(err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Bets" WHERE parcel_reference = 'P1' AND result_status = $1`, status.ResultPending); n != 2 {
+		t.Errorf("%d pending bets in the parcel, want 2", n)
+	}
+	// One duplicate reference writes none of the parcel
+	again := []ParcelBet{{Stake: Stake{"B9", 20}, Box: "1"}, {Stake: stakes[0], Box: "2"}}
+	if err := db.CreateParcelBets(ctx, "254700000001", "P2", again, "normal", "1", "Test", "web"); !errors.Is(err, ErrDuplicateReference) {
+		t.Errorf("duplicate = %v, want ErrDuplicateReference", err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Bets" WHERE parcel_reference = 'P2'`); n != 0 {
+		t.Errorf("%d bets of the failed parcel written", n)
+	}
+}
+
+func TestMsisdnChangeIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "Attempted_Players")
+	ctx := context.Background()
+	dbtest.SeedPlayer(t, pool, "254700000001", 40)
+	dbtest.SeedPlayer(t, pool, "254700000002", 0)
+	hold := time.Now().Add(10 * time.Minute)
+
+	if n, err := db.CreateUserAttempted(ctx, "254700000001", "254700000009", hold); err != nil || n != 1 {
+		t.Fatalf("first claim = %d, %v", n, err)
+	}
+	if n, err := db.CreateUserAttempted(ctx, "254700000002", "254700000009", hold); err != nil || n != 0 {
+		t.Errorf("contested claim = %d, %v, want no row", n, err)
+	}
+	if _, err := db.UpdateUserMsisdn(ctx, "254700000002", "254700000009"); !errors.Is(err, ErrMsisdnChangeExpired) {
+		t.Errorf("loser moving = %v, want ErrMsisdnChangeExpired", err)
+	}
+
+	// An expired hold is ignored and cleared by the next claim
+	dbtest.Exec(t, pool, `UPDATE "Attempted_Players" SET expires_at = NOW() - INTERVAL '1 second'`)
+	if row, err := db.GetUserAttempted(ctx, "254700000001"); row != nil || err != nil {
+		t.Errorf("expired hold = %v, %v, want none", row, err)
+	}
+	if _, err := db.UpdateUserMsisdn(ctx, "254700000001", "254700000009"); !errors.Is(err, ErrMsisdnChangeExpired) {
+		t.Errorf("moving on an expired hold = %v, want ErrMsisdnChangeExpired", err)
+	}
+	if n, err := db.CreateUserAttempted(ctx, "254700000002", "254700000009", hold); err != nil || n != 1 {
+		t.Fatalf("claim after expiry = %d, %v", n, err)
+	}
+	if _, err := db.UpdateUserMsisdn(ctx, "254700000002", "254700000009"); err != nil {
+		t.Fatal(err)
+	}
+	if dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE msisdn = '254700000009'`) != 1 ||
+		dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Attempted_Players"`) != 0 {
+		t.Error("the change did not move the player and consume the hold")
+	}
+}
+
+func TestExpireFreeBetsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "CustomerLogs")
+	ctx := context.Background()
+	for i, offset := range []string{"-2 hours", "-1 hour", "-1 second", "1 hour"} {
+		msisdn := fmt.Sprintf("25470000000%d", i+1)
+		dbtest.SeedPlayer(t, pool, msisdn, 0)
+		dbtest.Exec(t, pool, `UPDATE "Player" SET free_bet = 3, is_free = 'YES',
+			freebet_expiry = NOW() + $2::interval WHERE msisdn = $1`, msisdn, offset)
+	}
+
+	// Oldest expiry first, batchSize at a time
+	first, err := db.ExpireFreeBets(ctx, 2)
+	if err != nil || len(first) != 2 || first[0].Msisdn != "254700000001" || first[1].Msisdn != "254700000002" {
+		t.Fatalf("first batch = %+v, %v, want the two oldest", first, err)
+	}
+	rest, err := db.ExpireFreeBets(ctx, 2)
+	if err != nil || len(rest) != 1 || rest[0].Msisdn != "254700000003" || rest[0].FreeBets != 3 {
+		t.Fatalf("second batch = %+v, %v, want the one expired a second ago", rest, err)
+	}
+	if again, _ := db.ExpireFreeBets(ctx, 2); len(again) != 0 {
+		t.Errorf("third batch = %+v, want none", again)
+	}
+
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE free_bet = 0 AND is_free = 'NO'`); n != 3 {
+		t.Errorf("%d players cleared, want 3", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE msisdn = '254700000004' AND free_bet = 3 AND is_free = 'YES'`); n != 1 {
+		t.Error("the active free bets were touched")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "CustomerLogs" WHERE type = 'freebet_expired' AND amount = 3`); n != 3 {
+		t.Errorf("%d freebet_expired logs, want 3", n)
+	}
+}
+
+func TestDepositsByShortcodeIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "deposit", "shortcodes")
+	ctx := context.Background()
+	if err := db.UpsertShortcode(ctx, "4093451", "Radio Jambo", "jambo", "", false, true); err != nil {
+		t.Fatal(err)
+	}
+	deposits := []struct {
+		msisdn, shortcode string
+		amount            float64
+		at                string
+	}{
+		{"254700000001", "4093451", 100, "2026-03-02"},
+		{"254700000001", "4093451", 20, "2026-03-03"},
+		{"254700000002", "4093451", 30, "2026-03-04"},
+		{"254700000003", "999999", 20, "2026-03-05"},
+		{"254700000003", "4093451", 500, "2026-04-02"},
+	}
+	for _, d := range deposits {
+		dbtest.Exec(t, pool, `INSERT INTO "deposit" (msisdn, shortcode, amount, date_created) VALUES ($1, $2, $3, $4)`,
+			d.msisdn, d.shortcode, d.amount, d.at)
+	}
+
+	rows, err := db.GetDepositsByShortcode(ctx, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("rows = %v, want the known and the unknown shortcode", rows)
+	}
+	jambo, unknown := rows[0], rows[1]
+	if jambo["shortcode"] != "4093451" || jambo["campaign"] != "jambo" || jambo["known"] != true ||
+		utils.ToInt64(jambo["deposits"]) != 3 || utils.ToInt64(jambo["players"]) != 2 || utils.ToFloat64(jambo["amount"]) != 150 {
+		t.Errorf("jambo = %v, want 3 deposits of 150 by 2 players in March", jambo)
+	}
+	if unknown["shortcode"] != "999999" || unknown["known"] != false || utils.ToFloat64(unknown["amount"]) != 20 {
+		t.Errorf("unknown = %v, want the 20 flagged unknown", unknown)
+	}
+
+	if err := db.UpsertShortcode(ctx, "4093452", "Radio Citizen", "jambo", "", false, true); !errors.Is(err, ErrShortcodeConflict) {
+		t.Errorf("second jambo shortcode = %v, want ErrShortcodeConflict", err)
+	}
+}
+
+func TestCreateUserZeroedIntegration(t *testing.T) {
+	db, _ := openIntegration(t, "Player")
+	ctx := context.Background()
+	if _, err := db.CreateUser(ctx, "safaricom", "254700000001", "Wanjiru", "abc123", ""); err != nil {
+		t.Fatal(err)
+	}
+	row, err := db.CheckUser(ctx, "254700000001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, col := range []string{"balance", "bonus", "free_bet", "total_bets", "payout", "total_losses", "lost_count"} {
+		if row[col] == nil {
+			t.Errorf("%s is NULL, want 0", col)
+		}
+	}
+	p := Player(row)
+	if p.Funds() != 0 || p.TotalBets() != 0 || p.RTP() != 0 {
+		t.Errorf("new player = %v, want zeroed money and stats", row)
+	}
+}
+
+// TestReportFiguresIntegration seeds a known business day in every source
+// table, with rows either side of it, and checks each figure
+func TestReportFiguresIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Bets", "tax_record", "deposit", "deposit_reversals", "withdrawals", "pending_withdrawals")
+	ctx := context.Background()
+	day := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{day, day.AddDate(0, 0, -1), day.AddDate(0, 0, 1)} {
+		dbtest.Exec(t, pool, `INSERT INTO "Bets" (msisdn, amount, win_amount, bet_type, date_created) VALUES
+			('254700000001', 100, 0, 'cash', $1), ('254700000001', 200, 60, NULL, $1), ('254700000002', 50, 60, 'free_bet', $1)`, at)
+		dbtest.Exec(t, pool, `INSERT INTO "tax_record" (msisdn, tax_amount, tax_type, date_created) VALUES
+			('254700000001', 38, 'excise', $1), ('254700000001', 24, 'withholding', $1), ('254700000001', 5, 'jackpot', $1)`, at)
+		dbtest.Exec(t, pool, `INSERT INTO "deposit" (msisdn, amount, date_created) VALUES ('254700000001', 1000, $1)`, at)
+		dbtest.Exec(t, pool, `INSERT INTO "deposit_reversals" (reversal_reference, transaction_id, msisdn, amount, clawed_back, date_created)
+			VALUES ($2, $2, '254700000001', 100, 100, $1)`, at, "R"+at.Format("0102"))
+		dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (msisdn, amount, status, date_created) VALUES
+			('254700000001', 400, $2, $1), ('254700000001', 96, $3, $1), ('254700000001', 70, 'failed', $1)`,
+			at, status.WithdrawalProcessed, status.WithdrawalPending)
+		dbtest.Exec(t, pool, `INSERT INTO "pending_withdrawals" (msisdn, amount, date_created) VALUES ('254700000001', 48, $1)`, at)
+	}
+
+	dateRange, err := utils.ParseDateRange("2026-03-02", "2026-03-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.GetReportFigures(ctx, dateRange.Start, dateRange.End)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"stakes": 300, "wins": 120, "free_bet_stakes": 50, "free_bet_wins": 60, "excise": 38, "withholding": 24,
+		"deposits": 1000, "deposit_reversals": 100, "withdrawals_paid": 400, "withdrawals_queued": 96, "payouts_held": 48,
+	}
+	got := make(map[string]float64)
+	for _, row := range rows {
+		if day := utils.ToString(row["day"]); day != "2026-03-02" {
+			t.Errorf("row %v booked to %s, want 2026-03-02", row, day)
+		}
+		got[utils.ToString(row["figure"])] = utils.ToFloat64(row["amount"])
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("figures = %v\nwant %v", got, want)
+	}
+}
+
+func TestBetRevealsIntegration(t *testing.T) {
+	db, _ := openIntegration(t, "bet_reveals")
+	ctx := context.Background()
+	now := time.Now()
+	result := []byte(`{"GameID":"PW1","WinAmount":60}`)
+	if err := db.CreateBetReveal(ctx, "PW1", "254700000001", result, []string{"You won"}, now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateBetReveal(ctx, "PW2", "254700000001", result, nil, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if row, err := db.GetBetReveal(ctx, "PW1", "254700000002"); err != nil || row != nil {
+		t.Errorf("another player's reveal = %v, %v; want none", row, err)
+	}
+	rows, err := db.ClaimDueReveals(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0]["reference"] != "PW1" || fmt.Sprint(rows[0]["sms"]) != "[You won]" {
+		t.Fatalf("claimed %v, want PW1 with its SMS", rows)
+	}
+	if rows, err = db.ClaimDueReveals(ctx, 10); err != nil || len(rows) != 0 {
+		t.Errorf("second claim = %v, %v; want nothing", rows, err)
+	}
+	if n, err := db.PurgeBetReveals(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+		t.Errorf("purged %d, %v; want the sent PW1 only", n, err)
+	}
+}
+
+// TestWarmPoolIntegration warms a fresh pool and serves as many concurrent
+// hot queries as it opened without dialing again
+func TestWarmPoolIntegration(t *testing.T) {
+	dbtest.Open(t)
+	poolCfg, err := pgxpool.ParseConfig(os.Getenv("TEST_DATABASE_URL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolCfg.MinConns, poolCfg.MaxConns = 0, 8
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolCfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	saved := globalPool
+	globalPool = pool
+	t.Cleanup(func() { globalPool = saved })
+
+	const warm = 4
+	cfg := config.DatabaseConfig{WarmConns: warm, WarmTimeout: 10 * time.Second, WarmQueries: config.WarmQueryNames}
+	if err := WarmPool(context.Background(), cfg); err != nil {
+		t.Fatal(err)
+	}
+	if stat := pool.Stat(); stat.TotalConns() != warm || stat.NewConnsCount() != warm || stat.IdleConns() != warm {
+		t.Fatalf("after warmup: %d conns, %d dialed, %d idle; want %d of each", stat.TotalConns(), stat.NewConnsCount(), stat.IdleConns(), warm)
+	}
+
+	db := NewDatabaseWithPool(pool, nil)
+	var wg sync.WaitGroup
+	errs := make(chan error, warm)
+	for i := 0; i < warm; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.CheckUser(context.Background(), "254700000001"); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if n := pool.Stat().NewConnsCount(); n != warm {
+		t.Errorf("first %d requests dialed %d more connections, want none", warm, n-warm)
+	}
+
+	cfg.WarmQueries = []string{"check_users"}
+	if err := WarmPool(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "check_users") {
+		t.Errorf("unknown warm query = %v, want it named", err)
+	}
+}
+
+// TestJackpotContributionsIntegration has concurrent bets pay into the same
+// kitties and checks the ledger accounts for every shilling of the kitties'
+// movement, that a locked kitty takes nothing and that a payout reconciles
+func TestJackpotContributionsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "jackpot_kitty", "jackpot_contributions")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "jackpot_kitty" (id, name_init, item_name, kitty, cost, pct_slice, is_locked) VALUES
+		(1, 'pw', 'Phone', 100, 300, 50, 0), (2, 'pw', 'TV', 0, 1000, 25, 0), (3, 'pw', 'Car', 40, 5000, 25, 1), (4, '', 'Cash', 0, 1000, 100, 0)`)
+	dbtest.Exec(t, pool, `INSERT INTO "jackpot_contributions" (reference, kitty_id, amount, kind) VALUES ('opening', 1, 100, 'opening'), ('opening', 3, 40, 'opening')`)
+
+	const bets = 40
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*bets)
+	for i := 0; i < bets; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reference := fmt.Sprintf("PW%03d", i)
+			if n, err := db.UpdateJackpotKitNameInit(ctx, reference, 10, "pw"); err != nil || n != 2 {
+				errs <- fmt.Errorf("%s: paid %d kitties, %v; want the two unlocked", reference, n, err)
+			}
+			if n, err := db.UpdateJackpotKit(ctx, reference, 10); err != nil || n != 1 {
+				errs <- fmt.Errorf("%s: paid %d generic kitties, %v; want 1", reference, n, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	kitty := func(id int) float64 {
+		var v float64
+		if err := pool.QueryRow(ctx, `SELECT kitty::float8 FROM "jackpot_kitty" WHERE id = $1`, id).Scan(&v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	for id, want := range map[int]float64{1: 100 + bets*5, 2: bets * 2.5, 3: 40, 4: bets * 10} {
+		if got := kitty(id); got != want {
+			t.Errorf("kitty %d = %v, want %v", id, got, want)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "jackpot_contributions" WHERE kind = 'contribution' AND kitty_id = 3`); n != 0 {
+		t.Errorf("locked kitty booked %d contributions", n)
+	}
+
+	if _, err := db.UpdateJackpotKity(ctx, 1, "PW-WIN"); err != nil {
+		t.Fatal(err)
+	}
+	if got := kitty(1); got != 100+bets*5-300 {
+		t.Errorf("kitty 1 after its payout = %v, want %v", got, 100+bets*5-300)
+	}
+
+	rows, err := db.GetJackpotReconciliation(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("reconciled %d kitties, want 4", len(rows))
+	}
+	for _, row := range rows {
+		value := utils.ToFloat64(row["kitty"])
+		ledger := utils.ToFloat64(row["opening"]) + utils.ToFloat64(row["contributions"]) - utils.ToFloat64(row["payouts"])
+		if value != ledger {
+			t.Errorf("kitty %v = %v, ledger sums to %v", row["id"], value, ledger)
+		}
+	}
+	if k1 := rows[0]; utils.ToInt64(k1["contribution_count"]) != bets || utils.ToInt64(k1["payout_count"]) != 1 {
+		t.Errorf("kitty 1 ledger = %v, want %d contributions and a payout", k1, bets)
+	}
+}
+
+func TestAuditStatusesIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Bets", "deposit_requests", "withdrawals", "withdrawal_b2b_to_process", "deposit_reversals")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (msisdn, result_status, status) VALUES
+		('254700000001', 'Win', 'processed'), ('254700000001', 'Loss', NULL), ('254700000001', 'Pending', NULL),
+		('254700000001', 'Lose', 'processed'), ('254700000001', 'Lose', 'processed'), ('254700000001', 'Won', 'settled')`)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (msisdn, status) VALUES ('254700000001', NULL), ('254700000001', 'success'), ('254700000001', 'timeout')`)
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (msisdn, status) VALUES ('254700000001', 'pending'), ('254700000001', 'processed')`)
+	if _, err := db.InsertB2BWithdrawalB2B(ctx, "PW1", "254700000001", 50, status.ResultLoss.B2B()); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawal_b2b_to_process" (reference, msisdn, amount, bet_status) VALUES ('PW2', '254700000001', 50, 'Loss')`)
+
+	rows, err := db.AuditStatuses(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, row := range rows {
+		got = append(got, fmt.Sprintf("%s.%s=%s×%d", row["table_name"], row["column_name"], row["value"], utils.ToInt64(row["count"])))
+	}
+	want := []string{
+		"Bets.result_status=Lose×2", "Bets.result_status=Won×1", "Bets.status=settled×1",
+		"deposit_requests.status=timeout×1", "withdrawal_b2b_to_process.bet_status=Loss×1",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("audit = %v\nwant %v", got, want)
+	}
+}
+
+func TestClaimSTKRetryIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "deposit_requests", "stk_queue_ke")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (reference, msisdn, amount, status, date_created) VALUES
+		('PW1', '254700000001', 50, NULL, NOW() - interval '1 minute'),
+		('PW2', '254700000001', 50, 'success', NOW() - interval '1 minute')`)
+
+	claim := func(reference string, retries int) bool {
+		ok, err := db.ClaimSTKRetry(ctx, reference, retries, 2, 30*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if !claim("PW1", 0) {
+		t.Fatal("first retry a minute after the push refused")
+	}
+	if claim("PW1", 1) {
+		t.Error("retry inside the spacing claimed")
+	}
+	if claim("PW1", 0) {
+		t.Error("stale retry count claimed")
+	}
+	dbtest.Exec(t, pool, `UPDATE "deposit_requests" SET stk_retried_at = NOW() - interval '1 minute' WHERE reference = 'PW1'`)
+	if !claim("PW1", 1) {
+		t.Error("second retry after the spacing refused")
+	}
+	dbtest.Exec(t, pool, `UPDATE "deposit_requests" SET stk_retried_at = NOW() - interval '1 minute' WHERE reference = 'PW1'`)
+	if claim("PW1", 2) {
+		t.Error("retry past the ceiling claimed")
+	}
+	if claim("PW2", 0) {
+		t.Error("settled deposit claimed")
+	}
+
+	row, err := db.GetSTKRetry(ctx, "PW1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utils.ToInt64(row["stk_retries"]) != 2 || row["msisdn"] != "254700000001" {
+		t.Errorf("PW1 = %v, want 2 retries", row)
+	}
+}
+
+func TestRecentWinnersShowWinIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "withdrawals", "Bets")
+	ctx := context.Background()
+	for _, msisdn := range []string{"254700000001", "254700000002", "254700000003", "254700000004"} {
+		dbtest.SeedPlayer(t, pool, msisdn, 0)
+	}
+	dbtest.Exec(t, pool, `UPDATE "Player" SET show_win = CASE msisdn
+		WHEN '254700000001' THEN 'true' WHEN '254700000002' THEN 'YES' WHEN '254700000003' THEN 'false' END`)
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (reference, msisdn, amount, items) VALUES
+		('W1', '254700000001', 500, 'KES 500'), ('W2', '254700000002', 500, 'KES 500'),
+		('W3', '254700000003', 500, 'KES 500'), ('W4', '254700000004', 500, 'KES 500')`)
+
+	shown := func() map[string]bool {
+		rows, err := db.GetRecentWinners(ctx, 10, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]bool{}
+		for _, row := range rows {
+			got[utils.ToString(row["msisdn"])] = true
+		}
+		return got
+	}
+	got := shown()
+	if !got["254700000001"] || !got["254700000002"] || got["254700000003"] || got["254700000004"] || !got[""] {
+		t.Errorf("feed msisdns = %v, want only the opted-in players shown", got)
+	}
+
+	dbtest.Exec(t, pool, `UPDATE "Player" SET show_win = 'false' WHERE msisdn = '254700000001'`)
+	if shown()["254700000001"] {
+		t.Error("player still shown after turning show_win off")
+	}
+}
+
+func TestGameDailyExposureIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Games", "game_daily_exposure")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Games" (id, name, status, daily_exposure_cap) VALUES (1, 'PawaBox', 'active', 1000)`)
+	// Yesterday's row reached the cap; today starts again from nothing
+	dbtest.Exec(t, pool, `INSERT INTO "game_daily_exposure" (date, game_cat_id, exposure, win_count)
+		VALUES (`+today()+` - 1, '1', 1000, 4)`)
+
+	exposure, err := db.GetGameDailyExposure(ctx, "1")
+	if err != nil || exposure != 0 {
+		t.Fatalf("exposure after midnight = %v, %v; want 0", exposure, err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := db.AddGameDailyExposure(ctx, "1", 25.5); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if exposure, _ := db.GetGameDailyExposure(ctx, "1"); exposure != 255 {
+		t.Errorf("exposure = %v, want 10 wins of 25.5", exposure)
+	}
+	if _, err := db.AddGameDailyExposure(ctx, "1", -5); err == nil {
+		t.Error("negative exposure added")
+	}
+
+	rows, err := db.ListGameDailyExposure(ctx)
+	if err != nil || len(rows) != 1 {
+		t.Fatalf("ListGameDailyExposure = %v, %v", rows, err)
+	}
+	if rows[0]["exposure"] != 255.0 || rows[0]["win_count"] != int64(10) || rows[0]["daily_exposure_cap"] != 1000.0 {
+		t.Errorf("row = %v, want today's 255 over 10 wins against 1000", rows[0])
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "game_daily_exposure"`); n != 2 {
+		t.Errorf("%d exposure rows, want yesterday's and today's", n)
+	}
+}
+
+func TestSessionLimitIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "player_sessions", "access_tokens", "refresh_tokens")
+	ctx := context.Background()
+	msisdn := "254700000001"
+	open := func(jti, device, finger string, evict bool) ([]string, error) {
+		expires := time.Now().Add(time.Hour)
+		return db.OpenSession(ctx, msisdn, jti, device, finger, expires, expires, 2, evict)
+	}
+	for _, jti := range []string{"a", "b"} {
+		if revoked, err := open(jti, "", "finger-"+jti, true); err != nil || len(revoked) != 0 {
+			t.Fatalf("session %s within the limit = %v, %v", jti, revoked, err)
+		}
+	}
+
+	if _, err := open("c", "", "finger-c", false); !errors.Is(err, ErrSessionLimit) {
+		t.Errorf("reject past the limit = %v, want ErrSessionLimit", err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "player_sessions"`); n != 2 {
+		t.Errorf("%d sessions after a refused login, want 2", n)
+	}
+
+	dbtest.Exec(t, pool, `INSERT INTO "refresh_tokens" (token_hash, msisdn, device_id, expires_at)
+		VALUES ('hash-a', $1, 'device-a', NOW() + INTERVAL '1 day')`, msisdn)
+	dbtest.Exec(t, pool, `UPDATE "player_sessions" SET device_id = 'device-a' WHERE jti = 'a'`)
+	revoked, err := open("c", "", "finger-c", true)
+	if err != nil || len(revoked) != 1 || revoked[0] != "a" {
+		t.Fatalf("evict past the limit = %v, %v; want the oldest, a", revoked, err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "access_tokens" WHERE jti = 'a' AND revoked_at IS NOT NULL`); n != 1 {
+		t.Error("evicted session's access token not revoked")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "refresh_tokens" WHERE device_id = 'device-a' AND revoked_at IS NULL`); n != 0 {
+		t.Error("evicted session's refresh token still live")
+	}
+
+	// The same fingerprint replaces its own session rather than another
+	if revoked, err := open("b2", "", "finger-b", true); err != nil || len(revoked) != 1 || revoked[0] != "b" {
+		t.Errorf("login again on a device = %v, %v; want b replaced", revoked, err)
+	}
+	rows, err := db.ListSessions(ctx, msisdn)
+	if err != nil || len(rows) != 2 || rows[0]["jti"] != "b2" || rows[1]["jti"] != "c" {
+		t.Fatalf("live sessions = %v, %v; want b2 and c, newest first", rows, err)
+	}
+
+	if jti, err := db.RevokeSession(ctx, "254700000009", utils.ToInt64(rows[1]["id"])); err != nil || jti != "" {
+		t.Errorf("another player's revoke = %q, %v; want nothing", jti, err)
+	}
+	if jti, err := db.RevokeSession(ctx, msisdn, utils.ToInt64(rows[1]["id"])); err != nil || jti != "c" {
+		t.Errorf("revoke = %q, %v; want c", jti, err)
+	}
+	if jti, _ := db.RevokeSession(ctx, "", utils.ToInt64(rows[1]["id"])); jti != "" {
+		t.Errorf("revoking twice = %q, want nothing", jti)
+	}
+
+	dbtest.Exec(t, pool, `UPDATE "player_sessions" SET last_seen = NOW() - INTERVAL '1 hour' WHERE jti = 'b2'`)
+	if err := db.TouchSession(ctx, "b2"); err != nil {
+		t.Fatal(err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "player_sessions" WHERE jti = 'b2' AND last_seen > NOW() - INTERVAL '1 minute'`); n != 1 {
+		t.Error("touch did not move last_seen")
+	}
+}
+
+func TestJackpotGamesIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Games", "jackpot_kitty")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Games" (id, name, name_init, status, is_jackpot) VALUES
+		(1, 'Supa', 'pawa_supa', 'active', TRUE), (2, 'Mega', 'pw_mega', 'active', FALSE), (3, 'PawaBox', 'pw', 'active', FALSE)`)
+	dbtest.Exec(t, pool, `INSERT INTO "jackpot_kitty" (id, name_init, item_name, kitty, cost, pct_slice, is_locked) VALUES
+		(1, 'pw_mega', 'Car', 0, 5000, 100, 0)`)
+
+	games, err := db.ListJackpotGames(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 || games[0]["id"] != "1" || games[0]["is_jackpot"] != true || games[1]["id"] != "2" || games[1]["is_jackpot"] != false {
+		t.Errorf("jackpot games = %v, want the flagged game and the one sharing a kitty's name", games)
+	}
+	kitties, err := db.ListJackpotKitties(ctx)
+	if err != nil || len(kitties) != 1 || kitties[0]["name_init"] != "pw_mega" {
+		t.Errorf("kitties = %v, %v", kitties, err)
+	}
+	game, err := db.GetGame(ctx, "1")
+	if err != nil || game == nil || !game.IsJackpot {
+		t.Errorf("GetGame = %+v, %v; want IsJackpot", game, err)
+	}
+}
+
+func TestPlayerLifetimeStatsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Bets")
+	ctx := context.Background()
+	bet := func(msisdn, result string, amount, won float64, betType string, ago time.Duration) {
+		dbtest.Exec(t, pool, `INSERT INTO "Bets" (msisdn, amount, win_amount, result_status, bet_type, date_created)
+			VALUES ($1, $2, $3, $4, $5, NOW() - $6::interval)`, msisdn, amount, won, result, betType, fmt.Sprintf("%d seconds", int(ago.Seconds())))
+	}
+
+	// Oldest first: W L W W, then two losses, one of them a free bet, then
+	// a pending bet that is not settled and a bet of another player
+	const p = "254700000001"
+	bet(p, "Win", 20, 100.5, "cash_bet", 6*time.Hour)
+	bet(p, "Loss", 50, 0, "cash_bet", 5*time.Hour)
+	bet(p, "Win", 20, 40, "cash_bet", 4*time.Hour)
+	bet(p, "Win", 10, 1200, "cash_bet", 3*time.Hour)
+	bet(p, "Loss", 30, 0, "cash_bet", 2*time.Hour)
+	bet(p, "Loss", 25, 0, "free_bet", time.Hour)
+	bet(p, "Pending", 99, 0, "cash_bet", time.Minute)
+	bet("254700000002", "Win", 500, 5000, "cash_bet", time.Minute)
+
+	st, err := db.GetPlayerLifetimeStats(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PlayerLifetimeStats{GamesPlayed: 6, Wins: 3, Losses: 3, TotalWagered: 130, TotalWon: 1340.5, BiggestWin: 1200, Streak: 2}
+	if st != want {
+		t.Errorf("stats = %+v, want %+v", st, want)
+	}
+
+	// Bets in the same second are ordered by id
+	bet(p, "Win", 10, 30, "cash_bet", 0)
+	bet(p, "Win", 10, 30, "cash_bet", 0)
+	if st, _ := db.GetPlayerLifetimeStats(ctx, p); !st.StreakWon || st.Streak != 2 {
+		t.Errorf("after two wins streak = %d won %v, want 2 wins", st.Streak, st.StreakWon)
+	}
+
+	const single = "254700000003"
+	bet(single, "Win", 20, 60, "cash_bet", time.Minute)
+	if st, _ := db.GetPlayerLifetimeStats(ctx, single); st.Streak != 1 || !st.StreakWon || st.GamesPlayed != 1 || st.BiggestWin != 60 {
+		t.Errorf("single bet stats = %+v, want a streak of one win", st)
+	}
+
+	const losing = "254700000004"
+	for i := 0; i < 4; i++ {
+		bet(losing, "Loss", 20, 0, "cash_bet", time.Duration(i)*time.Minute)
+	}
+	if st, _ := db.GetPlayerLifetimeStats(ctx, losing); st.Streak != 4 || st.StreakWon || st.Wins != 0 || st.TotalWon != 0 || st.BiggestWin != 0 || st.TotalWagered != 80 {
+		t.Errorf("all losses stats = %+v, want a streak of 4 losses and nothing won", st)
+	}
+
+	if st, err := db.GetPlayerLifetimeStats(ctx, "254700000009"); err != nil || st != (PlayerLifetimeStats{}) {
+		t.Errorf("no bets = %+v, %v; want zeros", st, err)
+	}
+}
+
+func TestGrantWelcomeFreeBetsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "Bets", "CustomerLogs", "welcome_grant_settings")
+	ctx := context.Background()
+	if w, err := db.GetWelcomeGrantSettings(ctx); err != nil || w != nil {
+		t.Fatalf("settings with no row = %+v, %v; want none", w, err)
+	}
+	if err := db.SetWelcomeGrantSettings(ctx, true, 3, 72, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetWelcomeGrantSettings(ctx, true, 5, 48, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := db.GetWelcomeGrantSettings(ctx); err != nil || w == nil || w.FreeBets != 5 || w.ValidHours != 48 || w.UpdatedBy != "ops" {
+		t.Errorf("settings = %+v, %v; want the second change in the single row", w, err)
+	}
+
+	dbtest.SeedPlayer(t, pool, "254700000001", 0)
+	expiry := time.Now().Add(72 * time.Hour)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := db.GrantWelcomeFreeBets(ctx, "254700000001", 3, expiry)
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 1 {
+		t.Errorf("%d of 10 concurrent grants went through, want 1", granted)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE msisdn = '254700000001' AND free_bet = 3
+		AND welcome_free_bets = 3 AND welcome_grant_at IS NOT NULL AND freebet_expiry > NOW() + INTERVAL '71 hours'`); n != 1 {
+		t.Error("new player does not hold the 3 welcome free bets")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "CustomerLogs" WHERE type = 'welcome_grant'`); n != 1 {
+		t.Errorf("%d welcome_grant log rows, want 1", n)
+	}
+
+	// A player who has bet, or whose grant was decided, gets nothing
+	dbtest.SeedPlayer(t, pool, "254700000002", 0)
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (msisdn, amount) VALUES ('254700000002', 20)`)
+	dbtest.SeedPlayer(t, pool, "254700000003", 0)
+	dbtest.Exec(t, pool, `UPDATE "Player" SET welcome_grant_at = NOW() WHERE msisdn = '254700000003'`)
+	for _, msisdn := range []string{"254700000002", "254700000003", "254700000009"} {
+		if ok, err := db.GrantWelcomeFreeBets(ctx, msisdn, 3, expiry); err != nil || ok {
+			t.Errorf("grant to %s = %v, %v; want none", msisdn, ok, err)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "CustomerLogs" WHERE type = 'welcome_grant'`); n != 1 {
+		t.Errorf("%d welcome_grant log rows after refused grants, want 1", n)
+	}
+}
+
+func TestWithdrawalRetryIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "withdrawals", "withdrawal_queue_ke", "withdrawal_retries")
+	ctx := context.Background()
+	for _, w := range []struct {
+		ref, disburse, age string
+		status             status.WithdrawalStatus
+	}{
+		{"W_FAILED", "Failed", "2 hours", status.WithdrawalProcessed},
+		{"W_SILENT", "", "3 hours", status.WithdrawalProcessed},
+		{"W_PAID", "0", "4 hours", status.WithdrawalProcessed},
+		{"W_SUCCESS", "Success", "4 hours", status.WithdrawalProcessed},
+		{"W_YOUNG", "", "5 minutes", status.WithdrawalProcessed},
+		{"W_PENDING", "", "4 hours", status.WithdrawalPending},
+	} {
+		dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (reference, msisdn, amount, status, disburse, date_created)
+			VALUES ($1, '254700000001', 500, $2, NULLIF($3, ''), NOW() - $4::interval)`, w.ref, w.status, w.disburse, w.age)
+	}
+
+	rows, total, err := db.FindUndisbursedWithdrawals(ctx, 30*time.Minute, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(rows) != 2 || rows[0]["reference"] != "W_SILENT" || rows[1]["reference"] != "W_FAILED" {
+		t.Fatalf("stuck = %d %v, want W_SILENT then W_FAILED", total, rows)
+	}
+	if rows, total, _ := db.FindUndisbursedWithdrawals(ctx, 30*time.Minute, 1, 1); total != 2 || len(rows) != 1 || rows[0]["reference"] != "W_FAILED" {
+		t.Errorf("second page = %d %v, want W_FAILED", total, rows)
+	}
+
+	if _, err := db.RetryWithdrawal(ctx, "W_PAID", "ops", 2, 0); !errors.Is(err, ErrWithdrawalDisbursed) {
+		t.Errorf("retry of a paid withdrawal = %v, want ErrWithdrawalDisbursed", err)
+	}
+	if _, err := db.RetryWithdrawal(ctx, "W_YOUNG", "ops", 2, 30*time.Minute); !errors.Is(err, ErrWithdrawalAwaitingCallback) {
+		t.Errorf("retry of a young withdrawal = %v, want ErrWithdrawalAwaitingCallback", err)
+	}
+	if _, err := db.RetryWithdrawal(ctx, "W_PENDING", "ops", 2, 0); !errors.Is(err, ErrWithdrawalNotFound) {
+		t.Errorf("retry of a pending withdrawal = %v, want ErrWithdrawalNotFound", err)
+	}
+
+	// The cap: two requeues, then the third is flagged manual
+	for attempt := 1; attempt <= 3; attempt++ {
+		w, err := db.RetryWithdrawal(ctx, "W_FAILED", "ops", 2, 0)
+		if err != nil {
+			t.Fatalf("retry %d: %v", attempt, err)
+		}
+		want := WithdrawalRequeued
+		if attempt == 3 {
+			want = WithdrawalManual
+		}
+		if w.Attempt != attempt || w.Outcome != want || w.Msisdn != "254700000001" || w.Amount != 500 {
+			t.Errorf("retry %d = %+v, want %s", attempt, w, want)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawal_queue_ke" WHERE reference = 'W_FAILED'`); n != 2 {
+		t.Errorf("%d queue rows, want 2", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawals"
+		WHERE reference = 'W_FAILED' AND disburse IS NULL AND disburse_retries = 2 AND manual_resolution`); n != 1 {
+		t.Error("the capped withdrawal must count 2 retries and be flagged manual")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawal_retries"
+		WHERE reference = 'W_FAILED' AND admin = 'ops' AND previous_disburse = 'Failed' AND attempt = 1`); n != 1 {
+		t.Error("the first retry must record the partner's last status")
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawal_retries" WHERE reference = 'W_FAILED' AND outcome = 'manual'`); n != 1 {
+		t.Error("the manual flag must be audited")
+	}
+	if _, err := db.RetryWithdrawal(ctx, "W_FAILED", "ops", 2, 0); !errors.Is(err, ErrWithdrawalManual) {
+		t.Errorf("retry once flagged = %v, want ErrWithdrawalManual", err)
+	}
+	if rows, _, _ := db.FindUndisbursedWithdrawals(ctx, 30*time.Minute, 10, 0); len(rows) != 2 || rows[1]["manual_resolution"] != true {
+		t.Errorf("stuck = %v, want the flagged withdrawal still listed", rows)
+	}
+}
+
+func TestWithdrawalRetryLateCallbackIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "withdrawals", "withdrawal_queue_ke", "withdrawal_retries")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (reference, msisdn, amount, status, disburse, date_created)
+		VALUES ('W_RACE', '254700000001', 500, $1, 'Failed', NOW() - INTERVAL '2 hours')`, status.WithdrawalProcessed)
+
+	// The success callback holds the row while the retry is asked for
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `UPDATE "withdrawals" SET disburse = '0', transaction_id = 'TX1' WHERE reference = 'W_RACE'`); err != nil {
+		t.Fatal(err)
+	}
+	retried := make(chan error, 1)
+	go func() {
+		_, err := db.RetryWithdrawal(ctx, "W_RACE", "ops", 3, 0)
+		retried <- err
+	}()
+	select {
+	case err := <-retried:
+		t.Fatalf("retry returned %v while the callback held the row", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-retried; !errors.Is(err, ErrWithdrawalDisbursed) {
+		t.Errorf("retry behind a success callback = %v, want ErrWithdrawalDisbursed", err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawal_queue_ke" WHERE reference = 'W_RACE'`); n != 0 {
+		t.Errorf("%d queue rows, want the paid withdrawal left alone", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "withdrawals" WHERE reference = 'W_RACE' AND disburse = '0' AND disburse_retries = 0`); n != 1 {
+		t.Error("the callback's status must stand")
+	}
+
+	// A callback after the retry lands on the requeued row
+	dbtest.Exec(t, pool, `UPDATE "withdrawals" SET disburse = 'Failed' WHERE reference = 'W_RACE'`)
+	if _, err := db.RetryWithdrawal(ctx, "W_RACE", "ops", 3, 0); err != nil {
+		t.Fatal(err)
+	}
+	w, err := db.UpdatePawaBoxKeWithdrawalDisburse(ctx, "TX2", "0", "paid", "W_RACE")
+	if err != nil || w == nil {
+		t.Fatalf("callback after the retry = %v, %v", w, err)
+	}
+	if _, err := db.RetryWithdrawal(ctx, "W_RACE", "ops", 3, 0); !errors.Is(err, ErrWithdrawalDisbursed) {
+		t.Errorf("retry after the callback = %v, want ErrWithdrawalDisbursed", err)
+	}
+}
+
+func TestBusinessDaySQLIntegration(t *testing.T) {
+	_, pool := openIntegration(t)
+	ctx := context.Background()
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+	// A session in UTC still buckets by the Nairobi day
+	if _, err := conn.Exec(ctx, `SET TIME ZONE 'UTC'`); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(ctx, `RESET TIME ZONE`)
+
+	var before, after, started time.Time
+	err = conn.QueryRow(ctx, `SELECT `+dayOf("$1::timestamptz")+`, `+dayOf("$2::timestamptz")+`, `+startOfToday(),
+		time.Date(2026, 3, 31, 20, 59, 0, 0, time.UTC), time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC)).
+		Scan(&before, &after, &started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.Format("2006-01-02") != "2026-03-31" || after.Format("2006-01-02") != "2026-04-01" {
+		t.Errorf("23:59 is on %s and 00:01 on %s, want 31 March and 1 April", before.Format("2006-01-02"), after.Format("2006-01-02"))
+	}
+	if !started.Equal(clock.Today()) {
+		t.Errorf("the business day started at %v, want %v", started, clock.Today())
+	}
+}
+
+func TestFeatureFlagsIntegration(t *testing.T) {
+	db, _ := openIntegration(t, "feature_flags")
+	ctx := context.Background()
+	if err := db.SetFeatureFlag(ctx, "response_v2", true, 5, []string{"254700000001"}, "ops"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetFeatureFlag(ctx, "response_v2", false, 20, []string{}, "lead"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := db.ListFeatureFlags(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("flags = %v, want the one flag updated in place", rows)
+	}
+	f := rows[0]
+	list, ok := f["allowlist"].([]interface{})
+	if f["enabled"] != false || utils.ToInt(f["percentage"]) != 20 || !ok || len(list) != 0 || f["updated_by"] != "lead" {
+		t.Errorf("flag = %v, want the second write", f)
+	}
+}
+
+func TestCheckGamesConfigIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Games", "awards", "jackpot_kitty")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Games" (id, name, name_init, category, status, boxes, bet_amount, max_win,
+			min_stake, max_stake, allowed_stakes, marketing_copy, is_jackpot) VALUES
+		(1, 'PawaBox', 'pw', 'Money Prize', 'active', '7', 20, 3000000, NULL, NULL, NULL, NULL, FALSE),
+		(2, 'Supa', 'pawa_supa', 'Car Prize', 'active', '5', 50, 1500000, 10, 500, NULL, 'SHINDA GARI!', TRUE),
+		(3, 'Spin', 'spin', 'Money Prize', 'active', NULL, 20, 100000, NULL, NULL, '{50,20,20}', NULL, FALSE),
+		(4, 'Old', 'old', 'Money Prize', 'inactive', '7', 20, 100000, NULL, NULL, NULL, NULL, FALSE)`)
+	dbtest.Exec(t, pool, `INSERT INTO "awards" (name, name_init, value, status) VALUES
+		('Smart TV', 'pw', 25000, 'active'), ('Car', 'pw', 900000, 'active'), ('Phone', 'pw', 15000, 'active'),
+		('Radio', 'pw', 2000, 'active'), ('Yacht', 'pw', 5000000, 'inactive'), ('Bike', 'pawa_supa', 80000, 'active')`)
+	dbtest.Exec(t, pool, `INSERT INTO "jackpot_kitty" (name_init, item_name, kitty, cost, pct_slice) VALUES
+		('pawa_supa', 'Car', 120000, 900000, 50), ('pawa_supa', 'Bike', 5000, 80000, 50), ('pw', 'TV', 999, 25000, 100)`)
+
+	games, err := db.CheckGames(ctx, "all", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 3 {
+		t.Fatalf("games = %v, want the 3 active ones", games)
+	}
+	byID := map[string]map[string]interface{}{}
+	for _, g := range games {
+		byID[utils.ToString(g["id"])] = g
+	}
+
+	pw := byID["1"]
+	if got := fmt.Sprint(pw["prize_preview"]); got != "[Car Smart TV Phone]" {
+		t.Errorf("preview = %s, want the 3 most valuable active awards", got)
+	}
+	if pw["jackpot_kitty"] != nil || pw["marketing_copy"] != "" || pw["min_stake"] != nil {
+		t.Errorf("PawaBox = %v, want no teaser, copy or stake range", pw)
+	}
+	supa := byID["2"]
+	if supa["jackpot_kitty"] != 125000.0 || supa["marketing_copy"] != "SHINDA GARI!" || fmt.Sprint(supa["prize_preview"]) != "[Bike]" {
+		t.Errorf("Supa = %v, want its kitties summed, its copy and its one award", supa)
+	}
+	if supa["min_stake"] != 10.0 || supa["max_stake"] != 500.0 {
+		t.Errorf("Supa stakes = %v – %v, want 10 – 500", supa["min_stake"], supa["max_stake"])
+	}
+	spin := byID["3"]
+	if got := fmt.Sprint(spin["allowed_stakes"]); got != "[50 20 20]" || fmt.Sprint(spin["prize_preview"]) != "[]" {
+		t.Errorf("Spin = %v, want its stakes as stored and an empty preview", spin)
+	}
+
+	if games, err := db.CheckGames(ctx, "Car Prize", 1); err != nil || len(games) != 1 || utils.ToString(games[0]["id"]) != "2" {
+		t.Errorf("Car Prize = %v, %v, want Supa alone", games, err)
+	}
+}
+
+func TestInboundCallbackQueueIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "inbound_callbacks")
+	ctx := context.Background()
+	payload := []byte(`{"reference":"REF1","transaction_id":"TX1","status":"0"}`)
+
+	id, inserted, err := db.InsertInboundCallback(ctx, "settle_bt", "REF1", "TX1", payload)
+	if err != nil || !inserted {
+		t.Fatalf("insert = %d, %t, %v", id, inserted, err)
+	}
+	again, inserted, err := db.InsertInboundCallback(ctx, "settle_bt", "REF1", "TX1", payload)
+	if err != nil || inserted || again != id {
+		t.Errorf("re-delivery = %d, %t, %v, want the stored row %d", again, inserted, err, id)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "inbound_callbacks"`); n != 1 {
+		t.Errorf("%d rows, want one per transaction", n)
+	}
+
+	row, err := db.ClaimInboundCallback(ctx, id, time.Minute)
+	if err != nil || row == nil || utils.ToInt(row["attempts"]) != 1 || !strings.Contains(utils.ToString(row["payload"]), `"TX1"`) {
+		t.Fatalf("claim = %v, %v, want the payload on attempt 1", row, err)
+	}
+	// Leased: neither claimable again nor due
+	if row, err := db.ClaimInboundCallback(ctx, id, time.Minute); err != nil || row != nil {
+		t.Errorf("second claim = %v, %v, want nothing while leased", row, err)
+	}
+	if rows, err := db.ClaimDueInboundCallbacks(ctx, 20, time.Minute); err != nil || len(rows) != 0 {
+		t.Errorf("due = %v, %v, want nothing while leased", rows, err)
+	}
+
+	// The process died: once the lease runs out the row is due again
+	dbtest.Exec(t, pool, `UPDATE "inbound_callbacks" SET next_attempt_at = NOW() - INTERVAL '1 second' WHERE id = $1`, id)
+	rows, err := db.ClaimDueInboundCallbacks(ctx, 20, time.Minute)
+	if err != nil || len(rows) != 1 || utils.ToInt(rows[0]["attempts"]) != 2 {
+		t.Fatalf("due = %v, %v, want the row on attempt 2", rows, err)
+	}
+
+	if err := db.RecordInboundCallback(ctx, id, "failed", time.Now(), "deadlock detected"); err != nil {
+		t.Fatal(err)
+	}
+	failed, total, err := db.ListInboundCallbacks(ctx, "failed", 20, 0)
+	if err != nil || total != 1 || len(failed) != 1 || failed[0]["last_error"] != "deadlock detected" || failed[0]["processed_at"] != nil {
+		t.Fatalf("failed = %v, %d, %v", failed, total, err)
+	}
+	if prev, err := db.RequeueInboundCallback(ctx, id); err != nil || prev != "failed" {
+		t.Fatalf("requeue = %q, %v", prev, err)
+	}
+	row, err = db.ClaimInboundCallback(ctx, id, time.Minute)
+	if err != nil || row == nil || utils.ToInt(row["attempts"]) != 1 {
+		t.Fatalf("claim after requeue = %v, %v, want attempts reset", row, err)
+	}
+
+	if err := db.RecordInboundCallback(ctx, id, "processed", time.Now(), ""); err != nil {
+		t.Fatal(err)
+	}
+	if prev, err := db.RequeueInboundCallback(ctx, id); err != nil || prev != "processed" {
+		t.Errorf("requeue of a processed callback = %q, %v, want it left alone", prev, err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "inbound_callbacks" WHERE status = 'processed' AND processed_at IS NOT NULL`); n != 1 {
+		t.Errorf("%d processed rows, want the callback processed", n)
+	}
+	if prev, err := db.RequeueInboundCallback(ctx, id+1); err != nil || prev != "" {
+		t.Errorf("requeue of an unknown callback = %q, %v", prev, err)
+	}
+}
+
+func TestBalanceSnapshotsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Basket", "BasketLogs", "HouseIncome", "HouseIncomeLogs", "basket_snapshots", "house_snapshots")
+	ctx := context.Background()
+	dbtest.Exec(t, pool, `INSERT INTO "Basket" (amount) VALUES (1000)`)
+	dbtest.Exec(t, pool, `INSERT INTO "HouseIncome" (house_income, total_bets, total_wins, total_losses) VALUES (400, 5000, 3000, 1600)`)
+	dbtest.Exec(t, pool, `INSERT INTO "BasketLogs" (credit, debit, date_created) VALUES
+		(100, NULL, NOW()), (NULL, 250, NOW()), (999, 999, NOW() - INTERVAL '2 days')`)
+	dbtest.Exec(t, pool, `INSERT INTO "HouseIncomeLogs" (house_income, total_bets, total_wins, total_losses, date_created) VALUES
+		(30, NULL, NULL, NULL, NOW()), (NULL, 200, NULL, NULL, NOW()), (NULL, NULL, 120, 50, NOW()),
+		(999, 999, 999, 999, NOW() - INTERVAL '2 days')`)
+
+	first, err := db.UpsertBalanceSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first["basket"] != 1000.0 || first["basket_credit"] != 100.0 || first["basket_debit"] != 250.0 ||
+		first["house_income"] != 400.0 || first["total_losses"] != 1600.0 || first["day_house_income"] != 30.0 ||
+		first["day_bets"] != 200.0 || first["day_wins"] != 120.0 || first["day_losses"] != 50.0 {
+		t.Errorf("snapshot = %v, want the balances and only today's log sums", first)
+	}
+
+	// Taken again the same day: the one row is overwritten
+	dbtest.Exec(t, pool, `UPDATE "Basket" SET amount = 900`)
+	dbtest.Exec(t, pool, `INSERT INTO "BasketLogs" (credit) VALUES (100)`)
+	again, err := db.UpsertBalanceSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again["day"] != first["day"] || again["basket"] != 900.0 || again["basket_credit"] != 200.0 {
+		t.Errorf("second snapshot = %v, want today's row updated", again)
+	}
+	for _, table := range []string{"basket_snapshots", "house_snapshots"} {
+		if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "`+table+`"`); n != 1 {
+			t.Errorf("%d rows in %s, want one per day", n, table)
+		}
+	}
+
+	// A week, the house snapshot missing on one day
+	dbtest.Exec(t, pool, `DELETE FROM "basket_snapshots"`)
+	dbtest.Exec(t, pool, `DELETE FROM "house_snapshots"`)
+	dbtest.Exec(t, pool, `INSERT INTO "basket_snapshots" (day, amount, credit, debit)
+		SELECT d, 1000 + 100 * EXTRACT(DAY FROM d), 50, 150 FROM generate_series('2026-03-01'::date, '2026-03-07', '1 day') d`)
+	dbtest.Exec(t, pool, `INSERT INTO "house_snapshots" (day, house_income, total_bets, total_wins, total_losses)
+		SELECT d, 40 * EXTRACT(DAY FROM d), 0, 0, 0 FROM generate_series('2026-03-01'::date, '2026-03-07', '1 day') d
+		WHERE d <> '2026-03-04'`)
+
+	loc := clock.Location()
+	rows, err := db.GetBalanceSnapshots(ctx, time.Date(2026, 3, 2, 0, 0, 0, 0, loc), time.Date(2026, 3, 5, 23, 59, 59, 0, loc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var days []string
+	for _, row := range rows {
+		days = append(days, utils.ToString(row["day"]))
+	}
+	if strings.Join(days, ",") != "2026-03-02,2026-03-03,2026-03-04,2026-03-05" {
+		t.Fatalf("days = %v, want the 2nd to the 5th in order", days)
+	}
+	if rows[0]["basket"] != 1200.0 || rows[0]["house_income"] != 80.0 {
+		t.Errorf("2026-03-02 = %v", rows[0])
+	}
+	if rows[2]["basket"] != 1400.0 || rows[2]["house_income"] != nil {
+		t.Errorf("2026-03-04 = %v, want the basket without a house snapshot", rows[2])
+	}
+}
+
+func TestBetThrottleIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "bet_throttle", "deposit", "Player")
+	ctx := context.Background()
+	const msisdn = "254700000001"
+
+	if ok, _, err := db.AdmitBet(ctx, msisdn, time.Hour, 0); err != nil || !ok {
+		t.Fatalf("first bet = %t, %v, want admitted", ok, err)
+	}
+	ok, row, err := db.AdmitBet(ctx, msisdn, time.Hour, 0)
+	if err != nil || ok || row == nil || utils.ToInt(row["window_count"]) != 1 {
+		t.Fatalf("bet within the cooldown = %t, %v, %v, want refused with the stored window", ok, row, err)
+	}
+	if _, ok := row["now"].(time.Time); !ok {
+		t.Errorf("row = %v, want the database's now", row)
+	}
+
+	// The rate alone: two a minute, with no cooldown
+	const other = "254700000002"
+	for i := 0; i < 2; i++ {
+		if ok, _, err := db.AdmitBet(ctx, other, 0, 2); err != nil || !ok {
+			t.Fatalf("bet %d = %t, %v", i+1, ok, err)
+		}
+	}
+	if ok, row, err := db.AdmitBet(ctx, other, 0, 2); err != nil || ok || utils.ToInt(row["window_count"]) != 2 {
+		t.Errorf("third bet in the minute = %t, %v, %v, want refused and not counted", ok, row, err)
+	}
+	dbtest.Exec(t, pool, `UPDATE "bet_throttle" SET window_start = NOW() - INTERVAL '61 seconds' WHERE msisdn = $1`, other)
+	if ok, _, err := db.AdmitBet(ctx, other, 0, 2); err != nil || !ok {
+		t.Errorf("bet in a new minute = %t, %v, want admitted", ok, err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT window_count FROM "bet_throttle" WHERE msisdn = $1`, other); n != 1 {
+		t.Errorf("window_count = %d, want the new window counting 1", n)
+	}
+
+	// The loss streak's start, and the deposits made during it
+	dbtest.SeedPlayer(t, pool, msisdn, 100)
+	var id int64
+	if err := pool.QueryRow(ctx, `SELECT id FROM "Player" WHERE msisdn = $1`, msisdn).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.UpdateUserLossCount(ctx, 10, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	player, err := db.CheckUser(ctx, msisdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	since, ok := Player(player).LostSince()
+	if !ok || time.Since(since) > time.Minute {
+		t.Fatalf("lost_since = %v, want the streak's start", player["lost_since"])
+	}
+	dbtest.Exec(t, pool, `INSERT INTO "deposit" (msisdn, amount, date_created) VALUES
+		($1, 50, NOW() - INTERVAL '1 hour'), ($1, 50, NOW()), ($1, 50, NOW()), ($2, 50, NOW())`, msisdn, other)
+	if n, err := db.CountDepositsSince(ctx, msisdn, since); err != nil || n != 2 {
+		t.Errorf("deposits in the streak = %d, %v, want 2", n, err)
+	}
+	if _, err := db.UpdateRESTLossUser(ctx, 50, id); err != nil {
+		t.Fatal(err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Player" WHERE id = $1 AND lost_count = 0 AND lost_since IS NULL`, id); n != 1 {
+		t.Error("a win did not end the loss streak")
+	}
+}
+
+func TestSearchIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Player", "Bets", "deposit_requests", "withdrawals", "admin_audit_log")
+	ctx := context.Background()
+	const msisdn = "254700000001"
+	dbtest.SeedPlayer(t, pool, msisdn, 480)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (reference, transaction_id, msisdn, amount, status) VALUES
+		('BET_STK1', 'SBK4XYZ12A', $1, 20, 'success'), ('', 'OTHER12345', $1, 5, 'failed')`, msisdn)
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (reference, parcel_reference, msisdn, amount, result_status, win_amount, date_created) VALUES
+		('BET_STK1', NULL, $1, 20, 'Win', 500, NOW() - INTERVAL '1 minute'),
+		('BET_P1', 'PCL_9', $1, 10, 'Loss', 0, NOW()), ('BET_P2', 'PCL_9', $1, 10, 'Loss', 0, NOW()),
+		('', NULL, '254700000002', 10, 'Loss', 0, NOW())`, msisdn)
+	dbtest.Exec(t, pool, `INSERT INTO "withdrawals" (reference, transaction_id, msisdn, amount, tax_amount, status) VALUES
+		('BET_STK1', 'TGH7QWE45R', $1, 500, 100, 'processed')`, msisdn)
+
+	player, err := db.SearchPlayer(ctx, msisdn)
+	if err != nil || player == nil || player.Balance != 480 || player.DateCreated == nil {
+		t.Fatalf("player = %+v, %v", player, err)
+	}
+	if player, err := db.SearchPlayer(ctx, "254799999999"); err != nil || player != nil {
+		t.Errorf("no such player = %+v, %v, want nil", player, err)
+	}
+	bets, err := db.SearchPlayerBets(ctx, msisdn, 2)
+	if err != nil || len(bets) != 2 || bets[0].ParcelReference != "PCL_9" {
+		t.Errorf("latest bets = %+v, %v, want the parcel's two, limited", bets, err)
+	}
+
+	// The chain, key by key
+	deposits, err := db.SearchDepositsByKey(ctx, []string{"SBK4XYZ12A"}, 50)
+	if err != nil || len(deposits) != 1 || deposits[0].Reference != "BET_STK1" {
+		t.Fatalf("deposits by transaction id = %+v, %v", deposits, err)
+	}
+	if deposits, err := db.SearchDepositsByKey(ctx, []string{""}, 50); err != nil || len(deposits) != 0 {
+		t.Errorf("deposits by an empty reference = %+v, %v, want none", deposits, err)
+	}
+	if bets, err := db.SearchBetsByKey(ctx, []string{"BET_STK1"}, 50); err != nil || len(bets) != 1 || bets[0].WinAmount != 500 {
+		t.Errorf("bets by reference = %+v, %v", bets, err)
+	}
+	if bets, err := db.SearchBetsByKey(ctx, []string{"PCL_9", ""}, 50); err != nil || len(bets) != 2 {
+		t.Errorf("bets by parcel = %+v, %v, want both boxes and no unreferenced bet", bets, err)
+	}
+	withdrawals, err := db.SearchWithdrawalsByKey(ctx, []string{"TGH7QWE45R"}, 50)
+	if err != nil || len(withdrawals) != 1 || withdrawals[0].Reference != "BET_STK1" || withdrawals[0].TaxAmount != 100 {
+		t.Errorf("withdrawals by transaction id = %+v, %v", withdrawals, err)
+	}
+
+	if err := db.LogAdminAccess(ctx, "support1", "search", "0700000001", []string{msisdn}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.LogAdminAccess(ctx, "support1", "search", "BET_NONE", nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "admin_audit_log" WHERE admin = 'support1' AND $1 = ANY(msisdns)`, msisdn); n != 1 {
+		t.Errorf("%d audit rows show %s, want 1", n, msisdn)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "admin_audit_log" WHERE msisdns = '{}'`); n != 1 {
+		t.Errorf("%d audit rows with no players, want 1", n)
+	}
+}
+
+func TestOTPPlaintextGraceIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "verification", "dbQueue")
+	ctx := context.Background()
+	const msisdn = "254700000001"
+	now := time.Now().Unix()
+	since := now - 3600
+
+	// A row from before hashing, one past the grace, and a hashed one
+	dbtest.Exec(t, pool, `INSERT INTO verification (msisdn, purpose, code, expired, created) VALUES
+		($1, 'login', '4321', $2, $3), ($1, 'withdraw', '8765', $2, $4)`, msisdn, now+300, now-60, since-60)
+	if _, err := db.InsertVerification(ctx, msisdn, "reset", "hash-1", now+300, now); err != nil {
+		t.Fatal(err)
+	}
+
+	guesses := []struct {
+		purpose string
+		guess   OTPGuess
+		ok      bool
+	}{
+		{"login", OTPGuess{Hash: "no-such-hash", Code: "4321", PlaintextSince: since}, true},
+		{"login", OTPGuess{Hash: "no-such-hash", Code: "1111", PlaintextSince: since}, false},
+		{"withdraw", OTPGuess{Hash: "no-such-hash", Code: "8765", PlaintextSince: since}, false},
+		{"reset", OTPGuess{Hash: "hash-1", PlaintextSince: since}, true},
+		{"reset", OTPGuess{Hash: "hash-2", Code: "", PlaintextSince: since}, false},
+	}
+	for _, g := range guesses {
+		row, err := db.GetOTPChecked(ctx, msisdn, g.purpose, g.guess)
+		if err != nil || (row != nil) != g.ok {
+			t.Errorf("%s %+v = %v, %v, want found %t", g.purpose, g.guess, row, err, g.ok)
+		}
+		if row, err := db.GetOTPVerified(ctx, msisdn, g.purpose, g.guess, now); err != nil || (row != nil) != g.ok {
+			t.Errorf("verified %s %+v = %v, %v, want found %t", g.purpose, g.guess, row, err, g.ok)
+		}
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM verification WHERE purpose = 'reset' AND code IS NULL AND code_hash = 'hash-1'`); n != 1 {
+		t.Error("a new code was stored with its plaintext")
+	}
+
+	// The purge clears plaintext past the grace, and old OTP message text
+	dbtest.Exec(t, pool, `INSERT INTO "dbQueue" ("Destination", "Message", "MessageTimeStamp", command) VALUES
+		($1, 'Your code is 8765', NOW() - INTERVAL '2 hours', 'otp'), ($1, 'Your code is 4321', NOW(), 'otp'),
+		($1, 'You won', NOW() - INTERVAL '2 hours', 'result')`, msisdn)
+	cleared, err := db.PurgeOTPPlaintext(ctx, time.Unix(since, 0))
+	if err != nil || cleared != 2 {
+		t.Fatalf("purge = %d, %v, want the old code and the old OTP text", cleared, err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM verification WHERE code IS NOT NULL`); n != 1 {
+		t.Errorf("%d plaintext codes left, want the one within the grace", n)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "dbQueue" WHERE "Message" <> ''`); n != 2 {
+		t.Errorf("%d messages with text, want the new OTP and the result", n)
+	}
+}
+
+func TestCreateBetOncePerReferenceIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "Bets")
+	ctx := context.Background()
+
+	// Processors of one round racing to its bet: the first insert wins
+	const processors = 8
+	created := make(chan bool, processors)
+	var wg sync.WaitGroup
+	for i := 0; i < processors; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := db.CreateBet(ctx, "254700000001", "1", 20, "", "BET_TWICE", status.ResultPending, "normal", "1", "PawaBox", "ussd")
+			if err != nil {
+				t.Error(err)
+			}
+			created <- ok
+		}()
+	}
+	wg.Wait()
+	close(created)
+	wins := 0
+	for ok := range created {
+		if ok {
+			wins++
+		}
+	}
+	if wins != 1 {
+		t.Errorf("%d inserts created the bet, want 1", wins)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "Bets" WHERE reference = 'BET_TWICE'`); n != 1 {
+		t.Errorf("%d rows for the reference, want 1", n)
+	}
+	if played, err := db.BetExists(ctx, "BET_TWICE"); err != nil || !played {
+		t.Errorf("BetExists = %t, %v, want true", played, err)
+	}
+	if played, err := db.BetExists(ctx, "BET_OTHER"); err != nil || played {
+		t.Errorf("BetExists for another reference = %t, %v, want false", played, err)
+	}
+
+	// Bets without a reference are not arbitrated
+	for i := 0; i < 2; i++ {
+		if ok, err := db.CreateBet(ctx, "254700000001", "1", 20, "", "", status.ResultPending, "normal", "1", "PawaBox", "ussd"); err != nil || !ok {
+			t.Errorf("unreferenced bet %d = %t, %v, want created", i+1, ok, err)
+		}
+	}
+}
+
+func TestDeliveryOrderIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "dbQueue", "webhook_deliveries", "webhook_events", "webhook_subscriptions", "Player")
+	ctx := context.Background()
+
+	// SMS rows keep the sequence their flow stamped, whatever the insert order
+	late, err := db.InsertIntoSMSQueue(ctx, "254700000001", "You won", "LuckyNumber", "game_response", 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	early, err := db.InsertIntoSMSQueue(ctx, "254700000001", "Deposit received", "LuckyNumber", "deposit", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var first int64
+	if err := pool.QueryRow(ctx, `SELECT "RecordID" FROM "dbQueue" WHERE "Destination" = $1
+		ORDER BY "Sequence", "RecordID" LIMIT 1`, "254700000001").Scan(&first); err != nil {
+		t.Fatal(err)
+	}
+	if first != early || first == late {
+		t.Errorf("drainer order starts at %d, want the deposit confirmation %d", first, early)
+	}
+
+	// Webhooks: a player's next event waits for the one before it
+	dbtest.Exec(t, pool, `INSERT INTO "Player" (msisdn, promocode) VALUES ('254700000001', 'PARTNER'), ('254700000002', 'PARTNER')`)
+	if _, err := db.CreateWebhookSubscription(ctx, "PARTNER", "https://partner.example/hook", "secret", []string{"bet_settled"}, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, msisdn := range []string{"254700000001", "254700000001", "254700000002"} {
+		if n, err := db.EnqueueWebhookEvent(ctx, "bet_settled", msisdn, []byte(`{}`)); err != nil || n != 1 {
+			t.Fatalf("enqueue for %s = %d, %v", msisdn, n, err)
+		}
+	}
+	claim := func() []int64 {
+		t.Helper()
+		rows, err := db.ClaimWebhookEvents(ctx, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, row := range rows {
+			ids = append(ids, utils.ToInt64(row["id"]))
+		}
+		return ids
+	}
+	ids := claim()
+	if len(ids) != 2 {
+		t.Fatalf("claimed %v, want each player's first event", ids)
+	}
+	var held int64
+	if err := pool.QueryRow(ctx, `SELECT MAX(id) FROM "webhook_events" WHERE msisdn = '254700000001'`).Scan(&held); err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(ids, held) {
+		t.Errorf("claimed %v, want %d held behind the player's first event", ids, held)
+	}
+
+	// Still held while the first is pending its retry, due the moment it is delivered
+	for _, id := range ids {
+		if err := db.RecordWebhookDelivery(ctx, id, 1, 500, "server error", time.Millisecond, "pending", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dbtest.Exec(t, pool, `UPDATE "webhook_events" SET status = 'delivered' WHERE id <> $1 AND msisdn = '254700000002'`, held)
+	if again := claim(); len(again) != 1 || again[0] == held {
+		t.Errorf("claimed %v, want only the first event's retry", again)
+	}
+	dbtest.Exec(t, pool, `UPDATE "webhook_events" SET status = 'delivered' WHERE id <> $1`, held)
+	if next := claim(); len(next) != 1 || next[0] != held {
+		t.Errorf("claimed %v after delivery, want %d", next, held)
+	}
+}
+
+func TestOpenRoundsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "deposit_requests", "stk_results", "Bets", "bet_reveals")
+	ctx := context.Background()
+	const m = "254700000001"
+	old := time.Now().Add(-2 * time.Hour)
+	dbtest.Exec(t, pool, `INSERT INTO "deposit_requests" (reference, msisdn, amount, status, selected_box, game_cat_id, date_created) VALUES
+		('D_AWAIT', $1, 20, NULL, '3', '1', NOW() - interval '1 minute'),
+		('D_PAID', $1, 50, 'success', '2', '1', NOW() - interval '2 minutes'),
+		('D_STKFAIL', $1, 20, NULL, '1', '1', NOW()),
+		('D_FAILED', $1, 20, 'fail', '1', '1', NOW()),
+		('D_PLAYED', $1, 20, 'success', '1', '1', NOW()),
+		('D_NOBOX', $1, 20, NULL, NULL, '1', NOW()),
+		('D_OLD', $1, 20, NULL, '1', '1', $2),
+		('D_OTHER', '254700000002', 20, NULL, '1', '1', NOW())`, m, old)
+	dbtest.Exec(t, pool, `INSERT INTO "stk_results" (reference, status) VALUES ('D_STKFAIL', 'fail'), ('D_AWAIT', 'pending')`)
+	dbtest.Exec(t, pool, `INSERT INTO "Bets" (reference, msisdn, amount, selected_number, result_status, date_created) VALUES
+		('D_PLAYED', $1, 20, '1', 'Loss', NOW()),
+		('B_PLAY', $1, 10, '4', 'Pending', NOW() - interval '30 seconds'),
+		('B_REVEAL', $1, 20, '5', 'Win', NOW() - interval '3 minutes'),
+		('B_REVEALED', $1, 20, '5', 'Win', NOW()),
+		('B_OLD', $1, 10, '4', 'Pending', $2)`, m, old)
+	for ref, at := range map[string]time.Time{"B_REVEAL": time.Now().Add(time.Hour), "B_REVEALED": time.Now().Add(-time.Second)} {
+		if err := db.CreateBetReveal(ctx, ref, m, []byte(`{}`), nil, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since := time.Now().Add(-30 * time.Minute)
+	deposits, err := db.ListOpenDeposits(ctx, m, since, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range deposits {
+		got = append(got, d.Reference+":"+d.Status)
+	}
+	if want := []string{"D_AWAIT:", "D_PAID:success"}; !slices.Equal(got, want) {
+		t.Errorf("open deposits = %v, want %v", got, want)
+	}
+	bets, err := db.ListOpenBets(ctx, m, since, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bets) != 2 || bets[0].Reference != "B_PLAY" || bets[0].RevealAt != nil ||
+		bets[1].Reference != "B_REVEAL" || bets[1].RevealAt == nil || bets[1].SelectedBox != "5" {
+		t.Errorf("open bets = %+v, want B_PLAY playing then B_REVEAL held", bets)
+	}
+	if bets, err = db.ListOpenBets(ctx, m, since, 1); err != nil || len(bets) != 1 {
+		t.Errorf("limit 1 = %+v, %v", bets, err)
+	}
+}
+
+func TestTaxRatesIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "tax_rates", "game_rounds", "tax_record")
+	ctx := context.Background()
+	from := time.Now().Add(-time.Hour).Truncate(time.Second)
+	dbtest.Exec(t, pool, `INSERT INTO "tax_rates" (tax_type, rate, effective_from) VALUES
+		('excise', 15, $1), ('excise', 20, $2), ('withholding', 25, $2)`, from.Add(-24*time.Hour), from)
+
+	at := func(when time.Time) map[string]float64 {
+		t.Helper()
+		rates, err := db.TaxRatesAt(ctx, when)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rates
+	}
+	if got := at(from.Add(-time.Microsecond)); fmt.Sprint(got) != "map[excise:15]" {
+		t.Errorf("just before = %v, want the old excise and no withholding row", got)
+	}
+	if got := at(from); fmt.Sprint(got) != "map[excise:20 withholding:25]" {
+		t.Errorf("at effective_from = %v, want the new rates", got)
+	}
+
+	// A round keeps the rates it opened with when a later one takes effect
+	if err := db.CreateRound(ctx, "BET_TAX1", "254700000001", "1", 20, "game", ""); err != nil {
+		t.Fatal(err)
+	}
+	dbtest.Exec(t, pool, `INSERT INTO "tax_rates" (tax_type, rate, effective_from) VALUES ('excise', 30, NOW())`)
+	if rates, err := db.RoundTaxRates(ctx, "BET_TAX1"); err != nil || fmt.Sprint(rates) != "map[excise:20 withholding:25]" {
+		t.Errorf("round rates = %v, %v, want those at its opening", rates, err)
+	}
+	if rates, err := db.RoundTaxRates(ctx, "BET_NONE"); err != nil || len(rates) != 0 {
+		t.Errorf("no round = %v, %v, want no rates", rates, err)
+	}
+
+	if _, err := db.InsertTaxQueue(ctx, "BET_TAX1", 20, 3.33, 16.67, 20, "excise", "254700000001"); err != nil {
+		t.Fatal(err)
+	}
+	if n := dbtest.CountRows(t, pool, `SELECT COUNT(*) FROM "tax_record" WHERE game_id = 'BET_TAX1' AND rate = 20`); n != 1 {
+		t.Errorf("%d tax records carry the rate, want 1", n)
+	}
+
+	// Only rates still to come can change
+	future := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	id, err := db.InsertTaxRate(ctx, "withholding", 18, future, "admin1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.InsertTaxRate(ctx, "withholding", 19, future, "admin1"); !errors.Is(err, ErrTaxRateExists) {
+		t.Errorf("same start twice = %v, want ErrTaxRateExists", err)
+	}
+	if n, err := db.UpdateTaxRate(ctx, id, 17, future.Add(time.Hour), "admin2"); err != nil || n != 1 {
+		t.Errorf("update a future rate = %d, %v", n, err)
+	}
+	if n, err := db.UpdateTaxRate(ctx, 1, 10, future, "admin2"); err != nil || n != 0 {
+		t.Errorf("update a rate in effect = %d, %v, want nothing changed", n, err)
+	}
+	if n, err := db.DeleteTaxRate(ctx, 1); err != nil || n != 0 {
+		t.Errorf("delete a rate in effect = %d, %v, want nothing removed", n, err)
+	}
+	if n, err := db.DeleteTaxRate(ctx, id); err != nil || n != 1 {
+		t.Errorf("delete a future rate = %d, %v", n, err)
+	}
+}
+
+func TestDepositReviewsIntegration(t *testing.T) {
+	db, _ := openIntegration(t, "deposit_reviews")
+	ctx := context.Background()
+
+	for i, want := range []bool{true, false} {
+		inserted, err := db.InsertDepositReview(ctx, "settle_bet", "QK1", "REF1", "254700000001", 200000, "deposit_above_max")
+		if err != nil || inserted != want {
+			t.Fatalf("delivery %d = %t, %v, want %t", i+1, inserted, err, want)
+		}
+	}
+	if _, err := db.InsertDepositReview(ctx, "settle_bt", "QK2", "REF2", "254700000001", 20.5, "deposit_not_whole"); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, total, err := db.ListDepositReviews(ctx, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(rows) != 1 || rows[0]["transaction_id"] != "QK2" || rows[0]["amount"] != 20.5 {
+		t.Errorf("first page = %v of %d, want QK2 of 2", rows, total)
+	}
+}
+
+func TestSettingsIntegration(t *testing.T) {
+	db, pool := openIntegration(t, "PawaBox_KeSettings")
+	ctx := context.Background()
+	if st, err := db.GetSettings(ctx); err != nil || st != nil {
+		t.Fatalf("no row = %+v, %v, want nil", st, err)
+	}
+	if n, err := db.UpdateSettings(ctx, Settings{DefaultRTP: 85}); err != nil || n != 0 {
+		t.Errorf("update with no row = %d, %v, want 0", n, err)
+	}
+
+	// NUMERIC columns come back as their values, an unset one as 0
+	dbtest.Exec(t, pool, `INSERT INTO "PawaBox_KeSettings" (default_rtp, adjustmentable_rtp, vig_percentage, withholding, excise_duty, min_win_multipier, max_win_multipier, min_loss_count)
+		VALUES (85.5, 5, 10, 20, 12.5, 1, 10, 3)`)
+	st, err := db.GetSettings(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.DefaultRTP != 85.5 || st.AdjustableRTP != 5 || st.ExciseDuty != 12.5 || st.MinLossCount != 3 || st.JackpotPercentage != 0 ||
+		st.MinDeposit != 10 || st.MaxDeposit != 150000 || st.RoundDeposits {
+		t.Errorf("settings = %+v", st)
+	}
+
+	st.DefaultRTP, st.MaxDeposit, st.RoundDeposits = 90, 70000, true
+	if n, err := db.UpdateSettings(ctx, *st); err != nil || n != 1 {
+		t.Fatalf("update = %d, %v", n, err)
+	}
+	if again, err := db.GetSettings(ctx); err != nil || *again != *st {
+		t.Errorf("read back = %+v, %v, want %+v", again, err, *st)
+	}
+}
@@ -0,0 +1,15 @@
+package database
+
+import "context"
+
+// JackpotRepo reads the jackpot ledger and which games feed which kitty.
+// Contributions and payouts are written by UpdateJackpotKit,
+// UpdateJackpotKitNameInit and UpdateJackpotKity in the same statement that
+// moves the kitty.
+type JackpotRepo interface {
+	GetJackpotReconciliation(ctx context.Context) ([]map[string]interface{}, error)
+	ListJackpotGames(ctx context.Context) ([]map[string]interface{}, error)
+	ListJackpotKitties(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+var _ JackpotRepo = (*Database)(nil)
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// kpiTable stands in for the kpi table and its unique index on date. day
+// is the database's business day, which may run ahead of the process.
+type kpiTable struct {
+	mu        sync.Mutex
+	day       string
+	handle    map[string]float64
+	inserts   int
+	insertErr error
+	noInsert  bool // the insert silently creates nothing
+}
+
+func (k *kpiTable) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if strings.HasPrefix(sql, `INSERT INTO "kpi"`) {
+		k.inserts++
+		if k.insertErr != nil {
+			return pgconn.CommandTag{}, k.insertErr
+		}
+		if _, ok := k.handle[k.day]; ok || k.noInsert {
+			return pgconn.NewCommandTag("INSERT 0 0"), nil
+		}
+		k.handle[k.day] = 0
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	}
+	if _, ok := k.handle[k.day]; !ok {
+		return pgconn.NewCommandTag("UPDATE 0"), nil
+	}
+	k.handle[k.day] += args[0].(float64)
+	return pgconn.NewCommandTag("UPDATE 1"), nil
+}
+
+const kpiUpdate = `UPDATE "kpi" SET handle = handle + $1`
+
+func resetKPIDay(date string) {
+	kpiDay.mu.Lock()
+	kpiDay.date = date
+	kpiDay.mu.Unlock()
+}
+
+func TestExecKPIFirstBetsOfTheDayCreateOneRow(t *testing.T) {
+	defer resetKPIDay("")
+	resetKPIDay("")
+	today := clock.Now().Format("2006-01-02")
+	table := &kpiTable{day: today, handle: map[string]float64{}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := execKPI(context.Background(), table, kpiUpdate, 1.0); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(table.handle) != 1 || table.handle[today] != 50 {
+		t.Errorf("kpi rows = %v, want one row for %s holding all 50 bets", table.handle, today)
+	}
+
+	// Once the day is seen, updates go straight to the row
+	inserts := table.inserts
+	execKPI(context.Background(), table, kpiUpdate, 1.0)
+	if table.inserts != inserts {
+		t.Errorf("an update on a seen day upserted again")
+	}
+}
+
+func TestExecKPIDatabaseRolledOverFirst(t *testing.T) {
+	defer resetKPIDay("")
+	today := clock.Now().Format("2006-01-02")
+	resetKPIDay(today)
+	// The database has already moved on to a day without a row
+	table := &kpiTable{day: "next", handle: map[string]float64{today: 10}}
+
+	n, err := execKPI(context.Background(), table, kpiUpdate, 5.0)
+	if err != nil || n != 1 {
+		t.Fatalf("execKPI = %d, %v; want the update retried on the new row", n, err)
+	}
+	if table.handle["next"] != 5 || table.handle[today] != 10 {
+		t.Errorf("kpi rows = %v, want 5 on the new day and yesterday untouched", table.handle)
+	}
+}
+
+func TestExecKPIFailures(t *testing.T) {
+	defer resetKPIDay("")
+
+	resetKPIDay("")
+	boom := errors.New("boom")
+	table := &kpiTable{day: "d", handle: map[string]float64{}, insertErr: boom}
+	if _, err := execKPI(context.Background(), table, kpiUpdate, 1.0); !errors.Is(err, boom) {
+		t.Errorf("failed upsert = %v, want it returned", err)
+	}
+
+	resetKPIDay("")
+	table = &kpiTable{day: "d", handle: map[string]float64{}, noInsert: true}
+	if _, err := execKPI(context.Background(), table, kpiUpdate, 1.0); !errors.Is(err, ErrKPIRowMissing) {
+		t.Errorf("update that never lands = %v, want ErrKPIRowMissing", err)
+	}
+}
+
+func TestExecKPIRollsOverAtNairobiMidnight(t *testing.T) {
+	defer resetKPIDay("")
+	defer clock.ConfigureSource(nil)
+	resetKPIDay("")
+	table := &kpiTable{day: "2026-03-31", handle: map[string]float64{}}
+
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 20, 59, 0, 0, time.UTC) }) // 23:59 in Nairobi
+	if _, err := execKPI(context.Background(), table, kpiUpdate, 1.0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 00:01 in Nairobi, still 31 March in UTC: the process moves to the new
+	// row itself, before any update misses
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC) })
+	table.day = "2026-04-01"
+	if _, err := execKPI(context.Background(), table, kpiUpdate, 2.0); err != nil {
+		t.Fatal(err)
+	}
+	if table.handle["2026-03-31"] != 1 || table.handle["2026-04-01"] != 2 || table.inserts != 2 {
+		t.Errorf("kpi rows = %v after %d inserts, want 1 on 31 March and 2 on 1 April", table.handle, table.inserts)
+	}
+	if kpiDay.date != "2026-04-01" {
+		t.Errorf("kpi day = %s, want 2026-04-01", kpiDay.date)
+	}
+}
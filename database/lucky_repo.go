@@ -0,0 +1,175 @@
+package database
+
+import (
+	"context"
+	"fiberapp/status"
+	"time"
+)
+
+// ParcelBet is one box of a multi-box bet
+type ParcelBet struct {
+	Stake
+	Box string
+}
+
+// DisbursedWithdrawal is the withdrawal a disbursement callback updated
+type DisbursedWithdrawal struct {
+	Msisdn    string
+	Amount    float64
+	Reference string
+}
+
+// LuckyRepo is everything the PawaBox/lucky number service needs: players,
+// bets, games, KPI, house/basket accounting, deposits and withdrawals.
+type LuckyRepo interface {
+	SharedRepo
+	AdminRepo
+	CampaignRepo
+	TemplateRepo
+	TokenRepo
+	SessionRepo
+	BonusRepo
+	WebhookRepo
+	ProfileRepo
+	DeletionRepo
+	FreeBetRepo
+	ShortcodeRepo
+	BasketRepo
+	MaintenanceRepo
+	RoundRepo
+	IdempotencyRepo
+	ReportRepo
+	RevealRepo
+	DecisionRepo
+	JackpotRepo
+	AuditRepo
+	STKRetryRepo
+	WithdrawalRetryRepo
+	WithdrawalRepo
+	FlagRepo
+	InboundCallbackRepo
+	SnapshotRepo
+	BetThrottleRepo
+	SearchRepo
+	OpenRoundRepo
+	TaxRateRepo
+	DepositReviewRepo
+	SettingsRepo
+
+	GetOnlineUsers(ctx context.Context) ([]map[string]interface{}, error)
+	CheckUserAttempted(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	CheckSelfExclusion(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	CheckPromoCode(ctx context.Context, promo string) (map[string]interface{}, error)
+	CheckTransaction(ctx context.Context, transactionID string) (map[string]interface{}, error)
+	UpdateUserAviatorBalInfoLucky(ctx context.Context, amount float64, msisdn, name string) (int64, error)
+	UpdateUserMsisdn(ctx context.Context, msisdn, newmsisdn string) (int64, error)
+	UpdatePlayerSelf(ctx context.Context, msisdn string, hrs string) error
+	UpdateSelfExclusion(ctx context.Context, msisdn string) error
+	UpdateUserProfilePic(ctx context.Context, msisdn, filename string) (int64, error)
+	TransferBalance(ctx context.Context, from, to string, amount float64, reference string) (float64, float64, error)
+	CheckDepositRequestLucky(ctx context.Context, reference string) (map[string]interface{}, error)
+	GetDepositStatus(ctx context.Context, reference string) (map[string]interface{}, error)
+	ReverseDeposit(ctx context.Context, transactionID, reversalReference, description string, allowNegative bool) (map[string]interface{}, bool, error)
+	CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	CheckHistory(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error)
+	CheckGameHistory(ctx context.Context, msisdn string, startDate, endDate time.Time, offset, pageSize string) ([]map[string]interface{}, float64, error)
+	CheckWithdrawal(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error)
+	GetRecentWinners(ctx context.Context, limit int, minAmount float64, gameCatID string) ([]map[string]interface{}, error)
+	CheckDeposits(ctx context.Context, msisdn string, startDate, endDate time.Time) ([]map[string]interface{}, error)
+	CheckBets(ctx context.Context, msisdn string) ([]map[string]interface{}, error)
+	CheckBettoBet(ctx context.Context, msisdn string) ([]map[string]interface{}, error)
+	CheckJackpotWinnerKitty(ctx context.Context, msisdn string) ([]map[string]interface{}, error)
+	UpdateKPI(ctx context.Context) (int64, error)
+	UpdateJackpotKit(ctx context.Context, reference string, mvalue float64) (int64, error)
+	UpdateJackpotKitNameInit(ctx context.Context, reference string, mvalue float64, nameInit string) (int64, error)
+	UpdateJackpotKity(ctx context.Context, id int, reference string) (int64, error)
+	UpdatePlayerRestLossJackpot(ctx context.Context, cost float64, id int) (int64, error)
+	UpdateJackpotKitUpdate(ctx context.Context, id int) (int64, error)
+	UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error)
+	CheckSettingKPI(ctx context.Context) (map[string]interface{}, error)
+	UpdateKPIPayouts(ctx context.Context, mvalue, withTaxAmount, exciseTaxAmount float64) (int64, error)
+	UpdateKPIPayoutSPIN(ctx context.Context, exciseTaxAmount float64) (int64, error)
+	UpdateKPIRTP(ctx context.Context) (int64, error)
+	UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error)
+	UpdateKPIFreeBetStake(ctx context.Context, stake float64) (int64, error)
+	UpdateKPIChannelHandle(ctx context.Context, channel string, mvalue float64) (int64, error)
+	UpdateKPIChannelPayout(ctx context.Context, channel string, mvalue float64) (int64, error)
+	AddGameDailyExposure(ctx context.Context, gameCatID string, mvalue float64) (float64, error)
+	GetGameDailyExposure(ctx context.Context, gameCatID string) (float64, error)
+	UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64, error)
+	ReverseKPIDeposit(ctx context.Context, transactionID string, mvalue float64) (int64, error)
+	CheckGames(ctx context.Context, category string, previewAwards int) ([]map[string]interface{}, error)
+	GetGame(ctx context.Context, catID string) (*Game, error)
+	GetGameCategories(ctx context.Context) ([]string, error)
+	CheckSetting(ctx context.Context) (map[string]interface{}, error)
+	UpdateUserLucky(ctx context.Context, msisdn string) (int64, error)
+	UpdateUserLuckyFree(ctx context.Context, msisdn string) (int64, error)
+	UpdateUser(ctx context.Context, name string, mvalue interface{}, id int64) (int64, error)
+	UpdateUserRTP(ctx context.Context, amount float64, id int64) (int64, error)
+	UpdateUserLossCount(ctx context.Context, mvalue float64, id int64) (int64, error)
+	UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error)
+	CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference string, betStatus status.ResultStatus, betType, gameCatID, gameName, channel string) (bool, error)
+	BetExists(ctx context.Context, reference string) (bool, error)
+	CreateParcelBets(ctx context.Context, msisdn, parcel string, bets []ParcelBet, betType, gameCatID, gameName, channel string) error
+	RequestSelfExlusion(ctx context.Context, msisdn string, hrs int) (int64, error)
+	UpdateLuckyBet(ctx context.Context, result, game, reference string, betStatus status.ResultStatus) (int64, error)
+	UpdateLuckyBetWin(ctx context.Context, result, game, reference string, winAmount float64, betStatus status.ResultStatus) (int64, error)
+	CreateUser(ctx context.Context, carrier, msisdn string, name string, my_promocode string, promocode string) (int64, error)
+	CreatePromo(ctx context.Context, msisdn string, promocode string) (int64, error)
+	CreateUserAttempted(ctx context.Context, msisdn string, new_msisdn string, expiresAt time.Time) (int64, error)
+	GetUserAttempted(ctx context.Context, msisdn string) (map[string]interface{}, error)
+	DeleteUserAttempted(ctx context.Context, msisdn string) (int64, error)
+	CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error)
+	CheckBasketLucky(ctx context.Context) (map[string]interface{}, error)
+	CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error)
+	CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error)
+	InsertHouseBasketLogs(ctx context.Context, credit, debit, mvalue float64, narrative string) (int64, error)
+	CheckHousePawaBoxKe(ctx context.Context) (map[string]interface{}, error)
+	UpdateAviatorDepositRequestLucky(ctx context.Context, transactionID, reference, description string) (int64, error)
+	InsertIntoDepositLuckyRequestBonus(ctx context.Context, depositType, ussd, game, carrier string, gameCatID string, amount float64, msisdn, selectedBox, reference, channel string) (int64, error)
+	InsertIntoDepositLuckyRequestComplete(
+		ctx context.Context,
+		transactionID, description, game, carrier, channel, gameCatID string,
+		amount float64,
+		msisdn, selectedBox, reference string,
+	) (int64, error)
+	CreateDepositRecordLucky(ctx context.Context, msisdn string, amount float64, transactionID, shortcode, name, reference, depositType string) (int64, error)
+	UpdateHousePawaBoxKeBasket(ctx context.Context, mvalue float64) (int64, error)
+	UpdateHousePawaBoxKeHouse(ctx context.Context, mvalue float64) (int64, error)
+	UpdateHouseLucyNumberHouseCurrentRTP(ctx context.Context) (int64, error)
+	UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error)
+	DisburseWithdrawals(ctx context.Context, amount float64, msisdn, reference string) (int64, error)
+	InsertIntoWithdrawalsLucky(ctx context.Context, nonAmount, amount, withholdTax float64, items string, msisdn, reference string) (int64, error)
+	InsertIntoJackPotWinners(ctx context.Context, taxAmount float64, items string, gameID string, gameName, jackpotCategory string, kittyID string, amount float64, msisdn string) (int64, error)
+	InsertIntoPendingWithdrawalsLucky(ctx context.Context, amount, taxAmount float64, items, msisdn, reference string) (int64, error)
+	CheckWithdrawalsPawaBoxKe(ctx context.Context, reference string) (map[string]interface{}, error)
+	CheckDepositRequestLuckyFailed(ctx context.Context, reference string) (map[string]interface{}, error)
+	InsertIntoDepositLuckyRequest(
+		ctx context.Context,
+		ussd, game, carrier string,
+		gameCatID string,
+		amount float64,
+		msisdn, selectedBox, reference, channel string,
+	) (int64, error)
+	InsertSTK(ctx context.Context, game, carrier, reference, msisdn string, amount float64, shortcode string) (int64, error)
+	InsertWithdrawalQueue(ctx context.Context, reference, msisdn string, amount float64, callback string) (int64, error)
+	InsertCustomerLogsPawaBoxKeWithID(ctx context.Context, amount float64, logType string, customerID int64, narrative, reference string) (int64, error)
+	UpdateHouseLuckyWins(ctx context.Context, mvalue float64) (int64, error)
+	UpdateHouseLuckyBasketWins(ctx context.Context, mvalue float64) (bool, error)
+	UpdateRESTLossUser(ctx context.Context, payout float64, id int64) (int64, error)
+	InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error)
+	UpdatePawaBoxKeWithdrawalRequest(ctx context.Context, reference string) (int64, error)
+	UpdateHouseLuckyHouseLosses(ctx context.Context, mvalue float64) (int64, error)
+	UpdatePawaBoxKeWithdrawalB2BDisburse(ctx context.Context, transactionID, disburse, description, reference string) (bool, error)
+	UpdatePawaBoxKeWithdrawalDisburseMotto(ctx context.Context, transactionID, disburse, description, reference string) (bool, error)
+	UpdatePawaBoxKeWithdrawalDisburse(ctx context.Context, transactionID, disburse, description, reference string) (*DisbursedWithdrawal, error)
+	UpdateAviatorDepositFailRequestLucky(ctx context.Context, reference, description string) (int64, error)
+	UpdateAviatorDepositFailRequestLuckySTK(ctx context.Context, reference, description string) (int64, error)
+	InsertCustomerLogsPawaBoxKe(ctx context.Context, amount float64, logType string, customerID string, narrative, reference string) (int64, error)
+	InsertHouseLogsPawaBoxKeGameID(ctx context.Context, gameID string, fieldName, msisdn string, mvalue float64) (int64, error)
+	InsertB2BWithdrawalB2B(ctx context.Context, reference, msisdn string, amount float64, betStatus status.B2BStatus) (int64, error)
+	InsertSpinResult(ctx context.Context, playerID, spinID string, drums []byte, stake, winAmount, balance int64, isWin bool) (int64, error)
+	InsertSpinWinLine(ctx context.Context, spinResultID int64, lineNumber int, symbol string, count int, payout int64, positions []byte) (int64, error)
+}
+
+var _ LuckyRepo = (*Database)(nil)
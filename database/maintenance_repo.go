@@ -0,0 +1,11 @@
+package database
+
+import "context"
+
+// MaintenanceRepo holds the admin switches that pause betting and deposits
+type MaintenanceRepo interface {
+	SetMaintenanceSwitch(ctx context.Context, scope, gameCatID string, bettingEnabled, depositsEnabled bool, message, admin string) error
+	ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error)
+}
+
+var _ MaintenanceRepo = (*Database)(nil)
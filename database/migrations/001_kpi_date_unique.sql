@@ -0,0 +1,4 @@
+-- One kpi row per day. Required by the ON CONFLICT (date) upsert in
+-- database.UpdateKPI / execKPI. Remove existing duplicates before applying:
+--   DELETE FROM "kpi" a USING "kpi" b WHERE a.date = b.date AND a.id > b.id;
+CREATE UNIQUE INDEX IF NOT EXISTS kpi_date_unique ON "kpi" (date);
@@ -0,0 +1,32 @@
+-- Deposit campaigns ("deposit 100 get 2 free bets") and their redemptions.
+-- The unique (campaign_id, transaction_id) index makes a retried deposit
+-- callback unable to grant the same reward twice.
+CREATE TABLE IF NOT EXISTS "campaigns" (
+    id                       BIGSERIAL PRIMARY KEY,
+    name                     TEXT        NOT NULL,
+    min_deposit              NUMERIC     NOT NULL,
+    reward_type              TEXT        NOT NULL CHECK (reward_type IN ('free_bet', 'bonus')),
+    reward_amount            NUMERIC     NOT NULL CHECK (reward_amount > 0),
+    reward_validity_hours    INTEGER     NOT NULL DEFAULT 24,
+    start_date               TIMESTAMPTZ NOT NULL,
+    end_date                 TIMESTAMPTZ NOT NULL,
+    max_redemptions_per_user INTEGER     NOT NULL DEFAULT 1,
+    status                   TEXT        NOT NULL DEFAULT 'active',
+    date_created             TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (end_date > start_date)
+);
+
+CREATE TABLE IF NOT EXISTS "campaign_redemptions" (
+    id             BIGSERIAL PRIMARY KEY,
+    campaign_id    BIGINT      NOT NULL REFERENCES "campaigns" (id),
+    msisdn         TEXT        NOT NULL,
+    transaction_id TEXT        NOT NULL,
+    reward_type    TEXT        NOT NULL,
+    reward_amount  NUMERIC     NOT NULL,
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS campaign_redemptions_txn_unique
+    ON "campaign_redemptions" (campaign_id, transaction_id);
+CREATE INDEX IF NOT EXISTS campaign_redemptions_user
+    ON "campaign_redemptions" (campaign_id, msisdn);
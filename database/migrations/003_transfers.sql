@@ -0,0 +1,19 @@
+-- Player-to-player wallet transfers. Each transfer also writes a
+-- transfer_out and a transfer_in row to "CustomerLogs" sharing the reference.
+CREATE TABLE IF NOT EXISTS "transfers" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT        NOT NULL UNIQUE,
+    sender       TEXT        NOT NULL,
+    recipient    TEXT        NOT NULL,
+    amount       NUMERIC     NOT NULL CHECK (amount > 0),
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (sender <> recipient)
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_date
+    ON "transfers" (sender, date_created);
+
+-- Per-sender daily caps; 0 disables a cap
+ALTER TABLE "PawaBox_KeSettings"
+    ADD COLUMN IF NOT EXISTS transfer_daily_limit NUMERIC NOT NULL DEFAULT 10000,
+    ADD COLUMN IF NOT EXISTS transfer_daily_count INTEGER NOT NULL DEFAULT 5;
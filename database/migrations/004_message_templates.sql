@@ -0,0 +1,14 @@
+-- SMS copy editable without a deploy. A missing or inactive row falls back
+-- to the compiled-in default for that key.
+CREATE TABLE IF NOT EXISTS "message_templates" (
+    id           BIGSERIAL PRIMARY KEY,
+    key          TEXT        NOT NULL,
+    language     TEXT        NOT NULL,
+    body         TEXT        NOT NULL,
+    active       BOOLEAN     NOT NULL DEFAULT TRUE,
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (key, language)
+);
+
+-- Preferred SMS language; NULL uses the default (sw)
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS language TEXT;
@@ -0,0 +1,16 @@
+-- Device-bound refresh tokens issued after OTP verification. Only the
+-- SHA-256 of a token is stored. Each refresh rotates the token; presenting
+-- a rotated (revoked) token again revokes every token of that player.
+CREATE TABLE IF NOT EXISTS "refresh_tokens" (
+    id           BIGSERIAL PRIMARY KEY,
+    token_hash   TEXT        NOT NULL UNIQUE,
+    msisdn       TEXT        NOT NULL,
+    device_id    TEXT        NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ,
+    replaced_by  BIGINT REFERENCES "refresh_tokens" (id),
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_msisdn
+    ON "refresh_tokens" (msisdn) WHERE revoked_at IS NULL;
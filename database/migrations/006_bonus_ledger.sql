@@ -0,0 +1,41 @@
+-- Bonus wallet ledger. "Player".bonus is kept equal to the sum of the
+-- player's active grant balances. A grant converts to cash once the stakes
+-- counted against it reach wagering_required; a grant that expires first is
+-- forfeited, however much of the requirement was met.
+CREATE TABLE IF NOT EXISTS "bonus_grants" (
+    id                BIGSERIAL PRIMARY KEY,
+    msisdn            TEXT        NOT NULL,
+    amount            NUMERIC     NOT NULL CHECK (amount > 0),
+    balance           NUMERIC     NOT NULL CHECK (balance >= 0),
+    wagering_required NUMERIC     NOT NULL CHECK (wagering_required >= 0),
+    wagered           NUMERIC     NOT NULL DEFAULT 0,
+    status            TEXT        NOT NULL DEFAULT 'active', -- active, converted, expired
+    source            TEXT        NOT NULL,
+    reference         TEXT,
+    converted_amount  NUMERIC,
+    expires_at        TIMESTAMPTZ NOT NULL,
+    date_created      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    date_closed       TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS bonus_grants_active
+    ON "bonus_grants" (msisdn, expires_at) WHERE status = 'active';
+
+-- Which wallet paid each stake. The bonus share of a win goes back to
+-- grant_id; bonus_win records it so a replayed settlement is not credited twice.
+CREATE TABLE IF NOT EXISTS "bet_funding" (
+    reference    TEXT        PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    cash_amount  NUMERIC     NOT NULL DEFAULT 0,
+    bonus_amount NUMERIC     NOT NULL DEFAULT 0,
+    grant_id     BIGINT REFERENCES "bonus_grants" (id),
+    bonus_win    NUMERIC,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Bonuses granted before the ledger existed carry no wagering requirement
+INSERT INTO "bonus_grants" (msisdn, amount, balance, wagering_required, source, expires_at)
+SELECT p.msisdn, p.bonus, p.bonus, 0, 'legacy', COALESCE(p.bonus_expiry, NOW() + INTERVAL '7 days')
+FROM "Player" p
+WHERE COALESCE(p.bonus, 0) > 0
+  AND NOT EXISTS (SELECT 1 FROM "bonus_grants" g WHERE g.msisdn = p.msisdn);
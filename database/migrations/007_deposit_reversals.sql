@@ -0,0 +1,30 @@
+-- M-Pesa deposit reversals. One row per reversed transaction doubles as the
+-- audit trail and the idempotency key for repeated notifications.
+CREATE TABLE IF NOT EXISTS "deposit_reversals" (
+    id                 BIGSERIAL PRIMARY KEY,
+    reversal_reference TEXT        NOT NULL UNIQUE,
+    transaction_id     TEXT        NOT NULL UNIQUE,
+    msisdn             TEXT        NOT NULL,
+    amount             NUMERIC     NOT NULL,
+    clawed_back        NUMERIC     NOT NULL,
+    debt               NUMERIC     NOT NULL DEFAULT 0,
+    bet_reference      TEXT,
+    bet_result         TEXT,
+    bet_win_amount     NUMERIC,
+    description        TEXT,
+    date_created       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Amounts a reversal could not claw back because the balance was too low
+CREATE TABLE IF NOT EXISTS "player_debts" (
+    id           BIGSERIAL PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    amount       NUMERIC     NOT NULL CHECK (amount > 0),
+    reason       TEXT        NOT NULL,
+    reference    TEXT        NOT NULL,
+    settled_at   TIMESTAMPTZ,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS player_debts_open
+    ON "player_debts" (msisdn) WHERE settled_at IS NULL;
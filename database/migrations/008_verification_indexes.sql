@@ -0,0 +1,7 @@
+-- GetOTPChecked and GetOTPVerified look codes up by (msisdn, code), and
+-- GetOTPChecked also filters on status; without this index both scan the
+-- whole table once it grows. The expired index serves the batched
+-- PurgeExpiredVerifications job. On a large live table, build them with
+-- CREATE INDEX CONCURRENTLY outside a transaction instead.
+CREATE INDEX IF NOT EXISTS verification_lookup ON verification (msisdn, code, status);
+CREATE INDEX IF NOT EXISTS verification_expired ON verification (expired);
@@ -0,0 +1,47 @@
+-- Partner webhooks. A subscription receives events for the players who
+-- signed up with its partner_id as their promocode ("Player".promocode).
+CREATE TABLE IF NOT EXISTS "webhook_subscriptions" (
+    id           BIGSERIAL PRIMARY KEY,
+    partner_id   TEXT        NOT NULL,
+    target_url   TEXT        NOT NULL,
+    secret       TEXT        NOT NULL,
+    event_types  TEXT[]      NOT NULL,
+    active       BOOLEAN     NOT NULL DEFAULT TRUE,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    deleted_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_partner
+    ON "webhook_subscriptions" (partner_id) WHERE deleted_at IS NULL;
+
+-- Outbox of events per subscription. Rows stay pending across restarts
+-- until delivered or failed after webhooks.max_attempts.
+CREATE TABLE IF NOT EXISTS "webhook_events" (
+    id              BIGSERIAL PRIMARY KEY,
+    subscription_id BIGINT      NOT NULL REFERENCES "webhook_subscriptions" (id),
+    event_type      TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending', -- pending, delivered, failed
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error      TEXT,
+    date_created    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    date_delivered  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_events_due
+    ON "webhook_events" (next_attempt_at) WHERE status = 'pending';
+
+-- One row per delivery attempt, for the admin delivery log
+CREATE TABLE IF NOT EXISTS "webhook_deliveries" (
+    id           BIGSERIAL PRIMARY KEY,
+    event_id     BIGINT      NOT NULL REFERENCES "webhook_events" (id),
+    attempt      INT         NOT NULL,
+    status_code  INT,
+    error        TEXT,
+    duration_ms  BIGINT      NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_event ON "webhook_deliveries" (event_id);
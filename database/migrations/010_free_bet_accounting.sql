@@ -0,0 +1,6 @@
+-- Free-bet stakes are house money, not handle. playGame books them here
+-- instead of kpi.bet / kpi.handle, HouseIncomeLogs.total_bets and excise.
+ALTER TABLE "kpi" ADD COLUMN IF NOT EXISTS free_bet_count BIGINT  NOT NULL DEFAULT 0;
+ALTER TABLE "kpi" ADD COLUMN IF NOT EXISTS free_bet_stake NUMERIC NOT NULL DEFAULT 0;
+
+ALTER TABLE "HouseIncomeLogs" ADD COLUMN IF NOT EXISTS free_bet_stake NUMERIC;
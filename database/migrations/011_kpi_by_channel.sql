@@ -0,0 +1,11 @@
+-- Per-channel daily totals kept beside "kpi", so handle and payout can be
+-- split by web / ussd / app. Rows are upserted as bets settle; days before
+-- this table existed are not backfilled.
+CREATE TABLE IF NOT EXISTS "kpi_by_channel" (
+    date       DATE    NOT NULL,
+    channel    TEXT    NOT NULL,
+    handle     NUMERIC NOT NULL DEFAULT 0,
+    payout     NUMERIC NOT NULL DEFAULT 0,
+    bet_count  BIGINT  NOT NULL DEFAULT 0,
+    PRIMARY KEY (date, channel)
+);
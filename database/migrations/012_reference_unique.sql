@@ -0,0 +1,9 @@
+-- Bet and deposit references must be unique: settlement and
+-- UpdateLuckyBetWin look rows up by reference. CreateBet and
+-- InsertIntoDepositLuckyRequest report a violation as ErrDuplicateReference
+-- and the caller retries with a new reference. Find existing duplicates
+-- before applying:
+--   SELECT reference, count(*) FROM "Bets" GROUP BY reference HAVING count(*) > 1;
+--   SELECT reference, count(*) FROM "deposit_requests" GROUP BY reference HAVING count(*) > 1;
+CREATE UNIQUE INDEX IF NOT EXISTS bets_reference_unique ON "Bets" (reference) WHERE reference <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS deposit_requests_reference_unique ON "deposit_requests" (reference) WHERE reference <> '';
@@ -0,0 +1,3 @@
+-- Player opt-out for non-transactional SMS (win and loss results). OTPs,
+-- deposits, reversals and transfers are always sent.
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS sms_notifications BOOLEAN NOT NULL DEFAULT TRUE;
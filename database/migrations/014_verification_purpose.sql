@@ -0,0 +1,7 @@
+-- What an OTP was sent for. GetOTPChecked and GetOTPVerified match on it,
+-- so a login code cannot confirm a transfer, deletion or self exclusion.
+-- Codes issued before this migration count as login codes.
+ALTER TABLE verification ADD COLUMN IF NOT EXISTS purpose TEXT NOT NULL DEFAULT 'login';
+
+DROP INDEX IF EXISTS verification_lookup;
+CREATE INDEX IF NOT EXISTS verification_lookup ON verification (msisdn, purpose, code, status);
@@ -0,0 +1,14 @@
+-- Display order of game categories in /lucky_games. The category list
+-- itself comes from the active "Games" rows; a category missing here sorts
+-- after the listed ones, alphabetically.
+CREATE TABLE IF NOT EXISTS "category_order" (
+    category TEXT PRIMARY KEY,
+    position INT  NOT NULL
+);
+
+INSERT INTO "category_order" (category, position) VALUES
+    ('Money Prize', 1),
+    ('Car Prize', 2),
+    ('Bike Prize', 3),
+    ('JackPot', 4)
+ON CONFLICT (category) DO NOTHING;
@@ -0,0 +1,10 @@
+-- Delivery reports from the SMS gateway, posted to /sms_dlr. A final status
+-- (DELIVERED, FAILED, REJECTED, EXPIRED) is never overwritten by a late one.
+ALTER TABLE "dbQueue" ADD COLUMN IF NOT EXISTS delivery_status TEXT;
+ALTER TABLE "dbQueue" ADD COLUMN IF NOT EXISTS delivery_description TEXT;
+ALTER TABLE "dbQueue" ADD COLUMN IF NOT EXISTS delivery_updated_at TIMESTAMPTZ;
+
+-- OTP resends through /resend_otp. A code reissued after expiry replaces
+-- the old row (status = 2) and carries its resend_count over.
+ALTER TABLE verification ADD COLUMN IF NOT EXISTS resend_count INT NOT NULL DEFAULT 0;
+ALTER TABLE verification ADD COLUMN IF NOT EXISTS last_sent BIGINT NOT NULL DEFAULT 0;
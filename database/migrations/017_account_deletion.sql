@@ -0,0 +1,11 @@
+-- Account deletion. /delete_user marks the player pending_deletion; once
+-- limits.deletion_retention has passed the deletion job replaces the msisdn
+-- everywhere with an anonymous token, clears the name and picture and sets
+-- active_status = 'deleted'. A player with money in flight is skipped and
+-- deletion_blocked says why.
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS deletion_requested_at TIMESTAMPTZ;
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS deletion_blocked TEXT;
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS player_pending_deletion
+    ON "Player" (deletion_requested_at) WHERE active_status = 'pending_deletion';
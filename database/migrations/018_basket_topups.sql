@@ -0,0 +1,11 @@
+-- Admin top-ups of the prize basket. The "Basket" balance moves in the same
+-- transaction; each row records who added how much, why, and the balance it
+-- left behind.
+CREATE TABLE IF NOT EXISTS "basket_topups" (
+    id            BIGSERIAL PRIMARY KEY,
+    amount        NUMERIC     NOT NULL CHECK (amount > 0),
+    balance_after NUMERIC     NOT NULL,
+    admin         TEXT        NOT NULL,
+    note          TEXT        NOT NULL DEFAULT '',
+    date_created  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
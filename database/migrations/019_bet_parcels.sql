@@ -0,0 +1,6 @@
+-- Multi-box bets. Each box of a parcel is its own "Bets" row under its own
+-- reference; parcel_reference ties the rows of one request together.
+ALTER TABLE "Bets" ADD COLUMN IF NOT EXISTS parcel_reference TEXT;
+
+CREATE INDEX IF NOT EXISTS bets_parcel_reference
+    ON "Bets" (parcel_reference) WHERE parcel_reference IS NOT NULL;
@@ -0,0 +1,14 @@
+-- Access tokens (JWTs) by their jti claim. JWTMiddleware rejects a token
+-- whose row is revoked or missing, so logout, self-exclusion, account
+-- deletion and an admin can end a session before the token expires. Rows
+-- are only needed until expires_at.
+CREATE TABLE IF NOT EXISTS "access_tokens" (
+    jti          TEXT PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    revoked_at   TIMESTAMPTZ,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS access_tokens_msisdn
+    ON "access_tokens" (msisdn) WHERE revoked_at IS NULL;
@@ -0,0 +1,19 @@
+-- Replay protection for place_bet_pawabox and initiate_deposit. A client
+-- key (Idempotency-Key or client_request_id) keeps the first response so a
+-- retry gets it back; without one, an "auto:" key derived from the request
+-- blocks an identical request inside the duplicate window. Rows past
+-- expires_at are free to be claimed again and are purged.
+CREATE TABLE IF NOT EXISTS "idempotency_keys" (
+    msisdn       TEXT        NOT NULL,
+    route        TEXT        NOT NULL,
+    key          TEXT        NOT NULL,
+    request_hash TEXT        NOT NULL,
+    status_code  INT,
+    response     BYTEA,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (msisdn, route, key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at
+    ON "idempotency_keys" (expires_at);
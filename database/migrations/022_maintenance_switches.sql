@@ -0,0 +1,14 @@
+-- Operational switches an admin flips to pause betting or deposits without
+-- a redeploy. scope 'global' (game_cat_id '') covers every game and
+-- deposits; scope 'game' pauses betting on one game category. A missing
+-- row means enabled. Settlement callbacks and withdrawals ignore these.
+CREATE TABLE IF NOT EXISTS "maintenance_switches" (
+    scope            TEXT        NOT NULL CHECK (scope IN ('global', 'game')),
+    game_cat_id      TEXT        NOT NULL DEFAULT '',
+    betting_enabled  BOOLEAN     NOT NULL DEFAULT TRUE,
+    deposits_enabled BOOLEAN     NOT NULL DEFAULT TRUE,
+    message          TEXT        NOT NULL DEFAULT '',
+    updated_by       TEXT        NOT NULL DEFAULT '',
+    date_updated     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, game_cat_id)
+);
@@ -0,0 +1,29 @@
+-- A round follows one reference from the STK push or stake debit to the
+-- payout. state only moves along created -> funded -> played -> settled ->
+-- paid, or to failed from any state before paid; every move is kept in
+-- game_round_events with its time and actor. References already in "Bets"
+-- or "deposit_requests" map 1:1 to rounds, so nothing is backfilled.
+CREATE TABLE IF NOT EXISTS "game_rounds" (
+    reference    TEXT PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    game_cat_id  TEXT        NOT NULL DEFAULT '',
+    amount       NUMERIC     NOT NULL DEFAULT 0,
+    state        TEXT        NOT NULL
+        CHECK (state IN ('created', 'funded', 'played', 'settled', 'paid', 'failed')),
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS game_rounds_msisdn ON "game_rounds" (msisdn, date_created);
+
+CREATE TABLE IF NOT EXISTS "game_round_events" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT        NOT NULL REFERENCES "game_rounds" (reference) ON DELETE CASCADE,
+    from_state   TEXT,
+    to_state     TEXT        NOT NULL,
+    actor        TEXT        NOT NULL,
+    detail       TEXT        NOT NULL DEFAULT '',
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS game_round_events_reference ON "game_round_events" (reference, id);
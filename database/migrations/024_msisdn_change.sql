@@ -0,0 +1,10 @@
+-- Pending phone number changes. A row holds new_msisdn for one player
+-- until expires_at: the unique index on new_msisdn stops two players
+-- claiming the same number, and a player has one pending change at a time.
+-- Rows from before this migration expire at once and are dropped.
+ALTER TABLE "Attempted_Players" ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+DELETE FROM "Attempted_Players" WHERE expires_at <= NOW();
+
+CREATE UNIQUE INDEX IF NOT EXISTS attempted_players_new_msisdn ON "Attempted_Players" (new_msisdn);
+CREATE UNIQUE INDEX IF NOT EXISTS attempted_players_msisdn ON "Attempted_Players" (msisdn);
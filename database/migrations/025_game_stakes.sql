@@ -0,0 +1,15 @@
+-- Stake rules per game. A game with allowed_stakes takes one of those
+-- amounts; otherwise one with min_stake or max_stake takes any whole
+-- amount in that range; otherwise only bet_amount, as before. Spin games
+-- accepted any stake until now; give them the amounts their app offered:
+--   UPDATE "Games" SET allowed_stakes = '{20,30,40,50,100}' WHERE id = <spin game>;
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS min_stake NUMERIC;
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS max_stake NUMERIC;
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS allowed_stakes NUMERIC[];
+
+ALTER TABLE "Games" DROP CONSTRAINT IF EXISTS games_stake_range;
+ALTER TABLE "Games" ADD CONSTRAINT games_stake_range CHECK (
+    (min_stake IS NULL OR min_stake > 0)
+    AND (max_stake IS NULL OR max_stake > 0)
+    AND (min_stake IS NULL OR max_stake IS NULL OR min_stake <= max_stake)
+);
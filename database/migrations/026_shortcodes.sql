@@ -0,0 +1,23 @@
+-- Paybill shortcodes, one per marketing campaign. An STK push goes out on
+-- the shortcode of the campaign the client names, else the one assigned to
+-- its channel, else the default one, else limits.default_shortcode.
+-- Deposit callbacks on a shortcode missing here are still settled and
+-- reported as unknown.
+CREATE TABLE IF NOT EXISTS "shortcodes" (
+    shortcode    TEXT        PRIMARY KEY,
+    label        TEXT        NOT NULL,
+    campaign     TEXT        UNIQUE,
+    channel      TEXT        CHECK (channel IN ('web', 'ussd', 'app')),
+    is_default   BOOLEAN     NOT NULL DEFAULT FALSE,
+    active       BOOLEAN     NOT NULL DEFAULT TRUE,
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- At most one active shortcode per channel, and one active default
+CREATE UNIQUE INDEX IF NOT EXISTS shortcodes_channel_unique
+    ON "shortcodes" (channel) WHERE active AND channel IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS shortcodes_default_unique
+    ON "shortcodes" (is_default) WHERE active AND is_default;
+
+CREATE INDEX IF NOT EXISTS deposit_date_created_shortcode
+    ON "deposit" (date_created, shortcode);
@@ -0,0 +1,20 @@
+-- CreateUser inserts only carrier, msisdn, name and the promocodes, which
+-- left the money and RTP columns of a new player NULL. NULL survives
+-- "total_bets = total_bets + $1", so a player could stay NULL for good.
+-- Backfill them with 0 and make 0 the default. Columns a deployment does
+-- not have are skipped.
+DO $$
+DECLARE
+    col TEXT;
+BEGIN
+    FOREACH col IN ARRAY ARRAY[
+        'balance', 'bonus', 'free_bet', 'monetary', 'frequency', 'total_bets',
+        'payout', 'total_losses', 'lost_count', 'total_loss_count', 'rtp_player'
+    ] LOOP
+        IF EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'Player' AND column_name = col) THEN
+            EXECUTE format('UPDATE "Player" SET %I = 0 WHERE %I IS NULL', col, col);
+            EXECUTE format('ALTER TABLE "Player" ALTER COLUMN %I SET DEFAULT 0, ALTER COLUMN %I SET NOT NULL', col, col);
+        END IF;
+    END LOOP;
+END $$;
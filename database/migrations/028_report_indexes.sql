@@ -0,0 +1,14 @@
+-- Indexes behind /admin/reports (database.GetReportFigures). Every figure
+-- is a date_created range scan on its source table; deposit is covered by
+-- deposit_date_created_shortcode (026) and kpi by its unique date. On a
+-- live database, build these by hand with CREATE INDEX CONCURRENTLY.
+CREATE INDEX IF NOT EXISTS bets_date_created
+    ON "Bets" (date_created);
+CREATE INDEX IF NOT EXISTS tax_record_date_created_type
+    ON "tax_record" (date_created, tax_type);
+CREATE INDEX IF NOT EXISTS withdrawals_date_created_status
+    ON "withdrawals" (date_created, status);
+CREATE INDEX IF NOT EXISTS pending_withdrawals_date_created
+    ON "pending_withdrawals" (date_created);
+CREATE INDEX IF NOT EXISTS deposit_reversals_date_created
+    ON "deposit_reversals" (date_created);
@@ -0,0 +1,24 @@
+-- Reveal delay: a game with reveal_delay seconds answers web and app bets
+-- as pending and shows the outcome, already settled, once that long has
+-- passed. NULL or 0 shows it at once, as before.
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS reveal_delay INTEGER;
+ALTER TABLE "Games" DROP CONSTRAINT IF EXISTS games_reveal_delay;
+ALTER TABLE "Games" ADD CONSTRAINT games_reveal_delay CHECK (reveal_delay IS NULL OR reveal_delay BETWEEN 0 AND 30);
+
+-- One row per delayed bet. result is the PlaceBetResultDisplay and sms the
+-- result messages to send at reveal_at; revealed_at is set when the reveal
+-- job has sent them.
+CREATE TABLE IF NOT EXISTS "bet_reveals" (
+    reference    TEXT PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    result       JSONB       NOT NULL,
+    sms          TEXT[]      NOT NULL DEFAULT '{}',
+    reveal_at    TIMESTAMPTZ NOT NULL,
+    revealed_at  TIMESTAMPTZ,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS bet_reveals_due
+    ON "bet_reveals" (reveal_at) WHERE revealed_at IS NULL;
+CREATE INDEX IF NOT EXISTS bet_reveals_revealed
+    ON "bet_reveals" (revealed_at) WHERE revealed_at IS NOT NULL;
@@ -0,0 +1,23 @@
+-- Jackpot ledger: every change to a jackpot_kitty's kitty, so a kitty can be
+-- reconciled as opening + contributions - payouts. A contribution is the
+-- jackpot slice of one bet (reference) paid into one kitty; a payout is the
+-- kitty's cost taken out for a jackpot win.
+CREATE TABLE IF NOT EXISTS "jackpot_contributions" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT        NOT NULL,
+    kitty_id     BIGINT      NOT NULL,
+    amount       NUMERIC     NOT NULL,
+    kind         TEXT        NOT NULL CHECK (kind IN ('opening', 'contribution', 'payout')),
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS jackpot_contributions_kitty
+    ON "jackpot_contributions" (kitty_id, kind);
+CREATE INDEX IF NOT EXISTS jackpot_contributions_reference
+    ON "jackpot_contributions" (reference);
+
+-- The kitties as they stand now are each one's opening balance
+INSERT INTO "jackpot_contributions" (reference, kitty_id, amount, kind)
+SELECT 'opening', id, COALESCE(kitty, 0), 'opening'
+FROM "jackpot_kitty"
+WHERE NOT EXISTS (SELECT 1 FROM "jackpot_contributions" WHERE kind = 'opening');
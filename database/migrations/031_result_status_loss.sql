@@ -0,0 +1,6 @@
+-- A lost bet is "Loss" (package status). Bets used to be written with
+-- "Lose" while responses, webhooks and parcels said "Loss"; rewrite the old
+-- rows so reports and the status audit see one spelling. On a large "Bets"
+-- table run this off-peak.
+UPDATE "Bets" SET result_status = 'Loss' WHERE result_status = 'Lose';
+UPDATE "deposit_reversals" SET bet_result = 'Loss' WHERE bet_result = 'Lose';
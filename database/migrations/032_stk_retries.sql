@@ -0,0 +1,7 @@
+-- STK retry: a player whose push never reached the handset, or timed out
+-- there, can have it sent again under the same reference while the deposit
+-- request is still pending. stk_retries counts the re-pushes and
+-- stk_retried_at stamps the last one; a request never retried holds 0 and
+-- NULL.
+ALTER TABLE "deposit_requests" ADD COLUMN IF NOT EXISTS stk_retries INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "deposit_requests" ADD COLUMN IF NOT EXISTS stk_retried_at TIMESTAMPTZ;
@@ -0,0 +1,15 @@
+-- Daily exposure cap: a game with daily_exposure_cap pays out at most that
+-- much in wins per day. NULL or 0 is no cap. What each game has paid today
+-- is kept in "game_daily_exposure", one row per game and day, so the count
+-- starts again at midnight without a job.
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS daily_exposure_cap NUMERIC;
+ALTER TABLE "Games" DROP CONSTRAINT IF EXISTS games_daily_exposure_cap;
+ALTER TABLE "Games" ADD CONSTRAINT games_daily_exposure_cap CHECK (daily_exposure_cap IS NULL OR daily_exposure_cap >= 0);
+
+CREATE TABLE IF NOT EXISTS "game_daily_exposure" (
+    date        DATE    NOT NULL,
+    game_cat_id TEXT    NOT NULL,
+    exposure    NUMERIC NOT NULL DEFAULT 0,
+    win_count   BIGINT  NOT NULL DEFAULT 0,
+    PRIMARY KEY (date, game_cat_id)
+);
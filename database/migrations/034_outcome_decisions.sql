@@ -0,0 +1,29 @@
+-- Outcome decisions: one row per settled bet with what the outcome was
+-- decided from, so any single result can be justified to the regulator.
+-- decision is the services.OutcomeDecision record; the columns beside it
+-- are for lookup and retention. Rows are never updated; the purge job
+-- deletes those older than limits.decision_retention.
+CREATE TABLE IF NOT EXISTS "outcome_decisions" (
+    reference    TEXT PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    game_cat_id  TEXT        NOT NULL DEFAULT '',
+    branch       TEXT        NOT NULL,
+    result       TEXT        NOT NULL,
+    amount       NUMERIC     NOT NULL DEFAULT 0,
+    decision     JSONB       NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS outcome_decisions_created
+    ON "outcome_decisions" (date_created);
+
+CREATE OR REPLACE FUNCTION outcome_decisions_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'outcome_decisions rows cannot be updated';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outcome_decisions_no_update ON "outcome_decisions";
+CREATE TRIGGER outcome_decisions_no_update
+    BEFORE UPDATE ON "outcome_decisions"
+    FOR EACH ROW EXECUTE FUNCTION outcome_decisions_append_only();
@@ -0,0 +1,22 @@
+-- Player sessions: one row per successful login. jti is the session's
+-- current access token and moves on when the refresh token of device_id
+-- rotates. A session is live until revoked_at is set or expires_at, the
+-- expiry of its refresh token or, without one, of its access token, passes.
+-- limits.max_sessions caps the live sessions of a player.
+CREATE TABLE IF NOT EXISTS "player_sessions" (
+    id                 BIGSERIAL PRIMARY KEY,
+    msisdn             TEXT        NOT NULL,
+    jti                TEXT        NOT NULL,
+    device_id          TEXT        NOT NULL DEFAULT '',
+    device_fingerprint TEXT        NOT NULL DEFAULT '',
+    expires_at         TIMESTAMPTZ NOT NULL,
+    revoked_at         TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen          TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS player_sessions_jti
+    ON "player_sessions" (jti);
+
+CREATE INDEX IF NOT EXISTS player_sessions_msisdn
+    ON "player_sessions" (msisdn, created_at) WHERE revoked_at IS NULL;
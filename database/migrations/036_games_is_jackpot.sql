@@ -0,0 +1,8 @@
+-- Jackpot games: a stake on a game with is_jackpot feeds the jackpot_kitty
+-- row of the same name_init. This replaces the list of name_inits that was
+-- hardcoded in the service; the games on that list are flagged here. A bet
+-- only contributes when the game is flagged and its kitty row exists.
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS is_jackpot BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE "Games" SET is_jackpot = TRUE
+WHERE name_init IN ('pawa_supa', 'pawa_jackpot', 'mega_jackpot', 'pawa_demio') AND NOT is_jackpot;
@@ -0,0 +1,6 @@
+-- Index behind database.GetPlayerStats: a player's settled bets, newest
+-- first, so the current streak is read from the top of the index rather
+-- than by sorting every bet the player ever placed. On a live database,
+-- build it by hand with CREATE INDEX CONCURRENTLY.
+CREATE INDEX IF NOT EXISTS bets_msisdn_date_created
+    ON "Bets" (msisdn, date_created DESC, id DESC);
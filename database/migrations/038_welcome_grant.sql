@@ -0,0 +1,19 @@
+-- Welcome free bets: a player verifying their first login OTP, who has never
+-- placed a bet, is granted free_bets free bets valid for valid_hours. The
+-- grant is set by an admin in the single "welcome_grant_settings" row; with
+-- no row it is off. welcome_grant_at records that a player's grant was
+-- decided, so it is made at most once, and welcome_free_bets how many it
+-- gave. Players from before this migration count as decided with none.
+CREATE TABLE IF NOT EXISTS "welcome_grant_settings" (
+    id           BOOLEAN     PRIMARY KEY DEFAULT TRUE CHECK (id),
+    enabled      BOOLEAN     NOT NULL DEFAULT FALSE,
+    free_bets    INTEGER     NOT NULL DEFAULT 0 CHECK (free_bets >= 0),
+    valid_hours  INTEGER     NOT NULL DEFAULT 72 CHECK (valid_hours > 0),
+    updated_by   TEXT        NOT NULL DEFAULT '',
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS welcome_grant_at TIMESTAMPTZ;
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS welcome_free_bets INTEGER NOT NULL DEFAULT 0;
+
+UPDATE "Player" SET welcome_grant_at = NOW() WHERE welcome_grant_at IS NULL;
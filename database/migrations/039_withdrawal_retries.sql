@@ -0,0 +1,25 @@
+-- Withdrawal re-drive: a processed withdrawal the disbursement partner
+-- rejected, or never answered for, can be put back on withdrawal_queue_ke
+-- by an admin. disburse_retries counts the re-drives and
+-- disburse_retried_at stamps the last one; after limits.withdrawal_retry_max
+-- of them the row is flagged manual_resolution and left to ops.
+ALTER TABLE "withdrawals" ADD COLUMN IF NOT EXISTS disburse_retries INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "withdrawals" ADD COLUMN IF NOT EXISTS disburse_retried_at TIMESTAMPTZ;
+ALTER TABLE "withdrawals" ADD COLUMN IF NOT EXISTS manual_resolution BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The stuck list: processed withdrawals with no successful callback
+CREATE INDEX IF NOT EXISTS withdrawals_undisbursed ON "withdrawals" (date_created)
+    WHERE status = 'processed' AND (disburse IS NULL OR lower(disburse) NOT IN ('0', 'success'));
+
+-- One row per admin re-drive: who asked, which attempt it was, what the
+-- partner had last said, and whether it was requeued or flagged manual
+CREATE TABLE IF NOT EXISTS "withdrawal_retries" (
+    id                BIGSERIAL PRIMARY KEY,
+    reference         TEXT        NOT NULL,
+    attempt           INTEGER     NOT NULL,
+    outcome           TEXT        NOT NULL CHECK (outcome IN ('requeued', 'manual')),
+    previous_disburse TEXT,
+    admin             TEXT        NOT NULL,
+    date_created      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS withdrawal_retries_reference ON "withdrawal_retries" (reference);
@@ -0,0 +1,12 @@
+-- Features rolled out gradually. A flag is on for the msisdns in allowlist
+-- and for percentage of other players, bucketed by a hash of the flag name
+-- and msisdn; enabled FALSE turns it off for everyone. A missing row means
+-- off. Admins flip flags at runtime through PUT /admin/flags/:name.
+CREATE TABLE IF NOT EXISTS "feature_flags" (
+    name         TEXT        PRIMARY KEY,
+    enabled      BOOLEAN     NOT NULL DEFAULT FALSE,
+    percentage   INT         NOT NULL DEFAULT 0 CHECK (percentage BETWEEN 0 AND 100),
+    allowlist    TEXT[]      NOT NULL DEFAULT '{}',
+    updated_by   TEXT        NOT NULL DEFAULT '',
+    date_updated TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,4 @@
+-- Per-game marketing copy for the games list, such as "Win up to KES 3M
+-- instantly!". Null or empty falls back to the global title the app has
+-- always shown.
+ALTER TABLE "Games" ADD COLUMN IF NOT EXISTS marketing_copy TEXT;
@@ -0,0 +1,26 @@
+-- Gateway callbacks stored before they are answered, so one is never lost
+-- to a crash or a failed handler. source names the endpoint ('settle_bt');
+-- a re-delivery of the same transaction_id is recorded once. Rows stay
+-- pending across restarts until processed, or failed after
+-- callbacks.max_attempts; failed ones show on the settlement lag monitor
+-- and GET /admin/callbacks.
+CREATE TABLE IF NOT EXISTS "inbound_callbacks" (
+    id              BIGSERIAL PRIMARY KEY,
+    source          TEXT        NOT NULL,
+    reference       TEXT        NOT NULL,
+    transaction_id  TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    status          TEXT        NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processed', 'failed')),
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error      TEXT,
+    received_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at    TIMESTAMPTZ,
+    UNIQUE (source, transaction_id)
+);
+
+CREATE INDEX IF NOT EXISTS inbound_callbacks_due
+    ON "inbound_callbacks" (next_attempt_at) WHERE status = 'pending';
+
+CREATE INDEX IF NOT EXISTS inbound_callbacks_failed
+    ON "inbound_callbacks" (received_at) WHERE status = 'failed';
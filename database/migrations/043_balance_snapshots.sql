@@ -0,0 +1,32 @@
+-- Daily snapshots of the prize basket and the house income, for finance's
+-- history charts. "Basket" and "HouseIncome" are single rows holding only
+-- the current amounts; a snapshot keeps them as they stood when it was
+-- taken, with the day's movements summed from BasketLogs and
+-- HouseIncomeLogs. One row per business day: taking it again overwrites it.
+CREATE TABLE IF NOT EXISTS "basket_snapshots" (
+    day      DATE        PRIMARY KEY,
+    amount   NUMERIC     NOT NULL,
+    credit   NUMERIC     NOT NULL DEFAULT 0, -- BasketLogs.credit: paid out of the basket
+    debit    NUMERIC     NOT NULL DEFAULT 0, -- BasketLogs.debit: put into the basket
+    taken_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "house_snapshots" (
+    day              DATE        PRIMARY KEY,
+    house_income     NUMERIC     NOT NULL,
+    total_bets       NUMERIC     NOT NULL,
+    total_wins       NUMERIC     NOT NULL,
+    total_losses     NUMERIC     NOT NULL,
+    day_house_income NUMERIC     NOT NULL DEFAULT 0,
+    day_bets         NUMERIC     NOT NULL DEFAULT 0,
+    day_wins         NUMERIC     NOT NULL DEFAULT 0,
+    day_losses       NUMERIC     NOT NULL DEFAULT 0,
+    taken_at         TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The day's sums are date_created range scans on the logs. On a live
+-- database, build these by hand with CREATE INDEX CONCURRENTLY.
+CREATE INDEX IF NOT EXISTS basketlogs_date_created
+    ON "BasketLogs" (date_created);
+CREATE INDEX IF NOT EXISTS houseincomelogs_date_created
+    ON "HouseIncomeLogs" (date_created);
@@ -0,0 +1,30 @@
+-- Bet pacing against scripted play. bet_cooldown_ms is the least time
+-- between two of a player's balance-funded bets and max_bets_per_minute how
+-- many a player may place in a minute; 0 disables either. A loss streak
+-- earns its forced win only once it has lasted forced_win_min_streak_secs
+-- or seen forced_win_min_deposits deposits; 0 disables either way, both 0
+-- lets every streak earn it as before.
+ALTER TABLE "PawaBox_KeSettings"
+    ADD COLUMN IF NOT EXISTS bet_cooldown_ms INTEGER NOT NULL DEFAULT 1000,
+    ADD COLUMN IF NOT EXISTS max_bets_per_minute INTEGER NOT NULL DEFAULT 30,
+    ADD COLUMN IF NOT EXISTS forced_win_min_streak_secs INTEGER NOT NULL DEFAULT 120,
+    ADD COLUMN IF NOT EXISTS forced_win_min_deposits INTEGER NOT NULL DEFAULT 2;
+
+-- When the player's current loss streak began; NULL while lost_count is 0.
+-- Streaks running at this migration count from now.
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS lost_since TIMESTAMPTZ;
+
+UPDATE "Player" SET lost_since = NOW() WHERE lost_count > 0 AND lost_since IS NULL;
+
+-- Counts each player's bets for limits.bet_throttle_store = database: the
+-- last bet and the minute window max_bets_per_minute is counted in
+CREATE TABLE IF NOT EXISTS "bet_throttle" (
+    msisdn       TEXT        PRIMARY KEY,
+    last_bet_at  TIMESTAMPTZ NOT NULL,
+    window_start TIMESTAMPTZ NOT NULL,
+    window_count INTEGER     NOT NULL
+);
+
+-- Deposits made during a player's loss streak
+CREATE INDEX IF NOT EXISTS deposit_msisdn_date_created
+    ON "deposit" (msisdn, date_created);
@@ -0,0 +1,29 @@
+-- Indexes behind /admin/search (database.SearchRepo): a player's deposit
+-- requests and withdrawals newest first, and the M-Pesa transaction ids
+-- and withdrawal references a reference chain is looked up by. Bets are
+-- covered by bets_msisdn_date_created (037), bets_reference_unique (012)
+-- and bets_parcel_reference (019). On a live database, build these by hand
+-- with CREATE INDEX CONCURRENTLY.
+CREATE INDEX IF NOT EXISTS deposit_requests_msisdn_date_created
+    ON "deposit_requests" (msisdn, date_created DESC);
+CREATE INDEX IF NOT EXISTS deposit_requests_transaction_id
+    ON "deposit_requests" (transaction_id);
+CREATE INDEX IF NOT EXISTS withdrawals_msisdn_date_created
+    ON "withdrawals" (msisdn, date_created DESC);
+CREATE INDEX IF NOT EXISTS withdrawals_reference
+    ON "withdrawals" (reference);
+CREATE INDEX IF NOT EXISTS withdrawals_transaction_id
+    ON "withdrawals" (transaction_id);
+
+-- One row per admin lookup of player data: who looked, what they asked
+-- for and which players' records they were shown
+CREATE TABLE IF NOT EXISTS "admin_audit_log" (
+    id           BIGSERIAL PRIMARY KEY,
+    admin        TEXT        NOT NULL,
+    action       TEXT        NOT NULL,
+    query        TEXT        NOT NULL,
+    msisdns      TEXT[]      NOT NULL DEFAULT '{}',
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS admin_audit_log_date_created ON "admin_audit_log" (date_created);
+CREATE INDEX IF NOT EXISTS admin_audit_log_msisdns ON "admin_audit_log" USING GIN (msisdns);
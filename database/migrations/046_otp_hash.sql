@@ -0,0 +1,18 @@
+-- OTP codes are stored hashed: code_hash is auth.HashOTP of the msisdn,
+-- purpose and code, and code stays NULL. Rows issued before this migration
+-- keep their plaintext code, which still verifies for
+-- limits.otp_plaintext_grace after the row was created; the purge job then
+-- clears it, as it clears the text of OTP messages in dbQueue.
+ALTER TABLE verification ADD COLUMN IF NOT EXISTS code_hash TEXT;
+ALTER TABLE verification ALTER COLUMN code DROP NOT NULL;
+
+DROP INDEX IF EXISTS verification_lookup;
+CREATE INDEX IF NOT EXISTS verification_lookup ON verification (msisdn, purpose, status);
+
+-- Codes left in plaintext, for the purge job
+CREATE INDEX IF NOT EXISTS verification_plaintext ON verification (created)
+    WHERE code IS NOT NULL;
+
+-- OTP messages whose text the purge job has yet to clear
+CREATE INDEX IF NOT EXISTS dbqueue_otp_text ON "dbQueue" ("MessageTimeStamp")
+    WHERE command = 'otp' AND "Message" <> '';
@@ -0,0 +1,9 @@
+-- CreateBet inserts with ON CONFLICT (reference) WHERE reference <> ''
+-- DO NOTHING, so a round processed twice (a gateway retry racing the
+-- callback dispatcher) keeps its first bet and the second attempt stops.
+-- Postgres needs a unique index matching that clause to arbitrate the
+-- conflict; without one every bet insert fails. 012 created it; this
+-- restates it for databases that skipped 012. Find duplicates first:
+--   SELECT reference, count(*) FROM "Bets" GROUP BY reference HAVING count(*) > 1;
+-- On a live database, build it by hand with CREATE UNIQUE INDEX CONCURRENTLY.
+CREATE UNIQUE INDEX IF NOT EXISTS bets_reference_unique ON "Bets" (reference) WHERE reference <> '';
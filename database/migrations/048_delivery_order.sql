@@ -0,0 +1,19 @@
+-- Per-player delivery order of SMS and partner webhooks.
+--
+-- dbQueue rows carry "Sequence", stamped when the app decided to send the
+-- message rather than when the row was inserted: the SMS drainer sends a
+-- destination's rows in ("Sequence", "RecordID") order and holds a row
+-- while an earlier one of the same destination is unsent. Different
+-- destinations go out in parallel. Rows from before this migration have
+-- no sequence and sort by "RecordID".
+ALTER TABLE "dbQueue" ADD COLUMN IF NOT EXISTS "Sequence" BIGINT;
+
+-- webhook_events rows carry the player they are about; ClaimWebhookEvents
+-- claims only a player's oldest pending event per subscription.
+ALTER TABLE "webhook_events" ADD COLUMN IF NOT EXISTS msisdn TEXT;
+
+-- On a live database, build these by hand with CREATE INDEX CONCURRENTLY.
+CREATE INDEX IF NOT EXISTS dbqueue_destination_sequence
+    ON "dbQueue" ("Destination", "Sequence");
+CREATE INDEX IF NOT EXISTS webhook_events_pending_msisdn
+    ON "webhook_events" (subscription_id, msisdn, id) WHERE status = 'pending';
@@ -0,0 +1,25 @@
+-- Effective-dated tax rates. The rate of a tax_type at a moment is the row
+-- with the latest effective_from at or before it; with no such row the
+-- setting's excise_duty or withholding applies. Admins only add, change or
+-- remove rates that are not yet in effect, so the rate a past moment was
+-- taxed at never changes.
+CREATE TABLE IF NOT EXISTS "tax_rates" (
+    id             BIGSERIAL PRIMARY KEY,
+    tax_type       TEXT        NOT NULL CHECK (tax_type IN ('excise', 'withholding')),
+    rate           NUMERIC     NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    effective_from TIMESTAMPTZ NOT NULL,
+    updated_by     TEXT        NOT NULL DEFAULT '',
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    date_updated   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (tax_type, effective_from)
+);
+
+-- The rates in effect when a round was opened. Settlement taxes the round
+-- at these however the rates change while it is in flight; NULL means no
+-- tax_rates row applied and the settings do.
+ALTER TABLE "game_rounds" ADD COLUMN IF NOT EXISTS excise_rate NUMERIC;
+ALTER TABLE "game_rounds" ADD COLUMN IF NOT EXISTS withholding_rate NUMERIC;
+
+-- The rate each tax was deducted at; NULL on rows recorded before this
+-- migration
+ALTER TABLE "tax_record" ADD COLUMN IF NOT EXISTS rate NUMERIC;
@@ -0,0 +1,26 @@
+-- Deposit bounds players are held to, within limits.deposit_min and
+-- deposit_max. M-Pesa takes whole shillings only: with round_deposits
+-- FALSE a deposit asked for with decimals is refused, with TRUE it is
+-- rounded to the nearest shilling before the STK push.
+ALTER TABLE "PawaBox_KeSettings"
+    ADD COLUMN IF NOT EXISTS min_deposit NUMERIC NOT NULL DEFAULT 10,
+    ADD COLUMN IF NOT EXISTS max_deposit NUMERIC NOT NULL DEFAULT 150000,
+    ADD COLUMN IF NOT EXISTS round_deposits BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Deposit callbacks that would have credited an amount outside the deposit
+-- bounds. They are recorded here instead of credited, once per
+-- transaction, for ops to settle by hand. reason is the deposit error code
+-- ('deposit_below_min', 'deposit_above_max', 'deposit_not_whole').
+CREATE TABLE IF NOT EXISTS "deposit_reviews" (
+    id             BIGSERIAL PRIMARY KEY,
+    source         TEXT        NOT NULL,
+    transaction_id TEXT        NOT NULL UNIQUE,
+    reference      TEXT        NOT NULL,
+    msisdn         TEXT        NOT NULL,
+    amount         NUMERIC     NOT NULL,
+    reason         TEXT        NOT NULL,
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS deposit_reviews_date_created
+    ON "deposit_reviews" (date_created);
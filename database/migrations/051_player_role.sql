@@ -0,0 +1,6 @@
+-- The role signed into a player's access tokens. Admin endpoints require
+-- role 'admin'; grant it by hand:
+--   UPDATE "Player" SET role = 'admin' WHERE msisdn = '2547...';
+-- A changed role takes effect at the next login or token refresh, so
+-- revoke the player's sessions when taking it away.
+ALTER TABLE "Player" ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'user';
@@ -0,0 +1,21 @@
+-- Player withdrawals of wallet balance. Each one also writes a "withdrawals"
+-- row and a withdrawal_queue_ke row under the same reference, so it is
+-- disbursed and settled like a win payout.
+CREATE TABLE IF NOT EXISTS "balance_withdrawals" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT        NOT NULL UNIQUE,
+    msisdn       TEXT        NOT NULL,
+    amount       NUMERIC     NOT NULL CHECK (amount > 0),
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS balance_withdrawals_msisdn_date
+    ON "balance_withdrawals" (msisdn, date_created);
+
+-- Withdrawals above withdrawal_otp_threshold need an OTP. A player may make
+-- at most withdrawal_max_count withdrawals totalling withdrawal_max_amount
+-- in any rolling 24 hours. 0 disables a rule.
+ALTER TABLE "PawaBox_KeSettings"
+    ADD COLUMN IF NOT EXISTS withdrawal_otp_threshold NUMERIC NOT NULL DEFAULT 1000,
+    ADD COLUMN IF NOT EXISTS withdrawal_max_count INTEGER NOT NULL DEFAULT 5,
+    ADD COLUMN IF NOT EXISTS withdrawal_max_amount NUMERIC NOT NULL DEFAULT 50000;
@@ -0,0 +1,19 @@
+-- Wins the basket could not cover. The gross amount is reserved against the
+-- basket so later wins cannot take it first; "Basket".amount - reserved is
+-- what is available. A top-up releases holds oldest first: the amount
+-- leaves the basket and the net payout moves from pending_withdrawals to
+-- withdrawal_queue_ke.
+ALTER TABLE "Basket"
+    ADD COLUMN IF NOT EXISTS reserved NUMERIC NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS "basket_holds" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT        NOT NULL UNIQUE,
+    msisdn       TEXT        NOT NULL,
+    amount       NUMERIC     NOT NULL CHECK (amount > 0),
+    released_at  TIMESTAMPTZ,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS basket_holds_open
+    ON "basket_holds" (id) WHERE released_at IS NULL;
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// OpenDeposit is a "deposit_requests" row of a round with no bet yet: the
+// STK push is unanswered, or the deposit succeeded and the game has not
+// been played
+type OpenDeposit struct {
+	Reference   string
+	GameCatID   string
+	GameName    string
+	Channel     string
+	Amount      float64
+	SelectedBox string
+	Status      string // empty while M-Pesa has not answered
+	DateCreated time.Time
+}
+
+// PlayerBet is a "Bets" row as its player may see it. RevealAt is set
+// while a delayed outcome is held back.
+type PlayerBet struct {
+	Reference    string
+	GameCatID    string
+	GameName     string
+	Channel      string
+	Amount       float64
+	SelectedBox  string
+	ResultStatus string
+	WinAmount    float64
+	DateCreated  time.Time
+	RevealAt     *time.Time
+}
+
+// OpenRoundRepo lists a player's unresolved rounds created since a cutoff,
+// newest first and at most limit of each kind, for the app to resume them.
+// They are covered by deposit_requests_msisdn_date_created (045) and
+// bets_msisdn_date_created (037).
+type OpenRoundRepo interface {
+	ListOpenDeposits(ctx context.Context, msisdn string, since time.Time, limit int) ([]OpenDeposit, error)
+	ListOpenBets(ctx context.Context, msisdn string, since time.Time, limit int) ([]PlayerBet, error)
+	GetPlayerBet(ctx context.Context, reference, msisdn string) (*PlayerBet, error)
+}
+
+var _ OpenRoundRepo = (*Database)(nil)
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"fiberapp/utils"
+	"strings"
+	"time"
+)
+
+// Player is a "Player" row as CheckUser returns it. Its accessors read the
+// money and RTP columns with one rule: NULL, which rows created before
+// migration 027 can still hold, reads as 0. NUMERIC and float columns are
+// both accepted.
+type Player map[string]interface{}
+
+// ID is the player's id
+func (p Player) ID() int64 { return utils.ToInt64(p["id"]) }
+
+// Balance is the cash wallet
+func (p Player) Balance() float64 { return utils.NumericFloat(p["balance"]) }
+
+// Bonus is the bonus wallet
+func (p Player) Bonus() float64 { return utils.NumericFloat(p["bonus"]) }
+
+// Funds is what the player can stake: cash and bonus
+func (p Player) Funds() float64 { return p.Balance() + p.Bonus() }
+
+// TotalBets is the sum of every stake the player has placed
+func (p Player) TotalBets() float64 { return utils.NumericFloat(p["total_bets"]) }
+
+// Payout is the sum of every win paid to the player
+func (p Player) Payout() float64 { return utils.NumericFloat(p["payout"]) }
+
+// TotalLosses is the sum of the stakes of lost bets
+func (p Player) TotalLosses() float64 { return utils.NumericFloat(p["total_losses"]) }
+
+// LostCount is the number of bets lost since the last win
+func (p Player) LostCount() int64 { return utils.ToInt64(p["lost_count"]) }
+
+// LostSince is when the current loss streak began; ok is false while there
+// is none
+func (p Player) LostSince() (since time.Time, ok bool) {
+	since, ok = p["lost_since"].(time.Time)
+	return since, ok
+}
+
+// Frequency is the number of bets placed
+func (p Player) Frequency() int64 { return utils.ToInt64(p["frequency"]) }
+
+// Role is the role signed into the player's access tokens, utils.RoleUser
+// unless the row says utils.RoleAdmin
+func (p Player) Role() string {
+	if strings.TrimSpace(utils.ToString(p["role"])) == utils.RoleAdmin {
+		return utils.RoleAdmin
+	}
+	return utils.RoleUser
+}
+
+// RTP is Payout as a percentage of TotalBets, 0 before the first stake
+func (p Player) RTP() float64 { return RTP(p.Payout(), p.TotalBets()) }
+
+// RTP returns payout as a percentage of stakes, 0 when nothing was staked,
+// so a zero or NULL denominator never yields NaN or Inf. The games use it
+// for player, demo session and daily KPI RTPs; SQL guards the same way with
+// CASE WHEN total_bets = 0 THEN 1 ELSE total_bets END.
+func RTP(payout, stakes float64) float64 {
+	if stakes <= 0 {
+		return 0
+	}
+	return payout / stakes * 100
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// TestPlayerNullColumns reads a brand-new player's row, whose money and
+// stats columns are NULL or missing, as zeros
+func TestPlayerNullColumns(t *testing.T) {
+	for name, p := range map[string]Player{
+		"null":    {"id": int64(7), "balance": nil, "bonus": nil, "total_bets": nil, "payout": nil, "total_losses": nil, "lost_count": nil, "frequency": nil},
+		"missing": {"id": int64(7)},
+	} {
+		if p.ID() != 7 {
+			t.Errorf("%s: ID = %d, want 7", name, p.ID())
+		}
+		for col, v := range map[string]float64{"Balance": p.Balance(), "Bonus": p.Bonus(), "Funds": p.Funds(), "TotalBets": p.TotalBets(), "Payout": p.Payout(), "TotalLosses": p.TotalLosses(), "RTP": p.RTP()} {
+			if v != 0 {
+				t.Errorf("%s: %s = %v, want 0", name, col, v)
+			}
+		}
+		if p.LostCount() != 0 || p.Frequency() != 0 {
+			t.Errorf("%s: lost count %d, frequency %d; want 0", name, p.LostCount(), p.Frequency())
+		}
+		if _, ok := p.LostSince(); ok {
+			t.Errorf("%s: LostSince reports a streak", name)
+		}
+	}
+}
+
+func TestPlayerNumericColumns(t *testing.T) {
+	p := Player{
+		"balance":    pgtype.Numeric{Int: big.NewInt(12550), Exp: -2, Valid: true},
+		"bonus":      float64(10),
+		"total_bets": pgtype.Numeric{Int: big.NewInt(200), Valid: true},
+		"payout":     pgtype.Numeric{Valid: false},
+	}
+	if p.Balance() != 125.5 || p.Funds() != 135.5 {
+		t.Errorf("balance %v, funds %v; want 125.5 and 135.5", p.Balance(), p.Funds())
+	}
+	if p.TotalBets() != 200 || p.Payout() != 0 || p.RTP() != 0 {
+		t.Errorf("total bets %v, payout %v, RTP %v; want 200, 0 and 0", p.TotalBets(), p.Payout(), p.RTP())
+	}
+}
+
+func TestRTPZeroStakes(t *testing.T) {
+	for _, c := range []struct{ payout, stakes, want float64 }{
+		{0, 0, 0}, {50, 0, 0}, {0, -1, 0}, {85, 100, 85}, {0, 100, 0},
+	} {
+		got := RTP(c.payout, c.stakes)
+		if math.IsNaN(got) || math.IsInf(got, 0) || got != c.want {
+			t.Errorf("RTP(%v, %v) = %v, want %v", c.payout, c.stakes, got, c.want)
+		}
+	}
+}
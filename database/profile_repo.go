@@ -0,0 +1,34 @@
+package database
+
+import "context"
+
+// PlayerProfile is the player-editable part of a Player row
+type PlayerProfile struct {
+	Msisdn           string
+	Name             string
+	Language         string // empty uses the default SMS language
+	SMSNotifications bool
+	ShowWin          bool
+}
+
+// PlayerLifetimeStats are a player's lifetime figures over their settled bets.
+// Pending bets are left out until they settle.
+type PlayerLifetimeStats struct {
+	GamesPlayed  int64
+	Wins         int64
+	Losses       int64
+	TotalWagered float64 // stakes of the player's own money; free bets are left out
+	TotalWon     float64
+	BiggestWin   float64
+	StreakWon    bool  // whether the current streak is of wins
+	Streak       int64 // settled bets in a row, newest first, with the same outcome; 0 with no bets
+}
+
+// ProfileRepo reads and writes PlayerProfile and reads PlayerLifetimeStats
+type ProfileRepo interface {
+	GetPlayerProfile(ctx context.Context, msisdn string) (*PlayerProfile, error)
+	UpdatePlayerProfile(ctx context.Context, p PlayerProfile) (int64, error)
+	GetPlayerLifetimeStats(ctx context.Context, msisdn string) (PlayerLifetimeStats, error)
+}
+
+var _ ProfileRepo = (*Database)(nil)
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"fiberapp/clock"
+	"fiberapp/config"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+const replicaHealthInterval = 5 * time.Second
+
+var (
+	// Optional read replica, set by ConnectPostgres when database.replica_enabled
+	replicaPool       *pgxpool.Pool
+	replicaHealthy    atomic.Bool
+	replicaStickiness time.Duration
+	replicaStop       chan struct{}
+
+	// recentWrites maps msisdn to the time of its last money-moving write,
+	// so that player's reads stay on the primary until the replica catches up
+	recentWrites sync.Map
+)
+
+// connectReplica opens the replica pool and starts its health check. A
+// replica that is down at startup only logs: reads use the primary until
+// the health check sees it come up.
+func connectReplica(cfg config.DatabaseConfig) error {
+	poolConfig, err := pgxpool.ParseConfig(cfg.ReplicaDSN)
+	if err != nil {
+		return fmt.Errorf("failed to parse replica DSN: %w", err)
+	}
+	poolConfig.MaxConns = cfg.MaxConns
+	poolConfig.MaxConnLifetime = 1 * time.Hour
+	poolConfig.MaxConnIdleTime = 30 * time.Minute
+	poolConfig.HealthCheckPeriod = 1 * time.Minute
+	poolConfig.ConnConfig.ConnectTimeout = 5 * time.Second
+	poolConfig.ConnConfig.RuntimeParams["statement_timeout"] = "10000" // 10 seconds
+	poolConfig.ConnConfig.RuntimeParams["timezone"] = clock.Zone()     // CURRENT_DATE and ::date in the business zone
+	poolConfig.ConnConfig.Tracer = queryTracer{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 8*time.Second)
+	defer cancel()
+	pool, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create replica pool: %w", err)
+	}
+
+	replicaPool = pool
+	replicaStickiness = cfg.ReplicaStickiness
+	replicaStop = make(chan struct{})
+	checkReplica()
+	go replicaHealthLoop(replicaStop)
+
+	logrus.Infof("🔄 Read replica configured (healthy=%t, stickiness=%s)", replicaHealthy.Load(), replicaStickiness)
+	return nil
+}
+
+func replicaHealthLoop(stop chan struct{}) {
+	ticker := time.NewTicker(replicaHealthInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			checkReplica()
+			pruneRecentWrites()
+		}
+	}
+}
+
+// checkReplica pings the replica and logs when its health changes
+func checkReplica() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	err := replicaPool.Ping(ctx)
+	healthy := err == nil
+	if replicaHealthy.Swap(healthy) != healthy {
+		if healthy {
+			logrus.Info("✅ Read replica is back; routing reads to it")
+		} else {
+			logrus.Warnf("Read replica is down, reads fall back to the primary: %v", err)
+		}
+	}
+}
+
+// closeReplica stops the health check and closes the replica pool
+func closeReplica() {
+	if replicaPool == nil {
+		return
+	}
+	close(replicaStop)
+	replicaPool.Close()
+	replicaHealthy.Store(false)
+}
+
+// ReadDB returns the pool for read-only queries: the replica when one is
+// configured and healthy, otherwise the primary. Writes must use the primary.
+func (db *Database) ReadDB() *pgxpool.Pool {
+	if db.replica != nil && replicaHealthy.Load() {
+		return db.replica
+	}
+	return db.pool
+}
+
+// readConn acquires a connection for a read-only query. Reads about a player
+// who wrote within the stickiness window stay on the primary, and a replica
+// that cannot hand out a connection is marked down and skipped.
+func (db *Database) readConn(ctx context.Context, msisdn string) (*pgxpool.Conn, error) {
+	pool := db.ReadDB()
+	if pool != db.pool && msisdn != "" && wroteRecently(msisdn) {
+		pool = db.pool
+	}
+
+	if pool != db.pool {
+		conn, err := pool.Acquire(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if replicaHealthy.Swap(false) {
+			logrus.Warnf("Read replica acquire failed, falling back to the primary: %v", err)
+		}
+	}
+	return db.pool.Acquire(ctx)
+}
+
+// noteWrite records a write that changes what msisdn's history or wallet
+// reads return
+func noteWrite(msisdn string) {
+	if replicaPool == nil || msisdn == "" {
+		return
+	}
+	recentWrites.Store(msisdn, time.Now())
+}
+
+func wroteRecently(msisdn string) bool {
+	v, ok := recentWrites.Load(msisdn)
+	return ok && time.Since(v.(time.Time)) < replicaStickiness
+}
+
+func pruneRecentWrites() {
+	recentWrites.Range(func(k, v interface{}) bool {
+		if time.Since(v.(time.Time)) >= replicaStickiness {
+			recentWrites.Delete(k)
+		}
+		return true
+	})
+}
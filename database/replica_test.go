@@ -0,0 +1,176 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// unreachablePool is a pool whose connections all fail with an error naming
+// port, so a test can tell which pool a read tried
+func unreachablePool(t *testing.T, port string) *pgxpool.Pool {
+	t.Helper()
+	cfg, err := pgxpool.ParseConfig("postgres://test@127.0.0.1:" + port + "/test?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// withReplica installs replica as the package replica for the test
+func withReplica(t *testing.T, replica *pgxpool.Pool, healthy bool, stickiness time.Duration) {
+	t.Helper()
+	savedPool, savedHealthy, savedStickiness := replicaPool, replicaHealthy.Load(), replicaStickiness
+	replicaPool, replicaStickiness = replica, stickiness
+	replicaHealthy.Store(healthy)
+	t.Cleanup(func() {
+		replicaPool, replicaStickiness = savedPool, savedStickiness
+		replicaHealthy.Store(savedHealthy)
+		recentWrites.Range(func(k, _ interface{}) bool { recentWrites.Delete(k); return true })
+	})
+}
+
+func TestReadDBRouting(t *testing.T) {
+	primary, replica := unreachablePool(t, "1"), unreachablePool(t, "2")
+	db := &Database{pool: primary, replica: replica}
+
+	withReplica(t, replica, true, time.Minute)
+	if db.ReadDB() != replica {
+		t.Error("healthy replica: reads should go to the replica")
+	}
+	replicaHealthy.Store(false)
+	if db.ReadDB() != primary {
+		t.Error("unhealthy replica: reads should fall back to the primary")
+	}
+	if (&Database{pool: primary}).ReadDB() != primary {
+		t.Error("no replica: reads should use the primary")
+	}
+}
+
+func TestReadConnFallsBackToPrimary(t *testing.T) {
+	primary, replica := unreachablePool(t, "1"), unreachablePool(t, "2")
+	db := &Database{pool: primary, replica: replica}
+	withReplica(t, replica, true, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := db.readConn(ctx, "254700000001")
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:1:") {
+		t.Fatalf("read error = %v, want the primary's after the replica failed", err)
+	}
+	if replicaHealthy.Load() {
+		t.Error("a replica that cannot hand out a connection should be marked down")
+	}
+}
+
+func TestReadConnStickyAfterWrite(t *testing.T) {
+	primary, replica := unreachablePool(t, "1"), unreachablePool(t, "2")
+	db := &Database{pool: primary, replica: replica}
+	withReplica(t, replica, true, time.Minute)
+
+	noteWrite("254700000001")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := db.readConn(ctx, "254700000001"); err == nil || !strings.Contains(err.Error(), "127.0.0.1:1:") {
+		t.Fatalf("read error = %v, want the primary's for a player who just wrote", err)
+	}
+	if !replicaHealthy.Load() {
+		t.Error("a sticky read never tried the replica, so it should stay healthy")
+	}
+}
+
+func TestRecentWriteStickinessExpires(t *testing.T) {
+	withReplica(t, unreachablePool(t, "2"), true, 20*time.Millisecond)
+
+	noteWrite("254700000001")
+	if !wroteRecently("254700000001") {
+		t.Fatal("a write should be sticky inside the window")
+	}
+	if wroteRecently("254700000002") {
+		t.Error("stickiness is per msisdn")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if wroteRecently("254700000001") {
+		t.Error("a write should stop being sticky after the window")
+	}
+	pruneRecentWrites()
+	if _, ok := recentWrites.Load("254700000001"); ok {
+		t.Error("pruneRecentWrites should drop expired writes")
+	}
+}
+
+func TestNoteWriteWithoutReplica(t *testing.T) {
+	withReplica(t, nil, false, time.Minute)
+	noteWrite("254700000001")
+	if _, ok := recentWrites.Load("254700000001"); ok {
+		t.Error("without a replica there is nothing to stick to")
+	}
+}
+
+// TestReadConnRoutesToReplica needs two databases, the primary at
+// TEST_DATABASE_URL and a replica at TEST_REPLICA_DATABASE_URL, and skips
+// without them
+func TestReadConnRoutesToReplica(t *testing.T) {
+	primaryURL, replicaURL := os.Getenv("TEST_DATABASE_URL"), os.Getenv("TEST_REPLICA_DATABASE_URL")
+	if primaryURL == "" || replicaURL == "" {
+		t.Skip("TEST_DATABASE_URL and TEST_REPLICA_DATABASE_URL not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	primary, err := pgxpool.New(ctx, primaryURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer primary.Close()
+	replica, err := pgxpool.New(ctx, replicaURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+	db := &Database{pool: primary, replica: replica}
+	withReplica(t, replica, true, time.Minute)
+
+	server := func(msisdn string) string {
+		conn, err := db.readConn(ctx, msisdn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Release()
+		var addr string
+		if err := conn.QueryRow(ctx, `SELECT current_database() || ':' || COALESCE(inet_server_port(), 0)`).Scan(&addr); err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	want := func(pool *pgxpool.Pool) string {
+		var addr string
+		if err := pool.QueryRow(ctx, `SELECT current_database() || ':' || COALESCE(inet_server_port(), 0)`).Scan(&addr); err != nil {
+			t.Fatal(err)
+		}
+		return addr
+	}
+	if want(primary) == want(replica) {
+		t.Skip("primary and replica URLs name the same database")
+	}
+
+	if got := server("254700000001"); got != want(replica) {
+		t.Errorf("read went to %s, want the replica", got)
+	}
+	noteWrite("254700000001")
+	if got := server("254700000001"); got != want(primary) {
+		t.Errorf("read after a write went to %s, want the primary", got)
+	}
+	replicaHealthy.Store(false)
+	if got := server("254700000002"); got != want(primary) {
+		t.Errorf("read with the replica down went to %s, want the primary", got)
+	}
+}
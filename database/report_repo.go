@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// ReportRepo holds the finance report queries. They read the source tables
+// rather than the running kpi counters, so the report can check one against
+// the other. Migration 028 indexes every range they scan.
+type ReportRepo interface {
+	GetReportFigures(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error)
+}
+
+var _ ReportRepo = (*Database)(nil)
@@ -0,0 +1,17 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// RevealRepo holds bets whose outcome is withheld until their reveal time,
+// with the SMS held back with them
+type RevealRepo interface {
+	CreateBetReveal(ctx context.Context, reference, msisdn string, result []byte, sms []string, revealAt time.Time) error
+	GetBetReveal(ctx context.Context, reference, msisdn string) (map[string]interface{}, error)
+	ClaimDueReveals(ctx context.Context, limit int) ([]map[string]interface{}, error)
+	PurgeBetReveals(ctx context.Context, before time.Time) (int64, error)
+}
+
+var _ RevealRepo = (*Database)(nil)
@@ -0,0 +1,13 @@
+package database
+
+import "context"
+
+// RoundRepo holds the game rounds: one per bet or deposit reference, with
+// the timeline of its state changes
+type RoundRepo interface {
+	CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error
+	TransitionRound(ctx context.Context, reference, to, actor, detail string) error
+	GetRound(ctx context.Context, reference string) (map[string]interface{}, []map[string]interface{}, error)
+}
+
+var _ RoundRepo = (*Database)(nil)
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRoundTransitionAllowed(t *testing.T) {
+	states := []string{RoundCreated, RoundFunded, RoundPlayed, RoundSettled, RoundPaid, RoundFailed}
+	legal := map[[2]string]bool{
+		{RoundCreated, RoundFunded}: true,
+		{RoundFunded, RoundPlayed}:  true,
+		{RoundPlayed, RoundSettled}: true,
+		{RoundSettled, RoundPaid}:   true,
+		{RoundCreated, RoundFailed}: true,
+		{RoundFunded, RoundFailed}:  true,
+		{RoundPlayed, RoundFailed}:  true,
+		{RoundSettled, RoundFailed}: true,
+	}
+	for _, from := range states {
+		for _, to := range states {
+			if got := RoundTransitionAllowed(from, to); got != legal[[2]string{from, to}] {
+				t.Errorf("%s -> %s allowed = %t, want %t", from, to, got, !got)
+			}
+		}
+	}
+	if RoundTransitionAllowed("", RoundFunded) {
+		t.Error("a round with no state moved")
+	}
+}
+
+func TestRoundLifecycleIntegration(t *testing.T) {
+	db, _ := openIntegration(t, "game_rounds", "game_round_events")
+	ctx := context.Background()
+
+	if err := db.CreateRound(ctx, "REF1", "254700000001", "1", 50, "player", "bet"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateRound(ctx, "REF1", "254700000001", "1", 50, "player", "bet"); !errors.Is(err, ErrRoundExists) {
+		t.Errorf("second create = %v, want ErrRoundExists", err)
+	}
+	for _, to := range []string{RoundFunded, RoundPlayed, RoundSettled} {
+		if err := db.TransitionRound(ctx, "REF1", to, "game", ""); err != nil {
+			t.Fatalf("-> %s: %v", to, err)
+		}
+	}
+	if err := db.TransitionRound(ctx, "REF1", RoundSettled, "game", "again"); !errors.Is(err, ErrInvalidRoundTransition) {
+		t.Errorf("settling twice = %v, want ErrInvalidRoundTransition", err)
+	}
+	if err := db.TransitionRound(ctx, "NOPE", RoundFunded, "mpesa", ""); !errors.Is(err, ErrRoundNotFound) {
+		t.Errorf("unknown round = %v, want ErrRoundNotFound", err)
+	}
+
+	round, events, err := db.GetRound(ctx, "REF1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if round["state"] != RoundSettled || len(events) != 4 {
+		t.Fatalf("round %v with %d events, want settled with 4", round["state"], len(events))
+	}
+	if events[0]["to_state"] != RoundCreated || events[3]["from_state"] != RoundPlayed || events[3]["to_state"] != RoundSettled {
+		t.Errorf("events = %v, want created through played -> settled in order", events)
+	}
+	if round, _, err := db.GetRound(ctx, "NOPE"); round != nil || err != nil {
+		t.Errorf("unknown round = %v, %v, want nil", round, err)
+	}
+}
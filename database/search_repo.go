@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SearchPlayer is the summary of a "Player" row a support search shows
+type SearchPlayer struct {
+	Msisdn          string
+	Name            string
+	Balance         float64
+	FreeBets        float64
+	BetCount        int64
+	LostCount       int64
+	LastTransaction *time.Time
+	DateCreated     *time.Time
+}
+
+// SearchBet is a "Bets" row a support search shows
+type SearchBet struct {
+	Reference       string
+	ParcelReference string // empty unless the bet is one box of a parcel
+	Msisdn          string
+	GameCatID       string
+	GameName        string
+	Channel         string
+	BetType         string
+	Amount          float64
+	SelectedNumber  string
+	ResultStatus    string
+	WinAmount       float64
+	DateCreated     time.Time
+}
+
+// SearchDeposit is a "deposit_requests" row a support search shows
+type SearchDeposit struct {
+	Reference     string
+	TransactionID string
+	Msisdn        string
+	Amount        float64
+	Status        string
+	DepositType   string
+	Channel       string
+	GameCatID     string
+	Description   string
+	DateCreated   time.Time
+}
+
+// SearchWithdrawal is a "withdrawals" row a support search shows
+type SearchWithdrawal struct {
+	Reference     string
+	TransactionID string
+	Msisdn        string
+	Amount        float64
+	TaxAmount     float64
+	Status        string
+	Disburse      string
+	Description   string
+	DateCreated   time.Time
+}
+
+// SearchRepo answers the admin support search, newest rows first and at
+// most limit of them. A player's lookups take their msisdn; the chain
+// lookups take keys, each matched against the reference and the M-Pesa
+// transaction id (the parcel reference for bets). Migration 045 adds the
+// indexes behind them and admin_audit_log, where LogAdminAccess records
+// which admin looked at which players.
+type SearchRepo interface {
+	SearchPlayer(ctx context.Context, msisdn string) (*SearchPlayer, error)
+	SearchPlayerBets(ctx context.Context, msisdn string, limit int) ([]SearchBet, error)
+	SearchPlayerDeposits(ctx context.Context, msisdn string, limit int) ([]SearchDeposit, error)
+	SearchPlayerWithdrawals(ctx context.Context, msisdn string, limit int) ([]SearchWithdrawal, error)
+	SearchBetsByKey(ctx context.Context, keys []string, limit int) ([]SearchBet, error)
+	SearchDepositsByKey(ctx context.Context, keys []string, limit int) ([]SearchDeposit, error)
+	SearchWithdrawalsByKey(ctx context.Context, keys []string, limit int) ([]SearchWithdrawal, error)
+	LogAdminAccess(ctx context.Context, admin, action, query string, msisdns []string) error
+}
+
+var _ SearchRepo = (*Database)(nil)
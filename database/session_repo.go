@@ -0,0 +1,18 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SessionRepo holds the player sessions opened at login, which
+// limits.max_sessions caps and players can list and end
+type SessionRepo interface {
+	OpenSession(ctx context.Context, msisdn, jti, deviceID, fingerprint string, accessExpiry, expiresAt time.Time, maxSessions int, evictOldest bool) ([]string, error)
+	RenewSession(ctx context.Context, msisdn, deviceID, jti string, expiresAt time.Time) error
+	TouchSession(ctx context.Context, jti string) error
+	ListSessions(ctx context.Context, msisdn string) ([]map[string]interface{}, error)
+	RevokeSession(ctx context.Context, msisdn string, id int64) (string, error)
+}
+
+var _ SessionRepo = (*Database)(nil)
@@ -0,0 +1,39 @@
+package database
+
+import "context"
+
+// Settings is the "PawaBox_KeSettings" row, typed. Percentages are in
+// percent. The json names are the column names, misspellings included.
+type Settings struct {
+	DefaultRTP        float64 `json:"default_rtp"`
+	AdjustableRTP     float64 `json:"adjustmentable_rtp"`
+	VigPercentage     float64 `json:"vig_percentage"`
+	JackpotPercentage float64 `json:"jackpot_percentage"`
+	RTPOverload       float64 `json:"rtp_overload"`
+	MinWinMultiplier  float64 `json:"min_win_multipier"`
+	MaxWinMultiplier  float64 `json:"max_win_multipier"`
+	MinLossCount      int     `json:"min_loss_count"`
+	Withholding       float64 `json:"withholding"`
+	ExciseDuty        float64 `json:"excise_duty"`
+
+	BetCooldownMS          int64 `json:"bet_cooldown_ms"`
+	MaxBetsPerMinute       int   `json:"max_bets_per_minute"`
+	ForcedWinMinStreakSecs int64 `json:"forced_win_min_streak_secs"`
+	ForcedWinMinDeposits   int64 `json:"forced_win_min_deposits"`
+
+	MinDeposit    float64 `json:"min_deposit"`
+	MaxDeposit    float64 `json:"max_deposit"`
+	RoundDeposits bool    `json:"round_deposits"`
+
+	WithdrawalOTPThreshold float64 `json:"withdrawal_otp_threshold"`
+	WithdrawalMaxCount     int     `json:"withdrawal_max_count"`
+	WithdrawalMaxAmount    float64 `json:"withdrawal_max_amount"`
+}
+
+// SettingsRepo reads and writes the typed settings row
+type SettingsRepo interface {
+	GetSettings(ctx context.Context) (*Settings, error)
+	UpdateSettings(ctx context.Context, s Settings) (int64, error)
+}
+
+var _ SettingsRepo = (*Database)(nil)
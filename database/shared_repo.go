@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SharedRepo holds the tables used by every deployment regardless of game:
+// OTP verification, the SMS queue and USSD session logs.
+type SharedRepo interface {
+	InsertVerification(ctx context.Context, msisdn, purpose, codeHash string, expired int64, created int64) (int, error)
+	GetOTPVerified(ctx context.Context, msisdn, purpose string, guess OTPGuess, now int64) (map[string]interface{}, error)
+	GetOTPChecked(ctx context.Context, msisdn, purpose string, guess OTPGuess) (map[string]interface{}, error)
+	UpdateIntoVerification(ctx context.Context, id int32) (int64, error)
+	GetLatestVerification(ctx context.Context, msisdn, purpose string) (*VerificationCode, error)
+	ReissueVerification(ctx context.Context, id int64, codeHash string, expired, created int64, maxResends int) (bool, error)
+	PurgeExpiredVerifications(ctx context.Context, olderThan time.Duration) (int64, error)
+	PurgeOTPPlaintext(ctx context.Context, before time.Time) (int64, error)
+	InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error)
+	UpdateSMSDeliveryStatus(ctx context.Context, recordID int64, delivery, description string) (bool, error)
+	InsertUSSDLogs(ctx context.Context, msisdn, sessionID, serviceCode, ussdString string) (int64, error)
+	Close()
+}
+
+var _ SharedRepo = (*Database)(nil)
@@ -0,0 +1,21 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrShortcodeConflict means another active shortcode already holds the
+// channel, the default or the campaign
+var ErrShortcodeConflict = errors.New("another active shortcode already holds this channel, default or campaign")
+
+// ShortcodeRepo holds the paybill shortcodes deposits are pushed on
+type ShortcodeRepo interface {
+	ListShortcodes(ctx context.Context) ([]map[string]interface{}, error)
+	UpsertShortcode(ctx context.Context, shortcode, label, campaign, channel string, isDefault, active bool) error
+	DeleteShortcode(ctx context.Context, shortcode string) (int64, error)
+	GetDepositsByShortcode(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error)
+}
+
+var _ ShortcodeRepo = (*Database)(nil)
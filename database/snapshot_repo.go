@@ -0,0 +1,14 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// SnapshotRepo keeps the daily basket and house income snapshots
+type SnapshotRepo interface {
+	UpsertBalanceSnapshots(ctx context.Context) (map[string]interface{}, error)
+	GetBalanceSnapshots(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error)
+}
+
+var _ SnapshotRepo = (*Database)(nil)
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// STKRetryRepo holds the re-pushes of a pending deposit request's STK.
+// Migration 032 adds the counters to "deposit_requests".
+type STKRetryRepo interface {
+	GetSTKRetry(ctx context.Context, reference string) (map[string]interface{}, error)
+	ClaimSTKRetry(ctx context.Context, reference string, retries, maxRetries int, spacing time.Duration) (bool, error)
+}
+
+var _ STKRetryRepo = (*Database)(nil)
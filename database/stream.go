@@ -0,0 +1,83 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ForEachRow runs query on the read pool and hands each row to fn as it is
+// read, so memory stays flat however many rows match. The map is reused
+// between rows; fn must copy anything it keeps. An error from fn stops the
+// scan, closes the rows and is returned as is. Use scanRowsToMap for small
+// result sets.
+func (db *Database) ForEachRow(ctx context.Context, query string, args []interface{}, fn func(row map[string]interface{}) error) error {
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	names := make([]string, len(fields))
+	for i, fd := range fields {
+		names[i] = fd.Name
+	}
+
+	row := make(map[string]interface{}, len(names))
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return fmt.Errorf("failed to get row values: %w", err)
+		}
+		for i, name := range names {
+			row[name] = values[i]
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+	return nil
+}
+
+// ForEachRowAs is ForEachRow for a struct whose fields match the columns
+// by name (or db tag); see pgx.RowToStructByName
+func ForEachRowAs[T any](ctx context.Context, db *Database, query string, args []interface{}, fn func(T) error) error {
+	conn, err := db.readConn(ctx, "")
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute query: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		v, err := pgx.RowToStructByName[T](rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan row: %w", err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+)
+
+// exportQuery is a 50k-row result shaped like the player export
+const exportQuery = `SELECT i AS id, '2547' || lpad(i::text, 8, '0') AS msisdn,
+		(i % 1000)::numeric AS total_bets, NOW() AS date_created
+	FROM generate_series(1, 50000) i`
+
+func TestForEachRowStopsEarly(t *testing.T) {
+	db, pool := openIntegration(t)
+	ctx := context.Background()
+	stop := errors.New("stop")
+
+	n := 0
+	err := db.ForEachRow(ctx, exportQuery, nil, func(row map[string]interface{}) error {
+		if n++; n == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 10 {
+		t.Fatalf("ForEachRow = %v after %d rows, want the callback's error as is after 10", err, n)
+	}
+	if acquired := pool.Stat().AcquiredConns(); acquired != 0 {
+		t.Errorf("%d connections still held after the early stop", acquired)
+	}
+	// The connection went back usable, not mid-result
+	for i := 0; i < int(pool.Config().MaxConns)+1; i++ {
+		var one int
+		if err := pool.QueryRow(ctx, `SELECT 1`).Scan(&one); err != nil {
+			t.Fatalf("query after the early stop = %v", err)
+		}
+	}
+}
+
+func TestForEachRowAs(t *testing.T) {
+	db, _ := openIntegration(t)
+	type player struct {
+		ID     int32
+		Msisdn string
+	}
+	var last player
+	n := 0
+	err := ForEachRowAs(context.Background(), db, `SELECT i AS id, 'p' || i AS msisdn FROM generate_series(1, 5) i`, nil, func(p player) error {
+		n++
+		last = p
+		return nil
+	})
+	if err != nil || n != 5 || last != (player{5, "p5"}) {
+		t.Errorf("ForEachRowAs = %v, %d rows, last %+v", err, n, last)
+	}
+	if err := ForEachRowAs(context.Background(), db, `SELECT 1 AS unknown_column`, nil, func(p player) error { return nil }); err == nil {
+		t.Error("a column with no field should fail the scan")
+	}
+}
+
+// heapInUse is the live heap after a collection
+func heapInUse() uint64 {
+	runtime.GC()
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// heapAbove is how far the live heap is above base, or 0
+func heapAbove(base uint64) uint64 {
+	if h := heapInUse(); h > base {
+		return h - base
+	}
+	return 0
+}
+
+// BenchmarkExport50kCollected and BenchmarkExport50kStreamed compare the
+// heap a 50k-row export holds. peak-MB is the live heap above the starting
+// point once every row is collected, or the most seen while streaming,
+// sampled every 5000 rows.
+func BenchmarkExport50kCollected(b *testing.B) {
+	db, pool := openIntegration(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		base := heapInUse()
+		rows, err := pool.Query(ctx, exportQuery)
+		if err != nil {
+			b.Fatal(err)
+		}
+		all, err := db.scanRowsToMap(rows)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if used := heapAbove(base); used > peak {
+			peak = used
+		}
+		runtime.KeepAlive(all)
+	}
+	b.ReportMetric(float64(peak)/1e6, "peak-MB")
+}
+
+func BenchmarkExport50kStreamed(b *testing.B) {
+	db, _ := openIntegration(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	var peak uint64
+	for i := 0; i < b.N; i++ {
+		base := heapInUse()
+		n := 0
+		err := db.ForEachRow(ctx, exportQuery, nil, func(row map[string]interface{}) error {
+			if n++; n%5000 == 0 {
+				if used := heapAbove(base); used > peak {
+					peak = used
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(peak)/1e6, "peak-MB")
+}
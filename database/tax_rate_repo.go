@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Tax types of "tax_rates" and "tax_record"
+const (
+	TaxExcise      = "excise"
+	TaxWithholding = "withholding"
+)
+
+// ErrTaxRateExists means the tax type already has a rate effective from the
+// same moment
+var ErrTaxRateExists = errors.New("a rate of this tax type already takes effect at that time")
+
+// TaxRateRepo holds the effective-dated excise and withholding rates, and
+// the rates each round was opened with
+type TaxRateRepo interface {
+	TaxRatesAt(ctx context.Context, at time.Time) (map[string]float64, error)
+	RoundTaxRates(ctx context.Context, reference string) (map[string]float64, error)
+	ListTaxRates(ctx context.Context) ([]map[string]interface{}, error)
+	InsertTaxRate(ctx context.Context, taxType string, rate float64, effectiveFrom time.Time, admin string) (int64, error)
+	UpdateTaxRate(ctx context.Context, id int64, rate float64, effectiveFrom time.Time, admin string) (int64, error)
+	DeleteTaxRate(ctx context.Context, id int64) (int64, error)
+}
+
+var _ TaxRateRepo = (*Database)(nil)
@@ -0,0 +1,13 @@
+package database
+
+import "context"
+
+// TemplateRepo holds the editable SMS templates
+type TemplateRepo interface {
+	ListMessageTemplates(ctx context.Context) ([]map[string]interface{}, error)
+	GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error)
+	UpsertMessageTemplate(ctx context.Context, key, language, body string, active bool) (int64, error)
+	DeleteMessageTemplate(ctx context.Context, key, language string) (int64, error)
+}
+
+var _ TemplateRepo = (*Database)(nil)
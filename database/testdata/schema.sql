@@ -0,0 +1,370 @@
+-- Base tables for integration tests. Production already has these; the
+-- numbered migrations only alter them, so a fresh test database needs them
+-- before database/migrations/*.sql can run. Only the columns the app reads
+-- or writes are here. Of the other schemas only the "Aviator" USSD tables
+-- are created; code paths using the rest ("LudoMotto_Ke", "luckynumber")
+-- are not covered.
+-- dbtest.Open applies this file and then every migration, in order.
+
+CREATE TABLE IF NOT EXISTS "Player" (
+    id                         BIGSERIAL PRIMARY KEY,
+    carrier                    TEXT,
+    msisdn                     TEXT        NOT NULL UNIQUE,
+    name                       TEXT,
+    promocode                  TEXT,
+    my_promocode               TEXT,
+    profile_url                TEXT,
+    balance                    NUMERIC,
+    bonus                      NUMERIC,
+    bonus_expiry               TIMESTAMPTZ,
+    bonus_turn_into_real_money NUMERIC,
+    free_bet                   NUMERIC,
+    freebet_expiry             TIMESTAMPTZ,
+    freebet_count              BIGINT,
+    is_free                    TEXT,
+    monetary                   NUMERIC,
+    frequency                  BIGINT,
+    total_bets                 NUMERIC,
+    payout                     NUMERIC,
+    total_losses               NUMERIC,
+    lost_count                 BIGINT,
+    total_loss_count           BIGINT,
+    total_withdrawal           NUMERIC,
+    rtp_player                 NUMERIC,
+    last_stake_amount          NUMERIC,
+    last_transaction_time      TIMESTAMPTZ,
+    show_win                   TEXT,
+    status                     TEXT,
+    active_status              TEXT        DEFAULT 'active',
+    self_exclusion             TEXT        DEFAULT 'NO',
+    self_exclusion_expiry      TIMESTAMPTZ,
+    subscription_id            TEXT,
+    date_created               TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "Attempted_Players" (
+    id           BIGSERIAL PRIMARY KEY,
+    msisdn       TEXT        NOT NULL,
+    new_msisdn   TEXT        NOT NULL,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "PawaBox_KeSettings" (
+    id                 BIGSERIAL PRIMARY KEY,
+    default_rtp        NUMERIC,
+    adjustmentable_rtp NUMERIC,
+    vig_percentage     NUMERIC,
+    jackpot_percentage NUMERIC,
+    rtp_overload       NUMERIC,
+    min_win_multipier  NUMERIC,
+    max_win_multipier  NUMERIC,
+    min_loss_count     INTEGER,
+    withholding        NUMERIC,
+    excise_duty        NUMERIC
+);
+
+CREATE TABLE IF NOT EXISTS "Games" (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT,
+    title        TEXT,
+    description  TEXT,
+    name_init    TEXT,
+    category     TEXT,
+    org          TEXT,
+    status       TEXT,
+    boxes        TEXT,
+    max_exposure NUMERIC,
+    max_win      NUMERIC,
+    bet_amount   NUMERIC
+);
+
+CREATE TABLE IF NOT EXISTS "awards" (
+    id        BIGSERIAL PRIMARY KEY,
+    name      TEXT,
+    name_init TEXT,
+    value     NUMERIC,
+    status    TEXT
+);
+
+CREATE TABLE IF NOT EXISTS "Bets" (
+    id              BIGSERIAL PRIMARY KEY,
+    game_cat_id     TEXT,
+    game_name       TEXT,
+    channel         TEXT,
+    bet_type        TEXT,
+    result_status   TEXT,
+    results         TEXT,
+    game            TEXT,
+    reference       TEXT        NOT NULL DEFAULT '',
+    amount          NUMERIC,
+    msisdn          TEXT,
+    selected_number TEXT,
+    status          TEXT,
+    win_amount      NUMERIC,
+    date_created    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "deposit_requests" (
+    id             BIGSERIAL PRIMARY KEY,
+    deposit_type   TEXT,
+    status         TEXT        DEFAULT 'pending',
+    transaction_id TEXT,
+    description    TEXT,
+    ussd           TEXT,
+    game           TEXT,
+    carrier        TEXT,
+    channel        TEXT,
+    game_cat_id    TEXT,
+    amount         NUMERIC,
+    msisdn         TEXT,
+    selected_box   TEXT,
+    reference      TEXT        NOT NULL DEFAULT '',
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "deposit" (
+    id             BIGSERIAL PRIMARY KEY,
+    deposit_type   TEXT,
+    msisdn         TEXT,
+    amount         NUMERIC,
+    transaction_id TEXT,
+    shortcode      TEXT,
+    name           TEXT,
+    mreference     TEXT,
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "stk_queue_ke" (
+    id           BIGSERIAL PRIMARY KEY,
+    game         TEXT,
+    carrier      TEXT,
+    reference    TEXT,
+    msisdn       TEXT,
+    amount       NUMERIC,
+    account      TEXT,
+    shortcode    TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Written by the STK gateway with its own statuses
+CREATE TABLE IF NOT EXISTS "stk_results" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT,
+    status       TEXT,
+    description  TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "withdrawals" (
+    id                  BIGSERIAL PRIMARY KEY,
+    reference           TEXT,
+    msisdn              TEXT,
+    amount              NUMERIC,
+    non_roundoff_amount NUMERIC,
+    tax_amount          NUMERIC,
+    items               TEXT,
+    game_id             TEXT,
+    status              TEXT        DEFAULT 'pending',
+    disburse            TEXT,
+    transaction_id      TEXT,
+    date_created        TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "withdrawal_b2b_to_process" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT,
+    msisdn       TEXT,
+    amount       NUMERIC,
+    bet_status   TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "pending_withdrawals" (
+    id           BIGSERIAL PRIMARY KEY,
+    tax_amount   NUMERIC,
+    items        TEXT,
+    reference    TEXT,
+    amount       NUMERIC,
+    msisdn       TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "withdrawal_queue_ke" (
+    id           BIGSERIAL PRIMARY KEY,
+    reference    TEXT,
+    msisdn       TEXT,
+    amount       NUMERIC,
+    callback     TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "mpesa_disburse" (
+    id             BIGSERIAL PRIMARY KEY,
+    transaction_id TEXT,
+    reference      TEXT,
+    msisdn         TEXT,
+    amount         NUMERIC,
+    date_created   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "CustomerLogs" (
+    id           BIGSERIAL PRIMARY KEY,
+    customer_id  TEXT,
+    type         TEXT,
+    narrative    TEXT,
+    amount       NUMERIC,
+    game_id      TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "Basket" (
+    id     BIGSERIAL PRIMARY KEY,
+    amount NUMERIC NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "BasketLogs" (
+    id           BIGSERIAL PRIMARY KEY,
+    credit       NUMERIC,
+    debit        NUMERIC,
+    amount       NUMERIC,
+    narrative    TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "HouseIncome" (
+    id           BIGSERIAL PRIMARY KEY,
+    house_income NUMERIC NOT NULL DEFAULT 0,
+    total_bets   NUMERIC NOT NULL DEFAULT 0,
+    total_wins   NUMERIC NOT NULL DEFAULT 0,
+    total_losses NUMERIC NOT NULL DEFAULT 0,
+    current_rtp  NUMERIC NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "HouseIncomeLogs" (
+    id                      BIGSERIAL PRIMARY KEY,
+    game_id                 TEXT,
+    msisdn                  TEXT,
+    house_income            NUMERIC,
+    total_bets              NUMERIC,
+    total_wins              NUMERIC,
+    total_losses            NUMERIC,
+    vig                     NUMERIC,
+    jackpot_amount          NUMERIC,
+    excise_duty_tax_amount  NUMERIC,
+    withholding_tax_amount  NUMERIC,
+    date_created            TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "kpi" (
+    id         BIGSERIAL PRIMARY KEY,
+    date       DATE    NOT NULL,
+    handle     NUMERIC NOT NULL DEFAULT 0,
+    payout     NUMERIC NOT NULL DEFAULT 0,
+    ggr        NUMERIC NOT NULL DEFAULT 0,
+    bet        NUMERIC NOT NULL DEFAULT 0,
+    bet_count  BIGINT  NOT NULL DEFAULT 0,
+    win_count  BIGINT  NOT NULL DEFAULT 0,
+    loss_count BIGINT  NOT NULL DEFAULT 0,
+    rtp        NUMERIC NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS "tax_record" (
+    id           BIGSERIAL PRIMARY KEY,
+    game_id      TEXT,
+    amount       NUMERIC,
+    tax_amount   NUMERIC,
+    after_tax    NUMERIC,
+    tax_type     TEXT,
+    msisdn       TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "jackpot_kitty" (
+    id              BIGSERIAL PRIMARY KEY,
+    name_init       TEXT,
+    item_name       TEXT,
+    kitty           NUMERIC NOT NULL DEFAULT 0,
+    cost            NUMERIC NOT NULL DEFAULT 0,
+    pct_slice       NUMERIC NOT NULL DEFAULT 0,
+    pct_to_target   NUMERIC NOT NULL DEFAULT 0,
+    is_locked       INTEGER NOT NULL DEFAULT 0,
+    win_count       INTEGER NOT NULL DEFAULT 0,
+    release_jackpot TEXT
+);
+
+CREATE TABLE IF NOT EXISTS "jackpot_winners" (
+    id               BIGSERIAL PRIMARY KEY,
+    tax_amount       NUMERIC,
+    items            TEXT,
+    game_id          TEXT,
+    game_name        TEXT,
+    jackpot_category TEXT,
+    kitty_id         TEXT,
+    amount           NUMERIC,
+    msisdn           TEXT,
+    awarded          TEXT,
+    date_created     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "promocode" (
+    id           BIGSERIAL PRIMARY KEY,
+    msisdn       TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "dbQueue" (
+    "RecordID"         BIGSERIAL PRIMARY KEY,
+    "Originator"       TEXT,
+    "Destination"      TEXT,
+    "Message"          TEXT,
+    "MessageDirection" TEXT,
+    "MessageTimeStamp" TIMESTAMPTZ,
+    "SMSCID"           TEXT,
+    command            TEXT
+);
+
+CREATE TABLE IF NOT EXISTS verification (
+    id      BIGSERIAL PRIMARY KEY,
+    msisdn  TEXT    NOT NULL,
+    code    TEXT    NOT NULL,
+    status  INTEGER NOT NULL DEFAULT 0,
+    expired BIGINT  NOT NULL,
+    created BIGINT  NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS self_exlusion_request (
+    id           BIGSERIAL PRIMARY KEY,
+    msisdn       TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- The USSD tables live in the "Aviator" schema, shared with the Aviator game
+CREATE SCHEMA IF NOT EXISTS "Aviator";
+
+CREATE TABLE IF NOT EXISTS "Aviator"."ussd_session" (
+    id           BIGSERIAL PRIMARY KEY,
+    sessionid    TEXT,
+    servicecode  TEXT,
+    msisdn       TEXT,
+    ussdstring   TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "Aviator"."ussd_logs" (
+    id           BIGSERIAL PRIMARY KEY,
+    game_id      BIGINT,
+    sessionid    TEXT,
+    msisdn       TEXT,
+    payload      TEXT,
+    status       TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS "Aviator"."ussd_log_inputs" (
+    id           BIGSERIAL PRIMARY KEY,
+    ussd_code    TEXT,
+    sessionid    TEXT,
+    msisdn       TEXT,
+    ussd_menu    TEXT,
+    date_created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
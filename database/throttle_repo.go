@@ -0,0 +1,14 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// BetThrottleRepo holds what bets are paced by and forced wins earned with
+type BetThrottleRepo interface {
+	AdmitBet(ctx context.Context, msisdn string, cooldown time.Duration, perMinute int) (bool, map[string]interface{}, error)
+	CountDepositsSince(ctx context.Context, msisdn string, since time.Time) (int64, error)
+}
+
+var _ BetThrottleRepo = (*Database)(nil)
@@ -0,0 +1,21 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// TokenRepo holds the refresh tokens behind /refresh_token and the access
+// tokens JWTMiddleware checks for revocation
+type TokenRepo interface {
+	InsertRefreshToken(ctx context.Context, msisdn, deviceID, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(ctx context.Context, oldHash, deviceID, newHash string, expiresAt time.Time) (string, error)
+	RevokeRefreshTokens(ctx context.Context, msisdn, deviceID string) (int64, error)
+
+	InsertAccessToken(ctx context.Context, jti, msisdn string, expiresAt time.Time) error
+	AccessTokenRevoked(ctx context.Context, jti string) (bool, error)
+	RevokeAccessToken(ctx context.Context, msisdn, jti string) (bool, error)
+	RevokeAccessTokens(ctx context.Context, msisdn string) ([]string, error)
+}
+
+var _ TokenRepo = (*Database)(nil)
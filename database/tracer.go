@@ -0,0 +1,72 @@
+package database
+
+import (
+	"context"
+	"fiberapp/utils"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+)
+
+type traceStartKey struct{}
+
+type traceStart struct {
+	name    string
+	startAt time.Time
+}
+
+// queryTracer logs every query with its duration and the request ID carried
+// in the context. It never logs arguments or row values.
+type queryTracer struct{}
+
+// TraceQueryStart implements pgx.QueryTracer
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, traceStartKey{}, traceStart{name: queryName(data.SQL), startAt: time.Now()})
+}
+
+// TraceQueryEnd implements pgx.QueryTracer
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(traceStartKey{}).(traceStart)
+	if !ok {
+		return
+	}
+
+	entry := withRequestID(ctx, logrus.StandardLogger()).WithFields(logrus.Fields{
+		"query":       start.name,
+		"duration_ms": time.Since(start.startAt).Milliseconds(),
+	})
+	if data.Err != nil {
+		entry.WithError(data.Err).Warn("db query failed")
+		return
+	}
+	entry.Debug("db query")
+}
+
+// queryName condenses a SQL statement to its leading keywords and table,
+// e.g. `UPDATE "Player"` or `SELECT ... FROM "withdrawals"`
+func queryName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	verb := strings.ToUpper(fields[0])
+	for i, f := range fields {
+		switch strings.ToUpper(f) {
+		case "FROM", "INTO", "UPDATE":
+			if i+1 < len(fields) {
+				return verb + " " + strings.TrimSuffix(fields[i+1], ";")
+			}
+		}
+	}
+	return verb
+}
+
+// withRequestID tags log with the request ID from ctx, if any
+func withRequestID(ctx context.Context, log logrus.FieldLogger) logrus.FieldLogger {
+	if id := utils.RequestIDFromContext(ctx); id != "" {
+		return log.WithField("request_id", id)
+	}
+	return log
+}
@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fiberapp/utils"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestQueryTracerLogsNameDurationAndRequestID(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+	defer logrus.SetLevel(logrus.GetLevel())
+	logrus.SetLevel(logrus.DebugLevel)
+
+	ctx := utils.ContextWithRequestID(context.Background(), "req-1")
+	var tr queryTracer
+	ctx = tr.TraceQueryStart(ctx, nil, pgx.TraceQueryStartData{
+		SQL:  `SELECT * FROM "Player" WHERE msisdn = $1`,
+		Args: []any{"254712345678"},
+	})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{})
+
+	entry := hook.LastEntry()
+	if entry == nil {
+		t.Fatal("tracer logged nothing")
+	}
+	if entry.Level != logrus.DebugLevel || entry.Message != "db query" {
+		t.Errorf("entry = %s %q, want debug \"db query\"", entry.Level, entry.Message)
+	}
+	if entry.Data["request_id"] != "req-1" || entry.Data["query"] != `SELECT "Player"` {
+		t.Errorf("fields = %v", entry.Data)
+	}
+	if _, ok := entry.Data["duration_ms"]; !ok {
+		t.Error("duration_ms missing")
+	}
+	for _, v := range entry.Data {
+		if s, ok := v.(string); ok && strings.Contains(s, "254712345678") {
+			t.Errorf("tracer logged a query argument: %v", entry.Data)
+		}
+	}
+
+	ctx = tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: `UPDATE "Bets" SET status = 1`})
+	tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("boom")})
+	if entry := hook.LastEntry(); entry.Level != logrus.WarnLevel || entry.Data["query"] != `UPDATE "Bets"` {
+		t.Errorf("failed query logged as %s %v, want a warning", entry.Level, entry.Data)
+	}
+	if _, ok := hook.LastEntry().Data["request_id"]; ok {
+		t.Error("request_id set without one in the context")
+	}
+}
+
+func TestQueryName(t *testing.T) {
+	cases := map[string]string{
+		`SELECT id FROM "Player" WHERE msisdn = $1`:   `SELECT "Player"`,
+		`INSERT INTO "Bets" (msisdn) VALUES ($1)`:     `INSERT "Bets"`,
+		"  update \"house\" set basket = basket + $1": `UPDATE "house"`,
+		`WITH x AS (SELECT 1) SELECT * FROM x;`:       "WITH x",
+		`BEGIN`:                                       "BEGIN",
+		``:                                            "",
+	}
+	for sql, want := range cases {
+		if got := queryName(sql); got != want {
+			t.Errorf("queryName(%q) = %q, want %q", sql, got, want)
+		}
+	}
+}
+
+// rowValueNames are the variables the package scans rows into. Logging any
+// of them would put row contents, phone numbers included, in the logs.
+var rowValueNames = map[string]bool{
+	"row": true, "rows": true, "result": true, "results": true, "rowMap": true, "values": true, "record": true,
+}
+
+var logMethods = map[string]bool{
+	"Print": true, "Printf": true, "Println": true,
+	"Debug": true, "Debugf": true, "Info": true, "Infof": true,
+	"Warn": true, "Warnf": true, "Error": true, "Errorf": true,
+}
+
+func TestNoRowContentLogging(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			if id, ok := call.Fun.(*ast.Ident); ok && (id.Name == "println" || id.Name == "print") {
+				t.Errorf("%s: %s; log through db.logFor or logrus", fset.Position(call.Pos()), id.Name)
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !logMethods[sel.Sel.Name] {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "log" || pkg.Name == "fmt") {
+				if strings.HasPrefix(sel.Sel.Name, "Print") {
+					t.Errorf("%s: %s.%s; log through db.logFor or logrus", fset.Position(call.Pos()), pkg.Name, sel.Sel.Name)
+				}
+				return true
+			}
+			for _, arg := range call.Args {
+				if id, ok := arg.(*ast.Ident); ok && rowValueNames[id.Name] {
+					t.Errorf("%s: logs %s", fset.Position(call.Pos()), id.Name)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// secretName reports whether a variable named name holds a phone number,
+// a code or an OTP, which must not reach a log as is
+func secretName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "msisdn") || strings.Contains(name, "otp") || name == "code"
+}
+
+func TestLoggedMsisdnsRedacted(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok || !(logMethods[sel.Sel.Name] || sel.Sel.Name == "WithField") {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && (pkg.Name == "fmt" || pkg.Name == "errors") {
+				return true
+			}
+			// Only direct arguments: utils.RedactMsisdn(msisdn) is a call
+			for _, arg := range call.Args {
+				if id, ok := arg.(*ast.Ident); ok && secretName(id.Name) {
+					t.Errorf("%s: logs %s unredacted; wrap it in utils.RedactMsisdn", fset.Position(call.Pos()), id.Name)
+				}
+			}
+			return true
+		})
+	}
+}
+
+func TestLogForUsesInjectedLogger(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.SetLevel(logrus.DebugLevel)
+	db := NewDatabaseWithPool(nil, logger)
+
+	db.logFor(utils.ContextWithRequestID(context.Background(), "req-7")).Debugf("sms queued for %s", utils.RedactMsisdn("254712345678"))
+	entry := hook.LastEntry()
+	if entry == nil || entry.Data["request_id"] != "req-7" {
+		t.Fatalf("entry = %v, want the injected logger tagged with the request id", entry)
+	}
+	if strings.Contains(entry.Message, "254712345678") || !strings.Contains(entry.Message, "254712****78") {
+		t.Errorf("message %q, want the msisdn redacted", entry.Message)
+	}
+}
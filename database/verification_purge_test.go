@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type verificationRow struct {
+	expired, created int64
+	status           int
+}
+
+// verificationTable stands in for verification and applies the purge
+// DELETE's WHERE and LIMIT to its rows
+type verificationTable struct {
+	rows    []verificationRow
+	batches []int64
+}
+
+func (v *verificationTable) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if !strings.Contains(sql, "DELETE FROM verification") {
+		return pgconn.CommandTag{}, fmt.Errorf("unexpected statement %q", sql)
+	}
+	cutoff, limit := args[0].(int64), args[1].(int)
+	var kept []verificationRow
+	var deleted int64
+	for _, r := range v.rows {
+		if deleted < int64(limit) && (r.expired < cutoff || (r.status == 1 && r.created < cutoff)) {
+			deleted++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	v.rows = kept
+	v.batches = append(v.batches, deleted)
+	return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", deleted)), nil
+}
+
+func TestPurgeVerificationBatches(t *testing.T) {
+	now := time.Now().Unix()
+	cutoff := now - 86400
+	table := &verificationTable{}
+	for i := 0; i < 2*verificationPurgeBatch+1234; i++ {
+		table.rows = append(table.rows, verificationRow{expired: cutoff - 60 - int64(i), created: cutoff - 180})
+	}
+	inFlight := verificationRow{expired: now + 120, created: now}
+	usedRecently := verificationRow{expired: cutoff + 60, created: cutoff + 1, status: 1}
+	atCutoff := verificationRow{expired: cutoff, created: cutoff - 120}
+	usedLongAgo := verificationRow{expired: now + 120, created: cutoff - 1, status: 1}
+	table.rows = append(table.rows, inFlight, usedRecently, atCutoff, usedLongAgo)
+
+	purged, err := purgeVerificationBatches(context.Background(), table, cutoff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(2*verificationPurgeBatch + 1235); purged != want {
+		t.Errorf("purged %d rows, want %d", purged, want)
+	}
+	if want := []int64{verificationPurgeBatch, verificationPurgeBatch, 1235}; fmt.Sprint(table.batches) != fmt.Sprint(want) {
+		t.Errorf("batches = %v, want %v", table.batches, want)
+	}
+	// Retention is exclusive: a row expiring exactly at the cutoff stays
+	if want := []verificationRow{inFlight, usedRecently, atCutoff}; fmt.Sprint(table.rows) != fmt.Sprint(want) {
+		t.Errorf("kept %v, want %v", table.rows, want)
+	}
+}
+
+func TestPurgeVerificationBatchesNeverTouchesLiveCodes(t *testing.T) {
+	now := time.Now().Unix()
+	table := &verificationTable{}
+	for i := 0; i < 3*verificationPurgeBatch; i++ {
+		table.rows = append(table.rows, verificationRow{expired: now + 120, created: now - int64(i%100)})
+	}
+
+	purged, err := purgeVerificationBatches(context.Background(), table, now-86400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 0 || len(table.rows) != 3*verificationPurgeBatch {
+		t.Errorf("purged %d of %d live codes, want none", purged, 3*verificationPurgeBatch)
+	}
+	if len(table.batches) != 1 {
+		t.Errorf("ran %d statements, want one that stops the loop", len(table.batches))
+	}
+}
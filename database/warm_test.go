@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+	"fiberapp/config"
+	"testing"
+)
+
+func TestWarmPoolNotConnected(t *testing.T) {
+	saved := globalPool
+	globalPool = nil
+	defer func() { globalPool = saved }()
+	if err := WarmPool(context.Background(), config.Default().Database); err == nil {
+		t.Error("WarmPool without a pool succeeded")
+	}
+}
+
+// TestWarmQueriesNamed keeps the warm queries and the names config accepts
+// for them in step
+func TestWarmQueriesNamed(t *testing.T) {
+	queries := warmQueries()
+	if len(queries) != len(config.WarmQueryNames) {
+		t.Errorf("%d warm queries, %d names", len(queries), len(config.WarmQueryNames))
+	}
+	for _, name := range config.WarmQueryNames {
+		if q, ok := queries[name]; !ok || q.sql == "" {
+			t.Errorf("config names %q, which WarmPool has no query for", name)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"fiberapp/status"
+	"time"
+)
+
+// WebhookRepo holds partner webhook subscriptions, their event outbox and
+// the delivery log
+type WebhookRepo interface {
+	ListWebhookSubscriptions(ctx context.Context) ([]map[string]interface{}, error)
+	GetWebhookSubscription(ctx context.Context, id int64) (map[string]interface{}, error)
+	CreateWebhookSubscription(ctx context.Context, partnerID, targetURL, secret string, eventTypes []string, active bool) (int64, error)
+	UpdateWebhookSubscription(ctx context.Context, id int64, partnerID, targetURL, secret string, eventTypes []string, active bool) (int64, error)
+	DeleteWebhookSubscription(ctx context.Context, id int64) (int64, error)
+	EnqueueWebhookEvent(ctx context.Context, eventType, msisdn string, payload []byte) (int64, error)
+	ClaimWebhookEvents(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error)
+	RecordWebhookDelivery(ctx context.Context, eventID int64, attempt, statusCode int, deliveryErr string, elapsed time.Duration, state status.WebhookStatus, nextAttemptAt time.Time) error
+	ListWebhookDeliveries(ctx context.Context, subscriptionID int64, limit, offset int) ([]map[string]interface{}, int64, error)
+}
+
+var _ WebhookRepo = (*Database)(nil)
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// WithdrawalItemsBalance is the "withdrawals".items of a balance
+// withdrawal, telling it apart from a win paid out
+const WithdrawalItemsBalance = "balance"
+
+var (
+	ErrWithdrawalPlayer = errors.New("player not found or inactive")
+	// ErrWithdrawalVelocity is matched by every *WithdrawalVelocityError
+	ErrWithdrawalVelocity = errors.New("withdrawal limit reached")
+)
+
+// WithdrawalLimits caps a player's balance withdrawals made since Since,
+// the start of the rolling window. 0 turns a cap off.
+type WithdrawalLimits struct {
+	MaxCount  int
+	MaxAmount float64
+	Since     time.Time
+}
+
+// WithdrawalVelocityError is a withdrawal refused because, with it, the
+// player's withdrawals in the window would pass a cap. Count and Total are
+// what the player had already withdrawn in the window.
+type WithdrawalVelocityError struct {
+	Count  int64
+	Total  float64
+	Amount float64
+	Limits WithdrawalLimits
+}
+
+func (e *WithdrawalVelocityError) Error() string {
+	if e.Limits.MaxCount > 0 && e.Count+1 > int64(e.Limits.MaxCount) {
+		return fmt.Sprintf("withdrawal limit reached: %d withdrawals since %s, at most %d allowed",
+			e.Count, e.Limits.Since.Format(time.RFC3339), e.Limits.MaxCount)
+	}
+	return fmt.Sprintf("withdrawal limit reached: Ksh.%.2f withdrawn since %s, Ksh.%.2f more would pass Ksh.%.2f",
+		e.Total, e.Limits.Since.Format(time.RFC3339), e.Amount, e.Limits.MaxAmount)
+}
+
+func (e *WithdrawalVelocityError) Is(target error) bool { return target == ErrWithdrawalVelocity }
+
+// Check refuses amount when, added to count withdrawals totalling total
+// already made in the window, it would pass either cap
+func (l WithdrawalLimits) Check(count int64, total, amount float64) error {
+	if (l.MaxCount > 0 && count+1 > int64(l.MaxCount)) || (l.MaxAmount > 0 && total+amount > l.MaxAmount) {
+		return &WithdrawalVelocityError{Count: count, Total: total, Amount: amount, Limits: l}
+	}
+	return nil
+}
+
+// WithdrawalRepo holds player withdrawals of wallet balance. Migration 052
+// adds the balance_withdrawals table and the limits in "PawaBox_KeSettings".
+type WithdrawalRepo interface {
+	WithdrawBalance(ctx context.Context, msisdn string, amount float64, reference string, limits WithdrawalLimits) (float64, error)
+	CheckBalanceWithdrawal(ctx context.Context, msisdn string, amount float64, limits WithdrawalLimits) error
+}
+
+var _ WithdrawalRepo = (*Database)(nil)
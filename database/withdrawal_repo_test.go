@@ -0,0 +1,49 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithdrawalLimitsCheck(t *testing.T) {
+	since := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	limits := WithdrawalLimits{MaxCount: 3, MaxAmount: 5000, Since: since}
+	cases := []struct {
+		name   string
+		limits WithdrawalLimits
+		count  int64
+		total  float64
+		amount float64
+		ok     bool
+	}{
+		{"first", limits, 0, 0, 500, true},
+		{"last allowed", limits, 2, 1000, 500, true},
+		{"one too many", limits, 3, 1000, 500, false},
+		{"up to the amount", limits, 1, 4000, 1000, true},
+		{"past the amount", limits, 1, 4000, 1000.01, false},
+		{"count off", WithdrawalLimits{MaxAmount: 5000}, 50, 0, 100, true},
+		{"amount off", WithdrawalLimits{MaxCount: 3}, 0, 1e6, 1e6, true},
+	}
+	for _, tc := range cases {
+		err := tc.limits.Check(tc.count, tc.total, tc.amount)
+		if tc.ok != (err == nil) {
+			t.Errorf("%s: Check = %v, want ok %v", tc.name, err, tc.ok)
+		}
+		if err != nil && !errors.Is(err, ErrWithdrawalVelocity) {
+			t.Errorf("%s: %v should match ErrWithdrawalVelocity", tc.name, err)
+		}
+	}
+}
+
+func TestWithdrawalVelocityErrorNamesTheCap(t *testing.T) {
+	since := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	limits := WithdrawalLimits{MaxCount: 3, MaxAmount: 5000, Since: since}
+	if err := limits.Check(3, 100, 100); !strings.Contains(err.Error(), "3 withdrawals since 2026-03-01T09:00:00Z") {
+		t.Errorf("count refusal = %q, want the count and window", err)
+	}
+	if err := limits.Check(1, 4900, 200); !strings.Contains(err.Error(), "Ksh.4900.00 withdrawn") {
+		t.Errorf("amount refusal = %q, want the total", err)
+	}
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// Outcomes of a withdrawal re-drive, as stored in withdrawal_retries
+const (
+	WithdrawalRequeued = "requeued"
+	WithdrawalManual   = "manual"
+)
+
+// WithdrawalRetry is a re-drive RetryWithdrawal recorded. Attempt counts
+// the re-drives including this one; a manual outcome is not requeued.
+type WithdrawalRetry struct {
+	Msisdn    string
+	Amount    float64
+	Reference string
+	Attempt   int
+	Outcome   string
+}
+
+// WithdrawalRetryRepo holds the admin re-drives of processed withdrawals
+// the disbursement partner never paid. Migration 039 adds the counters to
+// "withdrawals" and the withdrawal_retries audit table.
+type WithdrawalRetryRepo interface {
+	FindUndisbursedWithdrawals(ctx context.Context, olderThan time.Duration, limit, offset int) ([]map[string]interface{}, int64, error)
+	RetryWithdrawal(ctx context.Context, reference, admin string, maxRetries int, awaitCallback time.Duration) (*WithdrawalRetry, error)
+}
+
+var _ WithdrawalRetryRepo = (*Database)(nil)
@@ -0,0 +1,62 @@
+package dbtest
+
+import (
+	"context"
+	"fiberapp/clock"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SeedPlayer inserts an active player holding balance in cash, with every
+// other counter at 0
+func SeedPlayer(t testing.TB, pool *pgxpool.Pool, msisdn string, balance float64) {
+	t.Helper()
+	Exec(t, pool, `INSERT INTO "Player" (msisdn, balance, bonus, free_bet, monetary, total_bets, payout, total_losses, lost_count)
+		VALUES ($1, $2, 0, 0, 0, 0, 0, 0, 0)`, msisdn, balance)
+}
+
+// SeedGame inserts an active seven-box game under id, staked at 20
+func SeedGame(t testing.TB, pool *pgxpool.Pool, id int64, name, nameInit string) {
+	t.Helper()
+	Exec(t, pool, `INSERT INTO "Games" (id, name, name_init, category, status, boxes, bet_amount, max_win, max_exposure)
+		VALUES ($1, $2, $3, 'Money Prize', 'active', '7', 20, 3000000, 100000)`, id, name, nameInit)
+}
+
+// SeedSettings inserts the settings row, with values the services accept.
+// A test wanting others updates the row after.
+func SeedSettings(t testing.TB, pool *pgxpool.Pool) {
+	t.Helper()
+	Exec(t, pool, `INSERT INTO "PawaBox_KeSettings" (default_rtp, adjustmentable_rtp, vig_percentage, jackpot_percentage,
+			rtp_overload, min_win_multipier, max_win_multipier, min_loss_count, withholding, excise_duty)
+		VALUES (85, 5, 10, 5, 0, 1, 10, 3, 20, 12.5)`)
+}
+
+// SeedKPI inserts the kpi row of day's business day with handle staked and
+// payout paid
+func SeedKPI(t testing.TB, pool *pgxpool.Pool, day time.Time, handle, payout float64) {
+	t.Helper()
+	Exec(t, pool, `INSERT INTO "kpi" (date, handle, payout, ggr, bet) VALUES ($1::date, $2, $3, $2 - $3, $2)`,
+		day.In(clock.Location()).Format("2006-01-02"), handle, payout)
+}
+
+// PlayerBalance is msisdn's cash balance
+func PlayerBalance(t testing.TB, pool *pgxpool.Pool, msisdn string) float64 {
+	t.Helper()
+	var balance float64
+	if err := pool.QueryRow(context.Background(), `SELECT balance::float8 FROM "Player" WHERE msisdn = $1`, msisdn).Scan(&balance); err != nil {
+		t.Fatalf("dbtest: balance of %s: %v", msisdn, err)
+	}
+	return balance
+}
+
+// CountRows runs a SELECT COUNT(*) query
+func CountRows(t testing.TB, pool *pgxpool.Pool, sql string, args ...interface{}) int64 {
+	t.Helper()
+	var n int64
+	if err := pool.QueryRow(context.Background(), sql, args...).Scan(&n); err != nil {
+		t.Fatalf("dbtest: %s: %v", sql, err)
+	}
+	return n
+}
@@ -0,0 +1,128 @@
+// Package flags decides, per player, whether a feature being rolled out is
+// on. A flag is on for the msisdns on its allowlist and for a stable
+// percentage of everyone else: a player's bucket comes from a hash of the
+// flag name and their msisdn, so they see the same side of the flag on
+// every request and raising the percentage only adds players.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Flags the code checks. An admin can only set these.
+const (
+	// ResponseV2 answers bets without X-API-Version in version 2
+	ResponseV2 = "response_v2"
+	// TightBasket caps a normal game's wins at a smaller share of the basket
+	TightBasket = "outcome_tight_basket"
+)
+
+// Known lists the flags the code checks
+var Known = []string{ResponseV2, TightBasket}
+
+// Buckets is how many buckets players are hashed into, one per percent
+const Buckets = 100
+
+// Flag is a feature's rollout. Disabled, it is off for everyone, the
+// allowlist included.
+type Flag struct {
+	Name       string   `json:"name" example:"response_v2"`
+	Enabled    bool     `json:"enabled"`
+	Percentage int      `json:"percentage" example:"5"` // of players, 0 to 100
+	Allowlist  []string `json:"allowlist"`
+}
+
+// On reports whether the flag is on for msisdn
+func (f Flag) On(msisdn string) bool {
+	if !f.Enabled {
+		return false
+	}
+	if msisdn != "" && slices.Contains(f.Allowlist, msisdn) {
+		return true
+	}
+	return Bucket(f.Name, msisdn) < f.Percentage
+}
+
+// Bucket returns msisdn's bucket for flag name, 0 to Buckets-1. Hashing the
+// name in keeps the players of different flags independent.
+func Bucket(name, msisdn string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(msisdn))
+	return int(h.Sum32() % Buckets)
+}
+
+// IsKnown reports whether name is one of the flags the code checks
+func IsKnown(name string) bool {
+	return slices.Contains(Known, name)
+}
+
+var lookup func(ctx context.Context, name string) (Flag, error)
+
+// Configure sets where flags are read from. lookup should be cheap: it is
+// called for every check. Until it is set every flag is off.
+func Configure(fn func(ctx context.Context, name string) (Flag, error)) {
+	lookup = fn
+}
+
+// IsEnabled reports whether flag name is on for msisdn and records the
+// decision on ctx for the request log. A flag that fails to load is off.
+func IsEnabled(ctx context.Context, name, msisdn string) bool {
+	on := false
+	if lookup != nil {
+		f, err := lookup(ctx, name)
+		if err != nil {
+			logrus.Errorf("flags: failed to load %s: %v", name, err)
+		} else {
+			on = f.On(msisdn)
+		}
+	}
+	if d, ok := ctx.Value(decisionsKey{}).(*decisions); ok {
+		d.add(name, on)
+	}
+	return on
+}
+
+type decisionsKey struct{}
+
+// decisions are the flags checked while serving one request
+type decisions struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (d *decisions) add(name string, on bool) {
+	entry := name + "=off"
+	if on {
+		entry = name + "=on"
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !slices.Contains(d.list, entry) {
+		d.list = append(d.list, entry)
+	}
+}
+
+// WithDecisions returns a copy of ctx that records the flags checked with it
+func WithDecisions(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decisionsKey{}, &decisions{})
+}
+
+// Decisions returns the flags checked with ctx, such as
+// "response_v2=on,outcome_tight_basket=off", or "" when none were
+func Decisions(ctx context.Context) string {
+	d, ok := ctx.Value(decisionsKey{}).(*decisions)
+	if !ok {
+		return ""
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return strings.Join(d.list, ",")
+}
@@ -0,0 +1,145 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// msisdn returns the i-th test msisdn
+func msisdn(i int) string {
+	return fmt.Sprintf("2547%08d", i)
+}
+
+// configure serves flags from set for the test
+func configure(t *testing.T, set map[string]Flag) {
+	t.Helper()
+	Configure(func(ctx context.Context, name string) (Flag, error) {
+		return set[name], nil
+	})
+	t.Cleanup(func() { Configure(nil) })
+}
+
+func TestBucketIsStable(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		b := Bucket(ResponseV2, msisdn(i))
+		if b < 0 || b >= Buckets {
+			t.Fatalf("bucket %d out of range", b)
+		}
+		for j := 0; j < 3; j++ {
+			if again := Bucket(ResponseV2, msisdn(i)); again != b {
+				t.Fatalf("%s moved from bucket %d to %d", msisdn(i), b, again)
+			}
+		}
+	}
+
+	// The same players are not in the first buckets of every flag
+	same := 0
+	for i := 0; i < 10000; i++ {
+		if (Bucket(ResponseV2, msisdn(i)) < 10) == (Bucket(TightBasket, msisdn(i)) < 10) {
+			same++
+		}
+	}
+	if same > 9000 {
+		t.Errorf("%d of 10000 players on the same side of two 10%% flags, want the flags independent", same)
+	}
+}
+
+func TestPercentageAccuracy(t *testing.T) {
+	const n = 200000
+	for _, pct := range []int{1, 5, 50, 95} {
+		f := Flag{Name: ResponseV2, Enabled: true, Percentage: pct}
+		on := 0
+		for i := 0; i < n; i++ {
+			if f.On(msisdn(i)) {
+				on++
+			}
+		}
+		// Within five standard deviations of the binomial mean
+		p := float64(pct) / 100
+		if sd := math.Sqrt(n * p * (1 - p)); math.Abs(float64(on)-n*p) > 5*sd {
+			t.Errorf("%d%% flag on for %d of %d players, want about %d", pct, on, n, int(n*p))
+		}
+	}
+
+	for _, pct := range []int{0, 100} {
+		f := Flag{Name: ResponseV2, Enabled: true, Percentage: pct}
+		for i := 0; i < 1000; i++ {
+			if f.On(msisdn(i)) != (pct == 100) {
+				t.Fatalf("%d%% flag is %t for %s", pct, f.On(msisdn(i)), msisdn(i))
+			}
+		}
+	}
+}
+
+func TestRaisingPercentageOnlyAddsPlayers(t *testing.T) {
+	low := Flag{Name: ResponseV2, Enabled: true, Percentage: 5}
+	high := Flag{Name: ResponseV2, Enabled: true, Percentage: 20}
+	for i := 0; i < 10000; i++ {
+		if low.On(msisdn(i)) && !high.On(msisdn(i)) {
+			t.Fatalf("%s dropped out going from 5%% to 20%%", msisdn(i))
+		}
+	}
+}
+
+func TestAllowlistOverride(t *testing.T) {
+	// A player outside the 1% bucket
+	outside := ""
+	for i := 0; outside == ""; i++ {
+		if Bucket(ResponseV2, msisdn(i)) >= 1 {
+			outside = msisdn(i)
+		}
+	}
+	f := Flag{Name: ResponseV2, Enabled: true, Percentage: 1, Allowlist: []string{outside}}
+	if !f.On(outside) {
+		t.Error("an allowlisted player is on whatever their bucket")
+	}
+	f.Percentage = 0
+	if !f.On(outside) {
+		t.Error("an allowlisted player is on at 0%")
+	}
+	f.Enabled = false
+	if f.On(outside) {
+		t.Error("a disabled flag is off for the allowlist too")
+	}
+	if (Flag{Name: ResponseV2, Enabled: true, Allowlist: []string{""}}).On("") {
+		t.Error("an empty msisdn never matches the allowlist")
+	}
+}
+
+func TestIsEnabled(t *testing.T) {
+	Configure(nil)
+	if IsEnabled(context.Background(), ResponseV2, msisdn(1)) {
+		t.Error("a flag is off until flags are configured")
+	}
+
+	configure(t, map[string]Flag{
+		ResponseV2: {Name: ResponseV2, Enabled: true, Percentage: 100},
+	})
+	ctx := WithDecisions(context.Background())
+	if !IsEnabled(ctx, ResponseV2, msisdn(1)) || IsEnabled(ctx, TightBasket, msisdn(1)) {
+		t.Error("want response_v2 on and the unset flag off")
+	}
+	IsEnabled(ctx, ResponseV2, msisdn(1))
+	if got := Decisions(ctx); got != "response_v2=on,outcome_tight_basket=off" {
+		t.Errorf("decisions = %q, want each flag once", got)
+	}
+	if Decisions(context.Background()) != "" {
+		t.Error("a context without decisions records none")
+	}
+
+	Configure(func(ctx context.Context, name string) (Flag, error) {
+		return Flag{Name: name, Enabled: true, Percentage: 100}, errors.New("boom")
+	})
+	if IsEnabled(context.Background(), ResponseV2, msisdn(1)) {
+		t.Error("a flag that fails to load is off")
+	}
+}
+
+func TestIsKnown(t *testing.T) {
+	if !IsKnown(ResponseV2) || !IsKnown(TightBasket) || IsKnown("dark_mode") {
+		t.Error("only the flags the code checks are known")
+	}
+}
@@ -48,9 +48,9 @@ require (
 	github.com/vmihailenco/msgpack/v5 v5.3.5 // indirect
 	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 	github.com/xo/terminfo v0.0.0-20210125001918-ca9a967f8778 // indirect
-	github.com/zishang520/engine.io v1.5.9 // indirect
+	github.com/zishang520/engine.io v1.5.9
 	github.com/zishang520/engine.io-go-parser v1.2.2 // indirect
-	github.com/zishang520/socket.io v1.3.2 // indirect
+	github.com/zishang520/socket.io v1.3.2
 	github.com/zishang520/socket.io-go-parser v1.0.4 // indirect
 	golang.org/x/crypto v0.37.0 // indirect
 	golang.org/x/net v0.21.0 // indirect
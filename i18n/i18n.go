@@ -0,0 +1,113 @@
+// Package i18n translates API StatusMessage strings. Messages are looked up
+// by a stable code in the catalog compiled in from locales/<lang>.json;
+// clients get the code as MessageCode and the text in the player's
+// language as StatusMessage.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultLanguage is the fallback for missing translations and for requests
+// that name no language we have
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+// catalog maps language to message code to text. Texts are fmt formats
+// filled from the args given with the code.
+var catalog = loadCatalog()
+
+// missing remembers the lang/code pairs already logged as untranslated
+var missing sync.Map
+
+func loadCatalog() map[string]map[string]string {
+	files, err := localeFiles.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("i18n: %v", err))
+	}
+	out := make(map[string]map[string]string, len(files))
+	for _, f := range files {
+		b, err := localeFiles.ReadFile(path.Join("locales", f.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("i18n: %v", err))
+		}
+		messages := map[string]string{}
+		if err := json.Unmarshal(b, &messages); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", f.Name(), err))
+		}
+		out[strings.TrimSuffix(f.Name(), path.Ext(f.Name()))] = messages
+	}
+	if _, ok := out[DefaultLanguage]; !ok {
+		panic("i18n: no " + DefaultLanguage + " catalog")
+	}
+	return out
+}
+
+// Languages returns the languages with a catalog, sorted
+func Languages() []string {
+	langs := make([]string, 0, len(catalog))
+	for lang := range catalog {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Supported reports whether lang has a catalog
+func Supported(lang string) bool {
+	_, ok := catalog[lang]
+	return ok
+}
+
+// T returns the text of code in lang formatted with args. A code missing
+// from lang falls back to DefaultLanguage and is logged once; a code
+// missing from every catalog is returned as is.
+func T(lang, code string, args ...interface{}) string {
+	text, ok := catalog[lang][code]
+	if !ok {
+		if _, logged := missing.LoadOrStore(lang+"/"+code, true); !logged {
+			logrus.Warnf("i18n: no %q translation for %s, using %s", lang, code, DefaultLanguage)
+		}
+		if text, ok = catalog[DefaultLanguage][code]; !ok {
+			return code
+		}
+	}
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// Negotiate picks the supported language the Accept-Language header header
+// prefers most, matching on the primary subtag so sw-KE selects sw. It
+// returns "" when the header names none we have.
+func Negotiate(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		lang, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if q > bestQ && Supported(lang) {
+			best, bestQ = lang, q
+		}
+	}
+	return best
+}
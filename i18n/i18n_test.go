@@ -0,0 +1,91 @@
+package i18n
+
+import (
+	"io"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestTopMessages(t *testing.T) {
+	cases := []struct {
+		code   string
+		args   []interface{}
+		en, sw string
+	}{
+		{"insufficient_balance", nil, "insufficient balance", "Salio halitoshi"},
+		{"deposit_pin_prompt", nil, "To complete the bet, enter your M-Pesa PIN.", "Kukamilisha BET weka M-Pesa PIN yako."},
+		{"invalid_promocode", nil, "Invalid PromoCode", "PromoCode si sahihi"},
+		{"otp_sent", nil, "OTP Verification has been send", "Nambari ya uthibitisho (OTP) imetumwa"},
+		{"otp_invalid", nil, "Wrong Code", "Nambari si sahihi"},
+		{"otp_expired", nil, "otp expired", "Nambari ya OTP imeisha muda"},
+		{"game_not_found", nil, "Game not found", "Mchezo haukupatikana"},
+		{"unauthorized", nil, "unauthorized", "Huna idhini"},
+		{"internal_error", nil, "internal server error", "Hitilafu ya mfumo, tafadhali jaribu tena"},
+		{"stake_below_min", []interface{}{10}, "Minimum stake is 10.", "Dau la chini ni 10."},
+	}
+	for _, c := range cases {
+		if got := T("en", c.code, c.args...); got != c.en {
+			t.Errorf("T(en, %s) = %q, want %q", c.code, got, c.en)
+		}
+		if got := T("sw", c.code, c.args...); got != c.sw {
+			t.Errorf("T(sw, %s) = %q, want %q", c.code, got, c.sw)
+		}
+	}
+}
+
+func TestCatalogsCoverDefault(t *testing.T) {
+	for _, lang := range Languages() {
+		for code := range catalog[DefaultLanguage] {
+			if _, ok := catalog[lang][code]; !ok {
+				t.Errorf("%s catalog has no %s", lang, code)
+			}
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	out := logrus.StandardLogger().Out
+	logrus.SetOutput(io.Discard)
+	hook := logtest.NewGlobal()
+	t.Cleanup(func() {
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+		logrus.SetOutput(out)
+	})
+	catalog[DefaultLanguage]["test_only"] = "English only %d"
+	t.Cleanup(func() { delete(catalog[DefaultLanguage], "test_only") })
+
+	for i := 0; i < 3; i++ {
+		if got := T("sw", "test_only", 7); got != "English only 7" {
+			t.Errorf("untranslated code = %q, want the English text", got)
+		}
+	}
+	if n := len(hook.AllEntries()); n != 1 {
+		t.Errorf("%d warnings for one missing translation, want 1", n)
+	}
+	if got := T("fr", "insufficient_balance"); got != "insufficient balance" {
+		t.Errorf("unsupported language = %q, want the English text", got)
+	}
+	if got := T("en", "no_such_code"); got != "no_such_code" {
+		t.Errorf("uncatalogued code = %q, want the code itself", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := map[string]string{
+		"":                          "",
+		"sw":                        "sw",
+		"sw-KE":                     "sw",
+		"EN-us":                     "en",
+		"fr-FR, sw;q=0.8, en;q=0.5": "sw",
+		"en;q=0.4, sw;q=0.9":        "sw",
+		"sw;q=bad, en;q=0.1":        "en",
+		"fr, de":                    "",
+	}
+	for header, want := range cases {
+		if got := Negotiate(header); got != want {
+			t.Errorf("Negotiate(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
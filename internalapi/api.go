@@ -0,0 +1,91 @@
+// Package internalapi is the API the USSD gateway calls on
+// server.internal_addr, and a client for it. Every call sends
+// server.internal_token as a bearer token. Answers carry no Status
+// envelope: a 2xx body is the typed result and any other an Error.
+//
+//	GET  /internal/v1/players/:msisdn    PlayerSummary
+//	GET  /internal/v1/games              []Game
+//	POST /internal/v1/bets               PlaceBetRequest -> Bet
+//	GET  /internal/v1/bets/:reference    BetStatus
+package internalapi
+
+import (
+	"fmt"
+	"time"
+)
+
+// BasePath prefixes every internal route
+const BasePath = "/internal/v1"
+
+// ChannelUSSD is the channel a bet is placed on when the request names none
+const ChannelUSSD = "ussd"
+
+// PlayerSummary is a player's wallet
+type PlayerSummary struct {
+	Msisdn  string  `json:"msisdn"`
+	Name    string  `json:"name"`
+	Balance float64 `json:"balance"`
+	Bonus   float64 `json:"bonus"`
+	FreeBet float64 `json:"free_bet"` // 0 when the player holds no unexpired free bet
+}
+
+// Game is an active game and the stakes it accepts
+type Game struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Category     string   `json:"category"`
+	Boxes        int      `json:"boxes"`
+	StakeMode    string   `json:"stake_mode"` // discrete, range or fixed
+	DefaultStake float64  `json:"default_stake"`
+	Stakes       []string `json:"stakes"` // every allowed stake, the bounds of a range, or the fixed amount
+}
+
+// PlaceBetRequest is a single-box bet
+type PlaceBetRequest struct {
+	Msisdn    string  `json:"msisdn"`
+	GameCatID string  `json:"game_cat_id"`
+	Box       string  `json:"box"`
+	Stake     float64 `json:"stake"`
+	Channel   string  `json:"channel,omitempty"` // ChannelUSSD when empty
+	USSD      string  `json:"ussd,omitempty"`    // USSD string, stored with the bet
+}
+
+// Bet is the settled outcome of a PlaceBetRequest
+type Bet struct {
+	Reference     string  `json:"reference"`
+	Result        string  `json:"result"` // the public API's ResultStatus
+	Box           string  `json:"box"`
+	Jackpot       bool    `json:"jackpot"`
+	GrossAmount   float64 `json:"gross_amount"`
+	TaxAmount     float64 `json:"tax_amount"`
+	NetAmount     float64 `json:"net_amount"`
+	PayoutDelayed bool    `json:"payout_delayed"`
+	FreeBet       bool    `json:"free_bet"` // the stake came from a free bet
+	Message       string  `json:"message"`
+	// RevealAt is set, and Result is "Pending" with no outcome, for a web or
+	// app bet on a game with a reveal delay; USSD bets are never delayed
+	RevealAt *time.Time `json:"reveal_at,omitempty"`
+}
+
+// BetStatus is where a bet's round stands
+type BetStatus struct {
+	Reference   string    `json:"reference"`
+	Msisdn      string    `json:"msisdn"`
+	GameCatID   string    `json:"game_cat_id,omitempty"`
+	Stake       float64   `json:"stake"`
+	State       string    `json:"state"`
+	DateCreated time.Time `json:"date_created"`
+	DateUpdated time.Time `json:"date_updated"`
+}
+
+// Error is a refused or failed call. Code is the public API's message code,
+// e.g. insufficient_balance or betting_paused.
+type Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("internal api: %d %s: %s", e.Status, e.Code, e.Message)
+}
@@ -0,0 +1,96 @@
+package internalapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls the internal API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient returns a client for the internal API at baseURL, e.g.
+// "http://10.0.0.5:3008". A nil httpClient gets one with a 10s timeout.
+func NewClient(baseURL, token string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/") + BasePath, token: token, http: httpClient}
+}
+
+// GetPlayerSummary returns the wallet of msisdn
+func (c *Client) GetPlayerSummary(ctx context.Context, msisdn string) (PlayerSummary, error) {
+	var out PlayerSummary
+	err := c.do(ctx, http.MethodGet, "/players/"+url.PathEscape(msisdn), nil, &out)
+	return out, err
+}
+
+// GetActiveGames lists the games that take bets
+func (c *Client) GetActiveGames(ctx context.Context) ([]Game, error) {
+	var out []Game
+	err := c.do(ctx, http.MethodGet, "/games", nil, &out)
+	return out, err
+}
+
+// PlaceBet places and settles a single-box bet. A refused bet is an *Error.
+func (c *Client) PlaceBet(ctx context.Context, req PlaceBetRequest) (Bet, error) {
+	var out Bet
+	err := c.do(ctx, http.MethodPost, "/bets", req, &out)
+	return out, err
+}
+
+// GetBetResult returns where the bet with reference stands
+func (c *Client) GetBetResult(ctx context.Context, reference string) (BetStatus, error) {
+	var out BetStatus
+	err := c.do(ctx, http.MethodGet, "/bets/"+url.PathEscape(reference), nil, &out)
+	return out, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("internal api: encoding request: %w", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &Error{Status: resp.StatusCode}
+		if json.NewDecoder(resp.Body).Decode(apiErr) != nil || apiErr.Code == "" {
+			apiErr.Code = "error"
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		apiErr.Status = resp.StatusCode
+		return apiErr
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("internal api: decoding %s %s: %w", method, path, err)
+	}
+	return nil
+}
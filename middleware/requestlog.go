@@ -0,0 +1,69 @@
+// Package middleware holds the fiber middleware that wraps every request
+// rather than one route group
+package middleware
+
+import (
+	"errors"
+	"fiberapp/flags"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestLog logs each request with probability 1/sampleRate.
+// Sampling is decided per request, so it is unbiased under bursty traffic
+// and gives the same rate with or without prefork. Server errors (5xx) and
+// requests slower than slow are always logged; slow = 0 turns that rule off.
+// The feature flags checked while serving the request are logged as ff.
+func RequestLog(sampleRate int, slow time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		c.SetUserContext(flags.WithDecisions(c.UserContext()))
+		err := c.Next()
+		duration := time.Since(start)
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// the error handler has not written the status yet
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+
+		isSlow := slow > 0 && duration >= slow
+		if !sampleRequest(sampleRate) && !isSlow && status < 500 {
+			return err
+		}
+
+		// keep log fields minimal to reduce allocation
+		entry := logrus.WithFields(logrus.Fields{
+			"m":   c.Method(),
+			"p":   c.Path(),
+			"d":   duration.Milliseconds(),
+			"s":   status,
+			"ip":  c.IP(),
+			"rid": c.Locals("request_id"),
+		})
+		if ff := flags.Decisions(c.UserContext()); ff != "" {
+			entry = entry.WithField("ff", ff)
+		}
+		switch {
+		case status >= 500:
+			entry.Error("request")
+		case isSlow:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+		return err
+	}
+}
+
+// sampleRequest reports true with probability 1/sampleRate
+func sampleRequest(sampleRate int) bool {
+	return sampleRate <= 1 || rand.IntN(sampleRate) == 0
+}
@@ -0,0 +1,189 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fiberapp/flags"
+	"fiberapp/utils"
+	"io"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// captureLogs collects the standard logger's entries for the test
+func captureLogs(t *testing.T) *logtest.Hook {
+	t.Helper()
+	out := logrus.StandardLogger().Out
+	logrus.SetOutput(io.Discard)
+	hook := logtest.NewGlobal()
+	t.Cleanup(func() {
+		logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+		logrus.SetOutput(out)
+	})
+	return hook
+}
+
+// logApp serves /ok, /fail, /error and /slow behind RequestLog
+func logApp(sampleRate int, slow time.Duration) *fiber.App {
+	app := fiber.New()
+	app.Use(utils.RequestIDMiddleware())
+	app.Use(RequestLog(sampleRate, slow))
+	app.Get("/ok", func(c *fiber.Ctx) error { return c.SendStatus(200) })
+	app.Get("/fail", func(c *fiber.Ctx) error { return c.SendStatus(503) })
+	app.Get("/error", func(c *fiber.Ctx) error { return errors.New("boom") })
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.SendStatus(200)
+	})
+	return app
+}
+
+func serve(t *testing.T, app *fiber.App, path string) {
+	t.Helper()
+	if _, err := app.Test(httptest.NewRequest("GET", path, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// withinBounds reports whether hits of n trials at probability p is within
+// five standard deviations of the mean, a false failure roughly once in
+// 3.5 million runs
+func withinBounds(hits, n int, p float64) bool {
+	mean := float64(n) * p
+	sd := math.Sqrt(float64(n) * p * (1 - p))
+	return math.Abs(float64(hits)-mean) <= 5*sd
+}
+
+func TestSampleRequestProbability(t *testing.T) {
+	const n = 200000
+	for _, rate := range []int{2, 10, 100, 1000} {
+		hits := 0
+		for i := 0; i < n; i++ {
+			if sampleRequest(rate) {
+				hits++
+			}
+		}
+		if !withinBounds(hits, n, 1/float64(rate)) {
+			t.Errorf("rate %d sampled %d of %d, want about %d", rate, hits, n, n/rate)
+		}
+	}
+	for _, rate := range []int{-1, 0, 1} {
+		if !sampleRequest(rate) {
+			t.Errorf("rate %d should log every request", rate)
+		}
+	}
+}
+
+func TestRequestLogAlwaysLogs(t *testing.T) {
+	hook := captureLogs(t)
+	app := logApp(math.MaxInt32, 10*time.Millisecond)
+
+	cases := []struct {
+		path  string
+		level logrus.Level
+		// status is the logged "s" field
+		status int
+	}{
+		{"/fail", logrus.ErrorLevel, 503},
+		{"/error", logrus.ErrorLevel, 500},
+		{"/slow", logrus.WarnLevel, 200},
+	}
+	for _, tc := range cases {
+		hook.Reset()
+		serve(t, app, tc.path)
+		entry := hook.LastEntry()
+		if entry == nil {
+			t.Errorf("%s was not logged", tc.path)
+			continue
+		}
+		if entry.Level != tc.level || entry.Data["s"] != tc.status || entry.Data["p"] != tc.path {
+			t.Errorf("%s logged %s %v, want %s with status %d", tc.path, entry.Level, entry.Data, tc.level, tc.status)
+		}
+		if rid, _ := entry.Data["rid"].(string); len(rid) != 32 {
+			t.Errorf("%s logged request id %v, want the generated one", tc.path, entry.Data["rid"])
+		}
+	}
+
+	hook.Reset()
+	for i := 0; i < 100; i++ {
+		serve(t, app, "/ok")
+	}
+	if n := len(hook.AllEntries()); n != 0 {
+		t.Errorf("%d fast successful requests logged at 1 in %d, want none", n, math.MaxInt32)
+	}
+}
+
+func TestRequestLogSlowOff(t *testing.T) {
+	hook := captureLogs(t)
+	app := logApp(math.MaxInt32, 0)
+	serve(t, app, "/slow")
+	if len(hook.AllEntries()) != 0 {
+		t.Error("slow = 0 should not log slow requests")
+	}
+}
+
+// TestRequestLogPreforkIndependent serves traffic through two apps, as two
+// prefork children would be. Each logs about 1 in sampleRate on its own,
+// and a burst of sampleRate requests may log none or several, which a
+// counter taken modulo sampleRate never does.
+func TestRequestLogPreforkIndependent(t *testing.T) {
+	hook := captureLogs(t)
+	const rate, bursts = 10, 300
+	children := []*fiber.App{logApp(rate, 0), logApp(rate, 0)}
+
+	for i, app := range children {
+		hook.Reset()
+		empty, crowded := 0, 0
+		for b := 0; b < bursts; b++ {
+			before := len(hook.AllEntries())
+			for r := 0; r < rate; r++ {
+				serve(t, app, "/ok")
+			}
+			switch len(hook.AllEntries()) - before {
+			case 0:
+				empty++
+			case 1:
+			default:
+				crowded++
+			}
+		}
+		if n := len(hook.AllEntries()); !withinBounds(n, rate*bursts, 1.0/rate) {
+			t.Errorf("child %d logged %d of %d, want about %d", i, n, rate*bursts, bursts)
+		}
+		if empty == 0 || crowded == 0 {
+			t.Errorf("child %d: %d empty and %d crowded bursts, want sampling independent of the request count", i, empty, crowded)
+		}
+	}
+}
+
+func TestRequestLogFlagDecisions(t *testing.T) {
+	hook := captureLogs(t)
+	flags.Configure(func(ctx context.Context, name string) (flags.Flag, error) {
+		return flags.Flag{Name: name, Enabled: true, Percentage: 100}, nil
+	})
+	t.Cleanup(func() { flags.Configure(nil) })
+	app := logApp(1, 0)
+	app.Get("/flagged", func(c *fiber.Ctx) error {
+		flags.IsEnabled(c.UserContext(), flags.ResponseV2, "254700000001")
+		return c.SendStatus(200)
+	})
+
+	serve(t, app, "/flagged")
+	serve(t, app, "/ok")
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	if ff := entries[0].Data["ff"]; ff != "response_v2=on" {
+		t.Errorf("ff = %v, want response_v2=on", ff)
+	}
+	if _, ok := entries[1].Data["ff"]; ok {
+		t.Error("a request that checked no flag logs no ff")
+	}
+}
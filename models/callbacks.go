@@ -0,0 +1,312 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fiberapp/money"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// StrictCallbackDecoding rejects callback bodies carrying fields that are not
+// part of the schema. It is off by default because the payment gateway adds
+// fields without notice; enable it with callbacks.strict / CALLBACK_STRICT.
+var StrictCallbackDecoding bool
+
+// FlexString accepts a JSON string or number. The gateway sends status,
+// msisdn and shortcode as either depending on the channel.
+type FlexString string
+
+func (f *FlexString) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*f = ""
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*f = FlexString(strings.TrimSpace(s))
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(b, &n); err != nil {
+		return &json.UnmarshalTypeError{Value: string(b), Type: reflect.TypeOf(*f)}
+	}
+	*f = FlexString(n.String())
+	return nil
+}
+
+// Amount accepts a JSON number or a numeric string such as "50.00"
+type Amount float64
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		*a = 0
+		return nil
+	}
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		s = strings.TrimSpace(s)
+		if s == "" {
+			*a = 0
+			return nil
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return &json.UnmarshalTypeError{Value: s, Type: reflect.TypeOf(*a)}
+	}
+	*a = Amount(v)
+	return nil
+}
+
+// SettlementCallback is the body posted by the gateway to the deposit
+// settlement endpoints (settle_bt and settle_bet)
+type SettlementCallback struct {
+	Reference     string     `json:"reference"`
+	TransactionID FlexString `json:"transaction_id"`
+	Status        FlexString `json:"status"`
+	Description   string     `json:"description"`
+	Msisdn        FlexString `json:"msisdn"`
+	Amount        Amount     `json:"amount"`
+	Name          string     `json:"name"`
+	Shortcode     FlexString `json:"shortcode"`
+	USSD          FlexString `json:"ussd"`
+	GameName      string     `json:"game_name"`
+}
+
+// Succeeded reports whether the gateway marked the payment as successful
+func (cb SettlementCallback) Succeeded() bool {
+	return status.GatewayStatus(cb.Status).Succeeded()
+}
+
+// Validate returns the missing or invalid fields of a settle_bet callback.
+// Failed payments only need enough to mark the deposit request failed; a
+// successful one must carry a positive amount in whole cents. Its bounds
+// are left to settlement, which flags a deposit outside them for review:
+// the player has paid it already.
+func (cb SettlementCallback) Validate() []string {
+	var fields []string
+	if strings.TrimSpace(cb.Reference) == "" {
+		fields = append(fields, "reference")
+	}
+	if cb.Status == "" {
+		fields = append(fields, "status")
+	}
+	if !cb.Succeeded() {
+		return fields
+	}
+	if cb.TransactionID == "" {
+		fields = append(fields, "transaction_id")
+	}
+	if cb.Msisdn == "" {
+		fields = append(fields, "msisdn")
+	}
+	if money.CheckWithin(money.Deposit, float64(cb.Amount), money.Bounds{}) != nil {
+		fields = append(fields, "amount")
+	}
+	return fields
+}
+
+// NormalizeMsisdn rewrites a present msisdn to its canonical 2547.. form and
+// reports "msisdn" when it is not a Kenyan mobile number
+func (cb *SettlementCallback) NormalizeMsisdn() []string {
+	if cb.Msisdn == "" {
+		return nil
+	}
+	msisdn, err := utils.NormalizeMsisdn(string(cb.Msisdn))
+	if err != nil {
+		return []string{"msisdn"}
+	}
+	cb.Msisdn = FlexString(msisdn)
+	return nil
+}
+
+// ValidateBT returns the missing fields of a settle_bt callback; the amount
+// and msisdn are read from the stored deposit request instead
+func (cb SettlementCallback) ValidateBT() []string {
+	var fields []string
+	if strings.TrimSpace(cb.Reference) == "" {
+		fields = append(fields, "reference")
+	}
+	if cb.TransactionID == "" {
+		fields = append(fields, "transaction_id")
+	}
+	return fields
+}
+
+// WithdrawalCallback is the body posted to the withdrawal settlement endpoints
+type WithdrawalCallback struct {
+	Reference     string     `json:"reference"`
+	TransactionID FlexString `json:"transaction_id"`
+	Status        FlexString `json:"status"`
+	Description   string     `json:"description"`
+	Msisdn        FlexString `json:"msisdn"`
+	Amount        Amount     `json:"amount"`
+	Name          string     `json:"name"`
+	Shortcode     FlexString `json:"shortcode"`
+}
+
+// Succeeded reports whether the gateway sent the money to the player
+func (cb WithdrawalCallback) Succeeded() bool {
+	return status.GatewayStatus(cb.Status).Succeeded()
+}
+
+// Validate returns the missing or invalid fields of a withdrawal callback
+func (cb WithdrawalCallback) Validate() []string {
+	var fields []string
+	if strings.TrimSpace(cb.Reference) == "" {
+		fields = append(fields, "reference")
+	}
+	if cb.Status == "" {
+		fields = append(fields, "status")
+	}
+	return fields
+}
+
+// ReversalCallback is the body posted to settle_reversal when M-Pesa
+// reverses a deposit
+type ReversalCallback struct {
+	TransactionID     FlexString `json:"transaction_id"`     // the reversed deposit
+	ReversalReference FlexString `json:"reversal_reference"` // the reversal's own transaction id
+	Description       string     `json:"description"`
+}
+
+// Validate returns the missing fields of a reversal callback
+func (cb ReversalCallback) Validate() []string {
+	var fields []string
+	if strings.TrimSpace(string(cb.TransactionID)) == "" {
+		fields = append(fields, "transaction_id")
+	}
+	if strings.TrimSpace(string(cb.ReversalReference)) == "" {
+		fields = append(fields, "reversal_reference")
+	}
+	return fields
+}
+
+// SMS delivery statuses reported to sms_dlr. SENT may still change; the
+// others are final.
+const (
+	SMSSent      = string(status.SMSSent)
+	SMSDelivered = string(status.SMSDelivered)
+	SMSFailed    = string(status.SMSFailed)
+	SMSRejected  = string(status.SMSRejected)
+	SMSExpired   = string(status.SMSExpired)
+)
+
+// SMSDeliveryReport is the body the SMS gateway posts to sms_dlr for a
+// dbQueue row
+type SMSDeliveryReport struct {
+	RecordID    FlexString `json:"record_id"`
+	Status      string     `json:"status"`
+	Description string     `json:"description"`
+}
+
+// ID returns the dbQueue RecordID, or 0 when it is not a number
+func (r SMSDeliveryReport) ID() int64 {
+	id, err := strconv.ParseInt(strings.TrimSpace(string(r.RecordID)), 10, 64)
+	if err != nil || id <= 0 {
+		return 0
+	}
+	return id
+}
+
+// NormalizedStatus returns the status upper-cased and trimmed
+func (r SMSDeliveryReport) NormalizedStatus() string {
+	return strings.ToUpper(strings.TrimSpace(r.Status))
+}
+
+// Validate returns the missing or invalid fields of a delivery report
+func (r SMSDeliveryReport) Validate() []string {
+	var fields []string
+	if r.ID() == 0 {
+		fields = append(fields, "record_id")
+	}
+	switch r.NormalizedStatus() {
+	case SMSSent, SMSDelivered, SMSFailed, SMSRejected, SMSExpired:
+	default:
+		fields = append(fields, "status")
+	}
+	return fields
+}
+
+// CallbackDecodeError lists the fields that could not be decoded
+type CallbackDecodeError struct {
+	Fields []string
+	Err    error
+}
+
+func (e *CallbackDecodeError) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("invalid fields %s: %v", strings.Join(e.Fields, ", "), e.Err)
+}
+
+func (e *CallbackDecodeError) Unwrap() error { return e.Err }
+
+// DecodeCallback decodes a callback body into v, rejecting unknown fields
+// when StrictCallbackDecoding is set
+func DecodeCallback(body []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if StrictCallbackDecoding {
+		dec.DisallowUnknownFields()
+	}
+	err := dec.Decode(v)
+	if err == nil {
+		return nil
+	}
+
+	// encoding/json has no typed error for unknown fields
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+		return &CallbackDecodeError{Fields: []string{field}, Err: err}
+	}
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return &CallbackDecodeError{Fields: badCallbackFields(body, v), Err: err}
+	}
+	return &CallbackDecodeError{Err: err}
+}
+
+// badCallbackFields re-decodes each top-level key on its own to find every
+// field with the wrong type; the decoder only reports the first one and
+// leaves Field empty when a custom unmarshaler fails
+func badCallbackFields(body []byte, v interface{}) []string {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil
+	}
+	typ := reflect.TypeOf(v).Elem()
+	var fields []string
+	for key, val := range raw {
+		probe := reflect.New(typ).Interface()
+		single, _ := json.Marshal(map[string]json.RawMessage{key: val})
+		if err := json.Unmarshal(single, probe); err != nil {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// NewCallbackFieldsError is the 400 body returned for a rejected callback
+func NewCallbackFieldsError(fields []string) H {
+	return H{
+		"Status":        400,
+		"StatusCode":    1,
+		"StatusMessage": "invalid callback: " + strings.Join(fields, ", "),
+		"Fields":        fields,
+	}
+}
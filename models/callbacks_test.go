@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeSettlementCallback(t *testing.T) {
+	body := `{"reference":"REF1","transaction_id":123456,"status":0,"msisdn":"0712345678",
+		"amount":"50.00","shortcode":4040,"extra":"ignored"}`
+	var cb SettlementCallback
+	if err := DecodeCallback([]byte(body), &cb); err != nil {
+		t.Fatal(err)
+	}
+	if cb.TransactionID != "123456" || cb.Status != "0" || cb.Shortcode != "4040" || cb.Amount != 50 {
+		t.Errorf("decoded %+v", cb)
+	}
+	if !cb.Succeeded() {
+		t.Error("status 0 is a success")
+	}
+	if bad := cb.NormalizeMsisdn(); bad != nil || cb.Msisdn != "254712345678" {
+		t.Errorf("msisdn = %q, bad %v; want 254712345678", cb.Msisdn, bad)
+	}
+	if fields := cb.Validate(); len(fields) != 0 {
+		t.Errorf("valid callback rejected: %v", fields)
+	}
+}
+
+func TestDecodeCallbackReportsEveryBadField(t *testing.T) {
+	body := `{"reference":"REF1","amount":"fifty","status":{"code":0},"msisdn":"0712345678"}`
+	var cb SettlementCallback
+	err := DecodeCallback([]byte(body), &cb)
+	var decodeErr *CallbackDecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Fatalf("err = %v, want a CallbackDecodeError", err)
+	}
+	if want := []string{"amount", "status"}; !reflect.DeepEqual(decodeErr.Fields, want) {
+		t.Errorf("fields = %v, want %v", decodeErr.Fields, want)
+	}
+
+	if err := DecodeCallback([]byte(`{"reference":`), &cb); !errors.As(err, &decodeErr) || decodeErr.Fields != nil {
+		t.Errorf("truncated body = %v, want a decode error without fields", err)
+	}
+}
+
+func TestDecodeCallbackStrict(t *testing.T) {
+	defer func() { StrictCallbackDecoding = false }()
+	StrictCallbackDecoding = true
+
+	var cb WithdrawalCallback
+	err := DecodeCallback([]byte(`{"reference":"R","status":"success","surprise":1}`), &cb)
+	var decodeErr *CallbackDecodeError
+	if !errors.As(err, &decodeErr) || !reflect.DeepEqual(decodeErr.Fields, []string{"surprise"}) {
+		t.Errorf("unknown field = %v, want it named", err)
+	}
+}
+
+func TestSettlementCallbackValidate(t *testing.T) {
+	cases := []struct {
+		name string
+		cb   SettlementCallback
+		want []string
+	}{
+		{"empty", SettlementCallback{}, []string{"reference", "status"}},
+		{"failed payment needs no amount", SettlementCallback{Reference: "R", Status: "1"}, nil},
+		{"success needs the money fields", SettlementCallback{Reference: "R", Status: "success"},
+			[]string{"transaction_id", "msisdn", "amount"}},
+		{"fractional cents", SettlementCallback{Reference: "R", Status: "0", TransactionID: "T", Msisdn: "254712345678", Amount: 10.005},
+			[]string{"amount"}},
+		{"negative", SettlementCallback{Reference: "R", Status: "0", TransactionID: "T", Msisdn: "254712345678", Amount: -5},
+			[]string{"amount"}},
+		{"decimal deposit", SettlementCallback{Reference: "R", Status: "0", TransactionID: "T", Msisdn: "254712345678", Amount: 10.5}, nil},
+	}
+	for _, tc := range cases {
+		if got := tc.cb.Validate(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Validate = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	bad := SettlementCallback{Msisdn: "12345"}
+	if got := bad.NormalizeMsisdn(); !reflect.DeepEqual(got, []string{"msisdn"}) {
+		t.Errorf("non-Kenyan msisdn = %v, want rejected", got)
+	}
+	if got := (SettlementCallback{}).ValidateBT(); !reflect.DeepEqual(got, []string{"reference", "transaction_id"}) {
+		t.Errorf("ValidateBT = %v", got)
+	}
+}
+
+func TestSMSDeliveryReport(t *testing.T) {
+	var r SMSDeliveryReport
+	if err := DecodeCallback([]byte(`{"record_id":42,"status":" delivered "}`), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID() != 42 || r.NormalizedStatus() != SMSDelivered || r.Validate() != nil {
+		t.Errorf("report = %+v", r)
+	}
+	bad := SMSDeliveryReport{RecordID: "x", Status: "LOST"}
+	if got := bad.Validate(); !reflect.DeepEqual(got, []string{"record_id", "status"}) {
+		t.Errorf("Validate = %v", got)
+	}
+}
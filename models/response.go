@@ -1,6 +1,7 @@
 package models
 
 import (
+	"fiberapp/i18n"
 	"time"
 
 	"gorm.io/gorm"
@@ -11,6 +12,7 @@ type H map[string]interface{}
 type BaseResponse struct {
 	Status        int         `json:"Status"`
 	StatusCode    int         `json:"StatusCode"`
+	MessageCode   string      `json:"MessageCode,omitempty"`
 	StatusMessage interface{} `json:"StatusMessage"`
 }
 
@@ -26,6 +28,18 @@ func NewErrorResponse(status, statusCode int, msg interface{}) H {
 	return H{"Status": status, "StatusCode": statusCode, "StatusMessage": msg}
 }
 
+// NewErrorResponseCode is NewErrorResponse for a catalogued message: the
+// envelope carries msgKey as MessageCode and its text in lang as
+// StatusMessage
+func NewErrorResponseCode(lang string, status, statusCode int, msgKey string, args ...interface{}) H {
+	return H{
+		"Status":        status,
+		"StatusCode":    statusCode,
+		"MessageCode":   msgKey,
+		"StatusMessage": i18n.T(lang, msgKey, args...),
+	}
+}
+
 type User struct {
 	ID                     int64      `json:"id" db:"id"`
 	PlayerID               string     `json:"player_id" db:"player_id"`
@@ -0,0 +1,171 @@
+// Package money checks the amounts that move through wallets, KPI counters
+// and the house tables. Every ingress (player endpoints, gateway callbacks,
+// admin adjustments) checks its amount with Check before anything is
+// written, and the database methods that add to a balance or counter check
+// their delta again with CheckDelta, so an amount that slipped past a
+// handler is still refused.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"fiberapp/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Op is the kind of money movement an amount is checked for
+type Op string
+
+const (
+	Deposit    Op = "deposit"
+	Stake      Op = "stake"
+	Payout     Op = "payout"
+	Transfer   Op = "transfer"
+	Adjustment Op = "adjustment" // admin bonus grants and basket top-ups
+	Counter    Op = "counter"    // KPI, house and jackpot totals
+)
+
+// MaxDelta is the largest single movement CheckDelta lets through. No
+// deposit, stake or win comes near it; a larger delta is a bug or an attack.
+const MaxDelta = 100_000_000
+
+// ErrInvalidAmount is matched by every *Error
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Error is an amount refused for Op. Code is its message code in the i18n
+// catalog and Limit the bound it crossed, nil for none.
+type Error struct {
+	Op     Op
+	Amount float64
+	Code   string
+	Limit  interface{}
+}
+
+func (e *Error) Error() string {
+	switch e.Code {
+	case "amount_not_number":
+		return fmt.Sprintf("%s amount is not a number", e.Op)
+	case "amount_not_positive":
+		return fmt.Sprintf("%s amount %v must be greater than 0", e.Op, e.Amount)
+	case "amount_negative":
+		return fmt.Sprintf("%s amount %v must not be negative", e.Op, e.Amount)
+	case "amount_cents":
+		return fmt.Sprintf("%s amount %v has more than two decimals", e.Op, e.Amount)
+	case "amount_below_min":
+		return fmt.Sprintf("%s amount %v is below the minimum of %v", e.Op, e.Amount, e.Limit)
+	}
+	return fmt.Sprintf("%s amount %v is above the maximum of %v", e.Op, e.Amount, e.Limit)
+}
+
+func (e *Error) Is(target error) bool { return target == ErrInvalidAmount }
+
+// Bounds are the smallest and largest amount an Op accepts; 0 is no bound
+type Bounds struct {
+	Min float64
+	Max float64
+}
+
+var bounds = map[Op]Bounds{}
+
+// Configure sets the per-operation bounds from the limits config. Stakes
+// are bounded by each game's stake rules and payouts by the game's
+// max_exposure instead.
+func Configure(c config.LimitsConfig) {
+	bounds = map[Op]Bounds{
+		Deposit:    {Min: c.DepositMin, Max: c.DepositMax},
+		Transfer:   {Min: c.TransferMinAmount},
+		Adjustment: {Max: c.AdjustmentMax},
+	}
+}
+
+// Check refuses an amount entering the system for op: it must be a finite
+// number above 0, in whole cents and within op's configured bounds
+func Check(op Op, amount float64) error {
+	return CheckWithin(op, amount, bounds[op])
+}
+
+// CheckWithin is Check with b in place of op's configured bounds
+func CheckWithin(op Op, amount float64, b Bounds) error {
+	err := check(op, amount, b)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"alert": "money", "op": op, "amount": amount, "code": err.Code}).
+			Warn("money: refused amount")
+		return err
+	}
+	return nil
+}
+
+func check(op Op, amount float64, b Bounds) *Error {
+	refuse := func(code string, limit interface{}) *Error {
+		return &Error{Op: op, Amount: amount, Code: code, Limit: limit}
+	}
+	switch {
+	case math.IsNaN(amount) || math.IsInf(amount, 0):
+		return refuse("amount_not_number", nil)
+	case amount <= 0:
+		return refuse("amount_not_positive", nil)
+	case !wholeCents(amount) || math.Round(amount*100) == 0:
+		// an amount below half a cent passes wholeCents as 0 cents
+		return refuse("amount_cents", nil)
+	case b.Min > 0 && amount < b.Min:
+		return refuse("amount_below_min", b.Min)
+	case b.Max > 0 && amount > b.Max:
+		return refuse("amount_above_max", b.Max)
+	case amount > MaxDelta:
+		return refuse("amount_above_max", float64(MaxDelta))
+	}
+	return nil
+}
+
+// wholeCents reports whether amount has at most two decimals, allowing for
+// the float error of amounts like 0.1+0.2
+func wholeCents(amount float64) bool {
+	cents := amount * 100
+	return math.Abs(cents-math.Round(cents)) < 1e-6
+}
+
+// CheckPayout refuses a win that is negative, not a number, or above max
+// when max is set
+func CheckPayout(amount, max float64) error {
+	err := checkDelta(Payout, amount)
+	if err == nil && max > 0 && amount > max {
+		err = &Error{Op: Payout, Amount: amount, Code: "amount_above_max", Limit: max}
+	}
+	if err != nil {
+		logrus.WithFields(logrus.Fields{"alert": "money", "op": Payout, "amount": amount, "code": err.Code}).
+			Error("money: refused payout")
+		return err
+	}
+	return nil
+}
+
+// CheckDelta refuses amounts a database method is about to add to, or for
+// a debit take from, a balance or counter: each must be a finite number,
+// not negative and at most MaxDelta. Unlike Check it allows 0 and fractions
+// of a cent, as computed shares such as tax and RTP contributions are both.
+// A refused delta means a caller skipped Check, so it is logged as an error.
+func CheckDelta(op Op, amounts ...float64) error {
+	for _, amount := range amounts {
+		if err := checkDelta(op, amount); err != nil {
+			logrus.WithFields(logrus.Fields{"alert": "money", "op": op, "amount": amount, "code": err.Code}).
+				Error("money: refused balance delta")
+			return err
+		}
+	}
+	return nil
+}
+
+func checkDelta(op Op, amount float64) *Error {
+	switch {
+	case math.IsNaN(amount) || math.IsInf(amount, 0):
+		return &Error{Op: op, Amount: amount, Code: "amount_not_number"}
+	case amount < 0:
+		return &Error{Op: op, Amount: amount, Code: "amount_negative"}
+	case amount > MaxDelta:
+		return &Error{Op: op, Amount: amount, Code: "amount_above_max", Limit: float64(MaxDelta)}
+	}
+	return nil
+}
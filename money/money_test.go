@@ -0,0 +1,103 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"fiberapp/config"
+)
+
+func TestCheck(t *testing.T) {
+	defer func(b map[Op]Bounds) { bounds = b }(bounds)
+	Configure(config.LimitsConfig{DepositMin: 1, DepositMax: 150000, TransferMinAmount: 10, AdjustmentMax: 50000})
+
+	cases := []struct {
+		op     Op
+		amount float64
+		code   string
+	}{
+		{Deposit, 50, ""},
+		{Deposit, 10.5, ""},
+		{Deposit, 0.1 + 0.2, "amount_below_min"},
+		{Stake, 0.1 + 0.2, ""},
+		{Deposit, 150000, ""},
+		{Deposit, 150000.01, "amount_above_max"},
+		{Deposit, 0.5, "amount_below_min"},
+		{Deposit, -500, "amount_not_positive"},
+		{Deposit, 0, "amount_not_positive"},
+		{Deposit, math.Copysign(0, -1), "amount_not_positive"},
+		{Deposit, 10.005, "amount_cents"},
+		{Deposit, 1e12, "amount_above_max"},
+		{Deposit, math.NaN(), "amount_not_number"},
+		{Deposit, math.Inf(1), "amount_not_number"},
+		{Deposit, math.Inf(-1), "amount_not_number"},
+		{Stake, 1e12, "amount_above_max"},
+		{Stake, MaxDelta, ""},
+		{Transfer, 5, "amount_below_min"},
+		{Adjustment, 50001, "amount_above_max"},
+		{Counter, math.SmallestNonzeroFloat64, "amount_cents"},
+		{Stake, 1e-9, "amount_cents"},
+		{Stake, 0.01, ""},
+	}
+	for _, tc := range cases {
+		err := Check(tc.op, tc.amount)
+		var amountErr *Error
+		switch {
+		case tc.code == "" && err != nil:
+			t.Errorf("Check(%s, %v) = %v, want accepted", tc.op, tc.amount, err)
+		case tc.code != "" && (!errors.As(err, &amountErr) || amountErr.Code != tc.code):
+			t.Errorf("Check(%s, %v) = %v, want %s", tc.op, tc.amount, err, tc.code)
+		case tc.code != "" && !errors.Is(err, ErrInvalidAmount):
+			t.Errorf("Check(%s, %v) = %v, want ErrInvalidAmount", tc.op, tc.amount, err)
+		}
+	}
+}
+
+func TestCheckDelta(t *testing.T) {
+	if err := CheckDelta(Counter, 0, 0.004, 500, MaxDelta); err != nil {
+		t.Errorf("zero, fraction of a cent and MaxDelta = %v, want accepted", err)
+	}
+	for _, amount := range []float64{-0.01, -500, MaxDelta + 1, 1e12, math.NaN(), math.Inf(1)} {
+		if err := CheckDelta(Counter, 10, amount); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("CheckDelta(10, %v) = %v, want refused", amount, err)
+		}
+	}
+}
+
+func TestCheckPayout(t *testing.T) {
+	if err := CheckPayout(0, 1000); err != nil {
+		t.Errorf("a loss = %v, want accepted", err)
+	}
+	if err := CheckPayout(1000, 1000); err != nil {
+		t.Errorf("a win at max_exposure = %v, want accepted", err)
+	}
+	if err := CheckPayout(1000.01, 1000); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("a win above max_exposure = %v, want refused", err)
+	}
+	if err := CheckPayout(5000, 0); err != nil {
+		t.Errorf("no max = %v, want accepted", err)
+	}
+	for _, amount := range []float64{-1, math.NaN(), MaxDelta + 1} {
+		if err := CheckPayout(amount, 0); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("CheckPayout(%v) = %v, want refused", amount, err)
+		}
+	}
+}
+
+func FuzzCheck(f *testing.F) {
+	for _, seed := range []float64{50, -500, 0, 1e12, 10.005, 0.1 + 0.2, math.NaN(), math.Inf(1), MaxDelta} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, amount float64) {
+		if Check(Stake, amount) != nil {
+			return
+		}
+		if math.IsNaN(amount) || math.IsInf(amount, 0) || amount <= 0 || amount > MaxDelta || amount < 0.01-1e-8 || !wholeCents(amount) {
+			t.Errorf("Check accepted %v", amount)
+		}
+		if CheckDelta(Stake, amount) != nil {
+			t.Errorf("CheckDelta refused %v that Check accepted", amount)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+package routes
+
+import (
+	"fiberapp/controllers"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/services"
+)
+
+// rows is a list of database rows returned as JSON objects
+type rows = []map[string]interface{}
+
+// apiDocs documents every route RegisterRoutes adds. CheckOpenAPI reports a
+// registered route missing from this list at startup.
+var apiDocs = []routeDoc{
+	{Method: "GET", Path: "/api/v1/", Tag: "meta", Summary: "Game settings; also opens the database pool", Response: envelope("Data", map[string]interface{}{})},
+	{Method: "GET", Path: "/api/v1/test", Tag: "meta", Summary: "Liveness probe", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/api/v1/openapi.json", Tag: "meta", Summary: "This OpenAPI document", Response: map[string]interface{}{}},
+	{Method: "GET", Path: "/api/v1/docs", Tag: "meta", Summary: "Swagger UI, only when server.docs is on", Response: ""},
+
+	// Auth
+	{
+		Method: "POST", Path: "/api/v1/login", Tag: "auth",
+		Summary:  "Send a login OTP. The answer is the same whether or not the account exists. 202 otp_delivery_delayed when the code was stored but its SMS could not be queued; /resend_otp sends a new one. A new code replaces every earlier one, which can no longer be verified; asking again while the last code is valid counts as a resend of it, and ResendsLeft says how many remain.",
+		Body:     controllers.LoginRequest{},
+		Response: controllers.LoginResponse{},
+		Examples: &examples{
+			Request:  map[string]interface{}{"msisdn": "254712345678", "name": "Jane", "promocode": ""},
+			Response: map[string]interface{}{"Status": 200, "StatusCode": 0, "Units": "Minutes", "ExpireIn": 2, "ResendAllowedAfter": 30, "StatusMessage": "OTP sent if the account is eligible"},
+		},
+	},
+	{Method: "POST", Path: "/api/v1/register", Tag: "auth", Summary: "Alias of /login", Body: controllers.LoginRequest{}, Response: controllers.LoginResponse{}},
+	{Method: "POST", Path: "/api/v1/resend_otp", Tag: "auth", Summary: "Replace the latest login OTP with a new code and send it; the old code no longer verifies. limits.otp_resend_max per code. 202 otp_delivery_delayed when its SMS could not be queued; the resend still counts.", Body: controllers.ResendOTPRequest{}, Response: controllers.ResendOTPResponse{}},
+	{Method: "POST", Path: "/api/v1/verify_otp", Tag: "auth", Summary: "Exchange a login OTP for an access token and open a session on the device named by the X-Device-Fingerprint header. Past limits.max_sessions live sessions the oldest is logged out, or under session_limit_policy reject the login is refused with session_limit. Stats carries the player's lifetime figures as on GET /user. A brand-new player given welcome free bets gets their count in WelcomeFreeBets", Body: controllers.VerifyOTPRequest{}, Response: controllers.TokenResponse{}},
+	{Method: "POST", Path: "/api/v1/refresh_token", Tag: "auth", Summary: "Rotate a refresh token and issue a new access token", Body: controllers.RefreshTokenRequest{}, Response: controllers.TokenResponse{}},
+	{Method: "POST", Path: "/api/v1/logout", Tag: "auth", Summary: "Revoke the presented access token, and refresh tokens on one device or all", Auth: "jwt", Body: controllers.LogoutRequest{}, Response: envelope()},
+	{Method: "GET", Path: "/api/v1/sessions", Tag: "auth", Summary: "The caller's live sessions, newest first; current marks the one making the request", Auth: "jwt", Response: envelope("Data", []services.PlayerSession{})},
+	{Method: "DELETE", Path: "/api/v1/sessions/:id", Tag: "auth", Summary: "Log one of the caller's sessions out: its access token stops working on the next request and its device's refresh tokens are revoked", Auth: "jwt", Response: envelope()},
+
+	// Games
+	{
+		Method: "POST", Path: "/api/v1/place_bet_pawabox", Tag: "games", Auth: "jwt",
+		Summary:  "Place a lucky number bet. mode \"demo\" plays against a fake balance. selections plays several boxes at once and answers with ParcelResults instead of GameResults. A repeated Idempotency-Key header or client_request_id replays the first response; an identical keyless bet within a couple of seconds gets StatusCode 4. When the server is overloaded the bet is refused with 503 and Retry-After before any money moves. A player betting faster than the settings' bet_cooldown_ms or max_bets_per_minute is refused with 429, StatusCode 6, Retry-After and RetryAfterMs, the wait in milliseconds. On a game with a reveal delay, web and app bets answer with Pending (Status, Reference, RevealAt) instead of GameResults; see GET /bet/:reference. An admin token sending X-Debug-Timing also gets Timing, the milliseconds spent in each stage of the bet. With X-API-Version: 2 each box of GameResults and ParcelResults is {value, display, kind, award_name}: the raw amount, the amount formatted, cash or award, and the award's name; without it boxes keep Value and Item, unless the player is in the response_v2 rollout (see /admin/flags).",
+		Body:     controllers.PlaceBetRequest{},
+		Response: controllers.PlaceBetResponse{},
+		Examples: &examples{
+			Request: map[string]interface{}{"amount": 20, "choice": "3", "game_cat_id": "1", "channel": "app"},
+			Response: map[string]interface{}{
+				"Status": 200, "StatusCode": 0, "FreeBet": "0", "StatusMessage": "Box 3 wins! You won: Ksh.150.00",
+				"GameResults": map[string]interface{}{
+					"Boxes": map[string]interface{}{
+						"1": map[string]interface{}{"Value": 0, "Item": "0"},
+						"3": map[string]interface{}{"Value": 150, "Item": "150.00"},
+					},
+					"ResultStatus": "Win", "WinAmount": 150, "JackPot": "False",
+					"GameID": "AB12CD34EF", "SelectedBox": "3", "ResultMessage": "Box 3 wins! You won: Ksh.150.00",
+				},
+			},
+		},
+	},
+	{Method: "POST", Path: "/api/v1/place_bet_spin", Tag: "games", Summary: "Place a spin bet. Paced like /place_bet_pawabox: too fast a bet gets 429 with Retry-After and RetryAfterMs.", Auth: "jwt", Body: controllers.PlaceSpinRequest{}, Response: envelope("StatusMessage", services.SpinResponse{})},
+	{
+		Method: "GET", Path: "/api/v1/lucky_games", Tag: "games", Auth: "optional",
+		Summary:  "List games; with a token also the caller's balance and free bet. Each game has a config: boxes, stake_mode, default_stake, min_stake and max_stake (0: no maximum), max_win, prize_preview (the names of its up to 3 most valuable awards), jackpot_teaser on jackpot games (what the kitty holds) and title (its marketing copy, else the list's Title). Lists are cached for limits.lookup_cache_ttl.",
+		Query:    map[string]string{"category": "all (default) or one of the returned Categories; others get 400"},
+		Response: controllers.GamesResponse{},
+	},
+	{Method: "GET", Path: "/api/v1/bet_amounts", Tag: "games", Summary: "Stakes a game accepts: one of allowed_stakes, any whole amount in a range, or its fixed bet amount", Auth: "jwt", Query: map[string]string{"game_cat_id": "game id"}, Response: envelope("BetAmount", []string{}, "BetType", "", "Data", services.StakeRules{})},
+	{Method: "GET", Path: "/api/v1/spin_bet_type", Tag: "games", Summary: "Same as bet_amounts, kept for older spin clients", Auth: "jwt", Query: map[string]string{"game_cat_id": "game id"}, Response: envelope("BetAmount", []string{}, "BetType", "", "Data", services.StakeRules{})},
+	{Method: "GET", Path: "/api/v1/winners", Tag: "games", Summary: "Recent winners, msisdns masked. A player who has not turned show_win on is listed as \"A lucky player\".", Query: map[string]string{"min_amount": "smallest win to list", "game_cat_id": "only this game"}, Response: envelope("Winners", []services.Winner{})},
+	{Method: "GET", Path: "/api/v1/promotions", Tag: "games", Summary: "Running deposit promotions", Response: envelope("Promotions", []services.Promotion{})},
+	{Method: "GET", Path: "/api/v1/get_year", Tag: "meta", Summary: "Current year", Response: envelope("Year", 0)},
+	{Method: "POST", Path: "/api/v1/apply_promo", Tag: "games", Summary: "Check a promo code", Body: controllers.PromoRequest{}, Response: envelope()},
+
+	// Wallet
+	{Method: "POST", Path: "/api/v1/initiate_deposit", Tag: "wallet", Summary: "Start an STK push deposit on the shortcode of campaign, else of channel; an unknown campaign is 400. The amount must be whole shillings, unless the setting round_deposits rounds it to the nearest, and within the settings' min_deposit to max_deposit (inside limits.deposit_min to deposit_max); otherwise 202 with MessageCode deposit_not_whole, deposit_below_min or deposit_above_max. Idempotency-Key and client_request_id work as on place_bet_pawabox.", Auth: "jwt", Body: controllers.IniatateDepositRequest{}, Response: envelope("FreeBet", "", "Reference", "")},
+	{Method: "GET", Path: "/api/v1/bet/:reference", Tag: "games", Summary: "A bet: Status Pending until it settles, or on a game with a reveal delay until RevealAt, then Revealed with GameResult. A bet without a reveal delay answers from the bet record, so its GameResult has no boxes or tax breakdown and RevealAt is when it was placed. The socket bet_result event carries the same at RevealAt, always in version 1. Boxes follow X-API-Version as on /place_bet_pawabox.", Auth: "jwt", Response: envelope("Data", services.BetReveal{})},
+	{Method: "GET", Path: "/api/v1/open_rounds", Tag: "games", Summary: "The player's unresolved rounds, newest first, to resume after the app restarts: deposits awaiting M-Pesa (state awaiting_payment) or paid and not yet played (paid), and bets not yet settled (playing) or with the outcome held until reveal_at (revealing). Each names the game, stake, selected box and when it started, and poll is the endpoint to follow it on: /deposit_status/:reference while awaiting payment, /bet/:reference after, which answers 404 until the game is played. Rounds older than limits.open_round_max_age are left out; reconciliation settles them.", Auth: "jwt", Response: envelope("Data", []services.OpenRound{})},
+	{Method: "GET", Path: "/api/v1/deposit_status/:reference", Tag: "wallet", Summary: "Status of a deposit, optionally waiting for it to settle", Auth: "jwt", Query: map[string]string{"wait": "long-poll for up to this many seconds"}, Response: envelope("Data", services.DepositStatus{})},
+	{Method: "POST", Path: "/api/v1/retry_stk", Tag: "wallet", Summary: "Send the STK of a pending deposit again under the same reference. Allowed limits.stk_retry_max times per deposit, limits.stk_retry_spacing apart, while it is younger than limits.stk_retry_max_age: a settled deposit is 409, an exhausted or too early retry 429 with Retry-After.", Auth: "jwt", Body: controllers.RetrySTKRequest{}, Response: envelope("Data", services.STKRetry{})},
+	{Method: "GET", Path: "/api/v1/wallet", Tag: "wallet", Summary: "Cash and bonus balances", Auth: "jwt", Response: envelope("Data", services.WalletSummary{})},
+	{Method: "GET", Path: "/api/v1/tax_preview", Tag: "wallet", Summary: "Withholding tax and net payout for a win, and excise on a stake", Auth: "jwt", Query: map[string]string{"amount": "gross win in KES", "stake": "optional stake for the excise duty"}, Response: envelope("Data", services.TaxPreview{})},
+	{Method: "POST", Path: "/api/v1/transfer", Tag: "wallet", Summary: "Send balance to another player; large transfers need an OTP", Auth: "jwt", Body: controllers.TransferRequest{}, Response: envelope("Data", services.TransferResult{})},
+	{Method: "POST", Path: "/api/v1/withdraw", Tag: "wallet", Summary: "Withdraw balance to M-Pesa; large withdrawals need an OTP and a rolling 24h limit applies", Auth: "jwt", Body: controllers.WithdrawRequest{}, Response: envelope("Data", services.WithdrawalResult{})},
+	{Method: "POST", Path: "/api/v1/bet_history", Tag: "wallet", Summary: "Caller's bets", Auth: "jwt", Body: controllers.HistoryRequest{}, Response: envelope("History", rows{})},
+	{Method: "POST", Path: "/api/v1/game_history", Tag: "wallet", Summary: "Caller's settled games, paged", Auth: "jwt", Body: controllers.GameHistoryRequest{}, Response: envelope("Total", 0, "History", rows{})},
+	{Method: "POST", Path: "/api/v1/list_withdrawal", Tag: "wallet", Summary: "Caller's withdrawals", Auth: "jwt", Body: controllers.HistoryRequest{}, Response: envelope("Withdrawal", rows{})},
+	{Method: "POST", Path: "/api/v1/list_deposit", Tag: "wallet", Summary: "Caller's deposits", Auth: "jwt", Body: controllers.HistoryRequest{}, Response: envelope("Deposit", rows{})},
+
+	// Account
+	{Method: "GET", Path: "/api/v1/user", Tag: "account", Summary: "Caller's player record, and under Stats their lifetime figures over settled bets: games played, wins, losses, total wagered, total won, biggest win and current streak. Stats are cached for limits.lookup_cache_ttl and left out when they cannot be read.", Auth: "jwt", Response: envelope("Data", map[string]interface{}{}, "Stats", services.LifetimeStats{})},
+	{Method: "PUT", Path: "/api/v1/user", Tag: "account", Summary: "Update the caller's name", Auth: "jwt", Body: controllers.UpdateUserRequest{}, Response: envelope()},
+	{Method: "PUT", Path: "/api/v1/user/msisdn", Tag: "account", Summary: "Start moving the account to a new phone number: the number is held for limits.msisdn_change_ttl and an OTP is sent to it. 409 when it is registered or held by another account.", Auth: "jwt", Body: controllers.ChangeMsisdnRequest{}, Response: envelope("Units", "", "ExpireIn", 0)},
+	{Method: "POST", Path: "/api/v1/user/msisdn/verify", Tag: "account", Summary: "Confirm the phone number change with the OTP sent to the new number. Tokens of the old number are revoked; the response carries a token for the new one.", Auth: "jwt", Body: controllers.OTPRequest{}, Response: controllers.TokenResponse{}},
+	{Method: "GET", Path: "/api/v1/profile", Tag: "account", Summary: "Caller's profile and SMS preferences", Auth: "jwt", Response: envelope("Data", services.Profile{})},
+	{Method: "PUT", Path: "/api/v1/profile", Tag: "account", Summary: "Update name (2-30 letters), language (en or sw), sms_notifications or show_win", Auth: "jwt", Body: controllers.ProfileRequest{}, Response: envelope("Data", services.Profile{})},
+	{Method: "POST", Path: "/api/v1/update_profile_pic", Tag: "account", Summary: "Upload a profile picture", Auth: "jwt", Body: multipartForm{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/update_show_win", Tag: "account", Summary: "Show or hide the caller's wins; same as PUT /profile with show_win", Auth: "jwt", Body: controllers.ShowWinRequest{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/request_delete_user", Tag: "account", Summary: "Send an OTP to confirm account deletion", Auth: "jwt", Response: envelope()},
+	{Method: "POST", Path: "/api/v1/delete_user", Tag: "account", Summary: "Request deletion of the caller's account; personal data is anonymized after limits.deletion_retention", Auth: "jwt", Body: controllers.OTPRequest{}, Response: envelope("ExpireIn", int64(0))},
+	{Method: "POST", Path: "/api/v1/request_self_exclusion_period", Tag: "account", Summary: "Send an OTP to confirm self exclusion", Auth: "jwt", Body: controllers.SelfExclusionRequest{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/verify_self_exclusion_period", Tag: "account", Summary: "Confirm self exclusion", Auth: "jwt", Body: controllers.OTPRequest{}, Response: envelope("ExpireIn", int64(0), "Units", "")},
+
+	// Gateway callbacks
+	{Method: "POST", Path: "/api/v1/settle_bt_luckynumber", Tag: "callbacks", Summary: "Deposit-and-bet settlement from the payment gateway. The callback is stored before the 200 and processed in the background, retried on failure; 500 when it could not be stored. A re-delivered transaction_id is answered 200 and not processed again. A deposit outside the deposit bounds is flagged for review, not credited.", Body: models.SettlementCallback{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/settle_transaction", Tag: "callbacks", Summary: "Deposit settlement; allowed gateway IPs only. A deposit outside the deposit bounds is answered 200 but flagged for review (GET /admin/deposit_reviews), not credited.", Body: models.SettlementCallback{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/sms_dlr", Tag: "callbacks", Summary: "SMS delivery report for a dbQueue row; allowed gateway IPs only", Body: models.SMSDeliveryReport{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/settle_reversal", Tag: "callbacks", Summary: "M-Pesa deposit reversal; allowed gateway IPs only", Body: models.ReversalCallback{}, Response: envelope("Data", services.Reversal{})},
+	{Method: "POST", Path: "/api/v1/settle_withdrawal", Tag: "callbacks", Summary: "Withdrawal settlement. The player gets an SMS that the money was sent or failed, and a socket withdrawal_status event when sms_notifications is on.", Body: models.WithdrawalCallback{}, Response: envelope()},
+	{Method: "POST", Path: "/api/v1/settle_withdrawal_b2b", Tag: "callbacks", Summary: "B2B withdrawal settlement", Body: models.WithdrawalCallback{}, Response: envelope()},
+
+	// Admin
+	{Method: "GET", Path: "/api/v1/admin/players", Tag: "admin", Summary: "Players with their stats, paged", Auth: "admin", Query: map[string]string{"page": "page number", "page_size": "rows per page", "sort": "sort key", "min_bets": "only players with at least this many bets"}, Response: envelope("Data", services.PlayerStatsPage{})},
+	{Method: "GET", Path: "/api/v1/admin/players/export", Tag: "admin", Summary: "Every matching player as CSV, streamed", Auth: "admin", Query: map[string]string{"sort": "sort key", "min_bets": "only players with at least this many bets"}, Response: ""},
+	{Method: "GET", Path: "/api/v1/admin/deletions", Tag: "admin", Summary: "Accounts pending deletion, pending and blocked", Auth: "admin", Response: envelope("Data", struct {
+		Requests []services.DeletionRequest    `json:"requests"`
+		Job      services.AccountDeletionStats `json:"job"`
+	}{})},
+	{Method: "GET", Path: "/api/v1/admin/freebets/liability", Tag: "admin", Summary: "Unexpired free bets by expiry day, with the expiry job counters", Auth: "admin", Response: envelope("Data", struct {
+		Liability services.FreeBetLiability   `json:"liability"`
+		Job       services.FreeBetExpiryStats `json:"job"`
+	}{})},
+	{Method: "GET", Path: "/api/v1/admin/players/duplicates", Tag: "admin", Summary: "Players stored under several msisdn formats", Auth: "admin", Response: envelope("Data", []services.DuplicatePlayers{})},
+	{Method: "GET", Path: "/api/v1/admin/players/:msisdn/stats", Tag: "admin", Summary: "One player's stats", Auth: "admin", Response: envelope("Data", services.PlayerStats{})},
+	{Method: "POST", Path: "/api/v1/admin/players/:msisdn/bonus", Tag: "admin", Summary: "Grant a bonus", Auth: "admin", Body: controllers.GrantBonusRequest{}, Response: envelope("Data", map[string]interface{}{})},
+	{Method: "GET", Path: "/api/v1/admin/players/:msisdn/sessions", Tag: "admin", Summary: "A player's live sessions", Auth: "admin", Response: envelope("Data", []services.PlayerSession{})},
+	{Method: "DELETE", Path: "/api/v1/admin/sessions/:id", Tag: "admin", Summary: "Log one session of any player out", Auth: "admin", Response: envelope()},
+	{Method: "POST", Path: "/api/v1/admin/players/:msisdn/revoke_sessions", Tag: "admin", Summary: "Revoke every access and refresh token of a player", Auth: "admin", Response: envelope("Data", services.RevokedSessions{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/daily", Tag: "admin", Summary: "Daily KPI", Auth: "admin", Query: map[string]string{"start_date": "YYYY-MM-DD", "end_date": "YYYY-MM-DD"}, Response: envelope("Data", []services.DailyStats{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/channels", Tag: "admin", Summary: "Handle and payout per channel", Auth: "admin", Query: map[string]string{"from": "YYYY-MM-DD", "to": "YYYY-MM-DD"}, Response: envelope("Data", []services.ChannelStats{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/cache", Tag: "admin", Summary: "Player and lookup cache counters", Auth: "admin", Response: envelope("Data", struct {
+		Players services.PlayerCacheStats `json:"players"`
+		Lookups services.LookupCacheStats `json:"lookups"`
+	}{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/load", Tag: "admin", Summary: "Requests in flight and shed, DB pool use and play slots of the serving worker", Auth: "admin", Response: envelope("Data", controllers.LoadStats{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/verification_purge", Tag: "admin", Summary: "OTP purge job counters", Auth: "admin", Response: envelope("Data", services.VerificationPurgeStats{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/deposits_by_shortcode", Tag: "admin", Summary: "Deposits per paybill shortcode; shortcodes not in the shortcode table have known false", Auth: "admin", Query: map[string]string{"from": "YYYY-MM-DD", "to": "YYYY-MM-DD"}, Response: envelope("Data", []services.ShortcodeDeposits{})},
+	{Method: "GET", Path: "/api/v1/admin/stats/exposure", Tag: "admin", Summary: "Each game's wins paid today against its daily exposure cap; remaining only for capped games. A game reaching its cap has its wins cut, and with limits.exposure_cap_strict is paused for maintenance", Auth: "admin", Response: envelope("Data", []services.GameExposure{})},
+	{Method: "GET", Path: "/api/v1/admin/reports/daily", Tag: "admin", Summary: "Finance report of one day (yesterday by default): handle, payout, GGR, taxes, deposits, withdrawals, pending payouts and free-bet cost summed from the source tables, plus the kpi counters that differ from those sums by more than limits.report_tolerance. format=csv downloads it.", Auth: "admin", Query: map[string]string{"date": "YYYY-MM-DD", "format": "json or csv"}, Response: envelope("Data", services.FinanceReport{})},
+	{Method: "GET", Path: "/api/v1/admin/reports/monthly", Tag: "admin", Summary: "The daily finance report for every day of a month (the current one by default), with month totals", Auth: "admin", Query: map[string]string{"month": "YYYY-MM", "format": "json or csv"}, Response: envelope("Data", services.FinanceReport{})},
+	{Method: "GET", Path: "/api/v1/admin/reports/basket_history", Tag: "admin", Summary: "The basket and house income as snapshotted each day at limits.snapshot_time, with each day's movements; the last 30 days by default. Days without a snapshot are left out", Auth: "admin", Query: map[string]string{"from": "YYYY-MM-DD", "to": "YYYY-MM-DD"}, Response: envelope("Data", services.BalanceHistory{})},
+	{Method: "POST", Path: "/api/v1/admin/reports/basket_history/snapshot", Tag: "admin", Summary: "Take today's basket and house income snapshot now, replacing one taken earlier today", Auth: "admin", Response: envelope("Data", services.BalanceSnapshot{})},
+	{Method: "GET", Path: "/api/v1/admin/basket", Tag: "admin", Summary: "Prize basket level and the latest top-ups", Auth: "admin", Response: envelope("Data", services.BasketStatus{})},
+	{Method: "GET", Path: "/api/v1/admin/jackpots/reconcile", Tag: "admin", Summary: "Each jackpot kitty next to its ledger: opening balance + contributions - payouts. balanced is false when the kitty differs from that sum.", Auth: "admin", Response: envelope("Data", []services.JackpotKittyBalance{})},
+	{Method: "GET", Path: "/api/v1/admin/jackpots/consistency", Tag: "admin", Summary: "Games flagged is_jackpot against the jackpot kitties, matched on name_init. Issues are missing_kitty (an active jackpot game with no kitty), orphan_kitty (a kitty no game has) and unflagged_game (a game with a kitty but not flagged). A stake only feeds a kitty when both sides agree.", Auth: "admin", Response: envelope("Data", services.JackpotConsistency{})},
+	{Method: "GET", Path: "/api/v1/admin/audit/statuses", Tag: "admin", Summary: "Values in the bet, deposit, withdrawal and B2B status columns that are outside their vocabulary, with row counts, to fix historical data", Auth: "admin", Response: envelope("Data", []services.StatusAuditRow{})},
+	{Method: "POST", Path: "/api/v1/admin/simulate_rtp", Tag: "admin", Summary: "Play up to 100000 simulated bets of bet_amount on a game through the real box generator, with the live settings overlaid by settings, and report the RTP, win rate, forced win rate and payout percentiles. The same seed gives the same result. Jackpot kitties and awards are not simulated; nothing is written.", Auth: "admin", Body: services.RTPSimulation{}, Response: envelope("Data", services.RTPSimulationResult{})},
+	{Method: "POST", Path: "/api/v1/admin/basket/topup", Tag: "admin", Summary: "Add to the prize basket; the admin is recorded", Auth: "admin", Body: controllers.TopUpBasketRequest{}, Response: envelope("Data", services.BasketTopUp{})},
+	{Method: "GET", Path: "/api/v1/admin/maintenance", Tag: "admin", Summary: "Whether betting and deposits are paused, globally and per game", Auth: "admin", Response: envelope("Data", services.MaintenanceState{})},
+	{Method: "PUT", Path: "/api/v1/admin/maintenance", Tag: "admin", Summary: "Pause or resume betting (scope global or game) and deposits (global only). Paused bets and deposits get 503 with StatusCode 5 and the message; settlement callbacks and withdrawals keep working. All workers pick the change up within limits.lookup_cache_ttl.", Auth: "admin", Body: controllers.MaintenanceRequest{}, Response: envelope("Data", services.MaintenanceState{})},
+	{Method: "GET", Path: "/api/v1/admin/flags", Tag: "admin", Summary: "The feature flags and their rollout. A flag is on for its allowlist and for percentage of other players, each always landing on the same side; disabled it is off for everyone. Never set means disabled.", Auth: "admin", Response: envelope("Data", []services.FeatureFlag{})},
+	{Method: "PUT", Path: "/api/v1/admin/flags/:name", Tag: "admin", Summary: "Set a feature flag: enabled, percentage (0 to 100) and allowlist (msisdns, replacing the stored list). Only the flags the code checks can be set. All workers pick the change up within limits.lookup_cache_ttl.", Auth: "admin", Body: controllers.FeatureFlagRequest{}, Response: envelope("Data", services.FeatureFlag{})},
+	{Method: "GET", Path: "/api/v1/admin/tax_rates", Tag: "admin", Summary: "The effective-dated excise and withholding rates, past and scheduled. A round is taxed at the rates in effect when it was opened, even if they change before it settles; with no rate in effect the settings' excise_duty and withholding apply. Each tax record keeps the rate it was deducted at.", Auth: "admin", Response: envelope("Data", []services.TaxRate{})},
+	{Method: "POST", Path: "/api/v1/admin/tax_rates", Tag: "admin", Summary: "Schedule a rate: tax_type excise or withholding, rate a percentage from 0 to 100, effective_from in the future. 400 when the tax type already has a rate from that moment.", Auth: "admin", Body: controllers.TaxRateRequest{}, Response: envelope("Data", services.TaxRate{})},
+	{Method: "PUT", Path: "/api/v1/admin/tax_rates/:id", Tag: "admin", Summary: "Change the rate and effective_from of a scheduled rate; its tax_type stays. A rate already in effect cannot change: 409.", Auth: "admin", Body: controllers.TaxRateRequest{}, Response: envelope("Data", services.TaxRate{})},
+	{Method: "DELETE", Path: "/api/v1/admin/tax_rates/:id", Tag: "admin", Summary: "Withdraw a scheduled rate. A rate already in effect cannot be removed: 409.", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/welcome_grant", Tag: "admin", Summary: "The free bets a brand-new player gets on verifying their first login OTP. Off until set.", Auth: "admin", Response: envelope("Data", services.WelcomeGrant{})},
+	{Method: "PUT", Path: "/api/v1/admin/welcome_grant", Tag: "admin", Summary: "Turn the welcome grant on or off and set free_bets (0 to 100) and valid_hours (1 to 720). It goes to players who have never placed a bet, once each. All workers pick the change up within limits.lookup_cache_ttl.", Auth: "admin", Body: controllers.WelcomeGrantRequest{}, Response: envelope("Data", services.WelcomeGrant{})},
+	{Method: "GET", Path: "/api/v1/admin/search", Tag: "admin", Summary: "Support lookup by whatever the customer gives. kind says how q was read: an msisdn in any format gives the player and their latest 20 bets, deposits and withdrawals; a reference (BET_, PCL_, SPIN_, DEP_, TRF_ or older unprefixed) or an M-Pesa transaction id gives the deposit, bets and withdrawals sharing its references, up to 50 of each. Every search is written to admin_audit_log with the admin and the players shown.", Auth: "admin", Query: map[string]string{"q": "msisdn, reference or M-Pesa transaction id"}, Response: envelope("Data", services.SearchResult{})},
+	{Method: "GET", Path: "/api/v1/admin/rounds/:reference", Tag: "admin", Summary: "The round of a bet or deposit reference and every state it went through (created, funded, played, settled, paid or failed) with time and actor", Auth: "admin", Response: envelope("Data", services.Round{})},
+	{Method: "GET", Path: "/api/v1/admin/outcome_decisions/:reference", Tag: "admin", Summary: "What a settled bet's outcome was decided from: the generator inputs, the day's KPI and basket, the branch taken for the selected box (force_win, potential_win, loss or jackpot), the boxes and the amount paid. 404 when the bet has none; decisions older than limits.decision_retention are purged", Auth: "admin", Response: envelope("Data", services.OutcomeDecision{})},
+	{Method: "GET", Path: "/api/v1/admin/settlement_lag", Tag: "admin", Summary: "Money stuck in pending deposits, withdrawals and bets, and stored callbacks left unprocessed", Auth: "admin", Response: envelope("Data", services.SettlementLag{})},
+	{Method: "GET", Path: "/api/v1/admin/settlement_lag/metrics", Tag: "admin", Summary: "Settlement lag as plain-text metrics", Auth: "admin", Response: ""},
+	{Method: "GET", Path: "/api/v1/admin/withdrawals/stuck", Tag: "admin", Summary: "Processed withdrawals the disbursement partner rejected or never answered, older than older_than (default limits.withdrawal_stuck_age), oldest first and paged. Rows flagged for manual resolution are included.", Auth: "admin", Response: envelope("Data", services.StuckWithdrawalPage{})},
+	{Method: "POST", Path: "/api/v1/admin/withdrawals/:reference/retry", Tag: "admin", Summary: "Put a stuck withdrawal back on the disbursement queue; the admin is recorded. 409 when it was paid meanwhile, is flagged for manual resolution, or was sent less than limits.withdrawal_stuck_age ago without an answer. Past limits.withdrawal_retry_max retries it is flagged for manual resolution instead, the player gets an apology SMS, and the response is 409 with the retry in Data.", Auth: "admin", Response: envelope("Data", services.WithdrawalRetry{})},
+	{Method: "GET", Path: "/api/v1/admin/callbacks", Tag: "admin", Summary: "Stored settle_bt callbacks, newest first and paged; status filters to pending, processed or failed", Auth: "admin", Response: envelope("Data", services.InboundCallbackPage{})},
+	{Method: "POST", Path: "/api/v1/admin/callbacks/:id/retry", Tag: "admin", Summary: "Queue a failed callback for processing again with fresh attempts; the admin is recorded. 409 when it has not failed", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/deposit_reviews", Tag: "admin", Summary: "Deposit callbacks not credited because their amount is outside the deposit bounds (reason deposit_below_min, deposit_above_max or deposit_not_whole), newest first and paged, for ops to settle by hand", Auth: "admin", Response: envelope("Data", services.DepositReviewPage{})},
+	{Method: "GET", Path: "/api/v1/admin/settings", Tag: "admin", Summary: "The stored game settings row, including one the engine refuses as invalid", Auth: "admin", Response: envelope("Data", database.Settings{})},
+	{Method: "PUT", Path: "/api/v1/admin/settings", Tag: "admin", Summary: "Set the settings fields given and keep the rest. 400 when the resulting row is invalid: percentages outside 0 to 100, a missing default_rtp or min_win_multipier, max_win_multipier below min_win_multipier, negative counts, or max_deposit below min_deposit. Each change is recorded in admin_audit_log with the admin. Other workers play with the new values within limits.lookup_cache_ttl.", Auth: "admin", Body: services.SettingsChange{}, Response: envelope("Data", database.Settings{})},
+	{Method: "GET", Path: "/api/v1/admin/bet_timing/metrics", Tag: "admin", Summary: "Per-stage bet and deposit settlement timings as plain-text histograms", Auth: "admin", Response: ""},
+	{Method: "GET", Path: "/api/v1/admin/campaigns", Tag: "admin", Summary: "Deposit campaigns", Auth: "admin", Response: envelope("Data", []services.Campaign{})},
+	{Method: "POST", Path: "/api/v1/admin/campaigns", Tag: "admin", Summary: "Create a campaign", Auth: "admin", Body: services.Campaign{}, Response: envelope("Data", services.Campaign{})},
+	{Method: "PUT", Path: "/api/v1/admin/campaigns/:id", Tag: "admin", Summary: "Update a campaign", Auth: "admin", Body: services.Campaign{}, Response: envelope("Data", services.Campaign{})},
+	{Method: "DELETE", Path: "/api/v1/admin/campaigns/:id", Tag: "admin", Summary: "Delete a campaign", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/templates", Tag: "admin", Summary: "SMS templates", Auth: "admin", Response: envelope("Data", []services.MessageTemplate{})},
+	{Method: "PUT", Path: "/api/v1/admin/templates/:key/:language", Tag: "admin", Summary: "Save an SMS template", Auth: "admin", Body: controllers.SaveTemplateRequest{}, Response: envelope("Data", services.MessageTemplate{})},
+	{Method: "DELETE", Path: "/api/v1/admin/templates/:key/:language", Tag: "admin", Summary: "Delete an SMS template override", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/shortcodes", Tag: "admin", Summary: "Paybill shortcodes and their campaigns", Auth: "admin", Response: envelope("Data", []services.Shortcode{})},
+	{Method: "PUT", Path: "/api/v1/admin/shortcodes/:shortcode", Tag: "admin", Summary: "Save a shortcode. One active shortcode per channel and one active default; a clash is 409.", Auth: "admin", Body: controllers.SaveShortcodeRequest{}, Response: envelope("Data", services.Shortcode{})},
+	{Method: "DELETE", Path: "/api/v1/admin/shortcodes/:shortcode", Tag: "admin", Summary: "Delete a shortcode; its deposits then report as unknown", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/webhooks", Tag: "admin", Summary: "Partner webhook subscriptions", Auth: "admin", Response: envelope("Data", []services.WebhookSubscription{})},
+	{Method: "POST", Path: "/api/v1/admin/webhooks", Tag: "admin", Summary: "Create a webhook subscription", Auth: "admin", Body: services.WebhookSubscription{}, Response: envelope("Data", services.WebhookSubscription{})},
+	{Method: "PUT", Path: "/api/v1/admin/webhooks/:id", Tag: "admin", Summary: "Update a webhook subscription", Auth: "admin", Body: services.WebhookSubscription{}, Response: envelope("Data", services.WebhookSubscription{})},
+	{Method: "DELETE", Path: "/api/v1/admin/webhooks/:id", Tag: "admin", Summary: "Delete a webhook subscription", Auth: "admin", Response: envelope()},
+	{Method: "GET", Path: "/api/v1/admin/webhooks/:id/deliveries", Tag: "admin", Summary: "Delivery attempts for a subscription, paged", Auth: "admin", Query: map[string]string{"page": "page number", "page_size": "rows per page"}, Response: envelope("Data", services.WebhookDeliveryPage{})},
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"fiberapp/controllers"
+	"fiberapp/internalapi"
+	"fiberapp/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterInternalRoutes serves the internal API on its own app. It is not
+// in the OpenAPI document; package internalapi describes it.
+func RegisterInternalRoutes(app *fiber.App, token string) {
+	api := app.Group(internalapi.BasePath, controllers.InternalAuth(token))
+
+	api.Get("/players/:msisdn", controllers.InternalPlayerSummary)
+	api.Get("/games", controllers.InternalActiveGames)
+	api.Post("/bets", utils.DrainMiddleware(), utils.AdmissionMiddleware("internal_place_bet"), controllers.InternalPlaceBet)
+	api.Get("/bets/:reference", controllers.InternalBetResult)
+}
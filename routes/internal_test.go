@@ -0,0 +1,414 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fiberapp/controllers"
+	"fiberapp/database"
+	"fiberapp/internalapi"
+	"fiberapp/services"
+	"fiberapp/status"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const testInternalToken = "internal-token-for-the-gateway-tests"
+
+// gatewayRepo is the in-memory database behind the internal API tests: one
+// player, one game and the rows a settled bet writes. The calls the bet
+// path makes only for bookkeeping succeed without recording anything.
+type gatewayRepo struct {
+	database.LuckyRepo
+
+	mu      sync.Mutex
+	players map[string]map[string]interface{}
+	rounds  map[string]map[string]interface{}
+	bets    map[string]status.ResultStatus
+}
+
+func newGatewayRepo() *gatewayRepo {
+	return &gatewayRepo{
+		players: map[string]map[string]interface{}{
+			"254700000001": {"id": int64(1), "msisdn": "254700000001", "name": "Wanjiru", "balance": 500.0, "bonus": 0.0,
+				"free_bet": 0.0, "is_free": "NO", "lost_count": int64(0), "total_bets": 0.0, "payout": 0.0, "language": "en"},
+		},
+		rounds: map[string]map[string]interface{}{},
+		bets:   map[string]status.ResultStatus{},
+	}
+}
+
+var gatewayGame = database.Game{ID: "1", Name: "PawaBox", NameInit: "pw", Category: "Money Prize", Status: "active", Boxes: 7,
+	MaxExposure: 100000, GameStakeRules: database.GameStakeRules{BetAmount: 20}}
+
+func (r *gatewayRepo) ok() (int64, error) { return 1, nil }
+
+func (r *gatewayRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[msisdn]
+	if !ok {
+		return nil, nil
+	}
+	row := make(map[string]interface{}, len(p))
+	for k, v := range p {
+		row[k] = v
+	}
+	return row, nil
+}
+
+func (r *gatewayRepo) GetGame(ctx context.Context, catID string) (*database.Game, error) {
+	if catID != gatewayGame.ID {
+		return nil, nil
+	}
+	game := gatewayGame
+	return &game, nil
+}
+
+func (r *gatewayRepo) CheckGames(ctx context.Context, category string, previewAwards int) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{{"id": "1", "name": "PawaBox", "category": "Money Prize", "boxes": "7", "bet_amount": 20.0}}, nil
+}
+
+func (r *gatewayRepo) ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) GetSettings(ctx context.Context) (*database.Settings, error) {
+	return &database.Settings{
+		DefaultRTP: 85, AdjustableRTP: 5, VigPercentage: 10, JackpotPercentage: 5,
+		MinWinMultiplier: 1, MaxWinMultiplier: 10, MinLossCount: 3,
+		Withholding: 20, ExciseDuty: 12.5, MinDeposit: 10, MaxDeposit: 150000,
+	}, nil
+}
+
+func (r *gatewayRepo) CheckSetting(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"default_rtp": 85.0}, nil
+}
+
+// Rounds
+
+func (r *gatewayRepo) CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.rounds[reference] = map[string]interface{}{"reference": reference, "msisdn": msisdn, "game_cat_id": gameCatID,
+		"amount": amount, "state": database.RoundCreated, "date_created": now, "date_updated": now}
+	return nil
+}
+
+func (r *gatewayRepo) TransitionRound(ctx context.Context, reference, to, actor, detail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	round, ok := r.rounds[reference]
+	if !ok {
+		return database.ErrRoundNotFound
+	}
+	if !database.RoundTransitionAllowed(round["state"].(string), to) {
+		return database.ErrInvalidRoundTransition
+	}
+	round["state"], round["date_updated"] = to, time.Now()
+	return nil
+}
+
+func (r *gatewayRepo) GetRound(ctx context.Context, reference string) (map[string]interface{}, []map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	round, ok := r.rounds[reference]
+	if !ok {
+		return nil, nil, nil
+	}
+	return round, nil, nil
+}
+
+func (r *gatewayRepo) TaxRatesAt(ctx context.Context, at time.Time) (map[string]float64, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) RoundTaxRates(ctx context.Context, reference string) (map[string]float64, error) {
+	return nil, nil
+}
+
+// The wallet
+
+func (r *gatewayRepo) DebitStake(ctx context.Context, msisdn, reference string, amount float64, bonusFirst bool) (float64, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.players[msisdn]
+	if p["balance"].(float64) < amount {
+		return 0, 0, database.ErrInsufficientBalance
+	}
+	p["balance"] = p["balance"].(float64) - amount
+	return amount, 0, nil
+}
+
+func (r *gatewayRepo) CreditBonusWin(ctx context.Context, reference string, amount float64) (float64, error) {
+	return 0, nil
+}
+
+func (r *gatewayRepo) CheckBets(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference string, betStatus status.ResultStatus, betType, gameCatID, gameName, channel string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bets[reference] = betStatus
+	return true, nil
+}
+
+func (r *gatewayRepo) UpdateLuckyBet(ctx context.Context, result, game, reference string, betStatus status.ResultStatus) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.bets[reference] = betStatus
+	return 1, nil
+}
+
+func (r *gatewayRepo) UpdateLuckyBetWin(ctx context.Context, result, game, reference string, winAmount float64, betStatus status.ResultStatus) (int64, error) {
+	return r.UpdateLuckyBet(ctx, result, game, reference, betStatus)
+}
+
+func (r *gatewayRepo) InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error {
+	return nil
+}
+
+// Bookkeeping the tests do not look at
+
+func (r *gatewayRepo) CheckBasketLucky(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"amount": 100000.0, "reserved": 0.0}, nil
+}
+
+func (r *gatewayRepo) CheckHousePawaBoxKe(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"total_bets": 0.0, "total_wins": 0.0, "income": 0.0}, nil
+}
+
+func (r *gatewayRepo) CheckSettingKPI(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"bet": 0.0, "payout": 0.0, "rtp": 0.0}, nil
+}
+
+func (r *gatewayRepo) CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) GetGameDailyExposure(ctx context.Context, gameCatID string) (float64, error) {
+	return 0, nil
+}
+
+func (r *gatewayRepo) AddGameDailyExposure(ctx context.Context, gameCatID string, mvalue float64) (float64, error) {
+	return mvalue, nil
+}
+
+func (r *gatewayRepo) UpdateHouseLuckyBasketWins(ctx context.Context, mvalue float64) (bool, error) {
+	return true, nil
+}
+
+func (r *gatewayRepo) HoldBasketPayout(ctx context.Context, reference, msisdn string, amount float64) (bool, error) {
+	return true, nil
+}
+
+func (r *gatewayRepo) GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) ListWebhookSubscriptions(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *gatewayRepo) CheckWithdrawalsPawaBoxKe(ctx context.Context, reference string) (map[string]interface{}, error) {
+	return map[string]interface{}{"msisdn": "254700000001", "reference": reference}, nil
+}
+
+func (r *gatewayRepo) UpdateUserRTP(ctx context.Context, amount float64, id int64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateUserLossCount(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateRESTLossUser(ctx context.Context, payout float64, id int64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdatePlayerRestLossJackpot(ctx context.Context, cost float64, id int) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHousePawaBoxKeBasket(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHousePawaBoxKeHouse(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHouseLuckyWins(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHouseLuckyHouseLosses(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateHouseLucyNumberHouseCurrentRTP(ctx context.Context) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateKPIPayouts(ctx context.Context, mvalue, withTaxAmount, exciseTaxAmount float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error) { return r.ok() }
+func (r *gatewayRepo) UpdateKPIChannelHandle(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateKPIChannelPayout(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdateJackpotKit(ctx context.Context, reference string, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertIntoWithdrawalsLucky(ctx context.Context, nonAmount, amount, withholdTax float64, items string, msisdn, reference string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertWithdrawalQueue(ctx context.Context, reference, msisdn string, amount float64, callback string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertIntoPendingWithdrawalsLucky(ctx context.Context, amount, taxAmount float64, items, msisdn, reference string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) UpdatePawaBoxKeWithdrawalRequest(ctx context.Context, reference string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertCustomerLogsPawaBoxKe(ctx context.Context, amount float64, logType string, customerID string, narrative, reference string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertHouseLogsPawaBoxKeGameID(ctx context.Context, gameID string, fieldName, msisdn string, mvalue float64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertHouseBasketLogs(ctx context.Context, credit, debit, mvalue float64, narrative string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertB2BWithdrawalB2B(ctx context.Context, reference, msisdn string, amount float64, betStatus status.B2BStatus) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	return r.ok()
+}
+func (r *gatewayRepo) EnqueueWebhookEvent(ctx context.Context, eventType, msisdn string, payload []byte) (int64, error) {
+	return r.ok()
+}
+
+// internalAPI serves the internal routes over repo on a local port and
+// returns a client for them holding token
+func internalAPI(t *testing.T, repo database.LuckyRepo, token string) *internalapi.Client {
+	t.Helper()
+	controllers.InitLuckyNumberService(services.NewLuckyNumberService(repo), repo)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	RegisterInternalRoutes(app, testInternalToken)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go app.Listener(ln)
+	t.Cleanup(func() { app.Shutdown() })
+	return internalapi.NewClient("http://"+ln.Addr().String(), token, nil)
+}
+
+func TestInternalAPIEndToEnd(t *testing.T) {
+	repo := newGatewayRepo()
+	client := internalAPI(t, repo, testInternalToken)
+	ctx := context.Background()
+
+	player, err := client.GetPlayerSummary(ctx, "0700000001")
+	if err != nil || player.Msisdn != "254700000001" || player.Balance != 500 || player.Name != "Wanjiru" {
+		t.Fatalf("player = %+v, %v, want Wanjiru's 500", player, err)
+	}
+
+	games, err := client.GetActiveGames(ctx)
+	if err != nil || len(games) != 1 {
+		t.Fatalf("games = %+v, %v, want PawaBox", games, err)
+	}
+	if g := games[0]; g.ID != "1" || g.Boxes != 7 || g.StakeMode != "fixed" || g.DefaultStake != 20 {
+		t.Errorf("game = %+v, want PawaBox's 7 boxes at a fixed 20", g)
+	}
+
+	bet, err := client.PlaceBet(ctx, internalapi.PlaceBetRequest{Msisdn: "254700000001", GameCatID: "1", Box: "3", Stake: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bet.Reference == "" || bet.Box != "3" || (bet.Result != status.ResultWin.String() && bet.Result != status.ResultLoss.String()) {
+		t.Errorf("bet = %+v, want a settled bet on box 3", bet)
+	}
+	if player, _ := client.GetPlayerSummary(ctx, "254700000001"); player.Balance != 480 {
+		t.Errorf("balance after the bet = %v, want 480", player.Balance)
+	}
+
+	result, err := client.GetBetResult(ctx, bet.Reference)
+	if err != nil || result.Reference != bet.Reference || result.Stake != 20 || result.Msisdn != "254700000001" {
+		t.Fatalf("result = %+v, %v, want the bet's round", result, err)
+	}
+	if result.State != database.RoundSettled && result.State != database.RoundPaid {
+		t.Errorf("round state = %s, want settled or paid", result.State)
+	}
+}
+
+func TestInternalAPIRefusals(t *testing.T) {
+	repo := newGatewayRepo()
+	client := internalAPI(t, repo, testInternalToken)
+	ctx := context.Background()
+
+	refusals := []struct {
+		name   string
+		call   func() error
+		status int
+		code   string
+	}{
+		{"unknown player", func() error { _, err := client.GetPlayerSummary(ctx, "254700000009"); return err }, 404, ""},
+		{"unknown game", func() error {
+			_, err := client.PlaceBet(ctx, internalapi.PlaceBetRequest{Msisdn: "254700000001", GameCatID: "9", Box: "3", Stake: 20})
+			return err
+		}, 404, ""},
+		{"stake off the rules", func() error {
+			_, err := client.PlaceBet(ctx, internalapi.PlaceBetRequest{Msisdn: "254700000001", GameCatID: "1", Box: "3", Stake: 25})
+			return err
+		}, 422, ""},
+		{"box off the grid", func() error {
+			_, err := client.PlaceBet(ctx, internalapi.PlaceBetRequest{Msisdn: "254700000001", GameCatID: "1", Box: "8", Stake: 20})
+			return err
+		}, 422, ""},
+		{"channel", func() error {
+			_, err := client.PlaceBet(ctx, internalapi.PlaceBetRequest{Msisdn: "254700000001", GameCatID: "1", Box: "3", Stake: 20, Channel: "sms"})
+			return err
+		}, 400, "invalid_channel"},
+		{"unknown bet", func() error { _, err := client.GetBetResult(ctx, "NOPE"); return err }, 404, ""},
+	}
+	for _, tc := range refusals {
+		var apiErr *internalapi.Error
+		if err := tc.call(); !errors.As(err, &apiErr) || apiErr.Status != tc.status || (tc.code != "" && apiErr.Code != tc.code) {
+			t.Errorf("%s = %v, want a %d %s", tc.name, err, tc.status, tc.code)
+		}
+	}
+	if len(repo.rounds) != 0 {
+		t.Errorf("refused bets opened %d rounds", len(repo.rounds))
+	}
+
+	outsider := internalAPI(t, repo, "not-the-token")
+	var apiErr *internalapi.Error
+	if _, err := outsider.GetActiveGames(ctx); !errors.As(err, &apiErr) || apiErr.Status != 401 || apiErr.Code != "unauthorized" {
+		t.Errorf("wrong token = %v, want 401 unauthorized", err)
+	}
+}
@@ -12,13 +12,19 @@ func RegisterRoutes(app *fiber.App) {
 
 	api.Get("/", controllers.Hello)
 	api.Get("/test", controllers.Test)
-	api.Post("/place_bet_pawabox", utils.JWTMiddleware(), controllers.PlaceBetLuckyNumber)
+	api.Get("/openapi.json", OpenAPIHandler)
+	if docsEnabled {
+		api.Get("/docs", SwaggerUIHandler)
+	}
+	api.Post("/place_bet_pawabox", utils.DrainMiddleware(), utils.AdmissionMiddleware("place_bet_pawabox"), utils.JWTMiddleware(), controllers.Idempotent("place_bet_pawabox"), controllers.PlaceBetLuckyNumber)
 	api.Post("/settle_bt_luckynumber", controllers.SettleBTLuckyNumber)
 	api.Post("/settle_transaction", controllers.SettleBetLuckyNumber)
+	api.Post("/settle_reversal", controllers.SettleReversalLuckyNumber)
+	api.Post("/sms_dlr", controllers.SMSDeliveryReportHandler)
 
-	api.Post("/place_bet_spin", utils.JWTMiddleware(), controllers.PlaceBetSpin)
+	api.Post("/place_bet_spin", utils.DrainMiddleware(), utils.AdmissionMiddleware("place_bet_spin"), utils.JWTMiddleware(), controllers.PlaceBetSpin)
 
-	api.Post("/initiate_deposit", utils.JWTMiddleware(), controllers.IniatateDepositLuckyNumber)
+	api.Post("/initiate_deposit", utils.DrainMiddleware(), utils.AdmissionMiddleware("initiate_deposit"), utils.JWTMiddleware(), controllers.Idempotent("initiate_deposit"), controllers.IniatateDepositLuckyNumber)
 
 	api.Post("/settle_withdrawal", controllers.SettleWithdrawalLuckyNumber)
 	api.Post("/settle_withdrawal_b2b", controllers.SettleWithdrawalB2BLuckyNumber)
@@ -30,6 +36,10 @@ func RegisterRoutes(app *fiber.App) {
 	api.Post("/update_profile_pic", utils.JWTMiddleware(), controllers.UpdateUserProfilePic)
 
 	api.Put("/user", utils.JWTMiddleware(), controllers.UpdateUser)
+	api.Put("/user/msisdn", utils.JWTMiddleware(), controllers.RequestMsisdnChange)
+	api.Post("/user/msisdn/verify", utils.JWTMiddleware(), controllers.ConfirmMsisdnChange)
+	api.Get("/profile", utils.JWTMiddleware(), controllers.GetProfileHandler)
+	api.Put("/profile", utils.JWTMiddleware(), controllers.UpdateProfileHandler)
 
 	api.Post("/request_delete_user", utils.JWTMiddleware(), controllers.RequestAccountDeletion)
 
@@ -44,6 +54,12 @@ func RegisterRoutes(app *fiber.App) {
 	api.Post("/list_withdrawal", utils.JWTMiddleware(), controllers.GetWithdrawalHandler)
 
 	api.Post("/list_deposit", utils.JWTMiddleware(), controllers.GetDepositHandler)
+	api.Get("/deposit_status/:reference", utils.JWTMiddleware(), controllers.GetDepositStatusHandler)
+	api.Post("/retry_stk", utils.DrainMiddleware(), utils.AdmissionMiddleware("retry_stk"), utils.JWTMiddleware(), controllers.RetrySTKHandler)
+	api.Get("/bet/:reference", utils.JWTMiddleware(), controllers.GetBetHandler)
+	api.Get("/open_rounds", utils.JWTMiddleware(), controllers.OpenRoundsHandler)
+	api.Get("/wallet", utils.JWTMiddleware(), controllers.GetWalletHandler)
+	api.Get("/tax_preview", utils.JWTMiddleware(), controllers.GetTaxPreviewHandler)
 
 	api.Post("/register", controllers.Login)
 
@@ -51,12 +67,92 @@ func RegisterRoutes(app *fiber.App) {
 
 	api.Get("/get_year", controllers.GetYear)
 
-	api.Get("/spin_bet_type", utils.JWTMiddleware(), controllers.GetBetAmount)
+	api.Get("/winners", controllers.GetWinnersHandler)
+
+	api.Get("/promotions", controllers.GetPromotionsHandler)
+
+	api.Post("/transfer", utils.DrainMiddleware(), utils.AdmissionMiddleware("transfer"), utils.JWTMiddleware(), controllers.TransferHandler)
+	api.Post("/withdraw", utils.DrainMiddleware(), utils.AdmissionMiddleware("withdraw"), utils.JWTMiddleware(), controllers.WithdrawHandler)
+
+	api.Get("/bet_amounts", utils.JWTMiddleware(), controllers.GetBetAmount)
+	api.Get("/spin_bet_type", utils.JWTMiddleware(), controllers.GetBetAmount) // older spin clients
 
 	api.Post("/request_self_exclusion_period", utils.JWTMiddleware(), controllers.RequestSelfExlusion)
 	api.Post("/verify_self_exclusion_period", utils.JWTMiddleware(), controllers.VerySelfExlusion)
 
+	api.Post("/resend_otp", controllers.ResendOTP)
 	api.Post("/verify_otp", controllers.VerifyOTP)
+	api.Post("/refresh_token", controllers.RefreshTokenHandler)
+	api.Post("/logout", utils.JWTMiddleware(), controllers.LogoutHandler)
+	api.Get("/sessions", utils.JWTMiddleware(), controllers.ListSessionsHandler)
+	api.Delete("/sessions/:id", utils.JWTMiddleware(), controllers.EndSessionHandler)
+
+	admin := api.Group("/admin", utils.JWTMiddleware(), utils.RequireRole(utils.RoleAdmin))
+	admin.Get("/players", controllers.ListPlayerStatsHandler)
+	admin.Get("/players/export", controllers.ExportPlayerStatsHandler)
+	admin.Get("/deletions", controllers.ListDeletionRequestsHandler)
+	admin.Get("/freebets/liability", controllers.FreeBetLiabilityHandler)
+	admin.Get("/players/duplicates", controllers.FindDuplicatePlayersHandler)
+	admin.Get("/players/:msisdn/stats", controllers.GetPlayerStatsHandler)
+	admin.Post("/players/:msisdn/bonus", controllers.GrantBonusHandler)
+	admin.Post("/players/:msisdn/revoke_sessions", controllers.RevokeSessionsHandler)
+	admin.Get("/players/:msisdn/sessions", controllers.ListPlayerSessionsHandler)
+	admin.Delete("/sessions/:id", controllers.EndPlayerSessionHandler)
+	admin.Get("/stats/daily", controllers.GetDailyStatsHandler)
+	admin.Get("/stats/channels", controllers.GetChannelStatsHandler)
+	admin.Get("/stats/cache", controllers.GetCacheStatsHandler)
+	admin.Get("/stats/load", controllers.GetLoadStatsHandler)
+	admin.Get("/stats/verification_purge", controllers.GetVerificationPurgeStatsHandler)
+	admin.Get("/stats/deposits_by_shortcode", controllers.GetDepositsByShortcodeHandler)
+	admin.Get("/stats/exposure", controllers.GetExposureStatsHandler)
+	admin.Get("/reports/daily", controllers.GetDailyReportHandler)
+	admin.Get("/reports/monthly", controllers.GetMonthlyReportHandler)
+	admin.Get("/reports/basket_history", controllers.GetBasketHistoryHandler)
+	admin.Post("/reports/basket_history/snapshot", controllers.SnapshotBalancesHandler)
+	admin.Get("/basket", controllers.GetBasketHandler)
+	admin.Get("/jackpots/reconcile", controllers.GetJackpotReconciliationHandler)
+	admin.Get("/jackpots/consistency", controllers.GetJackpotConsistencyHandler)
+	admin.Get("/audit/statuses", controllers.AuditStatusesHandler)
+	admin.Get("/search", controllers.SearchHandler)
+	admin.Post("/basket/topup", controllers.TopUpBasketHandler)
+	admin.Post("/simulate_rtp", controllers.SimulateRTPHandler)
+	admin.Get("/maintenance", controllers.GetMaintenanceHandler)
+	admin.Put("/maintenance", controllers.SetMaintenanceHandler)
+	admin.Get("/welcome_grant", controllers.GetWelcomeGrantHandler)
+	admin.Put("/welcome_grant", controllers.SetWelcomeGrantHandler)
+	admin.Get("/flags", controllers.ListFeatureFlagsHandler)
+	admin.Put("/flags/:name", controllers.SetFeatureFlagHandler)
+	admin.Get("/tax_rates", controllers.ListTaxRatesHandler)
+	admin.Post("/tax_rates", controllers.CreateTaxRateHandler)
+	admin.Put("/tax_rates/:id", controllers.UpdateTaxRateHandler)
+	admin.Delete("/tax_rates/:id", controllers.DeleteTaxRateHandler)
+	admin.Get("/rounds/:reference", controllers.GetRoundHandler)
+	admin.Get("/outcome_decisions/:reference", controllers.GetOutcomeDecisionHandler)
+	admin.Get("/settlement_lag", controllers.GetSettlementLagHandler)
+	admin.Get("/settlement_lag/metrics", controllers.SettlementLagMetricsHandler)
+	admin.Get("/withdrawals/stuck", controllers.ListStuckWithdrawalsHandler)
+	admin.Post("/withdrawals/:reference/retry", controllers.RetryWithdrawalHandler)
+	admin.Get("/callbacks", controllers.ListCallbacksHandler)
+	admin.Post("/callbacks/:id/retry", controllers.RetryCallbackHandler)
+	admin.Get("/deposit_reviews", controllers.ListDepositReviewsHandler)
+	admin.Get("/settings", controllers.GetSettingsHandler)
+	admin.Put("/settings", controllers.UpdateSettingsHandler)
+	admin.Get("/bet_timing/metrics", controllers.BetTimingMetricsHandler)
+	admin.Get("/campaigns", controllers.ListCampaignsHandler)
+	admin.Post("/campaigns", controllers.CreateCampaignHandler)
+	admin.Put("/campaigns/:id", controllers.UpdateCampaignHandler)
+	admin.Delete("/campaigns/:id", controllers.DeleteCampaignHandler)
+	admin.Get("/templates", controllers.ListMessageTemplatesHandler)
+	admin.Put("/templates/:key/:language", controllers.SaveMessageTemplateHandler)
+	admin.Delete("/templates/:key/:language", controllers.DeleteMessageTemplateHandler)
+	admin.Get("/shortcodes", controllers.ListShortcodesHandler)
+	admin.Put("/shortcodes/:shortcode", controllers.SaveShortcodeHandler)
+	admin.Delete("/shortcodes/:shortcode", controllers.DeleteShortcodeHandler)
+	admin.Get("/webhooks", controllers.ListWebhooksHandler)
+	admin.Post("/webhooks", controllers.CreateWebhookHandler)
+	admin.Put("/webhooks/:id", controllers.UpdateWebhookHandler)
+	admin.Delete("/webhooks/:id", controllers.DeleteWebhookHandler)
+	admin.Get("/webhooks/:id/deliveries", controllers.ListWebhookDeliveriesHandler)
 
 	// metrics route omitted per your instruction (no Prometheus)
 }
@@ -0,0 +1,462 @@
+package routes
+
+import (
+	"encoding/json"
+	"fiberapp/models"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// docsEnabled serves the Swagger UI; set it with ConfigureDocs
+var docsEnabled bool
+
+// ConfigureDocs turns the Swagger UI at /api/v1/docs on or off. Keep it off
+// in production; /api/v1/openapi.json is always served.
+func ConfigureDocs(enabled bool) {
+	docsEnabled = enabled
+}
+
+// routeDoc describes one route of apiDocs
+type routeDoc struct {
+	Method   string
+	Path     string // Fiber path, e.g. /api/v1/admin/webhooks/:id
+	Tag      string
+	Summary  string
+	Auth     string            // "", "jwt", "optional" or "admin"
+	Query    map[string]string // query parameter -> description
+	Body     interface{}       // request body, nil when there is none
+	Response interface{}       // success body: a response struct or envelope(...)
+	Examples *examples
+}
+
+type examples struct {
+	Request  interface{}
+	Response interface{}
+}
+
+// enveloped is a success body: the Status/StatusCode/StatusMessage envelope
+// plus the listed top-level fields
+type enveloped []envelopeField
+
+type envelopeField struct {
+	Key   string
+	Value interface{}
+}
+
+// envelope describes a success body from key, value pairs; the values are
+// zero values of the fields' types
+func envelope(pairs ...interface{}) enveloped {
+	fields := make(enveloped, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		fields = append(fields, envelopeField{Key: pairs[i].(string), Value: pairs[i+1]})
+	}
+	return fields
+}
+
+var (
+	specOnce sync.Once
+	specJSON []byte
+	specErr  error
+)
+
+// OpenAPISpec returns the OpenAPI 3 document built from apiDocs
+func OpenAPISpec() ([]byte, error) {
+	specOnce.Do(func() {
+		specJSON, specErr = json.Marshal(buildSpec(apiDocs))
+	})
+	return specJSON, specErr
+}
+
+// OpenAPIHandler - GET /api/v1/openapi.json
+func OpenAPIHandler(c *fiber.Ctx) error {
+	spec, err := OpenAPISpec()
+	if err != nil {
+		return c.Status(500).JSON(models.NewErrorResponse(500, 1, "failed to build API spec"))
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Send(spec)
+}
+
+// SwaggerUIHandler - GET /api/v1/docs
+func SwaggerUIHandler(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+	return c.SendString(swaggerUI)
+}
+
+const swaggerUI = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>PawaBox API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({ url: "/api/v1/openapi.json", dom_id: "#swagger-ui" });</script>
+</body>
+</html>`
+
+// CheckOpenAPI reports /api/v1 routes registered on app but missing from
+// the document, and references in the document that do not resolve. Call
+// it after RegisterRoutes.
+func CheckOpenAPI(app *fiber.App) []error {
+	var problems []error
+
+	documented := make(map[string]bool, len(apiDocs))
+	for _, d := range apiDocs {
+		documented[d.Method+" "+d.Path] = true
+	}
+	seen := make(map[string]bool)
+	for _, r := range app.GetRoutes(true) {
+		if !strings.HasPrefix(r.Path, "/api/v1") {
+			continue
+		}
+		switch r.Method {
+		case fiber.MethodGet, fiber.MethodPost, fiber.MethodPut, fiber.MethodDelete, fiber.MethodPatch:
+		default:
+			continue
+		}
+		key := r.Method + " " + strings.TrimSuffix(r.Path, "/")
+		if r.Path == "/api/v1/" {
+			key = r.Method + " /api/v1/"
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if !documented[key] {
+			problems = append(problems, fmt.Errorf("route %s is not in the OpenAPI document", key))
+		}
+	}
+
+	spec := buildSpec(apiDocs)
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	walkRefs(spec, func(ref string) {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		if _, ok := schemas[name]; !ok {
+			problems = append(problems, fmt.Errorf("unresolved reference %s", ref))
+		}
+	})
+	for _, d := range apiDocs {
+		if d.Summary == "" || d.Response == nil {
+			problems = append(problems, fmt.Errorf("route %s %s has no summary or response", d.Method, d.Path))
+		}
+	}
+	return problems
+}
+
+func walkRefs(v interface{}, visit func(string)) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if ref, ok := child.(string); ok && k == "$ref" {
+				visit(ref)
+				continue
+			}
+			walkRefs(child, visit)
+		}
+	case []interface{}:
+		for _, child := range t {
+			walkRefs(child, visit)
+		}
+	}
+}
+
+// buildSpec renders docs as an OpenAPI 3.0 document
+func buildSpec(docs []routeDoc) map[string]interface{} {
+	b := &schemaBuilder{schemas: map[string]interface{}{}}
+	b.schemas["Envelope"] = map[string]interface{}{
+		"type":     "object",
+		"required": []string{"Status", "StatusCode", "StatusMessage"},
+		"properties": map[string]interface{}{
+			"Status":        map[string]interface{}{"type": "integer", "example": 200},
+			"StatusCode":    map[string]interface{}{"type": "integer", "description": "0 on success, non-zero codes identify the failure", "example": 0},
+			"StatusMessage": map[string]interface{}{"description": "message, or the payload on some routes"},
+		},
+	}
+	errorResponse := map[string]interface{}{
+		"description": "Error envelope",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema":  ref("Envelope"),
+				"example": map[string]interface{}{"Status": 400, "StatusCode": 1, "StatusMessage": "invalid JSON"},
+			},
+		},
+	}
+
+	paths := map[string]interface{}{}
+	for _, d := range docs {
+		path, params := openAPIPath(d.Path)
+		for name, desc := range d.Query {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "query", "required": false,
+				"description": desc, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		sort.Slice(params, func(i, j int) bool {
+			return params[i]["in"].(string)+params[i]["name"].(string) < params[j]["in"].(string)+params[j]["name"].(string)
+		})
+
+		success := map[string]interface{}{"schema": b.body(d.Response)}
+		if d.Examples != nil && d.Examples.Response != nil {
+			success["example"] = d.Examples.Response
+		}
+		op := map[string]interface{}{
+			"tags":        []string{d.Tag},
+			"summary":     d.Summary,
+			"operationId": operationID(d.Method, path),
+			"responses": map[string]interface{}{
+				"200": map[string]interface{}{
+					"description": "Success",
+					"content":     map[string]interface{}{"application/json": success},
+				},
+				"default": errorResponse,
+			},
+		}
+		if len(params) > 0 {
+			op["parameters"] = params
+		}
+		if d.Body != nil {
+			content := map[string]interface{}{"schema": b.schema(reflect.TypeOf(d.Body))}
+			if d.Examples != nil && d.Examples.Request != nil {
+				content["example"] = d.Examples.Request
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{bodyMIME(d.Body): content},
+			}
+		}
+		switch d.Auth {
+		case "jwt", "admin":
+			op["security"] = []map[string][]string{{"bearerAuth": {}}}
+		case "optional":
+			op["security"] = []map[string][]string{{}, {"bearerAuth": {}}}
+		}
+		if d.Auth == "admin" {
+			op["description"] = "Requires a token with the admin role."
+		}
+
+		item, _ := paths[path].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(d.Method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "PawaBox Lucky Number API",
+			"version":     "1.0.0",
+			"description": "Every response carries Status, StatusCode and StatusMessage. Errors carry only those, plus MessageCode when the message is catalogued; StatusMessage is then in the Accept-Language (en or sw), else the player's language, else English.",
+		},
+		"servers": []map[string]interface{}{{"url": "/"}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": b.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+					"description":  "Access token from /api/v1/verify_otp or /api/v1/refresh_token",
+				},
+			},
+		},
+	}
+}
+
+// multipartForm marks a request body sent as multipart/form-data
+type multipartForm struct {
+	File []byte `json:"file" format:"binary"`
+}
+
+func bodyMIME(body interface{}) string {
+	if _, ok := body.(multipartForm); ok {
+		return "multipart/form-data"
+	}
+	return "application/json"
+}
+
+// openAPIPath turns /users/:id into /users/{id} and returns its path parameters
+func openAPIPath(path string) (string, []map[string]interface{}) {
+	var params []map[string]interface{}
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			name := strings.TrimSuffix(strings.TrimPrefix(p, ":"), "?")
+			parts[i] = "{" + name + "}"
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true,
+				"schema": map[string]interface{}{"type": "string"},
+			})
+		}
+	}
+	return strings.Join(parts, "/"), params
+}
+
+func operationID(method, path string) string {
+	id := strings.ToLower(method)
+	for _, p := range strings.Split(strings.TrimPrefix(path, "/api/v1"), "/") {
+		p = strings.Trim(p, "{}")
+		if p == "" {
+			continue
+		}
+		id += "_" + strings.ReplaceAll(p, "-", "_")
+	}
+	return id
+}
+
+func ref(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// schemaBuilder turns Go types into schemas, registering named structs
+// under components/schemas
+type schemaBuilder struct {
+	schemas map[string]interface{}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	flexStringType = reflect.TypeOf(models.FlexString(""))
+	amountType     = reflect.TypeOf(models.Amount(0))
+	rawType        = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// body returns the schema of a success response
+func (b *schemaBuilder) body(v interface{}) map[string]interface{} {
+	e, ok := v.(enveloped)
+	if !ok {
+		return b.schema(reflect.TypeOf(v))
+	}
+	props := map[string]interface{}{}
+	for _, f := range e {
+		props[f.Key] = b.schema(reflect.TypeOf(f.Value))
+	}
+	if len(props) == 0 {
+		return ref("Envelope")
+	}
+	return map[string]interface{}{
+		"allOf": []interface{}{
+			ref("Envelope"),
+			map[string]interface{}{"type": "object", "properties": props},
+		},
+	}
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	switch t {
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case flexStringType:
+		return map[string]interface{}{"type": "string", "description": "string or number"}
+	case amountType:
+		return map[string]interface{}{"type": "number", "description": "number or numeric string"}
+	case rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := b.schema(t.Elem())
+		if _, isRef := s["$ref"]; !isRef {
+			s["nullable"] = true
+		}
+		return s
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = map[string]interface{}{} // placeholder for recursive types
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return ref(t.Name())
+	}
+	return map[string]interface{}{}
+}
+
+func (b *schemaBuilder) object(t reflect.Type) map[string]interface{} {
+	props := map[string]interface{}{}
+	b.fields(t, props)
+	return map[string]interface{}{"type": "object", "properties": props}
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, props map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, props)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := b.schema(f.Type)
+		if _, isRef := s["$ref"]; !isRef {
+			if example := f.Tag.Get("example"); example != "" {
+				s["example"] = exampleValue(s, example)
+			}
+			if format := f.Tag.Get("format"); format != "" {
+				s["format"] = format
+			}
+		}
+		props[name] = s
+	}
+}
+
+// exampleValue converts an example tag to the schema's type
+func exampleValue(s map[string]interface{}, example string) interface{} {
+	switch s["type"] {
+	case "integer", "number":
+		var n json.Number = json.Number(example)
+		if f, err := n.Float64(); err == nil {
+			return f
+		}
+	case "boolean":
+		return example == "true"
+	}
+	return example
+}
@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	ConfigureDocs(true)
+	defer ConfigureDocs(false)
+	app := fiber.New()
+	RegisterRoutes(app)
+
+	for _, problem := range CheckOpenAPI(app) {
+		t.Error(problem)
+	}
+}
+
+func TestOpenAPISpecIsValid(t *testing.T) {
+	raw, err := OpenAPISpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Info       map[string]interface{}                       `json:"info"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas         map[string]map[string]interface{} `json:"schemas"`
+			SecuritySchemes map[string]map[string]interface{} `json:"securitySchemes"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.0.") || spec.Info["title"] == nil || spec.Info["version"] == nil {
+		t.Errorf("openapi %q, info %v; want a 3.0 document with title and version", spec.OpenAPI, spec.Info)
+	}
+
+	bearer := spec.Components.SecuritySchemes["bearerAuth"]
+	if bearer["type"] != "http" || bearer["scheme"] != "bearer" || bearer["bearerFormat"] != "JWT" {
+		t.Errorf("bearerAuth = %v, want an http bearer JWT scheme", bearer)
+	}
+	envelope := spec.Components.Schemas["Envelope"]
+	for _, field := range []string{"Status", "StatusCode", "StatusMessage"} {
+		if props, _ := envelope["properties"].(map[string]interface{}); props[field] == nil {
+			t.Errorf("Envelope lacks %s", field)
+		}
+	}
+
+	ids := map[string]string{}
+	for path, item := range spec.Paths {
+		if !strings.HasPrefix(path, "/api/v1") || strings.Contains(path, ":") {
+			t.Errorf("path %s should be an /api/v1 path with {params}", path)
+		}
+		for method, op := range item {
+			where := strings.ToUpper(method) + " " + path
+			responses, _ := op["responses"].(map[string]interface{})
+			if responses["200"] == nil || responses["default"] == nil {
+				t.Errorf("%s lacks a success or error response", where)
+			}
+			id, _ := op["operationId"].(string)
+			if other, dup := ids[id]; id == "" || dup {
+				t.Errorf("%s operationId %q is empty or shared with %s", where, id, other)
+			}
+			ids[id] = where
+		}
+	}
+
+	for _, path := range []string{"/api/v1/place_bet_pawabox", "/api/v1/login"} {
+		op := spec.Paths[path]["post"]
+		body, _ := op["requestBody"].(map[string]interface{})
+		content, _ := body["content"].(map[string]interface{})
+		js, _ := content["application/json"].(map[string]interface{})
+		if js["example"] == nil {
+			t.Errorf("%s has no request example", path)
+		}
+		ok, _ := op["responses"].(map[string]interface{})["200"].(map[string]interface{})
+		okJSON, _ := ok["content"].(map[string]interface{})["application/json"].(map[string]interface{})
+		if okJSON["example"] == nil {
+			t.Errorf("%s has no response example", path)
+		}
+	}
+	if sec := spec.Paths["/api/v1/place_bet_pawabox"]["post"]["security"]; sec == nil {
+		t.Error("place_bet_pawabox should require the bearer token")
+	}
+}
+
+func TestDocsRoutes(t *testing.T) {
+	get := func(app *fiber.App, path string) (int, string) {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, resp.Header.Get("Content-Type")
+	}
+
+	ConfigureDocs(false)
+	app := fiber.New()
+	RegisterRoutes(app)
+	if status, ctype := get(app, "/api/v1/openapi.json"); status != 200 || !strings.HasPrefix(ctype, "application/json") {
+		t.Errorf("openapi.json = %d %s, want 200 JSON", status, ctype)
+	}
+	if status, _ := get(app, "/api/v1/docs"); status != 404 {
+		t.Errorf("docs with server.docs off = %d, want 404", status)
+	}
+
+	ConfigureDocs(true)
+	defer ConfigureDocs(false)
+	app = fiber.New()
+	RegisterRoutes(app)
+	if status, ctype := get(app, "/api/v1/docs"); status != 200 || !strings.HasPrefix(ctype, "text/html") {
+		t.Errorf("docs with server.docs on = %d %s, want the Swagger UI", status, ctype)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fiberapp/utils"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ProfileUploadDir holds the profile pictures served from /image
+const ProfileUploadDir = "./profile_uploads"
+
+// deletionBatch bounds how many accounts one run of the deletion job handles
+const deletionBatch = 200
+
+// DeletionRequest is a pending account deletion in the admin report
+type DeletionRequest struct {
+	Msisdn      string    `json:"msisdn"`
+	RequestedAt time.Time `json:"requested_at"`
+	DueAt       time.Time `json:"due_at"`
+	Blocked     string    `json:"blocked,omitempty"` // pending_withdrawal or open_debt
+}
+
+// AccountDeletionStats counts what the deletion job has done since the
+// process started
+type AccountDeletionStats struct {
+	Runs        int64      `json:"runs"`
+	Anonymized  int64      `json:"anonymized"`
+	Blocked     int64      `json:"blocked"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastBlocked int64      `json:"last_blocked"`
+}
+
+var (
+	deletionMu    sync.Mutex
+	deletionStats AccountDeletionStats
+)
+
+// DeleteUser starts deleting msisdn's account: it is marked pending_deletion,
+// can no longer sign in and loses its access and refresh tokens. The PII is
+// removed by the deletion job once limits.deletion_retention has passed.
+func (s *LuckyNumberService) DeleteUser(msisdn string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.db.RequestPlayerDeletion(ctx, msisdn); err != nil {
+		return err
+	}
+	if _, err := s.RevokeSessions(msisdn); err != nil {
+		logrus.Errorf("account deletion: revoking sessions for %s failed: %v", msisdn, err)
+	}
+	logrus.Infof("account deletion: %s requested deletion", msisdn)
+	return nil
+}
+
+// AnonymizeDueAccounts anonymizes every account whose deletion request is
+// older than limits.deletion_retention. Accounts with a pending withdrawal
+// or an open debt are skipped and flagged; they are retried on later runs.
+// Returns how many accounts were anonymized.
+func (s *LuckyNumberService) AnonymizeDueAccounts(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+
+	var anonymized, blocked int64
+	err := s.anonymizeDue(ctx, &anonymized, &blocked)
+
+	now := time.Now()
+	deletionMu.Lock()
+	deletionStats.Runs++
+	deletionStats.Anonymized += anonymized
+	deletionStats.Blocked += blocked
+	deletionStats.LastRun = &now
+	deletionStats.LastBlocked = blocked
+	deletionStats.LastError = ""
+	if err != nil {
+		deletionStats.LastError = err.Error()
+	}
+	deletionMu.Unlock()
+
+	return anonymized, err
+}
+
+func (s *LuckyNumberService) anonymizeDue(ctx context.Context, anonymized, blocked *int64) error {
+	due, err := s.db.ListDueDeletions(ctx, time.Now().Add(-limits.DeletionRetention), deletionBatch)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range due {
+		reason, err := s.db.GetDeletionBlocker(ctx, c.Msisdn)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			logrus.Warnf("account deletion: %s blocked by %s", c.Msisdn, reason)
+			if err := s.db.MarkDeletionBlocked(ctx, c.Msisdn, reason); err != nil {
+				return err
+			}
+			*blocked++
+			continue
+		}
+
+		ok, err := s.db.AnonymizePlayer(ctx, c.Msisdn, anonymousToken(c.Msisdn))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		*anonymized++
+
+		if c.ProfileURL != "" {
+			file := filepath.Join(ProfileUploadDir, path.Base(c.ProfileURL))
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				logrus.Errorf("account deletion: removing %s failed: %v", file, err)
+			}
+		}
+	}
+	return nil
+}
+
+// anonymousToken replaces msisdn once an account is deleted. The hash is
+// salted with random bytes that are never stored, so the token cannot be
+// matched back by hashing every possible number. It is 12 characters long,
+// like an msisdn, so it fits the columns it replaces.
+func anonymousToken(msisdn string) string {
+	salt := make([]byte, 16)
+	_, _ = rand.Read(salt)
+	sum := sha256.Sum256(append(salt, msisdn...))
+	return "del" + hex.EncodeToString(sum[:])[:9]
+}
+
+// DeletionRequests returns the accounts waiting to be anonymized, with the
+// date each is due and why it is blocked if it is
+func (s *LuckyNumberService) DeletionRequests() ([]DeletionRequest, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := s.db.ListDeletionRequests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	requests := make([]DeletionRequest, 0, len(rows))
+	for _, row := range rows {
+		r := DeletionRequest{
+			Msisdn:  utils.ToString(row["msisdn"]),
+			Blocked: utils.ToString(row["deletion_blocked"]),
+		}
+		if t, ok := row["deletion_requested_at"].(time.Time); ok {
+			r.RequestedAt = t
+			r.DueAt = t.Add(limits.DeletionRetention)
+		}
+		requests = append(requests, r)
+	}
+	return requests, nil
+}
+
+// AccountDeletionStats returns the deletion job's counters
+func (s *LuckyNumberService) AccountDeletionStats() AccountDeletionStats {
+	deletionMu.Lock()
+	defer deletionMu.Unlock()
+	return deletionStats
+}
+
+// RunAccountDeletion anonymizes due accounts on every
+// limits.deletion_interval until ctx is done. A zero interval disables it.
+// Run it in one process only.
+func (s *LuckyNumberService) RunAccountDeletion(ctx context.Context) {
+	if limits.DeletionInterval <= 0 {
+		logrus.Info("account deletion: disabled")
+		return
+	}
+	ticker := time.NewTicker(limits.DeletionInterval)
+	defer ticker.Stop()
+
+	for {
+		anonymized, err := s.AnonymizeDueAccounts(ctx)
+		if err != nil {
+			logrus.Errorf("account deletion: failed after %d accounts: %v", anonymized, err)
+		} else if anonymized > 0 {
+			logrus.Infof("account deletion: anonymized %d accounts", anonymized)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
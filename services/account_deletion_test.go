@@ -0,0 +1,206 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// deletionRepo keeps deletion requests and blockers beside a memRepo. It
+// re-keys the player to the token on anonymization, as AnonymizePlayer does.
+type deletionRepo struct {
+	*memRepo
+	requested map[string]time.Time
+	profile   map[string]string
+	blockers  map[string]string
+	blocked   map[string]string
+	cutoff    time.Time
+	tokens    map[string]string // msisdn -> token it was anonymized to
+	created   []string
+}
+
+func newDeletionRepo() *deletionRepo {
+	return &deletionRepo{
+		memRepo:   newMemRepo(),
+		requested: map[string]time.Time{},
+		profile:   map[string]string{},
+		blockers:  map[string]string{},
+		blocked:   map[string]string{},
+		tokens:    map[string]string{},
+	}
+}
+
+func (r *deletionRepo) ListDueDeletions(ctx context.Context, requestedBefore time.Time, limit int) ([]database.DeletionCandidate, error) {
+	r.cutoff = requestedBefore
+	var due []database.DeletionCandidate
+	for msisdn, at := range r.requested {
+		if !at.After(requestedBefore) {
+			due = append(due, database.DeletionCandidate{Msisdn: msisdn, ProfileURL: r.profile[msisdn], RequestedAt: at})
+		}
+	}
+	return due, nil
+}
+
+func (r *deletionRepo) GetDeletionBlocker(ctx context.Context, msisdn string) (string, error) {
+	return r.blockers[msisdn], nil
+}
+
+func (r *deletionRepo) MarkDeletionBlocked(ctx context.Context, msisdn, reason string) error {
+	r.blocked[msisdn] = reason
+	return nil
+}
+
+func (r *deletionRepo) AnonymizePlayer(ctx context.Context, msisdn, token string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[msisdn]
+	if !ok {
+		return false, nil
+	}
+	delete(r.players, msisdn)
+	delete(r.requested, msisdn)
+	p.Msisdn = token
+	r.players[token] = p
+	r.tokens[msisdn] = token
+	return true, nil
+}
+
+func (r *deletionRepo) CreateUser(ctx context.Context, carrier, msisdn, name, myPromocode, promocode string) (int64, error) {
+	r.created = append(r.created, msisdn)
+	return r.addPlayer(msisdn, 0).ID, nil
+}
+
+func (r *deletionRepo) CreatePromo(ctx context.Context, msisdn, promocode string) (int64, error) {
+	return 1, nil
+}
+
+func TestAnonymizeRetentionBoundary(t *testing.T) {
+	repo := newDeletionRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now()
+	repo.addPlayer("254700000001", 0)
+	repo.addPlayer("254700000002", 0)
+	repo.requested["254700000001"] = now.Add(-limits.DeletionRetention - time.Minute)
+	repo.requested["254700000002"] = now.Add(-limits.DeletionRetention + time.Minute)
+
+	n, err := s.AnonymizeDueAccounts(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("AnonymizeDueAccounts = %d, %v, want 1", n, err)
+	}
+	if cutoff := now.Add(-limits.DeletionRetention); repo.cutoff.Before(cutoff) || repo.cutoff.Sub(cutoff) > time.Second {
+		t.Errorf("due before %s, want the retention window back from now, %s", repo.cutoff, cutoff)
+	}
+	if _, ok := repo.tokens["254700000001"]; !ok {
+		t.Error("the request past the retention window should be anonymized")
+	}
+	if _, ok := repo.tokens["254700000002"]; ok {
+		t.Error("the request inside the retention window must wait")
+	}
+}
+
+func TestAnonymizeBlocked(t *testing.T) {
+	repo := newDeletionRepo()
+	s := newTestService(t, repo, nil)
+	due := time.Now().Add(-limits.DeletionRetention - time.Hour)
+	for _, msisdn := range []string{"254700000001", "254700000002", "254700000003"} {
+		repo.addPlayer(msisdn, 0)
+		repo.requested[msisdn] = due
+	}
+	repo.blockers["254700000001"] = "pending_withdrawal"
+	repo.blockers["254700000002"] = "open_debt"
+	before := s.AccountDeletionStats()
+
+	n, err := s.AnonymizeDueAccounts(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("AnonymizeDueAccounts = %d, %v, want only the unblocked account", n, err)
+	}
+	if repo.blocked["254700000001"] != "pending_withdrawal" || repo.blocked["254700000002"] != "open_debt" {
+		t.Errorf("flagged %v, want each blocked account with its reason", repo.blocked)
+	}
+	for _, msisdn := range []string{"254700000001", "254700000002"} {
+		if _, ok := repo.tokens[msisdn]; ok {
+			t.Errorf("%s was anonymized despite its blocker", msisdn)
+		}
+	}
+	after := s.AccountDeletionStats()
+	if after.Blocked-before.Blocked != 2 || after.LastBlocked != 2 || after.Anonymized-before.Anonymized != 1 {
+		t.Errorf("stats %+v after %+v, want 2 blocked and 1 anonymized", after, before)
+	}
+
+	// The blocker clears and the next run picks the account up
+	delete(repo.blockers, "254700000001")
+	if n, _ := s.AnonymizeDueAccounts(context.Background()); n != 1 {
+		t.Errorf("after the withdrawal settled anonymized %d, want 1", n)
+	}
+}
+
+func TestAnonymizeRemovesProfilePicture(t *testing.T) {
+	dir := t.TempDir()
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.MkdirAll(ProfileUploadDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	picture := filepath.Join(ProfileUploadDir, "254700000001.jpg")
+	kept := filepath.Join(ProfileUploadDir, "254700000002.jpg")
+	for _, f := range []string{picture, kept} {
+		if err := os.WriteFile(f, []byte("jpeg"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repo := newDeletionRepo()
+	s := newTestService(t, repo, nil)
+	repo.addPlayer("254700000001", 0)
+	repo.requested["254700000001"] = time.Now().Add(-limits.DeletionRetention - time.Hour)
+	repo.profile["254700000001"] = "/image/../../254700000001.jpg"
+
+	if _, err := s.AnonymizeDueAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(picture); !os.IsNotExist(err) {
+		t.Error("the profile picture should be removed")
+	}
+	if _, err := os.Stat(kept); err != nil {
+		t.Error("another player's picture must stay")
+	}
+}
+
+func TestLoginAfterDeletionCreatesFreshAccount(t *testing.T) {
+	repo := newDeletionRepo()
+	s := newTestService(t, repo, nil)
+	old := repo.addPlayer(testMsisdn, 250)
+	repo.requested[testMsisdn] = time.Now().Add(-limits.DeletionRetention - time.Hour)
+
+	if _, err := s.AnonymizeDueAccounts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	token := repo.tokens[testMsisdn]
+	if !strings.HasPrefix(token, "del") || len(token) != len(testMsisdn) || strings.Contains(token, testMsisdn[3:]) {
+		t.Fatalf("token = %q, want a 12-character del token unrelated to the msisdn", token)
+	}
+
+	user, err := s.CheckUser(testMsisdn, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.created) != 1 || repo.created[0] != testMsisdn {
+		t.Fatalf("created %v, want a new account for the deleted msisdn", repo.created)
+	}
+	if user["id"] == old.ID || user["balance"] != 0.0 {
+		t.Errorf("new account = %v, want a fresh id and no balance", user)
+	}
+	if p := repo.player(token); p.ID != old.ID || p.Balance != 250 {
+		t.Errorf("anonymized account = %+v, want the old money kept under the token", p)
+	}
+	if anonymousToken(testMsisdn) == anonymousToken(testMsisdn) {
+		t.Error("tokens are salted, so the same msisdn should not hash to the same token twice")
+	}
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// AccountingPoolStats reports how busy the accounting workers are
+type AccountingPoolStats struct {
+	Workers int    `json:"workers"`
+	Busy    int64  `json:"busy"`
+	Peak    int64  `json:"peak"`    // most workers ever busy at once
+	Waiting int64  `json:"waiting"` // bets waiting for a free worker
+	Tasks   uint64 `json:"tasks"`   // statements run since start
+}
+
+// accountingPool runs the statements of a bet that may go in parallel on
+// limits.accounting_workers workers shared by every bet of the process. A
+// bet used to start a goroutine per statement, some 17 of them, so a burst
+// of bets put thousands of goroutines onto the database pool at once and
+// acquires timed out; now the statements past the worker count queue.
+type accountingPool struct {
+	jobs    chan accountingJob
+	workers int
+	busy    atomic.Int64
+	peak    atomic.Int64
+	waiting atomic.Int64
+	tasks   atomic.Uint64
+}
+
+type accountingJob struct {
+	task func() error
+	done chan<- error
+}
+
+func newAccountingPool(workers int) *accountingPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	p := &accountingPool{jobs: make(chan accountingJob), workers: workers}
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+func (p *accountingPool) work() {
+	for job := range p.jobs {
+		busy := p.busy.Add(1)
+		for peak := p.peak.Load(); busy > peak && !p.peak.CompareAndSwap(peak, busy); peak = p.peak.Load() {
+		}
+		err := job.task()
+		p.busy.Add(-1)
+		p.tasks.Add(1)
+		job.done <- err
+	}
+}
+
+// run runs tasks on the workers and waits for every one that started. It
+// returns the first error. Tasks still queued when ctx is done are not run
+// and ctx's error is returned, so a bet fails unless all of them succeeded.
+func (p *accountingPool) run(ctx context.Context, tasks ...func() error) error {
+	done := make(chan error, len(tasks))
+	started := 0
+	var err error
+	for _, task := range tasks {
+		job := accountingJob{task: task, done: done}
+		select {
+		case p.jobs <- job:
+			started++
+			continue
+		default:
+		}
+
+		p.waiting.Add(1)
+		select {
+		case p.jobs <- job:
+			started++
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		p.waiting.Add(-1)
+		if err != nil {
+			break
+		}
+	}
+
+	for ; started > 0; started-- {
+		if e := <-done; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *accountingPool) Stats() AccountingPoolStats {
+	return AccountingPoolStats{
+		Workers: p.workers,
+		Busy:    p.busy.Load(),
+		Peak:    p.peak.Load(),
+		Waiting: p.waiting.Load(),
+		Tasks:   p.tasks.Load(),
+	}
+}
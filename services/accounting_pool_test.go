@@ -0,0 +1,344 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/dbtest"
+	"fiberapp/models"
+	"fiberapp/status"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sirupsen/logrus"
+)
+
+// gauge counts statements in flight and the most at once
+type gauge struct {
+	inflight, peak atomic.Int64
+}
+
+func (g *gauge) statement(d time.Duration) {
+	n := g.inflight.Add(1)
+	for peak := g.peak.Load(); n > peak && !g.peak.CompareAndSwap(peak, n); peak = g.peak.Load() {
+	}
+	time.Sleep(d)
+	g.inflight.Add(-1)
+}
+
+func TestAccountingPoolCeiling(t *testing.T) {
+	const workers, bets, statements = 4, 50, 17
+	p := newAccountingPool(workers)
+	var g gauge
+
+	var wg sync.WaitGroup
+	for i := 0; i < bets; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tasks := make([]func() error, statements)
+			for j := range tasks {
+				tasks[j] = func() error { g.statement(100 * time.Microsecond); return nil }
+			}
+			if err := p.run(context.Background(), tasks...); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := g.peak.Load(); peak > workers {
+		t.Errorf("%d statements ran at once, want at most %d", peak, workers)
+	}
+	stats := p.Stats()
+	if stats.Peak > workers || stats.Peak < 2 || stats.Tasks != bets*statements || stats.Busy != 0 || stats.Waiting != 0 {
+		t.Errorf("stats = %+v, want %d tasks run on up to %d workers", stats, bets*statements, workers)
+	}
+}
+
+func TestAccountingPoolFirstError(t *testing.T) {
+	p := newAccountingPool(2)
+	boom := errors.New("deadlock detected")
+	var ran atomic.Int64
+	err := p.run(context.Background(),
+		func() error { ran.Add(1); return nil },
+		func() error { ran.Add(1); return boom },
+		func() error { time.Sleep(5 * time.Millisecond); ran.Add(1); return nil },
+		func() error { ran.Add(1); return errors.New("later") },
+	)
+	if err == nil || (!errors.Is(err, boom) && err.Error() != "later") {
+		t.Errorf("run = %v, want a statement's error", err)
+	}
+	if ran.Load() != 4 {
+		t.Errorf("%d statements finished before run returned, want it to wait for all 4", ran.Load())
+	}
+	if err := p.run(context.Background()); err != nil {
+		t.Errorf("no statements = %v", err)
+	}
+}
+
+func TestAccountingPoolContextDone(t *testing.T) {
+	p := newAccountingPool(1)
+	release := make(chan struct{})
+	hold := make(chan struct{})
+	go p.run(context.Background(), func() error { close(hold); <-release; return nil })
+	<-hold
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var ran atomic.Bool
+	if err := p.run(ctx, func() error { ran.Store(true); return nil }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("run with no free worker = %v, want the context's error", err)
+	}
+	close(release)
+	if err := p.run(context.Background(), func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if ran.Load() {
+		t.Error("a statement still waiting when the context ended was run")
+	}
+}
+
+// loadRepo makes some of a bet's accounting statements take time, and
+// counts how many run at once
+type loadRepo struct {
+	*memRepo
+	gauge
+	fail string // msisdn whose tax queue insert fails
+}
+
+func (r *loadRepo) UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error) {
+	r.statement(200 * time.Microsecond)
+	return r.memRepo.UpdateKPIHandle(ctx, mvalue)
+}
+
+func (r *loadRepo) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error) {
+	r.statement(200 * time.Microsecond)
+	return r.memRepo.UpdateKPIVIG(ctx, mvalue)
+}
+
+func (r *loadRepo) UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error) {
+	r.statement(200 * time.Microsecond)
+	return r.memRepo.UpdateHousePawaBoxKeBets(ctx, mvalue)
+}
+
+func (r *loadRepo) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error) {
+	r.statement(200 * time.Microsecond)
+	if msisdn == r.fail {
+		return 0, errors.New("tax queue: connection reset")
+	}
+	return r.memRepo.InsertTaxQueue(ctx, gameID, amount, taxAmount, taxDeductedAmount, rate, taxType, msisdn)
+}
+
+func TestBetsUnderLoadRespectWorkers(t *testing.T) {
+	const workers, players = 3, 40
+	repo := &loadRepo{memRepo: newMemRepo()}
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	s.accounts = newAccountingPool(workers)
+	for i := 0; i < players; i++ {
+		repo.addPlayer(fmt.Sprintf("2547%08d", i), 100)
+	}
+	repo.fail = fmt.Sprintf("2547%08d", 7)
+
+	var wg sync.WaitGroup
+	errs := make([]error, players)
+	for i := 0; i < players; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msisdn := fmt.Sprintf("2547%08d", i)
+			user, _ := repo.CheckUser(context.Background(), msisdn)
+			_, errs[i] = s.PlaceBet(context.Background(), user, "", "Test", "1", msisdn, 20, "1", "web")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i == 7 && err == nil {
+			t.Error("a bet whose accounting statement failed was accepted")
+		} else if i != 7 && err != nil {
+			t.Errorf("bet %d: %v", i, err)
+		}
+	}
+	if peak := repo.peak.Load(); peak > workers || peak == 0 {
+		t.Errorf("%d accounting statements ran at once, want at most %d", peak, workers)
+	}
+	if stats := s.AccountingPoolStats(); stats.Peak > workers {
+		t.Errorf("stats = %+v, want at most %d busy", stats, workers)
+	}
+}
+
+// BenchmarkBetStatements books bets' stakes, the statements bookStake runs
+// for a cash bet, against the database at TEST_DATABASE_URL through a pool
+// of benchConns connections. "unbounded" runs each statement on a goroutine
+// of its own, as bets used to; "pool" runs them on an accounting pool of
+// benchWorkers. Each bet has benchDeadline to finish, as a request would.
+// It reports the share of bets that failed, and of those that timed out
+// acquiring a connection, and the bets' p50 and p99 latency. Skipped
+// without a database, see package dbtest:
+//
+//	TEST_DATABASE_URL=... go test ./services -run '^$' -bench BetStatements -benchtime 2000x
+func BenchmarkBetStatements(b *testing.B) {
+	const benchConns, benchWorkers, benchDeadline = 20, 16, 500 * time.Millisecond
+	pool := dbtest.Open(b)
+	dbtest.Reset(b, pool, "kpi", "kpi_by_channel", "HouseIncome", "HouseIncomeLogs", "Basket", "BasketLogs",
+		"tax_record", "withdrawal_b2b_to_process", "jackpot_kitty", "jackpot_contributions")
+	dbtest.SeedKPI(b, pool, clock.Now(), 0, 0)
+	dbtest.Exec(b, pool, `INSERT INTO "HouseIncome" (house_income) VALUES (0)`)
+	dbtest.Exec(b, pool, `INSERT INTO "Basket" (amount) VALUES (0)`)
+	dbtest.Exec(b, pool, `INSERT INTO "jackpot_kitty" (name_init, item_name, cost, pct_slice) VALUES ('', 'Jackpot', 100000, 100)`)
+
+	config := pool.Config().Copy()
+	config.MaxConns = benchConns
+	bounded, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer bounded.Close()
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	db := database.NewDatabaseWithPool(bounded, quiet)
+
+	statements := func(ctx context.Context, reference string) []func() error {
+		return []func() error{
+			func() error { _, err := db.UpdateHouseLucyNumberHouseCurrentRTP(ctx); return err },
+			func() error { _, err := db.UpdateKPIHandle(ctx, 20); return err },
+			func() error { _, err := db.UpdateKPIChannelHandle(ctx, "web", 20); return err },
+			func() error { _, err := db.UpdateKPIPayouts(ctx, 1, 0, 2); return err },
+			func() error {
+				_, err := db.InsertTaxQueue(ctx, reference, 20, 2, 18, 12.5, "excise", testMsisdn)
+				return err
+			},
+			func() error {
+				_, err := db.InsertB2BWithdrawalB2B(ctx, reference, testMsisdn, 2, status.B2BPlaced)
+				return err
+			},
+			func() error { _, err := db.UpdateJackpotKit(ctx, reference, 1); return err },
+			func() error { _, err := db.UpdateHousePawaBoxKeBets(ctx, 20); return err },
+			func() error {
+				_, err := db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "total_bets", testMsisdn, 20)
+				return err
+			},
+			func() error { _, err := db.UpdateHousePawaBoxKeHouse(ctx, 2); return err },
+			func() error { _, err := db.UpdateKPIVIG(ctx, 2); return err },
+			func() error {
+				_, err := db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "house_income", testMsisdn, 2)
+				return err
+			},
+			func() error { _, err := db.UpdateHousePawaBoxKeBasket(ctx, 18); return err },
+			func() error { _, err := db.InsertHouseBasketLogs(ctx, 0, 18, 18, "benchmark "+reference); return err },
+		}
+	}
+	unbounded := func(tasks []func() error) error {
+		errs := make([]error, len(tasks))
+		var wg sync.WaitGroup
+		for i, task := range tasks {
+			wg.Add(1)
+			go func(i int, task func() error) { defer wg.Done(); errs[i] = task() }(i, task)
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+	accounts := newAccountingPool(benchWorkers)
+
+	for _, run := range []struct {
+		name string
+		run  func(ctx context.Context, tasks []func() error) error
+	}{
+		{"unbounded", func(ctx context.Context, tasks []func() error) error { return unbounded(tasks) }},
+		{fmt.Sprintf("pool%d", benchWorkers), func(ctx context.Context, tasks []func() error) error { return accounts.run(ctx, tasks...) }},
+	} {
+		b.Run(run.name, func(b *testing.B) {
+			var (
+				mu       sync.Mutex
+				took     []time.Duration
+				failed   atomic.Int64
+				timedOut atomic.Int64
+				bet      atomic.Int64
+			)
+			b.SetParallelism(16)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					ctx, cancel := context.WithTimeout(context.Background(), benchDeadline)
+					reference := fmt.Sprintf("BENCH_%s_%d", run.name, bet.Add(1))
+					start := time.Now()
+					if err := run.run(ctx, statements(ctx, reference)); err != nil {
+						failed.Add(1)
+						if strings.Contains(err.Error(), "failed to acquire connection") {
+							timedOut.Add(1)
+						}
+					}
+					elapsed := time.Since(start)
+					cancel()
+					mu.Lock()
+					took = append(took, elapsed)
+					mu.Unlock()
+				}
+			})
+			slices.Sort(took)
+			b.ReportMetric(float64(failed.Load())/float64(len(took)), "failed/bet")
+			b.ReportMetric(float64(timedOut.Load())/float64(len(took)), "acquire-timeouts/bet")
+			b.ReportMetric(float64(took[len(took)/2].Microseconds())/1000, "p50-ms")
+			b.ReportMetric(float64(took[len(took)*99/100].Microseconds())/1000, "p99-ms")
+		})
+	}
+}
+
+// depositAccountingRepo settles deposit requests whose KPI write fails
+type depositAccountingRepo struct {
+	*maintenanceRepo
+	records []string // deposit records created, by transaction id
+}
+
+func (r *depositAccountingRepo) ListShortcodes(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *depositAccountingRepo) UpdateAviatorDepositRequestLucky(ctx context.Context, transactionID, reference, description string) (int64, error) {
+	return 1, nil
+}
+
+func (r *depositAccountingRepo) DeleteUserAttempted(ctx context.Context, msisdn string) (int64, error) {
+	return 1, nil
+}
+
+func (r *depositAccountingRepo) CreateDepositRecordLucky(ctx context.Context, msisdn string, amount float64, transactionID, shortcode, name, reference, betType string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, transactionID)
+	return 1, nil
+}
+
+func (r *depositAccountingRepo) UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64, error) {
+	return 0, errors.New("kpi: connection reset")
+}
+
+func TestDepositAccountingFailureFailsDeposit(t *testing.T) {
+	repo := &depositAccountingRepo{maintenanceRepo: newMaintenanceRepo()}
+	repo.addPlayer(testMsisdn, 0)
+	repo.deposits["REF1"] = map[string]interface{}{
+		"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1", "selected_box": "1",
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	s.accounts = newAccountingPool(2)
+
+	_, err := s.SettleDeposit(models.SettlementCallback{TransactionID: "QK1", Reference: "REF1", Msisdn: testMsisdn, Amount: 20}, "normal")
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("settle = %v, want the KPI write's error", err)
+	}
+	if len(repo.records) != 1 {
+		t.Errorf("deposit records %v, want the other writes run to completion", repo.records)
+	}
+	if stats := s.AccountingPoolStats(); stats.Tasks != 6 || stats.Busy != 0 {
+		t.Errorf("stats = %+v, want the deposit's 6 writes run on the pool", stats)
+	}
+}
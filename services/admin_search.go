@@ -0,0 +1,306 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Kinds of query a support search tells apart
+const (
+	SearchMsisdn        = "msisdn"
+	SearchReference     = "reference"
+	SearchTransactionID = "transaction_id"
+)
+
+// auditSearch is the admin_audit_log action of a support search
+const auditSearch = "search"
+
+const (
+	searchMaxQuery    = 64
+	searchRecentLimit = 20 // rows of each kind listed for an msisdn
+	searchChainLimit  = 50 // rows of each kind in a reference chain
+)
+
+var ErrInvalidSearch = fmt.Errorf("q must be 1 to %d characters", searchMaxQuery)
+
+// searchReferenceKinds are the reference prefixes utils.NewReference writes
+var searchReferenceKinds = []string{utils.RefBet, utils.RefParcel, utils.RefSpin, utils.RefDeposit, utils.RefTransfer}
+
+// SearchPlayer is the player summary of a support search
+type SearchPlayer struct {
+	Msisdn          string     `json:"msisdn"`
+	Name            string     `json:"name,omitempty"`
+	Balance         float64    `json:"balance"`
+	FreeBets        float64    `json:"free_bets"`
+	BetCount        int64      `json:"bet_count"`
+	LossStreak      int64      `json:"loss_streak"`
+	LastTransaction *time.Time `json:"last_transaction,omitempty"`
+	DateCreated     *time.Time `json:"date_created,omitempty"`
+}
+
+// SearchBet is a bet found by a support search
+type SearchBet struct {
+	Reference       string    `json:"reference"`
+	ParcelReference string    `json:"parcel_reference,omitempty"`
+	Msisdn          string    `json:"msisdn"`
+	GameCatID       string    `json:"game_cat_id,omitempty"`
+	GameName        string    `json:"game_name,omitempty"`
+	Channel         string    `json:"channel,omitempty"`
+	BetType         string    `json:"bet_type,omitempty"`
+	Amount          float64   `json:"amount"`
+	SelectedNumber  string    `json:"selected_number,omitempty"`
+	ResultStatus    string    `json:"result_status" example:"Loss"`
+	WinAmount       float64   `json:"win_amount"`
+	DateCreated     time.Time `json:"date_created"`
+}
+
+// SearchDeposit is a deposit request found by a support search
+type SearchDeposit struct {
+	Reference     string    `json:"reference"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Msisdn        string    `json:"msisdn"`
+	Amount        float64   `json:"amount"`
+	Status        string    `json:"status" example:"success"`
+	DepositType   string    `json:"deposit_type,omitempty"`
+	Channel       string    `json:"channel,omitempty"`
+	GameCatID     string    `json:"game_cat_id,omitempty"`
+	Description   string    `json:"description,omitempty"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// SearchWithdrawal is a withdrawal found by a support search
+type SearchWithdrawal struct {
+	Reference     string    `json:"reference"`
+	TransactionID string    `json:"transaction_id,omitempty"`
+	Msisdn        string    `json:"msisdn"`
+	Amount        float64   `json:"amount"`
+	TaxAmount     float64   `json:"tax_amount"`
+	Status        string    `json:"status" example:"processed"`
+	Disburse      string    `json:"disburse,omitempty"` // the partner's last status
+	Description   string    `json:"description,omitempty"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// SearchResult is what a support search found, newest first. For an
+// msisdn it is the player and their latest bets, deposits and withdrawals;
+// for a reference or transaction id, the deposit, bets and withdrawals
+// sharing its references.
+type SearchResult struct {
+	Query       string             `json:"query"`
+	Kind        string             `json:"kind" example:"msisdn"` // msisdn, reference or transaction_id
+	Player      *SearchPlayer      `json:"player,omitempty"`
+	Bets        []SearchBet        `json:"bets"`
+	Deposits    []SearchDeposit    `json:"deposits"`
+	Withdrawals []SearchWithdrawal `json:"withdrawals"`
+}
+
+// detectSearch returns what kind of query q is and the key to look it up
+// by. Our references carry their kind's prefix; a phone number in any form
+// NormalizeMsisdn takes is an msisdn; ten letters and digits starting with
+// a letter is an M-Pesa transaction id. Anything else is looked up as a
+// reference, as references from before the prefixes were.
+func detectSearch(q string) (kind, key string) {
+	upper := strings.ToUpper(q)
+	if prefix, _, ok := strings.Cut(upper, "_"); ok && slices.Contains(searchReferenceKinds, prefix) {
+		return SearchReference, upper
+	}
+	if msisdn, err := utils.NormalizeMsisdn(q); err == nil {
+		return SearchMsisdn, msisdn
+	}
+	if isMpesaTransactionID(upper) {
+		return SearchTransactionID, upper
+	}
+	return SearchReference, q
+}
+
+// isMpesaTransactionID reports whether s looks like an M-Pesa receipt
+// number such as SBK4XYZ12A: ten upper-case letters and digits, a letter
+// first and at least one digit
+func isMpesaTransactionID(s string) bool {
+	if len(s) != 10 || s[0] < 'A' || s[0] > 'Z' {
+		return false
+	}
+	digits := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c >= '0' && c <= '9':
+			digits++
+		case c < 'A' || c > 'Z':
+			return false
+		}
+	}
+	return digits > 0
+}
+
+// Search looks q up for support on behalf of admin and records in the
+// audit trail which players' records admin was shown. Nothing is returned
+// when the audit row cannot be written.
+func (s *LuckyNumberService) Search(ctx context.Context, admin, q string) (SearchResult, error) {
+	if s == nil || s.db == nil {
+		return SearchResult{}, fmt.Errorf("service or database not initialized")
+	}
+	q = strings.TrimSpace(q)
+	if q == "" || len(q) > searchMaxQuery {
+		return SearchResult{}, ErrInvalidSearch
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	kind, key := detectSearch(q)
+	result := SearchResult{Query: q, Kind: kind}
+	var err error
+	if kind == SearchMsisdn {
+		err = s.searchPlayer(ctx, key, &result)
+	} else {
+		err = s.searchChain(ctx, key, &result)
+	}
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	msisdns := result.msisdns()
+	if kind == SearchMsisdn && !slices.Contains(msisdns, key) {
+		msisdns = append(msisdns, key)
+	}
+	if err := s.db.LogAdminAccess(ctx, admin, auditSearch, q, msisdns); err != nil {
+		return SearchResult{}, err
+	}
+	return result, nil
+}
+
+// searchPlayer fills result with msisdn's summary and latest rows
+func (s *LuckyNumberService) searchPlayer(ctx context.Context, msisdn string, result *SearchResult) error {
+	player, err := s.db.SearchPlayer(ctx, msisdn)
+	if err != nil {
+		return err
+	}
+	if player != nil {
+		result.Player = searchPlayerOf(*player)
+	}
+	bets, err := s.db.SearchPlayerBets(ctx, msisdn, searchRecentLimit)
+	if err != nil {
+		return err
+	}
+	deposits, err := s.db.SearchPlayerDeposits(ctx, msisdn, searchRecentLimit)
+	if err != nil {
+		return err
+	}
+	withdrawals, err := s.db.SearchPlayerWithdrawals(ctx, msisdn, searchRecentLimit)
+	if err != nil {
+		return err
+	}
+	result.Bets, result.Deposits, result.Withdrawals = searchBetsOf(bets), searchDepositsOf(deposits), searchWithdrawalsOf(withdrawals)
+	return nil
+}
+
+// searchChain fills result with the rows key leads to: the deposit requests
+// with key as reference or transaction id, the bets on their references or
+// under key as a parcel, and the withdrawals paying those bets. A
+// withdrawal found by its own transaction id leads back to its bet and
+// deposit on a second pass.
+func (s *LuckyNumberService) searchChain(ctx context.Context, key string, result *SearchResult) error {
+	keys := []string{key}
+	for pass := 0; pass < 2; pass++ {
+		deposits, err := s.db.SearchDepositsByKey(ctx, keys, searchChainLimit)
+		if err != nil {
+			return err
+		}
+		for _, d := range deposits {
+			keys = addSearchKey(keys, d.Reference)
+		}
+		bets, err := s.db.SearchBetsByKey(ctx, keys, searchChainLimit)
+		if err != nil {
+			return err
+		}
+		for _, b := range bets {
+			keys = addSearchKey(keys, b.Reference)
+			keys = addSearchKey(keys, b.ParcelReference)
+		}
+		withdrawals, err := s.db.SearchWithdrawalsByKey(ctx, keys, searchChainLimit)
+		if err != nil {
+			return err
+		}
+		result.Bets, result.Deposits, result.Withdrawals = searchBetsOf(bets), searchDepositsOf(deposits), searchWithdrawalsOf(withdrawals)
+
+		known := len(keys)
+		for _, w := range withdrawals {
+			keys = addSearchKey(keys, w.Reference)
+		}
+		if len(keys) == known {
+			break
+		}
+	}
+	return nil
+}
+
+func addSearchKey(keys []string, key string) []string {
+	if key == "" || slices.Contains(keys, key) {
+		return keys
+	}
+	return append(keys, key)
+}
+
+// msisdns lists the players whose records r shows, once each
+func (r SearchResult) msisdns() []string {
+	var msisdns []string
+	add := func(msisdn string) {
+		if msisdn != "" && !slices.Contains(msisdns, msisdn) {
+			msisdns = append(msisdns, msisdn)
+		}
+	}
+	if r.Player != nil {
+		add(r.Player.Msisdn)
+	}
+	for _, b := range r.Bets {
+		add(b.Msisdn)
+	}
+	for _, d := range r.Deposits {
+		add(d.Msisdn)
+	}
+	for _, w := range r.Withdrawals {
+		add(w.Msisdn)
+	}
+	return msisdns
+}
+
+func searchPlayerOf(p database.SearchPlayer) *SearchPlayer {
+	return &SearchPlayer{
+		Msisdn:          p.Msisdn,
+		Name:            p.Name,
+		Balance:         p.Balance,
+		FreeBets:        p.FreeBets,
+		BetCount:        p.BetCount,
+		LossStreak:      p.LostCount,
+		LastTransaction: p.LastTransaction,
+		DateCreated:     p.DateCreated,
+	}
+}
+
+func searchBetsOf(rows []database.SearchBet) []SearchBet {
+	bets := make([]SearchBet, 0, len(rows))
+	for _, b := range rows {
+		bets = append(bets, SearchBet(b))
+	}
+	return bets
+}
+
+func searchDepositsOf(rows []database.SearchDeposit) []SearchDeposit {
+	deposits := make([]SearchDeposit, 0, len(rows))
+	for _, d := range rows {
+		deposits = append(deposits, SearchDeposit(d))
+	}
+	return deposits
+}
+
+func searchWithdrawalsOf(rows []database.SearchWithdrawal) []SearchWithdrawal {
+	withdrawals := make([]SearchWithdrawal, 0, len(rows))
+	for _, w := range rows {
+		withdrawals = append(withdrawals, SearchWithdrawal(w))
+	}
+	return withdrawals
+}
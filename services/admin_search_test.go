@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetectSearch(t *testing.T) {
+	cases := []struct {
+		q, kind, key string
+	}{
+		{"BET_abc123", SearchReference, "BET_ABC123"},
+		{"dep_8f2k", SearchReference, "DEP_8F2K"},
+		{"PCL_1", SearchReference, "PCL_1"},
+		{"0712345678", SearchMsisdn, "254712345678"},
+		{"+254 712 345 678", SearchMsisdn, "254712345678"},
+		{"712345678", SearchMsisdn, "254712345678"},
+		{"SBK4XYZ12A", SearchTransactionID, "SBK4XYZ12A"},
+		{"sbk4xyz12a", SearchTransactionID, "SBK4XYZ12A"},
+		{"ABCDEFGHIJ", SearchReference, "ABCDEFGHIJ"}, // no digit
+		{"1BK4XYZ12A", SearchReference, "1BK4XYZ12A"}, // a digit first
+		{"SBK4XYZ12", SearchReference, "SBK4XYZ12"},
+		{"a1b2c3d4e5f6", SearchReference, "a1b2c3d4e5f6"}, // from before the prefixes
+		{"XYZ_1", SearchReference, "XYZ_1"},
+	}
+	for _, tc := range cases {
+		if kind, key := detectSearch(tc.q); kind != tc.kind || key != tc.key {
+			t.Errorf("detectSearch(%q) = %s %q, want %s %q", tc.q, kind, key, tc.kind, tc.key)
+		}
+	}
+}
+
+type auditRow struct {
+	admin, action, query string
+	msisdns              []string
+}
+
+// searchRepo answers the search lookups from rows matched as the SQL does
+// and keeps the audit trail
+type searchRepo struct {
+	*memRepo
+	profile      *database.SearchPlayer
+	betRows      []database.SearchBet
+	depositRows  []database.SearchDeposit
+	payoutRows   []database.SearchWithdrawal
+	audits       []auditRow
+	auditErr     error
+	chainLookups int
+}
+
+func (r *searchRepo) SearchPlayer(ctx context.Context, msisdn string) (*database.SearchPlayer, error) {
+	if r.profile == nil || r.profile.Msisdn != msisdn {
+		return nil, nil
+	}
+	p := *r.profile
+	return &p, nil
+}
+
+func (r *searchRepo) SearchPlayerBets(ctx context.Context, msisdn string, limit int) ([]database.SearchBet, error) {
+	return searchMatch(r.betRows, limit, func(b database.SearchBet) bool { return b.Msisdn == msisdn }), nil
+}
+
+func (r *searchRepo) SearchPlayerDeposits(ctx context.Context, msisdn string, limit int) ([]database.SearchDeposit, error) {
+	return searchMatch(r.depositRows, limit, func(d database.SearchDeposit) bool { return d.Msisdn == msisdn }), nil
+}
+
+func (r *searchRepo) SearchPlayerWithdrawals(ctx context.Context, msisdn string, limit int) ([]database.SearchWithdrawal, error) {
+	return searchMatch(r.payoutRows, limit, func(w database.SearchWithdrawal) bool { return w.Msisdn == msisdn }), nil
+}
+
+func (r *searchRepo) SearchBetsByKey(ctx context.Context, keys []string, limit int) ([]database.SearchBet, error) {
+	r.chainLookups++
+	return searchMatch(r.betRows, limit, func(b database.SearchBet) bool {
+		return (b.Reference != "" && slices.Contains(keys, b.Reference)) || slices.Contains(keys, b.ParcelReference)
+	}), nil
+}
+
+func (r *searchRepo) SearchDepositsByKey(ctx context.Context, keys []string, limit int) ([]database.SearchDeposit, error) {
+	return searchMatch(r.depositRows, limit, func(d database.SearchDeposit) bool {
+		return (d.Reference != "" && slices.Contains(keys, d.Reference)) || slices.Contains(keys, d.TransactionID)
+	}), nil
+}
+
+func (r *searchRepo) SearchWithdrawalsByKey(ctx context.Context, keys []string, limit int) ([]database.SearchWithdrawal, error) {
+	return searchMatch(r.payoutRows, limit, func(w database.SearchWithdrawal) bool {
+		return slices.Contains(keys, w.Reference) || slices.Contains(keys, w.TransactionID)
+	}), nil
+}
+
+func (r *searchRepo) LogAdminAccess(ctx context.Context, admin, action, query string, msisdns []string) error {
+	if r.auditErr != nil {
+		return r.auditErr
+	}
+	r.audits = append(r.audits, auditRow{admin, action, query, msisdns})
+	return nil
+}
+
+func searchMatch[T any](rows []T, limit int, match func(T) bool) []T {
+	var found []T
+	for _, row := range rows {
+		if match(row) && len(found) < limit {
+			found = append(found, row)
+		}
+	}
+	return found
+}
+
+// newSearchRepo holds one won STK bet of testMsisdn, paid in by M-Pesa,
+// its withdrawal, and another player's unrelated bet
+func newSearchRepo() *searchRepo {
+	at := time.Date(2026, 5, 2, 9, 30, 0, 0, time.UTC)
+	return &searchRepo{
+		memRepo: newMemRepo(),
+		betRows: []database.SearchBet{
+			{Reference: "BET_STK1", Msisdn: testMsisdn, Amount: 20, ResultStatus: "Win", WinAmount: 500, DateCreated: at},
+			{Reference: "BET_OTHER", Msisdn: "254700000002", Amount: 10, ResultStatus: "Loss", DateCreated: at},
+		},
+		depositRows: []database.SearchDeposit{
+			{Reference: "BET_STK1", TransactionID: "SBK4XYZ12A", Msisdn: testMsisdn, Amount: 20, Status: "success", DateCreated: at},
+		},
+		payoutRows: []database.SearchWithdrawal{
+			{Reference: "BET_STK1", TransactionID: "TGH7QWE45R", Msisdn: testMsisdn, Amount: 500, Status: "processed", DateCreated: at},
+		},
+	}
+}
+
+func TestSearchChain(t *testing.T) {
+	for _, q := range []string{"SBK4XYZ12A", "bet_stk1", "TGH7QWE45R"} {
+		t.Run(q, func(t *testing.T) {
+			repo := newSearchRepo()
+			s := newTestService(t, repo, nil)
+
+			result, err := s.Search(context.Background(), "support1", " "+q+" ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Query != q || result.Player != nil {
+				t.Errorf("result = %+v, want the trimmed query and no player", result)
+			}
+			if len(result.Deposits) != 1 || result.Deposits[0].TransactionID != "SBK4XYZ12A" ||
+				len(result.Bets) != 1 || result.Bets[0].Reference != "BET_STK1" ||
+				len(result.Withdrawals) != 1 || result.Withdrawals[0].TransactionID != "TGH7QWE45R" {
+				t.Errorf("chain = %+v, want the deposit, its bet and the bet's withdrawal", result)
+			}
+			want := []auditRow{{"support1", auditSearch, q, []string{testMsisdn}}}
+			if !reflect.DeepEqual(repo.audits, want) {
+				t.Errorf("audit = %+v, want %+v", repo.audits, want)
+			}
+		})
+	}
+}
+
+func TestSearchChainParcel(t *testing.T) {
+	repo := newSearchRepo()
+	repo.betRows = append(repo.betRows,
+		database.SearchBet{Reference: "BET_P1", ParcelReference: "PCL_9", Msisdn: testMsisdn},
+		database.SearchBet{Reference: "BET_P2", ParcelReference: "PCL_9", Msisdn: testMsisdn})
+	repo.payoutRows = append(repo.payoutRows, database.SearchWithdrawal{Reference: "BET_P2", Msisdn: testMsisdn})
+	s := newTestService(t, repo, nil)
+
+	result, err := s.Search(context.Background(), "support1", "PCL_9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != SearchReference || len(result.Bets) != 2 || len(result.Withdrawals) != 1 || len(result.Deposits) != 0 {
+		t.Errorf("parcel = %+v, want both boxes and the one that paid out", result)
+	}
+	if repo.chainLookups != 1 {
+		t.Errorf("%d passes, want one when the withdrawals bring no new reference", repo.chainLookups)
+	}
+}
+
+func TestSearchUnknownReference(t *testing.T) {
+	repo := newSearchRepo()
+	s := newTestService(t, repo, nil)
+
+	result, err := s.Search(context.Background(), "support1", "BET_NONE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Bets == nil || result.Deposits == nil || result.Withdrawals == nil || len(result.Bets)+len(result.Deposits)+len(result.Withdrawals) != 0 {
+		t.Errorf("result = %+v, want empty lists", result)
+	}
+	if len(repo.audits) != 1 || len(repo.audits[0].msisdns) != 0 {
+		t.Errorf("audit = %+v, want the search logged with no players shown", repo.audits)
+	}
+}
+
+func TestSearchMsisdn(t *testing.T) {
+	repo := newSearchRepo()
+	repo.profile = &database.SearchPlayer{Msisdn: testMsisdn, Name: "Wanjiru", Balance: 480, BetCount: 1, LostCount: 0}
+	s := newTestService(t, repo, nil)
+
+	result, err := s.Search(context.Background(), "support1", "0712 345 678")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Kind != SearchMsisdn || result.Player == nil || result.Player.Balance != 480 || result.Player.Name != "Wanjiru" {
+		t.Fatalf("result = %+v, want the player's summary", result)
+	}
+	if len(result.Bets) != 1 || len(result.Deposits) != 1 || len(result.Withdrawals) != 1 {
+		t.Errorf("rows = %+v, want only the player's own", result)
+	}
+	if len(repo.audits) != 1 || !reflect.DeepEqual(repo.audits[0].msisdns, []string{testMsisdn}) {
+		t.Errorf("audit = %+v", repo.audits)
+	}
+
+	// Looking up a number with no player is still an access to that number
+	if _, err := s.Search(context.Background(), "support1", "254799999999"); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.audits[1].msisdns; !reflect.DeepEqual(got, []string{"254799999999"}) {
+		t.Errorf("audit msisdns = %v, want the number looked up", got)
+	}
+}
+
+func TestSearchRefused(t *testing.T) {
+	repo := newSearchRepo()
+	s := newTestService(t, repo, nil)
+
+	for _, q := range []string{"", "   ", strings.Repeat("A", searchMaxQuery+1)} {
+		if _, err := s.Search(context.Background(), "support1", q); !errors.Is(err, ErrInvalidSearch) {
+			t.Errorf("Search(%q) = %v, want ErrInvalidSearch", q, err)
+		}
+	}
+
+	// Nothing is shown when the access cannot be recorded
+	repo.auditErr = errors.New("admin_audit_log: connection reset")
+	result, err := s.Search(context.Background(), "support1", "SBK4XYZ12A")
+	if !errors.Is(err, repo.auditErr) || result.Bets != nil || result.Deposits != nil {
+		t.Errorf("search with the audit down = %+v, %v, want nothing and the error", result, err)
+	}
+	if len(repo.audits) != 0 {
+		t.Errorf("audits = %+v", repo.audits)
+	}
+}
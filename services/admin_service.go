@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultPlayerSort = "rtp_desc"
+
+// ErrPlayerNotFound is returned when an admin looks up an unknown msisdn
+var ErrPlayerNotFound = errors.New("player not found")
+
+// PlayerStats is the admin view of a player's lifetime gameplay
+type PlayerStats struct {
+	Msisdn              string  `json:"msisdn"`
+	RTP                 float64 `json:"rtp"`
+	BetCount            int64   `json:"bet_count"`
+	TotalBets           float64 `json:"total_bets"`
+	Payout              float64 `json:"payout"`
+	TotalLosses         float64 `json:"total_losses"`
+	AverageStake        float64 `json:"average_stake"`
+	LastStake           float64 `json:"last_stake"`
+	LargestWin          float64 `json:"largest_win"`
+	LossStreak          int64   `json:"loss_streak"`
+	LastTransactionTime string  `json:"last_transaction_time,omitempty"`
+	DateCreated         string  `json:"date_created,omitempty"`
+}
+
+// PlayerStatsPage is one page of ListPlayerStats
+type PlayerStatsPage struct {
+	Players    []PlayerStats `json:"players"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"page_size"`
+	Total      int64         `json:"total"`
+	TotalPages int           `json:"total_pages"`
+}
+
+// DailyStats is one day of the kpi table
+type DailyStats struct {
+	Date           string  `json:"date"`
+	Handle         float64 `json:"handle"`
+	Bet            float64 `json:"bet"`
+	BetCount       int64   `json:"bet_count"`
+	Payout         float64 `json:"payout"`
+	GGR            float64 `json:"ggr"`
+	RTP            float64 `json:"rtp"`
+	VIG            float64 `json:"vig"`
+	WithholdingTax float64 `json:"withholding_tax"`
+	ExciseDuty     float64 `json:"excise_duty"`
+	FreeBetCount   int64   `json:"free_bet_count"`
+	FreeBetStake   float64 `json:"free_bet_stake"`
+}
+
+// ChannelStats is one channel's share of handle and payout over a date range
+type ChannelStats struct {
+	Channel  string  `json:"channel"`
+	Handle   float64 `json:"handle"`
+	Payout   float64 `json:"payout"`
+	BetCount int64   `json:"bet_count"`
+	GGR      float64 `json:"ggr"`
+}
+
+// GetPlayerStats returns the admin stats for one msisdn
+func (s *LuckyNumberService) GetPlayerStats(msisdn string) (PlayerStats, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return PlayerStats{}, fmt.Errorf("service or database not initialized")
+	}
+
+	msisdn = strings.TrimSpace(msisdn)
+	if normalized, err := utils.NormalizeMsisdn(msisdn); err == nil {
+		msisdn = normalized
+	}
+
+	row, err := s.db.GetPlayerStats(context.Background(), msisdn)
+	if err != nil {
+		return PlayerStats{}, err
+	}
+	if row == nil {
+		return PlayerStats{}, ErrPlayerNotFound
+	}
+	return playerStatsFromRow(row), nil
+}
+
+// ListPlayerStats pages through players with at least minBets bets. An empty
+// sort defaults to rtp_desc; unknown keys return database.ErrInvalidSort.
+func (s *LuckyNumberService) ListPlayerStats(sort string, minBets int64, page utils.Page) (PlayerStatsPage, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return PlayerStatsPage{}, fmt.Errorf("service or database not initialized")
+	}
+
+	sort, err := NormalizePlayerSort(sort)
+	if err != nil {
+		return PlayerStatsPage{}, err
+	}
+	if minBets < 0 {
+		minBets = 0
+	}
+
+	rows, total, err := s.db.ListPlayerStats(context.Background(), sort, minBets, page.Size, page.Offset())
+	if err != nil {
+		return PlayerStatsPage{}, err
+	}
+
+	players := make([]PlayerStats, 0, len(rows))
+	for _, row := range rows {
+		players = append(players, playerStatsFromRow(row))
+	}
+
+	return PlayerStatsPage{
+		Players:    players,
+		Page:       page.Number,
+		PageSize:   page.Size,
+		Total:      total,
+		TotalPages: page.TotalPages(total),
+	}, nil
+}
+
+// GetDailyStats returns the kpi rows for every day in dateRange
+func (s *LuckyNumberService) GetDailyStats(dateRange utils.DateRange) ([]DailyStats, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+
+	start := dateRange.Start.In(clock.Location()).Format("2006-01-02")
+	end := dateRange.End.In(clock.Location()).Format("2006-01-02")
+
+	rows, err := s.db.GetDailyKPI(context.Background(), start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make([]DailyStats, 0, len(rows))
+	for _, row := range rows {
+		days = append(days, DailyStats{
+			Date:           utils.ToString(row["date"]),
+			Handle:         utils.ToFloat64(row["handle"]),
+			Bet:            utils.ToFloat64(row["bet"]),
+			BetCount:       utils.ToInt64(row["bet_count"]),
+			Payout:         utils.ToFloat64(row["payout"]),
+			GGR:            utils.ToFloat64(row["ggr"]),
+			RTP:            utils.ToFloat64(row["rtp"]),
+			VIG:            utils.ToFloat64(row["vig"]),
+			WithholdingTax: utils.ToFloat64(row["withholding_tax_amount"]),
+			ExciseDuty:     utils.ToFloat64(row["excise_duty_tax_amount"]),
+			FreeBetCount:   utils.ToInt64(row["free_bet_count"]),
+			FreeBetStake:   utils.ToFloat64(row["free_bet_stake"]),
+		})
+	}
+	return days, nil
+}
+
+// GetChannelStats totals kpi_by_channel per channel over dateRange
+func (s *LuckyNumberService) GetChannelStats(dateRange utils.DateRange) ([]ChannelStats, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+
+	start := dateRange.Start.In(clock.Location()).Format("2006-01-02")
+	end := dateRange.End.In(clock.Location()).Format("2006-01-02")
+
+	rows, err := s.db.GetChannelKPI(context.Background(), start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]ChannelStats, 0, len(rows))
+	for _, row := range rows {
+		handle := utils.ToFloat64(row["handle"])
+		payout := utils.ToFloat64(row["payout"])
+		stats = append(stats, ChannelStats{
+			Channel:  utils.ToString(row["channel"]),
+			Handle:   handle,
+			Payout:   payout,
+			BetCount: utils.ToInt64(row["bet_count"]),
+			GGR:      round2(handle - payout), // negative on a losing day
+		})
+	}
+	return stats, nil
+}
+
+// DuplicatePlayers is one phone number stored under several msisdn formats
+type DuplicatePlayers struct {
+	Canonical string   `json:"canonical"`
+	Msisdns   []string `json:"msisdns"`
+	PlayerIDs []int64  `json:"player_ids"`
+}
+
+// FindDuplicatePlayers reports players that differ only by msisdn format.
+// Merging is left to an operator.
+func (s *LuckyNumberService) FindDuplicatePlayers() ([]DuplicatePlayers, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+
+	rows, err := s.db.FindDuplicatePlayers(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]DuplicatePlayers, 0, len(rows))
+	for _, row := range rows {
+		group := DuplicatePlayers{
+			Canonical: utils.ToString(row["canonical"]),
+			Msisdns:   strings.Split(utils.ToString(row["msisdns"]), ","),
+		}
+		for _, id := range strings.Split(utils.ToString(row["player_ids"]), ",") {
+			group.PlayerIDs = append(group.PlayerIDs, utils.ToInt64(id))
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// NormalizePlayerSort defaults an empty sort key to rtp_desc and returns
+// database.ErrInvalidSort for keys outside the whitelist
+func NormalizePlayerSort(sort string) (string, error) {
+	if sort = strings.TrimSpace(sort); sort == "" {
+		sort = defaultPlayerSort
+	}
+	if !database.IsValidPlayerSort(sort) {
+		return "", fmt.Errorf("%w: %q", database.ErrInvalidSort, sort)
+	}
+	return sort, nil
+}
+
+// ExportPlayerStats hands every player with at least minBets bets to fn in
+// sort order. Rows are streamed from the database, so the whole player base
+// is never held in memory; an error from fn stops the export.
+func (s *LuckyNumberService) ExportPlayerStats(ctx context.Context, sort string, minBets int64, fn func(PlayerStats) error) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+
+	sort, err := NormalizePlayerSort(sort)
+	if err != nil {
+		return err
+	}
+	if minBets < 0 {
+		minBets = 0
+	}
+
+	return s.db.StreamPlayerStats(ctx, sort, minBets, func(row map[string]interface{}) error {
+		return fn(playerStatsFromRow(row))
+	})
+}
+
+func playerStatsFromRow(row map[string]interface{}) PlayerStats {
+	stats := PlayerStats{
+		Msisdn:      utils.ToString(row["msisdn"]),
+		RTP:         utils.ToFloat64(row["rtp_player"]),
+		BetCount:    utils.ToInt64(row["frequency"]),
+		TotalBets:   utils.ToFloat64(row["total_bets"]),
+		Payout:      utils.ToFloat64(row["payout"]),
+		TotalLosses: utils.ToFloat64(row["total_losses"]),
+		LastStake:   utils.ToFloat64(row["last_stake_amount"]),
+		LargestWin:  utils.ToFloat64(row["largest_win"]),
+		LossStreak:  utils.ToInt64(row["lost_count"]),
+	}
+	if stats.BetCount > 0 {
+		stats.AverageStake = stats.TotalBets / float64(stats.BetCount)
+	}
+	if t, ok := row["last_transaction_time"].(time.Time); ok {
+		stats.LastTransactionTime = t.Format(time.RFC3339)
+	}
+	if t, ok := row["date_created"].(time.Time); ok {
+		stats.DateCreated = t.Format(time.RFC3339)
+	}
+	return stats
+}
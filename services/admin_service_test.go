@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"testing"
+	"time"
+)
+
+// playerStatsRepo serves ListPlayerStats and records the page it was asked for
+type playerStatsRepo struct {
+	database.LuckyRepo
+	total          int64
+	sort           string
+	limit, offset  int
+	minBets        int64
+	sessionsOpened int
+	role           string
+}
+
+func (r *playerStatsRepo) ListPlayerStats(ctx context.Context, sort string, minBets int64, limit, offset int) ([]map[string]interface{}, int64, error) {
+	r.sort, r.minBets, r.limit, r.offset = sort, minBets, limit, offset
+	return []map[string]interface{}{{"msisdn": "254712345678", "rtp_player": 95.0}}, r.total, nil
+}
+
+func (r *playerStatsRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	return map[string]interface{}{"msisdn": msisdn, "role": r.role}, nil
+}
+
+func (r *playerStatsRepo) OpenSession(ctx context.Context, msisdn, jti, deviceID, fingerprint string, accessExpiry, expiresAt time.Time, maxSessions int, evictOldest bool) ([]string, error) {
+	r.sessionsOpened++
+	return nil, nil
+}
+
+func TestNormalizePlayerSort(t *testing.T) {
+	for _, sort := range []string{"", " rtp_desc ", "bets_desc", "loss_streak_desc", "recent"} {
+		if _, err := NormalizePlayerSort(sort); err != nil {
+			t.Errorf("sort %q rejected: %v", sort, err)
+		}
+	}
+	if got, _ := NormalizePlayerSort(""); got != defaultPlayerSort {
+		t.Errorf("empty sort = %q, want %q", got, defaultPlayerSort)
+	}
+	for _, sort := range []string{"rtp_player", "msisdn", "p.payout DESC", "rtp_desc; DROP TABLE \"Player\"", "RTP_DESC"} {
+		if _, err := NormalizePlayerSort(sort); !errors.Is(err, database.ErrInvalidSort) {
+			t.Errorf("sort %q = %v, want ErrInvalidSort", sort, err)
+		}
+	}
+}
+
+func TestListPlayerStatsPaging(t *testing.T) {
+	repo := &playerStatsRepo{total: 45}
+	s := &LuckyNumberService{db: repo}
+
+	got, err := s.ListPlayerStats("", -3, utils.Page{Number: 3, Size: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.sort != "rtp_desc" || repo.minBets != 0 || repo.limit != 20 || repo.offset != 40 {
+		t.Errorf("queried sort %q, min %d, limit %d, offset %d", repo.sort, repo.minBets, repo.limit, repo.offset)
+	}
+	if got.Page != 3 || got.PageSize != 20 || got.Total != 45 || got.TotalPages != 3 || len(got.Players) != 1 {
+		t.Errorf("page = %+v", got)
+	}
+
+	repo.sort = ""
+	if _, err := s.ListPlayerStats("msisdn", 0, utils.Page{Number: 1, Size: 20}); !errors.Is(err, database.ErrInvalidSort) {
+		t.Errorf("unlisted sort = %v, want ErrInvalidSort", err)
+	}
+	if repo.sort != "" {
+		t.Error("an unlisted sort reached the database")
+	}
+}
+
+func TestStartSessionSignsStoredRole(t *testing.T) {
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+	for stored, want := range map[string]string{"admin": utils.RoleAdmin, "user": utils.RoleUser, "": utils.RoleUser} {
+		repo := &playerStatsRepo{role: stored}
+		s := &LuckyNumberService{db: repo}
+		token, err := s.StartSession("254712345678", "", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := auth.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims["role"] != want {
+			t.Errorf("stored role %q signed as %v, want %s", stored, claims["role"], want)
+		}
+	}
+}
+
+func (r *playerStatsRepo) FindDuplicatePlayers(ctx context.Context) ([]map[string]interface{}, error) {
+	return []map[string]interface{}{
+		{"canonical": "254712345678", "msisdns": "0712345678,254712345678", "player_ids": "4,9"},
+	}, nil
+}
+
+func TestFindDuplicatePlayers(t *testing.T) {
+	s := &LuckyNumberService{db: &playerStatsRepo{}}
+	groups, err := s.FindDuplicatePlayers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("groups = %+v, want one", groups)
+	}
+	g := groups[0]
+	if g.Canonical != "254712345678" || len(g.Msisdns) != 2 || g.Msisdns[0] != "0712345678" || len(g.PlayerIDs) != 2 || g.PlayerIDs[1] != 9 {
+		t.Errorf("group = %+v", g)
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDeviceRequired is returned when a refresh token is requested without a device id
+var ErrDeviceRequired = errors.New("device_id is required")
+
+// OTP purposes. A code only confirms the action it was sent for, so a
+// login OTP cannot approve a transfer, a withdrawal or an account deletion.
+const (
+	OTPLogin         = "login"
+	OTPDeleteAccount = "delete_account"
+	OTPSelfExclusion = "self_exclusion"
+	OTPTransfer      = "transfer"
+	OTPWithdrawal    = "withdrawal"
+	OTPChangeMsisdn  = "change_msisdn" // sent to the new number
+)
+
+var (
+	ErrOTPNotFound      = errors.New("no OTP to resend, request a new one")
+	ErrOTPResendLimit   = errors.New("OTP resend limit reached, request a new one")
+	ErrOTPResendTooSoon = errors.New("OTP was sent too recently")
+	// ErrOTPDeliveryDelayed: the code was stored but its SMS could not be
+	// queued. The code stays valid and a resend sends a new one.
+	ErrOTPDeliveryDelayed = errors.New("code generated but delivery delayed")
+)
+
+// Account states VerifyOTP reports once the OTP checks out. Login never
+// reveals them, so they cannot be used to probe which numbers are registered.
+var (
+	ErrAccountInactive     = errors.New("user account is inactive")
+	ErrAccountSelfExcluded = errors.New("user account is self-excluded")
+)
+
+// RequestLoginOTP sends a login OTP to msisdn, registering the player on
+// first login. Every valid number takes the same path: inactive and
+// self-excluded players get an OTP too and learn their state from VerifyOTP,
+// and an unknown promocode is dropped rather than reported. The call takes
+// at least limits.login_min_latency so registration does not show in timing.
+// Returns the resends the code has left, as InsertVerification does.
+func (s *LuckyNumberService) RequestLoginOTP(msisdn, name, promocode, code string, expired, created int64) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+	defer padLatency(time.Now(), limits.LoginMinLatency)
+
+	if promocode != "" {
+		promo, err := s.CheckPromoCode(promocode)
+		if err != nil || promo == nil {
+			logrus.Infof("login: ignoring unknown promocode %q for %s", promocode, msisdn)
+			promocode = ""
+		}
+	}
+
+	if _, err := s.CheckUser(msisdn, name, promocode); err != nil {
+		return 0, err
+	}
+	return s.InsertVerification(msisdn, OTPLogin, code, expired, created)
+}
+
+// OTPResend describes a resent OTP. On ErrOTPResendTooSoon only
+// ResendAllowedAfter is set; on ErrOTPDeliveryDelayed all of it is.
+type OTPResend struct {
+	ExpireIn           int64 // seconds until the code expires
+	ResendAllowedAfter int64 // seconds until the next resend
+	ResendsLeft        int
+}
+
+// ResendAllowedAfter is how long, in seconds, a client waits after an OTP is
+// sent before offering to resend it
+func ResendAllowedAfter() int64 {
+	return int64(limits.OTPResendCooldown / time.Second)
+}
+
+// ResendOTP replaces msisdn's latest unused purpose code with freshCode,
+// valid for ttl, and sends it. Only hashes of codes are stored, so the old
+// code cannot be sent again; it can no longer be verified either. A code
+// may be resent limits.otp_resend_max times, limits.otp_resend_cooldown
+// apart, and a replacement inherits the count of the code it replaced.
+func (s *LuckyNumberService) ResendOTP(msisdn, purpose, freshCode string, ttl time.Duration) (OTPResend, error) {
+	if s == nil || s.db == nil {
+		return OTPResend{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	v, err := s.db.GetLatestVerification(ctx, msisdn, purpose)
+	if err != nil {
+		return OTPResend{}, err
+	}
+	if v == nil {
+		return OTPResend{}, ErrOTPNotFound
+	}
+	if v.ResendCount >= limits.OTPResendMax {
+		return OTPResend{}, ErrOTPResendLimit
+	}
+
+	now := clock.Now().Unix()
+	if wait := v.LastSent + ResendAllowedAfter() - now; wait > 0 {
+		return OTPResend{ResendAllowedAfter: wait}, ErrOTPResendTooSoon
+	}
+
+	defer utils.HoldSecret(freshCode)()
+	hash, err := auth.HashOTP(msisdn, purpose, freshCode)
+	if err != nil {
+		return OTPResend{}, err
+	}
+	expired := now + int64(ttl/time.Second)
+	ok, err := s.db.ReissueVerification(ctx, v.ID, hash, expired, now, limits.OTPResendMax)
+	if err != nil {
+		return OTPResend{}, err
+	}
+	if !ok {
+		// used, replaced or resent by a concurrent request
+		return OTPResend{}, ErrOTPResendLimit
+	}
+
+	resend := OTPResend{
+		ExpireIn:           expired - now,
+		ResendAllowedAfter: ResendAllowedAfter(),
+		ResendsLeft:        limits.OTPResendMax - v.ResendCount - 1,
+	}
+	// The resend is counted either way; on ErrOTPDeliveryDelayed another
+	// resend sends a new code
+	if err := s.queueOTP(ctx, msisdn, freshCode); err != nil {
+		return resend, err
+	}
+	logrus.Infof("otp: resent %s code to %s (%d/%d)", purpose, msisdn, v.ResendCount+1, limits.OTPResendMax)
+	return resend, nil
+}
+
+// queueOTP queues the OTP message for code. The gateway reports delivery
+// to /sms_dlr against the returned dbQueue row. When the insert keeps
+// failing it returns ErrOTPDeliveryDelayed.
+func (s *LuckyNumberService) queueOTP(ctx context.Context, msisdn, code string) error {
+	message := s.renderMessage(ctx, TemplateOTP, s.playerLanguage(ctx, msisdn), map[string]string{
+		"code": code,
+	})
+	if _, err := s.queueSMS(ctx, msisdn, message, smsSettings.SenderID, "otp"); err != nil {
+		logrus.Errorf("otp: queue sms for %s failed: %v", msisdn, err)
+		return ErrOTPDeliveryDelayed
+	}
+	return nil
+}
+
+// RecordSMSDelivery stores a gateway delivery report. Returns false when the
+// dbQueue row is unknown or already has a final status.
+func (s *LuckyNumberService) RecordSMSDelivery(recordID int64, status, description string) (bool, error) {
+	if s == nil || s.db == nil {
+		return false, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ok, err := s.db.UpdateSMSDeliveryStatus(ctx, recordID, status, description)
+	if err != nil {
+		return false, err
+	}
+	if ok && status != models.SMSSent && status != models.SMSDelivered {
+		logrus.Warnf("sms: record %d not delivered: %s %s", recordID, status, description)
+	}
+	return ok, nil
+}
+
+// AccountState returns ErrAccountInactive or ErrAccountSelfExcluded when the
+// player may not sign in, and nil otherwise
+func AccountState(user map[string]interface{}) error {
+	switch utils.ToString(user["active_status"]) {
+	case "inactive", "pending_deletion", "deleted":
+		return ErrAccountInactive
+	}
+	if utils.ToString(user["self_exclusion"]) == "YES" {
+		return ErrAccountSelfExcluded
+	}
+	return nil
+}
+
+// padLatency sleeps until min has passed since start
+func padLatency(start time.Time, min time.Duration) {
+	if wait := min - time.Since(start); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// Session is an access token plus the refresh token that renews it
+type Session struct {
+	Token              string `json:"Token"`
+	TokenExpiry        int64  `json:"TokenExpiry"`
+	RefreshToken       string `json:"RefreshToken,omitempty"`
+	RefreshTokenExpiry int64  `json:"RefreshTokenExpiry,omitempty"`
+}
+
+// IssueRefreshToken creates a refresh token bound to deviceID. Call it only
+// after the player has verified an OTP.
+func (s *LuckyNumberService) IssueRefreshToken(msisdn, deviceID string) (string, error) {
+	if s == nil || s.db == nil {
+		return "", fmt.Errorf("service or database not initialized")
+	}
+	if deviceID = strings.TrimSpace(deviceID); deviceID == "" {
+		return "", ErrDeviceRequired
+	}
+
+	token, hash, err := utils.NewRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.db.InsertRefreshToken(context.Background(), msisdn, deviceID, hash, time.Now().Add(limits.RefreshTokenTTL)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RefreshSession rotates a refresh token and returns a new session. Invalid,
+// expired or foreign-device tokens return database.ErrRefreshTokenInvalid;
+// a token that was already used returns database.ErrRefreshTokenReused and
+// logs the player out everywhere.
+func (s *LuckyNumberService) RefreshSession(refreshToken, deviceID string) (Session, error) {
+	if s == nil || s.db == nil {
+		return Session{}, fmt.Errorf("service or database not initialized")
+	}
+	if deviceID = strings.TrimSpace(deviceID); deviceID == "" {
+		return Session{}, ErrDeviceRequired
+	}
+	if refreshToken == "" {
+		return Session{}, database.ErrRefreshTokenInvalid
+	}
+
+	ctx := context.Background()
+	token, hash, err := utils.NewRefreshToken()
+	if err != nil {
+		return Session{}, err
+	}
+	msisdn, err := s.db.RotateRefreshToken(ctx, utils.HashRefreshToken(refreshToken), deviceID, hash, time.Now().Add(limits.RefreshTokenTTL))
+	if errors.Is(err, database.ErrRefreshTokenReused) {
+		logrus.Warnf("refresh token reused for device %s; all sessions revoked", deviceID)
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	user, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		return Session{}, err
+	}
+	if user == nil || utils.ToString(user["active_status"]) == "inactive" {
+		if _, err := s.db.RevokeRefreshTokens(ctx, msisdn, ""); err != nil {
+			logrus.Errorf("revoke refresh tokens for %s failed: %v", msisdn, err)
+		}
+		return Session{}, database.ErrRefreshTokenInvalid
+	}
+
+	access, jti, err := s.issueAccessToken(ctx, msisdn, database.Player(user).Role())
+	if err != nil {
+		return Session{}, err
+	}
+	// The refresh token is already rotated, so a session row left behind
+	// only shows an old token until the next refresh
+	if err := s.db.RenewSession(ctx, msisdn, deviceID, jti, time.Now().Add(limits.RefreshTokenTTL)); err != nil {
+		logrus.Errorf("renew session of %s failed: %v", msisdn, err)
+	}
+	return Session{
+		Token:              access,
+		TokenExpiry:        int64(utils.AccessTokenTTL.Seconds()),
+		RefreshToken:       token,
+		RefreshTokenExpiry: int64(limits.RefreshTokenTTL.Seconds()),
+	}, nil
+}
+
+// RevokeRefreshTokens logs msisdn out on deviceID, or everywhere when empty
+func (s *LuckyNumberService) RevokeRefreshTokens(msisdn, deviceID string) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+	return s.db.RevokeRefreshTokens(context.Background(), msisdn, strings.TrimSpace(deviceID))
+}
+
+// issueAccessToken signs an access token for msisdn with role and records
+// its jti so it can be revoked. Call it only after the player has verified
+// a refresh token; logins go through StartSession.
+func (s *LuckyNumberService) issueAccessToken(ctx context.Context, msisdn, role string) (string, string, error) {
+	jti, err := utils.NewTokenID()
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	if err := s.db.InsertAccessToken(ctx, jti, msisdn, now.Add(utils.AccessTokenTTL)); err != nil {
+		return "", "", err
+	}
+	token, err := utils.SignAccessToken(msisdn, role, jti, now)
+	return token, jti, err
+}
+
+// RevokeAccessToken logs out the one access token jti of msisdn. Tokens
+// without a jti cannot be revoked and are left to expire.
+func (s *LuckyNumberService) RevokeAccessToken(msisdn, jti string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	if jti == "" {
+		return nil
+	}
+	if _, err := s.db.RevokeAccessToken(context.Background(), msisdn, jti); err != nil {
+		return err
+	}
+	utils.MarkTokensRevoked(jti)
+	return nil
+}
+
+// RevokedSessions counts the tokens RevokeSessions revoked
+type RevokedSessions struct {
+	AccessTokens  int64 `json:"access_tokens"`
+	RefreshTokens int64 `json:"refresh_tokens"`
+}
+
+// RevokeSessions logs msisdn out everywhere: every live access token and
+// refresh token is revoked
+func (s *LuckyNumberService) RevokeSessions(msisdn string) (RevokedSessions, error) {
+	if s == nil || s.db == nil {
+		return RevokedSessions{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	jtis, err := s.db.RevokeAccessTokens(ctx, msisdn)
+	if err != nil {
+		return RevokedSessions{}, err
+	}
+	utils.MarkTokensRevoked(jtis...)
+	revoked := RevokedSessions{AccessTokens: int64(len(jtis))}
+	if revoked.RefreshTokens, err = s.db.RevokeRefreshTokens(ctx, msisdn, ""); err != nil {
+		return revoked, err
+	}
+	logrus.Infof("sessions: revoked %d access and %d refresh tokens for %s", revoked.AccessTokens, revoked.RefreshTokens, msisdn)
+	return revoked, nil
+}
+
+// RefreshTokenTTL is how long an issued refresh token stays valid
+func RefreshTokenTTL() time.Duration {
+	return limits.RefreshTokenTTL
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type memRefreshToken struct {
+	msisdn, device string
+	expires        time.Time
+	revoked        bool
+}
+
+// tokenRepo keeps refresh and access tokens in memory and rotates them the
+// way RotateRefreshToken does, revoking everything on reuse
+type tokenRepo struct {
+	*memRepo
+	refresh  map[string]*memRefreshToken // by hash
+	access   map[string]string           // jti -> msisdn
+	revoked  map[string]bool             // revoked jtis
+	inactive bool
+}
+
+func newTokenRepo() *tokenRepo {
+	return &tokenRepo{memRepo: newMemRepo(), refresh: map[string]*memRefreshToken{}, access: map[string]string{}, revoked: map[string]bool{}}
+}
+
+func (r *tokenRepo) InsertRefreshToken(ctx context.Context, msisdn, deviceID, tokenHash string, expiresAt time.Time) error {
+	r.refresh[tokenHash] = &memRefreshToken{msisdn: msisdn, device: deviceID, expires: expiresAt}
+	return nil
+}
+
+func (r *tokenRepo) RotateRefreshToken(ctx context.Context, oldHash, deviceID, newHash string, expiresAt time.Time) (string, error) {
+	old := r.refresh[oldHash]
+	switch {
+	case old == nil:
+		return "", database.ErrRefreshTokenInvalid
+	case old.revoked:
+		r.RevokeRefreshTokens(ctx, old.msisdn, "")
+		return "", database.ErrRefreshTokenReused
+	case !old.expires.After(time.Now()) || old.device != deviceID:
+		return "", database.ErrRefreshTokenInvalid
+	}
+	old.revoked = true
+	r.refresh[newHash] = &memRefreshToken{msisdn: old.msisdn, device: deviceID, expires: expiresAt}
+	return old.msisdn, nil
+}
+
+func (r *tokenRepo) RevokeRefreshTokens(ctx context.Context, msisdn, deviceID string) (int64, error) {
+	var n int64
+	for _, t := range r.refresh {
+		if t.msisdn == msisdn && (deviceID == "" || t.device == deviceID) && !t.revoked {
+			t.revoked = true
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r *tokenRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	user, err := r.memRepo.CheckUser(ctx, msisdn)
+	if user != nil && r.inactive {
+		user["active_status"] = "inactive"
+	}
+	return user, err
+}
+
+func (r *tokenRepo) InsertAccessToken(ctx context.Context, jti, msisdn string, expiresAt time.Time) error {
+	r.access[jti] = msisdn
+	return nil
+}
+
+func (r *tokenRepo) AccessTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return r.revoked[jti], nil
+}
+
+func (r *tokenRepo) RevokeAccessToken(ctx context.Context, msisdn, jti string) (bool, error) {
+	if r.access[jti] != msisdn || r.revoked[jti] {
+		return false, nil
+	}
+	r.revoked[jti] = true
+	return true, nil
+}
+
+func (r *tokenRepo) RevokeAccessTokens(ctx context.Context, msisdn string) ([]string, error) {
+	var jtis []string
+	for jti, owner := range r.access {
+		if owner == msisdn && !r.revoked[jti] {
+			r.revoked[jti] = true
+			jtis = append(jtis, jti)
+		}
+	}
+	return jtis, nil
+}
+
+func (r *tokenRepo) RequestPlayerDeletion(ctx context.Context, msisdn string) (int64, error) {
+	return 1, nil
+}
+
+func (r *tokenRepo) UpdateSelfExclusion(ctx context.Context, msisdn string) error {
+	return nil
+}
+
+func (r *tokenRepo) UpdatePlayerSelf(ctx context.Context, msisdn string, hrs string) error {
+	return nil
+}
+
+func (r *tokenRepo) RenewSession(ctx context.Context, msisdn, deviceID, jti string, expiresAt time.Time) error {
+	return nil
+}
+
+func TestRefreshSessionRotates(t *testing.T) {
+	configureTestOTP(t)
+	repo := newTokenRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+
+	if _, err := s.IssueRefreshToken(testMsisdn, " "); !errors.Is(err, ErrDeviceRequired) {
+		t.Errorf("no device = %v, want ErrDeviceRequired", err)
+	}
+	first, err := s.IssueRefreshToken(testMsisdn, "phone-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hash := range repo.refresh {
+		if hash == first {
+			t.Fatal("refresh token stored in plaintext")
+		}
+	}
+
+	session, err := s.RefreshSession(first, "phone-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.RefreshToken == "" || session.RefreshToken == first {
+		t.Errorf("refresh token not rotated: %+v", session)
+	}
+	claims, err := auth.Verify(session.Token)
+	if err != nil || claims["sub"] != testMsisdn {
+		t.Errorf("access token claims %v, %v", claims, err)
+	}
+
+	if _, err := s.RefreshSession(session.RefreshToken, "phone-2"); !errors.Is(err, database.ErrRefreshTokenInvalid) {
+		t.Errorf("token from another device = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if _, err := s.RefreshSession("made-up", "phone-1"); !errors.Is(err, database.ErrRefreshTokenInvalid) {
+		t.Errorf("unknown token = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesAll(t *testing.T) {
+	configureTestOTP(t)
+	repo := newTokenRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+
+	first, _ := s.IssueRefreshToken(testMsisdn, "phone-1")
+	session, err := s.RefreshSession(first, "phone-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A stolen copy of the first token replayed after rotation
+	if _, err := s.RefreshSession(first, "phone-1"); !errors.Is(err, database.ErrRefreshTokenReused) {
+		t.Fatalf("replayed token = %v, want ErrRefreshTokenReused", err)
+	}
+	if _, err := s.RefreshSession(session.RefreshToken, "phone-1"); !errors.Is(err, database.ErrRefreshTokenReused) {
+		t.Errorf("rotated token after reuse = %v, want revoked", err)
+	}
+}
+
+func TestRevokeRefreshTokens(t *testing.T) {
+	configureTestOTP(t)
+	repo := newTokenRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+
+	one, _ := s.IssueRefreshToken(testMsisdn, "phone-1")
+	two, _ := s.IssueRefreshToken(testMsisdn, "phone-2")
+	if n, err := s.RevokeRefreshTokens(testMsisdn, "phone-1"); err != nil || n != 1 {
+		t.Fatalf("revoked %d, %v; want 1", n, err)
+	}
+	if _, err := s.RefreshSession(two, "phone-2"); err != nil {
+		t.Errorf("other device's token = %v, want still valid", err)
+	}
+	if _, err := s.RefreshSession(one, "phone-1"); err == nil {
+		t.Error("revoked token refreshed")
+	}
+
+	// An inactive player's token is refused and revoked
+	three, _ := s.IssueRefreshToken(testMsisdn, "phone-3")
+	repo.inactive = true
+	if _, err := s.RefreshSession(three, "phone-3"); !errors.Is(err, database.ErrRefreshTokenInvalid) {
+		t.Errorf("inactive player = %v, want ErrRefreshTokenInvalid", err)
+	}
+}
+
+// signedIn issues n access tokens for msisdn and returns their jtis, with
+// JWTMiddleware's revocation check reading repo
+func signedIn(t *testing.T, s *LuckyNumberService, repo *tokenRepo, msisdn string, n int) []string {
+	t.Helper()
+	utils.ConfigureTokenRevocation(repo.AccessTokenRevoked, time.Hour)
+	t.Cleanup(func() { utils.ConfigureTokenRevocation(nil, 0) })
+	jtis := make([]string, n)
+	for i := range jtis {
+		token, jti, err := s.issueAccessToken(context.Background(), msisdn, utils.RoleUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := auth.Verify(token)
+		if err != nil || claims["jti"] != jti {
+			t.Fatalf("token claims %v, %v, want jti %s", claims, err, jti)
+		}
+		jtis[i] = jti
+	}
+	return jtis
+}
+
+func tokenRevoked(t *testing.T, jti string) bool {
+	t.Helper()
+	revoked, err := utils.TokenRevoked(context.Background(), jwt.MapClaims{"jti": jti})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return revoked
+}
+
+func TestLogoutRevokesOnlyPresentedToken(t *testing.T) {
+	configureTestOTP(t)
+	repo := newTokenRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+	jtis := signedIn(t, s, repo, testMsisdn, 2)
+	for _, jti := range jtis {
+		tokenRevoked(t, jti) // cache both as live
+	}
+
+	if err := s.RevokeAccessToken(testMsisdn, jtis[0]); err != nil {
+		t.Fatal(err)
+	}
+	if !tokenRevoked(t, jtis[0]) {
+		t.Error("the logged out token still works")
+	}
+	if tokenRevoked(t, jtis[1]) {
+		t.Error("logout revoked the player's other token")
+	}
+	if err := s.RevokeAccessToken(testMsisdn, ""); err != nil {
+		t.Errorf("logout without a jti = %v, want a no-op", err)
+	}
+}
+
+func TestRevokeSessionsPaths(t *testing.T) {
+	configureTestOTP(t)
+	paths := map[string]func(s *LuckyNumberService) error{
+		"admin": func(s *LuckyNumberService) error {
+			_, err := s.RevokeSessions(testMsisdn)
+			return err
+		},
+		"self exclusion": func(s *LuckyNumberService) error { return s.UpdatePlayerSelf(testMsisdn, "24") },
+		"deletion":       func(s *LuckyNumberService) error { return s.DeleteUser(testMsisdn) },
+	}
+	for name, revoke := range paths {
+		repo := newTokenRepo()
+		repo.addPlayer(testMsisdn, 0)
+		repo.addPlayer("254700000001", 0)
+		s := newTestService(t, repo, nil)
+		jtis := signedIn(t, s, repo, testMsisdn, 3)
+		other := signedIn(t, s, repo, "254700000001", 1)
+		refresh, _ := s.IssueRefreshToken(testMsisdn, "phone-1")
+
+		if err := revoke(s); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, jti := range jtis {
+			if !tokenRevoked(t, jti) {
+				t.Errorf("%s left access token %s working", name, jti)
+			}
+		}
+		if tokenRevoked(t, other[0]) {
+			t.Errorf("%s revoked another player's token", name)
+		}
+		if _, err := s.RefreshSession(refresh, "phone-1"); err == nil {
+			t.Errorf("%s left the refresh token working", name)
+		}
+	}
+}
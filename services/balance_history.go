@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BalanceSnapshot is the basket and house income as they stood when one
+// day's snapshot was taken, with that day's movements. BasketLogs book what
+// the basket pays out as credit and what it takes in as debit.
+type BalanceSnapshot struct {
+	Date           string    `json:"date" example:"2024-05-01"`
+	Basket         float64   `json:"basket"`
+	BasketCredit   float64   `json:"basket_credit"` // paid out of the basket that day
+	BasketDebit    float64   `json:"basket_debit"`  // put into the basket that day
+	HouseIncome    float64   `json:"house_income"`
+	TotalBets      float64   `json:"total_bets"`
+	TotalWins      float64   `json:"total_wins"`
+	TotalLosses    float64   `json:"total_losses"`
+	DayHouseIncome float64   `json:"day_house_income"`
+	DayBets        float64   `json:"day_bets"`
+	DayWins        float64   `json:"day_wins"`
+	DayLosses      float64   `json:"day_losses"`
+	TakenAt        time.Time `json:"taken_at"`
+}
+
+// BalanceHistory is the series of snapshots over a date range. Days no
+// snapshot was taken on are left out.
+type BalanceHistory struct {
+	From      string            `json:"from"`
+	To        string            `json:"to"`
+	Snapshots []BalanceSnapshot `json:"snapshots"`
+}
+
+// SnapshotBalances takes today's basket and house income snapshot, replacing
+// one taken earlier today
+func (s *LuckyNumberService) SnapshotBalances(ctx context.Context) (BalanceSnapshot, error) {
+	if s == nil || s.db == nil {
+		return BalanceSnapshot{}, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.db.UpsertBalanceSnapshots(ctx)
+	if err != nil {
+		return BalanceSnapshot{}, err
+	}
+	return balanceSnapshotOf(row), nil
+}
+
+// GetBalanceHistory returns the snapshots of the days in dateRange, oldest
+// first
+func (s *LuckyNumberService) GetBalanceHistory(ctx context.Context, dateRange utils.DateRange) (BalanceHistory, error) {
+	if s == nil || s.db == nil {
+		return BalanceHistory{}, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.GetBalanceSnapshots(ctx, dateRange.Start, dateRange.End)
+	if err != nil {
+		return BalanceHistory{}, err
+	}
+	history := BalanceHistory{
+		From:      dateRange.Start.In(clock.Location()).Format("2006-01-02"),
+		To:        dateRange.End.In(clock.Location()).Format("2006-01-02"),
+		Snapshots: make([]BalanceSnapshot, 0, len(rows)),
+	}
+	for _, row := range rows {
+		history.Snapshots = append(history.Snapshots, balanceSnapshotOf(row))
+	}
+	return history, nil
+}
+
+func balanceSnapshotOf(row map[string]interface{}) BalanceSnapshot {
+	snapshot := BalanceSnapshot{
+		Date:           utils.ToString(row["day"]),
+		Basket:         utils.ToFloat64(row["basket"]),
+		BasketCredit:   utils.ToFloat64(row["basket_credit"]),
+		BasketDebit:    utils.ToFloat64(row["basket_debit"]),
+		HouseIncome:    utils.ToFloat64(row["house_income"]),
+		TotalBets:      utils.ToFloat64(row["total_bets"]),
+		TotalWins:      utils.ToFloat64(row["total_wins"]),
+		TotalLosses:    utils.ToFloat64(row["total_losses"]),
+		DayHouseIncome: utils.ToFloat64(row["day_house_income"]),
+		DayBets:        utils.ToFloat64(row["day_bets"]),
+		DayWins:        utils.ToFloat64(row["day_wins"]),
+		DayLosses:      utils.ToFloat64(row["day_losses"]),
+	}
+	snapshot.TakenAt, _ = row["taken_at"].(time.Time)
+	return snapshot
+}
+
+// RunBalanceSnapshots takes the day's balance snapshot at limits.snapshot_time
+// every day until ctx is done. An empty snapshot_time disables it. Run it in
+// one process only.
+func (s *LuckyNumberService) RunBalanceSnapshots(ctx context.Context) {
+	if limits.SnapshotTime == "" {
+		logrus.Info("balance snapshots: disabled")
+		return
+	}
+	at, err := time.Parse("15:04", limits.SnapshotTime)
+	if err != nil {
+		logrus.Errorf("balance snapshots: invalid snapshot_time %q: %v", limits.SnapshotTime, err)
+		return
+	}
+
+	for {
+		next := nextSnapshot(clock.Now(), at)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		snapCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		snapshot, err := s.SnapshotBalances(snapCtx)
+		cancel()
+		if err != nil {
+			logrus.Errorf("balance snapshots: %v", err)
+			continue
+		}
+		logrus.Infof("balance snapshots: took %s, basket %.2f, house income %.2f", snapshot.Date, snapshot.Basket, snapshot.HouseIncome)
+	}
+}
+
+// nextSnapshot returns the first time of day at, in the business zone,
+// after now
+func nextSnapshot(now, at time.Time) time.Time {
+	y, m, d := now.In(clock.Location()).Date()
+	next := time.Date(y, m, d, at.Hour(), at.Minute(), 0, 0, clock.Location())
+	if !next.After(now) {
+		next = time.Date(y, m, d+1, at.Hour(), at.Minute(), 0, 0, clock.Location())
+	}
+	return next
+}
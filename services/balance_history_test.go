@@ -0,0 +1,26 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextSnapshot(t *testing.T) {
+	at, _ := time.Parse("15:04", "23:55")
+	for _, tc := range []struct {
+		now, want time.Time
+	}{
+		// 12:00 in Nairobi: tonight
+		{time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 20, 55, 0, 0, time.UTC)},
+		// At 23:55 itself the snapshot is being taken: tomorrow's is next
+		{time.Date(2026, 3, 1, 20, 55, 0, 0, time.UTC), time.Date(2026, 3, 2, 20, 55, 0, 0, time.UTC)},
+		// 22:30 UTC is already the 2nd in Nairobi
+		{time.Date(2026, 3, 1, 22, 30, 0, 0, time.UTC), time.Date(2026, 3, 2, 20, 55, 0, 0, time.UTC)},
+		// Month end
+		{time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 20, 55, 0, 0, time.UTC)},
+	} {
+		if got := nextSnapshot(tc.now, at); !got.Equal(tc.want) {
+			t.Errorf("next after %v = %v, want %v", tc.now, got.UTC(), tc.want)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/money"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// basketTopUpHistory is how many recent top-ups GetBasket returns
+const basketTopUpHistory = 20
+
+// BasketStatus is the prize basket level with its latest top-ups. Amount
+// is what is available; Reserved is held for wins awaiting a top-up.
+type BasketStatus struct {
+	Amount    float64       `json:"amount"`
+	Reserved  float64       `json:"reserved"`
+	CheckedAt time.Time     `json:"checked_at"`
+	TopUps    []BasketTopUp `json:"top_ups"`
+}
+
+// BasketTopUp is one audited admin top-up of the basket
+type BasketTopUp struct {
+	ID           int64     `json:"id"`
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	Admin        string    `json:"admin"`
+	Note         string    `json:"note,omitempty"`
+	DateCreated  time.Time `json:"date_created"`
+	Released     int       `json:"released,omitempty"` // held wins paid out by this top-up
+}
+
+// lastBasketAlert throttles the basket-short alert to one per
+// settlement_lag.alert_interval; a top-up re-arms it
+var (
+	basketAlertMu   sync.Mutex
+	lastBasketAlert time.Time
+)
+
+// GetBasket returns the current basket level and the latest top-ups
+func (s *LuckyNumberService) GetBasket() (BasketStatus, error) {
+	if s == nil || s.db == nil {
+		return BasketStatus{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	basket, err := s.db.CheckBasketLucky(ctx)
+	if err != nil {
+		return BasketStatus{}, err
+	}
+	rows, err := s.db.ListBasketTopUps(ctx, basketTopUpHistory)
+	if err != nil {
+		return BasketStatus{}, err
+	}
+
+	status := BasketStatus{
+		Amount:    utils.NumericFloat(basket["amount"]),
+		Reserved:  utils.NumericFloat(basket["reserved"]),
+		CheckedAt: time.Now(),
+		TopUps:    make([]BasketTopUp, 0, len(rows)),
+	}
+	for _, row := range rows {
+		t := BasketTopUp{
+			ID:           utils.ToInt64(row["id"]),
+			Amount:       utils.ToFloat64(row["amount"]),
+			BalanceAfter: utils.ToFloat64(row["balance_after"]),
+			Admin:        utils.ToString(row["admin"]),
+			Note:         utils.ToString(row["note"]),
+		}
+		if d, ok := row["date_created"].(time.Time); ok {
+			t.DateCreated = d
+		}
+		status.TopUps = append(status.TopUps, t)
+	}
+	return status, nil
+}
+
+// TopUpBasket adds amount to the basket on behalf of admin, pays out the
+// held wins it now covers and re-arms the basket-short alert. Returns
+// ErrInvalidAmount for an amount outside the adjustment limits.
+func (s *LuckyNumberService) TopUpBasket(admin string, amount float64, note string) (BasketTopUp, error) {
+	if s == nil || s.db == nil {
+		return BasketTopUp{}, fmt.Errorf("service or database not initialized")
+	}
+	// Checked as sent, so fractions of a cent are refused rather than
+	// rounded away, and again in the whole shillings credited
+	if err := money.Check(money.Adjustment, amount); err != nil {
+		return BasketTopUp{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	amount = round(amount)
+	if err := money.Check(money.Adjustment, amount); err != nil {
+		return BasketTopUp{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	note = strings.TrimSpace(note)
+	id, balance, err := s.db.TopUpBasket(ctx, amount, admin, note)
+	if err != nil {
+		return BasketTopUp{}, err
+	}
+
+	basketAlertMu.Lock()
+	lastBasketAlert = time.Time{}
+	basketAlertMu.Unlock()
+
+	logrus.Infof("basket: %s topped up Ksh.%.2f, balance Ksh.%.2f", admin, amount, balance)
+	released, err := s.releaseHeldWins(ctx)
+	if err != nil {
+		// The top-up stands; the holds are released by the next one
+		logrus.Errorf("basket: releasing held wins after top-up #%d: %v", id, err)
+	}
+	return BasketTopUp{
+		ID:           id,
+		Amount:       amount,
+		BalanceAfter: balance,
+		Admin:        admin,
+		Note:         note,
+		DateCreated:  time.Now(),
+		Released:     released,
+	}, nil
+}
+
+// releaseHeldWins pays out the held wins the basket now covers, oldest
+// first, and returns how many were released
+func (s *LuckyNumberService) releaseHeldWins(ctx context.Context) (int, error) {
+	released, err := s.db.ReleaseBasketHolds(ctx)
+	for _, r := range released {
+		logrus.Infof("basket: released held win %s of Ksh.%.2f for %s", r.Reference, r.Amount, r.Msisdn)
+		_ = s.advanceRound(ctx, r.Reference, database.RoundPaid, actorPayout, fmt.Sprintf("held net %.2f queued for disbursement after a basket top-up", r.Payout))
+	}
+	return len(released), err
+}
+
+// takeFromBasket deducts a gross win from the basket. It reports false,
+// and deducts nothing, when the basket cannot cover the amount.
+func (s *LuckyNumberService) takeFromBasket(ctx context.Context, amount float64, reference string) (bool, error) {
+	covered, err := s.db.UpdateHouseLuckyBasketWins(ctx, amount)
+	if err != nil || !covered {
+		return false, err
+	}
+	_, err = s.db.InsertHouseBasketLogs(ctx, amount, 0, -amount, fmt.Sprintf("%.2f deducted from the basket:- game id %s", amount, reference))
+	return true, err
+}
+
+// alertBasketShort tells ops the basket could not cover a win. Every
+// shortfall is logged; the Slack webhook (settlement_lag.webhook_url) is
+// posted at most once per settlement_lag.alert_interval.
+func (s *LuckyNumberService) alertBasketShort(msisdn, reference string, amount float64) {
+	msg := fmt.Sprintf("Basket short: win of Ksh.%.2f on game %s could not be covered; payout held in pending withdrawals. Top up the basket.", amount, reference)
+	logrus.WithFields(logrus.Fields{"msisdn": msisdn, "reference": reference, "amount": amount}).Error(msg)
+
+	if s.lag == nil || s.lag.cfg.WebhookURL == "" {
+		return
+	}
+	now := time.Now()
+	basketAlertMu.Lock()
+	if !lastBasketAlert.IsZero() && now.Sub(lastBasketAlert) < s.lag.cfg.AlertInterval {
+		basketAlertMu.Unlock()
+		return
+	}
+	lastBasketAlert = now
+	basketAlertMu.Unlock()
+
+	utils.GoBackground("basket alert", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.lag.postWebhook(ctx, msg); err != nil {
+			logrus.Errorf("basket: webhook failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"testing"
+)
+
+// TestBasketShortHoldsWin plays two wins into an underfunded basket. Both
+// stand as wins with their payouts held and reserved, the second because
+// the first's reservation comes first, and top-ups release them in order.
+func TestBasketShortHoldsWin(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 200)
+	repo.basket = 100
+	repo.kpi.Handle = 1000000 // keeps the day's RTP under its limit
+	s := newTestService(t, repo, fixedOutcomes{"1": 200, "2": 120, "3": 0})
+
+	first := placeTestBet(t, s, repo, 50, "1").GameResult
+	if first.ResultStatus != status.ResultWin || !first.PayoutDelayed || first.NetAmount != 160 {
+		t.Fatalf("first = %+v, want a 200 win with its payout delayed", first)
+	}
+	// 145 in the basket after the stake: nothing taken, 200 reserved
+	if !near(repo.basket, 145) || repo.reserved != 200 {
+		t.Errorf("basket %.2f reserved %.2f, want 145 with 200 reserved", repo.basket, repo.reserved)
+	}
+	second := placeTestBet(t, s, repo, 50, "2").GameResult
+	if second.ResultStatus != status.ResultWin || !second.PayoutDelayed {
+		t.Fatalf("second = %+v, want held behind the first, not paid from its reservation", second)
+	}
+	for _, ref := range []string{first.GameID, second.GameID} {
+		if b := repo.bets[ref]; b == nil || b.Status != status.ResultWin {
+			t.Errorf("bet %s = %+v, want a win, never a loss", ref, b)
+		}
+		if repo.rounds[ref] != database.RoundSettled {
+			t.Errorf("round %s = %s, want settled until released", ref, repo.rounds[ref])
+		}
+	}
+	if len(repo.queued) != 0 || len(repo.pending) != 2 || repo.reserved != 320 {
+		t.Fatalf("queued %+v, pending %+v, reserved %.2f; want both held and 320 reserved", repo.queued, repo.pending, repo.reserved)
+	}
+	if basket, _ := s.GetBasket(); !near(basket.Amount, 190-320) || basket.Reserved != 320 {
+		t.Errorf("GetBasket = %+v, want -130 available and 320 reserved", basket)
+	}
+
+	// 290 covers the first hold only; the second waits rather than skipping ahead
+	topUp, err := s.TopUpBasket("admin", 100, "")
+	if err != nil || topUp.Released != 1 {
+		t.Fatalf("top-up = %+v, %v, want one win released", topUp, err)
+	}
+	if len(repo.queued) != 1 || repo.queued[0].Reference != first.GameID || repo.queued[0].Amount != 160 {
+		t.Errorf("queued = %+v, want the first win's net 160", repo.queued)
+	}
+	if !near(repo.basket, 90) || repo.reserved != 120 || repo.rounds[first.GameID] != database.RoundPaid {
+		t.Errorf("basket %.2f reserved %.2f round %s; want 90, 120 and paid", repo.basket, repo.reserved, repo.rounds[first.GameID])
+	}
+
+	if topUp, _ := s.TopUpBasket("admin", 50, ""); topUp.Released != 1 {
+		t.Fatalf("second top-up released %d, want 1", topUp.Released)
+	}
+	if len(repo.queued) != 2 || repo.queued[1].Reference != second.GameID || len(repo.pending) != 0 {
+		t.Errorf("queued %+v pending %+v, want both payouts queued", repo.queued, repo.pending)
+	}
+	if !near(repo.basket, 20) || repo.reserved != 0 || repo.rounds[second.GameID] != database.RoundPaid {
+		t.Errorf("basket %.2f reserved %.2f; want 20 and nothing reserved", repo.basket, repo.reserved)
+	}
+}
+
+func TestBasketTopUpWithoutHolds(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, nil)
+	topUp, err := s.TopUpBasket("admin", 500, "  weekly float ")
+	if err != nil || topUp.Released != 0 || topUp.BalanceAfter != 100500 || topUp.Note != "weekly float" {
+		t.Errorf("top-up = %+v, %v", topUp, err)
+	}
+	if _, err := s.TopUpBasket("admin", 0, ""); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("zero top-up = %v, want ErrInvalidAmount", err)
+	}
+}
@@ -0,0 +1,1391 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/flags"
+	"fiberapp/status"
+	"fiberapp/taxcalc"
+	"fiberapp/utils"
+	"fmt"
+	"maps"
+	"math"
+
+	"github.com/sirupsen/logrus"
+)
+
+// BetSettler takes a bet from stake to result: it books the stake, plays
+// the game and settles the win or loss
+type BetSettler interface {
+	PlaceBet(ctx context.Context, user map[string]interface{}, ussd string, name string, gameCatID string, msisdn string, amount float64, selectedNumber string, channel string) (PlaceBetResult, error)
+}
+
+var _ BetSettler = (*LuckyNumberService)(nil)
+
+// PlaceBet handles the main betting logic. On a game with a reveal delay
+// the bet is settled all the same, but Reveal comes back in place of the
+// outcome and the result SMS wait for it; see RunRevealDispatcher. A bet
+// faster than the settings' pace is a *BetThrottleError before any money
+// moves.
+func (s *LuckyNumberService) PlaceBet(ctx context.Context, user map[string]interface{}, ussd string, name string, gameCatID string, msisdn string, amount float64, selectedNumber string, channel string) (PlaceBetResult, error) {
+	if err := s.checkBetPace(ctx, msisdn); err != nil {
+		return PlaceBetResult{}, err
+	}
+	// ctx carries the request's values; the bet settles even if it ends
+	ctx, timing := withTiming(context.WithoutCancel(ctx), flowBet)
+	result, err := s.placeBetAndReveal(ctx, user, ussd, name, gameCatID, msisdn, amount, selectedNumber, channel)
+	result.Timing = timing.finish()
+	return result, err
+}
+
+// placeBetAndReveal places a single-box bet and, on a game with a reveal
+// delay, withholds its outcome
+func (s *LuckyNumberService) placeBetAndReveal(ctx context.Context, user map[string]interface{}, ussd string, name string, gameCatID string, msisdn string, amount float64, selectedNumber string, channel string) (PlaceBetResult, error) {
+	game, err := s.GetPlayableGame(ctx, gameCatID)
+	if err != nil {
+		return PlaceBetResult{}, err
+	}
+	// a settings row the engine refuses is refused before the stake is taken
+	if _, err := s.settings(ctx); err != nil {
+		return PlaceBetResult{}, err
+	}
+	timingFrom(ctx).lap(stageSettings)
+	delay := revealDelay(game.RevealDelay, channel)
+	if delay <= 0 {
+		return s.placeBet(ctx, user, ussd, name, gameCatID, msisdn, amount, selectedNumber, channel)
+	}
+
+	ctx, held := holdResultSMS(ctx)
+	result, err := s.placeBet(ctx, user, ussd, name, gameCatID, msisdn, amount, selectedNumber, channel)
+	if err != nil {
+		return result, err
+	}
+	reveal, err := s.holdReveal(ctx, msisdn, result.GameResult, *held, delay)
+	timingFrom(ctx).lap(stageOutcome)
+	if err != nil {
+		// The bet is settled either way; show it now rather than never
+		logrus.Errorf("bet %s: holding the outcome failed, showing it now: %v", result.GameResult.GameID, err)
+		for _, message := range *held {
+			if err := s.sendsms(msisdn, message); err != nil {
+				logrus.Errorf("bet %s: sms failed: %v", result.GameResult.GameID, err)
+			}
+		}
+		return result, nil
+	}
+	return PlaceBetResult{FreeBet: result.FreeBet, Message: result.Message, Reveal: reveal}, nil
+}
+
+// placeBet places and settles a single-box bet
+func (s *LuckyNumberService) placeBet(ctx context.Context, user map[string]interface{}, ussd string, name string, gameCatID string, msisdn string, amount float64, selectedNumber string, channel string) (PlaceBetResult, error) {
+	release, err := s.plays.acquire(ctx)
+	if err != nil {
+		return PlaceBetResult{}, err
+	}
+	defer release()
+	timingFrom(ctx).lap(stageQueue)
+
+	gameID := utils.NewReference(utils.RefBet)
+
+	// 3. Handle free bet
+	if user != nil && s.hasActiveFreeBet(user) {
+		logrus.Infof("Freebet is working: %v", user)
+
+		var totalBetsHist []Bet // adjust type to your CheckBets return type
+		err := s.accounts.run(ctx,
+			func() error {
+				_, err := s.db.CheckBets(ctx, msisdn)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateUserLucky(ctx, msisdn)
+				return err
+			},
+		)
+		if err != nil {
+			return PlaceBetResult{}, err
+		}
+
+		// Refresh user data after updates
+
+		if err := s.openRound(ctx, gameID, msisdn, gameCatID, amount, actorPlayer, "free bet on box "+selectedNumber+" via "+channel); err != nil {
+			return PlaceBetResult{}, err
+		}
+		_ = s.advanceRound(ctx, gameID, database.RoundFunded, actorWallet, "free bet")
+
+		// Play game immediately
+		game_result, err := s.playGame(ctx, totalBetsHist, gameCatID, user, msisdn, amount, selectedNumber, gameID,
+			"free_bet", channel, ussd, name)
+		if err != nil {
+			return PlaceBetResult{}, err
+		}
+
+		return PlaceBetResult{GameResult: game_result, FreeBet: "true", Message: "Free Bet Placed Successful"}, nil
+	} else {
+		var totalBetsHist, err = s.db.CheckBets(ctx, msisdn)
+		if err != nil {
+			return PlaceBetResult{}, err
+		}
+
+		if err := s.openRound(ctx, gameID, msisdn, gameCatID, amount, actorPlayer, "bet on box "+selectedNumber+" via "+channel); err != nil {
+			return PlaceBetResult{}, err
+		}
+
+		// Take the stake from cash and/or bonus before playing
+		cashStake, bonusStake, err := s.db.DebitStake(ctx, msisdn, gameID, amount, limits.BonusFirst)
+		if err != nil {
+			s.failRound(ctx, gameID, actorWallet, err)
+			return PlaceBetResult{}, err
+		}
+		if bonusStake > 0 {
+			logrus.Infof("bet %s funded: cash=%.2f bonus=%.2f", gameID, cashStake, bonusStake)
+		}
+		_ = s.advanceRound(ctx, gameID, database.RoundFunded, actorWallet, fmt.Sprintf("stake cash=%.2f bonus=%.2f", cashStake, bonusStake))
+
+		game_result, err := s.playGame(ctx,
+			totalBetsHist,
+			gameCatID, // Use toString instead of type assertion
+			user,
+			msisdn,
+			amount, // Use toFloat64 instead of type assertion
+			selectedNumber,
+			gameID,
+			"normal",
+			channel,
+			"",
+			name)
+
+		if err != nil {
+			return PlaceBetResult{}, err
+		}
+
+		return PlaceBetResult{GameResult: game_result, FreeBet: "false", Message: "Bet Placed Successful"}, nil
+	}
+}
+
+func (s *LuckyNumberService) hasActiveFreeBet(user map[string]interface{}) bool {
+	freeBet := FreeBetOf(user)
+	logrus.Infof("Freebet is working: is_free=%t, free_bet=%.2f, freebet_expiry=%v", freeBet.Flagged, freeBet.Amount, freeBet.Expiry)
+	return freeBet.Active(clock.Now())
+}
+
+func (s *LuckyNumberService) adjustBetAmount(ctx context.Context, msisdn string, amount float64) (float64, error) {
+	previousBet, err := s.db.CheckBettoBet(ctx, msisdn)
+	if err != nil {
+		return amount, err
+	}
+	if previousBet != nil && len(previousBet) > 0 {
+		betRecord := previousBet[0]
+		previousAmount, ok := betRecord["amount"].(float64)
+		if ok {
+			if previousAmount == amount {
+				return amount - 1, nil
+			} else if previousAmount == (amount - 1) {
+				return amount + 1, nil
+			}
+		}
+	}
+	return amount, nil
+}
+
+// gameState is what a bet is played against: the global settings, the
+// game, today's KPI row, the house totals and the tax rates
+type gameState struct {
+	settings database.Settings
+	game     database.Game
+	kpi      map[string]interface{}
+	house    map[string]interface{}
+	tax      taxRates
+}
+
+// loadGameState reads the game state for gameCatID. The game is read with
+// roundGame: by the time a round is played its stake is already taken.
+// The tax rates are those the round of reference was opened with, so a
+// rate change while it was in flight does not reach it; an empty reference
+// takes the rates in effect now.
+func (s *LuckyNumberService) loadGameState(ctx context.Context, gameCatID, reference string) (gameState, error) {
+	// Get settings
+	var (
+		settings database.Settings
+		game     database.Game
+		kpi      interface{}
+		house    interface{}
+		rates    map[string]float64
+	)
+	err := s.accounts.run(ctx,
+		func() (err error) {
+			settings, err = s.settings(ctx)
+			return err
+		},
+		func() (err error) {
+			rates, err = s.storedTaxRates(ctx, reference)
+			return err
+		},
+		func() (err error) {
+			game, err = s.roundGame(ctx, gameCatID)
+			return err
+		},
+		func() (err error) {
+			kpi, err = s.db.CheckSettingKPI(ctx)
+			return err
+		},
+		func() (err error) {
+			house, err = s.db.CheckHousePawaBoxKe(ctx)
+			return err
+		},
+	)
+	if err != nil {
+		return gameState{}, err
+	}
+
+	// Now you can use game, kpi, house as interface{} and type assert when needed
+
+	houseMap, ok := house.(map[string]interface{})
+	if !ok {
+		return gameState{}, fmt.Errorf("house is not a map")
+	}
+
+	kpiMap, ok := kpi.(map[string]interface{})
+	if !ok {
+		return gameState{}, fmt.Errorf("kpi is not a map")
+	}
+	return gameState{settings: settings, game: game, kpi: kpiMap, house: houseMap, tax: taxRatesFrom(rates, settings)}, nil
+}
+
+// playGame plays the funded round of reference and marks it failed when
+// the game errors
+func (s *LuckyNumberService) playGame(ctx context.Context, history interface{}, gameCatID string, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference, betType, channel, ussd, gameName string) (PlaceBetResultDisplay, error) {
+	ctx = withChannel(ctx, channel)
+	// whatever the caller did to fund the round is accounting
+	timing := timingFrom(ctx)
+	timing.setReference(reference)
+	timing.lap(stageAccounting)
+	result, err := s.playRound(ctx, history, gameCatID, player, msisdn, betAmount, selectedNumber, reference, betType, channel, ussd, gameName)
+	if err != nil {
+		s.failRound(ctx, reference, actorGame, err)
+	}
+	return result, err
+}
+
+// playRound contains the main game logic
+func (s *LuckyNumberService) playRound(ctx context.Context, history interface{}, gameCatID string, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference, betType, channel, ussd, gameName string) (PlaceBetResultDisplay, error) {
+	timing := timingFrom(ctx)
+	state, err := s.loadGameState(ctx, gameCatID, reference)
+	if err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	timing.lap(stageSettings)
+	settings, houseMap := state.settings, state.house
+
+	// Calculate current RTP
+	totalBets := utils.NumericFloat(houseMap["total_bets"]) + betAmount
+	currentRTP := 0.0
+	if totalBets > 0 {
+		currentRTP = utils.NumericFloat(houseMap["total_wins"]) / totalBets
+	}
+	defaultRTP := settings.DefaultRTP + settings.JackpotPercentage
+	if currentRTP > defaultRTP {
+		currentRTP = defaultRTP
+	}
+
+	// The bet row claims the round before anything else is written under
+	// its reference. The round's own reference is kept: a bet already
+	// holding it means another process is playing this round, and it wins.
+	created, err := s.db.CreateBet(ctx, msisdn, selectedNumber, betAmount, "", reference, status.ResultPending, betType, gameCatID, gameName, channel)
+	if err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	if !created {
+		logrus.Warnf("bet %s: already placed, not playing the round again", reference)
+		return PlaceBetResultDisplay{}, fmt.Errorf("%w: %s", ErrRoundPlayed, reference)
+	}
+
+	if err := s.bookStake(ctx, state, player, msisdn, betAmount, selectedNumber, reference, betType, gameCatID, gameName, channel, ussd); err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	if err := s.advanceRound(ctx, reference, database.RoundPlayed, actorGame, "box "+selectedNumber); err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	timing.lap(stageAccounting)
+
+	result, err := s.decideOutcome(ctx, state, player, msisdn, betAmount, selectedNumber, reference, betType)
+	timing.lap(stageOutcome)
+	if err == nil {
+		s.reportSettledBet(ctx, msisdn, reference, gameCatID, channel, betAmount, result)
+		timing.lap(stageAccounting)
+	}
+	return result, err
+}
+
+// decideOutcome decides and settles the staked round of reference. Outcomes
+// are decided one at a time under s.mu, against the day's KPI as every
+// earlier outcome left it, so two rounds cannot pay out the same headroom.
+// The rounds' accounting before and after runs concurrently, as many at a
+// time as there are play slots.
+func (s *LuckyNumberService) decideOutcome(ctx context.Context, state gameState, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference, betType string) (PlaceBetResultDisplay, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kpi, err := s.db.CheckSettingKPI(ctx)
+	if err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	state.kpi = kpiBeforeStake(kpi, state.settings, betAmount, betType)
+
+	// Check for jackpot winner
+	jackpotWinner, err := s.db.CheckJackpotWinner(ctx)
+	if err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+
+	// Determine game outcome
+	minLossCount := cryptoRandIndex(state.settings.MinLossCount) + 1
+
+	playerFrequency := int64(0)
+	if freq, ok := player["frequency"].(int32); ok {
+		playerFrequency = int64(freq)
+	} else if freq, ok := player["frequency"].(int64); ok {
+		playerFrequency = freq
+	}
+
+	playerLostCount := int64(0)
+	if lost, ok := player["lost_count"].(int32); ok {
+		playerLostCount = int64(lost)
+	} else if lost, ok := player["lost_count"].(int64); ok {
+		playerLostCount = lost
+	}
+	// The loss streak's jackpot is subject to the forced-win rule too
+	if playerFrequency > 10 && playerLostCount > int64(minLossCount) && jackpotWinner != nil && s.streakEarnsForcedWin(ctx, player, msisdn, state.settings) {
+
+		// Handle jackpot win condition
+		// if playerFrequency > 10 && jackpotWinner != nil {
+		return s.handleJackpotWin(ctx, player, msisdn, betAmount, utils.ToInt(selectedNumber), reference, state.settings, state.tax, state.game, state.kpi, jackpotWinner)
+	}
+	return s.handleNormalGame(ctx, player, msisdn, betAmount, selectedNumber, reference, state.settings, state.tax, state.game, state.kpi, minLossCount)
+}
+
+// reportSettledBet books a settled bet's payout on its channel and
+// publishes bet_settled
+func (s *LuckyNumberService) reportSettledBet(ctx context.Context, msisdn, reference, gameCatID, channel string, betAmount float64, result PlaceBetResultDisplay) {
+	if result.WinAmount > 0 {
+		// The win is already paid; a failed report must not fail the bet
+		if _, kpiErr := s.db.UpdateKPIChannelPayout(ctx, channel, result.WinAmount); kpiErr != nil {
+			logrus.Errorf("kpi by channel: payout for %s failed: %v", reference, kpiErr)
+		}
+	}
+	s.publishBetSettled(ctx, msisdn, reference, gameCatID, channel, betAmount, result)
+}
+
+// bookStake books a stake of betAmount under reference: the player's bet
+// totals, KPI handle, excise, the jackpot, house and basket shares, or for a
+// free bet its cost
+func (s *LuckyNumberService) bookStake(ctx context.Context, state gameState, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference, betType, gameCatID, gameName, channel, ussd string) error {
+	// Register player and record bet
+	playerRow := database.Player(player)
+	err := s.bet(ctx, reference, playerRow.ID(), playerRow.TotalBets(), betAmount)
+	if err != nil {
+		return err
+	}
+
+	// Calculate basket and house values
+	globalRTP := state.settings.DefaultRTP + state.settings.AdjustableRTP
+	basketValue := betAmount * (globalRTP / 100)
+	houseValue := (state.settings.VigPercentage / 100) * betAmount
+	jackpotValue := (state.settings.JackpotPercentage / 100) * betAmount
+
+	// A free bet is staked with the house's own money: no cash came in, so
+	// its stake stays out of handle, house bets, basket, jackpot and excise
+	// and is booked as free-bet cost instead. Its wins are paid and taxed
+	// like any other win.
+	freeBet := betType == "free_bet"
+
+	// Feed the jackpot kitty of a jackpot game. A game flagged is_jackpot
+	// without a kitty of its name_init is left out; the startup check and
+	// GET /admin/jackpots/consistency report it.
+	if !freeBet {
+		feeds, err := s.feedsJackpot(ctx, state.game)
+		if err != nil {
+			return err
+		}
+		if feeds {
+			_, err = s.db.UpdateJackpotKitNameInit(ctx, reference, jackpotValue, state.game.NameInit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Calculate taxes
+	withholdTaxJackpot := (state.tax.Withholding / 100) * jackpotValue
+	exciseTaxAmountRound := taxcalc.Excise(betAmount, state.tax.Excise)
+
+	// Execute all database operations
+	tasks := []func() error{
+		func() error {
+			_, err := s.db.UpdateHouseLucyNumberHouseCurrentRTP(ctx)
+			return err
+		},
+	}
+
+	if freeBet {
+		tasks = append(tasks,
+			func() error {
+				_, err := s.db.InsertIntoDepositLuckyRequestBonus(ctx, betType, ussd, gameName,
+					s.getMNOCategory(msisdn), gameCatID, betAmount, msisdn, selectedNumber, reference, channel)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateKPIFreeBetStake(ctx, betAmount)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "free_bet_stake", msisdn, betAmount)
+				return err
+			},
+		)
+	} else {
+		tasks = append(tasks,
+			func() error {
+				_, err := s.db.UpdateKPIHandle(ctx, betAmount)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateKPIChannelHandle(ctx, channel, betAmount)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateKPIPayouts(ctx, jackpotValue, round(withholdTaxJackpot), exciseTaxAmountRound)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertTaxQueue(ctx, reference, betAmount, exciseTaxAmountRound, betAmount-exciseTaxAmountRound, state.tax.Excise, "excise", msisdn)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertB2BWithdrawalB2B(ctx, reference, msisdn, exciseTaxAmountRound, status.B2BPlaced)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateJackpotKit(ctx, reference, jackpotValue)
+				return err
+			},
+			func() error {
+				// DebitStake already took the stake from cash and/or bonus
+				_, err := s.db.UpdateUserRTP(ctx, 0, player["id"].(int64))
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateHousePawaBoxKeBets(ctx, betAmount)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "total_bets", msisdn, betAmount)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateHousePawaBoxKeHouse(ctx, houseValue)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateKPIVIG(ctx, houseValue)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "house_income", msisdn, houseValue)
+				return err
+			},
+			func() error {
+				_, err := s.db.UpdateHousePawaBoxKeBasket(ctx, basketValue)
+				return err
+			},
+			func() error {
+				_, err := s.db.InsertHouseBasketLogs(ctx, 0, basketValue, basketValue, fmt.Sprintf("%.2f added to the basket:- game id %s", basketValue, reference))
+				return err
+			},
+		)
+	}
+	// Run all tasks in parallel on the accounting workers
+	return s.accounts.run(ctx, tasks...)
+}
+
+// kpiBeforeStake is the day's kpi without the stake of betAmount bookStake
+// booked for a round of betType: bet and payout as the round found them
+func kpiBeforeStake(kpi map[string]interface{}, settings database.Settings, betAmount float64, betType string) map[string]interface{} {
+	if betType == "free_bet" {
+		return kpi
+	}
+	before := maps.Clone(kpi)
+	before["bet"] = utils.ToFloat64(kpi["bet"]) - betAmount
+	before["payout"] = utils.ToFloat64(kpi["payout"]) - (settings.JackpotPercentage/100)*betAmount
+	return before
+}
+
+// bet records a bet for a player
+func (s *LuckyNumberService) bet(ctx context.Context, reference string, playerID int64, totalBets, amount float64) error {
+	_, err := s.db.UpdateUserBet(ctx, amount, playerID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.InsertCustomerLogsPawaBoxKe(ctx, amount, "bet", utils.ToString(playerID), "customer placed bet", reference)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// winBooking is what differs between the games when creditWin books a win
+type winBooking struct {
+	narrative string // the payout's customer log narrative
+	holdLarge bool   // hold payouts of 60000 and over in pending_withdrawals
+}
+
+var (
+	boxWin     = winBooking{narrative: "customer withdrawal: luckynumber", holdLarge: true}
+	jackpotWin = winBooking{narrative: "customer withdrawal: luckynumber"}
+	spinWin    = winBooking{narrative: "customer withdrawal: spin&win", holdLarge: true}
+)
+
+// winJackpot records a jackpot win. It is credited like any other win, so
+// the bonus-funded share goes back to the bonus wallet, but the payout is
+// queued whatever its size.
+func (s *LuckyNumberService) winJackpot(ctx context.Context, playerID int64, payout, bets float64, winItem string, tax taxcalc.Win, msisdn, reference string) error {
+	_, err := s.creditWin(ctx, playerID, winItem, tax, msisdn, reference, jackpotWin)
+	return err
+}
+
+// win records a win for a player. It reports true when the basket could
+// not cover the win: the win still stands but its payout is held in
+// pending_withdrawals until the basket is topped up.
+func (s *LuckyNumberService) win(ctx context.Context, playerID int64, payout, bets float64, winItem string, tax taxcalc.Win, msisdn, reference string) (bool, error) {
+	return s.creditWin(ctx, playerID, winItem, tax, msisdn, reference, boxWin)
+}
+
+// creditWin books a settled win: the share won by a bonus-funded stake is
+// credited to the bonus wallet, and the rest is taken from the basket and
+// queued for disbursement as book says. It reports true when the basket
+// could not cover the win.
+func (s *LuckyNumberService) creditWin(ctx context.Context, playerID int64, winItem string, tax taxcalc.Win, msisdn, reference string, book winBooking) (bool, error) {
+	amount, withholdTax, taxDeductedAmount := tax.GrossAmount, tax.TaxAmount, tax.NetAmount
+	amountNew := round(amount)
+	withholdTaxNew := round(withholdTax)
+
+	// The bonus-funded share of the stake wins back into the bonus wallet
+	bonusShare, err := s.db.CreditBonusWin(ctx, reference, taxDeductedAmount)
+	if err != nil {
+		return false, err
+	}
+	if bonusShare > 0 {
+		logrus.Infof("win %s: Ksh.%.2f kept in bonus wallet for %s", reference, bonusShare, msisdn)
+		taxDeductedAmount -= bonusShare
+	}
+	taxDeductedAmountNew := round(taxDeductedAmount)
+
+	if taxDeductedAmountNew <= 0 {
+		// Nothing to pay out; still account for tax and the basket
+		if _, err := s.db.InsertTaxQueue(ctx, reference, amount, withholdTax, 0, tax.WithholdingPercent, "withholding", msisdn); err != nil {
+			return false, err
+		}
+		covered, err := s.recordWin(ctx, playerID, amountNew, msisdn, reference, book.narrative)
+		if err == nil && !covered {
+			s.alertBasketShort(msisdn, reference, amountNew)
+			_, err = s.db.HoldBasketPayout(ctx, reference, msisdn, amountNew)
+		}
+		if err == nil {
+			_ = s.advanceRound(ctx, reference, database.RoundPaid, actorPayout, fmt.Sprintf("%.2f credited to the bonus wallet", bonusShare))
+		}
+		return false, err
+	}
+
+	// Insert into withdrawals
+	_, err = s.db.InsertIntoWithdrawalsLucky(ctx, amount, taxDeductedAmountNew, withholdTaxNew, winItem, msisdn, reference)
+	if err != nil {
+		return false, err
+	}
+
+	// Check settings
+	setting, err := s.setting(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if setting != nil {
+		checkWithdrawal, err := s.db.CheckWithdrawalsPawaBoxKe(ctx, reference)
+		if err != nil {
+			return false, err
+		}
+
+		if checkWithdrawal != nil && checkWithdrawal["msisdn"] != nil {
+			// Insert tax queue
+			_, err := s.db.InsertTaxQueue(ctx, reference, amount, withholdTax, taxDeductedAmount, tax.WithholdingPercent, "withholding", msisdn)
+			if err != nil {
+				return false, err
+			}
+
+			// Insert B2B withdrawal
+			_, err = s.db.InsertB2BWithdrawalB2B(ctx, reference, msisdn, taxDeductedAmountNew, status.B2BWon)
+			if err != nil {
+				return false, err
+			}
+
+			covered, err := s.recordWin(ctx, playerID, amountNew, msisdn, reference, book.narrative)
+			if err != nil {
+				return false, err
+			}
+			if err := s.queuePayout(ctx, covered, book.holdLarge, amountNew, taxDeductedAmountNew, withholdTaxNew, winItem, msisdn, reference); err != nil {
+				return false, err
+			}
+			if _, err := s.db.UpdatePawaBoxKeWithdrawalRequest(ctx, reference); err != nil {
+				return false, err
+			}
+			return !covered, nil
+		}
+	}
+	return false, nil
+}
+
+// queuePayout sends a net win to disbursement. Wins the basket could not
+// cover wait in pending_withdrawals instead, with their gross amount
+// reserved against the basket until a top-up releases them, and alert ops;
+// with holdLarge, so do wins of 60000 and over.
+func (s *LuckyNumberService) queuePayout(ctx context.Context, covered, holdLarge bool, amountNew, taxDeductedAmountNew, withholdTaxNew float64, winItem, msisdn, reference string) error {
+	if !covered {
+		s.alertBasketShort(msisdn, reference, amountNew)
+	}
+
+	// A held payout leaves the round settled until it is released
+	if (holdLarge && amountNew >= 60000) || !covered {
+		if _, err := s.db.InsertIntoPendingWithdrawalsLucky(ctx, taxDeductedAmountNew, withholdTaxNew, winItem, msisdn, reference); err != nil {
+			return err
+		}
+		if !covered {
+			_, err := s.db.HoldBasketPayout(ctx, reference, msisdn, amountNew)
+			return err
+		}
+		return nil
+	}
+	if _, err := s.db.InsertWithdrawalQueue(ctx, reference, msisdn, taxDeductedAmountNew, "http?"); err != nil {
+		return err
+	}
+	_ = s.advanceRound(ctx, reference, database.RoundPaid, actorPayout, fmt.Sprintf("net %.2f queued for disbursement", taxDeductedAmountNew))
+	return nil
+}
+
+// recordWin updates the player's and the house's win totals and takes the
+// gross win from the basket, logging the payout under narrative. It reports
+// false when the basket could not cover the win and nothing was taken from it.
+func (s *LuckyNumberService) recordWin(ctx context.Context, playerID int64, amountNew float64, msisdn, reference, narrative string) (bool, error) {
+	covered, err := s.takeFromBasket(ctx, amountNew, reference)
+	if err != nil {
+		return false, err
+	}
+
+	tasks := []func() error{
+		func() error {
+			_, err := s.db.UpdateRESTLossUser(ctx, amountNew, playerID)
+			return err
+		},
+		func() error {
+			_, err := s.db.InsertCustomerLogsPawaBoxKe(ctx, amountNew, "withdraw", utils.ToString(playerID), narrative, reference)
+			return err
+		},
+		func() error {
+			_, err := s.db.UpdateHouseLuckyWins(ctx, amountNew)
+			return err
+		},
+		func() error {
+			_, err := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "total_wins", msisdn, amountNew)
+			return err
+		},
+	}
+
+	for _, task := range tasks {
+		if err := task(); err != nil {
+			return covered, err
+		}
+	}
+	return covered, nil
+}
+
+// lose records a loss for a player
+func (s *LuckyNumberService) lose(ctx context.Context, playerID int64, reference string, msisdn string, lostCount int64, totalLosses, amount float64) error {
+	tasks := []func() error{
+		func() error {
+			_, err := s.db.UpdateUserLossCount(ctx, amount, playerID)
+			return err
+		},
+		func() error {
+			_, err := s.db.InsertCustomerLogsPawaBoxKe(ctx, amount, "lost", utils.ToString(playerID), fmt.Sprintf("customer lost %.2f", amount), reference)
+			return err
+		},
+		func() error {
+			_, err := s.db.UpdateHouseLuckyHouseLosses(ctx, amount)
+			return err
+		},
+		func() error {
+			_, err := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, reference, "total_losses", msisdn, amount)
+			return err
+		},
+		func() error {
+			_, err := s.db.InsertB2BWithdrawalB2B(ctx, reference, msisdn, 0, status.B2BLost)
+			return err
+		},
+	}
+
+	for _, task := range tasks {
+		if err := task(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *LuckyNumberService) GenerateWinJackpotWinner(
+	ctx context.Context,
+	msisdn string,
+	kpi map[string]interface{},
+	defaultRTP, playerRTP float64,
+	reference string,
+	betAmount float64,
+	selectedNumber int,
+	playerID int,
+	minWinMultiplier, maxWinMultiplier float64,
+	maxExposure float64,
+	nameInit string,
+	playerCount, maxLossCount int,
+	maxWon, vigPercentage float64,
+	itemWinValue float64,
+	itemWon string) (map[int]WinAmount, error) {
+	//-------------------------------------
+	// Step 1 — Choose 7 unique box numbers
+	//-------------------------------------
+	chosen := cryptoRandUniqueInts(1, 8, 7) // {1..7}
+	numZeroBoxes := cryptoRandInt(0, 3)     // 0–2
+
+	boxes := make(map[int]WinAmount)
+
+	minWinAmount := betAmount * minWinMultiplier
+	maxWinAmount := maxExposure
+
+	//-------------------------------------
+	// Step 2 — Assign random win amounts
+	//-------------------------------------
+	for _, num := range chosen {
+
+		var winAmt float64
+
+		if cryptoRandFloat() < 0.5 {
+			// small range
+			winAmt = cryptoRandFloatRange(minWinAmount, minWinAmount*20)
+		} else {
+			winAmt = cryptoRandFloatRange(minWinAmount, maxWinAmount)
+		}
+
+		boxes[num] = WinAmount{
+			Value: winAmt,
+			Item:  FormatToMZN(winAmt),
+		}
+	}
+
+	//-------------------------------------
+	// Step 3 — Zero out random boxes (except selected box)
+	//-------------------------------------
+	candidates := make([]int, 0)
+	for _, n := range chosen {
+		if n != selectedNumber {
+			candidates = append(candidates, n)
+		}
+	}
+
+	zeroBoxes := cryptoRandSample(candidates, numZeroBoxes)
+	for _, zb := range zeroBoxes {
+		boxes[zb] = WinAmount{Value: 0, Item: "0"}
+	}
+
+	//-------------------------------------
+	// Step 4 — Add a random AWARD box
+	//-------------------------------------
+	award, err := s.db.CheckAwardsLuckyRandom(ctx, nameInit)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candidates) > 0 {
+		rnd := candidates[cryptoRandInt(0, len(candidates))]
+		boxes[rnd] = WinAmount{
+			Value: utils.ToFloat64(award["value"]),
+			Item:  utils.ToString(award["name"]),
+			Kind:  BoxAward,
+		}
+	}
+
+	//-------------------------------------
+	// Step 5 — Set selected box winning
+	//-------------------------------------
+	boxes[selectedNumber] = WinAmount{
+		Value: itemWinValue,
+		Item:  itemWon,
+		Kind:  BoxAward,
+	}
+
+	return boxes, nil
+}
+
+func (s *LuckyNumberService) handleJackpotWin(
+	ctx context.Context,
+	player map[string]interface{},
+	msisdn string,
+	betAmount float64,
+	selectedNumber int,
+	reference string,
+	settings database.Settings, rates taxRates, game database.Game, kpi, jackpotWinner map[string]interface{}) (PlaceBetResultDisplay, error) {
+	// 1. Preconditions
+	// 2. Update jackpot Kity (lock-in winner)
+	// -------------------------------
+	_, err := s.db.UpdateJackpotKitUpdate(ctx, utils.ToInt(jackpotWinner["id"]))
+
+	defaultRTP := settings.DefaultRTP
+	playerPayout := database.Player(player).Payout()
+	playerID := utils.ToInt64(player["id"])
+
+	playerTotalBets := database.Player(player).TotalBets()
+	jackpotpercentage := settings.JackpotPercentage
+	mx_win := playerTotalBets + betAmount - playerPayout
+	playerFreeBet := utils.ToInt64(player["free_bet"])
+
+	default_e := defaultRTP + jackpotpercentage
+	max_won := (default_e / 100) * mx_win
+	maxWon := utils.ToFloat64(max_won)
+	// -------------------------------
+	// 3. Generate jackpot win
+	// -------------------------------
+	winBoxes, err := s.GenerateWinJackpotWinner(
+		ctx,
+		msisdn,
+		kpi,
+		defaultRTP,
+		utils.ToFloat64(player["rtp"]),
+		reference,
+		betAmount,
+		selectedNumber,
+		utils.ToInt(player["id"]),
+		settings.MinWinMultiplier,
+		settings.MaxWinMultiplier,
+		game.MaxExposure,
+		game.NameInit,
+		utils.ToInt(player["lost_count"]),
+		settings.MinLossCount,
+		maxWon,
+		settings.VigPercentage,
+		utils.ToFloat64(jackpotWinner["cost"]),
+		utils.ToString(jackpotWinner["item_name"]),
+	)
+	generated := winBoxes[selectedNumber].Value
+	// -------------------------------
+	// 4. Adjust jackpot win amount if needed
+	// -------------------------------
+	nameInit := utils.ToString(jackpotWinner["name_init"])
+	isSpecialJackpot := nameInit == "pw_jackport" || nameInit == "pw_ist" || nameInit == "pw_mega"
+	if isSpecialJackpot {
+		winBox := winBoxes[selectedNumber]
+		winBox.Value = utils.ToFloat64(jackpotWinner["cost"])
+		winBox.Item = utils.ToString(jackpotWinner["item_name"])
+		winBox.Kind = BoxAward
+		winBoxes[selectedNumber] = winBox
+
+	}
+	if winBoxes[selectedNumber].Value < 1 {
+		winBox := winBoxes[selectedNumber]
+		winBox.Value = utils.ToFloat64(jackpotWinner["cost"])
+		winBox.Item = utils.ToString(jackpotWinner["item_name"])
+		winBox.Kind = BoxAward
+		winBoxes[selectedNumber] = winBox
+
+	}
+	winAmount := winBoxes[selectedNumber].Value
+	winItem := winBoxes[selectedNumber].Item
+	logrus.Infof("Box %d wins jackpot: %+v", selectedNumber, winBoxes)
+	// -------------------------------
+	// 5. Mark bet as WIN
+	// -------------------------------
+	resultMessage := fmt.Sprintf("Box %d wins. Numbers: %+v", selectedNumber, winAmount)
+	logrus.Info(resultMessage)
+	// 6. Calculate withholding tax
+
+	tax := taxcalc.Withholding(winAmount, rates.Withholding)
+	taxDeductedAmount := tax.NetAmount
+	// -------------------------------
+
+	if err := s.advanceRound(ctx, reference, database.RoundSettled, actorGame, fmt.Sprintf("jackpot win %.2f on box %d", winAmount, selectedNumber)); err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+
+	err = s.accounts.run(ctx,
+		// 1. Update bet as win
+		func() error {
+			_, err := s.db.UpdateLuckyBetWin(
+				ctx,
+				fmt.Sprintf("Box %d wins. Numbers: %+v", selectedNumber, winBoxes),
+				"PAWABOX",
+				reference,
+				winAmount,
+				status.ResultWin,
+			)
+			return err
+		},
+		// 2. Update jackpot entry
+		func() error {
+			_, err := s.db.UpdateJackpotKity(
+				ctx,
+				utils.ToInt(jackpotWinner["id"]),
+				reference,
+			)
+			return err
+		},
+		// 3. Update player loss stats
+		func() error {
+			_, err := s.db.UpdatePlayerRestLossJackpot(
+				ctx,
+				winAmount,
+				utils.ToInt(player["id"]),
+			)
+			return err
+		},
+		// 4. Insert into Jackpot winners
+		func() error {
+			_, err := s.db.InsertIntoJackPotWinners(
+				ctx,
+				taxDeductedAmount,
+				winItem,
+				reference,
+				game.Name,
+				utils.ToString(jackpotWinner["item_name"]),
+				utils.ToString(jackpotWinner["id"]),
+				winAmount,
+				msisdn,
+			)
+			return err
+		},
+	)
+	if err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+
+	// winBoxes[selectedNumber] = WinAmount{
+	// 	Value: taxDeductedAmount,
+	// 	Item:  FormatToMZN(taxDeductedAmount),
+	// }
+	// // Handle win logic
+
+	converted := make(map[string]WinAmount)
+
+	for k, v := range winBoxes {
+		converted[fmt.Sprintf("%d", k)] = v
+	}
+
+	box := utils.ToString(selectedNumber)
+	decision := OutcomeDecision{
+		Reference:   reference,
+		Msisdn:      msisdn,
+		GameCatID:   game.ID,
+		SelectedBox: box,
+		Branch:      BranchJackpot,
+		Generated:   round2(generated),
+		Params:      decisionParams(s.normalGameParams(player, msisdn, betAmount, box, reference, settings, game, kpi, settings.MinLossCount)),
+		KPI:         decisionKPI(kpi),
+		Boxes:       boxValues(converted),
+	}
+	if err := s.recordDecision(ctx, decision, status.ResultWin, winAmount); err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	// msg := s.createWinMessage(converted)
+	message := s.createWinMessage(ctx, TemplateWin, utils.ToString(player["language"]), utils.ToString(selectedNumber), converted, playerFreeBet, reference, tax)
+	logrus.Infof("Player MSISDN: %s", msisdn)
+	resultd, err := s.ResultDisplay(utils.ToString(selectedNumber), converted, playerFreeBet, reference)
+	// Queue SMS
+	s.notifyResult(ctx, player, msisdn, reference, message)
+	// -------------------------------
+	if !isSpecialJackpot {
+		err = s.winJackpot(ctx, playerID, playerPayout, playerTotalBets, winItem, tax, msisdn, reference)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to handle win: %w", err)
+		}
+
+		message := s.createJackpotMessage(ctx, utils.ToString(player["language"]), utils.ToString(selectedNumber), converted, reference, taxDeductedAmount)
+
+		if err := s.sendGameSMS(ctx, msisdn, message); err != nil {
+			logrus.Errorf("bet %s: jackpot sms to %s failed, retrying: %v", reference, msisdn, err)
+			retrySMSLater("jackpot of bet "+reference, func(context.Context) error {
+				return s.sendsms(msisdn, message)
+			})
+		}
+	}
+
+	s.recordSettledBet(playerID, player, betAmount, winAmount)
+
+	var boxes map[string]WinAmount
+	if err := json.Unmarshal([]byte(resultd), &boxes); err != nil {
+		logrus.Errorf("Failed to unmarshal Boxes JSON: %v", err)
+		return PlaceBetResultDisplay{}, err
+	}
+	// 10. Return final response
+	// -------------------------------
+	taxAmount, netAmount := tax.Payable()
+	mresult := PlaceBetResultDisplay{
+		Boxes:         boxes,
+		ResultStatus:  status.ResultWin,
+		WinAmount:     0,
+		JackPot:       "True",
+		GameID:        reference,
+		SelectedBox:   utils.ToString(selectedNumber),
+		ResultMessage: message,
+		GrossAmount:   tax.GrossAmount,
+		TaxAmount:     taxAmount,
+		NetAmount:     netAmount,
+	}
+
+	logrus.Infof("Player %s lost bet: %.2f", msisdn, betAmount)
+
+	// return struct + nil error
+	return mresult, nil
+}
+
+func (s *LuckyNumberService) handleNormalGame(ctx context.Context, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference string, settings database.Settings, rates taxRates, game database.Game, kpi map[string]interface{}, minLossCount int) (PlaceBetResultDisplay, error) {
+	// Generate win amounts, keeping what each was decided from for the bet's decision record
+	ctx = withDecisionTrace(ctx)
+	params := s.normalGameParams(player, msisdn, betAmount, selectedNumber, reference, settings, game, kpi, minLossCount)
+	if forcesWin(params.PlayerLostCount, params.MinLossCount) {
+		params.ForceWinBlocked = !s.streakEarnsForcedWin(ctx, player, msisdn, settings)
+	}
+	if flags.IsEnabled(ctx, flags.TightBasket, msisdn) {
+		params.BasketShare = tightBasketShare
+	}
+	winAmounts, err := s.GenerateWinAmounts(ctx, params)
+	if err != nil {
+		return PlaceBetResultDisplay{}, fmt.Errorf("failed to generate win amounts: %w", err)
+	}
+
+	logrus.Infof("Win amounts generated: %+v", winAmounts)
+
+	// 🔥 CRITICAL SAFETY CHECKS - Add these lines
+	if winAmounts == nil {
+		return PlaceBetResultDisplay{}, fmt.Errorf("winAmounts is nil after generation")
+	}
+	if err := checkPayouts(winAmounts, game.MaxExposure); err != nil {
+		return PlaceBetResultDisplay{}, err
+	}
+	logrus.Infof("Min loss count: %d", minLossCount)
+
+	return s.settleSelection(ctx, player, msisdn, betAmount, selectedNumber, reference, game, settings, rates, kpi, winAmounts, true)
+}
+
+// normalGameParams builds the generator parameters of a normal game from
+// the player, settings, game and KPI rows. The player's RTP comes from the
+// player cache, falling back to the row.
+func (s *LuckyNumberService) normalGameParams(player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference string, settings database.Settings, game database.Game, kpi map[string]interface{}, minLossCount int) GenerateWinAmountsParams {
+	playerPayout := database.Player(player).Payout()
+	playerTotalBets := database.Player(player).TotalBets()
+	defaultRTP := settings.DefaultRTP
+	jackpotpercentage := settings.JackpotPercentage
+
+	mx_win := playerTotalBets + betAmount - playerPayout
+
+	default_e := defaultRTP + jackpotpercentage
+	max_won := (default_e / 100) * mx_win
+
+	return GenerateWinAmountsParams{
+		Msisdn:           msisdn,
+		KPI:              kpi,
+		DefaultRTP:       defaultRTP,
+		AdjustmentRTP:    settings.AdjustableRTP,
+		PlayerRTP:        s.playerData(utils.ToInt64(player["id"]), player).CurrentRTP,
+		Reference:        reference,
+		BetAmount:        betAmount,
+		SelectedNumber:   selectedNumber,
+		PlayerID:         utils.ToInt64(player["id"]),
+		MinWinMultiplier: settings.MinWinMultiplier,
+		MaxWinMultiplier: settings.MaxWinMultiplier,
+		MaxExposure:      game.MaxExposure,
+		GameNameInit:     game.NameInit,
+		PlayerLostCount:  utils.ToInt64(player["lost_count"]),
+		MinLossCount:     minLossCount,
+		MaxWon:           max_won,
+		VigPercentage:    settings.VigPercentage,
+		RTPOverload:      settings.RTPOverload,
+	}
+}
+
+// settleSelection settles the bet on selectedNumber against the generated
+// boxes: the game's daily exposure cap, the win condition, the bet row and
+// its outcome decision, the payout or loss and the result SMS when notify
+// is set. winAmounts is updated with what the box paid.
+func (s *LuckyNumberService) settleSelection(ctx context.Context, player map[string]interface{}, msisdn string, betAmount float64, selectedNumber, reference string, game database.Game, settings database.Settings, rates taxRates, kpi map[string]interface{}, winAmounts map[string]WinAmount, notify bool) (PlaceBetResultDisplay, error) {
+	// Convert types safely
+	playerID := utils.ToInt64(player["id"])
+	playerLostCount := utils.ToInt64(player["lost_count"])
+	playerFreeBet := utils.ToInt64(player["free_bet"])
+	playerPayout := database.Player(player).Payout()
+	playerTotalBets := database.Player(player).TotalBets()
+	playerTotalLosses := database.Player(player).TotalLosses()
+	defaultRTP := settings.DefaultRTP
+	adjustmentableRTP := settings.AdjustableRTP
+
+	kpiPayout := utils.ToFloat64(kpi["payout"])
+	kpiBet := utils.ToFloat64(kpi["bet"])
+	kpiRTP := utils.ToFloat64(kpi["rtp"])
+
+	winAmount, exists := winAmounts[selectedNumber]
+	if !exists {
+		logrus.Errorf("Selected number %s not found in winAmounts: %v", selectedNumber, winAmounts)
+		return PlaceBetResultDisplay{}, fmt.Errorf("selected number %s not found in win amounts", selectedNumber)
+	}
+
+	// Random increment calculation
+	randomIncrement := cryptoRandFloat() * 10 // Random between 0-10
+	increment := (defaultRTP / 100) * randomIncrement
+
+	// Get current RTP and adjust if needed - add safety check
+	currentRTP := s.playerData(playerID, player).CurrentRTP
+	if currentRTP > defaultRTP {
+		currentRTP = defaultRTP + increment
+	}
+	logrus.Infof("Player current RTP: %.2f", currentRTP)
+
+	logrus.Infof("Win amounts: %+v", winAmounts)
+
+	decision := decisionTraceFrom(ctx).decision(selectedNumber)
+	decision.Reference = reference
+	decision.Msisdn = msisdn
+	decision.GameCatID = game.ID
+	decision.Boxes = boxValues(winAmounts)
+
+	// 🔥 Use the safely accessed winAmount instead of direct map access
+	winAmountValue := winAmount.Value
+	winItem := winAmount.Item
+
+	// A win past the game's daily exposure cap pays only what is left of it
+	capped, err := s.capDailyExposure(ctx, game, reference, winAmountValue)
+	if err != nil {
+		return PlaceBetResultDisplay{}, fmt.Errorf("failed to check daily exposure: %w", err)
+	}
+	if capped < winAmountValue {
+		winAmountValue = capped
+		winItem = FormatToMZN(capped)
+		decision.ExposureCapped = true
+	}
+
+	logrus.Infof("Win amount: %.2f", winAmountValue)
+	logrus.Infof("Default RTP: %.2f", defaultRTP)
+	logrus.Infof("Player RTP: %.2f", utils.ToFloat64(player["rtp"]))
+	// Calculate current RTP for the day - add division by zero check
+	var currentRTPDay float64
+
+	logrus.Infof("kpiBet payout: %.2f", kpiBet)
+
+	logrus.Infof("KPI payout: %.2f", kpiPayout)
+
+	logrus.Infof("sum currentRTPDay: %.2f", winAmountValue+kpiPayout)
+
+	currentRTPDay = database.RTP(kpiPayout+winAmountValue, kpiBet)
+	if kpiBet <= 0 {
+		logrus.Warn("kpiBet is zero, cannot calculate RTP")
+	}
+
+	basket, err := s.db.CheckBasketLucky(ctx)
+
+	if err != nil {
+		return PlaceBetResultDisplay{}, fmt.Errorf("failed to fetch baskets: %w", err)
+	}
+
+	basketValue := utils.ToFloat64(basket["amount"])
+
+	logrus.Infof("Default RTP: %.2f", defaultRTP)
+	logrus.Infof("Player RTP: %.2f", utils.ToFloat64(player["rtp"]))
+	logrus.Infof("Global RTP: %.2f", utils.ToFloat64(player["rtp"])) // Assuming rtp_player is same
+	logrus.Infof("Current RTP: %.2f", kpiRTP)
+	logrus.Infof("Current RTP Day: %.2f", currentRTPDay)
+	logrus.Infof("Player lost count: %d", playerLostCount)
+	logrus.Infof("Basket value: %.2f", basketValue)
+	logrus.Infof("Win amount: %.2f", winAmountValue)
+
+	var crtp = math.Round(currentRTPDay*100) / 100
+
+	logrus.Infof("Win amount RTP: %.2f", crtp)
+
+	logrus.Infof("Win amount RTP: %.2f", (defaultRTP + adjustmentableRTP))
+	// Win condition. A basket too low to cover the win does not turn it into
+	// a loss: the win stands and win() holds the payout.
+	if basketValue < winAmountValue {
+		logrus.Warnf("Basket %.2f below win amount %.2f for %s", basketValue, winAmountValue, reference)
+	}
+	if winStands(winAmountValue, defaultRTP, adjustmentableRTP, kpiPayout, kpiBet) {
+		// Player wins
+		resultMessage := fmt.Sprintf("Box %s wins. Numbers: %+v", selectedNumber, winAmounts)
+		logrus.Info(resultMessage)
+
+		if err := s.advanceRound(ctx, reference, database.RoundSettled, actorGame, fmt.Sprintf("win %.2f on box %s", winAmountValue, selectedNumber)); err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Update bet as win
+		_, err := s.db.UpdateLuckyBetWin(ctx, resultMessage, "PAWABOX", reference, winAmountValue, status.ResultWin)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to update lucky bet win: %w", err)
+		}
+		if err := s.recordDecision(ctx, decision, status.ResultWin, winAmountValue); err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Calculate tax
+		tax := taxcalc.Withholding(winAmountValue, rates.Withholding)
+		withholdTax, taxDeductedAmount := tax.TaxAmount, tax.NetAmount
+
+		// Update KPI payouts
+		_, err = s.db.UpdateKPIPayouts(ctx, winAmountValue, withholdTax, 0)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to update KPI payouts: %w", err)
+		}
+		if _, err := s.db.AddGameDailyExposure(ctx, game.ID, winAmountValue); err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to update daily exposure: %w", err)
+		}
+
+		// Update win amounts with tax deducted values - SAFELY
+		winAmounts[selectedNumber] = WinAmount{
+			Value: taxDeductedAmount,
+			Item:  FormatToMZN(taxDeductedAmount),
+		}
+
+		// Handle win logic
+		delayed, err := s.win(ctx, playerID, playerPayout, playerTotalBets, winItem, tax, msisdn, reference)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to handle win: %w", err)
+		}
+
+		// Round amounts
+		withholdTax = math.Round(withholdTax)
+		taxDeductedAmount = math.Round(taxDeductedAmount)
+
+		// Create win message
+		messageKey := TemplateWin
+		if delayed {
+			messageKey = TemplateWinDelayed
+		}
+		message := s.createWinMessage(ctx, messageKey, utils.ToString(player["language"]), selectedNumber, winAmounts, playerFreeBet, reference, tax)
+		logrus.Infof("Player MSISDN: %s", msisdn)
+
+		resultd, err := s.ResultDisplay(selectedNumber, winAmounts, playerFreeBet, reference)
+		if err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Queue SMS; a parcel sends one summary instead
+		if notify {
+			s.notifyResult(ctx, player, msisdn, reference, message)
+		}
+
+		// Update RTP
+		_, err = s.db.UpdateHouseLucyNumberHouseCurrentRTP(ctx)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to update RTP: %w", err)
+		}
+
+		s.recordSettledBet(playerID, player, betAmount, winAmountValue)
+
+		logrus.Infof("Player %s won: %.2f (tax: %.2f)", msisdn, taxDeductedAmount, withholdTax)
+
+		var boxes map[string]WinAmount
+		if err := json.Unmarshal([]byte(resultd), &boxes); err != nil {
+			logrus.Errorf("Failed to unmarshal Boxes JSON: %v", err)
+			return PlaceBetResultDisplay{}, err
+		}
+		mresult := PlaceBetResultDisplay{
+			Boxes:         boxes,
+			ResultStatus:  status.ResultWin,
+			WinAmount:     winAmountValue,
+			JackPot:       "False",
+			GameID:        reference,
+			SelectedBox:   selectedNumber,
+			ResultMessage: message,
+			GrossAmount:   tax.GrossAmount,
+			TaxAmount:     withholdTax,
+			NetAmount:     taxDeductedAmount,
+			PayoutDelayed: delayed,
+		}
+
+		return mresult, nil
+
+	} else {
+		// Player loses - SAFELY update
+		winAmounts[selectedNumber] = WinAmount{
+			Value: 0,
+			Item:  "0",
+		}
+
+		if err := s.advanceRound(ctx, reference, database.RoundSettled, actorGame, "loss on box "+selectedNumber); err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Handle loss
+		err := s.lose(ctx, playerID, reference, msisdn, playerLostCount, playerTotalLosses, betAmount)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to handle loss: %w", err)
+		}
+
+		// Build loss message
+		resultMessage := fmt.Sprintf("Box %s loses. Numbers: (%+v)", selectedNumber, winAmounts)
+		logrus.Info(resultMessage)
+
+		message := s.createLossMessage(ctx, utils.ToString(player["language"]), selectedNumber, winAmounts, playerFreeBet, reference)
+		logrus.Infof("Player MSISDN: %s", msisdn)
+
+		resultd, err := s.ResultDisplay(selectedNumber, winAmounts, playerFreeBet, reference)
+		if err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Queue SMS; a parcel sends one summary instead
+		if notify {
+			s.notifyResult(ctx, player, msisdn, reference, message)
+		}
+
+		// Update bet as loss
+		_, err = s.db.UpdateLuckyBet(ctx, resultMessage, "PAWABOX", reference, status.ResultLoss)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to update lucky bet: %w", err)
+		}
+		if err := s.recordDecision(ctx, decision, status.ResultLoss, 0); err != nil {
+			return PlaceBetResultDisplay{}, err
+		}
+
+		// Record lost transaction
+		_, err = s.db.InsertB2BWithdrawalB2B(ctx, reference, msisdn, 0, status.B2BLost)
+		if err != nil {
+			return PlaceBetResultDisplay{}, fmt.Errorf("failed to insert B2B withdrawal: %w", err)
+		}
+
+		s.recordSettledBet(playerID, player, betAmount, 0)
+
+		var boxes map[string]WinAmount
+		if err := json.Unmarshal([]byte(resultd), &boxes); err != nil {
+			logrus.Errorf("Failed to unmarshal Boxes JSON: %v", err)
+			return PlaceBetResultDisplay{}, err
+		}
+
+		mresult := PlaceBetResultDisplay{
+			Boxes:         boxes,
+			ResultStatus:  status.ResultLoss,
+			WinAmount:     0,
+			JackPot:       "False",
+			GameID:        reference,
+			SelectedBox:   selectedNumber,
+			ResultMessage: message,
+		}
+
+		logrus.Infof("Player %s lost bet: %.2f", msisdn, betAmount)
+
+		// return struct + nil error
+		return mresult, nil
+	}
+}
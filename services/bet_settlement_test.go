@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/status"
+	"math"
+	"testing"
+)
+
+const testMsisdn = "254712345678"
+
+func placeTestBet(t *testing.T, s *LuckyNumberService, repo *memRepo, amount float64, box string) PlaceBetResult {
+	t.Helper()
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	result, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, amount, box, "web")
+	if err != nil {
+		t.Fatalf("PlaceBet: %v", err)
+	}
+	return result
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 0.005 }
+
+func TestPlaceBetLoss(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 300, "3": 20})
+
+	result := placeTestBet(t, s, repo, 50, "1")
+	if result.GameResult.ResultStatus != status.ResultLoss || result.FreeBet != "false" {
+		t.Fatalf("result = %+v, want a cash loss", result.GameResult)
+	}
+
+	ref := result.GameResult.GameID
+	p := repo.player(testMsisdn)
+	if p.Balance != 50 || p.TotalBets != 50 || p.TotalLosses != 50 || p.LostCount != 1 {
+		t.Errorf("player = %+v, want 50 left, 50 staked and lost", p)
+	}
+	if b := repo.bets[ref]; b == nil || b.Status != status.ResultLoss {
+		t.Errorf("bet %s = %+v, want a loss", ref, b)
+	}
+	if got := repo.rounds[ref]; got != database.RoundSettled {
+		t.Errorf("round = %s, want settled", got)
+	}
+	if repo.decisions[ref] != string(status.ResultLoss) {
+		t.Errorf("decision = %q, want a recorded loss", repo.decisions[ref])
+	}
+	// 90% of the stake feeds the basket, 10% is house income
+	if !near(repo.basket, 100045) || !near(repo.house.Income, 5) || repo.house.TotalBets != 50 {
+		t.Errorf("basket %.2f, house %+v; want 100045 and 5 income on 50 bets", repo.basket, repo.house)
+	}
+	// The 5% jackpot contribution is booked as payout; excise is 12.5% of
+	// the stake in whole shillings
+	if repo.kpi.Handle != 50 || repo.kpi.Payout != 2.5 || repo.kpi.Excise != 6 {
+		t.Errorf("kpi = %+v, want handle 50, payout 2.5 and excise 6", repo.kpi)
+	}
+	if len(repo.queued)+len(repo.pending) != 0 {
+		t.Errorf("a loss queued payouts: %+v %+v", repo.queued, repo.pending)
+	}
+}
+
+func TestPlaceBetWin(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 200, "2": 0, "3": 20})
+
+	result := placeTestBet(t, s, repo, 50, "1")
+	got := result.GameResult
+	if got.ResultStatus != status.ResultWin || got.GrossAmount != 200 || got.TaxAmount != 40 || got.NetAmount != 160 {
+		t.Fatalf("result = %+v, want a 200 win paying 160 after 40 tax", got)
+	}
+
+	ref := got.GameID
+	p := repo.player(testMsisdn)
+	if p.Balance != 50 || p.Payout != 200 || p.LostCount != 0 {
+		t.Errorf("player = %+v, want 50 left and 200 paid", p)
+	}
+	if len(repo.queued) != 1 || repo.queued[0].Amount != 160 || repo.queued[0].Reference != ref {
+		t.Errorf("queued = %+v, want the net 160 of %s", repo.queued, ref)
+	}
+	if !near(repo.basket, 100000+45-200) || repo.house.TotalWins != 200 {
+		t.Errorf("basket %.2f, house %+v; want the 200 win taken from the basket", repo.basket, repo.house)
+	}
+	if got := repo.rounds[ref]; got != database.RoundPaid {
+		t.Errorf("round = %s, want paid", got)
+	}
+	if repo.exposure["1"] != 200 || repo.kpi.Payout != 202.5 || repo.kpi.Withholding != 41 {
+		t.Errorf("exposure %v, kpi %+v; want 200 paid on top of the jackpot share", repo.exposure, repo.kpi)
+	}
+}
+
+func TestPlaceBetInsufficientBalance(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 10)
+	s := newTestService(t, repo, fixedOutcomes{"1": 200})
+
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	_, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, 50, "1", "web")
+	if err == nil {
+		t.Fatal("a stake over the balance was placed")
+	}
+	if p := repo.player(testMsisdn); p.Balance != 10 || p.TotalBets != 0 {
+		t.Errorf("player = %+v, want untouched", p)
+	}
+	if len(repo.bets) != 0 {
+		t.Errorf("bets = %v, want none", repo.betRefs())
+	}
+	for ref, state := range repo.rounds {
+		if state != database.RoundFailed {
+			t.Errorf("round %s = %s, want failed", ref, state)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Why a bet was throttled
+const (
+	ThrottleCooldown = "cooldown" // placed within bet_cooldown_ms of the last one
+	ThrottleRate     = "rate"     // max_bets_per_minute already placed this minute
+)
+
+// BetThrottleError is a bet refused for coming too fast. Wait is how long
+// the player must wait before the next bet is accepted.
+type BetThrottleError struct {
+	Reason string
+	Wait   time.Duration
+}
+
+func (e *BetThrottleError) Error() string {
+	if e.Reason == ThrottleRate {
+		return fmt.Sprintf("too many bets this minute, retry in %s", e.Wait.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("bet placed too soon after the last one, retry in %s", e.Wait.Round(time.Millisecond))
+}
+
+// RetrySeconds is Wait in whole seconds, rounded up, for Retry-After
+func (e *BetThrottleError) RetrySeconds() int64 {
+	return int64((e.Wait + time.Second - 1) / time.Second)
+}
+
+// Code is the error's message code in the i18n catalog
+func (e *BetThrottleError) Code() string {
+	if e.Reason == ThrottleRate {
+		return "bet_rate_limit"
+	}
+	return "bet_cooldown"
+}
+
+// betPace is how fast the settings let a player bet; 0 disables either
+type betPace struct {
+	cooldown  time.Duration
+	perMinute int
+}
+
+func betPaceOf(settings database.Settings) betPace {
+	return betPace{
+		cooldown:  time.Duration(settings.BetCooldownMS) * time.Millisecond,
+		perMinute: settings.MaxBetsPerMinute,
+	}
+}
+
+func (p betPace) off() bool {
+	return p.cooldown <= 0 && p.perMinute <= 0
+}
+
+// betWindow is one player's counted bets: the last one, and how many were
+// placed in the minute from start
+type betWindow struct {
+	last  time.Time
+	start time.Time
+	count int
+}
+
+// wait returns how long after now the next bet is accepted, 0 when it is
+// accepted now, and why
+func (w betWindow) wait(now time.Time, pace betPace) (time.Duration, string) {
+	var wait time.Duration
+	reason := ""
+	if d := w.last.Add(pace.cooldown).Sub(now); pace.cooldown > 0 && d > 0 {
+		wait, reason = d, ThrottleCooldown
+	}
+	if pace.perMinute > 0 && now.Sub(w.start) < time.Minute && w.count >= pace.perMinute {
+		if d := w.start.Add(time.Minute).Sub(now); d > wait {
+			wait, reason = d, ThrottleRate
+		}
+	}
+	return wait, reason
+}
+
+// counted returns the window once a bet at now is counted in it
+func (w betWindow) counted(now time.Time) betWindow {
+	if now.Sub(w.start) >= time.Minute {
+		w.start, w.count = now, 0
+	}
+	w.last = now
+	w.count++
+	return w
+}
+
+// betThrottle counts players' bets for limits.bet_throttle_store. admit
+// counts a bet of msisdn's, or returns a *BetThrottleError without counting
+// it.
+type betThrottle interface {
+	admit(ctx context.Context, msisdn string, pace betPace) error
+}
+
+func newBetThrottle(store string, db database.LuckyRepo) betThrottle {
+	if store == config.BetThrottleDatabase {
+		return &dbThrottle{db: db}
+	}
+	return &memoryThrottle{windows: make(map[string]betWindow)}
+}
+
+// memoryThrottle counts the bets this process places
+type memoryThrottle struct {
+	mu      sync.Mutex
+	windows map[string]betWindow
+	swept   time.Time
+}
+
+func (t *memoryThrottle) admit(_ context.Context, msisdn string, pace betPace) error {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Forget players whose window and cooldown have both run out
+	if now.Sub(t.swept) >= time.Minute {
+		idle := max(pace.cooldown, time.Minute)
+		for key, w := range t.windows {
+			if now.Sub(w.last) >= idle {
+				delete(t.windows, key)
+			}
+		}
+		t.swept = now
+	}
+
+	w := t.windows[msisdn]
+	if wait, reason := w.wait(now, pace); wait > 0 {
+		return &BetThrottleError{Reason: reason, Wait: wait}
+	}
+	t.windows[msisdn] = w.counted(now)
+	return nil
+}
+
+// dbThrottle counts bets in the bet_throttle table, shared by every process
+type dbThrottle struct {
+	db database.LuckyRepo
+}
+
+func (t *dbThrottle) admit(ctx context.Context, msisdn string, pace betPace) error {
+	admitted, row, err := t.db.AdmitBet(ctx, msisdn, pace.cooldown, pace.perMinute)
+	if err != nil || admitted || row == nil {
+		return err
+	}
+	w := betWindow{count: utils.ToInt(row["window_count"])}
+	w.last, _ = row["last_bet_at"].(time.Time)
+	w.start, _ = row["window_start"].(time.Time)
+	now, _ := row["now"].(time.Time)
+	wait, reason := w.wait(now, pace)
+	if wait <= 0 {
+		// The window ran out between the two statements
+		wait, reason = time.Millisecond, ThrottleCooldown
+	}
+	return &BetThrottleError{Reason: reason, Wait: wait}
+}
+
+// checkBetPace returns a *BetThrottleError when msisdn bets faster than the
+// settings' bet_cooldown_ms and max_bets_per_minute allow, and counts the
+// bet otherwise. Balance-funded bets call it before any money moves. The
+// settings or the store failing does not stop play.
+func (s *LuckyNumberService) checkBetPace(ctx context.Context, msisdn string) error {
+	settings, err := s.settings(ctx)
+	if err != nil {
+		logrus.Errorf("bet throttle: failed to load settings: %v", err)
+		return nil
+	}
+	pace := betPaceOf(settings)
+	if pace.off() {
+		return nil
+	}
+	err = s.throttle.admit(ctx, msisdn, pace)
+	var throttled *BetThrottleError
+	switch {
+	case errors.As(err, &throttled):
+		logrus.Infof("bet throttle: %s refused: %v", utils.RedactMsisdn(msisdn), err)
+		return err
+	case err != nil:
+		logrus.Errorf("bet throttle: %v", err)
+	}
+	return nil
+}
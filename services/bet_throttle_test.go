@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/status"
+	"testing"
+	"time"
+)
+
+func TestBetWindowWait(t *testing.T) {
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	pace := betPace{cooldown: time.Second, perMinute: 3}
+
+	var w betWindow
+	if wait, _ := w.wait(start, pace); wait != 0 {
+		t.Errorf("first bet waits %v, want none", wait)
+	}
+	w = w.counted(start)
+	if wait, reason := w.wait(start.Add(400*time.Millisecond), pace); wait != 600*time.Millisecond || reason != ThrottleCooldown {
+		t.Errorf("0.4s later = %v %s, want 0.6s of cooldown", wait, reason)
+	}
+	w = w.counted(start.Add(time.Second))
+	w = w.counted(start.Add(2 * time.Second))
+	if wait, reason := w.wait(start.Add(10*time.Second), pace); wait != 50*time.Second || reason != ThrottleRate {
+		t.Errorf("fourth bet in the minute = %v %s, want 50s to the window's end", wait, reason)
+	}
+	if wait, _ := w.wait(start.Add(time.Minute), pace); wait != 0 {
+		t.Errorf("next minute waits %v, want none", wait)
+	}
+	if w = w.counted(start.Add(time.Minute)); w.count != 1 || !w.start.Equal(start.Add(time.Minute)) {
+		t.Errorf("window = %+v, want a new one started", w)
+	}
+}
+
+func TestMemoryThrottle(t *testing.T) {
+	ctx := context.Background()
+	th := newBetThrottle("memory", nil)
+	pace := betPace{cooldown: 30 * time.Millisecond}
+
+	if err := th.admit(ctx, testMsisdn, pace); err != nil {
+		t.Fatal(err)
+	}
+	var throttled *BetThrottleError
+	if err := th.admit(ctx, testMsisdn, pace); !errors.As(err, &throttled) || throttled.Reason != ThrottleCooldown ||
+		throttled.Wait <= 0 || throttled.Wait > 30*time.Millisecond || throttled.RetrySeconds() != 1 || throttled.Code() != "bet_cooldown" {
+		t.Fatalf("bet straight after = %v, want a cooldown", err)
+	}
+	if err := th.admit(ctx, "254700000002", pace); err != nil {
+		t.Errorf("another player = %v, want admitted", err)
+	}
+	time.Sleep(35 * time.Millisecond)
+	if err := th.admit(ctx, testMsisdn, pace); err != nil {
+		t.Errorf("after the cooldown = %v, want admitted", err)
+	}
+
+	pace = betPace{perMinute: 2}
+	th = newBetThrottle("memory", nil)
+	for i := 0; i < 2; i++ {
+		if err := th.admit(ctx, testMsisdn, pace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := th.admit(ctx, testMsisdn, pace); !errors.As(err, &throttled) || throttled.Reason != ThrottleRate || throttled.Code() != "bet_rate_limit" {
+		t.Errorf("third bet in the minute = %v, want the rate limit", err)
+	}
+}
+
+// throttleRepo answers AdmitBet as the bet_throttle table does for a
+// player who bet 200ms ago
+type throttleRepo struct {
+	*memRepo
+	admitted bool
+	err      error
+}
+
+func (r *throttleRepo) AdmitBet(ctx context.Context, msisdn string, cooldown time.Duration, perMinute int) (bool, map[string]interface{}, error) {
+	if r.err != nil || r.admitted {
+		return r.admitted, nil, r.err
+	}
+	now := time.Now()
+	return false, map[string]interface{}{"last_bet_at": now.Add(-200 * time.Millisecond),
+		"window_start": now.Add(-10 * time.Second), "window_count": int32(1), "now": now}, nil
+}
+
+func TestDatabaseThrottle(t *testing.T) {
+	repo := &throttleRepo{memRepo: newMemRepo()}
+	th := newBetThrottle("database", repo)
+	var throttled *BetThrottleError
+	if err := th.admit(context.Background(), testMsisdn, betPace{cooldown: time.Second}); !errors.As(err, &throttled) ||
+		throttled.Reason != ThrottleCooldown || throttled.Wait != 800*time.Millisecond {
+		t.Errorf("refused = %v, want the 0.8s left of the cooldown from the stored row", err)
+	}
+	repo.admitted = true
+	if err := th.admit(context.Background(), testMsisdn, betPace{cooldown: time.Second}); err != nil {
+		t.Errorf("admitted = %v", err)
+	}
+
+	// The store failing does not stop play
+	repo.err = errors.New("bet_throttle: connection reset")
+	repo.settings.BetCooldownMS = 1000
+	s := newTestService(t, repo, nil)
+	s.throttle = th
+	if err := s.checkBetPace(context.Background(), testMsisdn); err != nil {
+		t.Errorf("pace with the store down = %v, want the bet let through", err)
+	}
+}
+
+func TestPlaceBetThrottled(t *testing.T) {
+	repo := &throttleRepo{memRepo: newMemRepo()}
+	repo.settings.BetCooldownMS = 60000
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+
+	placeTestBet(t, s, repo.memRepo, 20, "1")
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	var throttled *BetThrottleError
+	if _, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, 20, "1", "web"); !errors.As(err, &throttled) {
+		t.Fatalf("second bet within the cooldown = %v, want a *BetThrottleError", err)
+	}
+	if p := repo.player(testMsisdn); p.Balance != 80 || p.Frequency != 1 || len(repo.bets) != 1 {
+		t.Errorf("player = %+v with %d bets, want only the first bet's money moved", p, len(repo.bets))
+	}
+
+	// The settings are what turn it on: without them every bet goes through
+	repo.settings.BetCooldownMS = 0
+	s = newTestService(t, repo, fixedOutcomes{"1": 0})
+	for i := 0; i < 3; i++ {
+		placeTestBet(t, s, repo.memRepo, 10, "1")
+	}
+}
+
+// farmRepo records each bet's branch and whether the forced win was
+// withheld, and counts a fixed number of deposits in any streak
+type farmRepo struct {
+	*memRepo
+	deposits int64
+	branch   map[string]string
+	blocked  map[string]bool
+}
+
+func (r *farmRepo) CountDepositsSince(ctx context.Context, msisdn string, since time.Time) (int64, error) {
+	return r.deposits, nil
+}
+
+func (r *farmRepo) InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error {
+	var d OutcomeDecision
+	if err := json.Unmarshal(decision, &d); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.branch[reference], r.blocked[reference] = branch, d.Params.ForceWinBlocked
+	r.mu.Unlock()
+	return r.memRepo.InsertOutcomeDecision(ctx, reference, msisdn, gameCatID, branch, result, amount, decision)
+}
+
+func TestForcedWinNeedsStreakAgeOrDeposits(t *testing.T) {
+	cases := []struct {
+		name     string
+		age      time.Duration
+		deposits int64
+		minSecs  int64
+		minDep   int64
+		force    bool
+	}{
+		{"farmed in seconds", 10 * time.Second, 0, 120, 2, false},
+		{"one deposit", 10 * time.Second, 1, 120, 2, false},
+		{"long streak", 200 * time.Second, 0, 120, 2, true},
+		{"funded streak", 10 * time.Second, 2, 120, 2, true},
+		{"rule off", 10 * time.Second, 0, 0, 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &farmRepo{memRepo: newMemRepo(), deposits: tc.deposits, branch: map[string]string{}, blocked: map[string]bool{}}
+			repo.settings.ForcedWinMinStreakSecs, repo.settings.ForcedWinMinDeposits = tc.minSecs, tc.minDep
+			p := repo.addPlayer(testMsisdn, 100)
+			p.LostCount = int64(repo.settings.MinLossCount + 10)
+			p.LostSince = time.Now().Add(-tc.age)
+			repo.kpi.Handle = 100000 // a day far below the RTP target
+			s := newTestService(t, repo, nil)
+
+			result := placeTestBet(t, s, repo.memRepo, 20, "1")
+			ref := result.GameResult.GameID
+			if forced := repo.branch[ref] == BranchForceWin; forced != tc.force {
+				t.Errorf("branch = %s, want forced %t", repo.branch[ref], tc.force)
+			}
+			if repo.blocked[ref] == tc.force {
+				t.Errorf("force_win_blocked = %t, want %t", repo.blocked[ref], !tc.force)
+			}
+			if tc.force && result.GameResult.ResultStatus != status.ResultWin {
+				t.Errorf("result = %s, want the forced win paid", result.GameResult.ResultStatus)
+			}
+		})
+	}
+}
+
+func TestLossStreakStartsOnFirstLoss(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+
+	before := time.Now()
+	placeTestBet(t, s, repo, 10, "1")
+	first := repo.player(testMsisdn).LostSince
+	if first.Before(before) {
+		t.Fatalf("lost_since = %v, want set by the first loss", first)
+	}
+	placeTestBet(t, s, repo, 10, "1")
+	if p := repo.player(testMsisdn); !p.LostSince.Equal(first) || p.LostCount != 2 {
+		t.Errorf("after a second loss = %v (%d), want the streak's start kept", p.LostSince, p.LostCount)
+	}
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// timingStage is a part of a bet or deposit settlement BetTiming times
+type timingStage int
+
+const (
+	stageQueue      timingStage = iota // waiting for a play slot and the service lock
+	stageSettings                      // settings, game, KPI and house reads
+	stageAccounting                    // stake, round, ledger and KPI writes
+	stageOutcome                       // drawing the boxes and settling the win or loss
+	stageSMS                           // queueing the result or deposit SMS
+	numStages
+)
+
+var stageNames = [numStages]string{"queue", "settings_fetch", "accounting", "outcome", "sms"}
+
+// timingFlow is what a BetTiming timed
+type timingFlow int
+
+const (
+	flowBet     timingFlow = iota // a bet, including one funded by its STK
+	flowDeposit                   // SettleDeposit
+	numFlows
+)
+
+var flowNames = [numFlows]string{"bet", "deposit"}
+
+// slowBet is the total above which a timed bet or deposit is logged with
+// its breakdown; 0 logs none
+var slowBet time.Duration
+
+// ConfigureBetTiming sets the slow bet log threshold
+func ConfigureBetTiming(threshold time.Duration) {
+	slowBet = threshold
+}
+
+// BetTiming accumulates how long each stage of one bet or deposit took.
+// It is carried by pointer in the context and holds no maps, so timing
+// every bet stays cheap. Methods on a nil *BetTiming do nothing.
+type BetTiming struct {
+	flow      timingFlow
+	reference string
+	start     time.Time
+	mark      time.Time
+	nested    time.Duration // stages timed inside the running lap
+	stages    [numStages]time.Duration
+	total     time.Duration
+}
+
+type timingKey struct{}
+
+// withTiming starts timing flow under the returned context
+func withTiming(ctx context.Context, flow timingFlow) (context.Context, *BetTiming) {
+	now := time.Now()
+	t := &BetTiming{flow: flow, start: now, mark: now}
+	return context.WithValue(ctx, timingKey{}, t), t
+}
+
+// timingFrom returns the BetTiming of ctx, nil when ctx is not timed
+func timingFrom(ctx context.Context) *BetTiming {
+	t, _ := ctx.Value(timingKey{}).(*BetTiming)
+	return t
+}
+
+// lap books the time since the previous lap to stage, less the stages
+// timed inside it with took
+func (t *BetTiming) lap(stage timingStage) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.stages[stage] += now.Sub(t.mark) - t.nested
+	t.mark, t.nested = now, 0
+}
+
+// took books the time since start to stage from inside a lap, e.g. the
+// result SMS queued while the outcome is settled
+func (t *BetTiming) took(stage timingStage, start time.Time) {
+	if t == nil {
+		return
+	}
+	d := time.Since(start)
+	t.stages[stage] += d
+	t.nested += d
+}
+
+// add books d to stage without taking it off the running lap, for a stage
+// that ran alongside it
+func (t *BetTiming) add(stage timingStage, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.stages[stage] += d
+}
+
+func (t *BetTiming) setReference(reference string) {
+	if t == nil {
+		return
+	}
+	t.reference = reference
+}
+
+// finish stops the clock, records the stages in the histograms and logs a
+// slow bet. It returns the breakdown, nil for a nil t.
+func (t *BetTiming) finish() *TimingBreakdown {
+	if t == nil {
+		return nil
+	}
+	t.total = time.Since(t.start)
+	h := &timingHistograms[t.flow]
+	for stage, d := range t.stages {
+		h[stage].observe(d)
+	}
+	h[numStages].observe(t.total)
+
+	b := t.breakdown()
+	if slowBet > 0 && t.total >= slowBet {
+		logrus.WithFields(logrus.Fields{
+			"flow":              flowNames[t.flow],
+			"reference":         t.reference,
+			"queue_ms":          b.QueueMs,
+			"settings_fetch_ms": b.SettingsFetchMs,
+			"accounting_ms":     b.AccountingMs,
+			"outcome_ms":        b.OutcomeMs,
+			"sms_ms":            b.SMSMs,
+			"total_ms":          b.TotalMs,
+		}).Warn("slow bet")
+	}
+	return &b
+}
+
+// TimingBreakdown is a finished BetTiming in milliseconds. The stages add
+// up to about TotalMs, except that a deposit queues its SMS alongside the
+// accounting writes.
+type TimingBreakdown struct {
+	QueueMs         float64 `json:"queue_ms"`
+	SettingsFetchMs float64 `json:"settings_fetch_ms"`
+	AccountingMs    float64 `json:"accounting_ms"`
+	OutcomeMs       float64 `json:"outcome_ms"`
+	SMSMs           float64 `json:"sms_ms"`
+	TotalMs         float64 `json:"total_ms"`
+}
+
+func (t *BetTiming) breakdown() TimingBreakdown {
+	ms := func(d time.Duration) float64 { return round2(float64(d) / float64(time.Millisecond)) }
+	return TimingBreakdown{
+		QueueMs:         ms(t.stages[stageQueue]),
+		SettingsFetchMs: ms(t.stages[stageSettings]),
+		AccountingMs:    ms(t.stages[stageAccounting]),
+		OutcomeMs:       ms(t.stages[stageOutcome]),
+		SMSMs:           ms(t.stages[stageSMS]),
+		TotalMs:         ms(t.total),
+	}
+}
+
+// timingBuckets are the histogram upper bounds in seconds
+var timingBuckets = [...]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// stageHistogram counts observations per bucket, the last being +Inf
+type stageHistogram struct {
+	counts [len(timingBuckets) + 1]atomic.Uint64
+	sum    atomic.Int64 // nanoseconds
+}
+
+func (h *stageHistogram) observe(d time.Duration) {
+	secs := d.Seconds()
+	i := 0
+	for i < len(timingBuckets) && secs > timingBuckets[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+// timingHistograms holds one histogram per flow and stage, plus the total
+var timingHistograms [numFlows][numStages + 1]stageHistogram
+
+// WriteBetTimingMetrics writes the stage histograms in the Prometheus text
+// format
+func WriteBetTimingMetrics(w io.Writer) {
+	const name = "pawabox_bet_stage_seconds"
+	fmt.Fprintf(w, "# HELP %s Time a bet or deposit settlement spent in each stage.\n# TYPE %s histogram\n", name, name)
+	for flow := range timingHistograms {
+		for stage := range timingHistograms[flow] {
+			stageName := "total"
+			if stage < int(numStages) {
+				stageName = stageNames[stage]
+			}
+			labels := fmt.Sprintf("flow=%q,stage=%q", flowNames[flow], stageName)
+			h := &timingHistograms[flow][stage]
+
+			var count uint64
+			for i := range h.counts {
+				count += h.counts[i].Load()
+				le := "+Inf"
+				if i < len(timingBuckets) {
+					le = fmt.Sprintf("%g", timingBuckets[i])
+				}
+				fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, labels, le, count)
+			}
+			fmt.Fprintf(w, "%s_sum{%s} %g\n", name, labels, time.Duration(h.sum.Load()).Seconds())
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, count)
+		}
+	}
+}
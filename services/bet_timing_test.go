@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func stageSum(b *TimingBreakdown) float64 {
+	return b.QueueMs + b.SettingsFetchMs + b.AccountingMs + b.OutcomeMs + b.SMSMs
+}
+
+func TestBetTimingStagesSumToTotal(t *testing.T) {
+	_, timing := withTiming(context.Background(), flowBet)
+	time.Sleep(5 * time.Millisecond)
+	timing.lap(stageQueue)
+	time.Sleep(5 * time.Millisecond)
+	timing.lap(stageSettings)
+	smsStart := time.Now()
+	time.Sleep(20 * time.Millisecond)
+	timing.took(stageSMS, smsStart)
+	time.Sleep(5 * time.Millisecond)
+	timing.lap(stageOutcome)
+	b := timing.finish()
+
+	if b.QueueMs < 5 || b.SettingsFetchMs < 5 || b.SMSMs < 20 || b.OutcomeMs < 5 {
+		t.Errorf("breakdown %+v, want each slept stage at least its sleep", b)
+	}
+	// The SMS queued inside the outcome lap is not counted twice
+	if b.OutcomeMs >= 20 {
+		t.Errorf("outcome %vms still holds the nested sms %vms", b.OutcomeMs, b.SMSMs)
+	}
+	if sum := stageSum(b); sum > b.TotalMs+0.05 || sum < b.TotalMs-1 {
+		t.Errorf("stages sum to %vms, total %vms", sum, b.TotalMs)
+	}
+}
+
+func TestPlaceBetTimingSumsToTotal(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 30})
+	for _, box := range []string{"1", "2"} {
+		b := placeTestBet(t, s, repo, 10, box).Timing
+		if b == nil {
+			t.Fatalf("box %s: no timing", box)
+		}
+		if sum := stageSum(b); sum > b.TotalMs+0.05 || sum < b.TotalMs-1 {
+			t.Errorf("box %s: stages sum to %vms, total %vms", box, sum, b.TotalMs)
+		}
+	}
+}
+
+func TestNilBetTimingIsSafe(t *testing.T) {
+	var timing *BetTiming
+	timing.lap(stageQueue)
+	timing.took(stageSMS, time.Now())
+	timing.add(stageSMS, time.Millisecond)
+	timing.setReference("REF")
+	if timing.finish() != nil {
+		t.Error("nil timing finished with a breakdown")
+	}
+	if timingFrom(context.Background()) != nil {
+		t.Error("untimed context has a timing")
+	}
+}
+
+func TestSlowBetLogged(t *testing.T) {
+	defer ConfigureBetTiming(slowBet)
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	out, formatter := logger.Out, logger.Formatter
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	defer func() { logger.SetOutput(out); logger.SetFormatter(formatter) }()
+
+	ConfigureBetTiming(time.Hour)
+	_, fast := withTiming(context.Background(), flowBet)
+	fast.finish()
+	if buf.Len() != 0 {
+		t.Errorf("fast bet logged: %s", buf.String())
+	}
+
+	ConfigureBetTiming(time.Millisecond)
+	_, slow := withTiming(context.Background(), flowDeposit)
+	slow.setReference("DEP1")
+	time.Sleep(2 * time.Millisecond)
+	slow.lap(stageAccounting)
+	slow.finish()
+	for _, want := range []string{`"msg":"slow bet"`, `"flow":"deposit"`, `"reference":"DEP1"`, `"accounting_ms"`, `"total_ms"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("slow bet log %s, want %s", buf.String(), want)
+		}
+	}
+}
+
+func TestBetTimingMetrics(t *testing.T) {
+	_, timing := withTiming(context.Background(), flowDeposit)
+	timing.finish()
+
+	var buf bytes.Buffer
+	WriteBetTimingMetrics(&buf)
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE pawabox_bet_stage_seconds histogram",
+		`pawabox_bet_stage_seconds_bucket{flow="deposit",stage="settings_fetch",le="0.005"}`,
+		`pawabox_bet_stage_seconds_bucket{flow="bet",stage="total",le="+Inf"}`,
+		`pawabox_bet_stage_seconds_count{flow="deposit",stage="sms"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
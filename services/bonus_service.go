@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/money"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrBonusAmount = errors.New("bonus amount must be positive")
+
+// BonusGrant is one bonus and how far its wagering requirement has got
+type BonusGrant struct {
+	ID               int64     `json:"id"`
+	Amount           float64   `json:"amount"`
+	Balance          float64   `json:"balance"`
+	WageringRequired float64   `json:"wagering_required"`
+	Wagered          float64   `json:"wagered"`
+	Progress         float64   `json:"progress"` // percent of the requirement met
+	Status           string    `json:"status"`
+	Source           string    `json:"source"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	DateCreated      time.Time `json:"date_created"`
+}
+
+// WalletSummary is the player's cash and bonus wallets
+type WalletSummary struct {
+	Balance             float64      `json:"balance"`
+	Bonus               float64      `json:"bonus"`
+	BonusTurnedIntoCash float64      `json:"bonus_turn_into_real_money"`
+	BonusFirst          bool         `json:"bonus_first"`
+	Grants              []BonusGrant `json:"grants"`
+}
+
+// GrantBonus credits amount to msisdn's bonus wallet until expiresAt. It
+// converts to cash after limits.bonus_wagering times amount has been staked.
+// An amount outside the adjustment limits returns ErrBonusAmount.
+func (s *LuckyNumberService) GrantBonus(msisdn string, amount float64, expiresAt time.Time, source, reference string) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+	if err := money.Check(money.Adjustment, amount); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrBonusAmount, err)
+	}
+
+	ctx := context.Background()
+	player, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		return 0, err
+	}
+	if player == nil {
+		return 0, ErrPlayerNotFound
+	}
+
+	id, err := s.db.GrantBonus(ctx, msisdn, amount, amount*limits.BonusWagering, expiresAt, source, reference)
+	if err != nil {
+		return 0, err
+	}
+	logrus.Infof("bonus: granted Ksh.%.2f to %s (grant=%d, source=%s)", amount, msisdn, id, source)
+	return id, nil
+}
+
+// WalletSummary returns both balances and the progress of active grants.
+// Grants past their expiry are forfeited first so the bonus shown is spendable.
+func (s *LuckyNumberService) WalletSummary(msisdn string) (WalletSummary, error) {
+	if s == nil || s.db == nil {
+		return WalletSummary{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := s.db.ExpireBonusGrants(ctx, msisdn); err != nil {
+		logrus.Errorf("bonus: expire grants for %s failed: %v", msisdn, err)
+	}
+
+	player, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		return WalletSummary{}, err
+	}
+	if player == nil {
+		return WalletSummary{}, fmt.Errorf("user not found")
+	}
+	rows, err := s.db.ListBonusGrants(ctx, msisdn, true)
+	if err != nil {
+		return WalletSummary{}, err
+	}
+
+	summary := WalletSummary{
+		Balance:             utils.NumericFloat(player["balance"]),
+		Bonus:               utils.NumericFloat(player["bonus"]),
+		BonusTurnedIntoCash: utils.NumericFloat(player["bonus_turn_into_real_money"]),
+		BonusFirst:          limits.BonusFirst,
+		Grants:              make([]BonusGrant, 0, len(rows)),
+	}
+	for _, row := range rows {
+		g := BonusGrant{
+			ID:               utils.ToInt64(row["id"]),
+			Amount:           utils.ToFloat64(row["amount"]),
+			Balance:          utils.ToFloat64(row["balance"]),
+			WageringRequired: utils.ToFloat64(row["wagering_required"]),
+			Wagered:          utils.ToFloat64(row["wagered"]),
+			Status:           utils.ToString(row["status"]),
+			Source:           utils.ToString(row["source"]),
+			Progress:         100,
+		}
+		if g.WageringRequired > 0 && g.Wagered < g.WageringRequired {
+			g.Progress = round(g.Wagered / g.WageringRequired * 100)
+		}
+		g.ExpiresAt, _ = row["expires_at"].(time.Time)
+		g.DateCreated, _ = row["date_created"].(time.Time)
+		summary.Grants = append(summary.Grants, g)
+	}
+	return summary, nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Campaign reward types
+const (
+	RewardFreeBet = "free_bet"
+	RewardBonus   = "bonus"
+)
+
+const defaultRewardValidityHours = 24
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	ErrInvalidCampaign  = errors.New("invalid campaign")
+)
+
+// Campaign is a deposit-threshold promotion as managed by admins
+type Campaign struct {
+	ID                    int64     `json:"id"`
+	Name                  string    `json:"name"`
+	MinDeposit            float64   `json:"min_deposit"`
+	RewardType            string    `json:"reward_type"`
+	RewardAmount          float64   `json:"reward_amount"`
+	RewardValidityHours   int       `json:"reward_validity_hours"`
+	StartDate             time.Time `json:"start_date"`
+	EndDate               time.Time `json:"end_date"`
+	MaxRedemptionsPerUser int       `json:"max_redemptions_per_user"`
+	Status                string    `json:"status"`
+}
+
+// Promotion is the public view of an active campaign
+type Promotion struct {
+	Name         string    `json:"name"`
+	MinDeposit   float64   `json:"min_deposit"`
+	RewardType   string    `json:"reward_type"`
+	RewardAmount float64   `json:"reward_amount"`
+	EndDate      time.Time `json:"end_date"`
+}
+
+// Validate checks a campaign before it is created or updated
+func (c Campaign) Validate() error {
+	var problems []string
+	if strings.TrimSpace(c.Name) == "" {
+		problems = append(problems, "name is required")
+	}
+	if c.RewardType != RewardFreeBet && c.RewardType != RewardBonus {
+		problems = append(problems, "reward_type must be free_bet or bonus")
+	}
+	if c.MinDeposit <= 0 {
+		problems = append(problems, "min_deposit must be positive")
+	}
+	if c.RewardAmount <= 0 {
+		problems = append(problems, "reward_amount must be positive")
+	}
+	if c.RewardValidityHours < 0 {
+		problems = append(problems, "reward_validity_hours must not be negative")
+	}
+	if c.MaxRedemptionsPerUser < 1 {
+		problems = append(problems, "max_redemptions_per_user must be at least 1")
+	}
+	if c.StartDate.IsZero() || c.EndDate.IsZero() || !c.EndDate.After(c.StartDate) {
+		problems = append(problems, "end_date must be after start_date")
+	}
+	if c.Status != "" && c.Status != "active" && c.Status != "paused" {
+		problems = append(problems, "status must be active or paused")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidCampaign, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// AppliesTo reports whether a deposit of amount at time now qualifies
+func (c Campaign) AppliesTo(amount float64, now time.Time) bool {
+	return c.Status == "active" &&
+		!now.Before(c.StartDate) && !now.After(c.EndDate) &&
+		amount >= c.MinDeposit
+}
+
+// ListCampaigns returns every campaign for the admin dashboard
+func (s *LuckyNumberService) ListCampaigns() ([]Campaign, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.ListCampaigns(context.Background(), false)
+	if err != nil {
+		return nil, err
+	}
+	return campaignsFromRows(rows), nil
+}
+
+// GetPromotions returns the running campaigns without internal settings
+func (s *LuckyNumberService) GetPromotions() ([]Promotion, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.ListCampaigns(context.Background(), true)
+	if err != nil {
+		return nil, err
+	}
+	promotions := make([]Promotion, 0, len(rows))
+	for _, c := range campaignsFromRows(rows) {
+		promotions = append(promotions, Promotion{
+			Name:         c.Name,
+			MinDeposit:   c.MinDeposit,
+			RewardType:   c.RewardType,
+			RewardAmount: c.RewardAmount,
+			EndDate:      c.EndDate,
+		})
+	}
+	return promotions, nil
+}
+
+// CreateCampaign validates and stores a new campaign
+func (s *LuckyNumberService) CreateCampaign(c Campaign) (Campaign, error) {
+	if s == nil || s.db == nil {
+		return Campaign{}, fmt.Errorf("service or database not initialized")
+	}
+	if c.RewardValidityHours == 0 {
+		c.RewardValidityHours = defaultRewardValidityHours
+	}
+	c.Status = "active"
+	if err := c.Validate(); err != nil {
+		return Campaign{}, err
+	}
+
+	id, err := s.db.CreateCampaign(context.Background(), c.Name, c.RewardType, c.MinDeposit, c.RewardAmount,
+		c.RewardValidityHours, c.MaxRedemptionsPerUser, c.StartDate, c.EndDate)
+	if err != nil {
+		return Campaign{}, err
+	}
+	c.ID = id
+	return c, nil
+}
+
+// UpdateCampaign replaces a campaign's settings
+func (s *LuckyNumberService) UpdateCampaign(c Campaign) (Campaign, error) {
+	if s == nil || s.db == nil {
+		return Campaign{}, fmt.Errorf("service or database not initialized")
+	}
+	if c.RewardValidityHours == 0 {
+		c.RewardValidityHours = defaultRewardValidityHours
+	}
+	if c.Status == "" {
+		c.Status = "active"
+	}
+	if err := c.Validate(); err != nil {
+		return Campaign{}, err
+	}
+
+	n, err := s.db.UpdateCampaign(context.Background(), c.ID, c.Name, c.RewardType, c.MinDeposit, c.RewardAmount,
+		c.RewardValidityHours, c.MaxRedemptionsPerUser, c.StartDate, c.EndDate, c.Status)
+	if err != nil {
+		return Campaign{}, err
+	}
+	if n == 0 {
+		return Campaign{}, ErrCampaignNotFound
+	}
+	return c, nil
+}
+
+// DeleteCampaign stops a campaign; past redemptions are kept
+func (s *LuckyNumberService) DeleteCampaign(id int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	n, err := s.db.DeleteCampaign(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCampaignNotFound
+	}
+	return nil
+}
+
+// applyDepositCampaigns grants every running campaign the deposit qualifies
+// for. Redemptions are keyed by transaction id, so a retried callback never
+// grants twice. Failures are logged; they must not fail the settlement.
+func (s *LuckyNumberService) applyDepositCampaigns(ctx context.Context, msisdn, transactionID string, amount float64) {
+	rows, err := s.db.ListCampaigns(ctx, true)
+	if err != nil {
+		logrus.Errorf("campaigns: list failed for %s: %v", transactionID, err)
+		return
+	}
+
+	now := time.Now()
+	for _, c := range campaignsFromRows(rows) {
+		if !c.AppliesTo(amount, now) {
+			continue
+		}
+
+		expiry := now.Add(time.Duration(c.RewardValidityHours) * time.Hour)
+		granted, err := s.db.RedeemCampaign(ctx, c.ID, msisdn, transactionID, c.RewardType, c.RewardAmount, expiry, c.MaxRedemptionsPerUser, limits.BonusWagering)
+		if err != nil {
+			logrus.Errorf("campaigns: redeem campaign=%d txn=%s failed: %v", c.ID, transactionID, err)
+			continue
+		}
+		if !granted {
+			continue
+		}
+
+		logrus.Infof("campaigns: granted %s %.0f to %s (campaign=%d, txn=%s)", c.RewardType, c.RewardAmount, msisdn, c.ID, transactionID)
+		if err := s.queueOrderedSMS(ctx, msisdn, campaignRewardMessage(c, expiry), "LuckyNumber", "campaign_reward"); err != nil {
+			logrus.Errorf("campaigns: reward sms to %s failed: %v", msisdn, err)
+		}
+	}
+}
+
+func campaignRewardMessage(c Campaign, expiry time.Time) string {
+	until := expiry.In(clock.Location()).Format("02/01/2006 15:04")
+	if c.RewardType == RewardFreeBet {
+		return fmt.Sprintf("Hongera! Umepata FREE BET %.0f kutoka %s. Tumia kabla ya %s. BONYEZA *463#", c.RewardAmount, c.Name, until)
+	}
+	return fmt.Sprintf("Hongera! Umepata BONUS Ksh.%.2f kutoka %s. Tumia kabla ya %s. BONYEZA *463#", c.RewardAmount, c.Name, until)
+}
+
+func campaignsFromRows(rows []map[string]interface{}) []Campaign {
+	campaigns := make([]Campaign, 0, len(rows))
+	for _, row := range rows {
+		c := Campaign{
+			ID:                    utils.ToInt64(row["id"]),
+			Name:                  utils.ToString(row["name"]),
+			MinDeposit:            utils.ToFloat64(row["min_deposit"]),
+			RewardType:            utils.ToString(row["reward_type"]),
+			RewardAmount:          utils.ToFloat64(row["reward_amount"]),
+			RewardValidityHours:   utils.ToInt(row["reward_validity_hours"]),
+			MaxRedemptionsPerUser: utils.ToInt(row["max_redemptions_per_user"]),
+			Status:                utils.ToString(row["status"]),
+		}
+		c.StartDate, _ = row["start_date"].(time.Time)
+		c.EndDate, _ = row["end_date"].(time.Time)
+		campaigns = append(campaigns, c)
+	}
+	return campaigns
+}
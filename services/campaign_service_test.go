@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// campaignRepo serves campaigns over a memRepo and redeems them the way
+// RedeemCampaign does: once per transaction, up to maxPerUser per player
+type campaignRepo struct {
+	*memRepo
+	campaigns []map[string]interface{}
+	redeemed  map[string]bool // campaign/transaction
+	perUser   map[string]int  // campaign/msisdn
+}
+
+func (r *campaignRepo) ListCampaigns(ctx context.Context, activeOnly bool) ([]map[string]interface{}, error) {
+	return r.campaigns, nil
+}
+
+func (r *campaignRepo) RedeemCampaign(ctx context.Context, campaignID int64, msisdn, transactionID, rewardType string, rewardAmount float64, rewardExpiry time.Time, maxPerUser int, bonusWagering float64) (bool, error) {
+	txn, user := fmt.Sprintf("%d/%s", campaignID, transactionID), fmt.Sprintf("%d/%s", campaignID, msisdn)
+	if r.redeemed[txn] || r.perUser[user] >= maxPerUser {
+		return false, nil
+	}
+	r.redeemed[txn] = true
+	r.perUser[user]++
+	return true, nil
+}
+
+func campaignRow(id int64, minDeposit float64, rewardType string, start, end time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id, "name": fmt.Sprintf("Promo %d", id), "min_deposit": minDeposit, "reward_type": rewardType,
+		"reward_amount": 20.0, "reward_validity_hours": 24, "max_redemptions_per_user": 2,
+		"status": "active", "start_date": start, "end_date": end,
+	}
+}
+
+func TestApplyDepositCampaigns(t *testing.T) {
+	now := time.Now()
+	repo := &campaignRepo{
+		memRepo: newMemRepo(),
+		campaigns: []map[string]interface{}{
+			campaignRow(1, 100, RewardFreeBet, now.Add(-time.Hour), now.Add(time.Hour)),
+			campaignRow(2, 500, RewardBonus, now.Add(-time.Hour), now.Add(time.Hour)),
+			campaignRow(3, 100, RewardBonus, now.Add(-2*time.Hour), now.Add(-time.Hour)), // over
+		},
+		redeemed: map[string]bool{},
+		perUser:  map[string]int{},
+	}
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	s.applyDepositCampaigns(ctx, testMsisdn, "TXN1", 100)
+	if len(repo.sms) != 1 || !strings.Contains(repo.sms[0].Message, "FREE BET 20") {
+		t.Fatalf("sms = %+v, want one free bet reward", repo.sms)
+	}
+
+	// A retried callback grants nothing more
+	s.applyDepositCampaigns(ctx, testMsisdn, "TXN1", 100)
+	if len(repo.sms) != 1 {
+		t.Errorf("retried callback granted again: %+v", repo.sms)
+	}
+
+	// A larger deposit qualifies for both running campaigns, then the
+	// per-player cap of 2 stops the free bet
+	s.applyDepositCampaigns(ctx, testMsisdn, "TXN2", 500)
+	s.applyDepositCampaigns(ctx, testMsisdn, "TXN3", 500)
+	if got := repo.perUser["1/"+testMsisdn]; got != 2 {
+		t.Errorf("free bet granted %d times, want the cap of 2", got)
+	}
+	if got := repo.perUser["2/"+testMsisdn]; got != 2 {
+		t.Errorf("bonus granted %d times, want 2", got)
+	}
+	if got := repo.perUser["3/"+testMsisdn]; got != 0 {
+		t.Errorf("ended campaign granted %d times", got)
+	}
+}
+
+func TestCampaignAppliesTo(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	c := Campaign{Status: "active", MinDeposit: 100, StartDate: start, EndDate: start.Add(24 * time.Hour)}
+	cases := []struct {
+		name   string
+		amount float64
+		at     time.Time
+		want   bool
+	}{
+		{"threshold", 100, start.Add(time.Hour), true},
+		{"under threshold", 99.99, start.Add(time.Hour), false},
+		{"at start", 100, start, true},
+		{"at end", 100, c.EndDate, true},
+		{"before start", 100, start.Add(-time.Second), false},
+		{"after end", 100, c.EndDate.Add(time.Second), false},
+	}
+	for _, tc := range cases {
+		if got := c.AppliesTo(tc.amount, tc.at); got != tc.want {
+			t.Errorf("%s: AppliesTo = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	c.Status = "paused"
+	if c.AppliesTo(100, start.Add(time.Hour)) {
+		t.Error("paused campaign applies")
+	}
+}
+
+func TestCampaignValidate(t *testing.T) {
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	valid := Campaign{Name: "Promo", MinDeposit: 100, RewardType: RewardBonus, RewardAmount: 20,
+		MaxRedemptionsPerUser: 1, StartDate: start, EndDate: start.Add(time.Hour)}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid campaign rejected: %v", err)
+	}
+
+	bad := valid
+	bad.Name, bad.RewardType, bad.EndDate, bad.Status = " ", "cash", start, "running"
+	err := bad.Validate()
+	if !errors.Is(err, ErrInvalidCampaign) {
+		t.Fatalf("err = %v, want ErrInvalidCampaign", err)
+	}
+	for _, want := range []string{"name", "reward_type", "end_date", "status"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not name %s", err, want)
+		}
+	}
+}
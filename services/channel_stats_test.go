@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"testing"
+	"time"
+)
+
+func TestBetsBookedPerChannel(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 1000)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 60, "3": 20})
+
+	place := func(amount float64, box, channel string) {
+		t.Helper()
+		user, _ := repo.CheckUser(context.Background(), testMsisdn)
+		if _, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, amount, box, channel); err != nil {
+			t.Fatalf("PlaceBet on %s: %v", channel, err)
+		}
+	}
+	place(200, "1", "web")
+	place(50, "1", "ussd")
+	place(50, "1", "ussd")
+	place(100, "2", "app")
+
+	want := map[string]memChannelKPI{
+		"web":  {Handle: 200, Bets: 1},
+		"ussd": {Handle: 100, Bets: 2},
+		"app":  {Handle: 100, Payout: 60, Bets: 1},
+	}
+	for channel, w := range want {
+		if got := repo.channels[channel]; got != w {
+			t.Errorf("%s = %+v, want %+v", channel, got, w)
+		}
+	}
+	if len(repo.channels) != len(want) {
+		t.Errorf("channels = %v, want only web, ussd and app", repo.channels)
+	}
+	if repo.kpi.Handle != 400 {
+		t.Errorf("total handle = %v, want the channels' 400", repo.kpi.Handle)
+	}
+}
+
+// channelKPIRepo serves canned kpi_by_channel totals
+type channelKPIRepo struct {
+	*memRepo
+	from, to string
+}
+
+func (r *channelKPIRepo) GetChannelKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+	r.from, r.to = startDate, endDate
+	return []map[string]interface{}{
+		{"channel": "ussd", "handle": 1000.0, "payout": 650.5, "bet_count": int64(40)},
+		{"channel": "web", "handle": 300.0, "payout": 400.0, "bet_count": int64(6)},
+	}, nil
+}
+
+func TestGetChannelStats(t *testing.T) {
+	repo := &channelKPIRepo{memRepo: newMemRepo()}
+	s := newTestService(t, repo, nil)
+
+	// 21:30 UTC is already the next business day in Nairobi
+	rng := utils.DateRange{
+		Start: time.Date(2026, 3, 1, 21, 30, 0, 0, time.UTC),
+		End:   time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC),
+	}
+	stats, err := s.GetChannelStats(rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrom := rng.Start.In(clock.Location()).Format("2006-01-02")
+	if repo.from != wantFrom || repo.to != "2026-03-03" {
+		t.Errorf("queried %s..%s, want %s..2026-03-03 in the business zone", repo.from, repo.to, wantFrom)
+	}
+	if len(stats) != 2 || stats[0].GGR != 349.5 || stats[1].GGR != -100 || stats[0].BetCount != 40 {
+		t.Errorf("stats = %+v, want ussd GGR 349.5 over 40 bets and web -100", stats)
+	}
+}
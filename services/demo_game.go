@@ -0,0 +1,184 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrDemoInsufficientBalance = errors.New("insufficient demo balance")
+
+// DemoResult is a settled demo bet and the wallet balance after it
+type DemoResult struct {
+	GameResult PlaceBetResultDisplay
+	Balance    float64
+}
+
+// demoWallet is one demo session's fake balance and the totals the RTP rules
+// read in place of the Player row and the day's KPI
+type demoWallet struct {
+	balance    float64
+	totalBets  float64
+	payout     float64
+	lostCount  int64
+	lastPlayed time.Time
+}
+
+// DemoGameEngine plays the lucky number game with the real box generator
+// against in-memory wallets. It holds only a database.GameReader, so it
+// cannot write bets, withdrawals, KPI or house rows, and it sends no SMS.
+// Wallets live in the process that served the bet.
+type DemoGameEngine struct {
+	db      database.GameReader
+	mu      sync.Mutex
+	wallets map[string]*demoWallet
+}
+
+// NewDemoGameEngine creates a demo engine reading games and settings from db
+func NewDemoGameEngine(db database.GameReader) *DemoGameEngine {
+	return &DemoGameEngine{
+		db:      db,
+		wallets: make(map[string]*demoWallet),
+	}
+}
+
+// wallet returns msisdn's demo wallet, opening a new one with
+// limits.demo_balance when it is missing or idle past limits.demo_session_ttl.
+// Callers hold e.mu.
+func (e *DemoGameEngine) wallet(msisdn string, now time.Time) *demoWallet {
+	for k, w := range e.wallets {
+		if now.Sub(w.lastPlayed) > limits.DemoSessionTTL {
+			delete(e.wallets, k)
+		}
+	}
+	w, ok := e.wallets[msisdn]
+	if !ok {
+		w = &demoWallet{balance: limits.DemoBalance}
+		e.wallets[msisdn] = w
+	}
+	w.lastPlayed = now
+	return w
+}
+
+// Balance returns msisdn's demo balance
+func (e *DemoGameEngine) Balance(msisdn string) float64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.wallet(msisdn, time.Now()).balance
+}
+
+// Play stakes betAmount from msisdn's demo wallet on selectedNumber and
+// settles it in memory
+func (e *DemoGameEngine) Play(ctx context.Context, msisdn, gameCatID string, betAmount float64, selectedNumber string) (DemoResult, error) {
+	if e == nil || e.db == nil {
+		return DemoResult{}, fmt.Errorf("demo engine not initialized")
+	}
+
+	settings, err := e.db.GetSettings(ctx)
+	if err != nil {
+		return DemoResult{}, err
+	}
+	game, err := e.db.GetGame(ctx, gameCatID)
+	if err != nil {
+		return DemoResult{}, err
+	}
+	if settings == nil || game == nil || !game.Active() {
+		return DemoResult{}, ErrUnknownGame
+	}
+	if err := validateSettings(*settings); err != nil {
+		return DemoResult{}, err
+	}
+
+	e.mu.Lock()
+	w := e.wallet(msisdn, time.Now())
+	if w.balance < betAmount {
+		e.mu.Unlock()
+		return DemoResult{}, ErrDemoInsufficientBalance
+	}
+	w.balance -= betAmount
+	w.totalBets += betAmount
+	session := *w
+	e.mu.Unlock()
+
+	defaultRTP := settings.DefaultRTP
+	maxWon := ((defaultRTP + settings.JackpotPercentage) / 100) * (session.totalBets - session.payout)
+
+	sessionRTP := database.RTP(session.payout, session.totalBets)
+	reference := fmt.Sprintf("DEMO%d", time.Now().UnixNano())
+
+	boxes, err := generateWinAmounts(ctx, demoReader{GameReader: e.db, session: session}, GenerateWinAmountsParams{
+		Msisdn:           msisdn,
+		KPI:              map[string]interface{}{"bet": session.totalBets, "payout": session.payout, "rtp": sessionRTP},
+		DefaultRTP:       defaultRTP,
+		AdjustmentRTP:    settings.AdjustableRTP,
+		PlayerRTP:        sessionRTP,
+		Reference:        reference,
+		BetAmount:        betAmount,
+		SelectedNumber:   selectedNumber,
+		MinWinMultiplier: settings.MinWinMultiplier,
+		MaxWinMultiplier: settings.MaxWinMultiplier,
+		MaxExposure:      game.MaxExposure,
+		GameNameInit:     game.NameInit,
+		PlayerLostCount:  session.lostCount,
+		MinLossCount:     cryptoRandIndex(settings.MinLossCount) + 1,
+		MaxWon:           maxWon,
+		VigPercentage:    settings.VigPercentage,
+		RTPOverload:      settings.RTPOverload,
+	})
+	if err != nil {
+		e.mu.Lock()
+		w.balance += betAmount
+		w.totalBets -= betAmount
+		e.mu.Unlock()
+		return DemoResult{}, fmt.Errorf("failed to generate win amounts: %w", err)
+	}
+
+	win := boxes[selectedNumber]
+	result := PlaceBetResultDisplay{
+		Boxes:        boxes,
+		ResultStatus: status.ResultLoss,
+		JackPot:      "False",
+		GameID:       reference,
+		SelectedBox:  selectedNumber,
+	}
+
+	e.mu.Lock()
+	if win.Value > 0 {
+		w.balance += win.Value
+		w.payout += win.Value
+		w.lostCount = 0
+		result.ResultStatus = status.ResultWin
+		result.WinAmount = win.Value
+		result.ResultMessage = fmt.Sprintf("DEMO: Box %s wins %s. No real money was staked.", selectedNumber, win.Item)
+	} else {
+		w.lostCount++
+		result.ResultMessage = fmt.Sprintf("DEMO: Box %s loses. No real money was staked.", selectedNumber)
+	}
+	balance := w.balance
+	e.mu.Unlock()
+
+	logrus.Infof("demo: %s staked %.2f on box %s, won %.2f, demo balance %.2f", msisdn, betAmount, selectedNumber, win.Value, balance)
+	return DemoResult{GameResult: result, Balance: balance}, nil
+}
+
+// demoReader answers the box generator's player lookup from the demo session
+// instead of the Player row
+type demoReader struct {
+	database.GameReader
+	session demoWallet
+}
+
+func (r demoReader) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"msisdn":     msisdn,
+		"total_bets": r.session.totalBets,
+		"payout":     r.session.payout,
+		"lost_count": r.session.lostCount,
+	}, nil
+}
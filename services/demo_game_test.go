@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/status"
+	"strings"
+	"testing"
+)
+
+func TestDemoPlayWritesNothing(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	before := *repo.players[testMsisdn]
+	basket, house, kpi := repo.basket, repo.house, repo.kpi
+	e := NewDemoGameEngine(repo)
+
+	start := e.Balance(testMsisdn)
+	var staked, won float64
+	for i := 0; i < 20; i++ {
+		r, err := e.Play(context.Background(), testMsisdn, "1", 50, "1")
+		if err != nil {
+			t.Fatalf("play %d: %v", i, err)
+		}
+		if !strings.HasPrefix(r.GameResult.ResultMessage, "DEMO:") || !strings.HasPrefix(r.GameResult.GameID, "DEMO") {
+			t.Errorf("play %d = %+v, want a result marked as demo", i, r.GameResult)
+		}
+		staked += 50
+		if r.GameResult.ResultStatus == status.ResultWin {
+			won += r.GameResult.WinAmount
+		}
+		if !near(r.Balance, start-staked+won) {
+			t.Fatalf("play %d: demo balance %.2f, want %.2f", i, r.Balance, start-staked+won)
+		}
+	}
+
+	if len(repo.bets)+len(repo.rounds)+len(repo.queued)+len(repo.pending)+len(repo.sms) != 0 {
+		t.Errorf("demo wrote bets %v, rounds %v, payouts %v %v or sms %v", repo.betRefs(), repo.rounds, repo.queued, repo.pending, repo.sms)
+	}
+	if repo.basket != basket || repo.house != house || repo.kpi != kpi {
+		t.Errorf("demo moved basket %.2f, house %+v or kpi %+v", repo.basket, repo.house, repo.kpi)
+	}
+	if *repo.players[testMsisdn] != before {
+		t.Errorf("demo changed the player row: %+v", *repo.players[testMsisdn])
+	}
+}
+
+func TestDemoWallets(t *testing.T) {
+	repo := newMemRepo()
+	e := NewDemoGameEngine(repo)
+
+	if _, err := e.Play(context.Background(), testMsisdn, "1", limits.DemoBalance+1, "1"); !errors.Is(err, ErrDemoInsufficientBalance) {
+		t.Errorf("stake over the demo balance = %v, want ErrDemoInsufficientBalance", err)
+	}
+	if _, err := e.Play(context.Background(), testMsisdn, "1", 50, "1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.Balance("254700000009"); got != limits.DemoBalance {
+		t.Errorf("another number's wallet = %.2f, want a fresh %.2f", got, limits.DemoBalance)
+	}
+	if _, err := e.Play(context.Background(), testMsisdn, "404", 50, "1"); !errors.Is(err, ErrUnknownGame) {
+		t.Errorf("unknown game = %v, want ErrUnknownGame", err)
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrDepositFlagged is returned for a deposit callback recorded for review
+// instead of credited
+var ErrDepositFlagged = errors.New("deposit flagged for review")
+
+// Sources of deposit reviews
+const (
+	DepositReviewSettleBet = "settle_bet"
+)
+
+// DepositError is a deposit amount the settings refuse. Code is its message
+// code in the i18n catalog and Limit the amount the message names.
+type DepositError struct {
+	Code  string
+	Limit interface{}
+}
+
+func (e *DepositError) Error() string {
+	switch e.Code {
+	case "deposit_below_min":
+		return fmt.Sprintf("deposit must be at least %v", e.Limit)
+	case "deposit_above_max":
+		return fmt.Sprintf("deposit must be at most %v", e.Limit)
+	}
+	return "deposit must be a whole amount"
+}
+
+// depositLimits are the bounds a deposit is held to: the settings'
+// min_deposit and max_deposit within limits.deposit_min and deposit_max,
+// and whether a deposit asked for with decimals is rounded (round_deposits)
+// or refused
+type depositLimits struct {
+	Min   float64
+	Max   float64
+	Round bool
+}
+
+func depositLimitsOf(settings database.Settings) depositLimits {
+	l := depositLimits{
+		Min:   math.Max(settings.MinDeposit, limits.DepositMin),
+		Max:   settings.MaxDeposit,
+		Round: settings.RoundDeposits,
+	}
+	if l.Max <= 0 || (limits.DepositMax > 0 && l.Max > limits.DepositMax) {
+		l.Max = limits.DepositMax
+	}
+	return l
+}
+
+// amount returns the amount to push for a deposit asked for as requested.
+// M-Pesa takes whole shillings only, so with Round a requested amount is
+// rounded to the nearest shilling, half up; without it decimals are
+// refused. The result is then checked against the bounds.
+func (l depositLimits) amount(requested float64) (float64, error) {
+	amount := requested
+	if l.Round {
+		amount = math.Floor(requested + 0.5)
+	}
+	return amount, l.check(amount)
+}
+
+// check returns a *DepositError when amount is outside the bounds or not
+// whole shillings. The minimum is above 0, so it also refuses amounts that
+// are not a positive number.
+func (l depositLimits) check(amount float64) error {
+	switch {
+	case !(amount >= l.Min):
+		return &DepositError{Code: "deposit_below_min", Limit: l.Min}
+	case l.Max > 0 && amount > l.Max:
+		return &DepositError{Code: "deposit_above_max", Limit: l.Max}
+	case amount != math.Trunc(amount):
+		return &DepositError{Code: "deposit_not_whole"}
+	}
+	return nil
+}
+
+// depositLimits reads the deposit bounds from the cached settings
+func (s *LuckyNumberService) depositLimits(ctx context.Context) (depositLimits, error) {
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return depositLimits{}, err
+	}
+	return depositLimitsOf(settings), nil
+}
+
+// checkSettledDeposit guards a callback about to credit amount: outside
+// the deposit bounds it is recorded for review, once per transaction, and
+// ErrDepositFlagged returned so nothing is credited. The gateway already
+// took the money, so refusing the callback would lose it.
+func (s *LuckyNumberService) checkSettledDeposit(ctx context.Context, source, transactionID, reference, msisdn string, amount float64) error {
+	l, err := s.depositLimits(ctx)
+	if err != nil {
+		return err
+	}
+	refused := l.check(amount)
+	if refused == nil {
+		return nil
+	}
+	var deposit *DepositError
+	errors.As(refused, &deposit)
+	inserted, err := s.db.InsertDepositReview(ctx, source, transactionID, reference, msisdn, amount, deposit.Code)
+	if err != nil {
+		return err
+	}
+	if inserted {
+		logrus.WithFields(logrus.Fields{"alert": "money", "transaction_id": transactionID, "reference": reference}).
+			Warnf("deposit of %v flagged for review: %v", amount, refused)
+	}
+	return fmt.Errorf("%w: %s: %v", ErrDepositFlagged, transactionID, refused)
+}
+
+// DepositReview is a deposit callback recorded instead of credited; reason
+// is the deposit error code that refused its amount
+type DepositReview struct {
+	ID            int64     `json:"id"`
+	Source        string    `json:"source" example:"settle_bet"`
+	TransactionID string    `json:"transaction_id"`
+	Reference     string    `json:"reference"`
+	Msisdn        string    `json:"msisdn"`
+	Amount        float64   `json:"amount"`
+	Reason        string    `json:"reason" example:"deposit_above_max"`
+	DateCreated   time.Time `json:"date_created"`
+}
+
+// DepositReviewPage is one page of deposit reviews, newest first
+type DepositReviewPage struct {
+	Reviews    []DepositReview `json:"reviews"`
+	Page       int             `json:"page"`
+	PageSize   int             `json:"page_size"`
+	Total      int64           `json:"total"`
+	TotalPages int             `json:"total_pages"`
+}
+
+// ListDepositReviews returns one page of the deposits flagged for review
+func (s *LuckyNumberService) ListDepositReviews(page utils.Page) (DepositReviewPage, error) {
+	if s == nil || s.db == nil {
+		return DepositReviewPage{}, fmt.Errorf("service or database not initialized")
+	}
+	rows, total, err := s.db.ListDepositReviews(context.Background(), page.Size, page.Offset())
+	if err != nil {
+		return DepositReviewPage{}, err
+	}
+	result := DepositReviewPage{
+		Reviews:    make([]DepositReview, 0, len(rows)),
+		Page:       page.Number,
+		PageSize:   page.Size,
+		Total:      total,
+		TotalPages: page.TotalPages(total),
+	}
+	for _, row := range rows {
+		r := DepositReview{
+			ID:            utils.ToInt64(row["id"]),
+			Source:        utils.ToString(row["source"]),
+			TransactionID: utils.ToString(row["transaction_id"]),
+			Reference:     utils.ToString(row["reference"]),
+			Msisdn:        utils.ToString(row["msisdn"]),
+			Amount:        utils.ToFloat64(row["amount"]),
+			Reason:        utils.ToString(row["reason"]),
+		}
+		r.DateCreated, _ = row["date_created"].(time.Time)
+		result.Reviews = append(result.Reviews, r)
+	}
+	return result, nil
+}
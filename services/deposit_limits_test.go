@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestDepositLimitsOf(t *testing.T) {
+	saved := limits
+	defer func() { limits = saved }()
+	limits.DepositMin, limits.DepositMax = 1, 150000
+
+	cases := []struct {
+		name     string
+		settings database.Settings
+		want     depositLimits
+	}{
+		{"settings", database.Settings{MinDeposit: 10, MaxDeposit: 70000, RoundDeposits: true}, depositLimits{10, 70000, true}},
+		{"no minimum set", database.Settings{MaxDeposit: 70000}, depositLimits{1, 70000, false}},
+		{"no maximum set", database.Settings{MinDeposit: 10}, depositLimits{10, 150000, false}},
+		{"maximum over the ceiling", database.Settings{MinDeposit: 10, MaxDeposit: 1000000}, depositLimits{10, 150000, false}},
+	}
+	for _, tc := range cases {
+		if got := depositLimitsOf(tc.settings); got != tc.want {
+			t.Errorf("%s: limits = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDepositAmountBounds(t *testing.T) {
+	cases := []struct {
+		requested float64
+		round     bool
+		amount    float64
+		code      string
+	}{
+		{10, false, 10, ""},
+		{150000, false, 150000, ""},
+		{9, false, 9, "deposit_below_min"},
+		{0, false, 0, "deposit_below_min"},
+		{-50, false, -50, "deposit_below_min"},
+		{math.NaN(), false, 0, "deposit_below_min"},
+		{150001, false, 150001, "deposit_above_max"},
+		{1000000, false, 1000000, "deposit_above_max"},
+		{10.5, false, 10.5, "deposit_not_whole"},
+		{0.5, false, 0.5, "deposit_below_min"},
+		{10.5, true, 11, ""},
+		{10.49, true, 10, ""},
+		{9.5, true, 10, ""},
+		{9.49, true, 9, "deposit_below_min"},
+		{150000.5, true, 150001, "deposit_above_max"},
+	}
+	l := depositLimits{Min: 10, Max: 150000}
+	for _, tc := range cases {
+		l.Round = tc.round
+		amount, err := l.amount(tc.requested)
+		var deposit *DepositError
+		switch {
+		case tc.code == "" && err != nil:
+			t.Errorf("amount(%v, round %t) = %v, want %v accepted", tc.requested, tc.round, err, tc.amount)
+		case tc.code != "" && (!errors.As(err, &deposit) || deposit.Code != tc.code):
+			t.Errorf("amount(%v, round %t) = %v, want %s", tc.requested, tc.round, err, tc.code)
+		case !math.IsNaN(tc.requested) && amount != tc.amount:
+			t.Errorf("amount(%v, round %t) = %v, want %v", tc.requested, tc.round, amount, tc.amount)
+		}
+	}
+
+	var deposit *DepositError
+	if _, err := l.amount(5); !errors.As(err, &deposit) || deposit.Limit != 10.0 || err.Error() != "deposit must be at least 10" {
+		t.Errorf("below the minimum = %#v, want the minimum named", err)
+	}
+	if _, err := l.amount(200000); !errors.As(err, &deposit) || deposit.Limit != 150000.0 {
+		t.Errorf("above the maximum = %#v, want the maximum named", err)
+	}
+}
+
+// depositRepo records the deposit request, STK row and reviews a deposit
+// writes, with the reviews unique per transaction as deposit_reviews is
+type depositRepo struct {
+	*maintenanceRepo
+	requested []float64 // deposit_requests amounts
+	stkRows   []float64 // stk_queue_ke amounts
+	reviews   map[string]string
+}
+
+func newDepositRepo() *depositRepo {
+	return &depositRepo{maintenanceRepo: newMaintenanceRepo(), reviews: map[string]string{}}
+}
+
+func (r *depositRepo) CheckBettoBet(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *depositRepo) ListShortcodes(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *depositRepo) InsertIntoDepositLuckyRequest(ctx context.Context, depositType, ussd, carrier, gameCatID string, amount float64, msisdn, selectedBox, reference, channel string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requested = append(r.requested, amount)
+	return 1, nil
+}
+
+func (r *depositRepo) InsertSTK(ctx context.Context, game, carrier, reference, msisdn string, amount float64, shortcode string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stkRows = append(r.stkRows, amount)
+	return 1, nil
+}
+
+func (r *depositRepo) InsertDepositReview(ctx context.Context, source, transactionID, reference, msisdn string, amount float64, reason string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.reviews[transactionID]; ok {
+		return false, nil
+	}
+	r.reviews[transactionID] = reason
+	return true, nil
+}
+
+// captureSTKPushes points payment requests at a gateway that keeps the
+// amounts pushed
+func captureSTKPushes(t *testing.T) *[]string {
+	t.Helper()
+	saved := paymentRequestURL
+	var mu sync.Mutex
+	pushed := new([]string)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		*pushed = append(*pushed, body["amount"])
+		mu.Unlock()
+	}))
+	paymentRequestURL = gateway.URL
+	t.Cleanup(func() {
+		gateway.Close()
+		paymentRequestURL = saved
+	})
+	return pushed
+}
+
+func TestIniatatDepositRefusesBounds(t *testing.T) {
+	pushed := captureSTKPushes(t)
+	repo := newDepositRepo()
+	s := newTestService(t, repo, nil)
+
+	for requested, code := range map[float64]string{0: "deposit_below_min", -20: "deposit_below_min", 9: "deposit_below_min",
+		0.5: "deposit_below_min", 1000000: "deposit_above_max", 20.5: "deposit_not_whole"} {
+		_, err := s.IniatatDeposit(testMsisdn, requested, "app", "")
+		var deposit *DepositError
+		if !errors.As(err, &deposit) || deposit.Code != code {
+			t.Errorf("deposit of %v = %v, want %s", requested, err, code)
+		}
+	}
+	if len(repo.requested)+len(repo.stkRows)+len(*pushed) != 0 || len(repo.players) != 0 {
+		t.Errorf("refused deposits wrote %v requests, %v STK rows and pushed %v", repo.requested, repo.stkRows, *pushed)
+	}
+}
+
+func TestIniatatDepositRoundsOnce(t *testing.T) {
+	pushed := captureSTKPushes(t)
+	repo := newDepositRepo()
+	repo.settings.RoundDeposits = true
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+
+	result, err := s.IniatatDeposit(testMsisdn, 49.5, "app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Reference == "" || len(repo.requested) != 1 || repo.requested[0] != 50 ||
+		len(repo.stkRows) != 1 || repo.stkRows[0] != 50 || len(*pushed) != 1 || (*pushed)[0] != "50" {
+		t.Errorf("request %v, STK rows %v, pushed %v; want 50 in each", repo.requested, repo.stkRows, *pushed)
+	}
+}
+
+func TestSettlementOutOfBoundsFlagged(t *testing.T) {
+	repo := newDepositRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40})
+	repo.deposits["REF1"] = map[string]interface{}{
+		"msisdn": testMsisdn, "amount": 200000.0, "game_cat_id": "1", "selected_box": "1",
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+	cb := models.SettlementCallback{TransactionID: "QK1", Reference: "REF1"}
+
+	// Redelivered, it is still refused and reviewed once
+	for i := 0; i < 2; i++ {
+		if err := s.HandleDepositAndGame(cb); !errors.Is(err, ErrDepositFlagged) {
+			t.Fatalf("delivery %d = %v, want ErrDepositFlagged", i+1, err)
+		}
+	}
+	if p := repo.player(testMsisdn); p.Balance != 0 || len(repo.bets) != 0 {
+		t.Errorf("player = %+v with %d bets, want nothing credited or played", p, len(repo.bets))
+	}
+	if len(repo.reviews) != 1 || repo.reviews["QK1"] != "deposit_above_max" {
+		t.Errorf("reviews = %v, want QK1 flagged above the maximum", repo.reviews)
+	}
+	if _, ok := repo.rounds["REF1"]; ok {
+		t.Errorf("round = %s, want none funded", repo.rounds["REF1"])
+	}
+
+	// A decimal amount cannot have come from M-Pesa either
+	repo.deposits["REF2"] = map[string]interface{}{"msisdn": testMsisdn, "amount": 20.5, "game_cat_id": "1", "selected_box": "1"}
+	if err := s.HandleDepositAndGame(models.SettlementCallback{TransactionID: "QK2", Reference: "REF2"}); !errors.Is(err, ErrDepositFlagged) {
+		t.Errorf("decimal deposit = %v, want ErrDepositFlagged", err)
+	}
+	if repo.reviews["QK2"] != "deposit_not_whole" {
+		t.Errorf("reviews = %v, want QK2 flagged as not whole", repo.reviews)
+	}
+}
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DepositService starts deposits and settles their callbacks, playing the
+// game a deposit paid for
+type DepositService interface {
+	IniatatDeposit(msisdn string, amount float64, channel, campaign string) (PlaceBetResult, error)
+	HandleDepositAndGame(cb models.SettlementCallback) error
+	SettleDeposit(cb models.SettlementCallback, betType string) (map[string]interface{}, error)
+	ProcessBetAndPlayGame(cb models.SettlementCallback) (map[string]interface{}, error)
+}
+
+var _ DepositService = (*LuckyNumberService)(nil)
+
+// IniatatDeposit starts an STK push deposit on the shortcode of campaign, or
+// when it is empty the shortcode picked for channel. A campaign no active
+// shortcode carries returns ErrUnknownCampaign and an amount the deposit
+// limits refuse a *DepositError. The amount is rounded as depositLimits
+// does before anything is written, and the STK push, its STK row and the
+// deposit request all carry the same amount.
+func (s *LuckyNumberService) IniatatDeposit(msisdn string, amount float64, channel, campaign string) (PlaceBetResult, error) {
+	// NOTE: removed s.mu.Lock() / defer s.mu.Unlock() — do not serialize DB ops globally.
+
+	// Give each request a reasonable timeout so slow DB calls don't hang forever.
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	bounds, err := s.depositLimits(ctx)
+	if err != nil {
+		return PlaceBetResult{}, err
+	}
+	if amount, err = bounds.amount(amount); err != nil {
+		return PlaceBetResult{}, err
+	}
+	if err := s.checkDeposits(ctx); err != nil {
+		return PlaceBetResult{}, err
+	}
+	shortcode, err := s.DepositShortcode(ctx, campaign, channel)
+	if err != nil {
+		return PlaceBetResult{}, err
+	}
+	// 1) Check user
+	user, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		logrus.Errorf("CheckUser error: %v", err)
+		return PlaceBetResult{}, err
+	}
+	mnoCategory := s.getMNOCategory(msisdn)
+	// 2) Create user if missing (do this synchronously)
+	if user == nil {
+		promo := s.randomString(5)
+
+		if _, err := s.db.CreateUser(ctx, mnoCategory, msisdn, "", promo, ""); err != nil {
+			logrus.Errorf("CreateUser error: %v", err)
+			return PlaceBetResult{}, err
+		}
+		_, errd := s.db.CreatePromo(ctx, msisdn, promo)
+		if errd != nil {
+			logrus.Errorf("Error creating promo: %v", err)
+			return PlaceBetResult{}, err
+		}
+		// optionally re-fetch user if you need returned fields
+	}
+	// 3) compute adjusted amount (synchronous because it likely reads DB)
+	adjustedAmount, err := s.adjustBetAmount(ctx, msisdn, amount)
+	if err != nil {
+		logrus.Errorf("adjustBetAmount error: %v", err)
+		return PlaceBetResult{}, err
+	}
+	if bounds.check(adjustedAmount) != nil {
+		// the shilling off or on would leave the bounds
+		adjustedAmount = amount
+	}
+	// 4) claim a deposit reference: the deposit request row must own it
+	// before the STK push goes out under it
+	gameID, err := withFreshReference(utils.RefDeposit, utils.NewReference(utils.RefDeposit), func(reference string) error {
+		_, err := s.db.InsertIntoDepositLuckyRequest(ctx, "", "", mnoCategory, "0", adjustedAmount, msisdn, "0", reference, channel)
+		return err
+	})
+	if err != nil {
+		logrus.Errorf("InsertIntoDepositLuckyRequest error: %v", err)
+		return PlaceBetResult{}, err
+	}
+	if err := s.openRound(ctx, gameID, msisdn, "", adjustedAmount, actorPlayer, "stk push via "+channel); err != nil {
+		return PlaceBetResult{}, err
+	}
+
+	err = s.SendPaymentRequest(msisdn, utils.ToString(adjustedAmount), gameID)
+	if err != nil {
+		logrus.Errorf("SendPaymentRequest error: %v", err)
+	}
+
+	// 5) queue the STK record
+	if _, err := s.db.InsertSTK(ctx, "", mnoCategory, gameID, msisdn, adjustedAmount, shortcode); err != nil {
+		logrus.Errorf("InsertSTK error: %v", err)
+		return PlaceBetResult{}, err
+	}
+
+	// Success
+	return PlaceBetResult{FreeBet: "false", Message: "Kukamilisha BET weka M-Pesa PIN yako.", Reference: gameID}, nil
+}
+
+// paymentRequestURL is the payment gateway's STK push endpoint
+var paymentRequestURL = "http://172.16.0.184:8008/api/v1/initiate_deposit"
+
+// paymentRequestClient posts to paymentRequestURL
+var paymentRequestClient = &http.Client{Timeout: 20 * time.Second}
+
+func (s *LuckyNumberService) SendPaymentRequest(msisdn string, amount string, gameID string) error {
+
+	// Generate gameID
+
+	// Create request body JSON
+	payload := map[string]interface{}{
+		"amount":    amount,
+		"msisdn":    msisdn,
+		"reference": gameID,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("json marshal error: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", paymentRequestURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	// Send request
+	resp, err := paymentRequestClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("https request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("api error: status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// HandleDepositAndGame processes deposit and starts the game. It returns
+// ErrRoundPlayed, having changed nothing, when the deposit's round already
+// has its bet, and ErrDepositFlagged when its amount was flagged for review.
+func (s *LuckyNumberService) HandleDepositAndGame(cb models.SettlementCallback) error {
+	ctx, timing := withTiming(context.Background(), flowBet)
+	defer timing.finish()
+	defer s.plays.hold()()
+	timing.lap(stageQueue)
+
+	transactionID := string(cb.TransactionID)
+	reference := cb.Reference
+	name := cb.Name
+
+	// Check transaction and deposit request
+	checkTransaction, err := s.db.CheckTransaction(ctx, transactionID)
+	if err != nil {
+		return err
+	}
+
+	stkUSSD, err := s.db.CheckDepositRequestLucky(ctx, reference)
+	if err != nil {
+		return err
+	}
+	timing.lap(stageSettings)
+
+	if checkTransaction == nil && stkUSSD != nil && stkUSSD["msisdn"] != nil {
+		// A bet on the reference means the round was played already, by an
+		// earlier delivery of this callback or one racing it. Credit and
+		// play nothing again.
+		played, err := s.db.BetExists(ctx, reference)
+		if err != nil {
+			return err
+		}
+		if played {
+			logrus.Infof("deposit %s: round already played, skipping", reference)
+			return fmt.Errorf("%w: %s", ErrRoundPlayed, reference)
+		}
+
+		msisdn := stkUSSD["msisdn"].(string)
+		user, err := s.db.CheckUser(ctx, msisdn)
+		if err != nil {
+			return err
+		}
+
+		// Create user if doesn't exist
+		if user == nil {
+			mnoCategory := s.getMNOCategory(msisdn)
+			promo := s.randomString(5)
+
+			_, err = s.db.CreateUser(ctx, mnoCategory, msisdn, "", promo, "")
+			if err != nil {
+				return err
+			}
+			_, errd := s.db.CreatePromo(ctx, msisdn, promo)
+			if errd != nil {
+				logrus.Errorf("Error creating promo: %v", err)
+				return err
+			}
+			user, err = s.db.CheckUser(ctx, msisdn)
+			if err != nil {
+				return err
+			}
+		}
+
+		amount := stkUSSD["amount"].(float64)
+		if err := s.checkSettledDeposit(ctx, CallbackSettleBT, transactionID, reference, msisdn, amount); err != nil {
+			return err
+		}
+		gameCatID := stkUSSD["game_cat_id"].(string)
+		if err := s.fundRound(ctx, reference, msisdn, gameCatID, amount, actorMpesa, "deposit "+transactionID); err != nil {
+			return err
+		}
+		_, err = s.db.UpdateUserAviatorBalInfoLucky(ctx, amount, msisdn, name)
+		if err != nil {
+			return err
+		}
+		s.publishEvent(ctx, EventDepositSettled, msisdn, map[string]interface{}{
+			"msisdn":         msisdn,
+			"reference":      reference,
+			"transaction_id": transactionID,
+			"amount":         amount,
+		})
+
+		// Extract game data and start the game
+		selectedNumber := stkUSSD["selected_box"].(string)
+		channel, _ := stkUSSD["channel"].(string)
+		ussd, _ := stkUSSD["ussd"].(string)
+		gameName, _ := stkUSSD["game"].(string)
+
+		// The deposit pays for this bet, so take it from cash first
+		if _, _, err := s.db.DebitStake(ctx, msisdn, reference, amount, false); err != nil {
+			return err
+		}
+
+		_, err = s.playGame(ctx, nil, gameCatID, user, msisdn, amount, selectedNumber, reference, "normal", channel, ussd, gameName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SettleDeposit handles deposit settlement. A deposit whose amount the
+// deposit limits refuse is flagged for review and ErrDepositFlagged
+// returned, crediting nothing.
+func (s *LuckyNumberService) SettleDeposit(cb models.SettlementCallback, betType string) (map[string]interface{}, error) {
+	ctx, timing := withTiming(context.Background(), flowDeposit)
+	defer timing.finish()
+
+	msisdn := string(cb.Msisdn)
+	amount := float64(cb.Amount)
+	name, transactionID, reference := cb.Name, string(cb.TransactionID), cb.Reference
+	description, ussd, shortcode, gameName := cb.Description, string(cb.USSD), string(cb.Shortcode), cb.GameName
+
+	// Check if transaction already exists
+	transactionExists, err := s.db.CheckTransaction(ctx, transactionID)
+	if err != nil {
+		logrus.Errorf("Error checking transaction: %v", err)
+		return nil, err
+	}
+
+	logrus.Infof("Transaction already : %s", transactionExists)
+
+	if len(transactionExists) > 0 {
+		logrus.Info("No transaction found, safe to insert")
+		logrus.Infof("Transaction already exists: %s", transactionID)
+		logrus.Infof("Transaction already exists: %d records", len(transactionExists))
+		return nil, err
+		// handle duplicate
+	} else {
+		logrus.Infof("Transaction already : %s", transactionExists)
+
+		if transactionExists != nil {
+			logrus.Infof("Transaction already exists: %s", transactionID)
+			return nil, fmt.Errorf("transaction already exists")
+		}
+		// Check deposit request
+		depositRequest, err := s.db.CheckDepositRequestLucky(ctx, reference)
+		if err != nil {
+			logrus.Errorf("Error checking deposit request: %v", err)
+			return nil, err
+		}
+		s.flagUnknownShortcode(ctx, shortcode, transactionID)
+
+		// Check if user exists
+		user, err := s.db.CheckUser(ctx, msisdn)
+		if err != nil {
+			logrus.Errorf("Error checking user: %v", err)
+			return nil, err
+		}
+		logrus.Infof("user already : %s", user)
+
+		// Create user if doesn't exist
+		if user == nil {
+			carrier := s.getMNOCategory(msisdn)
+			promo := s.randomString(5)
+
+			_, err := s.db.CreateUser(ctx, carrier, msisdn, "", promo, "")
+			if err != nil {
+				logrus.Errorf("Error creating user: %v", err)
+				return nil, err
+			}
+
+			// Get the newly created user
+			user, err = s.db.CheckUser(ctx, msisdn)
+			if err != nil {
+				logrus.Errorf("Error getting new user: %v", err)
+				return nil, err
+			}
+		}
+
+		timing.setReference(reference)
+		timing.lap(stageSettings)
+
+		var gameCatID = utils.ToString(depositRequest["game_cat_id"]) // Use toString instead of type assertion
+		var selectedNumber = utils.ToString(depositRequest["selected_box"])
+		var channel = utils.ToString(depositRequest["channel"])
+
+		balance := utils.NumericFloat(user["balance"])
+		// Now you can add
+
+		if depositRequest == nil {
+			if err := s.checkSettledDeposit(ctx, DepositReviewSettleBet, transactionID, reference, msisdn, amount); err != nil {
+				return nil, err
+			}
+			reference := utils.NewReference(utils.RefDeposit)
+
+			var gameCatID = "0" // Use toString instead of type assertion
+			var selectedNumber = "0"
+			var channel = "direct"
+
+			total := balance + amount // var userBalance float64 = 250.0
+
+			if err := s.fundRound(ctx, reference, msisdn, "", amount, actorMpesa, "paybill deposit "+transactionID); err != nil {
+				return nil, err
+			}
+
+			message := s.renderMessage(ctx, TemplateDeposit, utils.ToString(user["language"]), map[string]string{
+				"balance": fmt.Sprintf("%.2f", total),
+			})
+
+			// logrus.Errorf("Deposit request not found for reference: %s", reference)
+
+			logrus.Infof("depositRequest already : %s", depositRequest)
+
+			// The confirmation takes its place before the balance is
+			// credited, ahead of the result SMS of any bet on it
+			confirmation := s.sms.reserve(msisdn)
+			s.confirmDeposit(confirmation, reference, message, nil)
+
+			err := s.accounts.run(ctx,
+				func() error {
+					_, err := s.db.UpdateUserAviatorBalInfoLucky(ctx, amount, msisdn, name)
+					return err
+				},
+				func() error {
+					_, err := s.db.InsertIntoDepositLuckyRequestComplete(ctx, transactionID, description, gameName, s.getMNOCategory(msisdn), channel, gameCatID, amount, msisdn, selectedNumber, reference)
+					return err
+				},
+				func() error {
+					_, err := s.db.UpdateKPIDeposit(ctx, amount)
+					return err
+				},
+				func() error {
+					_, err := s.db.DeleteUserAttempted(ctx, msisdn)
+					return err
+				},
+				func() error {
+					_, err := s.db.CreateDepositRecordLucky(ctx, msisdn, amount, transactionID, shortcode, name, reference, betType)
+					return err
+				},
+				func() error {
+					_, err := s.db.InsertCustomerLogsPawaBoxKe(ctx, amount, "deposit", utils.ToString(user["id"]), "customer deposit: lucky", reference)
+					return err
+				},
+			)
+			if err != nil {
+				logrus.Errorf("deposit %s: accounting failed: %v", reference, err)
+				return nil, err
+			}
+
+			s.applyDepositCampaigns(ctx, msisdn, transactionID, amount)
+			s.publishEvent(ctx, EventDepositSettled, msisdn, map[string]interface{}{
+				"msisdn":         msisdn,
+				"reference":      reference,
+				"transaction_id": transactionID,
+				"amount":         amount,
+			})
+		} else {
+
+			msisdn := utils.ToString(depositRequest["msisdn"])
+			if msisdn == "" {
+				logrus.Errorf("MSISDN not found in deposit request: %s", reference)
+				return nil, fmt.Errorf("msisdn not found in deposit request")
+			}
+			logrus.Infof("depositRequest already : %s", depositRequest)
+
+			amount := (depositRequest["amount"]).(float64)
+			if err := s.checkSettledDeposit(ctx, DepositReviewSettleBet, transactionID, reference, msisdn, amount); err != nil {
+				return nil, err
+			}
+
+			total := balance + amount // var userBalance float64 = 250.0
+
+			if err := s.fundRound(ctx, reference, msisdn, gameCatID, amount, actorMpesa, "deposit "+transactionID); err != nil {
+				return nil, err
+			}
+
+			message := s.renderMessage(withChannel(ctx, channel), TemplateDeposit, utils.ToString(user["language"]), map[string]string{
+				"balance": fmt.Sprintf("%.2f", total),
+			})
+
+			// Reserved before the credit, as above
+			confirmation := s.sms.reserve(msisdn)
+			var smsTook atomic.Int64
+			s.confirmDeposit(confirmation, reference, message, &smsTook)
+
+			err := s.accounts.run(ctx,
+				func() error {
+					_, err := s.db.UpdateUserAviatorBalInfoLucky(ctx, amount, msisdn, name)
+					return err
+				},
+				func() error {
+					if betType == "normal" {
+						_, err := s.db.UpdateAviatorDepositRequestLucky(ctx, transactionID, reference, description)
+						return err
+					}
+					_, err := s.db.InsertIntoDepositLuckyRequestBonus(ctx, betType, ussd, gameName, s.getMNOCategory(msisdn), gameCatID, amount, msisdn, selectedNumber, reference, channel)
+					return err
+				},
+				func() error {
+					_, err := s.db.DeleteUserAttempted(ctx, msisdn)
+					return err
+				},
+				func() error {
+					_, err := s.db.UpdateKPIDeposit(ctx, amount)
+					return err
+				},
+				func() error {
+					_, err := s.db.CreateDepositRecordLucky(ctx, msisdn, amount, transactionID, shortcode, name, reference, betType)
+					return err
+				},
+				func() error {
+					_, err := s.db.InsertCustomerLogsPawaBoxKe(ctx, amount, "deposit", utils.ToString(user["id"]), "customer deposit: lucky", reference)
+					return err
+				},
+			)
+			if err != nil {
+				logrus.Errorf("deposit %s: accounting failed: %v", reference, err)
+				return nil, err
+			}
+			// The SMS went out alongside the writes, so it is not taken
+			// off accounting. An SMS still being queued counts as 0.
+			timing.add(stageSMS, time.Duration(smsTook.Load()))
+
+			s.applyDepositCampaigns(ctx, msisdn, transactionID, amount)
+			s.publishEvent(ctx, EventDepositSettled, msisdn, map[string]interface{}{
+				"msisdn":         msisdn,
+				"reference":      reference,
+				"transaction_id": transactionID,
+				"amount":         amount,
+			})
+		}
+		timing.lap(stageAccounting)
+
+		logrus.Infof("Deposit settled successfully: reference=%s, msisdn=%s, amount=%.2f",
+			reference, msisdn, amount)
+
+		return depositRequest, nil
+	}
+}
+
+// confirmDeposit sends a deposit confirmation in the place t reserved,
+// alongside the accounting writes, and stores how long it took in took
+// when that is not nil. A failure is logged rather than returned: the
+// credit does not wait on its SMS.
+func (s *LuckyNumberService) confirmDeposit(t *smsTicket, reference, message string, took *atomic.Int64) {
+	go func() {
+		start := time.Now()
+		if err := s.sendReservedSMS(t, message); err != nil {
+			logrus.Errorf("deposit %s: confirmation sms to %s failed: %v", reference, utils.RedactMsisdn(t.msisdn), err)
+		}
+		if took != nil {
+			took.Store(int64(time.Since(start)))
+		}
+	}()
+}
+
+// ProcessBetAndPlayGame handles the main game logic
+func (s *LuckyNumberService) ProcessBetAndPlayGame(cb models.SettlementCallback) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Settle deposit first
+	_, err := s.SettleDeposit(cb, "normal")
+
+	if err != nil {
+		logrus.Errorf("Failed to settle deposit: %v", err)
+		return nil, fmt.Errorf("failed to settle deposit: %w", err)
+	}
+
+	return nil, err
+
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// MaxDepositStatusWait caps ?wait= so a long-poll cannot hold a
+	// connection longer than the app's own request timeout
+	MaxDepositStatusWait = 25 * time.Second
+	depositStatusPoll    = time.Second
+)
+
+// ErrDepositNotFound is returned for unknown references and for references
+// that belong to another player, so callers cannot probe for either
+var ErrDepositNotFound = errors.New("deposit not found")
+
+// DepositStatus is the state of one STK push deposit
+type DepositStatus struct {
+	Reference     string               `json:"reference"`
+	Status        status.DepositStatus `json:"status"`
+	Description   string               `json:"description,omitempty"`
+	Amount        float64              `json:"amount"`
+	TransactionID string               `json:"transaction_id,omitempty"`
+	DateCreated   time.Time            `json:"date_created"`
+}
+
+// depositStatusFromRow settles the deposit request status first and falls
+// back to the STK result, which fails before the request does when the
+// player cancels the push or it times out on the handset
+func depositStatusFromRow(row map[string]interface{}) DepositStatus {
+	d := DepositStatus{
+		Reference:     utils.ToString(row["reference"]),
+		Status:        status.DepositPending,
+		Amount:        utils.ToFloat64(row["amount"]),
+		TransactionID: utils.ToString(row["transaction_id"]),
+	}
+	d.DateCreated, _ = row["date_created"].(time.Time)
+
+	if s, err := status.ParseDepositStatus(utils.ToString(row["status"])); err == nil {
+		d.Status = s
+		d.Description = utils.ToString(row["description"])
+	} else if utils.ToString(row["stk_status"]) == string(status.DepositFail) {
+		d.Status = status.DepositFail
+		d.Description = utils.ToString(row["stk_description"])
+	}
+	return d
+}
+
+// GetDepositStatus returns the status of msisdn's deposit reference. When
+// wait is positive it polls until the deposit leaves pending, wait elapses
+// or ctx is done, and then returns the latest status.
+func (s *LuckyNumberService) GetDepositStatus(ctx context.Context, msisdn, reference string, wait time.Duration) (DepositStatus, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return DepositStatus{}, fmt.Errorf("service or database not initialized")
+	}
+	if wait > MaxDepositStatusWait {
+		wait = MaxDepositStatusWait
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		d, err := s.depositStatus(ctx, msisdn, reference)
+		if err != nil || d.Status != status.DepositPending {
+			return d, err
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return d, nil
+		}
+		pause := depositStatusPoll
+		if remaining < pause {
+			pause = remaining
+		}
+
+		timer := time.NewTimer(pause)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return d, nil
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *LuckyNumberService) depositStatus(ctx context.Context, msisdn, reference string) (DepositStatus, error) {
+	qctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	row, err := s.db.GetDepositStatus(qctx, reference)
+	if err != nil {
+		return DepositStatus{}, err
+	}
+	if row == nil || utils.ToString(row["msisdn"]) != msisdn {
+		return DepositStatus{}, ErrDepositNotFound
+	}
+	return depositStatusFromRow(row), nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+// depositStatusRepo serves deposit_requests joined to stk_results by reference
+type depositStatusRepo struct {
+	database.LuckyRepo
+	mu   sync.Mutex
+	rows map[string]map[string]interface{}
+}
+
+func (r *depositStatusRepo) GetDepositStatus(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	row, ok := r.rows[reference]
+	if !ok {
+		return nil, nil
+	}
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func (r *depositStatusRepo) set(reference, key string, value interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows[reference][key] = value
+}
+
+func newDepositStatusRepo() *depositStatusRepo {
+	row := func(ref, msisdn string) map[string]interface{} {
+		return map[string]interface{}{"reference": ref, "msisdn": msisdn, "amount": 100.0, "date_created": time.Now()}
+	}
+	r := &depositStatusRepo{rows: map[string]map[string]interface{}{
+		"PENDING": row("PENDING", testMsisdn),
+		"PAID":    row("PAID", testMsisdn),
+		"FAILED":  row("FAILED", testMsisdn),
+		"STKFAIL": row("STKFAIL", testMsisdn),
+		"OTHER":   row("OTHER", "254700000002"),
+	}}
+	r.rows["PAID"]["status"], r.rows["PAID"]["transaction_id"] = string(status.DepositSuccess), "QK12345"
+	r.rows["FAILED"]["status"], r.rows["FAILED"]["description"] = string(status.DepositFail), "insufficient funds"
+	r.rows["STKFAIL"]["stk_status"], r.rows["STKFAIL"]["stk_description"] = string(status.DepositFail), "Request cancelled by user"
+	return r
+}
+
+func TestGetDepositStatus(t *testing.T) {
+	s := &LuckyNumberService{db: newDepositStatusRepo()}
+	ctx := context.Background()
+
+	cases := map[string]struct {
+		status status.DepositStatus
+		desc   string
+	}{
+		"PENDING": {status.DepositPending, ""},
+		"PAID":    {status.DepositSuccess, ""},
+		"FAILED":  {status.DepositFail, "insufficient funds"},
+		"STKFAIL": {status.DepositFail, "Request cancelled by user"},
+	}
+	for ref, want := range cases {
+		d, err := s.GetDepositStatus(ctx, testMsisdn, ref, 0)
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+			continue
+		}
+		if d.Status != want.status || d.Description != want.desc || d.Reference != ref {
+			t.Errorf("%s = %+v, want %s %q", ref, d, want.status, want.desc)
+		}
+	}
+
+	for _, ref := range []string{"OTHER", "MISSING"} {
+		d, err := s.GetDepositStatus(ctx, testMsisdn, ref, 0)
+		if !errors.Is(err, ErrDepositNotFound) || d.Reference != "" {
+			t.Errorf("%s = %+v, %v; want ErrDepositNotFound with nothing disclosed", ref, d, err)
+		}
+	}
+}
+
+func TestGetDepositStatusLongPoll(t *testing.T) {
+	repo := newDepositStatusRepo()
+	s := &LuckyNumberService{db: repo}
+	ctx := context.Background()
+
+	start := time.Now()
+	d, err := s.GetDepositStatus(ctx, testMsisdn, "PENDING", 50*time.Millisecond)
+	if err != nil || d.Status != status.DepositPending {
+		t.Fatalf("timed out poll = %+v, %v; want pending", d, err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond || waited > time.Second {
+		t.Errorf("poll returned after %s, want the 50ms wait", waited)
+	}
+
+	time.AfterFunc(100*time.Millisecond, func() { repo.set("PENDING", "status", string(status.DepositSuccess)) })
+	start = time.Now()
+	d, err = s.GetDepositStatus(ctx, testMsisdn, "PENDING", 10*time.Second)
+	if err != nil || d.Status != status.DepositSuccess {
+		t.Fatalf("poll across the callback = %+v, %v; want success", d, err)
+	}
+	if waited := time.Since(start); waited > 3*time.Second {
+		t.Errorf("callback seen after %s, want within a poll interval", waited)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := s.GetDepositStatus(cancelled, testMsisdn, "FAILED", time.Minute); err != nil {
+		t.Errorf("settled deposit under a cancelled context = %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// EventWithdrawalStatus is the socket event telling a player a withdrawal
+// was sent to M-Pesa or failed
+const EventWithdrawalStatus = "withdrawal_status"
+
+// Withdrawal statuses carried by EventWithdrawalStatus
+const (
+	WithdrawalSent   = "sent"
+	WithdrawalFailed = "failed"
+)
+
+// WithdrawalNotice is the data of an EventWithdrawalStatus event
+type WithdrawalNotice struct {
+	Status        string  `json:"status"`
+	Reference     string  `json:"reference"`
+	TransactionID string  `json:"transaction_id,omitempty"`
+	Amount        float64 `json:"amount"`
+}
+
+// UpdateLuckyNumberWithdrawalDisburse records a disbursement callback and,
+// when it matched a processed withdrawal, publishes withdrawal_disbursed and
+// tells the player. Reports false when no withdrawal matched.
+func (s *LuckyNumberService) UpdateLuckyNumberWithdrawalDisburse(cb models.WithdrawalCallback) (bool, error) {
+	ctx := context.Background()
+	w, err := s.db.UpdatePawaBoxKeWithdrawalDisburse(ctx, string(cb.TransactionID), string(cb.Status), cb.Description, cb.Reference)
+	if err != nil || w == nil {
+		return false, err
+	}
+	s.publishEvent(ctx, EventWithdrawalDisbursed, w.Msisdn, map[string]interface{}{
+		"msisdn":         w.Msisdn,
+		"reference":      w.Reference,
+		"transaction_id": string(cb.TransactionID),
+		"amount":         w.Amount,
+		"status":         string(cb.Status),
+	})
+
+	notice := WithdrawalNotice{
+		Status:        WithdrawalFailed,
+		Reference:     w.Reference,
+		TransactionID: string(cb.TransactionID),
+		Amount:        w.Amount,
+	}
+	if cb.Succeeded() {
+		notice.Status = WithdrawalSent
+	}
+	utils.GoBackground("withdrawal notice", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		s.notifyWithdrawal(ctx, w.Msisdn, notice)
+	})
+	return true, nil
+}
+
+// notifyWithdrawal tells msisdn what became of a withdrawal. The SMS is
+// always sent, as the player's money moved; the socket event only when they
+// have notifications on.
+func (s *LuckyNumberService) notifyWithdrawal(ctx context.Context, msisdn string, notice WithdrawalNotice) {
+	player, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		logrus.Errorf("withdrawal %s: load player failed: %v", notice.Reference, err)
+	}
+
+	key := TemplateWithdrawal
+	if notice.Status == WithdrawalFailed {
+		key = TemplateWithdrawalErr
+	}
+	message := s.renderMessage(ctx, key, utils.ToString(player["language"]), map[string]string{
+		"amount":         fmt.Sprintf("%.2f", notice.Amount),
+		"reference":      notice.Reference,
+		"transaction_id": notice.TransactionID,
+	})
+	if err := s.sendsms(msisdn, message); err != nil {
+		logrus.Errorf("withdrawal %s: sms to %s failed: %v", notice.Reference, msisdn, err)
+	}
+
+	if player == nil || !wantsSMS(player) {
+		return
+	}
+	if err := pushSocket(msisdn, EventWithdrawalStatus, notice); err != nil {
+		logrus.Errorf("withdrawal %s: %v", notice.Reference, err)
+	}
+}
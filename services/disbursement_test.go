@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// disburseRepo marks processed withdrawals disbursed by reference, as
+// UpdatePawaBoxKeWithdrawalDisburse does, returning nil for no match
+type disburseRepo struct {
+	*memRepo
+	withdrawals map[string]*database.DisbursedWithdrawal
+	disbursed   map[string]string
+}
+
+func newDisburseRepo() *disburseRepo {
+	repo := &disburseRepo{memRepo: newMemRepo(), disbursed: map[string]string{},
+		withdrawals: map[string]*database.DisbursedWithdrawal{
+			"W1": {Msisdn: testMsisdn, Amount: 500, Reference: "W1"},
+		}}
+	repo.addPlayer(testMsisdn, 0)
+	return repo
+}
+
+func (r *disburseRepo) UpdatePawaBoxKeWithdrawalDisburse(ctx context.Context, transactionID, disburse, description, reference string) (*database.DisbursedWithdrawal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.withdrawals[reference]
+	if !ok {
+		return nil, nil
+	}
+	r.disbursed[reference] = disburse
+	cp := *w
+	return &cp, nil
+}
+
+// captureNotices records the withdrawal_status events pushed to sockets
+func captureNotices(t *testing.T) func() []WithdrawalNotice {
+	t.Helper()
+	var mu sync.Mutex
+	var notices []WithdrawalNotice
+	ConfigureSocketEmitter(func(msisdn, event string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if notice, ok := data.(WithdrawalNotice); ok && event == EventWithdrawalStatus && msisdn == testMsisdn {
+			notices = append(notices, notice)
+		}
+	})
+	t.Cleanup(func() { ConfigureSocketEmitter(nil) })
+	return func() []WithdrawalNotice {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := utils.WaitBackground(ctx); err != nil {
+			t.Fatal(err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]WithdrawalNotice(nil), notices...)
+	}
+}
+
+func TestWithdrawalDisbursedNotifies(t *testing.T) {
+	for _, tc := range []struct {
+		status, want, message string
+	}{
+		{"0", WithdrawalSent, "KES 500.00 has been sent to your M-Pesa, ref W1"},
+		{"Failed", WithdrawalFailed, "KES 500.00, ref W1, could not be sent to M-Pesa. Please call 0703012550"},
+	} {
+		repo := newDisburseRepo()
+		s := newTestService(t, repo, nil)
+		notices := captureNotices(t)
+
+		ok, err := s.UpdateLuckyNumberWithdrawalDisburse(models.WithdrawalCallback{Reference: "W1", TransactionID: "TX1", Status: models.FlexString(tc.status)})
+		if err != nil || !ok {
+			t.Fatalf("status %s: = %v, %v; want matched", tc.status, ok, err)
+		}
+		got := notices()
+		if len(got) != 1 {
+			t.Fatalf("status %s: %d notices, want 1", tc.status, len(got))
+		}
+		if want := (WithdrawalNotice{Status: tc.want, Reference: "W1", TransactionID: "TX1", Amount: 500}); got[0] != want {
+			t.Errorf("status %s: notice %+v, want %+v", tc.status, got[0], want)
+		}
+		if len(repo.events) != 1 || repo.events[0] != EventWithdrawalDisbursed {
+			t.Errorf("status %s: events %v, want one %s", tc.status, repo.events, EventWithdrawalDisbursed)
+		}
+
+		key := TemplateWithdrawal
+		if tc.want == WithdrawalFailed {
+			key = TemplateWithdrawalErr
+		}
+		message := s.renderMessage(context.Background(), key, "", map[string]string{"amount": "500.00", "reference": "W1", "transaction_id": "TX1"})
+		if !strings.Contains(message, tc.message) {
+			t.Errorf("status %s: sms %q, want it to contain %q", tc.status, message, tc.message)
+		}
+	}
+}
+
+func TestWithdrawalNoticeRespectsOptOut(t *testing.T) {
+	repo := newDisburseRepo()
+	repo.players[testMsisdn].NoSMS = true
+	s := newTestService(t, repo, nil)
+	notices := captureNotices(t)
+
+	if ok, err := s.UpdateLuckyNumberWithdrawalDisburse(models.WithdrawalCallback{Reference: "W1", TransactionID: "TX1", Status: "0"}); err != nil || !ok {
+		t.Fatalf("= %v, %v; want matched", ok, err)
+	}
+	if got := notices(); len(got) != 0 {
+		t.Errorf("opted-out player pushed %v, want the sms only", got)
+	}
+	if repo.disbursed["W1"] != "0" {
+		t.Errorf("disburse = %q, want the callback recorded", repo.disbursed["W1"])
+	}
+}
+
+func TestWithdrawalNotFoundNotifiesNobody(t *testing.T) {
+	repo := newDisburseRepo()
+	s := newTestService(t, repo, nil)
+	notices := captureNotices(t)
+
+	ok, err := s.UpdateLuckyNumberWithdrawalDisburse(models.WithdrawalCallback{Reference: "W404", TransactionID: "TX2", Status: "0"})
+	if err != nil || ok {
+		t.Fatalf("unknown reference = %v, %v; want false", ok, err)
+	}
+	if got := notices(); len(got) != 0 || len(repo.events) != 0 {
+		t.Errorf("unknown reference notified %v and published %v", got, repo.events)
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// exposureAdmin is recorded as the admin of a maintenance switch set when
+// a game reaches its daily exposure cap
+const exposureAdmin = "exposure_cap"
+
+// GameExposure is what a game has paid out in wins today against its
+// daily_exposure_cap
+type GameExposure struct {
+	GameCatID string   `json:"game_cat_id" example:"1"`
+	Name      string   `json:"name"`
+	Status    string   `json:"status"`
+	Cap       float64  `json:"daily_exposure_cap"` // 0 is no cap
+	Exposure  float64  `json:"exposure"`
+	WinCount  int64    `json:"win_count"`
+	Remaining *float64 `json:"remaining,omitempty"` // left to pay today; only for a capped game
+	Paused    bool     `json:"paused"`              // betting is paused for maintenance
+}
+
+// capDailyExposure returns what a win of amount on game may pay given what
+// the game has paid today. A game without daily_exposure_cap pays it whole.
+// A win that would take the day past the cap is cut to what is left, which
+// is nothing once the cap is reached; with limits.exposure_cap_strict the
+// game is also paused until an admin turns betting back on. Wins settling
+// at the same moment read the same total, so those in flight when the cap
+// is reached can pass it between them.
+func (s *LuckyNumberService) capDailyExposure(ctx context.Context, game database.Game, reference string, amount float64) (float64, error) {
+	if game.DailyExposureCap <= 0 || amount <= 0 {
+		return amount, nil
+	}
+	exposure, err := s.db.GetGameDailyExposure(ctx, game.ID)
+	if err != nil {
+		return 0, err
+	}
+	left := math.Max(game.DailyExposureCap-exposure, 0)
+	if amount <= left {
+		return amount, nil
+	}
+	capped := math.Floor(left*100) / 100
+
+	logrus.WithFields(logrus.Fields{
+		"game_cat_id": game.ID,
+		"reference":   reference,
+		"exposure":    exposure,
+		"cap":         game.DailyExposureCap,
+	}).Warnf("exposure: win of %.2f on %s cut to %.2f by the daily cap", amount, reference, capped)
+
+	if limits.ExposureCapStrict {
+		s.pauseForExposure(ctx, game, exposure)
+	}
+	return capped, nil
+}
+
+// pauseForExposure pauses betting on game, which has paid exposure today,
+// and alerts ops. A game already paused is left alone.
+func (s *LuckyNumberService) pauseForExposure(ctx context.Context, game database.Game, exposure float64) {
+	if err := s.checkBetting(ctx, game.ID); err != nil {
+		return
+	}
+	message := "This game has reached its limit for today."
+	if err := s.db.SetMaintenanceSwitch(ctx, MaintenanceGame, game.ID, false, true, message, exposureAdmin); err != nil {
+		logrus.Errorf("exposure: failed to pause game %s: %v", game.ID, err)
+		return
+	}
+	s.lookups.Forget(maintenanceKey)
+
+	msg := fmt.Sprintf("Exposure cap: game %s (%s) has paid Ksh.%.2f today against a daily cap of Ksh.%.2f and is paused. Turn betting back on from maintenance once reviewed.",
+		game.ID, game.Name, exposure, game.DailyExposureCap)
+	logrus.WithFields(logrus.Fields{"game_cat_id": game.ID, "exposure": exposure, "cap": game.DailyExposureCap}).Error(msg)
+
+	if s.lag == nil || s.lag.cfg.WebhookURL == "" {
+		return
+	}
+	utils.GoBackground("exposure alert", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.lag.postWebhook(ctx, msg); err != nil {
+			logrus.Errorf("exposure: webhook failed: %v", err)
+		}
+	})
+}
+
+// GetGameExposure returns every game's exposure for today
+func (s *LuckyNumberService) GetGameExposure() ([]GameExposure, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx := context.Background()
+
+	rows, err := s.db.ListGameDailyExposure(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paused := map[string]bool{}
+	if state, err := s.GetMaintenance(ctx); err != nil {
+		logrus.Errorf("exposure: failed to load maintenance: %v", err)
+	} else {
+		for _, sw := range state.PausedGames {
+			paused[sw.GameCatID] = true
+		}
+	}
+
+	games := make([]GameExposure, 0, len(rows))
+	for _, row := range rows {
+		g := GameExposure{
+			GameCatID: utils.ToString(row["game_cat_id"]),
+			Name:      utils.ToString(row["name"]),
+			Status:    utils.ToString(row["status"]),
+			Cap:       utils.ToFloat64(row["daily_exposure_cap"]),
+			Exposure:  utils.ToFloat64(row["exposure"]),
+			WinCount:  utils.ToInt64(row["win_count"]),
+		}
+		g.Paused = paused[g.GameCatID]
+		if g.Cap > 0 {
+			remaining := round2(math.Max(g.Cap-g.Exposure, 0))
+			g.Remaining = &remaining
+		}
+		games = append(games, g)
+	}
+	return games, nil
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// exposureRepo lists the memRepo games with today's exposure, as
+// ListGameDailyExposure does
+type exposureRepo struct {
+	*maintenanceRepo
+}
+
+func (r *exposureRepo) ListGameDailyExposure(ctx context.Context) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []map[string]interface{}
+	for id, g := range r.games {
+		rows = append(rows, map[string]interface{}{"game_cat_id": id, "name": g.Name, "status": g.Status,
+			"daily_exposure_cap": g.DailyExposureCap, "exposure": r.exposure[id]})
+	}
+	return rows, nil
+}
+
+func newExposureTest(t *testing.T, cap, exposure float64, outcomes fixedOutcomes) (*LuckyNumberService, *exposureRepo) {
+	t.Helper()
+	repo := &exposureRepo{newMaintenanceRepo()}
+	repo.games["1"].DailyExposureCap = cap
+	repo.exposure["1"] = exposure
+	repo.addPlayer(testMsisdn, 1000)
+	return newTestService(t, repo, outcomes), repo
+}
+
+func TestCapDailyExposureBoundary(t *testing.T) {
+	cases := []struct {
+		cap, exposure, amount, want float64
+	}{
+		{0, 5000, 300, 300},
+		{1000, 900, 100, 100},
+		{1000, 900, 100.01, 100},
+		{1000, 900, 300, 100},
+		{1000, 999.995, 50, 0},
+		{1000, 1000, 50, 0},
+		{1000, 1200, 50, 0},
+		{1000, 0, 0, 0},
+	}
+	for _, tc := range cases {
+		s, repo := newExposureTest(t, tc.cap, tc.exposure, nil)
+		got, err := s.capDailyExposure(context.Background(), *repo.games["1"], "B1", tc.amount)
+		if err != nil || got != tc.want {
+			t.Errorf("cap %v, exposure %v: win %v pays %v, %v; want %v", tc.cap, tc.exposure, tc.amount, got, err, tc.want)
+		}
+	}
+}
+
+func TestExposureCapDegrades(t *testing.T) {
+	defer func(strict bool) { limits.ExposureCapStrict = strict }(limits.ExposureCapStrict)
+	limits.ExposureCapStrict = false
+	s, repo := newExposureTest(t, 1000, 800, fixedOutcomes{"2": 300})
+
+	result := placeTestBet(t, s, repo.memRepo, 10, "2").GameResult
+	if result.GrossAmount != 200 {
+		t.Errorf("win paid %v gross, want 200 left under the cap", result.GrossAmount)
+	}
+	if repo.exposure["1"] != 1000 {
+		t.Errorf("exposure = %v, want the cap of 1000", repo.exposure["1"])
+	}
+	if err := s.checkBetting(context.Background(), "1"); err != nil {
+		t.Errorf("degrade mode paused the game: %v", err)
+	}
+
+	// Once the cap is reached a win pays nothing, and betting goes on
+	result = placeTestBet(t, s, repo.memRepo, 10, "2").GameResult
+	if result.GrossAmount != 0 || repo.exposure["1"] != 1000 {
+		t.Errorf("win at the cap paid %v, exposure %v; want nothing paid", result.GrossAmount, repo.exposure["1"])
+	}
+}
+
+func TestExposureCapStrictPauses(t *testing.T) {
+	defer func(strict bool) { limits.ExposureCapStrict = strict }(limits.ExposureCapStrict)
+	limits.ExposureCapStrict = true
+	s, repo := newExposureTest(t, 1000, 900, fixedOutcomes{"2": 300})
+
+	// A win inside the cap leaves the game open
+	if paid, err := s.capDailyExposure(context.Background(), *repo.games["1"], "B0", 100); err != nil || paid != 100 {
+		t.Fatalf("win inside the cap = %v, %v", paid, err)
+	}
+	if err := s.checkBetting(context.Background(), "1"); err != nil {
+		t.Fatalf("win inside the cap paused the game: %v", err)
+	}
+
+	result := placeTestBet(t, s, repo.memRepo, 10, "2").GameResult
+	if result.GrossAmount != 100 || repo.exposure["1"] != 1000 {
+		t.Errorf("win paid %v gross, exposure %v; want the 100 left paid", result.GrossAmount, repo.exposure["1"])
+	}
+	var paused *MaintenanceError
+	if err := s.checkBetting(context.Background(), "1"); !errors.As(err, &paused) {
+		t.Fatalf("checkBetting = %v, want the game paused", err)
+	}
+	sw := repo.switches[MaintenanceGame+"|1"]
+	if sw["updated_by"] != exposureAdmin || sw["betting_enabled"] != false || sw["deposits_enabled"] != true {
+		t.Errorf("switch = %v, want betting off by %s and deposits on", sw, exposureAdmin)
+	}
+	if err := s.checkBetting(context.Background(), "2"); err != nil {
+		t.Errorf("other game paused too: %v", err)
+	}
+
+	exposure, err := s.GetGameExposure()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range exposure {
+		if g.GameCatID == "1" && (!g.Paused || g.Remaining == nil || *g.Remaining != 0) {
+			t.Errorf("game 1 exposure = %+v, want paused with nothing remaining", g)
+		}
+	}
+}
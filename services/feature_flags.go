@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/flags"
+	"fiberapp/utils"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// featureFlagsKey is the lookup cache key of the flags. Every worker
+// rereads them after limits.lookup_cache_ttl, so a flip reaches all of
+// them within that time.
+const featureFlagsKey = "feature_flags"
+
+// maxFlagAllowlist bounds a flag's allowlist, which is searched on every check
+const maxFlagAllowlist = 500
+
+var ErrInvalidFeatureFlag = errors.New("invalid feature flag")
+
+// FeatureFlag is a flag with who last set it
+type FeatureFlag struct {
+	flags.Flag
+	UpdatedBy   string     `json:"updated_by,omitempty"`
+	DateUpdated *time.Time `json:"date_updated,omitempty"`
+}
+
+// FeatureFlags returns every known flag through the lookup cache, a flag
+// never set as disabled
+func (s *LuckyNumberService) FeatureFlags(ctx context.Context) ([]FeatureFlag, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.lookups.Get(ctx, featureFlagsKey, func(ctx context.Context) (map[string]interface{}, error) {
+		rows, err := s.db.ListFeatureFlags(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stored := make(map[string]FeatureFlag, len(rows))
+		for _, r := range rows {
+			f := FeatureFlag{
+				Flag: flags.Flag{
+					Name:       utils.ToString(r["name"]),
+					Enabled:    utils.ToBool(r["enabled"]),
+					Percentage: utils.ToInt(r["percentage"]),
+					Allowlist:  []string{},
+				},
+				UpdatedBy: utils.ToString(r["updated_by"]),
+			}
+			if list, ok := r["allowlist"].([]interface{}); ok {
+				for _, msisdn := range list {
+					f.Allowlist = append(f.Allowlist, utils.ToString(msisdn))
+				}
+			}
+			if d, ok := r["date_updated"].(time.Time); ok {
+				f.DateUpdated = &d
+			}
+			stored[f.Name] = f
+		}
+		all := make([]FeatureFlag, 0, len(flags.Known))
+		for _, name := range flags.Known {
+			f, ok := stored[name]
+			if !ok {
+				f = FeatureFlag{Flag: flags.Flag{Name: name, Allowlist: []string{}}}
+			}
+			all = append(all, f)
+		}
+		return map[string]interface{}{"flags": all}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	all, _ := row["flags"].([]FeatureFlag)
+	return all, nil
+}
+
+// FeatureFlag returns flag name through the lookup cache. It is what
+// flags.IsEnabled reads.
+func (s *LuckyNumberService) FeatureFlag(ctx context.Context, name string) (flags.Flag, error) {
+	all, err := s.FeatureFlags(ctx)
+	if err != nil {
+		return flags.Flag{}, err
+	}
+	for _, f := range all {
+		if f.Name == name {
+			return f.Flag, nil
+		}
+	}
+	return flags.Flag{Name: name}, nil
+}
+
+// SetFeatureFlag changes flag name on behalf of admin. A nil field keeps
+// its current value. The change applies here at once and in other
+// processes within limits.lookup_cache_ttl.
+func (s *LuckyNumberService) SetFeatureFlag(admin, name string, enabled *bool, percentage *int, allowlist []string) (FeatureFlag, error) {
+	if s == nil || s.db == nil {
+		return FeatureFlag{}, fmt.Errorf("service or database not initialized")
+	}
+	if !flags.IsKnown(name) {
+		return FeatureFlag{}, fmt.Errorf("%w: unknown flag %s", ErrInvalidFeatureFlag, name)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Start from the stored flag, read past the cache
+	s.lookups.Forget(featureFlagsKey)
+	f, err := s.FeatureFlag(ctx, name)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	if enabled != nil {
+		f.Enabled = *enabled
+	}
+	if percentage != nil {
+		f.Percentage = *percentage
+	}
+	if allowlist != nil {
+		f.Allowlist = make([]string, 0, len(allowlist))
+		for _, msisdn := range allowlist {
+			if msisdn = strings.TrimSpace(msisdn); msisdn != "" && !slices.Contains(f.Allowlist, msisdn) {
+				f.Allowlist = append(f.Allowlist, msisdn)
+			}
+		}
+	}
+	if f.Percentage < 0 || f.Percentage > 100 {
+		return FeatureFlag{}, fmt.Errorf("%w: percentage must be 0 to 100", ErrInvalidFeatureFlag)
+	}
+	if len(f.Allowlist) > maxFlagAllowlist {
+		return FeatureFlag{}, fmt.Errorf("%w: allowlist holds at most %d msisdns", ErrInvalidFeatureFlag, maxFlagAllowlist)
+	}
+
+	if err := s.db.SetFeatureFlag(ctx, f.Name, f.Enabled, f.Percentage, f.Allowlist, admin); err != nil {
+		return FeatureFlag{}, err
+	}
+	logrus.Warnf("flags: %s set %s enabled=%t percentage=%d allowlist=%d msisdns",
+		admin, f.Name, f.Enabled, f.Percentage, len(f.Allowlist))
+
+	s.lookups.Forget(featureFlagsKey)
+	all, err := s.FeatureFlags(ctx)
+	if err != nil {
+		return FeatureFlag{}, err
+	}
+	for _, stored := range all {
+		if stored.Name == name {
+			return stored, nil
+		}
+	}
+	return FeatureFlag{Flag: f}, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/flags"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// flagRepo stores feature flags as the feature_flags table does, the
+// allowlist a TEXT[] read back as []interface{}
+type flagRepo struct {
+	*memRepo
+	flags map[string]map[string]interface{}
+	reads int
+}
+
+func newFlagRepo() *flagRepo {
+	return &flagRepo{memRepo: newMemRepo(), flags: map[string]map[string]interface{}{}}
+}
+
+func (r *flagRepo) SetFeatureFlag(ctx context.Context, name string, enabled bool, percentage int, allowlist []string, admin string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]interface{}, len(allowlist))
+	for i, msisdn := range allowlist {
+		list[i] = msisdn
+	}
+	r.flags[name] = map[string]interface{}{"name": name, "enabled": enabled, "percentage": int32(percentage),
+		"allowlist": list, "updated_by": admin, "date_updated": time.Now()}
+	return nil
+}
+
+func (r *flagRepo) ListFeatureFlags(ctx context.Context) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	rows := make([]map[string]interface{}, 0, len(r.flags))
+	for _, row := range r.flags {
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func TestFeatureFlagsDefaultOff(t *testing.T) {
+	repo := newFlagRepo()
+	s := newTestService(t, repo, nil)
+
+	all, err := s.FeatureFlags(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != len(flags.Known) {
+		t.Fatalf("flags = %+v, want every known flag", all)
+	}
+	for _, f := range all {
+		if f.Enabled || f.Percentage != 0 || f.Allowlist == nil || f.DateUpdated != nil {
+			t.Errorf("unset flag = %+v, want disabled with an empty allowlist", f)
+		}
+	}
+	if _, err := s.FeatureFlag(context.Background(), flags.ResponseV2); err != nil {
+		t.Fatal(err)
+	}
+	if repo.reads != 1 {
+		t.Errorf("%d reads, want the flags read once through the cache", repo.reads)
+	}
+}
+
+func TestSetFeatureFlag(t *testing.T) {
+	repo := newFlagRepo()
+	s := newTestService(t, repo, nil)
+	on, pct := true, 5
+
+	f, err := s.SetFeatureFlag("ops", flags.ResponseV2, &on, &pct, []string{" 254700000001 ", "254700000001", "", "254700000002"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled || f.Percentage != 5 || len(f.Allowlist) != 2 || f.UpdatedBy != "ops" || f.DateUpdated == nil {
+		t.Errorf("flag = %+v, want enabled at 5%% with two msisdns", f)
+	}
+
+	// The flip is seen at once, and fields left nil are kept
+	pct = 20
+	if f, err = s.SetFeatureFlag("ops", flags.ResponseV2, nil, &pct, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Enabled || f.Percentage != 20 || len(f.Allowlist) != 2 {
+		t.Errorf("flag = %+v, want only the percentage changed", f)
+	}
+	read, err := s.FeatureFlag(context.Background(), flags.ResponseV2)
+	if err != nil || read.Percentage != 20 {
+		t.Errorf("read back = %+v, %v, want 20%%", read, err)
+	}
+
+	for name, set := range map[string]func() error{
+		"unknown flag": func() error { _, err := s.SetFeatureFlag("ops", "dark_mode", &on, nil, nil); return err },
+		"over 100%": func() error {
+			p := 101
+			_, err := s.SetFeatureFlag("ops", flags.TightBasket, nil, &p, nil)
+			return err
+		},
+		"negative": func() error {
+			p := -1
+			_, err := s.SetFeatureFlag("ops", flags.TightBasket, nil, &p, nil)
+			return err
+		},
+		"long allowlist": func() error {
+			list := make([]string, maxFlagAllowlist+1)
+			for i := range list {
+				list[i] = fmt.Sprintf("2547%08d", i)
+			}
+			_, err := s.SetFeatureFlag("ops", flags.TightBasket, nil, nil, list)
+			return err
+		},
+	} {
+		if err := set(); !errors.Is(err, ErrInvalidFeatureFlag) {
+			t.Errorf("%s = %v, want ErrInvalidFeatureFlag", name, err)
+		}
+	}
+	if _, ok := repo.flags[flags.TightBasket]; ok {
+		t.Error("a refused flag must not be stored")
+	}
+}
+
+func TestTightBasketFlagCapsWins(t *testing.T) {
+	repo := newFlagRepo()
+	p := repo.addPlayer(testMsisdn, 1000)
+	s := newTestService(t, repo, nil)
+	flags.Configure(s.FeatureFlag)
+	t.Cleanup(func() { flags.Configure(nil) })
+	repo.basket = 1000
+
+	// With every draw at 0.999 an unselected box is drawn just under the
+	// largest win the basket allows, which largestWin recovers
+	largestWin := func() (float64, string) {
+		ctx := flags.WithDecisions(withSimulation(context.Background(), constRNG{0.999}))
+		repo.mu.Lock()
+		user := p.row()
+		repo.mu.Unlock()
+		r, err := s.PlaceBet(ctx, user, "", "PawaBox", "1", testMsisdn, 100, "1", "web")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return (r.GameResult.Boxes["2"].Value-100)/0.999 + 100, flags.Decisions(ctx)
+	}
+
+	wide, ff := largestWin()
+	if ff != "outcome_tight_basket=off" {
+		t.Errorf("decisions = %q, want the flag checked and off", ff)
+	}
+	on := true
+	if _, err := s.SetFeatureFlag("ops", flags.TightBasket, &on, nil, []string{testMsisdn}); err != nil {
+		t.Fatal(err)
+	}
+	repo.basket = 1000
+	tight, ff := largestWin()
+	if ff != "outcome_tight_basket=on" {
+		t.Errorf("decisions = %q, want the flag checked and on", ff)
+	}
+	if ratio := tight / wide; math.Abs(ratio-tightBasketShare/defaultBasketShare) > 1e-6 {
+		t.Errorf("largest win %.2f with the flag, %.2f without, want 70%% of the basket against 80%%", tight, wide)
+	}
+}
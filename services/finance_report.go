@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReportFigures are the money figures of a finance report, each summed from
+// its source table rather than read from the kpi counters
+type ReportFigures struct {
+	Handle               float64 `json:"handle"` // cash stakes; free bets are not handle
+	BetCount             int64   `json:"bet_count"`
+	Payout               float64 `json:"payout"` // gross wins, free bets included
+	GGR                  float64 `json:"ggr"`    // Handle - Payout
+	ExciseCollected      float64 `json:"excise_collected"`
+	WithholdingCollected float64 `json:"withholding_collected"`
+	Deposits             float64 `json:"deposits"`
+	DepositReversals     float64 `json:"deposit_reversals"`
+	DepositsTotal        float64 `json:"deposits_total"` // Deposits - DepositReversals
+	WithdrawalsDisbursed float64 `json:"withdrawals_disbursed"`
+	PendingPayouts       float64 `json:"pending_payouts"` // withdrawals not yet processed and wins held for the basket
+	FreeBetCount         int64   `json:"free_bet_count"`
+	FreeBetStake         float64 `json:"free_bet_stake"`
+	FreeBetCost          float64 `json:"free_bet_cost"` // wins paid on free bets
+}
+
+// ReportDay is one day of a FinanceReport
+type ReportDay struct {
+	Date string `json:"date"`
+	ReportFigures
+}
+
+// Discrepancy is a kpi counter that differs from the report's own sum
+type Discrepancy struct {
+	Date       string  `json:"date"`
+	Counter    string  `json:"counter"` // kpi column
+	KPI        float64 `json:"kpi"`
+	Recomputed float64 `json:"recomputed"`
+	Difference float64 `json:"difference"` // KPI - Recomputed
+}
+
+// FinanceReport is the daily GGR, tax and payout report finance files, over
+// one day or a month
+type FinanceReport struct {
+	From          string        `json:"from"`
+	To            string        `json:"to"`
+	Tolerance     float64       `json:"tolerance"`
+	Totals        ReportFigures `json:"totals"`
+	Days          []ReportDay   `json:"days"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// kpiChecks pairs each kpi counter with the figure it should equal. kpi's
+// bet column holds the stakes and its handle column the net deposits.
+// Amounts may differ by limits.report_tolerance; counts must match.
+var kpiChecks = []struct {
+	counter    string
+	count      bool
+	kpi        func(DailyStats) float64
+	recomputed func(ReportFigures) float64
+}{
+	{"bet", false, func(k DailyStats) float64 { return k.Bet }, func(f ReportFigures) float64 { return f.Handle }},
+	{"bet_count", true, func(k DailyStats) float64 { return float64(k.BetCount) }, func(f ReportFigures) float64 { return float64(f.BetCount) }},
+	{"payout", false, func(k DailyStats) float64 { return k.Payout }, func(f ReportFigures) float64 { return f.Payout }},
+	{"excise_duty_tax_amount", false, func(k DailyStats) float64 { return k.ExciseDuty }, func(f ReportFigures) float64 { return f.ExciseCollected }},
+	{"withholding_tax_amount", false, func(k DailyStats) float64 { return k.WithholdingTax }, func(f ReportFigures) float64 { return f.WithholdingCollected }},
+	{"handle", false, func(k DailyStats) float64 { return k.Handle }, func(f ReportFigures) float64 { return f.DepositsTotal }},
+	{"free_bet_count", true, func(k DailyStats) float64 { return float64(k.FreeBetCount) }, func(f ReportFigures) float64 { return float64(f.FreeBetCount) }},
+	{"free_bet_stake", false, func(k DailyStats) float64 { return k.FreeBetStake }, func(f ReportFigures) float64 { return f.FreeBetStake }},
+}
+
+// GetFinanceReport builds the finance report for every day in dateRange and
+// lists the kpi counters that disagree with it. A day without a kpi row is
+// compared as all zeroes.
+func (s *LuckyNumberService) GetFinanceReport(ctx context.Context, dateRange utils.DateRange) (FinanceReport, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return FinanceReport{}, fmt.Errorf("service or database not initialized")
+	}
+
+	rows, err := s.db.GetReportFigures(ctx, dateRange.Start, dateRange.End)
+	if err != nil {
+		return FinanceReport{}, err
+	}
+	kpiDays, err := s.GetDailyStats(dateRange)
+	if err != nil {
+		return FinanceReport{}, err
+	}
+
+	figures := make(map[string]*ReportFigures)
+	for _, row := range rows {
+		day := utils.ToString(row["day"])
+		f := figures[day]
+		if f == nil {
+			f = &ReportFigures{}
+			figures[day] = f
+		}
+		f.add(utils.ToString(row["figure"]), utils.ToFloat64(row["amount"]), utils.ToInt64(row["count"]))
+	}
+	kpi := make(map[string]DailyStats, len(kpiDays))
+	for _, k := range kpiDays {
+		kpi[k.Date] = k
+	}
+
+	report := FinanceReport{
+		From:          dateRange.Start.In(clock.Location()).Format("2006-01-02"),
+		To:            dateRange.End.In(clock.Location()).Format("2006-01-02"),
+		Tolerance:     limits.ReportTolerance,
+		Days:          []ReportDay{},
+		Discrepancies: []Discrepancy{},
+	}
+	last := dateRange.End.In(clock.Location())
+	for d := dateRange.Start.In(clock.Location()); !d.After(last); d = d.AddDate(0, 0, 1) {
+		date := d.Format("2006-01-02")
+		day := ReportDay{Date: date}
+		if f := figures[date]; f != nil {
+			day.ReportFigures = f.derive()
+		}
+		report.Days = append(report.Days, day)
+		report.Totals.sum(day.ReportFigures)
+		report.Discrepancies = append(report.Discrepancies, reconcile(date, kpi[date], day.ReportFigures)...)
+	}
+	report.Totals = report.Totals.derive()
+	return report, nil
+}
+
+// add books one row of database.GetReportFigures
+func (f *ReportFigures) add(figure string, amount float64, count int64) {
+	switch figure {
+	case "stakes":
+		f.Handle, f.BetCount = amount, count
+	case "wins":
+		f.Payout = amount
+	case "free_bet_stakes":
+		f.FreeBetStake, f.FreeBetCount = amount, count
+	case "free_bet_wins":
+		f.FreeBetCost = amount
+	case "excise":
+		f.ExciseCollected = amount
+	case "withholding":
+		f.WithholdingCollected = amount
+	case "deposits":
+		f.Deposits = amount
+	case "deposit_reversals":
+		f.DepositReversals = amount
+	case "withdrawals_paid":
+		f.WithdrawalsDisbursed = amount
+	case "withdrawals_queued", "payouts_held":
+		f.PendingPayouts += amount
+	}
+}
+
+// sum adds day's source figures to f; derive recomputes the rest
+func (f *ReportFigures) sum(day ReportFigures) {
+	f.Handle += day.Handle
+	f.BetCount += day.BetCount
+	f.Payout += day.Payout
+	f.ExciseCollected += day.ExciseCollected
+	f.WithholdingCollected += day.WithholdingCollected
+	f.Deposits += day.Deposits
+	f.DepositReversals += day.DepositReversals
+	f.WithdrawalsDisbursed += day.WithdrawalsDisbursed
+	f.PendingPayouts += day.PendingPayouts
+	f.FreeBetCount += day.FreeBetCount
+	f.FreeBetStake += day.FreeBetStake
+	f.FreeBetCost += day.FreeBetCost
+}
+
+// derive rounds the figures and fills in GGR and DepositsTotal
+func (f ReportFigures) derive() ReportFigures {
+	f.Handle = round(f.Handle)
+	f.Payout = round(f.Payout)
+	f.ExciseCollected = round(f.ExciseCollected)
+	f.WithholdingCollected = round(f.WithholdingCollected)
+	f.Deposits = round(f.Deposits)
+	f.DepositReversals = round(f.DepositReversals)
+	f.WithdrawalsDisbursed = round(f.WithdrawalsDisbursed)
+	f.PendingPayouts = round(f.PendingPayouts)
+	f.FreeBetStake = round(f.FreeBetStake)
+	f.FreeBetCost = round(f.FreeBetCost)
+	f.GGR = roundSigned(f.Handle - f.Payout)
+	f.DepositsTotal = roundSigned(f.Deposits - f.DepositReversals)
+	return f
+}
+
+// roundSigned rounds like round, mirrored below zero: GGR on a day the
+// house lost and a kpi counter under its recomputed sum are negative
+func roundSigned(value float64) float64 {
+	if value < 0 {
+		return -round(-value)
+	}
+	return round(value)
+}
+
+// reconcile lists the kpi counters of date that differ from figures
+func reconcile(date string, kpi DailyStats, figures ReportFigures) []Discrepancy {
+	var out []Discrepancy
+	for _, check := range kpiChecks {
+		k, r := check.kpi(kpi), check.recomputed(figures)
+		diff := k - r
+		if check.count && diff == 0 || !check.count && math.Abs(diff) <= limits.ReportTolerance {
+			continue
+		}
+		out = append(out, Discrepancy{Date: date, Counter: check.counter, KPI: k, Recomputed: r, Difference: roundSigned(diff)})
+	}
+	return out
+}
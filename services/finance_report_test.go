@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"fiberapp/utils"
+	"testing"
+	"time"
+)
+
+// reportRepo answers the finance report's two reads: the figures summed
+// from the source tables and the running kpi rows
+type reportRepo struct {
+	*memRepo
+	figures []map[string]interface{}
+	kpiRows []map[string]interface{}
+}
+
+func (r *reportRepo) GetReportFigures(ctx context.Context, start, end time.Time) ([]map[string]interface{}, error) {
+	return r.figures, nil
+}
+
+func (r *reportRepo) GetDailyKPI(ctx context.Context, startDate, endDate string) ([]map[string]interface{}, error) {
+	return r.kpiRows, nil
+}
+
+// seedReportDay books a known day of activity: three cash bets of 300, one
+// free bet of 50 that won 60, a cash win of 60, taxes, deposits less a
+// reversal, a paid and a queued withdrawal and a win held for the basket
+func (r *reportRepo) seedReportDay(day string) {
+	for _, f := range []struct {
+		figure string
+		amount float64
+		count  int64
+	}{
+		{"stakes", 300, 3}, {"wins", 120, 2}, {"free_bet_stakes", 50, 1}, {"free_bet_wins", 60, 1},
+		{"excise", 38, 3}, {"withholding", 24, 2}, {"deposits", 1000, 4}, {"deposit_reversals", 100, 1},
+		{"withdrawals_paid", 400, 2}, {"withdrawals_queued", 96, 2}, {"payouts_held", 48, 1},
+	} {
+		r.figures = append(r.figures, map[string]interface{}{"day": day, "figure": f.figure, "amount": f.amount, "count": f.count})
+	}
+}
+
+// kpiRow is the kpi row the seeded day should have booked
+func kpiRow(day string) map[string]interface{} {
+	return map[string]interface{}{
+		"date": day, "bet": 300.0, "bet_count": int64(3), "payout": 120.0, "excise_duty_tax_amount": 38.0,
+		"withholding_tax_amount": 24.0, "handle": 900.0, "free_bet_count": int64(1), "free_bet_stake": 50.0,
+	}
+}
+
+var seededDay = ReportFigures{
+	Handle: 300, BetCount: 3, Payout: 120, GGR: 180, ExciseCollected: 38, WithholdingCollected: 24,
+	Deposits: 1000, DepositReversals: 100, DepositsTotal: 900, WithdrawalsDisbursed: 400, PendingPayouts: 144,
+	FreeBetCount: 1, FreeBetStake: 50, FreeBetCost: 60,
+}
+
+func financeReport(t *testing.T, repo *reportRepo, from, to string) FinanceReport {
+	t.Helper()
+	dateRange, err := utils.ParseDateRange(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := newTestService(t, repo, nil).GetFinanceReport(context.Background(), dateRange)
+	if err != nil {
+		t.Fatalf("GetFinanceReport: %v", err)
+	}
+	return report
+}
+
+func TestFinanceReportDay(t *testing.T) {
+	repo := &reportRepo{memRepo: newMemRepo()}
+	repo.seedReportDay("2026-03-02")
+	repo.kpiRows = append(repo.kpiRows, kpiRow("2026-03-02"))
+
+	report := financeReport(t, repo, "2026-03-02", "2026-03-02")
+	if report.From != "2026-03-02" || report.To != "2026-03-02" || len(report.Days) != 1 {
+		t.Fatalf("report covers %s to %s in %d days, want 2026-03-02 alone", report.From, report.To, len(report.Days))
+	}
+	if got := report.Days[0]; got.Date != "2026-03-02" || got.ReportFigures != seededDay {
+		t.Errorf("day = %+v\nwant %+v", got, seededDay)
+	}
+	if report.Totals != seededDay {
+		t.Errorf("totals = %+v\nwant %+v", report.Totals, seededDay)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("discrepancies = %+v, want none for a kpi row that matches", report.Discrepancies)
+	}
+}
+
+// TestFinanceReportDiscrepancies drifts the second day's kpi row: stakes
+// 50 over and a bet counted twice are listed, half a shilling of payout
+// drift is within tolerance, and a day with no activity and no kpi row is
+// all zeroes
+func TestFinanceReportDiscrepancies(t *testing.T) {
+	repo := &reportRepo{memRepo: newMemRepo()}
+	repo.seedReportDay("2026-03-02")
+	repo.seedReportDay("2026-03-03")
+	drifted := kpiRow("2026-03-03")
+	drifted["bet"], drifted["bet_count"], drifted["payout"] = 350.0, int64(4), 120.5
+	repo.kpiRows = append(repo.kpiRows, kpiRow("2026-03-02"), drifted)
+
+	report := financeReport(t, repo, "2026-03-01", "2026-03-03")
+	if len(report.Days) != 3 || report.Days[0].Date != "2026-03-01" || report.Days[0].ReportFigures != (ReportFigures{}) {
+		t.Fatalf("days = %+v, want an empty 2026-03-01 then the two seeded days", report.Days)
+	}
+	want := []Discrepancy{
+		{Date: "2026-03-03", Counter: "bet", KPI: 350, Recomputed: 300, Difference: 50},
+		{Date: "2026-03-03", Counter: "bet_count", KPI: 4, Recomputed: 3, Difference: 1},
+	}
+	if len(report.Discrepancies) != len(want) {
+		t.Fatalf("discrepancies = %+v, want %+v", report.Discrepancies, want)
+	}
+	for i := range want {
+		if report.Discrepancies[i] != want[i] {
+			t.Errorf("discrepancy %d = %+v, want %+v", i, report.Discrepancies[i], want[i])
+		}
+	}
+
+	double := seededDay
+	double.Handle, double.BetCount, double.Payout, double.GGR = 600, 6, 240, 360
+	double.ExciseCollected, double.WithholdingCollected = 76, 48
+	double.Deposits, double.DepositReversals, double.DepositsTotal = 2000, 200, 1800
+	double.WithdrawalsDisbursed, double.PendingPayouts = 800, 288
+	double.FreeBetCount, double.FreeBetStake, double.FreeBetCost = 2, 100, 120
+	if report.Totals != double {
+		t.Errorf("totals = %+v\nwant %+v", report.Totals, double)
+	}
+}
+
+// TestFinanceReportMissingKPIRow lists every counter of a day with activity
+// but no kpi row
+func TestFinanceReportMissingKPIRow(t *testing.T) {
+	repo := &reportRepo{memRepo: newMemRepo()}
+	repo.seedReportDay("2026-03-02")
+
+	report := financeReport(t, repo, "2026-03-02", "2026-03-02")
+	if len(report.Discrepancies) != len(kpiChecks) {
+		t.Fatalf("discrepancies = %+v, want one per kpi counter", report.Discrepancies)
+	}
+	if d := report.Discrepancies[0]; d.Counter != "bet" || d.KPI != 0 || d.Difference != -300 {
+		t.Errorf("first discrepancy = %+v, want bet 0 against 300", d)
+	}
+}
+
+// TestFinanceReportLosingDay rounds a negative GGR half away from zero, as
+// the positive figures are
+func TestFinanceReportLosingDay(t *testing.T) {
+	repo := &reportRepo{memRepo: newMemRepo()}
+	repo.figures = []map[string]interface{}{
+		{"day": "2026-03-02", "figure": "stakes", "amount": 100.0, "count": int64(1)},
+		{"day": "2026-03-02", "figure": "wins", "amount": 400.0, "count": int64(1)},
+	}
+	repo.kpiRows = []map[string]interface{}{{"date": "2026-03-02", "bet": 100.0, "bet_count": int64(1), "payout": 400.0}}
+
+	report := financeReport(t, repo, "2026-03-02", "2026-03-02")
+	if report.Totals.GGR != -300 {
+		t.Errorf("GGR = %v, want -300", report.Totals.GGR)
+	}
+	if len(report.Discrepancies) != 0 {
+		t.Errorf("discrepancies = %+v, want none", report.Discrepancies)
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// forcedWinRule is what a loss streak needs, besides its length, to earn
+// the win it forces, so a streak a script runs up in seconds does not: it
+// must have lasted minStreak or seen minDeposits deposits. 0 disables
+// either way; with both 0 every long enough streak earns it.
+type forcedWinRule struct {
+	minStreak   time.Duration
+	minDeposits int64
+}
+
+func forcedWinRuleOf(settings database.Settings) forcedWinRule {
+	return forcedWinRule{
+		minStreak:   time.Duration(settings.ForcedWinMinStreakSecs) * time.Second,
+		minDeposits: settings.ForcedWinMinDeposits,
+	}
+}
+
+// earned reports whether a streak that began at since, with deposits made
+// since, meets the rule at now
+func (r forcedWinRule) earned(since, now time.Time, deposits int64) bool {
+	if r.minStreak <= 0 && r.minDeposits <= 0 {
+		return true
+	}
+	return (r.minStreak > 0 && now.Sub(since) >= r.minStreak) ||
+		(r.minDeposits > 0 && deposits >= r.minDeposits)
+}
+
+// streakEarnsForcedWin reports whether the loss streak of player msisdn
+// meets the settings' forced-win rule. Deposits are only counted when the
+// streak's age does not already meet it; failing to count them withholds
+// the win.
+func (s *LuckyNumberService) streakEarnsForcedWin(ctx context.Context, player map[string]interface{}, msisdn string, settings database.Settings) bool {
+	rule := forcedWinRuleOf(settings)
+	now := time.Now()
+	since, ok := database.Player(player).LostSince()
+	if !ok {
+		since = now
+	}
+	if rule.earned(since, now, 0) {
+		return true
+	}
+	if rule.minDeposits <= 0 {
+		return false
+	}
+
+	deposits, err := s.db.CountDepositsSince(ctx, msisdn, since)
+	if err != nil {
+		logrus.Errorf("forced win: counting deposits of %s: %v", utils.RedactMsisdn(msisdn), err)
+		return false
+	}
+	return rule.earned(since, now, deposits)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"fiberapp/utils"
+	"time"
+)
+
+// FreeBet is the free-bet wallet of a "Player" row
+type FreeBet struct {
+	Flagged bool    // is_free = 'YES'
+	Amount  float64 // free_bet
+	Expiry  time.Time
+}
+
+// FreeBetOf reads the free-bet columns of a "Player" row. freebet_expiry is
+// a timestamp when the row comes from pgx and text when it was re-encoded
+// (cached or decoded from JSON); both are accepted.
+func FreeBetOf(player map[string]interface{}) FreeBet {
+	f := FreeBet{
+		Flagged: utils.ToString(player["is_free"]) == "YES",
+		Amount:  utils.NumericFloat(player["free_bet"]),
+	}
+	switch v := player["freebet_expiry"].(type) {
+	case time.Time:
+		f.Expiry = v
+	case *time.Time:
+		if v != nil {
+			f.Expiry = *v
+		}
+	case string:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				f.Expiry = t
+				break
+			}
+		}
+	}
+	return f
+}
+
+// Active reports whether the free bet can be staked at now
+func (f FreeBet) Active(now time.Time) bool {
+	return f.Flagged && f.Amount > 0 && now.Before(f.Expiry)
+}
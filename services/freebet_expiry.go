@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FreeBetExpiryStats counts what the free bet expiry job has done since the
+// process started
+type FreeBetExpiryStats struct {
+	Runs        int64      `json:"runs"`
+	Players     int64      `json:"players"`
+	FreeBets    float64    `json:"free_bets"`
+	LastRun     *time.Time `json:"last_run,omitempty"`
+	LastPlayers int64      `json:"last_players"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// FreeBetLiabilityDay is the free bets expiring on one day
+type FreeBetLiabilityDay struct {
+	Day      string  `json:"day" example:"2024-05-01"`
+	Players  int64   `json:"players"`
+	FreeBets float64 `json:"free_bets"`
+}
+
+// FreeBetLiability is every unexpired free bet, by the day it expires
+type FreeBetLiability struct {
+	Players  int64                 `json:"players"`
+	FreeBets float64               `json:"free_bets"`
+	ByDay    []FreeBetLiabilityDay `json:"by_day"`
+}
+
+var (
+	freeBetExpiryMu    sync.Mutex
+	freeBetExpiryStats FreeBetExpiryStats
+)
+
+// ExpireFreeBets takes back expired free bets in batches of
+// limits.freebet_expiry_batch, at most limits.freebet_expiry_max players per
+// call, and returns how many players lost theirs
+func (s *LuckyNumberService) ExpireFreeBets(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+
+	var players int64
+	var freeBets float64
+	var err error
+	for players < int64(limits.FreeBetExpiryMax) {
+		batch := min(limits.FreeBetExpiryBatch, limits.FreeBetExpiryMax-int(players))
+		expired, e := s.db.ExpireFreeBets(ctx, batch)
+		if e != nil {
+			err = e
+			break
+		}
+		for _, x := range expired {
+			freeBets += x.FreeBets
+			if limits.FreeBetExpirySMS && x.SMSNotifications {
+				message := fmt.Sprintf("Free bet %s zako zimeisha muda wake. Cheza tena *463#", strconv.FormatFloat(x.FreeBets, 'f', -1, 64))
+				if e := s.sendsms(x.Msisdn, message); e != nil {
+					logrus.Errorf("free bet expiry: sms to %s failed: %v", x.Msisdn, e)
+				}
+			}
+		}
+		players += int64(len(expired))
+		if len(expired) < batch {
+			break
+		}
+	}
+
+	now := clock.Now()
+	freeBetExpiryMu.Lock()
+	freeBetExpiryStats.Runs++
+	freeBetExpiryStats.Players += players
+	freeBetExpiryStats.FreeBets += freeBets
+	freeBetExpiryStats.LastRun = &now
+	freeBetExpiryStats.LastPlayers = players
+	freeBetExpiryStats.LastError = ""
+	if err != nil {
+		freeBetExpiryStats.LastError = err.Error()
+	}
+	freeBetExpiryMu.Unlock()
+
+	return players, err
+}
+
+// FreeBetExpiryStats returns the expiry job's counters
+func (s *LuckyNumberService) FreeBetExpiryStats() FreeBetExpiryStats {
+	freeBetExpiryMu.Lock()
+	defer freeBetExpiryMu.Unlock()
+	return freeBetExpiryStats
+}
+
+// FreeBetLiability returns the free bets players still hold
+func (s *LuckyNumberService) FreeBetLiability() (FreeBetLiability, error) {
+	if s == nil || s.db == nil {
+		return FreeBetLiability{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := s.db.GetFreeBetLiability(ctx)
+	if err != nil {
+		return FreeBetLiability{}, err
+	}
+	liability := FreeBetLiability{ByDay: make([]FreeBetLiabilityDay, 0, len(rows))}
+	for _, row := range rows {
+		day := FreeBetLiabilityDay{
+			Day:      utils.ToString(row["day"]),
+			Players:  utils.ToInt64(row["players"]),
+			FreeBets: utils.ToFloat64(row["free_bets"]),
+		}
+		liability.Players += day.Players
+		liability.FreeBets += day.FreeBets
+		liability.ByDay = append(liability.ByDay, day)
+	}
+	return liability, nil
+}
+
+// RunFreeBetExpiry expires free bets on every limits.freebet_expiry_interval
+// until ctx is done. A zero interval disables it. Run it in one process
+// only.
+func (s *LuckyNumberService) RunFreeBetExpiry(ctx context.Context) {
+	if limits.FreeBetExpiryInterval <= 0 {
+		logrus.Info("free bet expiry: disabled")
+		return
+	}
+	ticker := time.NewTicker(limits.FreeBetExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		players, err := s.ExpireFreeBets(ctx)
+		if err != nil {
+			logrus.Errorf("free bet expiry: failed after %d players: %v", players, err)
+		} else if players > 0 {
+			logrus.Infof("free bet expiry: expired the free bets of %d players", players)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+// expiryRepo expires memRepo's free bets the way ExpireFreeBets does:
+// players holding free bets past their expiry, oldest expiry first
+type expiryRepo struct {
+	*memRepo
+	batches []int // batch sizes asked for
+	failAt  int   // fail the nth call, 0 never
+}
+
+func (r *expiryRepo) ExpireFreeBets(ctx context.Context, batchSize int) ([]database.ExpiredFreeBet, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.batches = append(r.batches, batchSize)
+	if len(r.batches) == r.failAt {
+		return nil, errors.New("connection reset")
+	}
+	now := time.Now()
+	var due []*memPlayer
+	for _, p := range r.players {
+		if p.FreeBet > 0 && p.FreeBetEnds.Before(now) {
+			due = append(due, p)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].FreeBetEnds.Before(due[j].FreeBetEnds) })
+	if len(due) > batchSize {
+		due = due[:batchSize]
+	}
+	expired := make([]database.ExpiredFreeBet, len(due))
+	for i, p := range due {
+		expired[i] = database.ExpiredFreeBet{PlayerID: p.ID, Msisdn: p.Msisdn, FreeBets: float64(p.FreeBet), SMSNotifications: !p.NoSMS}
+		p.FreeBet, p.FreeBetEnds = 0, time.Time{}
+	}
+	return expired, nil
+}
+
+func configureFreeBetExpiry(t *testing.T, batch, max int) {
+	t.Helper()
+	limits := config.Default().Limits
+	limits.FreeBetExpiryBatch, limits.FreeBetExpiryMax = batch, max
+	Configure(limits)
+	t.Cleanup(func() { Configure(config.Default().Limits) })
+}
+
+// grant gives n players free bets expiring at ends, numbered from first
+func (r *expiryRepo) grant(first, n int, freeBets int64, ends time.Time) {
+	for i := first; i < first+n; i++ {
+		p := r.addPlayer(fmt.Sprintf("2547%08d", i), 0)
+		p.FreeBet, p.FreeBetEnds = freeBets, ends
+	}
+}
+
+func TestExpireFreeBetsBoundary(t *testing.T) {
+	configureFreeBetExpiry(t, 10, 100)
+	repo := &expiryRepo{memRepo: newMemRepo()}
+	repo.grant(0, 3, 2, time.Now().Add(-time.Second))
+	repo.grant(3, 2, 5, time.Now().Add(time.Minute))
+	s := newTestService(t, repo, nil)
+	before := s.FreeBetExpiryStats()
+
+	n, err := s.ExpireFreeBets(context.Background())
+	if err != nil || n != 3 {
+		t.Fatalf("expired %d players, %v; want the 3 past expiry", n, err)
+	}
+	for _, p := range repo.players {
+		switch {
+		case p.ID <= 3 && p.FreeBet != 0:
+			t.Errorf("expired player %s kept %d free bets", p.Msisdn, p.FreeBet)
+		case p.ID > 3 && p.FreeBet != 5:
+			t.Errorf("active player %s has %d free bets, want 5 untouched", p.Msisdn, p.FreeBet)
+		}
+	}
+	stats := s.FreeBetExpiryStats()
+	if stats.Runs-before.Runs != 1 || stats.Players-before.Players != 3 || stats.FreeBets-before.FreeBets != 6 || stats.LastPlayers != 3 || stats.LastRun == nil {
+		t.Errorf("stats = %+v after %+v, want one run of 3 players and 6 free bets", stats, before)
+	}
+
+	if n, _ := s.ExpireFreeBets(context.Background()); n != 0 {
+		t.Errorf("second run expired %d players, want none", n)
+	}
+}
+
+func TestExpireFreeBetsBatches(t *testing.T) {
+	configureFreeBetExpiry(t, 4, 10)
+	repo := &expiryRepo{memRepo: newMemRepo()}
+	repo.grant(0, 13, 1, time.Now().Add(-time.Hour))
+	s := newTestService(t, repo, nil)
+
+	// 4 + 4 + 2 reaches the per-run cap; the other 3 wait
+	if n, err := s.ExpireFreeBets(context.Background()); err != nil || n != 10 {
+		t.Fatalf("first run = %d, %v, want the cap of 10", n, err)
+	}
+	if want := []int{4, 4, 2}; !equalInts(repo.batches, want) {
+		t.Errorf("batches = %v, want %v", repo.batches, want)
+	}
+	repo.batches = nil
+	if n, _ := s.ExpireFreeBets(context.Background()); n != 3 {
+		t.Errorf("second run = %d, want the 3 left", n)
+	}
+	// A short batch ends the run
+	if want := []int{4}; !equalInts(repo.batches, want) {
+		t.Errorf("batches = %v, want %v", repo.batches, want)
+	}
+}
+
+func TestExpireFreeBetsStopsOnError(t *testing.T) {
+	configureFreeBetExpiry(t, 2, 10)
+	repo := &expiryRepo{memRepo: newMemRepo(), failAt: 2}
+	repo.grant(0, 5, 1, time.Now().Add(-time.Hour))
+	s := newTestService(t, repo, nil)
+
+	n, err := s.ExpireFreeBets(context.Background())
+	if err == nil || n != 2 {
+		t.Errorf("run = %d, %v, want 2 expired before the error", n, err)
+	}
+	if stats := s.FreeBetExpiryStats(); stats.LastError == "" || stats.LastPlayers != 2 {
+		t.Errorf("stats = %+v, want the error and 2 players recorded", stats)
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
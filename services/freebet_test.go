@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fiberapp/clock"
+	"testing"
+	"time"
+)
+
+func TestFreeBetOf(t *testing.T) {
+	expiry := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for name, v := range map[string]interface{}{
+		"timestamp": expiry,
+		"pointer":   &expiry,
+		"rfc3339":   "2026-03-01T12:00:00Z",
+		"text":      "2026-03-01 12:00:00",
+	} {
+		f := FreeBetOf(map[string]interface{}{"is_free": "YES", "free_bet": "50", "freebet_expiry": v})
+		if !f.Flagged || f.Amount != 50 || !f.Expiry.Equal(expiry) {
+			t.Errorf("%s: FreeBetOf = %+v, want 50 expiring %s", name, f, expiry)
+		}
+	}
+
+	f := FreeBet{Flagged: true, Amount: 50, Expiry: expiry}
+	if !f.Active(expiry.Add(-time.Second)) || f.Active(expiry) {
+		t.Error("a free bet is active until, not at, its expiry")
+	}
+	if (FreeBet{Amount: 50, Expiry: expiry}).Active(expiry.Add(-time.Hour)) {
+		t.Error("an unflagged free bet is not active")
+	}
+}
+
+// TestFreeBetDayReconciles plays a day of cash and free bets and checks the
+// KPI, house and basket totals: free stakes stay out of handle, house bets,
+// basket, jackpot and excise but their wins are paid and taxed.
+func TestFreeBetDayReconciles(t *testing.T) {
+	repo := newMemRepo()
+	p := repo.addPlayer(testMsisdn, 1000)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 60, "3": 20})
+
+	placeTestBet(t, s, repo, 200, "1") // cash loss
+	placeTestBet(t, s, repo, 100, "2") // cash win of 60
+
+	repo.mu.Lock()
+	p.FreeBet, p.FreeBetEnds = 2, time.Now().Add(time.Hour)
+	repo.mu.Unlock()
+	if r := placeTestBet(t, s, repo, 50, "1"); r.FreeBet != "true" {
+		t.Fatalf("bet 3 = %+v, want a free bet", r)
+	}
+	if r := placeTestBet(t, s, repo, 50, "2"); r.FreeBet != "true" {
+		t.Fatalf("bet 4 = %+v, want a free bet", r)
+	}
+
+	if repo.kpi.Handle != 300 || repo.kpi.FreeBetStake != 100 {
+		t.Errorf("handle %v, free-bet stake %v; want 300 cash and 100 free", repo.kpi.Handle, repo.kpi.FreeBetStake)
+	}
+	// Excise on the cash stakes only: 25 on 200 and 13 on 100 in whole shillings
+	if repo.kpi.Excise != 38 {
+		t.Errorf("excise = %v, want 38 on the cash stakes", repo.kpi.Excise)
+	}
+	// 5% jackpot share of 300 cash plus two 60 wins; 20% withholding on
+	// both wins plus the jackpot shares' rounded 2 + 1
+	if !near(repo.kpi.Payout, 135) || repo.kpi.Withholding != 27 {
+		t.Errorf("payout %v, withholding %v; want 135 and 27", repo.kpi.Payout, repo.kpi.Withholding)
+	}
+	if repo.house.TotalBets != 300 || !near(repo.basket, 100000+270-120) {
+		t.Errorf("house bets %v, basket %.2f; want 300 and 100150", repo.house.TotalBets, repo.basket)
+	}
+	if got := repo.player(testMsisdn); got.Balance != 700 || got.FreeBet != 0 {
+		t.Errorf("player = %+v, want 700 cash left and both free bets used", got)
+	}
+	var paid float64
+	for _, w := range repo.queued {
+		paid += w.Amount
+	}
+	if paid != 96 {
+		t.Errorf("queued payouts %v, want 48 net for each win", paid)
+	}
+}
+
+// TestFreeBetExpiresAtNairobiMidnight pins the clock either side of a free
+// bet that runs out at midnight in Nairobi, 21:00 UTC
+func TestFreeBetExpiresAtNairobiMidnight(t *testing.T) {
+	defer clock.ConfigureSource(nil)
+	repo := newMemRepo()
+	p := repo.addPlayer(testMsisdn, 1000)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	repo.mu.Lock()
+	p.FreeBet, p.FreeBetEnds = 2, time.Date(2026, 4, 1, 0, 0, 0, 0, clock.Location())
+	repo.mu.Unlock()
+
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 20, 59, 0, 0, time.UTC) })
+	if r := placeTestBet(t, s, repo, 50, "1"); r.FreeBet != "true" {
+		t.Errorf("bet at 23:59 = %+v, want a free bet", r)
+	}
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC) })
+	if r := placeTestBet(t, s, repo, 50, "1"); r.FreeBet != "false" {
+		t.Errorf("bet at 00:01 = %+v, want a cash bet", r)
+	}
+	if got := repo.player(testMsisdn); got.FreeBet != 1 || got.Balance != 950 {
+		t.Errorf("free bets %v, balance %v, want 1 left unused and 50 cash staked", got.FreeBet, got.Balance)
+	}
+}
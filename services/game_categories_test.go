@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// categoryRepo serves GetGameCategories from a list the test edits, as an
+// ops change to "Games" would
+type categoryRepo struct {
+	*memRepo
+	cmu        sync.Mutex
+	categories []string
+	loads      int
+}
+
+func (r *categoryRepo) GetGameCategories(ctx context.Context) ([]string, error) {
+	r.cmu.Lock()
+	defer r.cmu.Unlock()
+	r.loads++
+	return append([]string(nil), r.categories...), nil
+}
+
+func (r *categoryRepo) set(categories ...string) {
+	r.cmu.Lock()
+	r.categories = categories
+	r.cmu.Unlock()
+}
+
+func TestResolveCategory(t *testing.T) {
+	repo := &categoryRepo{memRepo: newMemRepo(), categories: []string{"Money Prize", "Car Prize", "JackPot"}}
+	s := newTestService(t, repo, nil)
+
+	cases := []struct {
+		in, want string
+		err      error
+	}{
+		{"", "all", nil},
+		{"ALL", "all", nil},
+		{"money prize", "Money Prize", nil},
+		{"  JACKPOT ", "JackPot", nil},
+		{"Boat Prize", "", ErrUnknownCategory},
+		{"Money", "", ErrUnknownCategory},
+	}
+	for _, tc := range cases {
+		got, err := s.ResolveCategory(tc.in)
+		if got != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("ResolveCategory(%q) = %q, %v; want %q, %v", tc.in, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestGameCategoriesKeepStoredOrder(t *testing.T) {
+	repo := &categoryRepo{memRepo: newMemRepo(), categories: []string{"Money Prize", "Car Prize", "Bike Prize", "JackPot", "Airtime"}}
+	s := newTestService(t, repo, nil)
+
+	got, err := s.GameCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, repo.categories) {
+		t.Errorf("categories = %v, want the category_order order %v", got, repo.categories)
+	}
+	s.GameCategories()
+	if repo.loads != 1 {
+		t.Errorf("loaded %d times, want the second call served from the cache", repo.loads)
+	}
+}
+
+func TestGameCategoriesFollowCategoryChange(t *testing.T) {
+	repo := &categoryRepo{memRepo: newMemRepo(), categories: []string{"Money Prize", "Car Prize"}}
+	s := newTestService(t, repo, nil)
+	s.lookups = newLookupCache(30*time.Millisecond, 10*time.Millisecond)
+
+	if _, err := s.ResolveCategory("Car Prize"); err != nil {
+		t.Fatal(err)
+	}
+	// The last car game moves to a new category
+	repo.set("Money Prize", "Phone Prize")
+
+	if _, err := s.ResolveCategory("Phone Prize"); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("new category before the TTL = %v, want the cached list", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if got, err := s.ResolveCategory("phone prize"); err != nil || got != "Phone Prize" {
+		t.Errorf("new category after the TTL = %q, %v; want it resolved", got, err)
+	}
+	if _, err := s.ResolveCategory("Car Prize"); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("emptied category = %v, want ErrUnknownCategory", err)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"strings"
+)
+
+// DefaultGamesTitle heads the games list, and is the copy of a game that
+// has no marketing_copy of its own
+const DefaultGamesTitle = "SHINDA HADI KES 3M CASH PAPO HAPO!"
+
+const (
+	// prizePreviewSize is how many award names a game's prize preview lists
+	prizePreviewSize = 3
+	// defaultBoxes is the grid of a game whose boxes column is not set
+	defaultBoxes = 7
+	// gamesKeyPrefix prefixes the lookup cache keys of the games lists, one
+	// per category
+	gamesKeyPrefix = "games:"
+)
+
+// gameListColumns are the columns CheckGames reads only to build a game's
+// GameConfig; they are not listed with the game
+var gameListColumns = []string{"min_stake", "max_stake", "allowed_stakes", "marketing_copy", "is_jackpot", "prize_preview", "jackpot_kitty"}
+
+// GameConfig is how the app presents a game, so a new grid size or prize
+// needs no app release
+type GameConfig struct {
+	Boxes         int      `json:"boxes" example:"7"`
+	StakeMode     string   `json:"stake_mode" example:"range"`
+	DefaultStake  float64  `json:"default_stake" example:"20"`
+	MinStake      float64  `json:"min_stake" example:"10"`
+	MaxStake      float64  `json:"max_stake" example:"1000"` // 0: no maximum
+	MaxWin        float64  `json:"max_win" example:"3000000"`
+	PrizePreview  []string `json:"prize_preview"`                             // the names of the game's most valuable awards, at most prizePreviewSize
+	JackpotTeaser *float64 `json:"jackpot_teaser,omitempty" example:"125000"` // what the kitty holds, on jackpot games
+	Title         string   `json:"title" example:"SHINDA HADI KES 3M CASH PAPO HAPO!"`
+}
+
+// Bounds returns the smallest and largest stake the rules accept; max is 0
+// when there is no maximum
+func (r StakeRules) Bounds() (min, max float64) {
+	switch r.Mode {
+	case StakeDiscrete:
+		return r.AllowedStakes[0], r.AllowedStakes[len(r.AllowedStakes)-1]
+	case StakeRange:
+		return r.MinStake, r.MaxStake
+	}
+	return r.DefaultStake, r.DefaultStake
+}
+
+// GameList returns the active games of category, "all" for every one, each
+// with its GameConfig under "config". The list is cached like the other
+// game lookups.
+func (s *LuckyNumberService) GameList(ctx context.Context, category string) ([]map[string]interface{}, error) {
+	row, err := s.lookups.Get(ctx, gamesKeyPrefix+category, func(ctx context.Context) (map[string]interface{}, error) {
+		rows, err := s.db.CheckGames(ctx, category, prizePreviewSize)
+		if err != nil {
+			return nil, err
+		}
+		games := make([]map[string]interface{}, 0, len(rows))
+		for _, r := range rows {
+			game := utils.NormalizeRow(r)
+			game["config"] = gameConfigOf(r)
+			for _, column := range gameListColumns {
+				delete(game, column)
+			}
+			games = append(games, game)
+		}
+		return map[string]interface{}{"games": games}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	games, _ := row["games"].([]map[string]interface{})
+	return games, nil
+}
+
+// gameConfigOf builds the GameConfig of a CheckGames row
+func gameConfigOf(row map[string]interface{}) GameConfig {
+	var stored database.GameStakeRules
+	stored.BetAmount = utils.NumericFloat(row["bet_amount"])
+	if v, ok := row["min_stake"].(float64); ok {
+		stored.MinStake = &v
+	}
+	if v, ok := row["max_stake"].(float64); ok {
+		stored.MaxStake = &v
+	}
+	if list, ok := row["allowed_stakes"].([]interface{}); ok {
+		for _, v := range list {
+			stored.AllowedStakes = append(stored.AllowedStakes, utils.ToFloat64(v))
+		}
+	}
+	rules := stakeRulesOf(utils.ToString(row["id"]), stored)
+
+	boxes := row["boxes"]
+	if text, ok := boxes.(string); ok {
+		boxes = strings.TrimSpace(text)
+	}
+	config := GameConfig{
+		Boxes:        int(utils.NumericFloat(boxes)),
+		StakeMode:    rules.Mode,
+		DefaultStake: rules.DefaultStake,
+		MaxWin:       utils.NumericFloat(row["max_win"]),
+		PrizePreview: []string{},
+		Title:        strings.TrimSpace(utils.ToString(row["marketing_copy"])),
+	}
+	config.MinStake, config.MaxStake = rules.Bounds()
+	if config.Boxes <= 0 {
+		config.Boxes = defaultBoxes
+	}
+	if config.Title == "" {
+		config.Title = DefaultGamesTitle
+	}
+	if names, ok := row["prize_preview"].([]interface{}); ok {
+		for _, name := range names {
+			if len(config.PrizePreview) < prizePreviewSize {
+				config.PrizePreview = append(config.PrizePreview, utils.ToString(name))
+			}
+		}
+	}
+	if kitty, ok := row["jackpot_kitty"].(float64); ok {
+		config.JackpotTeaser = &kitty
+	}
+	return config
+}
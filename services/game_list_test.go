@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// gameListRepo answers CheckGames with rows shaped as the query scans them
+// and counts the calls
+type gameListRepo struct {
+	*memRepo
+	rows     []map[string]interface{}
+	calls    int
+	previews []int
+}
+
+func (r *gameListRepo) CheckGames(ctx context.Context, category string, previewAwards int) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	r.previews = append(r.previews, previewAwards)
+	rows := make([]map[string]interface{}, len(r.rows))
+	for i, row := range r.rows {
+		cp := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			cp[k] = v
+		}
+		rows[i] = cp
+	}
+	return rows, nil
+}
+
+func newGameListRepo() *gameListRepo {
+	kitty := 125000.0
+	return &gameListRepo{memRepo: newMemRepo(), rows: []map[string]interface{}{
+		{"id": int64(1), "name": "PawaBox", "bet_amount": 20.0, "boxes": "7", "max_win": 3000000.0,
+			"min_stake": nil, "max_stake": nil, "allowed_stakes": []interface{}{}, "marketing_copy": "", "is_jackpot": false,
+			"prize_preview": []interface{}{"Car", "Smart TV", "Phone", "Radio"}, "jackpot_kitty": nil},
+		{"id": int64(2), "name": "Supa", "bet_amount": 5.0, "boxes": " 5 ", "max_win": 1500000.0,
+			"min_stake": 10.0, "max_stake": 500.0, "allowed_stakes": []interface{}{}, "marketing_copy": " SHINDA GARI! ", "is_jackpot": true,
+			"prize_preview": []interface{}{"Bike"}, "jackpot_kitty": kitty},
+		{"id": int64(3), "name": "Spin", "bet_amount": 30.0, "boxes": nil, "max_win": 100000.0,
+			"min_stake": nil, "max_stake": nil, "allowed_stakes": []interface{}{50.0, 20.0, 20.0}, "marketing_copy": "", "is_jackpot": false,
+			"prize_preview": []interface{}{}, "jackpot_kitty": nil},
+	}}
+}
+
+func TestGameListConfig(t *testing.T) {
+	repo := newGameListRepo()
+	s := newTestService(t, repo, nil)
+
+	games, err := s.GameList(context.Background(), "all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 3 {
+		t.Fatalf("games = %v", games)
+	}
+	kitty := 125000.0
+	want := []GameConfig{
+		{Boxes: 7, StakeMode: StakeFixed, DefaultStake: 20, MinStake: 20, MaxStake: 20, MaxWin: 3000000,
+			PrizePreview: []string{"Car", "Smart TV", "Phone"}, Title: DefaultGamesTitle},
+		{Boxes: 5, StakeMode: StakeRange, DefaultStake: 10, MinStake: 10, MaxStake: 500, MaxWin: 1500000,
+			PrizePreview: []string{"Bike"}, JackpotTeaser: &kitty, Title: "SHINDA GARI!"},
+		{Boxes: 7, StakeMode: StakeDiscrete, DefaultStake: 20, MinStake: 20, MaxStake: 50, MaxWin: 100000,
+			PrizePreview: []string{}, Title: DefaultGamesTitle},
+	}
+	for i, game := range games {
+		if got := game["config"].(GameConfig); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("game %v config = %+v, want %+v", game["id"], got, want[i])
+		}
+		for _, column := range gameListColumns {
+			if _, ok := game[column]; ok {
+				t.Errorf("game %v lists %s, want it only in config", game["id"], column)
+			}
+		}
+		if game["name"] == nil || game["max_win"] == nil || game["bet_amount"] == nil {
+			t.Errorf("game %v = %v, want the game fields kept", game["id"], game)
+		}
+	}
+	if !reflect.DeepEqual(repo.previews, []int{prizePreviewSize}) {
+		t.Errorf("preview sizes asked = %v, want %d", repo.previews, prizePreviewSize)
+	}
+}
+
+func TestGameListCachedPerCategory(t *testing.T) {
+	repo := newGameListRepo()
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.GameList(ctx, "all"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repo.calls != 1 {
+		t.Errorf("%d queries for one category, want the list cached", repo.calls)
+	}
+	if _, err := s.GameList(ctx, "Car Prize"); err != nil {
+		t.Fatal(err)
+	}
+	if repo.calls != 2 {
+		t.Errorf("%d queries, want each category cached apart", repo.calls)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrDuplicateRequest    = errors.New("duplicate request")
+	ErrRequestInProgress   = errors.New("request already in progress")
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with a different request")
+)
+
+// IdempotencyClaim holds a request's key until FinishIdempotent records its
+// response. Requests without a client key are keyed on their own hash and
+// held for limits.duplicate_bet_window only, so a double tap is rejected but
+// the same bet placed again later is not.
+type IdempotencyClaim struct {
+	msisdn string
+	route  string
+	key    string
+	auto   bool
+}
+
+// IdempotentReplay is the stored response of an earlier request with the
+// same key
+type IdempotentReplay struct {
+	Status int
+	Body   []byte
+}
+
+// BeginIdempotent claims key for msisdn's request to route. It returns the
+// stored response when the key has already been answered, ErrRequestInProgress
+// while the first request is still running, ErrIdempotencyMismatch when the
+// key was used with a different requestHash and ErrDuplicateRequest for a
+// keyless request repeated within the window. A nil claim and replay means
+// the request is not guarded.
+func (s *LuckyNumberService) BeginIdempotent(msisdn, route, key, requestHash string) (*IdempotencyClaim, *IdempotentReplay, error) {
+	if s == nil || s.db == nil {
+		return nil, nil, fmt.Errorf("service or database not initialized")
+	}
+
+	claim := &IdempotencyClaim{msisdn: msisdn, route: route, key: key}
+	ttl := limits.IdempotencyTTL
+	if key == "" {
+		if limits.DuplicateBetWindow <= 0 {
+			return nil, nil, nil
+		}
+		claim.key, claim.auto = "auto:"+requestHash, true
+		ttl = limits.DuplicateBetWindow
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	// A claim that expires between the two queries is taken over on the
+	// second pass
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := s.db.ClaimIdempotencyKey(ctx, msisdn, route, claim.key, requestHash, time.Now().Add(ttl))
+		if err != nil {
+			return nil, nil, err
+		}
+		if claimed {
+			return claim, nil, nil
+		}
+		if claim.auto {
+			return nil, nil, ErrDuplicateRequest
+		}
+
+		stored, err := s.db.GetIdempotencyKey(ctx, msisdn, route, claim.key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if stored == nil {
+			continue
+		}
+		if stored.RequestHash != requestHash {
+			return nil, nil, ErrIdempotencyMismatch
+		}
+		if stored.StatusCode == 0 {
+			return nil, nil, ErrRequestInProgress
+		}
+		return nil, &IdempotentReplay{Status: stored.StatusCode, Body: stored.Response}, nil
+	}
+	return nil, nil, ErrRequestInProgress
+}
+
+// FinishIdempotent records the response to claim's request for replays. A
+// 5xx or 429 response releases the key instead so the client can retry.
+func (s *LuckyNumberService) FinishIdempotent(claim *IdempotencyClaim, status int, body []byte) {
+	if s == nil || s.db == nil || claim == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	var err error
+	switch {
+	case status >= 500 || status == http.StatusTooManyRequests:
+		err = s.db.ReleaseIdempotencyKey(ctx, claim.msisdn, claim.route, claim.key)
+	case !claim.auto:
+		err = s.db.SaveIdempotentResponse(ctx, claim.msisdn, claim.route, claim.key, status, body)
+	}
+	if err != nil {
+		logrus.Errorf("idempotency %s %s: %v", claim.route, claim.key, err)
+	}
+}
+
+// PurgeIdempotencyKeys deletes expired idempotency keys and returns how many
+// were removed
+func (s *LuckyNumberService) PurgeIdempotencyKeys(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+	return s.db.PurgeExpiredIdempotencyKeys(ctx)
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Sources of stored gateway callbacks
+const (
+	CallbackSettleBT = "settle_bt"
+)
+
+// Stored callback states
+const (
+	CallbackPending   = status.CallbackPending
+	CallbackProcessed = status.CallbackProcessed
+	CallbackFailed    = status.CallbackFailed
+)
+
+const callbackClaimBatch = 20
+
+var (
+	ErrCallbackNotFound  = errors.New("callback not found")
+	ErrCallbackNotFailed = errors.New("callback has not failed")
+	ErrCallbackStatus    = errors.New("invalid callback status")
+)
+
+// callbackSettings holds the callbacks section; ConfigureInboundCallbacks
+// replaces it
+var callbackSettings = config.Default().Callbacks
+
+// ConfigureInboundCallbacks applies the loaded callbacks section. Call it
+// before RunInboundCallbackDispatcher.
+func ConfigureInboundCallbacks(c config.CallbacksConfig) {
+	callbackSettings = c
+}
+
+// InboundCallback is a gateway callback as stored before it was processed
+type InboundCallback struct {
+	ID            int64      `json:"id"`
+	Source        string     `json:"source" example:"settle_bt"`
+	Reference     string     `json:"reference"`
+	TransactionID string     `json:"transaction_id"`
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status" example:"failed"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at"`
+	LastError     string     `json:"last_error,omitempty"`
+	ReceivedAt    time.Time  `json:"received_at"`
+	ProcessedAt   *time.Time `json:"processed_at,omitempty"`
+}
+
+// InboundCallbackPage is one page of stored callbacks, newest first
+type InboundCallbackPage struct {
+	Callbacks  []InboundCallback `json:"callbacks"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	Total      int64             `json:"total"`
+	TotalPages int               `json:"total_pages"`
+}
+
+// AcceptSettleBT stores a validated settle_bt callback and starts processing
+// it in the background. Once it returns nil the callback survives a crash:
+// the dispatcher picks it up if this process never finishes it. The gateway
+// re-delivering a stored transaction is accepted without processing it again.
+func (s *LuckyNumberService) AcceptSettleBT(ctx context.Context, cb models.SettlementCallback, payload []byte) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	id, inserted, err := s.db.InsertInboundCallback(ctx, CallbackSettleBT, cb.Reference, string(cb.TransactionID), payload)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		logrus.Infof("callbacks: settle_bt %s re-delivered, already stored as %d", cb.TransactionID, id)
+		return nil
+	}
+	utils.GoBackground("handle_deposit_and_game", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		row, err := s.db.ClaimInboundCallback(ctx, id, callbackSettings.Lease)
+		cancel()
+		if err != nil {
+			// Left pending; the dispatcher retries it
+			logrus.Errorf("callbacks: claim of %d failed: %v", id, err)
+			return
+		}
+		if row != nil {
+			s.processInboundCallback(row)
+		}
+	})
+	return nil
+}
+
+// RunInboundCallbackDispatcher processes stored callbacks that are due until
+// ctx is done: retries after a failed attempt, and callbacks whose process
+// died before recording an outcome once their lease runs out. Run it in one
+// process only.
+func (s *LuckyNumberService) RunInboundCallbackDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(callbackSettings.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		s.dispatchInboundCallbacks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchInboundCallbacks claims and processes due callbacks until none are
+// left. They are processed one at a time: HandleDepositAndGame serializes
+// them anyway.
+func (s *LuckyNumberService) dispatchInboundCallbacks(ctx context.Context) {
+	for ctx.Err() == nil {
+		rows, err := s.db.ClaimDueInboundCallbacks(ctx, callbackClaimBatch, callbackSettings.Lease)
+		if err != nil {
+			logrus.Errorf("callbacks: claim failed: %v", err)
+			return
+		}
+		for _, row := range rows {
+			done := make(chan struct{})
+			utils.GoBackground("handle_deposit_and_game", func() {
+				defer close(done)
+				s.processInboundCallback(row)
+			})
+			<-done
+		}
+		if len(rows) < callbackClaimBatch {
+			return
+		}
+	}
+}
+
+// processInboundCallback makes one attempt at a claimed callback and records
+// its outcome. A refused round transition or a bet already on the round
+// means an earlier attempt already funded or played it, so the callback
+// counts as processed, as does one flagged for review.
+func (s *LuckyNumberService) processInboundCallback(row map[string]interface{}) {
+	id := utils.ToInt64(row["id"])
+	source := utils.ToString(row["source"])
+	attempt := utils.ToInt(row["attempts"])
+
+	var err error
+	switch source {
+	case CallbackSettleBT:
+		var cb models.SettlementCallback
+		if err = models.DecodeCallback([]byte(utils.ToString(row["payload"])), &cb); err == nil {
+			err = s.HandleDepositAndGame(cb)
+		}
+	default:
+		err = fmt.Errorf("unknown callback source %q", source)
+	}
+
+	state, next, errMsg := CallbackProcessed, time.Now(), ""
+	switch {
+	case err == nil:
+	case errors.Is(err, database.ErrInvalidRoundTransition) || errors.Is(err, database.ErrRoundExists) || errors.Is(err, ErrRoundPlayed):
+		errMsg = "already processed: " + err.Error()
+		logrus.Infof("callbacks: %s %d already processed: %v", source, id, err)
+	case errors.Is(err, ErrDepositFlagged):
+		errMsg = err.Error()
+	case attempt >= callbackSettings.MaxAttempts:
+		state, errMsg = CallbackFailed, err.Error()
+		logrus.Warnf("callbacks: %s %d failed permanently after %d attempts: %v", source, id, attempt, err)
+	default:
+		state, errMsg = CallbackPending, err.Error()
+		next = next.Add(callbackBackoff(attempt))
+		logrus.Errorf("callbacks: %s %d attempt %d failed: %v", source, id, attempt, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.db.RecordInboundCallback(ctx, id, state, next, errMsg); err != nil {
+		logrus.Errorf("callbacks: record outcome of %d failed: %v", id, err)
+	}
+}
+
+// callbackBackoff is the wait after failed attempt n (1-based): backoff_base
+// doubled per earlier failure, capped at backoff_max
+func callbackBackoff(attempt int) time.Duration {
+	wait := callbackSettings.BackoffBase
+	for i := 1; i < attempt && wait < callbackSettings.BackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > callbackSettings.BackoffMax {
+		wait = callbackSettings.BackoffMax
+	}
+	return wait
+}
+
+// ListInboundCallbacks returns one page of stored callbacks in filter, ""
+// for all
+func (s *LuckyNumberService) ListInboundCallbacks(filter string, page utils.Page) (InboundCallbackPage, error) {
+	if s == nil || s.db == nil {
+		return InboundCallbackPage{}, fmt.Errorf("service or database not initialized")
+	}
+	if filter != "" {
+		if _, err := status.ParseCallbackStatus(filter); err != nil {
+			return InboundCallbackPage{}, fmt.Errorf("%w: %q", ErrCallbackStatus, filter)
+		}
+	}
+
+	rows, total, err := s.db.ListInboundCallbacks(context.Background(), filter, page.Size, page.Offset())
+	if err != nil {
+		return InboundCallbackPage{}, err
+	}
+	result := InboundCallbackPage{
+		Callbacks:  make([]InboundCallback, 0, len(rows)),
+		Page:       page.Number,
+		PageSize:   page.Size,
+		Total:      total,
+		TotalPages: page.TotalPages(total),
+	}
+	for _, row := range rows {
+		cb := InboundCallback{
+			ID:            utils.ToInt64(row["id"]),
+			Source:        utils.ToString(row["source"]),
+			Reference:     utils.ToString(row["reference"]),
+			TransactionID: utils.ToString(row["transaction_id"]),
+			Payload:       utils.ToString(row["payload"]),
+			Status:        utils.ToString(row["status"]),
+			Attempts:      utils.ToInt(row["attempts"]),
+			LastError:     utils.ToString(row["last_error"]),
+		}
+		cb.NextAttemptAt, _ = row["next_attempt_at"].(time.Time)
+		cb.ReceivedAt, _ = row["received_at"].(time.Time)
+		if t, ok := row["processed_at"].(time.Time); ok {
+			cb.ProcessedAt = &t
+		}
+		result.Callbacks = append(result.Callbacks, cb)
+	}
+	return result, nil
+}
+
+// RetryInboundCallback queues failed callback id again with a fresh set of
+// attempts, on behalf of admin
+func (s *LuckyNumberService) RetryInboundCallback(admin string, id int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	prev, err := s.db.RequeueInboundCallback(ctx, id)
+	switch {
+	case err != nil:
+		return err
+	case prev == "":
+		return ErrCallbackNotFound
+	case prev != CallbackFailed:
+		return fmt.Errorf("%w: it is %s", ErrCallbackNotFailed, prev)
+	}
+	logrus.Warnf("callbacks: %s requeued failed callback %d", admin, id)
+	return nil
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storedCallback is an inbound_callbacks row
+type storedCallback struct {
+	id                int64
+	source, ref, txID string
+	payload           string
+	status            status.CallbackStatus
+	attempts          int
+	nextAttempt       time.Time
+	lastError         string
+}
+
+// callbackRepo stores callbacks as the inbound_callbacks queue does: one
+// row per (source, transaction_id), claims that count an attempt and lease
+// the row, and recorded outcomes. events is the order things happened in.
+type callbackRepo struct {
+	*memRepo
+	requests   map[string]map[string]interface{}
+	callbacks  []*storedCallback
+	events     []string
+	insertErr  error
+	depositErr error
+}
+
+func newCallbackRepo() *callbackRepo {
+	repo := &callbackRepo{memRepo: newMemRepo(), requests: map[string]map[string]interface{}{
+		"REF1": {"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1", "selected_box": "1",
+			"channel": "ussd", "ussd": "*463#", "game": "PawaBox"},
+	}}
+	repo.addPlayer(testMsisdn, 0)
+	return repo
+}
+
+func (r *callbackRepo) event(format string, args ...interface{}) {
+	r.events = append(r.events, fmt.Sprintf(format, args...))
+}
+
+func (r *callbackRepo) InsertInboundCallback(ctx context.Context, source, reference, transactionID string, payload []byte) (int64, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.insertErr != nil {
+		return 0, false, r.insertErr
+	}
+	for _, cb := range r.callbacks {
+		if cb.source == source && cb.txID == transactionID {
+			return cb.id, false, nil
+		}
+	}
+	cb := &storedCallback{id: int64(len(r.callbacks) + 1), source: source, ref: reference, txID: transactionID,
+		payload: string(payload), status: CallbackPending, nextAttempt: time.Now()}
+	r.callbacks = append(r.callbacks, cb)
+	r.event("store %d", cb.id)
+	return cb.id, true, nil
+}
+
+// claim leases cb when it is pending and due; r.mu is held
+func (r *callbackRepo) claim(cb *storedCallback, lease time.Duration) map[string]interface{} {
+	if cb.status != CallbackPending || cb.nextAttempt.After(time.Now()) {
+		return nil
+	}
+	cb.attempts++
+	cb.nextAttempt = time.Now().Add(lease)
+	r.event("claim %d", cb.id)
+	return map[string]interface{}{"id": cb.id, "source": cb.source, "reference": cb.ref,
+		"transaction_id": cb.txID, "payload": cb.payload, "attempts": int32(cb.attempts)}
+}
+
+func (r *callbackRepo) ClaimInboundCallback(ctx context.Context, id int64, lease time.Duration) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cb := r.find(id); cb != nil {
+		return r.claim(cb, lease), nil
+	}
+	return nil, nil
+}
+
+func (r *callbackRepo) ClaimDueInboundCallbacks(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []map[string]interface{}
+	for _, cb := range r.callbacks {
+		if len(rows) == limit {
+			break
+		}
+		if row := r.claim(cb, lease); row != nil {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+func (r *callbackRepo) RecordInboundCallback(ctx context.Context, id int64, state status.CallbackStatus, nextAttemptAt time.Time, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb := r.find(id)
+	cb.status, cb.nextAttempt, cb.lastError = state, nextAttemptAt, lastError
+	r.event("record %d %s", id, state)
+	return nil
+}
+
+func (r *callbackRepo) RequeueInboundCallback(ctx context.Context, id int64) (status.CallbackStatus, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cb := r.find(id)
+	if cb == nil {
+		return "", nil
+	}
+	prev := cb.status
+	if prev == CallbackFailed {
+		cb.status, cb.attempts, cb.nextAttempt = CallbackPending, 0, time.Now()
+	}
+	return prev, nil
+}
+
+func (r *callbackRepo) find(id int64) *storedCallback {
+	for _, cb := range r.callbacks {
+		if cb.id == id {
+			return cb
+		}
+	}
+	return nil
+}
+
+func (r *callbackRepo) CheckTransaction(ctx context.Context, transactionID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *callbackRepo) CheckDepositRequestLucky(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("process %s", reference)
+	if r.depositErr != nil {
+		return nil, r.depositErr
+	}
+	return r.requests[reference], nil
+}
+
+// callback returns stored callback id
+func (r *callbackRepo) callback(id int64) storedCallback {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.find(id)
+}
+
+func settleBT(txID string) (models.SettlementCallback, []byte) {
+	cb := models.SettlementCallback{Reference: "REF1", TransactionID: models.FlexString(txID), Status: "0", Amount: 20}
+	return cb, []byte(`{"reference":"REF1","transaction_id":"` + txID + `","status":"0","amount":20}`)
+}
+
+func waitCallbacks(t *testing.T) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.WaitBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// callbackTunables sets the callbacks section for the test
+func callbackTunables(t *testing.T, maxAttempts int) {
+	t.Helper()
+	saved := callbackSettings
+	ConfigureInboundCallbacks(config.CallbacksConfig{RetryInterval: time.Second, Lease: time.Minute,
+		MaxAttempts: maxAttempts, BackoffBase: time.Second, BackoffMax: 10 * time.Second})
+	t.Cleanup(func() { ConfigureInboundCallbacks(saved) })
+}
+
+func TestAcceptSettleBTStoresBeforeProcessing(t *testing.T) {
+	callbackTunables(t, 3)
+	repo := newCallbackRepo()
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+
+	cb, payload := settleBT("TX1")
+	if err := s.AcceptSettleBT(context.Background(), cb, payload); err != nil {
+		t.Fatal(err)
+	}
+	waitCallbacks(t)
+
+	if want := []string{"store 1", "claim 1", "process REF1", "record 1 processed"}; !reflect.DeepEqual(repo.events, want) {
+		t.Errorf("events = %v, want %v", repo.events, want)
+	}
+	if stored := repo.callback(1); stored.payload != string(payload) || stored.attempts != 1 {
+		t.Errorf("stored = %+v, want the raw payload after one attempt", stored)
+	}
+	if _, ok := repo.bets["REF1"]; !ok {
+		t.Error("the deposit's round was not played")
+	}
+
+	// Not stored, not accepted: the gateway is answered 500 and sends it again
+	repo.insertErr = errors.New("connection refused")
+	repo.events = nil
+	cb, payload = settleBT("TX2")
+	if err := s.AcceptSettleBT(context.Background(), cb, payload); !errors.Is(err, repo.insertErr) {
+		t.Errorf("accept with the store down = %v, want its error", err)
+	}
+	waitCallbacks(t)
+	if len(repo.events) != 0 {
+		t.Errorf("events = %v, want nothing processed", repo.events)
+	}
+}
+
+func TestSettleBTRecoveredAfterCrash(t *testing.T) {
+	callbackTunables(t, 3)
+	repo := newCallbackRepo()
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	ctx := context.Background()
+
+	// Stored, then the process died before it claimed the row
+	_, payload := settleBT("TX1")
+	if _, _, err := repo.InsertInboundCallback(ctx, CallbackSettleBT, "REF1", "TX1", payload); err != nil {
+		t.Fatal(err)
+	}
+	s.dispatchInboundCallbacks(ctx)
+	if stored := repo.callback(1); stored.status != CallbackProcessed {
+		t.Fatalf("stored = %+v, want the dispatcher to process it", stored)
+	}
+
+	// Claimed, then the process died before recording an outcome: the row
+	// waits out the lease
+	repo.requests["REF2"] = map[string]interface{}{"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1",
+		"selected_box": "1", "channel": "ussd", "ussd": "*463#", "game": "PawaBox"}
+	if _, _, err := repo.InsertInboundCallback(ctx, CallbackSettleBT, "REF2", "TX2", payload); err != nil {
+		t.Fatal(err)
+	}
+	if row, _ := repo.ClaimInboundCallback(ctx, 2, time.Minute); row == nil {
+		t.Fatal("claim failed")
+	}
+	repo.events = nil
+	s.dispatchInboundCallbacks(ctx)
+	if len(repo.events) != 0 {
+		t.Errorf("events = %v, want a leased row left alone", repo.events)
+	}
+	repo.mu.Lock()
+	repo.find(2).nextAttempt = time.Now().Add(-time.Second)
+	repo.mu.Unlock()
+	s.dispatchInboundCallbacks(ctx)
+	if stored := repo.callback(2); stored.status != CallbackProcessed || stored.attempts != 2 {
+		t.Errorf("stored = %+v, want it processed on a second attempt once the lease ran out", stored)
+	}
+}
+
+func TestSettleBTRedeliveryIsIdempotent(t *testing.T) {
+	callbackTunables(t, 3)
+	repo := newCallbackRepo()
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	ctx := context.Background()
+
+	cb, payload := settleBT("TX1")
+	for i := 0; i < 3; i++ {
+		if err := s.AcceptSettleBT(ctx, cb, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitCallbacks(t)
+	if len(repo.callbacks) != 1 {
+		t.Errorf("%d rows stored, want one per transaction", len(repo.callbacks))
+	}
+	balance := repo.player(testMsisdn).Balance
+
+	// The row comes due again after the round was played, as after a crash
+	// between playing and recording: it is processed without a second credit
+	repo.mu.Lock()
+	repo.find(1).status = CallbackPending
+	repo.find(1).nextAttempt = time.Now().Add(-time.Second)
+	repo.mu.Unlock()
+	s.dispatchInboundCallbacks(ctx)
+	stored := repo.callback(1)
+	if stored.status != CallbackProcessed || stored.lastError == "" {
+		t.Errorf("stored = %+v, want processed and noted as already processed", stored)
+	}
+	if got := repo.player(testMsisdn).Balance; got != balance {
+		t.Errorf("balance = %v after reprocessing, want %v", got, balance)
+	}
+}
+
+func TestInboundCallbackRetriesUntilFailed(t *testing.T) {
+	callbackTunables(t, 3)
+	repo := newCallbackRepo()
+	repo.depositErr = errors.New("deadlock detected")
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	ctx := context.Background()
+
+	cb, payload := settleBT("TX1")
+	if err := s.AcceptSettleBT(ctx, cb, payload); err != nil {
+		t.Fatal(err)
+	}
+	waitCallbacks(t)
+	stored := repo.callback(1)
+	if stored.status != CallbackPending || stored.lastError != "deadlock detected" {
+		t.Fatalf("after attempt 1 = %+v, want pending with the error", stored)
+	}
+	if wait := time.Until(stored.nextAttempt); wait < 500*time.Millisecond || wait > time.Second {
+		t.Errorf("next attempt in %v, want backoff_base", wait)
+	}
+
+	for attempt := 2; attempt <= 3; attempt++ {
+		repo.mu.Lock()
+		repo.find(1).nextAttempt = time.Now().Add(-time.Second)
+		repo.mu.Unlock()
+		s.dispatchInboundCallbacks(ctx)
+	}
+	if stored := repo.callback(1); stored.status != CallbackFailed || stored.attempts != 3 {
+		t.Fatalf("after max_attempts = %+v, want failed", stored)
+	}
+
+	if err := s.RetryInboundCallback("ops", 9); !errors.Is(err, ErrCallbackNotFound) {
+		t.Errorf("retry of an unknown callback = %v, want ErrCallbackNotFound", err)
+	}
+	repo.depositErr = nil
+	if err := s.RetryInboundCallback("ops", 1); err != nil {
+		t.Fatal(err)
+	}
+	s.dispatchInboundCallbacks(ctx)
+	if stored := repo.callback(1); stored.status != CallbackProcessed || stored.attempts != 1 {
+		t.Errorf("after the admin retry = %+v, want processed on a fresh attempt", stored)
+	}
+	if err := s.RetryInboundCallback("ops", 1); !errors.Is(err, ErrCallbackNotFailed) {
+		t.Errorf("retry of a processed callback = %v, want ErrCallbackNotFailed", err)
+	}
+}
+
+func TestCallbackBackoff(t *testing.T) {
+	callbackTunables(t, 6)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		if got := callbackBackoff(i + 1); got != w {
+			t.Errorf("backoff after attempt %d = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestListInboundCallbacksRejectsStatus(t *testing.T) {
+	s := newTestService(t, newCallbackRepo(), nil)
+	if _, err := s.ListInboundCallbacks("stuck", utils.Page{Number: 1, Size: 20}); !errors.Is(err, ErrCallbackStatus) {
+		t.Errorf("unknown status = %v, want ErrCallbackStatus", err)
+	}
+}
+
+var _ database.InboundCallbackRepo = (*callbackRepo)(nil)
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JackpotKittyBalance is one jackpot kitty reconciled against its ledger.
+// Expected is Opening + Contributions - Payouts; a kitty created after
+// migration 030 has no opening row and starts from 0.
+type JackpotKittyBalance struct {
+	ID                int64   `json:"id"`
+	NameInit          string  `json:"name_init"`
+	ItemName          string  `json:"item_name"`
+	Locked            bool    `json:"locked"`
+	Kitty             float64 `json:"kitty"`
+	Opening           float64 `json:"opening"`
+	Contributions     float64 `json:"contributions"`
+	ContributionCount int64   `json:"contribution_count"`
+	Payouts           float64 `json:"payouts"`
+	PayoutCount       int64   `json:"payout_count"`
+	Expected          float64 `json:"expected"`
+	Difference        float64 `json:"difference"` // Kitty - Expected
+	Balanced          bool    `json:"balanced"`
+}
+
+// ReconcileJackpots compares every jackpot kitty with the sum of its ledger
+func (s *LuckyNumberService) ReconcileJackpots() ([]JackpotKittyBalance, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := s.db.GetJackpotReconciliation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	kitties := make([]JackpotKittyBalance, 0, len(rows))
+	for _, row := range rows {
+		k := JackpotKittyBalance{
+			ID:                utils.ToInt64(row["id"]),
+			NameInit:          utils.ToString(row["name_init"]),
+			ItemName:          utils.ToString(row["item_name"]),
+			Locked:            utils.ToInt64(row["is_locked"]) != 0,
+			Kitty:             utils.ToFloat64(row["kitty"]),
+			Opening:           utils.ToFloat64(row["opening"]),
+			Contributions:     utils.ToFloat64(row["contributions"]),
+			ContributionCount: utils.ToInt64(row["contribution_count"]),
+			Payouts:           utils.ToFloat64(row["payouts"]),
+			PayoutCount:       utils.ToInt64(row["payout_count"]),
+		}
+		// To the cent: slices are fractions of a stake, and whole-shilling
+		// rounding would hide a kitty a shilling short
+		k.Expected = round2(k.Opening + k.Contributions - k.Payouts)
+		k.Difference = round2(k.Kitty - k.Expected)
+		k.Balanced = k.Difference == 0
+		kitties = append(kitties, k)
+	}
+	return kitties, nil
+}
+
+// JackpotIssueKind is a way a game and the jackpot kitties disagree
+type JackpotIssueKind string
+
+const (
+	// JackpotMissingKitty: an active game is flagged is_jackpot but no kitty
+	// has its name_init, so its bets contribute nothing
+	JackpotMissingKitty JackpotIssueKind = "missing_kitty"
+	// JackpotOrphanKitty: no game has the kitty's name_init, so nothing
+	// feeds it
+	JackpotOrphanKitty JackpotIssueKind = "orphan_kitty"
+	// JackpotUnflaggedGame: a game has a kitty's name_init but is not
+	// flagged is_jackpot, so its bets do not feed the kitty
+	JackpotUnflaggedGame JackpotIssueKind = "unflagged_game"
+)
+
+// JackpotIssue is one disagreement between "Games" and "jackpot_kitty".
+// GameID is empty for an orphan kitty and KittyID 0 for a missing one.
+type JackpotIssue struct {
+	Kind     JackpotIssueKind `json:"kind" example:"missing_kitty"`
+	NameInit string           `json:"name_init" example:"pawa_supa"`
+	GameID   string           `json:"game_id,omitempty"`
+	KittyID  int64            `json:"kitty_id,omitempty"`
+	Detail   string           `json:"detail"`
+}
+
+// JackpotConsistency is the result of cross-checking jackpot games against
+// jackpot kitties. Bets only feed a kitty when both sides agree, so every
+// issue is a kitty that is not being fed.
+type JackpotConsistency struct {
+	Consistent   bool           `json:"consistent"`
+	JackpotGames int            `json:"jackpot_games"` // active games flagged is_jackpot
+	Kitties      int            `json:"kitties"`
+	Issues       []JackpotIssue `json:"issues"`
+}
+
+// jackpotGameRow is a "Games" row as the consistency check reads it
+type jackpotGameRow struct {
+	ID, Name, NameInit, Status string
+	IsJackpot                  bool
+}
+
+// jackpotKittyRow is a "jackpot_kitty" row as the consistency check reads it
+type jackpotKittyRow struct {
+	ID       int64
+	NameInit string
+	ItemName string
+}
+
+// CheckJackpotConsistency cross-checks the games flagged is_jackpot, and
+// those sharing a name_init with a kitty, against the jackpot kitties
+func (s *LuckyNumberService) CheckJackpotConsistency(ctx context.Context) (JackpotConsistency, error) {
+	if s == nil || s.db == nil {
+		return JackpotConsistency{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	gameRows, err := s.db.ListJackpotGames(ctx)
+	if err != nil {
+		return JackpotConsistency{}, err
+	}
+	kittyRows, err := s.db.ListJackpotKitties(ctx)
+	if err != nil {
+		return JackpotConsistency{}, err
+	}
+
+	games := make([]jackpotGameRow, 0, len(gameRows))
+	for _, row := range gameRows {
+		games = append(games, jackpotGameRow{
+			ID:        utils.ToString(row["id"]),
+			Name:      utils.ToString(row["name"]),
+			NameInit:  utils.ToString(row["name_init"]),
+			Status:    utils.ToString(row["status"]),
+			IsJackpot: utils.ToBool(row["is_jackpot"]),
+		})
+	}
+	kitties := make([]jackpotKittyRow, 0, len(kittyRows))
+	for _, row := range kittyRows {
+		kitties = append(kitties, jackpotKittyRow{
+			ID:       utils.ToInt64(row["id"]),
+			NameInit: utils.ToString(row["name_init"]),
+			ItemName: utils.ToString(row["item_name"]),
+		})
+	}
+	return jackpotConsistency(games, kitties), nil
+}
+
+// jackpotConsistency reports where games and kitties disagree. Names are
+// matched exactly, as bets match them; a near miss in case or surrounding
+// space is named in the issue's Detail since it is most likely a typo.
+func jackpotConsistency(games []jackpotGameRow, kitties []jackpotKittyRow) JackpotConsistency {
+	report := JackpotConsistency{Kitties: len(kitties), Issues: []JackpotIssue{}}
+
+	kittyByName := make(map[string]jackpotKittyRow, len(kitties))
+	for _, k := range kitties {
+		kittyByName[k.NameInit] = k
+	}
+	gameNames := make(map[string]bool, len(games))
+	for _, g := range games {
+		gameNames[g.NameInit] = true
+	}
+
+	for _, g := range games {
+		kitty, hasKitty := kittyByName[g.NameInit]
+		switch {
+		case g.IsJackpot && !hasKitty:
+			if g.Status != "active" {
+				continue
+			}
+			detail := fmt.Sprintf("game %s (%s) is flagged is_jackpot but no jackpot_kitty has name_init %q", g.ID, g.Name, g.NameInit)
+			if near := nearName(g.NameInit, kittyNames(kitties)); near != "" {
+				detail += fmt.Sprintf("; a kitty has %q", near)
+			}
+			report.Issues = append(report.Issues, JackpotIssue{Kind: JackpotMissingKitty, NameInit: g.NameInit, GameID: g.ID, Detail: detail})
+		case !g.IsJackpot && hasKitty:
+			report.Issues = append(report.Issues, JackpotIssue{
+				Kind: JackpotUnflaggedGame, NameInit: g.NameInit, GameID: g.ID, KittyID: kitty.ID,
+				Detail: fmt.Sprintf("game %s (%s) shares name_init %q with kitty %d (%s) but is not flagged is_jackpot", g.ID, g.Name, g.NameInit, kitty.ID, kitty.ItemName),
+			})
+		}
+		if g.IsJackpot && g.Status == "active" {
+			report.JackpotGames++
+		}
+	}
+
+	for _, k := range kitties {
+		if gameNames[k.NameInit] {
+			continue
+		}
+		detail := fmt.Sprintf("kitty %d (%s) has name_init %q, which no game has", k.ID, k.ItemName, k.NameInit)
+		names := make([]string, 0, len(games))
+		for _, g := range games {
+			names = append(names, g.NameInit)
+		}
+		if near := nearName(k.NameInit, names); near != "" {
+			detail += fmt.Sprintf("; a game has %q", near)
+		}
+		report.Issues = append(report.Issues, JackpotIssue{Kind: JackpotOrphanKitty, NameInit: k.NameInit, KittyID: k.ID, Detail: detail})
+	}
+
+	report.Consistent = len(report.Issues) == 0
+	return report
+}
+
+func kittyNames(kitties []jackpotKittyRow) []string {
+	names := make([]string, 0, len(kitties))
+	for _, k := range kitties {
+		names = append(names, k.NameInit)
+	}
+	return names
+}
+
+// nearName returns the first of names that differs from name only in case
+// or surrounding space, or "" when none does
+func nearName(name string, names []string) string {
+	want := strings.ToLower(strings.TrimSpace(name))
+	for _, n := range names {
+		if n != name && strings.ToLower(strings.TrimSpace(n)) == want {
+			return n
+		}
+	}
+	return ""
+}
+
+// WarnJackpotInconsistencies logs a warning for each disagreement between
+// jackpot games and kitties. Run at startup; it never fails it.
+func (s *LuckyNumberService) WarnJackpotInconsistencies(ctx context.Context) {
+	report, err := s.CheckJackpotConsistency(ctx)
+	if err != nil {
+		logrus.Warnf("⚠️ Jackpot consistency check failed: %v", err)
+		return
+	}
+	for _, issue := range report.Issues {
+		logrus.Warnf("⚠️ Jackpot %s: %s", issue.Kind, issue.Detail)
+	}
+	if !report.Consistent {
+		logrus.Warnf("⚠️ %d jackpot configuration issues; see GET /api/v1/admin/jackpots/consistency", len(report.Issues))
+	}
+}
+
+// jackpotKittiesKey caches the name_inits that have a jackpot kitty
+const jackpotKittiesKey = "jackpot_kitties"
+
+// feedsJackpot reports whether a stake on game feeds a jackpot kitty: the
+// game must be flagged is_jackpot and a kitty must have its name_init.
+// Kitties are read through the lookup cache.
+func (s *LuckyNumberService) feedsJackpot(ctx context.Context, game database.Game) (bool, error) {
+	if !game.IsJackpot || game.NameInit == "" {
+		return false, nil
+	}
+	row, err := s.lookups.Get(ctx, jackpotKittiesKey, func(ctx context.Context) (map[string]interface{}, error) {
+		rows, err := s.db.ListJackpotKitties(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names := make(map[string]interface{}, len(rows))
+		for _, r := range rows {
+			names[utils.ToString(r["name_init"])] = true
+		}
+		return names, nil
+	})
+	if err != nil {
+		return false, err
+	}
+	_, ok := row[game.NameInit]
+	return ok, nil
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// jackpotLedgerRepo answers GetJackpotReconciliation with fixed rows
+type jackpotLedgerRepo struct {
+	*memRepo
+	rows []map[string]interface{}
+}
+
+func (r *jackpotLedgerRepo) GetJackpotReconciliation(ctx context.Context) ([]map[string]interface{}, error) {
+	return r.rows, nil
+}
+
+func TestReconcileJackpots(t *testing.T) {
+	repo := &jackpotLedgerRepo{memRepo: newMemRepo(), rows: []map[string]interface{}{
+		{"id": int64(1), "name_init": "pw", "item_name": "Phone", "is_locked": int32(0), "kitty": 2.5,
+			"opening": 100.0, "contributions": 202.5, "contribution_count": int64(40), "payouts": 300.0, "payout_count": int64(1)},
+		{"id": int64(2), "name_init": "pw", "item_name": "TV", "is_locked": int32(1), "kitty": 130.0,
+			"opening": 0.0, "contributions": 100.0, "contribution_count": int64(40), "payouts": 0.0, "payout_count": int64(0)},
+		{"id": int64(3), "name_init": "", "item_name": "Cash", "is_locked": int32(0), "kitty": 0.0},
+		{"id": int64(4), "name_init": "pw", "item_name": "Watch", "is_locked": int32(0), "kitty": 99.0,
+			"contributions": 100.0, "contribution_count": int64(10)},
+	}}
+	s := newTestService(t, repo, nil)
+
+	kitties, err := s.ReconcileJackpots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kitties) != 4 {
+		t.Fatalf("kitties = %+v, want 4", kitties)
+	}
+	if k := kitties[0]; !k.Balanced || k.Expected != 2.5 || k.Difference != 0 || k.ContributionCount != 40 || k.PayoutCount != 1 {
+		t.Errorf("kitty 1 = %+v, want balanced at 2.5 after its payout", k)
+	}
+	if k := kitties[1]; k.Balanced || !k.Locked || k.Expected != 100 || k.Difference != 30 {
+		t.Errorf("kitty 2 = %+v, want locked and 30 over its ledger", k)
+	}
+	if k := kitties[2]; !k.Balanced || k.Expected != 0 || k.NameInit != "" {
+		t.Errorf("kitty 3 = %+v, want an empty generic kitty, balanced", k)
+	}
+	if k := kitties[3]; k.Balanced || k.Difference != -1 {
+		t.Errorf("kitty 4 = %+v, want a shilling short of its ledger", k)
+	}
+}
+
+// kittyRepo serves jackpot games and kitties and records which kitty each
+// stake fed
+type kittyRepo struct {
+	*memRepo
+	jackpotGames, kitties []map[string]interface{}
+
+	mu         sync.Mutex
+	kittyReads int
+	fed        map[string]float64
+}
+
+func (r *kittyRepo) ListJackpotGames(ctx context.Context) ([]map[string]interface{}, error) {
+	return r.jackpotGames, nil
+}
+
+func (r *kittyRepo) ListJackpotKitties(ctx context.Context) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kittyReads++
+	return r.kitties, nil
+}
+
+func (r *kittyRepo) UpdateJackpotKitNameInit(ctx context.Context, reference string, mvalue float64, nameInit string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fed[nameInit] += mvalue
+	return 1, nil
+}
+
+func TestJackpotConsistencyIssues(t *testing.T) {
+	repo := &kittyRepo{memRepo: newMemRepo(),
+		jackpotGames: []map[string]interface{}{
+			{"id": "1", "name": "PawaBox", "name_init": "pw", "status": "active", "is_jackpot": true},
+			{"id": "2", "name": "Supa", "name_init": "pawa_supa", "status": "active", "is_jackpot": true},
+			{"id": "3", "name": "Mega", "name_init": "pw_mega", "status": "active", "is_jackpot": false},
+			{"id": "4", "name": "Retired", "name_init": "pw_old", "status": "inactive", "is_jackpot": true},
+			{"id": "5", "name": "Ist", "name_init": "pw_ist", "status": "active", "is_jackpot": true},
+		},
+		kitties: []map[string]interface{}{
+			{"id": int64(10), "name_init": "pw", "item_name": "Phone"},
+			{"id": int64(11), "name_init": "Pawa_Supa ", "item_name": "TV"},
+			{"id": int64(12), "name_init": "pw_mega", "item_name": "Car"},
+			{"id": int64(13), "name_init": "pw_ist", "item_name": "Bike"},
+		},
+	}
+	s := newTestService(t, repo, nil)
+
+	report, err := s.CheckJackpotConsistency(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Consistent || report.JackpotGames != 3 || report.Kitties != 4 || len(report.Issues) != 3 {
+		t.Fatalf("report = %+v, want 3 flagged active games, 4 kitties and 3 issues", report)
+	}
+	missing, unflagged, orphan := report.Issues[0], report.Issues[1], report.Issues[2]
+	if missing.Kind != JackpotMissingKitty || missing.GameID != "2" || missing.KittyID != 0 || !strings.Contains(missing.Detail, `a kitty has "Pawa_Supa "`) {
+		t.Errorf("missing kitty issue = %+v, want game 2 pointing at the near-miss kitty name", missing)
+	}
+	if unflagged.Kind != JackpotUnflaggedGame || unflagged.GameID != "3" || unflagged.KittyID != 12 {
+		t.Errorf("unflagged game issue = %+v, want game 3 and kitty 12", unflagged)
+	}
+	if orphan.Kind != JackpotOrphanKitty || orphan.KittyID != 11 || orphan.GameID != "" || !strings.Contains(orphan.Detail, `a game has "pawa_supa"`) {
+		t.Errorf("orphan kitty issue = %+v, want kitty 11 pointing at the near-miss game name", orphan)
+	}
+
+	// Fixing the typo and the flag leaves only the retired game, which is not an issue
+	repo.kitties[1]["name_init"] = "pawa_supa"
+	repo.jackpotGames[2]["is_jackpot"] = true
+	report, err = s.CheckJackpotConsistency(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Consistent || len(report.Issues) != 0 || report.JackpotGames != 4 {
+		t.Errorf("report = %+v, want consistent with 4 jackpot games", report)
+	}
+}
+
+func TestStakeFeedsJackpotOnlyWhenBothAgree(t *testing.T) {
+	cases := []struct {
+		name      string
+		isJackpot bool
+		kitty     string
+		fed       bool
+	}{
+		{"flagged with a kitty", true, "pw", true},
+		{"flagged without a kitty", true, "pw_other", false},
+		{"kitty but not flagged", false, "pw", false},
+		{"neither", false, "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := &kittyRepo{memRepo: newMemRepo(), fed: map[string]float64{}}
+			repo.addPlayer(testMsisdn, 1000)
+			repo.games["1"].NameInit, repo.games["1"].IsJackpot = "pw", tc.isJackpot
+			if tc.kitty != "" {
+				repo.kitties = []map[string]interface{}{{"id": int64(1), "name_init": tc.kitty}}
+			}
+			s := newTestService(t, repo, fixedOutcomes{"3": 0})
+
+			for i := 0; i < 3; i++ {
+				placeTestBet(t, s, repo.memRepo, 20, "3")
+			}
+			if fed := len(repo.fed) > 0; fed != tc.fed {
+				t.Errorf("kitties fed = %v, want fed %v", repo.fed, tc.fed)
+			}
+			if tc.fed && (repo.fed["pw"] <= 0 || len(repo.fed) != 1) {
+				t.Errorf("kitties fed = %v, want only pw", repo.fed)
+			}
+			if tc.isJackpot && repo.kittyReads != 1 {
+				t.Errorf("kitties read %d times for 3 bets, want once through the cache", repo.kittyReads)
+			}
+			if !tc.isJackpot && repo.kittyReads != 0 {
+				t.Errorf("kitties read for a game that is not flagged")
+			}
+		})
+	}
+}
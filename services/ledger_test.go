@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var ledgerSeed = flag.Int64("ledger.seed", 0, "replay the ledger invariant test with this seed only")
+
+// ledgerRepo is the repo a simulated day of activity runs against. It
+// records every call that moves a wallet, so the invariants below compare
+// the end state with what the calls said they did.
+type ledgerRepo struct {
+	*withdrawalRepo
+	rev      *reversalRepo                     // ReverseDeposit over the same memRepo
+	requests map[string]map[string]interface{} // deposit_requests by reference
+
+	lmu         sync.Mutex
+	deposits    float64 // credited by deposit callbacks
+	stakes      float64 // debited from cash and bonus
+	bonusWins   float64 // bonus-funded shares of wins, back in the bonus wallet
+	withdrawals float64
+	clawbacks   float64 // taken back by deposit reversals
+}
+
+func newLedgerRepo() *ledgerRepo {
+	r := &ledgerRepo{withdrawalRepo: newWithdrawalRepo(), requests: map[string]map[string]interface{}{}}
+	r.settings.WithdrawalMaxCount = 1000
+	r.settings.WithdrawalMaxAmount = 1e9
+	r.rev = newReversalRepo()
+	r.rev.memRepo = r.memRepo
+	return r
+}
+
+func (r *ledgerRepo) add(total *float64, amount float64) {
+	r.lmu.Lock()
+	defer r.lmu.Unlock()
+	*total += amount
+}
+
+func (r *ledgerRepo) UpdateUserAviatorBalInfoLucky(ctx context.Context, amount float64, msisdn, name string) (int64, error) {
+	n, err := r.memRepo.UpdateUserAviatorBalInfoLucky(ctx, amount, msisdn, name)
+	if err == nil && n > 0 {
+		r.add(&r.deposits, amount)
+	}
+	return n, err
+}
+
+func (r *ledgerRepo) DebitStake(ctx context.Context, msisdn, reference string, amount float64, bonusFirst bool) (float64, float64, error) {
+	return r.DebitStakes(ctx, msisdn, []database.Stake{{Reference: reference, Amount: amount}}, bonusFirst)
+}
+
+func (r *ledgerRepo) DebitStakes(ctx context.Context, msisdn string, stakes []database.Stake, bonusFirst bool) (float64, float64, error) {
+	cash, bonus, err := r.memRepo.DebitStakes(ctx, msisdn, stakes, bonusFirst)
+	if err == nil {
+		r.add(&r.stakes, cash+bonus)
+	}
+	return cash, bonus, err
+}
+
+func (r *ledgerRepo) CreditBonusWin(ctx context.Context, reference string, amount float64) (float64, error) {
+	share, err := r.memRepo.CreditBonusWin(ctx, reference, amount)
+	if err == nil {
+		r.add(&r.bonusWins, share)
+	}
+	return share, err
+}
+
+func (r *ledgerRepo) WithdrawBalance(ctx context.Context, msisdn string, amount float64, reference string, limits database.WithdrawalLimits) (float64, error) {
+	balance, err := r.withdrawalRepo.WithdrawBalance(ctx, msisdn, amount, reference, limits)
+	if err == nil {
+		r.add(&r.withdrawals, amount)
+	}
+	return balance, err
+}
+
+func (r *ledgerRepo) ReverseDeposit(ctx context.Context, transactionID, reversalReference, description string, allowNegative bool) (map[string]interface{}, bool, error) {
+	row, applied, err := r.rev.ReverseDeposit(ctx, transactionID, reversalReference, description, allowNegative)
+	if err == nil && applied {
+		r.add(&r.clawbacks, row["clawed_back"].(float64))
+	}
+	return row, applied, err
+}
+
+func (r *ledgerRepo) ReverseKPIDeposit(ctx context.Context, transactionID string, mvalue float64) (int64, error) {
+	return r.rev.ReverseKPIDeposit(ctx, transactionID, mvalue)
+}
+
+func (r *ledgerRepo) CheckTransaction(ctx context.Context, transactionID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *ledgerRepo) CheckDepositRequestLucky(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests[reference], nil
+}
+
+// randomOutcomes lays out boxes from a seeded source: mostly losses, the
+// rest wins of one to three stakes
+type randomOutcomes struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func (o *randomOutcomes) GenerateWinAmounts(ctx context.Context, params GenerateWinAmountsParams) (map[string]WinAmount, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	boxes := make(map[string]WinAmount, defaultBoxes)
+	for box := 1; box <= defaultBoxes; box++ {
+		v := 0.0
+		if o.rng.Intn(3) == 0 {
+			v = params.BetAmount * float64(1+o.rng.Intn(3))
+		}
+		boxes[fmt.Sprint(box)] = WinAmount{Value: v, Item: FormatToMZN(v)}
+	}
+	return boxes, nil
+}
+
+// ledgerDay is one simulated day: the service, its repo and what the
+// players staked and deposited according to the simulation itself
+type ledgerDay struct {
+	t          *testing.T
+	seed       int64
+	rng        *rand.Rand
+	repo       *ledgerRepo
+	s          *LuckyNumberService
+	players    []string
+	reversible []string // transaction ids of deposits not yet reversed
+	freeStakes float64
+	paidStakes float64
+	trace      []string
+	next       int
+}
+
+// fail reports an invariant that does not hold, with the seed to replay it
+// and the last operations
+func (d *ledgerDay) fail(format string, args ...interface{}) {
+	d.t.Helper()
+	from := max(len(d.trace)-5, 0)
+	d.t.Errorf("seed %d: %s\nlast operations:\n  %s\nreplay with -run TestLedgerInvariants -ledger.seed=%d",
+		d.seed, fmt.Sprintf(format, args...), strings.Join(d.trace[from:], "\n  "), d.seed)
+}
+
+func (d *ledgerDay) ref(prefix string) string {
+	d.next++
+	return fmt.Sprintf("%s%d", prefix, d.next)
+}
+
+func (d *ledgerDay) bet() {
+	msisdn := d.players[d.rng.Intn(len(d.players))]
+	stake := float64(10 * (1 + d.rng.Intn(20)))
+	box := fmt.Sprint(1 + d.rng.Intn(defaultBoxes))
+	user, _ := d.repo.CheckUser(context.Background(), msisdn)
+	result, err := d.s.PlaceBet(context.Background(), user, "", "Test", "1", msisdn, stake, box, "web")
+	d.trace = append(d.trace, fmt.Sprintf("bet %v by %s on box %s: %v %v", stake, msisdn, box, result.GameResult.ResultStatus, err))
+	switch {
+	case errors.Is(err, database.ErrInsufficientBalance):
+	case err != nil:
+		d.fail("bet: %v", err)
+	case result.FreeBet == "true":
+		d.freeStakes += stake
+	default:
+		d.paidStakes += stake
+	}
+}
+
+func (d *ledgerDay) depositAndPlay() {
+	msisdn := d.players[d.rng.Intn(len(d.players))]
+	amount := float64(10 * (1 + d.rng.Intn(30)))
+	reference, tx := d.ref("DEP"), d.ref("QK")
+	d.repo.mu.Lock()
+	d.repo.requests[reference] = map[string]interface{}{
+		"msisdn": msisdn, "amount": amount, "game_cat_id": "1", "selected_box": fmt.Sprint(1 + d.rng.Intn(defaultBoxes)),
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+	d.repo.rev.deposits[tx] = &memDeposit{Reference: reference, Msisdn: msisdn, Amount: amount, Status: status.DepositSuccess}
+	d.repo.mu.Unlock()
+
+	err := d.s.HandleDepositAndGame(models.SettlementCallback{TransactionID: models.FlexString(tx), Reference: reference})
+	d.trace = append(d.trace, fmt.Sprintf("deposit %v by %s as %s: %v", amount, msisdn, tx, err))
+	if err != nil {
+		d.fail("deposit: %v", err)
+		return
+	}
+	d.paidStakes += amount
+	d.reversible = append(d.reversible, tx)
+}
+
+func (d *ledgerDay) grantFreeBet() {
+	msisdn := d.players[d.rng.Intn(len(d.players))]
+	d.repo.mu.Lock()
+	p := d.repo.players[msisdn]
+	p.FreeBet++
+	p.FreeBetEnds = time.Now().Add(time.Hour)
+	d.repo.mu.Unlock()
+	d.trace = append(d.trace, "free bet for "+msisdn)
+}
+
+func (d *ledgerDay) withdraw() {
+	msisdn := d.players[d.rng.Intn(len(d.players))]
+	balance := d.repo.player(msisdn).Balance
+	if balance < 1 {
+		return
+	}
+	amount := float64(1 + d.rng.Intn(int(math.Min(balance, 999))))
+	_, err := d.s.Withdraw(msisdn, amount, "")
+	d.trace = append(d.trace, fmt.Sprintf("withdraw %v by %s: %v", amount, msisdn, err))
+	if err != nil {
+		d.fail("withdraw: %v", err)
+	}
+}
+
+func (d *ledgerDay) reverse() {
+	if len(d.reversible) == 0 {
+		return
+	}
+	i := d.rng.Intn(len(d.reversible))
+	tx := d.reversible[i]
+	d.reversible = append(d.reversible[:i], d.reversible[i+1:]...)
+	r, err := d.s.ReverseDeposit(models.ReversalCallback{
+		TransactionID: models.FlexString(tx), ReversalReference: models.FlexString(d.ref("RV")), Description: "customer dispute",
+	})
+	d.trace = append(d.trace, fmt.Sprintf("reverse %s: clawed back %v, %v", tx, r.ClawedBack, err))
+	if err != nil {
+		d.fail("reverse: %v", err)
+	}
+}
+
+// wallets sums what the players hold in cash and bonus
+func (d *ledgerDay) wallets() float64 {
+	d.repo.mu.Lock()
+	defer d.repo.mu.Unlock()
+	var total float64
+	for _, p := range d.repo.players {
+		total += p.Balance + p.Bonus
+	}
+	return total
+}
+
+func (d *ledgerDay) checkNoNegative() {
+	d.t.Helper()
+	d.repo.mu.Lock()
+	defer d.repo.mu.Unlock()
+	for _, p := range d.repo.players {
+		if p.Balance < 0 || p.Bonus < 0 {
+			d.fail("%s holds %v cash and %v bonus", p.Msisdn, p.Balance, p.Bonus)
+		}
+	}
+	if d.repo.basket < 0 {
+		d.fail("basket at %v", d.repo.basket)
+	}
+}
+
+// runLedgerDay plays ops random operations from seed and checks the
+// invariants as it goes and at the end
+func runLedgerDay(t *testing.T, seed int64, ops int) {
+	repo := newLedgerRepo()
+	d := &ledgerDay{t: t, seed: seed, rng: rand.New(rand.NewSource(seed)), repo: repo}
+	for i := 0; i < 5; i++ {
+		msisdn := fmt.Sprintf("2547000000%02d", i)
+		p := repo.addPlayer(msisdn, float64(d.rng.Intn(50)*10))
+		p.Bonus = float64(d.rng.Intn(10) * 10)
+		d.players = append(d.players, msisdn)
+	}
+	d.s = newTestService(t, repo, &randomOutcomes{rng: rand.New(rand.NewSource(seed))})
+	startWallets, startBasket := d.wallets(), repo.basket
+	vig := repo.settings.VigPercentage
+
+	for i := 0; i < ops; i++ {
+		switch n := d.rng.Intn(20); {
+		case n < 8:
+			d.bet()
+		case n < 13:
+			d.depositAndPlay()
+		case n < 15:
+			d.grantFreeBet()
+		case n < 18:
+			d.withdraw()
+		default:
+			d.reverse()
+		}
+		d.checkNoNegative()
+		if t.Failed() {
+			return
+		}
+	}
+
+	// Every shilling in or out of the wallets went through a recorded call
+	want := repo.deposits - repo.stakes + repo.bonusWins - repo.withdrawals - repo.clawbacks
+	if got := d.wallets() - startWallets; !nearLedger(got, want) {
+		d.fail("wallets moved %.2f, want deposits %.2f - stakes %.2f + bonus wins %.2f - withdrawals %.2f - clawbacks %.2f = %.2f",
+			got, repo.deposits, repo.stakes, repo.bonusWins, repo.withdrawals, repo.clawbacks, want)
+	}
+	if !nearLedger(repo.stakes, d.paidStakes) {
+		d.fail("debited %.2f in stakes, the paid bets staked %.2f", repo.stakes, d.paidStakes)
+	}
+
+	// The basket takes the stakes less the vig and pays the wins it covered
+	var wins float64
+	for _, b := range repo.bets {
+		if b.Status == status.ResultWin {
+			wins += b.WinAmount
+		}
+	}
+	covered := wins - repo.reserved
+	want = d.paidStakes*(100-vig)/100 - covered
+	if got := repo.basket - startBasket; !nearLedger(got, want) {
+		d.fail("basket moved %.2f, want stakes %.2f less %v%% vig - wins %.2f = %.2f", got, d.paidStakes, vig, covered, want)
+	}
+
+	// The KPI handle counts the paid stakes, free bets apart
+	if !nearLedger(repo.kpi.Handle, d.paidStakes) || !nearLedger(repo.house.TotalBets, d.paidStakes) {
+		d.fail("kpi handle %.2f and house bets %.2f, want the %.2f staked", repo.kpi.Handle, repo.house.TotalBets, d.paidStakes)
+	}
+	if !nearLedger(repo.kpi.FreeBetStake, d.freeStakes) {
+		d.fail("kpi free bet stake %.2f, want %.2f", repo.kpi.FreeBetStake, d.freeStakes)
+	}
+}
+
+// nearLedger compares totals built from many rounded amounts
+func nearLedger(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+// TestLedgerInvariants simulates days of deposits, bets, free bets,
+// withdrawals and reversals and checks the money adds up. A failure names
+// its seed; -ledger.seed replays that day alone.
+func TestLedgerInvariants(t *testing.T) {
+	configureTestOTP(t)
+	seeds := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	if *ledgerSeed != 0 {
+		seeds = []int64{*ledgerSeed}
+	}
+	for _, seed := range seeds {
+		runLedgerDay(t, seed, 200)
+	}
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultLookupCacheTTL = 5 * time.Second
+	defaultLookupMissTTL  = time.Second
+	maxLookupCacheEntries = 1024
+)
+
+// LookupCacheStats reports how often game and setting lookups reach the database
+type LookupCacheStats struct {
+	Size    int     `json:"size"`
+	Hits    uint64  `json:"hits"`
+	Misses  uint64  `json:"misses"`
+	Shared  uint64  `json:"shared"` // misses answered by a query shared with other callers
+	HitRate float64 `json:"hit_rate"`
+}
+
+type lookupEntry struct {
+	row       map[string]interface{} // nil caches a missing row
+	expiresAt time.Time
+}
+
+// lookupCache caches single-row lookups such as "Games" by id and
+// "PawaBox_KeSettings". Concurrent misses for the same key share one query,
+// and missing rows are cached for a shorter time so probes for random ids
+// cannot stampede the pool. Errors are never cached.
+type lookupCache struct {
+	mu      sync.RWMutex
+	ttl     time.Duration
+	missTTL time.Duration
+	items   map[string]lookupEntry
+	group   singleflight.Group
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	shared atomic.Uint64
+}
+
+func newLookupCache(ttl, missTTL time.Duration) *lookupCache {
+	if ttl <= 0 {
+		ttl = defaultLookupCacheTTL
+	}
+	if missTTL <= 0 {
+		missTTL = defaultLookupMissTTL
+	}
+	return &lookupCache{
+		ttl:     ttl,
+		missTTL: missTTL,
+		items:   make(map[string]lookupEntry),
+	}
+}
+
+// Get returns the row for key, calling load at most once per key at a time
+func (c *lookupCache) Get(ctx context.Context, key string, load func(context.Context) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	c.mu.RLock()
+	entry, ok := c.items[key]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		c.hits.Add(1)
+		return copyRow(entry.row), nil
+	}
+	c.misses.Add(1)
+
+	v, err, shared := c.group.Do(key, func() (interface{}, error) {
+		row, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.set(key, row)
+		return row, nil
+	})
+	if shared {
+		c.shared.Add(1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	row, _ := v.(map[string]interface{})
+	return copyRow(row), nil
+}
+
+func (c *lookupCache) set(key string, row map[string]interface{}) {
+	ttl := c.ttl
+	if row == nil {
+		ttl = c.missTTL
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.items) >= maxLookupCacheEntries {
+		for k, e := range c.items {
+			if now.After(e.expiresAt) {
+				delete(c.items, k)
+			}
+		}
+		// Still full of live entries: start over rather than grow unbounded
+		if len(c.items) >= maxLookupCacheEntries {
+			c.items = make(map[string]lookupEntry)
+		}
+	}
+	c.items[key] = lookupEntry{row: row, expiresAt: now.Add(ttl)}
+}
+
+// Forget drops key so the next Get reloads it
+func (c *lookupCache) Forget(key string) {
+	c.mu.Lock()
+	delete(c.items, key)
+	c.mu.Unlock()
+	c.group.Forget(key)
+}
+
+// ForgetPrefix drops every key starting with prefix
+func (c *lookupCache) ForgetPrefix(prefix string) {
+	c.mu.Lock()
+	for k := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.items, k)
+			c.group.Forget(k)
+		}
+	}
+	c.mu.Unlock()
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *lookupCache) Stats() LookupCacheStats {
+	c.mu.RLock()
+	size := len(c.items)
+	c.mu.RUnlock()
+
+	hits := c.hits.Load()
+	misses := c.misses.Load()
+	var hitRate float64
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+	return LookupCacheStats{
+		Size:    size,
+		Hits:    hits,
+		Misses:  misses,
+		Shared:  c.shared.Load(),
+		HitRate: hitRate,
+	}
+}
+
+// copyRow returns a shallow copy so callers never share the cached map
+func copyRow(row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingGameRepo counts GetGame queries and holds each one until release
+// is closed, so concurrent lookups pile up behind the first
+type countingGameRepo struct {
+	database.LuckyRepo
+	queries atomic.Int32
+	release chan struct{}
+}
+
+func (r *countingGameRepo) GetGame(ctx context.Context, gameCatID string) (*database.Game, error) {
+	r.queries.Add(1)
+	<-r.release
+	if gameCatID != "1" {
+		return nil, nil
+	}
+	return &database.Game{ID: "1", Name: "Lucky Box", Status: "1"}, nil
+}
+
+func TestLookupCacheSharesConcurrentQueries(t *testing.T) {
+	repo := &countingGameRepo{release: make(chan struct{})}
+	s := &LuckyNumberService{db: repo, lookups: newLookupCache(time.Minute, time.Minute)}
+
+	const callers = 50
+	var wg sync.WaitGroup
+	var found atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			game, err := s.game(context.Background(), "1")
+			if err == nil && game != nil && game.ID == "1" {
+				found.Add(1)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(repo.release)
+	wg.Wait()
+
+	if got := repo.queries.Load(); got != 1 {
+		t.Errorf("%d concurrent lookups ran %d queries, want 1", callers, got)
+	}
+	if found.Load() != callers {
+		t.Errorf("%d of %d callers got the game", found.Load(), callers)
+	}
+	st := s.LookupCacheStats()
+	if st.Hits+st.Misses != callers || st.Size != 1 {
+		t.Errorf("stats = %+v, want %d lookups over one entry", st, callers)
+	}
+}
+
+func TestLookupCacheCachesMissingRows(t *testing.T) {
+	repo := &countingGameRepo{release: make(chan struct{})}
+	close(repo.release)
+	s := &LuckyNumberService{db: repo, lookups: newLookupCache(time.Minute, 30*time.Millisecond)}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if game, err := s.game(ctx, "999"); err != nil || game != nil {
+			t.Fatalf("missing game = %+v, %v; want nil", game, err)
+		}
+	}
+	if got := repo.queries.Load(); got != 1 {
+		t.Errorf("probing a missing id ran %d queries, want 1", got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	s.game(ctx, "999")
+	if got := repo.queries.Load(); got != 2 {
+		t.Errorf("queries after the miss TTL = %d, want 2", got)
+	}
+}
+
+func TestLookupCacheDoesNotCacheErrors(t *testing.T) {
+	c := newLookupCache(time.Minute, time.Minute)
+	ctx := context.Background()
+	var loads int
+	fail := errors.New("pool exhausted")
+	load := func(context.Context) (map[string]interface{}, error) {
+		loads++
+		if loads == 1 {
+			return nil, fail
+		}
+		return map[string]interface{}{"rtp": 85.0}, nil
+	}
+
+	if _, err := c.Get(ctx, "setting", load); !errors.Is(err, fail) {
+		t.Fatalf("first load = %v, want the error", err)
+	}
+	row, err := c.Get(ctx, "setting", load)
+	if err != nil || row["rtp"] != 85.0 || loads != 2 {
+		t.Fatalf("retry = %v, %v after %d loads; want the row from a second load", row, err, loads)
+	}
+
+	// Callers get their own copy of the cached row
+	row["rtp"] = 0.0
+	if again, _ := c.Get(ctx, "setting", load); again["rtp"] != 85.0 {
+		t.Error("a caller's change leaked into the cache")
+	}
+
+	c.Forget("setting")
+	c.Get(ctx, "setting", load)
+	if loads != 3 {
+		t.Errorf("loads after Forget = %d, want 3", loads)
+	}
+}
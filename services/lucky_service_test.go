@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// winnersRepo serves GetRecentWinners rows and records what it was asked for
+type winnersRepo struct {
+	database.LuckyRepo
+	rows  []map[string]interface{}
+	calls int
+	limit int
+	min   float64
+	game  string
+}
+
+func (r *winnersRepo) GetRecentWinners(ctx context.Context, limit int, minAmount float64, gameCatID string) ([]map[string]interface{}, error) {
+	r.calls++
+	r.limit, r.min, r.game = limit, minAmount, gameCatID
+	return r.rows, nil
+}
+
+func newWinnersService(repo database.LuckyRepo) *LuckyNumberService {
+	return &LuckyNumberService{db: repo, lookups: newLookupCache(time.Minute, time.Minute)}
+}
+
+func TestRecentWinnersMasksAndWhitelists(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	repo := &winnersRepo{rows: []map[string]interface{}{
+		{"msisdn": "254712345678", "items": "KES 500", "amount": 500.0, "game_name": "PawaBox", "date_created": created,
+			"tax_amount": 100.0, "reference": "REF123"},
+		{"msisdn": "", "items": "Smart TV", "amount": 30000.0, "game_name": "PawaBox", "date_created": created},
+	}}
+	winners, err := newWinnersService(repo).GetRecentWinners(5, 0, " 3 ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(winners) != 2 {
+		t.Fatalf("got %d winners, want 2", len(winners))
+	}
+	if got := winners[0].Msisdn; got != "2547****5678" {
+		t.Errorf("msisdn = %q, want masked 2547****5678", got)
+	}
+	if got := winners[1].Msisdn; got != AnonymousWinner {
+		t.Errorf("opted-out msisdn = %q, want %q", got, AnonymousWinner)
+	}
+	if got := winners[0].DateCreated; got != "2026-03-01T12:00:00Z" {
+		t.Errorf("date_created = %q", got)
+	}
+	if repo.game != "3" {
+		t.Errorf("game filter = %q, want trimmed 3", repo.game)
+	}
+
+	raw, _ := json.Marshal(winners[0])
+	var fields map[string]interface{}
+	json.Unmarshal(raw, &fields)
+	var keys []string
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if got := strings.Join(keys, ","); got != "amount,date_created,game_name,item,msisdn" {
+		t.Errorf("winner fields = %s, want only the whitelisted ones", got)
+	}
+	if strings.Contains(string(raw), "REF123") || strings.Contains(string(raw), "254712345678") {
+		t.Errorf("winner leaks internal values: %s", raw)
+	}
+}
+
+func TestRecentWinnersClampsLimitAndMinimum(t *testing.T) {
+	defer func(l float64) { limits.WinnersMinAmount = l }(limits.WinnersMinAmount)
+	limits.WinnersMinAmount = 100
+
+	repo := &winnersRepo{}
+	s := newWinnersService(repo)
+	if _, err := s.GetRecentWinners(500, 20, ""); err != nil {
+		t.Fatal(err)
+	}
+	if repo.limit != maxWinnersLimit || repo.min != 100 {
+		t.Errorf("asked for limit %d, min %v; want %d and the 100 floor", repo.limit, repo.min, maxWinnersLimit)
+	}
+	if _, err := s.GetRecentWinners(0, 250, ""); err != nil {
+		t.Fatal(err)
+	}
+	if repo.limit != defaultWinnersLimit || repo.min != 250 {
+		t.Errorf("asked for limit %d, min %v; want %d and 250", repo.limit, repo.min, defaultWinnersLimit)
+	}
+
+	// The same feed again is served from the lookup cache
+	s.GetRecentWinners(0, 250, "")
+	if repo.calls != 2 {
+		t.Errorf("database read %d times, want 2", repo.calls)
+	}
+}
+
+// deactivate marks game gameCatID inactive and drops the cached row, as
+// limits.lookup_cache_ttl passing would
+func deactivate(s *LuckyNumberService, repo *memRepo, gameCatID string) {
+	repo.mu.Lock()
+	repo.games[gameCatID].Status = "inactive"
+	repo.mu.Unlock()
+	s.lookups.Forget("game:" + gameCatID)
+}
+
+func TestDeactivatedGameRefusesBets(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	if err := betOn(s, repo, "1"); err != nil {
+		t.Fatalf("bet on the active game = %v", err)
+	}
+
+	deactivate(s, repo.memRepo, "1")
+	if err := betOn(s, repo, "1"); !errors.Is(err, ErrUnknownGame) {
+		t.Errorf("bet on the deactivated game = %v, want ErrUnknownGame", err)
+	}
+	if _, err := s.GetPlayableGame(context.Background(), "1"); !errors.Is(err, ErrUnknownGame) {
+		t.Errorf("GetPlayableGame = %v, want ErrUnknownGame", err)
+	}
+	if p := repo.player(testMsisdn); p.Balance != 90 || len(repo.bets) != 1 {
+		t.Errorf("balance %v with %d bets, want the refused bet to take nothing", p.Balance, len(repo.bets))
+	}
+	if err := betOn(s, repo, "2"); err != nil {
+		t.Errorf("bet on another game = %v", err)
+	}
+}
+
+func TestDeactivatedGameResolvesFundedRounds(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40, "2": 0})
+	repo.deposits["REF1"] = map[string]interface{}{
+		"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1", "selected_box": "1",
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+
+	// The deposit was funded before the game was switched off
+	deactivate(s, repo.memRepo, "1")
+	if err := s.HandleDepositAndGame(models.SettlementCallback{TransactionID: "QK1", Reference: "REF1"}); err != nil {
+		t.Fatalf("callback for a deactivated game: %v", err)
+	}
+	b := repo.bets["REF1"]
+	if b == nil || b.Status != status.ResultWin || b.Amount != 20 {
+		t.Errorf("bet = %+v, want the funded 20 played and won", b)
+	}
+}
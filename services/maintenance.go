@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Maintenance scopes
+const (
+	MaintenanceGlobal = "global"
+	MaintenanceGame   = "game"
+)
+
+// maintenanceKey is the lookup cache key of the switches. Every worker
+// rereads them after limits.lookup_cache_ttl, so a change reaches all of
+// them within that time.
+const maintenanceKey = "maintenance"
+
+var ErrInvalidMaintenance = errors.New("invalid maintenance switch")
+
+// MaintenanceSwitch pauses betting, and for the global scope deposits, until
+// an admin turns it back on
+type MaintenanceSwitch struct {
+	Scope           string     `json:"scope" example:"game"`
+	GameCatID       string     `json:"game_cat_id,omitempty" example:"1"`
+	BettingEnabled  bool       `json:"betting_enabled"`
+	DepositsEnabled bool       `json:"deposits_enabled"`
+	Message         string     `json:"message,omitempty"`
+	UpdatedBy       string     `json:"updated_by,omitempty"`
+	DateUpdated     *time.Time `json:"date_updated,omitempty"`
+}
+
+// MaintenanceState is what /health and the admin API report: the global
+// switch and the games with betting paused
+type MaintenanceState struct {
+	BettingEnabled  bool                `json:"betting_enabled"`
+	DepositsEnabled bool                `json:"deposits_enabled"`
+	Message         string              `json:"message,omitempty"`
+	PausedGames     []MaintenanceSwitch `json:"paused_games"`
+}
+
+// MaintenanceError is returned for a bet or deposit made while it is paused
+type MaintenanceError struct {
+	Deposits bool   // deposits rather than betting are paused
+	Message  string // the admin's message; "" uses the default text
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Deposits {
+		return "deposits are paused for maintenance"
+	}
+	return "betting is paused for maintenance"
+}
+
+// MaintenanceSwitches returns the stored switches through the lookup cache
+func (s *LuckyNumberService) MaintenanceSwitches(ctx context.Context) ([]MaintenanceSwitch, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.lookups.Get(ctx, maintenanceKey, func(ctx context.Context) (map[string]interface{}, error) {
+		rows, err := s.db.ListMaintenanceSwitches(ctx)
+		if err != nil {
+			return nil, err
+		}
+		switches := make([]MaintenanceSwitch, 0, len(rows))
+		for _, r := range rows {
+			sw := MaintenanceSwitch{
+				Scope:           utils.ToString(r["scope"]),
+				GameCatID:       utils.ToString(r["game_cat_id"]),
+				BettingEnabled:  utils.ToBool(r["betting_enabled"]),
+				DepositsEnabled: utils.ToBool(r["deposits_enabled"]),
+				Message:         utils.ToString(r["message"]),
+				UpdatedBy:       utils.ToString(r["updated_by"]),
+			}
+			if d, ok := r["date_updated"].(time.Time); ok {
+				sw.DateUpdated = &d
+			}
+			switches = append(switches, sw)
+		}
+		return map[string]interface{}{"switches": switches}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	switches, _ := row["switches"].([]MaintenanceSwitch)
+	return switches, nil
+}
+
+// GetMaintenance returns the current maintenance state
+func (s *LuckyNumberService) GetMaintenance(ctx context.Context) (MaintenanceState, error) {
+	switches, err := s.MaintenanceSwitches(ctx)
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+	state := MaintenanceState{BettingEnabled: true, DepositsEnabled: true, PausedGames: []MaintenanceSwitch{}}
+	for _, sw := range switches {
+		switch {
+		case sw.Scope == MaintenanceGlobal:
+			state.BettingEnabled = sw.BettingEnabled
+			state.DepositsEnabled = sw.DepositsEnabled
+			state.Message = sw.Message
+		case !sw.BettingEnabled:
+			state.PausedGames = append(state.PausedGames, sw)
+		}
+	}
+	return state, nil
+}
+
+// SetMaintenance sets the switch for scope and gameCatID on behalf of
+// admin. A nil bettingEnabled or depositsEnabled keeps the current value.
+// Deposits are not per game, so a game switch cannot pause them. The change
+// applies here at once and in other processes within
+// limits.lookup_cache_ttl.
+func (s *LuckyNumberService) SetMaintenance(admin, scope, gameCatID string, bettingEnabled, depositsEnabled *bool, message string) (MaintenanceState, error) {
+	if s == nil || s.db == nil {
+		return MaintenanceState{}, fmt.Errorf("service or database not initialized")
+	}
+	gameCatID = strings.TrimSpace(gameCatID)
+	switch scope {
+	case MaintenanceGlobal:
+		if gameCatID != "" {
+			return MaintenanceState{}, fmt.Errorf("%w: game_cat_id is only for scope game", ErrInvalidMaintenance)
+		}
+	case MaintenanceGame:
+		if gameCatID == "" {
+			return MaintenanceState{}, fmt.Errorf("%w: game_cat_id is required for scope game", ErrInvalidMaintenance)
+		}
+		if depositsEnabled != nil && !*depositsEnabled {
+			return MaintenanceState{}, fmt.Errorf("%w: deposits can only be paused globally", ErrInvalidMaintenance)
+		}
+		game, err := s.game(context.Background(), gameCatID)
+		if err != nil {
+			return MaintenanceState{}, err
+		}
+		if game == nil || !game.Active() {
+			return MaintenanceState{}, fmt.Errorf("%w: unknown game_cat_id %s", ErrInvalidMaintenance, gameCatID)
+		}
+	default:
+		return MaintenanceState{}, fmt.Errorf("%w: scope must be global or game", ErrInvalidMaintenance)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Start from the stored switch, read past the cache
+	s.lookups.Forget(maintenanceKey)
+	switches, err := s.MaintenanceSwitches(ctx)
+	if err != nil {
+		return MaintenanceState{}, err
+	}
+	sw := MaintenanceSwitch{Scope: scope, GameCatID: gameCatID, BettingEnabled: true, DepositsEnabled: true}
+	for _, current := range switches {
+		if current.Scope == scope && current.GameCatID == gameCatID {
+			sw = current
+		}
+	}
+	if bettingEnabled != nil {
+		sw.BettingEnabled = *bettingEnabled
+	}
+	if depositsEnabled != nil && scope == MaintenanceGlobal {
+		sw.DepositsEnabled = *depositsEnabled
+	}
+	sw.Message = strings.TrimSpace(message)
+
+	if err := s.db.SetMaintenanceSwitch(ctx, sw.Scope, sw.GameCatID, sw.BettingEnabled, sw.DepositsEnabled, sw.Message, admin); err != nil {
+		return MaintenanceState{}, err
+	}
+	logrus.Warnf("maintenance: %s set scope %s %s betting_enabled=%t deposits_enabled=%t",
+		admin, sw.Scope, sw.GameCatID, sw.BettingEnabled, sw.DepositsEnabled)
+
+	s.lookups.Forget(maintenanceKey)
+	return s.GetMaintenance(ctx)
+}
+
+// checkBetting returns a *MaintenanceError when betting on gameCatID is
+// paused. The switches failing to load does not stop play.
+func (s *LuckyNumberService) checkBetting(ctx context.Context, gameCatID string) error {
+	switches, err := s.MaintenanceSwitches(ctx)
+	if err != nil {
+		logrus.Errorf("maintenance: failed to load switches: %v", err)
+		return nil
+	}
+	for _, sw := range switches {
+		if sw.BettingEnabled {
+			continue
+		}
+		if sw.Scope == MaintenanceGlobal || sw.GameCatID == gameCatID {
+			return &MaintenanceError{Message: sw.Message}
+		}
+	}
+	return nil
+}
+
+// checkDeposits returns a *MaintenanceError when deposits are paused
+func (s *LuckyNumberService) checkDeposits(ctx context.Context) error {
+	switches, err := s.MaintenanceSwitches(ctx)
+	if err != nil {
+		logrus.Errorf("maintenance: failed to load switches: %v", err)
+		return nil
+	}
+	for _, sw := range switches {
+		if sw.Scope == MaintenanceGlobal && !sw.DepositsEnabled {
+			return &MaintenanceError{Deposits: true, Message: sw.Message}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"testing"
+)
+
+// maintenanceRepo adds maintenance_switches and the deposit requests a
+// settlement callback reads to memRepo
+type maintenanceRepo struct {
+	*memRepo
+	switches map[string]map[string]interface{} // by scope|game_cat_id
+	deposits map[string]map[string]interface{} // deposit_requests by reference
+}
+
+func newMaintenanceRepo() *maintenanceRepo {
+	r := &maintenanceRepo{memRepo: newMemRepo(), switches: map[string]map[string]interface{}{}, deposits: map[string]map[string]interface{}{}}
+	r.games["2"] = &database.Game{ID: "2", Name: "PawaBox Gold", NameInit: "pg", Category: "boxes", Status: "active", Boxes: 7, MaxExposure: 100000}
+	return r
+}
+
+func (r *maintenanceRepo) SetMaintenanceSwitch(ctx context.Context, scope, gameCatID string, bettingEnabled, depositsEnabled bool, message, admin string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.switches[scope+"|"+gameCatID] = map[string]interface{}{
+		"scope": scope, "game_cat_id": gameCatID, "betting_enabled": bettingEnabled,
+		"deposits_enabled": depositsEnabled, "message": message, "updated_by": admin,
+	}
+	return nil
+}
+
+func (r *maintenanceRepo) ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rows := make([]map[string]interface{}, 0, len(r.switches))
+	for _, row := range r.switches {
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func (r *maintenanceRepo) CheckTransaction(ctx context.Context, transactionID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *maintenanceRepo) CheckDepositRequestLucky(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deposits[reference], nil
+}
+
+func pause(t *testing.T, s *LuckyNumberService, scope, gameCatID string, betting, deposits *bool) {
+	t.Helper()
+	if _, err := s.SetMaintenance("admin", scope, gameCatID, betting, deposits, "back soon"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func betOn(s *LuckyNumberService, repo *maintenanceRepo, gameCatID string) error {
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	_, err := s.PlaceBet(context.Background(), user, "", "Test", gameCatID, testMsisdn, 10, "1", "web")
+	return err
+}
+
+func paused(err error) bool {
+	var m *MaintenanceError
+	return errors.As(err, &m)
+}
+
+func TestMaintenanceGameScope(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	off := false
+	pause(t, s, MaintenanceGame, "1", &off, nil)
+
+	err := betOn(s, repo, "1")
+	var m *MaintenanceError
+	if !errors.As(err, &m) || m.Deposits || m.Message != "back soon" {
+		t.Errorf("bet on the paused game = %v, want betting paused with the admin's message", err)
+	}
+	if err := betOn(s, repo, "2"); err != nil {
+		t.Errorf("bet on another game = %v, want it placed", err)
+	}
+	if err := s.checkDeposits(context.Background()); paused(err) {
+		t.Errorf("a game switch paused deposits: %v", err)
+	}
+	if _, err := s.SetMaintenance("admin", MaintenanceGame, "1", nil, &off, ""); !errors.Is(err, ErrInvalidMaintenance) {
+		t.Errorf("pausing deposits for one game = %v, want ErrInvalidMaintenance", err)
+	}
+
+	state, err := s.GetMaintenance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.BettingEnabled || len(state.PausedGames) != 1 || state.PausedGames[0].GameCatID != "1" {
+		t.Errorf("state = %+v, want game 1 paused only", state)
+	}
+
+	on := true
+	pause(t, s, MaintenanceGame, "1", &on, nil)
+	if err := betOn(s, repo, "1"); err != nil {
+		t.Errorf("bet after resuming = %v, want it placed", err)
+	}
+}
+
+func TestMaintenanceGlobalScope(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	off := false
+	pause(t, s, MaintenanceGlobal, "", &off, nil)
+
+	for _, game := range []string{"1", "2"} {
+		if err := betOn(s, repo, game); !paused(err) {
+			t.Errorf("bet on game %s = %v, want betting paused", game, err)
+		}
+	}
+	if p := repo.player(testMsisdn); p.Balance != 100 || len(repo.bets) != 0 {
+		t.Errorf("paused bets moved money: balance %v, %d bets", p.Balance, len(repo.bets))
+	}
+	// Betting alone is paused; the deposit switch is left as it was
+	if err := s.checkDeposits(context.Background()); paused(err) {
+		t.Errorf("deposit with only betting paused = %v", err)
+	}
+
+	pause(t, s, MaintenanceGlobal, "", nil, &off)
+	err := s.checkDeposits(context.Background())
+	var m *MaintenanceError
+	if !errors.As(err, &m) || !m.Deposits {
+		t.Errorf("deposit = %v, want deposits paused", err)
+	}
+	state, _ := s.GetMaintenance(context.Background())
+	if state.BettingEnabled || state.DepositsEnabled || state.Message != "back soon" {
+		t.Errorf("state = %+v, want betting and deposits paused", state)
+	}
+}
+
+func TestCallbacksSettleDuringMaintenance(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 30})
+	repo.deposits["REF1"] = map[string]interface{}{
+		"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1", "selected_box": "1",
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+	off := false
+	pause(t, s, MaintenanceGlobal, "", &off, &off)
+
+	// The deposit was paid before the switch, so its round still plays
+	if err := s.HandleDepositAndGame(models.SettlementCallback{TransactionID: "QK1", Reference: "REF1"}); err != nil {
+		t.Fatalf("callback during maintenance: %v", err)
+	}
+	b := repo.bets["REF1"]
+	if b == nil || b.Status != status.ResultLoss || b.Amount != 20 {
+		t.Errorf("bet = %+v, want the funded 20 played and lost", b)
+	}
+	if got := repo.rounds["REF1"]; got != database.RoundSettled {
+		t.Errorf("round = %s, want settled", got)
+	}
+}
@@ -0,0 +1,826 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memRepo is an in-memory LuckyRepo holding the rows a bet, deposit or
+// payout moves money through: players, bets, rounds, the basket and house
+// totals, today's KPI, withdrawals and the SMS queue. Methods it does not
+// model fall through to the nil embedded LuckyRepo and panic, naming the
+// method in the trace.
+type memRepo struct {
+	database.LuckyRepo
+
+	mu       sync.Mutex
+	settings database.Settings
+	games    map[string]*database.Game
+	players  map[string]*memPlayer
+	nextID   int64
+	bets     map[string]*memBet
+	rounds   map[string]string
+	funding  map[string]memFunding
+	basket   float64
+	reserved float64   // held wins reserved against the basket
+	holds    []memHold // basket_holds not yet released
+	topUps   int64
+	house    memHouse
+	kpi      memKPI
+	channels map[string]memChannelKPI // kpi_by_channel
+	exposure map[string]float64
+
+	withdrawals map[string]memWithdrawal
+	queued      []memWithdrawal // withdrawal_queue_ke
+	pending     []memWithdrawal // pending_withdrawals
+	sms         []memSMS
+	decisions   map[string]string // reference -> result
+	logs        int               // customer, house and tax log rows
+	events      []string          // webhook event types
+	spins       []memSpin
+}
+
+type memPlayer struct {
+	ID          int64
+	Msisdn      string
+	Balance     float64
+	Bonus       float64
+	TotalBets   float64
+	Payout      float64
+	TotalLosses float64
+	LostCount   int64
+	LostSince   time.Time // start of the loss streak, zero when there is none
+	Frequency   int64
+	Jackpot     float64
+	FreeBet     int64
+	FreeBetEnds time.Time // freebet_expiry; free bets are flagged while it is ahead
+	Language    string
+	NoSMS       bool // sms_notifications off
+}
+
+type memBet struct {
+	Msisdn    string
+	Amount    float64
+	Status    status.ResultStatus
+	WinAmount float64
+	BetType   string
+	GameCatID string
+	Created   time.Time
+	Box       string // parcel bets only
+	Parcel    string
+}
+
+type memFunding struct {
+	Cash, Bonus float64
+}
+
+type memHouse struct {
+	TotalBets, TotalWins, Income, Losses float64
+}
+
+type memKPI struct {
+	Handle, Payout, Withholding, Excise, Vig, FreeBetStake, Deposits float64
+}
+
+type memChannelKPI struct {
+	Handle, Payout float64
+	Bets           int64
+}
+
+type memWithdrawal struct {
+	Reference string
+	Msisdn    string
+	Amount    float64 // net
+	Tax       float64
+}
+
+type memSpin struct {
+	SpinID    string
+	Drums     string
+	Stake     int64
+	WinAmount int64
+	IsWin     bool
+	Line      string // symbol x count of the win line, if any
+}
+
+type memSMS struct {
+	Msisdn   string
+	Message  string
+	Sequence int64
+}
+
+// newMemRepo returns a repo with one active game "1", the settings below
+// and a basket of 100000
+func newMemRepo() *memRepo {
+	return &memRepo{
+		settings: database.Settings{
+			DefaultRTP: 85, AdjustableRTP: 5, VigPercentage: 10, JackpotPercentage: 5,
+			MinWinMultiplier: 1, MaxWinMultiplier: 10, MinLossCount: 3,
+			Withholding: 20, ExciseDuty: 12.5, MinDeposit: 10, MaxDeposit: 150000,
+		},
+		games: map[string]*database.Game{
+			"1": {ID: "1", Name: "PawaBox", NameInit: "pw", Category: "boxes", Status: "active", Boxes: 7, MaxExposure: 100000},
+		},
+		players:     make(map[string]*memPlayer),
+		bets:        make(map[string]*memBet),
+		rounds:      make(map[string]string),
+		funding:     make(map[string]memFunding),
+		basket:      100000,
+		channels:    make(map[string]memChannelKPI),
+		exposure:    make(map[string]float64),
+		withdrawals: make(map[string]memWithdrawal),
+		decisions:   make(map[string]string),
+	}
+}
+
+// addPlayer adds a player with balance in cash
+func (r *memRepo) addPlayer(msisdn string, balance float64) *memPlayer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nextID++
+	p := &memPlayer{ID: r.nextID, Msisdn: msisdn, Balance: balance, Language: "en"}
+	r.players[msisdn] = p
+	return p
+}
+
+func (r *memRepo) player(msisdn string) memPlayer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.players[msisdn]
+}
+
+func (r *memRepo) playerByID(id int64) *memPlayer {
+	for _, p := range r.players {
+		if p.ID == id {
+			return p
+		}
+	}
+	return nil
+}
+
+func (p *memPlayer) row() map[string]interface{} {
+	row := map[string]interface{}{
+		"id": p.ID, "msisdn": p.Msisdn, "balance": p.Balance, "bonus": p.Bonus,
+		"total_bets": p.TotalBets, "payout": p.Payout, "total_losses": p.TotalLosses,
+		"lost_count": p.LostCount, "frequency": p.Frequency, "free_bet": p.FreeBet,
+		"language": p.Language, "is_free": p.isFree(), "freebet_expiry": p.FreeBetEnds,
+		"sms_notifications": !p.NoSMS, "lost_since": nil,
+	}
+	if !p.LostSince.IsZero() {
+		row["lost_since"] = p.LostSince
+	}
+	return row
+}
+
+func (p *memPlayer) isFree() string {
+	if p.FreeBet > 0 && !p.FreeBetEnds.IsZero() {
+		return "YES"
+	}
+	return "NO"
+}
+
+func (r *memRepo) UpdateUserLucky(ctx context.Context, msisdn string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.players[msisdn]
+	p.FreeBet = max(p.FreeBet-1, 0)
+	return 1, nil
+}
+
+func (r *memRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[msisdn]
+	if !ok {
+		return nil, nil
+	}
+	return p.row(), nil
+}
+
+func (r *memRepo) GetSettings(ctx context.Context) (*database.Settings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.settings
+	return &st, nil
+}
+
+func (r *memRepo) CheckSetting(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"default_rtp": r.settings.DefaultRTP}, nil
+}
+
+func (r *memRepo) GetGame(ctx context.Context, catID string) (*database.Game, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	g, ok := r.games[catID]
+	if !ok {
+		return nil, nil
+	}
+	game := *g
+	return &game, nil
+}
+
+func (r *memRepo) ListMaintenanceSwitches(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) CheckBets(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+// Rounds
+
+func (r *memRepo) CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rounds[reference]; ok {
+		return database.ErrRoundExists
+	}
+	r.rounds[reference] = database.RoundCreated
+	return nil
+}
+
+func (r *memRepo) TransitionRound(ctx context.Context, reference, to, actor, detail string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	from, ok := r.rounds[reference]
+	if !ok {
+		return fmt.Errorf("%w: %s", database.ErrRoundNotFound, reference)
+	}
+	if !database.RoundTransitionAllowed(from, to) {
+		return fmt.Errorf("%w: %s %s -> %s", database.ErrInvalidRoundTransition, reference, from, to)
+	}
+	r.rounds[reference] = to
+	return nil
+}
+
+func (r *memRepo) TaxRatesAt(ctx context.Context, at time.Time) (map[string]float64, error) {
+	return nil, nil
+}
+
+func (r *memRepo) RoundTaxRates(ctx context.Context, reference string) (map[string]float64, error) {
+	return nil, nil
+}
+
+// Wallets
+
+func (r *memRepo) DebitStake(ctx context.Context, msisdn, reference string, amount float64, bonusFirst bool) (float64, float64, error) {
+	return r.DebitStakes(ctx, msisdn, []database.Stake{{Reference: reference, Amount: amount}}, bonusFirst)
+}
+
+// DebitStakes takes every stake or none, splitting the cash and bonus
+// funding across the references in proportion to their stakes
+func (r *memRepo) DebitStakes(ctx context.Context, msisdn string, stakes []database.Stake, bonusFirst bool) (float64, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[msisdn]
+	if !ok {
+		return 0, 0, fmt.Errorf("player %s not found", msisdn)
+	}
+	var amount float64
+	for _, st := range stakes {
+		amount += st.Amount
+	}
+	if p.Balance+p.Bonus < amount {
+		return 0, 0, database.ErrInsufficientBalance
+	}
+	var bonus float64
+	if bonusFirst {
+		bonus = math.Min(amount, p.Bonus)
+	} else {
+		bonus = math.Max(0, amount-math.Max(p.Balance, 0))
+	}
+	cash := amount - bonus
+	p.Balance -= cash
+	p.Bonus -= bonus
+	for _, st := range stakes {
+		share := st.Amount / amount
+		r.funding[st.Reference] = memFunding{Cash: cash * share, Bonus: bonus * share}
+	}
+	return cash, bonus, nil
+}
+
+func (r *memRepo) CreditBonusWin(ctx context.Context, reference string, amount float64) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.funding[reference]
+	if !ok || f.Bonus <= 0 {
+		return 0, nil
+	}
+	share := amount * f.Bonus / (f.Cash + f.Bonus)
+	if b, ok := r.bets[reference]; ok {
+		if p := r.players[b.Msisdn]; p != nil {
+			p.Bonus += share
+		}
+	}
+	return share, nil
+}
+
+func (r *memRepo) UpdateUserRTP(ctx context.Context, amount float64, id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.playerByID(id)
+	if p == nil {
+		return 0, nil
+	}
+	p.Balance -= amount
+	return 1, nil
+}
+
+func (r *memRepo) UpdateUserAviatorBalInfoLucky(ctx context.Context, amount float64, msisdn, name string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[msisdn]
+	if !ok {
+		return 0, nil
+	}
+	p.Balance += amount
+	return 1, nil
+}
+
+func (r *memRepo) UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.playerByID(id)
+	p.TotalBets += mvalue
+	p.Frequency++
+	return 1, nil
+}
+
+func (r *memRepo) UpdateUserLossCount(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.playerByID(id)
+	if p.LostCount == 0 || p.LostSince.IsZero() {
+		p.LostSince = time.Now()
+	}
+	p.LostCount++
+	p.TotalLosses += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateRESTLossUser(ctx context.Context, payout float64, id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.playerByID(id)
+	p.Payout += payout
+	p.LostCount, p.LostSince = 0, time.Time{}
+	return 1, nil
+}
+
+func (r *memRepo) UpdatePlayerRestLossJackpot(ctx context.Context, cost float64, id int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.playerByID(int64(id))
+	p.Jackpot += cost
+	p.LostCount, p.LostSince = 0, time.Time{}
+	return 1, nil
+}
+
+// Bets
+
+func (r *memRepo) CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference string, betStatus status.ResultStatus, betType, gameCatID, gameName, channel string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.bets[reference]; ok {
+		return false, nil
+	}
+	r.bets[reference] = &memBet{Msisdn: msisdn, Amount: amount, Status: betStatus, BetType: betType, GameCatID: gameCatID, Created: time.Now()}
+	return true, nil
+}
+
+func (r *memRepo) CreateParcelBets(ctx context.Context, msisdn, parcel string, bets []database.ParcelBet, betType, gameCatID, gameName, channel string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, b := range bets {
+		if _, ok := r.bets[b.Reference]; ok {
+			return fmt.Errorf("failed to create bet %s: %w", b.Reference, database.ErrDuplicateReference)
+		}
+	}
+	for _, b := range bets {
+		r.bets[b.Reference] = &memBet{Msisdn: msisdn, Amount: b.Amount, Status: status.ResultPending, BetType: betType,
+			GameCatID: gameCatID, Created: time.Now(), Box: b.Box, Parcel: parcel}
+	}
+	return nil
+}
+
+func (r *memRepo) BetExists(ctx context.Context, reference string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.bets[reference]
+	return ok, nil
+}
+
+func (r *memRepo) UpdateLuckyBet(ctx context.Context, result, game, reference string, betStatus status.ResultStatus) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bets[reference]
+	if !ok {
+		return 0, nil
+	}
+	b.Status = betStatus
+	return 1, nil
+}
+
+func (r *memRepo) UpdateLuckyBetWin(ctx context.Context, result, game, reference string, winAmount float64, betStatus status.ResultStatus) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := r.bets[reference]
+	if !ok {
+		return 0, nil
+	}
+	b.Status = betStatus
+	b.WinAmount = winAmount
+	return 1, nil
+}
+
+func (r *memRepo) InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions[reference] = result
+	return nil
+}
+
+// House, basket and KPI
+
+func (r *memRepo) CheckBasketLucky(ctx context.Context) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]interface{}{"amount": r.basket - r.reserved, "reserved": r.reserved}, nil
+}
+
+func (r *memRepo) CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) UpdateHousePawaBoxKeBasket(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.basket += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateHouseLuckyBasketWins(ctx context.Context, mvalue float64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.basket-r.reserved < mvalue {
+		return false, nil
+	}
+	r.basket -= mvalue
+	return true, nil
+}
+
+type memHold struct {
+	Reference, Msisdn string
+	Amount            float64
+}
+
+func (r *memRepo) HoldBasketPayout(ctx context.Context, reference, msisdn string, amount float64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.holds {
+		if h.Reference == reference {
+			return false, nil
+		}
+	}
+	r.holds = append(r.holds, memHold{reference, msisdn, amount})
+	r.reserved += amount
+	return true, nil
+}
+
+func (r *memRepo) ReleaseBasketHolds(ctx context.Context) ([]database.BasketRelease, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var released []database.BasketRelease
+	for len(r.holds) > 0 && r.basket >= r.holds[0].Amount {
+		h := r.holds[0]
+		r.holds = r.holds[1:]
+		r.basket -= h.Amount
+		r.reserved -= h.Amount
+		release := database.BasketRelease{Reference: h.Reference, Msisdn: h.Msisdn, Amount: h.Amount}
+		for i, p := range r.pending {
+			if p.Reference == h.Reference {
+				release.Payout = p.Amount
+				r.pending = append(r.pending[:i], r.pending[i+1:]...)
+				r.queued = append(r.queued, memWithdrawal{Reference: h.Reference, Msisdn: h.Msisdn, Amount: p.Amount})
+				break
+			}
+		}
+		released = append(released, release)
+	}
+	return released, nil
+}
+
+func (r *memRepo) ListBasketTopUps(ctx context.Context, limit int) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) TopUpBasket(ctx context.Context, amount float64, admin, note string) (int64, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.basket += amount
+	r.topUps++
+	return r.topUps, r.basket, nil
+}
+
+func (r *memRepo) CheckHousePawaBoxKe(ctx context.Context) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]interface{}{"total_bets": r.house.TotalBets, "total_wins": r.house.TotalWins, "income": r.house.Income}, nil
+}
+
+func (r *memRepo) UpdateHousePawaBoxKeBets(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.house.TotalBets += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateHousePawaBoxKeHouse(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.house.Income += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateHouseLuckyWins(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.house.TotalWins += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateHouseLuckyHouseLosses(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.house.Losses += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateHouseLucyNumberHouseCurrentRTP(ctx context.Context) (int64, error) {
+	return 1, nil
+}
+
+func (r *memRepo) CheckSettingKPI(ctx context.Context) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return map[string]interface{}{"bet": r.kpi.Handle, "payout": r.kpi.Payout, "rtp": database.RTP(r.kpi.Payout, r.kpi.Handle)}, nil
+}
+
+func (r *memRepo) UpdateKPIHandle(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Handle += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIPayouts(ctx context.Context, mvalue, withTaxAmount, exciseTaxAmount float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Payout += mvalue
+	r.kpi.Withholding += withTaxAmount
+	r.kpi.Excise += exciseTaxAmount
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIPayoutSPIN(ctx context.Context, exciseTaxAmount float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Excise += exciseTaxAmount
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIVIG(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Vig += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIFreeBetStake(ctx context.Context, stake float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.FreeBetStake += stake
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIDeposit(ctx context.Context, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Deposits += mvalue
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIChannelHandle(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.channels[channel]
+	c.Handle += mvalue
+	c.Bets++
+	r.channels[channel] = c
+	return 1, nil
+}
+
+func (r *memRepo) UpdateKPIChannelPayout(ctx context.Context, channel string, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.channels[channel]
+	c.Payout += mvalue
+	r.channels[channel] = c
+	return 1, nil
+}
+
+func (r *memRepo) GetGameDailyExposure(ctx context.Context, gameCatID string) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.exposure[gameCatID], nil
+}
+
+func (r *memRepo) AddGameDailyExposure(ctx context.Context, gameCatID string, mvalue float64) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exposure[gameCatID] += mvalue
+	return r.exposure[gameCatID], nil
+}
+
+// Jackpots
+
+func (r *memRepo) CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) UpdateJackpotKit(ctx context.Context, reference string, mvalue float64) (int64, error) {
+	return 1, nil
+}
+
+func (r *memRepo) UpdateJackpotKitNameInit(ctx context.Context, reference string, mvalue float64, nameInit string) (int64, error) {
+	return 1, nil
+}
+
+// Payouts
+
+func (r *memRepo) InsertIntoWithdrawalsLucky(ctx context.Context, nonAmount, amount, withholdTax float64, items string, msisdn, reference string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.withdrawals[reference] = memWithdrawal{Reference: reference, Msisdn: msisdn, Amount: amount, Tax: withholdTax}
+	return 1, nil
+}
+
+func (r *memRepo) CheckWithdrawalsPawaBoxKe(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.withdrawals[reference]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{"msisdn": w.Msisdn, "amount": w.Amount, "reference": w.Reference}, nil
+}
+
+func (r *memRepo) InsertWithdrawalQueue(ctx context.Context, reference, msisdn string, amount float64, callback string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.queued = append(r.queued, memWithdrawal{Reference: reference, Msisdn: msisdn, Amount: amount})
+	return 1, nil
+}
+
+func (r *memRepo) InsertIntoPendingWithdrawalsLucky(ctx context.Context, amount, taxAmount float64, items, msisdn, reference string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending = append(r.pending, memWithdrawal{Reference: reference, Msisdn: msisdn, Amount: amount, Tax: taxAmount})
+	return 1, nil
+}
+
+func (r *memRepo) UpdatePawaBoxKeWithdrawalRequest(ctx context.Context, reference string) (int64, error) {
+	return 1, nil
+}
+
+// Log rows
+
+func (r *memRepo) countLog() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logs++
+	return 1, nil
+}
+
+func (r *memRepo) InsertCustomerLogsPawaBoxKe(ctx context.Context, amount float64, logType string, customerID string, narrative, reference string) (int64, error) {
+	return r.countLog()
+}
+
+func (r *memRepo) InsertHouseLogsPawaBoxKeGameID(ctx context.Context, gameID string, fieldName, msisdn string, mvalue float64) (int64, error) {
+	return r.countLog()
+}
+
+func (r *memRepo) InsertHouseBasketLogs(ctx context.Context, credit, debit, mvalue float64, narrative string) (int64, error) {
+	return r.countLog()
+}
+
+func (r *memRepo) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error) {
+	return r.countLog()
+}
+
+func (r *memRepo) InsertB2BWithdrawalB2B(ctx context.Context, reference, msisdn string, amount float64, betStatus status.B2BStatus) (int64, error) {
+	return r.countLog()
+}
+
+func (r *memRepo) InsertIntoDepositLuckyRequestBonus(ctx context.Context, depositType, ussd, game, carrier string, gameCatID string, amount float64, msisdn, selectedBox, reference, channel string) (int64, error) {
+	return r.countLog()
+}
+
+// Spins
+
+func (r *memRepo) InsertSpinResult(ctx context.Context, playerID, spinID string, drums []byte, stake, winAmount, balance int64, isWin bool) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spins = append(r.spins, memSpin{SpinID: spinID, Drums: string(drums), Stake: stake, WinAmount: winAmount, IsWin: isWin})
+	return int64(len(r.spins)), nil
+}
+
+func (r *memRepo) InsertSpinWinLine(ctx context.Context, spinResultID int64, lineNumber int, symbol string, count int, payout int64, positions []byte) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spins[spinResultID-1].Line = fmt.Sprintf("%sx%d", symbol, count)
+	return spinResultID, nil
+}
+
+// Messages
+
+func (r *memRepo) GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sms = append(r.sms, memSMS{Msisdn: msisdn, Message: message, Sequence: sequence})
+	return int64(len(r.sms)), nil
+}
+
+func (r *memRepo) ListWebhookSubscriptions(ctx context.Context) ([]map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r *memRepo) EnqueueWebhookEvent(ctx context.Context, eventType, msisdn string, payload []byte) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, eventType)
+	return int64(len(r.events)), nil
+}
+
+// playerSum is the money a player holds and has been paid: both wallets,
+// and every net payout queued or held for them
+func (r *memRepo) playerSum(msisdn string) float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := r.players[msisdn]
+	total := p.Balance + p.Bonus
+	for _, w := range append(append([]memWithdrawal{}, r.queued...), r.pending...) {
+		if w.Msisdn == msisdn {
+			total += w.Amount
+		}
+	}
+	return total
+}
+
+func (r *memRepo) betRefs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	refs := make([]string, 0, len(r.bets))
+	for ref := range r.bets {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// fixedOutcomes is an OutcomeEngine laying out the same boxes every time
+type fixedOutcomes map[string]float64
+
+func (f fixedOutcomes) GenerateWinAmounts(ctx context.Context, params GenerateWinAmountsParams) (map[string]WinAmount, error) {
+	boxes := make(map[string]WinAmount, len(f))
+	for box, v := range f {
+		boxes[box] = WinAmount{Value: v, Item: FormatToMZN(v)}
+	}
+	return boxes, nil
+}
+
+// newTestService returns a service over repo whose real games lay out
+// outcomes. Background work it starts is waited for at the end of the test.
+func newTestService(t *testing.T, repo database.LuckyRepo, outcomes OutcomeEngine) *LuckyNumberService {
+	t.Helper()
+	s := NewLuckyNumberService(repo)
+	if outcomes != nil {
+		s.outcomes = outcomes
+	}
+	return s
+}
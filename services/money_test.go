@@ -0,0 +1,48 @@
+package services
+
+import (
+	"errors"
+	"fiberapp/money"
+	"math"
+	"testing"
+	"time"
+)
+
+// extremeAmounts are amounts a callback or a crafted request could carry
+var extremeAmounts = []float64{-500, -0.01, 0, 1e-9, 0.004, 10.005, 1e12, money.MaxDelta + 1,
+	math.NaN(), math.Inf(1), math.Inf(-1), math.MaxFloat64, -math.MaxFloat64}
+
+func TestExtremeAmountsMoveNoBalance(t *testing.T) {
+	s, repo := newTransferTest(t)
+	balances := func() [3]float64 {
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		return [3]float64{repo.players[testMsisdn].Balance, repo.players[testRecipient].Balance, repo.basket}
+	}
+	before := balances()
+	rules := StakeRules{Mode: StakeRange, MinStake: 1, MaxStake: 1000}
+
+	for _, amount := range extremeAmounts {
+		if err := rules.Check(amount); err == nil {
+			t.Errorf("stake %v accepted", amount)
+		}
+		if _, err := s.Withdraw(testMsisdn, amount, ""); !errors.Is(err, ErrWithdrawalAmount) {
+			t.Errorf("withdrawal of %v = %v, want ErrWithdrawalAmount", amount, err)
+		}
+		if _, err := s.Transfer(testMsisdn, testRecipient, amount, ""); err == nil {
+			t.Errorf("transfer of %v accepted", amount)
+		}
+		if _, err := s.GrantBonus(testMsisdn, amount, time.Now().Add(time.Hour), "admin", "B1"); !errors.Is(err, ErrBonusAmount) {
+			t.Errorf("bonus of %v = %v, want ErrBonusAmount", amount, err)
+		}
+		if _, err := s.TopUpBasket("admin", amount, ""); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("basket top-up of %v = %v, want ErrInvalidAmount", amount, err)
+		}
+		if after := balances(); after != before {
+			t.Fatalf("amount %v moved balances from %v to %v", amount, before, after)
+		}
+	}
+	if repo.transfers != 0 {
+		t.Errorf("%d transfers written", repo.transfers)
+	}
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrMsisdnContested means another player's pending change holds the number
+var ErrMsisdnContested = errors.New("phone number is being claimed by another account")
+
+// RequestMsisdnChange starts moving msisdn's account to newMsisdn: it holds
+// newMsisdn for limits.msisdn_change_ttl and sends code, valid until
+// expired, to newMsisdn. A registered newMsisdn returns
+// database.ErrMsisdnTaken and one held by another player ErrMsisdnContested.
+// A second request replaces the player's first.
+func (s *LuckyNumberService) RequestMsisdnChange(msisdn, newMsisdn, code string, expired, created int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	if newMsisdn == msisdn {
+		return database.ErrMsisdnTaken
+	}
+
+	user, err := s.CheckUserNoCreating(newMsisdn)
+	if err != nil {
+		return err
+	}
+	if user != nil {
+		return database.ErrMsisdnTaken
+	}
+	if err := s.CreateUserAttempted(msisdn, newMsisdn); err != nil {
+		return err
+	}
+	logrus.Infof("msisdn change: %s requested a move to %s", msisdn, newMsisdn)
+	_, err = s.InsertVerification(newMsisdn, OTPChangeMsisdn, code, expired, created)
+	return err
+}
+
+// ConfirmMsisdnChange completes msisdn's pending change with the OTP sent to
+// the new number and returns that number. Every session of the old number
+// is revoked and both numbers are told by SMS. Without a pending change it
+// returns database.ErrMsisdnChangeExpired.
+func (s *LuckyNumberService) ConfirmMsisdnChange(msisdn, otp string) (string, error) {
+	if s == nil || s.db == nil {
+		return "", fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pending, err := s.db.GetUserAttempted(ctx, msisdn)
+	if err != nil {
+		return "", err
+	}
+	if pending == nil {
+		return "", database.ErrMsisdnChangeExpired
+	}
+	newMsisdn := utils.ToString(pending["new_msisdn"])
+
+	if _, err := s.VerifyOTP(newMsisdn, OTPChangeMsisdn, otp); err != nil {
+		return "", err
+	}
+	if err := s.UpdateMsisdn(msisdn, newMsisdn); err != nil {
+		return "", err
+	}
+	logrus.Infof("msisdn change: %s moved to %s", msisdn, newMsisdn)
+
+	if _, err := s.RevokeSessions(msisdn); err != nil {
+		logrus.Errorf("msisdn change: revoking sessions of %s failed: %v", msisdn, err)
+	}
+
+	messages := map[string]string{
+		msisdn:    fmt.Sprintf("Akaunti yako ya PawaBox imehamishwa kwenda namba %s. Kama hukufanya hivi piga 0703012550", newMsisdn),
+		newMsisdn: fmt.Sprintf("Akaunti yako ya PawaBox sasa inatumia namba hii badala ya %s. BONYEZA *463#", msisdn),
+	}
+	for to, message := range messages {
+		if err := s.queueOrderedSMS(ctx, to, message, "LuckyNumber", "msisdn_change"); err != nil {
+			logrus.Errorf("msisdn change: sms to %s failed: %v", to, err)
+		}
+	}
+	return newMsisdn, nil
+}
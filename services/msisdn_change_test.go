@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/database"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type memAttempt struct {
+	NewMsisdn string
+	ExpiresAt time.Time
+}
+
+// changeRepo adds Attempted_Players, the Player msisdn move and session
+// revocation to otpRepo
+type changeRepo struct {
+	*otpRepo
+	attempts map[string]memAttempt // by msisdn
+	revoked  []string              // msisdns whose sessions were revoked
+}
+
+func newChangeRepo() *changeRepo {
+	return &changeRepo{otpRepo: newOTPRepo(), attempts: map[string]memAttempt{}}
+}
+
+func (r *changeRepo) InsertVerification(ctx context.Context, msisdn, purpose, codeHash string, expired, created int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.codes = append(r.codes, &otpRow{ID: int32(len(r.codes) + 1), Msisdn: msisdn, Purpose: purpose, CodeHash: codeHash, Created: created, Expired: expired, LastSent: created})
+	return 0, nil
+}
+
+func (r *changeRepo) CreateUserAttempted(ctx context.Context, msisdn, newMsisdn string, expiresAt time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	delete(r.attempts, msisdn)
+	for holder, a := range r.attempts {
+		if !a.ExpiresAt.After(now) {
+			delete(r.attempts, holder)
+		} else if a.NewMsisdn == newMsisdn {
+			return 0, nil
+		}
+	}
+	r.attempts[msisdn] = memAttempt{NewMsisdn: newMsisdn, ExpiresAt: expiresAt}
+	return 1, nil
+}
+
+func (r *changeRepo) GetUserAttempted(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[msisdn]
+	if !ok || !a.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return map[string]interface{}{"msisdn": msisdn, "new_msisdn": a.NewMsisdn, "expires_at": a.ExpiresAt}, nil
+}
+
+func (r *changeRepo) UpdateUserMsisdn(ctx context.Context, msisdn, newMsisdn string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.attempts[msisdn]
+	if !ok || a.NewMsisdn != newMsisdn || !a.ExpiresAt.After(time.Now()) {
+		return 0, database.ErrMsisdnChangeExpired
+	}
+	delete(r.attempts, msisdn)
+	if _, taken := r.players[newMsisdn]; taken {
+		return 0, database.ErrMsisdnTaken
+	}
+	p := r.players[msisdn]
+	delete(r.players, msisdn)
+	p.Msisdn = newMsisdn
+	r.players[newMsisdn] = p
+	return 1, nil
+}
+
+func (r *changeRepo) RevokeAccessTokens(ctx context.Context, msisdn string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.revoked = append(r.revoked, msisdn)
+	return nil, nil
+}
+
+func (r *changeRepo) RevokeRefreshTokens(ctx context.Context, msisdn, deviceID string) (int64, error) {
+	return 0, nil
+}
+
+// smsTo returns the messages queued for msisdn
+func (r *changeRepo) smsTo(msisdn string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for _, m := range r.sms {
+		if m.Msisdn == msisdn {
+			out = append(out, m.Message)
+		}
+	}
+	return out
+}
+
+const newTestMsisdn = "254700000009"
+
+func requestChange(s *LuckyNumberService, msisdn, newMsisdn, code string) error {
+	now := time.Now().Unix()
+	return s.RequestMsisdnChange(msisdn, newMsisdn, code, now+120, now)
+}
+
+func TestMsisdnChangeHappyPath(t *testing.T) {
+	configureTestOTP(t)
+	repo := newChangeRepo()
+	repo.addPlayer(testMsisdn, 75)
+	s := newTestService(t, repo, nil)
+
+	if err := requestChange(s, testMsisdn, newTestMsisdn, "4321"); err != nil {
+		t.Fatal(err)
+	}
+	// The code goes to the new number, for the change only
+	code := repo.latest(newTestMsisdn, OTPChangeMsisdn)
+	if code == nil {
+		t.Fatal("no change_msisdn code issued to the new number")
+	}
+	if want, _ := auth.HashOTP(newTestMsisdn, OTPChangeMsisdn, "4321"); code.CodeHash != want {
+		t.Error("the code stored is not the one sent")
+	}
+	if _, err := s.ConfirmMsisdnChange(testMsisdn, "1111"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("wrong code = %v, want ErrOTPInvalid", err)
+	}
+
+	got, err := s.ConfirmMsisdnChange(testMsisdn, "4321")
+	if err != nil || got != newTestMsisdn {
+		t.Fatalf("confirm = %q, %v, want %s", got, err, newTestMsisdn)
+	}
+	if _, ok := repo.players[testMsisdn]; ok {
+		t.Error("the old number still has the account")
+	}
+	if p := repo.player(newTestMsisdn); p.Balance != 75 {
+		t.Errorf("moved account = %+v, want the 75 balance", p)
+	}
+	if len(repo.revoked) != 1 || repo.revoked[0] != testMsisdn {
+		t.Errorf("revoked sessions of %v, want the old number's", repo.revoked)
+	}
+	confirmations := map[string]string{testMsisdn: "imehamishwa kwenda namba " + newTestMsisdn, newTestMsisdn: "badala ya " + testMsisdn}
+	for to, want := range confirmations {
+		if msgs := repo.smsTo(to); len(msgs) == 0 || !strings.Contains(msgs[len(msgs)-1], want) {
+			t.Errorf("messages to %s = %q, want one containing %q", to, msgs, want)
+		}
+	}
+	if _, err := s.ConfirmMsisdnChange(testMsisdn, "4321"); !errors.Is(err, database.ErrMsisdnChangeExpired) {
+		t.Errorf("confirming again = %v, want ErrMsisdnChangeExpired", err)
+	}
+}
+
+func TestMsisdnChangeRefusals(t *testing.T) {
+	configureTestOTP(t)
+	repo := newChangeRepo()
+	repo.addPlayer(testMsisdn, 0)
+	repo.addPlayer("254700000001", 0)
+	s := newTestService(t, repo, nil)
+
+	if err := requestChange(s, testMsisdn, "254700000001", "4321"); !errors.Is(err, database.ErrMsisdnTaken) {
+		t.Errorf("registered number = %v, want ErrMsisdnTaken", err)
+	}
+	if err := requestChange(s, testMsisdn, testMsisdn, "4321"); !errors.Is(err, database.ErrMsisdnTaken) {
+		t.Errorf("own number = %v, want ErrMsisdnTaken", err)
+	}
+	if _, err := s.ConfirmMsisdnChange(testMsisdn, "4321"); !errors.Is(err, database.ErrMsisdnChangeExpired) {
+		t.Errorf("confirm without a request = %v, want ErrMsisdnChangeExpired", err)
+	}
+
+	// The number registered itself through /login after the request
+	if err := requestChange(s, testMsisdn, newTestMsisdn, "4321"); err != nil {
+		t.Fatal(err)
+	}
+	repo.addPlayer(newTestMsisdn, 0)
+	if _, err := s.ConfirmMsisdnChange(testMsisdn, "4321"); !errors.Is(err, database.ErrMsisdnTaken) {
+		t.Errorf("number registered meanwhile = %v, want ErrMsisdnTaken", err)
+	}
+	if _, ok := repo.players[testMsisdn]; !ok {
+		t.Error("a refused change moved the account")
+	}
+}
+
+func TestMsisdnChangeExpiredAttempt(t *testing.T) {
+	configureTestOTP(t)
+	repo := newChangeRepo()
+	repo.addPlayer(testMsisdn, 0)
+	repo.addPlayer("254700000001", 0)
+	s := newTestService(t, repo, nil)
+
+	if err := requestChange(s, testMsisdn, newTestMsisdn, "4321"); err != nil {
+		t.Fatal(err)
+	}
+	repo.attempts[testMsisdn] = memAttempt{NewMsisdn: newTestMsisdn, ExpiresAt: time.Now().Add(-time.Second)}
+
+	if _, err := s.ConfirmMsisdnChange(testMsisdn, "4321"); !errors.Is(err, database.ErrMsisdnChangeExpired) {
+		t.Errorf("confirm after expiry = %v, want ErrMsisdnChangeExpired", err)
+	}
+	if _, ok := repo.players[testMsisdn]; !ok {
+		t.Error("an expired change moved the account")
+	}
+	// The stale hold no longer blocks another player
+	if err := requestChange(s, "254700000001", newTestMsisdn, "8765"); err != nil {
+		t.Errorf("claiming a number whose hold expired = %v", err)
+	}
+}
+
+func TestMsisdnChangeContestedRace(t *testing.T) {
+	configureTestOTP(t)
+	repo := newChangeRepo()
+	claimants := []string{"254700000001", "254700000002", "254700000003", "254700000004"}
+	for _, m := range claimants {
+		repo.addPlayer(m, 0)
+	}
+	s := newTestService(t, repo, nil)
+
+	errs := make([]error, len(claimants))
+	var wg sync.WaitGroup
+	for i, m := range claimants {
+		wg.Add(1)
+		go func(i int, m string) {
+			defer wg.Done()
+			errs[i] = requestChange(s, m, newTestMsisdn, "4321")
+		}(i, m)
+	}
+	wg.Wait()
+
+	winner := ""
+	for i, err := range errs {
+		switch {
+		case err == nil && winner == "":
+			winner = claimants[i]
+		case err == nil:
+			t.Errorf("%s and %s both hold %s", winner, claimants[i], newTestMsisdn)
+		case !errors.Is(err, ErrMsisdnContested):
+			t.Errorf("%s = %v, want ErrMsisdnContested", claimants[i], err)
+		}
+	}
+	if winner == "" {
+		t.Fatal("nobody holds the number")
+	}
+	for _, m := range claimants {
+		if m == winner {
+			continue
+		}
+		if _, err := s.ConfirmMsisdnChange(m, "4321"); !errors.Is(err, database.ErrMsisdnChangeExpired) {
+			t.Errorf("loser %s confirming = %v, want ErrMsisdnChangeExpired", m, err)
+		}
+	}
+	if got, err := s.ConfirmMsisdnChange(winner, "4321"); err != nil || got != newTestMsisdn {
+		t.Errorf("winner confirming = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+)
+
+// nullStatsRow is a brand-new player's row as rows created before migration
+// 027 return it: the stats and bonus columns are NULL
+func nullStatsRow(repo *memRepo) map[string]interface{} {
+	row, _ := repo.CheckUser(context.Background(), testMsisdn)
+	for _, col := range []string{"bonus", "total_bets", "payout", "total_losses", "lost_count", "frequency"} {
+		row[col] = nil
+	}
+	return row
+}
+
+func finite(v float64) bool { return !math.IsNaN(v) && !math.IsInf(v, 0) }
+
+// checkFinite fails when a bet result carries NaN or Inf; encoding/json
+// refuses both, so a result that marshals is one the handler can send
+func checkFinite(t *testing.T, name string, r PlaceBetResult) {
+	t.Helper()
+	g := r.GameResult
+	for field, v := range map[string]float64{"WinAmount": g.WinAmount, "GrossAmount": g.GrossAmount, "TaxAmount": g.TaxAmount, "NetAmount": g.NetAmount} {
+		if !finite(v) {
+			t.Errorf("%s: %s = %v", name, field, v)
+		}
+	}
+	if _, err := json.Marshal(r); err != nil {
+		t.Errorf("%s: marshal result: %v", name, err)
+	}
+}
+
+// TestNewPlayerFirstBets places a brand-new player's first free bet and
+// first cash bet from a row whose stats are NULL: neither panics, neither
+// result holds NaN and the cached RTP starts from 0.
+func TestNewPlayerFirstBets(t *testing.T) {
+	for _, outcome := range []float64{0, 60} {
+		repo := newMemRepo()
+		p := repo.addPlayer(testMsisdn, 100)
+		p.FreeBet, p.FreeBetEnds = 1, time.Now().Add(time.Hour)
+		s := newTestService(t, repo, fixedOutcomes{"1": outcome})
+
+		free, err := s.PlaceBet(context.Background(), nullStatsRow(repo), "", "Test", "1", testMsisdn, 50, "1", "web")
+		if err != nil {
+			t.Fatalf("outcome %v: free bet: %v", outcome, err)
+		}
+		if free.FreeBet != "true" {
+			t.Fatalf("outcome %v: first bet = %+v, want a free bet", outcome, free)
+		}
+		checkFinite(t, "free bet", free)
+
+		cash, err := s.PlaceBet(context.Background(), nullStatsRow(repo), "", "Test", "1", testMsisdn, 50, "1", "web")
+		if err != nil {
+			t.Fatalf("outcome %v: cash bet: %v", outcome, err)
+		}
+		if cash.FreeBet != "false" {
+			t.Fatalf("outcome %v: second bet = %+v, want a cash bet", outcome, cash)
+		}
+		checkFinite(t, "cash bet", cash)
+
+		data, ok := s.players.Get(p.ID)
+		if !ok {
+			t.Fatalf("outcome %v: no cached RTP figures after two bets", outcome)
+		}
+		if !finite(data.CurrentRTP) || data.CurrentRTP < 0 {
+			t.Errorf("outcome %v: cached RTP = %v, want a finite percentage", outcome, data.CurrentRTP)
+		}
+	}
+}
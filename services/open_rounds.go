@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// States of an open round, as /open_rounds reports them
+const (
+	OpenRoundAwaitingPayment = "awaiting_payment" // STK push sent, M-Pesa has not answered
+	OpenRoundPaid            = "paid"             // deposit in, game not played yet
+	OpenRoundPlaying         = "playing"          // bet placed, not settled
+	OpenRoundRevealing       = "revealing"        // settled, outcome held until RevealAt
+)
+
+// openRoundLimit caps the deposits and the bets an /open_rounds answer lists
+const openRoundLimit = 20
+
+// OpenRound is a round of the player's that has not resolved: enough to
+// show a resume screen, and the endpoint to poll for the rest
+type OpenRound struct {
+	Reference   string     `json:"reference"`
+	Kind        string     `json:"kind" example:"deposit"` // deposit or bet
+	State       string     `json:"state" example:"paid"`
+	GameCatID   string     `json:"game_cat_id,omitempty"`
+	GameName    string     `json:"game_name,omitempty"`
+	Channel     string     `json:"channel,omitempty"`
+	Amount      float64    `json:"amount"`
+	SelectedBox string     `json:"selected_box,omitempty"`
+	RevealAt    *time.Time `json:"reveal_at,omitempty"`
+	DateCreated time.Time  `json:"date_created"`
+	Poll        string     `json:"poll" example:"/api/v1/bet/BET_0Q4X7R2M9K3T8V1A"`
+}
+
+// OpenRounds returns msisdn's unresolved rounds, newest first: deposits
+// awaiting M-Pesa or paid and not yet played, and bets not settled or
+// with their outcome held back. Rounds older than limits.open_round_max_age
+// are left to reconciliation.
+func (s *LuckyNumberService) OpenRounds(ctx context.Context, msisdn string) ([]OpenRound, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	since := time.Now().Add(-limits.OpenRoundMaxAge)
+
+	deposits, err := s.db.ListOpenDeposits(ctx, msisdn, since, openRoundLimit)
+	if err != nil {
+		return nil, err
+	}
+	bets, err := s.db.ListOpenBets(ctx, msisdn, since, openRoundLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	rounds := make([]OpenRound, 0, len(deposits)+len(bets))
+	for _, d := range deposits {
+		rounds = append(rounds, openDepositRound(d))
+	}
+	for _, b := range bets {
+		rounds = append(rounds, openBetRound(b))
+	}
+	slices.SortStableFunc(rounds, func(a, b OpenRound) int {
+		return b.DateCreated.Compare(a.DateCreated)
+	})
+	return rounds, nil
+}
+
+// openDepositRound polls a deposit M-Pesa has not answered on
+// /deposit_status and a paid one on /bet, which finds it once it is played
+func openDepositRound(d database.OpenDeposit) OpenRound {
+	r := OpenRound{
+		Reference:   d.Reference,
+		Kind:        "deposit",
+		State:       OpenRoundPaid,
+		GameCatID:   d.GameCatID,
+		GameName:    d.GameName,
+		Channel:     d.Channel,
+		Amount:      d.Amount,
+		SelectedBox: d.SelectedBox,
+		DateCreated: d.DateCreated,
+		Poll:        "/api/v1/bet/" + d.Reference,
+	}
+	if d.Status == "" {
+		r.State, r.Poll = OpenRoundAwaitingPayment, "/api/v1/deposit_status/"+d.Reference
+	}
+	return r
+}
+
+func openBetRound(b database.PlayerBet) OpenRound {
+	state := OpenRoundPlaying
+	if b.RevealAt != nil {
+		state = OpenRoundRevealing
+	}
+	return OpenRound{
+		Reference:   b.Reference,
+		Kind:        "bet",
+		State:       state,
+		GameCatID:   b.GameCatID,
+		GameName:    b.GameName,
+		Channel:     b.Channel,
+		Amount:      b.Amount,
+		SelectedBox: b.SelectedBox,
+		RevealAt:    b.RevealAt,
+		DateCreated: b.DateCreated,
+		Poll:        "/api/v1/bet/" + b.Reference,
+	}
+}
+
+// betResult answers GET /bet/:reference for a bet of msisdn placed without
+// a reveal delay: Pending until it settles, then Revealed with its result
+// status and win. The bet row keeps neither the boxes nor the tax
+// breakdown, so GameResult comes without them. RevealAt is when the bet
+// was placed.
+func (s *LuckyNumberService) betResult(ctx context.Context, msisdn, reference string) (BetReveal, error) {
+	bet, err := s.db.GetPlayerBet(ctx, reference, msisdn)
+	if err != nil {
+		return BetReveal{}, err
+	}
+	if bet == nil {
+		return BetReveal{}, ErrBetNotFound
+	}
+	reveal := BetReveal{Status: RevealPending, Reference: reference, RevealAt: bet.DateCreated}
+	if bet.ResultStatus == string(status.ResultPending) {
+		return reveal, nil
+	}
+	reveal.Status = RevealRevealed
+	reveal.GameResult = &PlaceBetResultDisplay{
+		ResultStatus: status.ResultStatus(bet.ResultStatus),
+		WinAmount:    bet.WinAmount,
+		GameID:       reference,
+		SelectedBox:  bet.SelectedBox,
+	}
+	return reveal, nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// openRoundRepo lists the seeded rounds created since the cutoff it is
+// asked for, as ListOpenDeposits and ListOpenBets do, and keeps the cutoff
+type openRoundRepo struct {
+	*memRepo
+	openDeposits []database.OpenDeposit
+	openBets     []database.PlayerBet
+	since        time.Time
+	limit        int
+}
+
+func (r *openRoundRepo) ListOpenDeposits(ctx context.Context, msisdn string, since time.Time, limit int) ([]database.OpenDeposit, error) {
+	r.since, r.limit = since, limit
+	return searchMatch(r.openDeposits, limit, func(d database.OpenDeposit) bool { return !d.DateCreated.Before(since) }), nil
+}
+
+func (r *openRoundRepo) ListOpenBets(ctx context.Context, msisdn string, since time.Time, limit int) ([]database.PlayerBet, error) {
+	return searchMatch(r.openBets, limit, func(b database.PlayerBet) bool { return !b.DateCreated.Before(since) }), nil
+}
+
+func TestOpenRoundStates(t *testing.T) {
+	now := time.Now()
+	revealAt := now.Add(time.Minute)
+	repo := &openRoundRepo{
+		memRepo: newMemRepo(),
+		openDeposits: []database.OpenDeposit{
+			{Reference: "BET_PAID", GameCatID: "2", GameName: "Supa", Channel: "app", Amount: 50, SelectedBox: "3", Status: "success", DateCreated: now.Add(-2 * time.Minute)},
+			{Reference: "BET_STK", GameCatID: "1", GameName: "PawaBox", Channel: "app", Amount: 20, SelectedBox: "5", DateCreated: now.Add(-time.Minute)},
+		},
+		openBets: []database.PlayerBet{
+			{Reference: "BET_REVEAL", GameCatID: "1", GameName: "PawaBox", Channel: "web", Amount: 20, SelectedBox: "1", ResultStatus: "Win", WinAmount: 60, DateCreated: now.Add(-3 * time.Minute), RevealAt: &revealAt},
+			{Reference: "BET_PLAY", GameCatID: "1", GameName: "PawaBox", Channel: "web", Amount: 10, SelectedBox: "2", ResultStatus: "Pending", DateCreated: now.Add(-30 * time.Second)},
+		},
+	}
+	s := newTestService(t, repo, nil)
+
+	rounds, err := s.OpenRounds(context.Background(), testMsisdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []OpenRound{
+		{Reference: "BET_PLAY", Kind: "bet", State: OpenRoundPlaying, GameCatID: "1", GameName: "PawaBox", Channel: "web", Amount: 10, SelectedBox: "2",
+			DateCreated: now.Add(-30 * time.Second), Poll: "/api/v1/bet/BET_PLAY"},
+		{Reference: "BET_STK", Kind: "deposit", State: OpenRoundAwaitingPayment, GameCatID: "1", GameName: "PawaBox", Channel: "app", Amount: 20, SelectedBox: "5",
+			DateCreated: now.Add(-time.Minute), Poll: "/api/v1/deposit_status/BET_STK"},
+		{Reference: "BET_PAID", Kind: "deposit", State: OpenRoundPaid, GameCatID: "2", GameName: "Supa", Channel: "app", Amount: 50, SelectedBox: "3",
+			DateCreated: now.Add(-2 * time.Minute), Poll: "/api/v1/bet/BET_PAID"},
+		{Reference: "BET_REVEAL", Kind: "bet", State: OpenRoundRevealing, GameCatID: "1", GameName: "PawaBox", Channel: "web", Amount: 20, SelectedBox: "1",
+			RevealAt: &revealAt, DateCreated: now.Add(-3 * time.Minute), Poll: "/api/v1/bet/BET_REVEAL"},
+	}
+	if !reflect.DeepEqual(rounds, want) {
+		t.Errorf("rounds = %+v\nwant %+v", rounds, want)
+	}
+	if repo.limit != openRoundLimit {
+		t.Errorf("limit = %d, want %d", repo.limit, openRoundLimit)
+	}
+}
+
+func TestOpenRoundsAgeCutoff(t *testing.T) {
+	now := time.Now()
+	repo := &openRoundRepo{
+		memRepo: newMemRepo(),
+		openDeposits: []database.OpenDeposit{
+			{Reference: "BET_OLD_STK", SelectedBox: "1", DateCreated: now.Add(-limits.OpenRoundMaxAge - time.Minute)},
+			{Reference: "BET_NEW_STK", SelectedBox: "1", DateCreated: now.Add(-limits.OpenRoundMaxAge + time.Minute)},
+		},
+		openBets: []database.PlayerBet{
+			{Reference: "BET_OLD", ResultStatus: "Pending", DateCreated: now.Add(-limits.OpenRoundMaxAge - time.Minute)},
+		},
+	}
+	s := newTestService(t, repo, nil)
+
+	rounds, err := s.OpenRounds(context.Background(), testMsisdn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 1 || rounds[0].Reference != "BET_NEW_STK" {
+		t.Errorf("rounds = %+v, want only the one inside limits.open_round_max_age", rounds)
+	}
+	if cutoff := now.Add(-limits.OpenRoundMaxAge); repo.since.Before(cutoff) || repo.since.Sub(cutoff) > time.Second {
+		t.Errorf("since %s, want open_round_max_age back from now, %s", repo.since, cutoff)
+	}
+
+	// None open is an empty list, not null
+	repo.openDeposits, repo.openBets = nil, nil
+	if rounds, err = s.OpenRounds(context.Background(), testMsisdn); err != nil || rounds == nil || len(rounds) != 0 {
+		t.Errorf("no open rounds = %#v, %v, want an empty list", rounds, err)
+	}
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func (r *otpRepo) GetLatestVerification(ctx context.Context, msisdn, purpose string) (*database.VerificationCode, error) {
+	c := r.latest(msisdn, purpose)
+	if c == nil {
+		return nil, nil
+	}
+	return &database.VerificationCode{ID: int64(c.ID), Msisdn: c.Msisdn, Purpose: c.Purpose, CodeHash: c.CodeHash,
+		Expired: c.Expired, Created: c.Created, Status: c.Status, ResendCount: c.ResendCount, LastSent: c.LastSent}, nil
+}
+
+// ReissueVerification retires id and carries its resend count on to the
+// new code, as the SQL does
+func (r *otpRepo) ReissueVerification(ctx context.Context, id int64, codeHash string, expired, created int64, maxResends int) (bool, error) {
+	for _, c := range r.codes {
+		if int64(c.ID) != id {
+			continue
+		}
+		if c.Status != 0 || c.ResendCount >= maxResends {
+			return false, nil
+		}
+		c.Status = 2
+		r.codes = append(r.codes, &otpRow{ID: int32(len(r.codes) + 1), Msisdn: c.Msisdn, Purpose: c.Purpose, CodeHash: codeHash,
+			Expired: expired, Created: created, LastSent: created, ResendCount: c.ResendCount + 1})
+		return true, nil
+	}
+	return false, nil
+}
+
+// dlrRepo records the delivery reports passed to the database
+type dlrRepo struct {
+	*memRepo
+	reports []string
+	known   bool
+}
+
+func (r *dlrRepo) UpdateSMSDeliveryStatus(ctx context.Context, recordID int64, status, description string) (bool, error) {
+	r.reports = append(r.reports, status)
+	return r.known, nil
+}
+
+// otpSMS is the number of OTP messages queued to msisdn
+func otpSMS(repo *memRepo, msisdn string) int {
+	n := 0
+	for _, m := range repo.sms {
+		if m.Msisdn == msisdn {
+			n++
+		}
+	}
+	return n
+}
+
+func TestResendOTPCooldown(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPLogin, "1234", now-5, now+300, false)
+
+	resend, err := s.ResendOTP(testMsisdn, OTPLogin, "5678", 5*time.Minute)
+	if !errors.Is(err, ErrOTPResendTooSoon) {
+		t.Fatalf("resend 5s after sending = %v, want ErrOTPResendTooSoon", err)
+	}
+	if want := ResendAllowedAfter() - 5; resend.ResendAllowedAfter < want-1 || resend.ResendAllowedAfter > want {
+		t.Errorf("ResendAllowedAfter = %d, want about %d", resend.ResendAllowedAfter, want)
+	}
+	if len(repo.codes) != 1 || otpSMS(repo.memRepo, testMsisdn) != 0 {
+		t.Error("a refused resend must neither replace nor send the code")
+	}
+}
+
+func TestResendOTPLimit(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	wait := ResendAllowedAfter()
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPLogin, "1234", now-wait, now+300, false)
+
+	for i := 1; i <= limits.OTPResendMax; i++ {
+		resend, err := s.ResendOTP(testMsisdn, OTPLogin, "5678", 5*time.Minute)
+		if err != nil {
+			t.Fatalf("resend %d = %v", i, err)
+		}
+		if resend.ResendsLeft != limits.OTPResendMax-i {
+			t.Errorf("resend %d leaves %d, want %d", i, resend.ResendsLeft, limits.OTPResendMax-i)
+		}
+		// as if the cooldown had passed
+		repo.latest(testMsisdn, OTPLogin).LastSent -= wait
+	}
+	if _, err := s.ResendOTP(testMsisdn, OTPLogin, "5678", 5*time.Minute); !errors.Is(err, ErrOTPResendLimit) {
+		t.Errorf("resend past the limit = %v, want ErrOTPResendLimit", err)
+	}
+	if n := otpSMS(repo.memRepo, testMsisdn); n != limits.OTPResendMax {
+		t.Errorf("%d OTP SMS queued, want %d", n, limits.OTPResendMax)
+	}
+	if _, err := s.ResendOTP("254700000009", OTPLogin, "5678", 5*time.Minute); !errors.Is(err, ErrOTPNotFound) {
+		t.Errorf("resend without a code = %v, want ErrOTPNotFound", err)
+	}
+}
+
+func TestResendOTPAfterExpiryIssuesNewCode(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPLogin, "1234", now-600, now-300, false)
+
+	resend, err := s.ResendOTP(testMsisdn, OTPLogin, "5678", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resend.ExpireIn != 300 {
+		t.Errorf("ExpireIn = %d, want 300", resend.ExpireIn)
+	}
+	if repo.codes[0].Status != 2 {
+		t.Errorf("old code status = %d, want retired (2)", repo.codes[0].Status)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "1234"); err == nil {
+		t.Error("the expired code must not verify after a resend")
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "5678"); err != nil {
+		t.Errorf("the new code = %v, want it to verify", err)
+	}
+	if len(repo.sms) != 1 || !strings.Contains(repo.sms[0].Message, "5678") {
+		t.Errorf("queued %+v, want the new code sent", repo.sms)
+	}
+}
+
+func TestRecordSMSDelivery(t *testing.T) {
+	repo := &dlrRepo{memRepo: newMemRepo(), known: true}
+	s := newTestService(t, repo, nil)
+	for _, st := range []string{models.SMSSent, models.SMSDelivered, models.SMSFailed} {
+		ok, err := s.RecordSMSDelivery(7, st, "")
+		if err != nil || !ok {
+			t.Errorf("RecordSMSDelivery(%s) = %v, %v", st, ok, err)
+		}
+	}
+	repo.known = false
+	if ok, _ := s.RecordSMSDelivery(8, models.SMSDelivered, ""); ok {
+		t.Error("an unknown or final row should report false")
+	}
+	if len(repo.reports) != 4 {
+		t.Errorf("reports = %v, want each passed to the database", repo.reports)
+	}
+}
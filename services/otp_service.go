@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// OTPService issues and checks the one-time codes sent by SMS
+type OTPService interface {
+	InsertVerification(msisdn, purpose, code string, expired int64, created int64) (int, error)
+	ResendOTP(msisdn, purpose, freshCode string, ttl time.Duration) (OTPResend, error)
+	VerifyOTP(msisdn, purpose, otp string) (int64, error)
+}
+
+var _ OTPService = (*LuckyNumberService)(nil)
+
+// VerifyOTP failures callers can tell apart with errors.Is
+var (
+	ErrOTPInvalid = errors.New("Wrong Code")
+	ErrOTPExpired = errors.New("otp expired")
+)
+
+// VerifyOTP verifies an OTP sent for purpose and returns remaining seconds until expiry (ExpireIn).
+// Returns (0, ErrOTPInvalid) or (0, ErrOTPExpired) on a bad OTP, (0, error) on other errors.
+// A code sent for another purpose is invalid. Codes are compared by their
+// auth.HashOTP hash; one stored in plaintext before codes were hashed
+// still verifies within limits.otp_plaintext_grace of being issued.
+func (s *LuckyNumberService) VerifyOTP(msisdn, purpose, otp string) (int64, error) {
+	if s == nil || s.db == nil {
+		log.Printf("PANIC PREVENTION: s=%p, s.db=%p", s, s.db)
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+
+	ctx := context.Background()
+	now := clock.Now().Unix() // seconds
+	defer utils.HoldSecret(otp)()
+
+	hash, err := auth.HashOTP(msisdn, purpose, otp)
+	if err != nil {
+		return 0, err
+	}
+	guess := database.OTPGuess{
+		Hash:           hash,
+		Code:           otp,
+		PlaintextSince: now - int64(limits.OTPPlaintextGrace/time.Second),
+	}
+
+	// Step 1 — Check if there is an unused OTP (status = 0)
+	checked, err := s.db.GetOTPChecked(ctx, msisdn, purpose, guess)
+	if err != nil {
+		logrus.Errorf("GetOTPChecked error: %v", err)
+		return 0, err
+	}
+	if checked == nil {
+		// invalid otp
+		logrus.Warnf("Invalid OTP for msisdn=%s purpose=%s", msisdn, purpose)
+		return 0, ErrOTPInvalid
+	}
+
+	// Step 2 — Verify expiry (expired > now)
+	verified, err := s.db.GetOTPVerified(ctx, msisdn, purpose, guess, now)
+	if err != nil {
+		logrus.Errorf("GetOTPVerified error: %v", err)
+		return 0, err
+	}
+
+	// Step 3 — Mark OTP as used (status = 1) using id from checked row
+
+	if _, err := s.db.UpdateIntoVerification(ctx, checked["id"].(int32)); err != nil {
+		logrus.Errorf("UpdateIntoVerification error: %v", err)
+		return 0, err
+	}
+
+	// Step 4 — If verified == nil → expired
+	if verified == nil {
+		logrus.Warnf("OTP expired for msisdn=%s", msisdn)
+		return 0, ErrOTPExpired
+	}
+
+	// Compute remaining seconds until expiry
+	expiredVal, ok := verified["expired"]
+	if !ok {
+		// If the column is missing, treat as success but no expiry info.
+		return 0, nil
+	}
+
+	var expiredSec int64
+	switch v := expiredVal.(type) {
+	case int64:
+		expiredSec = v
+	case int:
+		expiredSec = int64(v)
+	case float64:
+		expiredSec = int64(v)
+	case string:
+		// attempt parse if stored as string
+		var parsed int64
+		_, err := fmt.Sscan(v, &parsed)
+		if err == nil {
+			expiredSec = parsed
+		} else {
+			// if it's a timestamp string, try parsing RFC3339
+			if t, perr := time.Parse(time.RFC3339, v); perr == nil {
+				expiredSec = t.Unix()
+			} else {
+				// unknown format
+				expiredSec = 0
+			}
+		}
+	default:
+		expiredSec = 0
+	}
+
+	remain := expiredSec - now
+	if remain < 0 {
+		// expired (this branch should be rare because GetOTPVerified already checks expired > now)
+		return 0, ErrOTPExpired
+	}
+
+	// success: return remaining seconds until expiry
+	return remain, nil
+}
+
+// InsertVerification stores code as msisdn's only valid purpose code, sends
+// it by SMS and returns how many resends the code has left. Codes sent
+// before it can no longer be verified; asking again while the last code is
+// valid counts as a resend of it. Only the code's hash is stored, and logs
+// mask the code while it is in hand. The code is stored first: when the
+// SMS cannot be queued it stays valid and ErrOTPDeliveryDelayed is
+// returned, so a resend can deliver a new one.
+func (s *LuckyNumberService) InsertVerification(msisdn, purpose, code string, expired int64, created int64) (int, error) {
+	ctx := context.Background()
+	defer utils.HoldSecret(code)()
+
+	hash, err := auth.HashOTP(msisdn, purpose, code)
+	if err != nil {
+		return 0, err
+	}
+	resends, err := s.db.InsertVerification(ctx, msisdn, purpose, hash, expired, created)
+	if err != nil {
+		return 0, err
+	}
+	left := max(limits.OTPResendMax-resends, 0)
+	return left, s.queueOTP(ctx, msisdn, code)
+}
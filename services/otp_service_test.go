@@ -0,0 +1,339 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// otpRow is one row of the verification table
+type otpRow struct {
+	ID                  int32
+	Msisdn, Purpose     string
+	CodeHash, Code      string
+	Expired, Created    int64
+	Status, ResendCount int
+	LastSent            int64
+}
+
+// otpRepo keeps the verification table in memory over a memRepo
+type otpRepo struct {
+	*memRepo
+	codes []*otpRow
+}
+
+func newOTPRepo() *otpRepo {
+	return &otpRepo{memRepo: newMemRepo()}
+}
+
+// latest is the newest unused code for msisdn and purpose, the only one checked
+func (r *otpRepo) latest(msisdn, purpose string) *otpRow {
+	for i := len(r.codes) - 1; i >= 0; i-- {
+		c := r.codes[i]
+		if c.Msisdn == msisdn && c.Purpose == purpose && c.Status == 0 {
+			return c
+		}
+	}
+	return nil
+}
+
+func (r *otpRepo) matching(msisdn, purpose string, guess database.OTPGuess) *otpRow {
+	c := r.latest(msisdn, purpose)
+	if c == nil {
+		return nil
+	}
+	if c.CodeHash == guess.Hash || (c.CodeHash == "" && c.Code == guess.Code && c.Created >= guess.PlaintextSince) {
+		return c
+	}
+	return nil
+}
+
+func (r *otpRepo) GetOTPChecked(ctx context.Context, msisdn, purpose string, guess database.OTPGuess) (map[string]interface{}, error) {
+	c := r.matching(msisdn, purpose, guess)
+	if c == nil {
+		return nil, nil
+	}
+	return map[string]interface{}{"id": c.ID, "msisdn": c.Msisdn, "purpose": c.Purpose, "expired": c.Expired, "created": c.Created, "status": int32(c.Status)}, nil
+}
+
+func (r *otpRepo) GetOTPVerified(ctx context.Context, msisdn, purpose string, guess database.OTPGuess, now int64) (map[string]interface{}, error) {
+	c := r.matching(msisdn, purpose, guess)
+	if c == nil || c.Expired <= now {
+		return nil, nil
+	}
+	return map[string]interface{}{"id": c.ID, "msisdn": c.Msisdn, "purpose": c.Purpose, "expired": c.Expired, "created": c.Created, "status": int32(c.Status)}, nil
+}
+
+func (r *otpRepo) UpdateIntoVerification(ctx context.Context, id int32) (int64, error) {
+	for _, c := range r.codes {
+		if c.ID == id {
+			c.Status = 1
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// InsertVerification mirrors the database: every other unused code for
+// msisdn and purpose is retired, a request while the latest is valid
+// counts as a resend of it, and the same hash again refreshes its row
+func (r *otpRepo) InsertVerification(ctx context.Context, msisdn, purpose, codeHash string, expired, created int64) (int, error) {
+	latest := r.latest(msisdn, purpose)
+	resends := 0
+	if latest != nil && latest.Expired > created {
+		resends = latest.ResendCount + 1
+	}
+	for _, c := range r.codes {
+		if c.Msisdn == msisdn && c.Purpose == purpose && c.Status == 0 && (c != latest || c.CodeHash != codeHash) {
+			c.Status = 2
+		}
+	}
+	if latest != nil && latest.CodeHash == codeHash {
+		latest.Expired, latest.Created, latest.LastSent, latest.ResendCount = expired, created, created, resends
+		return resends, nil
+	}
+	r.codes = append(r.codes, &otpRow{ID: int32(len(r.codes) + 1), Msisdn: msisdn, Purpose: purpose, CodeHash: codeHash,
+		Expired: expired, Created: created, ResendCount: resends, LastSent: created})
+	return resends, nil
+}
+
+// issue stores code for msisdn and purpose, hashed unless plaintext is set
+func (r *otpRepo) issue(t *testing.T, msisdn, purpose, code string, created, expired int64, plaintext bool) {
+	t.Helper()
+	row := &otpRow{ID: int32(len(r.codes) + 1), Msisdn: msisdn, Purpose: purpose, Created: created, Expired: expired, LastSent: created}
+	if plaintext {
+		row.Code = code
+	} else {
+		hash, err := auth.HashOTP(msisdn, purpose, code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		row.CodeHash = hash
+	}
+	r.codes = append(r.codes, row)
+}
+
+func configureTestOTP(t *testing.T) {
+	t.Helper()
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyOTP(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	repo.issue(t, testMsisdn, "login", "1234", now, now+300, false)
+	if _, err := s.VerifyOTP(testMsisdn, "login", "9999"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("wrong code = %v, want ErrOTPInvalid", err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "withdraw", "1234"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("code for another purpose = %v, want ErrOTPInvalid", err)
+	}
+	left, err := s.VerifyOTP(testMsisdn, "login", "1234")
+	if err != nil {
+		t.Fatalf("right code = %v", err)
+	}
+	if left < 295 || left > 300 {
+		t.Errorf("remaining = %ds, want about 300", left)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "login", "1234"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("used code = %v, want ErrOTPInvalid", err)
+	}
+
+	repo.issue(t, testMsisdn, "login", "5678", now-600, now-300, false)
+	if _, err := s.VerifyOTP(testMsisdn, "login", "5678"); !errors.Is(err, ErrOTPExpired) {
+		t.Errorf("expired code = %v, want ErrOTPExpired", err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "login", "5678"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("expired code retried = %v, want ErrOTPInvalid once used up", err)
+	}
+}
+
+func TestVerifyOTPPlaintextGrace(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+	grace := int64(limits.OTPPlaintextGrace / time.Second)
+
+	repo.issue(t, testMsisdn, "login", "4321", now-grace+60, now+300, true)
+	if _, err := s.VerifyOTP(testMsisdn, "login", "4321"); err != nil {
+		t.Errorf("plaintext code within the grace = %v, want verified", err)
+	}
+
+	repo.issue(t, testMsisdn, "login", "8765", now-grace-60, now+300, true)
+	if _, err := s.VerifyOTP(testMsisdn, "login", "8765"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("plaintext code past the grace = %v, want ErrOTPInvalid", err)
+	}
+}
+
+func TestInsertVerificationSupersedes(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	repo.issue(t, testMsisdn, "withdraw", "7777", now, now+300, false)
+	for i, code := range []string{"1234", "5678", "9012"} {
+		left, err := s.InsertVerification(testMsisdn, "login", code, now+300, now+int64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := limits.OTPResendMax - i; left != want {
+			t.Errorf("request %d left %d resends, want %d", i+1, left, want)
+		}
+	}
+	active := 0
+	for _, c := range repo.codes {
+		if c.Purpose == "login" && c.Status == 0 {
+			active++
+		}
+	}
+	if active != 1 {
+		t.Errorf("%d usable login codes, want only the latest", active)
+	}
+
+	// A code sent before a resend no longer verifies
+	for _, old := range []string{"1234", "5678"} {
+		if _, err := s.VerifyOTP(testMsisdn, "login", old); !errors.Is(err, ErrOTPInvalid) {
+			t.Errorf("superseded %s = %v, want ErrOTPInvalid", old, err)
+		}
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "login", "9012"); err != nil {
+		t.Errorf("latest code = %v, want verified", err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "withdraw", "7777"); err != nil {
+		t.Errorf("another purpose's code = %v, want it left usable", err)
+	}
+
+	// Once the last code has expired a request starts over
+	if _, err := s.InsertVerification(testMsisdn, "login", "3456", now+900, now+600); err != nil {
+		t.Fatal(err)
+	}
+	if left, err := s.InsertVerification(testMsisdn, "login", "4567", now+1200, now+900); err != nil || left != limits.OTPResendMax {
+		t.Errorf("after expiry left = %d, %v, want %d", left, err, limits.OTPResendMax)
+	}
+}
+
+func TestInsertVerificationFixedCode(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	// A test account gets 1111 every time: its one row is refreshed
+	for i := 0; i < 3; i++ {
+		if _, err := s.InsertVerification(testMsisdn, "login", "1111", now+300+int64(i), now+int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(repo.codes) != 1 || repo.codes[0].Expired != now+302 || repo.codes[0].ResendCount != 2 {
+		t.Fatalf("codes = %+v, want the one row refreshed", repo.codes)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "login", "1111"); err != nil {
+		t.Errorf("fixed code = %v, want verified", err)
+	}
+
+	// Used, it is stored afresh on the next login
+	if _, err := s.InsertVerification(testMsisdn, "login", "1111", now+400, now+100); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.codes) != 2 || repo.codes[1].Status != 0 {
+		t.Errorf("codes = %+v, want a new row after the used one", repo.codes)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, "login", "1111"); err != nil {
+		t.Errorf("fixed code on the next login = %v, want verified", err)
+	}
+}
+
+// echoSMSRepo fails every dbQueue insert with an error quoting the
+// message, as a constraint violation does
+type echoSMSRepo struct {
+	*otpRepo
+}
+
+func (r *echoSMSRepo) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	return 0, fmt.Errorf("dbQueue: value too long for %q", message)
+}
+
+// captureLog sends the standard logger to a buffer through the redaction
+// hook bootstrap installs, until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	logger := logrus.StandardLogger()
+	out, formatter := logger.Out, logger.Formatter
+	hooks := logger.ReplaceHooks(make(logrus.LevelHooks))
+	logger.AddHook(utils.SecretRedactionHook{})
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	t.Cleanup(func() {
+		logger.ReplaceHooks(hooks)
+		logger.SetOutput(out)
+		logger.SetFormatter(formatter)
+	})
+	return &buf
+}
+
+func TestOTPCodeNeverLogged(t *testing.T) {
+	configureTestOTP(t)
+	repo := &echoSMSRepo{otpRepo: newOTPRepo()}
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+	buf := captureLog(t)
+
+	if _, err := s.InsertVerification(testMsisdn, OTPLogin, "4821", now+300, now); !errors.Is(err, ErrOTPDeliveryDelayed) {
+		t.Fatalf("OTP with dbQueue refusing it = %v, want ErrOTPDeliveryDelayed", err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "9157"); !errors.Is(err, ErrOTPInvalid) {
+		t.Fatalf("wrong code = %v", err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "4821"); err != nil {
+		t.Fatalf("right code = %v", err)
+	}
+
+	out := buf.String()
+	for _, code := range []string{"4821", "9157"} {
+		if strings.Contains(out, code) {
+			t.Errorf("log carries the code %s:\n%s", code, out)
+		}
+	}
+	if !strings.Contains(out, `\"Your`) || !strings.Contains(out, "****") {
+		t.Errorf("log = %q, want the failed SMS logged with its code masked", out)
+	}
+	for _, c := range repo.codes {
+		if c.Code != "" || c.CodeHash == "" || strings.Contains(c.CodeHash, "4821") {
+			t.Errorf("stored row = %+v, want only the code's hash", c)
+		}
+	}
+	if utils.RedactSecrets("4821") != "4821" {
+		t.Error("the code is still held after the request")
+	}
+}
+
+func TestOTPSMSCarriesCode(t *testing.T) {
+	configureTestOTP(t)
+	repo := newOTPRepo()
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	if _, err := s.InsertVerification(testMsisdn, OTPLogin, "4821", now+300, now); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.sms) != 1 || !strings.Contains(repo.sms[0].Message, "4821") {
+		t.Errorf("sms = %+v, want the code in the message sent", repo.sms)
+	}
+}
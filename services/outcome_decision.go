@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+)
+
+// Outcome branches: how the box generator settled a selected box
+const (
+	BranchForceWin     = "force_win"     // the player was owed a win after a losing run
+	BranchPotentialWin = "potential_win" // the box drew a win, then checked against the RTPs and the basket
+	BranchLoss         = "loss"          // the box drew nothing
+	BranchJackpot      = "jackpot"       // the box of a jackpot winner
+)
+
+var ErrDecisionNotFound = errors.New("outcome decision not found")
+
+// DecisionParams is the part of GenerateWinAmountsParams an outcome is
+// decided from
+type DecisionParams struct {
+	BetAmount        float64 `json:"bet_amount"`
+	DefaultRTP       float64 `json:"default_rtp"`
+	AdjustmentRTP    float64 `json:"adjustment_rtp"`
+	PlayerRTP        float64 `json:"player_rtp"`
+	MinWinMultiplier float64 `json:"min_win_multiplier"`
+	MaxWinMultiplier float64 `json:"max_win_multiplier"`
+	MaxExposure      float64 `json:"max_exposure"`
+	MaxWon           float64 `json:"max_won"`
+	VigPercentage    float64 `json:"vig_percentage"`
+	RTPOverload      float64 `json:"rtp_overload"`
+	PlayerLostCount  int64   `json:"player_lost_count"`
+	MinLossCount     int     `json:"min_loss_count"`
+	ForceWinBlocked  bool    `json:"force_win_blocked,omitempty"`
+	GameNameInit     string  `json:"game_name_init"`
+}
+
+// DecisionKPI is the day's KPI a box was decided against
+type DecisionKPI struct {
+	Bet    float64 `json:"bet"`
+	Payout float64 `json:"payout"`
+	RTP    float64 `json:"rtp"`
+}
+
+// OutcomeDecision is kept for every settled bet so its outcome can be
+// justified later: the inputs the generator saw, the branch it took for the
+// selected box and what the bet finally paid
+type OutcomeDecision struct {
+	Reference      string             `json:"reference"`
+	Msisdn         string             `json:"msisdn"`
+	GameCatID      string             `json:"game_cat_id,omitempty"`
+	SelectedBox    string             `json:"selected_box"`
+	Branch         string             `json:"branch" example:"potential_win"`
+	Generated      float64            `json:"generated"` // the selected box as drawn, before its branch
+	Params         DecisionParams     `json:"params"`
+	KPI            DecisionKPI        `json:"kpi"`
+	Basket         float64            `json:"basket"`
+	Boxes          map[string]float64 `json:"boxes"` // every box once generated
+	ExposureCapped bool               `json:"exposure_capped,omitempty"`
+	Result         string             `json:"result" example:"Win"`
+	Amount         float64            `json:"amount"` // gross win; 0 for a loss
+	DecidedAt      time.Time          `json:"decided_at"`
+}
+
+type decisionKey struct{}
+
+// decisionTrace collects, while a layout is generated, what each selected
+// box was decided from. A nil trace records nothing, as for simulated and
+// demo bets.
+type decisionTrace struct {
+	boxes map[string]OutcomeDecision
+}
+
+// withDecisionTrace returns a context under which generateLayout records
+// its decisions for settleSelection
+func withDecisionTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, decisionKey{}, &decisionTrace{boxes: map[string]OutcomeDecision{}})
+}
+
+func decisionTraceFrom(ctx context.Context) *decisionTrace {
+	t, _ := ctx.Value(decisionKey{}).(*decisionTrace)
+	return t
+}
+
+// record notes that box took branch, having been drawn as generated, with
+// the KPI and basket it was checked against
+func (t *decisionTrace) record(box, branch string, generated float64, params GenerateWinAmountsParams, kpi map[string]interface{}, basket float64) {
+	if t == nil {
+		return
+	}
+	t.boxes[box] = OutcomeDecision{
+		SelectedBox: box,
+		Branch:      branch,
+		Generated:   round2(generated),
+		Params:      decisionParams(params),
+		KPI:         decisionKPI(kpi),
+		Basket:      round2(basket),
+	}
+}
+
+// decision returns what was recorded for box
+func (t *decisionTrace) decision(box string) OutcomeDecision {
+	if t == nil {
+		return OutcomeDecision{SelectedBox: box}
+	}
+	d, ok := t.boxes[box]
+	if !ok {
+		d.SelectedBox = box
+	}
+	return d
+}
+
+func decisionParams(p GenerateWinAmountsParams) DecisionParams {
+	return DecisionParams{
+		BetAmount:        p.BetAmount,
+		DefaultRTP:       p.DefaultRTP,
+		AdjustmentRTP:    p.AdjustmentRTP,
+		PlayerRTP:        p.PlayerRTP,
+		MinWinMultiplier: p.MinWinMultiplier,
+		MaxWinMultiplier: p.MaxWinMultiplier,
+		MaxExposure:      p.MaxExposure,
+		MaxWon:           round2(p.MaxWon),
+		VigPercentage:    p.VigPercentage,
+		RTPOverload:      p.RTPOverload,
+		PlayerLostCount:  p.PlayerLostCount,
+		MinLossCount:     p.MinLossCount,
+		ForceWinBlocked:  p.ForceWinBlocked,
+		GameNameInit:     p.GameNameInit,
+	}
+}
+
+func decisionKPI(kpi map[string]interface{}) DecisionKPI {
+	return DecisionKPI{
+		Bet:    utils.ToFloat64(kpi["bet"]),
+		Payout: utils.ToFloat64(kpi["payout"]),
+		RTP:    utils.ToFloat64(kpi["rtp"]),
+	}
+}
+
+// boxValues is the amount of every box in winAmounts
+func boxValues(winAmounts map[string]WinAmount) map[string]float64 {
+	values := make(map[string]float64, len(winAmounts))
+	for box, w := range winAmounts {
+		values[box] = round2(w.Value)
+	}
+	return values
+}
+
+// recordDecision stores d for the bet it settled. It is called right
+// after the bet row is marked won or lost.
+func (s *LuckyNumberService) recordDecision(ctx context.Context, d OutcomeDecision, result status.ResultStatus, amount float64) error {
+	d.Result = string(result)
+	d.Amount = round2(amount)
+	d.DecidedAt = time.Now()
+	raw, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to encode outcome decision %s: %w", d.Reference, err)
+	}
+	return s.db.InsertOutcomeDecision(ctx, d.Reference, d.Msisdn, d.GameCatID, d.Branch, d.Result, d.Amount, raw)
+}
+
+// GetOutcomeDecision returns how the bet reference was decided
+func (s *LuckyNumberService) GetOutcomeDecision(reference string) (OutcomeDecision, error) {
+	if s == nil || s.db == nil {
+		return OutcomeDecision{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	row, err := s.db.GetOutcomeDecision(ctx, reference)
+	if err != nil {
+		return OutcomeDecision{}, err
+	}
+	if row == nil {
+		return OutcomeDecision{}, ErrDecisionNotFound
+	}
+
+	var d OutcomeDecision
+	if err := json.Unmarshal([]byte(utils.ToString(row["decision"])), &d); err != nil {
+		return OutcomeDecision{}, fmt.Errorf("failed to decode outcome decision %s: %w", reference, err)
+	}
+	if at, ok := row["date_created"].(time.Time); ok {
+		d.DecidedAt = at
+	}
+	return d, nil
+}
+
+// PurgeOutcomeDecisions deletes decisions older than
+// limits.decision_retention and returns how many were removed. A zero
+// retention keeps them all.
+func (s *LuckyNumberService) PurgeOutcomeDecisions(ctx context.Context) (int64, error) {
+	if limits.DecisionRetention <= 0 {
+		return 0, nil
+	}
+	return s.db.PurgeOutcomeDecisions(ctx, time.Now().Add(-limits.DecisionRetention))
+}
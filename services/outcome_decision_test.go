@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/status"
+	"testing"
+	"time"
+)
+
+// decisionRepo keeps every outcome decision written, as outcome_decisions
+// does, so a second row for a bet shows up
+type decisionRepo struct {
+	*memRepo
+	rows map[string][]map[string]interface{}
+}
+
+func newDecisionRepo() *decisionRepo {
+	repo := &decisionRepo{memRepo: newMemRepo(), rows: map[string][]map[string]interface{}{}}
+	repo.addPlayer(testMsisdn, 10000)
+	return repo
+}
+
+func (r *decisionRepo) InsertOutcomeDecision(ctx context.Context, reference, msisdn, gameCatID, branch, result string, amount float64, decision []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rows[reference] = append(r.rows[reference], map[string]interface{}{
+		"branch": branch, "result": result, "amount": amount, "decision": string(decision), "date_created": time.Now(),
+	})
+	return nil
+}
+
+func (r *decisionRepo) GetOutcomeDecision(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rows := r.rows[reference]; len(rows) > 0 {
+		return rows[0], nil
+	}
+	return nil, nil
+}
+
+func TestEverySettledBetHasOneDecision(t *testing.T) {
+	repo := newDecisionRepo()
+	s := newTestService(t, repo, nil)
+
+	branches := map[string]int{}
+	for i := 0; i < 40; i++ {
+		if i%10 == 9 {
+			// A long losing run is owed a win
+			repo.mu.Lock()
+			repo.players[testMsisdn].LostCount = 30
+			repo.mu.Unlock()
+		}
+		result := placeTestBet(t, s, repo.memRepo, 20, "3").GameResult
+		reference := result.GameID
+
+		if n := len(repo.rows[reference]); n != 1 {
+			t.Fatalf("bet %s has %d decisions, want 1", reference, n)
+		}
+		d, err := s.GetOutcomeDecision(reference)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branches[d.Branch]++
+
+		won := result.ResultStatus == status.ResultWin
+		if d.Result != string(result.ResultStatus) || d.Amount != round2(result.GrossAmount) {
+			t.Errorf("bet %s: decision %s %v, bet %s %v", reference, d.Result, d.Amount, result.ResultStatus, result.GrossAmount)
+		}
+		switch {
+		case d.Branch == BranchLoss && won:
+			t.Errorf("bet %s won on the loss branch", reference)
+		case d.Branch == BranchForceWin && !won:
+			t.Errorf("bet %s lost on the force win branch", reference)
+		case won && d.Branch != BranchForceWin && d.Branch != BranchPotentialWin:
+			t.Errorf("bet %s won on branch %q", reference, d.Branch)
+		}
+		if d.Reference != reference || d.Msisdn != testMsisdn || d.GameCatID != "1" || d.SelectedBox != "3" || len(d.Boxes) == 0 {
+			t.Errorf("bet %s: decision %+v, want the bet's reference, player, game, box and boxes", reference, d)
+		}
+		if d.Params.BetAmount != 20 || d.Params.DefaultRTP == 0 {
+			t.Errorf("bet %s: params %+v, want the stake and the game's RTP", reference, d.Params)
+		}
+		if i%10 == 9 && d.Branch != BranchForceWin {
+			t.Errorf("bet %s after a losing run took %q, want %s", reference, d.Branch, BranchForceWin)
+		}
+	}
+	if branches[BranchForceWin] != 4 {
+		t.Errorf("branches %v, want 4 force wins", branches)
+	}
+	if len(repo.rows) != 40 {
+		t.Errorf("%d bets with decisions, want 40", len(repo.rows))
+	}
+}
+
+func TestDecisionRecordIsTrimmed(t *testing.T) {
+	repo := newDecisionRepo()
+	s := newTestService(t, repo, nil)
+	reference := placeTestBet(t, s, repo.memRepo, 20, "3").GameResult.GameID
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal([]byte(repo.rows[reference][0]["decision"].(string)), &raw); err != nil {
+		t.Fatal(err)
+	}
+	params, _ := raw["params"].(map[string]interface{})
+	for _, key := range []string{"KPI", "kpi", "msisdn", "SelectedNumber"} {
+		if _, ok := params[key]; ok {
+			t.Errorf("params carry %s: %v", key, params)
+		}
+	}
+	if n := len(repo.rows[reference][0]["decision"].(string)); n > 2048 {
+		t.Errorf("decision is %d bytes, want a compact record", n)
+	}
+
+	if _, err := s.GetOutcomeDecision("UNKNOWN"); !errors.Is(err, ErrDecisionNotFound) {
+		t.Errorf("unknown reference = %v, want ErrDecisionNotFound", err)
+	}
+}
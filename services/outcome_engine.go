@@ -0,0 +1,506 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fiberapp/money"
+	"fiberapp/utils"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+// OutcomeEngine lays out the boxes of a bet: what each box holds, given the
+// player's RTP, the game's basket and its forced-win rules
+type OutcomeEngine interface {
+	GenerateWinAmounts(ctx context.Context, params GenerateWinAmountsParams) (map[string]WinAmount, error)
+}
+
+// gameOutcomes is the OutcomeEngine of real games, reading game and basket
+// figures through db
+type gameOutcomes struct {
+	db database.GameReader
+}
+
+var _ OutcomeEngine = gameOutcomes{}
+
+// NewOutcomeEngine returns the OutcomeEngine reading through db
+func NewOutcomeEngine(db database.GameReader) OutcomeEngine {
+	return gameOutcomes{db: db}
+}
+
+func (o gameOutcomes) GenerateWinAmounts(ctx context.Context, params GenerateWinAmountsParams) (map[string]WinAmount, error) {
+	return generateWinAmounts(ctx, o.db, params)
+}
+
+type GenerateWinAmountsParams struct {
+	Msisdn           string
+	KPI              map[string]interface{}
+	DefaultRTP       float64
+	AdjustmentRTP    float64
+	PlayerRTP        float64
+	Reference        string
+	BetAmount        float64
+	SelectedNumber   string
+	PlayerID         int64
+	MinWinMultiplier float64
+	MaxWinMultiplier float64
+	MaxExposure      float64
+	GameNameInit     string
+	PlayerLostCount  int64
+	MinLossCount     int
+	MaxWon           float64
+	VigPercentage    float64
+	RTPOverload      float64
+	BasketShare      float64 // of the basket a win may take; 0 is defaultBasketShare
+	ForceWinBlocked  bool    // the loss streak is long enough but has not earned its forced win; see streakEarnsForcedWin
+}
+
+// Shares of the basket a single win may take. flags.TightBasket trials the
+// tighter one on a share of players.
+const (
+	defaultBasketShare = 0.80
+	tightBasketShare   = 0.70
+)
+
+// checkPayouts refuses a layout with a box paying a negative amount or more
+// than the game's max_exposure, which already caps stake times the max win
+// multiplier
+func checkPayouts(winAmounts map[string]WinAmount, maxExposure float64) error {
+	for box, w := range winAmounts {
+		if err := money.CheckPayout(w.Value, maxExposure); err != nil {
+			return fmt.Errorf("box %s: %w", box, err)
+		}
+	}
+	return nil
+}
+
+// GenerateWinAmounts generates unique win amounts for each box number
+func (s *LuckyNumberService) GenerateWinAmounts(ctx context.Context, params GenerateWinAmountsParams) (map[string]WinAmount, error) {
+	return s.outcomes.GenerateWinAmounts(ctx, params)
+}
+
+// generateWinAmounts is the box generator shared by real and demo games. It
+// only reads through db.
+func generateWinAmounts(ctx context.Context, db database.GameReader, params GenerateWinAmountsParams) (map[string]WinAmount, error) {
+	return generateLayout(ctx, db, params, []string{params.SelectedNumber})
+}
+
+// generateLayout generates one box layout for every box in selected. Each
+// selected box goes through the RTP and basket checks in turn, counting the
+// wins already given to the boxes before it.
+func generateLayout(ctx context.Context, db database.GameReader, params GenerateWinAmountsParams, selected []string) (map[string]WinAmount, error) {
+	r, logger := rngFrom(ctx), gameLog(ctx)
+
+	// Generate 7 unique random numbers between 1-7
+	chosenNumbers := randUniqueInts(r, 1, 8, 7)
+	numZeroBoxes := randInt(r, 0, 3) // 0–2
+	// numZeroBoxes := cryptoRandIndex(3) + 1 // 1-3
+
+	boxes := make(map[string]WinAmount)
+	totalAssigned := 0.0
+
+	// Get basket value
+	basket, err := db.CheckBasketLucky(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check basket: %w", err)
+	}
+	basketValue := utils.ToFloat64(basket["amount"])
+
+	logger.Infof("Max won: %.2f", params.MaxWon)
+	maxWinAmount := params.MaxWon
+
+	// Calculate min and max win amounts
+	minWinAmount := params.BetAmount * params.MinWinMultiplier
+	maxWinAmountCalc := math.Min(params.BetAmount*params.MaxWinMultiplier, params.MaxExposure)
+
+	basketShare := params.BasketShare
+	if basketShare <= 0 {
+		basketShare = defaultBasketShare
+	}
+	newBasketValue := basketValue * basketShare // max win in basket
+
+	if newBasketValue > minWinAmount {
+		maxWinAmountCalc = math.Min(newBasketValue, params.MaxExposure)
+	}
+
+	winAward := ""
+
+	// Select random boxes for awards
+	numSelectedBoxes := randInt(r, 1, 2) // 0-2
+	selectedBoxes := selectRandomBoxes(r, chosenNumbers, numSelectedBoxes)
+
+	logger.Infof("Selected boxes: %v", selectedBoxes)
+
+	// Step 1: Create boxes for each chosen number
+	for _, num := range chosenNumbers {
+		numStr := fmt.Sprintf("%d", num)
+		var winAmount float64
+
+		if r.Float64() < 0.5 {
+			// 50% chance for smaller wins
+			winAmount = randFloatRange(r, minWinAmount, minWinAmount*20)
+
+		} else {
+			// 50% chance for larger wins
+			winAmount = randFloatRange(r, minWinAmount, maxWinAmountCalc)
+		}
+
+		// Check for awards
+		awards, err := db.CheckAwardsLucky(ctx, winAmount, params.GameNameInit)
+		var kind BoxKind
+		if err == nil && awards != nil && contains(selectedBoxes, num) {
+			winAward = utils.ToString(awards["name"])
+			kind = BoxAward
+		} else {
+			winAward = FormatToMZN(winAmount)
+		}
+
+		// Handle special win conditions
+		if params.PlayerLostCount >= int64(params.MinLossCount) && maxWinAmount >= minWinAmount && slices.Contains(selected, numStr) {
+			logger.Infof("Player count: %d, Max loss count: %d", params.PlayerLostCount, params.MinLossCount)
+			logger.Infof("Min win amount: %.2f, Max won: %.2f", minWinAmount, params.MaxWon)
+			logger.Infof("Selected number: %s, Current num: %d", numStr, num)
+
+			var specialWinAmount float64
+			if r.Float64() < 0.5 {
+				specialWinAmount = r.Float64()*(minWinAmount*20-minWinAmount) + minWinAmount
+				if r.Float64() < 0.5 {
+					specialWinAmount = r.Float64()*(800-minWinAmount) + minWinAmount
+				}
+			} else {
+				specialWinAmount = r.Float64()*(800-minWinAmount) + minWinAmount
+			}
+
+			if specialWinAmount > params.MaxWon {
+				specialWinAmount = params.MaxWon
+			}
+
+			item := winAward
+			if !contains(selectedBoxes, num) {
+				item = FormatToMZN(specialWinAmount)
+			}
+
+			boxes[numStr] = WinAmount{
+				Value: specialWinAmount,
+				Item:  item,
+				Kind:  kind,
+			}
+		} else {
+			item := winAward
+			if !contains(selectedBoxes, num) {
+				item = FormatToMZN(winAmount)
+			}
+
+			boxes[numStr] = WinAmount{
+				Value: winAmount,
+				Item:  item,
+				Kind:  kind,
+			}
+		}
+
+		totalAssigned += winAmount
+	}
+
+	// Set zero boxes
+	if len(chosenNumbers) > 0 {
+		candidateBoxes := make([]int, 0)
+		for _, num := range chosenNumbers {
+			if !slices.Contains(selected, fmt.Sprintf("%d", num)) {
+				candidateBoxes = append(candidateBoxes, num)
+			}
+		}
+
+		// Set some boxes to zero
+		zeroBoxes := selectRandomBoxes(r, candidateBoxes, numZeroBoxes)
+		for _, zeroBox := range zeroBoxes {
+			boxes[fmt.Sprintf("%d", zeroBox)] = WinAmount{
+				Value: 0,
+				Item:  "0",
+			}
+		}
+
+		// Set special award box
+		awardsWin, err := db.CheckAwardsLuckyRandom(ctx, params.GameNameInit)
+		if err == nil && awardsWin != nil {
+			zeroBox := selectRandomBox(r, candidateBoxes)
+			boxes[fmt.Sprintf("%d", zeroBox)] = WinAmount{
+				Value: utils.ToFloat64(awardsWin["value"]),
+				Item:  utils.ToString(awardsWin["name"]),
+				Kind:  BoxAward,
+			}
+
+			// Remove used box from candidates
+			candidateBoxes = removeElement(candidateBoxes, zeroBox)
+		}
+
+		// Set max exposure box
+		if len(candidateBoxes) > 0 {
+			exposureBox := selectRandomBox(r, candidateBoxes)
+			boxes[fmt.Sprintf("%d", exposureBox)] = WinAmount{
+				Value: params.MaxExposure,
+				Item:  FormatToMZN(params.MaxExposure),
+			}
+
+			// Remove used box from candidates
+			candidateBoxes = removeElement(candidateBoxes, exposureBox)
+		}
+
+		// Set random min amount box
+		if len(candidateBoxes) > 0 {
+			randomMinAmount := r.Float64()*(minWinAmount*1.2-minWinAmount) + minWinAmount
+			exposureMinBox := selectRandomBox(r, candidateBoxes)
+			boxes[fmt.Sprintf("%d", exposureMinBox)] = WinAmount{
+				Value: randomMinAmount,
+				Item:  FormatToMZN(randomMinAmount),
+			}
+		}
+	}
+
+	logger.Infof("Player lost count: %d", params.PlayerLostCount)
+	logger.Infof("Max loss count: %d", params.MinLossCount)
+
+	// Force win logic
+	forceWin := forcesWin(params.PlayerLostCount, params.MinLossCount) && !params.ForceWinBlocked
+
+	kpi := maps.Clone(params.KPI)
+	if kpi == nil {
+		kpi = map[string]interface{}{}
+	}
+	trace := decisionTraceFrom(ctx)
+	for _, box := range selected {
+		p := params
+		p.SelectedNumber = box
+		p.KPI = kpi
+
+		generated := boxes[box].Value
+		branch := BranchLoss
+		if forceWin {
+			branch = BranchForceWin
+			boxes, err = handleForceWin(ctx, boxes, p, basketValue, minWinAmount, maxWinAmountCalc)
+		} else if winAmount, exists := boxes[box]; exists && winAmount.Value > 0 {
+			// Check if selected box has a win
+			branch = BranchPotentialWin
+			boxes, err = handlePotentialWin(ctx, db, boxes, p, basketValue, minWinAmount, maxWinAmountCalc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		trace.record(box, branch, generated, p, kpi, basketValue)
+
+		// Later boxes see this one's win in the day's payout and the basket
+		won := boxes[box].Value
+		kpi["payout"] = utils.ToFloat64(kpi["payout"]) + won
+		basketValue -= won
+	}
+
+	return boxes, nil
+}
+
+// forcesWin reports whether a player who lost lostCount bets in a row is
+// owed a win: ten losses past the bet's min loss count
+func forcesWin(lostCount int64, minLossCount int) bool {
+	return lostCount >= int64(minLossCount+10)
+}
+
+// winStands reports whether a generated win of amount is paid: the day's
+// RTP with it, to the cent, must stay within the default plus adjustable RTP
+func winStands(amount, defaultRTP, adjustmentableRTP, kpiPayout, kpiBet float64) bool {
+	dayRTP := math.Round(database.RTP(kpiPayout+amount, kpiBet)*100) / 100
+	return amount > 0 && defaultRTP+adjustmentableRTP >= dayRTP
+}
+
+// handleForceWin handles forced win logic
+func handleForceWin(ctx context.Context, boxes map[string]WinAmount, params GenerateWinAmountsParams, basketValue, minWinAmount, maxWinAmount float64) (map[string]WinAmount, error) {
+	r, logger := rngFrom(ctx), gameLog(ctx)
+	logger.Info("Player reached loss limit, forcing a win using adjustable_rtp")
+
+	// Determine target RTP
+	targetRTP := params.DefaultRTP + params.AdjustmentRTP
+
+	// Compute safe win range
+	baseMultiplier := params.AdjustmentRTP / 100
+	potentialWin := utils.ToFloat64(params.KPI["bet"]) * baseMultiplier
+
+	// Compute max allowed payout
+	maxAllowedPayout := (targetRTP/100)*utils.ToFloat64(params.KPI["bet"]) - utils.ToFloat64(params.KPI["payout"])
+
+	logger.Infof("[FORCE-WIN DEBUG] target_rtp=%.2f, adjustable_rtp=%.2f, bet=%.2f, payout=%.2f",
+		targetRTP, params.AdjustmentRTP, utils.ToFloat64(params.KPI["bet"]), utils.ToFloat64(params.KPI["payout"]))
+	logger.Infof("base_multiplier=%.4f, potential_win=%.2f, max_allowed_payout=%.2f",
+		baseMultiplier, potentialWin, maxAllowedPayout)
+
+	// Derive forced amount
+	forcedAmount := math.Min(math.Max(potentialWin, minWinAmount), maxWinAmount)
+	forcedAmount = math.Min(forcedAmount, maxAllowedPayout)
+
+	// Add random variation
+	forcedAmount *= r.Float64()*0.2 + 0.9 // ±10%
+	forcedAmount = math.Min(math.Max(forcedAmount, minWinAmount), maxWinAmount)
+
+	// Recalculate RTP
+	kpiBet := utils.ToFloat64(params.KPI["bet"])
+	currentRTPDay := database.RTP(utils.ToFloat64(params.KPI["payout"])+forcedAmount, kpiBet)
+
+	logger.Infof("[FORCE-WIN RTP CHECK] target_rtp=%.2f, current_rtp_day=%.2f, forced_amount=%.2f",
+		targetRTP, currentRTPDay, forcedAmount)
+
+	// Adjust if RTP exceeds target
+	if currentRTPDay > targetRTP {
+		reducedTargetRTP := math.Max(targetRTP-2, 0)
+		logger.Infof("[FORCE-WIN ADJUSTMENT] RTP above target, reducing to %.2f", reducedTargetRTP)
+
+		for i := 0; i < 10; i++ {
+			if kpiBet <= 0 {
+				break
+			}
+
+			currentRTPDay = database.RTP(utils.ToFloat64(params.KPI["payout"])+forcedAmount, kpiBet)
+			if currentRTPDay <= reducedTargetRTP+0.1 {
+				break
+			}
+
+			forcedAmount -= forcedAmount * 0.05 // reduce by 5% each step
+		}
+
+		forcedAmount = math.Min(math.Max(forcedAmount, maxAllowedPayout), maxWinAmount)
+	}
+
+	// Check basket coverage
+	if forcedAmount > basketValue || forcedAmount < 1 {
+		boxes[params.SelectedNumber] = WinAmount{Value: 0, Item: "0"}
+		return boxes, nil
+	}
+
+	// Assign final forced win
+	amount := math.Round(forcedAmount*100) / 100
+	boxes[params.SelectedNumber] = WinAmount{
+		Value: amount,
+		Item:  FormatToMZN(amount),
+	}
+
+	logger.Infof("[FORCE-WIN COMPLETE] Forced win=%.2f, adjustable_rtp=%.2f, target_rtp=%.2f, basket=%.2f",
+		amount, params.AdjustmentRTP, targetRTP, basketValue)
+
+	return boxes, nil
+}
+
+// handlePotentialWin handles potential win logic with RTP checks
+func handlePotentialWin(ctx context.Context, db database.GameReader, boxes map[string]WinAmount, params GenerateWinAmountsParams, basketValue, minWinAmount, maxWinAmount float64) (map[string]WinAmount, error) {
+	r, logger := rngFrom(ctx), gameLog(ctx)
+
+	// Get player data
+	player, err := db.CheckUser(ctx, params.Msisdn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check user: %w", err)
+	}
+
+	// mxWin := utils.ToFloat64(player["total_bets"]) + params.BetAmount - utils.ToFloat64(player["payout"])
+	// maxWonCalc := (params.DefaultRTP / 100) * mxWin
+
+	amount := boxes[params.SelectedNumber].Value
+
+	// Calculate RTPs
+	playerRTP := database.RTP(database.Player(player).Payout()+amount, database.Player(player).TotalBets())
+
+	kpiBet := utils.ToFloat64(params.KPI["bet"])
+	currentRTPDay := database.RTP(utils.ToFloat64(params.KPI["payout"])+amount, kpiBet)
+
+	logger.Infof("RTP before: %.2f", currentRTPDay)
+	logger.Infof("Amount before: %.2f", amount)
+
+	// RTP adjustment logic
+	if params.PlayerLostCount >= int64(params.MinLossCount) && currentRTPDay > params.DefaultRTP {
+		if kpiBet > 0 {
+			margin := r.Float64()*0.8 + 0.1 // 0.1-0.9%
+			targetRTP := (params.DefaultRTP + params.AdjustmentRTP) - margin
+			maxAllowedPayout := (targetRTP/100)*kpiBet - utils.ToFloat64(params.KPI["payout"])
+
+			if maxAllowedPayout > minWinAmount {
+				amount = r.Float64()*(maxAllowedPayout-minWinAmount) + minWinAmount
+			} else {
+				randomPercentage := r.Float64()*0.39 + 0.6 // 0.6-0.99
+				minRandom := params.BetAmount + ((minWinAmount - params.BetAmount) * randomPercentage)
+				amount = r.Float64()*(minWinAmount-minRandom) + minRandom
+			}
+
+			amount = math.Round(amount*100) / 100
+			currentRTPDay = database.RTP(utils.ToFloat64(params.KPI["payout"])+amount, kpiBet)
+		} else {
+			amount = minWinAmount
+		}
+
+		logger.Infof("RTP after: %.2f", currentRTPDay)
+		logger.Infof("Amount after: %.2f", amount)
+		logger.Infof("Min win amount: %.2f", minWinAmount)
+	}
+
+	// Various win condition checks
+	if amount > basketValue ||
+		minWinAmount > amount ||
+		(currentRTPDay > (params.DefaultRTP+params.AdjustmentRTP) && params.PlayerLostCount >= int64(params.MinLossCount)) ||
+		(utils.ToFloat64(params.KPI["rtp"]) > (params.DefaultRTP+params.AdjustmentRTP) && params.PlayerLostCount >= int64(params.MinLossCount)) ||
+		(currentRTPDay > params.DefaultRTP && int64(params.MinLossCount) > params.PlayerLostCount) ||
+		(utils.ToFloat64(params.KPI["rtp"]) > params.DefaultRTP && int64(params.MinLossCount) > params.PlayerLostCount) ||
+		(playerRTP > (params.AdjustmentRTP + params.DefaultRTP + params.VigPercentage + params.RTPOverload)) {
+
+		boxes[params.SelectedNumber] = WinAmount{Value: 0, Item: "0"}
+		return boxes, nil
+	}
+
+	// Final win assignment
+	boxes[params.SelectedNumber] = WinAmount{
+		Value: amount,
+		Item:  FormatToMZN(amount),
+	}
+	return boxes, nil
+}
+
+// Helper functions
+func generateUniqueNumbers(min, max, count int) []int {
+	numbers := make([]int, max-min)
+	for i := range numbers {
+		numbers[i] = min + i
+	}
+
+	// Correct shuffle using CryptoShuffle
+	CryptoShuffle(numbers)
+
+	if count > len(numbers) {
+		count = len(numbers)
+	}
+	return numbers[:count]
+}
+
+func selectRandomBoxes(r RNG, numbers []int, count int) []int {
+	if count >= len(numbers) {
+		return numbers
+	}
+
+	randShuffle(r, numbers)
+
+	return numbers[:count]
+}
+
+func selectRandomBox(r RNG, numbers []int) int {
+	return numbers[r.IntN(len(numbers))]
+}
+
+func contains(slice []int, item int) bool {
+	for _, v := range slice {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func removeElement(slice []int, element int) []int {
+	for i, v := range slice {
+		if v == element {
+			return append(slice[:i], slice[i+1:]...)
+		}
+	}
+	return slice
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"testing"
+)
+
+// constRNG draws the same numbers every time: f from Float64 and the first
+// index from IntN
+type constRNG struct{ f float64 }
+
+func (r constRNG) Float64() float64 { return r.f }
+func (r constRNG) IntN(n int) int   { return 0 }
+
+func engineParams() GenerateWinAmountsParams {
+	return GenerateWinAmountsParams{
+		Msisdn:           testMsisdn,
+		KPI:              map[string]interface{}{"bet": 1000.0, "payout": 500.0, "rtp": 50.0},
+		DefaultRTP:       85,
+		AdjustmentRTP:    5,
+		VigPercentage:    10,
+		BetAmount:        20,
+		SelectedNumber:   "3",
+		MinWinMultiplier: 1,
+		MaxWinMultiplier: 10,
+		MaxExposure:      1000,
+		MinLossCount:     3,
+		MaxWon:           500,
+	}
+}
+
+func TestGenerateWinAmountsReplaysWithSeed(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 0)
+	layout := func(seed uint64) map[string]WinAmount {
+		boxes, err := generateWinAmounts(withSimulation(context.Background(), seededRNG(seed)), repo, engineParams())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return boxes
+	}
+
+	first := layout(7)
+	if again := layout(7); !maps.Equal(first, again) {
+		t.Errorf("seed 7 laid out %v, then %v", first, again)
+	}
+	if len(first) != 7 {
+		t.Errorf("layout %v, want 7 boxes", first)
+	}
+	for box := 1; box <= 7; box++ {
+		if _, ok := first[fmt.Sprint(box)]; !ok {
+			t.Errorf("layout %v has no box %d", first, box)
+		}
+	}
+	if err := checkPayouts(first, engineParams().MaxExposure); err != nil {
+		t.Error(err)
+	}
+
+	differ := false
+	for seed := uint64(8); seed < 20 && !differ; seed++ {
+		differ = !maps.Equal(first, layout(seed))
+	}
+	if !differ {
+		t.Error("every seed laid out the same boxes")
+	}
+}
+
+func TestHandleForceWin(t *testing.T) {
+	ctx := withSimulation(context.Background(), constRNG{f: 0.5})
+	cases := []struct {
+		name   string
+		payout float64 // the day's payout so far
+		basket float64
+		want   float64
+	}{
+		// 5% adjustable RTP of the day's 1000 staked, within the 90% target
+		{"adjustable share", 500, 1000, 50},
+		// Only 20 left under the 90% target
+		{"capped by target", 880, 1000, 20},
+		{"basket short", 500, 30, 0},
+	}
+	for _, tc := range cases {
+		params := engineParams()
+		params.KPI["payout"] = tc.payout
+		boxes := map[string]WinAmount{"3": {Value: 0, Item: "0"}}
+		got, err := handleForceWin(ctx, boxes, params, tc.basket, 20, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := "0"
+		if tc.want > 0 {
+			item = FormatToMZN(tc.want)
+		}
+		if got["3"].Value != tc.want || got["3"].Item != item {
+			t.Errorf("%s: box 3 = %+v, want %v", tc.name, got["3"], tc.want)
+		}
+	}
+}
+
+func TestHandlePotentialWin(t *testing.T) {
+	ctx := withSimulation(context.Background(), constRNG{f: 0.5})
+	cases := []struct {
+		name         string
+		generated    float64
+		lostCount    int64
+		basket       float64
+		playerPayout float64
+		want         float64
+	}{
+		{"stands", 100, 0, 1000, 0, 100},
+		{"day RTP over default", 400, 0, 1000, 0, 0},
+		{"under the min win", 10, 0, 1000, 0, 0},
+		{"basket short", 100, 0, 50, 0, 0},
+		{"player RTP over the cap", 100, 0, 1000, 950, 0},
+		// After a losing run the win is scaled into the 89.5% the margin leaves:
+		// 0.5 of the way from the min win 20 to the 395 still allowed
+		{"rescaled after a losing run", 400, 5, 1000, 0, 207.5},
+	}
+	for _, tc := range cases {
+		repo := newMemRepo()
+		p := repo.addPlayer(testMsisdn, 0)
+		p.TotalBets, p.Payout = 1000, tc.playerPayout
+
+		params := engineParams()
+		params.PlayerLostCount = tc.lostCount
+		boxes := map[string]WinAmount{"3": {Value: tc.generated, Item: FormatToMZN(tc.generated)}}
+		got, err := handlePotentialWin(ctx, repo, boxes, params, tc.basket, 20, 200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got["3"].Value != tc.want {
+			t.Errorf("%s: box 3 = %+v, want %v", tc.name, got["3"], tc.want)
+		}
+	}
+}
+
+func TestForcesWin(t *testing.T) {
+	for _, tc := range []struct {
+		lost int64
+		min  int
+		want bool
+	}{{12, 3, false}, {13, 3, true}, {20, 3, true}, {0, 0, false}, {10, 0, true}} {
+		if got := forcesWin(tc.lost, tc.min); got != tc.want {
+			t.Errorf("forcesWin(%d, %d) = %v, want %v", tc.lost, tc.min, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"maps"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LuckyBoxes is the number of boxes in a lucky number game
+const LuckyBoxes = 7
+
+var ErrInvalidSelection = errors.New("invalid selection")
+
+// Selection is one box of a multi-box bet and its stake
+type Selection struct {
+	Box    string  `json:"box"`
+	Amount float64 `json:"amount"`
+}
+
+// SelectionResult is how one box of a parcel settled. GameID is the box's
+// own bet reference.
+type SelectionResult struct {
+	Box           string              `json:"Box"`
+	GameID        string              `json:"GameID"`
+	Amount        float64             `json:"Amount"`
+	ResultStatus  status.ResultStatus `json:"ResultStatus"`
+	WinAmount     float64             `json:"WinAmount"`
+	GrossAmount   float64             `json:"GrossAmount"`
+	TaxAmount     float64             `json:"TaxAmount"`
+	NetAmount     float64             `json:"NetAmount"`
+	PayoutDelayed bool                `json:"PayoutDelayed,omitempty"`
+}
+
+// ParcelResult is a settled multi-box bet. Every selection is evaluated
+// against the one Boxes layout; ResultStatus is Win when any box won.
+type ParcelResult struct {
+	ParcelReference string               `json:"ParcelReference"`
+	Boxes           map[string]WinAmount `json:"Boxes"`
+	Selections      []SelectionResult    `json:"Selections"`
+	ResultStatus    status.ResultStatus  `json:"ResultStatus"`
+	TotalStake      float64              `json:"TotalStake"`
+	WinAmount       float64              `json:"WinAmount"` // gross, all boxes
+	NetAmount       float64              `json:"NetAmount"` // paid to the player, all boxes
+	PayoutDelayed   bool                 `json:"PayoutDelayed,omitempty"`
+	ResultMessage   string               `json:"ResultMessage"`
+}
+
+// ValidateSelections checks a parcel against the game: each box is 1 to
+// LuckyBoxes and picked once, and each stake passes the game's stake rules.
+// Returns the selections with their boxes normalized, or
+// ErrInvalidSelection naming every problem.
+func ValidateSelections(selections []Selection, stakes StakeRules) ([]Selection, error) {
+	if len(selections) == 0 || len(selections) > LuckyBoxes {
+		return nil, fmt.Errorf("%w: pick 1 to %d boxes", ErrInvalidSelection, LuckyBoxes)
+	}
+
+	var problems []string
+	seen := map[int]bool{}
+	out := make([]Selection, 0, len(selections))
+	for _, sel := range selections {
+		box, err := strconv.Atoi(strings.TrimSpace(sel.Box))
+		if err != nil || box < 1 || box > LuckyBoxes {
+			problems = append(problems, fmt.Sprintf("box %q must be a number between 1 and %d", sel.Box, LuckyBoxes))
+			continue
+		}
+		if seen[box] {
+			problems = append(problems, fmt.Sprintf("box %d is picked more than once", box))
+			continue
+		}
+		seen[box] = true
+		if err := stakes.Check(sel.Amount); err != nil {
+			problems = append(problems, fmt.Sprintf("box %d %v", box, err))
+		}
+		out = append(out, Selection{Box: strconv.Itoa(box), Amount: sel.Amount})
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSelection, strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+// PlaceParcel plays several boxes of one game in a single request. The
+// stakes are debited together or not at all, each box gets its own Bets row
+// under the parcel reference, and one box layout is generated and every box
+// settled against it. KPI and house accounting book the total stake once.
+// A parcel never uses the free bet and never plays for the jackpot.
+// Selections must have passed ValidateSelections.
+func (s *LuckyNumberService) PlaceParcel(player map[string]interface{}, ussd, name, gameCatID, msisdn, channel string, selections []Selection) (ParcelResult, error) {
+	if s == nil || s.db == nil {
+		return ParcelResult{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx := withChannel(context.Background(), channel)
+	if _, err := s.GetPlayableGame(ctx, gameCatID); err != nil {
+		return ParcelResult{}, err
+	}
+	if err := s.checkBetPace(ctx, msisdn); err != nil {
+		return ParcelResult{}, err
+	}
+	release, err := s.plays.acquire(ctx)
+	if err != nil {
+		return ParcelResult{}, err
+	}
+	defer release()
+
+	state, err := s.loadGameState(ctx, gameCatID, "")
+	if err != nil {
+		return ParcelResult{}, err
+	}
+
+	parcel := utils.NewReference(utils.RefParcel)
+	bets := make([]database.ParcelBet, len(selections))
+	stakes := make([]database.Stake, len(selections))
+	boxes := make([]string, len(selections))
+	var total float64
+	for i, sel := range selections {
+		bets[i] = database.ParcelBet{
+			Stake: database.Stake{Reference: utils.NewReference(utils.RefBet), Amount: sel.Amount},
+			Box:   sel.Box,
+		}
+		stakes[i] = bets[i].Stake
+		boxes[i] = sel.Box
+		total += sel.Amount
+	}
+
+	// Each box is a round of its own; an error before the boxes settle
+	// fails those still open
+	for _, b := range bets {
+		if err := s.openRound(ctx, b.Reference, msisdn, gameCatID, b.Amount, actorPlayer, fmt.Sprintf("box %s of parcel %s via %s", b.Box, parcel, channel)); err != nil {
+			return ParcelResult{}, err
+		}
+	}
+	failRounds := func(open []database.ParcelBet, actor string, err error) {
+		for _, b := range open {
+			s.failRound(ctx, b.Reference, actor, err)
+		}
+	}
+
+	cashStake, bonusStake, err := s.db.DebitStakes(ctx, msisdn, stakes, limits.BonusFirst)
+	if err != nil {
+		failRounds(bets, actorWallet, err)
+		return ParcelResult{}, err
+	}
+	if bonusStake > 0 {
+		logrus.Infof("parcel %s funded: cash=%.2f bonus=%.2f", parcel, cashStake, bonusStake)
+	}
+	for _, b := range bets {
+		_ = s.advanceRound(ctx, b.Reference, database.RoundFunded, actorWallet, "parcel "+parcel)
+	}
+
+	if err := s.db.CreateParcelBets(ctx, msisdn, parcel, bets, "normal", gameCatID, name, channel); err != nil {
+		failRounds(bets, actorGame, err)
+		return ParcelResult{}, err
+	}
+	if err := s.bookStake(ctx, state, player, msisdn, total, strings.Join(boxes, ","), parcel, "normal", gameCatID, name, channel, ussd); err != nil {
+		failRounds(bets, actorGame, err)
+		return ParcelResult{}, err
+	}
+	for _, b := range bets {
+		if err := s.advanceRound(ctx, b.Reference, database.RoundPlayed, actorGame, "box "+b.Box); err != nil {
+			return ParcelResult{}, err
+		}
+	}
+
+	// The boxes' outcomes are decided together under the lock
+	// decideOutcome takes, against the day's KPI as it is now
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kpi, err := s.db.CheckSettingKPI(ctx)
+	if err != nil {
+		failRounds(bets, actorGame, err)
+		return ParcelResult{}, err
+	}
+	state.kpi = kpiBeforeStake(kpi, state.settings, total, "normal")
+
+	minLossCount := cryptoRandIndex(state.settings.MinLossCount) + 1
+	params := s.normalGameParams(player, msisdn, selections[0].Amount, boxes[0], parcel, state.settings, state.game, state.kpi, minLossCount)
+	if forcesWin(params.PlayerLostCount, params.MinLossCount) {
+		params.ForceWinBlocked = !s.streakEarnsForcedWin(ctx, player, msisdn, state.settings)
+	}
+	ctx = withDecisionTrace(ctx)
+	layout, err := generateLayout(ctx, s.db, params, boxes)
+	if err != nil {
+		failRounds(bets, actorGame, err)
+		return ParcelResult{}, fmt.Errorf("failed to generate win amounts: %w", err)
+	}
+	if err := checkPayouts(layout, state.game.MaxExposure); err != nil {
+		failRounds(bets, actorGame, err)
+		return ParcelResult{}, err
+	}
+
+	// Each box settles on top of the ones before it: the day's payout and
+	// the player's totals include their stakes and wins
+	kpi = maps.Clone(state.kpi)
+	player = maps.Clone(player)
+
+	result := ParcelResult{
+		ParcelReference: parcel,
+		ResultStatus:    status.ResultLoss,
+		TotalStake:      total,
+	}
+	for i, b := range bets {
+		r, err := s.settleSelection(ctx, player, msisdn, b.Amount, b.Box, b.Reference, state.game, state.settings, state.tax, kpi, layout, false)
+		if err != nil {
+			failRounds(bets[i:], actorGame, err)
+			return ParcelResult{}, fmt.Errorf("failed to settle box %s of %s: %w", b.Box, parcel, err)
+		}
+		s.reportSettledBet(ctx, msisdn, b.Reference, gameCatID, channel, b.Amount, r)
+
+		kpi["payout"] = utils.ToFloat64(kpi["payout"]) + r.WinAmount
+		player["total_bets"] = database.Player(player).TotalBets() + b.Amount
+		player["payout"] = database.Player(player).Payout() + r.WinAmount
+		if r.WinAmount <= 0 {
+			player["total_losses"] = database.Player(player).TotalLosses() + b.Amount
+		}
+
+		result.Selections = append(result.Selections, SelectionResult{
+			Box:           b.Box,
+			GameID:        b.Reference,
+			Amount:        b.Amount,
+			ResultStatus:  r.ResultStatus,
+			WinAmount:     r.WinAmount,
+			GrossAmount:   r.GrossAmount,
+			TaxAmount:     r.TaxAmount,
+			NetAmount:     r.NetAmount,
+			PayoutDelayed: r.PayoutDelayed,
+		})
+		if r.ResultStatus == status.ResultWin {
+			result.ResultStatus = status.ResultWin
+		}
+		result.WinAmount += r.WinAmount
+		result.NetAmount += r.NetAmount
+		result.PayoutDelayed = result.PayoutDelayed || r.PayoutDelayed
+	}
+	result.Boxes = layout
+
+	result.ResultMessage = s.createParcelMessage(ctx, utils.ToString(player["language"]), result)
+	s.notifyResult(ctx, player, msisdn, parcel, result.ResultMessage)
+
+	logrus.Infof("Player %s parcel %s: %d boxes, stake %.2f, won %.2f", msisdn, parcel, len(bets), total, result.WinAmount)
+	return result, nil
+}
+
+// createParcelMessage summarizes every box of a parcel in one SMS
+func (s *LuckyNumberService) createParcelMessage(ctx context.Context, language string, result ParcelResult) string {
+	var results []string
+	wins := 0
+	for _, sel := range result.Selections {
+		if sel.ResultStatus == status.ResultWin {
+			wins++
+			results = append(results, fmt.Sprintf("Box %s - UMESHINDA %s", sel.Box, FormatToMZN(sel.NetAmount)))
+		} else {
+			results = append(results, fmt.Sprintf("Box %s - 0", sel.Box))
+		}
+	}
+	var boxes []string
+	for num, winAmount := range result.Boxes {
+		boxes = append(boxes, fmt.Sprintf("Box %s - %s", num, winAmount.Item))
+	}
+	sort.Strings(boxes)
+
+	key := TemplateParcel
+	if result.PayoutDelayed {
+		key = TemplateParcelDelayed
+	}
+	return s.renderMessage(ctx, key, language, map[string]string{
+		"reference": result.ParcelReference,
+		"results":   strings.Join(results, "\n"),
+		"boxes":     strings.Join(boxes, ", "),
+		"stake":     FormatToMZN(result.TotalStake),
+		"net":       FormatToMZN(result.NetAmount),
+		"wins":      strconv.Itoa(wins),
+	})
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestValidateSelections(t *testing.T) {
+	stakes := StakeRules{Mode: "range", MinStake: 10, MaxStake: 100}
+	got, err := ValidateSelections([]Selection{{" 2 ", 20}, {"05", 20}, {"7", 100}}, stakes)
+	if err != nil || len(got) != 3 || got[0].Box != "2" || got[1].Box != "5" {
+		t.Fatalf("ValidateSelections = %+v, %v, want boxes 2, 5 and 7", got, err)
+	}
+
+	cases := map[string][]Selection{
+		"no boxes":      nil,
+		"too many":      {{"1", 20}, {"2", 20}, {"3", 20}, {"4", 20}, {"5", 20}, {"6", 20}, {"7", 20}, {"1", 20}},
+		"box 0":         {{"0", 20}},
+		"box 8":         {{"8", 20}},
+		"not a number":  {{"two", 20}},
+		"picked twice":  {{"3", 20}, {"03", 20}},
+		"stake too low": {{"3", 5}},
+	}
+	for name, sel := range cases {
+		if _, err := ValidateSelections(sel, stakes); !errors.Is(err, ErrInvalidSelection) {
+			t.Errorf("%s: err = %v, want ErrInvalidSelection", name, err)
+		}
+	}
+	_, err = ValidateSelections([]Selection{{"9", 20}, {"4", 1}}, stakes)
+	if err == nil || !strings.Contains(err.Error(), "box \"9\"") || !strings.Contains(err.Error(), "box 4") {
+		t.Errorf("err = %v, want every problem named", err)
+	}
+}
+
+func parcelPlayer(t *testing.T, repo *memRepo, balance float64) map[string]interface{} {
+	t.Helper()
+	repo.addPlayer(testMsisdn, balance)
+	repo.kpi.Handle = 1000000 // keeps the day's RTP under its limit
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	return user
+}
+
+// TestPlaceParcelSettlesEachBox plays parcels of three boxes until one wins
+// on some boxes and loses on others. Every parcel's boxes must each settle
+// against the one layout, in their own Bets row under the parcel reference.
+func TestPlaceParcelSettlesEachBox(t *testing.T) {
+	repo := newMemRepo()
+	user := parcelPlayer(t, repo, 100000)
+	s := newTestService(t, repo, nil)
+	selections := []Selection{{"2", 20}, {"5", 20}, {"7", 20}}
+
+	partial := false
+	for i := 0; i < 200 && !partial; i++ {
+		before := repo.player(testMsisdn).Balance
+		result, err := s.PlaceParcel(user, "", "Test", "1", testMsisdn, "web", selections)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := before - repo.player(testMsisdn).Balance; got != 60 || result.TotalStake != 60 {
+			t.Fatalf("debited %v, total stake %v, want 60 for three boxes", got, result.TotalStake)
+		}
+		if len(result.Selections) != 3 {
+			t.Fatalf("%d selection results, want 3", len(result.Selections))
+		}
+
+		var wins, losses int
+		var won, net float64
+		for _, sel := range result.Selections {
+			bet := repo.bets[sel.GameID]
+			if bet == nil || bet.Parcel != result.ParcelReference || bet.Box != sel.Box || bet.Amount != 20 {
+				t.Fatalf("box %s bet = %+v, want its own row in parcel %s", sel.Box, bet, result.ParcelReference)
+			}
+			if bet.Status != sel.ResultStatus {
+				t.Errorf("box %s bet %s, result %s", sel.Box, bet.Status, sel.ResultStatus)
+			}
+			switch sel.ResultStatus {
+			case status.ResultWin:
+				wins++
+				// The layout shows a winning box net of tax
+				if sel.WinAmount <= 0 || math.Abs(result.Boxes[sel.Box].Value-sel.NetAmount) > 0.5 {
+					t.Errorf("box %s paid %v, layout shows %v", sel.Box, sel.NetAmount, result.Boxes[sel.Box].Value)
+				}
+			case status.ResultLoss:
+				losses++
+				if sel.WinAmount != 0 || result.Boxes[sel.Box].Value != 0 {
+					t.Errorf("losing box %s won %v, layout shows %v", sel.Box, sel.WinAmount, result.Boxes[sel.Box].Value)
+				}
+			default:
+				t.Errorf("box %s settled %s", sel.Box, sel.ResultStatus)
+			}
+			if repo.rounds[sel.GameID] != database.RoundPaid && repo.rounds[sel.GameID] != database.RoundSettled {
+				t.Errorf("box %s round %s, want settled", sel.Box, repo.rounds[sel.GameID])
+			}
+			won += sel.WinAmount
+			net += sel.NetAmount
+		}
+		if result.WinAmount != won || result.NetAmount != net {
+			t.Errorf("parcel totals %v/%v, boxes sum to %v/%v", result.WinAmount, result.NetAmount, won, net)
+		}
+		if (wins > 0) != (result.ResultStatus == status.ResultWin) {
+			t.Errorf("parcel %s with %d winning boxes", result.ResultStatus, wins)
+		}
+		partial = wins > 0 && losses > 0
+	}
+	if !partial {
+		t.Error("200 parcels without one winning on some boxes and losing on others")
+	}
+}
+
+func TestPlaceParcelBooksTotalStakeOnce(t *testing.T) {
+	repo := newMemRepo()
+	user := parcelPlayer(t, repo, 1000)
+	s := newTestService(t, repo, nil)
+	handle, bets := repo.kpi.Handle, repo.house.TotalBets
+
+	result, err := s.PlaceParcel(user, "", "Test", "1", testMsisdn, "web", []Selection{{"1", 20}, {"4", 30}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.kpi.Handle-handle != 50 || repo.house.TotalBets-bets != 50 {
+		t.Errorf("kpi handle +%v, house bets +%v, want the 50 total once", repo.kpi.Handle-handle, repo.house.TotalBets-bets)
+	}
+	// One message summarizes the parcel
+	for _, want := range []string{result.ParcelReference, "Box 1 - ", "Box 4 - "} {
+		if !strings.Contains(result.ResultMessage, want) {
+			t.Errorf("message %q does not mention %q", result.ResultMessage, want)
+		}
+	}
+}
+
+// TestPlaceParcelDebitsAllOrNothing stakes three boxes against a balance
+// that covers two: nothing is debited, no bet is written and every round
+// fails
+func TestPlaceParcelDebitsAllOrNothing(t *testing.T) {
+	repo := newMemRepo()
+	user := parcelPlayer(t, repo, 50)
+	s := newTestService(t, repo, nil)
+
+	_, err := s.PlaceParcel(user, "", "Test", "1", testMsisdn, "web", []Selection{{"1", 20}, {"2", 20}, {"3", 20}})
+	if !errors.Is(err, database.ErrInsufficientBalance) {
+		t.Fatalf("err = %v, want ErrInsufficientBalance", err)
+	}
+	if p := repo.player(testMsisdn); p.Balance != 50 || p.TotalBets != 0 {
+		t.Errorf("player = %+v, want untouched", p)
+	}
+	if len(repo.bets) != 0 || len(repo.funding) != 0 {
+		t.Errorf("bets %v, funding %v, want none", repo.betRefs(), repo.funding)
+	}
+	if len(repo.rounds) != 3 {
+		t.Fatalf("%d rounds, want one per box", len(repo.rounds))
+	}
+	for ref, state := range repo.rounds {
+		if state != database.RoundFailed {
+			t.Errorf("round %s = %s, want failed", ref, state)
+		}
+	}
+}
+
+// TestPlaceBetSingleChoiceUnchanged is the single-box payload after parcels
+// were added: one Bets row with no parcel reference
+func TestPlaceBetSingleChoiceUnchanged(t *testing.T) {
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0, "2": 300, "3": 20})
+
+	result := placeTestBet(t, s, repo, 50, "2")
+	bet := repo.bets[result.GameResult.GameID]
+	if len(repo.bets) != 1 || bet == nil || bet.Parcel != "" || bet.Amount != 50 {
+		t.Errorf("bets = %v, want one plain bet of 50", repo.betRefs())
+	}
+	if p := repo.player(testMsisdn); p.Balance != 50 {
+		t.Errorf("balance = %v, want 50", p.Balance)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+var ErrServerBusy = errors.New("server busy")
+
+// PlaySlotStats reports how many games this process is playing and how many
+// bets waited for or were refused a slot
+type PlaySlotStats struct {
+	Capacity int    `json:"capacity"`
+	InUse    int    `json:"in_use"`
+	Waiting  int64  `json:"waiting"`
+	Rejected uint64 `json:"rejected"`
+}
+
+// playSlots bounds how many games a process plays at once, so a burst of
+// bets waits for a slot instead of piling onto the database pool
+type playSlots struct {
+	slots    chan struct{}
+	wait     time.Duration
+	waiting  atomic.Int64
+	rejected atomic.Uint64
+}
+
+func newPlaySlots(capacity int, wait time.Duration) *playSlots {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	return &playSlots{slots: make(chan struct{}, capacity), wait: wait}
+}
+
+// acquire takes a slot, waiting up to the queue timeout. It returns
+// ErrServerBusy when none frees up in time.
+func (p *playSlots) acquire(ctx context.Context) (release func(), err error) {
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	default:
+	}
+
+	p.waiting.Add(1)
+	defer p.waiting.Add(-1)
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return p.release, nil
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	p.rejected.Add(1)
+	return nil, ErrServerBusy
+}
+
+// hold takes a slot, waiting as long as it takes. Deposit callbacks use it:
+// the money has already moved, so their game must not be dropped.
+func (p *playSlots) hold() (release func()) {
+	p.waiting.Add(1)
+	p.slots <- struct{}{}
+	p.waiting.Add(-1)
+	return p.release
+}
+
+func (p *playSlots) release() {
+	<-p.slots
+}
+
+func (p *playSlots) Stats() PlaySlotStats {
+	return PlaySlotStats{
+		Capacity: cap(p.slots),
+		InUse:    len(p.slots),
+		Waiting:  p.waiting.Load(),
+		Rejected: p.rejected.Load(),
+	}
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPlaySlotsBoundLatency(t *testing.T) {
+	const wait = 30 * time.Millisecond
+	slots := newPlaySlots(3, wait)
+
+	// Ten bets race for three slots held by slow games
+	var running, peak atomic.Int32
+	var busy atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			release, err := slots.acquire(context.Background())
+			if errors.Is(err, ErrServerBusy) {
+				busy.Add(1)
+				if took := time.Since(start); took > wait+100*time.Millisecond {
+					t.Errorf("refused after %v, want about %v", took, wait)
+				}
+				return
+			}
+			n := running.Add(1)
+			for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+			}
+			time.Sleep(200 * time.Millisecond)
+			running.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 3 {
+		t.Errorf("%d games at once, want at most 3", peak.Load())
+	}
+	if busy.Load() != 7 {
+		t.Errorf("%d bets refused, want the 7 that found no slot", busy.Load())
+	}
+	if st := slots.Stats(); st.Capacity != 3 || st.InUse != 0 || st.Waiting != 0 || st.Rejected != 7 {
+		t.Errorf("stats = %+v, want 7 rejected and nothing held", st)
+	}
+}
+
+func TestPlaySlotsWaitForRelease(t *testing.T) {
+	slots := newPlaySlots(1, time.Second)
+	release, err := slots.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		release()
+	}()
+	if _, err := slots.acquire(context.Background()); err != nil {
+		t.Errorf("slot freed within the wait = %v, want it taken", err)
+	}
+
+	// A deposit callback waits however long it takes
+	done := make(chan struct{})
+	go func() {
+		slots.hold()()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("hold returned while every slot was taken")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if st := slots.Stats(); st.Waiting != 1 {
+		t.Errorf("waiting = %d, want the callback", st.Waiting)
+	}
+	slots.release()
+	<-done
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slots.hold()
+	if _, err := slots.acquire(ctx); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("cancelled bet = %v, want ErrServerBusy", err)
+	}
+}
+
+// playRepo counts the rounds booking their stakes and the outcomes being
+// decided at once
+type playRepo struct {
+	*memRepo
+	booking, deciding gauge
+}
+
+func (r *playRepo) UpdateUserBet(ctx context.Context, mvalue float64, id int64) (int64, error) {
+	r.booking.statement(5 * time.Millisecond)
+	return r.memRepo.UpdateUserBet(ctx, mvalue, id)
+}
+
+func (r *playRepo) CheckJackpotWinner(ctx context.Context) (map[string]interface{}, error) {
+	r.deciding.statement(time.Millisecond)
+	return r.memRepo.CheckJackpotWinner(ctx)
+}
+
+func TestPlaysRunUpToSlots(t *testing.T) {
+	const slots, players = 4, 24
+	repo := &playRepo{memRepo: newMemRepo()}
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	s.plays = newPlaySlots(slots, 5*time.Second)
+	s.accounts = newAccountingPool(64)
+	for i := 0; i < players; i++ {
+		repo.addPlayer(fmt.Sprintf("2547%08d", i), 100)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, players)
+	for i := 0; i < players; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msisdn := fmt.Sprintf("2547%08d", i)
+			user, _ := repo.CheckUser(context.Background(), msisdn)
+			_, errs[i] = s.PlaceBet(context.Background(), user, "", "Test", "1", msisdn, 20, "1", "web")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("bet %d: %v", i, err)
+		}
+	}
+	// The slots are the ceiling, and it is reached: only the outcome is
+	// decided one round at a time
+	if peak := repo.booking.peak.Load(); peak != slots {
+		t.Errorf("%d rounds booked at once, want the %d slots", peak, slots)
+	}
+	if peak := repo.deciding.peak.Load(); peak != 1 {
+		t.Errorf("%d outcomes decided at once, want 1", peak)
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"container/list"
+	"fiberapp/database"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPlayerCacheSize = 10000
+	defaultPlayerCacheTTL  = 30 * time.Minute
+)
+
+// PlayerCacheStats reports the hit rate of the player RTP cache
+type PlayerCacheStats struct {
+	Size      int     `json:"size"`
+	Capacity  int     `json:"capacity"`
+	Hits      uint64  `json:"hits"`
+	Misses    uint64  `json:"misses"`
+	Evictions uint64  `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+type playerCacheEntry struct {
+	playerID  int64
+	data      PlayerData
+	expiresAt time.Time
+}
+
+// playerCache is a bounded LRU cache of per-player RTP figures with a TTL.
+// It has its own lock so reads never contend on the service mutex.
+type playerCache struct {
+	mu       sync.RWMutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List // front = most recently used
+	items    map[int64]*list.Element
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+// newPlayerCache creates a cache holding at most capacity players for ttl each
+func newPlayerCache(capacity int, ttl time.Duration) *playerCache {
+	if capacity <= 0 {
+		capacity = defaultPlayerCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultPlayerCacheTTL
+	}
+	return &playerCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[int64]*list.Element),
+	}
+}
+
+// Get returns a copy of the cached player data if present and not expired
+func (c *playerCache) Get(playerID int64) (PlayerData, bool) {
+	c.mu.RLock()
+	el, ok := c.items[playerID]
+	if !ok {
+		c.mu.RUnlock()
+		c.misses.Add(1)
+		return PlayerData{}, false
+	}
+	entry := el.Value.(*playerCacheEntry)
+	expired := time.Now().After(entry.expiresAt)
+	data := entry.data
+	c.mu.RUnlock()
+
+	if expired {
+		c.mu.Lock()
+		// Re-check under the write lock; a concurrent Set may have refreshed it
+		if el, ok := c.items[playerID]; ok && time.Now().After(el.Value.(*playerCacheEntry).expiresAt) {
+			c.removeElement(el)
+		}
+		c.mu.Unlock()
+		c.misses.Add(1)
+		return PlayerData{}, false
+	}
+
+	// Promoting in the LRU list needs the write lock; skip it if contended
+	if c.mu.TryLock() {
+		if el, ok := c.items[playerID]; ok {
+			c.order.MoveToFront(el)
+		}
+		c.mu.Unlock()
+	}
+	c.hits.Add(1)
+	return data, true
+}
+
+// Set stores player data, evicting the least recently used entry when full
+func (c *playerCache) Set(playerID int64, data PlayerData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expiresAt := time.Now().Add(c.ttl)
+	if el, ok := c.items[playerID]; ok {
+		entry := el.Value.(*playerCacheEntry)
+		entry.data = data
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[playerID] = c.order.PushFront(&playerCacheEntry{playerID: playerID, data: data, expiresAt: expiresAt})
+	for c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// Delete drops a player from the cache
+func (c *playerCache) Delete(playerID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[playerID]; ok {
+		c.order.Remove(el)
+		delete(c.items, playerID)
+	}
+}
+
+// removeElement evicts an entry; the caller must hold the write lock
+func (c *playerCache) removeElement(el *list.Element) {
+	if el == nil {
+		return
+	}
+	entry := c.order.Remove(el).(*playerCacheEntry)
+	delete(c.items, entry.playerID)
+	c.evictions.Add(1)
+}
+
+// Stats returns a snapshot of the cache counters
+func (c *playerCache) Stats() PlayerCacheStats {
+	c.mu.RLock()
+	size := c.order.Len()
+	c.mu.RUnlock()
+
+	hits := c.hits.Load()
+	misses := c.misses.Load()
+	var hitRate float64
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total)
+	}
+	return PlayerCacheStats{
+		Size:      size,
+		Capacity:  c.capacity,
+		Hits:      hits,
+		Misses:    misses,
+		Evictions: c.evictions.Load(),
+		HitRate:   hitRate,
+	}
+}
+
+// playerDataFromRow builds the RTP figures from a Players row
+func playerDataFromRow(player map[string]interface{}) PlayerData {
+	p := database.Player(player)
+	return PlayerData{
+		TotalBets:   p.TotalBets(),
+		Payout:      p.Payout(),
+		TotalLosses: p.TotalLosses(),
+		CurrentRTP:  p.RTP(),
+	}
+}
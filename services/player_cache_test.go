@@ -0,0 +1,108 @@
+package services
+
+import (
+	"fiberapp/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPlayerCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newPlayerCache(2, time.Minute)
+	c.Set(1, PlayerData{CurrentRTP: 10})
+	c.Set(2, PlayerData{CurrentRTP: 20})
+	if _, ok := c.Get(1); !ok {
+		t.Fatal("player 1 missing before eviction")
+	}
+	c.Set(3, PlayerData{CurrentRTP: 30})
+
+	if _, ok := c.Get(2); ok {
+		t.Error("player 2 was least recently used and should have been evicted")
+	}
+	for _, id := range []int64{1, 3} {
+		if _, ok := c.Get(id); !ok {
+			t.Errorf("player %d evicted, want kept", id)
+		}
+	}
+	if st := c.Stats(); st.Size != 2 || st.Evictions != 1 {
+		t.Errorf("stats = %+v, want size 2 and 1 eviction", st)
+	}
+}
+
+func TestPlayerCacheExpires(t *testing.T) {
+	c := newPlayerCache(10, 20*time.Millisecond)
+	c.Set(1, PlayerData{CurrentRTP: 50})
+	if _, ok := c.Get(1); !ok {
+		t.Fatal("fresh entry missing")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := c.Get(1); ok {
+		t.Error("expired entry returned")
+	}
+	if st := c.Stats(); st.Size != 0 || st.Hits != 1 || st.Misses != 1 || st.HitRate != 0.5 {
+		t.Errorf("stats = %+v, want empty with 1 hit and 1 miss", st)
+	}
+}
+
+func TestPlayerCacheConcurrentAccess(t *testing.T) {
+	c := newPlayerCache(50, time.Minute)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				id := int64((w*1000 + i) % 100)
+				c.Set(id, PlayerData{TotalBets: float64(i)})
+				c.Get(id)
+				if i%10 == 0 {
+					c.Delete(id)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	st := c.Stats()
+	if st.Size > 50 {
+		t.Errorf("size %d exceeds capacity 50", st.Size)
+	}
+	if st.Hits+st.Misses != 8000 {
+		t.Errorf("counted %d lookups, want 8000", st.Hits+st.Misses)
+	}
+}
+
+func TestRecordSettledBetFeedsGeneratorRTP(t *testing.T) {
+	s := &LuckyNumberService{players: newPlayerCache(10, time.Minute)}
+	player := map[string]interface{}{"id": int64(7), "total_bets": 100.0, "payout": 50.0}
+	settings := database.Settings{DefaultRTP: 90, MinWinMultiplier: 1, MaxWinMultiplier: 5}
+
+	if got := s.normalGameParams(player, "254700000000", 10, "1", "ref", settings, database.Game{}, nil, 3).PlayerRTP; got != 50 {
+		t.Fatalf("PlayerRTP before any bet = %v, want 50 from the row", got)
+	}
+
+	// A 100 win on a 100 stake takes the player to 150 paid on 200 staked
+	s.recordSettledBet(7, player, 100, 100)
+	if got := s.normalGameParams(player, "254700000000", 10, "1", "ref", settings, database.Game{}, nil, 3).PlayerRTP; got != 75 {
+		t.Errorf("PlayerRTP after a settled bet = %v, want 75 from the cache", got)
+	}
+}
+
+func TestWinStandsAgainstDayRTP(t *testing.T) {
+	cases := []struct {
+		name                   string
+		amount, payout, staked float64
+		want                   bool
+	}{
+		{"under target", 10, 800, 1000, true},
+		{"at target", 100, 800, 1000, true},
+		{"over target", 101, 800, 1000, false},
+		{"nothing to win", 0, 0, 1000, false},
+	}
+	for _, tc := range cases {
+		// default 85% + adjustable 5% allows the day up to 90%
+		if got := winStands(tc.amount, 85, 5, tc.payout, tc.staked); got != tc.want {
+			t.Errorf("%s: winStands = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package services
+
+import (
+	"context"
+	"fiberapp/database"
+	"fmt"
+	"time"
+)
+
+// Streak kinds of LifetimeStats
+const (
+	StreakWin  = "win"
+	StreakLoss = "loss"
+)
+
+// playerStatsKeyPrefix starts the lookup cache keys of LifetimeStats, so a
+// player's figures are read at most once per limits.lookup_cache_ttl
+const playerStatsKeyPrefix = "player_stats:"
+
+// LifetimeStats are what the app home screen shows a player about their own
+// play: settled bets only, amounts to the cent. It carries no msisdn or
+// bet references.
+type LifetimeStats struct {
+	GamesPlayed   int64   `json:"games_played" example:"42"`
+	Wins          int64   `json:"wins" example:"9"`
+	Losses        int64   `json:"losses" example:"33"`
+	TotalWagered  float64 `json:"total_wagered" example:"4200"` // free bets are left out
+	TotalWon      float64 `json:"total_won" example:"3150.5"`
+	BiggestWin    float64 `json:"biggest_win" example:"1200"`
+	CurrentStreak int64   `json:"current_streak" example:"3"`
+	StreakKind    string  `json:"streak_kind,omitempty" example:"loss"` // win or loss; empty with no settled bets
+}
+
+// PlayerLifetimeStats returns msisdn's LifetimeStats through the lookup
+// cache. A player with no settled bets gets zeros.
+func (s *LuckyNumberService) PlayerLifetimeStats(ctx context.Context, msisdn string) (LifetimeStats, error) {
+	if s == nil || s.db == nil {
+		return LifetimeStats{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	row, err := s.lookups.Get(ctx, playerStatsKeyPrefix+msisdn, func(ctx context.Context) (map[string]interface{}, error) {
+		st, err := s.db.GetPlayerLifetimeStats(ctx, msisdn)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"stats": st}, nil
+	})
+	if err != nil {
+		return LifetimeStats{}, err
+	}
+	st, _ := row["stats"].(database.PlayerLifetimeStats)
+	return lifetimeStats(st), nil
+}
+
+// lifetimeStats converts the database figures for the API
+func lifetimeStats(st database.PlayerLifetimeStats) LifetimeStats {
+	stats := LifetimeStats{
+		GamesPlayed:   st.GamesPlayed,
+		Wins:          st.Wins,
+		Losses:        st.Losses,
+		TotalWagered:  round2(st.TotalWagered),
+		TotalWon:      round2(st.TotalWon),
+		BiggestWin:    round2(st.BiggestWin),
+		CurrentStreak: st.Streak,
+	}
+	switch {
+	case st.Streak == 0:
+	case st.StreakWon:
+		stats.StreakKind = StreakWin
+	default:
+		stats.StreakKind = StreakLoss
+	}
+	return stats
+}
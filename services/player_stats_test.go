@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/database"
+	"strings"
+	"testing"
+	"time"
+)
+
+// lifetimeRepo answers GetPlayerLifetimeStats from fixed figures and counts
+// the reads
+type lifetimeRepo struct {
+	*memRepo
+	stats map[string]database.PlayerLifetimeStats
+	reads int
+}
+
+func (r *lifetimeRepo) GetPlayerLifetimeStats(ctx context.Context, msisdn string) (database.PlayerLifetimeStats, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	return r.stats[msisdn], nil
+}
+
+func TestPlayerLifetimeStats(t *testing.T) {
+	repo := &lifetimeRepo{memRepo: newMemRepo(), stats: map[string]database.PlayerLifetimeStats{
+		testMsisdn:     {GamesPlayed: 6, Wins: 3, Losses: 3, TotalWagered: 130.004, TotalWon: 1340.499999, BiggestWin: 1200, Streak: 2},
+		"254700000002": {GamesPlayed: 1, Wins: 1, TotalWagered: 20, TotalWon: 60, BiggestWin: 60, StreakWon: true, Streak: 1},
+	}}
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	cases := map[string]LifetimeStats{
+		testMsisdn:     {GamesPlayed: 6, Wins: 3, Losses: 3, TotalWagered: 130, TotalWon: 1340.5, BiggestWin: 1200, CurrentStreak: 2, StreakKind: StreakLoss},
+		"254700000002": {GamesPlayed: 1, Wins: 1, TotalWagered: 20, TotalWon: 60, BiggestWin: 60, CurrentStreak: 1, StreakKind: StreakWin},
+		"254700000009": {},
+	}
+	for msisdn, want := range cases {
+		got, err := s.PlayerLifetimeStats(ctx, msisdn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s stats = %+v, want %+v", msisdn, got, want)
+		}
+	}
+
+	raw, _ := json.Marshal(cases["254700000009"])
+	if strings.Contains(string(raw), "streak_kind") || strings.Contains(string(raw), "msisdn") {
+		t.Errorf("no-bets stats = %s, want no streak kind and no msisdn", raw)
+	}
+}
+
+func TestPlayerLifetimeStatsCached(t *testing.T) {
+	repo := &lifetimeRepo{memRepo: newMemRepo(), stats: map[string]database.PlayerLifetimeStats{
+		testMsisdn: {GamesPlayed: 1, Losses: 1, TotalWagered: 20, Streak: 1},
+	}}
+	s := newTestService(t, repo, nil)
+	s.lookups = newLookupCache(30*time.Millisecond, 10*time.Millisecond)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		s.PlayerLifetimeStats(ctx, testMsisdn)
+	}
+	s.PlayerLifetimeStats(ctx, "254700000002")
+	if repo.reads != 2 {
+		t.Errorf("%d reads for 4 lookups of 2 players, want 2", repo.reads)
+	}
+
+	repo.stats[testMsisdn] = database.PlayerLifetimeStats{GamesPlayed: 2, Losses: 2, TotalWagered: 40, Streak: 2}
+	time.Sleep(40 * time.Millisecond)
+	if got, _ := s.PlayerLifetimeStats(ctx, testMsisdn); got.GamesPlayed != 2 || got.CurrentStreak != 2 {
+		t.Errorf("stats after the cache expired = %+v, want the new figures", got)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Display name bounds, counted in characters after sanitizing
+const (
+	NameMinLength = 2
+	NameMaxLength = 30
+)
+
+// ProfileLanguages are the SMS languages a player can pick
+var ProfileLanguages = []string{"en", "sw"}
+
+var (
+	ErrInvalidProfile  = errors.New("invalid profile")
+	ErrProfileNotFound = errors.New("player not found")
+)
+
+// smsSettings holds the sms section; ConfigureSMS replaces it
+var smsSettings = config.Default().SMS
+
+// ConfigureSMS applies the loaded sms section
+func ConfigureSMS(c config.SMSConfig) {
+	smsSettings = c
+}
+
+// Profile is a player's editable settings
+type Profile struct {
+	Msisdn           string `json:"msisdn"`
+	Name             string `json:"name"`
+	Language         string `json:"language"`
+	SMSNotifications bool   `json:"sms_notifications"`
+	ShowWin          bool   `json:"show_win"`
+}
+
+// ProfileUpdate changes the fields that are set and leaves the rest
+type ProfileUpdate struct {
+	Name             *string
+	Language         *string
+	SMSNotifications *bool
+	ShowWin          *bool
+}
+
+// SanitizeName trims name, drops anything but letters, digits, spaces and
+// ' - . and collapses runs of spaces. The result must be NameMinLength to
+// NameMaxLength characters long.
+func SanitizeName(name string) (string, error) {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsLetter(r), unicode.IsDigit(r), unicode.Is(unicode.Mn, r), r == '\'', r == '-', r == '.':
+		default:
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	clean := b.String()
+	if n := utf8.RuneCountInString(clean); n < NameMinLength || n > NameMaxLength {
+		return "", fmt.Errorf("%w: name must be %d to %d letters", ErrInvalidProfile, NameMinLength, NameMaxLength)
+	}
+	return clean, nil
+}
+
+// validLanguage reports whether lang is one of ProfileLanguages
+func validLanguage(lang string) bool {
+	for _, l := range ProfileLanguages {
+		if l == lang {
+			return true
+		}
+	}
+	return false
+}
+
+func profileFromRow(p *database.PlayerProfile) Profile {
+	language := p.Language
+	if language == "" {
+		language = DefaultLanguage
+	}
+	return Profile{
+		Msisdn:           p.Msisdn,
+		Name:             p.Name,
+		Language:         language,
+		SMSNotifications: p.SMSNotifications,
+		ShowWin:          p.ShowWin,
+	}
+}
+
+// GetProfile returns msisdn's profile
+func (s *LuckyNumberService) GetProfile(msisdn string) (Profile, error) {
+	if s == nil || s.db == nil {
+		return Profile{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := s.db.GetPlayerProfile(ctx, msisdn)
+	if err != nil {
+		return Profile{}, err
+	}
+	if p == nil {
+		return Profile{}, ErrProfileNotFound
+	}
+	return profileFromRow(p), nil
+}
+
+// UpdateProfile validates u, applies it to msisdn's profile and returns the
+// result. Returns ErrInvalidProfile naming every bad field.
+func (s *LuckyNumberService) UpdateProfile(msisdn string, u ProfileUpdate) (Profile, error) {
+	if s == nil || s.db == nil {
+		return Profile{}, fmt.Errorf("service or database not initialized")
+	}
+
+	var problems []string
+	var name, language string
+	if u.Name != nil {
+		clean, err := SanitizeName(*u.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("name must be %d to %d letters", NameMinLength, NameMaxLength))
+		}
+		name = clean
+	}
+	if u.Language != nil {
+		language = strings.ToLower(strings.TrimSpace(*u.Language))
+		if !validLanguage(language) {
+			problems = append(problems, fmt.Sprintf("language must be one of %s", strings.Join(ProfileLanguages, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return Profile{}, fmt.Errorf("%w: %s", ErrInvalidProfile, strings.Join(problems, "; "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	p, err := s.db.GetPlayerProfile(ctx, msisdn)
+	if err != nil {
+		return Profile{}, err
+	}
+	if p == nil {
+		return Profile{}, ErrProfileNotFound
+	}
+
+	if u.Name != nil {
+		p.Name = name
+	}
+	if u.Language != nil {
+		p.Language = language
+	}
+	if u.SMSNotifications != nil {
+		p.SMSNotifications = *u.SMSNotifications
+	}
+	if u.ShowWin != nil {
+		p.ShowWin = *u.ShowWin
+	}
+
+	if _, err := s.db.UpdatePlayerProfile(ctx, *p); err != nil {
+		return Profile{}, err
+	}
+	if u.ShowWin != nil {
+		s.lookups.ForgetPrefix(winnersKeyPrefix)
+	}
+	return profileFromRow(p), nil
+}
+
+// sendResultSMS sends a win or loss SMS unless the player turned
+// notifications off and sms.results_opt_out honours that. OTPs, deposit,
+// jackpot, reversal and transfer messages are always sent. Result and
+// jackpot messages wait for the reveal when ctx holds them.
+func (s *LuckyNumberService) sendResultSMS(ctx context.Context, player map[string]interface{}, msisdn, message string) error {
+	if smsSettings.ResultsOptOut && !wantsSMS(player) {
+		logrus.Debugf("sms: %s opted out of result messages", msisdn)
+		return nil
+	}
+	defer timingFrom(ctx).took(stageSMS, time.Now())
+	return s.sendGameSMS(ctx, msisdn, message)
+}
+
+// wantsSMS reads sms_notifications from a Player row. Rows from before the
+// column existed count as opted in.
+func wantsSMS(player map[string]interface{}) bool {
+	v, ok := player["sms_notifications"]
+	if !ok || v == nil {
+		return true
+	}
+	b, ok := v.(bool)
+	return !ok || b
+}
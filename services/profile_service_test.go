@@ -0,0 +1,272 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"strings"
+	"testing"
+	"time"
+)
+
+// profileRepo keeps PlayerProfile rows beside a memRepo's players
+type profileRepo struct {
+	*memRepo
+	profiles map[string]*database.PlayerProfile
+	updates  int
+}
+
+func newProfileRepo() *profileRepo {
+	return &profileRepo{memRepo: newMemRepo(), profiles: map[string]*database.PlayerProfile{}}
+}
+
+func (r *profileRepo) GetPlayerProfile(ctx context.Context, msisdn string) (*database.PlayerProfile, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.profiles[msisdn]
+	if !ok {
+		return nil, nil
+	}
+	cp := *p
+	return &cp, nil
+}
+
+func (r *profileRepo) UpdatePlayerProfile(ctx context.Context, p database.PlayerProfile) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.updates++
+	r.profiles[p.Msisdn] = &p
+	return 1, nil
+}
+
+func TestSanitizeName(t *testing.T) {
+	cases := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"A", "", false},
+		{"Al", "Al", true},
+		{strings.Repeat("a", NameMaxLength), strings.Repeat("a", NameMaxLength), true},
+		{strings.Repeat("a", NameMaxLength+1), "", false},
+		{"  Jane    Wanjiru  ", "Jane Wanjiru", true},
+		{"O'Neil-Smith Jr.", "O'Neil-Smith Jr.", true},
+		{"Amina 🎉🎉", "Amina", true},
+		{"Zoë Müller", "Zoë Müller", true},
+		{"<script>x</script>", "scriptxscript", true},
+		{"🎉 a 🎉", "", false},
+	}
+	for _, tc := range cases {
+		got, err := SanitizeName(tc.in)
+		if tc.ok != (err == nil) || got != tc.want {
+			t.Errorf("SanitizeName(%q) = %q, %v; want %q, ok %v", tc.in, got, err, tc.want, tc.ok)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("SanitizeName(%q) error %v, want ErrInvalidProfile", tc.in, err)
+		}
+	}
+}
+
+func TestUpdateProfileValidation(t *testing.T) {
+	repo := newProfileRepo()
+	repo.profiles[testMsisdn] = &database.PlayerProfile{Msisdn: testMsisdn, Name: "Jane", Language: "en", SMSNotifications: true}
+	s := newTestService(t, repo, nil)
+
+	bad, fr := "x", "fr"
+	_, err := s.UpdateProfile(testMsisdn, ProfileUpdate{Name: &bad, Language: &fr})
+	if !errors.Is(err, ErrInvalidProfile) || !strings.Contains(err.Error(), "name") || !strings.Contains(err.Error(), "language") {
+		t.Errorf("bad update = %v, want ErrInvalidProfile naming both fields", err)
+	}
+	if repo.updates != 0 {
+		t.Error("a rejected update must not be written")
+	}
+
+	if _, err := s.UpdateProfile("254799999999", ProfileUpdate{}); !errors.Is(err, ErrProfileNotFound) {
+		t.Errorf("unknown player = %v, want ErrProfileNotFound", err)
+	}
+}
+
+func TestUpdateProfilePartial(t *testing.T) {
+	repo := newProfileRepo()
+	repo.profiles[testMsisdn] = &database.PlayerProfile{Msisdn: testMsisdn, Name: "Jane", Language: "en", SMSNotifications: true, ShowWin: true}
+	s := newTestService(t, repo, nil)
+
+	sw, off := " SW ", false
+	got, err := s.UpdateProfile(testMsisdn, ProfileUpdate{Language: &sw, SMSNotifications: &off})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Profile{Msisdn: testMsisdn, Name: "Jane", Language: "sw", SMSNotifications: false, ShowWin: true}
+	if got != want {
+		t.Errorf("profile = %+v, want %+v", got, want)
+	}
+	if stored := *repo.profiles[testMsisdn]; stored.Name != "Jane" || stored.Language != "sw" || stored.SMSNotifications || !stored.ShowWin {
+		t.Errorf("stored %+v, want only language and sms_notifications changed", stored)
+	}
+}
+
+func TestUpdateProfileShowWinForgetsWinners(t *testing.T) {
+	repo := newProfileRepo()
+	repo.profiles[testMsisdn] = &database.PlayerProfile{Msisdn: testMsisdn, Name: "Jane", ShowWin: true}
+	s := newTestService(t, repo, nil)
+
+	loads := 0
+	load := func(context.Context) (map[string]interface{}, error) {
+		loads++
+		return map[string]interface{}{"n": loads}, nil
+	}
+	key := winnersKeyPrefix + "10:0:"
+	s.lookups.Get(context.Background(), key, load)
+	s.lookups.Get(context.Background(), key, load)
+	if loads != 1 {
+		t.Fatalf("loads = %d, want the feed cached", loads)
+	}
+
+	name := "Janet"
+	if _, err := s.UpdateProfile(testMsisdn, ProfileUpdate{Name: &name}); err != nil {
+		t.Fatal(err)
+	}
+	s.lookups.Get(context.Background(), key, load)
+	if loads != 1 {
+		t.Error("a name change should leave the winners feed cached")
+	}
+
+	hide := false
+	if _, err := s.UpdateProfile(testMsisdn, ProfileUpdate{ShowWin: &hide}); err != nil {
+		t.Fatal(err)
+	}
+	s.lookups.Get(context.Background(), key, load)
+	if loads != 2 {
+		t.Error("changing show_win should drop the cached winners feed")
+	}
+}
+
+func TestWantsSMS(t *testing.T) {
+	cases := []struct {
+		player map[string]interface{}
+		want   bool
+	}{
+		{map[string]interface{}{}, true},
+		{map[string]interface{}{"sms_notifications": nil}, true},
+		{map[string]interface{}{"sms_notifications": true}, true},
+		{map[string]interface{}{"sms_notifications": false}, false},
+	}
+	for _, tc := range cases {
+		if got := wantsSMS(tc.player); got != tc.want {
+			t.Errorf("wantsSMS(%v) = %v, want %v", tc.player, got, tc.want)
+		}
+	}
+}
+
+func TestResultSMSHonoursOptOut(t *testing.T) {
+	saved := smsSettings
+	t.Cleanup(func() { smsSettings = saved })
+	s := newTestService(t, newMemRepo(), nil)
+	optedOut := map[string]interface{}{"sms_notifications": false}
+	optedIn := map[string]interface{}{"sms_notifications": true}
+
+	for _, tc := range []struct {
+		name   string
+		optOut bool
+		player map[string]interface{}
+		sent   bool
+	}{
+		{"opted in", true, optedIn, true},
+		{"opted out", true, optedOut, false},
+		{"opt-out ignored", false, optedOut, true},
+	} {
+		smsSettings.ResultsOptOut = tc.optOut
+		ctx, held := holdResultSMS(context.Background())
+		if err := s.sendResultSMS(ctx, tc.player, testMsisdn, "You lost"); err != nil {
+			t.Fatal(err)
+		}
+		if sent := len(*held) == 1; sent != tc.sent {
+			t.Errorf("%s: sent = %v, want %v", tc.name, sent, tc.sent)
+		}
+	}
+}
+
+func TestOTPIgnoresOptOut(t *testing.T) {
+	saved := smsSettings
+	t.Cleanup(func() { smsSettings = saved })
+	smsSettings.ResultsOptOut = true
+
+	repo := newMemRepo()
+	repo.addPlayer(testMsisdn, 0).NoSMS = true
+	s := newTestService(t, repo, nil)
+
+	// An opted-out player still has to be able to sign in
+	if err := s.queueOTP(context.Background(), testMsisdn, "4821"); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.sms) != 1 || !strings.Contains(repo.sms[0].Message, "4821") {
+		t.Errorf("queued %+v, want the OTP", repo.sms)
+	}
+}
+
+// showWinRepo builds the winners feed from the stored profiles, blanking the
+// msisdn of a player without show_win as database.GetRecentWinners does
+type showWinRepo struct {
+	*profileRepo
+	reads int
+}
+
+func (r *showWinRepo) GetRecentWinners(ctx context.Context, limit int, minAmount float64, gameCatID string) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reads++
+	msisdn := ""
+	if p := r.profiles[testMsisdn]; p != nil && p.ShowWin {
+		msisdn = p.Msisdn
+	}
+	return []map[string]interface{}{{"msisdn": msisdn, "items": "KES 500", "amount": 500.0, "game_name": "PawaBox"}}, nil
+}
+
+func TestShowWinHidesFromNextFeed(t *testing.T) {
+	repo := &showWinRepo{profileRepo: newProfileRepo()}
+	repo.profiles[testMsisdn] = &database.PlayerProfile{Msisdn: testMsisdn, Language: "en", ShowWin: true}
+	s := newTestService(t, repo, nil)
+	s.lookups = newLookupCache(time.Minute, time.Minute)
+	// other is a second worker whose cache only ages out
+	other := newTestService(t, repo, nil)
+	other.lookups = newLookupCache(30*time.Millisecond, 10*time.Millisecond)
+
+	feed := func(s *LuckyNumberService) string {
+		t.Helper()
+		winners, err := s.GetRecentWinners(5, 0, "")
+		if err != nil || len(winners) != 1 {
+			t.Fatalf("feed = %v, %v", winners, err)
+		}
+		return winners[0].Msisdn
+	}
+	if got := feed(s); got != "2547****5678" {
+		t.Fatalf("shown winner = %q, want masked msisdn", got)
+	}
+	feed(s)
+	if got := feed(other); got != "2547****5678" {
+		t.Fatalf("other worker = %q, want masked msisdn", got)
+	}
+	if repo.reads != 2 {
+		t.Errorf("feed read %d times, want 2 with the repeat cached", repo.reads)
+	}
+
+	off := false
+	if _, err := s.UpdateProfile(testMsisdn, ProfileUpdate{ShowWin: &off}); err != nil {
+		t.Fatal(err)
+	}
+	if got := feed(s); got != AnonymousWinner {
+		t.Errorf("feed after opting out = %q, want %q", got, AnonymousWinner)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if got := feed(other); got != AnonymousWinner {
+		t.Errorf("other worker after the cache ttl = %q, want %q", got, AnonymousWinner)
+	}
+
+	on := true
+	if _, err := s.UpdateProfile(testMsisdn, ProfileUpdate{ShowWin: &on}); err != nil {
+		t.Fatal(err)
+	}
+	if got := feed(s); got != "2547****5678" {
+		t.Errorf("feed after opting back in = %q, want masked msisdn", got)
+	}
+}
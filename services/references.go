@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Helper methods
+func (s *LuckyNumberService) randomString(length int) string {
+	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	result := make([]byte, length)
+	for i := range result {
+		result[i] = charset[cryptoRandIndex(len(charset))]
+	}
+	return string(result)
+}
+
+// maxReferenceAttempts bounds how many references an insert tries before
+// giving up on ErrDuplicateReference
+const maxReferenceAttempts = 3
+
+// withFreshReference runs insert with reference and, while the database
+// reports the reference as taken, again with a new one of kind. It returns
+// the reference the row was stored under.
+func withFreshReference(kind, reference string, insert func(reference string) error) (string, error) {
+	for attempt := 1; ; attempt++ {
+		err := insert(reference)
+		if !errors.Is(err, database.ErrDuplicateReference) || attempt == maxReferenceAttempts {
+			return reference, err
+		}
+		next := utils.NewReference(kind)
+		logrus.Warnf("reference %s already in use, retrying as %s", reference, next)
+		reference = next
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"strings"
+	"testing"
+)
+
+func TestWithFreshReferenceRegenerates(t *testing.T) {
+	var tried []string
+	ref, err := withFreshReference(utils.RefDeposit, "DEP_TAKEN", func(reference string) error {
+		tried = append(tried, reference)
+		if len(tried) < 3 {
+			return database.ErrDuplicateReference
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tried) != 3 || tried[0] != "DEP_TAKEN" || ref != tried[2] {
+		t.Fatalf("tried %v and kept %s, want two collisions then the third reference", tried, ref)
+	}
+	if tried[1] == tried[2] || !strings.HasPrefix(tried[1], "DEP_") || !strings.HasPrefix(tried[2], "DEP_") {
+		t.Errorf("regenerated %v, want fresh DEP_ references", tried[1:])
+	}
+}
+
+func TestWithFreshReferenceGivesUp(t *testing.T) {
+	calls := 0
+	_, err := withFreshReference(utils.RefBet, utils.NewReference(utils.RefBet), func(string) error {
+		calls++
+		return database.ErrDuplicateReference
+	})
+	if !errors.Is(err, database.ErrDuplicateReference) || calls != maxReferenceAttempts {
+		t.Errorf("err %v after %d tries, want ErrDuplicateReference after %d", err, calls, maxReferenceAttempts)
+	}
+
+	calls = 0
+	boom := errors.New("connection reset")
+	if _, err := withFreshReference(utils.RefBet, "BET_X", func(string) error { calls++; return boom }); err != boom || calls != 1 {
+		t.Errorf("err %v after %d tries, want other errors returned at once", err, calls)
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+// BoxKind is what a box holds
+type BoxKind string
+
+const (
+	BoxCash  BoxKind = "cash"
+	BoxAward BoxKind = "award"
+)
+
+// ResultBox is a box as API version 2 returns it: the raw amount for the
+// client to format, a display string for clients that do not, and whether
+// the box is cash or an award
+type ResultBox struct {
+	Value     float64 `json:"value" example:"1234.5"`
+	Display   string  `json:"display" example:"1,234.50"`
+	Kind      BoxKind `json:"kind" example:"cash"`
+	AwardName string  `json:"award_name,omitempty" example:"Smart TV"`
+}
+
+// resultBox returns w as a version 2 box
+func (w WinAmount) resultBox() ResultBox {
+	box := ResultBox{Value: w.Value, Display: FormatToMZN(w.Value), Kind: BoxCash}
+	if w.Kind == BoxAward {
+		box.Kind, box.AwardName = BoxAward, w.Item
+	}
+	return box
+}
+
+func resultBoxes(boxes map[string]WinAmount) map[string]ResultBox {
+	v2 := make(map[string]ResultBox, len(boxes))
+	for num, w := range boxes {
+		v2[num] = w.resultBox()
+	}
+	return v2
+}
+
+// legacyBoxes returns boxes in the version 1 shape, Value and Item only
+func legacyBoxes(boxes map[string]WinAmount) map[string]WinAmount {
+	if boxes == nil {
+		return nil
+	}
+	v1 := make(map[string]WinAmount, len(boxes))
+	for num, w := range boxes {
+		w.Kind = ""
+		v1[num] = w
+	}
+	return v1
+}
+
+// GameResultV2 is PlaceBetResultDisplay with version 2 boxes. Its Boxes
+// hides the embedded one, so the other fields stay those of version 1.
+type GameResultV2 struct {
+	PlaceBetResultDisplay
+	Boxes map[string]ResultBox `json:"Boxes"`
+}
+
+// ParcelResultV2 is ParcelResult with version 2 boxes
+type ParcelResultV2 struct {
+	ParcelResult
+	Boxes map[string]ResultBox `json:"Boxes"`
+}
+
+// BetRevealV2 is BetReveal with a version 2 GameResult
+type BetRevealV2 struct {
+	BetReveal
+	GameResult *GameResultV2 `json:"GameResult,omitempty"`
+}
+
+// Legacy returns r as version 1 clients know it
+func (r PlaceBetResultDisplay) Legacy() PlaceBetResultDisplay {
+	r.Boxes = legacyBoxes(r.Boxes)
+	return r
+}
+
+// V2 returns r with version 2 boxes
+func (r PlaceBetResultDisplay) V2() GameResultV2 {
+	return GameResultV2{PlaceBetResultDisplay: r, Boxes: resultBoxes(r.Boxes)}
+}
+
+// Legacy returns r as version 1 clients know it
+func (r ParcelResult) Legacy() ParcelResult {
+	r.Boxes = legacyBoxes(r.Boxes)
+	return r
+}
+
+// V2 returns r with version 2 boxes
+func (r ParcelResult) V2() ParcelResultV2 {
+	return ParcelResultV2{ParcelResult: r, Boxes: resultBoxes(r.Boxes)}
+}
+
+// Legacy returns r as version 1 clients know it
+func (r BetReveal) Legacy() BetReveal {
+	if r.GameResult != nil {
+		result := r.GameResult.Legacy()
+		r.GameResult = &result
+	}
+	return r
+}
+
+// V2 returns r with a version 2 GameResult
+func (r BetReveal) V2() BetRevealV2 {
+	v2 := BetRevealV2{BetReveal: r}
+	if r.GameResult != nil {
+		result := r.GameResult.V2()
+		v2.GameResult = &result
+	}
+	return v2
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// awardRepo offers an award for the layout's award box
+type awardRepo struct {
+	*memRepo
+}
+
+func (r *awardRepo) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
+	return map[string]interface{}{"value": 25000.0, "name": "Smart TV"}, nil
+}
+
+func TestAwardBoxKindSetWhereAssigned(t *testing.T) {
+	repo := &awardRepo{memRepo: newMemRepo()}
+	repo.addPlayer(testMsisdn, 10000)
+	s := newTestService(t, repo, nil)
+
+	for i := 0; i < 10; i++ {
+		result := placeTestBet(t, s, repo.memRepo, 20, "3").GameResult
+		awards := 0
+		for num, w := range result.Boxes {
+			box := w.resultBox()
+			switch {
+			case w.Item == "Smart TV":
+				awards++
+				if w.Kind != BoxAward || box != (ResultBox{Value: 25000, Display: "25,000.00", Kind: BoxAward, AwardName: "Smart TV"}) {
+					t.Errorf("box %s: %+v as %+v, want the Smart TV award", num, w, box)
+				}
+			case w.Kind == BoxAward:
+				t.Errorf("box %s: %+v is an award without one being assigned", num, w)
+			default:
+				if box.Kind != BoxCash || box.AwardName != "" || box.Value != w.Value || box.Display != FormatToMZN(w.Value) {
+					t.Errorf("box %s: %+v as %+v, want cash with its amount formatted", num, w, box)
+				}
+			}
+		}
+		if awards != 1 {
+			t.Errorf("bet %s has %d award boxes, want 1: %+v", result.GameID, awards, result.Boxes)
+		}
+	}
+}
+
+func TestResultVersionsKeepTheirShape(t *testing.T) {
+	result := PlaceBetResultDisplay{
+		Boxes: map[string]WinAmount{
+			"1": {Value: 1234.5, Item: "1,234.50"},
+			"2": {Value: 25000, Item: "Smart TV", Kind: BoxAward},
+		},
+		ResultStatus: "Win",
+		GameID:       "BET_1",
+	}
+
+	v1, _ := json.Marshal(result.Legacy())
+	if want := `"Boxes":{"1":{"Value":1234.5,"Item":"1,234.50"},"2":{"Value":25000,"Item":"Smart TV"}}`; !strings.Contains(string(v1), want) {
+		t.Errorf("version 1 = %s, want %s", v1, want)
+	}
+	v2, _ := json.Marshal(result.V2())
+	if want := `"Boxes":{"1":{"value":1234.5,"display":"1,234.50","kind":"cash"},"2":{"value":25000,"display":"25,000.00","kind":"award","award_name":"Smart TV"}}`; !strings.Contains(string(v2), want) {
+		t.Errorf("version 2 = %s, want %s", v2, want)
+	}
+	if strings.Count(string(v2), `"Boxes"`) != 1 || !strings.Contains(string(v2), `"GameID":"BET_1"`) {
+		t.Errorf("version 2 = %s, want one Boxes and the version 1 fields", v2)
+	}
+	if result.Boxes["2"].Kind != BoxAward {
+		t.Error("Legacy changed the result it was given")
+	}
+
+	reveal := BetReveal{GameResult: &result}
+	if got := reveal.Legacy().GameResult.Boxes["2"].Kind; got != "" {
+		t.Errorf("version 1 reveal kind = %q, want none", got)
+	}
+	if got := reveal.V2().GameResult.Boxes["2"]; got.Kind != BoxAward || got.AwardName != "Smart TV" {
+		t.Errorf("version 2 reveal box = %+v, want the award", got)
+	}
+	if (BetReveal{}).V2().GameResult != nil {
+		t.Error("version 2 of a reveal without a result has one")
+	}
+}
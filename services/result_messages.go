@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/taxcalc"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sendsms sends message to msisdn after the messages already reserved in
+// its lane
+func (s *LuckyNumberService) sendsms(msisdn string, message string) error {
+	return s.sendReservedSMS(s.sms.reserve(msisdn), message)
+}
+
+// sendReservedSMS sends message in the lane place t reserved
+func (s *LuckyNumberService) sendReservedSMS(t *smsTicket, message string) error {
+	return t.send(func(sequence int64) error {
+		return s.deliverSMS(t.msisdn, message, sequence)
+	})
+}
+
+func (s *LuckyNumberService) deliverSMS(msisdn string, message string, sequence int64) error {
+
+	// ctx := context.Background()
+	// senderID := "LuckyNumber"
+	// _, err := s.db.InsertIntoSMSQueue(ctx, msisdn, message, senderID, "game_response", sequence)
+	// // Create request body JSON
+	// payload := map[string]interface{}{
+	// 	"message": message,
+	// 	"msisdn":  msisdn,
+	// }
+	// jsonData, err := json.Marshal(payload)
+	// if err != nil {
+	// 	return fmt.Errorf("json marshal error: %w", err)
+	// }
+	// // Prepare HTTPS client
+	// client := &http.Client{
+	// 	Timeout: 20 * time.Second,
+	// }
+	// req, err := http.NewRequest("POST", "http://172.16.0.184:8008/api/v1/insert_sms", bytes.NewBuffer(jsonData))
+	// if err != nil {
+	// 	return fmt.Errorf("creating request failed: %w", err)
+	// }
+
+	// req.Header.Set("Content-Type", "application/json")
+
+	// // Send request
+	// resp, err := client.Do(req)
+	// if err != nil {
+	// 	return fmt.Errorf("https request failed: %w", err)
+	// }
+	// defer resp.Body.Close()
+	// if resp.StatusCode != http.StatusOK {
+	// 	return fmt.Errorf("api error: status %d", resp.StatusCode)
+	// }
+	return nil
+}
+
+// MessageBuilder writes the result SMS of a settled bet in the player's
+// language, and the boxes shown with it
+type MessageBuilder interface {
+	createWinMessage(ctx context.Context, key, language, selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string, tax taxcalc.Win) string
+	createJackpotMessage(ctx context.Context, language, selectedNumber string, winAmounts map[string]WinAmount, reference string, taxDeductedAmount float64) string
+	createLossMessage(ctx context.Context, language, selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string) string
+	ResultDisplay(selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string) (string, error)
+}
+
+var _ MessageBuilder = (*LuckyNumberService)(nil)
+
+// FormatToMZN formats amount as MZN currency
+func FormatToMZN(n float64) string {
+	s := strconv.FormatFloat(n, 'f', 2, 64) // keep 2 decimal places
+	parts := strings.Split(s, ".")
+	intPart := parts[0]
+
+	length := len(intPart)
+	b := make([]byte, 0, length+length/3)
+
+	for i, c := range intPart {
+		if i > 0 && (length-i)%3 == 0 {
+			b = append(b, ',')
+		}
+		b = append(b, byte(c))
+	}
+
+	if len(parts) > 1 {
+		b = append(b, '.')
+		b = append(b, parts[1]...)
+	}
+
+	return string(b)
+}
+
+// Helper methods
+func (s *LuckyNumberService) createWinMessage(ctx context.Context, key, language, selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string, tax taxcalc.Win) string {
+	var boxes []string
+	for num, winAmount := range winAmounts {
+		boxes = append(boxes, fmt.Sprintf("Box %s - %s", num, winAmount.Item))
+	}
+	sort.Strings(boxes)
+	taxAmount, netAmount := tax.Payable()
+
+	return s.renderMessage(ctx, key, language, map[string]string{
+		"selected_box": selectedNumber,
+		"amount":       winAmounts[selectedNumber].Item,
+		"boxes":        strings.Join(boxes, ", "),
+		"free_bets":    strconv.FormatInt(freeBet, 10),
+		"reference":    reference,
+		"tax_pct":      strconv.Itoa(int(tax.WithholdingPercent)),
+		"tax":          FormatToMZN(taxAmount),
+		"gross":        FormatToMZN(tax.GrossAmount),
+		"net":          FormatToMZN(netAmount),
+	})
+}
+
+func (s *LuckyNumberService) createJackpotMessage(ctx context.Context, language, selectedNumber string, winAmounts map[string]WinAmount, reference string, taxDeductedAmount float64) string {
+	return s.renderMessage(ctx, TemplateJackpot, language, map[string]string{
+		"reference": reference,
+		"item":      winAmounts[selectedNumber].Item,
+		"amount":    FormatToMZN(taxDeductedAmount),
+	})
+}
+
+func (s *LuckyNumberService) ResultDisplay(selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string) (string, error) {
+	// Create a slice of keys to sort
+	keys := make([]string, 0, len(winAmounts))
+	for k := range winAmounts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Build ordered map
+	ordered := make(map[string]WinAmount, len(winAmounts))
+	for _, k := range keys {
+		ordered[k] = winAmounts[k]
+	}
+
+	// Marshal to JSON
+	resultJSON, err := json.Marshal(ordered)
+	if err != nil {
+		return "", err
+	}
+
+	// Convert []byte to string
+	return string(resultJSON), nil
+}
+
+func (s *LuckyNumberService) createLossMessage(ctx context.Context, language, selectedNumber string, winAmounts map[string]WinAmount, freeBet int64, reference string) string {
+	var boxes []string
+	for num, winAmount := range winAmounts {
+		boxes = append(boxes, fmt.Sprintf("Box %s - %s", num, winAmount.Item))
+	}
+	sort.Strings(boxes)
+
+	return s.renderMessage(ctx, TemplateLoss, language, map[string]string{
+		"selected_box": selectedNumber,
+		"boxes":        strings.Join(boxes, "\n"), // Use \n for better formatting
+		"free_bets":    strconv.FormatInt(freeBet, 10),
+		"reference":    reference,
+	})
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/utils"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A game with a reveal delay settles web and app bets at once, as always,
+// but answers them as pending and keeps the outcome in "bet_reveals" until
+// reveal_at. GET /bet/:reference shows it from then on; RunRevealDispatcher
+// sends the held result SMS and the socket bet_result event. Nothing waits
+// per bet: one loop polls for due reveals.
+
+// Reveal states of a BetReveal
+const (
+	RevealPending  = "Pending"
+	RevealRevealed = "Revealed"
+)
+
+// EventBetResult is the socket event that carries a revealed outcome
+const EventBetResult = "bet_result"
+
+const (
+	revealClaimBatch = 100
+	revealRetention  = 24 * time.Hour
+)
+
+// ErrBetNotFound is returned for a reference that is not a bet of the
+// caller
+var ErrBetNotFound = errors.New("bet not found")
+
+// socketPushURL is server.socket_push_url; ConfigureSocketPush replaces it
+var socketPushURL string
+
+// ConfigureSocketPush sets the socket server's /push URL. Empty sends no
+// socket events.
+func ConfigureSocketPush(url string) {
+	socketPushURL = url
+}
+
+// socketEmit delivers socket events to a socket server running in this
+// process; when set it replaces socketPushURL
+var socketEmit func(msisdn, event string, data interface{})
+
+// ConfigureSocketEmitter makes reveals emit their bet_result events through
+// emit instead of posting them to the socket server's /push
+func ConfigureSocketEmitter(emit func(msisdn, event string, data interface{})) {
+	socketEmit = emit
+}
+
+// BetReveal is a delayed bet. GameResult is only set once it is Revealed.
+type BetReveal struct {
+	Status     string                 `json:"Status"`
+	Reference  string                 `json:"Reference"`
+	RevealAt   time.Time              `json:"RevealAt"`
+	GameResult *PlaceBetResultDisplay `json:"GameResult,omitempty"`
+}
+
+// revealDelay is how long a bet placed via channel on a game with delay
+// waits for its outcome. USSD has no screen to build suspense on, so its
+// players get the outcome and SMS at once.
+func revealDelay(delay time.Duration, channel string) time.Duration {
+	if channel == "ussd" {
+		return 0
+	}
+	return delay
+}
+
+type heldSMSKey struct{}
+
+// holdResultSMS returns a context under which result SMS are collected in
+// the returned slice instead of sent
+func holdResultSMS(ctx context.Context) (context.Context, *[]string) {
+	held := new([]string)
+	return context.WithValue(ctx, heldSMSKey{}, held), held
+}
+
+// sendGameSMS sends a message about a bet's outcome, or holds it when ctx
+// comes from holdResultSMS
+func (s *LuckyNumberService) sendGameSMS(ctx context.Context, msisdn, message string) error {
+	if held, ok := ctx.Value(heldSMSKey{}).(*[]string); ok {
+		*held = append(*held, message)
+		return nil
+	}
+	return s.sendsms(msisdn, message)
+}
+
+// holdReveal stores a settled bet's outcome and held SMS until delay from
+// now and returns the pending reveal
+func (s *LuckyNumberService) holdReveal(ctx context.Context, msisdn string, result PlaceBetResultDisplay, sms []string, delay time.Duration) (*BetReveal, error) {
+	payload, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bet result: %w", err)
+	}
+	revealAt := clock.Now().Add(delay)
+	if err := s.db.CreateBetReveal(ctx, result.GameID, msisdn, payload, sms, revealAt); err != nil {
+		return nil, err
+	}
+	return &BetReveal{Status: RevealPending, Reference: result.GameID, RevealAt: revealAt}, nil
+}
+
+// GetBetReveal returns msisdn's bet reference: pending before its reveal
+// time, with the outcome after it. A bet with no reveal held is answered
+// from the Bets row.
+func (s *LuckyNumberService) GetBetReveal(ctx context.Context, msisdn, reference string) (BetReveal, error) {
+	if s == nil || s.db == nil {
+		return BetReveal{}, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.db.GetBetReveal(ctx, reference, msisdn)
+	if err != nil {
+		return BetReveal{}, err
+	}
+	if row == nil {
+		return s.betResult(ctx, msisdn, reference)
+	}
+
+	revealAt, _ := row["reveal_at"].(time.Time)
+	reveal := BetReveal{Status: RevealPending, Reference: reference, RevealAt: revealAt}
+	if clock.Now().Before(reveal.RevealAt) {
+		return reveal, nil
+	}
+	var result PlaceBetResultDisplay
+	if err := json.Unmarshal([]byte(utils.ToString(row["result"])), &result); err != nil {
+		return BetReveal{}, fmt.Errorf("failed to decode bet result %s: %w", reference, err)
+	}
+	reveal.Status, reveal.GameResult = RevealRevealed, &result
+	return reveal, nil
+}
+
+// RunRevealDispatcher sends the SMS and socket event of each delayed bet
+// once its reveal time comes, every limits.reveal_interval, and drops
+// reveals a day after they were sent
+func (s *LuckyNumberService) RunRevealDispatcher(ctx context.Context) {
+	if limits.RevealInterval <= 0 {
+		logrus.Info("bet reveals: disabled")
+		return
+	}
+	ticker := time.NewTicker(limits.RevealInterval)
+	defer ticker.Stop()
+	var purged time.Time
+
+	for {
+		s.dispatchReveals(ctx)
+		if time.Since(purged) >= time.Hour {
+			if n, err := s.db.PurgeBetReveals(ctx, time.Now().Add(-revealRetention)); err != nil {
+				logrus.Errorf("bet reveals: purge failed: %v", err)
+			} else if n > 0 {
+				logrus.Infof("bet reveals: purged %d", n)
+			}
+			purged = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchReveals claims and sends due reveals until none are left. A
+// reveal is claimed once; a failed SMS or push is logged, not retried.
+func (s *LuckyNumberService) dispatchReveals(ctx context.Context) {
+	for ctx.Err() == nil {
+		rows, err := s.db.ClaimDueReveals(ctx, revealClaimBatch)
+		if err != nil {
+			logrus.Errorf("bet reveals: claim failed: %v", err)
+			return
+		}
+		if len(rows) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, row := range rows {
+			row := row
+			wg.Add(1)
+			utils.GoBackground("bet reveal", func() {
+				defer wg.Done()
+				s.reveal(row)
+			})
+		}
+		wg.Wait()
+	}
+}
+
+// reveal sends one claimed reveal's held SMS and bet_result event
+func (s *LuckyNumberService) reveal(row map[string]interface{}) {
+	reference, msisdn := utils.ToString(row["reference"]), utils.ToString(row["msisdn"])
+
+	sms, _ := row["sms"].([]interface{})
+	for _, message := range sms {
+		if err := s.sendsms(msisdn, utils.ToString(message)); err != nil {
+			logrus.Errorf("bet reveal %s: sms failed: %v", reference, err)
+		}
+	}
+
+	if !socketConfigured() {
+		return
+	}
+	var result PlaceBetResultDisplay
+	if err := json.Unmarshal([]byte(utils.ToString(row["result"])), &result); err != nil {
+		logrus.Errorf("bet reveal %s: %v", reference, err)
+		return
+	}
+	revealAt, _ := row["reveal_at"].(time.Time)
+	// Socket clients do not negotiate a version, so they get version 1
+	data := BetReveal{Status: RevealRevealed, Reference: reference, RevealAt: revealAt, GameResult: &result}
+	if err := pushSocket(msisdn, EventBetResult, data.Legacy()); err != nil {
+		logrus.Errorf("bet reveal %s: %v", reference, err)
+	}
+}
+
+// socketPushClient posts to socket_push_url
+var socketPushClient = &http.Client{Timeout: 5 * time.Second}
+
+// socketConfigured reports whether pushSocket has anywhere to send events
+func socketConfigured() bool {
+	return socketEmit != nil || socketPushURL != ""
+}
+
+// pushSocket sends event to msisdn's sockets, in process when the socket
+// server is embedded and through socket_push_url otherwise. It does nothing
+// when neither is configured.
+func pushSocket(msisdn, event string, data interface{}) error {
+	if socketEmit != nil {
+		socketEmit(msisdn, event, data)
+		return nil
+	}
+	if socketPushURL == "" {
+		return nil
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"msisdn": msisdn,
+		"event":  event,
+		"data":   data,
+	})
+	if err != nil {
+		return err
+	}
+	resp, err := socketPushClient.Post(socketPushURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("socket push failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("socket push answered %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memReveal is a "bet_reveals" row
+type memReveal struct {
+	msisdn   string
+	result   []byte
+	sms      []string
+	revealAt time.Time
+	sent     bool
+}
+
+// revealRepo keeps bet_reveals in memory; createErr fails CreateBetReveal
+type revealRepo struct {
+	*memRepo
+	rmu       sync.Mutex
+	reveals   map[string]*memReveal
+	createErr error
+}
+
+func newRevealRepo(delay time.Duration) *revealRepo {
+	repo := &revealRepo{memRepo: newMemRepo(), reveals: make(map[string]*memReveal)}
+	repo.games["1"].RevealDelay = delay
+	repo.addPlayer(testMsisdn, 1000)
+	return repo
+}
+
+func (r *revealRepo) CreateBetReveal(ctx context.Context, reference, msisdn string, result []byte, sms []string, revealAt time.Time) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.rmu.Lock()
+	defer r.rmu.Unlock()
+	r.reveals[reference] = &memReveal{msisdn: msisdn, result: result, sms: sms, revealAt: revealAt}
+	return nil
+}
+
+func (r *revealRepo) GetBetReveal(ctx context.Context, reference, msisdn string) (map[string]interface{}, error) {
+	r.rmu.Lock()
+	defer r.rmu.Unlock()
+	rv, ok := r.reveals[reference]
+	if !ok || rv.msisdn != msisdn {
+		return nil, nil
+	}
+	return map[string]interface{}{"result": string(rv.result), "reveal_at": rv.revealAt}, nil
+}
+
+func (r *revealRepo) ClaimDueReveals(ctx context.Context, limit int) ([]map[string]interface{}, error) {
+	r.rmu.Lock()
+	defer r.rmu.Unlock()
+	var rows []map[string]interface{}
+	for reference, rv := range r.reveals {
+		if rv.sent || rv.revealAt.After(time.Now()) || len(rows) == limit {
+			continue
+		}
+		rv.sent = true
+		sms := make([]interface{}, len(rv.sms))
+		for i, m := range rv.sms {
+			sms[i] = m
+		}
+		rows = append(rows, map[string]interface{}{
+			"reference": reference, "msisdn": rv.msisdn, "result": string(rv.result), "sms": sms, "reveal_at": rv.revealAt,
+		})
+	}
+	return rows, nil
+}
+
+// GetPlayerBet finds no bet: every bet of these tests is held as a reveal
+func (r *revealRepo) GetPlayerBet(ctx context.Context, reference, msisdn string) (*database.PlayerBet, error) {
+	return nil, nil
+}
+
+// setRevealAt moves a held reveal's time
+func (r *revealRepo) setRevealAt(reference string, at time.Time) {
+	r.rmu.Lock()
+	defer r.rmu.Unlock()
+	r.reveals[reference].revealAt = at
+}
+
+func placeRevealBet(t *testing.T, s *LuckyNumberService, repo *revealRepo, channel string) PlaceBetResult {
+	t.Helper()
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	result, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, 50, "2", channel)
+	if err != nil {
+		t.Fatalf("PlaceBet: %v", err)
+	}
+	return result
+}
+
+// TestRevealImmediate answers a game without a delay, and a USSD bet on a
+// game with one, with the outcome and holds nothing
+func TestRevealImmediate(t *testing.T) {
+	for name, c := range map[string]struct {
+		delay   time.Duration
+		channel string
+	}{
+		"no delay": {0, "web"},
+		"ussd":     {3 * time.Second, "ussd"},
+	} {
+		repo := newRevealRepo(c.delay)
+		s := newTestService(t, repo, fixedOutcomes{"2": 60})
+		result := placeRevealBet(t, s, repo, c.channel)
+		if result.Reveal != nil || result.GameResult.ResultStatus != status.ResultWin || result.GameResult.WinAmount != 60 {
+			t.Errorf("%s: result = %+v, want the win at once", name, result)
+		}
+		if len(repo.reveals) != 0 {
+			t.Errorf("%s: held %d reveals, want none", name, len(repo.reveals))
+		}
+	}
+}
+
+// TestRevealDelayed settles a delayed bet at once but answers it pending,
+// holds its result SMS, and shows the outcome to a poll only from RevealAt
+func TestRevealDelayed(t *testing.T) {
+	repo := newRevealRepo(3 * time.Second)
+	s := newTestService(t, repo, fixedOutcomes{"2": 60})
+
+	before := time.Now()
+	result := placeRevealBet(t, s, repo, "web")
+	if result.Reveal == nil || result.Reveal.Status != RevealPending || result.Reveal.GameResult != nil {
+		t.Fatalf("result = %+v, want a pending reveal without the outcome", result)
+	}
+	if result.GameResult.GameID != "" || result.GameResult.WinAmount != 0 {
+		t.Errorf("pending result leaks the outcome: %+v", result.GameResult)
+	}
+	if at := result.Reveal.RevealAt.Sub(before); at < 3*time.Second || at > 4*time.Second {
+		t.Errorf("RevealAt is %v after the bet, want 3s", at)
+	}
+	reference := result.Reveal.Reference
+	if bet := repo.bets[reference]; bet == nil || bet.Status != status.ResultWin {
+		t.Fatalf("bet %s = %+v, want it settled as a win already", reference, bet)
+	}
+	if held := repo.reveals[reference]; held == nil || len(held.sms) == 0 {
+		t.Fatalf("reveal %s = %+v, want the result SMS held", reference, held)
+	}
+
+	poll, err := s.GetBetReveal(context.Background(), testMsisdn, reference)
+	if err != nil || poll.Status != RevealPending || poll.GameResult != nil {
+		t.Fatalf("poll before RevealAt = %+v, %v; want pending", poll, err)
+	}
+
+	// Either side of the boundary: pending a moment before it, revealed
+	// from it on
+	at := time.Now().Add(50 * time.Millisecond)
+	repo.setRevealAt(reference, at)
+	if poll, _ = s.GetBetReveal(context.Background(), testMsisdn, reference); poll.Status != RevealPending {
+		t.Errorf("poll just before RevealAt = %+v, want pending", poll)
+	}
+	time.Sleep(time.Until(at))
+	poll, err = s.GetBetReveal(context.Background(), testMsisdn, reference)
+	if err != nil || poll.Status != RevealRevealed || poll.GameResult == nil {
+		t.Fatalf("poll at RevealAt = %+v, %v; want revealed", poll, err)
+	}
+	if poll.GameResult.GameID != reference || poll.GameResult.ResultStatus != status.ResultWin || poll.GameResult.WinAmount != 60 {
+		t.Errorf("revealed = %+v, want the 60 win of %s", poll.GameResult, reference)
+	}
+
+	if _, err := s.GetBetReveal(context.Background(), "254700000999", reference); !errors.Is(err, ErrBetNotFound) {
+		t.Errorf("another player's poll = %v, want ErrBetNotFound", err)
+	}
+}
+
+// TestRevealDispatch pushes the bet_result event of a due reveal once, and
+// none for a reveal not yet due
+func TestRevealDispatch(t *testing.T) {
+	repo := newRevealRepo(time.Hour)
+	s := newTestService(t, repo, fixedOutcomes{"2": 60})
+	type event struct {
+		msisdn, name string
+		data         interface{}
+	}
+	var mu sync.Mutex
+	var events []event
+	ConfigureSocketEmitter(func(msisdn, name string, data interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event{msisdn, name, data})
+	})
+	t.Cleanup(func() { ConfigureSocketEmitter(nil) })
+
+	due := placeRevealBet(t, s, repo, "web").Reveal.Reference
+	later := placeRevealBet(t, s, repo, "app").Reveal.Reference
+	repo.setRevealAt(due, time.Now().Add(-time.Millisecond))
+
+	s.dispatchReveals(context.Background())
+	s.dispatchReveals(context.Background())
+	if len(events) != 1 {
+		t.Fatalf("events = %+v, want one for the due reveal", events)
+	}
+	e := events[0]
+	reveal, ok := e.data.(BetReveal)
+	if e.msisdn != testMsisdn || e.name != EventBetResult || !ok || reveal.Reference != due ||
+		reveal.Status != RevealRevealed || reveal.GameResult == nil || reveal.GameResult.WinAmount != 60 {
+		t.Errorf("event = %+v, want %s's revealed win", e, due)
+	}
+	if repo.reveals[later].sent {
+		t.Errorf("reveal %s dispatched before its time", later)
+	}
+}
+
+// TestRevealHoldFailure shows a delayed bet's outcome at once when its
+// reveal cannot be stored
+func TestRevealHoldFailure(t *testing.T) {
+	repo := newRevealRepo(3 * time.Second)
+	repo.createErr = errors.New("bet_reveals unavailable")
+	s := newTestService(t, repo, fixedOutcomes{"2": 60})
+
+	result := placeRevealBet(t, s, repo, "web")
+	if result.Reveal != nil || result.GameResult.WinAmount != 60 {
+		t.Errorf("result = %+v, want the win at once", result)
+	}
+	if _, err := json.Marshal(result); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reversal is the outcome of a settle_reversal notification
+type Reversal struct {
+	ReversalReference string  `json:"reversal_reference"`
+	TransactionID     string  `json:"transaction_id"`
+	Msisdn            string  `json:"msisdn"`
+	Amount            float64 `json:"amount"`
+	ClawedBack        float64 `json:"clawed_back"`
+	Debt              float64 `json:"debt"`
+	BetReference      string  `json:"bet_reference,omitempty"`
+	BetResult         string  `json:"bet_result,omitempty"`
+	BetWinAmount      float64 `json:"bet_win_amount,omitempty"`
+	Duplicate         bool    `json:"duplicate"`
+}
+
+// ReverseDeposit claws back a deposit M-Pesa has reversed. Repeated
+// notifications return the first reversal with Duplicate set and change
+// nothing. Policy for the bet the deposit paid for: the stake is clawed back
+// whatever the result. A win has already been paid out and is not recovered
+// automatically; it is kept on the reversal and logged for manual review.
+// Returns database.ErrReversalNotFound for unknown or unsettled deposits.
+func (s *LuckyNumberService) ReverseDeposit(cb models.ReversalCallback) (Reversal, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return Reversal{}, fmt.Errorf("service or database not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	row, applied, err := s.db.ReverseDeposit(ctx, string(cb.TransactionID), string(cb.ReversalReference), cb.Description, limits.ReversalAllowNegative)
+	if err != nil {
+		return Reversal{}, err
+	}
+
+	r := Reversal{
+		ReversalReference: utils.ToString(row["reversal_reference"]),
+		TransactionID:     utils.ToString(row["transaction_id"]),
+		Msisdn:            utils.ToString(row["msisdn"]),
+		Amount:            utils.ToFloat64(row["amount"]),
+		ClawedBack:        utils.ToFloat64(row["clawed_back"]),
+		Debt:              utils.ToFloat64(row["debt"]),
+		BetReference:      utils.ToString(row["bet_reference"]),
+		BetResult:         utils.ToString(row["bet_result"]),
+		BetWinAmount:      utils.ToFloat64(row["bet_win_amount"]),
+		Duplicate:         !applied,
+	}
+	if !applied {
+		logrus.Infof("reversal %s: transaction %s already reversed", cb.ReversalReference, r.TransactionID)
+		return r, nil
+	}
+
+	logrus.Infof("reversal %s: clawed back Ksh.%.2f of Ksh.%.2f from %s (debt Ksh.%.2f)",
+		r.ReversalReference, r.ClawedBack, r.Amount, r.Msisdn, r.Debt)
+	if r.BetWinAmount > 0 {
+		logrus.WithFields(logrus.Fields{"bet": r.BetReference, "win_amount": r.BetWinAmount}).
+			Warnf("reversal %s: reversed deposit funded a winning bet; payout needs manual review", r.ReversalReference)
+	}
+
+	if _, err := s.db.ReverseKPIDeposit(ctx, r.TransactionID, r.Amount); err != nil {
+		logrus.Errorf("reversal %s: kpi update failed: %v", r.ReversalReference, err)
+	}
+
+	message := s.renderMessage(ctx, TemplateReversal, s.playerLanguage(ctx, r.Msisdn), map[string]string{
+		"transaction_id": r.TransactionID,
+		"amount":         fmt.Sprintf("%.2f", r.Amount),
+		"balance":        fmt.Sprintf("%.2f", utils.ToFloat64(row["balance"])),
+		"debt":           fmt.Sprintf("%.2f", r.Debt),
+	})
+	if err := s.sendsms(r.Msisdn, message); err != nil {
+		logrus.Errorf("reversal %s: sms to %s failed: %v", r.ReversalReference, r.Msisdn, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"math"
+	"testing"
+)
+
+// memDeposit is one settled row of deposit_requests
+type memDeposit struct {
+	Reference, Msisdn string
+	Amount            float64
+	Status            status.DepositStatus
+}
+
+// reversalRepo mirrors ReverseDeposit's transaction over a memRepo
+type reversalRepo struct {
+	*memRepo
+	deposits     map[string]*memDeposit // by transaction id
+	reversals    map[string]map[string]interface{}
+	debts        map[string]float64
+	betsReversed map[string]bool
+}
+
+func newReversalRepo() *reversalRepo {
+	return &reversalRepo{
+		memRepo:      newMemRepo(),
+		deposits:     map[string]*memDeposit{},
+		reversals:    map[string]map[string]interface{}{},
+		debts:        map[string]float64{},
+		betsReversed: map[string]bool{},
+	}
+}
+
+func (r *reversalRepo) ReverseDeposit(ctx context.Context, transactionID, reversalReference, description string, allowNegative bool) (map[string]interface{}, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d := r.deposits[transactionID]
+	if d == nil {
+		return nil, false, database.ErrReversalNotFound
+	}
+	for _, rev := range r.reversals {
+		if rev["transaction_id"] == transactionID || rev["reversal_reference"] == reversalReference {
+			return rev, false, nil
+		}
+	}
+	p := r.players[d.Msisdn]
+	clawback := d.Amount
+	if !allowNegative {
+		clawback = math.Min(d.Amount, math.Max(p.Balance, 0))
+	}
+	debt := d.Amount - clawback
+	p.Balance -= clawback
+	r.debts[d.Msisdn] += debt
+	d.Status = status.DepositReversed
+
+	row := map[string]interface{}{
+		"reversal_reference": reversalReference, "transaction_id": transactionID, "msisdn": d.Msisdn,
+		"amount": d.Amount, "clawed_back": clawback, "debt": debt, "bet_reference": d.Reference,
+	}
+	if bet := r.bets[d.Reference]; bet != nil {
+		r.betsReversed[d.Reference] = true
+		row["bet_result"] = string(bet.Status)
+		row["bet_win_amount"] = bet.WinAmount
+	}
+	r.reversals[reversalReference] = row
+
+	out := map[string]interface{}{"balance": p.Balance}
+	for k, v := range row {
+		out[k] = v
+	}
+	return out, true, nil
+}
+
+func (r *reversalRepo) ReverseKPIDeposit(ctx context.Context, transactionID string, mvalue float64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.kpi.Deposits -= mvalue
+	return 1, nil
+}
+
+// deposit seeds a settled deposit of amount for msisdn that paid for a bet
+// with the given result and win
+func (r *reversalRepo) deposit(transactionID, reference, msisdn string, amount float64, result status.ResultStatus, win float64) {
+	r.deposits[transactionID] = &memDeposit{Reference: reference, Msisdn: msisdn, Amount: amount, Status: status.DepositSuccess}
+	r.bets[reference] = &memBet{Msisdn: msisdn, Amount: amount, Status: result, WinAmount: win}
+}
+
+func reversalCallback(transactionID, reversalReference string) models.ReversalCallback {
+	return models.ReversalCallback{
+		TransactionID:     models.FlexString(transactionID),
+		ReversalReference: models.FlexString(reversalReference),
+		Description:       "customer dispute",
+	}
+}
+
+func TestReverseDepositLostBet(t *testing.T) {
+	repo := newReversalRepo()
+	repo.addPlayer(testMsisdn, 500)
+	repo.deposit("TX1", "REF1", testMsisdn, 100, status.ResultLoss, 0)
+	s := newTestService(t, repo, nil)
+
+	r, err := s.ReverseDeposit(reversalCallback("TX1", "RV1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Duplicate || r.ClawedBack != 100 || r.Debt != 0 {
+		t.Errorf("reversal = %+v, want Ksh.100 clawed back and no debt", r)
+	}
+	if got := repo.player(testMsisdn).Balance; got != 400 {
+		t.Errorf("balance = %v, want 400", got)
+	}
+	if !repo.betsReversed["REF1"] || repo.deposits["TX1"].Status != status.DepositReversed {
+		t.Error("bet and deposit should both be marked reversed")
+	}
+	if repo.kpi.Deposits != -100 {
+		t.Errorf("kpi deposits = %v, want -100", repo.kpi.Deposits)
+	}
+}
+
+func TestReverseDepositWonBetKeepsPayout(t *testing.T) {
+	repo := newReversalRepo()
+	repo.addPlayer(testMsisdn, 2000)
+	repo.deposit("TX1", "REF1", testMsisdn, 100, status.ResultWin, 1500)
+	s := newTestService(t, repo, nil)
+
+	r, err := s.ReverseDeposit(reversalCallback("TX1", "RV1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the stake comes back; the paid win is recorded for review
+	if r.ClawedBack != 100 || r.BetWinAmount != 1500 || r.BetResult != string(status.ResultWin) {
+		t.Errorf("reversal = %+v, want the stake clawed back and the win recorded", r)
+	}
+	if got := repo.player(testMsisdn).Balance; got != 1900 {
+		t.Errorf("balance = %v, want 1900", got)
+	}
+}
+
+func TestReverseDepositClampsToZero(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		allowNegative bool
+		clawed, debt  float64
+		balance       float64
+	}{
+		{"clamped", false, 30, 70, 0},
+		{"negative", true, 100, 0, -70},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			saved := limits.ReversalAllowNegative
+			limits.ReversalAllowNegative = tc.allowNegative
+			t.Cleanup(func() { limits.ReversalAllowNegative = saved })
+
+			repo := newReversalRepo()
+			repo.addPlayer(testMsisdn, 30)
+			repo.deposit("TX1", "REF1", testMsisdn, 100, status.ResultLoss, 0)
+			s := newTestService(t, repo, nil)
+
+			r, err := s.ReverseDeposit(reversalCallback("TX1", "RV1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.ClawedBack != tc.clawed || r.Debt != tc.debt {
+				t.Errorf("clawed back %v with debt %v, want %v and %v", r.ClawedBack, r.Debt, tc.clawed, tc.debt)
+			}
+			if got := repo.player(testMsisdn).Balance; got != tc.balance {
+				t.Errorf("balance = %v, want %v", got, tc.balance)
+			}
+			if repo.debts[testMsisdn] != tc.debt {
+				t.Errorf("player debt = %v, want %v", repo.debts[testMsisdn], tc.debt)
+			}
+		})
+	}
+}
+
+func TestReverseDepositDuplicate(t *testing.T) {
+	repo := newReversalRepo()
+	repo.addPlayer(testMsisdn, 500)
+	repo.deposit("TX1", "REF1", testMsisdn, 100, status.ResultLoss, 0)
+	s := newTestService(t, repo, nil)
+
+	first, err := s.ReverseDeposit(reversalCallback("TX1", "RV1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cb := range []models.ReversalCallback{reversalCallback("TX1", "RV1"), reversalCallback("TX1", "RV2")} {
+		again, err := s.ReverseDeposit(cb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !again.Duplicate || again.ReversalReference != first.ReversalReference {
+			t.Errorf("repeat %s = %+v, want the first reversal marked duplicate", cb.ReversalReference, again)
+		}
+	}
+	if got := repo.player(testMsisdn).Balance; got != 400 {
+		t.Errorf("balance = %v, want a single claw-back to 400", got)
+	}
+	if repo.kpi.Deposits != -100 {
+		t.Errorf("kpi deposits = %v, want a single -100", repo.kpi.Deposits)
+	}
+}
+
+func TestReverseDepositUnknown(t *testing.T) {
+	s := newTestService(t, newReversalRepo(), nil)
+	if _, err := s.ReverseDeposit(reversalCallback("NOPE", "RV1")); !errors.Is(err, database.ErrReversalNotFound) {
+		t.Errorf("unknown transaction = %v, want ErrReversalNotFound", err)
+	}
+}
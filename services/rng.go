@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/big"
+	mrand "math/rand/v2"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RNG is the randomness the box generator draws from. Real and demo bets
+// use cryptoRNG; the RTP simulation runs the same generator on a seeded
+// source so a run can be repeated.
+type RNG interface {
+	Float64() float64 // [0, 1)
+	IntN(n int) int   // [0, n)
+}
+
+// cryptoRNG draws from crypto/rand
+type cryptoRNG struct{}
+
+func (cryptoRNG) Float64() float64 { return cryptoRandFloat() }
+func (cryptoRNG) IntN(n int) int   { return cryptoRandIndex(n) }
+
+// seededRNG returns a reproducible RNG for seed
+func seededRNG(seed uint64) RNG {
+	return mrand.New(mrand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+}
+
+type rngKey struct{}
+
+// simulated is the RNG and logger of a simulated bet
+type simulated struct {
+	rng RNG
+	log logrus.FieldLogger
+}
+
+// withSimulation returns a context under which the box generator draws
+// from rng and does not log, as a simulation plays thousands of bets
+func withSimulation(ctx context.Context, rng RNG) context.Context {
+	quiet := logrus.New()
+	quiet.SetOutput(io.Discard)
+	return context.WithValue(ctx, rngKey{}, simulated{rng: rng, log: quiet})
+}
+
+// rngFrom returns the RNG of ctx, crypto/rand unless ctx comes from
+// withSimulation
+func rngFrom(ctx context.Context) RNG {
+	if sim, ok := ctx.Value(rngKey{}).(simulated); ok {
+		return sim.rng
+	}
+	return cryptoRNG{}
+}
+
+// gameLog returns the box generator's logger for ctx
+func gameLog(ctx context.Context) logrus.FieldLogger {
+	if sim, ok := ctx.Value(rngKey{}).(simulated); ok {
+		return sim.log
+	}
+	return logrus.StandardLogger()
+}
+
+// randInt returns an int in [min, max), min when the range is empty
+func randInt(r RNG, min, max int) int {
+	if max <= min {
+		return min
+	}
+	return min + r.IntN(max-min)
+}
+
+// randFloatRange returns a float in [min, max)
+func randFloatRange(r RNG, min, max float64) float64 {
+	return min + r.Float64()*(max-min)
+}
+
+// randUniqueInts returns count distinct ints from [min, max) in random order
+func randUniqueInts(r RNG, min, max, count int) []int {
+	arr := []int{}
+	for i := min; i < max; i++ {
+		arr = append(arr, i)
+	}
+
+	out := []int{}
+	for len(out) < count && len(arr) > 0 {
+		idx := r.IntN(len(arr))
+		out = append(out, arr[idx])
+		arr = append(arr[:idx], arr[idx+1:]...)
+	}
+	return out
+}
+
+// randShuffle shuffles numbers in place
+func randShuffle[T any](r RNG, numbers []T) {
+	for i := len(numbers) - 1; i > 0; i-- {
+		j := r.IntN(i + 1)
+		numbers[i], numbers[j] = numbers[j], numbers[i]
+	}
+}
+
+func cryptoRandSample(arr []int, k int) []int {
+	if k > len(arr) {
+		k = len(arr)
+	}
+
+	out := []int{}
+	tmp := append([]int{}, arr...)
+
+	for i := 0; i < k; i++ {
+		idx := cryptoRandInt(0, len(tmp))
+		out = append(out, tmp[idx])
+		tmp = append(tmp[:idx], tmp[idx+1:]...)
+	}
+
+	return out
+}
+
+func cryptoRandFloatRange(min, max float64) float64 {
+	return min + cryptoRandFloat()*(max-min)
+}
+
+func cryptoRandFloat() float64 {
+	b := make([]byte, 8)
+	rand.Read(b)
+	u := binary.LittleEndian.Uint64(b)
+	return float64(u) / float64(math.MaxUint64)
+}
+
+func cryptoRandUniqueInts(min, max, count int) []int {
+	arr := []int{}
+	for i := min; i < max; i++ {
+		arr = append(arr, i)
+	}
+
+	out := []int{}
+	for len(out) < count && len(arr) > 0 {
+		idx := cryptoRandInt(0, len(arr))
+		out = append(out, arr[idx])
+		arr = append(arr[:idx], arr[idx+1:]...)
+	}
+	return out
+}
+
+func cryptoRandInt(min, max int) int {
+	if max <= min {
+		return min
+	}
+	nBig, _ := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	return int(nBig.Int64()) + min
+}
+
+func cryptoRandIndex2(n int) int {
+	b := make([]byte, 1)
+	_, err := rand.Read(b)
+	if err != nil {
+		panic(err)
+	}
+	return int(b[0]) % n
+}
+
+func cryptoRandIndex(length int) int {
+	if length <= 0 {
+		return 0
+	}
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(length)))
+	if err != nil {
+		panic(err) // handle error properly in real code
+	}
+	return int(n.Int64())
+}
+
+func CryptoShuffle[T any](numbers []T) {
+	n := len(numbers)
+	for i := n - 1; i > 0; i-- {
+		// Generate a random index j ∈ [0, i]
+		jBig, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			panic(err)
+		}
+		j := int(jBig.Int64())
+
+		// Swap numbers[i] and numbers[j]
+		numbers[i], numbers[j] = numbers[j], numbers[i]
+	}
+}
+
+// func CryptoShuffle[T any](numbers []T) {
+// 	n := len(numbers)
+// 	for i := n - 1; i > 0; i-- {
+// 		jBig, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+// 		if err != nil {
+// 			panic(err) // handle error properly
+// 		}
+// 		j := int(jBig.Int64())
+// 		numbers[i], numbers[j] = numbers[j], numbers[i]
+// 	}
+// }
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Round actors: who moved a round to its state
+const (
+	actorPlayer = "player"
+	actorMpesa  = "mpesa" // deposit callbacks
+	actorWallet = "wallet"
+	actorGame   = "game"
+	actorPayout = "payout"
+)
+
+var (
+	ErrRoundNotFound = errors.New("round not found")
+	// ErrRoundPlayed means a bet already holds the round's reference: the
+	// round was played by an earlier or concurrent attempt
+	ErrRoundPlayed = errors.New("round already played")
+)
+
+// RoundEvent is one state change of a round
+type RoundEvent struct {
+	From   string    `json:"from,omitempty" example:"played"`
+	To     string    `json:"to" example:"settled"`
+	Actor  string    `json:"actor" example:"game"`
+	Detail string    `json:"detail,omitempty"`
+	At     time.Time `json:"at"`
+}
+
+// Round follows one bet or deposit reference from the STK push or stake
+// debit to the payout
+type Round struct {
+	Reference   string       `json:"reference"`
+	Msisdn      string       `json:"msisdn"`
+	GameCatID   string       `json:"game_cat_id,omitempty"`
+	Amount      float64      `json:"amount"`
+	State       string       `json:"state" example:"paid"`
+	DateCreated time.Time    `json:"date_created"`
+	DateUpdated time.Time    `json:"date_updated"`
+	Timeline    []RoundEvent `json:"timeline"`
+}
+
+// GetRound returns the round of reference with its full timeline
+func (s *LuckyNumberService) GetRound(reference string) (Round, error) {
+	if s == nil || s.db == nil {
+		return Round{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	row, events, err := s.db.GetRound(ctx, reference)
+	if err != nil {
+		return Round{}, err
+	}
+	if row == nil {
+		return Round{}, ErrRoundNotFound
+	}
+
+	round := Round{
+		Reference: utils.ToString(row["reference"]),
+		Msisdn:    utils.ToString(row["msisdn"]),
+		GameCatID: utils.ToString(row["game_cat_id"]),
+		Amount:    utils.ToFloat64(row["amount"]),
+		State:     utils.ToString(row["state"]),
+		Timeline:  make([]RoundEvent, 0, len(events)),
+	}
+	round.DateCreated, _ = row["date_created"].(time.Time)
+	round.DateUpdated, _ = row["date_updated"].(time.Time)
+	for _, e := range events {
+		event := RoundEvent{
+			From:   utils.ToString(e["from_state"]),
+			To:     utils.ToString(e["to_state"]),
+			Actor:  utils.ToString(e["actor"]),
+			Detail: utils.ToString(e["detail"]),
+		}
+		event.At, _ = e["date_created"].(time.Time)
+		round.Timeline = append(round.Timeline, event)
+	}
+	return round, nil
+}
+
+// openRound opens the round of reference in state created
+func (s *LuckyNumberService) openRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	err := s.db.CreateRound(ctx, reference, msisdn, gameCatID, amount, actor, detail)
+	if err != nil {
+		logrus.Errorf("round %s: %v", reference, err)
+	}
+	return err
+}
+
+// advanceRound moves the round of reference to state to. A move the state
+// machine refuses means the step ran twice or out of order; it is logged
+// as an error and returned.
+func (s *LuckyNumberService) advanceRound(ctx context.Context, reference, to, actor, detail string) error {
+	err := s.db.TransitionRound(ctx, reference, to, actor, detail)
+	if err != nil {
+		logrus.Errorf("round %s: %v", reference, err)
+	}
+	return err
+}
+
+// fundRound moves the round of reference to funded, opening it first when
+// it has none: a paybill deposit, or an STK push sent before rounds were
+// recorded
+func (s *LuckyNumberService) fundRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	err := s.db.TransitionRound(ctx, reference, database.RoundFunded, actor, detail)
+	if errors.Is(err, database.ErrRoundNotFound) {
+		if err = s.db.CreateRound(ctx, reference, msisdn, gameCatID, amount, actor, "opened on funding"); err == nil {
+			err = s.db.TransitionRound(ctx, reference, database.RoundFunded, actor, detail)
+		}
+	}
+	if err != nil {
+		logrus.Errorf("round %s: %v", reference, err)
+	}
+	return err
+}
+
+// failRound marks the round of reference failed with cause. A refused
+// transition is not a failure of the round: the step that hit it ran twice
+// and the round itself is fine, as is a round another attempt played. Nor
+// is an error after the round was paid.
+func (s *LuckyNumberService) failRound(ctx context.Context, reference, actor string, cause error) {
+	if errors.Is(cause, database.ErrInvalidRoundTransition) || errors.Is(cause, database.ErrRoundExists) || errors.Is(cause, ErrRoundPlayed) {
+		return
+	}
+	err := s.db.TransitionRound(ctx, reference, database.RoundFailed, actor, cause.Error())
+	switch {
+	case errors.Is(err, database.ErrInvalidRoundTransition):
+		logrus.Warnf("round %s: not failed after %v: %v", reference, cause, err)
+	case err != nil:
+		logrus.Errorf("round %s: %v", reference, err)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// timelineRepo records each round's events so GetRound can return them
+type timelineRepo struct {
+	*memRepo
+	events map[string][]map[string]interface{}
+}
+
+func newTimelineRepo() *timelineRepo {
+	return &timelineRepo{memRepo: newMemRepo(), events: map[string][]map[string]interface{}{}}
+}
+
+func (r *timelineRepo) CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	if err := r.memRepo.CreateRound(ctx, reference, msisdn, gameCatID, amount, actor, detail); err != nil {
+		return err
+	}
+	r.record(reference, "", database.RoundCreated, actor, detail)
+	return nil
+}
+
+func (r *timelineRepo) TransitionRound(ctx context.Context, reference, to, actor, detail string) error {
+	r.mu.Lock()
+	from := r.rounds[reference]
+	r.mu.Unlock()
+	if err := r.memRepo.TransitionRound(ctx, reference, to, actor, detail); err != nil {
+		return err
+	}
+	r.record(reference, from, to, actor, detail)
+	return nil
+}
+
+func (r *timelineRepo) record(reference, from, to, actor, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[reference] = append(r.events[reference], map[string]interface{}{
+		"from_state": from, "to_state": to, "actor": actor, "detail": detail,
+	})
+}
+
+func (r *timelineRepo) GetRound(ctx context.Context, reference string) (map[string]interface{}, []map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.rounds[reference]
+	if !ok {
+		return nil, nil, nil
+	}
+	return map[string]interface{}{"reference": reference, "msisdn": testMsisdn, "game_cat_id": "1", "state": state}, r.events[reference], nil
+}
+
+// timeline renders round's events as "to/actor" steps
+func timeline(round Round) string {
+	steps := make([]string, len(round.Timeline))
+	for i, e := range round.Timeline {
+		steps[i] = e.To + "/" + e.Actor
+	}
+	return strings.Join(steps, " ")
+}
+
+func TestRoundTimelines(t *testing.T) {
+	cases := []struct {
+		name     string
+		outcomes fixedOutcomes
+		state    string
+		want     string
+	}{
+		{"loss", fixedOutcomes{"1": 0, "2": 300}, database.RoundSettled,
+			"created/player funded/wallet played/game settled/game"},
+		{"win", fixedOutcomes{"1": 200, "2": 0}, database.RoundPaid,
+			"created/player funded/wallet played/game settled/game paid/payout"},
+	}
+	for _, tc := range cases {
+		repo := newTimelineRepo()
+		repo.addPlayer(testMsisdn, 100)
+		s := newTestService(t, repo, tc.outcomes)
+		ref := placeTestBet(t, s, repo.memRepo, 50, "1").GameResult.GameID
+
+		round, err := s.GetRound(ref)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if round.State != tc.state || timeline(round) != tc.want {
+			t.Errorf("%s round = %s [%s], want %s [%s]", tc.name, round.State, timeline(round), tc.state, tc.want)
+		}
+		for i, e := range round.Timeline[1:] {
+			if e.From != round.Timeline[i].To {
+				t.Errorf("%s step %d moved from %s, want %s", tc.name, i+1, e.From, round.Timeline[i].To)
+			}
+		}
+	}
+
+	s := newTestService(t, newTimelineRepo(), nil)
+	if _, err := s.GetRound("NOPE"); !errors.Is(err, ErrRoundNotFound) {
+		t.Errorf("unknown reference = %v, want ErrRoundNotFound", err)
+	}
+}
+
+func TestRoundRefusesReplayedSteps(t *testing.T) {
+	repo := newTimelineRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 0})
+	ref := placeTestBet(t, s, repo.memRepo, 50, "1").GameResult.GameID
+	ctx := context.Background()
+
+	if err := s.advanceRound(ctx, ref, database.RoundSettled, actorGame, "again"); !errors.Is(err, database.ErrInvalidRoundTransition) {
+		t.Errorf("settling twice = %v, want ErrInvalidRoundTransition", err)
+	}
+	if err := s.openRound(ctx, ref, testMsisdn, "1", 50, actorPlayer, "again"); !errors.Is(err, database.ErrRoundExists) {
+		t.Errorf("reopening = %v, want ErrRoundExists", err)
+	}
+	// A replayed step is not a failure of the round
+	s.failRound(ctx, ref, actorGame, fmt.Errorf("replay: %w", database.ErrInvalidRoundTransition))
+	if repo.rounds[ref] != database.RoundSettled || len(repo.events[ref]) != 4 {
+		t.Errorf("round %s with %d events after refused steps, want settled with 4", repo.rounds[ref], len(repo.events[ref]))
+	}
+
+	s.failRound(ctx, ref, actorPayout, errors.New("b2c rejected"))
+	if repo.rounds[ref] != database.RoundFailed {
+		t.Errorf("round = %s after a real failure, want failed", repo.rounds[ref])
+	}
+}
+
+// raceRepo holds every CreateBet until parties have reached it, so the
+// processors of a round meet at the insert that decides between them
+type raceRepo struct {
+	*memRepo
+	arrived sync.WaitGroup
+}
+
+func (r *raceRepo) CreateBet(ctx context.Context, msisdn, selectedChoice string, amount float64, result, reference string, betStatus status.ResultStatus, betType, gameCatID, gameName, channel string) (bool, error) {
+	r.arrived.Done()
+	r.arrived.Wait()
+	return r.memRepo.CreateBet(ctx, msisdn, selectedChoice, amount, result, reference, betStatus, betType, gameCatID, gameName, channel)
+}
+
+func TestRoundPlayedOnceInParallel(t *testing.T) {
+	repo := &raceRepo{memRepo: newMemRepo()}
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40})
+	ctx := context.Background()
+	const ref = "BET_TWICE"
+	if err := s.fundRound(ctx, ref, testMsisdn, "1", 20, actorMpesa, "deposit QK1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both share one SMS outbox: only the processor that plays may add to it
+	const processors = 2
+	repo.arrived.Add(processors)
+	smsCtx, held := holdResultSMS(ctx)
+	errs := make([]error, processors)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user, _ := repo.CheckUser(ctx, testMsisdn)
+			_, errs[i] = s.playGame(smsCtx, nil, "1", user, testMsisdn, 20, "1", ref, "normal", "ussd", "*463#", "PawaBox")
+		}(i)
+	}
+	wg.Wait()
+
+	played := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			played++
+		case !errors.Is(err, ErrRoundPlayed):
+			t.Errorf("the other processor = %v, want ErrRoundPlayed", err)
+		}
+	}
+	if played != 1 {
+		t.Fatalf("errors = %v, want exactly one processor to play the round", errs)
+	}
+	if len(repo.bets) != 1 || repo.bets[ref].Status != status.ResultWin {
+		t.Errorf("bets = %v, want one, won", repo.bets)
+	}
+	if p := repo.player(testMsisdn); p.Payout != 40 || p.TotalBets != 20 || p.Frequency != 1 || len(repo.queued) != 1 {
+		t.Errorf("player = %+v with %d payouts queued, want the 20 staked and the 40 won once", p, len(repo.queued))
+	}
+	if len(*held) != 1 {
+		t.Errorf("result messages = %q, want one", *held)
+	}
+	if repo.rounds[ref] != database.RoundPaid {
+		t.Errorf("round = %s, want paid and not failed by the loser", repo.rounds[ref])
+	}
+}
+
+func TestDepositRoundNotReplayed(t *testing.T) {
+	repo := newMaintenanceRepo()
+	repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40})
+	repo.deposits["REF1"] = map[string]interface{}{
+		"msisdn": testMsisdn, "amount": 20.0, "game_cat_id": "1", "selected_box": "1",
+		"channel": "ussd", "ussd": "*463#", "game": "PawaBox",
+	}
+	cb := models.SettlementCallback{TransactionID: "QK1", Reference: "REF1"}
+
+	if err := s.HandleDepositAndGame(cb); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	balance := repo.player(testMsisdn).Balance
+
+	// The reconciliation job settling the same deposit finds the bet
+	if err := s.HandleDepositAndGame(cb); !errors.Is(err, ErrRoundPlayed) {
+		t.Fatalf("second settlement = %v, want ErrRoundPlayed", err)
+	}
+	if err := utils.WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p := repo.player(testMsisdn); p.Balance != balance || p.Payout != 40 || len(repo.bets) != 1 || len(repo.queued) != 1 {
+		t.Errorf("player = %+v with %d bets and %d payouts, want one of each and no second credit", p, len(repo.bets), len(repo.queued))
+	}
+	if repo.rounds["REF1"] != database.RoundPaid {
+		t.Errorf("round = %s, want left paid", repo.rounds["REF1"])
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	maxSimulatedBets    = 100000
+	maxSimulatedPlayers = 10000
+	defaultSimPlayers   = 100
+	simulationTimeout   = 30 * time.Second
+)
+
+var ErrInvalidSimulation = errors.New("invalid simulation")
+
+// RTPSettings are the "PawaBox_KeSettings" columns a simulation can try out.
+// A nil field keeps the live setting.
+type RTPSettings struct {
+	DefaultRTP        *float64 `json:"default_rtp,omitempty"`
+	AdjustmentableRTP *float64 `json:"adjustmentable_rtp,omitempty"`
+	VigPercentage     *float64 `json:"vig_percentage,omitempty"`
+	JackpotPercentage *float64 `json:"jackpot_percentage,omitempty"`
+	MinWinMultiplier  *float64 `json:"min_win_multipier,omitempty"`
+	MaxWinMultiplier  *float64 `json:"max_win_multipier,omitempty"`
+	RTPOverload       *float64 `json:"rtp_overload,omitempty"`
+	MinLossCount      *int     `json:"min_loss_count,omitempty"`
+}
+
+// RTPSimulation describes a simulation run: Bets bets of BetAmount on
+// GameCatID, spread round robin over Players synthetic players, against a
+// basket that starts at Basket. The same Seed replays the same run.
+type RTPSimulation struct {
+	GameCatID   string      `json:"game_cat_id"`
+	Settings    RTPSettings `json:"settings"`
+	MaxExposure *float64    `json:"max_exposure,omitempty"` // else the game's
+	BetAmount   float64     `json:"bet_amount"`
+	Bets        int         `json:"bets"`
+	Players     int         `json:"players"`
+	Basket      float64     `json:"basket"`
+	Seed        uint64      `json:"seed"`
+}
+
+// RTPSimulationResult is what a simulation run paid out. Percentiles are
+// over the wins paid.
+type RTPSimulationResult struct {
+	Seed             uint64             `json:"seed"`
+	Bets             int                `json:"bets"`
+	Staked           float64            `json:"staked"`
+	Paid             float64            `json:"paid"`
+	RTP              float64            `json:"rtp"`        // Paid as a percentage of Staked
+	TargetRTP        float64            `json:"target_rtp"` // default_rtp + adjustmentable_rtp
+	Wins             int                `json:"wins"`
+	WinRate          float64            `json:"win_rate"`
+	ForcedWins       int                `json:"forced_wins"` // bets that took the forced win path
+	ForcedWinRate    float64            `json:"forced_win_rate"`
+	PayoutPercentile map[string]float64 `json:"payout_percentiles"`
+	MaxPayout        float64            `json:"max_payout"`
+	EndBasket        float64            `json:"end_basket"`
+}
+
+// simPlayer is a synthetic player's totals
+type simPlayer struct {
+	totalBets float64
+	payout    float64
+	lostCount int64
+}
+
+// simReader answers the box generator from the simulation: the player
+// being played, the simulated basket, and no awards. Settings and games
+// are passed in, not read.
+type simReader struct {
+	player simPlayer
+	basket float64
+}
+
+func (r simReader) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"msisdn":     msisdn,
+		"total_bets": r.player.totalBets,
+		"payout":     r.player.payout,
+		"lost_count": r.player.lostCount,
+	}, nil
+}
+
+func (r simReader) GetSettings(ctx context.Context) (*database.Settings, error) {
+	return nil, nil
+}
+
+func (r simReader) GetGame(ctx context.Context, catID string) (*database.Game, error) {
+	return nil, nil
+}
+
+func (r simReader) CheckBasketLucky(ctx context.Context) (map[string]interface{}, error) {
+	return map[string]interface{}{"amount": r.basket}, nil
+}
+
+func (r simReader) CheckAwardsLucky(ctx context.Context, winAmount float64, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (r simReader) CheckAwardsLuckyRandom(ctx context.Context, nameInit string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+var _ database.GameReader = simReader{}
+
+// SimulateRTP plays sim with the live settings of sim.GameCatID overlaid by
+// sim.Settings. It only reads the settings and the game; nothing is written.
+func (s *LuckyNumberService) SimulateRTP(sim RTPSimulation) (RTPSimulationResult, error) {
+	if s == nil || s.db == nil {
+		return RTPSimulationResult{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), simulationTimeout)
+	defer cancel()
+
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return RTPSimulationResult{}, err
+	}
+	game, err := s.game(ctx, sim.GameCatID)
+	if err != nil {
+		return RTPSimulationResult{}, err
+	}
+	if game == nil {
+		return RTPSimulationResult{}, ErrUnknownGame
+	}
+	return simulateRTP(ctx, sim, simSettingsFrom(settings, sim.Settings), *game)
+}
+
+// simSettings are the settings a simulation plays with
+type simSettings struct {
+	defaultRTP, adjustmentableRTP, vigPercentage, jackpotPercentage float64
+	minWinMultiplier, maxWinMultiplier, rtpOverload                 float64
+	minLossCount                                                    int
+}
+
+// simSettingsFrom overlays candidate on the live settings
+func simSettingsFrom(live database.Settings, candidate RTPSettings) simSettings {
+	pick := func(v *float64, liveValue float64) float64 {
+		if v != nil {
+			return *v
+		}
+		return liveValue
+	}
+	out := simSettings{
+		defaultRTP:        pick(candidate.DefaultRTP, live.DefaultRTP),
+		adjustmentableRTP: pick(candidate.AdjustmentableRTP, live.AdjustableRTP),
+		vigPercentage:     pick(candidate.VigPercentage, live.VigPercentage),
+		jackpotPercentage: pick(candidate.JackpotPercentage, live.JackpotPercentage),
+		minWinMultiplier:  pick(candidate.MinWinMultiplier, live.MinWinMultiplier),
+		maxWinMultiplier:  pick(candidate.MaxWinMultiplier, live.MaxWinMultiplier),
+		rtpOverload:       pick(candidate.RTPOverload, live.RTPOverload),
+		minLossCount:      live.MinLossCount,
+	}
+	if candidate.MinLossCount != nil {
+		out.minLossCount = *candidate.MinLossCount
+	}
+	return out
+}
+
+// simulateRTP plays sim on game with settings. Each bet is generated and
+// settled as a real one: the day KPI and the MaxWon are taken before the
+// stake, the player and basket the generator reads after it, and the win
+// must pass winStands. Jackpot kitties and awards are not simulated.
+func simulateRTP(ctx context.Context, sim RTPSimulation, settings simSettings, game database.Game) (RTPSimulationResult, error) {
+	if sim.Players <= 0 {
+		sim.Players = defaultSimPlayers
+	}
+	if sim.MaxExposure != nil {
+		game.MaxExposure = *sim.MaxExposure
+	}
+	if err := sim.validate(settings, game); err != nil {
+		return RTPSimulationResult{}, err
+	}
+
+	rng := seededRNG(sim.Seed)
+	ctx = withSimulation(ctx, rng)
+	basketShare := (settings.defaultRTP + settings.adjustmentableRTP) / 100
+
+	players := make([]simPlayer, sim.Players)
+	var kpiBet, kpiPayout float64
+	basket := sim.Basket
+	result := RTPSimulationResult{Seed: sim.Seed, TargetRTP: settings.defaultRTP + settings.adjustmentableRTP}
+	var wins []float64
+
+	for i := 0; i < sim.Bets; i++ {
+		if i%1000 == 0 && ctx.Err() != nil {
+			return RTPSimulationResult{}, ctx.Err()
+		}
+		player := &players[i%len(players)]
+
+		p := GenerateWinAmountsParams{
+			Msisdn:           "sim" + strconv.Itoa(i%len(players)),
+			KPI:              map[string]interface{}{"bet": kpiBet, "payout": kpiPayout, "rtp": database.RTP(kpiPayout, kpiBet)},
+			DefaultRTP:       settings.defaultRTP,
+			AdjustmentRTP:    settings.adjustmentableRTP,
+			PlayerRTP:        database.RTP(player.payout, player.totalBets),
+			BetAmount:        sim.BetAmount,
+			SelectedNumber:   strconv.Itoa(rng.IntN(7) + 1),
+			MinWinMultiplier: settings.minWinMultiplier,
+			MaxWinMultiplier: settings.maxWinMultiplier,
+			MaxExposure:      game.MaxExposure,
+			GameNameInit:     game.NameInit,
+			PlayerLostCount:  player.lostCount,
+			MinLossCount:     randInt(rng, 0, settings.minLossCount) + 1,
+			MaxWon:           ((settings.defaultRTP + settings.jackpotPercentage) / 100) * (player.totalBets + sim.BetAmount - player.payout),
+			VigPercentage:    settings.vigPercentage,
+			RTPOverload:      settings.rtpOverload,
+		}
+		if forcesWin(p.PlayerLostCount, p.MinLossCount) {
+			result.ForcedWins++
+		}
+
+		player.totalBets += sim.BetAmount
+		basket += sim.BetAmount * basketShare
+
+		boxes, err := generateLayout(ctx, simReader{player: *player, basket: basket}, p, []string{p.SelectedNumber})
+		if err != nil {
+			return RTPSimulationResult{}, err
+		}
+		amount := boxes[p.SelectedNumber].Value
+
+		if winStands(amount, settings.defaultRTP, settings.adjustmentableRTP, kpiPayout, kpiBet) {
+			player.payout += amount
+			player.lostCount = 0
+			kpiPayout += amount
+			basket -= amount
+			result.Paid += amount
+			wins = append(wins, amount)
+		} else {
+			player.lostCount++
+		}
+		kpiBet += sim.BetAmount
+		result.Staked += sim.BetAmount
+	}
+
+	result.Bets = sim.Bets
+	result.Wins = len(wins)
+	result.RTP = round2(database.RTP(result.Paid, result.Staked))
+	result.WinRate = round2(float64(result.Wins) / float64(sim.Bets) * 100)
+	result.ForcedWinRate = round2(float64(result.ForcedWins) / float64(sim.Bets) * 100)
+	result.Staked, result.Paid, result.EndBasket = round2(result.Staked), round2(result.Paid), round2(basket)
+	result.PayoutPercentile = payoutPercentiles(wins)
+	if len(wins) > 0 {
+		result.MaxPayout = round2(wins[len(wins)-1])
+	}
+	return result, nil
+}
+
+func (sim RTPSimulation) validate(settings simSettings, game database.Game) error {
+	switch {
+	case sim.Bets <= 0 || sim.Bets > maxSimulatedBets:
+		return fmt.Errorf("%w: bets must be between 1 and %d", ErrInvalidSimulation, maxSimulatedBets)
+	case sim.Players > maxSimulatedPlayers:
+		return fmt.Errorf("%w: players must be at most %d", ErrInvalidSimulation, maxSimulatedPlayers)
+	case sim.BetAmount <= 0:
+		return fmt.Errorf("%w: bet_amount must be positive", ErrInvalidSimulation)
+	case sim.Basket < 0:
+		return fmt.Errorf("%w: basket must not be negative", ErrInvalidSimulation)
+	case game.MaxExposure <= 0:
+		return fmt.Errorf("%w: max_exposure must be positive", ErrInvalidSimulation)
+	case settings.defaultRTP < 0 || settings.adjustmentableRTP < 0:
+		return fmt.Errorf("%w: default_rtp and adjustmentable_rtp must not be negative", ErrInvalidSimulation)
+	case settings.minWinMultiplier <= 0 || settings.maxWinMultiplier < settings.minWinMultiplier:
+		return fmt.Errorf("%w: min_win_multipier must be positive and at most max_win_multipier", ErrInvalidSimulation)
+	case settings.minLossCount < 0:
+		return fmt.Errorf("%w: min_loss_count must not be negative", ErrInvalidSimulation)
+	}
+	return nil
+}
+
+// payoutPercentiles returns the p50, p90, p99 of wins and sorts wins
+func payoutPercentiles(wins []float64) map[string]float64 {
+	sort.Float64s(wins)
+	out := make(map[string]float64, 3)
+	for _, p := range []int{50, 90, 99} {
+		v := 0.0
+		if len(wins) > 0 {
+			idx := int(math.Ceil(float64(p)/100*float64(len(wins)))) - 1
+			v = round2(wins[max(idx, 0)])
+		}
+		out["p"+strconv.Itoa(p)] = v
+	}
+	return out
+}
+
+// round2 rounds to the cent
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
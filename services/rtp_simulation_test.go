@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func simulate(t *testing.T, repo *memRepo, sim RTPSimulation) RTPSimulationResult {
+	t.Helper()
+	result, err := newTestService(t, repo, nil).SimulateRTP(sim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestSimulateRTPMeetsTarget(t *testing.T) {
+	for _, rtp := range []float64{60, 85, 95} {
+		rtp := rtp
+		result := simulate(t, newMemRepo(), RTPSimulation{GameCatID: "1", Settings: RTPSettings{DefaultRTP: &rtp},
+			BetAmount: 50, Bets: 10000, Basket: 100000, Seed: 42})
+		if result.TargetRTP != rtp+5 {
+			t.Errorf("default_rtp %v: target = %v, want %v with adjustmentable_rtp", rtp, result.TargetRTP, rtp+5)
+		}
+		if math.Abs(result.RTP-result.TargetRTP) > 1.5 {
+			t.Errorf("default_rtp %v: simulated RTP %v, want within 1.5 of %v", rtp, result.RTP, result.TargetRTP)
+		}
+		if result.Wins == 0 || result.ForcedWins == 0 || result.Staked != 500000 {
+			t.Errorf("default_rtp %v: %+v, want wins, forced wins and 500000 staked", rtp, result)
+		}
+		p := result.PayoutPercentile
+		if !(p["p50"] <= p["p90"] && p["p90"] <= p["p99"] && p["p99"] <= result.MaxPayout) {
+			t.Errorf("default_rtp %v: percentiles %v out of order or above max %v", rtp, p, result.MaxPayout)
+		}
+	}
+}
+
+func TestSimulateRTPSeedReplays(t *testing.T) {
+	sim := RTPSimulation{GameCatID: "1", BetAmount: 20, Bets: 2000, Players: 10, Basket: 50000, Seed: 7}
+	first := simulate(t, newMemRepo(), sim)
+	if again := simulate(t, newMemRepo(), sim); !reflect.DeepEqual(first, again) {
+		t.Errorf("seed 7 replayed as %+v, want %+v", again, first)
+	}
+	sim.Seed = 8
+	if other := simulate(t, newMemRepo(), sim); reflect.DeepEqual(first, other) {
+		t.Error("seeds 7 and 8 gave the same run")
+	}
+}
+
+func TestSimulateRTPWritesNothing(t *testing.T) {
+	repo := newMemRepo()
+	basket := repo.basket
+	simulate(t, repo, RTPSimulation{GameCatID: "1", BetAmount: 50, Bets: 500, Seed: 1})
+	if len(repo.players) != 0 || len(repo.bets) != 0 || repo.basket != basket {
+		t.Errorf("simulation wrote %d players, %d bets and moved the basket to %v", len(repo.players), len(repo.bets), repo.basket)
+	}
+}
+
+func TestSimulateRTPRejects(t *testing.T) {
+	zero, negative, low := 0.0, -1.0, 0.5
+	cases := map[string]RTPSimulation{
+		"no bets":          {GameCatID: "1", BetAmount: 50},
+		"too many bets":    {GameCatID: "1", BetAmount: 50, Bets: maxSimulatedBets + 1},
+		"too many players": {GameCatID: "1", BetAmount: 50, Bets: 10, Players: maxSimulatedPlayers + 1},
+		"no stake":         {GameCatID: "1", Bets: 10},
+		"negative basket":  {GameCatID: "1", BetAmount: 50, Bets: 10, Basket: -1},
+		"no exposure":      {GameCatID: "1", BetAmount: 50, Bets: 10, MaxExposure: &zero},
+		"negative rtp":     {GameCatID: "1", BetAmount: 50, Bets: 10, Settings: RTPSettings{DefaultRTP: &negative}},
+		"multipliers":      {GameCatID: "1", BetAmount: 50, Bets: 10, Settings: RTPSettings{MaxWinMultiplier: &low}},
+	}
+	s := newTestService(t, newMemRepo(), nil)
+	for name, sim := range cases {
+		if _, err := s.SimulateRTP(sim); !errors.Is(err, ErrInvalidSimulation) {
+			t.Errorf("%s: err = %v, want ErrInvalidSimulation", name, err)
+		}
+	}
+	if _, err := s.SimulateRTP(RTPSimulation{GameCatID: "99", BetAmount: 50, Bets: 10}); !errors.Is(err, ErrUnknownGame) {
+		t.Errorf("unknown game: err = %v, want ErrUnknownGame", err)
+	}
+}
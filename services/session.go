@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// maxFingerprintLen bounds the client-supplied device fingerprint kept
+const maxFingerprintLen = 200
+
+// PlayerSession is a live login of a player
+type PlayerSession struct {
+	ID                int64     `json:"id" example:"42"`
+	Msisdn            string    `json:"msisdn"`
+	DeviceFingerprint string    `json:"device_fingerprint"`
+	Refreshable       bool      `json:"refreshable"` // holds a refresh token, so it outlives its access token
+	CreatedAt         time.Time `json:"created_at"`
+	LastSeen          time.Time `json:"last_seen"` // updated every limits.session_touch_interval at most
+	ExpiresAt         time.Time `json:"expires_at"`
+	Current           bool      `json:"current,omitempty"` // the session making the request
+}
+
+// StartSession opens a session for msisdn, who has just verified a login
+// OTP, and returns its access token. deviceID is that of the refresh token
+// the caller will be issued, if any. With limits.max_sessions reached the
+// oldest sessions are logged out, or under the reject policy the login
+// fails with database.ErrSessionLimit.
+func (s *LuckyNumberService) StartSession(msisdn, deviceID, fingerprint string) (string, error) {
+	if s == nil || s.db == nil {
+		return "", fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil {
+		return "", err
+	}
+	jti, err := utils.NewTokenID()
+	if err != nil {
+		return "", err
+	}
+	deviceID = strings.TrimSpace(deviceID)
+	if fingerprint = strings.TrimSpace(fingerprint); len(fingerprint) > maxFingerprintLen {
+		fingerprint = fingerprint[:maxFingerprintLen]
+	}
+
+	now := time.Now()
+	accessExpiry, expiresAt := now.Add(utils.AccessTokenTTL), now.Add(utils.AccessTokenTTL)
+	if deviceID != "" && limits.RefreshTokenTTL > utils.AccessTokenTTL {
+		expiresAt = now.Add(limits.RefreshTokenTTL)
+	}
+	evictOldest := limits.SessionLimitPolicy != config.SessionReject
+
+	revoked, err := s.db.OpenSession(ctx, msisdn, jti, deviceID, fingerprint, accessExpiry, expiresAt, limits.MaxSessions, evictOldest)
+	if err != nil {
+		return "", err
+	}
+	if len(revoked) > 0 {
+		utils.MarkTokensRevoked(revoked...)
+		logrus.Infof("sessions: login of %s ended %d earlier sessions", msisdn, len(revoked))
+	}
+	return utils.SignAccessToken(msisdn, database.Player(user).Role(), jti, now)
+}
+
+// ListSessions returns the live sessions of msisdn, newest first. The one
+// on access token currentJTI is marked Current.
+func (s *LuckyNumberService) ListSessions(msisdn, currentJTI string) ([]PlayerSession, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := s.db.ListSessions(ctx, msisdn)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]PlayerSession, 0, len(rows))
+	for _, row := range rows {
+		session := PlayerSession{
+			ID:                utils.ToInt64(row["id"]),
+			Msisdn:            utils.ToString(row["msisdn"]),
+			DeviceFingerprint: utils.ToString(row["device_fingerprint"]),
+			Refreshable:       utils.ToBool(row["refreshable"]),
+			Current:           currentJTI != "" && utils.ToString(row["jti"]) == currentJTI,
+		}
+		session.CreatedAt, _ = row["created_at"].(time.Time)
+		session.LastSeen, _ = row["last_seen"].(time.Time)
+		session.ExpiresAt, _ = row["expires_at"].(time.Time)
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
+}
+
+// EndSession logs session id of msisdn out, or of any player when msisdn is
+// empty: its access token stops working on the next request in this
+// process, and within limits.revocation_cache_ttl elsewhere, and its
+// device's refresh tokens are revoked
+func (s *LuckyNumberService) EndSession(msisdn string, id int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	jti, err := s.db.RevokeSession(ctx, msisdn, id)
+	if err != nil {
+		return err
+	}
+	if jti == "" {
+		return ErrSessionNotFound
+	}
+	utils.MarkTokensRevoked(jti)
+	return nil
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type memSession struct {
+	id                           int64
+	msisdn, jti, device, finger  string
+	createdAt, lastSeen, expires time.Time
+	revoked                      bool
+}
+
+// sessionRepo keeps sessions as player_sessions does, evicting or refusing
+// past maxSessions the way OpenSession's transaction does
+type sessionRepo struct {
+	*memRepo
+	sessions []*memSession
+}
+
+func newSessionRepo() *sessionRepo {
+	repo := &sessionRepo{memRepo: newMemRepo()}
+	repo.addPlayer(testMsisdn, 0)
+	return repo
+}
+
+func (r *sessionRepo) OpenSession(ctx context.Context, msisdn, jti, deviceID, fingerprint string, accessExpiry, expiresAt time.Time, maxSessions int, evictOldest bool) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ended, others []*memSession
+	for _, s := range r.sessions {
+		if s.msisdn != msisdn || s.revoked || !s.expires.After(time.Now()) {
+			continue
+		}
+		if (deviceID != "" && s.device == deviceID) || (fingerprint != "" && s.finger == fingerprint) {
+			ended = append(ended, s)
+			continue
+		}
+		others = append(others, s)
+	}
+	if maxSessions > 0 && len(others) >= maxSessions {
+		if !evictOldest {
+			return nil, database.ErrSessionLimit
+		}
+		ended = append(ended, others[:len(others)-maxSessions+1]...)
+	}
+	var jtis []string
+	for _, s := range ended {
+		s.revoked = true
+		jtis = append(jtis, s.jti)
+	}
+	now := time.Now()
+	r.sessions = append(r.sessions, &memSession{
+		id: int64(len(r.sessions) + 1), msisdn: msisdn, jti: jti, device: deviceID, finger: fingerprint,
+		createdAt: now, lastSeen: now, expires: expiresAt,
+	})
+	return jtis, nil
+}
+
+func (r *sessionRepo) ListSessions(ctx context.Context, msisdn string) ([]map[string]interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var rows []map[string]interface{}
+	for i := len(r.sessions) - 1; i >= 0; i-- {
+		s := r.sessions[i]
+		if s.msisdn == msisdn && !s.revoked {
+			rows = append(rows, map[string]interface{}{
+				"id": s.id, "msisdn": s.msisdn, "jti": s.jti, "device_fingerprint": s.finger,
+				"refreshable": s.device != "", "created_at": s.createdAt, "last_seen": s.lastSeen, "expires_at": s.expires,
+			})
+		}
+	}
+	return rows, nil
+}
+
+func (r *sessionRepo) RevokeSession(ctx context.Context, msisdn string, id int64) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.id == id && !s.revoked && (msisdn == "" || s.msisdn == msisdn) {
+			s.revoked = true
+			return s.jti, nil
+		}
+	}
+	return "", nil
+}
+
+// revoked answers utils.RevocationCheck from the sessions, as the
+// access_tokens table would
+func (r *sessionRepo) revoked(ctx context.Context, jti string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.sessions {
+		if s.jti == jti {
+			return s.revoked, nil
+		}
+	}
+	return false, nil
+}
+
+// startSessions configures auth and revocation against repo and returns a
+// function that calls a JWTMiddleware-protected route with a token
+func startSessions(t *testing.T, repo *sessionRepo, maxSessions int, policy string) func(token string) int {
+	t.Helper()
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+	saved := limits
+	limits.MaxSessions, limits.SessionLimitPolicy = maxSessions, policy
+	utils.ConfigureTokenRevocation(repo.revoked, time.Hour)
+	t.Cleanup(func() {
+		limits = saved
+		utils.ConfigureTokenRevocation(nil, 0)
+	})
+
+	app := fiber.New()
+	app.Get("/me", utils.JWTMiddleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return func(token string) int {
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("x-access-token", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+}
+
+func login(t *testing.T, s *LuckyNumberService, deviceID, fingerprint string) string {
+	t.Helper()
+	token, err := s.StartSession(testMsisdn, deviceID, fingerprint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestSessionLimitRevokesOldest(t *testing.T) {
+	repo := newSessionRepo()
+	get := startSessions(t, repo, 2, config.SessionRevokeOldest)
+	s := newTestService(t, repo, nil)
+
+	first := login(t, s, "", "phone")
+	second := login(t, s, "", "tablet")
+	for _, token := range []string{first, second} {
+		if got := get(token); got != 200 {
+			t.Fatalf("session within the limit = %d, want 200", got)
+		}
+	}
+
+	third := login(t, s, "", "laptop")
+	if got := get(first); got != 401 {
+		t.Errorf("oldest session past the limit = %d, want 401", got)
+	}
+	for _, token := range []string{second, third} {
+		if got := get(token); got != 200 {
+			t.Errorf("newer session = %d, want 200", got)
+		}
+	}
+
+	// Logging in again on a device replaces its session, not another
+	again := login(t, s, "", "tablet")
+	if get(second) != 401 || get(third) != 200 || get(again) != 200 {
+		t.Error("a second login on the tablet did not replace only the tablet's session")
+	}
+	sessions, err := s.ListSessions(testMsisdn, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Errorf("%d live sessions, want 2: %+v", len(sessions), sessions)
+	}
+}
+
+func TestSessionLimitRejects(t *testing.T) {
+	repo := newSessionRepo()
+	get := startSessions(t, repo, 1, config.SessionReject)
+	s := newTestService(t, repo, nil)
+
+	first := login(t, s, "", "phone")
+	if _, err := s.StartSession(testMsisdn, "", "tablet"); !errors.Is(err, database.ErrSessionLimit) {
+		t.Errorf("login past the limit = %v, want ErrSessionLimit", err)
+	}
+	if got := get(first); got != 200 {
+		t.Errorf("existing session after a refused login = %d, want 200", got)
+	}
+	// The same device may still log in again
+	if _, err := s.StartSession(testMsisdn, "", "phone"); err != nil {
+		t.Errorf("login again on the same device = %v", err)
+	}
+}
+
+func TestEndSessionTakesEffectOnNextRequest(t *testing.T) {
+	repo := newSessionRepo()
+	get := startSessions(t, repo, 0, config.SessionRevokeOldest)
+	s := newTestService(t, repo, nil)
+
+	phone := login(t, s, "device-1", "phone")
+	tablet := login(t, s, "", "tablet")
+	if get(phone) != 200 || get(tablet) != 200 {
+		t.Fatal("new sessions refused")
+	}
+
+	claims, err := auth.Verify(tablet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := s.ListSessions(testMsisdn, claims["jti"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 || !sessions[0].Current || sessions[1].Current || !sessions[1].Refreshable {
+		t.Fatalf("sessions = %+v, want the tablet current and the phone refreshable", sessions)
+	}
+	phoneID := sessions[1].ID
+
+	if err := s.EndSession("254700000009", phoneID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("ending another player's session = %v, want ErrSessionNotFound", err)
+	}
+	if get(phone) != 200 {
+		t.Error("session ended by another player")
+	}
+
+	// The revocation answer for the phone is cached; ending it still counts at once
+	if err := s.EndSession(testMsisdn, phoneID); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(phone); got != 401 {
+		t.Errorf("ended session = %d, want 401", got)
+	}
+	if got := get(tablet); got != 200 {
+		t.Errorf("other session = %d, want 200", got)
+	}
+	if err := s.EndSession(testMsisdn, phoneID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("ending it twice = %v, want ErrSessionNotFound", err)
+	}
+
+	// An admin ends a session of any player
+	if err := s.EndSession("", sessions[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(tablet); got != 401 {
+		t.Errorf("session ended by an admin = %d, want 401", got)
+	}
+}
+
+func TestStartSessionTrimsFingerprint(t *testing.T) {
+	repo := newSessionRepo()
+	startSessions(t, repo, 0, config.SessionRevokeOldest)
+	s := newTestService(t, repo, nil)
+
+	long := make([]byte, maxFingerprintLen+50)
+	for i := range long {
+		long[i] = 'f'
+	}
+	login(t, s, " device-1 ", "  "+string(long)+"  ")
+	if got := repo.sessions[0]; len(got.finger) != maxFingerprintLen || got.device != "device-1" {
+		t.Errorf("stored fingerprint of %d bytes and device %q, want %d and device-1", len(got.finger), got.device, maxFingerprintLen)
+	}
+}
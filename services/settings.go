@@ -0,0 +1,221 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrSettingsNotFound = errors.New("settings not found")
+	ErrInvalidSettings  = errors.New("invalid settings")
+)
+
+// auditSettingsUpdate is the admin_audit_log action of a settings change
+const auditSettingsUpdate = "settings_update"
+
+// validateSettings checks st before it is played with or written: every
+// percentage 0 to 100, a positive default_rtp and win multipliers, and
+// counts, pacing, deposit bounds and withdrawal limits that are not
+// negative
+func validateSettings(st database.Settings) error {
+	var problems []string
+	percent := func(name string, v float64) {
+		if v < 0 || v > 100 {
+			problems = append(problems, fmt.Sprintf("%s must be 0 to 100, got %v", name, v))
+		}
+	}
+	notNegative := func(name string, v float64) {
+		if v < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %v", name, v))
+		}
+	}
+
+	if st.DefaultRTP <= 0 {
+		problems = append(problems, "default_rtp is required")
+	}
+	percent("default_rtp", st.DefaultRTP)
+	percent("adjustmentable_rtp", st.AdjustableRTP)
+	percent("vig_percentage", st.VigPercentage)
+	percent("jackpot_percentage", st.JackpotPercentage)
+	percent("withholding", st.Withholding)
+	percent("excise_duty", st.ExciseDuty)
+	notNegative("rtp_overload", st.RTPOverload)
+	if st.MinWinMultiplier <= 0 {
+		problems = append(problems, "min_win_multipier is required")
+	}
+	if st.MaxWinMultiplier < st.MinWinMultiplier {
+		problems = append(problems, fmt.Sprintf("max_win_multipier must be at least min_win_multipier, got %v", st.MaxWinMultiplier))
+	}
+	notNegative("min_loss_count", float64(st.MinLossCount))
+	notNegative("bet_cooldown_ms", float64(st.BetCooldownMS))
+	notNegative("max_bets_per_minute", float64(st.MaxBetsPerMinute))
+	notNegative("forced_win_min_streak_secs", float64(st.ForcedWinMinStreakSecs))
+	notNegative("forced_win_min_deposits", float64(st.ForcedWinMinDeposits))
+	notNegative("min_deposit", st.MinDeposit)
+	notNegative("max_deposit", st.MaxDeposit)
+	notNegative("withdrawal_otp_threshold", st.WithdrawalOTPThreshold)
+	notNegative("withdrawal_max_count", float64(st.WithdrawalMaxCount))
+	notNegative("withdrawal_max_amount", st.WithdrawalMaxAmount)
+	if st.MaxDeposit > 0 && st.MaxDeposit < st.MinDeposit {
+		problems = append(problems, fmt.Sprintf("max_deposit must be at least min_deposit, got %v", st.MaxDeposit))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidSettings, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// settings returns the validated settings row through the lookup cache.
+// A row that fails validation is refused with ErrInvalidSettings rather
+// than played with.
+func (s *LuckyNumberService) settings(ctx context.Context) (database.Settings, error) {
+	row, err := s.lookups.Get(ctx, "settings", func(ctx context.Context) (map[string]interface{}, error) {
+		st, err := s.db.GetSettings(ctx)
+		if err != nil || st == nil {
+			return nil, err
+		}
+		if err := validateSettings(*st); err != nil {
+			logrus.WithField("alert", "settings").Errorf("settings: stored row refused: %v", err)
+			return nil, err
+		}
+		return map[string]interface{}{"settings": *st}, nil
+	})
+	if err != nil {
+		return database.Settings{}, err
+	}
+	st, ok := row["settings"].(database.Settings)
+	if !ok {
+		return database.Settings{}, ErrSettingsNotFound
+	}
+	return st, nil
+}
+
+// forgetSettings drops both cached forms of the settings row, typed and
+// raw, so this process reads the row again. Other processes pick a change
+// up when their entries expire, within limits.lookup_cache_ttl.
+func (s *LuckyNumberService) forgetSettings() {
+	s.lookups.Forget("settings")
+	s.lookups.Forget("setting")
+}
+
+// Settings returns the stored settings row, read past the cache and
+// whether or not it validates, so a refused row can be seen and fixed
+func (s *LuckyNumberService) Settings(ctx context.Context) (database.Settings, error) {
+	if s == nil || s.db == nil {
+		return database.Settings{}, fmt.Errorf("service or database not initialized")
+	}
+	stored, err := s.db.GetSettings(ctx)
+	if err != nil {
+		return database.Settings{}, err
+	}
+	if stored == nil {
+		return database.Settings{}, ErrSettingsNotFound
+	}
+	return *stored, nil
+}
+
+// SettingsChange sets the fields that are not nil; the others keep their
+// stored value
+type SettingsChange struct {
+	DefaultRTP             *float64 `json:"default_rtp,omitempty"`
+	AdjustableRTP          *float64 `json:"adjustmentable_rtp,omitempty"`
+	VigPercentage          *float64 `json:"vig_percentage,omitempty"`
+	JackpotPercentage      *float64 `json:"jackpot_percentage,omitempty"`
+	RTPOverload            *float64 `json:"rtp_overload,omitempty"`
+	MinWinMultiplier       *float64 `json:"min_win_multipier,omitempty"`
+	MaxWinMultiplier       *float64 `json:"max_win_multipier,omitempty"`
+	MinLossCount           *int     `json:"min_loss_count,omitempty"`
+	Withholding            *float64 `json:"withholding,omitempty"`
+	ExciseDuty             *float64 `json:"excise_duty,omitempty"`
+	BetCooldownMS          *int64   `json:"bet_cooldown_ms,omitempty"`
+	MaxBetsPerMinute       *int     `json:"max_bets_per_minute,omitempty"`
+	ForcedWinMinStreakSecs *int64   `json:"forced_win_min_streak_secs,omitempty"`
+	ForcedWinMinDeposits   *int64   `json:"forced_win_min_deposits,omitempty"`
+	MinDeposit             *float64 `json:"min_deposit,omitempty"`
+	MaxDeposit             *float64 `json:"max_deposit,omitempty"`
+	RoundDeposits          *bool    `json:"round_deposits,omitempty"`
+	WithdrawalOTPThreshold *float64 `json:"withdrawal_otp_threshold,omitempty"`
+	WithdrawalMaxCount     *int     `json:"withdrawal_max_count,omitempty"`
+	WithdrawalMaxAmount    *float64 `json:"withdrawal_max_amount,omitempty"`
+}
+
+// apply returns st with the change's fields set, and a "name old -> new"
+// entry for each field whose value changed
+func (c SettingsChange) apply(st database.Settings) (database.Settings, []string) {
+	var changed []string
+	changeSetting(&changed, "default_rtp", &st.DefaultRTP, c.DefaultRTP)
+	changeSetting(&changed, "adjustmentable_rtp", &st.AdjustableRTP, c.AdjustableRTP)
+	changeSetting(&changed, "vig_percentage", &st.VigPercentage, c.VigPercentage)
+	changeSetting(&changed, "jackpot_percentage", &st.JackpotPercentage, c.JackpotPercentage)
+	changeSetting(&changed, "rtp_overload", &st.RTPOverload, c.RTPOverload)
+	changeSetting(&changed, "min_win_multipier", &st.MinWinMultiplier, c.MinWinMultiplier)
+	changeSetting(&changed, "max_win_multipier", &st.MaxWinMultiplier, c.MaxWinMultiplier)
+	changeSetting(&changed, "min_loss_count", &st.MinLossCount, c.MinLossCount)
+	changeSetting(&changed, "withholding", &st.Withholding, c.Withholding)
+	changeSetting(&changed, "excise_duty", &st.ExciseDuty, c.ExciseDuty)
+	changeSetting(&changed, "bet_cooldown_ms", &st.BetCooldownMS, c.BetCooldownMS)
+	changeSetting(&changed, "max_bets_per_minute", &st.MaxBetsPerMinute, c.MaxBetsPerMinute)
+	changeSetting(&changed, "forced_win_min_streak_secs", &st.ForcedWinMinStreakSecs, c.ForcedWinMinStreakSecs)
+	changeSetting(&changed, "forced_win_min_deposits", &st.ForcedWinMinDeposits, c.ForcedWinMinDeposits)
+	changeSetting(&changed, "min_deposit", &st.MinDeposit, c.MinDeposit)
+	changeSetting(&changed, "max_deposit", &st.MaxDeposit, c.MaxDeposit)
+	changeSetting(&changed, "round_deposits", &st.RoundDeposits, c.RoundDeposits)
+	changeSetting(&changed, "withdrawal_otp_threshold", &st.WithdrawalOTPThreshold, c.WithdrawalOTPThreshold)
+	changeSetting(&changed, "withdrawal_max_count", &st.WithdrawalMaxCount, c.WithdrawalMaxCount)
+	changeSetting(&changed, "withdrawal_max_amount", &st.WithdrawalMaxAmount, c.WithdrawalMaxAmount)
+	return st, changed
+}
+
+func changeSetting[T comparable](changed *[]string, name string, field *T, value *T) {
+	if value == nil || *field == *value {
+		return
+	}
+	*changed = append(*changed, fmt.Sprintf("%s %v -> %v", name, *field, *value))
+	*field = *value
+}
+
+// UpdateSettings applies change to the stored settings on behalf of admin
+// and returns the result. The whole row is validated before it is
+// written, and each change is recorded in admin_audit_log. This process
+// plays with the new values at once.
+func (s *LuckyNumberService) UpdateSettings(admin string, change SettingsChange) (database.Settings, error) {
+	if s == nil || s.db == nil {
+		return database.Settings{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored, err := s.Settings(ctx)
+	if err != nil {
+		return database.Settings{}, err
+	}
+	st, changed := change.apply(stored)
+	if err := validateSettings(st); err != nil {
+		return database.Settings{}, err
+	}
+	if len(changed) == 0 {
+		return st, nil
+	}
+
+	n, err := s.db.UpdateSettings(ctx, st)
+	if err != nil {
+		return database.Settings{}, err
+	}
+	if n == 0 {
+		return database.Settings{}, ErrSettingsNotFound
+	}
+	s.forgetSettings()
+
+	summary := strings.Join(changed, "; ")
+	logrus.Warnf("settings: %s changed %s", admin, summary)
+	if err := s.db.LogAdminAccess(ctx, admin, auditSettingsUpdate, summary, nil); err != nil {
+		logrus.Errorf("settings: audit of %s's change failed: %v", admin, err)
+	}
+	return st, nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"strings"
+	"testing"
+)
+
+func TestValidateSettings(t *testing.T) {
+	if err := validateSettings(newMemRepo().settings); err != nil {
+		t.Fatalf("test settings refused: %v", err)
+	}
+	cases := []struct {
+		name   string
+		change func(*database.Settings)
+		field  string
+	}{
+		{"no default RTP", func(st *database.Settings) { st.DefaultRTP = 0 }, "default_rtp is required"},
+		{"RTP over 100", func(st *database.Settings) { st.DefaultRTP = 185 }, "default_rtp must be 0 to 100"},
+		{"negative adjustable RTP", func(st *database.Settings) { st.AdjustableRTP = -5 }, "adjustmentable_rtp"},
+		{"vig over 100", func(st *database.Settings) { st.VigPercentage = 110 }, "vig_percentage"},
+		{"withholding over 100", func(st *database.Settings) { st.Withholding = 120 }, "withholding"},
+		{"negative excise", func(st *database.Settings) { st.ExciseDuty = -1 }, "excise_duty"},
+		{"negative overload", func(st *database.Settings) { st.RTPOverload = -1 }, "rtp_overload"},
+		{"no min multiplier", func(st *database.Settings) { st.MinWinMultiplier = 0 }, "min_win_multipier is required"},
+		{"multipliers crossed", func(st *database.Settings) { st.MaxWinMultiplier = 0.5 }, "max_win_multipier must be at least"},
+		{"negative loss count", func(st *database.Settings) { st.MinLossCount = -1 }, "min_loss_count"},
+		{"negative cooldown", func(st *database.Settings) { st.BetCooldownMS = -1 }, "bet_cooldown_ms"},
+		{"deposits crossed", func(st *database.Settings) { st.MaxDeposit = 5 }, "max_deposit must be at least min_deposit"},
+	}
+	for _, tc := range cases {
+		st := newMemRepo().settings
+		tc.change(&st)
+		err := validateSettings(st)
+		if !errors.Is(err, ErrInvalidSettings) || !strings.Contains(err.Error(), tc.field) {
+			t.Errorf("%s: %v, want ErrInvalidSettings naming %s", tc.name, err, tc.field)
+		}
+	}
+}
+
+// settingsRepo counts reads of the settings row, writes it back and keeps
+// the audit trail
+type settingsRepo struct {
+	*memRepo
+	reads, writes int
+	audits        []string
+}
+
+func (r *settingsRepo) GetSettings(ctx context.Context) (*database.Settings, error) {
+	r.mu.Lock()
+	r.reads++
+	r.mu.Unlock()
+	return r.memRepo.GetSettings(ctx)
+}
+
+func (r *settingsRepo) UpdateSettings(ctx context.Context, st database.Settings) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes++
+	r.settings = st
+	return 1, nil
+}
+
+func (r *settingsRepo) LogAdminAccess(ctx context.Context, admin, action, query string, msisdns []string) error {
+	r.audits = append(r.audits, admin+" "+action+": "+query)
+	return nil
+}
+
+func TestSettingsCachedUntilUpdated(t *testing.T) {
+	repo := &settingsRepo{memRepo: newMemRepo()}
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if st, err := s.settings(ctx); err != nil || st.DefaultRTP != 85 {
+			t.Fatalf("settings = %+v, %v", st, err)
+		}
+	}
+	if repo.reads != 1 {
+		t.Errorf("%d reads for three bets, want the row cached", repo.reads)
+	}
+
+	rtp, withholding := 90.0, 20.0
+	updated, err := s.UpdateSettings("admin1", SettingsChange{DefaultRTP: &rtp, Withholding: &withholding})
+	if err != nil || updated.DefaultRTP != 90 {
+		t.Fatalf("update = %+v, %v", updated, err)
+	}
+	if st, _ := s.settings(ctx); st.DefaultRTP != 90 {
+		t.Errorf("after the update default_rtp = %v, want 90 without waiting for the cache", st.DefaultRTP)
+	}
+	// withholding was already 20, so only default_rtp is recorded
+	if want := []string{"admin1 settings_update: default_rtp 85 -> 90"}; len(repo.audits) != 1 || repo.audits[0] != want[0] {
+		t.Errorf("audit = %q, want %q", repo.audits, want)
+	}
+
+	// Nothing changed, nothing written
+	if _, err := s.UpdateSettings("admin1", SettingsChange{DefaultRTP: &rtp}); err != nil || repo.writes != 1 || len(repo.audits) != 1 {
+		t.Errorf("unchanged update = %v, %d writes, %d audits; want neither again", err, repo.writes, len(repo.audits))
+	}
+}
+
+func TestUpdateSettingsRefusesInvalid(t *testing.T) {
+	repo := &settingsRepo{memRepo: newMemRepo()}
+	s := newTestService(t, repo, nil)
+	s.settings(context.Background())
+
+	min, max := 100.0, 50.0
+	if _, err := s.UpdateSettings("admin1", SettingsChange{MinDeposit: &min, MaxDeposit: &max}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("crossed deposit bounds = %v, want ErrInvalidSettings", err)
+	}
+	// Valid on its own, but the whole row is checked
+	max = 0.5
+	if _, err := s.UpdateSettings("admin1", SettingsChange{MaxWinMultiplier: &max}); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("max multiplier under the min = %v, want ErrInvalidSettings", err)
+	}
+	if repo.writes != 0 || len(repo.audits) != 0 || repo.settings.MaxDeposit != 150000 {
+		t.Errorf("%d writes, audits %q; want the row untouched", repo.writes, repo.audits)
+	}
+}
+
+func TestStoredInvalidSettingsNotPlayed(t *testing.T) {
+	repo := newMemRepo()
+	repo.settings.DefaultRTP = 0 // a column left NULL
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40})
+
+	user, _ := repo.CheckUser(context.Background(), testMsisdn)
+	if _, err := s.PlaceBet(context.Background(), user, "", "Test", "1", testMsisdn, 20, "1", "web"); !errors.Is(err, ErrInvalidSettings) {
+		t.Errorf("bet = %v, want it refused with ErrInvalidSettings", err)
+	}
+	if p := repo.player(testMsisdn); p.Balance != 100 || len(repo.bets) != 0 {
+		t.Errorf("player = %+v with %d bets, want nothing staked", p, len(repo.bets))
+	}
+	// The admin still sees the row to fix it
+	if st, err := s.Settings(context.Background()); err != nil || st.DefaultRTP != 0 {
+		t.Errorf("Settings = %+v, %v, want the stored row", st, err)
+	}
+}
+
+// TestRTPUsesDefaultRTP pins the engine to default_rtp: the max a player
+// may win and whether a win stands both follow it
+func TestRTPUsesDefaultRTP(t *testing.T) {
+	s := newTestService(t, newMemRepo(), nil)
+	settings := database.Settings{DefaultRTP: 85, JackpotPercentage: 5, AdjustableRTP: 5, MinWinMultiplier: 1, MaxWinMultiplier: 10}
+	player := map[string]interface{}{"id": int64(1), "total_bets": 100.0, "payout": 40.0}
+
+	params := s.normalGameParams(player, testMsisdn, 20, "1", "BET_1", settings, database.Game{}, nil, 3)
+	if params.DefaultRTP != 85 || params.AdjustmentRTP != 5 {
+		t.Errorf("params RTP = %v + %v, want 85 + 5", params.DefaultRTP, params.AdjustmentRTP)
+	}
+	// (85 + 5)% of the 100 staked plus this 20, less the 40 paid
+	if !near(params.MaxWon, 72) {
+		t.Errorf("max won = %v, want 72", params.MaxWon)
+	}
+
+	for _, tc := range []struct {
+		defaultRTP float64
+		want       status.ResultStatus
+	}{
+		{85, status.ResultWin},  // 40 on 100-120 staked is within 90%
+		{20, status.ResultLoss}, // but not within 25%
+	} {
+		repo := newMemRepo()
+		repo.settings.DefaultRTP = tc.defaultRTP
+		repo.kpi.Handle = 100
+		repo.addPlayer(testMsisdn, 100)
+		s := newTestService(t, repo, fixedOutcomes{"1": 40})
+		if result := placeTestBet(t, s, repo, 20, "1"); result.GameResult.ResultStatus != tc.want {
+			t.Errorf("default_rtp %v: result = %s, want %s", tc.defaultRTP, result.GameResult.ResultStatus, tc.want)
+		}
+	}
+}
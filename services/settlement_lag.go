@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fiberapp/config"
+	"fiberapp/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Settlement lag buckets
+const (
+	LagDeposits    = "deposits"
+	LagWithdrawals = "withdrawals"
+	LagBets        = "bets"
+	LagCallbacks   = "callbacks"
+)
+
+// lagSettings holds the settlement_lag section; ConfigureSettlementLag replaces it
+var lagSettings = config.Default().SettlementLag
+
+// ConfigureSettlementLag applies the loaded settlement_lag section. Call it
+// before NewLuckyNumberService.
+func ConfigureSettlementLag(c config.SettlementLagConfig) {
+	lagSettings = c
+}
+
+// LagBucket is the money stuck in one settlement stage
+type LagBucket struct {
+	Name          string     `json:"name"`
+	OlderThan     string     `json:"older_than"`
+	Count         int64      `json:"count"`
+	Amount        float64    `json:"amount"`
+	Oldest        *time.Time `json:"oldest,omitempty"`
+	OldestAge     float64    `json:"oldest_age_seconds"`
+	MaxCount      int        `json:"max_count"`
+	MaxAmount     float64    `json:"max_amount"`
+	OverThreshold bool       `json:"over_threshold"`
+}
+
+// SettlementLag is one evaluation of every bucket
+type SettlementLag struct {
+	Buckets   []LagBucket `json:"buckets"`
+	CheckedAt time.Time   `json:"checked_at"`
+}
+
+// lagMonitor keeps the latest snapshot and when each bucket last alerted
+type lagMonitor struct {
+	cfg    config.SettlementLagConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	last      SettlementLag
+	lastAlert map[string]time.Time
+}
+
+func newLagMonitor(cfg config.SettlementLagConfig) *lagMonitor {
+	return &lagMonitor{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+func (m *lagMonitor) bucketConfig(name string) config.LagBucketConfig {
+	switch name {
+	case LagDeposits:
+		return m.cfg.Deposits
+	case LagWithdrawals:
+		return m.cfg.Withdrawals
+	case LagCallbacks:
+		return m.cfg.Callbacks
+	default:
+		return m.cfg.Bets
+	}
+}
+
+// MeasureSettlementLag queries every bucket and flags those over threshold
+func (s *LuckyNumberService) MeasureSettlementLag(ctx context.Context) (SettlementLag, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return SettlementLag{}, fmt.Errorf("service or database not initialized")
+	}
+
+	m := s.lag
+	rows, err := s.db.GetSettlementLag(ctx, m.cfg.Deposits.Age, m.cfg.Withdrawals.Age, m.cfg.Bets.Age, m.cfg.Callbacks.Age)
+	if err != nil {
+		return SettlementLag{}, err
+	}
+
+	now := time.Now()
+	snapshot := SettlementLag{CheckedAt: now, Buckets: make([]LagBucket, 0, len(rows))}
+	for _, row := range rows {
+		name := utils.ToString(row["bucket"])
+		cfg := m.bucketConfig(name)
+		b := LagBucket{
+			Name:      name,
+			OlderThan: cfg.Age.String(),
+			Count:     utils.ToInt64(row["count"]),
+			Amount:    utils.ToFloat64(row["amount"]),
+			MaxCount:  cfg.MaxCount,
+			MaxAmount: cfg.MaxAmount,
+		}
+		if t, ok := row["oldest"].(time.Time); ok {
+			b.Oldest = &t
+			b.OldestAge = now.Sub(t).Seconds()
+		}
+		b.OverThreshold = b.Count > int64(cfg.MaxCount) || b.Amount > cfg.MaxAmount
+		snapshot.Buckets = append(snapshot.Buckets, b)
+	}
+
+	m.mu.Lock()
+	m.last = snapshot
+	m.mu.Unlock()
+	return snapshot, nil
+}
+
+// SettlementLag returns the monitor's latest snapshot, measuring afresh when
+// the monitor has not run recently (or runs in another process)
+func (s *LuckyNumberService) SettlementLag(ctx context.Context) (SettlementLag, error) {
+	if s == nil || s.db == nil {
+		return SettlementLag{}, fmt.Errorf("service or database not initialized")
+	}
+
+	s.lag.mu.Lock()
+	last := s.lag.last
+	s.lag.mu.Unlock()
+	if !last.CheckedAt.IsZero() && time.Since(last.CheckedAt) < 2*s.lag.cfg.Interval {
+		return last, nil
+	}
+	return s.MeasureSettlementLag(ctx)
+}
+
+// RunSettlementLagMonitor measures on every settlement_lag.interval until ctx
+// is done, alerting on buckets over threshold. Run it in one process only.
+func (s *LuckyNumberService) RunSettlementLagMonitor(ctx context.Context) {
+	ticker := time.NewTicker(s.lag.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		snapshot, err := s.MeasureSettlementLag(ctx)
+		if err != nil {
+			logrus.Errorf("settlement lag: measure failed: %v", err)
+		} else {
+			s.alertSettlementLag(ctx, snapshot)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// alertSettlementLag warns once per bucket per alert_interval. A bucket that
+// drops back under threshold is re-armed so the next breach alerts at once.
+func (s *LuckyNumberService) alertSettlementLag(ctx context.Context, snapshot SettlementLag) {
+	m := s.lag
+	var due []LagBucket
+
+	m.mu.Lock()
+	for _, b := range snapshot.Buckets {
+		if !b.OverThreshold {
+			if _, alerted := m.lastAlert[b.Name]; alerted {
+				logrus.Infof("settlement lag: %s back under threshold (%d, Ksh.%.2f)", b.Name, b.Count, b.Amount)
+				delete(m.lastAlert, b.Name)
+			}
+			continue
+		}
+		if last, ok := m.lastAlert[b.Name]; ok && snapshot.CheckedAt.Sub(last) < m.cfg.AlertInterval {
+			continue
+		}
+		m.lastAlert[b.Name] = snapshot.CheckedAt
+		due = append(due, b)
+	}
+	m.mu.Unlock()
+
+	for _, b := range due {
+		msg := fmt.Sprintf("Settlement lag: %d %s older than %s holding Ksh.%.2f (oldest %.0fs, thresholds %d / Ksh.%.2f)",
+			b.Count, b.Name, b.OlderThan, b.Amount, b.OldestAge, b.MaxCount, b.MaxAmount)
+		logrus.WithFields(logrus.Fields{"bucket": b.Name, "count": b.Count, "amount": b.Amount}).Warn(msg)
+
+		if m.cfg.WebhookURL == "" {
+			continue
+		}
+		if err := m.postWebhook(ctx, msg); err != nil {
+			logrus.Errorf("settlement lag: webhook failed for %s: %v", b.Name, err)
+		}
+	}
+}
+
+// postWebhook sends a Slack incoming-webhook message
+func (m *lagMonitor) postWebhook(ctx context.Context, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WritePrometheus writes the snapshot as gauges in the Prometheus text format
+func (l SettlementLag) WritePrometheus(w io.Writer) {
+	gauges := []struct {
+		name, help string
+		value      func(LagBucket) float64
+	}{
+		{"pawabox_settlement_lag_count", "Rows unsettled past the bucket age.", func(b LagBucket) float64 { return float64(b.Count) }},
+		{"pawabox_settlement_lag_amount", "Amount held by rows unsettled past the bucket age.", func(b LagBucket) float64 { return b.Amount }},
+		{"pawabox_settlement_lag_oldest_seconds", "Age of the oldest unsettled row.", func(b LagBucket) float64 { return b.OldestAge }},
+		{"pawabox_settlement_lag_over_threshold", "1 when the bucket is over its alert threshold.", func(b LagBucket) float64 {
+			if b.OverThreshold {
+				return 1
+			}
+			return 0
+		}},
+	}
+
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, b := range l.Buckets {
+			fmt.Fprintf(w, "%s{bucket=%q} %g\n", g.name, b.Name, g.value(b))
+		}
+	}
+}
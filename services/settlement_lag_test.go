@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fiberapp/config"
+	"fiberapp/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lagRow is one unsettled row seeded into lagRepo
+type lagRow struct {
+	bucket string
+	amount float64
+	age    time.Duration
+}
+
+// lagRepo aggregates its seeded rows the way GetSettlementLag does
+type lagRepo struct {
+	database.LuckyRepo
+	rows []lagRow
+}
+
+func (r *lagRepo) GetSettlementLag(ctx context.Context, depositAge, withdrawalAge, betAge, callbackAge time.Duration) ([]map[string]interface{}, error) {
+	now := time.Now()
+	ages := map[string]time.Duration{LagDeposits: depositAge, LagWithdrawals: withdrawalAge, LagBets: betAge, LagCallbacks: callbackAge}
+	var out []map[string]interface{}
+	for _, name := range []string{LagDeposits, LagWithdrawals, LagBets, LagCallbacks} {
+		row := map[string]interface{}{"bucket": name, "count": int64(0), "amount": 0.0}
+		for _, s := range r.rows {
+			if s.bucket != name || s.age <= ages[name] {
+				continue
+			}
+			row["count"] = row["count"].(int64) + 1
+			row["amount"] = row["amount"].(float64) + s.amount
+			created := now.Add(-s.age)
+			if oldest, ok := row["oldest"].(time.Time); !ok || created.Before(oldest) {
+				row["oldest"] = created
+			}
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
+
+func lagTestConfig(webhook string) config.SettlementLagConfig {
+	cfg := config.Default().SettlementLag
+	cfg.WebhookURL = webhook
+	cfg.Deposits = config.LagBucketConfig{Age: 5 * time.Minute, MaxCount: 1, MaxAmount: 1000}
+	return cfg
+}
+
+func TestMeasureSettlementLag(t *testing.T) {
+	repo := &lagRepo{rows: []lagRow{
+		{LagDeposits, 100, 10 * time.Minute},
+		{LagDeposits, 250, 6 * time.Minute},
+		{LagDeposits, 999, 4 * time.Minute}, // not stuck yet
+		{LagWithdrawals, 500, 20 * time.Minute},
+		{LagBets, 50, time.Minute}, // not stuck yet
+	}}
+	s := &LuckyNumberService{db: repo, lag: newLagMonitor(lagTestConfig(""))}
+
+	snapshot, err := s.MeasureSettlementLag(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buckets := map[string]LagBucket{}
+	for _, b := range snapshot.Buckets {
+		buckets[b.Name] = b
+	}
+
+	dep := buckets[LagDeposits]
+	if dep.Count != 2 || dep.Amount != 350 || !dep.OverThreshold {
+		t.Errorf("deposits = %+v, want 2 holding 350 over the count threshold", dep)
+	}
+	if dep.OldestAge < 599 || dep.OldestAge > 610 {
+		t.Errorf("oldest deposit age = %.0fs, want about 600", dep.OldestAge)
+	}
+	if w := buckets[LagWithdrawals]; w.Count != 1 || w.Amount != 500 || w.OverThreshold {
+		t.Errorf("withdrawals = %+v, want 1 holding 500 under threshold", w)
+	}
+	if b := buckets[LagBets]; b.Count != 0 || b.Oldest != nil {
+		t.Errorf("bets = %+v, want none stuck", b)
+	}
+
+	var prom strings.Builder
+	snapshot.WritePrometheus(&prom)
+	for _, want := range []string{`pawabox_settlement_lag_count{bucket="deposits"} 2`, `pawabox_settlement_lag_amount{bucket="deposits"} 350`, `pawabox_settlement_lag_over_threshold{bucket="deposits"} 1`} {
+		if !strings.Contains(prom.String(), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestSettlementLagAlertsAreRateLimited(t *testing.T) {
+	var posts atomic.Int32
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts.Add(1)
+	}))
+	defer hook.Close()
+
+	s := &LuckyNumberService{lag: newLagMonitor(lagTestConfig(hook.URL))}
+	ctx := context.Background()
+	start := time.Now()
+	over := func(at time.Time, stuck bool) SettlementLag {
+		return SettlementLag{CheckedAt: at, Buckets: []LagBucket{{Name: LagDeposits, Count: 5, OverThreshold: stuck}}}
+	}
+	alertInterval := s.lag.cfg.AlertInterval
+
+	s.alertSettlementLag(ctx, over(start, true))
+	s.alertSettlementLag(ctx, over(start.Add(time.Minute), true))
+	if got := posts.Load(); got != 1 {
+		t.Fatalf("repeat breach within the alert interval posted %d times, want 1", got)
+	}
+
+	s.alertSettlementLag(ctx, over(start.Add(alertInterval), true))
+	if got := posts.Load(); got != 2 {
+		t.Fatalf("breach after the alert interval posted %d in all, want 2", got)
+	}
+
+	// Recovery re-arms the bucket, so the next breach alerts at once
+	s.alertSettlementLag(ctx, over(start.Add(alertInterval+time.Minute), false))
+	s.alertSettlementLag(ctx, over(start.Add(alertInterval+2*time.Minute), true))
+	if got := posts.Load(); got != 3 {
+		t.Errorf("breach after recovery posted %d in all, want 3", got)
+	}
+}
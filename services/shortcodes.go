@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/utils"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// shortcodesKey is the lookup cache key of the shortcodes. Other workers
+// see a change within limits.lookup_cache_ttl.
+const shortcodesKey = "shortcodes"
+
+var (
+	ErrUnknownCampaign   = errors.New("unknown deposit campaign")
+	ErrShortcodeNotFound = errors.New("shortcode not found")
+	ErrInvalidShortcode  = errors.New("invalid shortcode")
+)
+
+var (
+	shortcodePattern = regexp.MustCompile(`^[0-9]{5,7}$`)
+	campaignPattern  = regexp.MustCompile(`^[a-z0-9_-]{1,40}$`)
+)
+
+// depositChannels are the channels a shortcode can be assigned to
+var depositChannels = map[string]bool{"web": true, "ussd": true, "app": true}
+
+// Shortcode is a paybill deposits are pushed on and the campaign it
+// belongs to
+type Shortcode struct {
+	Shortcode   string     `json:"shortcode" example:"4093451"`
+	Label       string     `json:"label" example:"Radio Jambo"`
+	Campaign    string     `json:"campaign,omitempty" example:"jambo"`
+	Channel     string     `json:"channel,omitempty" example:"ussd"`
+	Default     bool       `json:"default"`
+	Active      bool       `json:"active"`
+	DateUpdated *time.Time `json:"date_updated,omitempty"`
+}
+
+// ShortcodeDeposits is the deposits made on one shortcode. Known is false
+// for a shortcode callbacks sent that is not in "shortcodes".
+type ShortcodeDeposits struct {
+	Shortcode string  `json:"shortcode" example:"4093451"`
+	Label     string  `json:"label,omitempty" example:"Radio Jambo"`
+	Campaign  string  `json:"campaign,omitempty" example:"jambo"`
+	Known     bool    `json:"known"`
+	Deposits  int64   `json:"deposits"`
+	Players   int64   `json:"players"`
+	Amount    float64 `json:"amount"`
+}
+
+// Validate checks a shortcode before it is saved
+func (sc Shortcode) Validate() error {
+	var problems []string
+	if !shortcodePattern.MatchString(sc.Shortcode) {
+		problems = append(problems, "shortcode must be 5 to 7 digits")
+	}
+	if strings.TrimSpace(sc.Label) == "" {
+		problems = append(problems, "label is required")
+	}
+	if sc.Campaign != "" && !campaignPattern.MatchString(sc.Campaign) {
+		problems = append(problems, "campaign must be lowercase letters, digits, - or _")
+	}
+	if sc.Channel != "" && !depositChannels[sc.Channel] {
+		problems = append(problems, "channel must be web, ussd or app")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidShortcode, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// pickShortcode returns the active shortcode for a deposit: the campaign's
+// when one is named, else the channel's, else the default one, else
+// fallback. A campaign no active shortcode carries is ErrUnknownCampaign.
+func pickShortcode(codes []Shortcode, campaign, channel, fallback string) (string, error) {
+	var byChannel, byDefault string
+	for _, sc := range codes {
+		if !sc.Active {
+			continue
+		}
+		if campaign != "" && sc.Campaign == campaign {
+			return sc.Shortcode, nil
+		}
+		if channel != "" && sc.Channel == channel {
+			byChannel = sc.Shortcode
+		}
+		if sc.Default {
+			byDefault = sc.Shortcode
+		}
+	}
+	switch {
+	case campaign != "":
+		return "", fmt.Errorf("%w: %s", ErrUnknownCampaign, campaign)
+	case byChannel != "":
+		return byChannel, nil
+	case byDefault != "":
+		return byDefault, nil
+	}
+	return fallback, nil
+}
+
+// Shortcodes returns every stored shortcode through the lookup cache
+func (s *LuckyNumberService) Shortcodes(ctx context.Context) ([]Shortcode, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.lookups.Get(ctx, shortcodesKey, func(ctx context.Context) (map[string]interface{}, error) {
+		rows, err := s.db.ListShortcodes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		codes := make([]Shortcode, 0, len(rows))
+		for _, r := range rows {
+			sc := Shortcode{
+				Shortcode: utils.ToString(r["shortcode"]),
+				Label:     utils.ToString(r["label"]),
+				Campaign:  utils.ToString(r["campaign"]),
+				Channel:   utils.ToString(r["channel"]),
+				Default:   utils.ToBool(r["is_default"]),
+				Active:    utils.ToBool(r["active"]),
+			}
+			if d, ok := r["date_updated"].(time.Time); ok {
+				sc.DateUpdated = &d
+			}
+			codes = append(codes, sc)
+		}
+		return map[string]interface{}{"shortcodes": codes}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	codes, _ := row["shortcodes"].([]Shortcode)
+	return codes, nil
+}
+
+// DepositShortcode returns the shortcode a deposit from channel, optionally
+// for campaign, is pushed on
+func (s *LuckyNumberService) DepositShortcode(ctx context.Context, campaign, channel string) (string, error) {
+	codes, err := s.Shortcodes(ctx)
+	if err != nil {
+		return "", err
+	}
+	return pickShortcode(codes, campaign, channel, limits.DefaultShortcode)
+}
+
+// flagUnknownShortcode logs a deposit callback on a shortcode missing from
+// "shortcodes". The deposit is settled anyway; the shortcode report lists
+// it as unknown.
+func (s *LuckyNumberService) flagUnknownShortcode(ctx context.Context, shortcode, transactionID string) {
+	if shortcode == limits.DefaultShortcode {
+		return
+	}
+	codes, err := s.Shortcodes(ctx)
+	if err != nil {
+		logrus.Errorf("shortcodes: checking %s for %s failed: %v", shortcode, transactionID, err)
+		return
+	}
+	for _, sc := range codes {
+		if sc.Shortcode == shortcode {
+			return
+		}
+	}
+	logrus.Warnf("shortcodes: deposit %s came in on unknown shortcode %q", transactionID, shortcode)
+}
+
+// SaveShortcode creates or replaces a shortcode
+func (s *LuckyNumberService) SaveShortcode(sc Shortcode) (Shortcode, error) {
+	if s == nil || s.db == nil {
+		return Shortcode{}, fmt.Errorf("service or database not initialized")
+	}
+	sc.Label = strings.TrimSpace(sc.Label)
+	sc.Campaign = strings.ToLower(strings.TrimSpace(sc.Campaign))
+	sc.Channel = strings.ToLower(strings.TrimSpace(sc.Channel))
+	if err := sc.Validate(); err != nil {
+		return Shortcode{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.db.UpsertShortcode(ctx, sc.Shortcode, sc.Label, sc.Campaign, sc.Channel, sc.Default, sc.Active); err != nil {
+		return Shortcode{}, err
+	}
+	s.lookups.Forget(shortcodesKey)
+	return sc, nil
+}
+
+// DeleteShortcode removes a shortcode. Deposits already made on it are kept
+// and reported as unknown.
+func (s *LuckyNumberService) DeleteShortcode(shortcode string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	n, err := s.db.DeleteShortcode(context.Background(), shortcode)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrShortcodeNotFound
+	}
+	s.lookups.Forget(shortcodesKey)
+	return nil
+}
+
+// DepositsByShortcode totals the deposits in dateRange per shortcode
+func (s *LuckyNumberService) DepositsByShortcode(dateRange utils.DateRange) ([]ShortcodeDeposits, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.GetDepositsByShortcode(context.Background(), dateRange.Start, dateRange.End)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]ShortcodeDeposits, 0, len(rows))
+	for _, row := range rows {
+		stats = append(stats, ShortcodeDeposits{
+			Shortcode: utils.ToString(row["shortcode"]),
+			Label:     utils.ToString(row["label"]),
+			Campaign:  utils.ToString(row["campaign"]),
+			Known:     utils.ToBool(row["known"]),
+			Deposits:  utils.ToInt64(row["deposits"]),
+			Players:   utils.ToInt64(row["players"]),
+			Amount:    utils.ToFloat64(row["amount"]),
+		})
+	}
+	return stats, nil
+}
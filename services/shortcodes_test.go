@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+var testShortcodes = []Shortcode{
+	{Shortcode: "4093451", Label: "Radio Jambo", Campaign: "jambo", Active: true},
+	{Shortcode: "4093452", Label: "USSD", Channel: "ussd", Active: true},
+	{Shortcode: "4093453", Label: "Main", Default: true, Active: true},
+	{Shortcode: "4093454", Label: "Old billboard", Campaign: "billboard", Channel: "app"},
+}
+
+func TestPickShortcode(t *testing.T) {
+	cases := []struct {
+		name, campaign, channel string
+		codes                   []Shortcode
+		want                    string
+	}{
+		{"campaign beats channel", "jambo", "ussd", testShortcodes, "4093451"},
+		{"channel beats default", "", "ussd", testShortcodes, "4093452"},
+		{"default", "", "web", testShortcodes, "4093453"},
+		{"inactive channel", "", "app", testShortcodes, "4093453"},
+		{"no shortcodes", "", "web", nil, "00000"},
+		{"no default", "", "web", testShortcodes[:2], "00000"},
+	}
+	for _, tc := range cases {
+		if got, err := pickShortcode(tc.codes, tc.campaign, tc.channel, "00000"); err != nil || got != tc.want {
+			t.Errorf("%s = %q, %v, want %s", tc.name, got, err, tc.want)
+		}
+	}
+
+	for _, campaign := range []string{"billboard", "nosuch"} {
+		if _, err := pickShortcode(testShortcodes, campaign, "web", "00000"); !errors.Is(err, ErrUnknownCampaign) {
+			t.Errorf("campaign %s = %v, want ErrUnknownCampaign", campaign, err)
+		}
+	}
+}
+
+// shortcodeRepo lists stored shortcodes and counts the reads
+type shortcodeRepo struct {
+	*memRepo
+	rows  []map[string]interface{}
+	reads int
+}
+
+func (r *shortcodeRepo) ListShortcodes(ctx context.Context) ([]map[string]interface{}, error) {
+	r.reads++
+	return r.rows, nil
+}
+
+func (r *shortcodeRepo) UpsertShortcode(ctx context.Context, shortcode, label, campaign, channel string, isDefault, active bool) error {
+	r.rows = append(r.rows, map[string]interface{}{
+		"shortcode": shortcode, "label": label, "campaign": campaign, "channel": channel, "is_default": isDefault, "active": active,
+	})
+	return nil
+}
+
+func TestDepositShortcode(t *testing.T) {
+	repo := &shortcodeRepo{memRepo: newMemRepo(), rows: []map[string]interface{}{
+		{"shortcode": "4093452", "label": "USSD", "campaign": "", "channel": "ussd", "is_default": false, "active": true},
+	}}
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	if got, _ := s.DepositShortcode(ctx, "", "ussd"); got != "4093452" {
+		t.Errorf("ussd deposit on %q, want 4093452", got)
+	}
+	if got, _ := s.DepositShortcode(ctx, "", "web"); got != limits.DefaultShortcode {
+		t.Errorf("web deposit on %q, want the configured default %s", got, limits.DefaultShortcode)
+	}
+	if repo.reads != 1 {
+		t.Errorf("%d shortcode reads, want the cached one", repo.reads)
+	}
+
+	// Saving drops the cached rows
+	if _, err := s.SaveShortcode(Shortcode{Shortcode: "4093451", Label: " Radio Jambo ", Campaign: "JAMBO", Active: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.DepositShortcode(ctx, "jambo", "ussd"); err != nil || got != "4093451" {
+		t.Errorf("jambo deposit = %q, %v, want the new shortcode", got, err)
+	}
+}
+
+func TestShortcodeValidate(t *testing.T) {
+	invalid := []Shortcode{
+		{Shortcode: "1234", Label: "Short"},
+		{Shortcode: "12345678", Label: "Long"},
+		{Shortcode: "40934a1", Label: "Letters"},
+		{Shortcode: "4093451"},
+		{Shortcode: "4093451", Label: "Radio", Campaign: "Radio Jambo"},
+		{Shortcode: "4093451", Label: "Radio", Channel: "sms"},
+	}
+	for _, sc := range invalid {
+		if err := sc.Validate(); !errors.Is(err, ErrInvalidShortcode) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidShortcode", sc, err)
+		}
+	}
+	if err := (Shortcode{Shortcode: "40934", Label: "Radio", Campaign: "jambo-2", Channel: "web"}).Validate(); err != nil {
+		t.Errorf("valid shortcode = %v", err)
+	}
+}
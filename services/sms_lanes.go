@@ -0,0 +1,105 @@
+package services
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// smsLaneWait bounds how long a message waits for the one reserved before
+// it. A send that hangs must not hold the player's later messages forever.
+const smsLaneWait = 30 * time.Second
+
+// smsLanes sends each player's SMS one at a time in the order they were
+// reserved, so a result never overtakes the deposit confirmation a flow
+// reserved before it. Different players' lanes run in parallel.
+type smsLanes struct {
+	mu    sync.Mutex
+	lanes map[string]*smsLane
+}
+
+type smsLane struct {
+	tail    chan struct{} // closed once the latest ticket is done
+	pending int           // tickets reserved and not yet done
+}
+
+// smsTicket is one message's place in its player's lane. Send it exactly
+// once.
+type smsTicket struct {
+	lanes    *smsLanes
+	msisdn   string
+	sequence int64 // dbQueue "Sequence"
+	prev     <-chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newSMSLanes() *smsLanes {
+	return &smsLanes{lanes: make(map[string]*smsLane)}
+}
+
+// reserve takes the next place in msisdn's lane. A flow that hands a send
+// to a goroutine reserves before starting it, in the order its messages
+// must arrive.
+func (l *smsLanes) reserve(msisdn string) *smsTicket {
+	t := &smsTicket{lanes: l, msisdn: msisdn, sequence: nextSMSSequence(), done: make(chan struct{})}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lane, ok := l.lanes[msisdn]
+	if !ok {
+		lane = &smsLane{}
+		l.lanes[msisdn] = lane
+	}
+	t.prev = lane.tail
+	lane.tail = t.done
+	lane.pending++
+	return t
+}
+
+// send waits for the messages reserved before t, then delivers it with its
+// sequence
+func (t *smsTicket) send(deliver func(sequence int64) error) error {
+	if t.prev != nil {
+		select {
+		case <-t.prev:
+		case <-time.After(smsLaneWait):
+			logrus.Warnf("sms: earlier message to %s still sending after %s, sending the next one", t.msisdn, smsLaneWait)
+		}
+	}
+	defer t.finish()
+	return deliver(t.sequence)
+}
+
+func (t *smsTicket) finish() {
+	t.once.Do(func() {
+		close(t.done)
+		t.lanes.mu.Lock()
+		defer t.lanes.mu.Unlock()
+		if lane := t.lanes.lanes[t.msisdn]; lane != nil {
+			if lane.pending--; lane.pending <= 0 {
+				delete(t.lanes.lanes, t.msisdn)
+			}
+		}
+	})
+}
+
+// smsSequence is the last stamp nextSMSSequence handed out
+var smsSequence atomic.Int64
+
+// nextSMSSequence stamps a message when its flow decides to send it: the
+// time in microseconds, or one past the last stamp when the clock has not
+// moved on. Stamps grow within a process and follow the clock across the
+// processes of a host, so the dbQueue drainer can order a player's
+// messages by them however late each row is inserted.
+func nextSMSSequence() int64 {
+	for {
+		last := smsSequence.Load()
+		next := max(time.Now().UnixMicro(), last+1)
+		if smsSequence.CompareAndSwap(last, next) {
+			return next
+		}
+	}
+}
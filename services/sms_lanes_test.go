@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSMSLanesKeepReserveOrder(t *testing.T) {
+	lanes := newSMSLanes()
+	const messages = 200
+	tickets := make([]*smsTicket, messages)
+	for i := range tickets {
+		tickets[i] = lanes.reserve(testMsisdn)
+	}
+
+	// Sent from goroutines started in random order, they arrive in the
+	// order they were reserved, with rising sequences
+	var mu sync.Mutex
+	var got []int
+	var sequences []int64
+	var wg sync.WaitGroup
+	for _, i := range rand.Perm(messages) {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tickets[i].send(func(sequence int64) error {
+				mu.Lock()
+				got = append(got, i)
+				sequences = append(sequences, sequence)
+				mu.Unlock()
+				return nil
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range got {
+		if got[i] != i {
+			t.Fatalf("delivered %v, want reserve order", got)
+		}
+	}
+	if !slices.IsSorted(sequences) || len(slices.Compact(slices.Clone(sequences))) != messages {
+		t.Errorf("sequences %v, want each one greater than the last", sequences)
+	}
+	if len(lanes.lanes) != 0 {
+		t.Errorf("%d lanes left, want them dropped once empty", len(lanes.lanes))
+	}
+}
+
+func TestSMSLanesParallelAcrossPlayers(t *testing.T) {
+	lanes := newSMSLanes()
+	const players, send = 20, 50 * time.Millisecond
+	deliver := func(int64) error { time.Sleep(send); return nil }
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for p := 0; p < players; p++ {
+		ticket := lanes.reserve(fmt.Sprintf("2547000000%02d", p))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ticket.send(deliver)
+		}()
+	}
+	wg.Wait()
+	if took := time.Since(start); took > 5*send {
+		t.Errorf("%d players' messages took %s, want them sent side by side", players, took)
+	}
+
+	// One player's two messages go one after the other
+	first, second := lanes.reserve(testMsisdn), lanes.reserve(testMsisdn)
+	start = time.Now()
+	go first.send(deliver)
+	second.send(deliver)
+	if took := time.Since(start); took < 2*send {
+		t.Errorf("one player's two messages took %s, want them sent in turn", took)
+	}
+}
+
+func TestSMSLaneFailedSendFreesLane(t *testing.T) {
+	lanes := newSMSLanes()
+	first, second := lanes.reserve(testMsisdn), lanes.reserve(testMsisdn)
+	if err := first.send(func(int64) error { return fmt.Errorf("dbQueue: connection reset") }); err == nil {
+		t.Fatal("want the send's error")
+	}
+	done := make(chan error, 1)
+	go func() { done <- second.send(func(int64) error { return nil }) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a failed send held the next message")
+	}
+}
+
+func TestQueueOrderedSMSSequences(t *testing.T) {
+	repo := newMemRepo()
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if err := s.queueOrderedSMS(ctx, testMsisdn, fmt.Sprintf("message %d", i), "LuckyNumber", "transfer"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 1; i < len(repo.sms); i++ {
+		if repo.sms[i].Sequence <= repo.sms[i-1].Sequence {
+			t.Errorf("row %d sequence %d after %d, want rising", i, repo.sms[i].Sequence, repo.sms[i-1].Sequence)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"fiberapp/utils"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// A failed dbQueue insert is retried a few times in the request, which
+// rides out a dropped connection or a failover, then given up on. What
+// happens next is the caller's choice: an OTP is already stored and can be
+// resent, a result SMS is retried in the background since the bet it
+// reports has settled either way.
+const (
+	smsQueueAttempts = 3
+	smsQueueBackoff  = 200 * time.Millisecond
+
+	smsRetryAttempts = 4
+	smsRetryBackoff  = 2 * time.Second
+	smsRetryTimeout  = 10 * time.Second
+)
+
+// queueSMS inserts message for msisdn into dbQueue, retrying a failed insert
+// smsQueueAttempts times in all while ctx allows, and returns the row's id.
+// It does not wait in msisdn's lane: an OTP goes out at once.
+func (s *LuckyNumberService) queueSMS(ctx context.Context, msisdn, message, smscID, response string) (int64, error) {
+	var err error
+	sequence := nextSMSSequence()
+	wait := smsQueueBackoff
+	for attempt := 1; ; attempt++ {
+		var id int64
+		if id, err = s.db.InsertIntoSMSQueue(ctx, msisdn, message, smscID, response, sequence); err == nil {
+			return id, nil
+		}
+		if attempt == smsQueueAttempts {
+			return 0, err
+		}
+		logrus.Warnf("sms: queue %s for %s failed (attempt %d/%d): %v", response, msisdn, attempt, smsQueueAttempts, err)
+		select {
+		case <-ctx.Done():
+			return 0, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// queueOrderedSMS inserts message for msisdn into dbQueue after the
+// messages already reserved in its lane
+func (s *LuckyNumberService) queueOrderedSMS(ctx context.Context, msisdn, message, smscID, response string) error {
+	return s.sms.reserve(msisdn).send(func(sequence int64) error {
+		_, err := s.db.InsertIntoSMSQueue(ctx, msisdn, message, smscID, response, sequence)
+		return err
+	})
+}
+
+// retrySMSLater runs send in the background until it succeeds or has been
+// tried smsRetryAttempts times, smsRetryBackoff apart and doubling. what
+// names the message in the log.
+func retrySMSLater(what string, send func(ctx context.Context) error) {
+	utils.GoBackground("sms retry", func() {
+		wait := smsRetryBackoff
+		for attempt := 1; attempt <= smsRetryAttempts; attempt++ {
+			time.Sleep(wait)
+			wait *= 2
+
+			ctx, cancel := context.WithTimeout(context.Background(), smsRetryTimeout)
+			err := send(ctx)
+			cancel()
+			if err == nil {
+				logrus.Infof("sms: %s sent on retry %d", what, attempt)
+				return
+			}
+			logrus.Warnf("sms: %s retry %d/%d failed: %v", what, attempt, smsRetryAttempts, err)
+		}
+		logrus.Errorf("sms: %s not sent, giving up", what)
+	})
+}
+
+// notifyResult sends a settled bet's result SMS. A failure is logged and
+// retried in the background rather than returned: the money has moved by
+// now, and failing the bet over its SMS would misreport it.
+func (s *LuckyNumberService) notifyResult(ctx context.Context, player map[string]interface{}, msisdn, reference, message string) {
+	if err := s.sendResultSMS(ctx, player, msisdn, message); err != nil {
+		logrus.Errorf("bet %s: result sms to %s failed, retrying: %v", reference, msisdn, err)
+		retrySMSLater("result of bet "+reference, func(context.Context) error {
+			return s.sendsms(msisdn, message)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smsDownRepo fails the next failures dbQueue inserts, as a dropped
+// connection would, and counts the inserts tried
+type smsDownRepo struct {
+	*changeRepo
+	failures, attempts int
+}
+
+func (r *smsDownRepo) InsertIntoSMSQueue(ctx context.Context, msisdn, message, smscID, response string, sequence int64) (int64, error) {
+	r.mu.Lock()
+	r.attempts++
+	if r.failures > 0 {
+		r.failures--
+		r.mu.Unlock()
+		return 0, errors.New("dbQueue: connection reset")
+	}
+	r.mu.Unlock()
+	return r.memRepo.InsertIntoSMSQueue(ctx, msisdn, message, smscID, response, sequence)
+}
+
+func TestOTPStoredWhenSMSQueueDown(t *testing.T) {
+	configureTestOTP(t)
+	repo := &smsDownRepo{changeRepo: newChangeRepo(), failures: 100}
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	if _, err := s.InsertVerification(testMsisdn, OTPLogin, "1234", now+300, now); !errors.Is(err, ErrOTPDeliveryDelayed) {
+		t.Fatalf("OTP with dbQueue down = %v, want ErrOTPDeliveryDelayed", err)
+	}
+	if repo.attempts != smsQueueAttempts || otpSMS(repo.memRepo, testMsisdn) != 0 {
+		t.Errorf("%d inserts tried and %d queued, want %d tried and none queued", repo.attempts, otpSMS(repo.memRepo, testMsisdn), smsQueueAttempts)
+	}
+	if len(repo.codes) != 1 {
+		t.Fatalf("%d codes stored, want the undelivered one", len(repo.codes))
+	}
+
+	// Once dbQueue is back a resend delivers a code
+	repo.failures = 0
+	repo.codes[0].LastSent -= ResendAllowedAfter()
+	if _, err := s.ResendOTP(testMsisdn, OTPLogin, "5678", 5*time.Minute); err != nil {
+		t.Fatalf("resend after recovery = %v", err)
+	}
+	if otpSMS(repo.memRepo, testMsisdn) != 1 || !strings.Contains(repo.sms[0].Message, "5678") {
+		t.Errorf("queued %+v, want the resent code", repo.sms)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "5678"); err != nil {
+		t.Errorf("resent code = %v, want it accepted", err)
+	}
+}
+
+func TestOTPUndeliveredCodeStaysValid(t *testing.T) {
+	configureTestOTP(t)
+	repo := &smsDownRepo{changeRepo: newChangeRepo(), failures: 100}
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	if _, err := s.InsertVerification(testMsisdn, OTPLogin, "1234", now+300, now); !errors.Is(err, ErrOTPDeliveryDelayed) {
+		t.Fatal(err)
+	}
+	if _, err := s.VerifyOTP(testMsisdn, OTPLogin, "1234"); err != nil {
+		t.Errorf("stored code whose SMS was delayed = %v, want it accepted", err)
+	}
+}
+
+func TestOTPQueueRetriesTransientFailure(t *testing.T) {
+	configureTestOTP(t)
+	repo := &smsDownRepo{changeRepo: newChangeRepo(), failures: smsQueueAttempts - 1}
+	s := newTestService(t, repo, nil)
+	now := time.Now().Unix()
+
+	if _, err := s.InsertVerification(testMsisdn, OTPLogin, "1234", now+300, now); err != nil {
+		t.Fatalf("OTP after %d failed inserts = %v, want it queued", smsQueueAttempts-1, err)
+	}
+	if repo.attempts != smsQueueAttempts || otpSMS(repo.memRepo, testMsisdn) != 1 {
+		t.Errorf("%d inserts tried and %d queued, want %d and 1", repo.attempts, otpSMS(repo.memRepo, testMsisdn), smsQueueAttempts)
+	}
+}
+
+func TestOTPQueueStopsWithContext(t *testing.T) {
+	repo := &smsDownRepo{changeRepo: newChangeRepo(), failures: 100}
+	s := newTestService(t, repo, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := s.queueSMS(ctx, testMsisdn, "code", "LuckyNumber", "otp"); err == nil {
+		t.Fatal("queued with dbQueue down")
+	}
+	if repo.attempts != 1 {
+		t.Errorf("%d inserts tried after the request ended, want 1", repo.attempts)
+	}
+}
+
+func TestSettlementSurvivesSMSQueueDown(t *testing.T) {
+	repo := &smsDownRepo{changeRepo: newChangeRepo(), failures: 1000}
+	repo.addPlayer(testMsisdn, 1000)
+	s := newTestService(t, repo, fixedOutcomes{"3": 100, "4": 0})
+
+	win := placeTestBet(t, s, repo.memRepo, 20, "3").GameResult
+	loss := placeTestBet(t, s, repo.memRepo, 20, "4").GameResult
+	if win.ResultStatus != "Win" || loss.ResultStatus != "Loss" {
+		t.Fatalf("results = %s, %s; want a win and a loss", win.ResultStatus, loss.ResultStatus)
+	}
+	if p := repo.player(testMsisdn); p.Balance != 960 || p.Payout != 100 {
+		t.Errorf("player = %+v, want both stakes taken and the win paid", p)
+	}
+	if len(repo.queued) != 1 || repo.queued[0].Reference != win.GameID {
+		t.Errorf("queued = %+v, want the payout of %s", repo.queued, win.GameID)
+	}
+	if err := utils.WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRetrySMSLater(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits out the first retry backoff")
+	}
+	calls := 0
+	retrySMSLater("test message", func(ctx context.Context) error {
+		calls++
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("retry without a deadline")
+		}
+		return nil
+	})
+	if err := utils.WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("%d sends, want 1: the first retry succeeded", calls)
+	}
+}
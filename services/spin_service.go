@@ -0,0 +1,621 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/status"
+	"fiberapp/taxcalc"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+
+	"github.com/sirupsen/logrus"
+)
+
+type SpinResponse struct {
+	Row       []string `json:"row"`
+	Win       bool     `json:"win"`
+	WinAmount float64  `json:"win_amount"`
+	GameID    string   `json:"game_id"`
+}
+
+// Generate forced row where matches are from the left
+// forcedMatchFromLeft generates a row of 3 symbols as strings, matching from the left
+// symbols: slice of available symbols, e.g., []string{"cherry","apple","orange","grape"}
+// symbolIndex: index in symbols to use for matching
+// matchSymbols: 0 = fully random, 2 = first two match, 3 = all three match
+func forcedMatchFromLeft(symbols []string, symbolIndex int, matchSymbols int) []string {
+	row := make([]string, 3)
+
+	switch matchSymbols {
+	case 3:
+		// All three same
+		row[0], row[1], row[2] = symbols[symbolIndex], symbols[symbolIndex], symbols[symbolIndex]
+	case 2:
+		// First two same, last one different
+		row[0], row[1] = symbols[symbolIndex], symbols[symbolIndex]
+		for {
+			r := cryptoRandIndex(len(symbols))
+			if r != symbolIndex {
+				row[2] = symbols[r]
+				break
+			}
+		}
+	default:
+		// fully random
+		for i := 0; i < 3; i++ {
+			row[i] = symbols[cryptoRandIndex(len(symbols))]
+		}
+	}
+
+	return row
+}
+
+func (s *LuckyNumberService) PlaceBetSpin(
+	player map[string]interface{},
+	gameCatID, msisdn string,
+	amount float64,
+	channel, mode string,
+) (resp SpinResponse, err error) {
+
+	// s.mu.Lock()
+	// defer s.mu.Unlock()
+
+	ctx := context.Background()
+	game, err := s.GetPlayableGame(ctx, gameCatID)
+	if err != nil {
+		return SpinResponse{}, err
+	}
+	if err := s.checkBetPace(ctx, msisdn); err != nil {
+		return SpinResponse{}, err
+	}
+	release, err := s.plays.acquire(ctx)
+	if err != nil {
+		return SpinResponse{}, err
+	}
+	defer release()
+	gameID := utils.NewReference(utils.RefSpin)
+	symbols := []string{"0", "1", "2", "3"}
+
+	//----------------------------------------------------
+	// LOAD SETTINGS
+	//----------------------------------------------------
+	data, err := s.loadSpinData(ctx, gameCatID, msisdn)
+	if err != nil {
+		return SpinResponse{}, err
+	}
+
+	basket := data.Basket
+	settings := data.Settings
+	kpi := data.KPI
+	// player := data.Player
+
+	//----------------------------------------------------
+	// EXTRACT PARAMS
+	//----------------------------------------------------
+
+	basketValue := utils.ToFloat64(basket["amount"])
+
+	defaultRTP := settings.DefaultRTP
+	qadjustRTP := settings.AdjustableRTP
+
+	// r := cryptoRandFloat() // returns float64 in [0,1)
+
+	// // Bias toward higher end by squaring (r^power with power < 1 favors higher)
+	// power := 0.3                 // lower than 1 → skews toward high end
+	// biased := math.Pow(r, power) // now mostly closer to 1
+
+	// // Scale to range 10..qadjustRTP
+	// adjustRTP := 10 + biased*(qadjustRTP-10)
+
+	adjustRTP := cryptoRandFloatRange(qadjustRTP, qadjustRTP+9)
+
+	minMul := settings.MinWinMultiplier
+	maxMul := settings.MaxWinMultiplier
+
+	vig := settings.VigPercentage
+	overload := settings.RTPOverload
+	jackpotspin := settings.JackpotPercentage
+
+	playerRow := database.Player(player)
+	playerTotalLosses := playerRow.TotalLosses()
+	playerLost := int(playerRow.LostCount())
+	playerPayout := playerRow.Payout()
+	playerTotalBets := playerRow.TotalBets()
+	playerID := playerRow.ID()
+	playerLostCount := playerRow.LostCount()
+	playerRTP := playerRow.RTP()
+
+	gameExposure := game.MaxExposure
+
+	kpiBet := utils.ToFloat64(kpi["bet"])
+	kpiPay := utils.ToFloat64(kpi["payout"])
+
+	BetAmount := amount
+	houseValue := (vig / 100) * BetAmount
+
+	globalRTP := settings.DefaultRTP + settings.AdjustableRTP
+	basket_Value := BetAmount * (globalRTP / 100)
+
+	//----------------------------------------------------
+	// HELPER: FORCE LOSS
+	//----------------------------------------------------
+	hardLoss := func() (SpinResponse, error) {
+		row := randomNonMatchingRow(symbols)
+		if err := s.advanceRound(ctx, gameID, database.RoundSettled, actorGame, "spin loss"); err != nil {
+			return SpinResponse{}, err
+		}
+		_, _ = s.db.UpdateLuckyBet(ctx, utils.ToString(row), "SPIN&WIN", gameID, status.ResultLoss)
+
+		err := s.lose(ctx, playerID, gameID, msisdn, playerLostCount, playerTotalLosses, BetAmount)
+		if err != nil {
+			return SpinResponse{}, fmt.Errorf("failed to handle loss: %w", err)
+		}
+
+		logrus.Info(row)
+		s.recordSpin(ctx, player, gameID, row, BetAmount, 0)
+
+		return SpinResponse{
+			Row:       row,
+			Win:       false,
+			WinAmount: 0,
+			GameID:    gameID,
+		}, nil
+	}
+
+	//----------------------------------------------------
+	// TAX CALC
+	//----------------------------------------------------
+	calcTax := func(amount float64) taxcalc.Win {
+		return taxcalc.Withholding(amount, data.Tax.Withholding)
+	}
+
+	//----------------------------------------------------
+	// RNG HELPERS
+	//----------------------------------------------------
+	forcedMatch := func() []string {
+		return forcedMatchingRow(symbols)
+	}
+
+	//----------------------------------------------------
+	// UPDATE PLAYER BET + TAX FIRST
+	//----------------------------------------------------
+	exciseTax := taxcalc.Excise(BetAmount, data.Tax.Excise)
+	// The stake is taken as a box bet's is: from cash and/or bonus, refused
+	// when they cannot cover it, and booked against the game id so a win on
+	// a bonus-funded spin goes back to the bonus wallet
+	if err := s.openRound(ctx, gameID, msisdn, gameCatID, BetAmount, actorPlayer, "spin via "+channel); err != nil {
+		return SpinResponse{}, err
+	}
+	cashStake, bonusStake, err := s.db.DebitStake(ctx, msisdn, gameID, BetAmount, limits.BonusFirst)
+	if err != nil {
+		s.failRound(ctx, gameID, actorWallet, err)
+		return SpinResponse{}, err
+	}
+	if bonusStake > 0 {
+		logrus.Infof("spin %s funded: cash=%.2f bonus=%.2f", gameID, cashStake, bonusStake)
+	}
+	_ = s.advanceRound(ctx, gameID, database.RoundFunded, actorWallet, fmt.Sprintf("stake cash=%.2f bonus=%.2f", cashStake, bonusStake))
+	// The funded round fails with any error from here, as playGame's does
+	defer func() {
+		if err != nil {
+			s.failRound(ctx, gameID, actorGame, err)
+		}
+	}()
+
+	// The bet row claims the game id the stake was booked under
+	created, err := s.db.CreateBet(ctx, msisdn, "0", BetAmount, "", gameID, status.ResultPending, "SpinWin", gameCatID, game.Name, channel)
+	if err == nil && !created {
+		err = database.ErrDuplicateReference
+	}
+	if err != nil {
+		return SpinResponse{}, err
+	}
+
+	if err := s.bet(ctx, gameID, playerID, playerTotalBets, BetAmount); err != nil {
+		return SpinResponse{}, err
+	}
+
+	// batch async DB tasks
+	tasks := []func() error{
+		func() error { _, e := s.db.UpdateKPIHandle(ctx, BetAmount); return e },
+		func() error { _, e := s.db.UpdateKPIChannelHandle(ctx, channel, BetAmount); return e },
+		func() error { _, e := s.db.UpdateKPIPayoutSPIN(ctx, exciseTax); return e },
+		func() error {
+			_, e := s.db.InsertTaxQueue(ctx, gameID, BetAmount, exciseTax, BetAmount-exciseTax, data.Tax.Excise, "excise", msisdn)
+			return e
+		},
+		func() error {
+			_, e := s.db.InsertB2BWithdrawalB2B(ctx, gameID, msisdn, exciseTax, status.B2BPlaced)
+			return e
+		},
+		// DebitStake already took the stake from cash and/or bonus
+		func() error { _, e := s.db.UpdateUserRTP(ctx, 0, playerID); return e },
+		func() error { _, e := s.db.UpdateHousePawaBoxKeBets(ctx, BetAmount); return e },
+		func() error {
+			_, e := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, gameID, "total_bets", msisdn, BetAmount)
+			return e
+		},
+		func() error { _, e := s.db.UpdateHouseLucyNumberHouseCurrentRTP(ctx); return e },
+		func() error { _, e := s.db.UpdateHousePawaBoxKeHouse(ctx, houseValue); return e },
+		func() error { _, e := s.db.UpdateKPIVIG(ctx, houseValue); return e },
+		func() error {
+			_, e := s.db.InsertHouseLogsPawaBoxKeGameID(ctx, gameID, "house_income", msisdn, houseValue)
+			return e
+		},
+		func() error { _, e := s.db.UpdateHousePawaBoxKeBasket(ctx, basket_Value); return e },
+
+		func() error {
+			_, err := s.db.InsertHouseBasketLogs(ctx, 0, basket_Value, basket_Value, fmt.Sprintf("%.2f added to the basket:- game id %s", basket_Value, gameID))
+			return err
+		},
+	}
+
+	if err := s.accounts.run(ctx, tasks...); err != nil {
+		return SpinResponse{}, err
+	}
+	if err := s.advanceRound(ctx, gameID, database.RoundPlayed, actorGame, "spin"); err != nil {
+		return SpinResponse{}, err
+	}
+
+	//----------------------------------------------------
+	// RTP CALC
+	//----------------------------------------------------
+
+	//----------------------------------------------------
+
+	// Calculate min/max win
+	minWin := BetAmount * minMul
+	maxWin := math.Min(BetAmount*maxMul, gameExposure)
+	// Apply basket cap (80%)
+	maxWin = math.Min(maxWin, basketValue*0.80)
+	// Generate potential win amount
+	winAmt := cryptoRandFloatRange(minWin, maxWin)
+	// Calculate current RTP day
+	currentRTPDay := database.RTP(kpiPay+winAmt, kpiBet)
+
+	// Define RTP limits
+	rtpLimit := defaultRTP + adjustRTP + jackpotspin
+	tooHigh := currentRTPDay > rtpLimit || playerRTP > (rtpLimit+vig+overload)
+
+	logrus.Infof("rtpLimit : %.2f", rtpLimit)
+	logrus.Infof("currentRTPDay : %.2f", currentRTPDay)
+	logrus.Infof("playerRTP : %.2f", playerRTP)
+	logrus.Infof("overload_rtp : %.2f", (rtpLimit + vig + overload))
+
+	// Hard loss conditions
+	minLossCount := cryptoRandIndex(settings.MinLossCount)
+
+	// 	forceWin := params.PlayerLostCount >= int64(params.MinLossCount+10)
+	// if forceWin {
+
+	logrus.Infof("playerLost : %d", playerLost)
+	logrus.Infof("minLossCount : %d", minLossCount)
+
+	cherries_three := BetAmount * 50
+	apple_three := BetAmount * 20
+	oranges_three := BetAmount * 15
+	grapes_three := BetAmount * 5
+
+	cherries_two := BetAmount * 40
+	apple_two := BetAmount * 10
+	oranges_two := BetAmount * 5
+
+	type payoutOption struct {
+		amount float64
+		match  int // 2 or 3 symbols match
+		symbol int // 0=cherries, 1=apple, 2=oranges, 3=grapes
+	}
+	forcedPayouts := []payoutOption{
+		{cherries_three, 3, 0},
+		{apple_three, 3, 1},
+		{oranges_three, 3, 2},
+		{grapes_three, 3, 3},
+		{cherries_two, 2, 0},
+		{apple_two, 2, 1},
+		{oranges_two, 2, 2},
+	}
+
+	if playerLost >= minLossCount {
+
+		logrus.Infof("playerLost : %d", playerLost)
+		logrus.Infof("minLossCount : %d", minLossCount)
+		if maxWin < minWin {
+			return hardLoss() // cannot afford a win
+		}
+		//----------------------------------------------------
+		// 100% RANDOM FORCED WIN USING CRYPTO RNG
+		//----------------------------------------------------
+
+		// Absolute maximum system allows based on RTP
+		// maxAllowedPayout := (rtpLimit/100.0)*kpiBet - kpiPay
+		// if maxAllowedPayout <= 0 {
+		// 	return hardLoss()
+		// }
+
+		// Remove negative exposures
+		// maxAllowedPayout = math.Max(maxAllowedPayout, 0)
+
+		// Also must respect game exposure and basket limits
+		absoluteMax := maxWin // maxWin already includes exposure & basket caps
+
+		if absoluteMax <= 0 {
+			return hardLoss()
+		}
+		// ------------------------------------------------------------
+		// FULL-RANDOM: forcedAmount anywhere between 0 and absoluteMax
+		// ------------------------------------------------------------
+		// Filter allowed payouts based on basket & absolute max
+		allowedPayouts := make([]payoutOption, 0)
+		for _, val := range forcedPayouts {
+			if val.amount <= basketValue && val.amount <= absoluteMax {
+				allowedPayouts = append(allowedPayouts, val)
+			}
+		}
+
+		// No valid payouts → hard loss
+		if len(allowedPayouts) == 0 {
+			return hardLoss()
+		}
+
+		// Pick a random allowed payout
+		idx := cryptoRandIndex(len(allowedPayouts))
+		chosen := allowedPayouts[idx]
+		forcedAmount := chosen.amount
+		symbolIndex := chosen.symbol // <- now you know which symbol to force
+		matchSymbol := chosen.match
+		// Compute new RTP
+		currentRTPDay := database.RTP(kpiPay+forcedAmount, kpiBet)
+
+		logrus.Infof("[FORCE-WIN COMPLETE] Forced win=%.2f, symbolIndex=%d, adjustable_rtp=%.2f, target_rtp=%.2f, basket=%.2f",
+			currentRTPDay, symbolIndex, adjustRTP, rtpLimit, forcedAmount)
+
+		// If RTP too high → try smaller payouts
+		if currentRTPDay > rtpLimit {
+			sorted := allowedPayouts // assume sorted ascending by amount
+			for _, p := range sorted {
+				if database.RTP(kpiPay+p.amount, kpiBet) <= rtpLimit {
+					forcedAmount = p.amount
+					symbolIndex = p.symbol
+					matchSymbol = p.match
+					currentRTPDay = database.RTP(kpiPay+forcedAmount, kpiBet)
+					break
+				}
+			}
+			// Still too high → hard loss
+			if currentRTPDay > rtpLimit {
+				return hardLoss()
+			}
+		}
+
+		// Final log
+		logrus.Infof("[FORCED-WIN RANDOM] forcedAmount=%.2f  maxAllowed=%.2f RTP=%.2f",
+			forcedAmount, absoluteMax, currentRTPDay)
+
+		// Check basket coverage
+		if forcedAmount > basketValue || forcedAmount < 1 {
+			return hardLoss()
+		}
+
+		// Assign final forced win
+		amount := forcedAmount
+
+		logrus.Infof("[FORCE-WIN COMPLETE] Forced win=%.2f, adjustable_rtp=%.2f, target_rtp=%.2f, basket=%.2f",
+			amount, kpiPay, rtpLimit, amount)
+
+		if basketValue > amount {
+			tax := calcTax(amount)
+			// Force a matching row (3 symbols match)
+
+			row := forcedMatchFromLeft(symbols, symbolIndex, matchSymbol)
+			logrus.Infof("minLossCount : %.2f", amount)
+			logrus.Infof("minLossCount : %.2f", tax.NetAmount)
+			if err := s.advanceRound(ctx, gameID, database.RoundSettled, actorGame, fmt.Sprintf("spin win %.2f", amount)); err != nil {
+				return SpinResponse{}, err
+			}
+			// Record win without adjusting RTP
+			if err := s.winSpin(ctx, playerID, playerPayout, playerTotalBets, utils.ToString(row), tax, msisdn, gameID); err != nil {
+				return SpinResponse{}, err
+			}
+			err := s.accounts.run(ctx,
+				func() error {
+					_, err := s.db.UpdateLuckyBetWin(
+						ctx,
+						utils.ToString(row),
+						"SPIN&WIN",
+						gameID,
+						amount,
+						status.ResultWin,
+					)
+					return err
+				},
+				func() error {
+					_, err := s.db.UpdateKPIPayouts(
+						ctx,
+						amount,
+						tax.TaxAmount,
+						0,
+					)
+					return err
+				},
+				func() error {
+					_, err := s.db.UpdateKPIChannelPayout(ctx, channel, amount)
+					return err
+				},
+			)
+			// -----------------------------------------------------
+			// Wait for all of them to finish. If ANY fails → returns error
+			// -----------------------------------------------------
+			if err != nil {
+				return SpinResponse{}, fmt.Errorf("parallel update failed: %w", err)
+			}
+			s.recordSpin(ctx, player, gameID, row, BetAmount, amount)
+			return SpinResponse{
+				Row:       row,
+				Win:       true,
+				WinAmount: tax.NetAmount,
+				GameID:    gameID,
+			}, nil
+		} else {
+			return hardLoss()
+		}
+	} else {
+
+		if winAmt > basketValue || tooHigh {
+			return hardLoss()
+		}
+		// ------------------------------
+		// NORMAL WIN (if allowed by RTP)
+		// ------------------------------
+		tax := calcTax(winAmt)
+		row := forcedMatch() // matching row
+		if err := s.advanceRound(ctx, gameID, database.RoundSettled, actorGame, fmt.Sprintf("spin win %.2f", winAmt)); err != nil {
+			return SpinResponse{}, err
+		}
+		if err := s.winSpin(ctx, playerID, playerPayout, playerTotalBets, utils.ToString(row), tax, msisdn, gameID); err != nil {
+			return SpinResponse{}, err
+		}
+
+		_, _ = s.db.UpdateLuckyBetWin(ctx, utils.ToString(row), "SPIN&WIN", gameID, winAmt, status.ResultWin)
+		s.recordSpin(ctx, player, gameID, row, BetAmount, winAmt)
+
+		return SpinResponse{
+			Row:       row,
+			Win:       true,
+			WinAmount: winAmt,
+			GameID:    gameID,
+		}, nil
+	}
+
+}
+
+func forcedMatchingRow(symbols []string) []string {
+	s := symbols[cryptoRandIndex(len(symbols))]
+	return []string{s, s, s}
+}
+
+func randomNonMatchingRow(symbols []string) []string {
+	if len(symbols) < 2 {
+		panic("need at least 2 symbols")
+	}
+	row := make([]string, 3)
+	// Pick first symbol
+	firstIdx := cryptoRandIndex(len(symbols))
+	first := symbols[firstIdx]
+	row[0] = first
+
+	// Build allowed indices (everything except first)
+	allowed := make([]string, 0, len(symbols)-1)
+	for i, s := range symbols {
+		if i != firstIdx {
+			allowed = append(allowed, s)
+		}
+	}
+
+	// Pick remaining symbols from allowed set (no retries)
+	row[1] = allowed[cryptoRandIndex(len(allowed))]
+	row[2] = allowed[cryptoRandIndex(len(allowed))]
+
+	return row
+}
+
+// winSpin records a spin win, crediting it like a box win
+func (s *LuckyNumberService) winSpin(ctx context.Context, playerID int64, payout, bets float64, winItem string, tax taxcalc.Win, msisdn, reference string) error {
+	_, err := s.creditWin(ctx, playerID, winItem, tax, msisdn, reference, spinWin)
+	return err
+}
+
+type SpinPrerequisites struct {
+	Basket   map[string]interface{}
+	Settings database.Settings
+	KPI      map[string]interface{}
+	Player   map[string]interface{}
+	Tax      taxRates // in effect now: a spin settles as it is placed
+}
+
+func (s *LuckyNumberService) loadSpinData(ctx context.Context, gameCatID, msisdn string) (*SpinPrerequisites, error) {
+
+	var r SpinPrerequisites
+	var rates map[string]float64
+	err := s.accounts.run(ctx,
+		func() (err error) {
+			r.Basket, err = s.db.CheckBasketLucky(ctx)
+			return err
+		},
+		func() (err error) {
+			r.Settings, err = s.settings(ctx)
+			return err
+		},
+		func() (err error) {
+			r.KPI, err = s.db.CheckSettingKPI(ctx)
+			return err
+		},
+		func() (err error) {
+			rates, err = s.storedTaxRates(ctx, "")
+			return err
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Tax = taxRatesFrom(rates, r.Settings)
+	return &r, nil
+}
+
+// spinWinLine evaluates the single pay line of a 3-drum row: two or three
+// identical symbols matching from the left pay out.
+func spinWinLine(row []string) (symbol string, count int, positions []models.Position) {
+	if len(row) == 0 {
+		return "", 0, nil
+	}
+	symbol = row[0]
+	count = 1
+	for count < len(row) && row[count] == symbol {
+		count++
+	}
+	if count < 2 {
+		return "", 0, nil
+	}
+	for drum := 0; drum < count; drum++ {
+		positions = append(positions, models.Position{Drum: drum, Row: 0})
+	}
+	return symbol, count, positions
+}
+
+// recordSpin persists the spin and its winning line. The money movements have
+// already been committed by then, so a failure here is logged, not returned.
+func (s *LuckyNumberService) recordSpin(ctx context.Context, player map[string]interface{}, spinID string, row []string, stake, winAmount float64) {
+	drums, err := json.Marshal(row)
+	if err != nil {
+		logrus.Errorf("Failed to encode spin %s drums: %v", spinID, err)
+		return
+	}
+
+	isWin := winAmount > 0
+	spinResultID, err := s.db.InsertSpinResult(ctx,
+		utils.ToString(player["id"]), spinID, drums,
+		int64(round(stake)), int64(round(winAmount)), int64(round(utils.NumericFloat(player["balance"]))), isWin)
+	if err != nil {
+		logrus.Errorf("Failed to persist spin %s: %v", spinID, err)
+		return
+	}
+	if !isWin {
+		return
+	}
+
+	symbol, count, positions := spinWinLine(row)
+	if count == 0 {
+		return
+	}
+	encoded, err := json.Marshal(positions)
+	if err != nil {
+		logrus.Errorf("Failed to encode spin %s win line: %v", spinID, err)
+		return
+	}
+	if _, err := s.db.InsertSpinWinLine(ctx, spinResultID, 1, symbol, count, int64(round(winAmount)), encoded); err != nil {
+		logrus.Errorf("Failed to persist spin %s win line: %v", spinID, err)
+	}
+}
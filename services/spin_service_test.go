@@ -0,0 +1,251 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fiberapp/taxcalc"
+	"testing"
+	"time"
+)
+
+// spinPlayer is a player past the settings' MinLossCount of 3, so every
+// spin takes the forced branch: a win when the basket can pay one, a hard
+// loss when it cannot
+func spinPlayer(repo *memRepo) map[string]interface{} {
+	p := repo.addPlayer(testMsisdn, 100)
+	p.LostCount = 3
+	repo.kpi.Handle = 100000 // a day far below the RTP target
+	return p.row()
+}
+
+func TestPlaceBetSpinForcedWin(t *testing.T) {
+	repo := newMemRepo()
+	player := spinPlayer(repo)
+	s := newTestService(t, repo, nil)
+
+	got, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Win {
+		t.Fatalf("spin = %+v, want a forced win", got)
+	}
+	symbol, count, _ := spinWinLine(got.Row)
+	if count < 2 {
+		t.Fatalf("row %v does not match from the left", got.Row)
+	}
+
+	// The stake of 10 pays 5x for three grapes and 5x or 10x for two
+	// oranges or apples; the winnings cap of 10x rules out the rest
+	bet := repo.bets[got.GameID]
+	if bet == nil || bet.Status != status.ResultWin {
+		t.Fatalf("bet = %+v, want a win", bet)
+	}
+	if gross := bet.WinAmount; gross != 50 && gross != 100 {
+		t.Errorf("gross win %v, want 50 or 100", gross)
+	}
+	tax := taxcalc.Withholding(bet.WinAmount, 20)
+	if got.WinAmount != tax.NetAmount {
+		t.Errorf("reported %v, want the net %v", got.WinAmount, tax.NetAmount)
+	}
+
+	p := repo.player(testMsisdn)
+	if p.Balance != 90 || p.TotalBets != 10 || p.Payout != bet.WinAmount {
+		t.Errorf("player = %+v, want the 10 stake debited and the win paid", p)
+	}
+	if len(repo.queued) != 1 || repo.queued[0].Amount != tax.NetAmount {
+		t.Errorf("queued = %+v, want the net win", repo.queued)
+	}
+	if repo.kpi.Payout != bet.WinAmount || repo.kpi.Excise != taxcalc.Excise(10, 12.5) {
+		t.Errorf("kpi = %+v", repo.kpi)
+	}
+
+	if len(repo.spins) != 1 {
+		t.Fatalf("spins = %+v, want one", repo.spins)
+	}
+	spin := repo.spins[0]
+	if !spin.IsWin || spin.SpinID != got.GameID || spin.Stake != 10 || spin.WinAmount != int64(bet.WinAmount) {
+		t.Errorf("spin = %+v", spin)
+	}
+	if want := symbol + "x" + string(rune('0'+count)); spin.Line != want {
+		t.Errorf("win line = %q, want %q", spin.Line, want)
+	}
+}
+
+func TestPlaceBetSpinLossWhenBasketCannotPay(t *testing.T) {
+	repo := newMemRepo()
+	repo.basket = 0
+	player := spinPlayer(repo)
+	s := newTestService(t, repo, nil)
+
+	got, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Win || got.WinAmount != 0 {
+		t.Fatalf("spin = %+v, want a loss", got)
+	}
+	if _, count, _ := spinWinLine(got.Row); count != 0 {
+		t.Errorf("losing row %v matches from the left", got.Row)
+	}
+	if bet := repo.bets[got.GameID]; bet == nil || bet.Status != status.ResultLoss {
+		t.Errorf("bet = %+v, want a loss", bet)
+	}
+	p := repo.player(testMsisdn)
+	if p.Balance != 90 || p.LostCount != 4 || p.TotalLosses != 10 {
+		t.Errorf("player = %+v, want the stake lost", p)
+	}
+	if len(repo.queued)+len(repo.pending) != 0 {
+		t.Errorf("a loss queued payouts")
+	}
+	// 90% of the stake still feeds the basket
+	if !near(repo.basket, 9) {
+		t.Errorf("basket = %v, want 9", repo.basket)
+	}
+	if len(repo.spins) != 1 || repo.spins[0].IsWin || repo.spins[0].Line != "" {
+		t.Errorf("spins = %+v, want one losing spin without a win line", repo.spins)
+	}
+}
+
+func TestPlaceBetSpinStakeFromBonus(t *testing.T) {
+	repo := newMemRepo()
+	player := spinPlayer(repo)
+	p := repo.players[testMsisdn]
+	p.Balance, p.Bonus = 0, 100
+	s := newTestService(t, repo, nil)
+
+	got, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := repo.funding[got.GameID]; f.Bonus != 10 || f.Cash != 0 {
+		t.Errorf("funding = %+v, want the stake from bonus", f)
+	}
+	after := repo.player(testMsisdn)
+	if after.Balance != 0 {
+		t.Errorf("cash = %v, want untouched by a bonus-funded stake", after.Balance)
+	}
+	// A win on a bonus-funded spin goes back to the bonus wallet
+	if got.Win {
+		if !near(after.Bonus, 90+got.WinAmount) || len(repo.queued)+len(repo.pending) != 0 {
+			t.Errorf("bonus %v, queued %+v; want the net %v kept in bonus", after.Bonus, repo.queued, got.WinAmount)
+		}
+	}
+}
+
+func TestPlaceBetSpinRefusesUncoveredStake(t *testing.T) {
+	repo := newMemRepo()
+	player := spinPlayer(repo)
+	p := repo.players[testMsisdn]
+	p.Balance, p.Bonus = 5, 3
+	s := newTestService(t, repo, nil)
+
+	if _, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", ""); !errors.Is(err, database.ErrInsufficientBalance) {
+		t.Fatalf("spin = %v, want ErrInsufficientBalance", err)
+	}
+	if after := repo.player(testMsisdn); after.Balance != 5 || after.Bonus != 3 {
+		t.Errorf("wallets = %v / %v, want untouched", after.Balance, after.Bonus)
+	}
+	if len(repo.bets) != 0 || repo.kpi.Handle != 100000 {
+		t.Errorf("refused spin booked: %d bets, handle %v", len(repo.bets), repo.kpi.Handle)
+	}
+}
+
+func TestPlaceBetSpinRounds(t *testing.T) {
+	// A win is queued for payout, so its round ends paid
+	repo := newMemRepo()
+	player := spinPlayer(repo)
+	s := newTestService(t, repo, nil)
+	got, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", "")
+	if err != nil || !got.Win {
+		t.Fatalf("spin = %+v, %v, want a forced win", got, err)
+	}
+	if state := repo.rounds[got.GameID]; state != database.RoundPaid {
+		t.Errorf("winning round = %q, want paid", state)
+	}
+
+	repo = newMemRepo()
+	repo.basket = 0
+	player = spinPlayer(repo)
+	s = newTestService(t, repo, nil)
+	if got, err = s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", ""); err != nil || got.Win {
+		t.Fatalf("spin = %+v, %v, want a loss", got, err)
+	}
+	if state := repo.rounds[got.GameID]; state != database.RoundSettled {
+		t.Errorf("losing round = %q, want settled", state)
+	}
+
+	// A stake the wallets cannot cover fails the round it opened
+	repo = newMemRepo()
+	player = spinPlayer(repo)
+	repo.players[testMsisdn].Balance = 5
+	s = newTestService(t, repo, nil)
+	if _, err := s.PlaceBetSpin(player, "1", testMsisdn, 10, "app", ""); !errors.Is(err, database.ErrInsufficientBalance) {
+		t.Fatalf("spin = %v, want ErrInsufficientBalance", err)
+	}
+	if len(repo.rounds) != 1 {
+		t.Fatalf("rounds = %v, want the one opened", repo.rounds)
+	}
+	for _, state := range repo.rounds {
+		if state != database.RoundFailed {
+			t.Errorf("unfunded round = %q, want failed", state)
+		}
+	}
+}
+
+func TestWinJackpotCreditsBonusShare(t *testing.T) {
+	repo := newMemRepo()
+	p := repo.addPlayer(testMsisdn, 0)
+	s := newTestService(t, repo, nil)
+	const ref = "BET-JACKPOT"
+	repo.bets[ref] = &memBet{Msisdn: testMsisdn, Amount: 50, Status: status.ResultPending, Created: time.Now()}
+	repo.funding[ref] = memFunding{Cash: 25, Bonus: 25}
+
+	tax := taxcalc.Withholding(1000, 20)
+	if err := s.winJackpot(context.Background(), p.ID, 0, 0, "TV", tax, testMsisdn, ref); err != nil {
+		t.Fatal(err)
+	}
+	if got := repo.player(testMsisdn).Bonus; !near(got, 400) {
+		t.Errorf("bonus = %v, want half the net 800", got)
+	}
+	if len(repo.queued) != 1 || !near(repo.queued[0].Amount, 400) {
+		t.Errorf("queued = %+v, want the cash half of the net", repo.queued)
+	}
+}
+
+func TestSpinWinLine(t *testing.T) {
+	cases := []struct {
+		row    []string
+		symbol string
+		count  int
+	}{
+		{[]string{"1", "1", "1"}, "1", 3},
+		{[]string{"2", "2", "0"}, "2", 2},
+		{[]string{"2", "0", "2"}, "", 0},
+		{[]string{"0", "1", "1"}, "", 0},
+		{nil, "", 0},
+	}
+	for _, tc := range cases {
+		symbol, count, positions := spinWinLine(tc.row)
+		if symbol != tc.symbol || count != tc.count || len(positions) != tc.count {
+			t.Errorf("spinWinLine(%v) = %q x%d %v, want %q x%d", tc.row, symbol, count, positions, tc.symbol, tc.count)
+		}
+	}
+}
+
+func TestForcedMatchFromLeft(t *testing.T) {
+	symbols := []string{"0", "1", "2", "3"}
+	for i := 0; i < 50; i++ {
+		if row := forcedMatchFromLeft(symbols, 2, 3); row[0] != "2" || row[1] != "2" || row[2] != "2" {
+			t.Fatalf("three of symbol 2 = %v", row)
+		}
+		if row := forcedMatchFromLeft(symbols, 1, 2); row[0] != "1" || row[1] != "1" || row[2] == "1" {
+			t.Fatalf("two of symbol 1 = %v", row)
+		}
+		if _, count, _ := spinWinLine(randomNonMatchingRow(symbols)); count != 0 {
+			t.Fatal("randomNonMatchingRow matched")
+		}
+	}
+}
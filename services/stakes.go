@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fiberapp/database"
+	"fiberapp/money"
+)
+
+// Stake rule modes, picked from the game's columns in this order
+const (
+	StakeDiscrete = "discrete" // one of allowed_stakes
+	StakeRange    = "range"    // any whole amount from min_stake to max_stake
+	StakeFixed    = "fixed"    // bet_amount only
+)
+
+var ErrUnknownGame = errors.New("game not found")
+
+// StakeRules are the stakes a game accepts
+type StakeRules struct {
+	GameCatID     string    `json:"game_cat_id" example:"1"`
+	Mode          string    `json:"mode" example:"range"`
+	DefaultStake  float64   `json:"default_stake" example:"20"`
+	MinStake      float64   `json:"min_stake,omitempty" example:"10"`
+	MaxStake      float64   `json:"max_stake,omitempty" example:"1000"` // 0: no maximum
+	AllowedStakes []float64 `json:"allowed_stakes,omitempty"`
+}
+
+// StakeError is a stake the game's rules refuse. Code is its message code
+// in the i18n catalog and Limit the amount or amounts the message names.
+type StakeError struct {
+	Code  string
+	Limit interface{}
+}
+
+func (e *StakeError) Error() string {
+	switch e.Code {
+	case "stake_below_min":
+		return fmt.Sprintf("stake must be at least %v", e.Limit)
+	case "stake_above_max":
+		return fmt.Sprintf("stake must be at most %v", e.Limit)
+	case "stake_not_whole":
+		return "stake must be a whole amount"
+	case "stake_not_allowed":
+		return fmt.Sprintf("stake must be one of %v", e.Limit)
+	}
+	return fmt.Sprintf("stake must be %v", e.Limit)
+}
+
+// StakeRules returns the stake rules of gameCatID through the lookup cache,
+// or ErrUnknownGame when no active game has that id
+func (s *LuckyNumberService) StakeRules(gameCatID string) (StakeRules, error) {
+	if s == nil || s.db == nil {
+		return StakeRules{}, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.lookups.Get(context.Background(), "stakes:"+gameCatID, func(ctx context.Context) (map[string]interface{}, error) {
+		stored, err := s.game(ctx, gameCatID)
+		if err != nil || stored == nil || !stored.Active() {
+			return nil, err
+		}
+		return map[string]interface{}{"rules": stakeRulesOf(gameCatID, stored.GameStakeRules)}, nil
+	})
+	if err != nil {
+		return StakeRules{}, err
+	}
+	rules, ok := row["rules"].(StakeRules)
+	if !ok {
+		return StakeRules{}, ErrUnknownGame
+	}
+	return rules, nil
+}
+
+// stakeRulesOf returns the stake rules the stake columns of game
+// gameCatID make
+func stakeRulesOf(gameCatID string, stored database.GameStakeRules) StakeRules {
+	rules := StakeRules{GameCatID: gameCatID, Mode: StakeFixed, DefaultStake: stored.BetAmount}
+	switch {
+	case len(stored.AllowedStakes) > 0:
+		rules.Mode = StakeDiscrete
+		rules.AllowedStakes = slices.Clone(stored.AllowedStakes)
+		slices.Sort(rules.AllowedStakes)
+		rules.AllowedStakes = slices.Compact(rules.AllowedStakes)
+		if !slices.Contains(rules.AllowedStakes, rules.DefaultStake) {
+			rules.DefaultStake = rules.AllowedStakes[0]
+		}
+	case stored.MinStake != nil || stored.MaxStake != nil:
+		rules.Mode = StakeRange
+		if stored.MinStake != nil {
+			rules.MinStake = *stored.MinStake
+		}
+		if stored.MaxStake != nil {
+			rules.MaxStake = *stored.MaxStake
+		}
+		if rules.Check(rules.DefaultStake) != nil {
+			rules.DefaultStake = math.Max(math.Ceil(rules.MinStake), 1)
+		}
+	}
+	return rules
+}
+
+// Check returns a *money.Error when amount is not a valid stake at all
+// (not a number, not above 0, fractions of a cent) and a *StakeError when
+// the rules refuse it
+func (r StakeRules) Check(amount float64) error {
+	if err := money.Check(money.Stake, amount); err != nil {
+		return err
+	}
+	switch r.Mode {
+	case StakeDiscrete:
+		if !slices.Contains(r.AllowedStakes, amount) {
+			return &StakeError{Code: "stake_not_allowed", Limit: strings.Join(r.Options(), ", ")}
+		}
+	case StakeRange:
+		switch {
+		case amount <= 0 || amount < r.MinStake:
+			return &StakeError{Code: "stake_below_min", Limit: math.Max(r.MinStake, 1)}
+		case r.MaxStake > 0 && amount > r.MaxStake:
+			return &StakeError{Code: "stake_above_max", Limit: r.MaxStake}
+		case amount != math.Trunc(amount):
+			return &StakeError{Code: "stake_not_whole"}
+		}
+	default:
+		if amount != r.DefaultStake {
+			return &StakeError{Code: "invalid_bet_amount", Limit: r.DefaultStake}
+		}
+	}
+	return nil
+}
+
+// Options lists the stakes a client can offer: every allowed stake, the
+// bounds of a range, or the fixed amount
+func (r StakeRules) Options() []string {
+	var amounts []float64
+	switch r.Mode {
+	case StakeDiscrete:
+		amounts = r.AllowedStakes
+	case StakeRange:
+		amounts = []float64{math.Max(r.MinStake, 1)}
+		if r.MaxStake > 0 {
+			amounts = append(amounts, r.MaxStake)
+		}
+	default:
+		amounts = []float64{r.DefaultStake}
+	}
+	options := make([]string, len(amounts))
+	for i, a := range amounts {
+		options[i] = strconv.FormatFloat(a, 'f', -1, 64)
+	}
+	return options
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"errors"
+	"fiberapp/database"
+	"fiberapp/money"
+	"math"
+	"slices"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 { return &v }
+
+// stakeCode returns the code Check refuses amount with, "" when accepted
+func stakeCode(t *testing.T, r StakeRules, amount float64) string {
+	t.Helper()
+	err := r.Check(amount)
+	var stake *StakeError
+	var m *money.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &stake):
+		return stake.Code
+	case errors.As(err, &m):
+		return m.Code
+	}
+	t.Fatalf("Check(%v) = %v, want a *StakeError or *money.Error", amount, err)
+	return ""
+}
+
+func TestStakeRulesDiscrete(t *testing.T) {
+	r := stakeRulesOf("1", database.GameStakeRules{BetAmount: 20, AllowedStakes: []float64{100, 20, 50, 20}})
+	if r.Mode != StakeDiscrete || !slices.Equal(r.AllowedStakes, []float64{20, 50, 100}) || r.DefaultStake != 20 {
+		t.Fatalf("rules = %+v, want discrete 20, 50, 100 defaulting to 20", r)
+	}
+	cases := map[float64]string{20: "", 50: "", 100: "", 30: "stake_not_allowed", 1000: "stake_not_allowed", 0: "amount_not_positive"}
+	for amount, want := range cases {
+		if got := stakeCode(t, r, amount); got != want {
+			t.Errorf("discrete Check(%v) = %q, want %q", amount, got, want)
+		}
+	}
+	var stake *StakeError
+	if !errors.As(r.Check(30), &stake) || stake.Limit != "20, 50, 100" {
+		t.Errorf("refusal = %+v, want it to name the allowed stakes", stake)
+	}
+	if got := r.Options(); !slices.Equal(got, []string{"20", "50", "100"}) {
+		t.Errorf("options = %v", got)
+	}
+
+	// A bet_amount outside the set does not become the default
+	r = stakeRulesOf("1", database.GameStakeRules{BetAmount: 25, AllowedStakes: []float64{50, 10}})
+	if r.DefaultStake != 10 {
+		t.Errorf("default = %v, want the smallest allowed stake", r.DefaultStake)
+	}
+}
+
+func TestStakeRulesRange(t *testing.T) {
+	r := stakeRulesOf("1", database.GameStakeRules{BetAmount: 20, MinStake: floatPtr(10), MaxStake: floatPtr(1000)})
+	if r.Mode != StakeRange || r.MinStake != 10 || r.MaxStake != 1000 || r.DefaultStake != 20 {
+		t.Fatalf("rules = %+v, want range 10 to 1000 defaulting to 20", r)
+	}
+	cases := map[float64]string{
+		10: "", 11: "", 1000: "",
+		9: "stake_below_min", 1001: "stake_above_max", 10.5: "stake_not_whole",
+		-5: "amount_not_positive", math.NaN(): "amount_not_number", 10.001: "amount_cents",
+	}
+	for amount, want := range cases {
+		if got := stakeCode(t, r, amount); got != want {
+			t.Errorf("range Check(%v) = %q, want %q", amount, got, want)
+		}
+	}
+	if got := r.Options(); !slices.Equal(got, []string{"10", "1000"}) {
+		t.Errorf("options = %v, want the bounds", got)
+	}
+
+	// No maximum, and a default below the minimum moves up to it
+	r = stakeRulesOf("1", database.GameStakeRules{BetAmount: 5, MinStake: floatPtr(49.5)})
+	if r.DefaultStake != 50 || stakeCode(t, r, 1_000_000) != "" || stakeCode(t, r, 49) != "stake_below_min" {
+		t.Errorf("open range = %+v, want default 50 and no maximum", r)
+	}
+	if got := r.Options(); !slices.Equal(got, []string{"49.5"}) {
+		t.Errorf("options = %v, want the minimum only", got)
+	}
+	// Only a maximum: anything positive up to it
+	r = stakeRulesOf("1", database.GameStakeRules{MaxStake: floatPtr(100)})
+	if r.DefaultStake != 1 || stakeCode(t, r, 1) != "" || stakeCode(t, r, 101) != "stake_above_max" {
+		t.Errorf("max-only range = %+v", r)
+	}
+}
+
+func TestStakeRulesFixed(t *testing.T) {
+	r := stakeRulesOf("1", database.GameStakeRules{BetAmount: 20})
+	if r.Mode != StakeFixed || r.DefaultStake != 20 {
+		t.Fatalf("rules = %+v, want fixed at 20", r)
+	}
+	cases := map[float64]string{20: "", 20.5: "invalid_bet_amount", 30: "invalid_bet_amount", 0: "amount_not_positive"}
+	for amount, want := range cases {
+		if got := stakeCode(t, r, amount); got != want {
+			t.Errorf("fixed Check(%v) = %q, want %q", amount, got, want)
+		}
+	}
+	if got := r.Options(); !slices.Equal(got, []string{"20"}) {
+		t.Errorf("options = %v", got)
+	}
+}
+
+func TestStakeRulesFromGame(t *testing.T) {
+	repo := newMemRepo()
+	repo.games["1"].GameStakeRules = database.GameStakeRules{BetAmount: 20, AllowedStakes: []float64{20, 50}}
+	repo.games["2"] = &database.Game{ID: "2", Status: "inactive", GameStakeRules: database.GameStakeRules{BetAmount: 20}}
+	s := newTestService(t, repo, nil)
+
+	r, err := s.StakeRules("1")
+	if err != nil || r.Mode != StakeDiscrete || r.GameCatID != "1" {
+		t.Errorf("game 1 rules = %+v, %v, want its allowed stakes", r, err)
+	}
+	for _, id := range []string{"2", "9"} {
+		if _, err := s.StakeRules(id); !errors.Is(err, ErrUnknownGame) {
+			t.Errorf("game %s = %v, want ErrUnknownGame", id, err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"context"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+)
+
+// StatusAuditRow is a value found in a status column that is not in its
+// vocabulary (package status), with the number of rows that hold it
+type StatusAuditRow struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	Count  int64  `json:"count"`
+}
+
+// AuditStatuses lists the out-of-vocabulary statuses stored in the bet,
+// deposit and withdrawal tables. It scans them whole, so it gets a minute.
+func (s *LuckyNumberService) AuditStatuses() ([]StatusAuditRow, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rows, err := s.db.AuditStatuses(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]StatusAuditRow, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, StatusAuditRow{
+			Table:  utils.ToString(row["table_name"]),
+			Column: utils.ToString(row["column_name"]),
+			Value:  utils.ToString(row["value"]),
+			Count:  utils.ToInt64(row["count"]),
+		})
+	}
+	return out, nil
+}
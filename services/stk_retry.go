@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrDepositNotPending = errors.New("deposit is no longer pending")
+	ErrSTKRetryExpired   = errors.New("deposit is too old to retry, start a new one")
+	ErrSTKRetryLimit     = errors.New("STK retry limit reached, start a new deposit")
+	ErrSTKRetryTooSoon   = errors.New("STK was sent too recently")
+)
+
+// STKRetry describes a re-pushed STK. On ErrSTKRetryTooSoon only
+// RetryAllowedAfter is set.
+type STKRetry struct {
+	Reference         string `json:"reference"`
+	RetriesLeft       int    `json:"retries_left"`
+	RetryAllowedAfter int64  `json:"retry_allowed_after"` // seconds until the next retry
+}
+
+// RetrySTK sends the STK of msisdn's pending deposit request reference
+// again, under the same reference and on the shortcode of the first push.
+// A request may be re-pushed limits.stk_retry_max times,
+// limits.stk_retry_spacing apart, until it is limits.stk_retry_max_age old.
+func (s *LuckyNumberService) RetrySTK(msisdn, reference string) (STKRetry, error) {
+	if s == nil || s.db == nil {
+		return STKRetry{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+	if err := s.checkDeposits(ctx); err != nil {
+		return STKRetry{}, err
+	}
+
+	row, err := s.db.GetSTKRetry(ctx, reference)
+	if err != nil {
+		return STKRetry{}, err
+	}
+	if row == nil || utils.ToString(row["msisdn"]) != msisdn {
+		return STKRetry{}, ErrDepositNotFound
+	}
+	if d, err := status.ParseDepositStatus(utils.ToString(row["status"])); err == nil && d != status.DepositPending {
+		return STKRetry{}, ErrDepositNotPending
+	}
+	created, _ := row["date_created"].(time.Time)
+	if time.Since(created) >= limits.STKRetryMaxAge {
+		return STKRetry{}, ErrSTKRetryExpired
+	}
+	retries := int(utils.ToInt64(row["stk_retries"]))
+	if retries >= limits.STKRetryMax {
+		return STKRetry{}, ErrSTKRetryLimit
+	}
+	lastPush, _ := row["last_push"].(time.Time)
+	if wait := time.Until(lastPush.Add(limits.STKRetrySpacing)); wait > 0 {
+		return STKRetry{RetryAllowedAfter: int64((wait + time.Second - 1) / time.Second)}, ErrSTKRetryTooSoon
+	}
+
+	ok, err := s.db.ClaimSTKRetry(ctx, reference, retries, limits.STKRetryMax, limits.STKRetrySpacing)
+	if err != nil {
+		return STKRetry{}, err
+	}
+	if !ok {
+		// settled or re-pushed by a concurrent request
+		return STKRetry{RetryAllowedAfter: int64(limits.STKRetrySpacing / time.Second)}, ErrSTKRetryTooSoon
+	}
+
+	amount := utils.ToFloat64(row["amount"])
+	shortcode := utils.ToString(row["shortcode"])
+	if shortcode == "" {
+		shortcode = limits.DefaultShortcode
+	}
+	if err := s.SendPaymentRequest(msisdn, utils.ToString(amount), reference); err != nil {
+		logrus.Errorf("retry stk %s: payment request failed: %v", reference, err)
+	}
+	if _, err := s.db.InsertSTK(ctx, "", utils.ToString(row["carrier"]), reference, msisdn, amount, shortcode); err != nil {
+		logrus.Errorf("retry stk %s: InsertSTK error: %v", reference, err)
+		return STKRetry{}, err
+	}
+	logrus.Infof("stk: re-pushed %s to %s (%d/%d)", reference, msisdn, retries+1, limits.STKRetryMax)
+
+	return STKRetry{
+		Reference:         reference,
+		RetriesLeft:       limits.STKRetryMax - retries - 1,
+		RetryAllowedAfter: int64(limits.STKRetrySpacing / time.Second),
+	}, nil
+}
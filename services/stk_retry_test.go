@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stkRetryRepo holds one deposit request, PW1 of testMsisdn, and records
+// the STK rows queued for it. Its claim applies the same conditions as
+// Database.ClaimSTKRetry.
+type stkRetryRepo struct {
+	*memRepo
+	smu      sync.Mutex
+	status   interface{} // deposit_requests.status, nil until M-Pesa answers
+	created  time.Time
+	retries  int
+	lastPush time.Time // stk_retried_at, zero until the first retry
+	queued   []string  // shortcodes of the queued STK rows
+}
+
+func newSTKRetryRepo(created time.Time) *stkRetryRepo {
+	return &stkRetryRepo{memRepo: newMemRepo(), created: created}
+}
+
+func (r *stkRetryRepo) GetSTKRetry(ctx context.Context, reference string) (map[string]interface{}, error) {
+	r.smu.Lock()
+	defer r.smu.Unlock()
+	if reference != "PW1" {
+		return nil, nil
+	}
+	last := r.lastPush
+	if last.IsZero() {
+		last = r.created
+	}
+	return map[string]interface{}{
+		"msisdn": testMsisdn, "status": r.status, "carrier": "safaricom", "amount": 50.0, "date_created": r.created,
+		"stk_retries": int32(r.retries), "last_push": last, "shortcode": "4093451",
+	}, nil
+}
+
+func (r *stkRetryRepo) ClaimSTKRetry(ctx context.Context, reference string, retries, maxRetries int, spacing time.Duration) (bool, error) {
+	r.smu.Lock()
+	defer r.smu.Unlock()
+	last := r.lastPush
+	if last.IsZero() {
+		last = r.created
+	}
+	if r.retries != retries || r.retries >= maxRetries || r.status != nil || time.Since(last) < spacing {
+		return false, nil
+	}
+	r.retries++
+	r.lastPush = time.Now()
+	return true, nil
+}
+
+func (r *stkRetryRepo) InsertSTK(ctx context.Context, game, carrier, reference, msisdn string, amount float64, shortcode string) (int64, error) {
+	r.smu.Lock()
+	defer r.smu.Unlock()
+	r.queued = append(r.queued, shortcode)
+	return 1, nil
+}
+
+// configureSTKRetry sets the retry limits and points payment requests at a
+// gateway that counts them
+func configureSTKRetry(t *testing.T, max int, spacing, maxAge time.Duration) *int {
+	t.Helper()
+	savedLimits, savedURL := limits, paymentRequestURL
+	limits.STKRetryMax, limits.STKRetrySpacing, limits.STKRetryMaxAge = max, spacing, maxAge
+	var mu sync.Mutex
+	pushes := new(int)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*pushes++
+		mu.Unlock()
+	}))
+	paymentRequestURL = gateway.URL
+	t.Cleanup(func() {
+		gateway.Close()
+		limits, paymentRequestURL = savedLimits, savedURL
+	})
+	return pushes
+}
+
+// TestRetrySTKCeiling re-pushes until the limit and then refuses
+func TestRetrySTKCeiling(t *testing.T) {
+	pushes := configureSTKRetry(t, 2, 0, 10*time.Minute)
+	repo := newSTKRetryRepo(time.Now().Add(-time.Minute))
+	s := newTestService(t, repo, nil)
+
+	for want := 1; want >= 0; want-- {
+		retry, err := s.RetrySTK(testMsisdn, "PW1")
+		if err != nil || retry.Reference != "PW1" || retry.RetriesLeft != want {
+			t.Fatalf("retry = %+v, %v; want %d left", retry, err, want)
+		}
+	}
+	if _, err := s.RetrySTK(testMsisdn, "PW1"); !errors.Is(err, ErrSTKRetryLimit) {
+		t.Errorf("third retry = %v, want ErrSTKRetryLimit", err)
+	}
+	if repo.retries != 2 || len(repo.queued) != 2 || repo.queued[0] != "4093451" || *pushes != 2 {
+		t.Errorf("%d retries, queued %v, %d pushes; want 2 of each on the first push's shortcode", repo.retries, repo.queued, *pushes)
+	}
+}
+
+// TestRetrySTKSpacing refuses a retry inside the spacing of the first push
+// and of the last retry, saying how long to wait
+func TestRetrySTKSpacing(t *testing.T) {
+	configureSTKRetry(t, 3, 30*time.Second, 10*time.Minute)
+	repo := newSTKRetryRepo(time.Now().Add(-10 * time.Second))
+	s := newTestService(t, repo, nil)
+
+	retry, err := s.RetrySTK(testMsisdn, "PW1")
+	if !errors.Is(err, ErrSTKRetryTooSoon) || retry.RetryAllowedAfter < 19 || retry.RetryAllowedAfter > 20 {
+		t.Fatalf("retry 10s after the push = %+v, %v; want ErrSTKRetryTooSoon with 20s to wait", retry, err)
+	}
+
+	repo.created = time.Now().Add(-31 * time.Second)
+	if retry, err = s.RetrySTK(testMsisdn, "PW1"); err != nil || retry.RetriesLeft != 2 || retry.RetryAllowedAfter != 30 {
+		t.Fatalf("retry 31s after the push = %+v, %v; want 2 left and 30s to the next", retry, err)
+	}
+	if retry, err = s.RetrySTK(testMsisdn, "PW1"); !errors.Is(err, ErrSTKRetryTooSoon) || retry.RetryAllowedAfter != 30 {
+		t.Errorf("retry right after a retry = %+v, %v; want ErrSTKRetryTooSoon with 30s to wait", retry, err)
+	}
+	if repo.retries != 1 || len(repo.queued) != 1 {
+		t.Errorf("%d retries, %d queued; want 1", repo.retries, len(repo.queued))
+	}
+}
+
+// TestRetrySTKRefusals refuses foreign, unknown, settled and expired
+// deposit requests without pushing
+func TestRetrySTKRefusals(t *testing.T) {
+	pushes := configureSTKRetry(t, 2, 0, 10*time.Minute)
+	for name, c := range map[string]struct {
+		msisdn, reference string
+		status            interface{}
+		age               time.Duration
+		want              error
+	}{
+		"foreign":   {"254700000999", "PW1", nil, time.Minute, ErrDepositNotFound},
+		"unknown":   {testMsisdn, "PW9", nil, time.Minute, ErrDepositNotFound},
+		"succeeded": {testMsisdn, "PW1", "success", time.Minute, ErrDepositNotPending},
+		"failed":    {testMsisdn, "PW1", "fail", time.Minute, ErrDepositNotPending},
+		"expired":   {testMsisdn, "PW1", nil, 10 * time.Minute, ErrSTKRetryExpired},
+	} {
+		repo := newSTKRetryRepo(time.Now().Add(-c.age))
+		repo.status = c.status
+		s := newTestService(t, repo, nil)
+		if _, err := s.RetrySTK(c.msisdn, c.reference); !errors.Is(err, c.want) {
+			t.Errorf("%s: retry = %v, want %v", name, err, c.want)
+		}
+		if repo.retries != 0 || len(repo.queued) != 0 {
+			t.Errorf("%s: retried", name)
+		}
+	}
+	if *pushes != 0 {
+		t.Errorf("%d pushes, want none", *pushes)
+	}
+}
+
+// TestRetrySTKConcurrent lets one of many simultaneous retries through
+func TestRetrySTKConcurrent(t *testing.T) {
+	configureSTKRetry(t, 5, 30*time.Second, 10*time.Minute)
+	repo := newSTKRetryRepo(time.Now().Add(-time.Minute))
+	s := newTestService(t, repo, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = s.RetrySTK(testMsisdn, "PW1")
+		}()
+	}
+	wg.Wait()
+	if repo.retries != 1 || len(repo.queued) != 1 {
+		t.Errorf("%d retries, %d queued; want exactly one", repo.retries, len(repo.queued))
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/taxcalc"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidAmount is returned for a tax preview or basket top-up of a
+// non-positive amount
+var ErrInvalidAmount = errors.New("amount must be greater than 0")
+
+// TaxPreview is what a win of GrossAmount pays after withholding tax, plus
+// the excise duty on Stake when one is given
+type TaxPreview struct {
+	GrossAmount        float64 `json:"GrossAmount" example:"1000"`
+	WithholdingPercent float64 `json:"WithholdingPercent" example:"20"`
+	TaxAmount          float64 `json:"TaxAmount" example:"200"`
+	NetAmount          float64 `json:"NetAmount" example:"800"`
+	Stake              float64 `json:"Stake,omitempty"`
+	ExcisePercent      float64 `json:"ExcisePercent,omitempty"`
+	ExciseAmount       float64 `json:"ExciseAmount,omitempty"`
+}
+
+// PreviewTax returns the deductions settlement would apply to a win of
+// amount at the rates in effect now, using the same taxcalc code. A stake > 0
+// also gets its excise duty. A win staked from the bonus wallet pays part
+// of NetAmount back to that wallet, which the preview does not show.
+func (s *LuckyNumberService) PreviewTax(amount, stake float64) (TaxPreview, error) {
+	if s == nil || s.db == nil {
+		return TaxPreview{}, fmt.Errorf("service or database not initialized")
+	}
+	if amount <= 0 {
+		return TaxPreview{}, ErrInvalidAmount
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	settings, err := s.settings(ctx)
+	if err != nil {
+		return TaxPreview{}, err
+	}
+	stored, err := s.storedTaxRates(ctx, "")
+	if err != nil {
+		return TaxPreview{}, err
+	}
+	rates := taxRatesFrom(stored, settings)
+
+	win := taxcalc.Withholding(amount, rates.Withholding)
+	tax, net := win.Payable()
+	preview := TaxPreview{
+		GrossAmount:        win.GrossAmount,
+		WithholdingPercent: win.WithholdingPercent,
+		TaxAmount:          tax,
+		NetAmount:          net,
+	}
+	if stake > 0 {
+		preview.Stake = stake
+		preview.ExcisePercent = rates.Excise
+		preview.ExciseAmount = taxcalc.Excise(stake, preview.ExcisePercent)
+	}
+	return preview, nil
+}
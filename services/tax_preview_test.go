@@ -0,0 +1,49 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPreviewMatchesSettlement settles a win for each amount and checks the
+// preview for the same amount and stake against what was deducted
+func TestPreviewMatchesSettlement(t *testing.T) {
+	for _, gross := range []float64{200, 333, 1007, 45} {
+		repo := newMemRepo()
+		repo.addPlayer(testMsisdn, 100)
+		s := newTestService(t, repo, fixedOutcomes{"1": gross, "2": 0, "3": 20})
+
+		preview, err := s.PreviewTax(gross, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := placeTestBet(t, s, repo, 50, "1").GameResult
+		if got.GrossAmount != preview.GrossAmount || got.TaxAmount != preview.TaxAmount || got.NetAmount != preview.NetAmount {
+			t.Errorf("win of %v settled %v/%v/%v, preview said %v/%v/%v", gross,
+				got.GrossAmount, got.TaxAmount, got.NetAmount, preview.GrossAmount, preview.TaxAmount, preview.NetAmount)
+		}
+		if len(repo.queued) != 1 || repo.queued[0].Amount != preview.NetAmount {
+			t.Errorf("win of %v queued %+v, want the previewed net %v", gross, repo.queued, preview.NetAmount)
+		}
+		if repo.kpi.Excise != preview.ExciseAmount {
+			t.Errorf("stake 50 paid %v excise, preview said %v", repo.kpi.Excise, preview.ExciseAmount)
+		}
+	}
+}
+
+func TestPreviewTax(t *testing.T) {
+	s := newTestService(t, newMemRepo(), nil)
+	preview, err := s.PreviewTax(1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TaxPreview{GrossAmount: 1000, WithholdingPercent: 20, TaxAmount: 200, NetAmount: 800}
+	if preview != want {
+		t.Errorf("preview = %+v, want %+v with no excise", preview, want)
+	}
+	for _, amount := range []float64{0, -5} {
+		if _, err := s.PreviewTax(amount, 0); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("PreviewTax(%v) = %v, want ErrInvalidAmount", amount, err)
+		}
+	}
+}
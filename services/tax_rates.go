@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTaxRateNotFound = errors.New("tax rate not found")
+	ErrInvalidTaxRate  = errors.New("invalid tax rate")
+	// ErrTaxRateInEffect refuses a change to a rate already in effect: past
+	// bets were taxed at it
+	ErrTaxRateInEffect = errors.New("tax rate already in effect")
+)
+
+// taxRates are the excise duty and withholding percentages a round is
+// taxed at
+type taxRates struct {
+	Excise      float64
+	Withholding float64
+}
+
+// taxRatesFrom takes each rate from rates, the "tax_rates" rows that
+// apply, or else from the settings' excise_duty and withholding
+func taxRatesFrom(rates map[string]float64, settings database.Settings) taxRates {
+	tax := taxRates{
+		Excise:      settings.ExciseDuty,
+		Withholding: settings.Withholding,
+	}
+	if rate, ok := rates[database.TaxExcise]; ok {
+		tax.Excise = rate
+	}
+	if rate, ok := rates[database.TaxWithholding]; ok {
+		tax.Withholding = rate
+	}
+	return tax
+}
+
+// storedTaxRates returns the "tax_rates" rows a play applies: those the
+// round of reference was opened with, or for an empty reference those in
+// effect now
+func (s *LuckyNumberService) storedTaxRates(ctx context.Context, reference string) (map[string]float64, error) {
+	if reference == "" {
+		return s.db.TaxRatesAt(ctx, clock.Now())
+	}
+	return s.db.RoundTaxRates(ctx, reference)
+}
+
+// TaxRate is an effective-dated excise or withholding rate, in percent.
+// InEffect rates can no longer be changed or removed.
+type TaxRate struct {
+	ID            int64      `json:"id" example:"3"`
+	TaxType       string     `json:"tax_type" example:"excise"`
+	Rate          float64    `json:"rate" example:"12.5"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	InEffect      bool       `json:"in_effect"`
+	UpdatedBy     string     `json:"updated_by,omitempty"`
+	DateUpdated   *time.Time `json:"date_updated,omitempty"`
+}
+
+// Validate checks a rate before it is created or updated: a known tax
+// type, a percentage and a start still to come
+func (r TaxRate) Validate() error {
+	var problems []string
+	if r.TaxType != database.TaxExcise && r.TaxType != database.TaxWithholding {
+		problems = append(problems, fmt.Sprintf("tax_type must be %s or %s", database.TaxExcise, database.TaxWithholding))
+	}
+	if r.Rate < 0 || r.Rate > 100 {
+		problems = append(problems, "rate must be 0 to 100")
+	}
+	if !r.EffectiveFrom.After(clock.Now()) {
+		problems = append(problems, "effective_from must be in the future")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTaxRate, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// TaxRates returns every tax rate, past and future, by tax type and start
+func (s *LuckyNumberService) TaxRates(ctx context.Context) ([]TaxRate, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.ListTaxRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := clock.Now()
+	rates := make([]TaxRate, 0, len(rows))
+	for _, row := range rows {
+		r := TaxRate{
+			ID:        utils.ToInt64(row["id"]),
+			TaxType:   utils.ToString(row["tax_type"]),
+			Rate:      utils.ToFloat64(row["rate"]),
+			UpdatedBy: utils.ToString(row["updated_by"]),
+		}
+		r.EffectiveFrom, _ = row["effective_from"].(time.Time)
+		r.InEffect = !r.EffectiveFrom.After(now)
+		if d, ok := row["date_updated"].(time.Time); ok {
+			r.DateUpdated = &d
+		}
+		rates = append(rates, r)
+	}
+	return rates, nil
+}
+
+func (s *LuckyNumberService) taxRate(ctx context.Context, id int64) (TaxRate, error) {
+	rates, err := s.TaxRates(ctx)
+	if err != nil {
+		return TaxRate{}, err
+	}
+	for _, r := range rates {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return TaxRate{}, ErrTaxRateNotFound
+}
+
+// CreateTaxRate schedules a rate of r.TaxType from r.EffectiveFrom. Rounds
+// opened from then on are taxed at it.
+func (s *LuckyNumberService) CreateTaxRate(admin string, r TaxRate) (TaxRate, error) {
+	if s == nil || s.db == nil {
+		return TaxRate{}, fmt.Errorf("service or database not initialized")
+	}
+	if err := r.Validate(); err != nil {
+		return TaxRate{}, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	id, err := s.db.InsertTaxRate(ctx, r.TaxType, r.Rate, r.EffectiveFrom, admin)
+	if errors.Is(err, database.ErrTaxRateExists) {
+		return TaxRate{}, fmt.Errorf("%w: %v", ErrInvalidTaxRate, err)
+	}
+	if err != nil {
+		return TaxRate{}, err
+	}
+	logrus.Warnf("tax rates: %s scheduled %s at %.2f%% from %s", admin, r.TaxType, r.Rate, r.EffectiveFrom.Format(time.RFC3339))
+	return s.taxRate(ctx, id)
+}
+
+// UpdateTaxRate changes the rate and start of a rate not yet in effect.
+// Its tax type stays.
+func (s *LuckyNumberService) UpdateTaxRate(admin string, id int64, r TaxRate) (TaxRate, error) {
+	if s == nil || s.db == nil {
+		return TaxRate{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored, err := s.taxRate(ctx, id)
+	if err != nil {
+		return TaxRate{}, err
+	}
+	if stored.InEffect {
+		return TaxRate{}, ErrTaxRateInEffect
+	}
+	r.TaxType = stored.TaxType
+	if err := r.Validate(); err != nil {
+		return TaxRate{}, err
+	}
+
+	n, err := s.db.UpdateTaxRate(ctx, id, r.Rate, r.EffectiveFrom, admin)
+	if errors.Is(err, database.ErrTaxRateExists) {
+		return TaxRate{}, fmt.Errorf("%w: %v", ErrInvalidTaxRate, err)
+	}
+	if err != nil {
+		return TaxRate{}, err
+	}
+	if n == 0 {
+		// it took effect since it was read
+		return TaxRate{}, ErrTaxRateInEffect
+	}
+	logrus.Warnf("tax rates: %s moved %s rate %d to %.2f%% from %s", admin, r.TaxType, id, r.Rate, r.EffectiveFrom.Format(time.RFC3339))
+	return s.taxRate(ctx, id)
+}
+
+// DeleteTaxRate removes a rate not yet in effect
+func (s *LuckyNumberService) DeleteTaxRate(admin string, id int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stored, err := s.taxRate(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stored.InEffect {
+		return ErrTaxRateInEffect
+	}
+	n, err := s.db.DeleteTaxRate(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTaxRateInEffect
+	}
+	logrus.Warnf("tax rates: %s removed %s rate %d", admin, stored.TaxType, id)
+	return nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/status"
+	"fiberapp/taxcalc"
+	"testing"
+	"time"
+)
+
+type memTaxRate struct {
+	id            int64
+	taxType       string
+	rate          float64
+	effectiveFrom time.Time
+}
+
+type memTaxRecord struct {
+	taxType   string
+	taxAmount float64
+	rate      float64
+}
+
+// taxRateRepo keeps "tax_rates" rows and looks them up as TaxRatesAt does.
+// CreateRound stores the rates in effect at the clock's now on the round,
+// then runs onRound, which tests use to change the rates mid-flight.
+type taxRateRepo struct {
+	*memRepo
+	rates      []memTaxRate
+	roundRates map[string]map[string]float64
+	taxRows    []memTaxRecord
+	onRound    func()
+	stale      bool // the UPDATE and DELETE find the rate in effect
+}
+
+func newTaxRateRepo() *taxRateRepo {
+	return &taxRateRepo{memRepo: newMemRepo(), roundRates: map[string]map[string]float64{}}
+}
+
+func (r *taxRateRepo) addRate(taxType string, rate float64, from time.Time) int64 {
+	id := int64(len(r.rates) + 1)
+	r.rates = append(r.rates, memTaxRate{id, taxType, rate, from})
+	return id
+}
+
+func (r *taxRateRepo) TaxRatesAt(ctx context.Context, at time.Time) (map[string]float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rates := map[string]float64{}
+	latest := map[string]time.Time{}
+	for _, row := range r.rates {
+		if !row.effectiveFrom.After(at) && !row.effectiveFrom.Before(latest[row.taxType]) {
+			rates[row.taxType], latest[row.taxType] = row.rate, row.effectiveFrom
+		}
+	}
+	return rates, nil
+}
+
+func (r *taxRateRepo) CreateRound(ctx context.Context, reference, msisdn, gameCatID string, amount float64, actor, detail string) error {
+	if err := r.memRepo.CreateRound(ctx, reference, msisdn, gameCatID, amount, actor, detail); err != nil {
+		return err
+	}
+	rates, _ := r.TaxRatesAt(ctx, clock.Now())
+	r.mu.Lock()
+	r.roundRates[reference] = rates
+	r.mu.Unlock()
+	if r.onRound != nil {
+		r.onRound()
+	}
+	return nil
+}
+
+func (r *taxRateRepo) RoundTaxRates(ctx context.Context, reference string) (map[string]float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.roundRates[reference], nil
+}
+
+func (r *taxRateRepo) InsertTaxQueue(ctx context.Context, gameID string, amount, taxAmount, taxDeductedAmount, rate float64, taxType, msisdn string) (int64, error) {
+	r.mu.Lock()
+	r.taxRows = append(r.taxRows, memTaxRecord{taxType, taxAmount, rate})
+	r.mu.Unlock()
+	return r.memRepo.InsertTaxQueue(ctx, gameID, amount, taxAmount, taxDeductedAmount, rate, taxType, msisdn)
+}
+
+func (r *taxRateRepo) taxRow(taxType string) (memTaxRecord, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, row := range r.taxRows {
+		if row.taxType == taxType {
+			return row, true
+		}
+	}
+	return memTaxRecord{}, false
+}
+
+func (r *taxRateRepo) ListTaxRates(ctx context.Context) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	for _, row := range r.rates {
+		rows = append(rows, map[string]interface{}{"id": row.id, "tax_type": row.taxType, "rate": row.rate, "effective_from": row.effectiveFrom})
+	}
+	return rows, nil
+}
+
+func (r *taxRateRepo) InsertTaxRate(ctx context.Context, taxType string, rate float64, effectiveFrom time.Time, admin string) (int64, error) {
+	for _, row := range r.rates {
+		if row.taxType == taxType && row.effectiveFrom.Equal(effectiveFrom) {
+			return 0, database.ErrTaxRateExists
+		}
+	}
+	return r.addRate(taxType, rate, effectiveFrom), nil
+}
+
+func (r *taxRateRepo) UpdateTaxRate(ctx context.Context, id int64, rate float64, effectiveFrom time.Time, admin string) (int64, error) {
+	for i, row := range r.rates {
+		if row.id == id && !r.stale {
+			r.rates[i].rate, r.rates[i].effectiveFrom = rate, effectiveFrom
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func (r *taxRateRepo) DeleteTaxRate(ctx context.Context, id int64) (int64, error) {
+	for i, row := range r.rates {
+		if row.id == id && !r.stale {
+			r.rates = append(r.rates[:i], r.rates[i+1:]...)
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func TestTaxRatesFallBackToSettings(t *testing.T) {
+	settings := database.Settings{ExciseDuty: 12.5, Withholding: 20}
+	if got := taxRatesFrom(nil, settings); got != (taxRates{Excise: 12.5, Withholding: 20}) {
+		t.Errorf("no rates = %+v, want the settings", got)
+	}
+	if got := taxRatesFrom(map[string]float64{database.TaxWithholding: 0}, settings); got != (taxRates{Excise: 12.5, Withholding: 0}) {
+		t.Errorf("a zero withholding rate = %+v, want it kept over the setting", got)
+	}
+}
+
+func TestTaxRateEffectiveBoundary(t *testing.T) {
+	defer clock.ConfigureSource(nil)
+	from := time.Date(2026, 7, 1, 0, 0, 0, 0, clock.Location())
+	repo := newTaxRateRepo()
+	repo.addRate(database.TaxExcise, 15, from.Add(-30*24*time.Hour))
+	repo.addRate(database.TaxExcise, 20, from)
+	repo.addRate(database.TaxWithholding, 25, from)
+	s := newTestService(t, repo, nil)
+
+	cases := []struct {
+		at                  time.Time
+		excise, withholding float64
+	}{
+		{from.Add(-time.Nanosecond), 15, 20}, // withholding still from the settings
+		{from, 20, 25},
+		{from.Add(time.Hour), 20, 25},
+	}
+	for _, tc := range cases {
+		clock.ConfigureSource(func() time.Time { return tc.at })
+		preview, err := s.PreviewTax(1000, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preview.ExcisePercent != tc.excise || preview.WithholdingPercent != tc.withholding ||
+			preview.ExciseAmount != taxcalc.Excise(100, tc.excise) {
+			t.Errorf("at %s: preview = %+v, want excise %.1f%% and withholding %.1f%%", tc.at, preview, tc.excise, tc.withholding)
+		}
+	}
+}
+
+func TestRoundTaxedAtOpeningRates(t *testing.T) {
+	repo := newTaxRateRepo()
+	repo.addRate(database.TaxExcise, 15, time.Now().Add(-time.Hour))
+	repo.addRate(database.TaxWithholding, 10, time.Now().Add(-time.Hour))
+	// The law changes between the round opening and it being played
+	repo.onRound = func() {
+		repo.mu.Lock()
+		repo.addRate(database.TaxExcise, 30, time.Now().Add(-time.Second))
+		repo.addRate(database.TaxWithholding, 40, time.Now().Add(-time.Second))
+		repo.mu.Unlock()
+	}
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, fixedOutcomes{"1": 40})
+
+	result := placeTestBet(t, s, repo.memRepo, 20, "1")
+	if result.GameResult.ResultStatus != status.ResultWin {
+		t.Fatalf("result = %+v, want a win", result.GameResult)
+	}
+	if row, ok := repo.taxRow(database.TaxExcise); !ok || row.rate != 15 || row.taxAmount != taxcalc.Excise(20, 15) {
+		t.Errorf("excise record = %+v, want the stake taxed at the opening 15%%", row)
+	}
+	if row, ok := repo.taxRow(database.TaxWithholding); !ok || row.rate != 10 || row.taxAmount != 4 {
+		t.Errorf("withholding record = %+v, want 4 of the 40 won at the opening 10%%", row)
+	}
+
+	// The next round opens at the new rates
+	repo.onRound = nil
+	repo.taxRows = nil
+	placeTestBet(t, s, repo.memRepo, 20, "1")
+	if row, _ := repo.taxRow(database.TaxExcise); row.rate != 30 || row.taxAmount != taxcalc.Excise(20, 30) {
+		t.Errorf("next round's excise = %+v, want the stake taxed at 30%%", row)
+	}
+}
+
+func TestTaxRateValidate(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	cases := []struct {
+		rate TaxRate
+		ok   bool
+	}{
+		{TaxRate{TaxType: database.TaxExcise, Rate: 12.5, EffectiveFrom: future}, true},
+		{TaxRate{TaxType: database.TaxWithholding, Rate: 0, EffectiveFrom: future}, true},
+		{TaxRate{TaxType: "vat", Rate: 16, EffectiveFrom: future}, false},
+		{TaxRate{TaxType: database.TaxExcise, Rate: 101, EffectiveFrom: future}, false},
+		{TaxRate{TaxType: database.TaxExcise, Rate: -1, EffectiveFrom: future}, false},
+		{TaxRate{TaxType: database.TaxExcise, Rate: 12.5, EffectiveFrom: time.Now().Add(-time.Minute)}, false},
+	}
+	for _, tc := range cases {
+		if err := tc.rate.Validate(); (err == nil) != tc.ok || (err != nil && !errors.Is(err, ErrInvalidTaxRate)) {
+			t.Errorf("Validate(%+v) = %v, want ok %t", tc.rate, err, tc.ok)
+		}
+	}
+}
+
+func TestTaxRateAdmin(t *testing.T) {
+	repo := newTaxRateRepo()
+	past := repo.addRate(database.TaxExcise, 15, time.Now().Add(-time.Hour))
+	s := newTestService(t, repo, nil)
+	from := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+
+	created, err := s.CreateTaxRate("admin1", TaxRate{TaxType: database.TaxExcise, Rate: 20, EffectiveFrom: from})
+	if err != nil || created.Rate != 20 || created.InEffect {
+		t.Fatalf("create = %+v, %v, want a scheduled rate", created, err)
+	}
+	if _, err := s.CreateTaxRate("admin1", TaxRate{TaxType: database.TaxExcise, Rate: 25, EffectiveFrom: from}); !errors.Is(err, ErrInvalidTaxRate) {
+		t.Errorf("a second rate from the same moment = %v, want ErrInvalidTaxRate", err)
+	}
+
+	moved, err := s.UpdateTaxRate("admin1", created.ID, TaxRate{TaxType: database.TaxWithholding, Rate: 18, EffectiveFrom: from.Add(time.Hour)})
+	if err != nil || moved.Rate != 18 || moved.TaxType != database.TaxExcise || !moved.EffectiveFrom.Equal(from.Add(time.Hour)) {
+		t.Errorf("update = %+v, %v, want the rate and start moved and the tax type kept", moved, err)
+	}
+
+	// Rates already in effect taxed past bets and stay as they are
+	if _, err := s.UpdateTaxRate("admin1", past, TaxRate{Rate: 10, EffectiveFrom: from}); !errors.Is(err, ErrTaxRateInEffect) {
+		t.Errorf("updating a rate in effect = %v, want ErrTaxRateInEffect", err)
+	}
+	if err := s.DeleteTaxRate("admin1", past); !errors.Is(err, ErrTaxRateInEffect) {
+		t.Errorf("deleting a rate in effect = %v, want ErrTaxRateInEffect", err)
+	}
+	if err := s.DeleteTaxRate("admin1", 99); !errors.Is(err, ErrTaxRateNotFound) {
+		t.Errorf("deleting an unknown rate = %v, want ErrTaxRateNotFound", err)
+	}
+
+	// It took effect between the read and the write
+	repo.stale = true
+	if _, err := s.UpdateTaxRate("admin1", created.ID, TaxRate{Rate: 19, EffectiveFrom: from}); !errors.Is(err, ErrTaxRateInEffect) {
+		t.Errorf("update refused by the SQL = %v, want ErrTaxRateInEffect", err)
+	}
+	if err := s.DeleteTaxRate("admin1", created.ID); !errors.Is(err, ErrTaxRateInEffect) {
+		t.Errorf("delete refused by the SQL = %v, want ErrTaxRateInEffect", err)
+	}
+	repo.stale = false
+	if err := s.DeleteTaxRate("admin1", created.ID); err != nil || len(repo.rates) != 1 {
+		t.Errorf("delete = %v, %d rates left, want only the past one", err, len(repo.rates))
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/utils"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultLanguage is used when the player has no language set
+const DefaultLanguage = "sw"
+
+// Template keys
+const (
+	TemplateWin            = "win"
+	TemplateWinDelayed     = "win_delayed"
+	TemplateLoss           = "loss"
+	TemplateParcel         = "parcel"
+	TemplateParcelDelayed  = "parcel_delayed"
+	TemplateJackpot        = "jackpot"
+	TemplateOTP            = "otp"
+	TemplateDeposit        = "deposit"
+	TemplateReversal       = "reversal"
+	TemplateWithdrawal     = "withdrawal"
+	TemplateWithdrawalErr  = "withdrawal_failed"
+	TemplateWithdrawalHeld = "withdrawal_manual"
+)
+
+var (
+	ErrTemplateNotFound = errors.New("message template not found")
+	ErrInvalidTemplate  = errors.New("invalid message template")
+)
+
+// messageTemplate is a compiled-in default and the placeholders its key
+// accepts. Required placeholders must appear in any replacement body.
+type messageTemplate struct {
+	body     string
+	allowed  []string
+	required []string
+}
+
+var defaultTemplates = map[string]messageTemplate{
+	TemplateWin: {
+		body: `Congratulations!! UMESHINDA
+-
+Ulichagua {{selected_box}}. UMESHINDA: {{amount}}
+-
+Jumla {{gross}} - Kodi {{tax_pct}}% {{tax}} = {{net}}
+-
+{{boxes}}
+-
+Free Bet - {{free_bets}}
+-
+Cheza Tena {{cta}}
+-
+game-id: {{reference}}
+-
+Help: 0703012550`,
+		allowed:  []string{"selected_box", "amount", "boxes", "free_bets", "reference", "tax_pct", "tax", "gross", "net", "cta"},
+		required: []string{"amount", "reference"},
+	},
+	TemplateWinDelayed: {
+		body: `Congratulations!! UMESHINDA
+-
+Ulichagua {{selected_box}}. UMESHINDA: {{amount}}
+-
+Jumla {{gross}} - Kodi {{tax_pct}}% {{tax}} = {{net}}
+-
+Malipo yako yatachelewa kidogo. Utatumiwa {{net}} hivi karibuni.
+-
+Free Bet - {{free_bets}}
+-
+game-id: {{reference}}
+-
+Help: 0703012550`,
+		allowed:  []string{"selected_box", "amount", "boxes", "free_bets", "reference", "tax_pct", "tax", "gross", "net", "cta"},
+		required: []string{"amount", "reference"},
+	},
+	TemplateJackpot: {
+		body: `CONGRATULATIONS! ID:{{reference}} IMESHINDA {{item}} YENYE THAMANI KES {{amount}}
+
+KIASI HIKI UTATUMIWA KWENYE ACCOUNT YAKO
+
+Cheza Tena {{cta}}
+
+Help: 0703012550`,
+		allowed:  []string{"reference", "item", "amount", "cta"},
+		required: []string{"reference", "amount"},
+	},
+	TemplateLoss: {
+		body: `Samahani, Jaribu tena
+-
+Ulichagua: {{selected_box}}
+-
+{{boxes}}
+-
+Free Bet - {{free_bets}}
+-
+Cheza Tena {{cta}}
+-
+game-id: {{reference}}
+-
+Help: 0703012550`,
+		allowed:  []string{"selected_box", "boxes", "free_bets", "reference", "cta"},
+		required: []string{"reference"},
+	},
+	TemplateParcel: {
+		body: `Matokeo ya bet {{reference}}
+-
+{{results}}
+-
+Dau {{stake}} - Ushindi {{net}}
+-
+{{boxes}}
+-
+Cheza Tena {{cta}}
+-
+Help: 0703012550`,
+		allowed:  []string{"reference", "results", "boxes", "stake", "net", "wins", "cta"},
+		required: []string{"reference", "results"},
+	},
+	TemplateParcelDelayed: {
+		body: `Matokeo ya bet {{reference}}
+-
+{{results}}
+-
+Dau {{stake}} - Ushindi {{net}}
+-
+Malipo yako yatachelewa kidogo. Utatumiwa {{net}} hivi karibuni.
+-
+Help: 0703012550`,
+		allowed:  []string{"reference", "results", "boxes", "stake", "net", "wins", "cta"},
+		required: []string{"reference", "results"},
+	},
+	TemplateOTP: {
+		body:     `Your OTP Code is: {{code}}`,
+		allowed:  []string{"code"},
+		required: []string{"code"},
+	},
+	TemplateDeposit: {
+		body:     "Account balance yako ni: Ksh.{{balance}}\n\nBONYEZA {{cta}} UKAMILISHE BET YAKO",
+		allowed:  []string{"balance", "cta"},
+		required: []string{"balance"},
+	},
+	TemplateReversal: {
+		body:     "Muamala {{transaction_id}} wa Ksh.{{amount}} umerudishwa na M-Pesa, kiasi hicho kimeondolewa kwenye akaunti yako. Salio lako ni Ksh.{{balance}}\n\nHelp: 0703012550",
+		allowed:  []string{"transaction_id", "amount", "balance", "debt"},
+		required: []string{"transaction_id", "amount"},
+	},
+	TemplateWithdrawal: {
+		body:     "KES {{amount}} has been sent to your M-Pesa, ref {{reference}}\n\nHelp: 0703012550",
+		allowed:  []string{"amount", "reference", "transaction_id"},
+		required: []string{"amount", "reference"},
+	},
+	TemplateWithdrawalErr: {
+		body:     "Your withdrawal of KES {{amount}}, ref {{reference}}, could not be sent to M-Pesa. Please call 0703012550 for help.",
+		allowed:  []string{"amount", "reference", "transaction_id"},
+		required: []string{"amount", "reference"},
+	},
+	TemplateWithdrawalHeld: {
+		body:     "Samahani! Your withdrawal of KES {{amount}}, ref {{reference}}, is delayed. Our team is sending it to you and will call you if needed.\n\nHelp: 0703012550",
+		allowed:  []string{"amount", "reference"},
+		required: []string{"amount", "reference"},
+	},
+}
+
+// {{cta}} is filled by renderMessage with the call to action of the channel
+// in ctx, see withChannel. The USSD one keeps the text as it always was.
+
+type channelKey struct{}
+
+// withChannel returns a context under which rendered messages point the
+// player back to channel ("ussd", "web" or "app")
+func withChannel(ctx context.Context, channel string) context.Context {
+	return context.WithValue(ctx, channelKey{}, channel)
+}
+
+// channelCTA returns the sms.cta_* setting for the channel in ctx. No
+// channel, an unknown one or an unset web/app CTA gets the USSD code.
+func channelCTA(ctx context.Context) string {
+	channel, _ := ctx.Value(channelKey{}).(string)
+	switch {
+	case channel == "web" && smsSettings.CTAWeb != "":
+		return smsSettings.CTAWeb
+	case channel == "app" && smsSettings.CTAApp != "":
+		return smsSettings.CTAApp
+	}
+	return smsSettings.CTAUSSD
+}
+
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// MessageTemplate is a stored template as managed by admins
+type MessageTemplate struct {
+	ID          int64     `json:"id,omitempty"`
+	Key         string    `json:"key"`
+	Language    string    `json:"language"`
+	Body        string    `json:"body"`
+	Active      bool      `json:"active"`
+	DateUpdated time.Time `json:"date_updated,omitempty"`
+}
+
+// Validate checks the key is known and the body uses exactly the
+// placeholders that key supports
+func (t MessageTemplate) Validate() error {
+	def, ok := defaultTemplates[t.Key]
+	if !ok {
+		return fmt.Errorf("%w: unknown key %q", ErrInvalidTemplate, t.Key)
+	}
+
+	var problems []string
+	if strings.TrimSpace(t.Language) == "" {
+		problems = append(problems, "language is required")
+	}
+	if strings.TrimSpace(t.Body) == "" {
+		problems = append(problems, "body is required")
+	}
+
+	used := map[string]bool{}
+	for _, m := range placeholderPattern.FindAllStringSubmatch(t.Body, -1) {
+		used[m[1]] = true
+	}
+	allowed := map[string]bool{}
+	for _, name := range def.allowed {
+		allowed[name] = true
+	}
+	var unknown []string
+	for name := range used {
+		if !allowed[name] {
+			unknown = append(unknown, "{{"+name+"}}")
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		problems = append(problems, fmt.Sprintf("unknown placeholders %s (allowed: %s)", strings.Join(unknown, ", "), strings.Join(def.allowed, ", ")))
+	}
+	for _, name := range def.required {
+		if !used[name] {
+			problems = append(problems, fmt.Sprintf("missing placeholder {{%s}}", name))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplate, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// renderTemplate replaces each {{name}} with vars[name]. Validate keeps
+// unknown names out of stored bodies; any left are rendered empty.
+func renderTemplate(body string, vars map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(body, func(m string) string {
+		return vars[placeholderPattern.FindStringSubmatch(m)[1]]
+	})
+}
+
+// renderMessage renders key in language, falling back to the default
+// language and then to the compiled-in template. vars gets {{cta}} for the
+// channel in ctx.
+func (s *LuckyNumberService) renderMessage(ctx context.Context, key, language string, vars map[string]string) string {
+	vars["cta"] = channelCTA(ctx)
+	if language == "" {
+		language = DefaultLanguage
+	}
+	languages := []string{language}
+	if language != DefaultLanguage {
+		languages = append(languages, DefaultLanguage)
+	}
+
+	body := defaultTemplates[key].body
+	for _, lang := range languages {
+		row, err := s.lookups.Get(ctx, "template:"+key+":"+lang, func(ctx context.Context) (map[string]interface{}, error) {
+			return s.db.GetMessageTemplate(ctx, key, lang)
+		})
+		if err != nil {
+			logrus.Errorf("templates: load %s/%s failed, using default: %v", key, lang, err)
+			break
+		}
+		if row != nil {
+			body = utils.ToString(row["body"])
+			break
+		}
+	}
+	return renderTemplate(body, vars)
+}
+
+// playerLanguage returns the language on the player's row, if any
+func (s *LuckyNumberService) playerLanguage(ctx context.Context, msisdn string) string {
+	player, err := s.db.CheckUser(ctx, msisdn)
+	if err != nil || player == nil {
+		return ""
+	}
+	return utils.ToString(player["language"])
+}
+
+// PlayerLanguage returns msisdn's stored language, or "" when it has none
+// or cannot be read
+func (s *LuckyNumberService) PlayerLanguage(msisdn string) string {
+	if s == nil || s.db == nil || msisdn == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	return s.playerLanguage(ctx, msisdn)
+}
+
+// ListMessageTemplates returns the stored templates for the admin dashboard
+func (s *LuckyNumberService) ListMessageTemplates() ([]MessageTemplate, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.ListMessageTemplates(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]MessageTemplate, 0, len(rows))
+	for _, row := range rows {
+		t := MessageTemplate{
+			ID:       utils.ToInt64(row["id"]),
+			Key:      utils.ToString(row["key"]),
+			Language: utils.ToString(row["language"]),
+			Body:     utils.ToString(row["body"]),
+		}
+		t.Active, _ = row["active"].(bool)
+		t.DateUpdated, _ = row["date_updated"].(time.Time)
+		templates = append(templates, t)
+	}
+	return templates, nil
+}
+
+// SaveMessageTemplate validates and stores a template. Running instances
+// pick it up once their lookup cache entry expires.
+func (s *LuckyNumberService) SaveMessageTemplate(t MessageTemplate) (MessageTemplate, error) {
+	if s == nil || s.db == nil {
+		return MessageTemplate{}, fmt.Errorf("service or database not initialized")
+	}
+	if err := t.Validate(); err != nil {
+		return MessageTemplate{}, err
+	}
+
+	id, err := s.db.UpsertMessageTemplate(context.Background(), t.Key, t.Language, t.Body, t.Active)
+	if err != nil {
+		return MessageTemplate{}, err
+	}
+	t.ID = id
+	return t, nil
+}
+
+// DeleteMessageTemplate removes a stored template, restoring the default
+func (s *LuckyNumberService) DeleteMessageTemplate(key, language string) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	n, err := s.db.DeleteMessageTemplate(context.Background(), key, language)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/taxcalc"
+	"strings"
+	"testing"
+	"time"
+)
+
+// templateRepo serves stored templates by key/language over a memRepo
+type templateRepo struct {
+	*memRepo
+	stored map[string]string
+}
+
+func (r *templateRepo) GetMessageTemplate(ctx context.Context, key, language string) (map[string]interface{}, error) {
+	body, ok := r.stored[key+"/"+language]
+	if !ok {
+		return nil, nil
+	}
+	return map[string]interface{}{"key": key, "language": language, "body": body}, nil
+}
+
+var testBoxes = map[string]WinAmount{
+	"1": {Value: 0, Item: "0"},
+	"2": {Value: 200, Item: "200.00"},
+	"3": {Value: 20, Item: "20.00"},
+}
+
+// The defaults must keep the text players got from the compiled-in copy
+func TestDefaultMessagesGolden(t *testing.T) {
+	s := newTestService(t, newMemRepo(), nil)
+	ctx := context.Background()
+
+	loss := s.createLossMessage(ctx, "", "1", testBoxes, 2, "REF123")
+	wantLoss := `Samahani, Jaribu tena
+-
+Ulichagua: 1
+-
+Box 1 - 0
+Box 2 - 200.00
+Box 3 - 20.00
+-
+Free Bet - 2
+-
+Cheza Tena *463#
+-
+game-id: REF123
+-
+Help: 0703012550`
+	if loss != wantLoss {
+		t.Errorf("loss message changed:\n%s\nwant:\n%s", loss, wantLoss)
+	}
+
+	jackpot := s.createJackpotMessage(ctx, "", "2", testBoxes, "REF123", 1600)
+	wantJackpot := `CONGRATULATIONS! ID:REF123 IMESHINDA 200.00 YENYE THAMANI KES 1,600.00
+
+KIASI HIKI UTATUMIWA KWENYE ACCOUNT YAKO
+
+Cheza Tena *463#
+
+Help: 0703012550`
+	if jackpot != wantJackpot {
+		t.Errorf("jackpot message changed:\n%s\nwant:\n%s", jackpot, wantJackpot)
+	}
+
+	win := s.createWinMessage(ctx, TemplateWin, "", "2", testBoxes, 0, "REF123", taxcalc.Withholding(200, 20))
+	wantWin := `Congratulations!! UMESHINDA
+-
+Ulichagua 2. UMESHINDA: 200.00
+-
+Jumla 200.00 - Kodi 20% 40.00 = 160.00
+-
+Box 1 - 0, Box 2 - 200.00, Box 3 - 20.00
+-
+Free Bet - 0
+-
+Cheza Tena *463#
+-
+game-id: REF123
+-
+Help: 0703012550`
+	if win != wantWin {
+		t.Errorf("win message changed:\n%s\nwant:\n%s", win, wantWin)
+	}
+
+	if got := s.renderMessage(ctx, TemplateOTP, "", map[string]string{"code": "4821"}); got != "Your OTP Code is: 4821" {
+		t.Errorf("otp message = %q", got)
+	}
+	if got := s.renderMessage(ctx, TemplateDeposit, "", map[string]string{"balance": "150.00"}); got != "Account balance yako ni: Ksh.150.00\n\nBONYEZA *463# UKAMILISHE BET YAKO" {
+		t.Errorf("deposit message = %q", got)
+	}
+}
+
+func TestRenderMessagePrefersStoredTemplate(t *testing.T) {
+	repo := &templateRepo{memRepo: newMemRepo(), stored: map[string]string{
+		TemplateOTP + "/en": "Code {{code}}",
+		TemplateOTP + "/sw": "Nambari {{ code }}",
+	}}
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+	vars := func() map[string]string { return map[string]string{"code": "4821"} }
+
+	if got := s.renderMessage(ctx, TemplateOTP, "en", vars()); got != "Code 4821" {
+		t.Errorf("en = %q", got)
+	}
+	if got := s.renderMessage(ctx, TemplateOTP, "", vars()); got != "Nambari 4821" {
+		t.Errorf("no language = %q, want the %s row", got, DefaultLanguage)
+	}
+	if got := s.renderMessage(ctx, TemplateOTP, "fr", vars()); got != "Nambari 4821" {
+		t.Errorf("unknown language = %q, want the %s row", got, DefaultLanguage)
+	}
+	if got := s.renderMessage(ctx, TemplateDeposit, "en", map[string]string{"balance": "10.00"}); !strings.HasPrefix(got, "Account balance yako ni: Ksh.10.00") {
+		t.Errorf("no stored row = %q, want the compiled-in default", got)
+	}
+}
+
+func TestMessageTemplateValidate(t *testing.T) {
+	valid := MessageTemplate{Key: TemplateLoss, Language: "en", Body: "Sorry! {{selected_box}} lost. Ref {{reference}} {{cta}}"}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid template rejected: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		t    MessageTemplate
+		want []string
+	}{
+		{"unknown key", MessageTemplate{Key: "promo", Language: "en", Body: "hi"}, []string{`unknown key "promo"`}},
+		{"unknown placeholder", MessageTemplate{Key: TemplateLoss, Language: "en", Body: "{{reference}} {{amount}} {{balance}}"}, []string{"{{amount}}, {{balance}}"}},
+		{"missing required", MessageTemplate{Key: TemplateWin, Language: "en", Body: "You won {{amount}}"}, []string{"missing placeholder {{reference}}"}},
+		{"blank", MessageTemplate{Key: TemplateOTP, Body: " "}, []string{"language is required", "body is required", "missing placeholder {{code}}"}},
+	}
+	for _, tc := range cases {
+		err := tc.t.Validate()
+		if !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%s: err = %v, want ErrInvalidTemplate", tc.name, err)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: error %q does not mention %q", tc.name, err, want)
+			}
+		}
+	}
+}
+
+// configureCTAs sets the web and app calls to action for the test
+func configureCTAs(t *testing.T, web, app string) {
+	t.Helper()
+	saved := smsSettings
+	smsSettings.CTAWeb, smsSettings.CTAApp = web, app
+	t.Cleanup(func() { smsSettings = saved })
+}
+
+// Each channel's messages differ from the USSD text only in their call to
+// action, and the USSD text is the one players always got
+func TestChannelMessagesGolden(t *testing.T) {
+	configureCTAs(t, "https://pawabox.co.ke", "pawabox://play")
+	s := newTestService(t, newMemRepo(), nil)
+
+	lossFor := func(ctx context.Context) string { return s.createLossMessage(ctx, "", "1", testBoxes, 2, "REF123") }
+	jackpotFor := func(ctx context.Context) string {
+		return s.createJackpotMessage(ctx, "", "2", testBoxes, "REF123", 1600)
+	}
+	winFor := func(ctx context.Context) string {
+		return s.createWinMessage(ctx, TemplateWin, "", "2", testBoxes, 0, "REF123", taxcalc.Withholding(200, 20))
+	}
+	depositFor := func(ctx context.Context) string {
+		return s.renderMessage(ctx, TemplateDeposit, "", map[string]string{"balance": "150.00"})
+	}
+
+	ussd := withChannel(context.Background(), "ussd")
+	if got, want := lossFor(ussd), lossFor(context.Background()); got != want || !strings.Contains(got, "Cheza Tena *463#\n") {
+		t.Errorf("ussd loss message changed:\n%s\nwant:\n%s", got, want)
+	}
+	if got := depositFor(ussd); got != "Account balance yako ni: Ksh.150.00\n\nBONYEZA *463# UKAMILISHE BET YAKO" {
+		t.Errorf("ussd deposit message = %q", got)
+	}
+
+	for _, c := range []struct{ channel, cta string }{{"web", "https://pawabox.co.ke"}, {"app", "pawabox://play"}} {
+		ctx := withChannel(context.Background(), c.channel)
+		wantLoss := `Samahani, Jaribu tena
+-
+Ulichagua: 1
+-
+Box 1 - 0
+Box 2 - 200.00
+Box 3 - 20.00
+-
+Free Bet - 2
+-
+Cheza Tena ` + c.cta + `
+-
+game-id: REF123
+-
+Help: 0703012550`
+		if got := lossFor(ctx); got != wantLoss {
+			t.Errorf("%s loss message:\n%s\nwant:\n%s", c.channel, got, wantLoss)
+		}
+		wantJackpot := `CONGRATULATIONS! ID:REF123 IMESHINDA 200.00 YENYE THAMANI KES 1,600.00
+
+KIASI HIKI UTATUMIWA KWENYE ACCOUNT YAKO
+
+Cheza Tena ` + c.cta + `
+
+Help: 0703012550`
+		if got := jackpotFor(ctx); got != wantJackpot {
+			t.Errorf("%s jackpot message:\n%s\nwant:\n%s", c.channel, got, wantJackpot)
+		}
+		wantWin := `Congratulations!! UMESHINDA
+-
+Ulichagua 2. UMESHINDA: 200.00
+-
+Jumla 200.00 - Kodi 20% 40.00 = 160.00
+-
+Box 1 - 0, Box 2 - 200.00, Box 3 - 20.00
+-
+Free Bet - 0
+-
+Cheza Tena ` + c.cta + `
+-
+game-id: REF123
+-
+Help: 0703012550`
+		if got := winFor(ctx); got != wantWin {
+			t.Errorf("%s win message:\n%s\nwant:\n%s", c.channel, got, wantWin)
+		}
+		if got, want := depositFor(ctx), "Account balance yako ni: Ksh.150.00\n\nBONYEZA "+c.cta+" UKAMILISHE BET YAKO"; got != want {
+			t.Errorf("%s deposit message = %q, want %q", c.channel, got, want)
+		}
+	}
+
+	if got := s.renderMessage(withChannel(context.Background(), "web"), TemplateOTP, "", map[string]string{"code": "4821"}); got != "Your OTP Code is: 4821" {
+		t.Errorf("web otp message = %q, want no call to action", got)
+	}
+}
+
+// An unconfigured web or app CTA, and an unknown channel, keep the USSD code
+func TestChannelCTAFallsBackToUSSD(t *testing.T) {
+	configureCTAs(t, "", "pawabox://play")
+	for channel, want := range map[string]string{"web": "*463#", "app": "pawabox://play", "ussd": "*463#", "kiosk": "*463#", "": "*463#"} {
+		if got := channelCTA(withChannel(context.Background(), channel)); got != want {
+			t.Errorf("channel %q CTA = %q, want %q", channel, got, want)
+		}
+	}
+}
+
+// A bet's own channel reaches its result SMS: the messages held with a
+// delayed web bet point at the web app
+func TestBetSMSUsesBetChannel(t *testing.T) {
+	configureCTAs(t, "https://pawabox.co.ke", "pawabox://play")
+	repo := newRevealRepo(3 * time.Second)
+	s := newTestService(t, repo, fixedOutcomes{"2": 0})
+
+	for channel, cta := range map[string]string{"web": "https://pawabox.co.ke", "app": "pawabox://play"} {
+		reference := placeRevealBet(t, s, repo, channel).Reveal.Reference
+		sms := repo.reveals[reference].sms
+		if len(sms) != 1 || !strings.Contains(sms[0], "Cheza Tena "+cta+"\n") {
+			t.Errorf("%s bet SMS = %q, want the %s call to action", channel, sms, cta)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/money"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTransferToSelf      = errors.New("cannot transfer to your own number")
+	ErrTransferAmount      = errors.New("invalid transfer amount")
+	ErrTransferOTPRequired = errors.New("otp required for this amount")
+)
+
+// TransferResult is what the sender sees after a successful transfer
+type TransferResult struct {
+	Reference string  `json:"reference"`
+	Recipient string  `json:"recipient_msisdn"`
+	Amount    float64 `json:"amount"`
+	Balance   float64 `json:"balance"`
+}
+
+// TransferNeedsOTP reports whether amount is above limits.transfer_otp_threshold
+func TransferNeedsOTP(amount float64) bool {
+	return limits.TransferOTPThreshold > 0 && amount > limits.TransferOTPThreshold
+}
+
+// Transfer sends amount from one player's balance to another. Amounts above
+// the OTP threshold need otp, issued through the usual verification flow.
+// Recipient, balance and daily-cap failures come back as the database
+// sentinels (database.ErrTransferRecipient and friends).
+func (s *LuckyNumberService) Transfer(from, to string, amount float64, otp string) (TransferResult, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return TransferResult{}, fmt.Errorf("service or database not initialized")
+	}
+
+	to, err := utils.NormalizeMsisdn(to)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	if to == from {
+		return TransferResult{}, ErrTransferToSelf
+	}
+	if money.Check(money.Transfer, amount) != nil || amount != math.Trunc(amount) {
+		return TransferResult{}, fmt.Errorf("%w: must be a whole amount of at least Ksh.%.0f", ErrTransferAmount, limits.TransferMinAmount)
+	}
+
+	if TransferNeedsOTP(amount) {
+		if otp == "" {
+			return TransferResult{}, ErrTransferOTPRequired
+		}
+		if _, err := s.VerifyOTP(from, OTPTransfer, otp); err != nil {
+			return TransferResult{}, err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	reference := utils.NewReference(utils.RefTransfer)
+	fromBalance, toBalance, err := s.db.TransferBalance(ctx, from, to, amount, reference)
+	if err != nil {
+		return TransferResult{}, err
+	}
+	logrus.Infof("transfer %s: %s -> %s Ksh.%.2f", reference, from, to, amount)
+
+	messages := map[string]string{
+		from: fmt.Sprintf("Umetuma Ksh.%.0f kwa %s. Salio lako ni Ksh.%.2f. Ref: %s", amount, to, fromBalance, reference),
+		to:   fmt.Sprintf("Umepokea Ksh.%.0f kutoka %s. Salio lako ni Ksh.%.2f. Ref: %s. BONYEZA *463#", amount, from, toBalance, reference),
+	}
+	for msisdn, message := range messages {
+		if err := s.queueOrderedSMS(ctx, msisdn, message, "LuckyNumber", "transfer"); err != nil {
+			logrus.Errorf("transfer %s: sms to %s failed: %v", reference, msisdn, err)
+		}
+	}
+
+	return TransferResult{
+		Reference: reference,
+		Recipient: to,
+		Amount:    amount,
+		Balance:   fromBalance,
+	}, nil
+}
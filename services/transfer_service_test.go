@@ -0,0 +1,160 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/money"
+	"sync"
+	"testing"
+	"time"
+)
+
+// transferRepo moves balance between memRepo players the way
+// TransferBalance does: all or nothing, under the players' row locks
+type transferRepo struct {
+	*otpRepo
+	unavailable map[string]bool
+	failCredit  bool
+	transfers   int
+}
+
+func (r *transferRepo) TransferBalance(ctx context.Context, from, to string, amount float64, reference string) (float64, float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sender, recipient := r.players[from], r.players[to]
+	if sender == nil || r.unavailable[from] {
+		return 0, 0, database.ErrTransferSender
+	}
+	if recipient == nil || r.unavailable[to] {
+		return 0, 0, database.ErrTransferRecipient
+	}
+	if sender.Balance < amount {
+		return 0, 0, database.ErrInsufficientBalance
+	}
+	sender.Balance -= amount
+	if r.failCredit {
+		sender.Balance += amount // the rollback
+		return 0, 0, errors.New("failed to credit recipient: connection reset")
+	}
+	recipient.Balance += amount
+	r.transfers++
+	return sender.Balance, recipient.Balance, nil
+}
+
+const testRecipient = "254722000111"
+
+func newTransferTest(t *testing.T) (*LuckyNumberService, *transferRepo) {
+	t.Helper()
+	configureTestOTP(t)
+	money.Configure(limits)
+	repo := &transferRepo{otpRepo: newOTPRepo(), unavailable: map[string]bool{}}
+	repo.addPlayer(testMsisdn, 1000)
+	repo.addPlayer(testRecipient, 0)
+	return newTestService(t, repo, nil), repo
+}
+
+func TestTransfer(t *testing.T) {
+	s, repo := newTransferTest(t)
+
+	res, err := s.Transfer(testMsisdn, "0722000111", 300, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Recipient != testRecipient || res.Balance != 700 || repo.player(testRecipient).Balance != 300 {
+		t.Errorf("result %+v, recipient holds %.2f", res, repo.player(testRecipient).Balance)
+	}
+	if len(repo.sms) != 2 {
+		t.Errorf("sms = %+v, want one to each party", repo.sms)
+	}
+
+	if _, err := s.Transfer(testMsisdn, testMsisdn, 100, ""); !errors.Is(err, ErrTransferToSelf) {
+		t.Errorf("self transfer = %v, want ErrTransferToSelf", err)
+	}
+	if _, err := s.Transfer(testMsisdn, "0712345678", 100, ""); !errors.Is(err, ErrTransferToSelf) {
+		t.Errorf("self transfer in local format = %v, want ErrTransferToSelf", err)
+	}
+	for _, amount := range []float64{0, -50, 5, 10.5} {
+		if _, err := s.Transfer(testMsisdn, testRecipient, amount, ""); !errors.Is(err, ErrTransferAmount) {
+			t.Errorf("amount %v = %v, want ErrTransferAmount", amount, err)
+		}
+	}
+
+	repo.unavailable[testRecipient] = true
+	if _, err := s.Transfer(testMsisdn, testRecipient, 100, ""); !errors.Is(err, database.ErrTransferRecipient) {
+		t.Errorf("self-excluded recipient = %v, want ErrTransferRecipient", err)
+	}
+	if repo.transfers != 1 || repo.player(testMsisdn).Balance != 700 {
+		t.Errorf("refused transfers moved money: %d transfers, sender holds %.2f", repo.transfers, repo.player(testMsisdn).Balance)
+	}
+}
+
+func TestTransferOTPAboveThreshold(t *testing.T) {
+	s, repo := newTransferTest(t)
+	repo.players[testMsisdn].Balance = 5000
+	amount := limits.TransferOTPThreshold + 1
+
+	if _, err := s.Transfer(testMsisdn, testRecipient, amount, ""); !errors.Is(err, ErrTransferOTPRequired) {
+		t.Fatalf("no otp = %v, want ErrTransferOTPRequired", err)
+	}
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPLogin, "1111", now, now+300, false)
+	if _, err := s.Transfer(testMsisdn, testRecipient, amount, "1111"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("login code = %v, want ErrOTPInvalid", err)
+	}
+	repo.issue(t, testMsisdn, OTPTransfer, "2222", now, now+300, false)
+	if _, err := s.Transfer(testMsisdn, testRecipient, amount, "2222"); err != nil {
+		t.Errorf("transfer code = %v", err)
+	}
+	if _, err := s.Transfer(testMsisdn, testRecipient, limits.TransferOTPThreshold, ""); err != nil {
+		t.Errorf("threshold amount without otp = %v, want allowed", err)
+	}
+}
+
+func TestTransferCannotOverdraw(t *testing.T) {
+	s, repo := newTransferTest(t)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var done, refused int
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Transfer(testMsisdn, testRecipient, 100, "")
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				done++
+			case errors.Is(err, database.ErrInsufficientBalance):
+				refused++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if done != 10 || refused != 15 {
+		t.Errorf("%d sent, %d refused; want 10 and 15", done, refused)
+	}
+	if from, to := repo.player(testMsisdn).Balance, repo.player(testRecipient).Balance; from != 0 || to != 1000 {
+		t.Errorf("balances %.2f and %.2f, want 0 and 1000", from, to)
+	}
+}
+
+func TestTransferFailedCreditKeepsDebit(t *testing.T) {
+	s, repo := newTransferTest(t)
+	repo.failCredit = true
+
+	if _, err := s.Transfer(testMsisdn, testRecipient, 100, ""); err == nil {
+		t.Fatal("failed credit reported success")
+	}
+	if from, to := repo.player(testMsisdn).Balance, repo.player(testRecipient).Balance; from != 1000 || to != 0 {
+		t.Errorf("balances %.2f and %.2f after a failed credit, want 1000 and 0", from, to)
+	}
+	if len(repo.sms) != 0 {
+		t.Errorf("failed transfer sent sms: %+v", repo.sms)
+	}
+}
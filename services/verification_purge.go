@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// VerificationPurgeStats counts what the verification purge job has removed
+// since the process started
+type VerificationPurgeStats struct {
+	Runs       int64      `json:"runs"`
+	Purged     int64      `json:"purged"`
+	LastRun    *time.Time `json:"last_run,omitempty"`
+	LastPurged int64      `json:"last_purged"`
+	LastError  string     `json:"last_error,omitempty"`
+}
+
+var (
+	purgeMu    sync.Mutex
+	purgeStats VerificationPurgeStats
+)
+
+// PurgeVerifications deletes OTP codes used or expired more than
+// limits.verification_retention ago and returns how many were removed
+func (s *LuckyNumberService) PurgeVerifications(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+
+	purged, err := s.db.PurgeExpiredVerifications(ctx, limits.VerificationRetention)
+
+	now := time.Now()
+	purgeMu.Lock()
+	purgeStats.Runs++
+	purgeStats.Purged += purged
+	purgeStats.LastRun = &now
+	purgeStats.LastPurged = purged
+	purgeStats.LastError = ""
+	if err != nil {
+		purgeStats.LastError = err.Error()
+	}
+	purgeMu.Unlock()
+
+	return purged, err
+}
+
+// PurgeOTPPlaintext clears the plaintext codes stored before codes were
+// hashed, and the text of queued OTP messages, older than
+// limits.otp_plaintext_grace, and returns how many rows were cleared
+func (s *LuckyNumberService) PurgeOTPPlaintext(ctx context.Context) (int64, error) {
+	if s == nil || s.db == nil {
+		return 0, fmt.Errorf("service or database not initialized")
+	}
+	return s.db.PurgeOTPPlaintext(ctx, time.Now().Add(-limits.OTPPlaintextGrace))
+}
+
+// VerificationPurgeStats returns the purge job's counters
+func (s *LuckyNumberService) VerificationPurgeStats() VerificationPurgeStats {
+	purgeMu.Lock()
+	defer purgeMu.Unlock()
+	return purgeStats
+}
+
+// RunVerificationPurge purges on every limits.verification_purge_interval
+// until ctx is done, OTP plaintext, expired idempotency keys and outcome
+// decisions past limits.decision_retention included. A zero interval disables it. Run it in one process only.
+func (s *LuckyNumberService) RunVerificationPurge(ctx context.Context) {
+	if limits.VerificationPurgeInterval <= 0 {
+		logrus.Info("verification purge: disabled")
+		return
+	}
+	ticker := time.NewTicker(limits.VerificationPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.PurgeVerifications(ctx)
+		if err != nil {
+			logrus.Errorf("verification purge: failed after %d rows: %v", purged, err)
+		} else if purged > 0 {
+			logrus.Infof("verification purge: removed %d codes older than %s", purged, limits.VerificationRetention)
+		}
+		if cleared, err := s.PurgeOTPPlaintext(ctx); err != nil {
+			logrus.Errorf("verification purge: OTP plaintext: %v", err)
+		} else if cleared > 0 {
+			logrus.Infof("verification purge: cleared %d plaintext OTP codes and messages older than %s", cleared, limits.OTPPlaintextGrace)
+		}
+		if keys, err := s.PurgeIdempotencyKeys(ctx); err != nil {
+			logrus.Errorf("verification purge: idempotency keys: %v", err)
+		} else if keys > 0 {
+			logrus.Infof("verification purge: removed %d expired idempotency keys", keys)
+		}
+		if decisions, err := s.PurgeOutcomeDecisions(ctx); err != nil {
+			logrus.Errorf("verification purge: outcome decisions: %v", err)
+		} else if decisions > 0 {
+			logrus.Infof("verification purge: removed %d outcome decisions older than %s", decisions, limits.DecisionRetention)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// purgeRepo returns canned purge results and records the retention asked for
+type purgeRepo struct {
+	*memRepo
+	purged    int64
+	err       error
+	retention time.Duration
+}
+
+func (r *purgeRepo) PurgeExpiredVerifications(ctx context.Context, olderThan time.Duration) (int64, error) {
+	r.retention = olderThan
+	return r.purged, r.err
+}
+
+func TestPurgeVerificationsCounts(t *testing.T) {
+	repo := &purgeRepo{memRepo: newMemRepo(), purged: 7}
+	s := newTestService(t, repo, nil)
+	before := s.VerificationPurgeStats()
+
+	if n, err := s.PurgeVerifications(context.Background()); err != nil || n != 7 {
+		t.Fatalf("purge = %d, %v; want 7 rows", n, err)
+	}
+	if repo.retention != limits.VerificationRetention {
+		t.Errorf("retention = %s, want limits.verification_retention %s", repo.retention, limits.VerificationRetention)
+	}
+
+	// A failing batch still counts the rows it removed before failing
+	repo.purged, repo.err = 3, errors.New("statement timeout")
+	if _, err := s.PurgeVerifications(context.Background()); err == nil {
+		t.Fatal("want the purge error")
+	}
+	stats := s.VerificationPurgeStats()
+	if stats.Runs-before.Runs != 2 || stats.Purged-before.Purged != 10 {
+		t.Errorf("stats moved by %d runs and %d rows, want 2 and 10", stats.Runs-before.Runs, stats.Purged-before.Purged)
+	}
+	if stats.LastPurged != 3 || stats.LastError != "statement timeout" || stats.LastRun == nil {
+		t.Errorf("last run = %+v, want 3 rows and the error", stats)
+	}
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fiberapp/config"
+	"fiberapp/status"
+	"fiberapp/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Partner webhook event types
+const (
+	EventBetSettled          = "bet_settled"
+	EventDepositSettled      = "deposit_settled"
+	EventWithdrawalDisbursed = "withdrawal_disbursed"
+)
+
+// Webhook event states
+const (
+	WebhookPending   = status.WebhookPending
+	WebhookDelivered = status.WebhookDelivered
+	WebhookFailed    = status.WebhookFailed
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256,
+// keyed by the subscription secret, of "<timestamp>.<body>".
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookIDHeader        = "X-Webhook-Id"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const webhookClaimBatch = 50
+
+var webhookEventTypes = []string{EventBetSettled, EventDepositSettled, EventWithdrawalDisbursed}
+
+var (
+	ErrWebhookNotFound = errors.New("webhook subscription not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook subscription")
+)
+
+// webhookSettings holds the webhooks section; ConfigureWebhooks replaces it
+var webhookSettings = config.Default().Webhooks
+
+// webhookNudge wakes the dispatcher when this process queues an event, so
+// deliveries do not wait for the next webhooks.interval tick
+var webhookNudge = make(chan struct{}, 1)
+
+// ConfigureWebhooks applies the loaded webhooks section. Call it before
+// RunWebhookDispatcher.
+func ConfigureWebhooks(c config.WebhooksConfig) {
+	webhookSettings = c
+}
+
+// WebhookSubscription is a partner's webhook endpoint as managed by admins.
+// Secret is only returned when it is created or rotated.
+type WebhookSubscription struct {
+	ID          int64     `json:"id"`
+	PartnerID   string    `json:"partner_id"`
+	TargetURL   string    `json:"target_url"`
+	Secret      string    `json:"secret,omitempty"`
+	EventTypes  []string  `json:"event_types"`
+	Active      bool      `json:"active"`
+	DateCreated time.Time `json:"date_created"`
+	DateUpdated time.Time `json:"date_updated"`
+}
+
+// WebhookDelivery is one attempt to deliver an event
+type WebhookDelivery struct {
+	ID          int64     `json:"id"`
+	EventID     int64     `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	EventStatus string    `json:"event_status"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int64     `json:"duration_ms"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// WebhookDeliveryPage is one page of a subscription's delivery log
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Page       int               `json:"page"`
+	PageSize   int               `json:"page_size"`
+	Total      int64             `json:"total"`
+	TotalPages int               `json:"total_pages"`
+}
+
+// Validate checks a subscription before it is created or updated
+func (w WebhookSubscription) Validate() error {
+	var problems []string
+	if strings.TrimSpace(w.PartnerID) == "" {
+		problems = append(problems, "partner_id is required")
+	}
+	if u, err := url.Parse(w.TargetURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "target_url must be an http(s) URL")
+	}
+	if w.Secret != "" && len(w.Secret) < 16 {
+		problems = append(problems, "secret must be at least 16 characters")
+	}
+	if len(w.EventTypes) == 0 {
+		problems = append(problems, "event_types is required")
+	}
+	for _, t := range w.EventTypes {
+		if !isWebhookEventType(t) {
+			problems = append(problems, fmt.Sprintf("unknown event type %q (want one of %s)", t, strings.Join(webhookEventTypes, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidWebhook, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func isWebhookEventType(t string) bool {
+	for _, known := range webhookEventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ListWebhookSubscriptions returns every subscription for the admin dashboard
+func (s *LuckyNumberService) ListWebhookSubscriptions() ([]WebhookSubscription, error) {
+	if s == nil || s.db == nil {
+		return nil, fmt.Errorf("service or database not initialized")
+	}
+	rows, err := s.db.ListWebhookSubscriptions(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	subs := make([]WebhookSubscription, 0, len(rows))
+	for _, row := range rows {
+		subs = append(subs, webhookSubscriptionFromRow(row))
+	}
+	return subs, nil
+}
+
+// CreateWebhookSubscription validates and stores a subscription. A missing
+// secret is generated; either way it is returned once, in the result.
+func (s *LuckyNumberService) CreateWebhookSubscription(w WebhookSubscription) (WebhookSubscription, error) {
+	if s == nil || s.db == nil {
+		return WebhookSubscription{}, fmt.Errorf("service or database not initialized")
+	}
+	if err := w.Validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+	secret := w.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return WebhookSubscription{}, err
+		}
+	}
+
+	ctx := context.Background()
+	id, err := s.db.CreateWebhookSubscription(ctx, strings.TrimSpace(w.PartnerID), w.TargetURL, secret, w.EventTypes, w.Active)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	created, err := s.getWebhookSubscription(ctx, id)
+	created.Secret = secret
+	return created, err
+}
+
+// UpdateWebhookSubscription replaces a subscription's settings. The secret
+// is rotated only when one is given.
+func (s *LuckyNumberService) UpdateWebhookSubscription(id int64, w WebhookSubscription) (WebhookSubscription, error) {
+	if s == nil || s.db == nil {
+		return WebhookSubscription{}, fmt.Errorf("service or database not initialized")
+	}
+	if err := w.Validate(); err != nil {
+		return WebhookSubscription{}, err
+	}
+
+	ctx := context.Background()
+	n, err := s.db.UpdateWebhookSubscription(ctx, id, strings.TrimSpace(w.PartnerID), w.TargetURL, w.Secret, w.EventTypes, w.Active)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	if n == 0 {
+		return WebhookSubscription{}, ErrWebhookNotFound
+	}
+	updated, err := s.getWebhookSubscription(ctx, id)
+	updated.Secret = w.Secret
+	return updated, err
+}
+
+// DeleteWebhookSubscription stops deliveries to a subscription
+func (s *LuckyNumberService) DeleteWebhookSubscription(id int64) error {
+	if s == nil || s.db == nil {
+		return fmt.Errorf("service or database not initialized")
+	}
+	n, err := s.db.DeleteWebhookSubscription(context.Background(), id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns one page of a subscription's delivery log
+func (s *LuckyNumberService) ListWebhookDeliveries(id int64, page utils.Page) (WebhookDeliveryPage, error) {
+	if s == nil || s.db == nil {
+		return WebhookDeliveryPage{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx := context.Background()
+	if _, err := s.getWebhookSubscription(ctx, id); err != nil {
+		return WebhookDeliveryPage{}, err
+	}
+
+	rows, total, err := s.db.ListWebhookDeliveries(ctx, id, page.Size, page.Offset())
+	if err != nil {
+		return WebhookDeliveryPage{}, err
+	}
+	result := WebhookDeliveryPage{
+		Deliveries: make([]WebhookDelivery, 0, len(rows)),
+		Page:       page.Number,
+		PageSize:   page.Size,
+		Total:      total,
+		TotalPages: page.TotalPages(total),
+	}
+	for _, row := range rows {
+		d := WebhookDelivery{
+			ID:          utils.ToInt64(row["id"]),
+			EventID:     utils.ToInt64(row["event_id"]),
+			EventType:   utils.ToString(row["event_type"]),
+			EventStatus: utils.ToString(row["event_status"]),
+			Attempt:     utils.ToInt(row["attempt"]),
+			StatusCode:  utils.ToInt(row["status_code"]),
+			Error:       utils.ToString(row["error"]),
+			DurationMS:  utils.ToInt64(row["duration_ms"]),
+		}
+		d.DateCreated, _ = row["date_created"].(time.Time)
+		result.Deliveries = append(result.Deliveries, d)
+	}
+	return result, nil
+}
+
+func (s *LuckyNumberService) getWebhookSubscription(ctx context.Context, id int64) (WebhookSubscription, error) {
+	row, err := s.db.GetWebhookSubscription(ctx, id)
+	if err != nil {
+		return WebhookSubscription{}, err
+	}
+	if row == nil {
+		return WebhookSubscription{}, ErrWebhookNotFound
+	}
+	return webhookSubscriptionFromRow(row), nil
+}
+
+func webhookSubscriptionFromRow(row map[string]interface{}) WebhookSubscription {
+	w := WebhookSubscription{
+		ID:        utils.ToInt64(row["id"]),
+		PartnerID: utils.ToString(row["partner_id"]),
+		TargetURL: utils.ToString(row["target_url"]),
+	}
+	w.Active, _ = row["active"].(bool)
+	w.DateCreated, _ = row["date_created"].(time.Time)
+	w.DateUpdated, _ = row["date_updated"].(time.Time)
+	if types, ok := row["event_types"].([]interface{}); ok {
+		for _, t := range types {
+			w.EventTypes = append(w.EventTypes, utils.ToString(t))
+		}
+	}
+	return w
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// SignWebhook returns the X-Webhook-Signature value for body sent at timestamp
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// publishEvent queues data for the partner subscriptions of msisdn. It never
+// fails the caller: the money has already moved when events are published.
+func (s *LuckyNumberService) publishEvent(ctx context.Context, eventType, msisdn string, data map[string]interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logrus.Errorf("webhooks: encode %s for %s failed: %v", eventType, msisdn, err)
+		return
+	}
+	queued, err := s.db.EnqueueWebhookEvent(ctx, eventType, msisdn, payload)
+	if err != nil {
+		logrus.Errorf("webhooks: enqueue %s for %s failed: %v", eventType, msisdn, err)
+		return
+	}
+	if queued > 0 {
+		select {
+		case webhookNudge <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// publishBetSettled queues bet_settled for a bet that playGame has settled
+func (s *LuckyNumberService) publishBetSettled(ctx context.Context, msisdn, reference, gameCatID, channel string, amount float64, result PlaceBetResultDisplay) {
+	s.publishEvent(ctx, EventBetSettled, msisdn, map[string]interface{}{
+		"msisdn":         msisdn,
+		"reference":      reference,
+		"game_cat_id":    gameCatID,
+		"channel":        channel,
+		"amount":         amount,
+		"result":         result.ResultStatus,
+		"win_amount":     result.WinAmount,
+		"jackpot":        result.JackPot,
+		"selected_box":   result.SelectedBox,
+		"payout_delayed": result.PayoutDelayed,
+		"settled_at":     time.Now(),
+	})
+}
+
+// RunWebhookDispatcher delivers due webhook events until ctx is done. Each
+// batch is delivered on tracked background goroutines, so shutdown waits for
+// attempts in flight. Run it in one process only.
+func (s *LuckyNumberService) RunWebhookDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(webhookSettings.Interval)
+	defer ticker.Stop()
+	client := &http.Client{Timeout: webhookSettings.Timeout}
+
+	for {
+		s.dispatchWebhooks(ctx, client)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-webhookNudge:
+		}
+	}
+}
+
+// dispatchWebhooks claims and delivers due events until none are left. A
+// batch holds at most one event per player and subscription, delivered in
+// parallel; a player's next event is claimed once the one before it has
+// been delivered.
+func (s *LuckyNumberService) dispatchWebhooks(ctx context.Context, client *http.Client) {
+	// Long enough for every attempt in the batch to finish and be recorded
+	lease := 2*webhookSettings.Timeout + 30*time.Second
+
+	for ctx.Err() == nil {
+		events, err := s.db.ClaimWebhookEvents(ctx, webhookClaimBatch, lease)
+		if err != nil {
+			logrus.Errorf("webhooks: claim failed: %v", err)
+			return
+		}
+		if len(events) == 0 {
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, event := range events {
+			ev := event
+			wg.Add(1)
+			utils.GoBackground("webhook delivery", func() {
+				defer wg.Done()
+				s.deliverWebhook(client, ev)
+			})
+		}
+		wg.Wait()
+	}
+}
+
+// deliverWebhook makes one delivery attempt and records its outcome
+func (s *LuckyNumberService) deliverWebhook(client *http.Client, event map[string]interface{}) {
+	id := utils.ToInt64(event["id"])
+	eventType := utils.ToString(event["event_type"])
+	attempt := utils.ToInt(event["attempts"])
+	created, _ := event["date_created"].(time.Time)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":         id,
+		"event":      eventType,
+		"created_at": created,
+		"data":       json.RawMessage(utils.ToString(event["payload"])),
+	})
+
+	start := time.Now()
+	var statusCode int
+	if err == nil {
+		statusCode, err = postWebhook(client, utils.ToString(event["target_url"]), utils.ToString(event["secret"]), eventType, id, body)
+	}
+	elapsed := time.Since(start)
+
+	state, next, errMsg := WebhookDelivered, time.Now(), ""
+	if err != nil {
+		errMsg = err.Error()
+		if attempt >= webhookSettings.MaxAttempts {
+			state = WebhookFailed
+			logrus.Warnf("webhooks: event %d (%s) failed permanently after %d attempts: %v", id, eventType, attempt, err)
+		} else {
+			state = WebhookPending
+			next = next.Add(webhookBackoff(attempt))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.db.RecordWebhookDelivery(ctx, id, attempt, statusCode, errMsg, elapsed, state, next); err != nil {
+		logrus.Errorf("webhooks: record delivery of event %d failed: %v", id, err)
+	}
+}
+
+// postWebhook sends one signed delivery. Any non-2xx answer is an error.
+func postWebhook(client *http.Client, target, secret, eventType string, id int64, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookSettings.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, eventType)
+	req.Header.Set(WebhookIDHeader, strconv.FormatInt(id, 10))
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff is the wait after failed attempt n (1-based): backoff_base
+// doubled per earlier failure, capped at backoff_max
+func webhookBackoff(attempt int) time.Duration {
+	wait := webhookSettings.BackoffBase
+	for i := 1; i < attempt && wait < webhookSettings.BackoffMax; i++ {
+		wait *= 2
+	}
+	if wait > webhookSettings.BackoffMax {
+		wait = webhookSettings.BackoffMax
+	}
+	return wait
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/config"
+	"fiberapp/status"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memWebhookEvent struct {
+	ID        int64
+	Msisdn    string
+	EventType string
+	Payload   string
+	Attempts  int
+	Status    status.WebhookStatus
+	Next      time.Time
+	Created   time.Time
+	Codes     []int
+}
+
+// webhookRepo is the webhook_events outbox for one subscription, claimed and
+// recorded the way ClaimWebhookEvents and RecordWebhookDelivery do: a
+// player's event waits while an earlier one of theirs is pending
+type webhookRepo struct {
+	*memRepo
+	wmu            sync.Mutex
+	target, secret string
+	outbox         []*memWebhookEvent
+}
+
+func (r *webhookRepo) EnqueueWebhookEvent(ctx context.Context, eventType, msisdn string, payload []byte) (int64, error) {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	now := time.Now()
+	r.outbox = append(r.outbox, &memWebhookEvent{ID: int64(len(r.outbox) + 1), Msisdn: msisdn, EventType: eventType, Payload: string(payload),
+		Status: WebhookPending, Next: now, Created: now})
+	return 1, nil
+}
+
+func (r *webhookRepo) ClaimWebhookEvents(ctx context.Context, limit int, lease time.Duration) ([]map[string]interface{}, error) {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	var claimed []map[string]interface{}
+	waiting := map[string]bool{} // players with an earlier event pending
+	for _, e := range r.outbox {
+		if e.Status != WebhookPending {
+			continue
+		}
+		earlier := waiting[e.Msisdn]
+		waiting[e.Msisdn] = true
+		if earlier || e.Next.After(time.Now()) || len(claimed) == limit {
+			continue
+		}
+		e.Attempts++
+		e.Next = time.Now().Add(lease)
+		claimed = append(claimed, map[string]interface{}{
+			"id": e.ID, "event_type": e.EventType, "payload": e.Payload, "attempts": int32(e.Attempts),
+			"date_created": e.Created, "target_url": r.target, "secret": r.secret,
+		})
+	}
+	return claimed, nil
+}
+
+func (r *webhookRepo) RecordWebhookDelivery(ctx context.Context, eventID int64, attempt, statusCode int, deliveryErr string, elapsed time.Duration, state status.WebhookStatus, nextAttemptAt time.Time) error {
+	r.wmu.Lock()
+	defer r.wmu.Unlock()
+	e := r.outbox[eventID-1]
+	e.Status, e.Next = state, nextAttemptAt
+	e.Codes = append(e.Codes, statusCode)
+	return nil
+}
+
+// withWebhookSettings retries immediately so a test dispatch runs every attempt
+func withWebhookSettings(t *testing.T, maxAttempts int) {
+	t.Helper()
+	saved := webhookSettings
+	webhookSettings = config.WebhooksConfig{Interval: time.Second, Timeout: 2 * time.Second, MaxAttempts: maxAttempts}
+	t.Cleanup(func() { webhookSettings = saved })
+}
+
+func newWebhookTest(t *testing.T, handler http.HandlerFunc) (*LuckyNumberService, *webhookRepo) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	repo := &webhookRepo{memRepo: newMemRepo(), target: srv.URL, secret: "partner-secret"}
+	s := newTestService(t, repo, nil)
+	s.publishEvent(context.Background(), EventBetSettled, testMsisdn, map[string]interface{}{"reference": "REF1", "amount": 50})
+	return s, repo
+}
+
+func TestWebhookSignature(t *testing.T) {
+	withWebhookSettings(t, 3)
+	var got struct {
+		headers http.Header
+		body    []byte
+	}
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		got.headers = r.Header.Clone()
+		got.body, _ = io.ReadAll(r.Body)
+	})
+
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	if e := repo.outbox[0]; e.Status != WebhookDelivered || e.Attempts != 1 {
+		t.Fatalf("event = %+v, want delivered on the first attempt", e)
+	}
+	want := SignWebhook("partner-secret", got.headers.Get(WebhookTimestampHeader), got.body)
+	if sig := got.headers.Get(WebhookSignatureHeader); sig != want {
+		t.Errorf("signature = %s, want %s", sig, want)
+	}
+	if SignWebhook("other-secret", got.headers.Get(WebhookTimestampHeader), got.body) == want {
+		t.Error("a different secret must not produce the same signature")
+	}
+	if got.headers.Get(WebhookEventHeader) != EventBetSettled || got.headers.Get(WebhookIDHeader) != "1" {
+		t.Errorf("headers = %v, want the event type and id", got.headers)
+	}
+	var body struct {
+		ID    int64                  `json:"id"`
+		Event string                 `json:"event"`
+		Data  map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(got.body, &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.ID != 1 || body.Event != EventBetSettled || body.Data["reference"] != "REF1" {
+		t.Errorf("body = %+v, want event 1 carrying the payload", body)
+	}
+}
+
+func TestWebhookRetriesOnServerError(t *testing.T) {
+	withWebhookSettings(t, 5)
+	var calls atomic.Int32
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= 2 {
+			w.WriteHeader(500)
+		}
+	})
+
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	e := repo.outbox[0]
+	if e.Status != WebhookDelivered || e.Attempts != 3 {
+		t.Errorf("event = %+v, want delivered on the third attempt", e)
+	}
+	if want := []int{500, 500, 200}; len(e.Codes) != 3 || e.Codes[0] != want[0] || e.Codes[2] != want[2] {
+		t.Errorf("recorded attempts %v, want %v", e.Codes, want)
+	}
+}
+
+func TestWebhookFailsAfterMaxAttempts(t *testing.T) {
+	withWebhookSettings(t, 3)
+	var calls atomic.Int32
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(503)
+	})
+
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	if e := repo.outbox[0]; e.Status != WebhookFailed || e.Attempts != 3 {
+		t.Errorf("event = %+v, want failed after 3 attempts", e)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("receiver saw %d attempts, want 3", calls.Load())
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	saved := webhookSettings
+	defer func() { webhookSettings = saved }()
+	webhookSettings.BackoffBase, webhookSettings.BackoffMax = 10*time.Second, time.Minute
+
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second, 3: 40 * time.Second, 4: time.Minute, 9: time.Minute} {
+		if got := webhookBackoff(attempt); got != want {
+			t.Errorf("webhookBackoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
+
+func TestWebhookRetryWaitsForBackoff(t *testing.T) {
+	withWebhookSettings(t, 5)
+	webhookSettings.BackoffBase, webhookSettings.BackoffMax = time.Minute, time.Hour
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	e := repo.outbox[0]
+	if e.Status != WebhookPending || e.Attempts != 1 {
+		t.Fatalf("event = %+v, want pending after one attempt", e)
+	}
+	if wait := time.Until(e.Next); wait < 59*time.Second || wait > time.Minute {
+		t.Errorf("next attempt in %s, want the one-minute backoff", wait)
+	}
+}
+
+func TestWebhooksInOrderPerPlayer(t *testing.T) {
+	withWebhookSettings(t, 3)
+	const players, events = 4, 5
+	var mu sync.Mutex
+	received := map[string][]int{}
+	inFlight := map[string]int{}
+	overlapped := false
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Data struct {
+				Msisdn string `json:"msisdn"`
+				Seq    int    `json:"seq"`
+			} `json:"data"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		msisdn := body.Data.Msisdn
+		mu.Lock()
+		if inFlight[msisdn]++; inFlight[msisdn] > 1 {
+			overlapped = true
+		}
+		mu.Unlock()
+		time.Sleep(2 * time.Millisecond)
+		mu.Lock()
+		inFlight[msisdn]--
+		received[msisdn] = append(received[msisdn], body.Data.Seq)
+		mu.Unlock()
+	})
+	repo.outbox = nil // newWebhookTest's event
+	for seq := 0; seq < events; seq++ {
+		for p := 0; p < players; p++ {
+			msisdn := fmt.Sprintf("2547000000%02d", p)
+			s.publishEvent(context.Background(), EventBetSettled, msisdn, map[string]interface{}{"msisdn": msisdn, "seq": seq})
+		}
+	}
+
+	// One dispatch keeps claiming until every event is out
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	if overlapped {
+		t.Error("two events of one player were delivered at once")
+	}
+	for p := 0; p < players; p++ {
+		msisdn := fmt.Sprintf("2547000000%02d", p)
+		if got := received[msisdn]; !slices.Equal(got, []int{0, 1, 2, 3, 4}) {
+			t.Errorf("%s received %v, want its events in the order queued", msisdn, got)
+		}
+	}
+	for _, e := range repo.outbox {
+		if e.Status != WebhookDelivered || e.Attempts != 1 {
+			t.Errorf("event = %+v, want delivered once", e)
+		}
+	}
+}
+
+func TestWebhookFailureHoldsPlayersLaterEvents(t *testing.T) {
+	withWebhookSettings(t, 5)
+	webhookSettings.BackoffBase, webhookSettings.BackoffMax = time.Minute, time.Hour
+	s, repo := newWebhookTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if body, _ := io.ReadAll(r.Body); strings.Contains(string(body), "REF1") {
+			w.WriteHeader(500)
+		}
+	})
+	s.publishEvent(context.Background(), EventBetSettled, testMsisdn, map[string]interface{}{"reference": "REF2"})
+	s.publishEvent(context.Background(), EventBetSettled, "254700000002", map[string]interface{}{"reference": "REF3"})
+
+	s.dispatchWebhooks(context.Background(), http.DefaultClient)
+
+	if e := repo.outbox[0]; e.Status != WebhookPending || e.Attempts != 1 {
+		t.Errorf("first event = %+v, want pending its retry", e)
+	}
+	if e := repo.outbox[1]; e.Status != WebhookPending || e.Attempts != 0 {
+		t.Errorf("the player's next event = %+v, want held behind the first", e)
+	}
+	if e := repo.outbox[2]; e.Status != WebhookDelivered {
+		t.Errorf("another player's event = %+v, want delivered", e)
+	}
+}
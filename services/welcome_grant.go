@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// welcomeGrantKey is the lookup cache key of the welcome grant settings.
+// Every worker rereads them after limits.lookup_cache_ttl, so a change
+// reaches all of them within that time.
+const welcomeGrantKey = "welcome_grant"
+
+// Welcome grant bounds an admin can set
+const (
+	maxWelcomeFreeBets   = 100
+	maxWelcomeValidHours = 24 * 30
+	defaultWelcomeHours  = 72
+)
+
+var ErrInvalidWelcomeGrant = errors.New("invalid welcome grant")
+
+// WelcomeGrant is what a brand-new player gets on verifying their first
+// login OTP
+type WelcomeGrant struct {
+	Enabled     bool       `json:"enabled"`
+	FreeBets    int        `json:"free_bets" example:"3"`
+	ValidHours  int        `json:"valid_hours" example:"72"`
+	UpdatedBy   string     `json:"updated_by,omitempty"`
+	DateUpdated *time.Time `json:"date_updated,omitempty"`
+}
+
+// GetWelcomeGrant returns the welcome grant settings through the lookup
+// cache. With none stored the grant is off.
+func (s *LuckyNumberService) GetWelcomeGrant(ctx context.Context) (WelcomeGrant, error) {
+	if s == nil || s.db == nil {
+		return WelcomeGrant{}, fmt.Errorf("service or database not initialized")
+	}
+	row, err := s.lookups.Get(ctx, welcomeGrantKey, func(ctx context.Context) (map[string]interface{}, error) {
+		w, err := s.db.GetWelcomeGrantSettings(ctx)
+		if err != nil {
+			return nil, err
+		}
+		grant := WelcomeGrant{ValidHours: defaultWelcomeHours}
+		if w != nil {
+			grant = WelcomeGrant{Enabled: w.Enabled, FreeBets: w.FreeBets, ValidHours: w.ValidHours, UpdatedBy: w.UpdatedBy}
+			if !w.DateUpdated.IsZero() {
+				grant.DateUpdated = &w.DateUpdated
+			}
+		}
+		return map[string]interface{}{"grant": grant}, nil
+	})
+	if err != nil {
+		return WelcomeGrant{}, err
+	}
+	grant, _ := row["grant"].(WelcomeGrant)
+	return grant, nil
+}
+
+// SetWelcomeGrant changes the welcome grant on behalf of admin. A nil field
+// keeps its current value. The change applies here at once and in other
+// processes within limits.lookup_cache_ttl; players already granted keep
+// what they got.
+func (s *LuckyNumberService) SetWelcomeGrant(admin string, enabled *bool, freeBets, validHours *int) (WelcomeGrant, error) {
+	if s == nil || s.db == nil {
+		return WelcomeGrant{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Start from the stored settings, read past the cache
+	s.lookups.Forget(welcomeGrantKey)
+	grant, err := s.GetWelcomeGrant(ctx)
+	if err != nil {
+		return WelcomeGrant{}, err
+	}
+	if enabled != nil {
+		grant.Enabled = *enabled
+	}
+	if freeBets != nil {
+		grant.FreeBets = *freeBets
+	}
+	if validHours != nil {
+		grant.ValidHours = *validHours
+	}
+	if grant.FreeBets < 0 || grant.FreeBets > maxWelcomeFreeBets {
+		return WelcomeGrant{}, fmt.Errorf("%w: free_bets must be 0 to %d", ErrInvalidWelcomeGrant, maxWelcomeFreeBets)
+	}
+	if grant.ValidHours < 1 || grant.ValidHours > maxWelcomeValidHours {
+		return WelcomeGrant{}, fmt.Errorf("%w: valid_hours must be 1 to %d", ErrInvalidWelcomeGrant, maxWelcomeValidHours)
+	}
+	if grant.Enabled && grant.FreeBets == 0 {
+		return WelcomeGrant{}, fmt.Errorf("%w: free_bets must be set to enable the grant", ErrInvalidWelcomeGrant)
+	}
+
+	if err := s.db.SetWelcomeGrantSettings(ctx, grant.Enabled, grant.FreeBets, grant.ValidHours, admin); err != nil {
+		return WelcomeGrant{}, err
+	}
+	logrus.Warnf("welcome grant: %s set enabled=%t free_bets=%d valid_hours=%d",
+		admin, grant.Enabled, grant.FreeBets, grant.ValidHours)
+
+	s.lookups.Forget(welcomeGrantKey)
+	return s.GetWelcomeGrant(ctx)
+}
+
+// GrantWelcomeFreeBets gives msisdn, who has just verified a login OTP, the
+// welcome free bets when the grant is on and they are brand new: never
+// granted before and never placed a bet. It returns how many were granted,
+// 0 when none were. However often or concurrently it is called for a
+// player, at most one call grants.
+func (s *LuckyNumberService) GrantWelcomeFreeBets(ctx context.Context, msisdn string) (int, error) {
+	grant, err := s.GetWelcomeGrant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !grant.Enabled || grant.FreeBets <= 0 {
+		return 0, nil
+	}
+
+	expiry := time.Now().Add(time.Duration(grant.ValidHours) * time.Hour)
+	granted, err := s.db.GrantWelcomeFreeBets(ctx, msisdn, grant.FreeBets, expiry)
+	if err != nil || !granted {
+		return 0, err
+	}
+	logrus.Infof("welcome grant: %d free bets to %s, valid until %s", grant.FreeBets, msisdn, expiry.Format(time.RFC3339))
+	return grant.FreeBets, nil
+}
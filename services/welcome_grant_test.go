@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"sync"
+	"testing"
+	"time"
+)
+
+// welcomeRepo stores the welcome grant settings and grants as the SQL
+// does: once per player, never to one who has bet or was already decided
+type welcomeRepo struct {
+	*memRepo
+	settings *database.WelcomeGrantSettings
+	decided  map[string]bool // welcome_grant_at set
+	hasBets  map[string]bool
+	logs     []string // welcome_grant CustomerLogs rows, by msisdn
+	grants   int      // GrantWelcomeFreeBets calls
+}
+
+func newWelcomeRepo() *welcomeRepo {
+	repo := &welcomeRepo{memRepo: newMemRepo(), decided: map[string]bool{}, hasBets: map[string]bool{}}
+	repo.addPlayer(testMsisdn, 0)
+	return repo
+}
+
+func (r *welcomeRepo) GetWelcomeGrantSettings(ctx context.Context) (*database.WelcomeGrantSettings, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settings == nil {
+		return nil, nil
+	}
+	w := *r.settings
+	return &w, nil
+}
+
+func (r *welcomeRepo) SetWelcomeGrantSettings(ctx context.Context, enabled bool, freeBets, validHours int, admin string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.settings = &database.WelcomeGrantSettings{Enabled: enabled, FreeBets: freeBets, ValidHours: validHours, UpdatedBy: admin, DateUpdated: time.Now()}
+	return nil
+}
+
+func (r *welcomeRepo) GrantWelcomeFreeBets(ctx context.Context, msisdn string, freeBets int, expiry time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.grants++
+	p, ok := r.players[msisdn]
+	if !ok || r.decided[msisdn] || r.hasBets[msisdn] {
+		return false, nil
+	}
+	p.FreeBet += int64(freeBets)
+	if expiry.After(p.FreeBetEnds) {
+		p.FreeBetEnds = expiry
+	}
+	r.decided[msisdn] = true
+	r.logs = append(r.logs, msisdn)
+	return true, nil
+}
+
+func enableWelcomeGrant(t *testing.T, s *LuckyNumberService, freeBets, hours int) {
+	t.Helper()
+	enabled := true
+	if _, err := s.SetWelcomeGrant("admin", &enabled, &freeBets, &hours); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWelcomeGrantOncePerPlayer(t *testing.T) {
+	repo := newWelcomeRepo()
+	s := newTestService(t, repo, nil)
+	enableWelcomeGrant(t, s, 3, 72)
+	ctx := context.Background()
+
+	n, err := s.GrantWelcomeFreeBets(ctx, testMsisdn)
+	if err != nil || n != 3 {
+		t.Fatalf("first verification granted %d, %v; want 3", n, err)
+	}
+	p := repo.player(testMsisdn)
+	if p.FreeBet != 3 || p.FreeBetEnds.Before(time.Now().Add(71*time.Hour)) || p.FreeBetEnds.After(time.Now().Add(72*time.Hour)) {
+		t.Errorf("player = %+v, want 3 free bets for 72 hours", p)
+	}
+	// Verifying again grants nothing
+	if n, err := s.GrantWelcomeFreeBets(ctx, testMsisdn); err != nil || n != 0 {
+		t.Errorf("re-verification granted %d, %v; want none", n, err)
+	}
+	if p := repo.player(testMsisdn); p.FreeBet != 3 || len(repo.logs) != 1 {
+		t.Errorf("player has %d free bets and %d log rows, want 3 and 1", p.FreeBet, len(repo.logs))
+	}
+}
+
+func TestWelcomeGrantConcurrentVerifications(t *testing.T) {
+	repo := newWelcomeRepo()
+	s := newTestService(t, repo, nil)
+	enableWelcomeGrant(t, s, 2, 24)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	total := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := s.GrantWelcomeFreeBets(context.Background(), testMsisdn)
+			if err != nil {
+				t.Error(err)
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if total != 2 || repo.player(testMsisdn).FreeBet != 2 || len(repo.logs) != 1 {
+		t.Errorf("10 concurrent verifications granted %d, player holds %d, %d log rows; want 2, 2 and 1",
+			total, repo.player(testMsisdn).FreeBet, len(repo.logs))
+	}
+}
+
+func TestWelcomeGrantExcludesReturningPlayers(t *testing.T) {
+	repo := newWelcomeRepo()
+	s := newTestService(t, repo, nil)
+	enableWelcomeGrant(t, s, 3, 72)
+	repo.addPlayer("254700000002", 0)
+	repo.decided[testMsisdn] = true     // a player from before the grant existed
+	repo.hasBets["254700000002"] = true // a player who has bet
+
+	for _, msisdn := range []string{testMsisdn, "254700000002"} {
+		if n, err := s.GrantWelcomeFreeBets(context.Background(), msisdn); err != nil || n != 0 {
+			t.Errorf("returning player %s granted %d, %v; want none", msisdn, n, err)
+		}
+		if p := repo.player(msisdn); p.FreeBet != 0 {
+			t.Errorf("returning player %s holds %d free bets", msisdn, p.FreeBet)
+		}
+	}
+}
+
+func TestWelcomeGrantFlag(t *testing.T) {
+	repo := newWelcomeRepo()
+	s := newTestService(t, repo, nil)
+	ctx := context.Background()
+
+	// No settings stored: off, and the database is not asked
+	if n, err := s.GrantWelcomeFreeBets(ctx, testMsisdn); err != nil || n != 0 || repo.grants != 0 {
+		t.Errorf("grant with no settings = %d, %v after %d grant calls; want none", n, err, repo.grants)
+	}
+	if grant, _ := s.GetWelcomeGrant(ctx); grant.Enabled || grant.ValidHours != defaultWelcomeHours {
+		t.Errorf("default grant = %+v, want off for %d hours", grant, defaultWelcomeHours)
+	}
+
+	enableWelcomeGrant(t, s, 3, 72)
+	disabled := false
+	if _, err := s.SetWelcomeGrant("admin", &disabled, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GrantWelcomeFreeBets(ctx, testMsisdn); n != 0 || repo.grants != 0 {
+		t.Errorf("grant switched off granted %d", n)
+	}
+	if grant, _ := s.GetWelcomeGrant(ctx); grant.FreeBets != 3 || grant.UpdatedBy != "admin" || grant.DateUpdated == nil {
+		t.Errorf("grant = %+v, want the count kept while off and the admin recorded", grant)
+	}
+
+	// Switching it back on takes effect at once, for a player not yet decided
+	enabled := true
+	if _, err := s.SetWelcomeGrant("admin", &enabled, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := s.GrantWelcomeFreeBets(ctx, testMsisdn); n != 3 {
+		t.Errorf("grant switched back on granted %d, want 3", n)
+	}
+}
+
+func TestSetWelcomeGrantRejects(t *testing.T) {
+	repo := newWelcomeRepo()
+	s := newTestService(t, repo, nil)
+	on, zero, many, noHours, tooLong := true, 0, maxWelcomeFreeBets+1, 0, maxWelcomeValidHours+1
+
+	for name, set := range map[string]func() error{
+		"too many free bets":   func() error { _, err := s.SetWelcomeGrant("admin", nil, &many, nil); return err },
+		"no hours":             func() error { _, err := s.SetWelcomeGrant("admin", nil, nil, &noHours); return err },
+		"too long":             func() error { _, err := s.SetWelcomeGrant("admin", nil, nil, &tooLong); return err },
+		"enabled with none":    func() error { _, err := s.SetWelcomeGrant("admin", &on, &zero, nil); return err },
+		"enabled, count unset": func() error { _, err := s.SetWelcomeGrant("admin", &on, nil, nil); return err },
+	} {
+		if err := set(); !errors.Is(err, ErrInvalidWelcomeGrant) {
+			t.Errorf("%s = %v, want ErrInvalidWelcomeGrant", name, err)
+		}
+	}
+	if repo.settings != nil {
+		t.Errorf("settings stored after rejected changes: %+v", repo.settings)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/utils"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrWithdrawalRetryLimit = errors.New("withdrawal retry limit reached, flagged for manual resolution")
+
+// StuckWithdrawal is a processed withdrawal the disbursement partner has
+// not paid: it rejected it, or never called back
+type StuckWithdrawal struct {
+	Reference        string     `json:"reference"`
+	Msisdn           string     `json:"msisdn"`
+	Amount           float64    `json:"amount"`
+	Disburse         string     `json:"disburse,omitempty"` // the partner's last status; empty when it never called back
+	Description      string     `json:"description,omitempty"`
+	TransactionID    string     `json:"transaction_id,omitempty"`
+	Retries          int        `json:"retries"`
+	LastRetry        *time.Time `json:"last_retry,omitempty"`
+	ManualResolution bool       `json:"manual_resolution"`
+	DateCreated      time.Time  `json:"date_created"`
+}
+
+// StuckWithdrawalPage is one page of stuck withdrawals, oldest first
+type StuckWithdrawalPage struct {
+	Withdrawals []StuckWithdrawal `json:"withdrawals"`
+	Page        int               `json:"page"`
+	PageSize    int               `json:"page_size"`
+	Total       int64             `json:"total"`
+	TotalPages  int               `json:"total_pages"`
+}
+
+// WithdrawalRetry describes a re-drive. ManualResolution is set, and
+// nothing requeued, once the retry limit was reached.
+type WithdrawalRetry struct {
+	Reference        string `json:"reference"`
+	Attempt          int    `json:"attempt"`
+	RetriesLeft      int    `json:"retries_left"`
+	ManualResolution bool   `json:"manual_resolution"`
+}
+
+// StuckWithdrawals lists processed withdrawals older than olderThan, or
+// limits.withdrawal_stuck_age when it is 0, that no successful
+// disbursement callback has matched
+func (s *LuckyNumberService) StuckWithdrawals(olderThan time.Duration, page utils.Page) (StuckWithdrawalPage, error) {
+	if s == nil || s.db == nil {
+		return StuckWithdrawalPage{}, fmt.Errorf("service or database not initialized")
+	}
+	if olderThan <= 0 {
+		olderThan = limits.WithdrawalStuckAge
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, total, err := s.db.FindUndisbursedWithdrawals(ctx, olderThan, page.Size, page.Offset())
+	if err != nil {
+		return StuckWithdrawalPage{}, err
+	}
+	result := StuckWithdrawalPage{
+		Withdrawals: make([]StuckWithdrawal, 0, len(rows)),
+		Page:        page.Number,
+		PageSize:    page.Size,
+		Total:       total,
+		TotalPages:  page.TotalPages(total),
+	}
+	for _, row := range rows {
+		w := StuckWithdrawal{
+			Reference:        utils.ToString(row["reference"]),
+			Msisdn:           utils.ToString(row["msisdn"]),
+			Amount:           utils.ToFloat64(row["amount"]),
+			Disburse:         utils.ToString(row["disburse"]),
+			Description:      utils.ToString(row["description"]),
+			TransactionID:    utils.ToString(row["transaction_id"]),
+			Retries:          utils.ToInt(row["disburse_retries"]),
+			ManualResolution: row["manual_resolution"] == true,
+		}
+		w.DateCreated, _ = row["date_created"].(time.Time)
+		if t, ok := row["disburse_retried_at"].(time.Time); ok {
+			w.LastRetry = &t
+		}
+		result.Withdrawals = append(result.Withdrawals, w)
+	}
+	return result, nil
+}
+
+// RetryWithdrawal puts stuck withdrawal reference back on the disbursement
+// queue on behalf of admin. A withdrawal may be re-driven
+// limits.withdrawal_retry_max times; asking again flags it for manual
+// resolution, tells the player it is delayed and returns
+// ErrWithdrawalRetryLimit. One the partner has paid in the meantime, or
+// has been sent less than limits.withdrawal_stuck_age ago without an
+// answer yet, is not re-driven (database.ErrWithdrawalDisbursed and
+// friends).
+func (s *LuckyNumberService) RetryWithdrawal(admin, reference string) (WithdrawalRetry, error) {
+	if s == nil || s.db == nil {
+		return WithdrawalRetry{}, fmt.Errorf("service or database not initialized")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	w, err := s.db.RetryWithdrawal(ctx, reference, admin, limits.WithdrawalRetryMax, limits.WithdrawalStuckAge)
+	if err != nil {
+		return WithdrawalRetry{}, err
+	}
+	retry := WithdrawalRetry{
+		Reference:   w.Reference,
+		Attempt:     w.Attempt,
+		RetriesLeft: max(limits.WithdrawalRetryMax-w.Attempt, 0),
+	}
+
+	if w.Outcome == database.WithdrawalManual {
+		retry.ManualResolution = true
+		logrus.Warnf("withdrawal %s: %s asked for retry %d, flagged for manual resolution", reference, admin, w.Attempt)
+		utils.GoBackground("withdrawal apology", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			s.apologizeForWithdrawal(ctx, w)
+		})
+		return retry, ErrWithdrawalRetryLimit
+	}
+	logrus.Infof("withdrawal %s: requeued by %s (%d/%d)", reference, admin, w.Attempt, limits.WithdrawalRetryMax)
+	return retry, nil
+}
+
+// apologizeForWithdrawal tells the player a withdrawal left for ops to
+// resolve is delayed
+func (s *LuckyNumberService) apologizeForWithdrawal(ctx context.Context, w *database.WithdrawalRetry) {
+	player, err := s.db.CheckUser(ctx, w.Msisdn)
+	if err != nil {
+		logrus.Errorf("withdrawal %s: load player failed: %v", w.Reference, err)
+	}
+	message := s.renderMessage(ctx, TemplateWithdrawalHeld, utils.ToString(player["language"]), map[string]string{
+		"amount":    fmt.Sprintf("%.2f", w.Amount),
+		"reference": w.Reference,
+	})
+	if err := s.sendsms(w.Msisdn, message); err != nil {
+		logrus.Errorf("withdrawal %s: apology sms to %s failed, retrying: %v", w.Reference, w.Msisdn, err)
+		retrySMSLater("apology for withdrawal "+w.Reference, func(context.Context) error {
+			return s.sendsms(w.Msisdn, message)
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"fiberapp/models"
+	"fiberapp/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stuckWithdrawal is a processed "withdrawals" row as retryRepo keeps it
+type stuckWithdrawal struct {
+	msisdn    string
+	amount    float64
+	disburse  string // empty while the partner has not called back
+	retries   int
+	manual    bool
+	retriedAt time.Time
+}
+
+// retryRepo re-drives withdrawals as RetryWithdrawal does: disbursed,
+// manual and young unanswered rows are refused, the one past maxRetries is
+// flagged manual instead of requeued. Callbacks land through
+// UpdatePawaBoxKeWithdrawalDisburse.
+type retryRepo struct {
+	*memRepo
+	stuck    map[string]*stuckWithdrawal
+	requeued []string
+	audit    []database.WithdrawalRetry
+	lookups  []string
+	olderArg time.Duration
+}
+
+func newRetryRepo() *retryRepo {
+	repo := &retryRepo{memRepo: newMemRepo(), stuck: map[string]*stuckWithdrawal{
+		"W1": {msisdn: testMsisdn, amount: 500, disburse: "Failed", retriedAt: time.Now().Add(-time.Hour)},
+	}}
+	repo.addPlayer(testMsisdn, 0)
+	return repo
+}
+
+func (r *retryRepo) FindUndisbursedWithdrawals(ctx context.Context, olderThan time.Duration, limit, offset int) ([]map[string]interface{}, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.olderArg = olderThan
+	retried := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	return []map[string]interface{}{
+		{"reference": "W1", "msisdn": testMsisdn, "amount": 500.0, "disburse": "Failed", "description": "invalid msisdn",
+			"disburse_retries": int32(2), "disburse_retried_at": retried, "manual_resolution": false,
+			"date_created": time.Date(2026, 3, 1, 8, 0, 0, 0, time.UTC)},
+		{"reference": "W2", "msisdn": testMsisdn, "amount": 200.0, "disburse": nil, "description": nil,
+			"disburse_retries": int32(0), "disburse_retried_at": nil, "manual_resolution": true,
+			"date_created": time.Date(2026, 3, 1, 8, 30, 0, 0, time.UTC)},
+	}, 7, nil
+}
+
+func (r *retryRepo) RetryWithdrawal(ctx context.Context, reference, admin string, maxRetries int, awaitCallback time.Duration) (*database.WithdrawalRetry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.stuck[reference]
+	switch {
+	case !ok:
+		return nil, database.ErrWithdrawalNotFound
+	case strings.EqualFold(w.disburse, "0") || strings.EqualFold(w.disburse, "success"):
+		return nil, database.ErrWithdrawalDisbursed
+	case w.manual:
+		return nil, database.ErrWithdrawalManual
+	case w.disburse == "" && time.Since(w.retriedAt) < awaitCallback:
+		return nil, database.ErrWithdrawalAwaitingCallback
+	}
+	retry := database.WithdrawalRetry{Msisdn: w.msisdn, Amount: w.amount, Reference: reference,
+		Attempt: w.retries + 1, Outcome: database.WithdrawalRequeued}
+	if w.retries >= maxRetries {
+		retry.Outcome = database.WithdrawalManual
+		w.manual = true
+	} else {
+		w.disburse, w.retriedAt = "", time.Now()
+		w.retries++
+		r.requeued = append(r.requeued, reference)
+	}
+	r.audit = append(r.audit, retry)
+	return &retry, nil
+}
+
+func (r *retryRepo) UpdatePawaBoxKeWithdrawalDisburse(ctx context.Context, transactionID, disburse, description, reference string) (*database.DisbursedWithdrawal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w, ok := r.stuck[reference]
+	if !ok {
+		return nil, nil
+	}
+	w.disburse = disburse
+	return &database.DisbursedWithdrawal{Msisdn: w.msisdn, Amount: w.amount, Reference: reference}, nil
+}
+
+func (r *retryRepo) CheckUser(ctx context.Context, msisdn string) (map[string]interface{}, error) {
+	r.mu.Lock()
+	r.lookups = append(r.lookups, msisdn)
+	r.mu.Unlock()
+	return r.memRepo.CheckUser(ctx, msisdn)
+}
+
+// retryLimits sets the re-drive tunables for the test
+func retryLimits(t *testing.T, maxRetries int, stuckAge time.Duration) {
+	t.Helper()
+	saved := limits
+	limits.WithdrawalRetryMax, limits.WithdrawalStuckAge = maxRetries, stuckAge
+	t.Cleanup(func() { limits = saved })
+}
+
+func TestStuckWithdrawalsPage(t *testing.T) {
+	retryLimits(t, 3, 30*time.Minute)
+	repo := newRetryRepo()
+	s := newTestService(t, repo, nil)
+
+	result, err := s.StuckWithdrawals(0, utils.Page{Number: 2, Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.olderArg != 30*time.Minute {
+		t.Errorf("olderThan = %v, want limits.withdrawal_stuck_age by default", repo.olderArg)
+	}
+	if result.Total != 7 || result.TotalPages != 4 || result.Page != 2 || len(result.Withdrawals) != 2 {
+		t.Fatalf("page = %+v", result)
+	}
+	w := result.Withdrawals[0]
+	if w.Reference != "W1" || w.Amount != 500 || w.Disburse != "Failed" || w.Retries != 2 || w.LastRetry == nil || w.ManualResolution {
+		t.Errorf("rejected withdrawal = %+v", w)
+	}
+	if w := result.Withdrawals[1]; w.Disburse != "" || w.LastRetry != nil || !w.ManualResolution {
+		t.Errorf("never answered withdrawal = %+v, want no disburse or last retry", w)
+	}
+
+	if _, err := s.StuckWithdrawals(2*time.Hour, utils.Page{Number: 1, Size: 20}); err != nil || repo.olderArg != 2*time.Hour {
+		t.Errorf("olderThan = %v, %v, want 2h", repo.olderArg, err)
+	}
+}
+
+func TestRetryWithdrawalCap(t *testing.T) {
+	retryLimits(t, 2, 0)
+	repo := newRetryRepo()
+	s := newTestService(t, repo, nil)
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		retry, err := s.RetryWithdrawal("ops", "W1")
+		if err != nil {
+			t.Fatalf("retry %d: %v", attempt, err)
+		}
+		if retry.Attempt != attempt || retry.RetriesLeft != 2-attempt || retry.ManualResolution {
+			t.Errorf("retry %d = %+v", attempt, retry)
+		}
+		repo.stuck["W1"].disburse = "Failed"
+	}
+
+	retry, err := s.RetryWithdrawal("ops", "W1")
+	if !errors.Is(err, ErrWithdrawalRetryLimit) || !retry.ManualResolution || retry.Attempt != 3 || retry.RetriesLeft != 0 {
+		t.Fatalf("retry past the limit = %+v, %v, want ErrWithdrawalRetryLimit", retry, err)
+	}
+	if len(repo.requeued) != 2 || len(repo.audit) != 3 || repo.audit[2].Outcome != database.WithdrawalManual {
+		t.Errorf("requeued %v, audit %+v, want 2 requeued and the manual flag recorded", repo.requeued, repo.audit)
+	}
+	if _, err := s.RetryWithdrawal("ops", "W1"); !errors.Is(err, database.ErrWithdrawalManual) {
+		t.Errorf("retry once flagged = %v, want ErrWithdrawalManual", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := utils.WaitBackground(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.lookups) != 1 || repo.lookups[0] != testMsisdn {
+		t.Errorf("apology looked up %v, want the player once", repo.lookups)
+	}
+	message := s.renderMessage(context.Background(), TemplateWithdrawalHeld, "", map[string]string{"amount": "500.00", "reference": "W1"})
+	if !strings.Contains(message, "KES 500.00, ref W1, is delayed") {
+		t.Errorf("apology = %q", message)
+	}
+}
+
+func TestRetryWithdrawalAfterLateCallback(t *testing.T) {
+	retryLimits(t, 3, 30*time.Minute)
+	repo := newRetryRepo()
+	s := newTestService(t, repo, nil)
+
+	ok, err := s.UpdateLuckyNumberWithdrawalDisburse(models.WithdrawalCallback{Reference: "W1", TransactionID: "TX1", Status: "0"})
+	if err != nil || !ok {
+		t.Fatalf("callback = %v, %v", ok, err)
+	}
+	if _, err := s.RetryWithdrawal("ops", "W1"); !errors.Is(err, database.ErrWithdrawalDisbursed) {
+		t.Errorf("retry after a success callback = %v, want ErrWithdrawalDisbursed", err)
+	}
+	if len(repo.requeued) != 0 || len(repo.audit) != 0 {
+		t.Errorf("requeued %v, audit %+v, want nothing", repo.requeued, repo.audit)
+	}
+}
+
+func TestRetryWithdrawalAwaitsCallback(t *testing.T) {
+	retryLimits(t, 3, 30*time.Minute)
+	repo := newRetryRepo()
+	s := newTestService(t, repo, nil)
+
+	repo.stuck["W1"].disburse = ""
+	if _, err := s.RetryWithdrawal("ops", "W1"); err != nil {
+		t.Fatalf("retry of one unanswered for an hour = %v", err)
+	}
+	if _, err := s.RetryWithdrawal("ops", "W1"); !errors.Is(err, database.ErrWithdrawalAwaitingCallback) {
+		t.Errorf("retry straight after a retry = %v, want ErrWithdrawalAwaitingCallback", err)
+	}
+	if _, err := s.RetryWithdrawal("ops", "W9"); !errors.Is(err, database.ErrWithdrawalNotFound) {
+		t.Errorf("unknown reference = %v, want ErrWithdrawalNotFound", err)
+	}
+	if len(repo.requeued) != 1 {
+		t.Errorf("requeued %v, want once", repo.requeued)
+	}
+}
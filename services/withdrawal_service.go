@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/clock"
+	"fiberapp/database"
+	"fiberapp/money"
+	"fiberapp/utils"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithdrawalWindow is the rolling window withdrawal_max_count and
+// withdrawal_max_amount are counted over
+const WithdrawalWindow = 24 * time.Hour
+
+// auditWithdrawalVelocity is the admin_audit_log action of a withdrawal
+// refused by the velocity limits
+const auditWithdrawalVelocity = "withdrawal_velocity"
+
+var (
+	ErrWithdrawalAmount      = errors.New("invalid withdrawal amount")
+	ErrWithdrawalOTPRequired = errors.New("otp required for this amount")
+)
+
+// WithdrawalResult is what the player sees after a successful withdrawal
+type WithdrawalResult struct {
+	Reference string  `json:"reference"`
+	Amount    float64 `json:"amount"`
+	Balance   float64 `json:"balance"`
+}
+
+// WithdrawalNeedsOTP reports whether amount is above the settings'
+// withdrawal_otp_threshold
+func WithdrawalNeedsOTP(st database.Settings, amount float64) bool {
+	return st.WithdrawalOTPThreshold > 0 && amount > st.WithdrawalOTPThreshold
+}
+
+// withdrawalLimits are the settings' velocity limits over the window
+// ending at now
+func withdrawalLimits(st database.Settings, now time.Time) database.WithdrawalLimits {
+	return database.WithdrawalLimits{
+		MaxCount:  st.WithdrawalMaxCount,
+		MaxAmount: st.WithdrawalMaxAmount,
+		Since:     now.Add(-WithdrawalWindow),
+	}
+}
+
+// Withdraw sends amount of msisdn's balance to their M-Pesa. Amounts above
+// the OTP threshold need otp, issued for OTPWithdrawal. A withdrawal that
+// would pass the velocity limits is refused with a
+// *database.WithdrawalVelocityError and recorded in admin_audit_log.
+func (s *LuckyNumberService) Withdraw(msisdn string, amount float64, otp string) (WithdrawalResult, error) {
+	if s == nil || s.db == nil {
+		logrus.Warnf("Service or DB not initialized: s=%p, s.db=%p", s, s.db)
+		return WithdrawalResult{}, fmt.Errorf("service or database not initialized")
+	}
+	if money.Check(money.Payout, amount) != nil || amount != math.Trunc(amount) {
+		return WithdrawalResult{}, fmt.Errorf("%w: must be a whole amount above 0", ErrWithdrawalAmount)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	st, err := s.settings(ctx)
+	if err != nil {
+		return WithdrawalResult{}, err
+	}
+	limits := withdrawalLimits(st, clock.Now())
+	if WithdrawalNeedsOTP(st, amount) {
+		if otp == "" {
+			return WithdrawalResult{}, ErrWithdrawalOTPRequired
+		}
+		// Refuse first, so a withdrawal the limits or balance stop does not
+		// use up the player's code
+		if err := s.db.CheckBalanceWithdrawal(ctx, msisdn, amount, limits); err != nil {
+			return WithdrawalResult{}, s.withdrawalRefused(ctx, msisdn, amount, err)
+		}
+		if _, err := s.VerifyOTP(msisdn, OTPWithdrawal, otp); err != nil {
+			return WithdrawalResult{}, err
+		}
+	}
+
+	reference := utils.NewReference(utils.RefWithdraw)
+	balance, err := s.db.WithdrawBalance(ctx, msisdn, amount, reference, limits)
+	if err != nil {
+		return WithdrawalResult{}, s.withdrawalRefused(ctx, msisdn, amount, err)
+	}
+	logrus.Infof("withdrawal %s: %s Ksh.%.2f", reference, msisdn, amount)
+
+	return WithdrawalResult{
+		Reference: reference,
+		Amount:    amount,
+		Balance:   balance,
+	}, nil
+}
+
+// withdrawalRefused returns err, first logging and auditing a refusal by
+// the velocity limits
+func (s *LuckyNumberService) withdrawalRefused(ctx context.Context, msisdn string, amount float64, err error) error {
+	var velocity *database.WithdrawalVelocityError
+	if errors.As(err, &velocity) {
+		logrus.WithField("alert", "withdrawal").Warnf("withdrawal: %s refused Ksh.%.2f: %v", msisdn, amount, err)
+		if err := s.db.LogAdminAccess(ctx, "system", auditWithdrawalVelocity, velocity.Error(), []string{msisdn}); err != nil {
+			logrus.Errorf("withdrawal: audit of %s's refusal failed: %v", msisdn, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fiberapp/database"
+	"strings"
+	"testing"
+	"time"
+)
+
+type memBalanceWithdrawal struct {
+	Msisdn, Reference string
+	Amount            float64
+	Created           time.Time
+}
+
+type memAudit struct {
+	Admin, Action, Query string
+	Msisdns              []string
+}
+
+// withdrawalRepo mirrors WithdrawBalance's transaction over the OTP table
+// and records admin_audit_log
+type withdrawalRepo struct {
+	*otpRepo
+	withdrawals []memBalanceWithdrawal
+	since       time.Time
+	audit       []memAudit
+}
+
+func newWithdrawalRepo() *withdrawalRepo {
+	repo := &withdrawalRepo{otpRepo: newOTPRepo()}
+	repo.settings.WithdrawalOTPThreshold = 1000
+	repo.settings.WithdrawalMaxCount = 3
+	repo.settings.WithdrawalMaxAmount = 5000
+	return repo
+}
+
+func (r *withdrawalRepo) WithdrawBalance(ctx context.Context, msisdn string, amount float64, reference string, limits database.WithdrawalLimits) (float64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.since = limits.Since
+	if err := r.check(msisdn, amount, limits); err != nil {
+		return 0, err
+	}
+	p := r.players[msisdn]
+	p.Balance -= amount
+	r.withdrawals = append(r.withdrawals, memBalanceWithdrawal{Msisdn: msisdn, Reference: reference, Amount: amount, Created: time.Now()})
+	return p.Balance, nil
+}
+
+func (r *withdrawalRepo) CheckBalanceWithdrawal(ctx context.Context, msisdn string, amount float64, limits database.WithdrawalLimits) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.check(msisdn, amount, limits)
+}
+
+// check refuses amount as checkWithdrawal does
+func (r *withdrawalRepo) check(msisdn string, amount float64, limits database.WithdrawalLimits) error {
+	p := r.players[msisdn]
+	if p == nil {
+		return database.ErrWithdrawalPlayer
+	}
+	var count int64
+	var total float64
+	for _, w := range r.withdrawals {
+		if w.Msisdn == msisdn && !w.Created.Before(limits.Since) {
+			count++
+			total += w.Amount
+		}
+	}
+	if err := limits.Check(count, total, amount); err != nil {
+		return err
+	}
+	if p.Balance < amount {
+		return database.ErrInsufficientBalance
+	}
+	return nil
+}
+
+func (r *withdrawalRepo) LogAdminAccess(ctx context.Context, admin, action, query string, msisdns []string) error {
+	r.audit = append(r.audit, memAudit{admin, action, query, msisdns})
+	return nil
+}
+
+// withdrew seeds a withdrawal of amount made ago
+func (r *withdrawalRepo) withdrew(msisdn string, amount float64, ago time.Duration) {
+	r.withdrawals = append(r.withdrawals, memBalanceWithdrawal{Msisdn: msisdn, Amount: amount, Created: time.Now().Add(-ago)})
+}
+
+func TestWithdrawOTPThreshold(t *testing.T) {
+	configureTestOTP(t)
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 10000)
+	s := newTestService(t, repo, nil)
+
+	// At the threshold no code is asked for
+	r, err := s.Withdraw(testMsisdn, 1000, "")
+	if err != nil {
+		t.Fatalf("withdrawal at the threshold = %v, want no OTP needed", err)
+	}
+	if r.Balance != 9000 || !strings.HasPrefix(r.Reference, "WDR_") {
+		t.Errorf("result = %+v, want balance 9000 and a WDR reference", r)
+	}
+
+	if _, err := s.Withdraw(testMsisdn, 1001, ""); !errors.Is(err, ErrWithdrawalOTPRequired) {
+		t.Errorf("withdrawal above the threshold = %v, want ErrWithdrawalOTPRequired", err)
+	}
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPWithdrawal, "4321", now, now+120, false)
+	if _, err := s.Withdraw(testMsisdn, 1001, "4321"); err != nil {
+		t.Errorf("withdrawal with its OTP = %v", err)
+	}
+	if got := repo.player(testMsisdn).Balance; got != 7999 {
+		t.Errorf("balance = %v, want 7999", got)
+	}
+}
+
+func TestWithdrawRejectsLoginOTP(t *testing.T) {
+	configureTestOTP(t)
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 10000)
+	s := newTestService(t, repo, nil)
+
+	now := time.Now().Unix()
+	for _, purpose := range []string{OTPLogin, OTPTransfer} {
+		repo.issue(t, testMsisdn, purpose, "4321", now, now+120, false)
+	}
+	if _, err := s.Withdraw(testMsisdn, 2000, "4321"); !errors.Is(err, ErrOTPInvalid) {
+		t.Errorf("login and transfer codes = %v, want ErrOTPInvalid for a withdrawal", err)
+	}
+	if len(repo.withdrawals) != 0 || repo.player(testMsisdn).Balance != 10000 {
+		t.Error("a withdrawal with another purpose's code must not go through")
+	}
+	if repo.latest(testMsisdn, OTPLogin) == nil {
+		t.Error("the login code should still be unused")
+	}
+}
+
+func TestWithdrawRefusalKeepsOTP(t *testing.T) {
+	configureTestOTP(t)
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 3000)
+	repo.withdrew(testMsisdn, 4500, time.Hour)
+	s := newTestService(t, repo, nil)
+
+	now := time.Now().Unix()
+	repo.issue(t, testMsisdn, OTPWithdrawal, "4321", now, now+120, false)
+	if _, err := s.Withdraw(testMsisdn, 2000, "4321"); !errors.Is(err, database.ErrWithdrawalVelocity) {
+		t.Errorf("withdrawal past the amount cap = %v, want a velocity refusal", err)
+	}
+	if len(repo.audit) != 1 {
+		t.Errorf("audit = %+v, want the refusal recorded", repo.audit)
+	}
+	repo.withdrawals[0].Created = time.Now().Add(-25 * time.Hour)
+	if _, err := s.Withdraw(testMsisdn, 4000, "4321"); !errors.Is(err, database.ErrInsufficientBalance) {
+		t.Errorf("overdraw = %v, want ErrInsufficientBalance", err)
+	}
+	if repo.latest(testMsisdn, OTPWithdrawal) == nil {
+		t.Fatal("refused withdrawals used up the code")
+	}
+
+	// The same code still confirms one that goes through
+	if _, err := s.Withdraw(testMsisdn, 2000, "4321"); err != nil {
+		t.Fatalf("withdrawal with the kept code = %v", err)
+	}
+	if repo.latest(testMsisdn, OTPWithdrawal) != nil || repo.player(testMsisdn).Balance != 1000 {
+		t.Errorf("balance = %v, want 1000 with the code used", repo.player(testMsisdn).Balance)
+	}
+}
+
+func TestWithdrawVelocityWindow(t *testing.T) {
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 100000)
+	repo.withdrew(testMsisdn, 500, 25*time.Hour)
+	repo.withdrew(testMsisdn, 500, 24*time.Hour+time.Minute)
+	repo.withdrew(testMsisdn, 500, 23*time.Hour+59*time.Minute)
+	repo.withdrew(testMsisdn, 500, time.Hour)
+	repo.withdrew("254700000009", 500, time.Minute)
+	s := newTestService(t, repo, nil)
+
+	// Two of the player's withdrawals fall inside the last 24 hours
+	if _, err := s.Withdraw(testMsisdn, 500, ""); err != nil {
+		t.Fatalf("third withdrawal in the window = %v, want allowed", err)
+	}
+	if wait := time.Since(repo.since); wait < WithdrawalWindow || wait > WithdrawalWindow+time.Minute {
+		t.Errorf("window starts %s ago, want %s", wait, WithdrawalWindow)
+	}
+
+	_, err := s.Withdraw(testMsisdn, 500, "")
+	var velocity *database.WithdrawalVelocityError
+	if !errors.As(err, &velocity) || !errors.Is(err, database.ErrWithdrawalVelocity) {
+		t.Fatalf("fourth withdrawal in the window = %v, want a velocity refusal", err)
+	}
+	if velocity.Count != 3 || velocity.Total != 1500 {
+		t.Errorf("counted %d totalling %v, want 3 totalling 1500", velocity.Count, velocity.Total)
+	}
+	if len(repo.audit) != 1 || repo.audit[0].Action != auditWithdrawalVelocity || repo.audit[0].Msisdns[0] != testMsisdn {
+		t.Errorf("audit = %+v, want one withdrawal_velocity row for the player", repo.audit)
+	}
+}
+
+func TestWithdrawVelocityAmount(t *testing.T) {
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 100000)
+	repo.withdrew(testMsisdn, 4000, time.Hour)
+	repo.settings.WithdrawalOTPThreshold = 0
+	s := newTestService(t, repo, nil)
+
+	if _, err := s.Withdraw(testMsisdn, 1001, ""); !errors.Is(err, database.ErrWithdrawalVelocity) {
+		t.Errorf("Ksh.1001 over Ksh.4000 of 5000 = %v, want a velocity refusal", err)
+	}
+	if _, err := s.Withdraw(testMsisdn, 1000, ""); err != nil {
+		t.Errorf("Ksh.1000 up to the cap = %v, want allowed", err)
+	}
+}
+
+func TestWithdrawAmount(t *testing.T) {
+	repo := newWithdrawalRepo()
+	repo.addPlayer(testMsisdn, 100)
+	s := newTestService(t, repo, nil)
+
+	for _, amount := range []float64{0, -5, 10.5} {
+		if _, err := s.Withdraw(testMsisdn, amount, ""); !errors.Is(err, ErrWithdrawalAmount) {
+			t.Errorf("Withdraw(%v) = %v, want ErrWithdrawalAmount", amount, err)
+		}
+	}
+	if _, err := s.Withdraw(testMsisdn, 200, ""); !errors.Is(err, database.ErrInsufficientBalance) {
+		t.Errorf("overdraw = %v, want ErrInsufficientBalance", err)
+	}
+}
@@ -0,0 +1,352 @@
+// Package socket is the Socket.IO server: the winners feed, the online
+// count, player info and the per-player events the API pushes. It runs as
+// its own binary (cmdsocket) or inside the API process when
+// server.socket_embedded is set.
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"fiberapp/config"
+	"fiberapp/controllers"
+	"fiberapp/services"
+	"fiberapp/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	socketio "github.com/zishang520/socket.io/socket"
+)
+
+// Server is the socket.io server and the HTTP listener it is mounted on
+type Server struct {
+	io    *socketio.Server
+	http  *http.Server
+	lucky *services.LuckyNumberService
+
+	mu      sync.Mutex
+	clients map[socketio.SocketId]bool
+}
+
+// New builds the socket server on socket_port for the shared lucky
+// service. It does not listen until ListenAndServe.
+func New(cfg *config.Config, lucky *services.LuckyNumberService) *Server {
+	s := &Server{
+		io:      socketio.NewServer(nil, nil),
+		lucky:   lucky,
+		clients: make(map[socketio.SocketId]bool),
+	}
+
+	// Authenticate once at the handshake; events read the session instead of a token
+	s.io.Use(handshakeAuth(cfg.Server.SocketGuests))
+	s.io.On("connection", s.connect)
+
+	mux := http.NewServeMux()
+
+	// Health check: the API's handler plus the connected sockets
+	mux.Handle("/health", adaptor.FiberHandler(controllers.HealthHandler("Lucky Number Game API", func() fiber.Map {
+		return fiber.Map{
+			"port":              cfg.Server.SocketPort,
+			"connected_clients": s.connected(),
+		}
+	})))
+
+	// Internal push: the API posts {msisdn, event, data} to reach one player's room.
+	// Only hosts on the callbacks allowlist may call it.
+	pushAllowed := make(map[string]bool, len(cfg.Callbacks.AllowedIPs))
+	for _, ip := range cfg.Callbacks.AllowedIPs {
+		pushAllowed[ip] = true
+	}
+	mux.HandleFunc("/push", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !pushAllowed[host] {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var push struct {
+			Msisdn string      `json:"msisdn"`
+			Event  string      `json:"event"`
+			Data   interface{} `json:"data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil || push.Msisdn == "" || push.Event == "" {
+			http.Error(w, "msisdn and event are required", http.StatusBadRequest)
+			return
+		}
+
+		s.Emit(push.Msisdn, push.Event, push.Data)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// Socket.IO handler. Building it here starts the engine, which Close
+	// needs even when no client ever connected.
+	engine := s.io.ServeHandler(nil)
+	mux.Handle("/socket.io/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Add CORS headers
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET,POST,OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+
+		// Respond to preflight requests
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		engine.ServeHTTP(w, r)
+	}))
+
+	s.http = &http.Server{
+		Addr:    fmt.Sprintf("0.0.0.0:%d", cfg.Server.SocketPort),
+		Handler: mux,
+	}
+	return s
+}
+
+// ListenAndServe serves until Shutdown, which makes it return nil
+func (s *Server) ListenAndServe() error {
+	if err := s.http.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown closes every socket, then stops the listener, waiting for open
+// HTTP requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.io.Close(nil)
+	return s.http.Shutdown(ctx)
+}
+
+// Emit sends event to the sockets of msisdn
+func (s *Server) Emit(msisdn, event string, data interface{}) {
+	s.io.To(socketio.Room(msisdn)).Emit(event, data)
+}
+
+func (s *Server) connected() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// track adds or removes a client and returns how many are connected
+func (s *Server) track(id socketio.SocketId, connected bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if connected {
+		s.clients[id] = true
+	} else {
+		delete(s.clients, id)
+	}
+	return len(s.clients)
+}
+
+func (s *Server) connect(conn ...any) {
+	if len(conn) == 0 {
+		return
+	}
+
+	socket := conn[0].(*socketio.Socket)
+	clientId := socket.Id()
+	session := sessionOf(socket)
+
+	// Each player gets a room named by msisdn so pushes can target them
+	if !session.Guest {
+		socket.Join(socketio.Room(session.Msisdn))
+	}
+
+	total := s.track(clientId, true)
+	log.Printf("✅ Connected: %s | Guest: %v | Total: %d", clientId, session.Guest, total)
+
+	socket.Emit("connected", map[string]interface{}{
+		"id":        clientId,
+		"message":   "Welcome to Lucky Number Game Socket Server",
+		"timestamp": time.Now().Unix(),
+	})
+
+	// Handle ping event
+	socket.On("ping", func(data ...any) {
+		socket.Emit("pong", map[string]interface{}{
+			"message":   "pong",
+			"timestamp": time.Now().Unix(),
+			"id":        clientId,
+		})
+	})
+
+	socket.On("winners", func(data ...any) {
+		var filter struct {
+			Limit     int         `json:"limit"`
+			GameCatID interface{} `json:"game_cat_id"`
+		}
+		if len(data) > 0 {
+			if raw, err := json.Marshal(data[0]); err == nil {
+				_ = json.Unmarshal(raw, &filter)
+			}
+		}
+
+		winner, err := s.lucky.GetRecentWinners(filter.Limit, 0, utils.ToString(filter.GameCatID))
+		if err != nil {
+			emitError(socket, err.Error())
+			return
+		}
+
+		if winner == nil {
+			winner = []services.Winner{}
+		}
+
+		socket.Emit("winners_list", map[string]interface{}{
+			"Status":        200,
+			"StatusCode":    0,
+			"Data":          winner,
+			"StatusMessage": "Success",
+		})
+	})
+
+	socket.On("online_users", func(data ...any) {
+		if session.Guest {
+			emitError(socket, "authentication required")
+			return
+		}
+
+		onlineUsers, err := s.lucky.GetOnlineUsers()
+		if err != nil {
+			emitError(socket, err.Error())
+			return
+		}
+
+		var online int
+		if len(onlineUsers) > 0 {
+			online = int(utils.ToInt64(onlineUsers[0]["online_users"]))
+		}
+
+		socket.Emit("online_list", map[string]interface{}{
+			"Status":        200,
+			"StatusCode":    0,
+			"UsersOnline":   online,
+			"StatusMessage": "Success",
+		})
+	})
+
+	// The msisdn comes from the handshake token; any payload is ignored.
+	// The row is the one GET /user sends.
+	socket.On("user", func(data ...any) {
+		if session.Guest {
+			emitError(socket, "authentication required")
+			return
+		}
+
+		user, err := s.lucky.CheckUser(session.Msisdn, "", "")
+		if err != nil {
+			emitError(socket, err.Error())
+			return
+		}
+
+		socket.Emit("user_info", map[string]interface{}{
+			"Status":        200,
+			"StatusCode":    0,
+			"Data":          utils.NormalizeRow(user),
+			"StatusMessage": "Success",
+		})
+	})
+
+	socket.On("disconnect", func(reason ...any) {
+		remaining := s.track(clientId, false)
+		disconnectReason := "client disconnect"
+		if len(reason) > 0 {
+			if r, ok := reason[0].(string); ok {
+				disconnectReason = r
+			}
+		}
+		log.Printf("🔌 Disconnected: %s | Reason: %s | Remaining: %d", clientId, disconnectReason, remaining)
+	})
+}
+
+// socketSession is stored on each socket by handshakeAuth
+type socketSession struct {
+	Msisdn string
+	Guest  bool
+}
+
+// sessionOf returns the handshake session; sockets that somehow lack one
+// are treated as guests
+func sessionOf(socket *socketio.Socket) *socketSession {
+	if session, ok := socket.Data().(*socketSession); ok {
+		return session
+	}
+	return &socketSession{Guest: true}
+}
+
+// handshakeAuth verifies the JWT sent in the socket.io auth payload
+// ({auth: {token}}) or the ?token= query at connect time. Clients without a
+// token may connect read-only by asking for guest mode ({auth: {guest: true}}
+// or ?guest=true) when allowGuests is set; everything else is rejected.
+func handshakeAuth(allowGuests bool) func(*socketio.Socket, func(*socketio.ExtendedError)) {
+	return func(socket *socketio.Socket, next func(*socketio.ExtendedError)) {
+		session, reason := authenticate(socket.Handshake(), allowGuests)
+		if session == nil {
+			next(socketio.NewExtendedError("unauthorized", map[string]interface{}{"reason": reason}))
+			return
+		}
+		socket.SetData(session)
+		next(nil)
+	}
+}
+
+// authenticate returns the session a handshake opens, or nil and the
+// reason it is refused
+func authenticate(h *socketio.Handshake, allowGuests bool) (*socketSession, string) {
+	token, guest := handshakeCredentials(h)
+	if token == "" {
+		if guest && allowGuests {
+			return &socketSession{Guest: true}, ""
+		}
+		return nil, "missing token"
+	}
+
+	claims, err := utils.VerifyJWTToken(token)
+	if err != nil {
+		return nil, err.Error()
+	}
+	msisdn, _ := claims["sub"].(string)
+	if msisdn == "" {
+		return nil, "token has no subject"
+	}
+	return &socketSession{Msisdn: msisdn}, ""
+}
+
+// handshakeCredentials reads the token and guest flag, preferring the auth
+// payload over the query string
+func handshakeCredentials(h *socketio.Handshake) (token string, guest bool) {
+	if auth, ok := h.Auth.(map[string]interface{}); ok {
+		token = utils.ToString(auth["token"])
+		guest = auth["guest"] == true || utils.ToString(auth["guest"]) == "true"
+	}
+	if h.Query != nil {
+		if token == "" {
+			token = h.Query.Peek("token")
+		}
+		if !guest {
+			guest = h.Query.Peek("guest") == "true"
+		}
+	}
+	return strings.TrimSpace(token), guest
+}
+
+func emitError(socket *socketio.Socket, message string) {
+	socket.Emit("error", map[string]interface{}{
+		"Status":        false,
+		"StatusCode":    1,
+		"StatusMessage": message,
+	})
+}
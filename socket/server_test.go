@@ -0,0 +1,128 @@
+package socket
+
+import (
+	"context"
+	"encoding/json"
+	"fiberapp/auth"
+	"fiberapp/config"
+	"fiberapp/controllers"
+	"fiberapp/services"
+	"fiberapp/utils"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	eioutils "github.com/zishang520/engine.io/utils"
+	socketio "github.com/zishang520/socket.io/socket"
+)
+
+func TestAuthenticateHandshake(t *testing.T) {
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.SignAccessToken("254712345678", utils.RoleUser, "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := utils.SignAccessToken("254712345678", utils.RoleUser, "", time.Now().Add(-2*utils.AccessTokenTTL))
+
+	query := func(kv ...string) *eioutils.ParameterBag {
+		params := map[string][]string{}
+		for i := 0; i+1 < len(kv); i += 2 {
+			params[kv[i]] = []string{kv[i+1]}
+		}
+		return eioutils.NewParameterBag(params)
+	}
+
+	cases := []struct {
+		name        string
+		handshake   socketio.Handshake
+		allowGuests bool
+		msisdn      string
+		guest       bool
+	}{
+		{name: "auth payload", handshake: socketio.Handshake{Auth: map[string]interface{}{"token": token}}, msisdn: "254712345678"},
+		{name: "bearer in the auth payload", handshake: socketio.Handshake{Auth: map[string]interface{}{"token": "Bearer " + token}}, msisdn: "254712345678"},
+		{name: "query token", handshake: socketio.Handshake{Query: query("token", token)}, msisdn: "254712345678"},
+		{name: "payload wins over query", handshake: socketio.Handshake{Auth: map[string]interface{}{"token": token}, Query: query("token", "junk")}, msisdn: "254712345678"},
+		{name: "guest allowed", handshake: socketio.Handshake{Auth: map[string]interface{}{"guest": true}}, allowGuests: true, guest: true},
+		{name: "guest by query", handshake: socketio.Handshake{Query: query("guest", "true")}, allowGuests: true, guest: true},
+		{name: "guest refused", handshake: socketio.Handshake{Auth: map[string]interface{}{"guest": true}}},
+		{name: "nothing", handshake: socketio.Handshake{}, allowGuests: true},
+		{name: "forged token", handshake: socketio.Handshake{Auth: map[string]interface{}{"token": token + "x"}}},
+		{name: "expired token", handshake: socketio.Handshake{Auth: map[string]interface{}{"token": expired}}},
+	}
+	for _, tc := range cases {
+		session, reason := authenticate(&tc.handshake, tc.allowGuests)
+		switch {
+		case tc.msisdn == "" && !tc.guest:
+			if session != nil || reason == "" {
+				t.Errorf("%s: session %+v, want refused with a reason", tc.name, session)
+			}
+		case session == nil:
+			t.Errorf("%s: refused: %s", tc.name, reason)
+		case session.Msisdn != tc.msisdn || session.Guest != tc.guest:
+			t.Errorf("%s: session = %+v", tc.name, session)
+		}
+	}
+}
+
+// freePort returns a port nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func TestServeAndShutdown(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.SocketPort = freePort(t)
+	// No database: /health reports the maintenance state as unknown
+	lucky := services.NewLuckyNumberService(nil)
+	controllers.InitLuckyNumberService(lucky, nil)
+	s := New(&cfg, lucky)
+
+	served := make(chan error, 1)
+	go func() { served <- s.ListenAndServe() }()
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/health", cfg.Server.SocketPort)
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, err = http.Get(url); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("health never answered: %v", err)
+	}
+	var health map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if health["status"] != "healthy" || health["connected_clients"] != 0.0 || health["maintenance"] != "unknown" {
+		t.Errorf("health = %v, want healthy with no clients", health)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown = %v", err)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("ListenAndServe after Shutdown = %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenAndServe still running after Shutdown")
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Error("health still answering after Shutdown")
+	}
+}
@@ -0,0 +1,266 @@
+// Package status is the vocabulary of the PawaBox status columns and of the
+// bet outcome the API reports. Every status the services write, and every
+// status a query compares against, is one of these constants, so a typo no
+// longer compiles. database.AuditStatuses lists stored values outside them.
+package status
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknown is wrapped by the Parse functions for a value outside the
+// vocabulary
+var ErrUnknown = errors.New("unknown status")
+
+// ResultStatus is a bet's outcome: "Bets".result_status and the
+// ResultStatus of bet responses, webhooks and the internal API.
+//
+// A loss is "Loss". Bets rows used to be written with "Lose" while the
+// responses said "Loss"; migration 031 rewrites those rows and
+// ParseResultStatus still reads "Lose" as ResultLoss.
+type ResultStatus string
+
+const (
+	ResultPending ResultStatus = "Pending"
+	ResultWin     ResultStatus = "Win"
+	ResultLoss    ResultStatus = "Loss"
+)
+
+// ResultStatuses is every ResultStatus
+var ResultStatuses = []ResultStatus{ResultPending, ResultWin, ResultLoss}
+
+// legacyLoss is the loss as Bets rows spelled it before migration 031
+const legacyLoss = "Lose"
+
+func (s ResultStatus) String() string { return string(s) }
+
+// B2B returns the withdrawal_b2b_to_process status that books this outcome
+func (s ResultStatus) B2B() B2BStatus {
+	switch s {
+	case ResultWin:
+		return B2BWon
+	case ResultLoss:
+		return B2BLost
+	}
+	return B2BPlaced
+}
+
+// ParseResultStatus reads a stored or reported outcome
+func ParseResultStatus(v string) (ResultStatus, error) {
+	if v == legacyLoss {
+		return ResultLoss, nil
+	}
+	return parse(v, ResultStatuses, "result")
+}
+
+// BetStatus is "Bets".status, how far a bet has been processed. It is NULL
+// until the bet settles.
+type BetStatus string
+
+const (
+	BetProcessed BetStatus = "processed"
+	BetReversed  BetStatus = "reversed" // its deposit was reversed by M-Pesa
+)
+
+// BetStatuses is every BetStatus
+var BetStatuses = []BetStatus{BetProcessed, BetReversed}
+
+func (s BetStatus) String() string { return string(s) }
+
+// ParseBetStatus reads a "Bets".status
+func ParseBetStatus(v string) (BetStatus, error) {
+	return parse(v, BetStatuses, "bet")
+}
+
+// B2BStatus is withdrawal_b2b_to_process.bet_status, the vocabulary of the
+// excise and withholding processor that reads that table: a stake is
+// Placed, then Won or Lost. It is deliberately not the ResultStatus
+// spelling; ResultStatus.B2B converts.
+type B2BStatus string
+
+const (
+	B2BPlaced B2BStatus = "Placed"
+	B2BWon    B2BStatus = "Won"
+	B2BLost   B2BStatus = "Lost"
+)
+
+// B2BStatuses is every B2BStatus
+var B2BStatuses = []B2BStatus{B2BPlaced, B2BWon, B2BLost}
+
+func (s B2BStatus) String() string { return string(s) }
+
+// ParseB2BStatus reads a withdrawal_b2b_to_process.bet_status
+func ParseB2BStatus(v string) (B2BStatus, error) {
+	return parse(v, B2BStatuses, "b2b")
+}
+
+// DepositStatus is deposit_requests.status and stk_results.status, and the
+// status GET /deposit/:reference reports. A deposit request is NULL until
+// M-Pesa answers; the API reports that as DepositPending, which is never
+// stored.
+type DepositStatus string
+
+const (
+	DepositPending  DepositStatus = "pending"
+	DepositSuccess  DepositStatus = "success"
+	DepositFail     DepositStatus = "fail"
+	DepositReversed DepositStatus = "reversed"
+)
+
+// DepositStatuses is every stored DepositStatus
+var DepositStatuses = []DepositStatus{DepositSuccess, DepositFail, DepositReversed}
+
+func (s DepositStatus) String() string { return string(s) }
+
+// ParseDepositStatus reads a deposit status, DepositPending included
+func ParseDepositStatus(v string) (DepositStatus, error) {
+	if v == string(DepositPending) {
+		return DepositPending, nil
+	}
+	return parse(v, DepositStatuses, "deposit")
+}
+
+// WithdrawalStatus is "withdrawals".status: pending from the insert until
+// the payout request is sent, then processed
+type WithdrawalStatus string
+
+const (
+	WithdrawalPending   WithdrawalStatus = "pending"
+	WithdrawalProcessed WithdrawalStatus = "processed"
+)
+
+// WithdrawalStatuses is every WithdrawalStatus
+var WithdrawalStatuses = []WithdrawalStatus{WithdrawalPending, WithdrawalProcessed}
+
+func (s WithdrawalStatus) String() string { return string(s) }
+
+// ParseWithdrawalStatus reads a "withdrawals".status
+func ParseWithdrawalStatus(v string) (WithdrawalStatus, error) {
+	return parse(v, WithdrawalStatuses, "withdrawal")
+}
+
+// GatewayStatus is the status a payment gateway callback reports, stored
+// in "withdrawals".disburse. The gateway spells success either way; any
+// other value is a failure reason.
+type GatewayStatus string
+
+const (
+	GatewayOK      GatewayStatus = "0"
+	GatewaySuccess GatewayStatus = "success"
+)
+
+// GatewaySucceeded is every GatewayStatus of a successful payment, compared
+// case-insensitively
+var GatewaySucceeded = []GatewayStatus{GatewayOK, GatewaySuccess}
+
+func (s GatewayStatus) String() string { return string(s) }
+
+// Succeeded reports whether the gateway marked the payment as successful
+func (s GatewayStatus) Succeeded() bool {
+	return s == GatewayOK || strings.EqualFold(string(s), string(GatewaySuccess))
+}
+
+// CallbackStatus is "inbound_callbacks".status: pending until processed, or
+// failed once its attempts run out
+type CallbackStatus string
+
+const (
+	CallbackPending   CallbackStatus = "pending"
+	CallbackProcessed CallbackStatus = "processed"
+	CallbackFailed    CallbackStatus = "failed"
+)
+
+// CallbackStatuses is every CallbackStatus
+var CallbackStatuses = []CallbackStatus{CallbackPending, CallbackProcessed, CallbackFailed}
+
+func (s CallbackStatus) String() string { return string(s) }
+
+// ParseCallbackStatus reads an "inbound_callbacks".status
+func ParseCallbackStatus(v string) (CallbackStatus, error) {
+	return parse(v, CallbackStatuses, "callback")
+}
+
+// WebhookStatus is "webhook_events".status: pending until delivered, or
+// failed once its attempts run out
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "pending"
+	WebhookDelivered WebhookStatus = "delivered"
+	WebhookFailed    WebhookStatus = "failed"
+)
+
+// WebhookStatuses is every WebhookStatus
+var WebhookStatuses = []WebhookStatus{WebhookPending, WebhookDelivered, WebhookFailed}
+
+func (s WebhookStatus) String() string { return string(s) }
+
+// ParseWebhookStatus reads a "webhook_events".status
+func ParseWebhookStatus(v string) (WebhookStatus, error) {
+	return parse(v, WebhookStatuses, "webhook")
+}
+
+// ExclusionStatus is self_exlusion_request.status: pending until the
+// exclusion is applied to the player
+type ExclusionStatus string
+
+const (
+	ExclusionPending   ExclusionStatus = "pending"
+	ExclusionProcessed ExclusionStatus = "processed"
+)
+
+// ExclusionStatuses is every ExclusionStatus
+var ExclusionStatuses = []ExclusionStatus{ExclusionPending, ExclusionProcessed}
+
+func (s ExclusionStatus) String() string { return string(s) }
+
+// ParseExclusionStatus reads a self_exlusion_request.status
+func ParseExclusionStatus(v string) (ExclusionStatus, error) {
+	return parse(v, ExclusionStatuses, "exclusion")
+}
+
+// SMSStatus is "dbQueue".delivery_status, the status the SMS gateway
+// reports to sms_dlr. SENT may still change; the others are final.
+type SMSStatus string
+
+const (
+	SMSSent      SMSStatus = "SENT"
+	SMSDelivered SMSStatus = "DELIVERED"
+	SMSFailed    SMSStatus = "FAILED"
+	SMSRejected  SMSStatus = "REJECTED"
+	SMSExpired   SMSStatus = "EXPIRED"
+)
+
+// SMSStatuses is every SMSStatus
+var SMSStatuses = []SMSStatus{SMSSent, SMSDelivered, SMSFailed, SMSRejected, SMSExpired}
+
+// SMSFinal is every SMSStatus a later report cannot replace
+var SMSFinal = []SMSStatus{SMSDelivered, SMSFailed, SMSRejected, SMSExpired}
+
+func (s SMSStatus) String() string { return string(s) }
+
+// ParseSMSStatus reads a "dbQueue".delivery_status
+func ParseSMSStatus(v string) (SMSStatus, error) {
+	return parse(v, SMSStatuses, "sms")
+}
+
+// Strings returns vs as plain strings, e.g. to pass a vocabulary to SQL as
+// a text[]
+func Strings[T ~string](vs []T) []string {
+	out := make([]string, len(vs))
+	for i, v := range vs {
+		out[i] = string(v)
+	}
+	return out
+}
+
+func parse[T ~string](v string, vocabulary []T, kind string) (T, error) {
+	for _, s := range vocabulary {
+		if string(s) == v {
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s status %q", ErrUnknown, kind, v)
+}
@@ -0,0 +1,85 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// The stored and reported spellings; changing one breaks reports and
+// clients reading the old value
+func TestSerializedValues(t *testing.T) {
+	for got, want := range map[string]string{
+		ResultPending.String(): "Pending", ResultWin.String(): "Win", ResultLoss.String(): "Loss",
+		BetProcessed.String(): "processed", BetReversed.String(): "reversed",
+		B2BPlaced.String(): "Placed", B2BWon.String(): "Won", B2BLost.String(): "Lost",
+		DepositPending.String(): "pending", DepositSuccess.String(): "success", DepositFail.String(): "fail", DepositReversed.String(): "reversed",
+		WithdrawalPending.String(): "pending", WithdrawalProcessed.String(): "processed",
+	} {
+		if got != want {
+			t.Errorf("status %q, want %q", got, want)
+		}
+	}
+
+	b, err := json.Marshal(struct {
+		ResultStatus ResultStatus
+		Deposit      DepositStatus
+	}{ResultLoss, DepositReversed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"ResultStatus":"Loss","Deposit":"reversed"}` {
+		t.Errorf("json = %s", b)
+	}
+}
+
+func TestParseRoundTrips(t *testing.T) {
+	check := func(kind string, values []string, parse func(string) (string, error)) {
+		for _, v := range values {
+			if got, err := parse(v); err != nil || got != v {
+				t.Errorf("parse %s %q = %q, %v", kind, v, got, err)
+			}
+		}
+	}
+	check("result", Strings(ResultStatuses), func(v string) (string, error) { s, err := ParseResultStatus(v); return string(s), err })
+	check("bet", Strings(BetStatuses), func(v string) (string, error) { s, err := ParseBetStatus(v); return string(s), err })
+	check("b2b", Strings(B2BStatuses), func(v string) (string, error) { s, err := ParseB2BStatus(v); return string(s), err })
+	check("deposit", append(Strings(DepositStatuses), "pending"), func(v string) (string, error) { s, err := ParseDepositStatus(v); return string(s), err })
+	check("withdrawal", Strings(WithdrawalStatuses), func(v string) (string, error) { s, err := ParseWithdrawalStatus(v); return string(s), err })
+}
+
+// "Lose" is read as the loss it meant and never written: the vocabulary
+// has "Loss" alone
+func TestLossSpelling(t *testing.T) {
+	if s, err := ParseResultStatus("Lose"); err != nil || s != ResultLoss {
+		t.Errorf(`ParseResultStatus("Lose") = %q, %v; want Loss`, s, err)
+	}
+	for _, s := range ResultStatuses {
+		if s == "Lose" {
+			t.Error(`"Lose" is in the result vocabulary`)
+		}
+	}
+	if ResultLoss.B2B() != B2BLost || ResultWin.B2B() != B2BWon || ResultPending.B2B() != B2BPlaced {
+		t.Error("B2B spelling of the outcomes changed")
+	}
+}
+
+func TestParseRejectsUnknown(t *testing.T) {
+	for _, v := range []string{"", "loss", "Won", "Lost", "win", "Processed"} {
+		if _, err := ParseResultStatus(v); !errors.Is(err, ErrUnknown) {
+			t.Errorf("ParseResultStatus(%q) = %v, want ErrUnknown", v, err)
+		}
+	}
+	if _, err := ParseB2BStatus("Win"); !errors.Is(err, ErrUnknown) {
+		t.Errorf(`ParseB2BStatus("Win") = %v, want ErrUnknown`, err)
+	}
+	if _, err := ParseWithdrawalStatus("success"); !errors.Is(err, ErrUnknown) {
+		t.Errorf(`ParseWithdrawalStatus("success") = %v, want ErrUnknown`, err)
+	}
+	// pending is reported, never stored
+	for _, s := range DepositStatuses {
+		if s == DepositPending {
+			t.Error("pending is in the stored deposit vocabulary")
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Package taxcalc holds the tax arithmetic. Settlement and the
+// /tax_preview endpoint both use it, so a preview always matches what is
+// deducted.
+package taxcalc
+
+// Win is the withholding tax on one win. TaxAmount and NetAmount are
+// exact; settlement records them unrounded and pays Payable.
+type Win struct {
+	GrossAmount        float64
+	WithholdingPercent float64
+	TaxAmount          float64
+	NetAmount          float64
+}
+
+// Withholding splits a gross win into the tax withheld at percent (the
+// withholding setting, e.g. 20) and the net amount
+func Withholding(gross, percent float64) Win {
+	tax := (percent / 100) * gross
+	return Win{
+		GrossAmount:        gross,
+		WithholdingPercent: percent,
+		TaxAmount:          tax,
+		NetAmount:          gross - tax,
+	}
+}
+
+// Payable returns the tax and net amount in whole shillings, as written to
+// the withdrawal. A win staked partly from the bonus wallet pays its bonus
+// share there, and the withdrawal is smaller by that share.
+func (w Win) Payable() (tax, net float64) {
+	return Round(w.TaxAmount), Round(w.NetAmount)
+}
+
+// Excise is the excise duty on a stake at percent (the excise_duty
+// setting), in whole shillings
+func Excise(stake, percent float64) float64 {
+	return Round((percent / 100) * stake)
+}
+
+// Round rounds a non-negative amount half up to whole shillings
+func Round(value float64) float64 {
+	return float64(int(value + 0.5))
+}
@@ -0,0 +1,61 @@
+package taxcalc
+
+import "testing"
+
+func TestWithholding(t *testing.T) {
+	cases := []struct {
+		gross, percent float64
+		tax, net       float64
+		payTax, payNet float64
+	}{
+		{1000, 20, 200, 800, 200, 800},
+		{200, 20, 40, 160, 40, 160},
+		{333, 20, 66.6, 266.4, 67, 266},
+		{12.5, 20, 2.5, 10, 3, 10},
+		{7, 20, 1.4, 5.6, 1, 6},
+		{1000, 0, 0, 1000, 0, 1000},
+		{150000, 20, 30000, 120000, 30000, 120000},
+		{99, 15, 14.85, 84.15, 15, 84},
+	}
+	for _, tc := range cases {
+		w := Withholding(tc.gross, tc.percent)
+		if w.GrossAmount != tc.gross || w.WithholdingPercent != tc.percent || !near(w.TaxAmount, tc.tax) || !near(w.NetAmount, tc.net) {
+			t.Errorf("Withholding(%v, %v) = %+v, want tax %v and net %v", tc.gross, tc.percent, w, tc.tax, tc.net)
+		}
+		if tax, net := w.Payable(); tax != tc.payTax || net != tc.payNet {
+			t.Errorf("Withholding(%v, %v).Payable() = %v, %v, want %v, %v", tc.gross, tc.percent, tax, net, tc.payTax, tc.payNet)
+		}
+	}
+}
+
+func TestExcise(t *testing.T) {
+	cases := []struct{ stake, percent, want float64 }{
+		{50, 12.5, 6},
+		{10, 12.5, 1},
+		{20, 12.5, 3},
+		{100, 12.5, 13},
+		{100, 0, 0},
+		{1, 12.5, 0},
+	}
+	for _, tc := range cases {
+		if got := Excise(tc.stake, tc.percent); got != tc.want {
+			t.Errorf("Excise(%v, %v) = %v, want %v", tc.stake, tc.percent, got, tc.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	cases := []struct{ in, want float64 }{
+		{0, 0}, {0.49, 0}, {0.5, 1}, {1.5, 2}, {2.5, 3}, {266.4, 266}, {66.6, 67},
+	}
+	for _, tc := range cases {
+		if got := Round(tc.in); got != tc.want {
+			t.Errorf("Round(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	d := a - b
+	return d < 1e-9 && d > -1e-9
+}
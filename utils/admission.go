@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// admissionRetryAfter is what a shed request is told to wait
+const admissionRetryAfter = 5 * time.Second
+
+// PoolUsage reports how many database connections are acquired out of the
+// pool's maximum
+type PoolUsage func() (acquired, max int32)
+
+// AdmissionStats counts what AdmissionMiddleware has let in and shed in
+// this process
+type AdmissionStats struct {
+	InFlight       int64            `json:"in_flight"`
+	MaxInFlight    int64            `json:"max_in_flight"`
+	PoolAcquired   int32            `json:"pool_acquired"`
+	PoolMax        int32            `json:"pool_max"`
+	PoolSaturation float64          `json:"pool_saturation"`
+	MaxSaturation  float64          `json:"max_saturation"`
+	Admitted       uint64           `json:"admitted"`
+	Shed           map[string]int64 `json:"shed"` // by endpoint
+	ShedInFlight   uint64           `json:"shed_in_flight"`
+	ShedPool       uint64           `json:"shed_pool"`
+}
+
+var admission = struct {
+	mu            sync.RWMutex
+	usage         PoolUsage
+	maxInFlight   int64
+	maxSaturation float64
+
+	inFlight     atomic.Int64
+	admitted     atomic.Uint64
+	shedInFlight atomic.Uint64
+	shedPool     atomic.Uint64
+	shed         sync.Map // endpoint -> *atomic.Int64
+}{}
+
+// ConfigureAdmission makes AdmissionMiddleware shed requests once
+// maxInFlight of them are running in this process, or once maxSaturation
+// of the database pool is acquired. Zero disables either check.
+func ConfigureAdmission(usage PoolUsage, maxInFlight int, maxSaturation float64) {
+	admission.mu.Lock()
+	defer admission.mu.Unlock()
+	admission.usage = usage
+	admission.maxInFlight = int64(maxInFlight)
+	admission.maxSaturation = maxSaturation
+}
+
+// AdmissionMiddleware answers 503 with Retry-After instead of queueing a
+// money-moving request behind a saturated database. name labels the
+// endpoint in AdmissionStats. Read-only endpoints should not use it.
+func AdmissionMiddleware(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		admission.mu.RLock()
+		usage, maxInFlight, maxSaturation := admission.usage, admission.maxInFlight, admission.maxSaturation
+		admission.mu.RUnlock()
+
+		inFlight := admission.inFlight.Add(1)
+		defer admission.inFlight.Add(-1)
+
+		if maxInFlight > 0 && inFlight > maxInFlight {
+			admission.shedInFlight.Add(1)
+			return shed(c, name, "too many requests in flight")
+		}
+		if maxSaturation > 0 && usage != nil {
+			if acquired, max := usage(); max > 0 && float64(acquired)/float64(max) >= maxSaturation {
+				admission.shedPool.Add(1)
+				return shed(c, name, "database pool saturated")
+			}
+		}
+
+		admission.admitted.Add(1)
+		return c.Next()
+	}
+}
+
+func shed(c *fiber.Ctx, name, reason string) error {
+	counter, _ := admission.shed.LoadOrStore(name, new(atomic.Int64))
+	if n := counter.(*atomic.Int64).Add(1); n == 1 || n%100 == 0 {
+		logrus.Warnf("admission: shed %s (%s), %d so far", name, reason, n)
+	}
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(admissionRetryAfter.Seconds())))
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+		"Status":        fiber.StatusServiceUnavailable,
+		"StatusCode":    1,
+		"StatusMessage": "service is busy, please try again shortly",
+	})
+}
+
+// Admission returns a snapshot of the admission counters
+func Admission() AdmissionStats {
+	admission.mu.RLock()
+	usage, maxInFlight, maxSaturation := admission.usage, admission.maxInFlight, admission.maxSaturation
+	admission.mu.RUnlock()
+
+	stats := AdmissionStats{
+		InFlight:      admission.inFlight.Load(),
+		MaxInFlight:   maxInFlight,
+		MaxSaturation: maxSaturation,
+		Admitted:      admission.admitted.Load(),
+		Shed:          map[string]int64{},
+		ShedInFlight:  admission.shedInFlight.Load(),
+		ShedPool:      admission.shedPool.Load(),
+	}
+	if usage != nil {
+		stats.PoolAcquired, stats.PoolMax = usage()
+		if stats.PoolMax > 0 {
+			stats.PoolSaturation = float64(stats.PoolAcquired) / float64(stats.PoolMax)
+		}
+	}
+	admission.shed.Range(func(k, v any) bool {
+		stats.Shed[k.(string)] = v.(*atomic.Int64).Load()
+		return true
+	})
+	return stats
+}
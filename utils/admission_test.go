@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// admissionApp serves POST /bet behind AdmissionMiddleware and GET /games
+// without it. Both take work to answer, standing in for a slow database.
+func admissionApp(t *testing.T, usage PoolUsage, maxInFlight int, maxSaturation float64, work time.Duration) *fiber.App {
+	t.Helper()
+	ConfigureAdmission(usage, maxInFlight, maxSaturation)
+	t.Cleanup(func() { ConfigureAdmission(nil, 0, 0) })
+	app := fiber.New()
+	slow := func(c *fiber.Ctx) error {
+		time.Sleep(work)
+		return c.SendStatus(fiber.StatusOK)
+	}
+	app.Post("/bet", AdmissionMiddleware("bet"), slow)
+	app.Get("/games", slow)
+	return app
+}
+
+type timedAnswer struct {
+	status     int
+	retryAfter string
+	took       time.Duration
+}
+
+// burst sends n requests at once and returns their answers
+func burst(t *testing.T, app *fiber.App, method, path string, n int) []timedAnswer {
+	t.Helper()
+	answers := make([]timedAnswer, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			start := time.Now()
+			resp, err := app.Test(httptest.NewRequest(method, path, nil), 5000)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			answers[i] = timedAnswer{resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter), time.Since(start)}
+		}(i)
+	}
+	wg.Wait()
+	return answers
+}
+
+func TestAdmissionShedsOverInFlightLimit(t *testing.T) {
+	const work = 200 * time.Millisecond
+	app := admissionApp(t, nil, 5, 0, work)
+	before := Admission()
+
+	answers := burst(t, app, "POST", "/bet", 40)
+	ok, shed := 0, 0
+	for _, a := range answers {
+		switch a.status {
+		case fiber.StatusOK:
+			ok++
+		case fiber.StatusServiceUnavailable:
+			shed++
+			if a.retryAfter == "" {
+				t.Error("a shed request has no Retry-After")
+			}
+			// Shed at once rather than queued behind the slow requests
+			if a.took > work/2 {
+				t.Errorf("shed after %v, want well under %v", a.took, work)
+			}
+		default:
+			t.Errorf("status %d, want 200 or 503", a.status)
+		}
+	}
+	if ok < 1 || ok > 5 || ok+shed != len(answers) {
+		t.Errorf("%d admitted and %d shed of %d, want at most 5 admitted and the rest shed", ok, shed, len(answers))
+	}
+
+	after := Admission()
+	if after.InFlight != 0 || after.ShedInFlight-before.ShedInFlight != uint64(shed) || after.Shed["bet"]-before.Shed["bet"] != int64(shed) {
+		t.Errorf("stats %+v after %+v, want %d more shed and nothing in flight", after, before, shed)
+	}
+	if after.Admitted-before.Admitted != uint64(ok) {
+		t.Errorf("%d admitted counted, want %d", after.Admitted-before.Admitted, ok)
+	}
+}
+
+func TestAdmissionShedsOnPoolSaturation(t *testing.T) {
+	var acquired atomic.Int32
+	usage := func() (int32, int32) { return acquired.Load(), 10 }
+	app := admissionApp(t, usage, 0, 0.8, 0)
+
+	acquired.Store(7)
+	if a := burst(t, app, "POST", "/bet", 1)[0]; a.status != fiber.StatusOK {
+		t.Errorf("70%% pool = %d, want admitted", a.status)
+	}
+	acquired.Store(8)
+	if a := burst(t, app, "POST", "/bet", 1)[0]; a.status != fiber.StatusServiceUnavailable {
+		t.Errorf("80%% pool = %d, want 503", a.status)
+	}
+	// Reads are not gated
+	if a := burst(t, app, "GET", "/games", 1)[0]; a.status != fiber.StatusOK {
+		t.Errorf("read with a saturated pool = %d, want 200", a.status)
+	}
+	stats := Admission()
+	if stats.PoolAcquired != 8 || stats.PoolMax != 10 || stats.PoolSaturation != 0.8 {
+		t.Errorf("stats = %+v, want 8 of 10 acquired", stats)
+	}
+}
+
+func TestAdmissionLeavesReadsAlone(t *testing.T) {
+	const work = 100 * time.Millisecond
+	app := admissionApp(t, nil, 1, 0, work)
+	for _, a := range burst(t, app, "GET", "/games", 20) {
+		if a.status != fiber.StatusOK {
+			t.Errorf("read = %d, want 200", a.status)
+		}
+	}
+}
+
+func TestAdmissionDisabled(t *testing.T) {
+	app := admissionApp(t, func() (int32, int32) { return 10, 10 }, 0, 0, 10*time.Millisecond)
+	for _, a := range burst(t, app, "POST", "/bet", 20) {
+		if a.status != fiber.StatusOK {
+			t.Errorf("with both checks off = %d, want 200", a.status)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"errors"
+	"fiberapp/clock"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaxDateRangeSpan is the widest history window a client may request
+const MaxDateRangeSpan = 92 * 24 * time.Hour
+
+// Typed date-range errors; handlers map all of them to 400
+var (
+	ErrInvalidDate       = errors.New("invalid date, expected YYYY-MM-DD or RFC3339")
+	ErrIncompleteRange   = errors.New("both StartDate and EndDate are required")
+	ErrReversedDateRange = errors.New("StartDate must not be after EndDate")
+	ErrDateRangeTooLong  = errors.New("date range exceeds the maximum span")
+)
+
+// DateRange is an inclusive [Start, End] window in the business zone.
+// The zero value means "no date filter".
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// IsZero reports whether no range was supplied
+func (r DateRange) IsZero() bool {
+	return r.Start.IsZero() && r.End.IsZero()
+}
+
+// ParseDateRange parses a StartDate/EndDate pair. Plain dates expand to the
+// whole day, so "2024-01-31" as the end includes every row from that day.
+// Both empty returns the zero DateRange.
+func ParseDateRange(start, end string) (DateRange, error) {
+	start, end = strings.TrimSpace(start), strings.TrimSpace(end)
+	if start == "" && end == "" {
+		return DateRange{}, nil
+	}
+	if start == "" || end == "" {
+		return DateRange{}, ErrIncompleteRange
+	}
+
+	from, fromIsDate, err := parseDateValue(start)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("StartDate %q: %w", start, err)
+	}
+	to, toIsDate, err := parseDateValue(end)
+	if err != nil {
+		return DateRange{}, fmt.Errorf("EndDate %q: %w", end, err)
+	}
+
+	if fromIsDate {
+		from = clock.StartOfDay(from)
+	}
+	if toIsDate {
+		to = endOfDay(to)
+	}
+
+	if from.After(to) {
+		return DateRange{}, ErrReversedDateRange
+	}
+	if to.Sub(from) > MaxDateRangeSpan {
+		return DateRange{}, ErrDateRangeTooLong
+	}
+
+	return DateRange{Start: from, End: to}, nil
+}
+
+// MonthRange returns the calendar month of t in the business zone
+func MonthRange(t time.Time) DateRange {
+	y, m, _ := t.In(clock.Location()).Date()
+	start := time.Date(y, m, 1, 0, 0, 0, 0, clock.Location())
+	return DateRange{Start: start, End: start.AddDate(0, 1, 0).Add(-time.Nanosecond)}
+}
+
+// IsDateRangeError reports whether err came from ParseDateRange
+func IsDateRangeError(err error) bool {
+	return errors.Is(err, ErrInvalidDate) ||
+		errors.Is(err, ErrIncompleteRange) ||
+		errors.Is(err, ErrReversedDateRange) ||
+		errors.Is(err, ErrDateRangeTooLong)
+}
+
+// parseDateValue accepts YYYY-MM-DD (interpreted in the business zone) or RFC3339
+// (converted to it). isDate is true for the plain date form.
+func parseDateValue(v string) (t time.Time, isDate bool, err error) {
+	if d, err := time.ParseInLocation("2006-01-02", v, clock.Location()); err == nil {
+		return d, true, nil
+	}
+	if ts, err := time.Parse(time.RFC3339, v); err == nil {
+		return ts.In(clock.Location()), false, nil
+	}
+	return time.Time{}, false, ErrInvalidDate
+}
+
+func endOfDay(t time.Time) time.Time {
+	return clock.StartOfDay(t).AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"errors"
+	"fiberapp/clock"
+	"testing"
+	"time"
+)
+
+func TestParseDateRange(t *testing.T) {
+	nbo := clock.Location()
+	cases := []struct {
+		name       string
+		start, end string
+		want       DateRange
+		err        error
+	}{
+		{name: "no filter"},
+		{
+			name: "plain dates cover whole days", start: "2024-01-01", end: "2024-01-31",
+			want: DateRange{
+				Start: time.Date(2024, 1, 1, 0, 0, 0, 0, nbo),
+				End:   time.Date(2024, 1, 31, 23, 59, 59, int(time.Second-time.Nanosecond), nbo),
+			},
+		},
+		{
+			name: "RFC3339 is converted to the business zone", start: "2024-01-01T21:00:00Z", end: "2024-01-02T09:30:00+03:00",
+			want: DateRange{
+				Start: time.Date(2024, 1, 2, 0, 0, 0, 0, nbo),
+				End:   time.Date(2024, 1, 2, 9, 30, 0, 0, nbo),
+			},
+		},
+		{name: "surrounding space", start: " 2024-02-29 ", end: "2024-02-29 ",
+			want: DateRange{
+				Start: time.Date(2024, 2, 29, 0, 0, 0, 0, nbo),
+				End:   time.Date(2024, 2, 29, 23, 59, 59, int(time.Second-time.Nanosecond), nbo),
+			},
+		},
+		{name: "start only", start: "2024-01-01", err: ErrIncompleteRange},
+		{name: "end only", end: "2024-01-01", err: ErrIncompleteRange},
+		{name: "not a date", start: "01/02/2024", end: "2024-01-31", err: ErrInvalidDate},
+		{name: "impossible day", start: "2024-01-01", end: "2023-02-30", err: ErrInvalidDate},
+		{name: "reversed", start: "2024-02-01", end: "2024-01-31", err: ErrReversedDateRange},
+		{name: "same day reversed times", start: "2024-01-01T10:00:00+03:00", end: "2024-01-01T09:00:00+03:00", err: ErrReversedDateRange},
+		{name: "93 days", start: "2024-01-01", end: "2024-04-02", err: ErrDateRangeTooLong},
+	}
+	for _, tc := range cases {
+		got, err := ParseDateRange(tc.start, tc.end)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) || !IsDateRangeError(err) {
+				t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !got.Start.Equal(tc.want.Start) || !got.End.Equal(tc.want.End) {
+			t.Errorf("%s: got %v – %v, want %v – %v", tc.name, got.Start, got.End, tc.want.Start, tc.want.End)
+		}
+	}
+}
+
+func TestMaxSpanAccepted(t *testing.T) {
+	// Jan 1 to Apr 1 of a leap year is 92 whole days
+	if _, err := ParseDateRange("2024-01-01", "2024-04-01"); err != nil {
+		t.Errorf("92 days rejected: %v", err)
+	}
+}
+
+func TestMonthRange(t *testing.T) {
+	nbo := clock.Location()
+	// 22:00 UTC on Jan 31 is already Feb 1 in Nairobi
+	r := MonthRange(time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC))
+	if !r.Start.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, nbo)) || !r.End.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, nbo).Add(-time.Nanosecond)) {
+		t.Errorf("MonthRange = %v – %v, want February 2024", r.Start, r.End)
+	}
+}
+
+func TestDayBoundaryRanges(t *testing.T) {
+	nbo := clock.Location()
+	defer clock.ConfigureSource(nil)
+
+	// 23:59 and 00:01 in Nairobi, both 31 March in UTC
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 20, 59, 0, 0, time.UTC) })
+	if r := MonthRange(clock.Now()); !r.Start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, nbo)) {
+		t.Errorf("month at 23:59 = %v – %v, want March", r.Start, r.End)
+	}
+	clock.ConfigureSource(func() time.Time { return time.Date(2026, 3, 31, 21, 1, 0, 0, time.UTC) })
+	if r := MonthRange(clock.Now()); !r.Start.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, nbo)) {
+		t.Errorf("month at 00:01 = %v – %v, want April", r.Start, r.End)
+	}
+
+	today := clock.Now().Format("2006-01-02")
+	r, err := ParseDateRange(today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 3, 31, 21, 0, 0, 0, time.UTC); today != "2026-04-01" || !r.Start.Equal(want) {
+		t.Errorf("today %s starts %v, want 1 April from %v", today, r.Start, want)
+	}
+	if at := clock.Now(); at.Before(r.Start) || at.After(r.End) {
+		t.Errorf("00:01 falls outside today's range %v – %v", r.Start, r.End)
+	}
+}
+
+func TestIsDateRangeErrorIgnoresOthers(t *testing.T) {
+	if IsDateRangeError(errors.New("boom")) || IsDateRangeError(nil) {
+		t.Error("unrelated error reported as a date range error")
+	}
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// background tracks goroutines that move money (deposit settlement, bet
+// processing) so shutdown can wait for them instead of killing them mid-way
+var background struct {
+	wg       sync.WaitGroup
+	inFlight atomic.Int64
+	draining atomic.Bool
+}
+
+// GoBackground runs fn in a tracked goroutine. name is only used for logging.
+func GoBackground(name string, fn func()) {
+	background.wg.Add(1)
+	background.inFlight.Add(1)
+	go func() {
+		defer background.wg.Done()
+		defer background.inFlight.Add(-1)
+		defer func() {
+			if r := recover(); r != nil {
+				logrus.Errorf("background task %s panicked: %v", name, r)
+			}
+		}()
+		fn()
+	}()
+}
+
+// BackgroundInFlight returns the number of tracked goroutines still running
+func BackgroundInFlight() int64 {
+	return background.inFlight.Load()
+}
+
+// BeginDrain marks the process as shutting down; DrainMiddleware starts refusing requests
+func BeginDrain() {
+	background.draining.Store(true)
+}
+
+// IsDraining reports whether shutdown has begun
+func IsDraining() bool {
+	return background.draining.Load()
+}
+
+// WaitBackground blocks until every tracked goroutine has finished or ctx is done
+func WaitBackground(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		background.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DrainMiddleware rejects new money-moving requests with 503 once shutdown has begun
+func DrainMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if IsDraining() {
+			c.Set(fiber.HeaderRetryAfter, "30")
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"Status":        fiber.StatusServiceUnavailable,
+				"StatusCode":    1,
+				"StatusMessage": "service is restarting, please try again shortly",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// ready is set by MarkReady once startup warmup is done
+var ready atomic.Bool
+
+// MarkReady lets ReadyMiddleware pass requests through
+func MarkReady() {
+	ready.Store(true)
+}
+
+// IsReady reports whether startup is done and shutdown has not begun; the
+// /ready probe answers with it
+func IsReady() bool {
+	return ready.Load() && !IsDraining()
+}
+
+// ReadyMiddleware rejects every request with 503 until MarkReady, so the
+// listener can open before the pool is warm. Paths in skip, the health and
+// readiness probes, are always served.
+func ReadyMiddleware(skip ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if ready.Load() || slices.Contains(skip, c.Path()) {
+			return c.Next()
+		}
+		c.Set(fiber.HeaderRetryAfter, "5")
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"Status":        fiber.StatusServiceUnavailable,
+			"StatusCode":    1,
+			"StatusMessage": "service is starting, please try again shortly",
+		})
+	}
+}
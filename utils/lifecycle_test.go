@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWaitBackgroundDrainsTrackedTasks(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	GoBackground("settle", func() {
+		<-release
+		close(done)
+	})
+	GoBackground("panics", func() { panic("boom") })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := WaitBackground(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("WaitBackground with a task running = %v, want the deadline", err)
+	}
+	if n := BackgroundInFlight(); n != 1 {
+		t.Errorf("in flight = %d, want the one blocked task", n)
+	}
+
+	close(release)
+	if err := WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("WaitBackground returned before the task finished")
+	}
+	if n := BackgroundInFlight(); n != 0 {
+		t.Errorf("in flight = %d after draining", n)
+	}
+}
+
+func TestDrainAndReadyMiddleware(t *testing.T) {
+	defer background.draining.Store(false)
+	defer ready.Store(false)
+
+	app := fiber.New()
+	app.Use(ReadyMiddleware("/health"))
+	app.Get("/health", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	app.Post("/bet", DrainMiddleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	status := func(method, path string) int {
+		resp, err := app.Test(httptest.NewRequest(method, path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("POST", "/bet"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("bet before ready = %d, want 503", got)
+	}
+	if got := status("GET", "/health"); got != fiber.StatusOK {
+		t.Errorf("health before ready = %d, want 200", got)
+	}
+
+	MarkReady()
+	if got := status("POST", "/bet"); got != fiber.StatusOK || !IsReady() {
+		t.Errorf("bet when ready = %d, want 200", got)
+	}
+
+	BeginDrain()
+	if got := status("POST", "/bet"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("bet while draining = %d, want 503", got)
+	}
+	if IsReady() {
+		t.Error("ready while draining")
+	}
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"context"
+	"fiberapp/auth"
 	"fmt"
 	"math"
 	"math/rand/v2"
@@ -246,8 +248,6 @@ func ToBool(value interface{}) bool {
 
 // JWTMiddleware verifies the JWT and sets claims in c.Locals("user")
 func JWTMiddleware() fiber.Handler {
-	secret := JWT_SECRET
-
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("x-access-token")
 		if authHeader == "" {
@@ -269,13 +269,7 @@ func JWTMiddleware() fiber.Handler {
 
 		tokenString := parts[1]
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// ensure token method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secret), nil
-		})
+		claims, err := auth.Verify(tokenString)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"Status":        false,
@@ -284,23 +278,44 @@ func JWTMiddleware() fiber.Handler {
 			})
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Locals("user", claims) // store claims for handlers
-			return c.Next()
+		if status, msg := rejectRevoked(c, claims); status != 0 {
+			return c.Status(status).JSON(fiber.Map{
+				"Status":        false,
+				"StatusCode":    1,
+				"StatusMessage": msg,
+			})
 		}
+		touchSession(claims)
+		c.Locals("user", claims) // store claims for handlers
+		return c.Next()
+	}
+}
 
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"Status":        false,
-			"StatusCode":    1,
-			"StatusMessage": "invalid or expired token",
-		})
+// RequireRole rejects requests whose JWT "role" claim is not role.
+// It must run after JWTMiddleware.
+func RequireRole(role string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(jwt.MapClaims)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"Status":        false,
+				"StatusCode":    1,
+				"StatusMessage": "missing token claims",
+			})
+		}
+		if r, _ := claims["role"].(string); r != role {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"Status":        false,
+				"StatusCode":    1,
+				"StatusMessage": "forbidden",
+			})
+		}
+		return c.Next()
 	}
 }
 
 // option jwt
 func OptionalJWTMiddleware() fiber.Handler {
-	secret := JWT_SECRET
-
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("x-access-token")
 		if authHeader == "" {
@@ -318,13 +333,7 @@ func OptionalJWTMiddleware() fiber.Handler {
 
 		tokenString := parts[1]
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// ensure token method is HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secret), nil
-		})
+		claims, err := auth.Verify(tokenString)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"Status":        false,
@@ -333,16 +342,16 @@ func OptionalJWTMiddleware() fiber.Handler {
 			})
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			c.Locals("user", claims) // store claims for handlers
-			return c.Next()
+		if status, msg := rejectRevoked(c, claims); status != 0 {
+			return c.Status(status).JSON(fiber.Map{
+				"Status":        false,
+				"StatusCode":    1,
+				"StatusMessage": msg,
+			})
 		}
-
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"Status":        false,
-			"StatusCode":    1,
-			"StatusMessage": "invalid or expired token",
-		})
+		touchSession(claims)
+		c.Locals("user", claims) // store claims for handlers
+		return c.Next()
 	}
 }
 
@@ -357,62 +366,9 @@ func ToSQLFloat(value interface{}) interface{} {
 	return f
 }
 
-var JWT_SECRET = "sdjffjjf83488fdfnfnbbnfbnmd20304483e@u3rhnfhfsu8@##UJjdjdjjJHDDHDHJSMWHSHHHD@*EUDHFHH"
-
-var Texts = map[string]map[string]string{
-	"results": {
-		"win": `Congratulations!! UMESHINDA
--
-Ulichagua %s. UMESHINDA: %s
--
-%s
--
-Free Bet - %d
--
-Cheza Tena *463#
--
-game-id: %s
--
-Help: 0703012550`,
-
-		"jackpot": `CONGRATULATIONS! ID:%s IMESHINDA %s YENYE THAMANI KES %s
-
-KIASI HIKI UTATUMIWA KWENYE ACCOUNT YAKO
-
-Cheza Tena *463#
-
-Help: 0703012550`,
-
-		"loss": `Samahani, Jaribu tena
--
-Ulichagua: %s
--
-%s
--
-Free Bet - %d
--
-Cheza Tena *463#
--
-game-id: %s
--
-Help: 0703012550`,
-
-		"cancelled": `Hapa chini ni muundo rahisi wa hatua za kucheza Bado Kidogo Ushinde!:
-
-Bonyeza *148*33#
-
-Chagua boksi lako (Boxi unalotaka kuchezea)
-
-Ingiza nambari yako ya siri
-
-Bonyeza 1 kuthibitisha na kuanza mchezo`,
-	},
-}
-
-// Extract the core token verification logic from your middleware
+// VerifyJWTToken verifies a token, with or without its "Bearer " prefix,
+// as JWTMiddleware does and returns its claims
 func VerifyJWTToken(tokenString string) (jwt.MapClaims, error) {
-	secret := JWT_SECRET
-
 	if tokenString == "" {
 		return nil, fmt.Errorf("missing token")
 	}
@@ -430,22 +386,19 @@ func VerifyJWTToken(tokenString string) (jwt.MapClaims, error) {
 		return nil, fmt.Errorf("missing token after Bearer prefix")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// ensure token method is HMAC
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(secret), nil
-	})
+	claims, err := auth.Verify(tokenString)
 	if err != nil {
 		return nil, fmt.Errorf("invalid token: %v", err)
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return claims, nil
+	revoked, err := TokenRevoked(context.Background(), claims)
+	if err != nil {
+		return nil, fmt.Errorf("could not verify token: %v", err)
 	}
-
-	return nil, fmt.Errorf("invalid or expired token")
+	if revoked {
+		return nil, fmt.Errorf("token revoked")
+	}
+	return claims, nil
 }
 
 // Helper function to extract token from various sources
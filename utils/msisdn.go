@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaskMsisdn hides the middle digits of a phone number, e.g. 254712345678 -> 2547****5678
+func MaskMsisdn(msisdn string) string {
+	msisdn = strings.TrimSpace(msisdn)
+	if len(msisdn) <= 6 {
+		return strings.Repeat("*", len(msisdn))
+	}
+	keepHead := 4
+	if len(msisdn) < 10 {
+		keepHead = 2
+	}
+	keepTail := 4
+	if len(msisdn)-keepHead-keepTail < 2 {
+		keepTail = 2
+	}
+	return msisdn[:keepHead] + strings.Repeat("*", len(msisdn)-keepHead-keepTail) + msisdn[len(msisdn)-keepTail:]
+}
+
+// RedactMsisdn is the form of a phone number logs carry: the country and
+// network prefix and the last two digits, e.g. 254712345678 -> 254712****78.
+// Anything too short to be a phone number is masked whole.
+func RedactMsisdn(msisdn string) string {
+	msisdn = strings.TrimSpace(msisdn)
+	if len(msisdn) < 10 {
+		return strings.Repeat("*", len(msisdn))
+	}
+	return msisdn[:6] + strings.Repeat("*", len(msisdn)-8) + msisdn[len(msisdn)-2:]
+}
+
+// ErrInvalidMsisdn is returned for numbers that are not Kenyan mobile numbers
+var ErrInvalidMsisdn = errors.New("invalid msisdn, expected a Kenyan mobile number such as 0712345678")
+
+// NormalizeMsisdn returns the canonical 2547XXXXXXXX / 2541XXXXXXXX form of a
+// Kenyan mobile number given as 07.., 01.., 7.., 1.., 2547.., +2547.. or
+// 002547.., ignoring spaces and dashes. Anything else is ErrInvalidMsisdn.
+func NormalizeMsisdn(msisdn string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(strings.TrimSpace(msisdn), "+") {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ' || r == '-':
+		default:
+			return "", ErrInvalidMsisdn
+		}
+	}
+	digits := b.String()
+
+	switch {
+	case len(digits) == 14 && strings.HasPrefix(digits, "00254"):
+		digits = digits[5:]
+	case len(digits) == 12 && strings.HasPrefix(digits, "254"):
+		digits = digits[3:]
+	case len(digits) == 10 && digits[0] == '0':
+		digits = digits[1:]
+	}
+
+	if len(digits) != 9 || (digits[0] != '7' && digits[0] != '1') {
+		return "", ErrInvalidMsisdn
+	}
+	return "254" + digits, nil
+}
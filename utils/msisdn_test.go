@@ -0,0 +1,52 @@
+package utils
+
+import "testing"
+
+func TestMaskMsisdn(t *testing.T) {
+	cases := map[string]string{
+		"254712345678":   "2547****5678",
+		" 254712345678 ": "2547****5678",
+		"0712345678":     "0712**5678",
+		"712345678":      "71***5678",
+		"123456":         "******",
+		"":               "",
+	}
+	for in, want := range cases {
+		if got := MaskMsisdn(in); got != want {
+			t.Errorf("MaskMsisdn(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeMsisdn(t *testing.T) {
+	valid := map[string]string{
+		"0712345678":       "254712345678",
+		"0112345678":       "254112345678",
+		"712345678":        "254712345678",
+		"112345678":        "254112345678",
+		"254712345678":     "254712345678",
+		"+254712345678":    "254712345678",
+		"00254712345678":   "254712345678",
+		" 0712 345-678 ":   "254712345678",
+		"+254 712 345 678": "254712345678",
+	}
+	for in, want := range valid {
+		if got, err := NormalizeMsisdn(in); err != nil || got != want {
+			t.Errorf("NormalizeMsisdn(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "0812345678", "255712345678", "07123456789", "071234567", "0712a45678", "254712345678 ext"} {
+		if got, err := NormalizeMsisdn(in); err != ErrInvalidMsisdn {
+			t.Errorf("NormalizeMsisdn(%q) = %q, %v; want ErrInvalidMsisdn", in, got, err)
+		}
+	}
+}
+
+func TestRedactMsisdn(t *testing.T) {
+	cases := map[string]string{"254712345678": "254712****78", "0712345678": "071234**78", "12345": "*****"}
+	for in, want := range cases {
+		if got := RedactMsisdn(in); got != want {
+			t.Errorf("RedactMsisdn(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
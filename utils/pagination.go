@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// ErrInvalidPage is returned for a non-numeric or non-positive page or page_size
+var ErrInvalidPage = errors.New("page and page_size must be positive integers")
+
+// Page is a 1-based page request
+type Page struct {
+	Number int
+	Size   int
+}
+
+// ParsePage parses page/page_size query values. Empty values default to the
+// first page of DefaultPageSize; sizes above MaxPageSize are clamped.
+func ParsePage(page, size string) (Page, error) {
+	p := Page{Number: 1, Size: DefaultPageSize}
+
+	if page = strings.TrimSpace(page); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return Page{}, ErrInvalidPage
+		}
+		p.Number = n
+	}
+	if size = strings.TrimSpace(size); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			return Page{}, ErrInvalidPage
+		}
+		p.Size = min(n, MaxPageSize)
+	}
+	return p, nil
+}
+
+// Offset is the number of rows to skip
+func (p Page) Offset() int {
+	return (p.Number - 1) * p.Size
+}
+
+// TotalPages returns how many pages hold total rows
+func (p Page) TotalPages(total int64) int {
+	if total <= 0 || p.Size <= 0 {
+		return 0
+	}
+	return int((total + int64(p.Size) - 1) / int64(p.Size))
+}
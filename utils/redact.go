@@ -0,0 +1,113 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// secrets holds the plaintext values no log line may carry, such as an OTP
+// code between its issue and its SMS being queued, with how many holders
+// each has
+var secrets struct {
+	mu     sync.RWMutex
+	values map[string]int
+}
+
+// HoldSecret masks value in every log entry until the returned release is
+// called. Hold it for as long as the plaintext is in memory.
+func HoldSecret(value string) (release func()) {
+	if value == "" {
+		return func() {}
+	}
+	secrets.mu.Lock()
+	if secrets.values == nil {
+		secrets.values = make(map[string]int)
+	}
+	secrets.values[value]++
+	secrets.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			secrets.mu.Lock()
+			if secrets.values[value]--; secrets.values[value] <= 0 {
+				delete(secrets.values, value)
+			}
+			secrets.mu.Unlock()
+		})
+	}
+}
+
+// RedactSecrets returns s with every held secret that stands as a word of
+// its own, not inside a longer run of letters and digits, replaced by
+// asterisks
+func RedactSecrets(s string) string {
+	secrets.mu.RLock()
+	defer secrets.mu.RUnlock()
+	for value := range secrets.values {
+		s = maskWord(s, value)
+	}
+	return s
+}
+
+func maskWord(s, word string) string {
+	var b strings.Builder
+	rest := s
+	for {
+		i := strings.Index(rest, word)
+		if i < 0 {
+			break
+		}
+		end := i + len(word)
+		b.WriteString(rest[:i])
+		if (i > 0 && isWordByte(rest[i-1])) || (end < len(rest) && isWordByte(rest[end])) {
+			b.WriteString(word)
+		} else {
+			b.WriteString(strings.Repeat("*", len(word)))
+		}
+		rest = rest[end:]
+	}
+	if b.Len() == 0 {
+		return s
+	}
+	b.WriteString(rest)
+	return b.String()
+}
+
+func isWordByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// SecretRedactionHook masks the held secrets in a log entry's message and
+// in its string and error fields before the entry is written
+type SecretRedactionHook struct{}
+
+// Levels implements logrus.Hook
+func (SecretRedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (SecretRedactionHook) Fire(entry *logrus.Entry) error {
+	secrets.mu.RLock()
+	held := len(secrets.values)
+	secrets.mu.RUnlock()
+	if held == 0 {
+		return nil
+	}
+
+	entry.Message = RedactSecrets(entry.Message)
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = RedactSecrets(v)
+		case error:
+			if masked := RedactSecrets(v.Error()); masked != v.Error() {
+				entry.Data[key] = masked
+			}
+		}
+	}
+	return nil
+}
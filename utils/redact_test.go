@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactSecrets(t *testing.T) {
+	release := HoldSecret("4821")
+	cases := map[string]string{
+		"Your PawaBox code is 4821.":   "Your PawaBox code is ****.",
+		"code=4821 again 4821":         "code=**** again ****",
+		"msisdn 254748210000 ref 4821": "msisdn 254748210000 ref ****", // inside a longer number it is left
+		"BET_4821X":                    "BET_4821X",
+		"nothing here":                 "nothing here",
+	}
+	for in, want := range cases {
+		if got := RedactSecrets(in); got != want {
+			t.Errorf("RedactSecrets(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	// Held twice, it stays masked until both holders let go
+	again := HoldSecret("4821")
+	release()
+	release()
+	if got := RedactSecrets("4821"); got != "****" {
+		t.Errorf("after one of two releases = %q, want still masked", got)
+	}
+	again()
+	if got := RedactSecrets("4821"); got != "4821" {
+		t.Errorf("after every release = %q, want left alone", got)
+	}
+	HoldSecret("")()
+}
+
+func TestSecretRedactionHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	logger.AddHook(SecretRedactionHook{})
+
+	release := HoldSecret("7390")
+	logger.WithField("otp", "7390").WithError(errors.New(`dbQueue: value "Your code is 7390" too long`)).
+		Errorf("otp: queue sms for 254712345678 with 7390 failed")
+	release()
+	logger.Info("code 7390 released")
+
+	out := buf.String()
+	if strings.Count(out, "7390") != 1 || !strings.Contains(out, "code 7390 released") {
+		t.Errorf("log = %q, want the code only in the line after its release", out)
+	}
+	if !strings.Contains(out, `otp="****"`) || !strings.Contains(out, "Your code is ****") || !strings.Contains(out, "with **** failed") {
+		t.Errorf("log = %q, want the message, field and error masked", out)
+	}
+}
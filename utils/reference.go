@@ -0,0 +1,31 @@
+package utils
+
+import "crypto/rand"
+
+// Reference kinds. A reference is its kind, an underscore and 16 random
+// characters, so a reference in a log or a gateway callback says what it is.
+const (
+	RefBet      = "BET"
+	RefParcel   = "PCL"
+	RefSpin     = "SPIN"
+	RefDeposit  = "DEP"
+	RefTransfer = "TRF"
+	RefWithdraw = "WDR"
+)
+
+// referenceAlphabet is Crockford base32: no I, L, O or U to misread over SMS
+const referenceAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewReference returns a new reference of kind carrying 80 bits from
+// crypto/rand. Unlike a seeded math/rand stream, prefork workers restarted
+// together do not draw the same sequence.
+func NewReference(kind string) string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	for i := range b {
+		b[i] = referenceAlphabet[b[i]&31]
+	}
+	return kind + "_" + string(b)
+}
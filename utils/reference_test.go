@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestNewReferenceFormat(t *testing.T) {
+	for _, kind := range []string{RefBet, RefParcel, RefSpin, RefDeposit, RefTransfer} {
+		pattern := regexp.MustCompile(`^` + kind + `_[0-9A-HJKMNP-TV-Z]{16}$`)
+		if ref := NewReference(kind); !pattern.MatchString(ref) {
+			t.Errorf("NewReference(%s) = %q, want %s_ and 16 Crockford base32 characters", kind, ref, kind)
+		}
+	}
+}
+
+func TestNewReferenceUnique(t *testing.T) {
+	seen := make(map[string]bool, 100000)
+	for i := 0; i < 100000; i++ {
+		ref := NewReference(RefBet)
+		if seen[ref] {
+			t.Fatalf("reference %s drawn twice in %d", ref, i)
+		}
+		seen[ref] = true
+	}
+}
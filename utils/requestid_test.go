@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestIDMiddleware())
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(RequestIDFromContext(c.UserContext()))
+	})
+
+	cases := []struct {
+		name, incoming string
+		keep           bool
+	}{
+		{"none", "", false},
+		{"sane", "abc-123_DEF", true},
+		{"unsafe", "bad id\nwith newline", false},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tc.incoming != "" {
+			req.Header.Set(RequestIDHeader, tc.incoming)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id := resp.Header.Get(RequestIDHeader)
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		if string(body[:n]) != id {
+			t.Errorf("%s: context carries %q, header %q", tc.name, body[:n], id)
+		}
+		if tc.keep && id != tc.incoming {
+			t.Errorf("%s: id = %q, want the incoming %q", tc.name, id, tc.incoming)
+		}
+		if !tc.keep && (id == tc.incoming || len(id) != 32) {
+			t.Errorf("%s: id = %q, want a fresh 32-char id", tc.name, id)
+		}
+	}
+}
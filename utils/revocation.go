@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRevocationCacheTTL = 30 * time.Second
+	maxRevocationCacheEntries = 10000
+	revocationLookupTimeout   = 2 * time.Second
+)
+
+// RevocationCheck reports whether the access token jti has been revoked
+type RevocationCheck func(ctx context.Context, jti string) (bool, error)
+
+type revocationEntry struct {
+	revoked   bool
+	expiresAt time.Time
+}
+
+// revocation caches RevocationCheck answers per jti so JWTMiddleware does
+// not query the database on every request. A live token is rechecked after
+// ttl; a revoked one stays rejected until it expires. Errors are never
+// cached.
+var revocation = struct {
+	mu    sync.RWMutex
+	check RevocationCheck
+	ttl   time.Duration
+	items map[string]revocationEntry
+}{items: make(map[string]revocationEntry)}
+
+// ConfigureTokenRevocation makes JWTMiddleware reject tokens check reports
+// as revoked. A token revoked by another process keeps working here for at
+// most ttl. Tokens without a jti claim are not checked. Without a check
+// nothing is revoked.
+func ConfigureTokenRevocation(check RevocationCheck, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultRevocationCacheTTL
+	}
+	revocation.mu.Lock()
+	defer revocation.mu.Unlock()
+	revocation.check = check
+	revocation.ttl = ttl
+	revocation.items = make(map[string]revocationEntry)
+}
+
+// MarkTokensRevoked rejects jtis in this process at once, without waiting
+// for the cached answer to expire
+func MarkTokensRevoked(jtis ...string) {
+	until := time.Now().Add(AccessTokenTTL)
+	for _, jti := range jtis {
+		setRevocation(jti, true, until)
+	}
+}
+
+// TokenRevoked reports whether the token with claims has been revoked
+func TokenRevoked(ctx context.Context, claims jwt.MapClaims) (bool, error) {
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return false, nil
+	}
+
+	revocation.mu.RLock()
+	check, ttl := revocation.check, revocation.ttl
+	entry, ok := revocation.items[jti]
+	revocation.mu.RUnlock()
+	if check == nil {
+		return false, nil
+	}
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.revoked, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, revocationLookupTimeout)
+	defer cancel()
+	revoked, err := check(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	until := time.Now().Add(ttl)
+	if revoked {
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			until = exp.Time
+		}
+	}
+	setRevocation(jti, revoked, until)
+	return revoked, nil
+}
+
+func setRevocation(jti string, revoked bool, until time.Time) {
+	now := time.Now()
+
+	revocation.mu.Lock()
+	defer revocation.mu.Unlock()
+	if len(revocation.items) >= maxRevocationCacheEntries {
+		for k, e := range revocation.items {
+			if now.After(e.expiresAt) {
+				delete(revocation.items, k)
+			}
+		}
+		// Still full of live entries: start over rather than grow unbounded
+		if len(revocation.items) >= maxRevocationCacheEntries {
+			revocation.items = make(map[string]revocationEntry)
+		}
+	}
+	revocation.items[jti] = revocationEntry{revoked: revoked, expiresAt: until}
+}
+
+// rejectRevoked returns the status and message to answer a revoked token
+// with, or 0 when the token may be used
+func rejectRevoked(c *fiber.Ctx, claims jwt.MapClaims) (int, string) {
+	revoked, err := TokenRevoked(c.UserContext(), claims)
+	if err != nil {
+		logrus.Errorf("token revocation check failed: %v", err)
+		return fiber.StatusServiceUnavailable, "could not verify token, try again"
+	}
+	if revoked {
+		return fiber.StatusUnauthorized, "token revoked"
+	}
+	return 0, ""
+}
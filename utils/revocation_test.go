@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// revocationStore answers RevocationCheck from a set of revoked jtis and
+// counts the lookups
+type revocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]bool
+	lookups int
+	err     error
+}
+
+func (s *revocationStore) check(ctx context.Context, jti string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lookups++
+	return s.revoked[jti], s.err
+}
+
+func (s *revocationStore) revoke(jti string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = true
+}
+
+func configureRevocation(t *testing.T, ttl time.Duration) *revocationStore {
+	t.Helper()
+	configureTestAuth(t)
+	store := &revocationStore{revoked: map[string]bool{}}
+	ConfigureTokenRevocation(store.check, ttl)
+	t.Cleanup(func() { ConfigureTokenRevocation(nil, 0) })
+	return store
+}
+
+// protectedApp serves /me behind JWTMiddleware and returns a function that
+// calls it with a token for jti
+func protectedApp(t *testing.T) func(jti string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/me", JWTMiddleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	return func(jti string) int {
+		token, err := SignAccessToken("254712345678", RoleUser, jti, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("GET", "/me", nil)
+		req.Header.Set("x-access-token", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+}
+
+func TestJWTMiddlewareRejectsRevoked(t *testing.T) {
+	store := configureRevocation(t, time.Minute)
+	get := protectedApp(t)
+	store.revoke("stolen")
+
+	if got := get("stolen"); got != fiber.StatusUnauthorized {
+		t.Errorf("revoked token = %d, want 401", got)
+	}
+	if got := get("other"); got != fiber.StatusOK {
+		t.Errorf("another token of the same player = %d, want 200", got)
+	}
+	if got := get(""); got != fiber.StatusOK {
+		t.Errorf("token without a jti = %d, want 200 unchecked", got)
+	}
+	lookups := store.lookups
+	for i := 0; i < 5; i++ {
+		get("stolen")
+		get("other")
+	}
+	if store.lookups != lookups {
+		t.Errorf("%d lookups for cached answers, want none", store.lookups-lookups)
+	}
+}
+
+func TestRevocationCacheExpiry(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	store := configureRevocation(t, ttl)
+	get := protectedApp(t)
+
+	if got := get("jti-1"); got != fiber.StatusOK {
+		t.Fatalf("live token = %d, want 200", got)
+	}
+	// Revoked by another process: the cached answer holds until ttl
+	store.revoke("jti-1")
+	if got := get("jti-1"); got != fiber.StatusOK {
+		t.Errorf("within the cache ttl = %d, want the cached 200", got)
+	}
+	time.Sleep(2 * ttl)
+	if got := get("jti-1"); got != fiber.StatusUnauthorized {
+		t.Errorf("after the cache ttl = %d, want 401", got)
+	}
+
+	// A revoked answer is kept past ttl, until the token expires
+	store.mu.Lock()
+	delete(store.revoked, "jti-1")
+	store.mu.Unlock()
+	time.Sleep(2 * ttl)
+	if got := get("jti-1"); got != fiber.StatusUnauthorized {
+		t.Errorf("revoked token after ttl = %d, want still 401", got)
+	}
+}
+
+func TestMarkTokensRevokedSkipsCache(t *testing.T) {
+	configureRevocation(t, time.Hour)
+	get := protectedApp(t)
+	if got := get("jti-1"); got != fiber.StatusOK {
+		t.Fatalf("live token = %d, want 200", got)
+	}
+	MarkTokensRevoked("jti-1")
+	if got := get("jti-1"); got != fiber.StatusUnauthorized {
+		t.Errorf("after logout in this process = %d, want 401 at once", got)
+	}
+}
+
+func TestRevocationErrorsNotCached(t *testing.T) {
+	store := configureRevocation(t, time.Hour)
+	get := protectedApp(t)
+	store.err = errors.New("connection refused")
+	if got := get("jti-1"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("failed lookup = %d, want 503", got)
+	}
+	store.err = nil
+	if got := get("jti-1"); got != fiber.StatusOK {
+		t.Errorf("after the store recovered = %d, want 200", got)
+	}
+}
+
+func TestRevocationCacheBounded(t *testing.T) {
+	configureRevocation(t, time.Hour)
+	for i := 0; i < maxRevocationCacheEntries+10; i++ {
+		setRevocation(NewReference(RefBet), false, time.Now().Add(time.Hour))
+	}
+	revocation.mu.RLock()
+	n := len(revocation.items)
+	revocation.mu.RUnlock()
+	if n > maxRevocationCacheEntries {
+		t.Errorf("%d cached answers, want at most %d", n, maxRevocationCacheEntries)
+	}
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fiberapp/clock"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// NormalizeRow returns a copy of a raw database row that marshals to plain
+// JSON: NUMERIC becomes a number, times become RFC3339 strings in the
+// business zone, byte slices become strings and NULLs stay null. Apply it
+// to any "SELECT *" map before it goes into a response.
+func NormalizeRow(row map[string]interface{}) map[string]interface{} {
+	if row == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		out[k] = NormalizeValue(v)
+	}
+	return out
+}
+
+// NormalizeRows applies NormalizeRow to each row. A nil slice becomes an
+// empty one so the response carries [] rather than null.
+func NormalizeRows(rows []map[string]interface{}) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		out[i] = NormalizeRow(row)
+	}
+	return out
+}
+
+// NormalizeValue converts a single value as NormalizeRow does, descending
+// into maps and slices
+func NormalizeValue(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case pgtype.Numeric:
+		if !x.Valid || x.NaN || x.InfinityModifier != pgtype.Finite {
+			return nil
+		}
+		f, err := x.Float64Value()
+		if err != nil || !f.Valid {
+			return nil
+		}
+		return f.Float64
+	case float64:
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return nil
+		}
+		return x
+	case float32:
+		return NormalizeValue(float64(x))
+	case time.Time:
+		return x.In(clock.Location()).Format(time.RFC3339)
+	case pgtype.Timestamp:
+		if !x.Valid || x.InfinityModifier != pgtype.Finite {
+			return nil
+		}
+		return NormalizeValue(x.Time)
+	case pgtype.Timestamptz:
+		if !x.Valid || x.InfinityModifier != pgtype.Finite {
+			return nil
+		}
+		return NormalizeValue(x.Time)
+	case pgtype.Date:
+		if !x.Valid || x.InfinityModifier != pgtype.Finite {
+			return nil
+		}
+		return x.Time.Format("2006-01-02")
+	case []byte:
+		return string(x)
+	case [16]byte:
+		return fmt.Sprintf("%x-%x-%x-%x-%x", x[0:4], x[4:6], x[6:8], x[8:10], x[10:16])
+	case map[string]interface{}:
+		return NormalizeRow(x)
+	case []map[string]interface{}:
+		return NormalizeRows(x)
+	case []interface{}:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = NormalizeValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// NumericFloat reads a NUMERIC column from a raw row. NULL, NaN and
+// values of other types that do not parse read as 0.
+func NumericFloat(v interface{}) float64 {
+	if n, ok := v.(pgtype.Numeric); ok {
+		f, err := n.Float64Value()
+		if err != nil || !f.Valid || math.IsNaN(f.Float64) || math.IsInf(f.Float64, 0) {
+			return 0
+		}
+		return f.Float64
+	}
+	return ToFloat64(v)
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func numeric(unscaled int64, exp int32) pgtype.Numeric {
+	return pgtype.Numeric{Int: big.NewInt(unscaled), Exp: exp, Valid: true}
+}
+
+// TestNormalizeRowJSONContract marshals rows shaped like the ones /user and
+// the history endpoints return and checks no pgx internals reach the JSON
+func TestNormalizeRowJSONContract(t *testing.T) {
+	created := time.Date(2026, 3, 1, 21, 30, 0, 0, time.UTC)
+	row := map[string]interface{}{
+		"id":             int32(7),
+		"msisdn":         "254712345678",
+		"balance":        numeric(12345, -2),
+		"bonus":          pgtype.Numeric{},
+		"payout":         pgtype.Numeric{NaN: true, Valid: true},
+		"date_created":   created,
+		"last_bet":       pgtype.Timestamp{Time: created, Valid: true},
+		"expiry":         pgtype.Timestamptz{},
+		"day":            pgtype.Date{Time: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Valid: true},
+		"items":          []byte(`1,2,3`),
+		"uuid":           [16]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 1, 2, 3, 4, 5, 6, 7, 8},
+		"name":           nil,
+		"rtp":            math.NaN(),
+		"nested":         map[string]interface{}{"amount": numeric(5, 1)},
+		"history":        []map[string]interface{}{{"stake": numeric(100, 0)}},
+		"selected_boxes": []interface{}{numeric(3, 0), "x"},
+	}
+
+	out, err := json.Marshal(NormalizeRow(row))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, internal := range []string{`"Int"`, `"Exp"`, `"NaN"`, `"Valid"`, `"InfinityModifier"`, `"Time"`} {
+		if strings.Contains(string(out), internal) {
+			t.Errorf("JSON %s carries pgtype field %s", out, internal)
+		}
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"id":             float64(7),
+		"msisdn":         "254712345678",
+		"balance":        123.45,
+		"bonus":          nil,
+		"payout":         nil,
+		"date_created":   "2026-03-02T00:30:00+03:00",
+		"last_bet":       "2026-03-02T00:30:00+03:00",
+		"expiry":         nil,
+		"day":            "2026-03-01",
+		"items":          "1,2,3",
+		"uuid":           "12345678-9abc-def0-0102-030405060708",
+		"name":           nil,
+		"rtp":            nil,
+		"nested":         map[string]interface{}{"amount": float64(50)},
+		"history":        []interface{}{map[string]interface{}{"stake": float64(100)}},
+		"selected_boxes": []interface{}{float64(3), "x"},
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("normalized row\n got %s\nwant %s", gotJSON, wantJSON)
+	}
+}
+
+func TestNormalizeRowsEmpty(t *testing.T) {
+	out, _ := json.Marshal(NormalizeRows(nil))
+	if string(out) != "[]" {
+		t.Errorf("NormalizeRows(nil) = %s, want []", out)
+	}
+	if NormalizeRow(nil) != nil {
+		t.Error("NormalizeRow(nil) should stay nil")
+	}
+}
+
+func TestNormalizeRowLeavesInputAlone(t *testing.T) {
+	row := map[string]interface{}{"balance": numeric(1, 0)}
+	NormalizeRow(row)
+	if _, ok := row["balance"].(pgtype.Numeric); !ok {
+		t.Error("NormalizeRow must return a copy, not rewrite the row")
+	}
+}
+
+func TestNumericFloat(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want float64
+	}{
+		{numeric(12345, -2), 123.45},
+		{pgtype.Numeric{}, 0}, // NULL balance, which used to panic
+		{pgtype.Numeric{NaN: true, Valid: true}, 0},
+		{nil, 0},
+		{float64(9.5), 9.5},
+		{"42", 42},
+	}
+	for _, tc := range cases {
+		if got := NumericFloat(tc.in); got != tc.want {
+			t.Errorf("NumericFloat(%#v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
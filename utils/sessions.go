@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSessionTouchInterval = time.Minute
+	maxSessionTouchEntries      = 10000
+	sessionTouchTimeout         = 2 * time.Second
+)
+
+// SessionTouch records that the session on access token jti was just used
+type SessionTouch func(ctx context.Context, jti string) error
+
+// sessionTouch remembers when each jti was last touched so JWTMiddleware
+// writes last_seen at most once per interval per token and process
+var sessionTouch = struct {
+	mu       sync.Mutex
+	touch    SessionTouch
+	interval time.Duration
+	touched  map[string]time.Time
+}{touched: make(map[string]time.Time)}
+
+// ConfigureSessionTouch makes JWTMiddleware call touch, in the background,
+// for a token it has not touched within interval. Without a touch nothing
+// is recorded.
+func ConfigureSessionTouch(touch SessionTouch, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultSessionTouchInterval
+	}
+	sessionTouch.mu.Lock()
+	defer sessionTouch.mu.Unlock()
+	sessionTouch.touch = touch
+	sessionTouch.interval = interval
+	sessionTouch.touched = make(map[string]time.Time)
+}
+
+// touchSession records use of the token with claims when it is due
+func touchSession(claims jwt.MapClaims) {
+	jti, _ := claims["jti"].(string)
+	if jti == "" || !sessionTouchDue(jti, time.Now()) {
+		return
+	}
+	sessionTouch.mu.Lock()
+	touch := sessionTouch.touch
+	sessionTouch.mu.Unlock()
+
+	GoBackground("session touch", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionTouchTimeout)
+		defer cancel()
+		if err := touch(ctx, jti); err != nil {
+			logrus.Warnf("session touch failed: %v", err)
+		}
+	})
+}
+
+// sessionTouchDue reports whether jti was last touched more than interval
+// before now, and if so notes it as touched at now
+func sessionTouchDue(jti string, now time.Time) bool {
+	sessionTouch.mu.Lock()
+	defer sessionTouch.mu.Unlock()
+	if sessionTouch.touch == nil {
+		return false
+	}
+	if last, ok := sessionTouch.touched[jti]; ok && now.Sub(last) < sessionTouch.interval {
+		return false
+	}
+	if len(sessionTouch.touched) >= maxSessionTouchEntries {
+		for k, last := range sessionTouch.touched {
+			if now.Sub(last) >= sessionTouch.interval {
+				delete(sessionTouch.touched, k)
+			}
+		}
+		// Still full of recent entries: start over rather than grow unbounded
+		if len(sessionTouch.touched) >= maxSessionTouchEntries {
+			sessionTouch.touched = make(map[string]time.Time)
+		}
+	}
+	sessionTouch.touched[jti] = now
+	return true
+}
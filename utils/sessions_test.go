@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// touchLog records the jtis a SessionTouch was called with
+type touchLog struct {
+	mu      sync.Mutex
+	touched []string
+	err     error
+}
+
+func (l *touchLog) touch(ctx context.Context, jti string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.touched = append(l.touched, jti)
+	return l.err
+}
+
+func (l *touchLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.touched)
+}
+
+func configureTouch(t *testing.T, interval time.Duration) *touchLog {
+	t.Helper()
+	log := &touchLog{}
+	ConfigureSessionTouch(log.touch, interval)
+	t.Cleanup(func() { ConfigureSessionTouch(nil, 0) })
+	return log
+}
+
+func TestSessionTouchSampled(t *testing.T) {
+	configureTouch(t, time.Minute)
+	now := time.Now()
+
+	if !sessionTouchDue("a", now) {
+		t.Fatal("first use not due")
+	}
+	if sessionTouchDue("a", now.Add(59*time.Second)) {
+		t.Error("due again within the interval")
+	}
+	if !sessionTouchDue("b", now.Add(time.Second)) {
+		t.Error("another token not due")
+	}
+	if !sessionTouchDue("a", now.Add(time.Minute)) {
+		t.Error("not due once the interval passed")
+	}
+}
+
+func TestSessionTouchWithoutToucher(t *testing.T) {
+	ConfigureSessionTouch(nil, time.Minute)
+	if sessionTouchDue("a", time.Now()) {
+		t.Error("due with nothing to record it")
+	}
+}
+
+func TestSessionTouchBounded(t *testing.T) {
+	configureTouch(t, time.Minute)
+	now := time.Now()
+	for i := 0; i < maxSessionTouchEntries+10; i++ {
+		sessionTouchDue(NewReference("T"), now)
+	}
+	if n := len(sessionTouch.touched); n > maxSessionTouchEntries {
+		t.Errorf("%d tokens remembered, want at most %d", n, maxSessionTouchEntries)
+	}
+}
+
+func TestJWTMiddlewareTouchesSessionOncePerInterval(t *testing.T) {
+	configureTestAuth(t)
+	log := configureTouch(t, time.Hour)
+	get := protectedApp(t)
+
+	for i := 0; i < 5; i++ {
+		get("session-1")
+	}
+	get("session-2")
+	get("")
+	if err := WaitBackground(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.count(); got != 2 {
+		t.Errorf("%d touches for 5 requests on one token and 1 on another, want 2: %v", got, log.touched)
+	}
+
+	log.err = errors.New("database down")
+	if got := get("session-3"); got != 200 {
+		t.Errorf("request with a failing touch = %d, want 200", got)
+	}
+}
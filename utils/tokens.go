@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fiberapp/auth"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// AccessTokenTTL is the lifetime of the JWT handed out after login
+const AccessTokenTTL = 48 * time.Hour
+
+// Roles signed into the "role" claim of an access token. RequireRole
+// checks them.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// SignAccessToken returns a JWT for msisdn with role, valid for
+// AccessTokenTTL from now, identified by jti and signed with the current
+// auth key. A role other than RoleAdmin is signed as RoleUser. The caller
+// records jti so the token can be revoked.
+func SignAccessToken(msisdn, role, jti string, now time.Time) (string, error) {
+	if role != RoleAdmin {
+		role = RoleUser
+	}
+	claims := jwt.MapClaims{
+		"jti":  jti,
+		"sub":  msisdn,
+		"iat":  now.Unix(),
+		"exp":  now.Add(AccessTokenTTL).Unix(),
+		"role": role,
+	}
+	return auth.Sign(claims)
+}
+
+// NewTokenID returns a random jti for an access token
+func NewTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash to store
+func NewRefreshToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken is the form refresh tokens are stored and looked up in
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"fiberapp/auth"
+	"fiberapp/config"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func configureTestAuth(t *testing.T) {
+	t.Helper()
+	if err := auth.Configure(config.AuthConfig{JWTKeyID: "test", JWTSecret: "test-signing-key", OTPKey: "test-otp-key"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignAccessTokenRole(t *testing.T) {
+	configureTestAuth(t)
+	now := time.Now()
+	cases := map[string]string{RoleAdmin: RoleAdmin, RoleUser: RoleUser, "": RoleUser, "root": RoleUser}
+	for role, want := range cases {
+		token, err := SignAccessToken("254712345678", role, "jti-1", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := auth.Verify(token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims["role"] != want || claims["sub"] != "254712345678" || claims["jti"] != "jti-1" {
+			t.Errorf("role %q signed as %v", role, claims)
+		}
+	}
+}
+
+func TestRequireRoleAdmin(t *testing.T) {
+	configureTestAuth(t)
+	app := fiber.New()
+	app.Get("/admin/stats", JWTMiddleware(), RequireRole(RoleAdmin), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	get := func(role string) int {
+		req := httptest.NewRequest("GET", "/admin/stats", nil)
+		if role != "-" {
+			token, err := SignAccessToken("254712345678", role, "", time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("x-access-token", "Bearer "+token)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := get(RoleAdmin); got != fiber.StatusOK {
+		t.Errorf("admin token = %d, want 200", got)
+	}
+	if got := get(RoleUser); got != fiber.StatusForbidden {
+		t.Errorf("player token = %d, want 403", got)
+	}
+	if got := get("-"); got != fiber.StatusUnauthorized {
+		t.Errorf("no token = %d, want 401", got)
+	}
+}
+
+func TestParsePage(t *testing.T) {
+	cases := []struct {
+		page, size string
+		want       Page
+		err        bool
+	}{
+		{"", "", Page{1, DefaultPageSize}, false},
+		{"3", "10", Page{3, 10}, false},
+		{" 2 ", "500", Page{2, MaxPageSize}, false},
+		{"0", "", Page{}, true},
+		{"1", "-5", Page{}, true},
+		{"x", "", Page{}, true},
+	}
+	for _, tc := range cases {
+		got, err := ParsePage(tc.page, tc.size)
+		if (err != nil) != tc.err || got != tc.want {
+			t.Errorf("ParsePage(%q, %q) = %+v, %v; want %+v", tc.page, tc.size, got, err, tc.want)
+		}
+	}
+
+	p := Page{Number: 3, Size: 20}
+	if p.Offset() != 40 {
+		t.Errorf("offset of page 3 = %d, want 40", p.Offset())
+	}
+	for total, want := range map[int64]int{0: 0, 1: 1, 20: 1, 21: 2, 100: 5, -1: 0} {
+		if got := p.TotalPages(total); got != want {
+			t.Errorf("TotalPages(%d) = %d, want %d", total, got, want)
+		}
+	}
+}